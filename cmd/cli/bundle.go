@@ -0,0 +1,111 @@
+package main
+
+import (
+	"archive/tar"
+	"clawrden/internal/jailhouse"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxBundleFileSize bounds each file unpacked from a bundle.
+const maxBundleFileSize = 256 << 20
+
+// RenderJail downloads a jail's bundle and unpacks it into outDir.
+func (c *Client) RenderJail(ctx context.Context, jailID, outDir string) error {
+	resp, err := c.do(ctx, http.MethodGet, "/api/jails/"+url.PathEscape(jailID)+"/bundle", nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := unpackBundle(resp.Body, outDir); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(filepath.Join(outDir, jailhouse.BundleManifest))
+	if err != nil {
+		return err
+	}
+	var manifest jailhouse.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("parse manifest: %w", err)
+	}
+	snippet, err := os.ReadFile(filepath.Join(outDir, jailhouse.BundleDockerfile))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Rendered jail %s to %s (%d commands", manifest.JailID, outDir, len(manifest.Links))
+	if manifest.Hardened {
+		fmt.Print(", hardened")
+	}
+	fmt.Println(")")
+	fmt.Printf("\nAdd to your Dockerfile (%s):\n\n%s", jailhouse.BundleDockerfile, snippet)
+	return nil
+}
+
+// unpackBundle extracts a bundle tarball into dir. Bundles contain only
+// regular files at the top level; anything else is rejected rather than
+// written.
+func unpackBundle(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("read bundle: %w", err)
+	}
+	defer gz.Close()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read bundle: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return fmt.Errorf("bundle entry %q is not a regular file", hdr.Name)
+		}
+		if hdr.Name == "" || hdr.Name == "." || hdr.Name == ".." || strings.ContainsAny(hdr.Name, `/\`) {
+			return fmt.Errorf("bundle entry %q is not a plain file name", hdr.Name)
+		}
+		if hdr.Size > maxBundleFileSize {
+			return fmt.Errorf("bundle entry %q is too large (%d bytes)", hdr.Name, hdr.Size)
+		}
+
+		// Replace rather than open existing files: a read-only shim from an
+		// earlier render can't be opened for writing, and a symlink would be
+		// followed
+		path := filepath.Join(dir, hdr.Name)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		_, copyErr := io.Copy(f, io.LimitReader(tr, hdr.Size))
+		closeErr := f.Close()
+		if copyErr != nil {
+			return fmt.Errorf("write %s: %w", path, copyErr)
+		}
+		if closeErr != nil {
+			return closeErr
+		}
+		if err := os.Chmod(path, os.FileMode(hdr.Mode).Perm()); err != nil {
+			return err
+		}
+	}
+}
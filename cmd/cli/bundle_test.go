@@ -0,0 +1,82 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type tarEntry struct {
+	name     string
+	typeflag byte
+	body     string
+}
+
+func makeTarball(t *testing.T, entries []tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Typeflag: e.typeflag, Mode: 0644, Size: int64(len(e.body))}
+		if e.typeflag == tar.TypeSymlink {
+			hdr.Linkname, hdr.Size = "/etc/passwd", 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("WriteHeader: %v", err)
+		}
+		if hdr.Size > 0 {
+			tw.Write([]byte(e.body))
+		}
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestUnpackBundle(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+	data := makeTarball(t, []tarEntry{
+		{name: "manifest.json", typeflag: tar.TypeReg, body: "{}"},
+		{name: "install.sh", typeflag: tar.TypeReg, body: "#!/bin/sh\n"},
+	})
+	if err := unpackBundle(bytes.NewReader(data), dir); err != nil {
+		t.Fatalf("unpackBundle: %v", err)
+	}
+	// Unpacking again replaces the files
+	if err := unpackBundle(bytes.NewReader(data), dir); err != nil {
+		t.Fatalf("second unpackBundle: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "manifest.json")); string(got) != "{}" {
+		t.Errorf("manifest.json = %q", got)
+	}
+}
+
+func TestUnpackBundleRejectsUnsafeEntries(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry tarEntry
+		want  string
+	}{
+		{"parent path", tarEntry{name: "../evil", typeflag: tar.TypeReg, body: "x"}, "not a plain file name"},
+		{"nested path", tarEntry{name: "bin/npm", typeflag: tar.TypeReg, body: "x"}, "not a plain file name"},
+		{"absolute path", tarEntry{name: "/tmp/evil", typeflag: tar.TypeReg, body: "x"}, "not a plain file name"},
+		{"symlink", tarEntry{name: "npm", typeflag: tar.TypeSymlink}, "not a regular file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := t.TempDir()
+			err := unpackBundle(bytes.NewReader(makeTarball(t, []tarEntry{tt.entry})), filepath.Join(parent, "out"))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("unpackBundle error = %v, want %q", err, tt.want)
+			}
+			if _, err := os.Lstat(filepath.Join(parent, "evil")); err == nil {
+				t.Error("entry was written outside the output directory")
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"clawrden/internal/cliout"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// defaultTimeout bounds each API call unless --timeout overrides it.
+const defaultTimeout = 10 * time.Second
+
+var (
+	errTimeout     = errors.New("timed out")
+	errUnreachable = errors.New("connection refused")
+	errCancelled   = errors.New("cancelled")
+)
+
+// Client is the HTTP client for the Warden API.
+type Client struct {
+	baseURL string
+	http    *http.Client
+	timeout time.Duration
+	out     cliout.Options // Table rendering options
+}
+
+// NewClient creates an API client whose requests time out after timeout
+// (defaultTimeout if zero).
+func NewClient(baseURL string, timeout time.Duration, out cliout.Options) *Client {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		http:    &http.Client{Timeout: timeout},
+		timeout: timeout,
+		out:     out,
+	}
+}
+
+// StatusError is returned when the warden answers with an unexpected status.
+type StatusError struct {
+	Code int
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("warden returned HTTP %d %s", e.Code, http.StatusText(e.Code))
+	}
+	return fmt.Sprintf("warden returned HTTP %d: %s", e.Code, e.Body)
+}
+
+// do sends a request and returns the response if its status is want.
+// The caller must close the response body.
+func (c *Client) do(ctx context.Context, method, path string, body io.Reader, want int) (*http.Response, error) {
+	return c.doHeader(ctx, method, path, nil, body, want)
+}
+
+// doHeader is do with extra request headers.
+func (c *Client) doHeader(ctx context.Context, method, path string, header http.Header, body io.Reader, want int) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, c.classify(err)
+	}
+
+	if resp.StatusCode != want {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &StatusError{Code: resp.StatusCode, Body: strings.TrimSpace(string(msg))}
+	}
+	return resp, nil
+}
+
+// classify turns transport errors into messages that tell an unreachable
+// warden apart from a hung one.
+func (c *Client) classify(err error) error {
+	var timeoutErr interface{ Timeout() bool }
+	switch {
+	case errors.Is(err, context.Canceled):
+		return fmt.Errorf("request to warden at %s %w", c.baseURL, errCancelled)
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &timeoutErr) && timeoutErr.Timeout()):
+		return fmt.Errorf("warden at %s %w after %v", c.baseURL, errTimeout, c.timeout)
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return fmt.Errorf("cannot reach warden at %s: %w (is it running?)", c.baseURL, errUnreachable)
+	}
+	return fmt.Errorf("request to warden at %s failed: %w", c.baseURL, err)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"clawrden/internal/cliout"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client := NewClient(srv.URL, 50*time.Millisecond, cliout.Options{})
+
+	start := time.Now()
+	err := client.Status(context.Background())
+	if !errors.Is(err, errTimeout) {
+		t.Fatalf("Status error = %v, want timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("timeout took %v", elapsed)
+	}
+	if !strings.Contains(err.Error(), "timed out after 50ms") {
+		t.Errorf("error message = %q", err)
+	}
+}
+
+func TestClientCancelled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL, time.Minute, cliout.Options{})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	if err := client.Queue(ctx); !errors.Is(err, errCancelled) {
+		t.Fatalf("Queue error = %v, want cancelled", err)
+	}
+}
+
+func TestClientConnectionRefused(t *testing.T) {
+	// Grab a free port and close it so nothing is listening
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	client := NewClient("http://"+addr, time.Second, cliout.Options{})
+	err = client.History(context.Background(), nil)
+	if !errors.Is(err, errUnreachable) {
+		t.Fatalf("History error = %v, want connection refused", err)
+	}
+}
+
+func TestClientStatusError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			t.Errorf("method = %s, want DELETE", r.Method)
+		}
+		http.Error(w, "jail not found: ghost", http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL, time.Second, cliout.Options{})
+	_, err := client.DeleteJail(context.Background(), "ghost", false)
+
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != http.StatusNotFound {
+		t.Fatalf("DeleteJail error = %v, want StatusError 404", err)
+	}
+	if statusErr.Body != "jail not found: ghost" {
+		t.Errorf("Body = %q", statusErr.Body)
+	}
+}
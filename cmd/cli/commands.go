@@ -0,0 +1,374 @@
+package main
+
+import (
+	"clawrden/internal/cliout"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Exit codes of clawrden-cli.
+const (
+	exitOK      = 0
+	exitFailure = 1 // The command ran and failed
+	exitUsage   = 2 // The command line was wrong; nothing ran
+)
+
+// runFunc carries out a command once its flags are parsed, with its
+// positional arguments.
+type runFunc func(ctx context.Context, env *cmdEnv, args []string) error
+
+// wardenUse is how a command picks the wardens it talks to.
+type wardenUse int
+
+const (
+	useOne       wardenUse = iota // Exactly one warden, as env.client
+	useSelection                  // Checks env.targets itself; may fan out or look up IDs
+	useNone                       // Talks to no warden
+)
+
+// command is an entry of the command registry. Dispatch, `help` and
+// `commands --json` are all generated from it.
+type command struct {
+	name    string   // Words that run it, e.g. "jails create"
+	args    []string // Positional arguments, e.g. "<id>"; a last one with "..." takes any number
+	summary string
+	details string // More help, shown by `help <command>`
+	group   string // Heading in the top-level usage
+	wardens wardenUse
+
+	// setup defines the command's flags on fs and returns its runner; nil
+	// for a name that only groups subcommands
+	setup func(fs *flag.FlagSet) runFunc
+}
+
+// commandGroups orders the headings of the top-level usage.
+var commandGroups = []string{"Requests", "Audit", "Operations", "Policy", "Jails", "CLI"}
+
+// noFlags is the setup of a command without flags.
+func noFlags(run runFunc) func(*flag.FlagSet) runFunc {
+	return func(*flag.FlagSet) runFunc { return run }
+}
+
+// cmdEnv is what a running command gets from the command line.
+type cmdEnv struct {
+	out        cliout.Options
+	ws         *wardens
+	targets    []target // The wardens the command line selected
+	selectErr  error    // Why none could be
+	client     *Client  // The one selected warden, for useOne
+	config     *cliConfig
+	configPath string
+	global     *flag.FlagSet // Options before the command
+	stdout     io.Writer
+}
+
+// fansOut reports whether a useSelection command should query every
+// selected warden rather than env.client.
+func (e *cmdEnv) fansOut() (bool, error) {
+	if e.selectErr != nil {
+		return false, e.selectErr
+	}
+	return e.ws.all, nil
+}
+
+// usageError is a mistake on the command line found by a command's runner,
+// such as a missing required flag. It is reported like a parse error.
+type usageError struct{ msg string }
+
+func (e *usageError) Error() string { return e.msg }
+
+func usagef(format string, args ...any) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// errQuiet fails a command that has already said why.
+var errQuiet = errors.New("command failed")
+
+// lookupCommand returns the registered command args name, the longest
+// match of its leading words, and the arguments after them.
+func lookupCommand(args []string) (*command, []string) {
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		return nil, args
+	}
+	rest := args[1:]
+	for len(rest) > 0 {
+		sub := findCommand(cmd.name + " " + rest[0])
+		if sub == nil {
+			break
+		}
+		cmd, rest = sub, rest[1:]
+	}
+	return cmd, rest
+}
+
+// findCommand returns the command with the given name, or nil.
+func findCommand(name string) *command {
+	for _, cmd := range registry() {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// subcommands returns the commands one word below cmd.
+func (cmd *command) subcommands() []*command {
+	var subs []*command
+	for _, c := range registry() {
+		rest, ok := strings.CutPrefix(c.name, cmd.name+" ")
+		if ok && !strings.Contains(rest, " ") {
+			subs = append(subs, c)
+		}
+	}
+	return subs
+}
+
+// flagSet returns cmd's flags, quiet so that errors and help are written
+// by the caller, and its runner.
+func (cmd *command) flagSet() (*flag.FlagSet, runFunc) {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Usage = func() {}
+	var run runFunc
+	if cmd.setup != nil {
+		run = cmd.setup(fs)
+	}
+	return fs, run
+}
+
+// usageLine shows how cmd is typed, e.g.
+// "clawrden-cli [options] jails create <id> [flags]".
+func (cmd *command) usageLine(fs *flag.FlagSet) string {
+	line := "clawrden-cli [options] " + cmd.name
+	if cmd.setup == nil {
+		return line + " <subcommand>"
+	}
+	if len(cmd.args) > 0 {
+		line += " " + strings.Join(cmd.args, " ")
+	}
+	if hasFlags(fs) {
+		line += " [flags]"
+	}
+	return line
+}
+
+// hasFlags reports whether fs defines any flag.
+func hasFlags(fs *flag.FlagSet) bool {
+	found := false
+	fs.VisitAll(func(*flag.Flag) { found = true })
+	return found
+}
+
+// variadic reports whether cmd's last argument takes any number of words.
+func (cmd *command) variadic() bool {
+	return len(cmd.args) > 0 && strings.Contains(cmd.args[len(cmd.args)-1], "...")
+}
+
+// parseArgs parses cmd's flags, which may come before, between or after its
+// positional arguments, and returns the positional arguments.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional, args = append(positional, args[0]), args[1:]
+	}
+}
+
+// checkArgs compares the positional arguments given to a runnable command
+// with the ones it takes.
+func (cmd *command) checkArgs(args []string) error {
+	if cmd.setup == nil {
+		if len(args) > 0 {
+			return usagef("unknown subcommand %q", args[0])
+		}
+		return usagef("missing <subcommand>")
+	}
+	want := len(cmd.args)
+	if cmd.variadic() {
+		want--
+	}
+	switch {
+	case len(args) < want:
+		return usagef("missing %s", strings.Join(cmd.args[len(args):want], " "))
+	case len(args) > want && !cmd.variadic():
+		if len(cmd.subcommands()) > 0 && len(cmd.args) == 0 {
+			return usagef("unknown subcommand %q", args[0])
+		}
+		return usagef("unexpected argument %q", args[want])
+	}
+	return nil
+}
+
+// printUsageError reports a command line mistake with the part of the
+// usage that explains it.
+func printUsageError(w io.Writer, cmd *command, fs *flag.FlagSet, err error) {
+	fmt.Fprintf(w, "error: %s: %v\n\n", cmd.name, err)
+	fmt.Fprintf(w, "Usage: %s\n", cmd.usageLine(fs))
+	if subs := cmd.subcommands(); len(subs) > 0 {
+		fmt.Fprintln(w, "\nSubcommands:")
+		printCommandList(w, subs)
+	}
+	if hasFlags(fs) {
+		fmt.Fprintln(w, "\nFlags:")
+		fs.SetOutput(w)
+		fs.PrintDefaults()
+		fs.SetOutput(io.Discard)
+	}
+	fmt.Fprintf(w, "\nRun 'clawrden-cli help %s' for details.\n", cmd.name)
+}
+
+// printHelp writes the full help of cmd.
+func printHelp(w io.Writer, cmd *command) {
+	fs, _ := cmd.flagSet()
+	fmt.Fprintf(w, "Usage: %s\n", cmd.usageLine(fs))
+	if cmd.summary != "" {
+		fmt.Fprintf(w, "\n%s\n", cmd.summary)
+	}
+	if cmd.details != "" {
+		fmt.Fprintf(w, "\n%s\n", cmd.details)
+	}
+	if subs := cmd.subcommands(); len(subs) > 0 {
+		fmt.Fprintln(w, "\nSubcommands:")
+		printCommandList(w, subs)
+	}
+	if hasFlags(fs) {
+		fmt.Fprintln(w, "\nFlags:")
+		fs.SetOutput(w)
+		fs.PrintDefaults()
+	}
+}
+
+// printUsage writes the top-level usage: the commands by group, then the
+// options that go before them.
+func printUsage(w io.Writer, global *flag.FlagSet) {
+	fmt.Fprintf(w, "clawrden-cli v%s - Clawrden Control Interface\n\n", version)
+	fmt.Fprintf(w, "Usage: clawrden-cli [options] <command> [arguments] [flags]\n")
+	for _, group := range commandGroups {
+		var cmds []*command
+		for _, cmd := range registry() {
+			if cmd.group == group && cmd.setup != nil {
+				cmds = append(cmds, cmd)
+			}
+		}
+		fmt.Fprintf(w, "\n%s:\n", group)
+		printCommandList(w, cmds)
+	}
+	printOptions(w, global)
+	fmt.Fprintln(w, "\nRun 'clawrden-cli help <command>' for a command's arguments and flags.")
+}
+
+// printOptions writes the options that go before the command.
+func printOptions(w io.Writer, global *flag.FlagSet) {
+	fmt.Fprintln(w, "\nOptions:")
+	global.SetOutput(w)
+	global.PrintDefaults()
+	global.SetOutput(io.Discard)
+}
+
+// printCommandList writes one line per runnable command: how it is typed
+// and its summary.
+func printCommandList(w io.Writer, cmds []*command) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, cmd := range cmds {
+		if cmd.setup == nil {
+			continue
+		}
+		fmt.Fprintf(tw, "  %s\t%s\n", strings.TrimSpace(cmd.name+" "+strings.Join(cmd.args, " ")), cmd.summary)
+	}
+	tw.Flush()
+}
+
+// helpCommand runs `help [command...]`.
+func helpCommand(ctx context.Context, env *cmdEnv, args []string) error {
+	if len(args) == 0 {
+		printUsage(env.stdout, env.global)
+		return nil
+	}
+	cmd, rest := lookupCommand(args)
+	if cmd == nil || len(rest) > 0 {
+		return usagef("unknown command: %s", strings.Join(args, " "))
+	}
+	printHelp(env.stdout, cmd)
+	return nil
+}
+
+// commandInfo describes a command in `commands --json`.
+type commandInfo struct {
+	Name        string     `json:"name"`
+	Args        []string   `json:"args,omitempty"`
+	Summary     string     `json:"summary,omitempty"`
+	Details     string     `json:"details,omitempty"`
+	Group       string     `json:"group"`
+	Runnable    bool       `json:"runnable"` // False for names that only group subcommands
+	Flags       []flagInfo `json:"flags,omitempty"`
+	Subcommands []string   `json:"subcommands,omitempty"`
+}
+
+// flagInfo describes one of a command's flags.
+type flagInfo struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"` // e.g. string, duration, bool
+	Default string `json:"default,omitempty"`
+	Usage   string `json:"usage"`
+}
+
+// describeCommands returns the registry as `commands --json` shows it.
+func describeCommands() []commandInfo {
+	var infos []commandInfo
+	for _, cmd := range registry() {
+		info := commandInfo{
+			Name:     cmd.name,
+			Args:     cmd.args,
+			Summary:  cmd.summary,
+			Details:  cmd.details,
+			Group:    cmd.group,
+			Runnable: cmd.setup != nil,
+		}
+		fs, _ := cmd.flagSet()
+		fs.VisitAll(func(f *flag.Flag) {
+			typ, usage := flag.UnquoteUsage(f)
+			if typ == "" {
+				typ = "bool"
+			}
+			info.Flags = append(info.Flags, flagInfo{Name: f.Name, Type: typ, Default: f.DefValue, Usage: usage})
+		})
+		for _, sub := range cmd.subcommands() {
+			info.Subcommands = append(info.Subcommands, sub.name)
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// commandsCommand runs `commands [--json]`.
+func commandsCommand(fs *flag.FlagSet) runFunc {
+	asJSON := fs.Bool("json", false, "Print every command with its arguments and flags as JSON")
+	return func(ctx context.Context, env *cmdEnv, args []string) error {
+		infos := describeCommands()
+		if *asJSON {
+			enc := json.NewEncoder(env.stdout)
+			enc.SetIndent("", "  ")
+			enc.SetEscapeHTML(false)
+			return enc.Encode(infos)
+		}
+		for _, info := range infos {
+			if info.Runnable {
+				fmt.Fprintln(env.stdout, info.Name)
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// checkGolden compares got against testdata/<name>.golden.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.MkdirAll("testdata", 0755); err != nil {
+			t.Fatalf("update golden: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("update golden: %v", err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output mismatch for %s\n--- got ---\n%s\n--- want ---\n%s", name, got, want)
+	}
+}
+
+func TestHelpOutput(t *testing.T) {
+	for _, tc := range []struct {
+		golden string
+		args   []string
+	}{
+		{"help", []string{"help"}},
+		{"help", []string{"-h"}},
+		{"help_jails_create", []string{"help", "jails", "create"}},
+		{"help_jails_create", []string{"jails", "create", "-h"}},
+		{"help_policy", []string{"help", "policy"}},
+		{"help_approve", []string{"approve", "--help"}},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := run(tc.args, &stdout, &stderr); code != exitOK {
+			t.Errorf("%v exited with %d: %s", tc.args, code, stderr.String())
+			continue
+		}
+		checkGolden(t, tc.golden, stdout.Bytes())
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want string // In the error line
+		hint string // Elsewhere in the output
+	}{
+		{nil, "", "Usage: clawrden-cli [options] <command>"},
+		{[]string{"frobnicate"}, "error: unknown command: frobnicate", "clawrden-cli help"},
+		{[]string{"-bogus", "status"}, "error: flag provided but not defined: -bogus", "-target string"},
+		{[]string{"jails", "create"}, "error: jails create: missing <id>", "-commands string"},
+		{[]string{"jails", "create", "dev", "--color"}, "error: jails create: flag provided but not defined: -color", "-hardened"},
+		{[]string{"jails", "create", "dev"}, "error: jails create: --commands is required", "help jails create"},
+		{[]string{"jails", "bogus"}, `error: jails: unknown subcommand "bogus"`, "jails prune-unused <id>"},
+		{[]string{"policy"}, "error: policy: missing <subcommand>", "policy adopt <command>"},
+		{[]string{"approve", "req-1", "req-2"}, `error: approve: unexpected argument "req-2"`, "-strategy string"},
+		{[]string{"logs"}, "error: logs: missing <id>", "-f\t"},
+		{[]string{"explain", "--last", "--command", "npm"}, "error: explain: give one of --last", "-since string"},
+		{[]string{"jails", "apply", "jails.yaml", "--yes", "--dry-run"}, "error: jails apply: --yes and --dry-run cannot be combined", "-prune"},
+		{[]string{"help", "jails", "nope"}, "error: help: unknown command: jails nope", ""},
+	} {
+		var stdout, stderr bytes.Buffer
+		// Runners that get this far must fail before reaching a warden
+		args := append([]string{"--api", "http://127.0.0.1:0"}, tc.args...)
+		if code := run(args, &stdout, &stderr); code != exitUsage {
+			t.Errorf("%v exited with %d, want %d", tc.args, code, exitUsage)
+		}
+		out := stderr.String()
+		if !strings.HasPrefix(out, tc.want) || !strings.Contains(out, tc.hint) {
+			t.Errorf("%v printed:\n%s\nwant %q first and %q", tc.args, out, tc.want, tc.hint)
+		}
+		if stdout.Len() > 0 {
+			t.Errorf("%v printed to stdout: %s", tc.args, stdout.String())
+		}
+	}
+}
+
+func TestFlagsAfterArguments(t *testing.T) {
+	cmd, rest := lookupCommand([]string{"approve", "req-1", "--strategy", "ghost", "-m", "ok"})
+	if cmd == nil || cmd.name != "approve" {
+		t.Fatalf("lookup = %v", cmd)
+	}
+	fs, _ := cmd.flagSet()
+	args, err := parseArgs(fs, rest)
+	if err != nil || len(args) != 1 || args[0] != "req-1" {
+		t.Fatalf("parseArgs = %v, %v", args, err)
+	}
+	if got := fs.Lookup("strategy").Value.String(); got != "ghost" {
+		t.Errorf("--strategy = %q", got)
+	}
+	if got := fs.Lookup("m").Value.String(); got != "ok" {
+		t.Errorf("-m = %q", got)
+	}
+}
+
+func TestCommandsJSON(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"commands", "--json"}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("exited with %d: %s", code, stderr.String())
+	}
+	var infos []commandInfo
+	if err := json.Unmarshal(stdout.Bytes(), &infos); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	byName := map[string]commandInfo{}
+	for _, info := range infos {
+		byName[info.Name] = info
+	}
+	if len(byName) != len(registry()) {
+		t.Errorf("%d commands listed, want %d", len(byName), len(registry()))
+	}
+
+	create := byName["jails create"]
+	if len(create.Args) != 1 || create.Args[0] != "<id>" || create.Group != "Jails" || !create.Runnable {
+		t.Errorf("jails create = %+v", create)
+	}
+	var timeout flagInfo
+	for _, f := range byName["approve"].Flags {
+		if f.Name == "exec-timeout" {
+			timeout = f
+		}
+	}
+	if timeout.Type != "string" || timeout.Usage == "" {
+		t.Errorf("approve --exec-timeout = %+v", timeout)
+	}
+	if policy := byName["policy"]; policy.Runnable || len(policy.Subcommands) != 6 {
+		t.Errorf("policy = %+v", policy)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	seen := map[string]bool{}
+	for _, cmd := range registry() {
+		if seen[cmd.name] {
+			t.Errorf("%s registered twice", cmd.name)
+		}
+		seen[cmd.name] = true
+		if cmd.summary == "" {
+			t.Errorf("%s has no summary", cmd.name)
+		}
+		if !strings.Contains(" "+strings.Join(commandGroups, " ")+" ", " "+cmd.group+" ") {
+			t.Errorf("%s is in unknown group %q", cmd.name, cmd.group)
+		}
+		// Subcommands come after the commands they belong to
+		if parent, _, ok := strings.Cut(cmd.name, " "); ok && !seen[parent] {
+			t.Errorf("%s registered before %s", cmd.name, parent)
+		}
+		cmd.flagSet() // Panics on flags defined twice
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"clawrden/internal/cliout"
+	"cmp"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+// adminTokenEnv holds the admin token for commands that need one.
+const adminTokenEnv = "CLAWRDEN_ADMIN_TOKEN"
+
+// reviewerTokenEnv holds the reviewer token sent with approvals and denials.
+const reviewerTokenEnv = "CLAWRDEN_REVIEWER_TOKEN"
+
+// remoteConfig mirrors the warden's /api/config report.
+type remoteConfig struct {
+	Settings map[string]struct {
+		Value  any    `json:"value"`
+		Flag   string `json:"flag"`
+		Source string `json:"source"`
+	} `json:"settings"`
+	Features map[string]any `json:"features"`
+}
+
+// configShowCommand runs `config show`: the CLI's own config file, or
+// with --remote the warden's effective configuration.
+func configShowCommand(fs *flag.FlagSet) runFunc {
+	remote := fs.Bool("remote", false, "Show the warden's effective configuration instead of the CLI's")
+	raw := fs.Bool("json", false, "Print the warden's report as JSON")
+	tokenFile := fs.String("admin-token-file", "", "File holding the warden's admin token (default: $"+adminTokenEnv+")")
+	return func(ctx context.Context, env *cmdEnv, args []string) error {
+		if !*remote {
+			printCLIConfig(os.Stdout, env.config, env.configPath)
+			return nil
+		}
+		token := os.Getenv(adminTokenEnv)
+		if *tokenFile != "" {
+			data, err := os.ReadFile(*tokenFile)
+			if err != nil {
+				return err
+			}
+			token = strings.TrimSpace(string(data))
+		}
+		return env.client.RemoteConfig(ctx, os.Stdout, token, *raw)
+	}
+}
+
+// printCLIConfig shows the config file the CLI read and the wardens it names.
+func printCLIConfig(w io.Writer, cfg *cliConfig, path string) {
+	fmt.Fprintf(w, "Config file: %s\n", cmp.Or(path, "(none)"))
+	if len(cfg.Targets) == 0 {
+		fmt.Fprintln(w, "Targets: none")
+		return
+	}
+	fmt.Fprintln(w, "Targets:")
+	names := make([]string, 0, len(cfg.Targets))
+	for name := range cfg.Targets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		line := fmt.Sprintf("  %s: %s", name, cfg.Targets[name])
+		if name == cfg.Default {
+			line += " (default)"
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// RemoteConfig shows the warden's effective configuration: its settings,
+// where each came from, and the state of its features. The endpoint needs
+// the warden's admin token.
+func (c *Client) RemoteConfig(ctx context.Context, w io.Writer, token string, raw bool) error {
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := c.doHeader(ctx, http.MethodGet, "/api/config", header, nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if raw {
+		_, err := io.Copy(w, resp.Body)
+		return err
+	}
+
+	var report remoteConfig
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return err
+	}
+	table := cliout.NewTable(c.out,
+		cliout.Column{Name: "SETTING"},
+		cliout.Column{Name: "VALUE", MaxWidth: 60},
+		cliout.Column{Name: "SOURCE"},
+		cliout.Column{Name: "FLAG"},
+	)
+	names := make([]string, 0, len(report.Settings))
+	for name := range report.Settings {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		s := report.Settings[name]
+		source := cliout.Plain(cmp.Or(s.Source, "-"))
+		if s.Source == "flag" {
+			source = cliout.Colored(s.Source, cliout.Yellow)
+		}
+		table.AddRow(cliout.Plain(name), cliout.Plain(configValue(s.Value)), source, cliout.Plain(cmp.Or(s.Flag, "-")))
+	}
+	if err := table.Render(w); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "\nFeatures:")
+	var lines []string
+	flattenConfig("", report.Features, &lines)
+	slices.Sort(lines)
+	for _, line := range lines {
+		fmt.Fprintf(w, "  %s\n", line)
+	}
+	return nil
+}
+
+// configValue renders a setting's value: strings as they are, "-" for
+// nothing, the rest as JSON.
+func configValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "-"
+	case string:
+		return cmp.Or(v, "-")
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// flattenConfig appends "a.b.c: value" lines for every leaf of v.
+func flattenConfig(prefix string, v any, lines *[]string) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			flattenConfig(join(key), value, lines)
+		}
+	case []any:
+		if len(v) == 0 {
+			*lines = append(*lines, prefix+": -")
+		}
+		for i, value := range v {
+			flattenConfig(join(fmt.Sprint(i)), value, lines)
+		}
+	default:
+		*lines = append(*lines, prefix+": "+configValue(v))
+	}
+}
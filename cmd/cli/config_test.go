@@ -0,0 +1,42 @@
+package main
+
+import (
+	"clawrden/internal/cliout"
+	"clawrden/pkg/wardentest"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRemoteConfig(t *testing.T) {
+	const token = "admin-secret-for-tests"
+	w := wardentest.StartTestWarden(t, wardentest.Options{
+		API:        true,
+		Policy:     wardentest.AllowPolicy("ls"),
+		AdminToken: token,
+	})
+	client := NewClient(w.APIURL, 0, cliout.Options{Wide: true})
+	ctx := context.Background()
+
+	var out strings.Builder
+	if err := client.RemoteConfig(ctx, &out, "", false); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("without the admin token: err = %v, want 401", err)
+	}
+	if err := client.RemoteConfig(ctx, &out, token, false); err != nil {
+		t.Fatalf("RemoteConfig: %v", err)
+	}
+	text := out.String()
+	if strings.Contains(text, token) {
+		t.Errorf("output shows the admin token:\n%s", text)
+	}
+	for _, want := range []string{"admin_token", "[redacted]", "admin-token-file", "audit_path", w.AuditPath, "Features:", "api.admin: token", "audit.backend: file"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("output lacks %q:\n%s", want, text)
+		}
+	}
+
+	out.Reset()
+	if err := client.RemoteConfig(ctx, &out, token, true); err != nil || !strings.HasPrefix(out.String(), "{") {
+		t.Errorf("--json output = %q, %v", out.String(), err)
+	}
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bytes"
+	"clawrden/pkg/protocol"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// explainedEntry mirrors the audit entry fields `explain` shows.
+type explainedEntry struct {
+	Timestamp string   `json:"timestamp"`
+	RequestID string   `json:"request_id"`
+	Command   string   `json:"command"`
+	Args      []string `json:"args"`
+	Cwd       string   `json:"cwd"`
+	Identity  struct {
+		UID    int   `json:"uid"`
+		GID    int   `json:"gid"`
+		Groups []int `json:"groups"`
+	} `json:"identity"`
+	GroupNames  []string          `json:"group_names"`
+	JailID      string            `json:"jail_id"`
+	Image       string            `json:"image"`
+	ImageDigest string            `json:"image_digest"`
+	Decision    protocol.Decision `json:"decision"`
+	Outcome     protocol.Outcome  `json:"outcome"`
+	Detail      string            `json:"detail"`
+	Rule        string            `json:"rule"`
+	Reason      string            `json:"reason"`
+	PolicyHash  string            `json:"policy_hash"`
+	Resolution  string            `json:"resolution"`
+	Error       string            `json:"error"`
+}
+
+// explainable reports whether the entry was denied or asked for review,
+// the decisions operators want explained.
+func (e *explainedEntry) explainable() bool {
+	return e.Decision == protocol.DecisionDeny || e.Resolution != ""
+}
+
+// evaluationRequest is the body of /api/policy/evaluate.
+type evaluationRequest struct {
+	Command  string   `json:"command"`
+	Args     []string `json:"args"`
+	Cwd      string   `json:"cwd"`
+	Identity struct {
+		UID    int   `json:"uid"`
+		GID    int   `json:"gid"`
+		Groups []int `json:"groups"`
+	} `json:"identity"`
+	JailID      string `json:"jail_id,omitempty"`
+	Image       string `json:"image,omitempty"`
+	ImageDigest string `json:"image_digest,omitempty"`
+}
+
+// policyEvaluation mirrors the warden's /api/policy/evaluate response.
+type policyEvaluation struct {
+	Decision     protocol.Decision `json:"decision"`
+	Outcome      protocol.Outcome  `json:"outcome"`
+	Rule         string            `json:"rule"`
+	Reason       string            `json:"reason"`
+	AllowedPaths []string          `json:"allowed_paths"`
+	PolicyHash   string            `json:"policy_hash"`
+}
+
+// label shows the evaluation's decision as the audit log would, e.g.
+// "deny (path violation)".
+func (ev policyEvaluation) label() string {
+	return protocol.FormatDecision(ev.Decision, ev.Outcome, "")
+}
+
+// maxArgDrops bounds how many arguments explain tries dropping, keeping the
+// number of evaluations small for long command lines.
+const maxArgDrops = 16
+
+// explainCommand runs `explain`.
+func explainCommand(fs *flag.FlagSet) runFunc {
+	last := fs.Bool("last", false, "Explain the most recent denied or reviewed request")
+	request := fs.String("request", "", "Explain the request with this ID")
+	command := fs.String("command", "", "Explain the most recent denied or reviewed request of this command")
+	since := fs.String("since", "", "Only look this far back (e.g. 10m, 2d)")
+	return func(ctx context.Context, env *cmdEnv, args []string) error {
+		query, err := explainQuery(*last, *request, *command, *since)
+		if err != nil {
+			return err
+		}
+		return env.client.Explain(ctx, query, os.Stdout)
+	}
+}
+
+// explainQuery builds the history query selecting the entries to explain.
+// Exactly one of last, request and command must be given.
+func explainQuery(last bool, request, command, since string) (url.Values, error) {
+	chosen := 0
+	for _, set := range []bool{last, request != "", command != ""} {
+		if set {
+			chosen++
+		}
+	}
+	if chosen != 1 {
+		return nil, usagef("give one of --last, --request <id> and --command <name>")
+	}
+	query := url.Values{}
+	if request != "" {
+		query.Set("request_id", request)
+	}
+	if command != "" {
+		query.Set("command", command)
+	}
+	if since != "" {
+		query.Set("since", since)
+	}
+	return query, nil
+}
+
+// Explain shows the most recent audit entry matching query that was denied
+// or reviewed (or, for a request ID, whatever was decided), with what the
+// policy in force decides for it now and which small changes to the
+// request would have been allowed.
+func (c *Client) Explain(ctx context.Context, query url.Values, w io.Writer) error {
+	path := "/api/history?" + query.Encode()
+	resp, err := c.do(ctx, http.MethodGet, path, nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var entries []explainedEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return err
+	}
+
+	var entry *explainedEntry
+	for i := len(entries) - 1; i >= 0 && entry == nil; i-- {
+		if query.Has("request_id") || entries[i].explainable() {
+			entry = &entries[i]
+		}
+	}
+	if entry == nil {
+		if query.Has("request_id") {
+			return fmt.Errorf("no audited request with ID %s", query.Get("request_id"))
+		}
+		return errors.New("no denied or reviewed request found")
+	}
+
+	printEntry(w, entry)
+	req := evaluationRequest{
+		Command:     entry.Command,
+		Args:        entry.Args,
+		Cwd:         entry.Cwd,
+		Identity:    entry.Identity,
+		JailID:      entry.JailID,
+		Image:       entry.Image,
+		ImageDigest: entry.ImageDigest,
+	}
+	now, err := c.evaluate(ctx, req)
+	if err != nil {
+		return fmt.Errorf("evaluate policy: %w", err)
+	}
+	if entry.PolicyHash != "" && now.PolicyHash != entry.PolicyHash {
+		fmt.Fprintf(w, "\nThe policy has changed since (now %s).\n", shortHash(now.PolicyHash))
+	}
+
+	fmt.Fprintln(w, "\nWhy:")
+	fmt.Fprintf(w, "  %s\n", why(entry, now))
+	if !policyDecided(entry.Decision, entry.Outcome) {
+		return nil
+	}
+	if rank(now.Decision, now.Outcome) < rank(entry.Decision, entry.Outcome) {
+		fmt.Fprintf(w, "  The policy in force now decides %s%s.\n", now.label(), byRule(now.Rule))
+		return nil
+	}
+
+	found := false
+	for _, p := range perturbations(req, now) {
+		ev, err := c.evaluate(ctx, p.req)
+		if err != nil {
+			return fmt.Errorf("evaluate policy: %w", err)
+		}
+		if rank(ev.Decision, ev.Outcome) >= rank(now.Decision, now.Outcome) {
+			continue
+		}
+		if !found {
+			fmt.Fprintln(w, "\nWould have been decided differently:")
+			found = true
+		}
+		fmt.Fprintf(w, "  %s: %s%s\n", p.change, ev.label(), byRule(ev.Rule))
+	}
+	if !found {
+		fmt.Fprintln(w, "\nNo small change to the request is decided differently; the policy itself would have to change.")
+	}
+	return nil
+}
+
+// printEntry shows what the audit log recorded for a request.
+func printEntry(w io.Writer, e *explainedEntry) {
+	fmt.Fprintf(w, "Request:   %s (%s)\n", e.RequestID, localTime(e.Timestamp))
+	fmt.Fprintf(w, "Command:   %s\n", strings.TrimSpace(e.Command+" "+strings.Join(e.Args, " ")))
+	fmt.Fprintf(w, "Cwd:       %s\n", e.Cwd)
+	identity := fmt.Sprintf("uid %d, gid %d", e.Identity.UID, e.Identity.GID)
+	if len(e.GroupNames) > 0 {
+		identity += " (groups " + strings.Join(e.GroupNames, ",") + ")"
+	}
+	fmt.Fprintf(w, "Identity:  %s\n", identity)
+	if e.JailID != "" {
+		fmt.Fprintf(w, "Jail:      %s\n", e.JailID)
+	}
+	if e.Image != "" {
+		fmt.Fprintf(w, "Image:     %s\n", e.Image)
+	}
+	fmt.Fprintf(w, "Decision:  %s\n", protocol.FormatDecision(e.Decision, e.Outcome, e.Detail))
+	if e.Rule != "" {
+		fmt.Fprintf(w, "Rule:      %s\n", e.Rule)
+	}
+	if e.Reason != "" {
+		fmt.Fprintf(w, "Reason:    %s\n", e.Reason)
+	}
+	if e.Error != "" {
+		fmt.Fprintf(w, "Error:     %s\n", e.Error)
+	}
+	if e.PolicyHash != "" {
+		fmt.Fprintf(w, "Policy:    %s\n", shortHash(e.PolicyHash))
+	}
+}
+
+// why says in one line what decided the audited request.
+func why(e *explainedEntry, now policyEvaluation) string {
+	switch {
+	case e.Outcome == protocol.OutcomePathViolation:
+		if nearest := nearestPattern(e.Cwd, now.AllowedPaths); nearest != "" {
+			return fmt.Sprintf("cwd %s is outside allowed_paths; nearest allowed pattern %s", e.Cwd, nearest)
+		}
+		return fmt.Sprintf("cwd %s is outside allowed_paths", e.Cwd)
+	case !policyDecided(e.Decision, e.Outcome):
+		why := "refused before the policy was evaluated: " + protocol.FormatDecision(e.Decision, e.Outcome, e.Detail)
+		if e.Error != "" {
+			why += " (" + e.Error + ")"
+		}
+		return why
+	case e.Rule == "":
+		return fmt.Sprintf("no rule matched; default_action %s decided", policyAction(e))
+	case e.Reason != "":
+		return fmt.Sprintf("matched %s %s %q", policyAction(e), e.Rule, e.Reason)
+	}
+	return fmt.Sprintf("matched %s %s", policyAction(e), e.Rule)
+}
+
+// policyAction is the policy action behind an audited decision: "ask" for
+// reviewed requests, whatever the reviewer decided.
+func policyAction(e *explainedEntry) string {
+	if e.Resolution != "" {
+		return "ask"
+	}
+	return e.Decision.String()
+}
+
+// policyDecided reports whether the policy, rather than the warden's state
+// (lockdowns, maintenance, an unwritable audit log...), decided a request.
+func policyDecided(decision protocol.Decision, outcome protocol.Outcome) bool {
+	if decision != protocol.DecisionAllow && decision != protocol.DecisionDeny {
+		return false
+	}
+	return outcome == protocol.OutcomeNone || outcome == protocol.OutcomePathViolation || outcome.Reviewed()
+}
+
+// rank orders decisions from most to least permissive. Reviewed requests
+// rank as asks.
+func rank(decision protocol.Decision, outcome protocol.Outcome) int {
+	switch {
+	case decision == protocol.DecisionAsk || outcome.Reviewed():
+		return 1
+	case decision == protocol.DecisionAllow:
+		return 0
+	}
+	return 2
+}
+
+// perturbation is a small change to a request that explain evaluates.
+type perturbation struct {
+	change string // What was changed, e.g. "without argument --force"
+	req    evaluationRequest
+}
+
+// perturbations lists the changes worth trying: for a refused cwd, a
+// directory under each allowed path; otherwise the request without each of
+// its arguments in turn.
+func perturbations(req evaluationRequest, now policyEvaluation) []perturbation {
+	var out []perturbation
+	if now.Outcome == protocol.OutcomePathViolation {
+		for _, pattern := range now.AllowedPaths {
+			dir := strings.TrimSuffix(pattern, "/*")
+			if strings.ContainsAny(dir, "*?[") {
+				continue // No single directory stands for the pattern
+			}
+			p := perturbation{change: "cwd " + dir, req: req}
+			p.req.Cwd = dir
+			out = append(out, p)
+		}
+		return out
+	}
+	for i, arg := range req.Args {
+		if i == maxArgDrops {
+			break
+		}
+		p := perturbation{change: "without argument " + arg, req: req}
+		p.req.Args = append(append([]string{}, req.Args[:i]...), req.Args[i+1:]...)
+		out = append(out, p)
+	}
+	return out
+}
+
+// nearestPattern returns the allowed path pattern sharing the longest
+// leading directories with cwd.
+func nearestPattern(cwd string, patterns []string) string {
+	best, bestLen := "", -1
+	for _, pattern := range patterns {
+		if n := commonDirs(cwd, strings.TrimSuffix(pattern, "/*")); n > bestLen {
+			best, bestLen = pattern, n
+		}
+	}
+	return best
+}
+
+// commonDirs counts the leading path elements a and b share.
+func commonDirs(a, b string) int {
+	as := strings.Split(filepath.Clean(a), "/")
+	bs := strings.Split(filepath.Clean(b), "/")
+	n := 0
+	for n < len(as) && n < len(bs) && as[n] == bs[n] {
+		n++
+	}
+	return n
+}
+
+// evaluate asks the warden what its policy decides for req.
+func (c *Client) evaluate(ctx context.Context, req evaluationRequest) (policyEvaluation, error) {
+	var ev policyEvaluation
+	body, err := json.Marshal(req)
+	if err != nil {
+		return ev, err
+	}
+	resp, err := c.do(ctx, http.MethodPost, "/api/policy/evaluate", bytes.NewReader(body), http.StatusOK)
+	if err != nil {
+		return ev, err
+	}
+	defer resp.Body.Close()
+	err = json.NewDecoder(resp.Body).Decode(&ev)
+	return ev, err
+}
+
+// byRule names the rule behind a decision, if one decided it.
+func byRule(rule string) string {
+	if rule == "" {
+		return " (default_action)"
+	}
+	return " by " + rule
+}
+
+// shortHash abbreviates a policy hash for display.
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+// localTime formats an audit timestamp in local time, or returns it as is.
+func localTime(timestamp string) string {
+	t, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return timestamp
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"clawrden/internal/cliout"
+	"clawrden/pkg/wardentest"
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	w := wardentest.StartTestWarden(t, wardentest.Options{
+		API: true,
+		Policy: &wardentest.Policy{
+			DefaultAction: wardentest.Deny,
+			AllowedPaths:  []string{"/srv/app/*", filepath.Join(os.TempDir(), "*")},
+			Rules: []wardentest.Rule{
+				{Command: "git", Args: []string{"--force"}, Action: wardentest.Deny, Reason: "no force push"},
+				{Command: "git", Action: wardentest.Allow},
+				{Command: "ls", Action: wardentest.Allow},
+			},
+		},
+	})
+	w.SendRequest(t, wardentest.NewRequest("git", "push", "--force", "origin", "main"))
+	outside := wardentest.NewRequest("ls", "-la")
+	outside.Cwd = "/srv/data/logs"
+	w.SendRequest(t, outside)
+	entries := w.WaitAudit(t, 2)
+	client := NewClient(w.APIURL, 0, cliout.Options{})
+
+	forcePush := []string{
+		"Command:   git push --force origin main",
+		"Rule:      rule 1 (git)",
+		"Reason:    no force push",
+		`matched deny rule 1 (git) "no force push"`,
+		"without argument --force: allow by rule 2 (git)",
+	}
+	tests := []struct {
+		name    string
+		query   url.Values
+		want    []string
+		notWant []string
+	}{
+		{"last", url.Values{}, []string{
+			"Decision:  deny (path violation)",
+			"cwd /srv/data/logs is outside allowed_paths; nearest allowed pattern /srv/app/*",
+			"cwd /srv/app: allow by rule 3 (ls)",
+		}, nil},
+		{"command", url.Values{"command": {"git"}, "since": {"10m"}}, forcePush, []string{"without argument push"}},
+		{"request", url.Values{"request_id": {entries[0].RequestID}}, forcePush, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			if err := client.Explain(context.Background(), tt.query, &out); err != nil {
+				t.Fatalf("Explain: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("output lacks %q:\n%s", want, out.String())
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(out.String(), notWant) {
+					t.Errorf("output has %q:\n%s", notWant, out.String())
+				}
+			}
+		})
+	}
+
+	if err := client.Explain(context.Background(), url.Values{"request_id": {"req-missing"}}, &strings.Builder{}); err == nil || !strings.Contains(err.Error(), "no audited request") {
+		t.Errorf("Explain of an unknown request = %v", err)
+	}
+}
+
+func TestExplainQuery(t *testing.T) {
+	if _, err := explainQuery(false, "", "", "10m"); err == nil {
+		t.Error("explainQuery accepted no selection")
+	}
+	if _, err := explainQuery(true, "req-1", "", ""); err == nil {
+		t.Error("explainQuery accepted --last with --request")
+	}
+	if q, err := explainQuery(false, "", "npm", "10m"); err != nil || q.Encode() != "command=npm&since=10m" {
+		t.Errorf("explainQuery(--command npm --since 10m) = %v, %v", q, err)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"clawrden/internal/cliout"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// historyExportCommand parses `history export` flags and downloads the
+// export.
+func historyExportCommand(fs *flag.FlagSet) runFunc {
+	format := fs.String("format", "csv", "Export format: csv or jsonl")
+	since := fs.String("since", "", "Only entries newer than this (e.g., 90d, 12h, 2026-01-01)")
+	until := fs.String("until", "", "Only entries before this date or RFC 3339 time")
+	command := fs.String("command", "", "Only entries for this command")
+	decision := fs.String("decision", "", "Only entries with this decision (e.g., deny)")
+	outcome := fs.String("outcome", "", "Only entries with this outcome (e.g., after_hitl)")
+	task := fs.String("task", "", "Only entries for this task ID (CLAWRDEN_TASK_ID)")
+	output := fs.String("o", "", "Write to this file instead of stdout")
+	return func(ctx context.Context, env *cmdEnv, args []string) error {
+		if all, err := env.fansOut(); err != nil {
+			return err
+		} else if all {
+			return errors.New("--all is not supported; export each warden with --target")
+		}
+
+		query := url.Values{"format": {*format}}
+		for key, value := range map[string]string{"since": *since, "until": *until, "command": *command, "decision": *decision, "outcome": *outcome, "task_id": *task} {
+			if value != "" {
+				query.Set(key, value)
+			}
+		}
+
+		if *output == "" {
+			_, err := env.client.ExportHistory(ctx, query, os.Stdout)
+			return err
+		}
+
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		n, err := env.client.ExportHistory(ctx, query, file)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(*output) // Never leave a truncated export behind
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Exported %s to %s\n", cliout.FormatBytes(n), *output)
+		return nil
+	}
+}
+
+// ExportHistory streams /api/history/export with the given query to w and
+// returns the number of bytes written. Unlike other calls it has no overall
+// timeout, since large exports take a while; only the response headers must
+// arrive in time.
+func (c *Client) ExportHistory(ctx context.Context, query url.Values, w io.Writer) (int64, error) {
+	stream := *c
+	stream.http = &http.Client{Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		ResponseHeaderTimeout: c.timeout,
+	}}
+	resp, err := stream.do(ctx, http.MethodGet, "/api/history/export?"+query.Encode(), nil, http.StatusOK)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		return n, c.classify(err)
+	}
+	return n, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"clawrden/internal/cliout"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportHistoryStreams(t *testing.T) {
+	var gotQuery url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.Query()
+		w.Header().Set("Content-Type", "text/csv")
+		w.Write([]byte("timestamp,argv\n"))
+		w.(http.Flusher).Flush()
+		// Slower than the client's timeout, which only bounds the headers
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("2026-01-05T10:00:00Z,ls -la\n"))
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL, 50*time.Millisecond, cliout.Options{})
+	var out bytes.Buffer
+	n, err := client.ExportHistory(context.Background(), url.Values{"format": {"csv"}, "since": {"90d"}}, &out)
+	if err != nil {
+		t.Fatalf("ExportHistory: %v", err)
+	}
+	if gotQuery.Get("format") != "csv" || gotQuery.Get("since") != "90d" {
+		t.Errorf("query = %v", gotQuery)
+	}
+	if n != int64(out.Len()) || !strings.HasSuffix(out.String(), "ls -la\n") {
+		t.Errorf("wrote %d bytes: %q", n, out.String())
+	}
+}
+
+func TestRenderCollapsedHistory(t *testing.T) {
+	rows := single([]map[string]interface{}{
+		{"timestamp": "2026-01-05T10:00:00Z", "command": "ls", "args": []interface{}{"-la"}, "decision": "allow",
+			"duration_ms": 12.0, "count": 3.0, "min_duration_ms": 7.0, "max_duration_ms": 30.0},
+		{"timestamp": "2026-01-05T10:00:06Z", "command": "rm", "args": []interface{}{"-rf", "/"}, "decision": "deny",
+			"count": 1.0},
+	})
+	var buf bytes.Buffer
+	if err := renderHistory(cliout.Options{}, rows, false, true, &buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[0], "COUNT") {
+		t.Fatalf("table:\n%s", buf.String())
+	}
+	if f := strings.Fields(lines[1]); len(f) < 3 || f[1] != "3" || !strings.Contains(lines[1], "7-30ms") {
+		t.Errorf("ls row = %q, want count 3 and durations 7-30ms", lines[1])
+	}
+	if f := strings.Fields(lines[2]); len(f) < 3 || f[1] != "1" {
+		t.Errorf("rm row = %q, want count 1", lines[2])
+	}
+
+	// Plain history has no COUNT column
+	buf.Reset()
+	renderHistory(cliout.Options{}, rows, false, false, &buf)
+	if strings.Contains(buf.String(), "COUNT") {
+		t.Errorf("uncollapsed table has a COUNT column:\n%s", buf.String())
+	}
+}
+
+func TestRenderUnfinishedHistory(t *testing.T) {
+	rows := single([]map[string]interface{}{
+		{"timestamp": "2026-01-05T10:00:00Z", "command": "make", "decision": "allow", "phase": "started", "completed": "unknown"},
+	})
+	var buf bytes.Buffer
+	renderHistory(cliout.Options{}, rows, false, false, &buf)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], "unknown") {
+		t.Errorf("table:\n%s\nwant the exit shown as unknown", buf.String())
+	}
+}
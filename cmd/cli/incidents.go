@@ -0,0 +1,91 @@
+package main
+
+import (
+	"clawrden/internal/cliout"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// incident mirrors the warden's /api/incidents entries.
+type incident struct {
+	ID        string     `json:"id"`
+	Subject   string     `json:"subject"`
+	Trigger   string     `json:"trigger"`
+	Reason    string     `json:"reason"`
+	Commands  []string   `json:"commands"`
+	Lockdown  bool       `json:"lockdown"`
+	OpenedAt  time.Time  `json:"opened_at"`
+	ClearedAt *time.Time `json:"cleared_at"`
+}
+
+// Incidents lists incidents, newest first.
+func (c *Client) Incidents(ctx context.Context) error {
+	resp, err := c.do(ctx, http.MethodGet, "/api/incidents", nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var incidents []incident
+	if err := json.NewDecoder(resp.Body).Decode(&incidents); err != nil {
+		return err
+	}
+
+	if len(incidents) == 0 {
+		fmt.Println("No incidents")
+		return nil
+	}
+
+	table := cliout.NewTable(c.out,
+		cliout.Column{Name: "ID"},
+		cliout.Column{Name: "SUBJECT", MaxWidth: 24},
+		cliout.Column{Name: "STATE"},
+		cliout.Column{Name: "OPENED"},
+		cliout.Column{Name: "REASON", MaxWidth: 40},
+		cliout.Column{Name: "COMMANDS", MaxWidth: 40},
+	)
+	for _, inc := range incidents {
+		state, color := "open", cliout.Yellow
+		switch {
+		case inc.ClearedAt != nil:
+			state, color = "cleared", cliout.Dim
+		case inc.Lockdown:
+			state, color = "lockdown", cliout.Red
+		}
+		table.AddRow(
+			cliout.Plain(inc.ID),
+			cliout.Plain(inc.Subject),
+			cliout.Colored(state, color),
+			cliout.Plain(inc.OpenedAt.Local().Format("2006-01-02 15:04:05")),
+			cliout.Plain(inc.Reason),
+			cliout.Plain(strings.Join(inc.Commands, "; ")),
+		)
+	}
+	return table.Render(os.Stdout)
+}
+
+// ClearIncident clears an incident, lifting any lockdown it imposed.
+func (c *Client) ClearIncident(ctx context.Context, id string) error {
+	resp, err := c.do(ctx, http.MethodPost, "/api/incidents/"+url.PathEscape(id)+"/clear", nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var inc incident
+	if err := json.NewDecoder(resp.Body).Decode(&inc); err != nil {
+		return err
+	}
+	if inc.Lockdown {
+		fmt.Printf("Incident %s cleared; lockdown of %s lifted\n", inc.ID, inc.Subject)
+	} else {
+		fmt.Printf("Incident %s cleared\n", inc.ID)
+	}
+	return nil
+}
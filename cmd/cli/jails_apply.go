@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bytes"
+	"clawrden/internal/jailhouse"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// jailManifest is the file `jails apply` reads:
+//
+//	jails:
+//	  - id: ci
+//	    commands: [npm, git]
+//	    hardened: true
+//	    rules:
+//	      - command: npm
+//	        action: allow
+type jailManifest struct {
+	Jails []manifestJail `yaml:"jails"`
+}
+
+// manifestJail is one jail of a manifest. Rules are in the policy file's
+// rule format.
+type manifestJail struct {
+	ID       string           `yaml:"id"`
+	Commands []string         `yaml:"commands"`
+	Hardened bool             `yaml:"hardened"`
+	Rules    []map[string]any `yaml:"rules,omitempty"`
+
+	// Jails created over the API have neither; they are read only to say so
+	Labels map[string]string `yaml:"labels,omitempty"`
+	TTL    string            `yaml:"ttl,omitempty"`
+}
+
+// jailState is a jail as GET /api/jails lists it.
+type jailState struct {
+	JailID   string          `json:"jail_id"`
+	Commands []string        `json:"commands"`
+	Hardened bool            `json:"hardened"`
+	Rules    json.RawMessage `json:"rules"`
+}
+
+// Jail plan actions
+const (
+	jailCreate    = "create"
+	jailUpdate    = "update"   // Commands or rules change in place
+	jailRecreate  = "recreate" // Hardening changes, which needs a new jail
+	jailDelete    = "delete"   // Only with --prune
+	jailUnchanged = "unchanged"
+)
+
+// jailChange is one step of a `jails apply` plan.
+type jailChange struct {
+	JailID      string
+	Action      string
+	Add, Remove []string // Commands, for updates
+	Rules       bool     // The rules change, for updates
+	Hardened    bool     // Hardening before a recreate
+	want        *manifestJail
+}
+
+// readJailManifest reads and checks a manifest file.
+func readJailManifest(path string) (*jailManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var m jailManifest
+	if err := dec.Decode(&m); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	seen := map[string]bool{}
+	for _, j := range m.Jails {
+		switch {
+		case j.ID == "":
+			return nil, fmt.Errorf("%s: a jail has no id", path)
+		case seen[j.ID]:
+			return nil, fmt.Errorf("%s: jail %s is listed twice", path, j.ID)
+		case len(j.Commands) == 0:
+			return nil, fmt.Errorf("%s: jail %s has no commands", path, j.ID)
+		case len(j.Labels) > 0 || j.TTL != "":
+			return nil, fmt.Errorf("%s: jail %s: labels and ttl are not supported; jails created over the API have neither (label containers to get jails that come and go with them)", path, j.ID)
+		}
+		seen[j.ID] = true
+	}
+	return &m, nil
+}
+
+// rulesJSON returns a manifest jail's rules as the jails API takes them;
+// nil without rules.
+func (j *manifestJail) rulesJSON() (json.RawMessage, error) {
+	if len(j.Rules) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(j.Rules)
+}
+
+// planJailApply works out what brings the jails the warden has in line with
+// the manifest. Jails the manifest does not list are deleted only with
+// prune. Manifest jails come first, in manifest order, then deletions.
+func planJailApply(m *jailManifest, current []jailState, prune bool) ([]jailChange, error) {
+	have := make(map[string]jailState, len(current))
+	for _, j := range current {
+		have[j.JailID] = j
+	}
+
+	var plan []jailChange
+	listed := map[string]bool{}
+	for i := range m.Jails {
+		want := &m.Jails[i]
+		listed[want.ID] = true
+		change := jailChange{JailID: want.ID, want: want}
+
+		cur, ok := have[want.ID]
+		switch {
+		case !ok:
+			change.Action = jailCreate
+		case cur.Hardened != want.Hardened:
+			change.Action = jailRecreate
+			change.Hardened = cur.Hardened
+		default:
+			change.Add, change.Remove = diffCommands(cur.Commands, want.Commands)
+			rules, err := want.rulesJSON()
+			if err != nil {
+				return nil, fmt.Errorf("jail %s rules: %w", want.ID, err)
+			}
+			change.Rules = !sameRules(cur.Rules, rules)
+			change.Action = jailUnchanged
+			if len(change.Add) > 0 || len(change.Remove) > 0 || change.Rules {
+				change.Action = jailUpdate
+			}
+		}
+		plan = append(plan, change)
+	}
+
+	if prune {
+		var extra []string
+		for id := range have {
+			if !listed[id] {
+				extra = append(extra, id)
+			}
+		}
+		sort.Strings(extra)
+		for _, id := range extra {
+			plan = append(plan, jailChange{JailID: id, Action: jailDelete})
+		}
+	}
+	return plan, nil
+}
+
+// diffCommands returns the commands in want but not have, and the reverse.
+func diffCommands(have, want []string) (add, remove []string) {
+	for _, c := range want {
+		if !slices.Contains(have, c) && !slices.Contains(add, c) {
+			add = append(add, c)
+		}
+	}
+	for _, c := range have {
+		if !slices.Contains(want, c) {
+			remove = append(remove, c)
+		}
+	}
+	return add, remove
+}
+
+// sameRules reports whether two JSON rule lists say the same, however they
+// are spaced; no rules and an empty list are the same.
+func sameRules(a, b json.RawMessage) bool {
+	var va, vb []any
+	if len(a) > 0 && json.Unmarshal(a, &va) != nil {
+		return false
+	}
+	if len(b) > 0 && json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	if len(va) == 0 && len(vb) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+// printJailPlan writes a plan, one line per jail and a summary.
+func printJailPlan(w io.Writer, plan []jailChange) {
+	counts := map[string]int{}
+	for _, c := range plan {
+		counts[c.Action]++
+		switch c.Action {
+		case jailCreate:
+			hardened := ""
+			if c.want.Hardened {
+				hardened = ", hardened"
+			}
+			rules := ""
+			if len(c.want.Rules) > 0 {
+				rules = fmt.Sprintf(", %d rule(s)", len(c.want.Rules))
+			}
+			fmt.Fprintf(w, "  + %-10s %s (%s%s%s)\n", c.Action, c.JailID, strings.Join(c.want.Commands, ","), hardened, rules)
+		case jailUpdate:
+			var parts []string
+			for _, cmd := range c.Add {
+				parts = append(parts, "+"+cmd)
+			}
+			for _, cmd := range c.Remove {
+				parts = append(parts, "-"+cmd)
+			}
+			if c.Rules {
+				parts = append(parts, "rules")
+			}
+			fmt.Fprintf(w, "  ~ %-10s %s (%s)\n", c.Action, c.JailID, strings.Join(parts, " "))
+		case jailRecreate:
+			fmt.Fprintf(w, "  ! %-10s %s (hardened %v -> %v)\n", c.Action, c.JailID, c.Hardened, c.want.Hardened)
+		case jailDelete:
+			fmt.Fprintf(w, "  - %-10s %s\n", c.Action, c.JailID)
+		default:
+			fmt.Fprintf(w, "    %-10s %s\n", c.Action, c.JailID)
+		}
+	}
+	fmt.Fprintf(w, "Plan: %d to create, %d to update, %d to recreate, %d to delete, %d unchanged\n",
+		counts[jailCreate], counts[jailUpdate], counts[jailRecreate], counts[jailDelete], counts[jailUnchanged])
+}
+
+// ApplyJails brings the warden's jails in line with a manifest. It prints
+// the plan, and unless apply is false carries it out, printing the result
+// for each jail. Steps that fail do not stop the others; the error counts
+// them.
+func (c *Client) ApplyJails(ctx context.Context, m *jailManifest, prune, apply bool, w io.Writer) error {
+	current, err := c.jailStates(ctx)
+	if err != nil {
+		return err
+	}
+	plan, err := planJailApply(m, current, prune)
+	if err != nil {
+		return err
+	}
+	printJailPlan(w, plan)
+	if !apply {
+		return nil
+	}
+
+	failed := 0
+	for _, change := range plan {
+		var result string
+		var err error
+		switch change.Action {
+		case jailCreate:
+			err = c.createManifestJail(ctx, change.want)
+			result = "created"
+		case jailUpdate:
+			err = c.updateManifestJail(ctx, change.want)
+			result = "updated"
+		case jailRecreate:
+			if _, err = c.DeleteJail(ctx, change.JailID, false); err == nil {
+				err = c.createManifestJail(ctx, change.want)
+			}
+			result = "recreated"
+		case jailDelete:
+			_, err = c.DeleteJail(ctx, change.JailID, false)
+			result = "deleted"
+		default:
+			continue
+		}
+		if err != nil {
+			failed++
+			fmt.Fprintf(w, "%s: %s failed: %v\n", change.JailID, change.Action, err)
+			continue
+		}
+		fmt.Fprintf(w, "%s: %s\n", change.JailID, result)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d change(s) failed", failed, len(plan)-countAction(plan, jailUnchanged))
+	}
+	return nil
+}
+
+func countAction(plan []jailChange, action string) int {
+	n := 0
+	for _, c := range plan {
+		if c.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+func (c *Client) createManifestJail(ctx context.Context, j *manifestJail) error {
+	rules, err := j.rulesJSON()
+	if err != nil {
+		return err
+	}
+	return c.CreateJail(ctx, j.ID, j.Commands, j.Hardened, rules)
+}
+
+func (c *Client) updateManifestJail(ctx context.Context, j *manifestJail) error {
+	rules, err := j.rulesJSON()
+	if err != nil {
+		return err
+	}
+	_, err = c.UpdateJail(ctx, j.ID, j.Commands, rules, false)
+	return err
+}
+
+// jailStates lists the warden's jails.
+func (c *Client) jailStates(ctx context.Context) ([]jailState, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/api/jails", nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var jails []jailState
+	if err := json.NewDecoder(resp.Body).Decode(&jails); err != nil {
+		return nil, err
+	}
+	return jails, nil
+}
+
+// UpdateJail sets an existing jail's commands and rules, and returns the
+// symlinks added and removed. With dryRun nothing changes and the symlinks
+// that would be are returned.
+func (c *Client) UpdateJail(ctx context.Context, jailID string, commands []string, rules json.RawMessage, dryRun bool) (*jailhouse.JailChange, error) {
+	data, err := json.Marshal(map[string]any{"commands": commands, "rules": rules})
+	if err != nil {
+		return nil, err
+	}
+	return decodeJailChange(c.do(ctx, http.MethodPut, "/api/jails/"+jailID+dryRunQuery(dryRun), bytes.NewReader(data), http.StatusOK))
+}
+
+// dryRunQuery is the query string asking the warden for a dry run.
+func dryRunQuery(dryRun bool) string {
+	if dryRun {
+		return "?dry_run=true"
+	}
+	return ""
+}
+
+// decodeJailChange reads the change out of the response to a jail update or
+// deletion. One that failed partway is answered with a 500 that still
+// carries the change, which is returned along with the error.
+func decodeJailChange(resp *http.Response, err error) (*jailhouse.JailChange, error) {
+	var body struct {
+		Error  string                `json:"error"`
+		Change *jailhouse.JailChange `json:"change"`
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		if json.Unmarshal([]byte(statusErr.Body), &body) != nil || body.Change == nil {
+			return nil, err
+		}
+		return body.Change, errors.New(body.Error)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return body.Change, nil
+}
+
+// printJailChange prints the symlinks a jail update or deletion added,
+// removed and failed to change, or for a dry run would add and remove.
+func printJailChange(w io.Writer, change *jailhouse.JailChange) {
+	if change == nil {
+		return
+	}
+	add, remove := "Added", "Removed"
+	if change.DryRun {
+		add, remove = "Would add", "Would remove"
+	}
+	if change.Empty() {
+		fmt.Fprintf(w, "Jail %s: no symlinks to change\n", change.JailID)
+	}
+	if len(change.Added) > 0 {
+		fmt.Fprintf(w, "%s: %s\n", add, strings.Join(change.Added, ", "))
+	}
+	if len(change.Removed) > 0 {
+		fmt.Fprintf(w, "%s: %s\n", remove, strings.Join(change.Removed, ", "))
+	}
+	for _, f := range change.Failed {
+		fmt.Fprintf(w, "Failed to %s %s: %s\n", f.Op, f.Command, f.Error)
+	}
+}
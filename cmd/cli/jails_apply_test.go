@@ -0,0 +1,272 @@
+package main
+
+import (
+	"clawrden/internal/cliout"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeJailWarden serves GET /api/jails from jails and records the jail
+// changes it is sent.
+func fakeJailWarden(t *testing.T, jails string) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.URL.Path == "/api/jails" {
+			io.WriteString(w, jails)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		calls = append(calls, strings.TrimSpace(r.Method+" "+r.URL.Path+" "+string(body)))
+		mu.Unlock()
+		switch r.Method {
+		case http.MethodPost:
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodPut, http.MethodDelete:
+			if strings.HasSuffix(r.URL.Path, "/broken") {
+				http.Error(w, "jail not found: broken", http.StatusNotFound)
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls
+	}
+}
+
+func writeManifest(t *testing.T, content string) *jailManifest {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jails.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := readJailManifest(path)
+	if err != nil {
+		t.Fatalf("readJailManifest: %v", err)
+	}
+	return m
+}
+
+const serverJails = `[
+	{"jail_id": "ci", "commands": ["npm", "git"], "hardened": false, "rules": [{"command": "npm", "action": "allow"}]},
+	{"jail_id": "web", "commands": ["ls", "node"], "hardened": false},
+	{"jail_id": "build", "commands": ["make"], "hardened": false},
+	{"jail_id": "old", "commands": ["ls"], "hardened": false}
+]`
+
+const jailsManifest = `
+jails:
+  - id: ci
+    commands: [git, npm]
+    rules:
+      - {command: npm, action: allow}
+  - id: web
+    commands: [ls, node, npm]
+    rules:
+      - command: npm
+        action: ask
+  - id: build
+    commands: [make]
+    hardened: true
+  - id: docs
+    commands: [mkdocs]
+`
+
+func TestPlanJailApply(t *testing.T) {
+	var current []jailState
+	if err := json.Unmarshal([]byte(serverJails), &current); err != nil {
+		t.Fatal(err)
+	}
+	m := writeManifest(t, jailsManifest)
+
+	tests := []struct {
+		name     string
+		manifest *jailManifest
+		prune    bool
+		want     []string
+	}{
+		{"drift", m, false, []string{
+			"ci unchanged",
+			"web update +[npm] -[] rules",
+			"build recreate",
+			"docs create",
+		}},
+		{"drift with prune", m, true, []string{
+			"ci unchanged",
+			"web update +[npm] -[] rules",
+			"build recreate",
+			"docs create",
+			"old delete",
+		}},
+		{"removed commands and rules", writeManifest(t, "jails:\n  - id: ci\n    commands: [git]\n"), false, []string{
+			"ci update +[] -[npm] rules",
+		}},
+		{"empty manifest with prune", writeManifest(t, "jails: []\n"), true, []string{
+			"build delete", "ci delete", "old delete", "web delete",
+		}},
+		{"empty file", writeManifest(t, ""), false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := planJailApply(tt.manifest, current, tt.prune)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, c := range plan {
+				line := c.JailID + " " + c.Action
+				if c.Action == jailUpdate {
+					line += " +" + fmtList(c.Add) + " -" + fmtList(c.Remove)
+					if c.Rules {
+						line += " rules"
+					}
+				}
+				got = append(got, line)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("plan =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func fmtList(s []string) string {
+	return "[" + strings.Join(s, " ") + "]"
+}
+
+func TestApplyJails(t *testing.T) {
+	m := writeManifest(t, jailsManifest)
+
+	t.Run("plan only", func(t *testing.T) {
+		srv, calls := fakeJailWarden(t, serverJails)
+		client := NewClient(srv.URL, 0, cliout.Options{})
+		var out strings.Builder
+		if err := client.ApplyJails(context.Background(), m, true, false, &out); err != nil {
+			t.Fatalf("ApplyJails: %v", err)
+		}
+		if got := calls(); len(got) != 0 {
+			t.Errorf("plan only sent %v", got)
+		}
+		for _, want := range []string{
+			"~ update     web (+npm rules)",
+			"! recreate   build (hardened false -> true)",
+			"+ create     docs (mkdocs)",
+			"- delete     old",
+			"Plan: 1 to create, 1 to update, 1 to recreate, 1 to delete, 1 unchanged",
+		} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("plan lacks %q:\n%s", want, out.String())
+			}
+		}
+	})
+
+	t.Run("apply", func(t *testing.T) {
+		srv, calls := fakeJailWarden(t, serverJails)
+		client := NewClient(srv.URL, 0, cliout.Options{})
+		var out strings.Builder
+		if err := client.ApplyJails(context.Background(), m, true, true, &out); err != nil {
+			t.Fatalf("ApplyJails: %v\n%s", err, out.String())
+		}
+		want := []string{
+			`PUT /api/jails/web {"commands":["ls","node","npm"],"rules":[{"action":"ask","command":"npm"}]}`,
+			`DELETE /api/jails/build`,
+			`POST /api/jails {"commands":["make"],"hardened":true,"jail_id":"build"}`,
+			`POST /api/jails {"commands":["mkdocs"],"hardened":false,"jail_id":"docs"}`,
+			`DELETE /api/jails/old`,
+		}
+		if got := calls(); !reflect.DeepEqual(got, want) {
+			t.Errorf("calls =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+		}
+		for _, want := range []string{"web: updated", "build: recreated", "docs: created", "old: deleted"} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("output lacks %q:\n%s", want, out.String())
+			}
+		}
+	})
+
+	t.Run("failures are reported per jail", func(t *testing.T) {
+		srv, calls := fakeJailWarden(t, `[{"jail_id": "broken", "commands": ["ls"]}]`)
+		client := NewClient(srv.URL, 0, cliout.Options{})
+		manifest := writeManifest(t, "jails:\n  - id: broken\n    commands: [ls, cat]\n  - id: fresh\n    commands: [ls]\n")
+		var out strings.Builder
+		err := client.ApplyJails(context.Background(), manifest, false, true, &out)
+		if err == nil || err.Error() != "1 of 2 change(s) failed" {
+			t.Errorf("err = %v", err)
+		}
+		if !strings.Contains(out.String(), "broken: update failed:") || !strings.Contains(out.String(), "fresh: created") {
+			t.Errorf("output:\n%s", out.String())
+		}
+		if len(calls()) != 2 {
+			t.Errorf("calls = %v, want both attempted", calls())
+		}
+	})
+}
+
+func TestJailChangeOutput(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("dry_run") == "true" {
+			io.WriteString(w, `{"jail_id":"ci","change":{"jail_id":"ci","dry_run":true,"added":["ls"],"removed":["npm"]}}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error":"jail partially changed","change":{"jail_id":"ci","added":[],"removed":["npm"],"failed":[{"command":"ls","op":"add","error":"file exists"}]}}`)
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL, 0, cliout.Options{})
+
+	var out strings.Builder
+	change, err := client.UpdateJail(context.Background(), "ci", []string{"git", "ls"}, nil, true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	printJailChange(&out, change)
+	if got, want := out.String(), "Would add: ls\nWould remove: npm\n"; got != want {
+		t.Errorf("dry run output = %q, want %q", got, want)
+	}
+
+	out.Reset()
+	change, err = client.DeleteJail(context.Background(), "ci", false)
+	if err == nil || err.Error() != "jail partially changed" {
+		t.Errorf("err = %v", err)
+	}
+	printJailChange(&out, change)
+	if got, want := out.String(), "Removed: npm\nFailed to add ls: file exists\n"; got != want {
+		t.Errorf("partial output = %q, want %q", got, want)
+	}
+}
+
+func TestReadJailManifestErrors(t *testing.T) {
+	tests := []struct {
+		name, content, want string
+	}{
+		{"no id", "jails:\n  - commands: [ls]\n", "has no id"},
+		{"duplicate", "jails:\n  - id: a\n    commands: [ls]\n  - id: a\n    commands: [ls]\n", "listed twice"},
+		{"no commands", "jails:\n  - id: a\n", "has no commands"},
+		{"typo", "jails:\n  - id: a\n    comands: [ls]\n", "field comands not found"},
+		{"labels", "jails:\n  - id: a\n    commands: [ls]\n    labels: {team: web}\n", "labels and ttl are not supported"},
+		{"ttl", "jails:\n  - id: a\n    commands: [ls]\n    ttl: 24h\n", "labels and ttl are not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "jails.yaml")
+			os.WriteFile(path, []byte(tt.content), 0644)
+			if _, err := readJailManifest(path); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// outputChunk mirrors one line of /api/executions/{id}/output.
+type outputChunk struct {
+	Stream   string `json:"stream"`
+	Data     string `json:"data"`
+	ExitCode *int   `json:"exit_code"`
+	Dropped  uint64 `json:"dropped"`
+}
+
+// logsCommand runs `logs <execution-id> [-f]`.
+func logsCommand(fs *flag.FlagSet) runFunc {
+	follow := fs.Bool("f", false, "Keep streaming until the command exits")
+	return func(ctx context.Context, env *cmdEnv, args []string) error {
+		return env.client.Logs(ctx, args[0], *follow, os.Stdout, os.Stderr)
+	}
+}
+
+// Logs writes the output of an execution to stdout and stderr, following
+// it until the command exits when follow is set.
+func (c *Client) Logs(ctx context.Context, id string, follow bool, stdout, stderr io.Writer) error {
+	path := "/api/executions/" + url.PathEscape(id) + "/output"
+	if follow {
+		path += "?follow=true"
+	}
+	stream := *c
+	stream.http = &http.Client{Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		ResponseHeaderTimeout: c.timeout,
+	}}
+	resp, err := stream.do(ctx, http.MethodGet, path, nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var chunk outputChunk
+		if err := json.Unmarshal(scanner.Bytes(), &chunk); err != nil {
+			return fmt.Errorf("decode output: %w", err)
+		}
+		switch chunk.Stream {
+		case "stdout":
+			io.WriteString(stdout, chunk.Data)
+		case "stderr":
+			io.WriteString(stderr, chunk.Data)
+		case "dropped":
+			fmt.Fprintf(stderr, "[clawrden: %d output chunks dropped]\n", chunk.Dropped)
+		case "exit":
+			if chunk.ExitCode != nil {
+				fmt.Fprintf(stderr, "[clawrden: exited with code %d]\n", *chunk.ExitCode)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return c.classify(err)
+	}
+	return nil
+}
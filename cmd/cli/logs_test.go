@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"clawrden/internal/cliout"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLogsFollowsOutput(t *testing.T) {
+	var gotURL string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotURL = r.URL.String()
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Write([]byte(`{"seq":1,"stream":"stdout","data":"planning\n"}` + "\n"))
+		w.(http.Flusher).Flush()
+		// Slower than the client's timeout, which only bounds the headers
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte(`{"stream":"dropped","dropped":3}` + "\n"))
+		w.Write([]byte(`{"seq":5,"stream":"stderr","data":"warning\n"}` + "\n"))
+		w.Write([]byte(`{"seq":6,"stream":"exit","exit_code":2}` + "\n"))
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL, 50*time.Millisecond, cliout.Options{})
+	var stdout, stderr bytes.Buffer
+	if err := client.Logs(context.Background(), "req-1", true, &stdout, &stderr); err != nil {
+		t.Fatalf("Logs: %v", err)
+	}
+	if gotURL != "/api/executions/req-1/output?follow=true" {
+		t.Errorf("requested %s", gotURL)
+	}
+	if stdout.String() != "planning\n" {
+		t.Errorf("stdout = %q", stdout.String())
+	}
+	want := "[clawrden: 3 output chunks dropped]\nwarning\n[clawrden: exited with code 2]\n"
+	if stderr.String() != want {
+		t.Errorf("stderr = %q, want %q", stderr.String(), want)
+	}
+}
@@ -5,272 +5,828 @@ package main
 
 import (
 	"bytes"
+	"clawrden/internal/cliout"
+	"clawrden/internal/jailhouse"
+	"clawrden/pkg/protocol"
+	"cmp"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 	"text/tabwriter"
 	"time"
 )
 
+// SLA thresholds for coloring the age of pending requests.
+const (
+	queueAgeWarn = 5 * time.Minute
+	queueAgeCrit = 30 * time.Minute
+)
+
 const version = "1.0.0"
 
 func main() {
-	apiURL := flag.String("api", "http://localhost:8080", "Warden API URL")
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "clawrden-cli v%s - Clawrden Control Interface\n\n", version)
-		fmt.Fprintf(os.Stderr, "Usage: clawrden-cli [options] <command>\n\n")
-		fmt.Fprintf(os.Stderr, "Commands:\n")
-		fmt.Fprintf(os.Stderr, "  status              Show warden status\n")
-		fmt.Fprintf(os.Stderr, "  queue               List pending HITL requests\n")
-		fmt.Fprintf(os.Stderr, "  approve <id>        Approve pending request\n")
-		fmt.Fprintf(os.Stderr, "  deny <id>           Deny pending request\n")
-		fmt.Fprintf(os.Stderr, "  history             View command audit log\n")
-		fmt.Fprintf(os.Stderr, "  kill                Trigger kill switch\n")
-		fmt.Fprintf(os.Stderr, "  jails               List all jails\n")
-		fmt.Fprintf(os.Stderr, "  jails create <id>   Create a jail (--commands=ls,npm --hardened)\n")
-		fmt.Fprintf(os.Stderr, "  jails get <id>      Show jail details\n")
-		fmt.Fprintf(os.Stderr, "  jails delete <id>   Delete a jail\n\n")
-		fmt.Fprintf(os.Stderr, "Options:\n")
-		flag.PrintDefaults()
-	}
-	flag.Parse()
-
-	if flag.NArg() < 1 {
-		flag.Usage()
-		os.Exit(1)
-	}
-
-	command := flag.Arg(0)
-	client := &Client{baseURL: *apiURL}
-
-	switch command {
-	case "status":
-		if err := client.Status(); err != nil {
-			fatal("status: %v", err)
-		}
-	case "queue":
-		if err := client.Queue(); err != nil {
-			fatal("queue: %v", err)
-		}
-	case "approve":
-		if flag.NArg() < 2 {
-			fatal("approve requires request ID")
-		}
-		if err := client.Approve(flag.Arg(1)); err != nil {
-			fatal("approve: %v", err)
-		}
-		fmt.Println("Request approved")
-	case "deny":
-		if flag.NArg() < 2 {
-			fatal("deny requires request ID")
-		}
-		if err := client.Deny(flag.Arg(1)); err != nil {
-			fatal("deny: %v", err)
-		}
-		fmt.Println("Request denied")
-	case "history":
-		if err := client.History(); err != nil {
-			fatal("history: %v", err)
-		}
-	case "kill":
-		if err := client.Kill(); err != nil {
-			fatal("kill: %v", err)
-		}
-		fmt.Println("Kill switch activated")
-	case "jails":
-		handleJailsCommand(client, flag.Args())
-	default:
-		fatal("unknown command: %s", command)
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command line args and returns the exit code. Help and usage
+// errors go to stdout and stderr; commands print their output to os.Stdout.
+func run(args []string, stdout, stderr io.Writer) int {
+	global := flag.NewFlagSet("clawrden-cli", flag.ContinueOnError)
+	global.SetOutput(io.Discard)
+	global.Usage = func() {}
+	apiURL := global.String("api", "http://localhost:8080", "Warden API URL")
+	wide := global.Bool("wide", false, "Do not truncate long table cells")
+	columns := global.String("columns", "", "Comma-separated table columns to show (e.g., id,command,age)")
+	timeout := global.Duration("timeout", defaultTimeout, "Timeout for each warden API request")
+	configPath := global.String("config", "", "Config file naming wardens (default: $"+configEnv+" or ~/.config/clawrden/cli.yaml)")
+	targetName := global.String("target", "", "Warden from the config file to talk to")
+	all := global.Bool("all", false, "Query every warden in the config file (queue, status, history)")
+	if err := global.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			printUsage(stdout, global)
+			return exitOK
+		}
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		printOptions(stderr, global)
+		fmt.Fprintln(stderr, "\nRun 'clawrden-cli help' for the list of commands.")
+		return exitUsage
+	}
+	if global.NArg() < 1 {
+		printUsage(stderr, global)
+		return exitUsage
+	}
+
+	cmd, rest := lookupCommand(global.Args())
+	if cmd == nil {
+		fmt.Fprintf(stderr, "error: unknown command: %s\n\nRun 'clawrden-cli help' for the list of commands.\n", global.Arg(0))
+		return exitUsage
+	}
+	fs, runner := cmd.flagSet()
+	positional, err := parseArgs(fs, rest)
+	if errors.Is(err, flag.ErrHelp) {
+		printHelp(stdout, cmd)
+		return exitOK
+	}
+	if err == nil {
+		err = cmd.checkArgs(positional)
+	}
+	if err != nil {
+		printUsageError(stderr, cmd, fs, err)
+		return exitUsage
+	}
+
+	env := &cmdEnv{
+		out: cliout.Options{
+			Wide:    *wide,
+			Color:   cliout.ColorEnabled(os.Stdout),
+			Columns: cliout.ParseColumns(*columns),
+		},
+		configPath: cmp.Or(*configPath, defaultConfigPath()),
+		global:     global,
+		stdout:     stdout,
+	}
+	if cmd.wardens != useNone {
+		env.config, err = loadConfig(env.configPath, *configPath != "")
+		if err != nil {
+			fmt.Fprintf(stderr, "error: config: %v\n", err)
+			return exitFailure
+		}
+		env.ws = &wardens{config: env.config, target: *targetName, all: *all, api: *apiURL, timeout: *timeout, out: env.out}
+		global.Visit(func(f *flag.Flag) { env.ws.apiSet = env.ws.apiSet || f.Name == "api" })
+
+		// Commands that fan out or look up IDs check the selection
+		// themselves; the rest talk to exactly one warden
+		env.targets, env.selectErr = env.ws.selected()
+		if cmd.wardens == useOne {
+			if env.selectErr != nil {
+				fmt.Fprintf(stderr, "error: %v\n", env.selectErr)
+				return exitFailure
+			}
+			if len(env.targets) > 1 {
+				fmt.Fprintln(stderr, "error: --all only works with queue, status and history")
+				return exitFailure
+			}
+		}
+		if env.selectErr == nil && len(env.targets) == 1 {
+			env.client = env.targets[0].client
+		}
+	}
+
+	// Ctrl-C cancels in-flight requests instead of leaving them hanging
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = runner(ctx, env, positional)
+	var usageErr *usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, errQuiet):
+		return exitFailure
+	case errors.As(err, &usageErr):
+		printUsageError(stderr, cmd, fs, err)
+		return exitUsage
+	}
+	fmt.Fprintf(stderr, "error: %s: %v\n", cmd.name, err)
+	return exitFailure
+}
+
+// idDetails explains the request IDs approve, deny and queue show take.
+const idDetails = "With several wardens configured, an ID may name its warden (host1:req-...);\notherwise every warden is asked for it."
+
+// registry returns every command of the CLI, in the order help lists them.
+func registry() []*command {
+	return []*command{
+		{name: "status", summary: "Show warden status", group: "Requests", wardens: useSelection, setup: noFlags(statusCommand)},
+		{name: "queue", summary: "List pending HITL requests", group: "Requests", wardens: useSelection, setup: noFlags(queueCommand)},
+		{name: "queue show", args: []string{"<id>"}, summary: "Show details of a pending request", details: idDetails, group: "Requests", wardens: useSelection, setup: noFlags(queueShowCommand)},
+		{name: "approve", args: []string{"<id>"}, summary: "Approve a pending request", details: idDetails, group: "Requests", wardens: useSelection, setup: approveCommand},
+		{name: "deny", args: []string{"<id>"}, summary: "Deny a pending request", details: idDetails, group: "Requests", wardens: useSelection, setup: denyCommand},
+		{name: "logs", args: []string{"<id>"}, summary: "Show a running command's output", group: "Requests", setup: logsCommand},
+		{name: "transcript", args: []string{"<id>"}, summary: "Show the recorded conversation of a request", group: "Requests", setup: noFlags(transcriptCommand)},
+
+		{name: "history", summary: "View the command audit log", group: "Audit", wardens: useSelection, setup: historyCommand},
+		{name: "history export", summary: "Download the audit log", group: "Audit", wardens: useSelection, setup: historyExportCommand},
+		{name: "explain", summary: "Explain why a request was denied or asked for review", group: "Audit", setup: explainCommand,
+			details: "Give exactly one of --last, --request and --command."},
+
+		{name: "kill", summary: "Trigger the kill switch", group: "Operations", setup: noFlags(killCommand)},
+		{name: "incidents", summary: "List incidents (repeated denials, lockdowns)", group: "Operations", setup: noFlags(incidentsCommand)},
+		{name: "incidents clear", args: []string{"<id>"}, summary: "Clear an incident and lift its lockdown", group: "Operations", setup: noFlags(incidentsClearCommand)},
+		{name: "maintenance", summary: "Show the active maintenance window", group: "Operations", setup: noFlags(maintenanceCommand)},
+		{name: "maintenance start", summary: "Announce maintenance", group: "Operations", setup: maintenanceStartCommand},
+		{name: "maintenance end", summary: "End maintenance early", group: "Operations", setup: noFlags(maintenanceEndCommand)},
+
+		{name: "policy", summary: "Inspect and edit the warden's policy", group: "Policy"},
+		{name: "policy validate", summary: "Lint the policy file without reloading it", group: "Policy", setup: noFlags(policyValidateCommand),
+			details: "Exits with 1 if the policy has errors."},
+		{name: "policy shadow-report", summary: "Show where the shadow policy would decide differently", group: "Policy", setup: noFlags(policyShadowReportCommand)},
+		{name: "policy rules", summary: "List the policy file's rules", group: "Policy", setup: noFlags(policyRulesCommand)},
+		{name: "policy add-rule", summary: "Append a rule to the policy file", group: "Policy", setup: policyAddRuleCommand},
+		{name: "policy suggestions", summary: "List commands denied by default, most first", group: "Policy", setup: policySuggestionsCommand},
+		{name: "policy adopt", args: []string{"<command>"}, summary: "Draft a rule for a suggestion", group: "Policy", setup: policyAdoptCommand},
+
+		{name: "jails", summary: "List all jails", group: "Jails", setup: noFlags(jailsCommand)},
+		{name: "jails create", args: []string{"<id>"}, summary: "Create a jail", group: "Jails", setup: jailsCreateCommand},
+		{name: "jails get", args: []string{"<id>"}, summary: "Show jail details", group: "Jails", setup: noFlags(jailsGetCommand)},
+		{name: "jails update", args: []string{"<id>"}, summary: "Set a jail's commands", group: "Jails", setup: jailsUpdateCommand},
+		{name: "jails delete", args: []string{"<id>"}, summary: "Delete a jail", group: "Jails", setup: jailsDeleteCommand},
+		{name: "jails prune-unused", args: []string{"<id>"}, summary: "Remove commands never used", group: "Jails", setup: jailsPruneCommand},
+		{name: "jails render", args: []string{"<id>"}, summary: "Unpack an image bundle for a jail", group: "Jails", setup: jailsRenderCommand},
+		{name: "jails apply", args: []string{"<file>"}, summary: "Create, update and delete jails to match a manifest", group: "Jails", setup: jailsApplyCommand,
+			details: "Prints the plan; --yes carries it out. Jails the manifest does not list are\nonly deleted with --prune."},
+
+		{name: "config", summary: "Show configuration", group: "CLI"},
+		{name: "config show", summary: "Show the CLI's config file, or the warden's settings", group: "CLI", setup: configShowCommand},
+		{name: "commands", summary: "List every command, as JSON for tooling", group: "CLI", wardens: useNone, setup: commandsCommand},
+		{name: "help", args: []string{"[command...]"}, summary: "Show help for a command", group: "CLI", wardens: useNone, setup: noFlags(helpCommand)},
+	}
+}
+
+func statusCommand(ctx context.Context, env *cmdEnv, args []string) error {
+	all, err := env.fansOut()
+	if err != nil {
+		return err
 	}
+	if all {
+		return StatusAll(ctx, env.out, env.targets, os.Stdout)
+	}
+	return env.client.Status(ctx)
+}
+
+func queueCommand(ctx context.Context, env *cmdEnv, args []string) error {
+	all, err := env.fansOut()
+	if err != nil {
+		return err
+	}
+	if all {
+		return QueueAll(ctx, env.out, env.targets, os.Stdout, os.Stderr)
+	}
+	return env.client.Queue(ctx)
+}
+
+func queueShowCommand(ctx context.Context, env *cmdEnv, args []string) error {
+	t, id, err := env.ws.resolveID(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	return t.client.ShowRequest(ctx, id)
 }
 
-func handleJailsCommand(client *Client, args []string) {
-	// "jails" with no subcommand lists all jails
-	if len(args) < 2 {
-		if err := client.ListJails(); err != nil {
-			fatal("jails: %v", err)
+func approveCommand(fs *flag.FlagSet) runFunc {
+	var overrides ExecutionOverrides
+	fs.StringVar(&overrides.Strategy, "strategy", "", "Run the command with this strategy instead (mirror, ghost, local)")
+	fs.StringVar(&overrides.Network, "network", "", "Network of the command's ghost container (none, bridge)")
+	fs.StringVar(&overrides.Timeout, "exec-timeout", "", "Time limit for the command instead of the policy's (e.g., 5m)")
+	message := fs.String("m", "", "Message shown to the agent before the command runs (e.g., \"run the tests afterwards\")")
+	return func(ctx context.Context, env *cmdEnv, args []string) error {
+		t, id, err := env.ws.resolveID(ctx, args[0])
+		if err != nil {
+			return err
 		}
-		return
+		remaining, err := t.client.Approve(ctx, id, overrides, *message)
+		if err != nil {
+			return err
+		}
+		if remaining > 0 {
+			fmt.Printf("Approval recorded%s; %d more needed from other reviewers\n", onWarden(t), remaining)
+			return nil
+		}
+		fmt.Println("Request approved" + onWarden(t))
+		return nil
 	}
+}
 
-	subcommand := args[1]
-	switch subcommand {
-	case "create":
-		if len(args) < 3 {
-			fatal("jails create requires a jail ID")
+func denyCommand(fs *flag.FlagSet) runFunc {
+	message := fs.String("m", "", "Message shown to the agent with the denial (e.g., \"use make deploy instead\")")
+	return func(ctx context.Context, env *cmdEnv, args []string) error {
+		t, id, err := env.ws.resolveID(ctx, args[0])
+		if err != nil {
+			return err
 		}
-		jailID := args[2]
+		if err := t.client.Deny(ctx, id, *message); err != nil {
+			return err
+		}
+		fmt.Println("Request denied" + onWarden(t))
+		return nil
+	}
+}
 
-		// Parse --commands and --hardened from remaining args
-		jailFlags := flag.NewFlagSet("jails create", flag.ExitOnError)
-		commands := jailFlags.String("commands", "", "Comma-separated list of commands (e.g., ls,npm,docker)")
-		hardened := jailFlags.Bool("hardened", false, "Enable hardened mode")
-		jailFlags.Parse(args[3:])
+func historyCommand(fs *flag.FlagSet) runFunc {
+	task := fs.String("task", "", "Only entries for this task ID (CLAWRDEN_TASK_ID)")
+	collapse := fs.Bool("collapse", false, "Merge runs of identical entries into one row with a COUNT")
+	return func(ctx context.Context, env *cmdEnv, args []string) error {
+		query := url.Values{}
+		if *task != "" {
+			query.Set("task_id", *task)
+		}
+		if *collapse {
+			query.Set("collapse", "true")
+		}
+		all, err := env.fansOut()
+		if err != nil {
+			return err
+		}
+		if all {
+			return HistoryAll(ctx, env.out, env.targets, query, os.Stdout, os.Stderr)
+		}
+		return env.client.History(ctx, query)
+	}
+}
+
+func killCommand(ctx context.Context, env *cmdEnv, args []string) error {
+	if err := env.client.Kill(ctx); err != nil {
+		return err
+	}
+	fmt.Println("Kill switch activated")
+	return nil
+}
 
+func incidentsCommand(ctx context.Context, env *cmdEnv, args []string) error {
+	return env.client.Incidents(ctx)
+}
+
+func incidentsClearCommand(ctx context.Context, env *cmdEnv, args []string) error {
+	return env.client.ClearIncident(ctx, args[0])
+}
+
+func transcriptCommand(ctx context.Context, env *cmdEnv, args []string) error {
+	return env.client.Transcript(ctx, args[0])
+}
+
+// jailsCommand runs `jails`, listing all jails.
+func jailsCommand(ctx context.Context, env *cmdEnv, args []string) error {
+	return env.client.ListJails(ctx)
+}
+
+// readRules reads a JSON file of policy rules for a jail; none without a
+// file.
+func readRules(path string) (json.RawMessage, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(data) {
+		return nil, fmt.Errorf("%s is not valid JSON", path)
+	}
+	return data, nil
+}
+
+func jailsCreateCommand(fs *flag.FlagSet) runFunc {
+	commands := fs.String("commands", "", "Comma-separated list of commands (e.g., ls,npm,docker)")
+	hardened := fs.Bool("hardened", false, "Enable hardened mode")
+	rulesFile := fs.String("rules", "", "JSON file with a list of policy rules for the jail")
+	return func(ctx context.Context, env *cmdEnv, args []string) error {
 		if *commands == "" {
-			fatal("jails create requires --commands flag")
+			return usagef("--commands is required")
 		}
-
-		cmdList := strings.Split(*commands, ",")
-		if err := client.CreateJail(jailID, cmdList, *hardened); err != nil {
-			fatal("jails create: %v", err)
+		rules, err := readRules(*rulesFile)
+		if err != nil {
+			return err
+		}
+		if err := env.client.CreateJail(ctx, args[0], strings.Split(*commands, ","), *hardened, rules); err != nil {
+			return err
 		}
-		fmt.Printf("Jail %s created\n", jailID)
+		fmt.Printf("Jail %s created\n", args[0])
+		return nil
+	}
+}
+
+func jailsGetCommand(ctx context.Context, env *cmdEnv, args []string) error {
+	return env.client.GetJail(ctx, args[0])
+}
 
-	case "get":
-		if len(args) < 3 {
-			fatal("jails get requires a jail ID")
+func jailsUpdateCommand(fs *flag.FlagSet) runFunc {
+	commands := fs.String("commands", "", "Comma-separated list of commands the jail should have")
+	rulesFile := fs.String("rules", "", "JSON file with a list of policy rules for the jail")
+	dryRun := fs.Bool("dry-run", false, "Only print the symlinks that would be added and removed")
+	return func(ctx context.Context, env *cmdEnv, args []string) error {
+		if *commands == "" {
+			return usagef("--commands is required")
+		}
+		rules, err := readRules(*rulesFile)
+		if err != nil {
+			return err
+		}
+		change, err := env.client.UpdateJail(ctx, args[0], strings.Split(*commands, ","), rules, *dryRun)
+		printJailChange(os.Stdout, change)
+		if err != nil {
+			return err
 		}
-		if err := client.GetJail(args[2]); err != nil {
-			fatal("jails get: %v", err)
+		if !*dryRun {
+			fmt.Printf("Jail %s updated\n", args[0])
 		}
+		return nil
+	}
+}
 
-	case "delete":
-		if len(args) < 3 {
-			fatal("jails delete requires a jail ID")
+func jailsDeleteCommand(fs *flag.FlagSet) runFunc {
+	dryRun := fs.Bool("dry-run", false, "Only print the symlinks that would be removed")
+	return func(ctx context.Context, env *cmdEnv, args []string) error {
+		change, err := env.client.DeleteJail(ctx, args[0], *dryRun)
+		printJailChange(os.Stdout, change)
+		if err != nil {
+			return err
 		}
-		if err := client.DeleteJail(args[2]); err != nil {
-			fatal("jails delete: %v", err)
+		if !*dryRun {
+			fmt.Printf("Jail %s deleted\n", args[0])
 		}
-		fmt.Printf("Jail %s deleted\n", args[2])
+		return nil
+	}
+}
 
-	default:
-		fatal("unknown jails subcommand: %s", subcommand)
+func jailsPruneCommand(fs *flag.FlagSet) runFunc {
+	olderThan := fs.String("older-than", "30d", "Only prune when usage has been counted at least this long (e.g. 30d, 72h)")
+	yes := fs.Bool("yes", false, "Remove the unused commands instead of listing them")
+	return func(ctx context.Context, env *cmdEnv, args []string) error {
+		return env.client.PruneJail(ctx, args[0], *olderThan, *yes)
 	}
 }
 
-func fatal(format string, args ...interface{}) {
-	fmt.Fprintf(os.Stderr, "error: "+format+"\n", args...)
-	os.Exit(1)
+func jailsRenderCommand(fs *flag.FlagSet) runFunc {
+	output := fs.String("output", "", "Directory to unpack the bundle into (default: clawrden-<id>)")
+	return func(ctx context.Context, env *cmdEnv, args []string) error {
+		return env.client.RenderJail(ctx, args[0], cmp.Or(*output, jailhouse.BundleDir(args[0])))
+	}
 }
 
-// Client is the HTTP client for the Warden API.
-type Client struct {
-	baseURL string
+func jailsApplyCommand(fs *flag.FlagSet) runFunc {
+	prune := fs.Bool("prune", false, "Delete jails the manifest does not list")
+	yes := fs.Bool("yes", false, "Carry out the plan")
+	dryRun := fs.Bool("dry-run", false, "Only print the plan")
+	return func(ctx context.Context, env *cmdEnv, args []string) error {
+		if *yes && *dryRun {
+			return usagef("--yes and --dry-run cannot be combined")
+		}
+		manifest, err := readJailManifest(args[0])
+		if err != nil {
+			return err
+		}
+		if err := env.client.ApplyJails(ctx, manifest, *prune, *yes, os.Stdout); err != nil {
+			return err
+		}
+		if !*yes && !*dryRun {
+			fmt.Println("Run again with --yes to apply the plan")
+		}
+		return nil
+	}
 }
 
-// Status displays the warden status.
-func (c *Client) Status() error {
-	resp, err := http.Get(c.baseURL + "/api/status")
+// fetchStatus retrieves the warden status.
+func (c *Client) fetchStatus(ctx context.Context) (map[string]interface{}, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/api/status", nil, http.StatusOK)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
-	}
-
 	var data map[string]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Status displays the warden status.
+func (c *Client) Status(ctx context.Context) error {
+	data, err := c.fetchStatus(ctx)
+	if err != nil {
 		return err
 	}
 
 	fmt.Printf("Status: %v\n", data["status"])
 	fmt.Printf("Pending HITL Requests: %v\n", data["pending_count"])
+	if open, _ := data["open_incidents"].(float64); open > 0 {
+		fmt.Printf("Open Incidents: %d (see: clawrden-cli incidents)\n", int(open))
+	}
+	if m, ok := data["maintenance"].(map[string]interface{}); ok {
+		fmt.Printf("Maintenance: until %v: %v\n", m["until"], m["message"])
+	}
+
+	bridges, _ := data["bridges"].([]interface{})
+	if len(bridges) == 0 {
+		fmt.Println("Bridges: none reporting")
+		return nil
+	}
+	fmt.Println("Bridges:")
+	for _, raw := range bridges {
+		b, _ := raw.(map[string]interface{})
+		ageSeconds, _ := b["age_seconds"].(float64)
+		age := cliout.FormatAge(time.Duration(ageSeconds * float64(time.Second)))
+		line := fmt.Sprintf("  %v (%v %v) last seen %s ago", b["name"], b["type"], b["version"], age)
+		if stale, _ := b["stale"].(bool); stale {
+			line += " [STALE]"
+		}
+		fmt.Println(line)
+	}
 	return nil
 }
 
-// Queue lists pending HITL requests.
-func (c *Client) Queue() error {
-	resp, err := http.Get(c.baseURL + "/api/queue")
+// fetchQueue retrieves the pending HITL requests.
+func (c *Client) fetchQueue(ctx context.Context) ([]map[string]interface{}, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/api/queue", nil, http.StatusOK)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
-	}
-
 	var queue []map[string]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&queue); err != nil {
+		return nil, err
+	}
+	return queue, nil
+}
+
+// Queue lists pending HITL requests.
+func (c *Client) Queue(ctx context.Context) error {
+	queue, err := c.fetchQueue(ctx)
+	if err != nil {
 		return err
 	}
+	return renderQueue(c.out, single(queue), false, os.Stdout)
+}
 
-	if len(queue) == 0 {
-		fmt.Println("No pending requests")
+// renderQueue writes a table of pending requests, with a WARDEN column if
+// they come from several wardens.
+func renderQueue(out cliout.Options, rows []fromWarden, multi bool, w io.Writer) error {
+	if len(rows) == 0 {
+		fmt.Fprintln(w, "No pending requests")
 		return nil
 	}
 
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "ID\tCOMMAND\tARGS\tCWD\tUID")
-	for _, req := range queue {
-		args := ""
-		if a, ok := req["args"].([]interface{}); ok {
-			parts := make([]string, len(a))
-			for i, v := range a {
-				parts[i] = fmt.Sprintf("%v", v)
+	table := cliout.NewTable(out, withWarden(multi,
+		cliout.Column{Name: "ID"},
+		cliout.Column{Name: "COMMAND", MaxWidth: 20},
+		cliout.Column{Name: "ARGS", MaxWidth: 40},
+		cliout.Column{Name: "CWD", MaxWidth: 30},
+		cliout.Column{Name: "UID"},
+		cliout.Column{Name: "GROUPS", MaxWidth: 24},
+		cliout.Column{Name: "TASK", MaxWidth: 24},
+		cliout.Column{Name: "RISK"},
+		cliout.Column{Name: "AGE"},
+	)...)
+	for _, row := range rows {
+		req := row.item
+		identity, _ := req["identity"].(map[string]interface{})
+
+		age := cliout.Plain("")
+		if ts, ok := req["timestamp"].(string); ok {
+			if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+				d := time.Since(t)
+				age = cliout.Colored(cliout.FormatAge(d), cliout.AgeColor(d, queueAgeWarn, queueAgeCrit))
 			}
-			args = strings.Join(parts, " ")
 		}
 
-		identity := req["identity"].(map[string]interface{})
-		uid := identity["uid"]
+		table.AddRow(wardenCell(multi, row,
+			cliout.Plain(fmt.Sprintf("%v", req["id"])),
+			cliout.Plain(fmt.Sprintf("%v", req["command"])),
+			cliout.Plain(joinList(req["args"], " ")),
+			cliout.Plain(fmt.Sprintf("%v", req["cwd"])),
+			cliout.Plain(fmt.Sprintf("%v", identity["uid"])),
+			cliout.Plain(joinList(req["groups"], ",")),
+			cliout.Plain(stringField(req["task_id"])),
+			cliout.Plain(riskField(req)),
+			age,
+		)...)
+	}
+	return table.Render(w)
+}
 
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%v\n",
-			req["id"], req["command"], args, req["cwd"], uid)
+// riskField shows a queued request's risk tier and, for a low-risk ask,
+// how long until it is approved automatically, e.g. "low (auto in 42s)".
+func riskField(req map[string]interface{}) string {
+	risk := stringField(req["risk"])
+	if in, ok := req["auto_approve_in_seconds"].(float64); ok {
+		risk += fmt.Sprintf(" (auto in %s)", time.Duration(in)*time.Second)
+	}
+	return risk
+}
+
+// ShowRequest displays the details of a single pending request, including
+// which environment variables were scrubbed before it reached the Warden's executor.
+func (c *Client) ShowRequest(ctx context.Context, id string) error {
+	resp, err := c.do(ctx, http.MethodGet, "/api/queue/"+url.PathEscape(id), nil, http.StatusOK)
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound {
+		return fmt.Errorf("no pending request with ID %s", id)
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var req map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&req); err != nil {
+		return err
+	}
+	identity, _ := req["identity"].(map[string]interface{})
+	env, _ := req["env"].(map[string]interface{})
+
+	fmt.Printf("ID:                  %v\n", req["id"])
+	fmt.Printf("Command:             %v %s\n", req["command"], joinList(req["args"], " "))
+	fmt.Printf("Cwd:                 %v\n", req["cwd"])
+	fmt.Printf("UID:                 %v\n", identity["uid"])
+	if groups := joinList(req["groups"], ","); groups != "" {
+		fmt.Printf("Groups:              %s\n", groups)
+	}
+	if task := stringField(req["task_id"]); task != "" {
+		fmt.Printf("Task:                %s\n", task)
+	}
+	if run := stringField(req["run_id"]); run != "" {
+		fmt.Printf("Run:                 %s\n", run)
+	}
+	if session := sessionField(req["session"]); session != "" {
+		fmt.Printf("Session:             %s\n", session)
+	}
+	if risk := riskField(req); risk != "" {
+		fmt.Printf("Risk:                %s\n", risk)
+	}
+	fmt.Printf("Queued:              %v\n", req["timestamp"])
+	fmt.Printf("Env passed:          %s\n", listOrNone(env["passed"]))
+	fmt.Printf("Env blocked:         %s\n", listOrNone(env["blocked"]))
+	fmt.Printf("Env not allowlisted: %s\n", listOrNone(env["not_allowlisted"]))
+	if subs, ok := req["subcommands"].([]interface{}); ok && len(subs) > 0 {
+		fmt.Println("Script commands:")
+		for _, v := range subs {
+			sub, _ := v.(map[string]interface{})
+			fmt.Printf("  %-6v %v %s\n", sub["action"], sub["command"], joinList(sub["args"], " "))
+		}
+	}
+	if annotations, ok := req["annotations"].([]interface{}); ok && len(annotations) > 0 {
+		fmt.Println("Impact:")
+		for _, v := range annotations {
+			fmt.Printf("  %s\n", annotationLine(v))
+		}
 	}
-	w.Flush()
 	return nil
 }
 
-// Approve approves a pending HITL request.
-func (c *Client) Approve(id string) error {
-	return c.resolveRequest(id, "approve")
+// sessionField shows where a queued request's human is logged in, e.g.
+// "/dev/pts/3, ssh from 10.0.0.5, login session 7 (self-reported)"; "" when
+// the shim reported nothing.
+func sessionField(value interface{}) string {
+	session, _ := value.(map[string]interface{})
+	var parts []string
+	if tty := stringField(session["tty"]); tty != "" {
+		parts = append(parts, tty)
+	}
+	if conn := strings.Fields(stringField(session["ssh_connection"])); len(conn) > 0 {
+		parts = append(parts, "ssh from "+conn[0])
+	}
+	if id := stringField(session["login_session"]); id != "" {
+		parts = append(parts, "login session "+id)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return strings.Join(parts, ", ") + " (self-reported)"
 }
 
-// Deny denies a pending HITL request.
-func (c *Client) Deny(id string) error {
-	return c.resolveRequest(id, "deny")
+// annotationLine shows one of a queued request's annotations, e.g.
+// "rm: deletes 12 files (4.0K)".
+func annotationLine(value interface{}) string {
+	a, _ := value.(map[string]interface{})
+	if summary := stringField(a["summary"]); summary != "" {
+		return fmt.Sprintf("%v: %s", a["command"], summary)
+	}
+	return fmt.Sprintf("%v: unknown (%s)", a["command"], stringField(a["error"]))
 }
 
-func (c *Client) resolveRequest(id, action string) error {
-	url := fmt.Sprintf("%s/api/queue/%s/%s", c.baseURL, id, action)
-	resp, err := http.Post(url, "application/json", nil)
-	if err != nil {
-		return err
+// droppedEnv summarizes the scrubbed variable names of an audit entry.
+func droppedEnv(value interface{}) string {
+	env, _ := value.(map[string]interface{})
+	var parts []string
+	if blocked := joinList(env["blocked"], ","); blocked != "" {
+		parts = append(parts, "blocked: "+blocked)
 	}
-	defer resp.Body.Close()
+	if other := joinList(env["not_allowlisted"], ","); other != "" {
+		parts = append(parts, "not allowlisted: "+other)
+	}
+	return strings.Join(parts, "; ")
+}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+// entryDecision returns an audit entry's decision and how to show it, e.g.
+// "deny (after HITL)". Wardens that predate outcomes send that as the
+// decision itself.
+func entryDecision(entry map[string]interface{}) (protocol.Decision, string) {
+	decision, outcome, detail := protocol.ParseLegacyDecision(stringField(entry["decision"]))
+	if o, err := protocol.ParseOutcome(stringField(entry["outcome"])); err == nil && o != protocol.OutcomeNone {
+		outcome = o
 	}
+	if d := stringField(entry["detail"]); d != "" {
+		detail = d
+	}
+	return decision, protocol.FormatDecision(decision, outcome, detail)
+}
 
-	return nil
+// stringField returns a decoded JSON string, or "" for anything else.
+func stringField(value interface{}) string {
+	s, _ := value.(string)
+	return s
 }
 
-// History displays the command audit log.
-func (c *Client) History() error {
-	resp, err := http.Get(c.baseURL + "/api/history")
+// listOrNone formats a decoded JSON array with its count, or "none".
+func listOrNone(value interface{}) string {
+	items, _ := value.([]interface{})
+	if len(items) == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%d (%s)", len(items), joinList(value, ", "))
+}
+
+// joinList joins a decoded JSON array of values into a string.
+func joinList(value interface{}, sep string) string {
+	items, ok := value.([]interface{})
+	if !ok {
+		return ""
+	}
+	parts := make([]string, len(items))
+	for i, v := range items {
+		parts[i] = fmt.Sprintf("%v", v)
+	}
+	return strings.Join(parts, sep)
+}
+
+// ExecutionOverrides change how an approved request runs; the policy's
+// reviewer_overrides says which fields a reviewer may set.
+type ExecutionOverrides struct {
+	Strategy string `json:"strategy,omitempty"`
+	Network  string `json:"network,omitempty"`
+	Timeout  string `json:"timeout,omitempty"`
+}
+
+// resolution is the body of an approval or denial; both fields are optional.
+type resolution struct {
+	Overrides *ExecutionOverrides `json:"execution_overrides,omitempty"`
+	Message   string              `json:"message_to_requester,omitempty"`
+}
+
+// Approve approves a pending HITL request, changing how it runs as overrides
+// asks. A message, if not empty, is shown to the agent before the command
+// runs. It returns how many approvals from other reviewers the request
+// still needs.
+func (c *Client) Approve(ctx context.Context, id string, overrides ExecutionOverrides, message string) (remaining int, err error) {
+	res := resolution{Message: message}
+	if overrides != (ExecutionOverrides{}) {
+		res.Overrides = &overrides
+	}
+	return c.resolveRequest(ctx, id, "approve", res)
+}
+
+// Deny denies a pending HITL request. A message, if not empty, is shown to
+// the agent with the denial.
+func (c *Client) Deny(ctx context.Context, id string, message string) error {
+	_, err := c.resolveRequest(ctx, id, "deny", resolution{Message: message})
+	return err
+}
+
+// resolveRequest sends the decision with the reviewer token in
+// $CLAWRDEN_REVIEWER_TOKEN, which the warden needs to count approvals of
+// requests that need several or are routed to channels. Without one the
+// decision goes as actor(), which is only recorded.
+func (c *Client) resolveRequest(ctx context.Context, id, action string, res resolution) (remaining int, err error) {
+	var body io.Reader
+	if res != (resolution{}) {
+		data, err := json.Marshal(res)
+		if err != nil {
+			return 0, err
+		}
+		body = bytes.NewReader(data)
+	}
+	header := http.Header{}
+	header.Set("X-Clawrden-Actor", actor())
+	if token := os.Getenv(reviewerTokenEnv); token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	path := fmt.Sprintf("/api/queue/%s/%s", id, action)
+	resp, err := c.doHeader(ctx, http.MethodPost, path, header, body, http.StatusOK)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+	var status struct {
+		Remaining int `json:"approvals_remaining"`
 	}
+	json.NewDecoder(resp.Body).Decode(&status)
+	return status.Remaining, nil
+}
+
+// fetchHistory retrieves the audit log entries matching query.
+func (c *Client) fetchHistory(ctx context.Context, query url.Values) ([]map[string]interface{}, error) {
+	path := "/api/history"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	resp, err := c.do(ctx, http.MethodGet, path, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
 
 	var history []map[string]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// History displays the command audit log.
+func (c *Client) History(ctx context.Context, query url.Values) error {
+	history, err := c.fetchHistory(ctx, query)
+	if err != nil {
 		return err
 	}
+	return renderHistory(c.out, single(history), false, collapsed(query), os.Stdout)
+}
 
-	if len(history) == 0 {
-		fmt.Println("No audit history")
+// collapsed reports whether a history query asks for collapsed rows.
+func collapsed(query url.Values) bool {
+	v, _ := strconv.ParseBool(query.Get("collapse"))
+	return v
+}
+
+// renderHistory writes a table of audit entries, with a WARDEN column if
+// they come from several wardens. Collapsed rows (see /api/history
+// ?collapse=true) get a COUNT column and show the range of their durations.
+func renderHistory(out cliout.Options, rows []fromWarden, multi, collapse bool, w io.Writer) error {
+	if len(rows) == 0 {
+		fmt.Fprintln(w, "No audit history")
 		return nil
 	}
 
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "TIME\tCOMMAND\tDECISION\tEXIT\tDURATION")
-	for _, entry := range history {
-		timestamp := entry["timestamp"].(string)
+	columns := withWarden(multi, cliout.Column{Name: "TIME"})
+	if collapse {
+		columns = append(columns, cliout.Column{Name: "COUNT"})
+	}
+	columns = append(columns,
+		cliout.Column{Name: "COMMAND", MaxWidth: 20},
+		cliout.Column{Name: "ARGS", MaxWidth: 40},
+		cliout.Column{Name: "DECISION"},
+		cliout.Column{Name: "EXIT"},
+		cliout.Column{Name: "DURATION"},
+	)
+	// Scrubbed environment names and task IDs are only shown in wide output
+	if out.Wide {
+		columns = append(columns, cliout.Column{Name: "DROPPED-ENV"}, cliout.Column{Name: "TASK", MaxWidth: 24})
+	}
+	table := cliout.NewTable(out, columns...)
+	for _, row := range rows {
+		entry := row.item
+		timestamp, _ := entry["timestamp"].(string)
 		// Parse and format timestamp
 		t, err := time.Parse(time.RFC3339Nano, timestamp)
 		if err == nil {
@@ -281,32 +837,47 @@ func (c *Client) History() error {
 		if d, ok := entry["duration_ms"].(float64); ok && d > 0 {
 			duration = fmt.Sprintf("%.0fms", d)
 		}
+		lo, _ := entry["min_duration_ms"].(float64)
+		if hi, _ := entry["max_duration_ms"].(float64); collapse && hi > lo {
+			duration = fmt.Sprintf("%.0f-%.0fms", lo, hi)
+		}
 
 		exitCode := ""
 		if e, ok := entry["exit_code"].(float64); ok {
 			exitCode = fmt.Sprintf("%d", int(e))
 		}
+		// A command with no finished entry: still running, or lost in a crash
+		if completed := stringField(entry["completed"]); completed != "" {
+			exitCode = completed
+		}
 
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
-			timestamp, entry["command"], entry["decision"], exitCode, duration)
+		decision, label := entryDecision(entry)
+		cells := []cliout.Cell{cliout.Plain(timestamp)}
+		if collapse {
+			count, _ := entry["count"].(float64)
+			cells = append(cells, cliout.Plain(fmt.Sprintf("%d", int(count))))
+		}
+		table.AddRow(wardenCell(multi, row, append(cells,
+			cliout.Plain(fmt.Sprintf("%v", entry["command"])),
+			cliout.Plain(joinList(entry["args"], " ")),
+			cliout.Colored(label, cliout.DecisionColor(decision)),
+			cliout.Plain(exitCode),
+			cliout.Plain(duration),
+			cliout.Colored(droppedEnv(entry["env"]), cliout.Dim),
+			cliout.Plain(stringField(entry["task_id"])),
+		)...)...)
 	}
-	w.Flush()
-	return nil
+	return table.Render(w)
 }
 
 // Kill triggers the kill switch.
-func (c *Client) Kill() error {
-	resp, err := http.Post(c.baseURL+"/api/kill", "application/json", nil)
+func (c *Client) Kill(ctx context.Context) error {
+	resp, err := c.do(ctx, http.MethodPost, "/api/kill", nil, http.StatusOK)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
-	}
-
 	var result map[string]string
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return err
@@ -320,18 +891,13 @@ func (c *Client) Kill() error {
 }
 
 // ListJails displays all active jails.
-func (c *Client) ListJails() error {
-	resp, err := http.Get(c.baseURL + "/api/jails")
+func (c *Client) ListJails(ctx context.Context) error {
+	resp, err := c.do(ctx, http.MethodGet, "/api/jails", nil, http.StatusOK)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
-	}
-
 	var jails []map[string]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&jails); err != nil {
 		return err
@@ -343,7 +909,7 @@ func (c *Client) ListJails() error {
 	}
 
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "JAIL ID\tCOMMANDS\tHARDENED\tCREATED")
+	fmt.Fprintln(w, "JAIL ID\tCOMMANDS\tLINKS\tSIZE\tHARDENED\tCREATED")
 	for _, jail := range jails {
 		commands := ""
 		if cmds, ok := jail["commands"].([]interface{}); ok {
@@ -367,52 +933,64 @@ func (c *Client) ListJails() error {
 			}
 		}
 
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
-			jail["jail_id"], commands, hardened, created)
+		links, size := jailStats(jail["stats"])
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			jail["jail_id"], commands, links, size, hardened, created)
 	}
 	w.Flush()
 	return nil
 }
 
-// CreateJail creates a new jail via the API.
-func (c *Client) CreateJail(jailID string, commands []string, hardened bool) error {
+// jailStats formats the LINKS and SIZE columns of a jail listing.
+// Links read "present/expected" with a "!" when they have drifted.
+func jailStats(value interface{}) (links, size string) {
+	stats, ok := value.(map[string]interface{})
+	if !ok {
+		return "-", "-"
+	}
+	present, _ := stats["links"].(float64)
+	expected, _ := stats["expected_links"].(float64)
+	links = fmt.Sprintf("%d/%d", int(present), int(expected))
+	if drifted, _ := stats["drifted"].(bool); drifted {
+		links += "!"
+	}
+	diskBytes, _ := stats["disk_bytes"].(float64)
+	return links, cliout.FormatBytes(int64(diskBytes))
+}
+
+// CreateJail creates a new jail via the API, with optional policy rules.
+func (c *Client) CreateJail(ctx context.Context, jailID string, commands []string, hardened bool, rules json.RawMessage) error {
 	body := map[string]interface{}{
 		"jail_id":  jailID,
 		"commands": commands,
 		"hardened": hardened,
 	}
+	if rules != nil {
+		body["rules"] = rules
+	}
 	data, err := json.Marshal(body)
 	if err != nil {
 		return err
 	}
 
-	resp, err := http.Post(c.baseURL+"/api/jails", "application/json", bytes.NewReader(data))
+	resp, err := c.do(ctx, http.MethodPost, "/api/jails", bytes.NewReader(data), http.StatusCreated)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusCreated {
-		respBody, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(respBody))
-	}
-
 	return nil
 }
 
 // GetJail displays details of a specific jail.
-func (c *Client) GetJail(jailID string) error {
-	resp, err := http.Get(c.baseURL + "/api/jails/" + jailID)
+func (c *Client) GetJail(ctx context.Context, jailID string) error {
+	resp, err := c.do(ctx, http.MethodGet, "/api/jails/"+jailID, nil, http.StatusOK)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
-	}
-
 	var jail map[string]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&jail); err != nil {
 		return err
@@ -421,28 +999,95 @@ func (c *Client) GetJail(jailID string) error {
 	fmt.Printf("Jail ID:  %v\n", jail["jail_id"])
 	fmt.Printf("Commands: %v\n", jail["commands"])
 	fmt.Printf("Hardened: %v\n", jail["hardened"])
+	if rules, ok := jail["rules"].([]interface{}); ok {
+		fmt.Printf("Rules:    %d\n", len(rules))
+	}
 	fmt.Printf("Path:     %v\n", jail["jail_path"])
 	fmt.Printf("Created:  %v\n", jail["created_at"])
-	return nil
+	if _, ok := jail["stats"].(map[string]interface{}); ok {
+		links, size := jailStats(jail["stats"])
+		fmt.Printf("Links:    %s\n", links)
+		fmt.Printf("Size:     %s\n", size)
+	}
+	return c.printJailUsage(ctx, jailID)
 }
 
-// DeleteJail removes a jail via the API.
-func (c *Client) DeleteJail(jailID string) error {
-	req, err := http.NewRequest(http.MethodDelete, c.baseURL+"/api/jails/"+jailID, nil)
+// printJailUsage lists how often each command of a jail was used. Wardens
+// that do not count usage are skipped silently.
+func (c *Client) printJailUsage(ctx context.Context, jailID string) error {
+	resp, err := c.do(ctx, http.MethodGet, "/api/jails/"+jailID+"/usage", nil, http.StatusOK)
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
+
+	var usage struct {
+		TrackedSince time.Time `json:"tracked_since"`
+		Commands     []struct {
+			Command  string     `json:"command"`
+			Count    int64      `json:"count"`
+			LastUsed *time.Time `json:"last_used"`
+		} `json:"commands"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&usage); err != nil {
+		return err
+	}
 
-	resp, err := http.DefaultClient.Do(req)
+	fmt.Printf("Usage since %s:\n", usage.TrackedSince.Local().Format("2006-01-02 15:04:05"))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  COMMAND\tUSES\tLAST USED")
+	for _, cmd := range usage.Commands {
+		lastUsed := "never"
+		if cmd.LastUsed != nil {
+			lastUsed = cmd.LastUsed.Local().Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "  %s\t%d\t%s\n", cmd.Command, cmd.Count, lastUsed)
+	}
+	return w.Flush()
+}
+
+// PruneJail lists the commands of a jail never used since its usage was
+// first counted, at least olderThan ago, and with apply removes them.
+func (c *Client) PruneJail(ctx context.Context, jailID, olderThan string, apply bool) error {
+	data, err := json.Marshal(map[string]interface{}{"older_than": olderThan, "apply": apply})
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, http.MethodPost, "/api/jails/"+jailID+"/prune-unused", bytes.NewReader(data), http.StatusOK)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+	var result struct {
+		TrackedSince time.Time `json:"tracked_since"`
+		Unused       []string  `json:"unused"`
+		Removed      bool      `json:"removed"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
 	}
 
+	since := result.TrackedSince.Local().Format("2006-01-02 15:04:05")
+	switch {
+	case len(result.Unused) == 0:
+		fmt.Printf("Every command of jail %s was used since %s\n", jailID, since)
+	case result.Removed:
+		fmt.Printf("Removed %d commands unused since %s from jail %s: %s\n",
+			len(result.Unused), since, jailID, strings.Join(result.Unused, ", "))
+	default:
+		fmt.Printf("Commands of jail %s unused since %s: %s\n", jailID, since, strings.Join(result.Unused, ", "))
+		fmt.Println("Run again with --yes to remove them")
+	}
 	return nil
 }
+
+// DeleteJail removes a jail via the API and returns the symlinks removed.
+// With dryRun nothing changes and the symlinks that would be are returned.
+func (c *Client) DeleteJail(ctx context.Context, jailID string, dryRun bool) (*jailhouse.JailChange, error) {
+	return decodeJailChange(c.do(ctx, http.MethodDelete, "/api/jails/"+jailID+dryRunQuery(dryRun), nil, http.StatusOK))
+}
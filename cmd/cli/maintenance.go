@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// maintenance mirrors the warden's /api/maintenance window.
+type maintenance struct {
+	ID       string    `json:"id"`
+	Message  string    `json:"message"`
+	Started  time.Time `json:"started"`
+	Until    time.Time `json:"until"`
+	QueueAsk bool      `json:"queue_ask"`
+}
+
+// maintenanceCommand runs `maintenance`.
+func maintenanceCommand(ctx context.Context, env *cmdEnv, args []string) error {
+	return env.client.Maintenance(ctx)
+}
+
+// maintenanceStartCommand runs `maintenance start`.
+func maintenanceStartCommand(fs *flag.FlagSet) runFunc {
+	duration := fs.Duration("duration", 10*time.Minute, "How long the window lasts")
+	message := fs.String("message", "", "Announcement shown to agents and reviewers")
+	queue := fs.Bool("queue", false, "Keep queueing requests for review instead of denying them")
+	return func(ctx context.Context, env *cmdEnv, args []string) error {
+		return env.client.StartMaintenance(ctx, *message, *duration, *queue)
+	}
+}
+
+// maintenanceEndCommand runs `maintenance end`.
+func maintenanceEndCommand(ctx context.Context, env *cmdEnv, args []string) error {
+	return env.client.EndMaintenance(ctx)
+}
+
+// Maintenance shows the active maintenance window.
+func (c *Client) Maintenance(ctx context.Context) error {
+	resp, err := c.do(ctx, http.MethodGet, "/api/maintenance", nil, http.StatusOK)
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound {
+		fmt.Println("No maintenance window active")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var m maintenance
+	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+		return err
+	}
+	printMaintenance(&m)
+	return nil
+}
+
+// StartMaintenance announces a maintenance window.
+func (c *Client) StartMaintenance(ctx context.Context, message string, d time.Duration, queue bool) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"message":  message,
+		"duration": d.String(),
+		"queue":    queue,
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, http.MethodPost, "/api/maintenance", bytes.NewReader(body), http.StatusCreated)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var m maintenance
+	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+		return err
+	}
+	fmt.Println("Maintenance started")
+	printMaintenance(&m)
+	return nil
+}
+
+// EndMaintenance ends the active maintenance window early.
+func (c *Client) EndMaintenance(ctx context.Context) error {
+	resp, err := c.do(ctx, http.MethodDelete, "/api/maintenance", nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	fmt.Println("Maintenance ended")
+	return nil
+}
+
+// printMaintenance shows a maintenance window.
+func printMaintenance(m *maintenance) {
+	fmt.Printf("ID: %s\n", m.ID)
+	fmt.Printf("Until: %s (%s left)\n", m.Until.Local().Format("2006-01-02 15:04:05"), time.Until(m.Until).Round(time.Second))
+	if m.Message != "" {
+		fmt.Printf("Message: %s\n", m.Message)
+	}
+	if m.QueueAsk {
+		fmt.Println("Requests needing approval: queued")
+	} else {
+		fmt.Println("Requests needing approval: denied")
+	}
+}
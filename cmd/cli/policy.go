@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bytes"
+	"clawrden/internal/cliout"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// policyValidation mirrors the warden's /api/policy/validate response.
+type policyValidation struct {
+	Path     string `json:"path"`
+	Valid    bool   `json:"valid"`
+	Error    string `json:"error"`
+	Lint     string `json:"lint"`
+	Findings []struct {
+		Check   string `json:"check"`
+		Jail    string `json:"jail"`
+		Rule    int    `json:"rule"`
+		Message string `json:"message"`
+	} `json:"findings"`
+	Tests        int `json:"tests"`
+	TestFailures []struct {
+		Test       int    `json:"test"`
+		Name       string `json:"name"`
+		Invocation string `json:"invocation"`
+		Expected   string `json:"expected"`
+		Actual     string `json:"actual"`
+		Rule       string `json:"rule"`
+	} `json:"test_failures"`
+}
+
+// shadowReport mirrors the warden's /api/policy/shadow-report response.
+type shadowReport struct {
+	Path      string    `json:"path"`
+	Loaded    bool      `json:"loaded"`
+	Since     time.Time `json:"since"`
+	Evaluated int64     `json:"evaluated"`
+	Diverged  int64     `json:"diverged"`
+	Commands  []struct {
+		Command     string `json:"command"`
+		Evaluated   int64  `json:"evaluated"`
+		Divergences []struct {
+			Primary string   `json:"primary"`
+			Shadow  string   `json:"shadow"`
+			Count   int64    `json:"count"`
+			Example []string `json:"example"`
+		} `json:"divergences"`
+	} `json:"commands"`
+}
+
+// policyRules mirrors the warden's GET /api/policy/rules response.
+type policyRules struct {
+	Path    string `json:"path"`
+	Hash    string `json:"hash"`
+	InForce bool   `json:"in_force"`
+	Rules   []struct {
+		Index int            `json:"index"`
+		Rule  map[string]any `json:"rule"`
+	} `json:"rules"`
+}
+
+// policySuggestions mirrors the warden's /api/policy/suggestions response.
+type policySuggestions struct {
+	Since       time.Time `json:"since"`
+	Total       int       `json:"total"`
+	Suggestions []struct {
+		Command    string    `json:"command"`
+		Count      int64     `json:"count"`
+		Example    []string  `json:"example"`
+		Containers []string  `json:"containers"`
+		LastSeen   time.Time `json:"last_seen"`
+	} `json:"suggestions"`
+}
+
+// adoptedSuggestion mirrors the warden's draft of a rule for a suggestion.
+type adoptedSuggestion struct {
+	Rule map[string]any `json:"rule"`
+	YAML string         `json:"yaml"`
+}
+
+// policyEdit mirrors the warden's answer to a policy rule edit.
+type policyEdit struct {
+	Op    string `json:"op"`
+	Index int    `json:"index"`
+	Diff  string `json:"diff"`
+	Hash  string `json:"hash"`
+}
+
+// policyValidateCommand runs `policy validate`, failing when the policy
+// has errors.
+func policyValidateCommand(ctx context.Context, env *cmdEnv, args []string) error {
+	valid, err := env.client.ValidatePolicy(ctx)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return errQuiet
+	}
+	return nil
+}
+
+func policyShadowReportCommand(ctx context.Context, env *cmdEnv, args []string) error {
+	return env.client.ShadowReport(ctx)
+}
+
+func policyRulesCommand(ctx context.Context, env *cmdEnv, args []string) error {
+	return env.client.PolicyRules(ctx)
+}
+
+// policyAddRuleCommand runs `policy add-rule`.
+func policyAddRuleCommand(fs *flag.FlagSet) runFunc {
+	command := fs.String("command", "", "Command the rule matches (required)")
+	action := fs.String("action", "", "allow, deny or ask (required)")
+	argPatterns := fs.String("args", "", "Comma-separated argument patterns the rule is limited to")
+	reason := fs.String("reason", "", "Why the rule exists, shown in denials and explanations")
+	execTimeout := fs.String("exec-timeout", "", "Time limit for the command (e.g., 5m)")
+	ifMatch := fs.String("if-match", "", "Policy hash the edit is based on (default: the current one)")
+	return func(ctx context.Context, env *cmdEnv, args []string) error {
+		if *command == "" || *action == "" {
+			return usagef("--command and --action are required")
+		}
+		rule := map[string]any{"command": *command, "action": *action}
+		if *argPatterns != "" {
+			rule["args"] = strings.Split(*argPatterns, ",")
+		}
+		if *reason != "" {
+			rule["reason"] = *reason
+		}
+		if *execTimeout != "" {
+			rule["exec_timeout"] = *execTimeout
+		}
+		return env.client.AddPolicyRule(ctx, rule, *ifMatch)
+	}
+}
+
+// policySuggestionsCommand runs `policy suggestions`.
+func policySuggestionsCommand(fs *flag.FlagSet) runFunc {
+	top := fs.Int("top", 20, "How many of the most denied commands to list")
+	reset := fs.Bool("reset", false, "Clear the suggestions instead of listing them")
+	return func(ctx context.Context, env *cmdEnv, args []string) error {
+		if *reset {
+			return env.client.ResetPolicySuggestions(ctx)
+		}
+		return env.client.PolicySuggestions(ctx, *top)
+	}
+}
+
+// policyAdoptCommand runs `policy adopt <command>`.
+func policyAdoptCommand(fs *flag.FlagSet) runFunc {
+	action := fs.String("action", "ask", "allow or ask")
+	appendRule := fs.Bool("append", false, "Append the rule to the policy file instead of only printing it")
+	ifMatch := fs.String("if-match", "", "Policy hash the edit is based on (default: the current one)")
+	return func(ctx context.Context, env *cmdEnv, args []string) error {
+		return env.client.AdoptSuggestion(ctx, args[0], *action, *appendRule, *ifMatch)
+	}
+}
+
+// PolicyRules lists the rules of the warden's policy file with the indices
+// edits name them by.
+func (c *Client) PolicyRules(ctx context.Context) error {
+	rules, err := c.policyRules(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Policy: %s (%s)\n", rules.Path, shortHash(rules.Hash))
+	if !rules.InForce {
+		fmt.Println("Not in force: the file has changes the warden has not applied; see the warden log")
+	}
+	for _, r := range rules.Rules {
+		line := fmt.Sprintf("%3d  %-6v %v", r.Index, r.Rule["action"], r.Rule["command"])
+		if args, ok := r.Rule["args"].([]any); ok {
+			line += fmt.Sprintf(" %v", args)
+		}
+		if reason, ok := r.Rule["reason"].(string); ok {
+			line += "  # " + reason
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
+
+func (c *Client) policyRules(ctx context.Context) (*policyRules, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/api/policy/rules", nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var rules policyRules
+	if err := json.NewDecoder(resp.Body).Decode(&rules); err != nil {
+		return nil, err
+	}
+	return &rules, nil
+}
+
+// AddPolicyRule appends rule to the warden's policy file. The edit is
+// based on the policy with hash ifMatch, or on the current one; if the file
+// changed in between, the warden refuses it.
+func (c *Client) AddPolicyRule(ctx context.Context, rule map[string]any, ifMatch string) error {
+	if ifMatch == "" {
+		rules, err := c.policyRules(ctx)
+		if err != nil {
+			return err
+		}
+		ifMatch = rules.Hash
+	}
+	body, err := json.Marshal(rule)
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	header.Set("If-Match", strconv.Quote(ifMatch))
+	header.Set("X-Clawrden-Actor", actor())
+	resp, err := c.doHeader(ctx, http.MethodPost, "/api/policy/rules", header, bytes.NewReader(body), http.StatusCreated)
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.Code == http.StatusPreconditionFailed {
+		return fmt.Errorf("the policy changed while you were editing it; review `clawrden-cli policy rules` and retry: %w", err)
+	}
+	var edit policyEdit
+	held := errors.As(err, &statusErr) && statusErr.Code == http.StatusAccepted
+	switch {
+	case held: // Written, but not in force until confirmed
+		if err := json.Unmarshal([]byte(statusErr.Body), &edit); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	default:
+		defer resp.Body.Close()
+		if err := json.NewDecoder(resp.Body).Decode(&edit); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Added rule %d; policy is now %s\n", edit.Index, shortHash(edit.Hash))
+	for _, line := range strings.Split(edit.Diff, "\n") {
+		fmt.Println("  " + line)
+	}
+	if held {
+		fmt.Println("Not in force: it flips too many recent decisions, and the warden holds it until")
+		fmt.Println("confirmed; review GET /api/policy/confirm-reload, then POST to it to apply the policy")
+	}
+	return nil
+}
+
+// PolicySuggestions lists the top commands denied because no rule matched
+// them, as candidates for `policy adopt`.
+func (c *Client) PolicySuggestions(ctx context.Context, top int) error {
+	resp, err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/policy/suggestions?top=%d", top), nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var report policySuggestions
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return err
+	}
+	if len(report.Suggestions) == 0 {
+		fmt.Printf("No commands denied by default since %s\n", report.Since.Local().Format("2006-01-02 15:04:05"))
+		return nil
+	}
+	fmt.Printf("%d commands denied by default since %s", report.Total, report.Since.Local().Format("2006-01-02 15:04:05"))
+	if len(report.Suggestions) < report.Total {
+		fmt.Printf(", top %d", len(report.Suggestions))
+	}
+	fmt.Println()
+
+	table := cliout.NewTable(c.out,
+		cliout.Column{Name: "COMMAND"},
+		cliout.Column{Name: "COUNT"},
+		cliout.Column{Name: "LAST"},
+		cliout.Column{Name: "CONTAINERS", MaxWidth: 40},
+		cliout.Column{Name: "EXAMPLE", MaxWidth: 60},
+	)
+	for _, s := range report.Suggestions {
+		table.AddRow(
+			cliout.Plain(s.Command),
+			cliout.Plain(fmt.Sprint(s.Count)),
+			cliout.Plain(s.LastSeen.Local().Format("15:04:05")),
+			cliout.Plain(strings.Join(s.Containers, ",")),
+			cliout.Plain(strings.Join(s.Example, " ")),
+		)
+	}
+	return table.Render(os.Stdout)
+}
+
+// ResetPolicySuggestions clears the warden's suggestions.
+func (c *Client) ResetPolicySuggestions(ctx context.Context) error {
+	resp, err := c.do(ctx, http.MethodDelete, "/api/policy/suggestions", nil, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	fmt.Println("Suggestions cleared")
+	return nil
+}
+
+// AdoptSuggestion prints a rule giving a suggested command action, and
+// with appendRule adds it to the policy file as `policy add-rule` would.
+func (c *Client) AdoptSuggestion(ctx context.Context, command, action string, appendRule bool, ifMatch string) error {
+	body, err := json.Marshal(map[string]string{"action": action})
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, http.MethodPost, "/api/policy/suggestions/"+url.PathEscape(command), bytes.NewReader(body), http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var adopted adoptedSuggestion
+	if err := json.NewDecoder(resp.Body).Decode(&adopted); err != nil {
+		return err
+	}
+	if !appendRule {
+		fmt.Print(adopted.YAML)
+		return nil
+	}
+	return c.AddPolicyRule(ctx, adopted.Rule, ifMatch)
+}
+
+// actor names who runs the CLI, for the warden's audit log of policy edits.
+func actor() string {
+	user := os.Getenv("USER")
+	if user == "" {
+		user = fmt.Sprintf("uid %d", os.Getuid())
+	}
+	if host, err := os.Hostname(); err == nil {
+		return user + "@" + host
+	}
+	return user
+}
+
+// ShadowReport shows where the warden's shadow policy would have decided
+// differently from the policy in force.
+func (c *Client) ShadowReport(ctx context.Context) error {
+	resp, err := c.do(ctx, http.MethodGet, "/api/policy/shadow-report", nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var report shadowReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return err
+	}
+
+	fmt.Printf("Shadow policy: %s\n", report.Path)
+	if !report.Loaded {
+		fmt.Println("Not loaded: the file failed to load; see the warden log")
+		return nil
+	}
+	fmt.Printf("%d of %d requests since %s would have been decided differently\n",
+		report.Diverged, report.Evaluated, report.Since.Local().Format("2006-01-02 15:04:05"))
+	if len(report.Commands) == 0 {
+		return nil
+	}
+
+	table := cliout.NewTable(c.out,
+		cliout.Column{Name: "COMMAND"},
+		cliout.Column{Name: "ENFORCED"},
+		cliout.Column{Name: "SHADOW"},
+		cliout.Column{Name: "COUNT"},
+		cliout.Column{Name: "OF"},
+		cliout.Column{Name: "EXAMPLE", MaxWidth: 60},
+	)
+	for _, cmd := range report.Commands {
+		for _, d := range cmd.Divergences {
+			color := cliout.Yellow
+			if d.Shadow == "deny" {
+				color = cliout.Red
+			}
+			table.AddRow(
+				cliout.Plain(cmd.Command),
+				cliout.Plain(d.Primary),
+				cliout.Colored(d.Shadow, color),
+				cliout.Plain(fmt.Sprint(d.Count)),
+				cliout.Plain(fmt.Sprint(cmd.Evaluated)),
+				cliout.Plain(strings.Join(d.Example, " ")),
+			)
+		}
+	}
+	return table.Render(os.Stdout)
+}
+
+// ValidatePolicy lints the warden's policy file without reloading it and
+// reports whether a reload would apply it.
+func (c *Client) ValidatePolicy(ctx context.Context) (bool, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/api/policy/validate", nil, http.StatusOK)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	var v policyValidation
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return false, err
+	}
+
+	if v.Path != "" {
+		fmt.Printf("Policy: %s\n", v.Path)
+	}
+	for _, f := range v.Findings {
+		where := "policy"
+		if f.Rule > 0 {
+			where = fmt.Sprintf("rule %d", f.Rule)
+		}
+		if f.Jail != "" {
+			where = "jail " + f.Jail + " " + where
+		}
+		fmt.Printf("  %-16s %-20s %s\n", f.Check, where, f.Message)
+	}
+	for _, f := range v.TestFailures {
+		name := fmt.Sprintf("test %d", f.Test)
+		if f.Name != "" {
+			name += " (" + f.Name + ")"
+		}
+		fmt.Printf("  FAIL %s: %s\n", name, f.Invocation)
+		fmt.Printf("    - expected: %s\n", f.Expected)
+		fmt.Printf("    + actual:   %s by %s\n", f.Actual, f.Rule)
+	}
+	switch {
+	case !v.Valid:
+		fmt.Printf("Invalid: %s\n", v.Error)
+	case len(v.Findings) > 0:
+		fmt.Printf("Valid with %d lint warning(s) (lint: %s)\n", len(v.Findings), v.Lint)
+	default:
+		fmt.Println("Valid, no lint findings")
+	}
+	if v.Valid && v.Tests > 0 {
+		fmt.Printf("%d policy test(s) passed\n", v.Tests)
+	}
+	return v.Valid, nil
+}
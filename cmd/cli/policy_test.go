@@ -0,0 +1,91 @@
+package main
+
+import (
+	"clawrden/internal/cliout"
+	"clawrden/pkg/wardentest"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAddPolicyRule(t *testing.T) {
+	w := wardentest.StartTestWarden(t, wardentest.Options{
+		API:    true,
+		Policy: wardentest.AllowPolicy("ls"),
+	})
+	client := NewClient(w.APIURL, 0, cliout.Options{})
+	ctx := context.Background()
+
+	before, err := client.policyRules(ctx)
+	if err != nil {
+		t.Fatalf("policyRules: %v", err)
+	}
+	if err := client.AddPolicyRule(ctx, map[string]any{"command": "jq", "action": "allow", "reason": "JSON filtering"}, ""); err != nil {
+		t.Fatalf("AddPolicyRule: %v", err)
+	}
+
+	after, err := client.policyRules(ctx)
+	if err != nil {
+		t.Fatalf("policyRules: %v", err)
+	}
+	if len(after.Rules) != len(before.Rules)+1 || after.Hash == before.Hash || !after.InForce {
+		t.Fatalf("rules after add = %+v", after)
+	}
+	if added := after.Rules[len(after.Rules)-1]; added.Rule["command"] != "jq" || added.Rule["reason"] != "JSON filtering" {
+		t.Errorf("added rule = %+v", added)
+	}
+	if r := w.SendRequest(t, wardentest.NewRequest("jq", ".")); !r.Allowed() {
+		t.Errorf("jq not allowed after the rule was added: %s", r.Reason)
+	}
+
+	// An edit based on the old policy loses
+	err = client.AddPolicyRule(ctx, map[string]any{"command": "yq", "action": "allow"}, before.Hash)
+	if err == nil || !strings.Contains(err.Error(), "policy changed") {
+		t.Errorf("stale edit err = %v, want a policy changed error", err)
+	}
+}
+
+func TestAdoptSuggestion(t *testing.T) {
+	w := wardentest.StartTestWarden(t, wardentest.Options{
+		API:    true,
+		Policy: wardentest.AllowPolicy("ls"),
+	})
+	client := NewClient(w.APIURL, 0, cliout.Options{})
+	ctx := context.Background()
+
+	if r := w.SendRequest(t, wardentest.NewRequest("jq", ".")); !r.Denied() {
+		t.Fatalf("jq not denied by default: %+v", r)
+	}
+	if err := client.AdoptSuggestion(ctx, "yq", "ask", true, ""); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("adopting a command never denied: err = %v, want 404", err)
+	}
+	if err := client.AdoptSuggestion(ctx, "jq", "allow", true, ""); err != nil {
+		t.Fatalf("AdoptSuggestion: %v", err)
+	}
+
+	rules, err := client.policyRules(ctx)
+	if err != nil {
+		t.Fatalf("policyRules: %v", err)
+	}
+	if added := rules.Rules[len(rules.Rules)-1]; added.Rule["command"] != "jq" || added.Rule["action"] != "allow" {
+		t.Errorf("added rule = %+v", added)
+	}
+
+	// The one request replayed was denied and would now be allowed, so the
+	// reload canary holds the new policy until it is confirmed
+	if r := w.SendRequest(t, wardentest.NewRequest("jq", ".")); !r.Denied() {
+		t.Errorf("jq allowed before the held policy was confirmed")
+	}
+	resp, err := http.Post(w.APIURL+"/api/policy/confirm-reload", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("confirm-reload: HTTP %d", resp.StatusCode)
+	}
+	if r := w.SendRequest(t, wardentest.NewRequest("jq", ".")); !r.Allowed() {
+		t.Errorf("jq not allowed after the suggestion was adopted: %s", r.Reason)
+	}
+}
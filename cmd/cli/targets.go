@@ -0,0 +1,355 @@
+package main
+
+import (
+	"clawrden/internal/cliout"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configEnv overrides the default config file path.
+const configEnv = "CLAWRDEN_CLI_CONFIG"
+
+// cliConfig names the wardens the CLI can talk to.
+type cliConfig struct {
+	Default string            `yaml:"default,omitempty"` // Target used without --target, --all or --api
+	Targets map[string]string `yaml:"targets"`           // Name to API URL, e.g. host1: http://host1:8080
+}
+
+// defaultConfigPath returns $CLAWRDEN_CLI_CONFIG, or cli.yaml in the user's
+// config directory.
+func defaultConfigPath() string {
+	if path := os.Getenv(configEnv); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "clawrden", "cli.yaml")
+}
+
+// loadConfig reads the config file at path. A missing file is an empty
+// config unless required, i.e. the path was given on the command line.
+func loadConfig(path string, required bool) (*cliConfig, error) {
+	cfg := &cliConfig{}
+	if path == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for name, url := range cfg.Targets {
+		if name == "" || strings.Contains(name, ":") {
+			return nil, fmt.Errorf("%s: target name %q must be non-empty and without ':'", path, name)
+		}
+		if url == "" {
+			return nil, fmt.Errorf("%s: target %s has no URL", path, name)
+		}
+	}
+	if _, ok := cfg.Targets[cfg.Default]; cfg.Default != "" && !ok {
+		return nil, fmt.Errorf("%s: default target %q is not in targets", path, cfg.Default)
+	}
+	return cfg, nil
+}
+
+// target is a warden the CLI talks to.
+type target struct {
+	name   string // Name in the config file; empty for --api
+	client *Client
+}
+
+// wardens picks the wardens a command talks to from the command line and
+// the config file.
+type wardens struct {
+	config  *cliConfig
+	target  string // --target
+	all     bool   // --all
+	api     string // --api
+	apiSet  bool   // --api was given, overriding the config's default
+	timeout time.Duration
+	out     cliout.Options
+}
+
+// named returns the configured target name.
+func (w *wardens) named(name string) target {
+	return target{name: name, client: NewClient(w.config.Targets[name], w.timeout, w.out)}
+}
+
+// configured returns every target in the config file, by name.
+func (w *wardens) configured() []target {
+	names := make([]string, 0, len(w.config.Targets))
+	for name := range w.config.Targets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	targets := make([]target, len(names))
+	for i, name := range names {
+		targets[i] = w.named(name)
+	}
+	return targets
+}
+
+// explicit reports whether the command line named one warden.
+func (w *wardens) explicit() bool {
+	return w.target != "" || w.apiSet
+}
+
+// selected returns the wardens the command line chose: the --target, every
+// configured one for --all, the --api URL, or the config's default.
+func (w *wardens) selected() ([]target, error) {
+	switch {
+	case w.target != "" && w.all:
+		return nil, fmt.Errorf("use --target or --all, not both")
+	case w.target != "":
+		if _, ok := w.config.Targets[w.target]; !ok {
+			return nil, fmt.Errorf("unknown target %q (configured: %s)", w.target, w.targetNames())
+		}
+		return []target{w.named(w.target)}, nil
+	case w.all:
+		if len(w.config.Targets) == 0 {
+			return nil, fmt.Errorf("--all needs targets in the config file (%s)", defaultConfigPath())
+		}
+		return w.configured(), nil
+	case w.apiSet || len(w.config.Targets) == 0:
+		return []target{{client: NewClient(w.api, w.timeout, w.out)}}, nil
+	case w.config.Default != "":
+		return []target{w.named(w.config.Default)}, nil
+	case len(w.config.Targets) == 1:
+		return w.configured(), nil
+	}
+	return nil, fmt.Errorf("several wardens are configured (%s); pick one with --target or use --all", w.targetNames())
+}
+
+func (w *wardens) targetNames() string {
+	var names []string
+	for _, t := range w.configured() {
+		names = append(names, t.name)
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
+// resolveID finds the warden holding a pending request. A qualified ID
+// ("host1:req-...") names it; otherwise, unless the command line named one,
+// every configured warden is asked for the ID. It returns the warden and
+// the unqualified ID.
+func (w *wardens) resolveID(ctx context.Context, id string) (target, string, error) {
+	if name, rest, ok := strings.Cut(id, ":"); ok {
+		if _, known := w.config.Targets[name]; !known {
+			return target{}, "", fmt.Errorf("unknown target %q in %s (configured: %s)", name, id, w.targetNames())
+		}
+		return w.named(name), rest, nil
+	}
+	if w.explicit() || len(w.config.Targets) == 0 {
+		targets, err := w.selected()
+		if err != nil {
+			return target{}, "", err
+		}
+		return targets[0], id, nil
+	}
+
+	var holders []target
+	var failures []string
+	for _, r := range fanOut(ctx, w.configured(), (*Client).fetchQueue) {
+		if r.err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", r.target.name, r.err))
+			continue
+		}
+		if slices.ContainsFunc(r.value, func(req map[string]interface{}) bool { return req["id"] == id }) {
+			holders = append(holders, r.target)
+		}
+	}
+	switch {
+	case len(holders) == 1:
+		return holders[0], id, nil
+	case len(holders) > 1:
+		names := make([]string, len(holders))
+		for i, t := range holders {
+			names[i] = t.name
+		}
+		return target{}, "", fmt.Errorf("request %s is pending on several wardens (%s); qualify it as <target>:%s", id, strings.Join(names, ", "), id)
+	case len(failures) > 0:
+		return target{}, "", fmt.Errorf("no reachable warden has pending request %s (%s)", id, strings.Join(failures, "; "))
+	}
+	return target{}, "", fmt.Errorf("no warden has pending request %s", id)
+}
+
+// onWarden names a configured warden in a confirmation message.
+func onWarden(t target) string {
+	if t.name == "" {
+		return ""
+	}
+	return " on " + t.name
+}
+
+// fetched is what one warden answered.
+type fetched[T any] struct {
+	target target
+	value  T
+	err    error
+}
+
+// fanOut calls fetch for every target concurrently and returns the results
+// in target order. Each call is bounded by its client's timeout, so one
+// hung warden does not hold up the others.
+func fanOut[T any](ctx context.Context, targets []target, fetch func(*Client, context.Context) (T, error)) []fetched[T] {
+	results := make([]fetched[T], len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Go(func() {
+			value, err := fetch(t.client, ctx)
+			results[i] = fetched[T]{target: t, value: value, err: err}
+		})
+	}
+	wg.Wait()
+	return results
+}
+
+// fromWarden is a decoded API object and the warden it came from.
+type fromWarden struct {
+	warden string
+	item   map[string]interface{}
+}
+
+// merge flattens the lists the wardens returned, oldest first, and reports
+// the wardens that failed on stderr. It fails only when every warden did.
+func merge(results []fetched[[]map[string]interface{}], stderr io.Writer) ([]fromWarden, error) {
+	var items []fromWarden
+	var errs []error
+	for _, r := range results {
+		if r.err != nil {
+			fmt.Fprintf(stderr, "warning: warden %s: %v\n", r.target.name, r.err)
+			errs = append(errs, fmt.Errorf("%s: %w", r.target.name, r.err))
+			continue
+		}
+		for _, item := range r.value {
+			items = append(items, fromWarden{warden: r.target.name, item: item})
+		}
+	}
+	if len(errs) == len(results) {
+		return nil, errors.Join(errs...)
+	}
+	slices.SortStableFunc(items, func(a, b fromWarden) int {
+		return timestampOf(a.item).Compare(timestampOf(b.item))
+	})
+	return items, nil
+}
+
+// timestampOf returns the time of a queued request or audit entry.
+func timestampOf(item map[string]interface{}) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, stringField(item["timestamp"]))
+	return t
+}
+
+// single wraps one warden's list for the renderers.
+func single(items []map[string]interface{}) []fromWarden {
+	rows := make([]fromWarden, len(items))
+	for i, item := range items {
+		rows[i] = fromWarden{item: item}
+	}
+	return rows
+}
+
+// withWarden prepends the WARDEN column when rows come from several wardens.
+func withWarden(multi bool, columns ...cliout.Column) []cliout.Column {
+	if !multi {
+		return columns
+	}
+	return append([]cliout.Column{{Name: "WARDEN"}}, columns...)
+}
+
+// wardenCell prepends the warden's name to a row when rows come from
+// several wardens.
+func wardenCell(multi bool, row fromWarden, cells ...cliout.Cell) []cliout.Cell {
+	if !multi {
+		return cells
+	}
+	return append([]cliout.Cell{cliout.Plain(row.warden)}, cells...)
+}
+
+// QueueAll lists the pending requests of every target in one table,
+// reporting the wardens that did not answer on stderr.
+func QueueAll(ctx context.Context, out cliout.Options, targets []target, stdout, stderr io.Writer) error {
+	rows, err := merge(fanOut(ctx, targets, (*Client).fetchQueue), stderr)
+	if err != nil {
+		return err
+	}
+	return renderQueue(out, rows, true, stdout)
+}
+
+// HistoryAll shows the audit logs of every target in one table, reporting
+// the wardens that did not answer on stderr.
+func HistoryAll(ctx context.Context, out cliout.Options, targets []target, query url.Values, stdout, stderr io.Writer) error {
+	rows, err := merge(fanOut(ctx, targets, func(c *Client, ctx context.Context) ([]map[string]interface{}, error) {
+		return c.fetchHistory(ctx, query)
+	}), stderr)
+	if err != nil {
+		return err
+	}
+	return renderHistory(out, rows, true, collapsed(query), stdout)
+}
+
+// StatusAll shows one line per target, with the error for wardens that did
+// not answer. It fails only when none did.
+func StatusAll(ctx context.Context, out cliout.Options, targets []target, stdout io.Writer) error {
+	table := cliout.NewTable(out,
+		cliout.Column{Name: "WARDEN"},
+		cliout.Column{Name: "STATUS", MaxWidth: 60},
+		cliout.Column{Name: "PENDING"},
+		cliout.Column{Name: "INCIDENTS"},
+		cliout.Column{Name: "MAINTENANCE", MaxWidth: 40},
+	)
+	var errs []error
+	for _, r := range fanOut(ctx, targets, (*Client).fetchStatus) {
+		if r.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.target.name, r.err))
+			table.AddRow(cliout.Plain(r.target.name), cliout.Colored("error: "+r.err.Error(), cliout.Red),
+				cliout.Plain(""), cliout.Plain(""), cliout.Plain(""))
+			continue
+		}
+		data := r.value
+		incidents := ""
+		if open, _ := data["open_incidents"].(float64); open > 0 {
+			incidents = fmt.Sprintf("%d", int(open))
+		}
+		maintenance := ""
+		if m, ok := data["maintenance"].(map[string]interface{}); ok {
+			maintenance = fmt.Sprintf("until %v: %v", m["until"], m["message"])
+		}
+		table.AddRow(
+			cliout.Plain(r.target.name),
+			cliout.Plain(fmt.Sprintf("%v", data["status"])),
+			cliout.Plain(fmt.Sprintf("%v", data["pending_count"])),
+			cliout.Plain(incidents),
+			cliout.Plain(maintenance),
+		)
+	}
+	if err := table.Render(stdout); err != nil {
+		return err
+	}
+	if len(errs) == len(targets) {
+		return errors.Join(errs...)
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"clawrden/internal/cliout"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// requestLog records the requests a fake warden got.
+type requestLog struct {
+	mu       sync.Mutex
+	requests []string
+}
+
+func (l *requestLog) add(r *http.Request) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.requests = append(l.requests, r.Method+" "+r.URL.String())
+}
+
+// take returns the requests so far and forgets them.
+func (l *requestLog) take() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	requests := l.requests
+	l.requests = nil
+	return requests
+}
+
+// fakeWarden serves a canned queue, history and status, recording what it
+// was asked.
+func fakeWarden(t *testing.T, queue []map[string]interface{}) (*httptest.Server, *requestLog) {
+	t.Helper()
+	requests := &requestLog{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.add(r)
+		switch {
+		case r.URL.Path == "/api/queue" || r.URL.Path == "/api/history":
+			json.NewEncoder(w).Encode(queue)
+		case r.URL.Path == "/api/status":
+			json.NewEncoder(w).Encode(map[string]interface{}{"status": "running", "pending_count": len(queue)})
+		case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/api/queue/"):
+			w.Write([]byte("{}"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, requests
+}
+
+// hungWarden never answers until the test ends.
+func hungWarden(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// deadURL returns the URL of a port nothing listens on.
+func deadURL(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	return "http://" + ln.Addr().String()
+}
+
+func queued(id, timestamp string) map[string]interface{} {
+	return map[string]interface{}{"id": id, "command": "npm", "timestamp": timestamp}
+}
+
+func testWardens(targets map[string]string) *wardens {
+	return &wardens{config: &cliConfig{Targets: targets}, timeout: 200 * time.Millisecond, api: "http://localhost:8080"}
+}
+
+func TestQueueAllMergesWardens(t *testing.T) {
+	host1, _ := fakeWarden(t, []map[string]interface{}{queued("req-late", "2026-01-05T10:05:00Z")})
+	host2, _ := fakeWarden(t, []map[string]interface{}{queued("req-early", "2026-01-05T10:00:00Z")})
+	ws := testWardens(map[string]string{"host1": host1.URL, "host2": host2.URL, "host3": hungWarden(t).URL})
+	ws.all = true
+	targets, err := ws.selected()
+	if err != nil {
+		t.Fatalf("selected: %v", err)
+	}
+
+	start := time.Now()
+	var stdout, stderr bytes.Buffer
+	if err := QueueAll(context.Background(), cliout.Options{}, targets, &stdout, &stderr); err != nil {
+		t.Fatalf("QueueAll: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("the hung warden held the others up for %v", elapsed)
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "WARDEN") ||
+		!strings.HasPrefix(lines[1], "host2") || !strings.Contains(lines[1], "req-early") ||
+		!strings.HasPrefix(lines[2], "host1") || !strings.Contains(lines[2], "req-late") {
+		t.Errorf("table, oldest first:\n%s", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "warning: warden host3:") || !strings.Contains(stderr.String(), "timed out") {
+		t.Errorf("stderr = %q, want the hung warden reported", stderr.String())
+	}
+}
+
+func TestQueueAllFailsWhenNoWardenAnswers(t *testing.T) {
+	ws := testWardens(map[string]string{"host1": deadURL(t), "host2": deadURL(t)})
+	var stdout, stderr bytes.Buffer
+	err := QueueAll(context.Background(), cliout.Options{}, ws.configured(), &stdout, &stderr)
+	if err == nil || !strings.Contains(err.Error(), "host1: ") || !strings.Contains(err.Error(), "host2: ") {
+		t.Errorf("QueueAll error = %v, want both wardens' errors", err)
+	}
+}
+
+func TestHistoryAllSendsQuery(t *testing.T) {
+	host1, reqs1 := fakeWarden(t, []map[string]interface{}{{"timestamp": "2026-01-05T10:00:00Z", "command": "ls", "decision": "allow"}})
+	host2, reqs2 := fakeWarden(t, nil)
+	ws := testWardens(map[string]string{"host1": host1.URL, "host2": host2.URL})
+
+	var stdout, stderr bytes.Buffer
+	query := url.Values{"task_id": {"task-42"}}
+	if err := HistoryAll(context.Background(), cliout.Options{}, ws.configured(), query, &stdout, &stderr); err != nil {
+		t.Fatalf("HistoryAll: %v", err)
+	}
+	for _, log := range []*requestLog{reqs1, reqs2} {
+		if reqs := log.take(); len(reqs) != 1 || reqs[0] != "GET /api/history?task_id=task-42" {
+			t.Errorf("requests = %v", reqs)
+		}
+	}
+	if !strings.Contains(stdout.String(), "host1") || stderr.Len() != 0 {
+		t.Errorf("stdout %q, stderr %q", stdout.String(), stderr.String())
+	}
+}
+
+func TestStatusAllReportsEachWarden(t *testing.T) {
+	host1, _ := fakeWarden(t, []map[string]interface{}{queued("req-1", "2026-01-05T10:00:00Z")})
+	ws := testWardens(map[string]string{"host1": host1.URL, "host2": deadURL(t)})
+
+	var stdout bytes.Buffer
+	if err := StatusAll(context.Background(), cliout.Options{}, ws.configured(), &stdout); err != nil {
+		t.Fatalf("StatusAll: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[1], "running") || !strings.Contains(lines[2], "error: cannot reach warden") {
+		t.Errorf("status table:\n%s", stdout.String())
+	}
+}
+
+func TestResolveID(t *testing.T) {
+	host1, reqs1 := fakeWarden(t, []map[string]interface{}{queued("req-1", ""), queued("req-both", "")})
+	host2, reqs2 := fakeWarden(t, []map[string]interface{}{queued("req-2", ""), queued("req-both", "")})
+
+	tests := []struct {
+		name       string
+		targets    map[string]string
+		target     string
+		id         string
+		wantWarden string
+		wantID     string
+		wantErr    string
+	}{
+		{"qualified", map[string]string{"host1": host1.URL, "host2": host2.URL}, "", "host2:req-both", "host2", "req-both", ""},
+		{"unknown qualifier", map[string]string{"host1": host1.URL}, "", "host9:req-1", "", "", `unknown target "host9"`},
+		{"probed", map[string]string{"host1": host1.URL, "host2": host2.URL}, "", "req-2", "host2", "req-2", ""},
+		{"probe skips the unreachable", map[string]string{"host1": host1.URL, "host2": deadURL(t)}, "", "req-1", "host1", "req-1", ""},
+		{"ambiguous", map[string]string{"host1": host1.URL, "host2": host2.URL}, "", "req-both", "", "", "pending on several wardens (host1, host2)"},
+		{"missing", map[string]string{"host1": host1.URL, "host2": deadURL(t)}, "", "req-9", "", "", "no reachable warden has pending request req-9 (host2: "},
+		{"named target is not probed", map[string]string{"host1": host1.URL, "host2": host2.URL}, "host1", "req-2", "host1", "req-2", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := testWardens(tt.targets)
+			ws.target = tt.target
+			got, id, err := ws.resolveID(context.Background(), tt.id)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("resolveID error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got.name != tt.wantWarden || id != tt.wantID {
+				t.Errorf("resolveID = %s, %s, %v; want %s, %s", got.name, id, err, tt.wantWarden, tt.wantID)
+			}
+		})
+	}
+
+	// A qualified approval goes to its warden only
+	reqs1.take()
+	reqs2.take()
+	ws := testWardens(map[string]string{"host1": host1.URL, "host2": host2.URL})
+	got, id, _ := ws.resolveID(context.Background(), "host1:req-1")
+	if _, err := got.client.Approve(context.Background(), id, ExecutionOverrides{}, ""); err != nil {
+		t.Fatalf("Approve: %v", err)
+	}
+	if got1, got2 := reqs1.take(), reqs2.take(); len(got1) != 1 || got1[0] != "POST /api/queue/req-1/approve" || len(got2) != 0 {
+		t.Errorf("host1 got %v, host2 got %v", got1, got2)
+	}
+}
+
+func TestSelectTargets(t *testing.T) {
+	two := map[string]string{"host1": "http://host1:8080", "host2": "http://host2:8080"}
+	tests := []struct {
+		name    string
+		ws      wardens
+		want    []string // URLs
+		wantErr string
+	}{
+		{"no config uses --api", wardens{config: &cliConfig{}, api: "http://localhost:8080"}, []string{"http://localhost:8080"}, ""},
+		{"--target", wardens{config: &cliConfig{Targets: two}, target: "host2"}, []string{"http://host2:8080"}, ""},
+		{"unknown --target", wardens{config: &cliConfig{Targets: two}, target: "host9"}, nil, "configured: host1, host2"},
+		{"--all", wardens{config: &cliConfig{Targets: two}, all: true}, []string{"http://host1:8080", "http://host2:8080"}, ""},
+		{"--all without targets", wardens{config: &cliConfig{}, all: true}, nil, "--all needs targets"},
+		{"--api beats the default", wardens{config: &cliConfig{Targets: two, Default: "host1"}, api: "http://other:8080", apiSet: true}, []string{"http://other:8080"}, ""},
+		{"default", wardens{config: &cliConfig{Targets: two, Default: "host1"}}, []string{"http://host1:8080"}, ""},
+		{"several without a default", wardens{config: &cliConfig{Targets: two}}, nil, "pick one with --target or use --all"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets, err := tt.ws.selected()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("selected error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			var urls []string
+			for _, target := range targets {
+				urls = append(urls, target.client.baseURL)
+			}
+			if err != nil || strings.Join(urls, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("selected = %v, %v; want %v", urls, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cli.yaml")
+	os.WriteFile(path, []byte("default: host1\ntargets:\n  host1: http://host1:8080\n  host2: http://host2:8080\n"), 0644)
+	cfg, err := loadConfig(path, true)
+	if err != nil || cfg.Default != "host1" || cfg.Targets["host2"] != "http://host2:8080" {
+		t.Errorf("loadConfig = %+v, %v", cfg, err)
+	}
+
+	if cfg, err := loadConfig(filepath.Join(dir, "missing.yaml"), false); err != nil || len(cfg.Targets) != 0 {
+		t.Errorf("missing default config = %+v, %v; want an empty config", cfg, err)
+	}
+	if _, err := loadConfig(filepath.Join(dir, "missing.yaml"), true); err == nil {
+		t.Error("a missing --config file was accepted")
+	}
+
+	os.WriteFile(path, []byte("default: host9\ntargets:\n  host1: http://host1:8080\n"), 0644)
+	if _, err := loadConfig(path, true); err == nil || !strings.Contains(err.Error(), `default target "host9"`) {
+		t.Errorf("loadConfig error = %v, want the unknown default", err)
+	}
+}
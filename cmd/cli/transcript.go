@@ -0,0 +1,92 @@
+package main
+
+import (
+	"clawrden/internal/cliout"
+	"clawrden/pkg/protocol"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// transcriptRecord mirrors the warden's /api/transcripts entries.
+type transcriptRecord struct {
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"`
+	Type      string    `json:"type"`
+	Size      int       `json:"size"`
+	Payload   []byte    `json:"payload"`
+	Truncated bool      `json:"truncated"`
+}
+
+// ackNames names the ack bytes the warden sends.
+var ackNames = map[byte]string{0: "allowed", 1: "denied", 2: "pending approval"}
+
+// Transcript prints the recorded conversation of a request, one message per
+// row, timed from the request.
+func (c *Client) Transcript(ctx context.Context, requestID string) error {
+	resp, err := c.do(ctx, http.MethodGet, "/api/transcripts/"+url.PathEscape(requestID), nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var records []transcriptRecord
+	if err := json.NewDecoder(resp.Body).Decode(&records); err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		fmt.Println("Empty transcript")
+		return nil
+	}
+
+	table := cliout.NewTable(c.out,
+		cliout.Column{Name: "TIME"},
+		cliout.Column{Name: "DIR"},
+		cliout.Column{Name: "TYPE"},
+		cliout.Column{Name: "SIZE"},
+		cliout.Column{Name: "PAYLOAD", MaxWidth: 80},
+	)
+	start := records[0].Time
+	for _, rec := range records {
+		dir := cliout.Colored("<-", cliout.Dim)
+		if rec.Direction == "in" {
+			dir = cliout.Colored("->", cliout.Yellow)
+		}
+		table.AddRow(
+			cliout.Plain(fmt.Sprintf("+%.3fs", rec.Time.Sub(start).Seconds())),
+			dir,
+			cliout.Plain(rec.Type),
+			cliout.Plain(cliout.FormatBytes(int64(rec.Size))),
+			cliout.Plain(describePayload(rec)),
+		)
+	}
+	return table.Render(os.Stdout)
+}
+
+// describePayload renders a record's payload for humans: acks and exit
+// codes by meaning, output as quoted text, JSON messages as they are.
+func describePayload(rec transcriptRecord) string {
+	var s string
+	switch {
+	case rec.Type == "ack" && len(rec.Payload) == 1:
+		s = ackNames[rec.Payload[0]]
+		if s == "" {
+			s = "unknown ack " + strconv.Itoa(int(rec.Payload[0]))
+		}
+	case rec.Type == "exit" && (len(rec.Payload) == 1 || len(rec.Payload) == 4):
+		s = "exit code " + strconv.Itoa(protocol.ParseExitCode(protocol.Frame{Payload: rec.Payload}))
+	case rec.Type == "request" || rec.Type == "meta":
+		s = string(rec.Payload)
+	default:
+		s = strconv.Quote(string(rec.Payload))
+	}
+	if rec.Truncated {
+		s += " (truncated)"
+	}
+	return s
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"clawrden/internal/bridgecache"
+	"clawrden/internal/bridgemsg"
+	"clawrden/pkg/protocol"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// backoffBase and backoffMax bound the delay after consecutive Slack errors.
+	backoffBase = 5 * time.Second
+	backoffMax  = 5 * time.Minute
+
+	// resolveGrace is how long a request that left the queue waits for its
+	// history entry (approved commands are audited only after they finish).
+	resolveGrace = 30 * time.Minute
+)
+
+// Bridge forwards pending requests to Slack and updates the messages once
+// the requests are resolved.
+type Bridge struct {
+	warden    *WardenClient
+	slack     *SlackClient
+	state     *State
+	name      string // Reported to the warden, e.g. "slack-bridge"
+	wardenURL string
+	messages  *bridgemsg.Templates
+	backoff   backoff
+	now       func() time.Time
+
+	queued     []string // Sorted IDs in the queue at the last poll
+	unresolved []string // Requests that left the queue but whose messages are not updated yet
+}
+
+// NewBridge creates a bridge using the given clients, persistent state and
+// message templates. name identifies it to the warden.
+func NewBridge(warden *WardenClient, slack *SlackClient, state *State, name, wardenURL string, messages *bridgemsg.Templates) *Bridge {
+	return &Bridge{
+		warden:    warden,
+		slack:     slack,
+		state:     state,
+		name:      name,
+		wardenURL: wardenURL,
+		messages:  messages,
+		now:       time.Now,
+
+		// Requests notified before a restart may have left the queue since
+		queued: state.Messages.IDs(),
+	}
+}
+
+// Poll runs one polling cycle: notify new requests, then update resolved ones.
+func (b *Bridge) Poll(ctx context.Context) error {
+	items, err := b.warden.GetQueue(ctx)
+	if err != nil {
+		return fmt.Errorf("fetch queue: %w", err)
+	}
+	items = slices.DeleteFunc(items, func(item QueueItem) bool { return !item.routed() })
+
+	changed := b.announceMaintenance(ctx)
+	if b.notify(ctx, items) {
+		changed = true
+	}
+
+	// Only requests that left the queue since the last poll need resolving
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	slices.Sort(ids)
+	_, removed := bridgecache.Diff(b.queued, ids)
+	b.queued = ids
+	gone := append(b.unresolved, removed...)
+	if len(gone) > 0 && b.resolve(ctx, gone) {
+		changed = true
+	}
+	b.unresolved = nil
+	for _, id := range gone {
+		if _, ok := b.state.Messages.Get(id); ok {
+			b.unresolved = append(b.unresolved, id)
+		}
+	}
+
+	if changed {
+		if err := b.state.Save(); err != nil {
+			log.Printf("Warning: failed to save state: %v", err)
+		}
+	}
+	return nil
+}
+
+// announceMaintenance posts a warden maintenance window once.
+func (b *Bridge) announceMaintenance(ctx context.Context) bool {
+	m, err := b.warden.GetMaintenance(ctx)
+	if err != nil {
+		log.Printf("Error fetching maintenance: %v", err)
+		return false
+	}
+	if m == nil || m.ID == b.state.Maintenance || !b.backoff.ready(b.now()) {
+		return false
+	}
+
+	if _, err := b.slack.Post(ctx, b.maintenanceText(m)); err != nil {
+		delay := b.backoff.fail(b.now(), err)
+		log.Printf("Error posting to Slack: %v (retrying in %v)", err, delay.Round(time.Second))
+		return false
+	}
+	b.backoff.reset()
+
+	b.state.Maintenance = m.ID
+	log.Printf("Announced warden maintenance %s in Slack", m.ID)
+	return true
+}
+
+// notify posts a message for each queued request not yet notified, and a
+// reminder for each whose next notify generation is due.
+func (b *Bridge) notify(ctx context.Context, items []QueueItem) bool {
+	changed := false
+	for _, item := range items {
+		prev, tracked := b.state.Messages.Get(item.ID)
+		posted, acked := item.NotifiedGenerations[b.name]
+		if tracked {
+			posted = max(posted, prev.Generation)
+		}
+		if (tracked || acked) && item.NotifyGeneration <= posted {
+			if !tracked {
+				// Posted before a restart that lost the state file; the
+				// message can no longer be updated, but must not repeat
+				b.state.Messages.Put(item.ID, NotifiedMessage{Command: formatCommand(item), NotifiedAt: b.now(), Generation: posted})
+				changed = true
+			}
+			continue
+		}
+		if !b.backoff.ready(b.now()) {
+			return changed
+		}
+
+		cmdStr := formatCommand(item)
+		reminder := tracked || acked
+		text := b.pendingText(item)
+		if reminder {
+			text = b.reminderText(item)
+		}
+		msg, err := b.slack.Post(ctx, text)
+		if err != nil {
+			delay := b.backoff.fail(b.now(), err)
+			log.Printf("Error posting to Slack: %v (retrying in %v)", err, delay.Round(time.Second))
+			return changed
+		}
+		b.backoff.reset()
+
+		msg.Command = cmdStr
+		msg.NotifiedAt = b.now()
+		msg.Generation = item.NotifyGeneration
+		if evicted := b.state.Messages.Put(item.ID, msg); len(evicted) > 0 {
+			log.Printf("Warning: tracking more than %d requests; forgot %d, whose messages will not be updated", b.state.Messages.Max(), len(evicted))
+		}
+		changed = true
+		if reminder {
+			log.Printf("Reminded Slack about request %s: %s", item.ID, cmdStr)
+		} else {
+			log.Printf("Notified Slack about request %s: %s", item.ID, cmdStr)
+			if err := b.warden.MarkViewed(ctx, item.ID); err != nil {
+				log.Printf("Warning: could not mark request %s viewed: %v", item.ID, err)
+			}
+		}
+		if err := b.warden.MarkNotified(ctx, item.ID, b.name, item.NotifyGeneration); err != nil {
+			log.Printf("Warning: could not mark request %s notified: %v", item.ID, err)
+		}
+	}
+	return changed
+}
+
+// resolve updates the messages of requests that left the queue with their
+// outcome from the warden's history, then forgets them.
+func (b *Bridge) resolve(ctx context.Context, ids []string) bool {
+	changed := false
+
+	// Webhook messages can't be edited; just forget them
+	if !b.slack.CanUpdate() {
+		for _, id := range ids {
+			b.state.Messages.Delete(id)
+		}
+		return true
+	}
+
+	history, err := b.warden.GetHistory(ctx)
+	if err != nil {
+		log.Printf("Error fetching history: %v", err)
+		return false
+	}
+	outcomes := make(map[string]string)
+	for _, entry := range history {
+		// Approval link uses share the request's ID; only its decision counts
+		if entry.RequestID != "" && entry.Decision != protocol.DecisionEvent && entry.Decision != protocol.DecisionRejected {
+			outcomes[entry.RequestID] = outcomeFor(entry)
+		}
+	}
+
+	now := b.now()
+	for _, id := range ids {
+		msg, ok := b.state.Messages.Get(id)
+		if !ok {
+			continue // Never notified, or forgotten
+		}
+		if msg.ResolvedAt.IsZero() {
+			msg.ResolvedAt = now
+			b.state.Messages.Put(id, msg)
+			changed = true
+		}
+
+		outcome, ok := outcomes[id]
+		if !ok {
+			if now.Sub(msg.ResolvedAt) < resolveGrace {
+				continue // Possibly still running; check again next tick
+			}
+			outcome = "resolved"
+		}
+
+		if msg.TS != "" {
+			if !b.backoff.ready(now) {
+				return changed
+			}
+			if err := b.slack.Update(ctx, msg, b.resolvedText(id, msg.Command, outcome)); err != nil {
+				delay := b.backoff.fail(now, err)
+				log.Printf("Error updating Slack message for %s: %v (retrying in %v)", id, err, delay.Round(time.Second))
+				return changed
+			}
+			b.backoff.reset()
+			log.Printf("Marked request %s as %s in Slack", id, outcome)
+		}
+
+		b.state.Messages.Delete(id)
+		changed = true
+	}
+	return changed
+}
+
+// pendingText formats the notification for a new request.
+func (b *Bridge) pendingText(item QueueItem) string {
+	req := item.message()
+	return b.render(bridgemsg.Pending, bridgemsg.Data{Request: req}, "Request %s needs approval: %s", req.ID, req.Command)
+}
+
+// reminderText formats the reminder of a request still waiting for review.
+func (b *Bridge) reminderText(item QueueItem) string {
+	req := item.message()
+	data := bridgemsg.Data{Request: req, Reminder: item.NotifyGeneration}
+	return b.render(bridgemsg.Reminder, data, "Request %s still needs approval: %s", req.ID, req.Command)
+}
+
+// maintenanceText formats the announcement of a maintenance window.
+func (b *Bridge) maintenanceText(m *Maintenance) string {
+	window := bridgemsg.MaintenanceWindow{ID: m.ID, Until: m.Until, QueueAsk: m.QueueAsk, Message: m.Message}
+	return b.render(bridgemsg.Maintenance, bridgemsg.Data{Maintenance: window}, "Warden maintenance until %s", m.Until.Local().Format("15:04 MST"))
+}
+
+// resolvedText formats the replacement text once a request is resolved.
+func (b *Bridge) resolvedText(id, cmdStr, outcome string) string {
+	data := bridgemsg.Data{Request: bridgemsg.Request{ID: id, Command: cmdStr}, Outcome: outcome}
+	return b.render(bridgemsg.Resolved, data, "Request %s %s: %s", id, outcome, cmdStr)
+}
+
+// render renders the message name. Templates are checked at startup, but
+// one can still fail on unusual data; the message then falls back to the
+// plain fallback format, so that no request goes unannounced.
+func (b *Bridge) render(name string, data bridgemsg.Data, fallback string, args ...any) string {
+	data.Links.Dashboard = b.wardenURL
+	text, err := b.messages.Render(name, data)
+	if err != nil {
+		log.Printf("Error rendering %s message: %v", name, err)
+		return fmt.Sprintf(fallback, args...)
+	}
+	return text
+}
+
+// outcomeFor maps an audit decision to a message outcome.
+func outcomeFor(entry HistoryItem) string {
+	switch {
+	case entry.Decision == protocol.DecisionAllow:
+		return "approved"
+	case entry.Outcome == protocol.OutcomeHITLExpired:
+		return "expired"
+	case entry.Decision == protocol.DecisionDeny:
+		return "denied"
+	}
+	return "resolved"
+}
+
+// formatCommand joins the command and its arguments.
+func formatCommand(item QueueItem) string {
+	if len(item.Args) > 0 {
+		return fmt.Sprintf("%s %s", item.Command, strings.Join(item.Args, " "))
+	}
+	return item.Command
+}
+
+// backoff tracks consecutive Slack failures and when to try again.
+type backoff struct {
+	failures int
+	until    time.Time
+}
+
+// ready reports whether Slack may be called at now.
+func (b *backoff) ready(now time.Time) bool {
+	return !now.Before(b.until)
+}
+
+// fail records a failure and returns the jittered delay before the next attempt.
+// A Retry-After from Slack is honored when it is longer.
+func (b *backoff) fail(now time.Time, err error) time.Duration {
+	if b.failures < 10 {
+		b.failures++
+	}
+	delay := backoffBase << (b.failures - 1)
+	if delay > backoffMax {
+		delay = backoffMax
+	}
+	// Jitter between half and the full delay so restarted bridges don't sync up
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+
+	var slackErr *SlackError
+	if errors.As(err, &slackErr) && slackErr.RetryAfter > delay {
+		delay = slackErr.RetryAfter
+	}
+	b.until = now.Add(delay)
+	return delay
+}
+
+// reset clears the failure count after a successful call.
+func (b *backoff) reset() {
+	b.failures = 0
+	b.until = time.Time{}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"clawrden/internal/bridgecache"
+	"clawrden/internal/bridgemsg"
+	"clawrden/pkg/protocol"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slackStub records Slack Web API calls.
+type slackStub struct {
+	mu      sync.Mutex
+	posts   []map[string]string
+	updates []map[string]string
+	fail    bool
+}
+
+func (s *slackStub) handler(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fail {
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+
+	var payload map[string]string
+	json.NewDecoder(r.Body).Decode(&payload)
+
+	switch r.URL.Path {
+	case "/chat.postMessage":
+		s.posts = append(s.posts, payload)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "channel": "C123", "ts": "1700000000.000100"})
+	case "/chat.update":
+		s.updates = append(s.updates, payload)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true})
+	default:
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "unknown_method"})
+	}
+}
+
+// wardenStub serves a mutable queue, history and maintenance window.
+type wardenStub struct {
+	mu          sync.Mutex
+	queue       []QueueItem
+	history     []HistoryItem
+	maintenance *Maintenance
+	viewed      []string // Requests marked viewed
+	notified    []string // "<id> <bridge> <generation>" of each MarkNotified
+}
+
+func (s *wardenStub) handler(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.URL.Path {
+	case "/api/queue":
+		json.NewEncoder(w).Encode(s.queue)
+	case "/api/history":
+		json.NewEncoder(w).Encode(s.history)
+	case "/api/maintenance":
+		if s.maintenance == nil {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(s.maintenance)
+	default:
+		if id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/queue/"), "/viewed"); ok && r.Method == http.MethodPost {
+			s.viewed = append(s.viewed, id)
+			return
+		}
+		if id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/queue/"), "/notified"); ok && r.Method == http.MethodPost {
+			var body struct {
+				Bridge     string `json:"bridge"`
+				Generation int    `json:"generation"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			s.notified = append(s.notified, fmt.Sprintf("%s %s %d", id, body.Bridge, body.Generation))
+			return
+		}
+		http.NotFound(w, r)
+	}
+}
+
+func newTestBridge(t *testing.T, statePath string, slack *slackStub, warden *wardenStub) *Bridge {
+	t.Helper()
+	slackSrv := httptest.NewServer(http.HandlerFunc(slack.handler))
+	t.Cleanup(slackSrv.Close)
+	wardenSrv := httptest.NewServer(http.HandlerFunc(warden.handler))
+	t.Cleanup(wardenSrv.Close)
+
+	state, err := LoadState(statePath, bridgecache.DefaultMaxTracked)
+	if err != nil {
+		t.Fatalf("LoadState: %v", err)
+	}
+	client := &SlackClient{
+		token:   "xoxb-test",
+		channel: "#approvals",
+		apiURL:  slackSrv.URL,
+		client:  slackSrv.Client(),
+	}
+	messages, err := bridgemsg.Load(bridgemsg.Slack, "", false)
+	if err != nil {
+		t.Fatalf("Load templates: %v", err)
+	}
+	return NewBridge(NewWardenClient(wardenSrv.URL, nil), client, state, "slack-bridge", wardenSrv.URL, messages)
+}
+
+func TestBridgeRestartDoesNotRenotify(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	slack := &slackStub{}
+	warden := &wardenStub{queue: []QueueItem{{ID: "req-1", Command: "npm", Args: []string{"install"}}}}
+
+	first := newTestBridge(t, statePath, slack, warden)
+	if err := first.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll: %v", err)
+	}
+	if len(slack.posts) != 1 {
+		t.Fatalf("posts = %d, want 1", len(slack.posts))
+	}
+
+	// A new bridge loading the same state file must not post again
+	second := newTestBridge(t, statePath, slack, warden)
+	if err := second.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll after restart: %v", err)
+	}
+	if len(slack.posts) != 1 {
+		t.Errorf("posts after restart = %d, want 1", len(slack.posts))
+	}
+	if msg, _ := second.state.Messages.Get("req-1"); msg.TS != "1700000000.000100" || msg.Channel != "C123" {
+		t.Errorf("restored message = %+v", msg)
+	}
+	if len(warden.viewed) != 1 || warden.viewed[0] != "req-1" {
+		t.Errorf("viewed = %q, want the delivered request once", warden.viewed)
+	}
+}
+
+func TestBridgeRemindsOfWaitingRequests(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	slack := &slackStub{}
+	warden := &wardenStub{queue: []QueueItem{{ID: "req-1", Command: "npm", Args: []string{"install"}}}}
+
+	bridge := newTestBridge(t, statePath, slack, warden)
+	poll := func() {
+		t.Helper()
+		if err := bridge.Poll(context.Background()); err != nil {
+			t.Fatalf("Poll: %v", err)
+		}
+	}
+	poll()
+	poll()
+	if len(slack.posts) != 1 {
+		t.Fatalf("posts = %d, want 1", len(slack.posts))
+	}
+
+	// The warden moves the request on to its next generation
+	warden.queue[0].NotifyGeneration = 1
+	poll()
+	poll()
+	if len(slack.posts) != 2 || !strings.Contains(slack.posts[1]["text"], "Still Waiting") {
+		t.Fatalf("posts = %v, want one reminder", slack.posts)
+	}
+	if want := []string{"req-1 slack-bridge 0", "req-1 slack-bridge 1"}; strings.Join(warden.notified, ",") != strings.Join(want, ",") {
+		t.Errorf("notified = %q, want %q", warden.notified, want)
+	}
+	if len(warden.viewed) != 1 {
+		t.Errorf("viewed = %q, want the first message only", warden.viewed)
+	}
+
+	// A bridge that lost its state trusts the warden's record of what it posted
+	warden.queue[0].NotifiedGenerations = map[string]int{"slack-bridge": 1}
+	fresh := newTestBridge(t, filepath.Join(t.TempDir(), "state.json"), slack, warden)
+	if err := fresh.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll: %v", err)
+	}
+	if len(slack.posts) != 2 {
+		t.Errorf("posts after losing state = %d, want 2", len(slack.posts))
+	}
+}
+
+func TestBridgeAnnouncesMaintenanceOnce(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	slack := &slackStub{}
+	warden := &wardenStub{maintenance: &Maintenance{ID: "mnt-1", Message: "upgrading", Until: time.Now().Add(10 * time.Minute)}}
+
+	bridge := newTestBridge(t, statePath, slack, warden)
+	bridge.Poll(context.Background())
+	bridge.Poll(context.Background())
+	if len(slack.posts) != 1 || !strings.Contains(slack.posts[0]["text"], "upgrading") {
+		t.Fatalf("posts = %v, want one maintenance announcement", slack.posts)
+	}
+
+	// Not again after a restart, but a new window is announced
+	restarted := newTestBridge(t, statePath, slack, warden)
+	restarted.Poll(context.Background())
+	warden.maintenance = &Maintenance{ID: "mnt-2", Message: "second try", Until: time.Now().Add(time.Minute), QueueAsk: true}
+	restarted.Poll(context.Background())
+	if len(slack.posts) != 2 || !strings.Contains(slack.posts[1]["text"], "still queued") {
+		t.Errorf("posts = %v, want a second announcement for the new window", slack.posts)
+	}
+}
+
+func TestBridgeUpdatesMessageOnResolution(t *testing.T) {
+	tests := []struct {
+		entry HistoryItem
+		want  string
+	}{
+		{HistoryItem{Decision: protocol.DecisionAllow, Outcome: protocol.OutcomeAfterHITL}, "Approved"},
+		{HistoryItem{Decision: protocol.DecisionDeny, Outcome: protocol.OutcomeAfterHITL}, "Denied"},
+		{HistoryItem{Decision: protocol.DecisionDeny, Outcome: protocol.OutcomeHITLExpired}, "Expired"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			statePath := filepath.Join(t.TempDir(), "state.json")
+			slack := &slackStub{}
+			warden := &wardenStub{queue: []QueueItem{{ID: "req-7", Command: "terraform", Args: []string{"apply"}}}}
+			bridge := newTestBridge(t, statePath, slack, warden)
+
+			if err := bridge.Poll(context.Background()); err != nil {
+				t.Fatalf("Poll: %v", err)
+			}
+
+			// The request leaves the queue and shows up in history
+			warden.queue = nil
+			// Preceded by the approval link use, which shares its ID
+			tt.entry.RequestID = "req-7"
+			warden.history = []HistoryItem{{RequestID: "req-7", Decision: protocol.DecisionEvent}, tt.entry}
+			if err := bridge.Poll(context.Background()); err != nil {
+				t.Fatalf("Poll: %v", err)
+			}
+
+			if len(slack.updates) != 1 {
+				t.Fatalf("updates = %d, want 1", len(slack.updates))
+			}
+			update := slack.updates[0]
+			if update["ts"] != "1700000000.000100" || update["channel"] != "C123" {
+				t.Errorf("update targeted %s/%s", update["channel"], update["ts"])
+			}
+			if !strings.Contains(update["text"], tt.want) || !strings.Contains(update["text"], "terraform apply") {
+				t.Errorf("update text = %q, want %q", update["text"], tt.want)
+			}
+
+			reloaded, err := LoadState(statePath, bridgecache.DefaultMaxTracked)
+			if err != nil {
+				t.Fatalf("LoadState: %v", err)
+			}
+			if reloaded.Messages.Has("req-7") {
+				t.Error("resolved request still in persisted state")
+			}
+		})
+	}
+}
+
+func TestBridgeWaitsForHistoryBeforeUpdating(t *testing.T) {
+	slack := &slackStub{}
+	warden := &wardenStub{queue: []QueueItem{{ID: "req-3", Command: "make"}}}
+	bridge := newTestBridge(t, "", slack, warden)
+	now := time.Now()
+	bridge.now = func() time.Time { return now }
+
+	bridge.Poll(context.Background())
+	warden.queue = nil
+
+	// Approved but still running: no history entry yet
+	bridge.Poll(context.Background())
+	if len(slack.updates) != 0 {
+		t.Fatalf("updated before outcome was known")
+	}
+
+	// Past the grace period the message is closed out without an outcome
+	now = now.Add(resolveGrace + time.Minute)
+	bridge.Poll(context.Background())
+	if len(slack.updates) != 1 || !strings.Contains(slack.updates[0]["text"], "Resolved") {
+		t.Errorf("updates = %v, want one Resolved update", slack.updates)
+	}
+}
+
+func TestBridgeResolvesRequestsThatLeftWhileDown(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	slack := &slackStub{}
+	warden := &wardenStub{queue: []QueueItem{{ID: "req-1", Command: "make"}, {ID: "req-2", Command: "ls"}}}
+	newTestBridge(t, statePath, slack, warden).Poll(context.Background())
+
+	// req-1 is approved while the bridge is down; only it is updated
+	warden.queue = warden.queue[1:]
+	warden.history = []HistoryItem{{RequestID: "req-1", Decision: protocol.DecisionAllow, Outcome: protocol.OutcomeAfterHITL}}
+	bridge := newTestBridge(t, statePath, slack, warden)
+	if err := bridge.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll after restart: %v", err)
+	}
+	if len(slack.updates) != 1 || !strings.Contains(slack.updates[0]["text"], "Approved") {
+		t.Errorf("updates = %v, want req-1 marked approved", slack.updates)
+	}
+	if got := bridge.state.Messages.IDs(); len(got) != 1 || got[0] != "req-2" {
+		t.Errorf("tracked = %q, want [req-2]", got)
+	}
+}
+
+func TestBridgeBacksOffOnSlackErrors(t *testing.T) {
+	slack := &slackStub{fail: true}
+	warden := &wardenStub{queue: []QueueItem{{ID: "req-1", Command: "ls"}, {ID: "req-2", Command: "cat"}}}
+	bridge := newTestBridge(t, "", slack, warden)
+	now := time.Now()
+	bridge.now = func() time.Time { return now }
+
+	bridge.Poll(context.Background())
+	if bridge.backoff.failures != 1 {
+		t.Fatalf("failures = %d, want 1 (stop after first error)", bridge.backoff.failures)
+	}
+	if bridge.backoff.ready(now) {
+		t.Fatal("bridge should be backing off")
+	}
+
+	// Polling again during the backoff doesn't call Slack
+	slack.fail = false
+	bridge.Poll(context.Background())
+	if len(slack.posts) != 0 {
+		t.Fatalf("posted during backoff")
+	}
+
+	now = now.Add(backoffMax)
+	bridge.Poll(context.Background())
+	if len(slack.posts) != 2 {
+		t.Errorf("posts after backoff = %d, want 2", len(slack.posts))
+	}
+	if bridge.backoff.failures != 0 {
+		t.Errorf("failures not reset after success")
+	}
+}
+
+func TestBackoffHonorsRetryAfter(t *testing.T) {
+	var b backoff
+	now := time.Now()
+	delay := b.fail(now, &SlackError{Message: "rate limited", RetryAfter: time.Hour})
+	if delay != time.Hour {
+		t.Errorf("delay = %v, want Retry-After of 1h", delay)
+	}
+
+	b.reset()
+	for i := 0; i < 20; i++ {
+		delay = b.fail(now, context.DeadlineExceeded)
+	}
+	if delay > backoffMax || delay < backoffMax/2 {
+		t.Errorf("capped delay = %v, want within [%v, %v]", delay, backoffMax/2, backoffMax)
+	}
+}
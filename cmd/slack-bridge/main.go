@@ -2,20 +2,43 @@ package main
 
 import (
 	"bytes"
+	"clawrden/internal/bridgecache"
+	"clawrden/internal/bridgemsg"
+	"clawrden/internal/bridgenet"
+	"clawrden/pkg/protocol"
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
-	"strings"
+	"slices"
 	"time"
 )
 
+const (
+	bridgeType        = "slack"
+	bridgeVersion     = "1.0.0"
+	heartbeatInterval = 30 * time.Second
+
+	// chatTimeout bounds a Slack call, including retries of transient errors
+	chatTimeout = 45 * time.Second
+
+	pollInterval = 5 * time.Second
+	pollTimeout  = 2 * time.Minute // Bounds one poll, Slack calls included
+	outageReport = 5 * time.Minute // How often a warden outage is summarized
+)
+
 // WardenClient communicates with the Clawrden warden API
 type WardenClient struct {
 	baseURL string
 	client  *http.Client
+
+	// The bridge's reviewer token (WARDEN_REVIEWER_TOKEN), with which its
+	// approvals count towards asks routed to its channel
+	reviewerToken string
 }
 
 // QueueItem represents a pending HITL request
@@ -28,13 +51,70 @@ type QueueItem struct {
 		UID int `json:"uid"`
 		GID int `json:"gid"`
 	} `json:"identity"`
+	Timestamp time.Time `json:"timestamp"` // When it entered the queue
+	TaskID    string    `json:"task_id,omitempty"`
+	RunID     string    `json:"run_id,omitempty"`
+
+	Risk        string     `json:"risk,omitempty"`
+	AutoApprove *time.Time `json:"auto_approve_at,omitempty"` // Set for low-risk asks
+
+	// What the warden worked out the command would touch
+	Annotations []struct {
+		Command string `json:"command"`
+		Summary string `json:"summary"`
+	} `json:"annotations,omitempty"`
+
+	// Reminders: the generation due now, which counts up every
+	// hitl.renotify_after the request waits, and the last each bridge posted
+	NotifyGeneration    int            `json:"notify_generation"`
+	NotifiedGenerations map[string]int `json:"notified_generations,omitempty"`
+
+	// Where the policy routes the request's risk tier; empty means everywhere
+	Channels []string `json:"channels,omitempty"`
+}
+
+// routed reports whether the request is posted by this bridge.
+func (item QueueItem) routed() bool {
+	return len(item.Channels) == 0 || slices.Contains(item.Channels, bridgeType)
+}
+
+// message returns what the message templates know about the request.
+func (item QueueItem) message() bridgemsg.Request {
+	req := bridgemsg.Request{
+		ID:            item.ID,
+		Command:       formatCommand(item),
+		Program:       item.Command,
+		Args:          item.Args,
+		Cwd:           item.Cwd,
+		UID:           item.Identity.UID,
+		GID:           item.Identity.GID,
+		TaskID:        item.TaskID,
+		RunID:         item.RunID,
+		Risk:          item.Risk,
+		QueuedAt:      item.Timestamp,
+		AutoApproveAt: item.AutoApprove,
+	}
+	for _, a := range item.Annotations {
+		if a.Summary != "" {
+			req.Annotations = append(req.Annotations, bridgemsg.Annotation{Command: a.Command, Summary: a.Summary})
+		}
+	}
+	return req
 }
 
-// NewWardenClient creates a new warden API client
-func NewWardenClient(baseURL string) *WardenClient {
+// NewWardenClient creates a new warden API client. A nil transport uses
+// http.DefaultTransport.
+func NewWardenClient(baseURL string, transport http.RoundTripper) *WardenClient {
 	return &WardenClient{
 		baseURL: baseURL,
-		client:  &http.Client{Timeout: 10 * time.Second},
+		client:  &http.Client{Transport: transport, Timeout: 10 * time.Second},
+	}
+}
+
+// authorize sends the reviewer token, if the bridge has one, with a decision.
+func (w *WardenClient) authorize(req *http.Request) {
+	if w.reviewerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+w.reviewerToken)
 	}
 }
 
@@ -62,13 +142,82 @@ func (w *WardenClient) GetQueue(ctx context.Context) ([]QueueItem, error) {
 	return items, nil
 }
 
-// Approve approves a pending request
-func (w *WardenClient) Approve(ctx context.Context, id string) error {
+// HistoryItem is the subset of an audit entry the bridge uses to
+// find out how a queued request was resolved
+type HistoryItem struct {
+	RequestID string            `json:"request_id"`
+	Decision  protocol.Decision `json:"decision"`
+	Outcome   protocol.Outcome  `json:"outcome"`
+}
+
+// GetHistory fetches the warden's audit history
+func (w *WardenClient) GetHistory(ctx context.Context) ([]HistoryItem, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", w.baseURL+"/api/history", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API returned status %d", resp.StatusCode)
+	}
+
+	var items []HistoryItem
+	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Maintenance is an announced warden maintenance window
+type Maintenance struct {
+	ID       string    `json:"id"`
+	Message  string    `json:"message"`
+	Until    time.Time `json:"until"`
+	QueueAsk bool      `json:"queue_ask"`
+}
+
+// GetMaintenance fetches the active maintenance window, or nil if there is none
+func (w *WardenClient) GetMaintenance(ctx context.Context) (*Maintenance, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", w.baseURL+"/api/maintenance", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API returned status %d", resp.StatusCode)
+	}
+
+	var m Maintenance
+	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Approve approves a pending request. A message, if not empty, is shown to
+// the agent before the command runs.
+func (w *WardenClient) Approve(ctx context.Context, id, message string) error {
 	url := fmt.Sprintf("%s/api/queue/%s/approve", w.baseURL, id)
-	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, resolutionBody(message))
 	if err != nil {
 		return err
 	}
+	w.authorize(req)
 
 	resp, err := w.client.Do(req)
 	if err != nil {
@@ -82,13 +231,15 @@ func (w *WardenClient) Approve(ctx context.Context, id string) error {
 	return nil
 }
 
-// Deny denies a pending request
-func (w *WardenClient) Deny(ctx context.Context, id string) error {
+// Deny denies a pending request. A message, if not empty, is shown to the
+// agent with the denial.
+func (w *WardenClient) Deny(ctx context.Context, id, message string) error {
 	url := fmt.Sprintf("%s/api/queue/%s/deny", w.baseURL, id)
-	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, resolutionBody(message))
 	if err != nil {
 		return err
 	}
+	w.authorize(req)
 
 	resp, err := w.client.Do(req)
 	if err != nil {
@@ -102,12 +253,111 @@ func (w *WardenClient) Deny(ctx context.Context, id string) error {
 	return nil
 }
 
+// resolutionBody is the body of an approval or denial carrying the
+// reviewer's message, or nil without one.
+func resolutionBody(message string) io.Reader {
+	if message == "" {
+		return nil
+	}
+	data, _ := json.Marshal(map[string]string{"message_to_requester": message})
+	return bytes.NewReader(data)
+}
+
+// MarkViewed tells the warden a request's notification was delivered, so it
+// can tell notification latency from the reviewer's
+func (w *WardenClient) MarkViewed(ctx context.Context, id string) error {
+	url := fmt.Sprintf("%s/api/queue/%s/viewed", w.baseURL, id)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("mark viewed failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// MarkNotified tells the warden the bridge posted the given notification
+// generation of a request: 0 for the first message, then one per reminder.
+func (w *WardenClient) MarkNotified(ctx context.Context, id, bridge string, generation int) error {
+	url := fmt.Sprintf("%s/api/queue/%s/notified", w.baseURL, id)
+	body, _ := json.Marshal(map[string]any{"bridge": bridge, "generation": generation})
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("mark notified failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Heartbeat tells the warden this bridge is alive
+func (w *WardenClient) Heartbeat(ctx context.Context, name, bridgeType, version string) error {
+	body, err := json.Marshal(map[string]string{
+		"name":    name,
+		"type":    bridgeType,
+		"version": version,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", w.baseURL+"/api/bridges/heartbeat", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("heartbeat failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sendHeartbeats reports to the warden every heartbeatInterval until ctx is done
+func sendHeartbeats(ctx context.Context, warden *WardenClient, name string) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		if err := warden.Heartbeat(ctx, name, bridgeType, bridgeVersion); err != nil {
+			log.Printf("Error sending heartbeat to warden: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 // SlackMessage represents a Slack message payload
 type SlackMessage struct {
-	Channel string             `json:"channel"`
-	Text    string             `json:"text"`
-	Blocks  []SlackBlock       `json:"blocks,omitempty"`
-	Actions []SlackAction      `json:"attachments,omitempty"`
+	Channel string        `json:"channel"`
+	Text    string        `json:"text"`
+	Blocks  []SlackBlock  `json:"blocks,omitempty"`
+	Actions []SlackAction `json:"attachments,omitempty"`
 }
 
 // SlackBlock represents a Slack block
@@ -140,96 +390,95 @@ type SlackButton struct {
 	Style string `json:"style,omitempty"`
 }
 
-// Simple Slack webhook client (without SDK to avoid dependencies)
-func postToSlack(webhookURL, message string) error {
-	payload := map[string]string{"text": message}
-	data, _ := json.Marshal(payload)
-
-	resp, err := http.Post(webhookURL, "application/json", bytes.NewBuffer(data))
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("slack returned status %d", resp.StatusCode)
-	}
-	return nil
-}
-
 func main() {
+	maxTracked := flag.Int("max-tracked", bridgecache.DefaultMaxTracked, "Most requests remembered as notified; beyond it the oldest messages are no longer updated")
+	flag.Parse()
+
 	webhookURL := os.Getenv("SLACK_WEBHOOK_URL")
+	botToken := os.Getenv("SLACK_BOT_TOKEN")
+	channel := os.Getenv("SLACK_CHANNEL")
 	wardenURL := os.Getenv("WARDEN_API_URL")
+	statePath := os.Getenv("SLACK_STATE_FILE")
+	bridgeName := os.Getenv("BRIDGE_NAME")
 
-	if webhookURL == "" {
-		log.Fatal("SLACK_WEBHOOK_URL environment variable is required")
+	if botToken == "" && webhookURL == "" {
+		log.Fatal("SLACK_BOT_TOKEN (with SLACK_CHANNEL) or SLACK_WEBHOOK_URL environment variable is required")
+	}
+	if botToken != "" && channel == "" {
+		log.Fatal("SLACK_CHANNEL environment variable is required with SLACK_BOT_TOKEN")
 	}
 
 	if wardenURL == "" {
 		wardenURL = "http://localhost:8080"
 	}
+	if statePath == "" {
+		statePath = "slack-bridge.state.json"
+	}
+	if bridgeName == "" {
+		bridgeName = "slack-bridge"
+	}
+
+	apiURL := os.Getenv("SLACK_API_URL")
+	if apiURL == "" {
+		apiURL = defaultSlackAPIURL
+	}
 
-	warden := NewWardenClient(wardenURL)
-	notified := make(map[string]bool)
+	messages, err := bridgemsg.LoadFromEnv(bridgemsg.Slack, os.Getenv)
+	if err != nil {
+		log.Fatalf("Invalid message template: %v", err)
+	}
 
-	log.Printf("Slack bridge started. Polling warden at %s every 5 seconds...", wardenURL)
+	state, err := LoadState(statePath, *maxTracked)
+	if err != nil {
+		log.Fatalf("Failed to load state from %s: %v", statePath, err)
+	}
 
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
+	netOpts, err := bridgenet.OptionsFromEnv(os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	transport, err := bridgenet.NewTransport(netOpts, log.Default())
+	if err != nil {
+		log.Fatalf("Failed to configure HTTP transport: %v", err)
+	}
+	slackURL := apiURL
+	if botToken == "" {
+		slackURL = webhookURL
+	}
+	log.Printf("Reaching Slack %s and the warden %s", bridgenet.DescribeProxy(transport, slackURL), bridgenet.DescribeProxy(transport, wardenURL))
+
+	slack := &SlackClient{
+		webhookURL: webhookURL,
+		token:      botToken,
+		channel:    channel,
+		apiURL:     apiURL,
+		plain:      messages.Plain(),
+		client:     &http.Client{Transport: bridgenet.WithRetry(transport, log.Default()), Timeout: chatTimeout},
+	}
+	warden := NewWardenClient(wardenURL, transport)
+	warden.reviewerToken = os.Getenv("WARDEN_REVIEWER_TOKEN")
+	bridge := NewBridge(warden, slack, state, bridgeName, wardenURL, messages)
 
-	for range ticker.C {
-		ctx := context.Background()
-		items, err := warden.GetQueue(ctx)
-		if err != nil {
-			log.Printf("Error fetching queue: %v", err)
-			continue
-		}
+	go sendHeartbeats(context.Background(), warden, bridgeName)
 
-		for _, item := range items {
-			if notified[item.ID] {
-				continue
-			}
-
-			// Format command
-			cmdStr := item.Command
-			if len(item.Args) > 0 {
-				cmdStr = fmt.Sprintf("%s %s", item.Command, strings.Join(item.Args, " "))
-			}
-
-			// Send notification to Slack
-			message := fmt.Sprintf(
-				"🔔 *New Command Approval Request*\n\n"+
-					"```%s```\n"+
-					"📁 Directory: `%s`\n"+
-					"👤 User: `uid:%d`\n"+
-					"🆔 Request ID: `%s`\n\n"+
-					"To approve: `./bin/clawrden-cli approve %s`\n"+
-					"To deny: `./bin/clawrden-cli deny %s`\n"+
-					"Or visit: http://localhost:8080",
-				cmdStr, item.Cwd, item.Identity.UID, item.ID, item.ID, item.ID,
-			)
-
-			if err := postToSlack(webhookURL, message); err != nil {
-				log.Printf("Error posting to Slack: %v", err)
-				continue
-			}
-
-			log.Printf("Notified Slack about request %s: %s", item.ID, cmdStr)
-			notified[item.ID] = true
-		}
+	mode := "webhook"
+	if slack.CanUpdate() {
+		mode = "bot token"
+	}
+	log.Printf("Slack bridge started (%s mode, %d tracked requests). Polling warden at %s every 5 seconds...",
+		mode, state.Messages.Len(), wardenURL)
+
+	outage := bridgenet.NewOutageLog("warden", outageReport, log.Default())
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
 
-		// Clean up notified map for completed requests
-		for id := range notified {
-			found := false
-			for _, item := range items {
-				if item.ID == id {
-					found = true
-					break
-				}
-			}
-			if !found {
-				delete(notified, id)
-			}
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), pollTimeout)
+		if err := bridge.Poll(ctx); err != nil {
+			outage.Fail(err)
+		} else {
+			outage.OK()
 		}
+		cancel()
 	}
 }
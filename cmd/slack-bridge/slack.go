@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"clawrden/internal/bridgenet"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// defaultSlackAPIURL is the base URL of the Slack Web API.
+const defaultSlackAPIURL = "https://slack.com/api"
+
+// SlackClient posts notifications either through an incoming webhook
+// (one-way) or through the Web API with a bot token, which also allows
+// updating messages after the request is resolved.
+type SlackClient struct {
+	webhookURL string
+	token      string
+	channel    string
+	apiURL     string
+	plain      bool // Post text verbatim, without mrkdwn formatting (PLAIN_TEXT)
+	client     *http.Client
+}
+
+// SlackError is returned for failed Slack calls. RetryAfter is set when
+// Slack rate-limits the bridge.
+type SlackError struct {
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *SlackError) Error() string {
+	return e.Message
+}
+
+// CanUpdate reports whether posted messages can be edited later (bot-token mode).
+func (s *SlackClient) CanUpdate() bool {
+	return s.token != ""
+}
+
+// Post sends a new message and returns where it was posted.
+// In webhook mode the returned message has no timestamp.
+func (s *SlackClient) Post(ctx context.Context, text string) (NotifiedMessage, error) {
+	if !s.CanUpdate() {
+		return NotifiedMessage{}, s.postWebhook(ctx, text)
+	}
+
+	var resp struct {
+		Channel string `json:"channel"`
+		TS      string `json:"ts"`
+	}
+	err := s.call(ctx, "chat.postMessage", s.payload(map[string]any{
+		"channel": s.channel,
+		"text":    text,
+	}), &resp)
+	if err != nil {
+		return NotifiedMessage{}, err
+	}
+	return NotifiedMessage{Channel: resp.Channel, TS: resp.TS}, nil
+}
+
+// Update replaces the text of a previously posted message.
+func (s *SlackClient) Update(ctx context.Context, msg NotifiedMessage, text string) error {
+	return s.call(ctx, "chat.update", s.payload(map[string]any{
+		"channel": msg.Channel,
+		"ts":      msg.TS,
+		"text":    text,
+	}), nil)
+}
+
+// payload adds the formatting options to a message payload.
+func (s *SlackClient) payload(p map[string]any) map[string]any {
+	if s.plain {
+		p["mrkdwn"] = false
+	}
+	return p
+}
+
+// postWebhook posts a message through the incoming webhook.
+func (s *SlackClient) postWebhook(ctx context.Context, text string) error {
+	data, _ := json.Marshal(s.payload(map[string]any{"text": text}))
+	req, err := http.NewRequestWithContext(ctx, "POST", s.webhookURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &SlackError{
+			Message:    fmt.Sprintf("slack returned status %d", resp.StatusCode),
+			RetryAfter: retryAfter(resp),
+		}
+	}
+	return nil
+}
+
+// call invokes a Slack Web API method and decodes the response into out.
+func (s *SlackClient) call(ctx context.Context, method string, payload interface{}, out interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.apiURL+"/"+method, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+s.token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &SlackError{
+			Message:    fmt.Sprintf("%s returned status %d", method, resp.StatusCode),
+			RetryAfter: retryAfter(resp),
+		}
+	}
+
+	var body struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	raw := new(bytes.Buffer)
+	if _, err := raw.ReadFrom(resp.Body); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw.Bytes(), &body); err != nil {
+		return fmt.Errorf("%s: decode response: %w", method, err)
+	}
+	if !body.OK {
+		return &SlackError{Message: fmt.Sprintf("%s failed: %s", method, body.Error)}
+	}
+	if out != nil {
+		return json.Unmarshal(raw.Bytes(), out)
+	}
+	return nil
+}
+
+// retryAfter parses the Retry-After header Slack sends when rate limiting.
+func retryAfter(resp *http.Response) time.Duration {
+	d, _ := bridgenet.RetryAfter(resp, time.Now())
+	return d
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"clawrden/internal/bridgecache"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// NotifiedMessage records the Slack message posted for a pending request.
+// Channel and TS are empty in webhook mode, where messages cannot be updated.
+type NotifiedMessage struct {
+	Channel    string    `json:"channel,omitempty"`
+	TS         string    `json:"ts,omitempty"`
+	Command    string    `json:"command"`
+	NotifiedAt time.Time `json:"notified_at"`
+	ResolvedAt time.Time `json:"resolved_at,omitempty"` // When the request left the queue
+	Generation int       `json:"generation,omitempty"`  // Reminders posted; TS is the latest message
+}
+
+// State is the bridge's persistent record of notified requests, keyed by
+// request ID, so restarts don't re-notify the whole queue. It remembers at
+// most maxTracked requests, each for bridgecache.DefaultTTL.
+type State struct {
+	path     string
+	Messages *bridgecache.Cache[NotifiedMessage]
+
+	// Maintenance is the ID of the last maintenance window announced
+	Maintenance string
+}
+
+// stateFile is the on-disk form of State.
+type stateFile struct {
+	Messages    map[string]NotifiedMessage `json:"messages"`
+	Maintenance string                     `json:"maintenance,omitempty"`
+}
+
+// LoadState reads the state file at path. A missing file yields empty state.
+func LoadState(path string, maxTracked int) (*State, error) {
+	state := &State{path: path, Messages: bridgecache.New[NotifiedMessage](maxTracked, bridgecache.DefaultTTL)}
+	if path == "" {
+		return state, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read state: %w", err)
+	}
+	var file stateFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse state: %w", err)
+	}
+	state.Maintenance = file.Maintenance
+
+	// Oldest first, so a smaller bound keeps the most recent requests
+	ids := make([]string, 0, len(file.Messages))
+	for id := range file.Messages {
+		ids = append(ids, id)
+	}
+	slices.SortFunc(ids, func(a, b string) int {
+		return file.Messages[a].NotifiedAt.Compare(file.Messages[b].NotifiedAt)
+	})
+	for _, id := range ids {
+		state.Messages.Put(id, file.Messages[id])
+	}
+	return state, nil
+}
+
+// Save writes the state file atomically (write to temp file, then rename).
+func (s *State) Save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(stateFile{Messages: s.Messages.Snapshot(), Maintenance: s.Maintenance}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".slack-bridge-state-*")
+	if err != nil {
+		return fmt.Errorf("create temp state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("rename state: %w", err)
+	}
+	return nil
+}
@@ -2,21 +2,43 @@ package main
 
 import (
 	"bytes"
+	"clawrden/internal/bridgecache"
+	"clawrden/internal/bridgemsg"
+	"clawrden/internal/bridgenet"
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
-	"net/url"
 	"os"
+	"slices"
 	"strings"
 	"time"
 )
 
+const (
+	bridgeType        = "telegram"
+	bridgeVersion     = "1.0.0"
+	heartbeatInterval = 30 * time.Second
+
+	// chatTimeout bounds a Telegram call, including retries of transient errors
+	chatTimeout = 45 * time.Second
+
+	pollInterval = 5 * time.Second
+	pollTimeout  = 30 * time.Second // Bounds the warden calls of one poll
+	outageReport = 5 * time.Minute  // How often a warden outage is summarized
+)
+
 // WardenClient communicates with the Clawrden warden API
 type WardenClient struct {
 	baseURL string
 	client  *http.Client
+
+	// The bridge's reviewer token (WARDEN_REVIEWER_TOKEN), with which its
+	// approvals count towards asks routed to its channel
+	reviewerToken string
 }
 
 // QueueItem represents a pending HITL request
@@ -29,13 +51,73 @@ type QueueItem struct {
 		UID int `json:"uid"`
 		GID int `json:"gid"`
 	} `json:"identity"`
+	Timestamp time.Time `json:"timestamp"` // When it entered the queue
+	TaskID    string    `json:"task_id,omitempty"`
+	RunID     string    `json:"run_id,omitempty"`
+
+	Risk        string     `json:"risk,omitempty"`
+	AutoApprove *time.Time `json:"auto_approve_at,omitempty"` // Set for low-risk asks
+
+	// What the warden worked out the command would touch
+	Annotations []struct {
+		Command string `json:"command"`
+		Summary string `json:"summary"`
+	} `json:"annotations,omitempty"`
+
+	// Reminders: the generation due now, which counts up every
+	// hitl.renotify_after the request waits, and the last each bridge posted
+	NotifyGeneration    int            `json:"notify_generation"`
+	NotifiedGenerations map[string]int `json:"notified_generations,omitempty"`
+
+	// Where the policy routes the request's risk tier; empty means everywhere
+	Channels []string `json:"channels,omitempty"`
+}
+
+// routed reports whether the request is posted by this bridge.
+func (item QueueItem) routed() bool {
+	return len(item.Channels) == 0 || slices.Contains(item.Channels, bridgeType)
+}
+
+// message returns what the message templates know about the request.
+func (item QueueItem) message() bridgemsg.Request {
+	req := bridgemsg.Request{
+		ID:            item.ID,
+		Command:       item.Command,
+		Program:       item.Command,
+		Args:          item.Args,
+		Cwd:           item.Cwd,
+		UID:           item.Identity.UID,
+		GID:           item.Identity.GID,
+		TaskID:        item.TaskID,
+		RunID:         item.RunID,
+		Risk:          item.Risk,
+		QueuedAt:      item.Timestamp,
+		AutoApproveAt: item.AutoApprove,
+	}
+	if len(item.Args) > 0 {
+		req.Command = fmt.Sprintf("%s %s", item.Command, strings.Join(item.Args, " "))
+	}
+	for _, a := range item.Annotations {
+		if a.Summary != "" {
+			req.Annotations = append(req.Annotations, bridgemsg.Annotation{Command: a.Command, Summary: a.Summary})
+		}
+	}
+	return req
 }
 
-// NewWardenClient creates a new warden API client
-func NewWardenClient(baseURL string) *WardenClient {
+// NewWardenClient creates a new warden API client. A nil transport uses
+// http.DefaultTransport.
+func NewWardenClient(baseURL string, transport http.RoundTripper) *WardenClient {
 	return &WardenClient{
 		baseURL: baseURL,
-		client:  &http.Client{Timeout: 10 * time.Second},
+		client:  &http.Client{Transport: transport, Timeout: 10 * time.Second},
+	}
+}
+
+// authorize sends the reviewer token, if the bridge has one, with a decision.
+func (w *WardenClient) authorize(req *http.Request) {
+	if w.reviewerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+w.reviewerToken)
 	}
 }
 
@@ -63,13 +145,50 @@ func (w *WardenClient) GetQueue(ctx context.Context) ([]QueueItem, error) {
 	return items, nil
 }
 
-// Approve approves a pending request
-func (w *WardenClient) Approve(ctx context.Context, id string) error {
+// Maintenance is an announced warden maintenance window
+type Maintenance struct {
+	ID       string    `json:"id"`
+	Message  string    `json:"message"`
+	Until    time.Time `json:"until"`
+	QueueAsk bool      `json:"queue_ask"`
+}
+
+// GetMaintenance fetches the active maintenance window, or nil if there is none
+func (w *WardenClient) GetMaintenance(ctx context.Context) (*Maintenance, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", w.baseURL+"/api/maintenance", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API returned status %d", resp.StatusCode)
+	}
+
+	var m Maintenance
+	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Approve approves a pending request. A message, if not empty, is shown to
+// the agent before the command runs.
+func (w *WardenClient) Approve(ctx context.Context, id, message string) error {
 	url := fmt.Sprintf("%s/api/queue/%s/approve", w.baseURL, id)
-	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, resolutionBody(message))
 	if err != nil {
 		return err
 	}
+	w.authorize(req)
 
 	resp, err := w.client.Do(req)
 	if err != nil {
@@ -83,13 +202,15 @@ func (w *WardenClient) Approve(ctx context.Context, id string) error {
 	return nil
 }
 
-// Deny denies a pending request
-func (w *WardenClient) Deny(ctx context.Context, id string) error {
+// Deny denies a pending request. A message, if not empty, is shown to the
+// agent with the denial.
+func (w *WardenClient) Deny(ctx context.Context, id, message string) error {
 	url := fmt.Sprintf("%s/api/queue/%s/deny", w.baseURL, id)
-	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, resolutionBody(message))
 	if err != nil {
 		return err
 	}
+	w.authorize(req)
 
 	resp, err := w.client.Do(req)
 	if err != nil {
@@ -103,19 +224,121 @@ func (w *WardenClient) Deny(ctx context.Context, id string) error {
 	return nil
 }
 
-// Simple Telegram Bot API client (without SDK to avoid dependencies)
-func sendTelegramMessage(botToken, chatID, message string) error {
+// resolutionBody is the body of an approval or denial carrying the
+// reviewer's message, or nil without one.
+func resolutionBody(message string) io.Reader {
+	if message == "" {
+		return nil
+	}
+	data, _ := json.Marshal(map[string]string{"message_to_requester": message})
+	return bytes.NewReader(data)
+}
+
+// MarkViewed tells the warden a request's notification was delivered, so it
+// can tell notification latency from the reviewer's
+func (w *WardenClient) MarkViewed(ctx context.Context, id string) error {
+	url := fmt.Sprintf("%s/api/queue/%s/viewed", w.baseURL, id)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("mark viewed failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// MarkNotified tells the warden the bridge sent the given notification
+// generation of a request: 0 for the first message, then one per reminder.
+func (w *WardenClient) MarkNotified(ctx context.Context, id, bridge string, generation int) error {
+	url := fmt.Sprintf("%s/api/queue/%s/notified", w.baseURL, id)
+	body, _ := json.Marshal(map[string]any{"bridge": bridge, "generation": generation})
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("mark notified failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Heartbeat tells the warden this bridge is alive
+func (w *WardenClient) Heartbeat(ctx context.Context, name, bridgeType, version string) error {
+	body, err := json.Marshal(map[string]string{
+		"name":    name,
+		"type":    bridgeType,
+		"version": version,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", w.baseURL+"/api/bridges/heartbeat", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("heartbeat failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sendHeartbeats reports to the warden every heartbeatInterval until ctx is done
+func sendHeartbeats(ctx context.Context, warden *WardenClient, name string) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		if err := warden.Heartbeat(ctx, name, bridgeType, bridgeVersion); err != nil {
+			log.Printf("Error sending heartbeat to warden: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Simple Telegram Bot API client (without SDK to avoid dependencies).
+// Plain messages are sent without a parse mode, so Telegram shows them as is.
+func sendTelegramMessage(client *http.Client, botToken, chatID, message string, plain bool) error {
 	apiURL := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", botToken)
 
 	payload := map[string]interface{}{
-		"chat_id":    chatID,
-		"text":       message,
-		"parse_mode": "Markdown",
+		"chat_id": chatID,
+		"text":    message,
+	}
+	if !plain {
+		payload["parse_mode"] = "Markdown"
 	}
 
 	data, _ := json.Marshal(payload)
 
-	resp, err := http.Post(apiURL, "application/json", bytes.NewBuffer(data))
+	resp, err := client.Post(apiURL, "application/json", bytes.NewBuffer(data))
 	if err != nil {
 		return err
 	}
@@ -128,9 +351,13 @@ func sendTelegramMessage(botToken, chatID, message string) error {
 }
 
 func main() {
+	maxTracked := flag.Int("max-tracked", bridgecache.DefaultMaxTracked, "Most requests remembered as notified; beyond it the oldest may be notified again")
+	flag.Parse()
+
 	botToken := os.Getenv("TELEGRAM_BOT_TOKEN")
 	chatID := os.Getenv("TELEGRAM_CHAT_ID")
 	wardenURL := os.Getenv("WARDEN_API_URL")
+	bridgeName := os.Getenv("BRIDGE_NAME")
 
 	if botToken == "" {
 		log.Fatal("TELEGRAM_BOT_TOKEN environment variable is required")
@@ -143,85 +370,131 @@ func main() {
 	if wardenURL == "" {
 		wardenURL = "http://localhost:8080"
 	}
+	if bridgeName == "" {
+		bridgeName = "telegram-bridge"
+	}
+
+	messages, err := bridgemsg.LoadFromEnv(bridgemsg.Telegram, os.Getenv)
+	if err != nil {
+		log.Fatalf("Invalid message template: %v", err)
+	}
+
+	netOpts, err := bridgenet.OptionsFromEnv(os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	transport, err := bridgenet.NewTransport(netOpts, log.Default())
+	if err != nil {
+		log.Fatalf("Failed to configure HTTP transport: %v", err)
+	}
+	log.Printf("Reaching Telegram %s and the warden %s",
+		bridgenet.DescribeProxy(transport, "https://api.telegram.org"), bridgenet.DescribeProxy(transport, wardenURL))
+
+	telegram := &http.Client{Transport: bridgenet.WithRetry(transport, log.Default()), Timeout: chatTimeout}
+	send := func(name string, data bridgemsg.Data) error {
+		data.Links.Dashboard = wardenURL
+		text, err := messages.Render(name, data)
+		if err != nil {
+			return fmt.Errorf("render %s message: %w", name, err)
+		}
+		return sendTelegramMessage(telegram, botToken, chatID, text, messages.Plain())
+	}
+	warden := NewWardenClient(wardenURL, transport)
+	warden.reviewerToken = os.Getenv("WARDEN_REVIEWER_TOKEN")
+	notified := bridgecache.New[int](*maxTracked, bridgecache.DefaultTTL)
+	var queued []string // Sorted IDs in the queue at the last poll
+	outage := bridgenet.NewOutageLog("warden", outageReport, log.Default())
+	announced := "" // Last maintenance window announced
 
-	warden := NewWardenClient(wardenURL)
-	notified := make(map[string]bool)
+	go sendHeartbeats(context.Background(), warden, bridgeName)
 
 	log.Printf("Telegram bridge started. Polling warden at %s every 5 seconds...", wardenURL)
 
 	// Send startup message
-	startMsg := "🛡️ *Clawrden Telegram Bot Started*\n\n" +
-		"I'll notify you of pending command approvals.\n\n" +
-		"Use the CLI to approve/deny:\n" +
-		"`./bin/clawrden-cli approve <id>`\n" +
-		"`./bin/clawrden-cli deny <id>`"
-
-	_ = sendTelegramMessage(botToken, chatID, startMsg)
+	_ = send(bridgemsg.Started, bridgemsg.Data{})
 
-	ticker := time.NewTicker(5 * time.Second)
+	ticker := time.NewTicker(pollInterval)
 	defer ticker.Stop()
 
 	for range ticker.C {
-		ctx := context.Background()
+		ctx, cancel := context.WithTimeout(context.Background(), pollTimeout)
 		items, err := warden.GetQueue(ctx)
 		if err != nil {
-			log.Printf("Error fetching queue: %v", err)
+			cancel()
+			outage.Fail(fmt.Errorf("fetch queue: %w", err))
 			continue
 		}
+		outage.OK()
+
+		// Announce each maintenance window once
+		if m, err := warden.GetMaintenance(ctx); err != nil {
+			log.Printf("Error fetching maintenance: %v", err)
+		} else if m != nil && m.ID != announced {
+			window := bridgemsg.MaintenanceWindow{ID: m.ID, Until: m.Until, QueueAsk: m.QueueAsk, Message: m.Message}
+			if err := send(bridgemsg.Maintenance, bridgemsg.Data{Maintenance: window}); err != nil {
+				log.Printf("Error sending to Telegram: %v", err)
+			} else {
+				log.Printf("Announced warden maintenance %s on Telegram", m.ID)
+				announced = m.ID
+			}
+		}
+
+		cancel()
 
 		for _, item := range items {
-			if notified[item.ID] {
+			if !item.routed() {
 				continue
 			}
-
-			// Format command
-			cmdStr := item.Command
-			if len(item.Args) > 0 {
-				cmdStr = fmt.Sprintf("%s %s", item.Command, strings.Join(item.Args, " "))
+			// The generation last sent, by this process or, before a
+			// restart, as the warden recorded it
+			posted, cached := notified.Get(item.ID)
+			acked, tracked := item.NotifiedGenerations[bridgeName]
+			posted, tracked = max(posted, acked), tracked || cached
+			if tracked && item.NotifyGeneration <= posted {
+				if !cached {
+					notified.Put(item.ID, posted)
+				}
+				continue
 			}
 
-			// Escape special Markdown characters
-			cmdStr = strings.ReplaceAll(cmdStr, "_", "\\_")
-			cmdStr = strings.ReplaceAll(cmdStr, "*", "\\*")
-			cmdStr = strings.ReplaceAll(cmdStr, "[", "\\[")
-			cmdStr = strings.ReplaceAll(cmdStr, "`", "\\`")
-
-			// Send notification to Telegram
-			message := fmt.Sprintf(
-				"🔔 *New Command Approval Request*\n\n"+
-					"```\n%s\n```\n"+
-					"📁 Directory: `%s`\n"+
-					"👤 User: `uid:%d`\n"+
-					"🆔 ID: `%s`\n\n"+
-					"*To approve:*\n"+
-					"`./bin/clawrden-cli approve %s`\n\n"+
-					"*To deny:*\n"+
-					"`./bin/clawrden-cli deny %s`\n\n"+
-					"Or visit: http://localhost:8080",
-				url.PathEscape(cmdStr), item.Cwd, item.Identity.UID, item.ID, item.ID, item.ID,
-			)
-
-			if err := sendTelegramMessage(botToken, chatID, message); err != nil {
+			req := item.message()
+			name, data := bridgemsg.Pending, bridgemsg.Data{Request: req}
+			if tracked {
+				name, data.Reminder = bridgemsg.Reminder, item.NotifyGeneration
+			}
+			if err := send(name, data); err != nil {
 				log.Printf("Error sending to Telegram: %v", err)
 				continue
 			}
 
-			log.Printf("Notified Telegram about request %s: %s", item.ID, cmdStr)
-			notified[item.ID] = true
-		}
-
-		// Clean up notified map for completed requests
-		for id := range notified {
-			found := false
-			for _, item := range items {
-				if item.ID == id {
-					found = true
-					break
+			ctx, cancel := context.WithTimeout(context.Background(), pollTimeout)
+			if tracked {
+				log.Printf("Reminded Telegram about request %s: %s", item.ID, req.Command)
+			} else {
+				log.Printf("Notified Telegram about request %s: %s", item.ID, req.Command)
+				if err := warden.MarkViewed(ctx, item.ID); err != nil {
+					log.Printf("Warning: could not mark request %s viewed: %v", item.ID, err)
 				}
 			}
-			if !found {
-				delete(notified, id)
+			if err := warden.MarkNotified(ctx, item.ID, bridgeName, item.NotifyGeneration); err != nil {
+				log.Printf("Warning: could not mark request %s notified: %v", item.ID, err)
 			}
+			cancel()
+			if evicted := notified.Put(item.ID, item.NotifyGeneration); len(evicted) > 0 {
+				log.Printf("Warning: tracking more than %d requests; forgot %d, which may be notified again", *maxTracked, len(evicted))
+			}
+		}
+
+		// Forget the requests that left the queue since the last poll
+		ids := make([]string, len(items))
+		for i, item := range items {
+			ids[i] = item.ID
+		}
+		slices.Sort(ids)
+		_, removed := bridgecache.Diff(queued, ids)
+		for _, id := range removed {
+			notified.Delete(id)
 		}
+		queued = ids
 	}
 }
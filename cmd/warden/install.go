@@ -0,0 +1,128 @@
+package main
+
+import (
+	"clawrden/internal/install"
+	"clawrden/internal/shimbin"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// runInstall runs `warden install` and `warden uninstall`. It returns the
+// exit status.
+func runInstall(cmd string, args []string) int {
+	fs := flag.NewFlagSet("warden "+cmd, flag.ContinueOnError)
+	user := fs.Bool("user", false, "Set up a systemd user unit with paths under $XDG_STATE_HOME and $XDG_CONFIG_HOME instead of a system-wide install")
+	dryRun := fs.Bool("dry-run", false, "Print what would be done without doing it")
+	policy := fs.String("policy", "", "Policy file the unit runs the warden with (default: policy.yaml in the configuration directory)")
+	binary := fs.String("binary", "", "Warden binary the unit runs (default: this one)")
+	shimPath := fs.String("shim", "", "Shim binary to put in the armory (default: the one embedded in the warden)")
+	purge := fs.Bool("purge", false, "uninstall: also remove the armory, jailhouse, transcripts, logs and socket directory")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: warden %s [flags] [-- warden flags for the unit]\n\n", cmd)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	opts := install.Options{ExtraArgs: fs.Args(), Policy: *policy, Purge: *purge}
+	if *user {
+		layout, err := install.UserLayout(os.Getenv)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warden %s: %v\n", cmd, err)
+			return 1
+		}
+		opts.Layout, opts.UID, opts.GID = layout, os.Getuid(), os.Getgid()
+	} else {
+		opts.Layout = install.SystemLayout()
+		if os.Geteuid() != 0 && !*dryRun {
+			fmt.Fprintf(os.Stderr, "warden %s: a system-wide install needs root; use sudo, or --user\n", cmd)
+			return 1
+		}
+	}
+
+	var ops []install.Op
+	if cmd == "uninstall" {
+		ops = install.PlanUninstall(opts)
+	} else {
+		var err error
+		if opts.Binary, err = wardenBinary(*binary); err != nil {
+			fmt.Fprintf(os.Stderr, "warden install: %v\n", err)
+			return 1
+		}
+		if opts.Policy != "" {
+			if opts.Policy, err = filepath.Abs(opts.Policy); err != nil {
+				fmt.Fprintf(os.Stderr, "warden install: %v\n", err)
+				return 1
+			}
+		}
+		if opts.Shim, err = shimFor(*shimPath); err != nil {
+			fmt.Fprintf(os.Stderr, "warden install: %v\n", err)
+			return 1
+		}
+		if ops, err = install.Plan(opts); err != nil {
+			fmt.Fprintf(os.Stderr, "warden install: %v\n", err)
+			return 1
+		}
+	}
+
+	if *dryRun {
+		for _, op := range ops {
+			fmt.Println(op)
+		}
+		return 0
+	}
+	err := install.Apply(ops, func(args []string) error {
+		c := exec.Command(args[0], args[1:]...)
+		c.Stdout, c.Stderr = os.Stderr, os.Stderr
+		return c.Run()
+	}, os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warden %s: %v\n", cmd, err)
+		return 1
+	}
+
+	if cmd == "install" {
+		unitPolicy := opts.Policy
+		if unitPolicy == "" {
+			unitPolicy = opts.Layout.PolicyFile()
+		}
+		if _, err := os.Stat(unitPolicy); err != nil {
+			fmt.Printf("note: %s does not exist yet; the warden will not start without it\n", unitPolicy)
+		}
+		if opts.Shim == nil {
+			fmt.Printf("note: no shim installed; put one at %s\n", filepath.Join(opts.Layout.Armory(), "clawrden-shim"))
+		}
+		systemctl := "systemctl"
+		if *user {
+			systemctl += " --user"
+		}
+		fmt.Printf("start the warden with: %s enable --now %s\n", systemctl, install.UnitName)
+	}
+	return 0
+}
+
+// wardenBinary returns the absolute path of the warden binary the unit
+// runs: path, or the running one.
+func wardenBinary(path string) (string, error) {
+	if path == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return "", fmt.Errorf("find the warden binary: %w (pass --binary)", err)
+		}
+		path = exe
+	}
+	return filepath.Abs(path)
+}
+
+// shimFor returns the shim to install: the file at path, or the embedded
+// one.
+func shimFor(path string) ([]byte, error) {
+	if path == "" {
+		return shimbin.Binary(), nil
+	}
+	return os.ReadFile(path)
+}
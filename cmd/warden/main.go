@@ -4,6 +4,9 @@
 package main
 
 import (
+	"bytes"
+	"clawrden/internal/securefile"
+	"clawrden/internal/shimbin"
 	"clawrden/internal/warden"
 	"flag"
 	"fmt"
@@ -11,46 +14,227 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 func main() {
+	if len(os.Args) > 1 && (os.Args[1] == "install" || os.Args[1] == "uninstall") {
+		os.Exit(runInstall(os.Args[1], os.Args[2:]))
+	}
+
 	socketPath := flag.String("socket", "/var/run/clawrden/warden.sock", "Path to the Unix Domain Socket")
 	policyPath := flag.String("policy", "policy.yaml", "Path to the policy configuration file")
+	check := flag.Bool("check", false, "Load the policy file, run its tests, print the result and exit")
 	auditPath := flag.String("audit", "/var/log/clawrden/audit.log", "Audit log file path")
+	auditFailureMode := flag.String("audit-failure-mode", "log", "What to do while the audit log cannot be written: log (count and log failures), block (deny new requests) or buffer (hold entries in memory until it recovers)")
+	fileCheck := flag.String("file-check", "warn", "When the policy file or audit log could be swapped by an untrusted user (a symlink, a writable parent directory, an unexpected owner): warn, strict (refuse to start or reload) or off")
+	fileOwner := flag.String("file-owner", "", "user[:group] that must own the policy file and audit log, e.g. root:root (default: root or the warden's user)")
+	auditBufferSize := flag.Int("audit-buffer-size", warden.DefaultAuditBufferSize, "Audit entries held in memory by the block and buffer failure modes")
+	auditSync := flag.String("audit-sync", "none", "When audit entries are fsynced: none (leave it to the OS), started (before each allowed command runs) or always (after every entry)")
 	apiAddr := flag.String("api", ":8080", "HTTP API server address")
+	grpcAddr := flag.String("grpc", "", "gRPC API server address (disabled when empty)")
+	grpcTokenFile := flag.String("grpc-token-file", "", "File holding the bearer token gRPC callers must send; any caller is accepted without it")
+	apiTLSCert := flag.String("api-tls-cert", "", "PEM certificate file for the HTTP API (serves plain HTTP without one); re-read when the API restarts")
+	apiTLSKey := flag.String("api-tls-key", "", "PEM key file for -api-tls-cert")
+	adminTokenFile := flag.String("admin-token-file", "", "File holding the bearer token for /api/admin/* endpoints; they are disabled without it")
+	reviewerTokensFile := flag.String("reviewer-tokens-file", "", "File of \"<name> <token> [channel]\" lines; approvals sent with one of these bearer tokens count as that reviewer's, and only they can approve asks needing several approvers or routed to channels")
+	apiDebug := flag.Bool("api-debug", false, "Log every HTTP API request")
+	slowRequest := flag.Duration("slow-request", time.Second, "Log HTTP API requests slower than this as warnings")
+	bridgeStaleAfter := flag.Duration("bridge-stale-after", 2*time.Minute, "Warn when a chat bridge sends no heartbeat for this long")
+	bridgeAlertWebhook := flag.String("bridge-alert-webhook", "", "URL to POST an alert to when a chat bridge goes silent")
+	approvalKeyFile := flag.String("approval-link-key-file", "", "File holding the HMAC key (32+ bytes) for one-time approve/deny links; links are disabled without it")
+	approvalLinkTTL := flag.Duration("approval-link-ttl", 15*time.Minute, "How long approve/deny links stay valid")
+	publicURL := flag.String("public-url", "", "Base URL reviewers use to reach the API, for approve/deny links (default: the Host header of the request minting them) and the dashboard links shims print while awaiting approval (default: none)")
+	incidentWebhook := flag.String("incident-webhook", "", "URL to POST an alert to when an incident opens or the Docker daemon goes down or recovers")
+	dockerPingInterval := flag.Duration("docker-ping-interval", 10*time.Second, "How often to check that the Docker daemon is reachable")
+	allowedOrigins := flag.String("allowed-origins", "", "Comma-separated origins whose pages may call the HTTP API, e.g. https://ops.example.com for a dashboard behind a reverse proxy")
+	console := flag.Bool("console", false, "Show pending requests on this terminal and read approve/deny decisions from stdin (needs a terminal)")
+	disableDashboard := flag.Bool("disable-dashboard", false, "Serve only the HTTP API, without the web dashboard")
 
 	// Jailhouse paths (always enabled)
 	armoryPath := flag.String("armory-path", "/var/lib/clawrden/armory", "Path to the armory (master shim location)")
 	jailhousePath := flag.String("jailhouse-path", "/var/lib/clawrden/jailhouse", "Path to the jailhouse root directory")
 	statePath := flag.String("state-path", "/var/lib/clawrden/jailhouse.state.json", "Path to the jailhouse state file")
+	noEmbeddedShim := flag.Bool("no-embedded-shim", false, "Never install the shim embedded in the warden; the armory must provide one")
+	autoJail := flag.Bool("auto-jail", false, "Create and destroy jails from clawrden.* container labels")
+	autoJailGrace := flag.Duration("auto-jail-grace", 30*time.Second, "Delay before destroying a label jail after its last container stops")
+	requireShim := flag.Bool("require-shim-provenance", false, "Deny requests unless the peer runs the armory shim through a jail symlink")
+	allowHostFallback := flag.Bool("allow-host-fallback", false, "Let policy rules with strategy: local run containerized requests on the warden host")
+	sandboxRoot := flag.String("sandbox-root", "", "Parent directory for sandboxed working directories (default: system temp dir)")
+	shadowPolicy := flag.String("shadow-policy", "", "Also evaluate requests against this policy without enforcing it, and report where it decides differently")
+	instanceID := flag.String("instance-id", "", "Name of this warden in the labels of its ghost containers, for removing its orphans after a crash (default: host name)")
+	maxGhosts := flag.Int("max-ghosts", 0, "Refuse new ghost containers while this many exist (0 = no cap)")
+	maxConnections := flag.Int("max-connections", 0, "Deny new shim requests while this many are being handled (0 = no cap)")
+	memoryWatermark := flag.Int64("memory-watermark-mb", 0, "Above this much memory in use (MiB), refuse ghost executions and skip transcripts and output capture until it falls (0 = off)")
+	policyCanary := flag.Int("policy-canary", 200, "Audited requests decided again under a reloaded policy before it takes effect (0 disables the canary)")
+	policyCanaryThreshold := flag.Float64("policy-canary-threshold", 0.1, "Fraction of replayed allowed (or denied) requests whose decision may flip before a reload is held for POST /api/policy/confirm-reload")
+	maxRuleMetrics := flag.Int("max-rule-metrics", 100, "Policy rules counted separately in /api/metrics; decisions of further rules are counted as \"(other)\"")
+	memoryLimit := flag.Int64("memory-limit-mb", 0, "Soft memory limit (MiB) for the Go runtime, which collects garbage harder near it (0 = the runtime default, GOMEMLIMIT)")
+	workspaceDir := flag.String("workspace-dir", "", "Where the warden mounts the workspace ghosts see as /app (default: snapshot it in a helper container for track_changes)")
+	spoolDir := flag.String("spool-dir", "/var/lib/clawrden/spool", "Directory for output of commands whose shim stopped reading, with on_shim_stall: spool in the policy")
+	stallTimeout := flag.Duration("stall-timeout", 2*time.Minute, "How long a write of command output to a shim may block before the shim counts as stalled (0 waits forever)")
+	transcriptDir := flag.String("transcript-dir", "/var/lib/clawrden/transcripts", "Directory for request transcripts (see transcript rules in the policy)")
 
 	flag.Parse()
 
+	if *check {
+		os.Exit(checkPolicy(*policyPath))
+	}
+
 	logger := log.New(os.Stdout, "[warden] ", log.LstdFlags|log.Lmsgprefix)
 
+	embeddedShim := shimbin.Binary()
+	switch {
+	case *noEmbeddedShim:
+		embeddedShim = nil
+	case embeddedShim == nil:
+		logger.Printf("warden built without an embedded shim; the armory must provide one")
+	}
+
+	var approvalKey []byte
+	if *approvalKeyFile != "" {
+		data, err := os.ReadFile(*approvalKeyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warden: read approval link key: %v\n", err)
+			os.Exit(1)
+		}
+		approvalKey = bytes.TrimSpace(data)
+	}
+
+	var adminToken string
+	if *adminTokenFile != "" {
+		data, err := os.ReadFile(*adminTokenFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warden: read admin token: %v\n", err)
+			os.Exit(1)
+		}
+		adminToken = string(bytes.TrimSpace(data))
+	}
+
+	var reviewerTokens []warden.ReviewerToken
+	if *reviewerTokensFile != "" {
+		data, err := os.ReadFile(*reviewerTokensFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warden: read reviewer tokens: %v\n", err)
+			os.Exit(1)
+		}
+		if reviewerTokens, err = warden.ParseReviewerTokens(data); err != nil {
+			fmt.Fprintf(os.Stderr, "warden: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var grpcToken string
+	if *grpcTokenFile != "" {
+		data, err := os.ReadFile(*grpcTokenFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warden: read gRPC token: %v\n", err)
+			os.Exit(1)
+		}
+		grpcToken = string(bytes.TrimSpace(data))
+	}
+
+	var fileExpectations securefile.Expectations
+	if *fileOwner != "" {
+		var err error
+		if fileExpectations, err = securefile.ParseOwner(*fileOwner); err != nil {
+			fmt.Fprintf(os.Stderr, "warden: -file-owner: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	origins, err := warden.ParseAllowedOrigins(*allowedOrigins)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warden: %v\n", err)
+		os.Exit(1)
+	}
+
+	flagsSet := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { flagsSet[f.Name] = true })
+
+	if *stallTimeout == 0 {
+		*stallTimeout = -1 // The config's "never stalled"
+	}
+	if *policyCanary == 0 {
+		*policyCanary = -1 // The config's "disabled"
+	}
+
 	srv, err := warden.NewServer(warden.Config{
-		SocketPath:      *socketPath,
-		PolicyPath:      *policyPath,
-		AuditPath:       *auditPath,
-		APIAddr:         *apiAddr,
-		JailhouseArmory: *armoryPath,
-		JailhouseRoot:   *jailhousePath,
-		JailhouseState:  *statePath,
-		Logger:          logger,
+		SocketPath:            *socketPath,
+		PolicyPath:            *policyPath,
+		AuditPath:             *auditPath,
+		AuditFailureMode:      warden.AuditFailureMode(*auditFailureMode),
+		AuditBufferSize:       *auditBufferSize,
+		AuditSync:             warden.AuditSyncPolicy(*auditSync),
+		FileCheckMode:         warden.FileCheckMode(*fileCheck),
+		FileExpectations:      fileExpectations,
+		APIAddr:               *apiAddr,
+		GRPCAddr:              *grpcAddr,
+		GRPCToken:             grpcToken,
+		APITLSCert:            *apiTLSCert,
+		APITLSKey:             *apiTLSKey,
+		AdminToken:            adminToken,
+		ReviewerTokens:        reviewerTokens,
+		APIDebug:              *apiDebug,
+		SlowRequestThreshold:  *slowRequest,
+		DisableDashboard:      *disableDashboard,
+		AllowedOrigins:        origins,
+		BridgeStaleAfter:      *bridgeStaleAfter,
+		BridgeAlertWebhook:    *bridgeAlertWebhook,
+		ApprovalLinkKey:       approvalKey,
+		ApprovalLinkTTL:       *approvalLinkTTL,
+		PublicURL:             *publicURL,
+		IncidentWebhook:       *incidentWebhook,
+		DockerPingInterval:    *dockerPingInterval,
+		JailhouseArmory:       *armoryPath,
+		JailhouseRoot:         *jailhousePath,
+		JailhouseState:        *statePath,
+		EmbeddedShim:          embeddedShim,
+		AutoJailFromLabels:    *autoJail,
+		AutoJailGrace:         *autoJailGrace,
+		SandboxRoot:           *sandboxRoot,
+		TranscriptDir:         *transcriptDir,
+		SpoolDir:              *spoolDir,
+		StallTimeout:          *stallTimeout,
+		RequireShimProvenance: *requireShim,
+		AllowHostFallback:     *allowHostFallback,
+		Console:               *console,
+		WorkspaceDir:          *workspaceDir,
+		ShadowPolicyPath:      *shadowPolicy,
+		InstanceID:            *instanceID,
+		MaxGhosts:             *maxGhosts,
+		MaxConnections:        *maxConnections,
+		MemoryWatermark:       *memoryWatermark << 20,
+		MemoryLimit:           *memoryLimit << 20,
+		MaxRuleMetrics:        *maxRuleMetrics,
+		PolicyCanary:          *policyCanary,
+		PolicyCanaryThreshold: *policyCanaryThreshold,
+		FlagsSet:              flagsSet,
+		Logger:                logger,
 	})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "warden: failed to initialize: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Handle shutdown signals
+	// Handle shutdown signals; SIGUSR1 restarts only the HTTP API, e.g. after
+	// its TLS certificate was rotated
 	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1)
 
 	go func() {
-		sig := <-sigCh
-		logger.Printf("received signal %v, shutting down...", sig)
-		srv.Shutdown()
+		for sig := range sigCh {
+			if sig == syscall.SIGUSR1 {
+				logger.Printf("received signal %v, restarting HTTP API...", sig)
+				if err := srv.RestartAPI(); err != nil {
+					logger.Printf("HTTP API restart failed: %v", err)
+				}
+				continue
+			}
+			logger.Printf("received signal %v, shutting down...", sig)
+			srv.Shutdown()
+			return
+		}
 	}()
 
 	logger.Printf("starting warden on %s", *socketPath)
@@ -59,3 +243,18 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// checkPolicy loads the policy at path the way the warden would and prints
+// its lint findings and test results. It returns the exit status.
+func checkPolicy(path string) int {
+	policy, err := warden.LoadPolicy(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return 1
+	}
+	for _, f := range policy.LintFindings() {
+		fmt.Printf("%s: lint: %s\n", path, f)
+	}
+	fmt.Printf("%s: ok, %d policy test(s) passed\n", path, policy.TestCount())
+	return 0
+}
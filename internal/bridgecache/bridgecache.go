@@ -0,0 +1,161 @@
+// Package bridgecache bounds what the chat bridges remember about the
+// requests they notified: an LRU cache of request IDs whose entries also
+// expire, and a diff of sorted ID sets so that each poll only touches the
+// requests that entered or left the queue.
+package bridgecache
+
+import (
+	"container/list"
+	"slices"
+	"time"
+)
+
+const (
+	// DefaultMaxTracked is how many requests a bridge remembers by default.
+	DefaultMaxTracked = 10000
+
+	// DefaultTTL is how long a bridge remembers a request by default. A
+	// request still queued after that is notified again.
+	DefaultTTL = 24 * time.Hour
+)
+
+// Cache maps request IDs to values, holding at most max entries, each for at
+// most ttl after it was last stored. Adding to a full cache evicts the least
+// recently used entry. It is not safe for concurrent use.
+type Cache[V any] struct {
+	max   int
+	ttl   time.Duration
+	now   func() time.Time
+	order *list.List // Most recently used at the front
+	items map[string]*list.Element
+}
+
+type entry[V any] struct {
+	id     string
+	value  V
+	stored time.Time
+}
+
+// New returns an empty cache. A max or ttl of 0 means no bound.
+func New[V any](max int, ttl time.Duration) *Cache[V] {
+	return &Cache[V]{
+		max:   max,
+		ttl:   ttl,
+		now:   time.Now,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// Get returns the value stored for id and marks it used. Expired entries
+// are dropped and not found.
+func (c *Cache[V]) Get(id string) (V, bool) {
+	el, ok := c.items[id]
+	if !ok || c.expired(el) {
+		if ok {
+			c.remove(el)
+		}
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*entry[V]).value, true
+}
+
+// Has reports whether id is cached, marking it used like Get.
+func (c *Cache[V]) Has(id string) bool {
+	_, ok := c.Get(id)
+	return ok
+}
+
+// Put stores value for id and restarts its expiry. It returns the IDs
+// evicted to make room, least recently used first.
+func (c *Cache[V]) Put(id string, value V) (evicted []string) {
+	now := c.now()
+	if el, ok := c.items[id]; ok {
+		e := el.Value.(*entry[V])
+		e.value, e.stored = value, now
+		c.order.MoveToFront(el)
+		return nil
+	}
+	c.items[id] = c.order.PushFront(&entry[V]{id: id, value: value, stored: now})
+	for c.max > 0 && c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.remove(oldest)
+		if !c.expired(oldest) {
+			evicted = append(evicted, oldest.Value.(*entry[V]).id)
+		}
+	}
+	return evicted
+}
+
+// Delete forgets id.
+func (c *Cache[V]) Delete(id string) {
+	if el, ok := c.items[id]; ok {
+		c.remove(el)
+	}
+}
+
+// Max returns the most entries the cache holds; 0 means no bound.
+func (c *Cache[V]) Max() int {
+	return c.max
+}
+
+// Len returns the number of entries, including expired ones not yet dropped.
+func (c *Cache[V]) Len() int {
+	return c.order.Len()
+}
+
+// Snapshot returns the unexpired entries.
+func (c *Cache[V]) Snapshot() map[string]V {
+	out := make(map[string]V, c.order.Len())
+	for el := c.order.Front(); el != nil; el = el.Next() {
+		if e := el.Value.(*entry[V]); !c.expired(el) {
+			out[e.id] = e.value
+		}
+	}
+	return out
+}
+
+// IDs returns the unexpired IDs in ascending order, ready for Diff.
+func (c *Cache[V]) IDs() []string {
+	ids := make([]string, 0, c.order.Len())
+	for el := c.order.Front(); el != nil; el = el.Next() {
+		if !c.expired(el) {
+			ids = append(ids, el.Value.(*entry[V]).id)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func (c *Cache[V]) expired(el *list.Element) bool {
+	return c.ttl > 0 && c.now().Sub(el.Value.(*entry[V]).stored) >= c.ttl
+}
+
+func (c *Cache[V]) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.items, el.Value.(*entry[V]).id)
+}
+
+// Diff compares two ascending ID lists in one pass and returns the IDs only
+// in next (added) and only in prev (removed).
+func Diff(prev, next []string) (added, removed []string) {
+	i, j := 0, 0
+	for i < len(prev) && j < len(next) {
+		switch {
+		case prev[i] == next[j]:
+			i++
+			j++
+		case prev[i] < next[j]:
+			removed = append(removed, prev[i])
+			i++
+		default:
+			added = append(added, next[j])
+			j++
+		}
+	}
+	removed = append(removed, prev[i:]...)
+	added = append(added, next[j:]...)
+	return added, removed
+}
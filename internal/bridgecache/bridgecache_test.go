@@ -0,0 +1,94 @@
+package bridgecache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestCache returns a cache whose clock the test advances.
+func newTestCache(max int, ttl time.Duration) (*Cache[int], *time.Time) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := New[int](max, ttl)
+	c.now = func() time.Time { return now }
+	return c, &now
+}
+
+func TestCacheExpiry(t *testing.T) {
+	c, now := newTestCache(0, time.Hour)
+	c.Put("req-1", 1)
+	*now = now.Add(30 * time.Minute)
+	c.Put("req-2", 2)
+
+	*now = now.Add(30 * time.Minute) // req-1 is an hour old
+	if c.Has("req-1") {
+		t.Error("req-1 still cached after its TTL")
+	}
+	if v, ok := c.Get("req-2"); !ok || v != 2 {
+		t.Errorf("req-2 = %d, %v; want 2, true", v, ok)
+	}
+	if c.Len() != 1 {
+		t.Errorf("Len = %d, want the expired entry dropped", c.Len())
+	}
+
+	// Storing again restarts the expiry
+	*now = now.Add(20 * time.Minute)
+	c.Put("req-2", 3)
+	*now = now.Add(50 * time.Minute)
+	if v, ok := c.Get("req-2"); !ok || v != 3 {
+		t.Errorf("req-2 after update = %d, %v; want 3, true", v, ok)
+	}
+	*now = now.Add(10 * time.Minute)
+	if got := c.IDs(); len(got) != 0 {
+		t.Errorf("IDs = %q, want none", got)
+	}
+	if got := c.Snapshot(); len(got) != 0 {
+		t.Errorf("Snapshot = %v, want empty", got)
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c, now := newTestCache(2, time.Hour)
+	c.Put("req-1", 1)
+	c.Put("req-2", 2)
+	c.Get("req-1") // req-2 is now the least recently used
+	if evicted := c.Put("req-3", 3); !reflect.DeepEqual(evicted, []string{"req-2"}) {
+		t.Errorf("evicted = %q, want [req-2]", evicted)
+	}
+	if got := c.IDs(); !reflect.DeepEqual(got, []string{"req-1", "req-3"}) {
+		t.Errorf("IDs = %q", got)
+	}
+
+	// Expired entries make room without being reported
+	*now = now.Add(time.Hour)
+	c.Put("req-4", 4)
+	if evicted := c.Put("req-5", 5); len(evicted) != 0 {
+		t.Errorf("evicted = %q, want only expired entries dropped", evicted)
+	}
+	c.Delete("req-4")
+	if got := c.IDs(); !reflect.DeepEqual(got, []string{"req-5"}) {
+		t.Errorf("IDs after delete = %q", got)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name           string
+		prev, next     []string
+		added, removed []string
+	}{
+		{"empty", nil, nil, nil, nil},
+		{"first poll", nil, []string{"a", "b"}, []string{"a", "b"}, nil},
+		{"queue drained", []string{"a", "b"}, nil, nil, []string{"a", "b"}},
+		{"unchanged", []string{"a", "b"}, []string{"a", "b"}, nil, nil},
+		{"interleaved", []string{"a", "c", "e"}, []string{"b", "c", "d", "f"}, []string{"b", "d", "f"}, []string{"a", "e"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, removed := Diff(tt.prev, tt.next)
+			if !reflect.DeepEqual(added, tt.added) || !reflect.DeepEqual(removed, tt.removed) {
+				t.Errorf("Diff = %q, %q; want %q, %q", added, removed, tt.added, tt.removed)
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+// Package bridgemsg renders the messages the chat bridges post, from Go
+// text/template templates: embedded defaults per chat, which a template file
+// may redefine one by one, and a plain-text mode without any formatting.
+package bridgemsg
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// Messages a template set defines. A template file redefines any of them
+// with {{define "pending"}}...{{end}}; the rest keep their defaults.
+const (
+	Pending     = "pending"     // A request waits for approval
+	Reminder    = "reminder"    // A request is still waiting after hitl.renotify_after
+	Resolved    = "resolved"    // Replaces a pending message once the request is resolved (Slack only)
+	Maintenance = "maintenance" // The warden announced a maintenance window
+	Started     = "started"     // The bridge started (Telegram only)
+)
+
+// DefaultCLI is how the default messages tell reviewers to run the CLI.
+const DefaultCLI = "./bin/clawrden-cli"
+
+// Flavor is the chat a template set formats for.
+type Flavor string
+
+const (
+	Slack    Flavor = "slack"
+	Telegram Flavor = "telegram"
+)
+
+//go:embed templates/*.tmpl
+var defaults embed.FS
+
+// Data is what every template receives. Fields that don't apply to a
+// message are zero: Request is empty in a maintenance message, for example.
+type Data struct {
+	Request     Request
+	Outcome     string // Resolved messages: approved, denied, expired, or resolved when unknown
+	Reminder    int    // Reminder messages: which reminder this is, from 1
+	Maintenance MaintenanceWindow
+	Links       Links
+	Plain       bool // Set in PLAIN_TEXT mode
+}
+
+// Request is a request waiting for approval. Resolved messages only know
+// its ID and Command.
+type Request struct {
+	ID      string
+	Command string   // Program and arguments, space-separated
+	Program string   // The program alone
+	Args    []string // Its arguments
+	Cwd     string
+	UID     int
+	GID     int
+	TaskID  string // Caller's correlation IDs (CLAWRDEN_TASK_ID, CLAWRDEN_RUN_ID)
+	RunID   string
+	Risk    string // Risk tier, if the policy assigned one
+
+	QueuedAt      time.Time  // When the request entered the queue
+	AutoApproveAt *time.Time // Deadline after which a low-risk ask is approved unless denied first
+
+	Annotations []Annotation // What the warden worked out the command would touch
+}
+
+// Annotation is impact context for one command of a request.
+type Annotation struct {
+	Command string
+	Summary string
+}
+
+// MaintenanceWindow is an announced warden maintenance window.
+type MaintenanceWindow struct {
+	ID       string
+	Until    time.Time
+	QueueAsk bool   // Requests needing approval are queued rather than denied
+	Message  string // The operator's note, if any
+}
+
+// Links point reviewers to where they can act on a request.
+type Links struct {
+	Dashboard string // The warden's web UI
+	CLI       string // How to run the CLI, like ./bin/clawrden-cli
+	Approve   string // CLI command approving Request (with "<id>" when there is none)
+	Deny      string // CLI command denying it
+}
+
+// Templates renders one bridge's messages.
+type Templates struct {
+	tmpl   *template.Template
+	flavor Flavor
+	plain  bool
+}
+
+// LoadFromEnv loads the templates of flavor, redefined by the file named in
+// <FLAVOR>_TEMPLATE (SLACK_TEMPLATE, TELEGRAM_TEMPLATE) if set, and in
+// plain-text mode if PLAIN_TEXT is true.
+func LoadFromEnv(flavor Flavor, getenv func(string) string) (*Templates, error) {
+	plain := false
+	if v := getenv("PLAIN_TEXT"); v != "" {
+		var err error
+		if plain, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("invalid PLAIN_TEXT %q: %w", v, err)
+		}
+	}
+	name := strings.ToUpper(string(flavor)) + "_TEMPLATE"
+	t, err := Load(flavor, getenv(name), plain)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return t, nil
+}
+
+// Load parses the default templates of flavor, then the template file at
+// path, if set. The file is checked by rendering every message with sample
+// data, so that a misspelled field fails at startup rather than on the
+// first request. In plain mode, the markup functions return their text
+// unchanged and icons are left out.
+func Load(flavor Flavor, path string, plain bool) (*Templates, error) {
+	t := &Templates{flavor: flavor, plain: plain}
+	t.tmpl = template.New(string(flavor)).Funcs(t.funcs())
+	if _, err := t.tmpl.ParseFS(defaults, "templates/"+string(flavor)+".tmpl"); err != nil {
+		return nil, fmt.Errorf("parse default %s templates: %w", flavor, err)
+	}
+	names := t.names()
+	if path == "" {
+		return t, nil
+	}
+
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	base := filepath.Base(path)
+	file, err := t.tmpl.New(base).Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("%w\n(a template file redefines any of %s with {{define \"name\"}}...{{end}})", err, quoteAll(names))
+	}
+	if hasText(file.Tree) {
+		return nil, fmt.Errorf("%s: text outside {{define}} is never rendered; wrap it in one of %s", base, quoteAll(names))
+	}
+	for _, name := range names {
+		if _, err := t.Render(name, sampleData()); err != nil {
+			return nil, fmt.Errorf("%s: %w", base, err)
+		}
+	}
+	return t, nil
+}
+
+// Render renders the message name with data. Links.Approve and Links.Deny
+// are filled in for data.Request, and Links.CLI defaults to DefaultCLI.
+func (t *Templates) Render(name string, data Data) (string, error) {
+	if data.Links.CLI == "" {
+		data.Links.CLI = DefaultCLI
+	}
+	id := data.Request.ID
+	if id == "" {
+		id = "<id>"
+	}
+	if data.Links.Approve == "" {
+		data.Links.Approve = data.Links.CLI + " approve " + id
+	}
+	if data.Links.Deny == "" {
+		data.Links.Deny = data.Links.CLI + " deny " + id
+	}
+	data.Plain = t.plain
+
+	var b strings.Builder
+	if err := t.tmpl.ExecuteTemplate(&b, name, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Plain reports whether messages are rendered without formatting, so the
+// chat must not parse them as markup either.
+func (t *Templates) Plain() bool {
+	return t.plain
+}
+
+// names returns the messages the default templates define.
+func (t *Templates) names() []string {
+	var names []string
+	for _, name := range []string{Pending, Reminder, Resolved, Maintenance, Started} {
+		if t.tmpl.Lookup(name) != nil {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// funcs returns the functions templates format with: bold, code, codeblock
+// and esc (escape text for the chat's markup), icon and outcomeIcon (an
+// emoji and a space), local (a time in the bridge's zone) and title.
+func (t *Templates) funcs() template.FuncMap {
+	funcs := template.FuncMap{
+		"bold":      func(s string) string { return "*" + s + "*" },
+		"code":      func(s string) string { return "`" + s + "`" },
+		"codeblock": func(s string) string { return "```" + s + "```" },
+		"esc":       func(s string) string { return s },
+		"icon":      func(emoji string) string { return emoji + " " },
+		"outcomeIcon": func(outcome string) string {
+			icon := map[string]string{
+				"approved": "✅",
+				"denied":   "❌",
+				"expired":  "⌛",
+			}[outcome]
+			if icon == "" {
+				icon = "☑️"
+			}
+			return icon + " "
+		},
+		"local": func(t time.Time) time.Time { return t.Local() },
+		"title": func(s string) string {
+			if s == "" {
+				return s
+			}
+			return strings.ToUpper(s[:1]) + s[1:]
+		},
+	}
+	if t.flavor == Telegram {
+		funcs["codeblock"] = func(s string) string { return "```\n" + s + "\n```" }
+		funcs["esc"] = strings.NewReplacer("_", "\\_", "*", "\\*", "[", "\\[", "`", "\\`").Replace
+	}
+	if t.plain {
+		same := func(s string) string { return s }
+		none := func(string) string { return "" }
+		for _, name := range []string{"bold", "code", "codeblock", "esc"} {
+			funcs[name] = same
+		}
+		funcs["icon"], funcs["outcomeIcon"] = none, none
+	}
+	return funcs
+}
+
+// hasText reports whether tree has anything but whitespace and comments
+// outside its {{define}} blocks.
+func hasText(tree *parse.Tree) bool {
+	if tree == nil || tree.Root == nil {
+		return false
+	}
+	for _, node := range tree.Root.Nodes {
+		switch n := node.(type) {
+		case *parse.TextNode:
+			if strings.TrimSpace(string(n.Text)) != "" {
+				return true
+			}
+		case *parse.CommentNode:
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// sampleData fills every field, so that rendering it takes each branch of
+// the default templates.
+func sampleData() Data {
+	at := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+	return Data{
+		Request: Request{
+			ID:            "req-1",
+			Command:       "npm install express",
+			Program:       "npm",
+			Args:          []string{"install", "express"},
+			Cwd:           "/app",
+			UID:           1000,
+			GID:           1000,
+			TaskID:        "task-1",
+			RunID:         "run-1",
+			Risk:          "low",
+			QueuedAt:      at,
+			AutoApproveAt: &at,
+			Annotations:   []Annotation{{Command: "npm", Summary: "writes node_modules"}},
+		},
+		Outcome:     "approved",
+		Reminder:    2,
+		Maintenance: MaintenanceWindow{ID: "m-1", Until: at, Message: "Upgrading"},
+		Links:       Links{Dashboard: "http://localhost:8080"},
+	}
+}
+
+func quoteAll(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = strconv.Quote(name)
+	}
+	return strings.Join(quoted, ", ")
+}
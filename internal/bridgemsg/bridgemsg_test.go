@@ -0,0 +1,141 @@
+package bridgemsg
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// checkGolden compares got against testdata/<name>.golden.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("update golden: %v", err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output mismatch for %s\n--- got ---\n%s\n--- want ---\n%s", name, got, want)
+	}
+}
+
+func testData() Data {
+	time.Local = time.UTC
+	data := sampleData()
+	data.Request.Command = "rm -rf build_*"
+	data.Maintenance.Message = "Upgrading *everything*"
+	return data
+}
+
+func TestDefaultTemplates(t *testing.T) {
+	noRisk := testData()
+	noRisk.Request.TaskID, noRisk.Request.Risk, noRisk.Request.AutoApproveAt, noRisk.Request.Annotations = "", "", nil, nil
+
+	for _, flavor := range []Flavor{Slack, Telegram} {
+		for _, plain := range []bool{false, true} {
+			tmpl, err := Load(flavor, "", plain)
+			if err != nil {
+				t.Fatalf("Load(%s): %v", flavor, err)
+			}
+			suffix := ""
+			if plain {
+				suffix = "_plain"
+			}
+			var out bytes.Buffer
+			for _, name := range tmpl.names() {
+				got, err := tmpl.Render(name, testData())
+				if err != nil {
+					t.Fatalf("%s %s: %v", flavor, name, err)
+				}
+				out.WriteString("== " + name + "\n" + got + "\n")
+			}
+			got, err := tmpl.Render(Pending, noRisk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out.WriteString("== pending, run ID only\n" + got + "\n")
+			checkGolden(t, string(flavor)+suffix, out.Bytes())
+		}
+	}
+}
+
+func TestCustomTemplate(t *testing.T) {
+	tmpl, err := Load(Slack, filepath.Join("testdata", "custom.tmpl"), false)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	var out bytes.Buffer
+	for _, name := range []string{Pending, Resolved} {
+		got, err := tmpl.Render(name, testData())
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		out.WriteString("== " + name + "\n" + got + "\n")
+	}
+	checkGolden(t, "custom", out.Bytes())
+}
+
+func TestLoadFromEnv(t *testing.T) {
+	env := map[string]string{
+		"TELEGRAM_TEMPLATE": filepath.Join("testdata", "custom.tmpl"),
+		"PLAIN_TEXT":        "1",
+	}
+	tmpl, err := LoadFromEnv(Telegram, func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatalf("LoadFromEnv: %v", err)
+	}
+	if !tmpl.Plain() {
+		t.Error("PLAIN_TEXT=1 did not select plain mode")
+	}
+	got, _ := tmpl.Render(Pending, testData())
+	if want := "Approval needed for npm in /app (auto-approves 15:04)\nhttp://localhost:8080/#/queue/req-1"; got != want {
+		t.Errorf("pending = %q, want %q", got, want)
+	}
+
+	env["PLAIN_TEXT"] = "sometimes"
+	if _, err := LoadFromEnv(Telegram, func(k string) string { return env[k] }); err == nil || !strings.Contains(err.Error(), "PLAIN_TEXT") {
+		t.Errorf("invalid PLAIN_TEXT: err = %v", err)
+	}
+}
+
+func TestLoadRejectsBrokenTemplates(t *testing.T) {
+	tests := []struct {
+		name, text, want string
+	}{
+		{"syntax", "{{define \"pending\"}}{{.Request.ID}\n{{end}}", "template: broken.tmpl:1: "},
+		{"unknown function", "{{define \"pending\"}}{{italic .Request.ID}}{{end}}", `function "italic" not defined`},
+		{"unknown field", "{{define \"resolved\"}}{{.Request.Name}}{{end}}", `can't evaluate field Name`},
+		{"outside define", "New request {{.Request.ID}}", "text outside {{define}}"},
+		{"unclosed define", "{{define \"pending\"}}hi", `"pending", "reminder", "resolved", "maintenance"`},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "broken.tmpl")
+		if err := os.WriteFile(path, []byte(tt.text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := LoadFromEnv(Slack, func(k string) string {
+			if k == "SLACK_TEMPLATE" {
+				return path
+			}
+			return ""
+		})
+		if err == nil || !strings.Contains(err.Error(), tt.want) || !strings.HasPrefix(err.Error(), "SLACK_TEMPLATE: ") {
+			t.Errorf("%s: err = %v, want one mentioning %q", tt.name, err, tt.want)
+		}
+	}
+
+	if _, err := Load(Slack, filepath.Join(t.TempDir(), "missing.tmpl"), false); err == nil {
+		t.Error("missing template file loaded")
+	}
+}
@@ -0,0 +1,267 @@
+// Package bridgenet builds the HTTP transport the chat bridges use to reach
+// the warden and the chat APIs: proxies from the environment, extra trusted
+// CAs, dial and TLS timeouts, and retries of transient chat API errors.
+package bridgenet
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultDialTimeout = 10 * time.Second
+	defaultTLSTimeout  = 10 * time.Second
+)
+
+// Options configures a bridge transport. The zero value uses the system
+// roots and default timeouts.
+type Options struct {
+	CAFile             string        // PEM bundle trusted in addition to the system roots
+	InsecureSkipVerify bool          // Accept any server certificate (never in production)
+	DialTimeout        time.Duration // TCP connect timeout (default: 10s)
+	TLSTimeout         time.Duration // TLS handshake timeout (default: 10s)
+}
+
+// OptionsFromEnv reads options from BRIDGE_CA_FILE,
+// BRIDGE_INSECURE_SKIP_VERIFY, BRIDGE_DIAL_TIMEOUT and BRIDGE_TLS_TIMEOUT.
+func OptionsFromEnv(getenv func(string) string) (Options, error) {
+	opts := Options{CAFile: getenv("BRIDGE_CA_FILE")}
+	if v := getenv("BRIDGE_INSECURE_SKIP_VERIFY"); v != "" {
+		skip, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid BRIDGE_INSECURE_SKIP_VERIFY %q: %w", v, err)
+		}
+		opts.InsecureSkipVerify = skip
+	}
+	for name, dst := range map[string]*time.Duration{
+		"BRIDGE_DIAL_TIMEOUT": &opts.DialTimeout,
+		"BRIDGE_TLS_TIMEOUT":  &opts.TLSTimeout,
+	} {
+		if v := getenv(name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return opts, fmt.Errorf("invalid %s %q: want a positive duration like 10s", name, v)
+			}
+			*dst = d
+		}
+	}
+	return opts, nil
+}
+
+// NewTransport builds a transport for opts. Proxies come from HTTPS_PROXY,
+// HTTP_PROXY and NO_PROXY (or their lowercase forms); a custom transport
+// would otherwise silently bypass them.
+func NewTransport(opts Options, logger *log.Logger) (*http.Transport, error) {
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = defaultDialTimeout
+	}
+	if opts.TLSTimeout <= 0 {
+		opts.TLSTimeout = defaultTLSTimeout
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opts.CAFile != "" {
+		pool, err := loadCAFile(opts.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if opts.InsecureSkipVerify {
+		logger.Printf("WARNING: TLS certificate verification is DISABLED (BRIDGE_INSECURE_SKIP_VERIFY); " +
+			"anyone on the network path can read and forge warden and chat traffic. Use BRIDGE_CA_FILE instead.")
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: opts.DialTimeout, KeepAlive: 30 * time.Second}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   opts.TLSTimeout,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}, nil
+}
+
+// loadCAFile returns the system roots plus the certificates in path.
+func loadCAFile(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read CA bundle: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("CA bundle %s contains no PEM certificates", path)
+	}
+	return pool, nil
+}
+
+// DescribeProxy reports which proxy requests to rawURL go through, for the
+// bridge's startup log.
+func DescribeProxy(t *http.Transport, rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || t.Proxy == nil {
+		return "direct"
+	}
+	proxy, err := t.Proxy(&http.Request{URL: u})
+	switch {
+	case err != nil:
+		return fmt.Sprintf("invalid proxy setting: %v", err)
+	case proxy == nil:
+		return "direct"
+	}
+	return "via proxy " + proxy.Redacted()
+}
+
+// Retry defaults for chat API calls. Longer Retry-After waits are left to the
+// caller's own backoff, so one poll never blocks for minutes.
+const (
+	retryAttempts = 3
+	retryBase     = time.Second
+	retryMaxWait  = 10 * time.Second
+)
+
+// retryTransport retries rate-limited (429) and server error (5xx) responses.
+type retryTransport struct {
+	next     http.RoundTripper
+	attempts int
+	base     time.Duration
+	maxWait  time.Duration
+	logger   *log.Logger
+}
+
+// WithRetry wraps next so transient chat API errors are retried, honoring
+// Retry-After. Requests whose body cannot be replayed are not retried.
+func WithRetry(next http.RoundTripper, logger *log.Logger) http.RoundTripper {
+	return &retryTransport{next: next, attempts: retryAttempts, base: retryBase, maxWait: retryMaxWait, logger: logger}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+		if err != nil || !retryable(resp.StatusCode) || attempt >= t.attempts {
+			return resp, err
+		}
+		if req.Body != nil && req.GetBody == nil {
+			return resp, nil
+		}
+
+		wait := t.base << (attempt - 1)
+		if d, ok := RetryAfter(resp, time.Now()); ok {
+			wait = d
+		}
+		if wait > t.maxWait {
+			return resp, nil // The caller's backoff deals with long waits
+		}
+		resp.Body.Close()
+		t.logger.Printf("%s %s returned %d, retrying in %v (attempt %d of %d)",
+			req.Method, req.URL.Host, resp.StatusCode, wait, attempt+1, t.attempts)
+
+		if err := sleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// retryable reports whether a status is worth retrying.
+func retryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// RetryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func RetryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// OutageLog logs a dependency that keeps failing once when it starts, as a
+// summary every interval while it lasts, and once when it recovers, rather
+// than on every poll. It is not safe for concurrent use.
+type OutageLog struct {
+	name     string
+	interval time.Duration
+	logger   *log.Logger
+	now      func() time.Time
+
+	failures int       // Consecutive failures
+	since    time.Time // First failure of the outage
+	logged   time.Time // Last time the outage was logged
+}
+
+// NewOutageLog returns an OutageLog for the dependency called name.
+func NewOutageLog(name string, interval time.Duration, logger *log.Logger) *OutageLog {
+	return &OutageLog{name: name, interval: interval, logger: logger, now: time.Now}
+}
+
+// Fail records a failed call.
+func (o *OutageLog) Fail(err error) {
+	now := o.now()
+	o.failures++
+	switch {
+	case o.failures == 1:
+		o.since, o.logged = now, now
+		o.logger.Printf("Error reaching %s: %v (repeats are summarized every %v)", o.name, err, o.interval)
+	case now.Sub(o.logged) >= o.interval:
+		o.logged = now
+		o.logger.Printf("%s still unreachable: %d failed attempts since %s, last error: %v",
+			o.name, o.failures, o.since.Format(time.TimeOnly), err)
+	}
+}
+
+// OK records a successful call, logging the recovery after an outage.
+func (o *OutageLog) OK() {
+	if o.failures == 0 {
+		return
+	}
+	o.logger.Printf("%s reachable again after %d failed attempts over %v",
+		o.name, o.failures, o.now().Sub(o.since).Round(time.Second))
+	o.failures = 0
+}
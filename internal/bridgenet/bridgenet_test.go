@@ -0,0 +1,220 @@
+package bridgenet
+
+import (
+	"bytes"
+	"encoding/pem"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeServerCA writes the test server's certificate as a CA bundle.
+func writeServerCA(t *testing.T, srv *httptest.Server) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestTransportTrustsCustomCA(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+	ca := writeServerCA(t, srv)
+	garbage := filepath.Join(t.TempDir(), "garbage.pem")
+	os.WriteFile(garbage, []byte("not a certificate"), 0644)
+
+	tests := []struct {
+		name      string
+		opts      Options
+		wantErr   bool // From NewTransport
+		wantOK    bool // Request succeeds
+		wantAlarm bool // Loud warning logged
+	}{
+		{name: "system roots only", opts: Options{}},
+		{name: "custom CA", opts: Options{CAFile: ca}, wantOK: true},
+		{name: "insecure skip verify", opts: Options{InsecureSkipVerify: true}, wantOK: true, wantAlarm: true},
+		{name: "missing CA file", opts: Options{CAFile: filepath.Join(t.TempDir(), "none.pem")}, wantErr: true},
+		{name: "CA file without certificates", opts: Options{CAFile: garbage}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			transport, err := NewTransport(tt.opts, log.New(&logs, "", 0))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewTransport error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := strings.Contains(logs.String(), "WARNING: TLS certificate verification is DISABLED"); got != tt.wantAlarm {
+				t.Errorf("warning logged = %v, want %v: %q", got, tt.wantAlarm, logs.String())
+			}
+
+			client := &http.Client{Transport: transport, Timeout: 5 * time.Second}
+			resp, err := client.Get(srv.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err == nil) != tt.wantOK {
+				t.Errorf("GET error = %v, want success %v", err, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestOptionsFromEnv(t *testing.T) {
+	env := map[string]string{
+		"BRIDGE_CA_FILE":              "/etc/ssl/corp.pem",
+		"BRIDGE_INSECURE_SKIP_VERIFY": "false",
+		"BRIDGE_DIAL_TIMEOUT":         "3s",
+		"BRIDGE_TLS_TIMEOUT":          "20s",
+	}
+	opts, err := OptionsFromEnv(func(k string) string { return env[k] })
+	want := Options{CAFile: "/etc/ssl/corp.pem", DialTimeout: 3 * time.Second, TLSTimeout: 20 * time.Second}
+	if err != nil || opts != want {
+		t.Errorf("OptionsFromEnv = %+v, %v; want %+v", opts, err, want)
+	}
+
+	for _, bad := range []map[string]string{
+		{"BRIDGE_INSECURE_SKIP_VERIFY": "maybe"},
+		{"BRIDGE_DIAL_TIMEOUT": "3"},
+		{"BRIDGE_TLS_TIMEOUT": "-1s"},
+	} {
+		if _, err := OptionsFromEnv(func(k string) string { return bad[k] }); err == nil {
+			t.Errorf("OptionsFromEnv(%v) accepted invalid input", bad)
+		}
+	}
+}
+
+// flakyAPI fails with the given statuses before answering 200, recording
+// the request bodies it saw.
+type flakyAPI struct {
+	mu         sync.Mutex
+	failures   []int
+	retryAfter string
+	bodies     []string
+}
+
+func (f *flakyAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	f.bodies = append(f.bodies, string(body))
+	if len(f.failures) > 0 {
+		status := f.failures[0]
+		f.failures = f.failures[1:]
+		if f.retryAfter != "" {
+			w.Header().Set("Retry-After", f.retryAfter)
+		}
+		w.WriteHeader(status)
+		return
+	}
+	io.WriteString(w, "ok")
+}
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name       string
+		failures   []int
+		retryAfter string
+		wantStatus int
+		wantCalls  int
+	}{
+		{"success", nil, "", http.StatusOK, 1},
+		{"rate limited then ok", []int{429}, "0", http.StatusOK, 2},
+		{"server errors then ok", []int{502, 503}, "", http.StatusOK, 3},
+		{"gives up after attempts", []int{500, 500, 500, 500}, "", http.StatusInternalServerError, 3},
+		{"long retry-after left to the caller", []int{429}, "3600", http.StatusTooManyRequests, 1},
+		{"client errors are not retried", []int{400}, "", http.StatusBadRequest, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &flakyAPI{failures: tt.failures, retryAfter: tt.retryAfter}
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			rt := WithRetry(http.DefaultTransport, log.New(io.Discard, "", 0)).(*retryTransport)
+			rt.base = time.Millisecond
+			client := &http.Client{Transport: rt}
+			resp, err := client.Post(srv.URL, "application/json", strings.NewReader(`{"text":"hi"}`))
+			if err != nil {
+				t.Fatalf("POST: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus || len(api.bodies) != tt.wantCalls {
+				t.Errorf("status %d after %d calls, want %d after %d", resp.StatusCode, len(api.bodies), tt.wantStatus, tt.wantCalls)
+			}
+			for i, body := range api.bodies {
+				if body != `{"text":"hi"}` {
+					t.Errorf("call %d body = %q, want the original body replayed", i+1, body)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"30", 30 * time.Second, true},
+		{now.Add(time.Minute).Format(http.TimeFormat), time.Minute, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{Header: http.Header{}}
+		if tt.header != "" {
+			resp.Header.Set("Retry-After", tt.header)
+		}
+		got, ok := RetryAfter(resp, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("RetryAfter(%q) = %v, %v; want %v, %v", tt.header, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestOutageLogSummarizes(t *testing.T) {
+	var buf bytes.Buffer
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	o := NewOutageLog("warden", time.Minute, log.New(&buf, "", 0))
+	o.now = func() time.Time { return now }
+
+	o.OK()                    // Nothing to recover from
+	for i := 0; i < 24; i++ { // Two minutes of failed polls every 5 seconds
+		o.Fail(io.ErrUnexpectedEOF)
+		now = now.Add(5 * time.Second)
+	}
+	o.OK()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("logged %d lines, want the start, one summary and the recovery:\n%s", len(lines), buf.String())
+	}
+	for i, want := range []string{
+		"Error reaching warden: unexpected EOF",
+		"warden still unreachable: 13 failed attempts since 12:00:00",
+		"warden reachable again after 24 failed attempts over 2m0s",
+	} {
+		if !strings.Contains(lines[i], want) {
+			t.Errorf("line %d = %q, want %q", i, lines[i], want)
+		}
+	}
+}
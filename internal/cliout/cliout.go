@@ -0,0 +1,288 @@
+// Package cliout renders the CLI's tabular output: aligned columns,
+// middle-ellipsis truncation of long cells, optional ANSI colors,
+// and user-selectable column sets.
+package cliout
+
+import (
+	"clawrden/pkg/protocol"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Color is an ANSI SGR color code. The zero value means no color.
+type Color string
+
+const (
+	NoColor Color = ""
+	Red     Color = "31"
+	Green   Color = "32"
+	Yellow  Color = "33"
+	Dim     Color = "2"
+)
+
+// ellipsis marks the elided middle of a truncated cell.
+const ellipsis = "…"
+
+// Options control how a table is rendered.
+type Options struct {
+	Wide    bool     // Disable truncation
+	Color   bool     // Emit ANSI colors
+	Columns []string // Column names to show, in order (empty = all)
+}
+
+// Column describes a table column.
+type Column struct {
+	Name     string // Header text; also the name used by Options.Columns (case-insensitive)
+	MaxWidth int    // Truncate cells wider than this unless Options.Wide (0 = never)
+}
+
+// Cell is a single table value with an optional color.
+type Cell struct {
+	Text  string
+	Color Color
+}
+
+// Plain returns an uncolored cell.
+func Plain(text string) Cell {
+	return Cell{Text: text}
+}
+
+// Colored returns a cell rendered in the given color.
+func Colored(text string, color Color) Cell {
+	return Cell{Text: text, Color: color}
+}
+
+// Table accumulates rows and renders them with aligned columns.
+type Table struct {
+	opts    Options
+	columns []Column
+	rows    [][]Cell
+}
+
+// NewTable creates a table with the given columns.
+func NewTable(opts Options, columns ...Column) *Table {
+	return &Table{opts: opts, columns: columns}
+}
+
+// AddRow appends a row. Cells correspond positionally to the table's columns.
+func (t *Table) AddRow(cells ...Cell) {
+	t.rows = append(t.rows, cells)
+}
+
+// Render writes the table to w. Unknown names in Options.Columns are an error
+// so that typos are reported instead of silently producing an empty table.
+func (t *Table) Render(w io.Writer) error {
+	indexes, err := t.selectColumns()
+	if err != nil {
+		return err
+	}
+
+	// Prepare cell text (truncated) and compute visible widths
+	header := make([]Cell, len(indexes))
+	widths := make([]int, len(indexes))
+	for i, idx := range indexes {
+		header[i] = Plain(t.columns[idx].Name)
+		widths[i] = visibleWidth(header[i].Text)
+	}
+
+	rows := make([][]Cell, len(t.rows))
+	for r, row := range t.rows {
+		rows[r] = make([]Cell, len(indexes))
+		for i, idx := range indexes {
+			var cell Cell
+			if idx < len(row) {
+				cell = row[idx]
+			}
+			cell.Text = sanitize(cell.Text)
+			if !t.opts.Wide {
+				cell.Text = Truncate(cell.Text, t.columns[idx].MaxWidth)
+			}
+			rows[r][i] = cell
+			if n := visibleWidth(cell.Text); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	if err := t.writeLine(w, header, widths); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := t.writeLine(w, row, widths); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selectColumns resolves Options.Columns to column indexes.
+func (t *Table) selectColumns() ([]int, error) {
+	if len(t.opts.Columns) == 0 {
+		indexes := make([]int, len(t.columns))
+		for i := range t.columns {
+			indexes[i] = i
+		}
+		return indexes, nil
+	}
+
+	indexes := make([]int, 0, len(t.opts.Columns))
+	for _, name := range t.opts.Columns {
+		found := false
+		for i, col := range t.columns {
+			if strings.EqualFold(col.Name, strings.TrimSpace(name)) {
+				indexes = append(indexes, i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown column %q (available: %s)", name, t.columnNames())
+		}
+	}
+	return indexes, nil
+}
+
+// columnNames lists the available column names for error messages.
+func (t *Table) columnNames() string {
+	names := make([]string, len(t.columns))
+	for i, col := range t.columns {
+		names[i] = strings.ToLower(col.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+// writeLine writes one padded, optionally colored line. The last column is not padded.
+func (t *Table) writeLine(w io.Writer, cells []Cell, widths []int) error {
+	var b strings.Builder
+	for i, cell := range cells {
+		text := cell.Text
+		if t.opts.Color && cell.Color != NoColor && text != "" {
+			text = "\x1b[" + string(cell.Color) + "m" + text + "\x1b[0m"
+		}
+		b.WriteString(text)
+		if i < len(cells)-1 {
+			b.WriteString(strings.Repeat(" ", widths[i]-visibleWidth(cell.Text)+2))
+		}
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Truncate shortens s to at most max runes by replacing its middle with an ellipsis,
+// keeping both the start (the verb) and the end (usually the target) visible.
+// A max of zero or less disables truncation.
+func Truncate(s string, max int) string {
+	n := utf8.RuneCountInString(s)
+	if max <= 0 || n <= max {
+		return s
+	}
+	if max == 1 {
+		return ellipsis
+	}
+	runes := []rune(s)
+	keep := max - 1
+	head := (keep + 1) / 2
+	tail := keep - head
+	return string(runes[:head]) + ellipsis + string(runes[n-tail:])
+}
+
+// DecisionColor maps an audit decision to a color: green for allow, red
+// for deny, yellow for ask.
+func DecisionColor(decision protocol.Decision) Color {
+	switch decision {
+	case protocol.DecisionAllow:
+		return Green
+	case protocol.DecisionDeny:
+		return Red
+	case protocol.DecisionAsk:
+		return Yellow
+	}
+	return NoColor
+}
+
+// AgeColor colors a pending request's age against SLA thresholds:
+// uncolored below warn, yellow from warn, red from crit.
+func AgeColor(age, warn, crit time.Duration) Color {
+	switch {
+	case age >= crit:
+		return Red
+	case age >= warn:
+		return Yellow
+	}
+	return NoColor
+}
+
+// FormatAge renders a duration compactly (e.g. "45s", "12m", "3h", "2d").
+func FormatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
+
+// FormatBytes renders a byte count compactly (e.g. "512B", "4.0K", "1.5M").
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 4; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(n)/float64(div), "KMGTP"[exp])
+}
+
+// ColorEnabled reports whether colors should be used for f:
+// only when f is a terminal and NO_COLOR is unset.
+func ColorEnabled(f *os.File) bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// ParseColumns splits a comma-separated --columns value.
+func ParseColumns(value string) []string {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	var cols []string
+	for _, c := range strings.Split(value, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			cols = append(cols, c)
+		}
+	}
+	return cols
+}
+
+// sanitize replaces control characters (newlines, tabs, escapes) that would
+// break alignment or inject terminal sequences.
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// visibleWidth returns the number of runes in s.
+func visibleWidth(s string) int {
+	return utf8.RuneCountInString(s)
+}
@@ -0,0 +1,168 @@
+package cliout
+
+import (
+	"bytes"
+	"clawrden/pkg/protocol"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// checkGolden compares got against testdata/<name>.golden.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("update golden: %v", err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output mismatch for %s\n--- got ---\n%s\n--- want ---\n%s", name, got, want)
+	}
+}
+
+func historyTable(opts Options) *Table {
+	table := NewTable(opts,
+		Column{Name: "TIME"},
+		Column{Name: "COMMAND", MaxWidth: 12},
+		Column{Name: "ARGS", MaxWidth: 24},
+		Column{Name: "DECISION"},
+		Column{Name: "EXIT"},
+	)
+	table.AddRow(Plain("10:00:01"), Plain("ls"), Plain("-la"), Colored("allow", DecisionColor(protocol.DecisionAllow)), Plain("0"))
+	table.AddRow(Plain("10:00:02"), Plain("npm"), Plain("install express lodash react react-dom typescript"), Colored("allow (after HITL)", DecisionColor(protocol.DecisionAllow)), Plain("0"))
+	table.AddRow(Plain("10:00:03"), Plain("rm"), Plain("-rf /"), Colored("deny", DecisionColor(protocol.DecisionDeny)), Plain(""))
+	table.AddRow(Plain("10:00:04"), Plain("echo"), Plain("multi\nline\targ"), Colored("ask", DecisionColor(protocol.DecisionAsk)), Plain("0"))
+	return table
+}
+
+func TestRenderGolden(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"default", Options{}},
+		{"wide", Options{Wide: true}},
+		{"color", Options{Color: true}},
+		{"columns", Options{Columns: []string{"decision", "COMMAND"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := historyTable(tt.opts).Render(&buf); err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			checkGolden(t, "history_"+tt.name, buf.Bytes())
+		})
+	}
+}
+
+func TestRenderUnknownColumn(t *testing.T) {
+	var buf bytes.Buffer
+	err := historyTable(Options{Columns: []string{"command", "nope"}}).Render(&buf)
+	if err == nil {
+		t.Fatal("expected error for unknown column")
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		in   string
+		max  int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exactly10!", 10, "exactly10!"},
+		{"install express lodash", 10, "insta…dash"},
+		{"abcdef", 1, "…"},
+		{"abcdef", 0, "abcdef"},
+		{"héllo wörld", 6, "hél…ld"},
+	}
+	for _, tt := range tests {
+		if got := Truncate(tt.in, tt.max); got != tt.want {
+			t.Errorf("Truncate(%q, %d) = %q, want %q", tt.in, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestDecisionColor(t *testing.T) {
+	tests := map[protocol.Decision]Color{
+		protocol.DecisionAllow:    Green,
+		protocol.DecisionDeny:     Red,
+		protocol.DecisionAsk:      Yellow,
+		protocol.DecisionRejected: NoColor,
+		protocol.DecisionEvent:    NoColor,
+		protocol.DecisionNone:     NoColor,
+	}
+	for decision, want := range tests {
+		if got := DecisionColor(decision); got != want {
+			t.Errorf("DecisionColor(%v) = %q, want %q", decision, got, want)
+		}
+	}
+}
+
+func TestAgeColorAndFormat(t *testing.T) {
+	if got := AgeColor(30*time.Second, time.Minute, 5*time.Minute); got != NoColor {
+		t.Errorf("fresh age colored %q", got)
+	}
+	if got := AgeColor(2*time.Minute, time.Minute, 5*time.Minute); got != Yellow {
+		t.Errorf("warn age colored %q", got)
+	}
+	if got := AgeColor(10*time.Minute, time.Minute, 5*time.Minute); got != Red {
+		t.Errorf("crit age colored %q", got)
+	}
+
+	formats := map[time.Duration]string{
+		45 * time.Second: "45s",
+		12 * time.Minute: "12m",
+		3 * time.Hour:    "3h",
+		50 * time.Hour:   "2d",
+	}
+	for d, want := range formats {
+		if got := FormatAge(d); got != want {
+			t.Errorf("FormatAge(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	formats := map[int64]string{
+		0:           "0B",
+		512:         "512B",
+		4096:        "4.0K",
+		1536 * 1024: "1.5M",
+		3 << 30:     "3.0G",
+	}
+	for n, want := range formats {
+		if got := FormatBytes(n); got != want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestColorEnabledRespectsNoColor(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+	if ColorEnabled(os.Stdout) {
+		t.Error("ColorEnabled should be false when NO_COLOR is set")
+	}
+}
+
+func TestParseColumns(t *testing.T) {
+	got := ParseColumns(" id, command ,,args")
+	if len(got) != 3 || got[0] != "id" || got[1] != "command" || got[2] != "args" {
+		t.Errorf("ParseColumns = %v", got)
+	}
+	if ParseColumns("") != nil {
+		t.Error("ParseColumns(\"\") should be nil")
+	}
+}
@@ -0,0 +1,182 @@
+package events
+
+import (
+	"log"
+	"runtime/debug"
+	"sync"
+)
+
+// Handler receives published events.
+type Handler func(Event)
+
+// Bus dispatches events to subscribers. Synchronous subscribers run on the
+// publisher's goroutine, in subscription order, before Publish returns.
+// Asynchronous subscribers get their own goroutine and queue, and still see
+// events in publish order. A panicking subscriber is logged and skipped; it
+// never affects the publisher or other subscribers.
+//
+// A nil *Bus is valid and drops every event.
+type Bus struct {
+	logger *log.Logger
+
+	mu     sync.RWMutex
+	subs   []*subscription
+	closed bool
+	wg     sync.WaitGroup
+}
+
+type subscription struct {
+	name    string
+	handler Handler
+	queue   chan Event // nil for synchronous subscribers
+
+	once  sync.Once
+	done  chan struct{} // Closed on unsubscribe; queued events are discarded
+	drain chan struct{} // Closed by Bus.Close; queued events are delivered first
+}
+
+// Option configures a subscription.
+type Option func(*subscription)
+
+// Async delivers events on a separate goroutine through a queue of the
+// given size. When the queue is full, events for this subscriber are
+// dropped (and logged) rather than blocking the publisher.
+func Async(queueSize int) Option {
+	if queueSize < 1 {
+		queueSize = 1
+	}
+	return func(s *subscription) {
+		s.queue = make(chan Event, queueSize)
+	}
+}
+
+// New creates an event bus that logs subscriber failures to logger.
+func New(logger *log.Logger) *Bus {
+	return &Bus{logger: logger}
+}
+
+// Subscribe registers handler under name (used in log messages) and returns
+// a function that removes it. After unsubscribe returns, a synchronous
+// handler is not called again; an async handler may still be finishing the
+// event it is processing, but queued events are discarded.
+func (b *Bus) Subscribe(name string, handler Handler, opts ...Option) (unsubscribe func()) {
+	s := &subscription{
+		name:    name,
+		handler: handler,
+		done:    make(chan struct{}),
+		drain:   make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return func() {}
+	}
+	b.subs = append(b.subs, s)
+	if s.queue != nil {
+		b.wg.Add(1)
+		go b.runAsync(s)
+	}
+	b.mu.Unlock()
+
+	return func() { b.remove(s) }
+}
+
+// Publish delivers e to every subscriber.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.RLock()
+	subs, closed := b.subs, b.closed
+	b.mu.RUnlock()
+	if closed {
+		return
+	}
+
+	for _, s := range subs {
+		if s.queue == nil {
+			select {
+			case <-s.done:
+				continue // Unsubscribed while we were dispatching
+			default:
+			}
+			b.call(s, e)
+			continue
+		}
+		select {
+		case s.queue <- e:
+		case <-s.done:
+		default:
+			b.logger.Printf("warning: event subscriber %s is falling behind; dropped %s", s.name, e.Name())
+		}
+	}
+}
+
+// Close unsubscribes everyone and waits for async subscribers to finish
+// the events already queued for them.
+func (b *Bus) Close() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.closed = true
+	subs := b.subs
+	b.subs = nil
+	b.mu.Unlock()
+
+	for _, s := range subs {
+		close(s.drain)
+	}
+	b.wg.Wait()
+}
+
+func (b *Bus) remove(s *subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, sub := range b.subs {
+		if sub == s {
+			// Copy so that in-flight Publish calls keep their snapshot
+			subs := make([]*subscription, 0, len(b.subs)-1)
+			subs = append(subs, b.subs[:i]...)
+			b.subs = append(subs, b.subs[i+1:]...)
+			s.once.Do(func() { close(s.done) })
+			return
+		}
+	}
+}
+
+func (b *Bus) runAsync(s *subscription) {
+	defer b.wg.Done()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.drain:
+			for {
+				select {
+				case e := <-s.queue:
+					b.call(s, e)
+				default:
+					return
+				}
+			}
+		case e := <-s.queue:
+			b.call(s, e)
+		}
+	}
+}
+
+// call runs one handler, containing any panic.
+func (b *Bus) call(s *subscription, e Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			b.logger.Printf("warning: event subscriber %s panicked on %s: %v\n%s", s.name, e.Name(), r, debug.Stack())
+		}
+	}()
+	s.handler(e)
+}
@@ -0,0 +1,158 @@
+package events
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestBus() (*Bus, *bytes.Buffer) {
+	var logs bytes.Buffer
+	return New(log.New(&logs, "", 0)), &logs
+}
+
+func TestBusSyncOrdering(t *testing.T) {
+	bus, _ := newTestBus()
+	var got []string
+	for _, name := range []string{"first", "second", "third"} {
+		name := name
+		bus.Subscribe(name, func(e Event) {
+			got = append(got, name+":"+e.(JailChanged).JailID)
+		})
+	}
+
+	bus.Publish(JailChanged{JailID: "a"})
+	bus.Publish(JailChanged{JailID: "b"})
+
+	want := "first:a second:a third:a first:b second:b third:b"
+	if s := strings.Join(got, " "); s != want {
+		t.Errorf("deliveries = %s, want %s", s, want)
+	}
+}
+
+func TestBusPanicIsolation(t *testing.T) {
+	bus, logs := newTestBus()
+	var got []string
+	bus.Subscribe("before", func(e Event) { got = append(got, "before") })
+	bus.Subscribe("broken", func(e Event) { panic("boom") })
+	bus.Subscribe("after", func(e Event) { got = append(got, "after") })
+
+	bus.Publish(PolicyReloaded{Path: "policy.yaml"})
+	bus.Publish(PolicyReloaded{Path: "policy.yaml"})
+
+	if s := strings.Join(got, ","); s != "before,after,before,after" {
+		t.Errorf("deliveries = %s, want every healthy subscriber twice", s)
+	}
+	if !strings.Contains(logs.String(), "event subscriber broken panicked on policy_reloaded: boom") {
+		t.Errorf("panic not logged: %q", logs.String())
+	}
+}
+
+func TestBusUnsubscribe(t *testing.T) {
+	bus, _ := newTestBus()
+	var a, b int
+	unsubA := bus.Subscribe("a", func(Event) { a++ })
+	bus.Subscribe("b", func(Event) { b++ })
+
+	bus.Publish(RequestReceived{})
+	unsubA()
+	unsubA() // Idempotent
+	bus.Publish(RequestReceived{})
+
+	if a != 1 || b != 2 {
+		t.Errorf("a=%d b=%d, want a=1 b=2", a, b)
+	}
+}
+
+func TestBusUnsubscribeDuringPublish(t *testing.T) {
+	bus, _ := newTestBus()
+	var later int
+	var unsubLater func()
+	bus.Subscribe("remover", func(Event) { unsubLater() })
+	unsubLater = bus.Subscribe("later", func(Event) { later++ })
+
+	bus.Publish(RequestReceived{})
+	if later != 0 {
+		t.Errorf("handler ran %d times after being unsubscribed mid-publish", later)
+	}
+}
+
+func TestBusAsync(t *testing.T) {
+	bus, logs := newTestBus()
+
+	var mu sync.Mutex
+	var got []string
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	bus.Subscribe("slow", func(e Event) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		mu.Lock()
+		got = append(got, e.(HITLEnqueued).ID)
+		mu.Unlock()
+	}, Async(2))
+	var syncCalls int
+	bus.Subscribe("sync", func(Event) { syncCalls++ })
+
+	// The publisher never waits for the async subscriber
+	bus.Publish(HITLEnqueued{ID: "1"})
+	<-started
+	for _, id := range []string{"2", "3", "4"} {
+		bus.Publish(HITLEnqueued{ID: id})
+	}
+	if syncCalls != 4 {
+		t.Errorf("sync subscriber saw %d events, want 4", syncCalls)
+	}
+
+	close(release)
+	bus.Close() // Waits for queued events
+	bus.Publish(HITLEnqueued{ID: "after-close"})
+
+	mu.Lock()
+	defer mu.Unlock()
+	// The handler was blocked on the first event with two more queued, so
+	// the fourth was dropped; the rest arrive in order.
+	if s := strings.Join(got, ","); s != "1,2,3" {
+		t.Errorf("async deliveries = %s, want 1,2,3", s)
+	}
+	if !strings.Contains(logs.String(), "event subscriber slow is falling behind; dropped hitl_enqueued") {
+		t.Errorf("drop not logged: %q", logs.String())
+	}
+}
+
+func TestBusAsyncPanicIsolation(t *testing.T) {
+	bus := New(log.New(io.Discard, "", 0))
+	done := make(chan string, 2)
+	bus.Subscribe("broken", func(e Event) {
+		if e.(HITLEnqueued).ID == "1" {
+			panic("boom")
+		}
+		done <- e.(HITLEnqueued).ID
+	}, Async(4))
+
+	bus.Publish(HITLEnqueued{ID: "1"})
+	bus.Publish(HITLEnqueued{ID: "2"})
+
+	select {
+	case id := <-done:
+		if id != "2" {
+			t.Errorf("got %s, want 2", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("async subscriber stopped after a panic")
+	}
+	bus.Close()
+}
+
+func TestNilBus(t *testing.T) {
+	var bus *Bus
+	bus.Publish(RequestReceived{}) // Must not panic
+	bus.Close()
+}
@@ -0,0 +1,132 @@
+// Package events is the warden's in-process event bus. Components publish
+// what happened (a request arrived, a reviewer decided, a jail changed) and
+// other components subscribe, instead of threading callbacks through the
+// connection handler.
+package events
+
+import (
+	"clawrden/pkg/protocol"
+	"time"
+)
+
+// Event is anything published on the bus. Name identifies the event type
+// in logs; subscribers usually type-switch on the concrete value.
+type Event interface {
+	Name() string
+}
+
+// RequestReceived is published when a shim request has been read and its
+// identity resolved, before policy is evaluated.
+type RequestReceived struct {
+	Request *protocol.Request
+}
+
+// DecisionMade is published after policy evaluation.
+type DecisionMade struct {
+	Request *protocol.Request
+	Action  string // "allow", "deny", or "ask"
+	Timeout time.Duration
+}
+
+// HITLEnqueued is published when a request starts waiting for a reviewer.
+type HITLEnqueued struct {
+	ID      string
+	Request *protocol.Request
+}
+
+// HITLResolved is published when a request leaves the HITL queue.
+type HITLResolved struct {
+	ID       string
+	Request  *protocol.Request
+	Approved bool
+	Expired  bool // Nobody decided before the request's context ended
+	Waited   time.Duration
+
+	// A low-risk ask was approved by its timer, without a reviewer
+	Automatic bool
+}
+
+// ExecutionStarted is published right before an allowed command runs.
+type ExecutionStarted struct {
+	ID      string // Execution ID, for tailing its output over the API
+	Request *protocol.Request
+}
+
+// ExecutionFinished is published after a command ran.
+type ExecutionFinished struct {
+	Request  *protocol.Request
+	ExitCode int
+	Duration time.Duration
+	TimedOut bool
+	Err      error
+}
+
+// JailChanged is published when a jail is created, destroyed, reconciled
+// with a reloaded policy or pruned of unused commands.
+type JailChanged struct {
+	JailID string
+	Change string // "created", "destroyed", "reconciled" or "pruned"
+	Source string // What caused the change, e.g. "policy", "api", "labels"
+}
+
+// PolicyReloaded is published after the policy file was reloaded.
+type PolicyReloaded struct {
+	Path string
+}
+
+// PolicyReloadHeld is published when the policy canary keeps a reloaded
+// policy from taking effect until an operator confirms it.
+type PolicyReloadHeld struct {
+	Path         string
+	PolicyHash   string
+	Summary      string // How its decisions differ, e.g. "12 of 40 allowed requests would now be denied, ..."
+	NewlyDenied  int
+	NewlyAllowed int
+}
+
+// IncidentOpened is published when repeated denials from one container
+// (or uid) trip an incident threshold.
+type IncidentOpened struct {
+	ID       string
+	Subject  string // "container:<id>" or "uid:<n>"
+	Trigger  string // "denials" or "path_violation"
+	Reason   string
+	Lockdown bool // Further requests from Subject are refused until cleared
+}
+
+// IncidentCleared is published when an operator clears an incident.
+type IncidentCleared struct {
+	ID      string
+	Subject string
+}
+
+// DockerHealthChanged is published when the Docker daemon becomes
+// unreachable or recovers.
+type DockerHealthChanged struct {
+	Healthy bool
+	Error   string        // Probe error when the daemon became unreachable
+	Outage  time.Duration // Length of the outage that just ended
+}
+
+// MaintenanceChanged is published when an operator announces a maintenance
+// window or ends one early. Windows that run out are not announced.
+type MaintenanceChanged struct {
+	ID      string
+	Active  bool // False when the window was ended early
+	Message string
+	Until   time.Time
+}
+
+func (RequestReceived) Name() string     { return "request_received" }
+func (DecisionMade) Name() string        { return "decision_made" }
+func (HITLEnqueued) Name() string        { return "hitl_enqueued" }
+func (HITLResolved) Name() string        { return "hitl_resolved" }
+func (ExecutionStarted) Name() string    { return "execution_started" }
+func (ExecutionFinished) Name() string   { return "execution_finished" }
+func (JailChanged) Name() string         { return "jail_changed" }
+func (PolicyReloaded) Name() string      { return "policy_reloaded" }
+func (PolicyReloadHeld) Name() string    { return "policy_reload_held" }
+func (IncidentOpened) Name() string      { return "incident_opened" }
+func (IncidentCleared) Name() string     { return "incident_cleared" }
+func (DockerHealthChanged) Name() string { return "docker_health_changed" }
+func (MaintenanceChanged) Name() string  { return "maintenance_changed" }
@@ -0,0 +1,303 @@
+package executor
+
+import (
+	"bufio"
+	"bytes"
+	"clawrden/pkg/protocol"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// Default bounds of a workspace snapshot.
+const (
+	DefaultManifestMaxFiles     = 20000
+	DefaultManifestMaxHashBytes = 1 << 20
+)
+
+// manifestImage runs the helper container that snapshots the /app volume
+// when the warden cannot see it directly.
+const manifestImage = "alpine:latest"
+
+// ErrWorkspaceTooLarge means a workspace has more files than a snapshot may
+// list; changes to it are not tracked.
+var ErrWorkspaceTooLarge = errors.New("workspace too large to snapshot")
+
+// ChangeTracking configures how a ghost command's changes to its workspace
+// are tracked.
+type ChangeTracking struct {
+	MaxFiles        int   // Skip tracking when the workspace has more files than this
+	MaxHashBytes    int64 // Hash files up to this size; larger ones compare by size and mtime
+	MaxFilesChanged int   // Changes beyond this many files are flagged (0 = no limit)
+}
+
+// withDefaults fills in unset bounds.
+func (t ChangeTracking) withDefaults() ChangeTracking {
+	if t.MaxFiles <= 0 {
+		t.MaxFiles = DefaultManifestMaxFiles
+	}
+	if t.MaxHashBytes <= 0 {
+		t.MaxHashBytes = DefaultManifestMaxHashBytes
+	}
+	return t
+}
+
+// FileState is what a snapshot records about one regular file.
+type FileState struct {
+	Size    int64
+	ModTime time.Time
+	Hash    string // SHA-256 of the content; empty for files over the hash cap
+}
+
+// Manifest maps the slash-separated paths of a workspace's regular files,
+// relative to its root, to their state. Symlinks and special files are left
+// out.
+type Manifest map[string]FileState
+
+// ScanManifest snapshots the regular files under root. It returns
+// ErrWorkspaceTooLarge once more than t.MaxFiles files are found.
+func ScanManifest(root string, t ChangeTracking) (Manifest, error) {
+	t = t.withDefaults()
+	m := make(Manifest)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if len(m) == t.MaxFiles {
+			return fmt.Errorf("%w: over %d files", ErrWorkspaceTooLarge, t.MaxFiles)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		state := FileState{Size: info.Size(), ModTime: info.ModTime()}
+		if state.Size <= t.MaxHashBytes {
+			if state.Hash, err = hashFile(path); err != nil {
+				return err
+			}
+		}
+		m[filepath.ToSlash(rel)] = state
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// manifestScript lists the files under /app as "size mtime hash path" lines,
+// with "-" for files over the hash cap. It stops one file past the limit so
+// ParseManifest can tell the workspace is too large. Paths with newlines are
+// not supported.
+const manifestScript = `cd /app && find . -xdev -type f | head -n %d | while IFS= read -r f; do
+  s=$(stat -c '%%s %%Y' "$f") || continue
+  h=-
+  [ "${s%%%% *}" -le %d ] && h=$(sha256sum "$f" | cut -d' ' -f1)
+  printf '%%s %%s %%s\n' "$s" "$h" "${f#./}"
+done`
+
+// ParseManifest reads the output of the snapshot helper container.
+func ParseManifest(r io.Reader, t ChangeTracking) (Manifest, error) {
+	t = t.withDefaults()
+	m := make(Manifest)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), " ", 4)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("malformed manifest line %q", scanner.Text())
+		}
+		size, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed manifest size %q", fields[0])
+		}
+		mtime, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed manifest mtime %q", fields[1])
+		}
+		if len(m) == t.MaxFiles {
+			return nil, fmt.Errorf("%w: over %d files", ErrWorkspaceTooLarge, t.MaxFiles)
+		}
+		state := FileState{Size: size, ModTime: time.Unix(mtime, 0)}
+		if fields[2] != "-" {
+			state.Hash = fields[2]
+		}
+		m[fields[3]] = state
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// File changes
+const (
+	FileAdded    = "added"
+	FileModified = "modified"
+	FileDeleted  = "deleted"
+)
+
+// FileChange is one file a command added, modified or deleted.
+type FileChange struct {
+	Path   string `json:"path"`
+	Change string `json:"change"` // added, modified or deleted
+}
+
+// ChangeSummary is what a command changed in its workspace.
+type ChangeSummary struct {
+	Added          int          `json:"added"`
+	Modified       int          `json:"modified"`
+	Deleted        int          `json:"deleted"`
+	Paths          []FileChange `json:"paths,omitempty"`           // The first changes by path
+	PathsTruncated bool         `json:"paths_truncated,omitempty"` // More changes than Paths lists
+
+	// Changes were not tracked, and why
+	Skipped string `json:"skipped,omitempty"`
+
+	// Set when the command changed more files than its max_files_changed
+	MaxFilesChanged int  `json:"max_files_changed,omitempty"`
+	Exceeded        bool `json:"exceeded,omitempty"`
+}
+
+// Total returns the number of files changed.
+func (c *ChangeSummary) Total() int {
+	return c.Added + c.Modified + c.Deleted
+}
+
+// DiffManifests summarizes how after differs from before, listing at most
+// maxPaths changed paths. A file is modified when its size or hash changed,
+// or, for files too large to hash, its mtime.
+func DiffManifests(before, after Manifest, maxPaths int) *ChangeSummary {
+	var changes []FileChange
+	for path, a := range after {
+		b, ok := before[path]
+		switch {
+		case !ok:
+			changes = append(changes, FileChange{Path: path, Change: FileAdded})
+		case modified(b, a):
+			changes = append(changes, FileChange{Path: path, Change: FileModified})
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changes = append(changes, FileChange{Path: path, Change: FileDeleted})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+
+	summary := &ChangeSummary{}
+	for _, c := range changes {
+		switch c.Change {
+		case FileAdded:
+			summary.Added++
+		case FileModified:
+			summary.Modified++
+		case FileDeleted:
+			summary.Deleted++
+		}
+	}
+	if len(changes) > maxPaths {
+		changes, summary.PathsTruncated = changes[:maxPaths], true
+	}
+	summary.Paths = changes
+	return summary
+}
+
+func modified(before, after FileState) bool {
+	if before.Size != after.Size {
+		return true
+	}
+	if before.Hash != "" && after.Hash != "" {
+		return before.Hash != after.Hash
+	}
+	return !before.ModTime.Equal(after.ModTime)
+}
+
+// SnapshotWorkspace snapshots the workspace ghost containers see as /app.
+// A workspace mounted on the warden at WorkspaceDir is scanned directly;
+// otherwise a helper container scans the volume.
+func (de *DockerExecutor) SnapshotWorkspace(ctx context.Context, req *protocol.Request, t ChangeTracking) (Manifest, error) {
+	if de.WorkspaceDir != "" {
+		return ScanManifest(de.WorkspaceDir, t)
+	}
+	return de.snapshotInHelper(ctx, req, t)
+}
+
+// snapshotInHelper scans the /app volume in a throwaway container that
+// mounts it read-only.
+func (de *DockerExecutor) snapshotInHelper(ctx context.Context, req *protocol.Request, t ChangeTracking) (Manifest, error) {
+	t = t.withDefaults()
+	containerConfig := &container.Config{
+		Image: manifestImage,
+		Cmd:   []string{"sh", "-c", fmt.Sprintf(manifestScript, t.MaxFiles+1, t.MaxHashBytes)},
+	}
+	hostConfig := &container.HostConfig{
+		Binds:       []string{ghostAppVolume + ":/app:ro"},
+		NetworkMode: "none",
+	}
+	resp, err := de.createContainer(ctx, containerConfig, hostConfig, req.RequestID)
+	if err != nil {
+		return nil, fmt.Errorf("create snapshot container: %w", err)
+	}
+	defer de.removeContainer(resp.ID)
+
+	if err := de.client.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		return nil, fmt.Errorf("start snapshot container: %w", err)
+	}
+	statusCh, errCh := de.client.ContainerWait(ctx, resp.ID, container.WaitConditionNotRunning)
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return nil, fmt.Errorf("wait snapshot container: %w", err)
+		}
+	case status := <-statusCh:
+		if status.StatusCode != 0 {
+			return nil, fmt.Errorf("snapshot container exited with %d", status.StatusCode)
+		}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	logs, err := de.client.ContainerLogs(ctx, resp.ID, container.LogsOptions{ShowStdout: true})
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot: %w", err)
+	}
+	defer logs.Close()
+	var stdout bytes.Buffer
+	if _, err := stdcopy.StdCopy(&stdout, io.Discard, logs); err != nil {
+		return nil, fmt.Errorf("read snapshot: %w", err)
+	}
+	return ParseManifest(&stdout, t)
+}
@@ -0,0 +1,112 @@
+package executor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManifestDiff(t *testing.T) {
+	root := t.TempDir()
+	write := func(rel, content string) {
+		t.Helper()
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("package.json", `{"name":"app"}`)
+	write("src/index.js", "console.log(1)")
+	write("src/old.js", "gone soon")
+	write("touched.txt", "same")
+	write("big.bin", strings.Repeat("x", 64))
+	os.Symlink("package.json", filepath.Join(root, "link"))
+
+	tracking := ChangeTracking{MaxHashBytes: 32}
+	before, err := ScanManifest(root, tracking)
+	if err != nil {
+		t.Fatalf("ScanManifest: %v", err)
+	}
+	if _, ok := before["link"]; ok {
+		t.Error("manifest lists a symlink")
+	}
+	if before["big.bin"].Hash != "" || before["package.json"].Hash == "" {
+		t.Errorf("hashes = %+v, want only files under the cap hashed", before)
+	}
+
+	write("node_modules/left-pad/index.js", "module.exports = 1")
+	write("src/index.js", "console.log(2)")
+	os.Remove(filepath.Join(root, "src/old.js"))
+	// Same content with a new mtime is no change; an unhashed file's mtime is
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(root, "touched.txt"), later, later)
+	os.Chtimes(filepath.Join(root, "big.bin"), later, later)
+
+	after, err := ScanManifest(root, tracking)
+	if err != nil {
+		t.Fatalf("ScanManifest: %v", err)
+	}
+	got := DiffManifests(before, after, 10)
+	want := &ChangeSummary{
+		Added:    1,
+		Modified: 2,
+		Deleted:  1,
+		Paths: []FileChange{
+			{Path: "big.bin", Change: FileModified},
+			{Path: "node_modules/left-pad/index.js", Change: FileAdded},
+			{Path: "src/index.js", Change: FileModified},
+			{Path: "src/old.js", Change: FileDeleted},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffManifests = %+v, want %+v", got, want)
+	}
+
+	capped := DiffManifests(before, after, 2)
+	if capped.Total() != 4 || len(capped.Paths) != 2 || !capped.PathsTruncated {
+		t.Errorf("capped diff = %+v, want 4 changes with 2 paths listed", capped)
+	}
+}
+
+func TestManifestTooLarge(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a", "b", "c"} {
+		os.WriteFile(filepath.Join(root, name), nil, 0644)
+	}
+	if _, err := ScanManifest(root, ChangeTracking{MaxFiles: 3}); err != nil {
+		t.Errorf("ScanManifest at the limit: %v", err)
+	}
+	if _, err := ScanManifest(root, ChangeTracking{MaxFiles: 2}); !errors.Is(err, ErrWorkspaceTooLarge) {
+		t.Errorf("ScanManifest over the limit: err = %v, want ErrWorkspaceTooLarge", err)
+	}
+}
+
+func TestParseManifest(t *testing.T) {
+	out := "14 1700000000 0a1b package.json\n" +
+		"2097152 1700000100 - dist/app with space.js\n"
+	m, err := ParseManifest(strings.NewReader(out), ChangeTracking{})
+	if err != nil {
+		t.Fatalf("ParseManifest: %v", err)
+	}
+	want := Manifest{
+		"package.json":           {Size: 14, ModTime: time.Unix(1700000000, 0), Hash: "0a1b"},
+		"dist/app with space.js": {Size: 2097152, ModTime: time.Unix(1700000100, 0)},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("ParseManifest = %+v, want %+v", m, want)
+	}
+
+	if _, err := ParseManifest(strings.NewReader(out), ChangeTracking{MaxFiles: 1}); !errors.Is(err, ErrWorkspaceTooLarge) {
+		t.Errorf("over the limit: err = %v, want ErrWorkspaceTooLarge", err)
+	}
+	if _, err := ParseManifest(strings.NewReader("garbage\n"), ChangeTracking{}); err == nil {
+		t.Error("ParseManifest accepted a malformed line")
+	}
+}
@@ -0,0 +1,124 @@
+package executor
+
+import (
+	"clawrden/pkg/protocol"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// Delivery outcomes reported by DeliveryConn.
+const (
+	DeliveryComplete = "complete" // Every frame reached the shim
+	DeliveryPartial  = "partial"  // Some frames were written before a failure
+	DeliveryFailed   = "failed"   // Nothing was delivered
+)
+
+// DeliveryStats summarizes the frames written through a DeliveryConn.
+type DeliveryStats struct {
+	StdoutBytes    int64 // Stdout payload bytes delivered
+	StderrBytes    int64 // Stderr payload bytes delivered
+	AttemptedBytes int64 // Total bytes written, including frame headers
+	DeliveredBytes int64 // Total bytes accepted by the connection
+	Err            error // First write error, if any
+
+	Exited     bool   // An exit frame was delivered
+	ExitCode   int    // The delivered exit code, if Exited
+	StderrTail string // The last stderrTailSize bytes of delivered stderr
+}
+
+// stderrTailSize bounds DeliveryStats.StderrTail.
+const stderrTailSize = 1024
+
+// Outcome classifies the delivery as complete, partial, or failed.
+func (s DeliveryStats) Outcome() string {
+	switch {
+	case s.Err == nil:
+		return DeliveryComplete
+	case s.DeliveredBytes > 0:
+		return DeliveryPartial
+	default:
+		return DeliveryFailed
+	}
+}
+
+// StreamCounter accumulates the stdout and stderr payload bytes delivered
+// through any number of DeliveryConns, e.g. for throughput statistics.
+type StreamCounter struct {
+	Stdout atomic.Int64
+	Stderr atomic.Int64
+}
+
+// DeliveryConn wraps a connection and counts the output frames written to
+// it. protocol.WriteFrame issues one Write per frame, so each Write is
+// treated as a whole frame when attributing payload bytes to a stream.
+type DeliveryConn struct {
+	net.Conn
+
+	mu         sync.Mutex
+	stats      DeliveryStats
+	stderrTail []byte
+	counter    *StreamCounter // Also counts delivered payload here, if set
+}
+
+// NewDeliveryConn wraps conn for delivery tracking.
+func NewDeliveryConn(conn net.Conn) *DeliveryConn {
+	return &DeliveryConn{Conn: conn}
+}
+
+// CountInto adds the payload bytes delivered from now on to counter as
+// well. It costs one atomic add per output frame.
+func (c *DeliveryConn) CountInto(counter *StreamCounter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counter = counter
+}
+
+// Write forwards b to the underlying connection and records how much of it
+// was delivered.
+func (c *DeliveryConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats.AttemptedBytes += int64(len(b))
+	c.stats.DeliveredBytes += int64(n)
+	if err != nil && c.stats.Err == nil {
+		c.stats.Err = err
+	}
+
+	if len(b) >= protocol.FrameHeaderSize && n > protocol.FrameHeaderSize {
+		payload := int64(n - protocol.FrameHeaderSize)
+		switch b[0] {
+		case protocol.StreamStdout:
+			c.stats.StdoutBytes += payload
+			if c.counter != nil {
+				c.counter.Stdout.Add(payload)
+			}
+		case protocol.StreamStderr:
+			c.stats.StderrBytes += payload
+			if c.counter != nil {
+				c.counter.Stderr.Add(payload)
+			}
+			c.stderrTail = append(c.stderrTail, b[protocol.FrameHeaderSize:n]...)
+			if over := len(c.stderrTail) - stderrTailSize; over > 0 {
+				c.stderrTail = append(c.stderrTail[:0], c.stderrTail[over:]...)
+			}
+		case protocol.StreamExit:
+			c.stats.Exited = true
+			c.stats.ExitCode = protocol.ParseExitCode(protocol.Frame{Payload: b[protocol.FrameHeaderSize:n]})
+		}
+	}
+
+	return n, err
+}
+
+// Stats returns a snapshot of the delivery counters.
+func (c *DeliveryConn) Stats() DeliveryStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.StderrTail = string(c.stderrTail)
+	return stats
+}
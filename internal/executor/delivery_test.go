@@ -0,0 +1,100 @@
+package executor
+
+import (
+	"clawrden/pkg/protocol"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+var errBrokenPipe = errors.New("broken pipe")
+
+// limitConn accepts up to limit bytes, then fails every write.
+type limitConn struct {
+	net.Conn
+	limit int
+}
+
+func (c *limitConn) Write(b []byte) (int, error) {
+	if len(b) <= c.limit {
+		c.limit -= len(b)
+		return len(b), nil
+	}
+	n := c.limit
+	c.limit = 0
+	return n, errBrokenPipe
+}
+
+func TestDeliveryConn(t *testing.T) {
+	// Each frame below is 5 header bytes + 5 payload bytes
+	frames := []protocol.Frame{
+		{Type: protocol.StreamStdout, Payload: []byte("hello")},
+		{Type: protocol.StreamStderr, Payload: []byte("oops!")},
+		{Type: protocol.StreamStdout, Payload: []byte("world")},
+	}
+
+	tests := []struct {
+		name      string
+		limit     int
+		outcome   string
+		stdout    int64
+		stderr    int64
+		delivered int64
+		wantErr   bool
+	}{
+		{"complete", 1000, DeliveryComplete, 10, 5, 30, false},
+		{"failed", 0, DeliveryFailed, 0, 0, 0, true},
+		{"partial mid-payload", 17, DeliveryPartial, 5, 2, 17, true},
+		{"partial in header", 12, DeliveryPartial, 5, 0, 12, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := NewDeliveryConn(&limitConn{limit: tt.limit})
+			for _, f := range frames {
+				protocol.WriteFrame(conn, f)
+			}
+
+			stats := conn.Stats()
+			if got := stats.Outcome(); got != tt.outcome {
+				t.Errorf("Outcome() = %q, want %q", got, tt.outcome)
+			}
+			if stats.StdoutBytes != tt.stdout || stats.StderrBytes != tt.stderr {
+				t.Errorf("stdout/stderr = %d/%d, want %d/%d",
+					stats.StdoutBytes, stats.StderrBytes, tt.stdout, tt.stderr)
+			}
+			if stats.AttemptedBytes != 30 || stats.DeliveredBytes != tt.delivered {
+				t.Errorf("delivered %d/%d bytes, want %d/30",
+					stats.DeliveredBytes, stats.AttemptedBytes, tt.delivered)
+			}
+			if (stats.Err != nil) != tt.wantErr {
+				t.Errorf("Err = %v, wantErr %v", stats.Err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(stats.Err, errBrokenPipe) {
+				t.Errorf("Err = %v, want the first write error", stats.Err)
+			}
+		})
+	}
+}
+
+func TestDeliveryConnExitAndStderrTail(t *testing.T) {
+	conn := NewDeliveryConn(&limitConn{limit: 1 << 20})
+	protocol.WriteFrame(conn, protocol.Frame{Type: protocol.StreamStderr, Payload: make([]byte, stderrTailSize)})
+	protocol.WriteFrame(conn, protocol.Frame{Type: protocol.StreamStderr, Payload: []byte("mkdir: Read-only file system\n")})
+	if conn.Stats().Exited {
+		t.Fatal("Exited before the exit frame")
+	}
+	protocol.WriteExitCode(conn, 2)
+
+	stats := conn.Stats()
+	if !stats.Exited || stats.ExitCode != 2 {
+		t.Errorf("exit = %v/%d, want true/2", stats.Exited, stats.ExitCode)
+	}
+	if len(stats.StderrTail) != stderrTailSize {
+		t.Errorf("tail is %d bytes, want %d", len(stats.StderrTail), stderrTailSize)
+	}
+	if !strings.HasSuffix(stats.StderrTail, "Read-only file system\n") {
+		t.Errorf("tail does not end with the last stderr: %q", stats.StderrTail[len(stats.StderrTail)-40:])
+	}
+}
@@ -6,7 +6,6 @@ package executor
 import (
 	"clawrden/pkg/protocol"
 	"context"
-	"fmt"
 	"net"
 	"strings"
 )
@@ -15,13 +14,78 @@ import (
 type Executor interface {
 	// Execute runs the command described in req and streams output to conn.
 	// It must send an exit code frame at the end.
+	//
+	// req.Cwd has already been normalized and checked against the policy's
+	// allowed_paths by the Warden; executors do not re-validate it.
+	//
+	// A failure outside the command that running it again may get past is
+	// returned as a *TransientError, without an exit frame.
 	Execute(ctx context.Context, req *protocol.Request, conn net.Conn) error
 }
 
-// ValidatePath checks that the working directory is within the /app boundary.
-func ValidatePath(cwd string) error {
-	if !strings.HasPrefix(cwd, "/app") {
-		return fmt.Errorf("working directory %q is outside /app boundary", cwd)
+// TransientError is an execution that failed for a reason outside the
+// command, such as its ghost container being OOM-killed or the Docker daemon
+// dropping the connection while it restarts, so that running the command
+// again may succeed. ExitCode, if not 0, is the code the command ended with.
+type TransientError struct {
+	Reason   string
+	ExitCode int
+	Err      error // The underlying error, if any
+}
+
+func (e *TransientError) Error() string {
+	if e.Err != nil {
+		return e.Reason + ": " + e.Err.Error()
+	}
+	return e.Reason
+}
+
+func (e *TransientError) Unwrap() error { return e.Err }
+
+// Func adapts a function, such as DockerExecutor.ExecuteGhost, to Executor.
+type Func func(ctx context.Context, req *protocol.Request, conn net.Conn) error
+
+// Execute calls f.
+func (f Func) Execute(ctx context.Context, req *protocol.Request, conn net.Conn) error {
+	return f(ctx, req, conn)
+}
+
+// markedEnv returns env with the marker variables of protocol.SupervisedEnv
+// set for a command run by strategy, replacing any the agent passed in.
+// With req.UnmarkedEnv it returns env as it is.
+func markedEnv(env []string, req *protocol.Request, strategy Strategy) []string {
+	if req.UnmarkedEnv {
+		return env
+	}
+	marked := make([]string, 0, len(env)+3)
+	for _, kv := range env {
+		key, _, _ := strings.Cut(kv, "=")
+		if key != protocol.SupervisedEnv && key != protocol.RequestIDEnv && key != protocol.StrategyEnv {
+			marked = append(marked, kv)
+		}
+	}
+	return append(marked,
+		protocol.SupervisedEnv+"=1",
+		protocol.RequestIDEnv+"="+req.RequestID,
+		protocol.StrategyEnv+"="+string(strategy),
+	)
+}
+
+// Strategy is where a containerized command runs.
+type Strategy string
+
+const (
+	StrategyAuto   Strategy = "auto"   // Ghost for known toolchains, mirror otherwise
+	StrategyMirror Strategy = "mirror" // Exec back in the originating container
+	StrategyGhost  Strategy = "ghost"  // Ephemeral container sharing /app
+	StrategyLocal  Strategy = "local"  // On the warden host
+)
+
+// Valid reports whether s names a strategy. The empty strategy means auto.
+func (s Strategy) Valid() bool {
+	switch s {
+	case "", StrategyAuto, StrategyMirror, StrategyGhost, StrategyLocal:
+		return true
 	}
-	return nil
+	return false
 }
@@ -0,0 +1,97 @@
+package executor
+
+import (
+	"clawrden/pkg/protocol"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// ghostAppVolume is the shared volume ghost containers see as /app.
+const ghostAppVolume = "clawrden_app-data"
+
+// GhostHardening restricts what a ghost container may do. The zero value
+// runs ghosts with Docker's defaults.
+type GhostHardening struct {
+	ReadonlyRootfs  bool     // Mount the image read-only; /tmp stays writable
+	CapDropAll      bool     // Drop every capability except CapAdd
+	CapAdd          []string // Capabilities to keep when CapDropAll is set (e.g. CHOWN)
+	NoNewPrivileges bool     // Block setuid binaries from gaining privileges
+	SeccompProfile  string   // Path to a seccomp JSON profile on the warden host (empty = Docker's default)
+}
+
+// Hardened reports whether any restriction is enabled.
+func (h GhostHardening) Hardened() bool {
+	return h.ReadonlyRootfs || h.CapDropAll || h.NoNewPrivileges || h.SeccompProfile != ""
+}
+
+// Hint suggests which restriction to relax after a hardened ghost command
+// failed, using the end of its stderr to guess the cause. It returns "" for
+// an unhardened container.
+func (h GhostHardening) Hint(command, stderrTail string) string {
+	var filesystem, permissions []string
+	if h.ReadonlyRootfs {
+		filesystem = append(filesystem, "readonly_rootfs: false")
+	}
+	if h.CapDropAll {
+		permissions = append(permissions, "cap_add: [...]")
+	}
+	if h.NoNewPrivileges {
+		permissions = append(permissions, "no_new_privileges: false")
+	}
+	if h.SeccompProfile != "" {
+		permissions = append(permissions, "a wider seccomp_profile")
+	}
+
+	suggest := append(filesystem, permissions...)
+	switch {
+	case len(filesystem) > 0 && strings.Contains(stderrTail, "Read-only file system"):
+		suggest = filesystem
+	case len(permissions) > 0 && strings.Contains(stderrTail, "Operation not permitted"):
+		suggest = permissions
+	}
+	if len(suggest) == 0 {
+		return ""
+	}
+	return "ghost container was hardened; if " + command + " needs more, try " +
+		strings.Join(suggest, " or ") + " under ghost.commands." + command + " in the policy"
+}
+
+// ghostHostConfig builds the HostConfig for a ghost container running req.
+// seccomp is the content of h.SeccompProfile, read by the caller.
+func ghostHostConfig(req *protocol.Request, h GhostHardening, seccomp []byte) *container.HostConfig {
+	hostConfig := &container.HostConfig{
+		// Mount the shared /app volume
+		Binds: []string{ghostAppVolume + ":/app"},
+	}
+
+	// Sandboxed commands see only the scratch directory, never the real /app
+	if req.SandboxDir != "" {
+		hostConfig.Binds = []string{req.SandboxDir + ":" + sandboxMountPoint}
+	}
+
+	if req.Network != "" {
+		hostConfig.NetworkMode = container.NetworkMode(req.Network)
+	}
+
+	if h.ReadonlyRootfs {
+		hostConfig.ReadonlyRootfs = true
+		hostConfig.Tmpfs = map[string]string{"/tmp": "rw,nosuid,nodev"}
+	}
+	if h.CapDropAll {
+		hostConfig.CapDrop = []string{"ALL"}
+		hostConfig.CapAdd = append([]string(nil), h.CapAdd...)
+	}
+	if h.NoNewPrivileges {
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, "no-new-privileges")
+	}
+	if len(seccomp) > 0 {
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, "seccomp="+string(seccomp))
+	}
+
+	// Containers have no nice value; CPU shares and blkio weight come closest
+	if req.Priority != nil {
+		hostConfig.CPUShares, hostConfig.BlkioWeight = ghostPriority(ClampPriority(*req.Priority))
+	}
+	return hostConfig
+}
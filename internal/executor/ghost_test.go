@@ -0,0 +1,121 @@
+package executor
+
+import (
+	"clawrden/pkg/protocol"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/strslice"
+)
+
+func TestGhostHostConfig(t *testing.T) {
+	hardened := GhostHardening{
+		ReadonlyRootfs:  true,
+		CapDropAll:      true,
+		CapAdd:          []string{"CHOWN"},
+		NoNewPrivileges: true,
+	}
+
+	tests := []struct {
+		name      string
+		req       *protocol.Request
+		hardening GhostHardening
+		seccomp   []byte
+		want      *container.HostConfig
+	}{
+		{
+			name: "docker defaults",
+			req:  &protocol.Request{Command: "npm"},
+			want: &container.HostConfig{Binds: []string{"clawrden_app-data:/app"}},
+		},
+		{
+			name:      "hardened",
+			req:       &protocol.Request{Command: "npm"},
+			hardening: hardened,
+			want: &container.HostConfig{
+				Binds:          []string{"clawrden_app-data:/app"},
+				ReadonlyRootfs: true,
+				Tmpfs:          map[string]string{"/tmp": "rw,nosuid,nodev"},
+				CapDrop:        strslice.StrSlice{"ALL"},
+				CapAdd:         strslice.StrSlice{"CHOWN"},
+				SecurityOpt:    []string{"no-new-privileges"},
+			},
+		},
+		{
+			name:      "seccomp and sandbox",
+			req:       &protocol.Request{Command: "python", SandboxDir: "/tmp/sbx"},
+			hardening: GhostHardening{SeccompProfile: "/etc/clawrden/seccomp.json"},
+			seccomp:   []byte(`{"defaultAction":"SCMP_ACT_ERRNO"}`),
+			want: &container.HostConfig{
+				Binds:       []string{"/tmp/sbx:/sandbox"},
+				SecurityOpt: []string{`seccomp={"defaultAction":"SCMP_ACT_ERRNO"}`},
+			},
+		},
+		{
+			name:      "drop all without additions",
+			req:       &protocol.Request{Command: "kubectl"},
+			hardening: GhostHardening{CapDropAll: true},
+			want: &container.HostConfig{
+				Binds:   []string{"clawrden_app-data:/app"},
+				CapDrop: strslice.StrSlice{"ALL"},
+			},
+		},
+		{
+			name:      "network pinned by a reviewer",
+			req:       &protocol.Request{Command: "pip", Network: "none"},
+			hardening: GhostHardening{},
+			want: &container.HostConfig{
+				Binds:       []string{"clawrden_app-data:/app"},
+				NetworkMode: "none",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ghostHostConfig(tt.req, tt.hardening, tt.seccomp)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ghostHostConfig =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGhostHardeningHint(t *testing.T) {
+	all := GhostHardening{ReadonlyRootfs: true, CapDropAll: true, NoNewPrivileges: true}
+	tests := []struct {
+		name      string
+		hardening GhostHardening
+		stderr    string
+		want      []string
+		notWant   []string
+	}{
+		{"unhardened", GhostHardening{}, "Read-only file system", nil, []string{"hardened"}},
+		{"read-only error", all, "npm ERR! EROFS: Read-only file system, mkdir '/root/.npm'", []string{"readonly_rootfs: false"}, []string{"cap_add"}},
+		{"permission error", all, "chown: /app/x: Operation not permitted", []string{"cap_add", "no_new_privileges"}, []string{"readonly_rootfs"}},
+		{"unknown failure", all, "error: exit 1", []string{"readonly_rootfs", "cap_add", "no_new_privileges"}, nil},
+		{"seccomp only", GhostHardening{SeccompProfile: "p.json"}, "Operation not permitted", []string{"seccomp_profile"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hint := tt.hardening.Hint("npm", tt.stderr)
+			if tt.want == nil && hint != "" {
+				t.Fatalf("Hint = %q, want none", hint)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(hint, w) {
+					t.Errorf("Hint = %q, missing %q", hint, w)
+				}
+			}
+			for _, w := range tt.notWant {
+				if strings.Contains(hint, w) {
+					t.Errorf("Hint = %q, should not mention %q", hint, w)
+				}
+			}
+			if hint != "" && !strings.Contains(hint, "ghost.commands.npm") {
+				t.Errorf("Hint = %q, does not name the policy section", hint)
+			}
+		})
+	}
+}
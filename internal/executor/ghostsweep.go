@@ -0,0 +1,124 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// Labels on every container the Docker executor creates, so containers a
+// warden left behind when it died mid-execution can be found and removed.
+const (
+	LabelGhost   = "clawrden.ghost"   // Always "true"
+	LabelRequest = "clawrden.request" // Request ID of the execution
+	LabelOwner   = "clawrden.owner"   // InstanceID of the warden that created it
+)
+
+// orphanMinAge spares containers created moments ago from a sweep: one may
+// exist before the executor has recorded it as live.
+const orphanMinAge = time.Minute
+
+// ErrTooManyGhosts means MaxGhosts ghost containers already exist.
+var ErrTooManyGhosts = errors.New("too many ghost containers")
+
+// ghostRegistry tracks the containers an executor has created and not yet
+// removed. The zero value is ready to use.
+type ghostRegistry struct {
+	mu     sync.Mutex
+	ghosts int               // Ghost slots taken, including ghosts being created
+	live   map[string]string // Container ID -> request ID
+}
+
+// OrphanedGhost is a container removed by SweepOrphans.
+type OrphanedGhost struct {
+	ContainerID string
+	RequestID   string
+	Created     time.Time
+}
+
+// reserveGhost takes a slot for a ghost container, or fails if MaxGhosts
+// are taken. The returned function frees the slot.
+func (de *DockerExecutor) reserveGhost() (func(), error) {
+	de.registry.mu.Lock()
+	defer de.registry.mu.Unlock()
+	if de.MaxGhosts > 0 && de.registry.ghosts >= de.MaxGhosts {
+		return nil, fmt.Errorf("%w: %d exist, the limit is %d; try again when one finishes", ErrTooManyGhosts, de.registry.ghosts, de.MaxGhosts)
+	}
+	de.registry.ghosts++
+	return func() {
+		de.registry.mu.Lock()
+		de.registry.ghosts--
+		de.registry.mu.Unlock()
+	}, nil
+}
+
+// createContainer creates a labeled container for requestID and records it
+// as live until removeContainer.
+func (de *DockerExecutor) createContainer(ctx context.Context, cfg *container.Config, host *container.HostConfig, requestID string) (container.CreateResponse, error) {
+	cfg.Labels = map[string]string{
+		LabelGhost:   "true",
+		LabelRequest: requestID,
+		LabelOwner:   de.InstanceID,
+	}
+	resp, err := de.client.ContainerCreate(ctx, cfg, host, nil, nil, "")
+	if err != nil {
+		return resp, err
+	}
+	de.registry.mu.Lock()
+	if de.registry.live == nil {
+		de.registry.live = make(map[string]string)
+	}
+	de.registry.live[resp.ID] = requestID
+	de.registry.mu.Unlock()
+	return resp, nil
+}
+
+// removeContainer force-removes a container made by createContainer. One
+// that cannot be removed is left to SweepOrphans.
+func (de *DockerExecutor) removeContainer(id string) {
+	de.registry.mu.Lock()
+	delete(de.registry.live, id)
+	de.registry.mu.Unlock()
+	if err := de.client.ContainerRemove(context.Background(), id, container.RemoveOptions{Force: true}); err != nil {
+		de.logger.Printf("warning: failed to remove container %s: %v (left for the orphan sweep)", id, err)
+	}
+}
+
+// SweepOrphans removes containers this warden created, as told by their
+// owner label, that no live execution uses: ghosts left behind when an
+// earlier run of the warden was killed before it could remove them.
+// Containers of other wardens are left alone.
+func (de *DockerExecutor) SweepOrphans(ctx context.Context) ([]OrphanedGhost, error) {
+	containers, err := de.client.ContainerList(ctx, container.ListOptions{
+		All: true,
+		Filters: filters.NewArgs(
+			filters.Arg("label", LabelGhost+"=true"),
+			filters.Arg("label", LabelOwner+"="+de.InstanceID),
+		),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list ghost containers: %w", err)
+	}
+
+	var removed []OrphanedGhost
+	for _, c := range containers {
+		created := time.Unix(c.Created, 0)
+		de.registry.mu.Lock()
+		_, live := de.registry.live[c.ID]
+		de.registry.mu.Unlock()
+		if live || time.Since(created) < orphanMinAge {
+			continue
+		}
+		if err := de.client.ContainerRemove(ctx, c.ID, container.RemoveOptions{Force: true}); err != nil {
+			de.logger.Printf("warning: failed to remove orphaned ghost %s: %v", c.ID, err)
+			continue
+		}
+		removed = append(removed, OrphanedGhost{ContainerID: c.ID, RequestID: c.Labels[LabelRequest], Created: created})
+	}
+	return removed, nil
+}
@@ -0,0 +1,134 @@
+package executor
+
+import (
+	"clawrden/pkg/protocol"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// sweepDocker is a Docker daemon holding some containers. Creating one
+// blocks until release is closed, then fails, so ExecuteGhost stops there.
+type sweepDocker struct {
+	DockerAPI // Unused container calls panic
+
+	mu         sync.Mutex
+	containers []container.Summary
+	created    []map[string]string // Labels of created containers
+	removed    []string
+	listOpts   container.ListOptions
+	creating   chan struct{}
+	release    chan struct{}
+}
+
+func (d *sweepDocker) ContainerList(ctx context.Context, opts container.ListOptions) ([]container.Summary, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.listOpts = opts
+	return slices.Clone(d.containers), nil
+}
+
+func (d *sweepDocker) ContainerRemove(ctx context.Context, id string, opts container.RemoveOptions) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.removed = append(d.removed, id)
+	return nil
+}
+
+func (d *sweepDocker) ContainerCreate(ctx context.Context, cfg *container.Config, host *container.HostConfig, net *network.NetworkingConfig, platform *ocispec.Platform, name string) (container.CreateResponse, error) {
+	d.mu.Lock()
+	d.created = append(d.created, cfg.Labels)
+	d.mu.Unlock()
+	if d.creating != nil {
+		d.creating <- struct{}{}
+		<-d.release
+	}
+	return container.CreateResponse{}, errors.New("fake docker")
+}
+
+func TestGhostContainerLabels(t *testing.T) {
+	docker := &sweepDocker{}
+	de := NewDockerExecutor(docker, log.New(io.Discard, "", 0))
+	de.InstanceID = "warden-a"
+
+	de.ExecuteGhost(context.Background(), &protocol.Request{Command: "npm", RequestID: "req-42"}, nil)
+	want := map[string]string{LabelGhost: "true", LabelRequest: "req-42", LabelOwner: "warden-a"}
+	if len(docker.created) != 1 || !mapsEqual(docker.created[0], want) {
+		t.Errorf("labels = %v, want %v", docker.created, want)
+	}
+}
+
+func mapsEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSweepOrphans(t *testing.T) {
+	old := time.Now().Add(-time.Hour).Unix()
+	docker := &sweepDocker{containers: []container.Summary{
+		{ID: "orphan", Created: old, Labels: map[string]string{LabelRequest: "req-1"}},
+		{ID: "live", Created: old, Labels: map[string]string{LabelRequest: "req-2"}},
+		{ID: "fresh", Created: time.Now().Unix(), Labels: map[string]string{LabelRequest: "req-3"}},
+	}}
+	de := NewDockerExecutor(docker, log.New(io.Discard, "", 0))
+	de.InstanceID = "warden-a"
+	de.registry.live = map[string]string{"live": "req-2"}
+
+	removed, err := de.SweepOrphans(context.Background())
+	if err != nil {
+		t.Fatalf("SweepOrphans: %v", err)
+	}
+	if len(removed) != 1 || removed[0].ContainerID != "orphan" || removed[0].RequestID != "req-1" {
+		t.Errorf("removed = %+v, want only the orphan", removed)
+	}
+	if !slices.Equal(docker.removed, []string{"orphan"}) {
+		t.Errorf("docker removed %v", docker.removed)
+	}
+
+	// Only this warden's ghosts are listed
+	filters := docker.listOpts.Filters
+	if !docker.listOpts.All || !filters.ExactMatch("label", LabelGhost+"=true") || !filters.ExactMatch("label", LabelOwner+"=warden-a") || filters.Len() != 1 {
+		t.Errorf("list options = %+v, want all containers labeled as this warden's ghosts", docker.listOpts)
+	}
+}
+
+func TestMaxGhosts(t *testing.T) {
+	docker := &sweepDocker{creating: make(chan struct{}), release: make(chan struct{})}
+	de := NewDockerExecutor(docker, log.New(io.Discard, "", 0))
+	de.MaxGhosts = 1
+
+	first := make(chan error, 1)
+	go func() {
+		first <- de.ExecuteGhost(context.Background(), &protocol.Request{Command: "npm"}, nil)
+	}()
+	<-docker.creating
+
+	err := de.ExecuteGhost(context.Background(), &protocol.Request{Command: "pip"}, nil)
+	if !errors.Is(err, ErrTooManyGhosts) {
+		t.Errorf("second ghost: err = %v, want ErrTooManyGhosts", err)
+	}
+
+	// The slot frees once the first ghost is gone
+	close(docker.release)
+	<-first
+	docker.creating = nil
+	if err := de.ExecuteGhost(context.Background(), &protocol.Request{Command: "pip"}, nil); errors.Is(err, ErrTooManyGhosts) {
+		t.Errorf("ghost after the first finished: %v", err)
+	}
+}
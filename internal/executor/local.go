@@ -2,6 +2,7 @@ package executor
 
 import (
 	"bufio"
+	"clawrden/internal/faultinject"
 	"clawrden/pkg/protocol"
 	"context"
 	"fmt"
@@ -27,8 +28,6 @@ func NewLocalExecutor(logger *log.Logger) *LocalExecutor {
 
 // Execute runs the command locally and streams output.
 func (le *LocalExecutor) Execute(ctx context.Context, req *protocol.Request, conn net.Conn) error {
-	// Skip strict /app validation for local executor (used in dev/testing)
-	// The server-level check is still enforced
 	le.logger.Printf("local exec: %s %v (cwd=%s)", req.Command, req.Args, req.Cwd)
 
 	// Find the real binary (skip our own shims)
@@ -39,7 +38,16 @@ func (le *LocalExecutor) Execute(ctx context.Context, req *protocol.Request, con
 
 	cmd := exec.CommandContext(ctx, cmdPath, req.Args...)
 	cmd.Dir = req.Cwd
-	cmd.Env = req.Env
+	if req.SandboxDir != "" {
+		cmd.Dir = req.SandboxDir
+	}
+	// No environment means the warden's own, as exec.Cmd would use
+	env := req.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	cmd.Env = markedEnv(env, req, StrategyLocal)
+	cmd.SysProcAttr = prioritySysProcAttr(req.Priority)
 
 	// Set up pipes for stdout and stderr
 	stdout, err := cmd.StdoutPipe()
@@ -55,6 +63,11 @@ func (le *LocalExecutor) Execute(ctx context.Context, req *protocol.Request, con
 	if err := cmd.Start(); err != nil {
 		return fmt.Errorf("start command: %w", err)
 	}
+	if req.Priority != nil {
+		if err := setProcessPriority(cmd.Process.Pid, *req.Priority); err != nil {
+			le.logger.Printf("warning: could not lower the priority of %s: %v", req.Command, err)
+		}
+	}
 
 	// Stream stdout in a goroutine
 	done := make(chan struct{}, 2)
@@ -63,6 +76,9 @@ func (le *LocalExecutor) Execute(ctx context.Context, req *protocol.Request, con
 		scanner := bufio.NewScanner(stdout)
 		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
 		for scanner.Scan() {
+			if faultinject.Check(faultinject.PointExecStream, conn) != nil {
+				continue // Drop the line, but keep draining the pipe
+			}
 			line := append(scanner.Bytes(), '\n')
 			protocol.WriteFrame(conn, protocol.Frame{
 				Type:    protocol.StreamStdout,
@@ -77,6 +93,9 @@ func (le *LocalExecutor) Execute(ctx context.Context, req *protocol.Request, con
 		scanner := bufio.NewScanner(stderr)
 		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
 		for scanner.Scan() {
+			if faultinject.Check(faultinject.PointExecStream, conn) != nil {
+				continue
+			}
 			line := append(scanner.Bytes(), '\n')
 			protocol.WriteFrame(conn, protocol.Frame{
 				Type:    protocol.StreamStderr,
@@ -100,6 +119,15 @@ func (le *LocalExecutor) Execute(ctx context.Context, req *protocol.Request, con
 		}
 	}
 
+	// A command killed for its time limit has no exit code of its own; its
+	// output is delivered, and the caller reports the limit
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := faultinject.Check(faultinject.PointExecExit, conn); err != nil {
+		return err
+	}
 	return protocol.WriteExitCode(conn, exitCode)
 }
 
@@ -1,29 +1,63 @@
 package executor
 
 import (
+	"clawrden/internal/faultinject"
 	"clawrden/pkg/protocol"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
+	"syscall"
+	"time"
 
+	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
 )
 
+// DockerAPI is the part of the Docker client the executor uses, plus Ping
+// for health checks. *client.Client implements it; tests use fakes.
+type DockerAPI interface {
+	client.ContainerAPIClient
+	Ping(ctx context.Context) (types.Ping, error)
+}
+
 // DockerExecutor uses the Docker SDK to execute commands.
 // It supports both Mirror (exec in originating container) and Ghost (ephemeral container) modes.
 // The target container ID is provided per-request via req.ContainerID.
 type DockerExecutor struct {
-	client *client.Client
+	client DockerAPI
 	logger *log.Logger
+
+	// Hardening returns the restrictions for a ghost command's container.
+	// Nil runs ghosts with Docker's defaults.
+	Hardening func(command string) GhostHardening
+
+	// WorkspaceDir is where the warden sees the volume ghosts mount as
+	// /app, if it mounts it too. Snapshots then scan it directly rather
+	// than in a helper container.
+	WorkspaceDir string
+
+	// InstanceID names this warden in the owner label of the containers it
+	// creates; SweepOrphans removes only containers with its own ID, so it
+	// should stay the same across restarts.
+	InstanceID string
+
+	// MaxGhosts caps the ghost containers that may exist at once, however
+	// many requests may run; more are refused with ErrTooManyGhosts.
+	// 0 means no cap.
+	MaxGhosts int
+
+	registry ghostRegistry
 }
 
 // NewDockerExecutor creates a Docker-based executor.
 // The executor does not hold a fixed container ID; it reads the target
 // container from each request's ContainerID field (set by peer credential resolution).
-func NewDockerExecutor(dockerClient *client.Client, logger *log.Logger) *DockerExecutor {
+func NewDockerExecutor(dockerClient DockerAPI, logger *log.Logger) *DockerExecutor {
 	return &DockerExecutor{
 		client: dockerClient,
 		logger: logger,
@@ -34,19 +68,28 @@ func NewDockerExecutor(dockerClient *client.Client, logger *log.Logger) *DockerE
 // For commands requiring external tools, it falls back to Ghost strategy.
 // The target container is identified by req.ContainerID.
 func (de *DockerExecutor) Execute(ctx context.Context, req *protocol.Request, conn net.Conn) error {
-	if err := ValidatePath(req.Cwd); err != nil {
-		return err
-	}
-
 	if req.ContainerID == "" {
 		return fmt.Errorf("no container ID on request (cannot mirror)")
 	}
 
-	// Determine execution strategy
-	if de.shouldUseGhost(req.Command) {
-		return de.executeGhost(ctx, req, conn)
+	if de.UsesGhost(req) {
+		return de.ExecuteGhost(ctx, req, conn)
 	}
-	return de.executeMirror(ctx, req, conn)
+	return de.ExecuteMirror(ctx, req, conn)
+}
+
+// UsesGhost reports whether Execute runs req in a ghost container rather
+// than mirroring it. Sandboxed requests can only run in a ghost.
+func (de *DockerExecutor) UsesGhost(req *protocol.Request) bool {
+	return de.shouldUseGhost(req.Command) || req.SandboxDir != ""
+}
+
+// GhostHardening returns the restrictions applied to command's ghost container.
+func (de *DockerExecutor) GhostHardening(command string) GhostHardening {
+	if de.Hardening == nil {
+		return GhostHardening{}
+	}
+	return de.Hardening(command)
 }
 
 // shouldUseGhost determines if a command needs Ghost (ephemeral container) execution.
@@ -64,8 +107,8 @@ func (de *DockerExecutor) shouldUseGhost(command string) bool {
 	return ghostCommands[command]
 }
 
-// executeMirror runs the command back inside the Prisoner container.
-func (de *DockerExecutor) executeMirror(ctx context.Context, req *protocol.Request, conn net.Conn) error {
+// ExecuteMirror runs the command back inside the Prisoner container.
+func (de *DockerExecutor) ExecuteMirror(ctx context.Context, req *protocol.Request, conn net.Conn) error {
 	de.logger.Printf("mirror exec: %s %v in container %s", req.Command, req.Args, req.ContainerID)
 
 	// Build the full command
@@ -78,28 +121,50 @@ func (de *DockerExecutor) executeMirror(ctx context.Context, req *protocol.Reque
 	execConfig := container.ExecOptions{
 		Cmd:          cmd,
 		WorkingDir:   req.Cwd,
-		Env:          req.Env,
+		Env:          markedEnv(req.Env, req, StrategyMirror),
 		AttachStdout: true,
 		AttachStderr: true,
 		User:         user,
 	}
 
+	// On a terminal, the shim's input and window size are passed through
+	if req.TTY {
+		execConfig.Tty = true
+		execConfig.AttachStdin = req.Terminal != nil
+		if req.WindowSize != nil {
+			execConfig.ConsoleSize = &[2]uint{uint(req.WindowSize.Rows), uint(req.WindowSize.Cols)}
+		}
+	}
+
 	// Create the exec instance
 	execID, err := de.client.ContainerExecCreate(ctx, req.ContainerID, execConfig)
 	if err != nil {
-		return fmt.Errorf("create exec: %w", err)
+		return dockerErr("create exec", err)
 	}
 
 	// Attach to the exec instance
-	resp, err := de.client.ContainerExecAttach(ctx, execID.ID, container.ExecAttachOptions{})
+	resp, err := de.client.ContainerExecAttach(ctx, execID.ID, container.ExecAttachOptions{
+		Tty:         execConfig.Tty,
+		ConsoleSize: execConfig.ConsoleSize,
+	})
 	if err != nil {
-		return fmt.Errorf("attach exec: %w", err)
+		return dockerErr("attach exec", err)
 	}
 	defer resp.Close()
 
+	if execConfig.AttachStdin {
+		done := make(chan struct{})
+		defer close(done)
+		de.forwardTerminal(ctx, execID.ID, req.Terminal, resp, done)
+	}
+
 	// Stream output to the shim
 	streamDone := make(chan error, 1)
 	go func() {
+		if execConfig.Tty {
+			streamDone <- streamTerminalOutput(resp.Reader, conn)
+			return
+		}
 		streamDone <- streamDockerOutput(resp.Reader, conn)
 	}()
 
@@ -110,9 +175,14 @@ func (de *DockerExecutor) executeMirror(ctx context.Context, req *protocol.Reque
 			de.logger.Printf("stream error: %v", err)
 		}
 	case <-ctx.Done():
+		drainStream(streamDone, resp.Close)
 		return ctx.Err()
 	}
 
+	if err := faultinject.Check(faultinject.PointExecExit, conn); err != nil {
+		return err
+	}
+
 	// Get the exit code
 	inspect, err := de.client.ContainerExecInspect(ctx, execID.ID)
 	if err != nil {
@@ -123,8 +193,11 @@ func (de *DockerExecutor) executeMirror(ctx context.Context, req *protocol.Reque
 	return protocol.WriteExitCode(conn, inspect.ExitCode)
 }
 
-// executeGhost runs the command in an ephemeral container.
-func (de *DockerExecutor) executeGhost(ctx context.Context, req *protocol.Request, conn net.Conn) error {
+// sandboxMountPoint is where a sandbox directory is mounted inside a ghost container.
+const sandboxMountPoint = "/sandbox"
+
+// ExecuteGhost runs the command in an ephemeral container.
+func (de *DockerExecutor) ExecuteGhost(ctx context.Context, req *protocol.Request, conn net.Conn) error {
 	de.logger.Printf("ghost exec: %s %v", req.Command, req.Args)
 
 	// Determine the image to use
@@ -138,26 +211,36 @@ func (de *DockerExecutor) executeGhost(ctx context.Context, req *protocol.Reques
 		Image:      image,
 		Cmd:        cmd,
 		WorkingDir: req.Cwd,
-		Env:        req.Env,
+		Env:        markedEnv(req.Env, req, StrategyGhost),
+	}
+
+	if req.SandboxDir != "" {
+		containerConfig.WorkingDir = sandboxMountPoint
 	}
 
-	hostConfig := &container.HostConfig{
-		Binds: []string{
-			// Mount the shared /app volume
-			"clawrden_app-data:/app",
-		},
+	hardening := de.GhostHardening(req.Command)
+	var seccomp []byte
+	if hardening.SeccompProfile != "" {
+		var err error
+		if seccomp, err = os.ReadFile(hardening.SeccompProfile); err != nil {
+			return fmt.Errorf("read seccomp profile: %w", err)
+		}
 	}
+	hostConfig := ghostHostConfig(req, hardening, seccomp)
 
-	resp, err := de.client.ContainerCreate(ctx, containerConfig, hostConfig, nil, nil, "")
+	release, err := de.reserveGhost()
 	if err != nil {
-		return fmt.Errorf("create ghost container: %w", err)
+		return err
+	}
+	defer release()
+
+	resp, err := de.createContainer(ctx, containerConfig, hostConfig, req.RequestID)
+	if err != nil {
+		return dockerErr("create ghost container", err)
 	}
 
 	// Ensure cleanup
-	defer func() {
-		removeCtx := context.Background()
-		de.client.ContainerRemove(removeCtx, resp.ID, container.RemoveOptions{Force: true})
-	}()
+	defer de.removeContainer(resp.ID)
 
 	// Attach to the container before starting
 	attachResp, err := de.client.ContainerAttach(ctx, resp.ID, container.AttachOptions{
@@ -166,13 +249,13 @@ func (de *DockerExecutor) executeGhost(ctx context.Context, req *protocol.Reques
 		Stderr: true,
 	})
 	if err != nil {
-		return fmt.Errorf("attach ghost container: %w", err)
+		return dockerErr("attach ghost container", err)
 	}
 	defer attachResp.Close()
 
 	// Start the container
 	if err := de.client.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
-		return fmt.Errorf("start ghost container: %w", err)
+		return dockerErr("start ghost container", err)
 	}
 
 	// Stream output
@@ -185,26 +268,61 @@ func (de *DockerExecutor) executeGhost(ctx context.Context, req *protocol.Reques
 	statusCh, errCh := de.client.ContainerWait(ctx, resp.ID, container.WaitConditionNotRunning)
 	select {
 	case err := <-errCh:
+		if ctx.Err() != nil {
+			// The wait was cancelled with the context
+			de.client.ContainerKill(context.Background(), resp.ID, "SIGKILL")
+			drainStream(streamDone, attachResp.Close)
+			return ctx.Err()
+		}
 		if err != nil {
-			return fmt.Errorf("wait ghost container: %w", err)
+			return dockerErr("wait ghost container", err)
 		}
 	case status := <-statusCh:
 		// Wait for streaming to complete
 		<-streamDone
 
-		// Fix file ownership (chown back to agent's UID/GID)
-		de.fixOwnership(ctx, req)
-
+		if err := faultinject.Check(faultinject.PointExecExit, conn); err != nil {
+			return err
+		}
+		if status.StatusCode == oomExitCode && de.oomKilled(resp.ID) {
+			return &TransientError{Reason: "ghost container was OOM-killed", ExitCode: oomExitCode}
+		}
 		return protocol.WriteExitCode(conn, int(status.StatusCode))
 	case <-ctx.Done():
 		// Kill the container on cancellation
 		de.client.ContainerKill(context.Background(), resp.ID, "SIGKILL")
+		drainStream(streamDone, attachResp.Close)
 		return ctx.Err()
 	}
 
 	return nil
 }
 
+// oomExitCode is the exit code of a process killed with SIGKILL (128 + 9),
+// as the kernel's OOM killer does.
+const oomExitCode = 137
+
+// oomKilled reports whether Docker says the OOM killer ended container id.
+func (de *DockerExecutor) oomKilled(id string) bool {
+	inspect, err := de.client.ContainerInspect(context.Background(), id)
+	if err != nil {
+		de.logger.Printf("warning: inspect killed ghost container: %v", err)
+		return false
+	}
+	return inspect.State != nil && inspect.State.OOMKilled
+}
+
+// dockerErr wraps the error of Docker API call op, as a *TransientError if
+// the connection to the daemon was lost, as when it restarts.
+func dockerErr(op string, err error) error {
+	err = fmt.Errorf("%s: %w", op, err)
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || client.IsErrConnectionFailed(err) {
+		return &TransientError{Reason: "lost the connection to the Docker daemon", Err: err}
+	}
+	return err
+}
+
 // ghostImage returns the Docker image to use for a given command.
 func (de *DockerExecutor) ghostImage(command string) string {
 	images := map[string]string{
@@ -222,25 +340,64 @@ func (de *DockerExecutor) ghostImage(command string) string {
 	return "alpine:latest"
 }
 
-// fixOwnership runs chown on /app to fix file ownership after ghost execution.
-func (de *DockerExecutor) fixOwnership(ctx context.Context, req *protocol.Request) {
-	cmd := []string{"chown", "-R",
-		fmt.Sprintf("%d:%d", req.Identity.UID, req.Identity.GID),
-		"/app",
-	}
+// drainGrace bounds how long the output of a cancelled command may keep
+// arriving before its stream is cut.
+const drainGrace = 2 * time.Second
 
-	execConfig := container.ExecOptions{
-		Cmd: cmd,
+// drainStream waits for the output stream of a cancelled command to end,
+// closing it after drainGrace, so output written before the cancellation
+// reaches the shim ahead of whatever the caller writes next.
+func drainStream(streamDone <-chan error, closeStream func()) {
+	select {
+	case <-streamDone:
+	case <-time.After(drainGrace):
+		closeStream()
+		<-streamDone
 	}
+}
 
-	execID, err := de.client.ContainerExecCreate(ctx, req.ContainerID, execConfig)
-	if err != nil {
-		de.logger.Printf("chown exec create error: %v", err)
-		return
-	}
+// forwardTerminal copies the shim's input to the exec attached as resp,
+// closing its stdin when the input ends, and resizes the exec's terminal
+// when the shim's window is, until done is closed.
+func (de *DockerExecutor) forwardTerminal(ctx context.Context, execID string, in *protocol.TerminalInput, resp types.HijackedResponse, done <-chan struct{}) {
+	go func() {
+		if _, err := io.Copy(resp.Conn, in.Stdin); err != nil {
+			return // The exec has ended
+		}
+		resp.CloseWrite()
+	}()
+	go func() {
+		for {
+			select {
+			case size := <-in.Resize:
+				err := de.client.ContainerExecResize(ctx, execID, container.ResizeOptions{Height: uint(size.Rows), Width: uint(size.Cols)})
+				if err != nil {
+					de.logger.Printf("exec resize error: %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+}
 
-	if err := de.client.ContainerExecStart(ctx, execID.ID, container.ExecStartOptions{}); err != nil {
-		de.logger.Printf("chown exec start error: %v", err)
+// streamTerminalOutput writes the output of an exec run on a terminal,
+// which Docker does not multiplex, as stdout frames.
+func streamTerminalOutput(reader io.Reader, conn net.Conn) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := reader.Read(buf)
+		if n > 0 {
+			if faultinject.Check(faultinject.PointExecStream, conn) != nil {
+				return nil // As if the attach stream ended here
+			}
+			if err := protocol.WriteFrame(conn, protocol.Frame{Type: protocol.StreamStdout, Payload: buf[:n]}); err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			return nil // EOF is normal
+		}
 	}
 }
 
@@ -255,6 +412,9 @@ func streamDockerOutput(reader interface{ Read([]byte) (int, error) }, conn net.
 		if err != nil {
 			return nil // EOF is normal
 		}
+		if faultinject.Check(faultinject.PointExecStream, conn) != nil {
+			return nil // As if the attach stream ended here
+		}
 
 		// Docker stream types: 0=stdin, 1=stdout, 2=stderr
 		streamType := header[0]
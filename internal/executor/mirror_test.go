@@ -0,0 +1,212 @@
+package executor
+
+import (
+	"bufio"
+	"clawrden/pkg/protocol"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// exitDocker runs ghost containers that print nothing and exit with code,
+// OOM-killed if oom is set. Mirrored execs fail with execErr.
+type exitDocker struct {
+	DockerAPI // Unused container calls panic
+
+	code    int64
+	oom     bool
+	execErr error
+}
+
+func (d *exitDocker) ContainerCreate(ctx context.Context, cfg *container.Config, host *container.HostConfig, net *network.NetworkingConfig, platform *ocispec.Platform, name string) (container.CreateResponse, error) {
+	return container.CreateResponse{ID: "ghost"}, nil
+}
+
+func (d *exitDocker) ContainerAttach(ctx context.Context, id string, opts container.AttachOptions) (types.HijackedResponse, error) {
+	conn, _ := net.Pipe()
+	return types.HijackedResponse{Conn: conn, Reader: bufio.NewReader(strings.NewReader(""))}, nil
+}
+
+func (d *exitDocker) ContainerStart(ctx context.Context, id string, opts container.StartOptions) error {
+	return nil
+}
+
+func (d *exitDocker) ContainerWait(ctx context.Context, id string, cond container.WaitCondition) (<-chan container.WaitResponse, <-chan error) {
+	status := make(chan container.WaitResponse, 1)
+	status <- container.WaitResponse{StatusCode: d.code}
+	return status, make(chan error)
+}
+
+func (d *exitDocker) ContainerInspect(ctx context.Context, id string) (container.InspectResponse, error) {
+	return container.InspectResponse{ContainerJSONBase: &container.ContainerJSONBase{State: &container.State{OOMKilled: d.oom}}}, nil
+}
+
+func (d *exitDocker) ContainerRemove(ctx context.Context, id string, opts container.RemoveOptions) error {
+	return nil
+}
+
+func (d *exitDocker) ContainerExecCreate(ctx context.Context, id string, opts container.ExecOptions) (container.ExecCreateResponse, error) {
+	return container.ExecCreateResponse{}, d.execErr
+}
+
+func TestTransientExecutionErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		docker    *exitDocker
+		ghost     bool
+		transient bool
+		exitCode  int // Of the exit frame, if not transient
+	}{
+		{"OOM-killed ghost", &exitDocker{code: 137, oom: true}, true, true, 0},
+		{"killed ghost", &exitDocker{code: 137}, true, false, 137},
+		{"failed ghost", &exitDocker{code: 1}, true, false, 1},
+		{"daemon restarting", &exitDocker{execErr: fmt.Errorf("request: %w", syscall.ECONNRESET)}, false, true, 0},
+		{"other exec error", &exitDocker{execErr: errors.New("no such container")}, false, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			de := NewDockerExecutor(tt.docker, log.New(io.Discard, "", 0))
+			client, server := net.Pipe()
+			frames := make(chan []protocol.Frame, 1)
+			go func() {
+				var got []protocol.Frame
+				for {
+					f, err := protocol.ReadFrame(client)
+					if err != nil {
+						frames <- got
+						return
+					}
+					got = append(got, f)
+				}
+			}()
+
+			req := &protocol.Request{Command: "ls", Cwd: "/app", ContainerID: "0123456789ab"}
+			var err error
+			if tt.ghost {
+				err = de.ExecuteGhost(context.Background(), req, server)
+			} else {
+				err = de.ExecuteMirror(context.Background(), req, server)
+			}
+			server.Close()
+			sent := <-frames
+
+			var transient *TransientError
+			if errors.As(err, &transient) != tt.transient {
+				t.Fatalf("err = %v, transient %v", err, tt.transient)
+			}
+			if tt.transient && len(sent) != 0 {
+				t.Errorf("transient failure sent frames %+v", sent)
+			}
+			if tt.docker.oom && transient.ExitCode != 137 {
+				t.Errorf("OOM exit code = %d, want 137", transient.ExitCode)
+			}
+			if tt.exitCode != 0 && (len(sent) != 1 || sent[0].Type != protocol.StreamExit || protocol.ParseExitCode(sent[0]) != tt.exitCode) {
+				t.Errorf("frames = %+v, want exit %d", sent, tt.exitCode)
+			}
+		})
+	}
+}
+
+// ttyDocker mirrors execs on a fake terminal: the command prints a prompt
+// and echoes the line typed at it.
+type ttyDocker struct {
+	DockerAPI // Unused container calls panic
+
+	exec    container.ExecOptions
+	attach  container.ExecAttachOptions
+	resized chan container.ResizeOptions
+}
+
+func (d *ttyDocker) ContainerExecCreate(ctx context.Context, id string, opts container.ExecOptions) (container.ExecCreateResponse, error) {
+	d.exec = opts
+	return container.ExecCreateResponse{ID: "exec"}, nil
+}
+
+func (d *ttyDocker) ContainerExecAttach(ctx context.Context, id string, opts container.ExecAttachOptions) (types.HijackedResponse, error) {
+	d.attach = opts
+	conn, command := net.Pipe()
+	go func() {
+		defer command.Close()
+		command.Write([]byte("Password: "))
+		line, _ := bufio.NewReader(command).ReadString('\r')
+		command.Write([]byte(line + "\n"))
+	}()
+	return types.HijackedResponse{Conn: conn, Reader: bufio.NewReader(conn)}, nil
+}
+
+func (d *ttyDocker) ContainerExecResize(ctx context.Context, id string, opts container.ResizeOptions) error {
+	d.resized <- opts
+	return nil
+}
+
+func (d *ttyDocker) ContainerExecInspect(ctx context.Context, id string) (container.ExecInspect, error) {
+	return container.ExecInspect{ExitCode: 0}, nil
+}
+
+func TestMirrorOnTerminal(t *testing.T) {
+	docker := &ttyDocker{resized: make(chan container.ResizeOptions, 1)}
+	de := NewDockerExecutor(docker, log.New(io.Discard, "", 0))
+	stdin, typing := io.Pipe()
+	resize := make(chan protocol.WindowSize, 1)
+	req := &protocol.Request{
+		Command: "passwd", Cwd: "/", ContainerID: "0123456789ab",
+		TTY: true, WindowSize: &protocol.WindowSize{Rows: 24, Cols: 80},
+		Terminal: &protocol.TerminalInput{Stdin: stdin, Resize: resize},
+	}
+
+	client, server := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- de.ExecuteMirror(context.Background(), req, server)
+		server.Close()
+	}()
+
+	var screen strings.Builder
+	readUntil := func(typ byte) {
+		t.Helper()
+		for {
+			f, err := protocol.ReadFrame(client)
+			if err != nil {
+				t.Fatalf("read frame: %v (screen %q)", err, screen.String())
+			}
+			if f.Type == typ {
+				return
+			}
+			if f.Type != protocol.StreamStdout {
+				t.Fatalf("frame type %d on a terminal, want stdout", f.Type)
+			}
+			screen.Write(f.Payload)
+		}
+	}
+
+	resize <- protocol.WindowSize{Rows: 40, Cols: 120}
+	if got := <-docker.resized; got != (container.ResizeOptions{Height: 40, Width: 120}) {
+		t.Errorf("resized to %+v, want 40x120", got)
+	}
+	go typing.Write([]byte("hunter2\r"))
+	readUntil(protocol.StreamExit)
+	if err := <-done; err != nil {
+		t.Fatalf("ExecuteMirror: %v", err)
+	}
+
+	if got, want := screen.String(), "Password: hunter2\r\n"; got != want {
+		t.Errorf("screen = %q, want %q", got, want)
+	}
+	if !docker.exec.Tty || !docker.exec.AttachStdin || docker.exec.ConsoleSize == nil || *docker.exec.ConsoleSize != [2]uint{24, 80} {
+		t.Errorf("exec options %+v, want a 24x80 terminal with stdin", docker.exec)
+	}
+	if !docker.attach.Tty {
+		t.Errorf("attach options %+v, want a terminal", docker.attach)
+	}
+}
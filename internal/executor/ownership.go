@@ -0,0 +1,188 @@
+package executor
+
+import (
+	"bytes"
+	"clawrden/pkg/protocol"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// OwnershipFix is which workspace files are given back to the requester
+// after a ghost command, which writes them as the ghost's user, usually
+// root.
+type OwnershipFix string
+
+const (
+	OwnershipFixNone    OwnershipFix = "none"
+	OwnershipFixChanged OwnershipFix = "changed" // Files created or changed while the command ran
+	OwnershipFixAll     OwnershipFix = "all"     // Everything under /app
+)
+
+// Valid reports whether f is a known setting; empty means the default.
+func (f OwnershipFix) Valid() bool {
+	switch f {
+	case "", OwnershipFixNone, OwnershipFixChanged, OwnershipFixAll:
+		return true
+	}
+	return false
+}
+
+// OwnershipFixed is what an ownership fix did.
+type OwnershipFixed struct {
+	Mode  OwnershipFix `json:"mode"`
+	Files int          `json:"files"`           // Files, directories and symlinks given to the requester
+	Error string       `json:"error,omitempty"` // The fix failed, perhaps part way
+}
+
+// ownershipImage runs the helper container that fixes ownership in the
+// /app volume when the warden cannot see it directly. Unlike a prisoner or
+// ghost image, busybox is sure to have chown.
+const ownershipImage = "busybox:latest"
+
+// ownershipScript gives the entries under /app whose ctime is at or after
+// a Unix time (0 for all) to uid:gid, skipping those it already owns, and
+// prints how many it changed. Ctimes rather than mtimes are compared, as
+// archives unpack files with old mtimes. Paths with newlines are not
+// supported.
+const ownershipScript = `cd /app && find . -xdev -mindepth 1 -exec stat -c '%%Z %%u %%g %%n' {} + | {
+  n=0
+  while read -r t u g f; do
+    [ "$t" -ge %d ] || continue
+    [ "$u:$g" = "%[2]d:%[3]d" ] && continue
+    chown -h %[2]d:%[3]d "$f" && n=$((n+1))
+  done
+  echo "$n"
+}`
+
+// FixOwnership gives the workspace files fix selects to the requester's
+// uid and gid, and returns how many it changed. since is when the ghost
+// command started; "changed" selects the files changed from then on. A
+// workspace mounted on the warden at WorkspaceDir is fixed directly;
+// otherwise a helper container fixes the volume.
+func (de *DockerExecutor) FixOwnership(ctx context.Context, req *protocol.Request, fix OwnershipFix, since time.Time) (int, error) {
+	switch fix {
+	case OwnershipFixNone:
+		return 0, nil
+	case OwnershipFixAll:
+		since = time.Time{}
+	}
+	if de.WorkspaceDir != "" {
+		return FixOwnershipIn(de.WorkspaceDir, req.Identity.UID, req.Identity.GID, since)
+	}
+	return de.fixOwnershipInHelper(ctx, req, since)
+}
+
+// FixOwnershipIn gives the entries under root changed at or after since
+// (all of them if since is zero) to uid:gid, and returns how many it
+// changed. root itself is left alone, as are symlinks' targets.
+func FixOwnershipIn(root string, uid, gid int, since time.Time) (int, error) {
+	fixed := 0
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil // Removed by a concurrent command
+			}
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		st, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return fmt.Errorf("%s: no owner information", path)
+		}
+		if !since.IsZero() && time.Unix(st.Ctim.Unix()).Before(since) {
+			return nil
+		}
+		if int(st.Uid) == uid && int(st.Gid) == gid {
+			return nil
+		}
+		if err := os.Lchown(path, uid, gid); err != nil {
+			return err
+		}
+		fixed++
+		return nil
+	})
+	return fixed, err
+}
+
+// fixOwnershipInHelper fixes ownership in the /app volume in a throwaway
+// container that mounts it. The helper sees ctimes in whole seconds, so
+// files changed in the second before since are fixed too.
+func (de *DockerExecutor) fixOwnershipInHelper(ctx context.Context, req *protocol.Request, since time.Time) (int, error) {
+	var from int64
+	if !since.IsZero() {
+		from = since.Unix()
+	}
+	containerConfig := &container.Config{
+		Image: ownershipImage,
+		Cmd:   []string{"sh", "-c", fmt.Sprintf(ownershipScript, from, req.Identity.UID, req.Identity.GID)},
+	}
+	hostConfig := &container.HostConfig{
+		Binds:       []string{ghostAppVolume + ":/app"},
+		NetworkMode: "none",
+	}
+	resp, err := de.createContainer(ctx, containerConfig, hostConfig, req.RequestID)
+	if err != nil {
+		return 0, fmt.Errorf("create ownership container: %w", err)
+	}
+	defer de.removeContainer(resp.ID)
+
+	if err := de.client.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		return 0, fmt.Errorf("start ownership container: %w", err)
+	}
+	statusCh, errCh := de.client.ContainerWait(ctx, resp.ID, container.WaitConditionNotRunning)
+	var exitCode int64
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return 0, fmt.Errorf("wait ownership container: %w", err)
+		}
+	case status := <-statusCh:
+		exitCode = status.StatusCode
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+
+	logs, err := de.client.ContainerLogs(ctx, resp.ID, container.LogsOptions{ShowStdout: true, ShowStderr: true})
+	if err != nil {
+		return 0, fmt.Errorf("read ownership fix: %w", err)
+	}
+	defer logs.Close()
+	var stdout, stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(&stdout, &stderr, io.LimitReader(logs, 1<<20)); err != nil {
+		return 0, fmt.Errorf("read ownership fix: %w", err)
+	}
+	fixed, err := strconv.Atoi(strings.TrimSpace(stdout.String()))
+	if err != nil {
+		return 0, fmt.Errorf("ownership container exited with %d: %s", exitCode, strings.TrimSpace(stderr.String()))
+	}
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		return fixed, fmt.Errorf("some files not fixed: %s", firstLine(msg))
+	}
+	return fixed, nil
+}
+
+// firstLine returns s up to its first newline.
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
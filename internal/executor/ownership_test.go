@@ -0,0 +1,94 @@
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func owner(t *testing.T, path string) [2]int {
+	t.Helper()
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := info.Sys().(*syscall.Stat_t)
+	return [2]int{int(st.Uid), int(st.Gid)}
+}
+
+func TestFixOwnershipIn(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing file owners needs root")
+	}
+	other, requester := [2]int{1234, 1234}, [2]int{2000, 2001}
+
+	root := t.TempDir()
+	for _, name := range []string{"README.md", "src/main.go", "src"} {
+		path := filepath.Join(root, name)
+		if name != "src" {
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.Lchown(path, other[0], other[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The ghost command starts, then writes node_modules and a new file in src
+	time.Sleep(20 * time.Millisecond) // File times are coarser than time.Now
+	since := time.Now()
+	time.Sleep(20 * time.Millisecond)
+	written := []string{"node_modules", "node_modules/left-pad", "node_modules/left-pad/index.js", "src/generated.go"}
+	if err := os.MkdirAll(filepath.Join(root, "node_modules/left-pad"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"node_modules/left-pad/index.js", "src/generated.go"} {
+		if err := os.WriteFile(filepath.Join(root, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Unpacked from an archive with its original time
+	old := time.Date(1985, 10, 26, 8, 15, 0, 0, time.UTC)
+	os.Chtimes(filepath.Join(root, "node_modules/left-pad/index.js"), old, old)
+
+	fixed, err := FixOwnershipIn(root, requester[0], requester[1], since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// src's ctime changed with its new file; its contents did not
+	if fixed != len(written)+1 {
+		t.Errorf("fixed %d entries, want %d", fixed, len(written)+1)
+	}
+	for _, name := range append(written, "src") {
+		if got := owner(t, filepath.Join(root, name)); got != requester {
+			t.Errorf("%s owned by %v, want the requester", name, got)
+		}
+	}
+	for _, name := range []string{"README.md", "src/main.go"} {
+		if got := owner(t, filepath.Join(root, name)); got != other {
+			t.Errorf("%s owned by %v, want its owner kept", name, got)
+		}
+	}
+	if got := owner(t, root); got == requester {
+		t.Error("workspace root changed owner")
+	}
+
+	// Nothing left to fix
+	if fixed, err := FixOwnershipIn(root, requester[0], requester[1], since); err != nil || fixed != 0 {
+		t.Errorf("second fix = %d, %v; want 0", fixed, err)
+	}
+
+	// "all" takes everything
+	if fixed, err := FixOwnershipIn(root, requester[0], requester[1], time.Time{}); err != nil || fixed != 2 {
+		t.Errorf("fix all = %d, %v; want the 2 older files", fixed, err)
+	}
+	if got := owner(t, filepath.Join(root, "README.md")); got != requester {
+		t.Errorf("README.md owned by %v after fixing all", got)
+	}
+}
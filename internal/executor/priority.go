@@ -0,0 +1,137 @@
+package executor
+
+import (
+	"clawrden/pkg/protocol"
+	"fmt"
+	"math"
+	"syscall"
+)
+
+// Bounds of a Priority. Only lowering is supported: a negative nice or the
+// realtime IO class would need privileges and starve everyone else.
+const (
+	MaxNice    = 19
+	MaxIOLevel = 7
+)
+
+// ioprio_set(2) constants, which the syscall package lacks.
+const (
+	ioprioWhoPgrp    = 2
+	ioprioClassShift = 13
+	ioprioClassBE    = 2
+	ioprioClassIdle  = 3
+)
+
+// ClampPriority returns p within the supported bounds: nice between 0 and
+// MaxNice, a known IO class, and an IO level between 0 and MaxIOLevel. An
+// unknown IO class leaves IO priority as it is.
+func ClampPriority(p protocol.Priority) protocol.Priority {
+	p.Nice = min(max(p.Nice, 0), MaxNice)
+	switch p.IOClass {
+	case protocol.IOClassBestEffort:
+		p.IOLevel = min(max(p.IOLevel, 0), MaxIOLevel)
+	case protocol.IOClassIdle:
+		p.IOLevel = 0 // The idle class has no levels
+	default:
+		p.IOClass, p.IOLevel = "", 0
+	}
+	return p
+}
+
+// AppliedPriority is what an execution made of its request's Priority, for
+// the audit log: the nice value and IO class and level of a local command,
+// or the CPU shares and blkio weight of a ghost container.
+type AppliedPriority struct {
+	Nice        int    `json:"nice,omitempty"`
+	IOClass     string `json:"ionice_class,omitempty"`
+	IOLevel     *int   `json:"ionice_level,omitempty"`
+	CPUShares   int64  `json:"cpu_shares,omitempty"`
+	BlkioWeight uint16 `json:"blkio_weight,omitempty"`
+}
+
+// PriorityFor returns what strategy applies of p, or nil if it applies
+// nothing: mirrored commands run in a container the warden did not start,
+// whose priority it leaves alone.
+func PriorityFor(p *protocol.Priority, strategy Strategy) *AppliedPriority {
+	if p == nil {
+		return nil
+	}
+	clamped := ClampPriority(*p)
+	switch strategy {
+	case StrategyLocal:
+		applied := &AppliedPriority{Nice: clamped.Nice, IOClass: clamped.IOClass}
+		if clamped.IOClass == protocol.IOClassBestEffort {
+			applied.IOLevel = &clamped.IOLevel
+		}
+		if *applied == (AppliedPriority{}) {
+			return nil
+		}
+		return applied
+	case StrategyGhost:
+		shares, weight := ghostPriority(clamped)
+		if shares == 0 && weight == 0 {
+			return nil
+		}
+		return &AppliedPriority{CPUShares: shares, BlkioWeight: weight}
+	}
+	return nil
+}
+
+// ghostPriority converts p to the closest container equivalents: CPU
+// shares scaled from Docker's default of 1024 as the kernel scales a
+// task's weight per nice level, and a blkio weight of 100 per best-effort
+// level below 8 (the idle class gets the minimum, 10). 0 leaves either at
+// Docker's default.
+func ghostPriority(p protocol.Priority) (cpuShares int64, blkioWeight uint16) {
+	if p.Nice > 0 {
+		cpuShares = max(int64(1024/math.Pow(1.25, float64(p.Nice))), 2)
+	}
+	switch p.IOClass {
+	case protocol.IOClassBestEffort:
+		blkioWeight = uint16(100 * (8 - p.IOLevel))
+	case protocol.IOClassIdle:
+		blkioWeight = 10
+	}
+	return cpuShares, blkioWeight
+}
+
+// prioritySysProcAttr returns the process attributes of a local command
+// run with priority p: its own process group, so that setProcessPriority
+// reaches every process it has started by then, and every later one
+// inherits the priority. It returns nil when p is nil.
+func prioritySysProcAttr(p *protocol.Priority) *syscall.SysProcAttr {
+	if p == nil {
+		return nil
+	}
+	return &syscall.SysProcAttr{Setpgid: true}
+}
+
+// ioprio encodes p's IO class and level for ioprio_set(2); 0 leaves IO
+// priority as it is.
+func ioprio(p protocol.Priority) uintptr {
+	switch p.IOClass {
+	case protocol.IOClassBestEffort:
+		return ioprioClassBE<<ioprioClassShift | uintptr(p.IOLevel)
+	case protocol.IOClassIdle:
+		return ioprioClassIdle << ioprioClassShift
+	}
+	return 0
+}
+
+// setProcessPriority lowers the priority of the process group pgid to p.
+// Raising it again (a nice value below the warden's own) fails without
+// CAP_SYS_NICE.
+func setProcessPriority(pgid int, p protocol.Priority) error {
+	p = ClampPriority(p)
+	if p.Nice > 0 {
+		if err := syscall.Setpriority(syscall.PRIO_PGRP, pgid, p.Nice); err != nil {
+			return fmt.Errorf("set nice %d: %w", p.Nice, err)
+		}
+	}
+	if prio := ioprio(p); prio != 0 {
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoPgrp, uintptr(pgid), prio); errno != 0 {
+			return fmt.Errorf("set IO priority %s/%d: %w", p.IOClass, p.IOLevel, errno)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package executor
+
+import (
+	"bytes"
+	"clawrden/pkg/protocol"
+	"context"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestClampPriority(t *testing.T) {
+	tests := []struct {
+		in, want protocol.Priority
+	}{
+		{protocol.Priority{}, protocol.Priority{}},
+		{protocol.Priority{Nice: 10, IOClass: protocol.IOClassBestEffort, IOLevel: 6}, protocol.Priority{Nice: 10, IOClass: protocol.IOClassBestEffort, IOLevel: 6}},
+		{protocol.Priority{Nice: -5}, protocol.Priority{}},
+		{protocol.Priority{Nice: 40, IOClass: protocol.IOClassBestEffort, IOLevel: 9}, protocol.Priority{Nice: 19, IOClass: protocol.IOClassBestEffort, IOLevel: 7}},
+		{protocol.Priority{IOClass: protocol.IOClassBestEffort, IOLevel: -1}, protocol.Priority{IOClass: protocol.IOClassBestEffort}},
+		{protocol.Priority{IOClass: protocol.IOClassIdle, IOLevel: 3}, protocol.Priority{IOClass: protocol.IOClassIdle}},
+		{protocol.Priority{Nice: 5, IOClass: "realtime", IOLevel: 0}, protocol.Priority{Nice: 5}},
+	}
+	for _, tt := range tests {
+		if got := ClampPriority(tt.in); got != tt.want {
+			t.Errorf("ClampPriority(%+v) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestGhostHostConfigPriority(t *testing.T) {
+	tests := []struct {
+		priority    *protocol.Priority
+		cpuShares   int64
+		blkioWeight uint16
+	}{
+		{nil, 0, 0},
+		{&protocol.Priority{Nice: 10}, 109, 0},
+		{&protocol.Priority{Nice: 19}, 14, 0},
+		{&protocol.Priority{Nice: 99}, 14, 0},
+		{&protocol.Priority{IOClass: protocol.IOClassBestEffort, IOLevel: 4}, 0, 400},
+		{&protocol.Priority{IOClass: protocol.IOClassBestEffort, IOLevel: 0}, 0, 800},
+		{&protocol.Priority{Nice: 5, IOClass: protocol.IOClassIdle}, 335, 10},
+	}
+	for _, tt := range tests {
+		got := ghostHostConfig(&protocol.Request{Command: "webpack", Priority: tt.priority}, GhostHardening{}, nil)
+		if got.CPUShares != tt.cpuShares || got.BlkioWeight != tt.blkioWeight {
+			t.Errorf("priority %+v: CPUShares %d, BlkioWeight %d; want %d, %d", tt.priority, got.CPUShares, got.BlkioWeight, tt.cpuShares, tt.blkioWeight)
+		}
+	}
+}
+
+func TestPriorityFor(t *testing.T) {
+	p := &protocol.Priority{Nice: 25, IOClass: protocol.IOClassBestEffort, IOLevel: 2}
+	if got := PriorityFor(p, StrategyLocal); got == nil || got.Nice != 19 || got.IOClass != protocol.IOClassBestEffort || got.IOLevel == nil || *got.IOLevel != 2 || got.CPUShares != 0 {
+		t.Errorf("local = %+v, want nice 19 and best-effort level 2", got)
+	}
+	if got := PriorityFor(p, StrategyGhost); got == nil || got.CPUShares != 14 || got.BlkioWeight != 600 || got.Nice != 0 {
+		t.Errorf("ghost = %+v, want 14 CPU shares and blkio weight 600", got)
+	}
+	if got := PriorityFor(p, StrategyMirror); got != nil {
+		t.Errorf("mirror = %+v, want nothing applied", got)
+	}
+	if got := PriorityFor(&protocol.Priority{IOClass: "realtime"}, StrategyLocal); got != nil {
+		t.Errorf("realtime = %+v, want nothing applied", got)
+	}
+}
+
+func TestPrioritySysProcAttr(t *testing.T) {
+	if attr := prioritySysProcAttr(nil); attr != nil {
+		t.Errorf("no priority: %+v, want nil", attr)
+	}
+	if attr := prioritySysProcAttr(&protocol.Priority{Nice: 10}); attr == nil || !attr.Setpgid {
+		t.Errorf("priority: %+v, want a process group of its own", attr)
+	}
+
+	for _, tt := range []struct {
+		p    protocol.Priority
+		want uintptr
+	}{
+		{protocol.Priority{Nice: 10}, 0},
+		{protocol.Priority{IOClass: protocol.IOClassBestEffort, IOLevel: 7}, 2<<13 | 7},
+		{protocol.Priority{IOClass: protocol.IOClassIdle}, 3 << 13},
+	} {
+		if got := ioprio(tt.p); got != tt.want {
+			t.Errorf("ioprio(%+v) = %#x, want %#x", tt.p, got, tt.want)
+		}
+	}
+}
+
+// Lowering the priority of one's own processes needs no privileges.
+func TestLocalExecutorLowersNice(t *testing.T) {
+	base, err := syscall.Getpriority(syscall.PRIO_PROCESS, 0)
+	if err != nil {
+		t.Skipf("getpriority: %v", err)
+	}
+	if 20-base >= 15 { // The raw syscall returns 20 - nice
+		t.Skip("already running at nice 15 or above")
+	}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	le := NewLocalExecutor(log.New(io.Discard, "", 0))
+	req := &protocol.Request{
+		Command:  "sh",
+		Args:     []string{"-c", "sleep 0.2; cut -d' ' -f19 /proc/self/stat"},
+		Cwd:      t.TempDir(),
+		Priority: &protocol.Priority{Nice: 15},
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- le.Execute(context.Background(), req, server)
+		server.Close()
+	}()
+
+	var stdout bytes.Buffer
+	for {
+		f, err := protocol.ReadFrame(client)
+		if err != nil {
+			break
+		}
+		if f.Type == protocol.StreamStdout {
+			stdout.Write(f.Payload)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	// cut starts after the priority was lowered, and inherits it
+	if got := strings.TrimSpace(stdout.String()); got != "15" {
+		t.Errorf("nice = %q, want 15", got)
+	}
+}
@@ -0,0 +1,204 @@
+package executor
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// Sandbox is a scratch working directory used instead of the real workspace.
+// Files are copied in from Source before execution and, optionally,
+// copied back out after execution. Symlinks are never followed or copied.
+type Sandbox struct {
+	Dir    string // Scratch directory the command runs in
+	Source string // Real working directory the sandbox was seeded from
+}
+
+// NewSandbox creates a fresh sandbox directory under root (os.TempDir() if
+// empty), private to the warden and to uid:gid, the requester the command
+// runs as.
+func NewSandbox(root, source string, uid, gid int) (*Sandbox, error) {
+	if root == "" {
+		root = os.TempDir()
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("create sandbox root: %w", err)
+	}
+
+	dir, err := os.MkdirTemp(root, "clawrden-sandbox-")
+	if err != nil {
+		return nil, fmt.Errorf("create sandbox: %w", err)
+	}
+	// MkdirTemp creates it 0700; the command runs as the requester's
+	// identity, so hand it to them rather than open it to every local user
+	if uid != os.Geteuid() {
+		if err := os.Lchown(dir, uid, gid); err != nil {
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("chown sandbox: %w", err)
+		}
+	}
+
+	return &Sandbox{Dir: dir, Source: source}, nil
+}
+
+// CopyIn copies files from the source directory matching any of the globs
+// into the sandbox. Returns the relative paths that were copied.
+func (sb *Sandbox) CopyIn(globs []string) ([]string, error) {
+	if len(globs) == 0 {
+		return nil, nil
+	}
+	files, err := matchFiles(sb.Source, globs)
+	if err != nil {
+		return nil, fmt.Errorf("match copy_in files: %w", err)
+	}
+	for _, rel := range files {
+		if err := copyFile(sb.Source, sb.Dir, rel); err != nil {
+			return nil, fmt.Errorf("copy in %s: %w", rel, err)
+		}
+	}
+	return files, nil
+}
+
+// Outputs lists the sandbox files matching any of the globs, as relative paths.
+func (sb *Sandbox) Outputs(globs []string) ([]string, error) {
+	if len(globs) == 0 {
+		return nil, nil
+	}
+	return matchFiles(sb.Dir, globs)
+}
+
+// CopyOut copies the given relative paths from the sandbox back into the source directory.
+func (sb *Sandbox) CopyOut(files []string) error {
+	for _, rel := range files {
+		if !filepath.IsLocal(rel) {
+			return fmt.Errorf("copy out %s: path escapes sandbox", rel)
+		}
+		// Never write through a symlink planted in the real workspace
+		if err := checkNoSymlinks(sb.Source, rel); err != nil {
+			return fmt.Errorf("copy out %s: %w", rel, err)
+		}
+		if err := copyFile(sb.Dir, sb.Source, rel); err != nil {
+			return fmt.Errorf("copy out %s: %w", rel, err)
+		}
+	}
+	return nil
+}
+
+// Cleanup removes the sandbox directory and everything in it.
+func (sb *Sandbox) Cleanup() error {
+	return os.RemoveAll(sb.Dir)
+}
+
+// matchFiles walks root and returns the relative paths of regular files matching any glob.
+// A glob containing "/" is matched against the relative path; otherwise against the base name.
+func matchFiles(root string, globs []string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if matchGlobs(globs, rel) {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// matchGlobs reports whether the relative path matches any of the globs.
+func matchGlobs(globs []string, rel string) bool {
+	for _, glob := range globs {
+		target := rel
+		if !strings.Contains(glob, "/") {
+			target = filepath.Base(rel)
+		}
+		if matched, err := filepath.Match(glob, target); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNoSymlinks verifies that no existing component of root/rel is a symlink.
+func checkNoSymlinks(root, rel string) error {
+	path := root
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		path = filepath.Join(path, part)
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("refusing to write through symlink %s", path)
+		}
+	}
+	return nil
+}
+
+// copyFile copies the regular file rel from srcDir to dstDir, creating
+// parent directories as needed. The file may have been swapped since
+// matchFiles saw it, by the agent in the workspace or by the command in the
+// sandbox, so nothing found then is trusted: both sides are opened within
+// their directory, which refuses symlinks leading out of it, and the source
+// must still be a regular file once open.
+func copyFile(srcDir, dstDir, rel string) error {
+	src, err := os.OpenRoot(srcDir)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	// O_NONBLOCK keeps a FIFO swapped in from blocking the open
+	in, err := src.OpenFile(rel, os.O_RDONLY|syscall.O_NOFOLLOW|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("not a regular file")
+	}
+
+	dst, err := os.OpenRoot(dstDir)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	if dir := filepath.Dir(rel); dir != "." {
+		if err := dst.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	out, err := dst.OpenFile(rel, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|syscall.O_NOFOLLOW, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,99 @@
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewSandboxIsPrivate(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("handing the sandbox to another user needs root")
+	}
+	sb, err := NewSandbox(t.TempDir(), t.TempDir(), 2000, 2001)
+	if err != nil {
+		t.Fatalf("NewSandbox: %v", err)
+	}
+	defer sb.Cleanup()
+
+	info, err := os.Stat(sb.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0700 {
+		t.Errorf("sandbox mode = %v, want 0700", perm)
+	}
+	if got := owner(t, sb.Dir); got != [2]int{2000, 2001} {
+		t.Errorf("sandbox owner = %v, want the requester's 2000:2001", got)
+	}
+}
+
+// swapForSymlink replaces path with a symlink to target, as an agent racing
+// the warden would.
+func swapForSymlink(t *testing.T, path, target string) {
+	t.Helper()
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCopyInRefusesFileSwappedForSymlink(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secret, []byte("TOKEN=abc"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	workspace := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workspace, "main.py"), []byte("print(1)"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sb, err := NewSandbox(t.TempDir(), workspace, os.Geteuid(), os.Getegid())
+	if err != nil {
+		t.Fatalf("NewSandbox: %v", err)
+	}
+	defer sb.Cleanup()
+
+	// The swap lands between CopyIn's walk and its copy
+	files, err := matchFiles(workspace, []string{"*.py"})
+	if err != nil || len(files) != 1 {
+		t.Fatalf("matchFiles = %v, %v", files, err)
+	}
+	swapForSymlink(t, filepath.Join(workspace, "main.py"), secret)
+	if err := copyFile(sb.Source, sb.Dir, files[0]); err == nil {
+		t.Error("copied a file swapped for a symlink")
+	}
+	if _, err := os.Lstat(filepath.Join(sb.Dir, "main.py")); !os.IsNotExist(err) {
+		t.Errorf("sandbox has main.py after a refused copy: %v", err)
+	}
+}
+
+func TestCopyOutRefusesFileSwappedForSymlink(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secret, []byte("TOKEN=abc"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	workspace := t.TempDir()
+	sb, err := NewSandbox(t.TempDir(), workspace, os.Geteuid(), os.Getegid())
+	if err != nil {
+		t.Fatalf("NewSandbox: %v", err)
+	}
+	defer sb.Cleanup()
+	if err := os.WriteFile(filepath.Join(sb.Dir, "report.txt"), []byte("42"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The command swaps its output while the copy-out waits for review
+	outputs, err := sb.Outputs([]string{"*.txt"})
+	if err != nil || len(outputs) != 1 {
+		t.Fatalf("Outputs = %v, %v", outputs, err)
+	}
+	swapForSymlink(t, filepath.Join(sb.Dir, "report.txt"), secret)
+	if err := sb.CopyOut(outputs); err == nil {
+		t.Error("copied out a file swapped for a symlink")
+	}
+	if _, err := os.Lstat(filepath.Join(workspace, "report.txt")); !os.IsNotExist(err) {
+		t.Errorf("workspace has report.txt after a refused copy: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrShimStalled is returned for writes to a shim that stopped reading
+// output, and is the cause of a command killed for it.
+var ErrShimStalled = errors.New("shim stopped reading output")
+
+// StallConn puts a deadline on every write to a shim, so a shim whose reader
+// stopped (an agent that no longer reads its command's output) cannot block
+// the command forever once the socket buffers fill. The first write to miss
+// its deadline marks the connection stalled and calls onStall. From then on
+// writes go to the spool, if SpoolTo set one, and otherwise fail at once.
+type StallConn struct {
+	net.Conn
+	timeout time.Duration
+	onStall func()
+
+	mu      sync.Mutex
+	stalled bool
+	spool   io.Writer
+	err     error // First spool write error
+}
+
+// NewStallConn wraps conn with a write deadline of timeout; onStall is
+// called once, from the stalled write.
+func NewStallConn(conn net.Conn, timeout time.Duration, onStall func()) *StallConn {
+	return &StallConn{Conn: conn, timeout: timeout, onStall: onStall}
+}
+
+// SpoolTo sends the writes after a stall to w instead of failing them.
+// protocol.WriteFrame issues one Write per frame, so w sees whole frames;
+// the frame that stalled is spooled whole, even if part of it reached the
+// shim.
+func (c *StallConn) SpoolTo(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.spool = w
+}
+
+// Write forwards b to the shim within the deadline. After a stall it
+// spools b and reports ErrShimStalled, since the shim did not get it.
+func (c *StallConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	stalled := c.stalled
+	c.mu.Unlock()
+	if stalled {
+		return 0, c.spoolWrite(b)
+	}
+
+	c.Conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	n, err := c.Conn.Write(b)
+	var netErr net.Error
+	if err == nil || !errors.As(err, &netErr) || !netErr.Timeout() {
+		return n, err
+	}
+
+	c.mu.Lock()
+	first := !c.stalled
+	c.stalled = true
+	c.mu.Unlock()
+	if first && c.onStall != nil {
+		c.onStall()
+	}
+	return n, c.spoolWrite(b)
+}
+
+// spoolWrite writes b to the spool, returning ErrShimStalled either way.
+func (c *StallConn) spoolWrite(b []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.spool != nil && c.err == nil {
+		if _, err := c.spool.Write(b); err != nil {
+			c.err = fmt.Errorf("spool output: %w", err)
+		}
+	}
+	return ErrShimStalled
+}
+
+// Stalled reports whether a write missed its deadline.
+func (c *StallConn) Stalled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stalled
+}
+
+// SpoolErr returns the first error writing to the spool, if any.
+func (c *StallConn) SpoolErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
@@ -0,0 +1,46 @@
+package executor
+
+import (
+	"bytes"
+	"clawrden/pkg/protocol"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestStallConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	stalls := 0
+	var spool bytes.Buffer
+	conn := NewStallConn(server, 50*time.Millisecond, func() { stalls++ })
+	conn.SpoolTo(&spool)
+
+	// A reading shim gets the frame
+	go io.CopyN(io.Discard, client, 10)
+	if err := protocol.WriteFrame(conn, protocol.Frame{Type: protocol.StreamStdout, Payload: []byte("hello")}); err != nil {
+		t.Fatalf("write to a reading shim: %v", err)
+	}
+
+	// One that stopped reading does not hold the writer past the deadline
+	start := time.Now()
+	for _, payload := range []string{"stuck", "later"} {
+		err := protocol.WriteFrame(conn, protocol.Frame{Type: protocol.StreamStdout, Payload: []byte(payload)})
+		if !errors.Is(err, ErrShimStalled) {
+			t.Errorf("write %q to a stalled shim: %v", payload, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("stalled writes took %v", elapsed)
+	}
+	if !conn.Stalled() || stalls != 1 {
+		t.Errorf("Stalled() = %v after %d onStall calls, want true after 1", conn.Stalled(), stalls)
+	}
+	if got := spool.String(); got != "\x01\x00\x00\x00\x05stuck\x01\x00\x00\x00\x05later" {
+		t.Errorf("spooled %q, want both frames", got)
+	}
+}
@@ -0,0 +1,26 @@
+//go:build !faultinject
+
+package faultinject
+
+import "io"
+
+// Enabled reports whether this build can inject faults.
+const Enabled = false
+
+// Set does nothing without the faultinject build tag.
+func Set(point string, f Fault) {}
+
+// Clear does nothing without the faultinject build tag.
+func Clear(point string) {}
+
+// Reset does nothing without the faultinject build tag.
+func Reset() {}
+
+// Armed returns nothing without the faultinject build tag.
+func Armed() map[string]Fault { return nil }
+
+// Check does nothing without the faultinject build tag.
+func Check(point string, conn any) error { return nil }
+
+// Write is w.Write(p) without the faultinject build tag.
+func Write(point string, w io.Writer, p []byte) (int, error) { return w.Write(p) }
@@ -0,0 +1,122 @@
+//go:build faultinject
+
+package faultinject
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Enabled reports whether this build can inject faults.
+const Enabled = true
+
+var (
+	mu    sync.Mutex
+	armed = make(map[string]*armedFault)
+)
+
+type armedFault struct {
+	Fault
+	hits  int
+	fired int
+}
+
+// Set arms point with f, replacing any fault armed there.
+func Set(point string, f Fault) {
+	mu.Lock()
+	defer mu.Unlock()
+	armed[point] = &armedFault{Fault: f}
+}
+
+// Clear disarms point.
+func Clear(point string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(armed, point)
+}
+
+// Reset disarms every point.
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	armed = make(map[string]*armedFault)
+}
+
+// Armed returns the faults still armed, by point.
+func Armed() map[string]Fault {
+	mu.Lock()
+	defer mu.Unlock()
+	out := make(map[string]Fault, len(armed))
+	for point, a := range armed {
+		out[point] = a.Fault
+	}
+	return out
+}
+
+// hit counts a hit on point and returns the fault to apply, if it fires.
+func hit(point string) (Fault, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	a, ok := armed[point]
+	if !ok {
+		return Fault{}, false
+	}
+	a.hits++
+	if a.hits <= a.Skip {
+		return Fault{}, false
+	}
+	a.fired++
+	if a.Times > 0 && a.fired >= a.Times {
+		delete(armed, point)
+	}
+	return a.Fault, true
+}
+
+// Check applies a fault armed at point to an operation on conn: it sleeps,
+// closes conn if the fault disconnects, and returns the fault's error.
+// Code after a disconnect carries on and finds the connection closed, as it
+// would after a real one.
+func Check(point string, conn any) error {
+	f, ok := hit(point)
+	if !ok {
+		return nil
+	}
+	time.Sleep(f.Delay)
+	if f.Disconnect {
+		closeConn(conn)
+	}
+	if f.Error != "" {
+		return fmt.Errorf("%w at %s: %s", ErrInjected, point, f.Error)
+	}
+	return nil
+}
+
+// Write writes p to w, applying a fault armed at point first. A truncating
+// fault writes the first bytes of p, closes w and fails.
+func Write(point string, w io.Writer, p []byte) (int, error) {
+	f, ok := hit(point)
+	if !ok {
+		return w.Write(p)
+	}
+	time.Sleep(f.Delay)
+	switch {
+	case f.Truncate > 0 && f.Truncate < len(p):
+		n, _ := w.Write(p[:f.Truncate])
+		closeConn(w)
+		return n, fmt.Errorf("%w at %s: truncated after %d bytes", ErrInjected, point, n)
+	case f.Disconnect:
+		closeConn(w)
+		return 0, fmt.Errorf("%w at %s: disconnected", ErrInjected, point)
+	case f.Error != "":
+		return 0, fmt.Errorf("%w at %s: %s", ErrInjected, point, f.Error)
+	}
+	return w.Write(p)
+}
+
+func closeConn(conn any) {
+	if c, ok := conn.(io.Closer); ok {
+		c.Close()
+	}
+}
@@ -0,0 +1,41 @@
+// Package faultinject lets tests break the warden at named points: slow a
+// frame down, fail it, cut it short or drop the connection. Injection only
+// works in builds with the faultinject tag (`make test-faults`); in every
+// other build the hooks are no-ops the compiler inlines away.
+package faultinject
+
+import (
+	"errors"
+	"time"
+)
+
+// Injection points.
+const (
+	PointWriteFrame = "protocol.write_frame" // Every frame written with protocol.WriteFrame
+	PointReadFrame  = "protocol.read_frame"  // Every frame read with protocol.ReadFrame
+	PointRequest    = "warden.request"       // After the warden read a request
+	PointPendingAck = "warden.pending_ack"   // After the warden sent AckPendingHITL
+	PointExecute    = "warden.execute"       // Before the warden starts an allowed command
+	PointExecStream = "executor.stream"      // Before an executor forwards a chunk of output
+	PointExecExit   = "executor.exit"        // Before an executor sends the exit code
+)
+
+// Points lists every injection point.
+var Points = []string{
+	PointWriteFrame, PointReadFrame,
+	PointRequest, PointPendingAck, PointExecute,
+	PointExecStream, PointExecExit,
+}
+
+// ErrInjected is wrapped by every error an armed point returns.
+var ErrInjected = errors.New("injected fault")
+
+// Fault is what an armed injection point does when it is hit.
+type Fault struct {
+	Delay      time.Duration `json:"delay,omitempty"`      // Sleep first
+	Error      string        `json:"error,omitempty"`      // Then fail the operation with this message
+	Truncate   int           `json:"truncate,omitempty"`   // Writes: send only the first N bytes, then disconnect
+	Disconnect bool          `json:"disconnect,omitempty"` // Close the connection
+	Skip       int           `json:"skip,omitempty"`       // Let this many hits pass first
+	Times      int           `json:"times,omitempty"`      // Disarm after firing this often; 0 fires forever
+}
@@ -0,0 +1,70 @@
+//go:build faultinject
+
+package faultinject
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+type closingBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *closingBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestWriteTruncates(t *testing.T) {
+	t.Cleanup(Reset)
+	Set(PointWriteFrame, Fault{Skip: 1, Truncate: 2, Times: 1})
+
+	var buf closingBuffer
+	for i, want := range []struct {
+		written string
+		failed  bool
+	}{
+		{"abcd", false}, // Skipped
+		{"abcdab", true},
+		{"abcdababcd", false}, // Disarmed after firing once
+	} {
+		_, err := Write(PointWriteFrame, &buf, []byte("abcd"))
+		if (err != nil) != want.failed || buf.String() != want.written {
+			t.Errorf("write %d: %q, %v; want %q, failed %v", i, buf.String(), err, want.written, want.failed)
+		}
+		if err != nil && !errors.Is(err, ErrInjected) {
+			t.Errorf("write %d: error %v does not wrap ErrInjected", i, err)
+		}
+	}
+	if !buf.closed {
+		t.Error("truncating write did not close the connection")
+	}
+	if len(Armed()) != 0 {
+		t.Errorf("armed = %v, want none", Armed())
+	}
+}
+
+func TestCheck(t *testing.T) {
+	t.Cleanup(Reset)
+	var conn closingBuffer
+	if err := Check(PointExecExit, &conn); err != nil {
+		t.Fatalf("unarmed point: %v", err)
+	}
+
+	Set(PointExecExit, Fault{Disconnect: true})
+	if err := Check(PointExecExit, &conn); err != nil || !conn.closed {
+		t.Errorf("disconnect: %v, closed %v", err, conn.closed)
+	}
+
+	Set(PointExecExit, Fault{Error: "boom"})
+	if err := Check(PointExecExit, &conn); !errors.Is(err, ErrInjected) {
+		t.Errorf("error fault: %v", err)
+	}
+	Clear(PointExecExit)
+	if err := Check(PointExecExit, &conn); err != nil {
+		t.Errorf("cleared point: %v", err)
+	}
+}
@@ -0,0 +1,329 @@
+// Package install sets a warden up on a host: the directories it uses, the
+// shim in its armory and a systemd unit running it. Plan and PlanUninstall
+// only work out the operations; Apply performs them. That way `warden
+// install --dry-run` can print exactly what an install would do, and plans
+// are tested without root.
+package install
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// UnitName is the name of the warden's systemd unit.
+const UnitName = "clawrden-warden.service"
+
+// Shim file names in the armory, as the jailhouse expects them.
+const (
+	shimName   = "clawrden-shim"
+	shimMarker = ".clawrden-shim.embedded" // See jailhouse.EmbeddedShimMarker
+)
+
+// Layout is where a warden keeps its files.
+type Layout struct {
+	User      bool   // A systemd user unit instead of a system one
+	ConfigDir string // Policy file
+	SocketDir string
+	StateDir  string // Armory, jailhouse, jailhouse state, transcripts
+	LogDir    string
+	UnitDir   string
+
+	// Name of SocketDir under the runtime directory systemd manages (/run,
+	// or $XDG_RUNTIME_DIR for user units), so it is recreated at boot; empty
+	// if SocketDir lies elsewhere
+	RuntimeDirectory string
+}
+
+// SystemLayout is the layout of a system-wide install, matching the
+// warden's default flags.
+func SystemLayout() Layout {
+	return Layout{
+		ConfigDir:        "/etc/clawrden",
+		SocketDir:        "/var/run/clawrden",
+		StateDir:         "/var/lib/clawrden",
+		LogDir:           "/var/log/clawrden",
+		UnitDir:          "/etc/systemd/system",
+		RuntimeDirectory: "clawrden",
+	}
+}
+
+// UserLayout is the layout of a per-user install, under the XDG base
+// directories that getenv reports.
+func UserLayout(getenv func(string) string) (Layout, error) {
+	home := getenv("HOME")
+	xdg := func(name, fallback string) (string, error) {
+		if dir := getenv(name); dir != "" {
+			return dir, nil
+		}
+		if home == "" {
+			return "", fmt.Errorf("neither %s nor HOME is set", name)
+		}
+		return filepath.Join(home, fallback), nil
+	}
+	state, err := xdg("XDG_STATE_HOME", ".local/state")
+	if err != nil {
+		return Layout{}, err
+	}
+	config, err := xdg("XDG_CONFIG_HOME", ".config")
+	if err != nil {
+		return Layout{}, err
+	}
+
+	l := Layout{
+		User:      true,
+		ConfigDir: filepath.Join(config, "clawrden"),
+		StateDir:  filepath.Join(state, "clawrden"),
+		LogDir:    filepath.Join(state, "clawrden", "log"),
+		UnitDir:   filepath.Join(config, "systemd", "user"),
+		SocketDir: filepath.Join(state, "clawrden", "run"),
+	}
+	if runtime := getenv("XDG_RUNTIME_DIR"); runtime != "" {
+		l.SocketDir = filepath.Join(runtime, "clawrden")
+		l.RuntimeDirectory = "clawrden"
+	}
+	return l, nil
+}
+
+// Paths of the files in a layout.
+func (l Layout) Socket() string      { return filepath.Join(l.SocketDir, "warden.sock") }
+func (l Layout) Armory() string      { return filepath.Join(l.StateDir, "armory") }
+func (l Layout) Jailhouse() string   { return filepath.Join(l.StateDir, "jailhouse") }
+func (l Layout) JailState() string   { return filepath.Join(l.StateDir, "jailhouse.state.json") }
+func (l Layout) Transcripts() string { return filepath.Join(l.StateDir, "transcripts") }
+func (l Layout) AuditLog() string    { return filepath.Join(l.LogDir, "audit.log") }
+func (l Layout) PolicyFile() string  { return filepath.Join(l.ConfigDir, "policy.yaml") }
+func (l Layout) UnitPath() string    { return filepath.Join(l.UnitDir, UnitName) }
+
+// Options describe an install.
+type Options struct {
+	Layout    Layout
+	Binary    string   // Absolute path of the warden binary the unit runs
+	Policy    string   // Policy file the unit passes the warden (default: policy.yaml in ConfigDir)
+	Shim      []byte   // Shim to put in the armory; nil leaves the armory alone
+	ExtraArgs []string // More warden flags for the unit, e.g. [-api, :9090]
+	UID, GID  int      // Owner of the directories and files
+	Purge     bool     // Uninstall: also remove state, logs and the socket directory
+}
+
+// OpKind is what an operation does.
+type OpKind string
+
+const (
+	OpMkdir  OpKind = "mkdir"  // Create a directory, or fix the mode and owner of an existing one
+	OpWrite  OpKind = "write"  // Replace a file
+	OpRemove OpKind = "remove" // Remove a file or directory tree; a missing one is fine
+	OpRun    OpKind = "run"    // Run a command
+)
+
+// Op is one step of an install.
+type Op struct {
+	Kind     OpKind
+	Path     string
+	Mode     fs.FileMode
+	UID, GID int
+	Content  []byte
+	Args     []string // For OpRun
+	MayFail  bool     // A failure is reported, and the install goes on
+}
+
+// String describes op, as --dry-run prints it.
+func (op Op) String() string {
+	switch op.Kind {
+	case OpMkdir:
+		return fmt.Sprintf("mkdir %s (%04o, %d:%d)", op.Path, op.Mode.Perm(), op.UID, op.GID)
+	case OpWrite:
+		return fmt.Sprintf("write %s (%04o, %d:%d, %d bytes)", op.Path, op.Mode.Perm(), op.UID, op.GID, len(op.Content))
+	case OpRemove:
+		return "remove " + op.Path
+	case OpRun:
+		return "run " + strings.Join(op.Args, " ")
+	}
+	return string(op.Kind)
+}
+
+// Plan returns the operations of an install: the directory tree, the shim
+// and the systemd unit. The unit is only written, not enabled.
+func Plan(opts Options) ([]Op, error) {
+	if !filepath.IsAbs(opts.Binary) {
+		return nil, fmt.Errorf("warden binary path %q is not absolute", opts.Binary)
+	}
+	l := opts.Layout
+	dir := func(path string, mode fs.FileMode) Op {
+		return Op{Kind: OpMkdir, Path: path, Mode: mode, UID: opts.UID, GID: opts.GID}
+	}
+	ops := []Op{
+		dir(l.ConfigDir, 0755),
+		dir(l.SocketDir, 0755),
+		dir(l.StateDir, 0755),
+		dir(l.Armory(), 0755),
+		dir(l.Jailhouse(), 0755),
+		dir(l.Transcripts(), 0700), // Commands' output
+		dir(l.LogDir, 0750),
+		dir(l.UnitDir, 0755),
+	}
+	if opts.Shim != nil {
+		sum := sha256.Sum256(opts.Shim)
+		ops = append(ops,
+			Op{Kind: OpWrite, Path: filepath.Join(l.Armory(), shimName), Mode: 0555, UID: opts.UID, GID: opts.GID, Content: opts.Shim},
+			// The warden keeps a shim it recognizes as its own up to date
+			Op{Kind: OpWrite, Path: filepath.Join(l.Armory(), shimMarker), Mode: 0644, UID: opts.UID, GID: opts.GID, Content: []byte(hex.EncodeToString(sum[:]) + "\n")},
+		)
+	}
+	ops = append(ops,
+		Op{Kind: OpWrite, Path: l.UnitPath(), Mode: 0644, UID: opts.UID, GID: opts.GID, Content: []byte(Unit(opts))},
+		Op{Kind: OpRun, Args: systemctl(l, "daemon-reload"), MayFail: true},
+	)
+	return ops, nil
+}
+
+// PlanUninstall returns the operations that stop the warden and remove its
+// unit, and with Purge its state, logs and socket directory. The
+// configuration directory, with the policy, is always kept.
+func PlanUninstall(opts Options) []Op {
+	l := opts.Layout
+	ops := []Op{
+		{Kind: OpRun, Args: systemctl(l, "disable", "--now", UnitName), MayFail: true},
+		{Kind: OpRemove, Path: l.UnitPath()},
+		{Kind: OpRun, Args: systemctl(l, "daemon-reload"), MayFail: true},
+	}
+	if opts.Purge {
+		ops = append(ops,
+			Op{Kind: OpRemove, Path: l.StateDir},
+			Op{Kind: OpRemove, Path: l.LogDir},
+			Op{Kind: OpRemove, Path: l.SocketDir},
+		)
+	}
+	return ops
+}
+
+// systemctl returns a systemctl command line for l's kind of unit.
+func systemctl(l Layout, args ...string) []string {
+	cmd := []string{"systemctl"}
+	if l.User {
+		cmd = append(cmd, "--user")
+	}
+	return append(cmd, args...)
+}
+
+// Unit returns the systemd unit running the warden with opts' layout.
+func Unit(opts Options) string {
+	l := opts.Layout
+	policy := opts.Policy
+	if policy == "" {
+		policy = l.PolicyFile()
+	}
+	args := []string{
+		opts.Binary,
+		"-policy", policy,
+		"-socket", l.Socket(),
+		"-audit", l.AuditLog(),
+		"-armory-path", l.Armory(),
+		"-jailhouse-path", l.Jailhouse(),
+		"-state-path", l.JailState(),
+		"-transcript-dir", l.Transcripts(),
+	}
+	args = append(args, opts.ExtraArgs...)
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = unitQuote(arg)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Written by warden install. Rerun it rather than editing this file.\n")
+	fmt.Fprintf(&b, "[Unit]\n")
+	fmt.Fprintf(&b, "Description=Clawrden warden\n")
+	if !l.User {
+		fmt.Fprintf(&b, "After=network.target docker.service\n")
+		fmt.Fprintf(&b, "Wants=docker.service\n")
+	}
+	fmt.Fprintf(&b, "\n[Service]\n")
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(quoted, " "))
+	fmt.Fprintf(&b, "Restart=on-failure\n")
+	if l.RuntimeDirectory != "" {
+		// Agents' bind mounts of the socket directory outlive warden restarts
+		fmt.Fprintf(&b, "RuntimeDirectory=%s\n", l.RuntimeDirectory)
+		fmt.Fprintf(&b, "RuntimeDirectoryPreserve=yes\n")
+	}
+	fmt.Fprintf(&b, "\n[Install]\n")
+	if l.User {
+		fmt.Fprintf(&b, "WantedBy=default.target\n")
+	} else {
+		fmt.Fprintf(&b, "WantedBy=multi-user.target\n")
+	}
+	return b.String()
+}
+
+// unitQuote quotes arg for a unit's command line when it needs it.
+func unitQuote(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\$%;") {
+		return arg
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `$$`, `%`, `%%`)
+	return `"` + r.Replace(arg) + `"`
+}
+
+// Apply performs ops in order, printing each to w. It stops at the first
+// failure, except for ops that may fail, which are reported and skipped.
+// run runs the commands of OpRun operations.
+func Apply(ops []Op, run func(args []string) error, w io.Writer) error {
+	for _, op := range ops {
+		fmt.Fprintln(w, op)
+		err := apply(op, run)
+		switch {
+		case err == nil:
+		case op.MayFail:
+			fmt.Fprintf(w, "  warning: %v\n", err)
+		default:
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	return nil
+}
+
+// apply performs one operation.
+func apply(op Op, run func(args []string) error) error {
+	switch op.Kind {
+	case OpMkdir:
+		if err := os.MkdirAll(op.Path, op.Mode); err != nil {
+			return err
+		}
+		if err := os.Chmod(op.Path, op.Mode); err != nil {
+			return err
+		}
+		return os.Lchown(op.Path, op.UID, op.GID)
+	case OpWrite:
+		// Write next to the file and rename, so a running shim keeps its binary
+		tmp, err := os.CreateTemp(filepath.Dir(op.Path), "."+filepath.Base(op.Path)+"-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		if _, err := tmp.Write(op.Content); err != nil {
+			tmp.Close()
+			return err
+		}
+		if err := tmp.Chmod(op.Mode); err != nil {
+			tmp.Close()
+			return err
+		}
+		if err := tmp.Chown(op.UID, op.GID); err != nil {
+			tmp.Close()
+			return err
+		}
+		if err := tmp.Close(); err != nil {
+			return err
+		}
+		return os.Rename(tmp.Name(), op.Path)
+	case OpRemove:
+		return os.RemoveAll(op.Path)
+	case OpRun:
+		return run(op.Args)
+	}
+	return fmt.Errorf("unknown operation %q", op.Kind)
+}
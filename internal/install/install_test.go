@@ -0,0 +1,198 @@
+package install
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testLayout is a user layout under dir.
+func testLayout(t *testing.T, dir string) Layout {
+	t.Helper()
+	env := map[string]string{"HOME": dir, "XDG_RUNTIME_DIR": filepath.Join(dir, "run")}
+	l, err := UserLayout(func(name string) string { return env[name] })
+	if err != nil {
+		t.Fatalf("UserLayout: %v", err)
+	}
+	return l
+}
+
+func TestUserLayout(t *testing.T) {
+	env := map[string]string{"HOME": "/home/ada", "XDG_STATE_HOME": "/state"}
+	l, err := UserLayout(func(name string) string { return env[name] })
+	if err != nil {
+		t.Fatalf("UserLayout: %v", err)
+	}
+	want := Layout{
+		User:      true,
+		ConfigDir: "/home/ada/.config/clawrden",
+		SocketDir: "/state/clawrden/run", // No XDG_RUNTIME_DIR
+		StateDir:  "/state/clawrden",
+		LogDir:    "/state/clawrden/log",
+		UnitDir:   "/home/ada/.config/systemd/user",
+	}
+	if l != want {
+		t.Errorf("layout = %+v, want %+v", l, want)
+	}
+
+	if _, err := UserLayout(func(string) string { return "" }); err == nil {
+		t.Error("UserLayout without HOME succeeded")
+	}
+}
+
+func TestPlan(t *testing.T) {
+	opts := Options{Layout: SystemLayout(), Binary: "/usr/local/bin/warden", Shim: []byte("shim"), ExtraArgs: []string{"-api", ":9090"}}
+	ops, err := Plan(opts)
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+
+	var got []string
+	for _, op := range ops {
+		got = append(got, op.String())
+	}
+	want := []string{
+		"mkdir /etc/clawrden (0755, 0:0)",
+		"mkdir /var/run/clawrden (0755, 0:0)",
+		"mkdir /var/lib/clawrden (0755, 0:0)",
+		"mkdir /var/lib/clawrden/armory (0755, 0:0)",
+		"mkdir /var/lib/clawrden/jailhouse (0755, 0:0)",
+		"mkdir /var/lib/clawrden/transcripts (0700, 0:0)",
+		"mkdir /var/log/clawrden (0750, 0:0)",
+		"mkdir /etc/systemd/system (0755, 0:0)",
+		"write /var/lib/clawrden/armory/clawrden-shim (0555, 0:0, 4 bytes)",
+		"write /var/lib/clawrden/armory/.clawrden-shim.embedded (0644, 0:0, 65 bytes)",
+		"write /etc/systemd/system/clawrden-warden.service (0644, 0:0, " + strconv.Itoa(len(Unit(opts))) + " bytes)",
+		"run systemctl daemon-reload",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("plan:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	unit := string(ops[10].Content)
+	for _, line := range []string{
+		"ExecStart=/usr/local/bin/warden -policy /etc/clawrden/policy.yaml -socket /var/run/clawrden/warden.sock -audit /var/log/clawrden/audit.log " +
+			"-armory-path /var/lib/clawrden/armory -jailhouse-path /var/lib/clawrden/jailhouse -state-path /var/lib/clawrden/jailhouse.state.json " +
+			"-transcript-dir /var/lib/clawrden/transcripts -api :9090\n",
+		"RuntimeDirectory=clawrden\n",
+		"WantedBy=multi-user.target\n",
+	} {
+		if !strings.Contains(unit, line) {
+			t.Errorf("unit lacks %q:\n%s", line, unit)
+		}
+	}
+
+	if _, err := Plan(Options{Layout: SystemLayout(), Binary: "bin/warden"}); err == nil {
+		t.Error("Plan accepted a relative binary path")
+	}
+}
+
+func TestUserUnit(t *testing.T) {
+	opts := Options{Layout: testLayout(t, "/home/my user"), Binary: "/opt/clawrden/warden", Policy: "/home/my user/policy.yaml"}
+	unit := Unit(opts)
+	for _, line := range []string{
+		`ExecStart=/opt/clawrden/warden -policy "/home/my user/policy.yaml" -socket "/home/my user/run/clawrden/warden.sock"`,
+		"WantedBy=default.target\n",
+	} {
+		if !strings.Contains(unit, line) {
+			t.Errorf("unit lacks %q:\n%s", line, unit)
+		}
+	}
+	if strings.Contains(unit, "docker.service") {
+		t.Errorf("user unit depends on docker.service:\n%s", unit)
+	}
+}
+
+func TestPlanUninstall(t *testing.T) {
+	l := testLayout(t, "/home/ada")
+	var got []string
+	for _, op := range PlanUninstall(Options{Layout: l, Purge: true}) {
+		got = append(got, op.String())
+	}
+	want := []string{
+		"run systemctl --user disable --now clawrden-warden.service",
+		"remove /home/ada/.config/systemd/user/clawrden-warden.service",
+		"run systemctl --user daemon-reload",
+		"remove /home/ada/.local/state/clawrden",
+		"remove /home/ada/.local/state/clawrden/log",
+		"remove /home/ada/run/clawrden",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("plan:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if ops := PlanUninstall(Options{Layout: l}); len(ops) != 3 {
+		t.Errorf("uninstall without purge removes data: %v", ops)
+	}
+}
+
+func TestApply(t *testing.T) {
+	dir := t.TempDir()
+	opts := Options{Layout: testLayout(t, dir), Binary: "/usr/bin/warden", Shim: []byte("shim"), UID: os.Getuid(), GID: os.Getgid()}
+	ops, err := Plan(opts)
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+
+	var ran [][]string
+	run := func(args []string) error {
+		ran = append(ran, args)
+		return os.ErrPermission // A failing systemctl does not fail the install
+	}
+	var out strings.Builder
+	if err := Apply(ops, run, &out); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if !reflect.DeepEqual(ran, [][]string{{"systemctl", "--user", "daemon-reload"}}) {
+		t.Errorf("ran %q", ran)
+	}
+	if !strings.Contains(out.String(), "warning: permission denied") {
+		t.Errorf("output lacks the systemctl warning:\n%s", out.String())
+	}
+
+	l := opts.Layout
+	for path, mode := range map[string]os.FileMode{
+		l.Transcripts():                     0700 | os.ModeDir,
+		l.LogDir:                            0750 | os.ModeDir,
+		filepath.Join(l.Armory(), shimName): 0555,
+		l.UnitPath():                        0644,
+	} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Errorf("stat: %v", err)
+			continue
+		}
+		if info.Mode() != mode {
+			t.Errorf("%s: mode %v, want %v", path, info.Mode(), mode)
+		}
+	}
+
+	// Installing again fixes modes and leaves no temporary files
+	if err := os.Chmod(l.LogDir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := Apply(ops, run, &out); err != nil {
+		t.Fatalf("second Apply: %v", err)
+	}
+	if info, _ := os.Stat(l.LogDir); info.Mode().Perm() != 0750 {
+		t.Errorf("log dir mode %v after reinstall, want 0750", info.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(l.Armory())
+	if len(entries) != 2 {
+		t.Errorf("armory holds %v, want the shim and its marker", entries)
+	}
+
+	if err := Apply(PlanUninstall(Options{Layout: l, Purge: true}), run, &out); err != nil {
+		t.Fatalf("uninstall: %v", err)
+	}
+	for _, path := range []string{l.UnitPath(), l.StateDir} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s survived uninstall --purge: %v", path, err)
+		}
+	}
+	if _, err := os.Stat(l.ConfigDir); err != nil {
+		t.Errorf("uninstall removed the config directory: %v", err)
+	}
+}
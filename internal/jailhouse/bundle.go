@@ -0,0 +1,199 @@
+package jailhouse
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Bundle file names. Every entry in a bundle is a regular file at the top
+// level; the symlinks are described by the manifest and created by the
+// install script, because symlinks inside tarballs are easy to extract
+// unsafely.
+const (
+	BundleShim       = "clawrden-shim"
+	BundleManifest   = "manifest.json"
+	BundleInstall    = "install.sh"
+	BundleDockerfile = "Dockerfile.snippet"
+)
+
+// DefaultBundlePrefix is where install.sh puts the jail inside an image.
+const DefaultBundlePrefix = "/clawrden"
+
+// Manifest describes a jail bundle's layout relative to its install prefix.
+type Manifest struct {
+	JailID      string         `json:"jail_id"`
+	Hardened    bool           `json:"hardened"`
+	Prefix      string         `json:"prefix"`           // Default install location
+	Shim        string         `json:"shim"`             // Shim path relative to Prefix
+	ShimSHA256  string         `json:"shim_sha256"`      // Checksum of the bundled shim
+	Links       []ManifestLink `json:"links"`            // Symlinks relative to Prefix, sorted by path
+	Marker      string         `json:"marker,omitempty"` // Hardened marker relative to Prefix
+	GeneratedAt time.Time      `json:"generated_at"`
+}
+
+// ManifestLink is one command symlink in a bundle.
+type ManifestLink struct {
+	Path   string `json:"path"`   // e.g. "bin/npm"
+	Target string `json:"target"` // Relative to the link's directory, e.g. "clawrden-shim"
+}
+
+// WriteBundle writes a gzipped tarball that installs jailID into a container
+// image: the armory's shim, a manifest of the symlink layout, install.sh
+// (which also works as an entrypoint), and a Dockerfile snippet.
+func (m *Manager) WriteBundle(jailID string, w io.Writer) error {
+	m.mu.RLock()
+	state, ok := m.jails[jailID]
+	var jail JailState
+	if ok {
+		jail = *state
+		jail.Commands = append([]string(nil), state.Commands...)
+	}
+	m.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("jail not found: %s", jailID)
+	}
+
+	shim, err := os.ReadFile(filepath.Join(m.armoryPath, "clawrden-shim"))
+	if err != nil {
+		return fmt.Errorf("read shim from armory: %w", err)
+	}
+
+	manifest := BuildManifest(&jail, shim)
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	manifestJSON = append(manifestJSON, '\n')
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	files := []struct {
+		name string
+		mode int64
+		body []byte
+	}{
+		{BundleShim, 0555, shim},
+		{BundleManifest, 0644, manifestJSON},
+		{BundleInstall, 0755, []byte(installScript(manifest))},
+		{BundleDockerfile, 0644, []byte(dockerfileSnippet(manifest))},
+	}
+	for _, f := range files {
+		hdr := &tar.Header{
+			Name:     f.name,
+			Mode:     f.mode,
+			Size:     int64(len(f.body)),
+			ModTime:  manifest.GeneratedAt,
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("write %s: %w", f.name, err)
+		}
+		if _, err := tw.Write(f.body); err != nil {
+			return fmt.Errorf("write %s: %w", f.name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// BuildManifest describes how a jail is laid out under DefaultBundlePrefix.
+func BuildManifest(jail *JailState, shim []byte) Manifest {
+	sum := sha256.Sum256(shim)
+	manifest := Manifest{
+		JailID:      jail.JailID,
+		Hardened:    jail.Hardened,
+		Prefix:      DefaultBundlePrefix,
+		Shim:        "bin/" + BundleShim,
+		ShimSHA256:  hex.EncodeToString(sum[:]),
+		GeneratedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	commands := append([]string(nil), jail.Commands...)
+	sort.Strings(commands)
+	for _, cmd := range commands {
+		manifest.Links = append(manifest.Links, ManifestLink{Path: "bin/" + cmd, Target: BundleShim})
+	}
+	if jail.Hardened {
+		manifest.Marker = HardenedMarker
+	}
+	return manifest
+}
+
+// installScript generates a POSIX shell script that installs a bundle into
+// $CLAWRDEN_PREFIX (default: the manifest's prefix). With arguments it then
+// execs them with the jail first in PATH, so it can be an image's entrypoint.
+func installScript(m Manifest) string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "#!/bin/sh\n")
+	fmt.Fprintf(&b, "# Generated by clawrden for jail %q. Do not edit.\n", m.JailID)
+	fmt.Fprintf(&b, "#\n")
+	fmt.Fprintf(&b, "# Usage: install.sh [command [args...]]\n")
+	fmt.Fprintf(&b, "# Installs the shim and its symlinks into $CLAWRDEN_PREFIX (default %s).\n", m.Prefix)
+	fmt.Fprintf(&b, "# Given a command, runs it afterwards with $CLAWRDEN_PREFIX/bin first in PATH.\n")
+	fmt.Fprintf(&b, "set -eu\n\n")
+	fmt.Fprintf(&b, "prefix=\"${CLAWRDEN_PREFIX:-%s}\"\n", m.Prefix)
+	fmt.Fprintf(&b, "here=\"$(cd \"$(dirname \"$0\")\" && pwd)\"\n\n")
+	fmt.Fprintf(&b, "mkdir -p \"$prefix/bin\"\n")
+	shim := "\"$prefix\"/" + shellQuote(m.Shim)
+	fmt.Fprintf(&b, "if [ \"$here\"/%s != %s ]; then\n", BundleShim, shim)
+	fmt.Fprintf(&b, "\tcp \"$here\"/%s %s\n", BundleShim, shim)
+	fmt.Fprintf(&b, "fi\n")
+	fmt.Fprintf(&b, "chmod 0555 %s\n", shim)
+	for _, link := range m.Links {
+		fmt.Fprintf(&b, "ln -sf %s \"$prefix\"/%s\n", shellQuote(link.Target), shellQuote(link.Path))
+	}
+	fmt.Fprintf(&b, "printf '%%s\\n' %s > \"$prefix\"/bin/%s\n", shellQuote(m.JailID), JailIDMarker)
+	if m.Marker != "" {
+		fmt.Fprintf(&b, "touch \"$prefix\"/%s\n", shellQuote(m.Marker))
+	}
+	fmt.Fprintf(&b, "\nif [ \"$#\" -gt 0 ]; then\n")
+	fmt.Fprintf(&b, "\tPATH=\"$prefix/bin:$PATH\"\n")
+	fmt.Fprintf(&b, "\texport PATH\n")
+	fmt.Fprintf(&b, "\texec \"$@\"\n")
+	fmt.Fprintf(&b, "fi\n")
+	return b.String()
+}
+
+// BundleDir is the directory name a jail's bundle is unpacked into by
+// default, and the one the Dockerfile snippet copies from.
+func BundleDir(jailID string) string {
+	safe := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, jailID)
+	return "clawrden-" + safe
+}
+
+// dockerfileSnippet generates Dockerfile lines that install an unpacked
+// bundle from the build context's BundleDir.
+func dockerfileSnippet(m Manifest) string {
+	dir := BundleDir(m.JailID)
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# Generated by clawrden for jail %q.\n", m.JailID)
+	fmt.Fprintf(&b, "# Unpack with: clawrden-cli jails render %q --output %s\n", m.JailID, dir)
+	fmt.Fprintf(&b, "COPY %s/ /tmp/%s/\n", dir, dir)
+	fmt.Fprintf(&b, "RUN sh /tmp/%s/%s && rm -rf /tmp/%s\n", dir, BundleInstall, dir)
+	fmt.Fprintf(&b, "ENV PATH=%s/bin:$PATH\n", m.Prefix)
+	fmt.Fprintf(&b, "ENV CLAWRDEN_SOCKET=/var/run/clawrden/warden.sock\n")
+	return b.String()
+}
+
+// shellQuote single-quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,180 @@
+package jailhouse
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// unpackTestBundle extracts a bundle into a temp dir, checking that every
+// entry is a top-level regular file, and returns the dir and entry modes.
+func unpackTestBundle(t *testing.T, data []byte) (string, map[string]os.FileMode) {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	dir := t.TempDir()
+	modes := make(map[string]os.FileMode)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("tar: %v", err)
+		}
+		if hdr.Typeflag != tar.TypeReg || strings.Contains(hdr.Name, "/") {
+			t.Fatalf("unexpected entry %q (type %c)", hdr.Name, hdr.Typeflag)
+		}
+		body, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("read %s: %v", hdr.Name, err)
+		}
+		mode := os.FileMode(hdr.Mode).Perm()
+		modes[hdr.Name] = mode
+		if err := os.WriteFile(filepath.Join(dir, hdr.Name), body, mode); err != nil {
+			t.Fatalf("write %s: %v", hdr.Name, err)
+		}
+	}
+	return dir, modes
+}
+
+func TestWriteBundle(t *testing.T) {
+	mgr, shimPath := newStartedManager(t)
+	if err := mgr.CreateJail("agent-x", []string{"npm", "git", "ls"}, true); err != nil {
+		t.Fatalf("CreateJail: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := mgr.WriteBundle("agent-x", &buf); err != nil {
+		t.Fatalf("WriteBundle: %v", err)
+	}
+	dir, modes := unpackTestBundle(t, buf.Bytes())
+
+	wantModes := map[string]os.FileMode{
+		BundleShim:       0555,
+		BundleManifest:   0644,
+		BundleInstall:    0755,
+		BundleDockerfile: 0644,
+	}
+	if !reflect.DeepEqual(modes, wantModes) {
+		t.Errorf("entries = %v, want %v", modes, wantModes)
+	}
+
+	shim, _ := os.ReadFile(shimPath)
+	bundled, _ := os.ReadFile(filepath.Join(dir, BundleShim))
+	if !bytes.Equal(shim, bundled) {
+		t.Error("bundled shim differs from the armory's")
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, BundleManifest))
+	if err != nil {
+		t.Fatalf("read manifest: %v", err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatalf("parse manifest: %v", err)
+	}
+	if manifest.JailID != "agent-x" || !manifest.Hardened || manifest.Marker != HardenedMarker {
+		t.Errorf("manifest = %+v", manifest)
+	}
+	wantLinks := []ManifestLink{
+		{Path: "bin/git", Target: BundleShim},
+		{Path: "bin/ls", Target: BundleShim},
+		{Path: "bin/npm", Target: BundleShim},
+	}
+	if !reflect.DeepEqual(manifest.Links, wantLinks) {
+		t.Errorf("links = %+v, want %+v", manifest.Links, wantLinks)
+	}
+
+	snippet, _ := os.ReadFile(filepath.Join(dir, BundleDockerfile))
+	for _, want := range []string{"COPY clawrden-agent-x/", "ENV PATH=/clawrden/bin:$PATH"} {
+		if !strings.Contains(string(snippet), want) {
+			t.Errorf("Dockerfile snippet missing %q:\n%s", want, snippet)
+		}
+	}
+}
+
+// TestBundleInstallMatchesJail runs install.sh into a temp prefix and checks
+// the installed layout against the jail on disk.
+func TestBundleInstallMatchesJail(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	mgr, _ := newStartedManager(t)
+	commands := []string{"npm", "it's"}
+	if err := mgr.CreateJail("quoted", commands, true); err != nil {
+		t.Fatalf("CreateJail: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := mgr.WriteBundle("quoted", &buf); err != nil {
+		t.Fatalf("WriteBundle: %v", err)
+	}
+	dir, _ := unpackTestBundle(t, buf.Bytes())
+
+	prefix := filepath.Join(t.TempDir(), "clawrden")
+	cmd := exec.Command("sh", filepath.Join(dir, BundleInstall), "sh", "-c", `echo "$PATH"`)
+	cmd.Env = append(os.Environ(), "CLAWRDEN_PREFIX="+prefix)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("install.sh: %v\n%s", err, out)
+	}
+	if !strings.HasPrefix(string(out), prefix+"/bin:") {
+		t.Errorf("entrypoint PATH = %q, want %s/bin first", out, prefix)
+	}
+
+	jail, _ := mgr.GetJail("quoted")
+	jailEntries, _ := os.ReadDir(filepath.Join(jail.JailPath, "bin"))
+	for _, e := range jailEntries {
+		if e.Name() == JailIDMarker {
+			if id, err := os.ReadFile(filepath.Join(prefix, "bin", JailIDMarker)); err != nil || string(id) != "quoted\n" {
+				t.Errorf("jail ID marker = %q, %v; want the jail ID", id, err)
+			}
+			continue
+		}
+		target, err := os.Readlink(filepath.Join(prefix, "bin", e.Name()))
+		if err != nil {
+			t.Errorf("%s not installed as a symlink: %v", e.Name(), err)
+			continue
+		}
+		if target != BundleShim {
+			t.Errorf("%s -> %s, want %s", e.Name(), target, BundleShim)
+		}
+	}
+	installed, _ := os.ReadDir(filepath.Join(prefix, "bin"))
+	if len(installed) != len(jailEntries)+1 { // Plus the shim itself
+		t.Errorf("installed %d entries, want %d", len(installed), len(jailEntries)+1)
+	}
+	if info, err := os.Stat(filepath.Join(prefix, "bin", BundleShim)); err != nil || info.Mode().Perm() != 0555 {
+		t.Errorf("shim not installed 0555: %v %v", info, err)
+	}
+	if _, err := os.Stat(filepath.Join(prefix, HardenedMarker)); err != nil {
+		t.Errorf("hardened marker missing: %v", err)
+	}
+}
+
+func TestWriteBundleUnknownJail(t *testing.T) {
+	mgr, _ := newStartedManager(t)
+	if err := mgr.WriteBundle("missing", io.Discard); err == nil {
+		t.Error("WriteBundle succeeded for a missing jail")
+	}
+}
+
+func TestBundleDir(t *testing.T) {
+	if got := BundleDir("agent-x.1"); got != "clawrden-agent-x.1" {
+		t.Errorf("BundleDir = %q", got)
+	}
+	if got := BundleDir("a b$c"); got != "clawrden-a_b_c" {
+		t.Errorf("BundleDir = %q", got)
+	}
+}
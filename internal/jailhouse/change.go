@@ -0,0 +1,101 @@
+package jailhouse
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrPartialChange is returned, with the JailChange, when some of a jail's
+// symlinks could not be added or removed. The jail's state then lists
+// exactly the commands left with a symlink, so retrying finishes the job.
+var ErrPartialChange = errors.New("jail partially changed")
+
+// JailChange is what reconciling or destroying a jail changed on disk, or
+// for a dry run would change: the commands whose symlinks were added and
+// removed, and those that could not be.
+type JailChange struct {
+	JailID  string        `json:"jail_id"`
+	DryRun  bool          `json:"dry_run,omitempty"`
+	Added   []string      `json:"added"`
+	Removed []string      `json:"removed"`
+	Failed  []LinkFailure `json:"failed,omitempty"`
+}
+
+// LinkFailure is a symlink a jail change could not add or remove.
+type LinkFailure struct {
+	Command string `json:"command"`
+	Op      string `json:"op"` // "add" or "remove"
+	Error   string `json:"error"`
+}
+
+// Empty reports whether the change adds and removes nothing.
+func (c *JailChange) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Failed) == 0
+}
+
+// fail records that op on cmd's symlink failed.
+func (c *JailChange) fail(cmd, op string, err error) {
+	c.Failed = append(c.Failed, LinkFailure{Command: cmd, Op: op, Error: err.Error()})
+}
+
+// err returns ErrPartialChange if anything failed.
+func (c *JailChange) err() error {
+	if len(c.Failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %d symlinks of jail %s failed, first %s %s: %s",
+		ErrPartialChange, len(c.Failed), c.JailID, c.Failed[0].Op, c.Failed[0].Command, c.Failed[0].Error)
+}
+
+// planReconcile returns the symlinks to remove (in the order of current)
+// and add (in the order of commands) to turn current into commands.
+func planReconcile(jailID string, current, commands []string) *JailChange {
+	change := &JailChange{JailID: jailID, Added: []string{}, Removed: []string{}}
+	have, want := makeSet(current), makeSet(commands)
+	for _, cmd := range unique(current) {
+		if !want[cmd] {
+			change.Removed = append(change.Removed, cmd)
+		}
+	}
+	for _, cmd := range unique(commands) {
+		if !have[cmd] {
+			change.Added = append(change.Added, cmd)
+		}
+	}
+	return change
+}
+
+// linkedCommands returns the commands a jail has symlinks for after a
+// change towards commands: those whose symlink could not be added are
+// missing, and those whose symlink could not be removed are still there.
+func linkedCommands(commands []string, failed []LinkFailure) []string {
+	notAdded := make(map[string]bool)
+	var notRemoved []string
+	for _, f := range failed {
+		if f.Op == "add" {
+			notAdded[f.Command] = true
+		} else {
+			notRemoved = append(notRemoved, f.Command)
+		}
+	}
+	linked := make([]string, 0, len(commands)+len(notRemoved))
+	for _, cmd := range commands {
+		if !notAdded[cmd] {
+			linked = append(linked, cmd)
+		}
+	}
+	return append(linked, notRemoved...)
+}
+
+// unique returns items without repeats, in their first order.
+func unique(items []string) []string {
+	seen := make(map[string]bool, len(items))
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		if !seen[item] {
+			seen[item] = true
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -0,0 +1,138 @@
+package jailhouse
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// linksOnDisk returns which of commands have an entry in a jail's bin directory.
+func linksOnDisk(t *testing.T, mgr *Manager, jailID string, commands ...string) []string {
+	t.Helper()
+	var found []string
+	for _, cmd := range commands {
+		if _, err := os.Lstat(filepath.Join(mgr.jailhousePath, jailID, "bin", cmd)); err == nil {
+			found = append(found, cmd)
+		}
+	}
+	return found
+}
+
+func TestReconcileJailDryRun(t *testing.T) {
+	mgr, _ := newStartedManager(t)
+	if err := mgr.CreateJail("ci", []string{"ls", "cat", "grep"}, false); err != nil {
+		t.Fatalf("CreateJail: %v", err)
+	}
+
+	change, err := mgr.ReconcileJail("ci", []string{"ls", "npm", "git", "npm"}, true)
+	if err != nil {
+		t.Fatalf("ReconcileJail: %v", err)
+	}
+	if !change.DryRun || !slices.Equal(change.Added, []string{"npm", "git"}) || !slices.Equal(change.Removed, []string{"cat", "grep"}) {
+		t.Errorf("plan = %+v", change)
+	}
+	if got := linksOnDisk(t, mgr, "ci", "ls", "cat", "grep", "npm", "git"); !slices.Equal(got, []string{"ls", "cat", "grep"}) {
+		t.Errorf("dry run changed the jail: links %v", got)
+	}
+	if state, _ := mgr.GetJail("ci"); !slices.Equal(state.Commands, []string{"ls", "cat", "grep"}) {
+		t.Errorf("dry run changed the state: %v", state.Commands)
+	}
+
+	change, err = mgr.DestroyJail("ci", true)
+	if err != nil || !change.DryRun || !slices.Equal(change.Removed, []string{"ls", "cat", "grep"}) {
+		t.Errorf("DestroyJail dry run = %+v, %v", change, err)
+	}
+	if _, err := mgr.GetJail("ci"); err != nil {
+		t.Errorf("dry run destroyed the jail: %v", err)
+	}
+}
+
+func TestReconcileJailPartialFailure(t *testing.T) {
+	mgr, _ := newStartedManager(t)
+	if err := mgr.CreateJail("ci", []string{"ls", "cat", "grep"}, false); err != nil {
+		t.Fatalf("CreateJail: %v", err)
+	}
+	binPath := filepath.Join(mgr.jailhousePath, "ci", "bin")
+
+	// A file where npm's symlink goes, and a non-empty directory in place of
+	// grep's, fail even for root
+	if err := os.WriteFile(filepath.Join(binPath, "npm"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(filepath.Join(binPath, "grep"))
+	if err := os.MkdirAll(filepath.Join(binPath, "grep", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	change, err := mgr.ReconcileJail("ci", []string{"ls", "npm", "git"}, false)
+	if !errors.Is(err, ErrPartialChange) {
+		t.Fatalf("err = %v, want ErrPartialChange", err)
+	}
+	if !slices.Equal(change.Added, []string{"git"}) || !slices.Equal(change.Removed, []string{"cat"}) {
+		t.Errorf("change = %+v", change)
+	}
+	failed := make(map[string]string)
+	for _, f := range change.Failed {
+		failed[f.Command] = f.Op
+	}
+	if len(failed) != 2 || failed["npm"] != "add" || failed["grep"] != "remove" {
+		t.Errorf("failed = %+v", change.Failed)
+	}
+
+	// The state lists what has a symlink, in memory and on disk
+	want := []string{"ls", "git", "grep"}
+	if state, _ := mgr.GetJail("ci"); !slices.Equal(state.Commands, want) {
+		t.Errorf("state commands = %v, want %v", state.Commands, want)
+	}
+	reloaded, err := NewManager(Config{ArmoryPath: mgr.armoryPath, JailhousePath: mgr.jailhousePath, StatePath: mgr.statePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reloaded.LoadState(); err != nil {
+		t.Fatalf("LoadState: %v", err)
+	}
+	if state, _ := reloaded.GetJail("ci"); !slices.Equal(state.Commands, want) {
+		t.Errorf("saved commands = %v, want %v", state.Commands, want)
+	}
+
+	// Once the obstacles are gone, a retry finishes the job
+	os.Remove(filepath.Join(binPath, "npm"))
+	os.RemoveAll(filepath.Join(binPath, "grep"))
+	change, err = mgr.ReconcileJail("ci", []string{"ls", "npm", "git"}, false)
+	if err != nil || !slices.Equal(change.Added, []string{"npm"}) || !slices.Equal(change.Removed, []string{"grep"}) {
+		t.Errorf("retry = %+v, %v", change, err)
+	}
+}
+
+func TestReadOnlyBinDirectory(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root ignores directory permissions")
+	}
+	mgr, _ := newStartedManager(t)
+	if err := mgr.CreateJail("ci", []string{"ls", "cat"}, false); err != nil {
+		t.Fatalf("CreateJail: %v", err)
+	}
+	binPath := filepath.Join(mgr.jailhousePath, "ci", "bin")
+	if err := os.Chmod(binPath, 0555); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(binPath, 0755) })
+
+	change, err := mgr.ReconcileJail("ci", []string{"ls", "npm"}, false)
+	if !errors.Is(err, ErrPartialChange) || len(change.Added) != 0 || len(change.Removed) != 0 || len(change.Failed) != 2 {
+		t.Errorf("ReconcileJail = %+v, %v", change, err)
+	}
+	if state, _ := mgr.GetJail("ci"); !slices.Equal(state.Commands, []string{"ls", "cat"}) {
+		t.Errorf("state commands = %v, want the unchanged ls, cat", state.Commands)
+	}
+
+	change, err = mgr.DestroyJail("ci", false)
+	if !errors.Is(err, ErrPartialChange) || len(change.Failed) != 2 {
+		t.Errorf("DestroyJail = %+v, %v", change, err)
+	}
+	if state, err := mgr.GetJail("ci"); err != nil || !slices.Equal(state.Commands, []string{"ls", "cat"}) {
+		t.Errorf("jail after failed destroy = %+v, %v", state, err)
+	}
+}
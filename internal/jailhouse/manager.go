@@ -1,6 +1,7 @@
 package jailhouse
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
@@ -20,7 +21,11 @@ func NewManager(cfg Config) (*Manager, error) {
 		jailhousePath: cfg.JailhousePath,
 		statePath:     cfg.StatePath,
 		jails:         make(map[string]*JailState),
+		usage:         make(map[string]*usageRecord),
 		logger:        cfg.Logger,
+		stats:         make(map[string]JailStats),
+		statsTTL:      defaultStatsTTL,
+		embeddedShim:  cfg.EmbeddedShim,
 	}
 
 	return m, nil
@@ -41,11 +46,26 @@ func (m *Manager) Start() error {
 		m.logger.Printf("warning: could not load state: %v", err)
 	}
 
-	// Ensure armory is properly set up
+	// Install the embedded shim on first run or upgrade, then check the armory
+	if err := m.installEmbeddedShim(); err != nil {
+		return fmt.Errorf("install embedded shim: %w", err)
+	}
 	if err := m.EnsureArmory(); err != nil {
 		return fmt.Errorf("ensure armory: %w", err)
 	}
 
+	// Jails created by older versions have no jail ID marker
+	m.mu.RLock()
+	for jailID, state := range m.jails {
+		binPath := filepath.Join(state.JailPath, "bin")
+		if _, err := os.Stat(filepath.Join(binPath, JailIDMarker)); os.IsNotExist(err) {
+			if err := writeJailIDMarker(binPath, jailID); err != nil {
+				m.logger.Printf("warning: %v", err)
+			}
+		}
+	}
+	m.mu.RUnlock()
+
 	m.logger.Printf("started (armory=%s, jailhouse=%s)", m.armoryPath, m.jailhousePath)
 	return nil
 }
@@ -58,7 +78,7 @@ func (m *Manager) EnsureArmory() error {
 	stat, err := os.Stat(shimPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return fmt.Errorf("master shim not found at %s (run 'make build-shim' and copy to armory)", shimPath)
+			return fmt.Errorf("master shim not found at %s (run 'make build-shim' and copy to armory, or run a warden built with an embedded shim)", shimPath)
 		}
 		return fmt.Errorf("stat shim: %w", err)
 	}
@@ -74,7 +94,11 @@ func (m *Manager) EnsureArmory() error {
 		return fmt.Errorf("shim at %s is not executable (mode: %o)", shimPath, mode)
 	}
 
-	m.logger.Printf("armory verified: shim at %s (mode: %o)", shimPath, mode)
+	source := m.shimSource
+	if source == "" {
+		source = ShimPreExisting
+	}
+	m.logger.Printf("armory verified: %s shim at %s (mode: %o)", source, shimPath, mode)
 	return nil
 }
 
@@ -86,7 +110,7 @@ func (m *Manager) CreateJail(jailID string, commands []string, hardened bool) er
 
 	// Validate command names
 	for _, cmd := range commands {
-		if err := validateCommandName(cmd); err != nil {
+		if err := ValidateCommandName(cmd); err != nil {
 			return fmt.Errorf("invalid command %q: %w", cmd, err)
 		}
 	}
@@ -118,6 +142,20 @@ func (m *Manager) CreateJail(jailID string, commands []string, hardened bool) er
 		}
 	}
 
+	// Tell shims running from the jail which jail they are in
+	if err := writeJailIDMarker(binPath, jailID); err != nil {
+		os.RemoveAll(jailPath)
+		return err
+	}
+
+	// Mark hardened jails so shims running from them can tell
+	if hardened {
+		if err := os.WriteFile(filepath.Join(jailPath, HardenedMarker), nil, 0644); err != nil {
+			os.RemoveAll(jailPath)
+			return fmt.Errorf("create hardened marker: %w", err)
+		}
+	}
+
 	// Record jail state
 	state := &JailState{
 		JailID:    jailID,
@@ -127,6 +165,8 @@ func (m *Manager) CreateJail(jailID string, commands []string, hardened bool) er
 		JailPath:  jailPath,
 	}
 	m.jails[jailID] = state
+	m.usage[jailID] = &usageRecord{Since: state.CreatedAt}
+	m.invalidateStats(jailID)
 
 	// Persist state (unlocked version - we already hold the lock)
 	if err := m.saveStateUnlocked(); err != nil {
@@ -137,23 +177,50 @@ func (m *Manager) CreateJail(jailID string, commands []string, hardened bool) er
 	return nil
 }
 
-// DestroyJail removes a jail directory and all its contents.
-func (m *Manager) DestroyJail(jailID string) error {
+// DestroyJail removes a jail directory and all its contents, and returns
+// the symlinks removed. With dryRun it only returns those it would remove.
+// If the directory cannot be removed completely, the jail is kept with the
+// symlinks that are left and ErrPartialChange is returned.
+func (m *Manager) DestroyJail(jailID string, dryRun bool) (*JailChange, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	state, exists := m.jails[jailID]
 	if !exists {
-		return fmt.Errorf("jail not found: %s", jailID)
+		return nil, fmt.Errorf("jail not found: %s", jailID)
+	}
+	change := planReconcile(jailID, state.Commands, nil)
+	if dryRun {
+		change.DryRun = true
+		return change, nil
 	}
 
 	// Remove the jail directory
 	if err := os.RemoveAll(state.JailPath); err != nil {
-		return fmt.Errorf("remove jail directory: %w", err)
+		// Whatever RemoveAll got through is gone
+		binPath := filepath.Join(state.JailPath, "bin")
+		removed := change.Removed[:0]
+		for _, cmd := range change.Removed {
+			if _, statErr := os.Lstat(filepath.Join(binPath, cmd)); statErr == nil {
+				change.fail(cmd, "remove", err)
+			} else {
+				removed = append(removed, cmd)
+			}
+		}
+		change.Removed = removed
+		state.Commands = linkedCommands(nil, change.Failed)
+		m.invalidateStats(jailID)
+		if err := m.saveStateUnlocked(); err != nil {
+			m.logger.Printf("warning: failed to save state: %v", err)
+		}
+		m.logger.Printf("warning: destroying jail %s: %v; %d symlinks left", jailID, err, len(state.Commands))
+		return change, fmt.Errorf("%w: remove jail directory: %w", ErrPartialChange, err)
 	}
 
 	// Remove from state
 	delete(m.jails, jailID)
+	delete(m.usage, jailID)
+	m.invalidateStats(jailID)
 
 	// Persist state (unlocked version - we already hold the lock)
 	if err := m.saveStateUnlocked(); err != nil {
@@ -161,9 +228,31 @@ func (m *Manager) DestroyJail(jailID string) error {
 	}
 
 	m.logger.Printf("destroyed jail %s", jailID)
+	return change, nil
+}
+
+// SetRules replaces the policy rules stored with a jail.
+func (m *Manager) SetRules(jailID string, rules json.RawMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, exists := m.jails[jailID]
+	if !exists {
+		return fmt.Errorf("jail not found: %s", jailID)
+	}
+	state.Rules = rules
+
+	if err := m.saveStateUnlocked(); err != nil {
+		m.logger.Printf("warning: failed to save state: %v", err)
+	}
 	return nil
 }
 
+// ShimPath returns the path of the master shim in the armory.
+func (m *Manager) ShimPath() string {
+	return filepath.Join(m.armoryPath, "clawrden-shim")
+}
+
 // ListJails returns a list of all active jails.
 func (m *Manager) ListJails() []*JailState {
 	m.mu.RLock()
@@ -194,67 +283,89 @@ func (m *Manager) GetJail(jailID string) (*JailState, error) {
 }
 
 // ReconcileJail updates an existing jail with a new set of commands.
-// It adds missing symlinks and removes extra ones.
-func (m *Manager) ReconcileJail(jailID string, commands []string) error {
+// It adds missing symlinks and removes extra ones, and returns what it
+// changed; with dryRun it only returns what it would change. A symlink that
+// cannot be added or removed does not stop the others: the jail's state is
+// left listing the commands that have a symlink, and ErrPartialChange is
+// returned along with the change.
+func (m *Manager) ReconcileJail(jailID string, commands []string, dryRun bool) (*JailChange, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	state, exists := m.jails[jailID]
 	if !exists {
-		return fmt.Errorf("jail not found: %s", jailID)
+		return nil, fmt.Errorf("jail not found: %s", jailID)
 	}
 
 	// Validate new command names
 	for _, cmd := range commands {
-		if err := validateCommandName(cmd); err != nil {
-			return fmt.Errorf("invalid command %q: %w", cmd, err)
+		if err := ValidateCommandName(cmd); err != nil {
+			return nil, fmt.Errorf("invalid command %q: %w", cmd, err)
 		}
 	}
 
+	change := planReconcile(jailID, state.Commands, commands)
+	if dryRun {
+		change.DryRun = true
+		return change, nil
+	}
+
 	binPath := filepath.Join(state.JailPath, "bin")
 	shimPath := filepath.Join(m.armoryPath, "clawrden-shim")
 
-	// Determine which commands to add and remove
-	oldCmds := makeSet(state.Commands)
-	newCmds := makeSet(commands)
-
 	// Remove symlinks for commands no longer needed
-	for cmd := range oldCmds {
-		if !newCmds[cmd] {
-			linkPath := filepath.Join(binPath, cmd)
-			if err := os.Remove(linkPath); err != nil && !os.IsNotExist(err) {
-				m.logger.Printf("warning: failed to remove symlink %s: %v", linkPath, err)
-			} else {
-				m.logger.Printf("removed symlink for %s in jail %s", cmd, jailID)
-			}
+	removed := make([]string, 0, len(change.Removed))
+	for _, cmd := range change.Removed {
+		linkPath := filepath.Join(binPath, cmd)
+		if err := os.Remove(linkPath); err != nil && !os.IsNotExist(err) {
+			m.logger.Printf("warning: failed to remove symlink %s: %v", linkPath, err)
+			change.fail(cmd, "remove", err)
+			continue
+		}
+		if record := m.usage[jailID]; record != nil {
+			delete(record.Commands, cmd)
 		}
+		removed = append(removed, cmd)
+		m.logger.Printf("removed symlink for %s in jail %s", cmd, jailID)
 	}
 
 	// Add symlinks for new commands
-	for cmd := range newCmds {
-		if !oldCmds[cmd] {
-			linkPath := filepath.Join(binPath, cmd)
-			if err := os.Symlink(shimPath, linkPath); err != nil {
-				return fmt.Errorf("create symlink for %s: %w", cmd, err)
-			}
-			m.logger.Printf("added symlink for %s in jail %s", cmd, jailID)
+	added := make([]string, 0, len(change.Added))
+	for _, cmd := range change.Added {
+		linkPath := filepath.Join(binPath, cmd)
+		if err := os.Symlink(shimPath, linkPath); err != nil {
+			m.logger.Printf("warning: failed to create symlink %s: %v", linkPath, err)
+			change.fail(cmd, "add", err)
+			continue
 		}
+		added = append(added, cmd)
+		m.logger.Printf("added symlink for %s in jail %s", cmd, jailID)
 	}
+	change.Added, change.Removed = added, removed
 
-	// Update state
-	state.Commands = commands
+	// Update state to what is on disk
+	state.Commands = linkedCommands(commands, change.Failed)
+	m.invalidateStats(jailID)
 
 	// Persist state (unlocked version - we already hold the lock)
 	if err := m.saveStateUnlocked(); err != nil {
 		m.logger.Printf("warning: failed to save state: %v", err)
 	}
 
-	m.logger.Printf("reconciled jail %s: %d commands", jailID, len(commands))
+	m.logger.Printf("reconciled jail %s: %d commands (+%d -%d, %d failed)", jailID, len(state.Commands), len(added), len(removed), len(change.Failed))
+	return change, change.err()
+}
+
+// writeJailIDMarker records jailID in a jail's bin directory.
+func writeJailIDMarker(binPath, jailID string) error {
+	if err := os.WriteFile(filepath.Join(binPath, JailIDMarker), []byte(jailID+"\n"), 0644); err != nil {
+		return fmt.Errorf("create jail ID marker: %w", err)
+	}
 	return nil
 }
 
-// validateCommandName ensures a command name is safe (no path traversal).
-func validateCommandName(name string) error {
+// ValidateCommandName ensures a command name is safe (no path traversal).
+func ValidateCommandName(name string) error {
 	if name == "" {
 		return fmt.Errorf("command name cannot be empty")
 	}
@@ -267,6 +378,9 @@ func validateCommandName(name string) error {
 	if strings.Contains(name, "\x00") {
 		return fmt.Errorf("command name cannot contain null bytes")
 	}
+	if name == JailIDMarker {
+		return fmt.Errorf("command name %s is reserved", JailIDMarker)
+	}
 	return nil
 }
 
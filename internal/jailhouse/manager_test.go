@@ -246,7 +246,7 @@ func TestDestroyJail(t *testing.T) {
 	}
 
 	// Destroy the jail
-	if err := mgr.DestroyJail(jailID); err != nil {
+	if _, err := mgr.DestroyJail(jailID, false); err != nil {
 		t.Fatalf("DestroyJail failed: %v", err)
 	}
 
@@ -293,7 +293,7 @@ func TestReconcileJail(t *testing.T) {
 
 	// Reconcile with new command set (remove grep, add npm)
 	newCmds := []string{"ls", "cat", "npm"}
-	if err := mgr.ReconcileJail(jailID, newCmds); err != nil {
+	if _, err := mgr.ReconcileJail(jailID, newCmds, false); err != nil {
 		t.Fatalf("ReconcileJail: %v", err)
 	}
 
@@ -388,4 +388,12 @@ func TestStatePersistence(t *testing.T) {
 	if !state2.Hardened {
 		t.Errorf("jail2 should be hardened")
 	}
+
+	// Only the hardened jail carries the marker the shim checks
+	if _, err := os.Stat(filepath.Join(state2.JailPath, HardenedMarker)); err != nil {
+		t.Errorf("jail2 missing hardened marker: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(state.JailPath, HardenedMarker)); !os.IsNotExist(err) {
+		t.Errorf("jail1 should not have a hardened marker")
+	}
 }
@@ -0,0 +1,100 @@
+package jailhouse
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Where the armory's active shim came from, as logged at startup.
+const (
+	ShimEmbedded    = "embedded"     // Installed by the warden from its own binary
+	ShimPreExisting = "pre-existing" // Put into the armory some other way
+)
+
+// EmbeddedShimMarker is written next to a shim the warden installed from its
+// embedded copy and holds the shim's checksum. A later warden only replaces
+// the shim while it still matches; anything else in the armory was put there
+// on purpose and is left alone.
+const EmbeddedShimMarker = ".clawrden-shim.embedded"
+
+// installEmbeddedShim installs the embedded shim into the armory when the
+// armory has none, or when its shim is an older embedded copy.
+func (m *Manager) installEmbeddedShim() error {
+	if m.embeddedShim == nil {
+		return nil
+	}
+	shimPath := filepath.Join(m.armoryPath, "clawrden-shim")
+	markerPath := filepath.Join(m.armoryPath, EmbeddedShimMarker)
+	want := shimChecksum(m.embeddedShim)
+
+	current, err := fileChecksum(shimPath)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return fmt.Errorf("checksum shim: %w", err)
+	case current == want:
+		m.shimSource = ShimEmbedded
+		return nil
+	default:
+		installed, _ := os.ReadFile(markerPath)
+		if strings.TrimSpace(string(installed)) != current {
+			m.logger.Printf("warning: keeping pre-existing shim at %s (sha256 %s), which differs from the embedded shim (sha256 %s)",
+				shimPath, current[:12], want[:12])
+			m.shimSource = ShimPreExisting
+			return nil
+		}
+	}
+
+	// Write next to the shim and rename, so running shims keep their binary
+	tmp, err := os.CreateTemp(m.armoryPath, ".clawrden-shim-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(m.embeddedShim); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0555); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), shimPath); err != nil {
+		return err
+	}
+	if err := os.WriteFile(markerPath, []byte(want+"\n"), 0644); err != nil {
+		return fmt.Errorf("write %s: %w", EmbeddedShimMarker, err)
+	}
+
+	m.shimSource = ShimEmbedded
+	m.logger.Printf("installed embedded shim at %s (sha256 %s)", shimPath, want[:12])
+	return nil
+}
+
+// shimChecksum returns the hex SHA-256 of a shim binary.
+func shimChecksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// fileChecksum returns the hex SHA-256 of a file.
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,99 @@
+package jailhouse
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// startWithEmbeddedShim starts a manager whose armory is seeded by setup.
+func startWithEmbeddedShim(t *testing.T, embedded []byte, setup func(armory string)) (*Manager, string, *bytes.Buffer) {
+	t.Helper()
+	dir := t.TempDir()
+	armory := filepath.Join(dir, "armory")
+	if err := os.MkdirAll(armory, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if setup != nil {
+		setup(armory)
+	}
+	var logs bytes.Buffer
+	mgr, _ := NewManager(Config{
+		ArmoryPath:    armory,
+		JailhousePath: filepath.Join(dir, "jailhouse"),
+		StatePath:     filepath.Join(dir, "state.json"),
+		Logger:        log.New(&logs, "", 0),
+		EmbeddedShim:  embedded,
+	})
+	if err := mgr.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	return mgr, filepath.Join(armory, "clawrden-shim"), &logs
+}
+
+func TestEmbeddedShimInstalledIntoEmptyArmory(t *testing.T) {
+	mgr, shimPath, logs := startWithEmbeddedShim(t, []byte("embedded v1"), nil)
+
+	data, err := os.ReadFile(shimPath)
+	if err != nil || string(data) != "embedded v1" {
+		t.Fatalf("armory shim = %q, %v; want the embedded shim", data, err)
+	}
+	if info, _ := os.Stat(shimPath); info.Mode().Perm() != 0555 {
+		t.Errorf("shim mode = %o, want 555", info.Mode().Perm())
+	}
+	if mgr.shimSource != ShimEmbedded || !strings.Contains(logs.String(), "armory verified: embedded shim") {
+		t.Errorf("source = %q, logs:\n%s", mgr.shimSource, logs)
+	}
+
+	// A newer warden replaces the shim it installed itself
+	mgr, _, _ = startWithEmbeddedShim(t, []byte("embedded v2"), func(armory string) {
+		os.WriteFile(filepath.Join(armory, "clawrden-shim"), []byte("embedded v1"), 0555)
+		os.WriteFile(filepath.Join(armory, EmbeddedShimMarker), []byte(shimChecksum([]byte("embedded v1"))+"\n"), 0644)
+	})
+	if data, _ := os.ReadFile(filepath.Join(mgr.armoryPath, "clawrden-shim")); string(data) != "embedded v2" {
+		t.Errorf("upgraded shim = %q, want embedded v2", data)
+	}
+}
+
+func TestEmbeddedShimKeepsExistingShim(t *testing.T) {
+	tests := []struct {
+		name   string
+		marker string // Contents of the embedded marker, if any
+	}{
+		{"placed by an operator", ""},
+		{"installed by the warden, then replaced", shimChecksum([]byte("embedded v1"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mgr, shimPath, logs := startWithEmbeddedShim(t, []byte("embedded v2"), func(armory string) {
+				os.WriteFile(filepath.Join(armory, "clawrden-shim"), []byte("approved build"), 0755)
+				if tt.marker != "" {
+					os.WriteFile(filepath.Join(armory, EmbeddedShimMarker), []byte(tt.marker), 0644)
+				}
+			})
+			if data, _ := os.ReadFile(shimPath); string(data) != "approved build" {
+				t.Errorf("armory shim = %q, want the existing shim kept", data)
+			}
+			if mgr.shimSource != ShimPreExisting || !strings.Contains(logs.String(), "keeping pre-existing shim") {
+				t.Errorf("source = %q, logs:\n%s", mgr.shimSource, logs)
+			}
+		})
+	}
+}
+
+func TestNoEmbeddedShimRequiresArmoryShim(t *testing.T) {
+	dir := t.TempDir()
+	mgr, _ := NewManager(Config{
+		ArmoryPath:    filepath.Join(dir, "armory"),
+		JailhousePath: filepath.Join(dir, "jailhouse"),
+		StatePath:     filepath.Join(dir, "state.json"),
+		Logger:        log.New(io.Discard, "", 0),
+	})
+	if err := mgr.Start(); err == nil || !strings.Contains(err.Error(), "master shim not found") {
+		t.Errorf("Start error = %v, want the missing shim reported", err)
+	}
+}
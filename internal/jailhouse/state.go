@@ -13,6 +13,9 @@ type persistedState struct {
 	Version string                 `json:"version"`
 	Updated time.Time              `json:"updated"`
 	Jails   map[string]*JailState `json:"jails"`
+
+	// Usage holds each jail's command usage counters (see usage.go)
+	Usage map[string]*usageRecord `json:"usage,omitempty"`
 }
 
 // SaveState persists the current jailhouse state to disk.
@@ -30,6 +33,7 @@ func (m *Manager) saveStateUnlocked() error {
 		Version: "1.0",
 		Updated: time.Now(),
 		Jails:   m.jails,
+		Usage:   m.usage,
 	}
 
 	// Marshal to JSON
@@ -79,6 +83,16 @@ func (m *Manager) LoadState() error {
 		m.jails = make(map[string]*JailState)
 	}
 
+	// Usage of jails saved before usage was counted is unknown until now
+	m.usage = make(map[string]*usageRecord)
+	for jailID := range m.jails {
+		if record, ok := state.Usage[jailID]; ok && record != nil {
+			m.usage[jailID] = record
+		} else {
+			m.usage[jailID] = &usageRecord{Since: time.Now()}
+		}
+	}
+
 	m.logger.Printf("loaded state: %d jails (version=%s, updated=%s)",
 		len(m.jails), state.Version, state.Updated.Format(time.RFC3339))
 
@@ -97,6 +111,7 @@ func (m *Manager) ReconcileState() error {
 		if _, err := os.Stat(state.JailPath); os.IsNotExist(err) {
 			m.logger.Printf("removing stale state for jail %s (directory not found)", jailID)
 			delete(m.jails, jailID)
+			delete(m.usage, jailID)
 			removed++
 		}
 	}
@@ -0,0 +1,131 @@
+package jailhouse
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// defaultStatsTTL bounds how often a jail directory is re-scanned.
+// Listing jails reuses cached stats so it stays fast with many jails.
+const defaultStatsTTL = 10 * time.Second
+
+// JailStats describes what is actually on disk for a jail.
+type JailStats struct {
+	Links         int       `json:"links"`          // Entries present in bin/
+	ExpectedLinks int       `json:"expected_links"` // Commands recorded in state
+	Drifted       bool      `json:"drifted"`        // Links != ExpectedLinks
+	DiskBytes     int64     `json:"disk_bytes"`     // Apparent size of files and links in the jail
+	Hardened      bool      `json:"hardened"`       // Hardened marker present on disk
+	VerifiedAt    time.Time `json:"verified_at"`    // When the directory was last scanned
+}
+
+// Inventory summarizes the whole jailhouse.
+type Inventory struct {
+	Jails          int       `json:"jails"`
+	Symlinks       int       `json:"symlinks"`
+	DiskBytes      int64     `json:"disk_bytes"`
+	StateFileBytes int64     `json:"state_file_bytes"`
+	LastSave       time.Time `json:"last_save,omitempty"`
+}
+
+// JailStats returns on-disk stats for a jail, scanning its directory only if
+// the cached result is older than the cache TTL.
+func (m *Manager) JailStats(jailID string) (JailStats, error) {
+	state, err := m.GetJail(jailID)
+	if err != nil {
+		return JailStats{}, err
+	}
+	return m.statsFor(state)
+}
+
+// Inventory returns jailhouse-wide totals.
+func (m *Manager) Inventory() Inventory {
+	var inv Inventory
+	for _, state := range m.ListJails() {
+		inv.Jails++
+		stats, err := m.statsFor(state)
+		if err != nil {
+			m.logger.Printf("warning: stats for jail %s: %v", state.JailID, err)
+			continue
+		}
+		inv.Symlinks += stats.Links
+		inv.DiskBytes += stats.DiskBytes
+	}
+
+	// The state file is always replaced by rename, so its mtime is the last save
+	if info, err := os.Stat(m.statePath); err == nil {
+		inv.StateFileBytes = info.Size()
+		inv.LastSave = info.ModTime()
+	}
+	return inv
+}
+
+// statsFor returns cached stats for state, refreshing them when stale.
+func (m *Manager) statsFor(state *JailState) (JailStats, error) {
+	m.statsMu.Lock()
+	cached, ok := m.stats[state.JailID]
+	m.statsMu.Unlock()
+	if ok && time.Since(cached.VerifiedAt) < m.statsTTL {
+		return cached, nil
+	}
+
+	stats, err := scanJail(state)
+	if err != nil {
+		return JailStats{}, err
+	}
+
+	m.statsMu.Lock()
+	m.stats[state.JailID] = stats
+	m.statsMu.Unlock()
+	return stats, nil
+}
+
+// invalidateStats drops a jail's cached stats after it changes.
+func (m *Manager) invalidateStats(jailID string) {
+	m.statsMu.Lock()
+	delete(m.stats, jailID)
+	m.statsMu.Unlock()
+}
+
+// scanJail walks a jail directory. Symlinks are counted, not followed.
+func scanJail(state *JailState) (JailStats, error) {
+	stats := JailStats{
+		ExpectedLinks: len(state.Commands),
+		VerifiedAt:    time.Now(),
+	}
+
+	entries, err := os.ReadDir(filepath.Join(state.JailPath, "bin"))
+	if err != nil {
+		return JailStats{}, fmt.Errorf("read bin directory: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != JailIDMarker {
+			stats.Links++
+		}
+	}
+	stats.Drifted = stats.Links != stats.ExpectedLinks
+
+	if _, err := os.Lstat(filepath.Join(state.JailPath, HardenedMarker)); err == nil {
+		stats.Hardened = true
+	}
+
+	err = filepath.WalkDir(state.JailPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		stats.DiskBytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return JailStats{}, fmt.Errorf("measure jail directory: %w", err)
+	}
+
+	return stats, nil
+}
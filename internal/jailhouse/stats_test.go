@@ -0,0 +1,115 @@
+package jailhouse
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newStartedManager returns a started manager with a shim in its armory.
+func newStartedManager(t *testing.T) (*Manager, string) {
+	t.Helper()
+	tempDir := t.TempDir()
+	armoryPath := filepath.Join(tempDir, "armory")
+	if err := os.MkdirAll(armoryPath, 0755); err != nil {
+		t.Fatalf("create armory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(armoryPath, "clawrden-shim"), []byte("#!/bin/sh\necho test"), 0755); err != nil {
+		t.Fatalf("create shim: %v", err)
+	}
+
+	mgr, err := NewManager(Config{
+		ArmoryPath:    armoryPath,
+		JailhousePath: filepath.Join(tempDir, "jailhouse"),
+		StatePath:     filepath.Join(tempDir, "state.json"),
+	})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	if err := mgr.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	return mgr, filepath.Join(armoryPath, "clawrden-shim")
+}
+
+func TestJailStats(t *testing.T) {
+	mgr, shimPath := newStartedManager(t)
+
+	if err := mgr.CreateJail("plain", []string{"ls", "npm", "git"}, false); err != nil {
+		t.Fatalf("CreateJail: %v", err)
+	}
+	if err := mgr.CreateJail("locked", []string{"cat"}, true); err != nil {
+		t.Fatalf("CreateJail: %v", err)
+	}
+
+	stats, err := mgr.JailStats("plain")
+	if err != nil {
+		t.Fatalf("JailStats: %v", err)
+	}
+	// Each symlink's size is the length of its target path; the jail ID
+	// marker holds the ID and a newline
+	linkSize := int64(len(shimPath))
+	markerSize := func(jailID string) int64 { return int64(len(jailID) + 1) }
+	if stats.Links != 3 || stats.ExpectedLinks != 3 || stats.Drifted {
+		t.Errorf("plain links = %+v, want 3/3 without drift", stats)
+	}
+	if want := 3*linkSize + markerSize("plain"); stats.DiskBytes != want {
+		t.Errorf("plain DiskBytes = %d, want %d", stats.DiskBytes, want)
+	}
+	if stats.Hardened || stats.VerifiedAt.IsZero() {
+		t.Errorf("plain stats = %+v", stats)
+	}
+
+	locked, err := mgr.JailStats("locked")
+	if err != nil {
+		t.Fatalf("JailStats: %v", err)
+	}
+	if !locked.Hardened || locked.Links != 1 || locked.DiskBytes != linkSize+markerSize("locked") {
+		t.Errorf("locked stats = %+v", locked)
+	}
+
+	// Stats are cached until they expire
+	os.Remove(filepath.Join(mgr.jailhousePath, "plain", "bin", "git"))
+	if cached, _ := mgr.JailStats("plain"); cached.Links != 3 {
+		t.Errorf("cached Links = %d, want 3", cached.Links)
+	}
+	mgr.statsTTL = 0
+	stats, _ = mgr.JailStats("plain")
+	if stats.Links != 2 || !stats.Drifted {
+		t.Errorf("after removing a link: %+v, want 2 links and drift", stats)
+	}
+
+	inv := mgr.Inventory()
+	if inv.Jails != 2 || inv.Symlinks != 3 || inv.DiskBytes != 3*linkSize+markerSize("plain")+markerSize("locked") {
+		t.Errorf("Inventory = %+v", inv)
+	}
+	info, err := os.Stat(mgr.statePath)
+	if err != nil {
+		t.Fatalf("stat state file: %v", err)
+	}
+	if inv.StateFileBytes != info.Size() || !inv.LastSave.Equal(info.ModTime()) {
+		t.Errorf("Inventory state file = %d bytes at %v, want %d at %v",
+			inv.StateFileBytes, inv.LastSave, info.Size(), info.ModTime())
+	}
+
+	if _, err := mgr.JailStats("missing"); err == nil {
+		t.Error("JailStats for unknown jail should fail")
+	}
+}
+
+func TestJailStatsInvalidatedOnReconcile(t *testing.T) {
+	mgr, _ := newStartedManager(t)
+	if err := mgr.CreateJail("agent", []string{"ls"}, false); err != nil {
+		t.Fatalf("CreateJail: %v", err)
+	}
+	if stats, _ := mgr.JailStats("agent"); stats.Links != 1 {
+		t.Fatalf("Links = %d, want 1", stats.Links)
+	}
+
+	if _, err := mgr.ReconcileJail("agent", []string{"ls", "npm"}, false); err != nil {
+		t.Fatalf("ReconcileJail: %v", err)
+	}
+	if stats, _ := mgr.JailStats("agent"); stats.Links != 2 || stats.ExpectedLinks != 2 {
+		t.Errorf("after reconcile: %+v, want 2/2", stats)
+	}
+}
@@ -3,6 +3,7 @@
 package jailhouse
 
 import (
+	"encoding/json"
 	"log"
 	"sync"
 	"time"
@@ -18,6 +19,16 @@ type Manager struct {
 	mu            sync.RWMutex        // Protects jails map
 	jails         map[string]*JailState // jailID -> state
 	logger        *log.Logger
+
+	statsMu    sync.Mutex           // Protects stats
+	stats      map[string]JailStats // jailID -> cached on-disk stats
+	statsTTL   time.Duration        // How long cached stats stay fresh
+
+	// Per-jail command usage counters, saved with the state (protected by mu)
+	usage map[string]*usageRecord
+
+	embeddedShim []byte // Shim to install into the armory; nil keeps the armory as is
+	shimSource   string // Where the active shim came from: embedded or pre-existing
 }
 
 // JailState represents the state of a single jail.
@@ -27,12 +38,29 @@ type JailState struct {
 	Hardened  bool      `json:"hardened"`
 	CreatedAt time.Time `json:"created_at"`
 	JailPath  string    `json:"jail_path"`
+
+	// Rules are policy rules for requests from this jail, in the warden's
+	// rule format. The jailhouse stores them without interpreting them.
+	Rules json.RawMessage `json:"rules,omitempty"`
 }
 
+// HardenedMarker is created in a hardened jail's directory (next to bin/).
+// The shim looks for it to disable debugging escape hatches like --clawrden-debug.
+const HardenedMarker = ".hardened"
+
+// JailIDMarker is created in every jail's bin/ directory and holds the jail
+// ID. The shim sends it with requests so the jail's rules apply.
+const JailIDMarker = ".clawrden-jail"
+
 // Config holds configuration for creating a new Manager.
 type Config struct {
 	ArmoryPath    string
 	JailhousePath string
 	StatePath     string
 	Logger        *log.Logger
+
+	// EmbeddedShim is installed into the armory when it has no shim, or
+	// replaces a shim installed from an earlier embedded copy. nil requires
+	// the armory to provide the shim.
+	EmbeddedShim []byte
 }
@@ -0,0 +1,135 @@
+package jailhouse
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// CommandUsage counts the requests made through one of a jail's commands.
+type CommandUsage struct {
+	Command  string     `json:"command"`
+	Count    int64      `json:"count"`
+	LastUsed *time.Time `json:"last_used,omitempty"` // nil if never used
+}
+
+// JailUsage is how a jail's commands have been used since counting began.
+type JailUsage struct {
+	JailID       string         `json:"jail_id"`
+	TrackedSince time.Time      `json:"tracked_since"` // Jail creation, or the first start that counted its usage
+	Commands     []CommandUsage `json:"commands"`      // Every command of the jail, by name
+}
+
+// Unused returns the commands never used since counting began.
+func (u JailUsage) Unused() []string {
+	var unused []string
+	for _, c := range u.Commands {
+		if c.Count == 0 {
+			unused = append(unused, c.Command)
+		}
+	}
+	return unused
+}
+
+// usageRecord is a jail's persisted usage counters.
+type usageRecord struct {
+	Since    time.Time                `json:"since"`
+	Commands map[string]*commandCount `json:"commands,omitempty"`
+}
+
+type commandCount struct {
+	Count    int64     `json:"count"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+// usageFor returns a jail's usage record, starting one at since if the jail
+// has none. Caller must hold the write lock.
+func (m *Manager) usageFor(jailID string, since time.Time) *usageRecord {
+	record, ok := m.usage[jailID]
+	if !ok {
+		record = &usageRecord{Since: since, Commands: make(map[string]*commandCount)}
+		m.usage[jailID] = record
+	}
+	if record.Commands == nil {
+		record.Commands = make(map[string]*commandCount)
+	}
+	return record
+}
+
+// RecordUse counts a request made through command in a jail and persists
+// the counters. Commands the jail does not have are not counted.
+func (m *Manager) RecordUse(jailID, command string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, exists := m.jails[jailID]
+	if !exists {
+		return fmt.Errorf("jail not found: %s", jailID)
+	}
+	if !slices.Contains(state.Commands, command) {
+		return fmt.Errorf("jail %s has no command %s", jailID, command)
+	}
+
+	record := m.usageFor(jailID, state.CreatedAt)
+	count := record.Commands[command]
+	if count == nil {
+		count = &commandCount{}
+		record.Commands[command] = count
+	}
+	count.Count++
+	count.LastUsed = at
+
+	if err := m.saveStateUnlocked(); err != nil {
+		m.logger.Printf("warning: failed to save state: %v", err)
+	}
+	return nil
+}
+
+// Usage returns the usage counters of a jail's commands.
+func (m *Manager) Usage(jailID string) (JailUsage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	state, exists := m.jails[jailID]
+	if !exists {
+		return JailUsage{}, fmt.Errorf("jail not found: %s", jailID)
+	}
+	usage := JailUsage{JailID: jailID, TrackedSince: state.CreatedAt}
+	record := m.usage[jailID]
+	if record != nil {
+		usage.TrackedSince = record.Since
+	}
+
+	commands := slices.Clone(state.Commands)
+	slices.Sort(commands)
+	for _, cmd := range slices.Compact(commands) {
+		c := CommandUsage{Command: cmd}
+		if record != nil {
+			if count := record.Commands[cmd]; count != nil {
+				lastUsed := count.LastUsed
+				c.Count, c.LastUsed = count.Count, &lastUsed
+			}
+		}
+		usage.Commands = append(usage.Commands, c)
+	}
+	return usage, nil
+}
+
+// JailForBinDir returns the jail whose bin directory is dir, for shims that
+// report where they were invoked from but not a jail ID.
+func (m *Manager) JailForBinDir(dir string) (string, bool) {
+	if dir == "" {
+		return "", false
+	}
+	dir = filepath.Clean(dir)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for jailID, state := range m.jails {
+		if filepath.Join(state.JailPath, "bin") == dir {
+			return jailID, true
+		}
+	}
+	return "", false
+}
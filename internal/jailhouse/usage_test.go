@@ -0,0 +1,144 @@
+package jailhouse
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// restart loads a manager's state into a new manager, as a warden restart
+// would.
+func restart(t *testing.T, m *Manager) *Manager {
+	t.Helper()
+	restarted, err := NewManager(Config{ArmoryPath: m.armoryPath, JailhousePath: m.jailhousePath, StatePath: m.statePath})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	if err := restarted.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	return restarted
+}
+
+func TestRecordUse(t *testing.T) {
+	mgr, _ := newStartedManager(t)
+	if err := mgr.CreateJail("ci", []string{"npm", "git", "ls"}, false); err != nil {
+		t.Fatalf("CreateJail: %v", err)
+	}
+
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := range 3 {
+		if err := mgr.RecordUse("ci", "npm", at.Add(time.Duration(i)*time.Minute)); err != nil {
+			t.Fatalf("RecordUse: %v", err)
+		}
+	}
+	if err := mgr.RecordUse("ci", "ls", at); err != nil {
+		t.Fatalf("RecordUse: %v", err)
+	}
+	if err := mgr.RecordUse("ci", "curl", at); err == nil {
+		t.Error("RecordUse counted a command the jail does not have")
+	}
+	if err := mgr.RecordUse("nope", "npm", at); err == nil {
+		t.Error("RecordUse counted a use of an unknown jail")
+	}
+
+	// Counters survive a restart
+	usage, err := restart(t, mgr).Usage("ci")
+	if err != nil {
+		t.Fatalf("Usage: %v", err)
+	}
+	var got []string
+	for _, c := range usage.Commands {
+		got = append(got, c.Command)
+	}
+	if !slices.Equal(got, []string{"git", "ls", "npm"}) {
+		t.Fatalf("commands = %v, want every command of the jail by name", got)
+	}
+	git, ls, npm := usage.Commands[0], usage.Commands[1], usage.Commands[2]
+	if git.Count != 0 || git.LastUsed != nil || ls.Count != 1 || npm.Count != 3 || !npm.LastUsed.Equal(at.Add(2*time.Minute)) {
+		t.Errorf("usage = %+v", usage.Commands)
+	}
+	if !slices.Equal(usage.Unused(), []string{"git"}) {
+		t.Errorf("Unused = %v, want git", usage.Unused())
+	}
+	if state, _ := mgr.GetJail("ci"); !usage.TrackedSince.Equal(state.CreatedAt) {
+		t.Errorf("TrackedSince = %v, want the jail's creation %v", usage.TrackedSince, state.CreatedAt)
+	}
+}
+
+func TestUsageFollowsJailChanges(t *testing.T) {
+	mgr, _ := newStartedManager(t)
+	if err := mgr.CreateJail("ci", []string{"npm", "git"}, false); err != nil {
+		t.Fatalf("CreateJail: %v", err)
+	}
+	mgr.RecordUse("ci", "git", time.Now())
+
+	// Re-adding a removed command starts its count from zero
+	if _, err := mgr.ReconcileJail("ci", []string{"npm"}, false); err != nil {
+		t.Fatalf("ReconcileJail: %v", err)
+	}
+	if _, err := mgr.ReconcileJail("ci", []string{"npm", "git"}, false); err != nil {
+		t.Fatalf("ReconcileJail: %v", err)
+	}
+	if usage, _ := mgr.Usage("ci"); !slices.Equal(usage.Unused(), []string{"git", "npm"}) {
+		t.Errorf("Unused = %v after re-adding git", usage.Unused())
+	}
+
+	// A recreated jail starts from scratch
+	mgr.RecordUse("ci", "npm", time.Now())
+	if _, err := mgr.DestroyJail("ci", false); err != nil {
+		t.Fatalf("DestroyJail: %v", err)
+	}
+	if err := mgr.CreateJail("ci", []string{"npm"}, false); err != nil {
+		t.Fatalf("CreateJail: %v", err)
+	}
+	if usage, _ := mgr.Usage("ci"); usage.Commands[0].Count != 0 {
+		t.Errorf("recreated jail has %d uses of npm", usage.Commands[0].Count)
+	}
+}
+
+func TestUsageOfJailsSavedBeforeCounting(t *testing.T) {
+	mgr, _ := newStartedManager(t)
+	created := time.Now().Add(-90 * 24 * time.Hour)
+	state := `{"version":"1.0","jails":{"old":{"jail_id":"old","commands":["ls"],"created_at":"` +
+		created.Format(time.RFC3339Nano) + `","jail_path":"` + filepath.Join(mgr.jailhousePath, "old") + `"}}}`
+	if err := os.WriteFile(mgr.statePath, []byte(state), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now()
+	usage, err := restart(t, mgr).Usage("old")
+	if err != nil {
+		t.Fatalf("Usage: %v", err)
+	}
+	// Its commands may have been used before; counting starts now
+	if usage.TrackedSince.Before(before) {
+		t.Errorf("TrackedSince = %v, want the load time, not the creation %v", usage.TrackedSince, created)
+	}
+}
+
+func TestJailForBinDir(t *testing.T) {
+	mgr, _ := newStartedManager(t)
+	if err := mgr.CreateJail("ci", []string{"npm"}, false); err != nil {
+		t.Fatalf("CreateJail: %v", err)
+	}
+
+	tests := []struct {
+		dir    string
+		want   string
+		wantOK bool
+	}{
+		{filepath.Join(mgr.jailhousePath, "ci", "bin"), "ci", true},
+		{filepath.Join(mgr.jailhousePath, "ci", "bin") + "/", "ci", true},
+		{filepath.Join(mgr.jailhousePath, "ci"), "", false},
+		{"/usr/bin", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := mgr.JailForBinDir(tt.dir); got != tt.want || ok != tt.wantOK {
+			t.Errorf("JailForBinDir(%q) = %q, %v; want %q, %v", tt.dir, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// Package securefile checks that a file the warden trusts, such as its
+// policy or its audit log, cannot be swapped or rewritten by a less
+// privileged user: the file is a regular file, and neither it nor any
+// directory leading to it, symlinks included, is owned or writable by
+// someone untrusted.
+//
+// Owners and writers of the directories matter as much as the file's own:
+// whoever can write to a parent directory can replace the file with a
+// symlink to /dev/null between restarts.
+package securefile
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Expectations say who may control a checked file.
+type Expectations struct {
+	// Users who may own the file. Directories may also be owned by root.
+	// Empty means root and the current effective user.
+	Owners []uint32
+
+	// Groups whose write access to the file and its directories is
+	// acceptable. Empty means root's group and the current effective group.
+	Groups []uint32
+
+	// A file that does not exist passes as long as its directories do:
+	// the warden creates its audit log, and runs with a deny-all policy
+	// when the policy file is missing.
+	AllowMissing bool
+}
+
+// ParseOwner parses "user[:group]", by name or numeric ID, into
+// expectations that trust only that user and group.
+func ParseOwner(s string) (Expectations, error) {
+	name, group, hasGroup := strings.Cut(s, ":")
+	var exp Expectations
+	uid, err := lookupID(name, func(n string) (string, error) {
+		u, err := user.Lookup(n)
+		if err != nil {
+			return "", err
+		}
+		return u.Uid, nil
+	})
+	if err != nil {
+		return exp, fmt.Errorf("owner %q: %w", s, err)
+	}
+	exp.Owners = []uint32{uid}
+	if hasGroup {
+		gid, err := lookupID(group, func(n string) (string, error) {
+			g, err := user.LookupGroup(n)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return exp, fmt.Errorf("owner %q: %w", s, err)
+		}
+		exp.Groups = []uint32{gid}
+	}
+	return exp, nil
+}
+
+// lookupID returns a numeric ID as is and looks names up.
+func lookupID(s string, lookup func(string) (string, error)) (uint32, error) {
+	if s == "" {
+		return 0, errors.New("empty name")
+	}
+	if id, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return uint32(id), nil
+	}
+	id, err := lookup(s)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(id, 10, 32)
+	return uint32(n), err
+}
+
+// Error lists what makes a file untrustworthy.
+type Error struct {
+	Path     string
+	Problems []string
+}
+
+func (e *Error) Error() string {
+	return e.Path + ": " + strings.Join(e.Problems, "; ")
+}
+
+// Check reports, as an *Error, every way path fails exp. Other errors mean
+// the file could not be inspected.
+func Check(path string, exp Expectations) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if len(exp.Owners) == 0 {
+		exp.Owners = []uint32{0, uint32(os.Geteuid())}
+	}
+	if len(exp.Groups) == 0 {
+		exp.Groups = []uint32{0, uint32(os.Getegid())}
+	}
+
+	var problems []string
+	info, err := os.Lstat(abs)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		if !exp.AllowMissing {
+			problems = append(problems, "does not exist")
+		}
+	case err != nil:
+		return err
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, _ := os.Readlink(abs)
+		problems = append(problems, fmt.Sprintf("is a symlink to %s", target))
+	case !info.Mode().IsRegular():
+		problems = append(problems, fmt.Sprintf("is not a regular file (%s)", info.Mode().Type()))
+	default:
+		problems = append(problems, exp.checkEntry("the file", info, exp.Owners)...)
+	}
+
+	problems = append(problems, exp.checkDirs(filepath.Dir(abs), make(map[string]bool))...)
+	if len(problems) > 0 {
+		return &Error{Path: path, Problems: problems}
+	}
+	return nil
+}
+
+// checkDirs checks dir and every directory above it. A symlinked directory
+// must be owned by a trusted user, and its target is checked in turn.
+func (exp Expectations) checkDirs(dir string, seen map[string]bool) []string {
+	var problems []string
+	dirOwners := append([]uint32{0}, exp.Owners...)
+	for d := dir; !seen[d]; d = filepath.Dir(d) {
+		seen[d] = true
+		info, err := os.Lstat(d)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("directory %s: %v", d, errors.Unwrap(err)))
+		} else if info.Mode()&fs.ModeSymlink != 0 {
+			if uid, _ := owner(info); !slices.Contains(dirOwners, uid) {
+				problems = append(problems, fmt.Sprintf("directory %s is a symlink owned by uid %d", d, uid))
+			}
+			if target, err := filepath.EvalSymlinks(d); err != nil {
+				problems = append(problems, fmt.Sprintf("directory %s: %v", d, err))
+			} else {
+				problems = append(problems, exp.checkDirs(target, seen)...)
+			}
+		} else {
+			problems = append(problems, exp.checkEntry("directory "+d, info, dirOwners)...)
+		}
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	return problems
+}
+
+// checkEntry checks who owns, and who may write to, a file or directory.
+// World-writable directories with the sticky bit, like /tmp, pass: others
+// cannot remove or rename what they do not own there.
+func (exp Expectations) checkEntry(what string, info fs.FileInfo, owners []uint32) []string {
+	var problems []string
+	uid, gid := owner(info)
+	if !slices.Contains(owners, uid) {
+		problems = append(problems, fmt.Sprintf("%s is owned by uid %d", what, uid))
+	}
+	perm := info.Mode().Perm()
+	if info.IsDir() && info.Mode()&fs.ModeSticky != 0 {
+		return problems
+	}
+	if perm&0o002 != 0 {
+		problems = append(problems, fmt.Sprintf("%s is writable by everyone (%04o)", what, perm))
+	}
+	if perm&0o020 != 0 && !slices.Contains(exp.Groups, gid) {
+		problems = append(problems, fmt.Sprintf("%s is writable by group %d (%04o)", what, gid, perm))
+	}
+	return problems
+}
+
+// owner returns the user and group owning a file.
+func owner(info fs.FileInfo) (uid, gid uint32) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0
+	}
+	return st.Uid, st.Gid
+}
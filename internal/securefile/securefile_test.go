@@ -0,0 +1,204 @@
+package securefile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// nobody is an unprivileged owner for the cases that need one.
+const nobody = 65534
+
+func writeFile(t *testing.T, path string, mode os.FileMode) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("default_action: deny\n"), mode); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, mode); err != nil { // Past the umask
+		t.Fatal(err)
+	}
+}
+
+// chown gives path to another user, which needs root.
+func chown(t *testing.T, path string, uid, gid int) {
+	t.Helper()
+	if os.Geteuid() != 0 {
+		t.Skip("changing ownership needs root")
+	}
+	if err := os.Lchown(path, uid, gid); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(t *testing.T, dir string) string // Returns the path to check
+		exp      Expectations
+		problems []string // Substrings of the problems reported
+	}{
+		{
+			name: "regular file",
+			setup: func(t *testing.T, dir string) string {
+				writeFile(t, filepath.Join(dir, "policy.yaml"), 0644)
+				return filepath.Join(dir, "policy.yaml")
+			},
+		},
+		{
+			name: "missing audit log",
+			setup: func(t *testing.T, dir string) string {
+				return filepath.Join(dir, "audit.log")
+			},
+			exp: Expectations{AllowMissing: true},
+		},
+		{
+			name: "missing",
+			setup: func(t *testing.T, dir string) string {
+				return filepath.Join(dir, "policy.yaml")
+			},
+			problems: []string{"does not exist"},
+		},
+		{
+			name: "symlink to /dev/null",
+			setup: func(t *testing.T, dir string) string {
+				os.Symlink("/dev/null", filepath.Join(dir, "audit.log"))
+				return filepath.Join(dir, "audit.log")
+			},
+			exp:      Expectations{AllowMissing: true},
+			problems: []string{"is a symlink to /dev/null"},
+		},
+		{
+			name:     "device",
+			setup:    func(t *testing.T, dir string) string { return "/dev/null" },
+			problems: []string{"is not a regular file"},
+		},
+		{
+			name: "world-writable file",
+			setup: func(t *testing.T, dir string) string {
+				writeFile(t, filepath.Join(dir, "policy.yaml"), 0666)
+				return filepath.Join(dir, "policy.yaml")
+			},
+			problems: []string{"the file is writable by everyone (0666)"},
+		},
+		{
+			name: "group-writable directory",
+			setup: func(t *testing.T, dir string) string {
+				writeFile(t, filepath.Join(dir, "etc", "policy.yaml"), 0644)
+				os.Chmod(filepath.Join(dir, "etc"), 0775)
+				return filepath.Join(dir, "etc", "policy.yaml")
+			},
+			exp:      Expectations{Groups: []uint32{12345}},
+			problems: []string{"/etc is writable by group"},
+		},
+		{
+			name: "trusted group may write",
+			setup: func(t *testing.T, dir string) string {
+				writeFile(t, filepath.Join(dir, "etc", "policy.yaml"), 0664)
+				os.Chmod(filepath.Join(dir, "etc"), 0775)
+				return filepath.Join(dir, "etc", "policy.yaml")
+			},
+			exp: Expectations{Groups: []uint32{uint32(os.Getegid())}},
+		},
+		{
+			name: "wrong owner",
+			setup: func(t *testing.T, dir string) string {
+				writeFile(t, filepath.Join(dir, "policy.yaml"), 0644)
+				return filepath.Join(dir, "policy.yaml")
+			},
+			exp:      Expectations{Owners: []uint32{12345}},
+			problems: []string{"the file is owned by uid"},
+		},
+		{
+			name: "file owned by an untrusted user",
+			setup: func(t *testing.T, dir string) string {
+				writeFile(t, filepath.Join(dir, "policy.yaml"), 0644)
+				chown(t, filepath.Join(dir, "policy.yaml"), nobody, nobody)
+				return filepath.Join(dir, "policy.yaml")
+			},
+			problems: []string{"the file is owned by uid 65534"},
+		},
+		{
+			name: "trusted symlinked parent",
+			setup: func(t *testing.T, dir string) string {
+				writeFile(t, filepath.Join(dir, "real", "policy.yaml"), 0644)
+				os.Symlink(filepath.Join(dir, "real"), filepath.Join(dir, "etc"))
+				return filepath.Join(dir, "etc", "policy.yaml")
+			},
+		},
+		{
+			name: "symlinked parent owned by an untrusted user",
+			setup: func(t *testing.T, dir string) string {
+				writeFile(t, filepath.Join(dir, "real", "policy.yaml"), 0644)
+				os.Symlink(filepath.Join(dir, "real"), filepath.Join(dir, "etc"))
+				chown(t, filepath.Join(dir, "etc"), nobody, nobody)
+				return filepath.Join(dir, "etc", "policy.yaml")
+			},
+			problems: []string{"/etc is a symlink owned by uid 65534"},
+		},
+		{
+			name: "symlinked parent pointing at an untrusted directory",
+			setup: func(t *testing.T, dir string) string {
+				writeFile(t, filepath.Join(dir, "home", "policy.yaml"), 0644)
+				chown(t, filepath.Join(dir, "home"), nobody, nobody)
+				os.Symlink(filepath.Join(dir, "home"), filepath.Join(dir, "etc"))
+				return filepath.Join(dir, "etc", "policy.yaml")
+			},
+			problems: []string{"/home is owned by uid 65534"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A directory without group or world write, so the test's own
+			// ancestors pass whatever the machine's /tmp is like
+			base, err := os.MkdirTemp("", "securefile")
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { os.RemoveAll(base) })
+			os.Chmod(base, 0755)
+			base, _ = filepath.EvalSymlinks(base)
+
+			path := tt.setup(t, base)
+			err = Check(path, tt.exp)
+			if len(tt.problems) == 0 {
+				if err != nil {
+					t.Fatalf("Check: %v", err)
+				}
+				return
+			}
+			var checkErr *Error
+			if !errors.As(err, &checkErr) {
+				t.Fatalf("Check = %v, want a *securefile.Error", err)
+			}
+			got := strings.Join(checkErr.Problems, "\n")
+			for _, want := range tt.problems {
+				if !strings.Contains(got, want) {
+					t.Errorf("problems lack %q:\n%s", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestParseOwner(t *testing.T) {
+	exp, err := ParseOwner("root:0")
+	if err != nil {
+		t.Fatalf("ParseOwner: %v", err)
+	}
+	if len(exp.Owners) != 1 || exp.Owners[0] != 0 || len(exp.Groups) != 1 || exp.Groups[0] != 0 {
+		t.Errorf("root:0 = %+v", exp)
+	}
+	if exp, err := ParseOwner("1000"); err != nil || exp.Owners[0] != 1000 || exp.Groups != nil {
+		t.Errorf("1000 = %+v, %v", exp, err)
+	}
+	for _, bad := range []string{"", ":root", "no-such-user-here"} {
+		if _, err := ParseOwner(bad); err == nil {
+			t.Errorf("ParseOwner(%q) succeeded", bad)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package shim
+
+import (
+	"clawrden/pkg/protocol"
+	"clawrden/pkg/protocol/conformance"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConformance(t *testing.T) {
+	conformance.RunShim(t, func(conn net.Conn, req *protocol.Request, stdout, stderr io.Writer) (int, protocol.Decision, protocol.Outcome) {
+		res := &Result{Decision: protocol.DecisionError}
+		code := execute(conn, req, stdout, stderr, req.Command, streamOptions{idleTimeout: time.Second}, res)
+		return code, res.Decision, res.Outcome
+	})
+}
@@ -0,0 +1,123 @@
+package shim
+
+import (
+	"clawrden/internal/jailhouse"
+	"clawrden/pkg/protocol"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DebugFlag is the reserved first argument that makes a shim print connection
+// and policy diagnostics instead of running the command.
+const DebugFlag = "--clawrden-debug"
+
+// debugDialTimeout bounds how long the debug connectivity check waits.
+const debugDialTimeout = 3 * time.Second
+
+// runDebug prints diagnostics for toolName to w: the socket in use, whether the
+// Warden is reachable, the protocol versions, and the Warden's status summary.
+// It never creates a command request.
+func runDebug(w io.Writer, toolName, socketPath string) int {
+	fmt.Fprintf(w, "clawrden-shim debug\n")
+	fmt.Fprintf(w, "  tool:      %s\n", toolName)
+	fmt.Fprintf(w, "  socket:    %s\n", socketPath)
+
+	conn, err := net.DialTimeout("unix", socketPath, debugDialTimeout)
+	if err != nil {
+		fmt.Fprintf(w, "  connect:   failed: %v\n", err)
+		return 0
+	}
+	defer conn.Close()
+	fmt.Fprintf(w, "  connect:   ok\n")
+
+	conn.SetDeadline(time.Now().Add(debugDialTimeout))
+
+	cwd, _ := os.Getwd()
+	req := &protocol.Request{
+		Type:     protocol.RequestTypeStatus,
+		Version:  protocol.ProtocolVersion,
+		Command:  toolName,
+		Cwd:      cwd,
+		Identity: protocol.Identity{UID: os.Getuid(), GID: os.Getgid()},
+	}
+	if err := protocol.WriteRequest(conn, req); err != nil {
+		fmt.Fprintf(w, "  status:    failed to send request: %v\n", err)
+		return 0
+	}
+
+	status, err := protocol.ReadStatus(conn)
+	if err != nil {
+		fmt.Fprintf(w, "  status:    no reply (warden may predate status requests): %v\n", err)
+		return 0
+	}
+
+	fmt.Fprintf(w, "  protocol:  shim v%d, warden v%d\n", protocol.ProtocolVersion, status.Version)
+	fmt.Fprintf(w, "  pending:   %d\n", status.Pending)
+	fmt.Fprintf(w, "  jails:     %d\n", status.Jails)
+	fmt.Fprintf(w, "  uptime:    %s\n", (time.Duration(status.UptimeSeconds) * time.Second).String())
+	rule := "no (default applies)"
+	if status.ToolHasRule {
+		rule = "yes"
+	}
+	fmt.Fprintf(w, "  policy:    default=%s, rule for %s: %s\n", status.DefaultAction, toolName, rule)
+	return 0
+}
+
+// jailBinDir returns the directory of the symlink the shim was invoked
+// through, looking argv0 up in PATH when it has no slash.
+func jailBinDir(argv0 string) (string, bool) {
+	path := argv0
+	if !strings.Contains(path, "/") {
+		resolved, err := exec.LookPath(path)
+		if err != nil {
+			return "", false
+		}
+		path = resolved
+	}
+	return filepath.Dir(path), true
+}
+
+// jailHardened reports whether the shim was invoked from a hardened jail,
+// i.e. whether <jail>/bin/<tool> has a hardened marker in <jail>.
+func jailHardened(argv0 string) bool {
+	binDir, ok := jailBinDir(argv0)
+	if !ok {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(filepath.Dir(binDir), jailhouse.HardenedMarker))
+	return err == nil
+}
+
+// shimDir returns the absolute directory the shim was invoked from, or ""
+// if it cannot be found.
+func shimDir(argv0 string) string {
+	binDir, ok := jailBinDir(argv0)
+	if !ok {
+		return ""
+	}
+	abs, err := filepath.Abs(binDir)
+	if err != nil {
+		return ""
+	}
+	return abs
+}
+
+// jailID returns the ID of the jail the shim was invoked from, read from the
+// marker in <jail>/bin, or "" outside a jail.
+func jailID(argv0 string) string {
+	binDir, ok := jailBinDir(argv0)
+	if !ok {
+		return ""
+	}
+	data, err := os.ReadFile(filepath.Join(binDir, jailhouse.JailIDMarker))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,137 @@
+package shim
+
+import (
+	"bytes"
+	"clawrden/internal/jailhouse"
+	"clawrden/pkg/protocol"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// stubWarden answers a single status request and reports what it received.
+func stubWarden(t *testing.T, status *protocol.StatusResponse) (string, <-chan *protocol.Request) {
+	t.Helper()
+	socketPath := filepath.Join(t.TempDir(), "warden.sock")
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan *protocol.Request, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		req, err := protocol.ReadRequest(conn)
+		if err != nil {
+			return
+		}
+		received <- req
+		protocol.WriteStatus(conn, status)
+	}()
+	return socketPath, received
+}
+
+func TestRunDebugPrintsStatus(t *testing.T) {
+	socketPath, received := stubWarden(t, &protocol.StatusResponse{
+		Version:       protocol.ProtocolVersion,
+		Pending:       2,
+		Jails:         1,
+		UptimeSeconds: 90,
+		DefaultAction: "deny",
+		ToolHasRule:   true,
+	})
+
+	var out bytes.Buffer
+	if code := runDebug(&out, "npm", socketPath); code != 0 {
+		t.Fatalf("runDebug exit code = %d, want 0", code)
+	}
+
+	req := <-received
+	if req.Type != protocol.RequestTypeStatus {
+		t.Errorf("request type = %q, want %q", req.Type, protocol.RequestTypeStatus)
+	}
+	if req.Command != "npm" || req.Version != protocol.ProtocolVersion {
+		t.Errorf("request = %+v", req)
+	}
+
+	for _, want := range []string{
+		"tool:      npm",
+		"socket:    " + socketPath,
+		"connect:   ok",
+		"protocol:  shim v6, warden v6",
+		"pending:   2",
+		"jails:     1",
+		"uptime:    1m30s",
+		"policy:    default=deny, rule for npm: yes",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestRunDebugUnreachableWarden(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "missing.sock")
+
+	var out bytes.Buffer
+	if code := runDebug(&out, "ls", socketPath); code != 0 {
+		t.Fatalf("runDebug exit code = %d, want 0", code)
+	}
+	if !strings.Contains(out.String(), "connect:   failed") {
+		t.Errorf("output should report connection failure:\n%s", out.String())
+	}
+}
+
+func TestJailHardened(t *testing.T) {
+	jail := t.TempDir()
+	bin := filepath.Join(jail, "bin")
+	if err := os.MkdirAll(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	tool := filepath.Join(bin, "npm")
+
+	if jailHardened(tool) {
+		t.Error("jail without marker reported as hardened")
+	}
+
+	if err := os.WriteFile(filepath.Join(jail, jailhouse.HardenedMarker), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !jailHardened(tool) {
+		t.Error("jail with marker not reported as hardened")
+	}
+}
+
+func TestJailID(t *testing.T) {
+	bin := filepath.Join(t.TempDir(), "agent", "bin")
+	if err := os.MkdirAll(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	tool := filepath.Join(bin, "npm")
+
+	if id := jailID(tool); id != "" {
+		t.Errorf("jailID without marker = %q, want none", id)
+	}
+	if err := os.WriteFile(filepath.Join(bin, jailhouse.JailIDMarker), []byte("agent\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if id := jailID(tool); id != "agent" {
+		t.Errorf("jailID = %q, want agent", id)
+	}
+
+	// Invoked by name, the symlink is found through PATH
+	t.Setenv("PATH", bin)
+	if err := os.Symlink("/bin/true", tool); err != nil {
+		t.Fatal(err)
+	}
+	if id := jailID("npm"); id != "agent" {
+		t.Errorf("jailID via PATH = %q, want agent", id)
+	}
+}
@@ -0,0 +1,170 @@
+package shim
+
+import (
+	"bytes"
+	"clawrden/pkg/protocol"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// Environment variables limiting how much output reaches the agent.
+const (
+	MaxStdoutEnv      = "CLAWRDEN_MAX_STDOUT_BYTES" // Bytes of stdout to print; the rest is saved to a file
+	TailOnTruncateEnv = "CLAWRDEN_TAIL_ON_TRUNCATE" // Bytes of the end of truncated stdout to print after the notice
+)
+
+// spillPrefix starts the name of the temp file truncated output is saved in.
+const spillPrefix = "clawrden-out-"
+
+// outputLimit caps the stdout the shim prints; zero values mean no limit
+// and no tail.
+type outputLimit struct {
+	maxStdout int64
+	tail      int64
+}
+
+// tighten applies the limits the Warden announced for the command. The
+// smaller stdout limit wins, so the policy can force one the environment
+// does not set but never lift the agent's own.
+func (l outputLimit) tighten(meta *protocol.ExecMetadata) outputLimit {
+	if m := meta.MaxStdoutBytes; m > 0 && (l.maxStdout == 0 || m < l.maxStdout) {
+		l.maxStdout = m
+	}
+	if meta.TailOnTruncate > 0 {
+		l.tail = meta.TailOnTruncate
+	}
+	return l
+}
+
+// outputLimitFromEnv reads the output limits from the environment,
+// warning about values that are not a byte count.
+func outputLimitFromEnv(toolName string) outputLimit {
+	var l outputLimit
+	for _, v := range []struct {
+		env string
+		dst *int64
+	}{{MaxStdoutEnv, &l.maxStdout}, {TailOnTruncateEnv, &l.tail}} {
+		s := os.Getenv(v.env)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n < 0 {
+			fmt.Fprintf(os.Stderr, "clawrden-shim [%s]: ignoring invalid %s=%q (want a number of bytes)\n", toolName, v.env, s)
+			continue
+		}
+		*v.dst = n
+	}
+	return l
+}
+
+// stdoutPager prints stdout until its limit, then stops printing and saves
+// the full output to a temp file instead, so a command returning megabytes
+// does not flood the agent. The stream is still read to the end, so the
+// command finishes normally.
+type stdoutPager struct {
+	out   io.Writer
+	limit outputLimit
+
+	printed  []byte   // Output printed so far, copied to the spill file
+	spill    *os.File // Holds the full output once the limit is hit
+	spillErr error
+	tail     []byte // The last limit.tail bytes of output
+	over     int64  // Bytes not printed
+}
+
+func newStdoutPager(out io.Writer, limit outputLimit) *stdoutPager {
+	return &stdoutPager{out: out, limit: limit}
+}
+
+// write passes p on, or what of it fits under the limit. requestID names
+// the spill file.
+func (pg *stdoutPager) write(p []byte, requestID string) {
+	max := pg.limit.maxStdout
+	if max <= 0 {
+		pg.out.Write(p)
+		return
+	}
+	if room := max - int64(len(pg.printed)); room > 0 {
+		n := min(int64(len(p)), room)
+		pg.out.Write(p[:n])
+		pg.printed = append(pg.printed, p[:n]...)
+		p = p[n:]
+	}
+	if len(p) == 0 {
+		return
+	}
+
+	if pg.over == 0 {
+		pg.startSpill(requestID)
+	}
+	pg.over += int64(len(p))
+	if pg.spill != nil && pg.spillErr == nil {
+		_, pg.spillErr = pg.spill.Write(p)
+	}
+	if pg.limit.tail > 0 {
+		pg.tail = append(pg.tail, p...)
+		if extra := int64(len(pg.tail)) - pg.limit.tail; extra > 0 {
+			pg.tail = pg.tail[extra:]
+		}
+	}
+}
+
+// startSpill creates the spill file and copies the printed output into it.
+func (pg *stdoutPager) startSpill(requestID string) {
+	pattern := spillPrefix + "*"
+	if id := protocol.SanitizeCorrelationID(requestID); id != "" {
+		pattern = spillPrefix + id + "-*"
+	}
+	pg.spill, pg.spillErr = os.CreateTemp("", pattern)
+	if pg.spillErr == nil {
+		_, pg.spillErr = pg.spill.Write(pg.printed)
+	}
+}
+
+// finish prints the truncation notice, and the tail of the output if one
+// was asked for, when output was cut. It returns the spill file's path, or
+// "" if the output was not cut or could not be saved.
+func (pg *stdoutPager) finish() (truncated bool, spillPath string) {
+	if pg.over == 0 {
+		return false, ""
+	}
+	if pg.spill != nil {
+		if err := pg.spill.Close(); pg.spillErr == nil {
+			pg.spillErr = err
+		}
+	}
+
+	var notice bytes.Buffer
+	if len(pg.printed) > 0 && pg.printed[len(pg.printed)-1] != '\n' {
+		notice.WriteByte('\n')
+	}
+	if pg.spillErr != nil {
+		fmt.Fprintf(&notice, "[clawrden: output truncated at %s, full output could not be saved: %v ]\n",
+			formatSize(pg.limit.maxStdout), pg.spillErr)
+	} else {
+		spillPath = pg.spill.Name()
+		fmt.Fprintf(&notice, "[clawrden: output truncated at %s, full output saved to %s ]\n",
+			formatSize(pg.limit.maxStdout), spillPath)
+	}
+	if len(pg.tail) > 0 {
+		fmt.Fprintf(&notice, "[clawrden: last %s of output follow]\n", formatSize(int64(len(pg.tail))))
+	}
+	pg.out.Write(notice.Bytes())
+	pg.out.Write(pg.tail)
+	return true, spillPath
+}
+
+// formatSize renders a byte count the way people write limits ("64KB",
+// "1MB", "1500 bytes").
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%dMB", n>>20)
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprintf("%dKB", n>>10)
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
@@ -0,0 +1,142 @@
+package shim
+
+import (
+	"bytes"
+	"clawrden/pkg/protocol"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// spillPath finds the spill file named in a truncation notice.
+var spillPath = regexp.MustCompile(`full output saved to (\S+) \]`)
+
+func TestStdoutPager(t *testing.T) {
+	tests := []struct {
+		name       string
+		limit      outputLimit
+		writes     []string
+		wantOut    string // Printed before the notice
+		wantNotice string
+		wantTail   string
+	}{
+		{
+			name:    "no limit by default",
+			writes:  []string{strings.Repeat("x", 100000)},
+			wantOut: strings.Repeat("x", 100000),
+		},
+		{
+			name:    "under the limit",
+			limit:   outputLimit{maxStdout: 10},
+			writes:  []string{"hello", "world"},
+			wantOut: "helloworld",
+		},
+		{
+			name:       "cut across writes",
+			limit:      outputLimit{maxStdout: 8},
+			writes:     []string{"line 1\n", "line 2\n", "line 3\n"},
+			wantOut:    "line 1\nl\n",
+			wantNotice: "[clawrden: output truncated at 8 bytes, full output saved to ",
+		},
+		{
+			name:       "tail of the cut output",
+			limit:      outputLimit{maxStdout: 1024, tail: 7},
+			writes:     []string{strings.Repeat("a", 1024), "middle\n", "last 1\n"},
+			wantOut:    strings.Repeat("a", 1024) + "\n",
+			wantNotice: "[clawrden: output truncated at 1KB, full output saved to ",
+			wantTail:   "[clawrden: last 7 bytes of output follow]\nlast 1\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TMPDIR", t.TempDir())
+			var out bytes.Buffer
+			pg := newStdoutPager(&out, tt.limit)
+			for _, w := range tt.writes {
+				pg.write([]byte(w), "req-42")
+			}
+			truncated, path := pg.finish()
+
+			if tt.wantNotice == "" {
+				if truncated || out.String() != tt.wantOut {
+					t.Errorf("truncated %v, printed %d bytes; want all %d printed", truncated, out.Len(), len(tt.wantOut))
+				}
+				return
+			}
+			got := out.String()
+			if !truncated || !strings.HasPrefix(got, tt.wantOut+tt.wantNotice) || !strings.HasSuffix(got, " ]\n"+tt.wantTail) {
+				t.Fatalf("printed %q", got)
+			}
+			if m := spillPath.FindStringSubmatch(got); m == nil || m[1] != path {
+				t.Errorf("notice names %v, spill file is %s", m, path)
+			}
+			if !strings.HasPrefix(filepath.Base(path), "clawrden-out-req-42-") {
+				t.Errorf("spill file %s is not named after the request", path)
+			}
+			full, err := os.ReadFile(path)
+			if err != nil || string(full) != strings.Join(tt.writes, "") {
+				t.Errorf("spill file holds %q, %v; want the full output", full, err)
+			}
+		})
+	}
+}
+
+func TestOutputLimitTighten(t *testing.T) {
+	tests := []struct {
+		name string
+		env  outputLimit
+		meta protocol.ExecMetadata
+		want outputLimit
+	}{
+		{"policy forces a limit", outputLimit{}, protocol.ExecMetadata{MaxStdoutBytes: 100, TailOnTruncate: 10}, outputLimit{100, 10}},
+		{"policy tightens the agent's", outputLimit{1000, 0}, protocol.ExecMetadata{MaxStdoutBytes: 100}, outputLimit{100, 0}},
+		{"policy cannot lift the agent's", outputLimit{100, 5}, protocol.ExecMetadata{MaxStdoutBytes: 1000}, outputLimit{100, 5}},
+		{"no policy limit", outputLimit{100, 5}, protocol.ExecMetadata{}, outputLimit{100, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.env.tighten(&tt.meta); got != tt.want {
+				t.Errorf("tighten = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputLimitFromEnv(t *testing.T) {
+	t.Setenv(MaxStdoutEnv, "65536")
+	t.Setenv(TailOnTruncateEnv, "lots")
+	if got := outputLimitFromEnv("npm"); got != (outputLimit{maxStdout: 65536}) {
+		t.Errorf("outputLimitFromEnv = %+v, want the stdout limit and no tail", got)
+	}
+}
+
+func TestStreamFramesAppliesPolicyLimit(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	var meta bytes.Buffer
+	protocol.WriteMetadata(&meta, &protocol.ExecMetadata{RequestID: "abc", MaxStdoutBytes: 5})
+	stream := join(meta.Bytes(),
+		frameBytes(protocol.StreamStdout, "0123456789"),
+		frameBytes(protocol.StreamExit, "\x00"))
+
+	shimSide, wardenSide := net.Pipe()
+	defer shimSide.Close()
+	go func() {
+		wardenSide.Write(stream)
+		wardenSide.Close()
+	}()
+	var out, errOut bytes.Buffer
+	res := &Result{}
+	if code := streamFrames(shimSide, &out, &errOut, "npm", streamOptions{}, res); code != 0 {
+		t.Fatalf("exit code = %d, stderr %q", code, errOut.String())
+	}
+
+	if !strings.HasPrefix(out.String(), "01234\n[clawrden: output truncated at 5 bytes") {
+		t.Errorf("stdout = %q", out.String())
+	}
+	if !res.Truncated || res.BytesStdout != 10 || !strings.HasPrefix(filepath.Base(res.SpillFile), "clawrden-out-abc-") {
+		t.Errorf("result = %+v, want 10 bytes truncated into a spill file for abc", res)
+	}
+}
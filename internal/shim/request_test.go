@@ -0,0 +1,61 @@
+package shim
+
+import (
+	"clawrden/pkg/protocol"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// ciEnviron is an environment like a CI container's: hundreds of variables,
+// a few of them hundreds of kilobytes long.
+func ciEnviron() []string {
+	environ := []string{"PATH=/usr/bin:/bin", "HOME=/root", "CLAWRDEN_TASK_ID=build-1234"}
+	for i := range 400 {
+		environ = append(environ, fmt.Sprintf("CI_VAR_%d=value-%d", i, i))
+	}
+	for i := range 4 {
+		environ = append(environ, fmt.Sprintf("NIX_BUILD_%d=%s", i, strings.Repeat("/nix/store/abc-pkg ", 20000)))
+	}
+	return environ
+}
+
+func TestNewRequestSendsOnlyPassedValues(t *testing.T) {
+	req, err := newRequest("npm", []string{"test"}, []string{
+		"PATH=/usr/bin", "AWS_SECRET_ACCESS_KEY=hunter2", "NIX_CFLAGS=" + strings.Repeat("x", 1<<20),
+		"CLAWRDEN_TASK_ID=task-42", "HOME=/home/agent", "EMPTY=",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"PATH=/usr/bin", "AWS_SECRET_ACCESS_KEY", "NIX_CFLAGS", "CLAWRDEN_TASK_ID", "HOME=/home/agent", "EMPTY"}
+	if !slices.Equal(req.Env, want) {
+		t.Errorf("env = %q, want %q", req.Env, want)
+	}
+	if req.TaskID != "task-42" || req.Cwd == "" || req.Version != protocol.ProtocolVersion {
+		t.Errorf("request = %+v", req)
+	}
+}
+
+func TestNewRequestValidates(t *testing.T) {
+	if _, err := newRequest("npm", []string{"a\x00b"}, nil); !errors.Is(err, protocol.ErrInvalidRequest) {
+		t.Errorf("err = %v, want ErrInvalidRequest", err)
+	}
+}
+
+func BenchmarkShimRequestBuild(b *testing.B) {
+	environ := ciEnviron()
+	b.ReportAllocs()
+	for b.Loop() {
+		req, err := newRequest("ls", []string{"-la"}, environ)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := protocol.WriteRequest(io.Discard, req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
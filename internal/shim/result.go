@@ -0,0 +1,125 @@
+package shim
+
+import (
+	"clawrden/pkg/protocol"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Environment variables asking for the result metadata.
+const (
+	ResultFileEnv = "CLAWRDEN_RESULT_FILE" // Path to write the result JSON to
+	ResultFDEnv   = "CLAWRDEN_RESULT_FD"   // Open file descriptor to write it to, e.g. "3"
+)
+
+// Result is the machine-readable account of one shim invocation, written
+// when the shim exits so agents need not parse its stderr. Its decision and
+// outcome are the audit log's, e.g. "deny" and "after_hitl", or "error"
+// when the shim got no decision from the Warden.
+type Result struct {
+	Decision      protocol.Decision `json:"decision"`
+	Outcome       protocol.Outcome  `json:"outcome,omitempty"`
+	RequestID     string            `json:"request_id,omitempty"`
+	ExitCode      int               `json:"exit_code"`
+	DeniedReason  string            `json:"denied_reason,omitempty"`
+	WaitMS        int64             `json:"wait_ms"`     // Time spent awaiting approval
+	ExecMS        int64             `json:"exec_ms"`     // Time from the approval to the exit code
+	DurationMS    int64             `json:"duration_ms"` // Time from connecting to exit
+	OverheadUS    int64             `json:"overhead_us"` // Time from start until the request was sent
+	BytesStdout   int64             `json:"bytes_stdout"`
+	BytesStderr   int64             `json:"bytes_stderr"`
+	StreamError   string            `json:"stream_error,omitempty"` // Why the output stream failed, if it did
+	Truncated     bool              `json:"truncated,omitempty"`    // Stdout was cut at the output limit
+	SpillFile     string            `json:"spill_file,omitempty"`   // Where the full stdout was saved
+	Strategy      string            `json:"strategy,omitempty"`     // Where the command ran: mirror, ghost or local
+	WardenVersion int               `json:"warden_version,omitempty"`
+
+	trailer bool // The policy asks for the trailer line
+}
+
+// applyMetadata copies what the Warden said about the request.
+func (r *Result) applyMetadata(meta *protocol.ExecMetadata) {
+	if meta == nil {
+		return
+	}
+	if meta.RequestID != "" {
+		r.RequestID = meta.RequestID
+	}
+	if meta.Decision != protocol.DecisionNone {
+		r.Decision, r.Outcome = meta.Decision, meta.Outcome
+	}
+	if meta.WardenVersion != 0 {
+		r.WardenVersion = meta.WardenVersion
+	}
+	if meta.Strategy != "" {
+		r.Strategy = meta.Strategy
+	}
+	r.trailer = r.trailer || meta.Trailer
+}
+
+// writeResult writes res wherever the environment asks for it. Failures
+// are reported on stderr and never change the command's exit code.
+func writeResult(res *Result, stderr io.Writer, toolName string) {
+	path, fd := os.Getenv(ResultFileEnv), os.Getenv(ResultFDEnv)
+	if path == "" && fd == "" {
+		return
+	}
+	data, err := json.Marshal(res)
+	if err != nil {
+		fmt.Fprintf(stderr, "clawrden-shim [%s]: warning: failed to encode result: %v\n", toolName, err)
+		return
+	}
+	data = append(data, '\n')
+
+	if path != "" {
+		if err := writeResultFile(path, data); err != nil {
+			fmt.Fprintf(stderr, "clawrden-shim [%s]: warning: failed to write %s: %v\n", toolName, ResultFileEnv, err)
+		}
+	}
+	if fd != "" {
+		if err := writeResultFD(fd, data); err != nil {
+			fmt.Fprintf(stderr, "clawrden-shim [%s]: warning: failed to write %s=%s: %v\n", toolName, ResultFDEnv, fd, err)
+		}
+	}
+}
+
+// writeResultFile replaces path with data, creating parent directories as
+// needed. Readers never see a partial file.
+func writeResultFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// writeResultFD writes data to an inherited file descriptor.
+func writeResultFD(fd string, data []byte) error {
+	n, err := strconv.Atoi(fd)
+	if err != nil || n < 3 {
+		return fmt.Errorf("not a file descriptor above stderr")
+	}
+	f := os.NewFile(uintptr(n), ResultFDEnv)
+	if f == nil {
+		return fmt.Errorf("invalid file descriptor")
+	}
+	defer f.Close()
+	_, err = f.Write(data)
+	return err
+}
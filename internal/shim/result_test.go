@@ -0,0 +1,209 @@
+package shim
+
+import (
+	"bytes"
+	"clawrden/pkg/protocol"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// scriptedWarden answers a single exec request by writing each of replies
+// in turn, pausing for any time.Duration among them, then hangs up.
+func scriptedWarden(t *testing.T, replies ...any) string {
+	t.Helper()
+	socketPath := filepath.Join(t.TempDir(), "warden.sock")
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if _, err := protocol.ReadRequest(conn); err != nil {
+			return
+		}
+		for _, r := range replies {
+			switch r := r.(type) {
+			case byte:
+				protocol.WriteAck(conn, r)
+			case protocol.Frame:
+				protocol.WriteFrame(conn, r)
+			case *protocol.ExecMetadata:
+				protocol.WriteMetadata(conn, r)
+			case time.Duration:
+				time.Sleep(r)
+			}
+		}
+	}()
+	return socketPath
+}
+
+func TestExecuteResult(t *testing.T) {
+	meta := func(decision protocol.Decision, outcome protocol.Outcome) *protocol.ExecMetadata {
+		return &protocol.ExecMetadata{RequestID: "req-1", Decision: decision, Outcome: outcome, WardenVersion: protocol.ProtocolVersion}
+	}
+	tests := []struct {
+		name     string
+		replies  []any
+		wantCode int
+		want     Result
+		minWait  int64
+	}{
+		{
+			name: "allowed",
+			replies: []any{
+				protocol.AckAllowed, meta(protocol.DecisionAllow, protocol.OutcomeNone),
+				protocol.Frame{Type: protocol.StreamStdout, Payload: []byte("hello\n")},
+				protocol.Frame{Type: protocol.StreamStderr, Payload: []byte("warn")},
+				protocol.Frame{Type: protocol.StreamExit, Payload: []byte{3}},
+			},
+			wantCode: 3,
+			want:     Result{Decision: protocol.DecisionAllow, RequestID: "req-1", BytesStdout: 6, BytesStderr: 4, WardenVersion: protocol.ProtocolVersion},
+		},
+		{
+			name: "denied with reason",
+			replies: []any{
+				protocol.AckDenied, protocol.Frame{Type: protocol.StreamReason, Payload: []byte("maintenance until 5pm")},
+				meta(protocol.DecisionDeny, protocol.OutcomeMaintenance),
+			},
+			wantCode: 1,
+			want:     Result{Decision: protocol.DecisionDeny, Outcome: protocol.OutcomeMaintenance, RequestID: "req-1", DeniedReason: "maintenance until 5pm", WardenVersion: protocol.ProtocolVersion},
+		},
+		{
+			name:     "denied by an older warden",
+			replies:  []any{protocol.AckDenied},
+			wantCode: 1,
+			want:     Result{Decision: protocol.DecisionDeny},
+		},
+		{
+			name: "approved by a reviewer",
+			replies: []any{
+				protocol.AckPendingHITL, 30 * time.Millisecond, protocol.AckAllowed, meta(protocol.DecisionAllow, protocol.OutcomeAfterHITL),
+				protocol.Frame{Type: protocol.StreamExit, Payload: []byte{0}},
+			},
+			want:    Result{Decision: protocol.DecisionAllow, Outcome: protocol.OutcomeAfterHITL, RequestID: "req-1", WardenVersion: protocol.ProtocolVersion},
+			minWait: 30,
+		},
+		{
+			name:     "denied by a reviewer",
+			replies:  []any{protocol.AckPendingHITL, protocol.AckDenied, meta(protocol.DecisionDeny, protocol.OutcomeAfterHITL)},
+			wantCode: 1,
+			want:     Result{Decision: protocol.DecisionDeny, Outcome: protocol.OutcomeAfterHITL, RequestID: "req-1", WardenVersion: protocol.ProtocolVersion},
+		},
+		{
+			name: "stream cut short",
+			replies: []any{
+				protocol.AckAllowed,
+				protocol.Frame{Type: protocol.StreamStdout, Payload: []byte("partial")},
+			},
+			wantCode: ExitStreamFailure,
+			want:     Result{Decision: protocol.DecisionAllow, BytesStdout: 7, StreamError: "connection closed before the exit code (after 1 frames)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.Dial("unix", scriptedWarden(t, tt.replies...))
+			if err != nil {
+				t.Fatalf("dial: %v", err)
+			}
+			defer conn.Close()
+
+			var res Result
+			var stderr bytes.Buffer
+			code := execute(conn, &protocol.Request{Command: "npm"}, io.Discard, &stderr, "npm", streamOptions{idleTimeout: time.Second}, &res)
+			if code != tt.wantCode {
+				t.Errorf("exit code = %d, want %d (stderr %q)", code, tt.wantCode, stderr.String())
+			}
+			if res.WaitMS < tt.minWait {
+				t.Errorf("wait_ms = %d, want at least %d", res.WaitMS, tt.minWait)
+			}
+			res.WaitMS, res.ExecMS = 0, 0
+			if res != tt.want {
+				t.Errorf("result = %+v, want %+v", res, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteResultFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results", "nested", "npm.json")
+	t.Setenv(ResultFileEnv, path)
+
+	var stderr bytes.Buffer
+	writeResult(&Result{Decision: protocol.DecisionAllow, RequestID: "req-1", ExitCode: 2, WardenVersion: 1}, &stderr, "npm")
+	if stderr.Len() != 0 {
+		t.Errorf("stderr = %q, want nothing", stderr.String())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read result: %v", err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("result is not JSON: %v\n%s", err, data)
+	}
+	for key, want := range map[string]any{"decision": "allow", "request_id": "req-1", "exit_code": 2.0, "wait_ms": 0.0, "bytes_stdout": 0.0, "warden_version": 1.0} {
+		if got[key] != want {
+			t.Errorf("%s = %v, want %v", key, got[key], want)
+		}
+	}
+	if _, ok := got["denied_reason"]; ok {
+		t.Errorf("denied_reason present for an allowed command: %s", data)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("result directory has %d entries, want only the result", len(entries))
+	}
+}
+
+func TestWriteResultFD(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	// The shim closes the descriptor it writes to, so hand it a copy
+	fd, err := syscall.Dup(int(w.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(ResultFDEnv, strconv.Itoa(fd))
+
+	writeResult(&Result{Decision: protocol.DecisionDeny, DeniedReason: "no"}, io.Discard, "npm")
+	w.Close()
+	data, _ := io.ReadAll(r)
+	if !strings.Contains(string(data), `"denied_reason":"no"`) {
+		t.Errorf("fd output = %q", data)
+	}
+}
+
+func TestWriteResultFailureOnlyWarns(t *testing.T) {
+	blocker := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(ResultFileEnv, filepath.Join(blocker, "result.json"))
+	t.Setenv(ResultFDEnv, "stdout")
+
+	var stderr bytes.Buffer
+	writeResult(&Result{Decision: protocol.DecisionAllow}, &stderr, "npm")
+	for _, want := range []string{"warning: failed to write " + ResultFileEnv, "warning: failed to write " + ResultFDEnv} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("stderr = %q, missing %q", stderr.String(), want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package shim
+
+import (
+	"clawrden/pkg/protocol"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// unsetSessionID is what /proc/self/sessionid holds for processes outside
+// any audited login session, e.g. those started by init or a container
+// runtime.
+const unsetSessionID = "4294967295"
+
+// sessionSource reads what the shim reports about its login session. Tests
+// replace it to fake terminals and /proc failures.
+type sessionSource struct {
+	fdLink    func(fd int) (string, error) // Target of /proc/self/fd/<fd>
+	sessionID func() (string, error)       // Contents of /proc/self/sessionid
+}
+
+// procSession reads the running process's session from /proc.
+var procSession = sessionSource{
+	fdLink: func(fd int) (string, error) {
+		return os.Readlink(fmt.Sprintf("/proc/self/fd/%d", fd))
+	},
+	sessionID: func() (string, error) {
+		data, err := os.ReadFile("/proc/self/sessionid")
+		return string(data), err
+	},
+}
+
+// captureSession reports the terminal on stdin or stderr, the SSH variables
+// and the login session ID. Agents usually run without a terminal or SSH
+// session, and /proc may be missing; whatever cannot be read is left out,
+// and nil means nothing could.
+func captureSession(src sessionSource, environ []string) *protocol.Session {
+	s := protocol.Session{
+		TTY:           terminal(src),
+		SSHConnection: lookupEnv(environ, "SSH_CONNECTION"),
+		SSHTTY:        lookupEnv(environ, "SSH_TTY"),
+	}
+	if id, err := src.sessionID(); err == nil {
+		if id = strings.TrimSpace(id); id != unsetSessionID {
+			s.LoginSession = id
+		}
+	}
+	return s.Sanitize()
+}
+
+// terminal returns the terminal device on fd 0 or, when stdin is piped,
+// fd 2; "" when neither is one.
+func terminal(src sessionSource) string {
+	for _, fd := range []int{0, 2} {
+		target, err := src.fdLink(fd)
+		if err != nil {
+			continue
+		}
+		if strings.HasPrefix(target, "/dev/pts/") || strings.HasPrefix(target, "/dev/tty") || target == "/dev/console" {
+			return target
+		}
+	}
+	return ""
+}
@@ -0,0 +1,50 @@
+package shim
+
+import (
+	"clawrden/pkg/protocol"
+	"errors"
+	"io/fs"
+	"testing"
+)
+
+// fakeSession links fds to the given targets; the rest fail like closed fds.
+func fakeSession(links map[int]string, sessionID string, idErr error) sessionSource {
+	return sessionSource{
+		fdLink: func(fd int) (string, error) {
+			if target, ok := links[fd]; ok {
+				return target, nil
+			}
+			return "", fs.ErrNotExist
+		},
+		sessionID: func() (string, error) { return sessionID, idErr },
+	}
+}
+
+func TestCaptureSession(t *testing.T) {
+	procFailed := fakeSession(nil, "", fs.ErrPermission)
+	tests := []struct {
+		name    string
+		src     sessionSource
+		environ []string
+		want    *protocol.Session
+	}{
+		{"agent without terminal or session", fakeSession(map[int]string{0: "/dev/null", 2: "pipe:[4242]"}, unsetSessionID+"\n", nil), nil, nil},
+		{"no /proc", procFailed, nil, nil},
+		{"terminal on stdin", fakeSession(map[int]string{0: "/dev/pts/3"}, "7\n", nil), nil,
+			&protocol.Session{TTY: "/dev/pts/3", LoginSession: "7"}},
+		{"terminal on stderr", fakeSession(map[int]string{0: "pipe:[1]", 2: "/dev/tty1"}, "", errors.New("read failed")), nil,
+			&protocol.Session{TTY: "/dev/tty1"}},
+		{"ssh without /proc", procFailed, []string{"SSH_CONNECTION=10.0.0.5 52144 10.0.0.1 22", "SSH_TTY=/dev/pts/9"},
+			&protocol.Session{SSHConnection: "10.0.0.5 52144 10.0.0.1 22", SSHTTY: "/dev/pts/9"}},
+		{"control characters", procFailed, []string{"SSH_TTY=/dev/pts/1\x1b[2J"},
+			&protocol.Session{SSHTTY: "/dev/pts/1_[2J"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := captureSession(tt.src, tt.environ)
+			if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+				t.Errorf("captureSession() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -10,10 +10,15 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 )
 
 // Run executes the shim logic and returns the exit code.
 func Run() int {
+	begun := time.Now()
+
 	// Determine which tool we're impersonating
 	toolName := filepath.Base(os.Args[0])
 
@@ -30,115 +35,277 @@ func Run() int {
 		args = os.Args[1:]
 	}
 
-	// Capture current working directory
-	cwd, err := os.Getwd()
+	// Determine socket path (allow override via env)
+	socketPath := os.Getenv("CLAWRDEN_SOCKET")
+	if socketPath == "" {
+		socketPath = protocol.DefaultSocketPath
+	}
+
+	// Debugging escape hatch (disabled in hardened jails)
+	if len(args) > 0 && args[0] == DebugFlag {
+		if jailHardened(os.Args[0]) {
+			fmt.Fprintf(os.Stderr, "clawrden-shim [%s]: %s is disabled in hardened jails\n", toolName, DebugFlag)
+			return 1
+		}
+		return runDebug(os.Stdout, toolName, socketPath)
+	}
+
+	req, err := newRequest(toolName, args, os.Environ())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clawrden-shim [%s]: %v\n", toolName, err)
+		return 1
+	}
+
+	// Ask for a terminal when the output goes to one
+	tty := openPassthrough(os.Stdin, os.Stdout)
+	if tty != nil {
+		req.TTY, req.WindowSize = true, tty.size()
+	}
+
+	// Connect to the Warden
+	res := &Result{Decision: protocol.DecisionError}
+	started := time.Now()
+	conn, err := net.Dial("unix", socketPath)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "clawrden-shim [%s]: failed to get working directory: %v\n", toolName, err)
+		fmt.Fprintf(os.Stderr, "clawrden-shim [%s]: failed to connect to warden at %s: %v\n",
+			toolName, socketPath, err)
+		res.ExitCode = 1
+		writeTrailer(res, os.Stderr)
+		writeResult(res, os.Stderr, toolName)
 		return 1
 	}
+	defer conn.Close()
 
-	// Capture environment
-	env := os.Environ()
+	// Set up signal handling (must happen before any blocking I/O)
+	cancelSignals(conn, tty)
 
-	// Capture identity
-	uid := os.Getuid()
-	gid := os.Getgid()
+	opts := streamOptionsFromEnv(toolName)
+	opts.terminal = tty
+	sent := &firstWrite{Conn: conn}
+	code := execute(sent, req, os.Stdout, os.Stderr, toolName, opts, res)
+	if !sent.at.IsZero() {
+		res.OverheadUS = sent.at.Sub(begun).Microseconds()
+	}
+	res.ExitCode = code
+	res.DurationMS = time.Since(started).Milliseconds()
+	writeTrailer(res, os.Stderr)
+	writeResult(res, os.Stderr, toolName)
+	// The result file and trailer keep the whole code; the process status
+	// cannot
+	return protocol.ExitStatus(code)
+}
 
-	// Build the request
+// newRequest captures what the Warden needs to know about this invocation.
+// Only the environment scales with the caller, so it is filtered first (see
+// captureEnv); the rest is a few system calls.
+func newRequest(toolName string, args, environ []string) (*protocol.Request, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+	groups, err := os.Getgroups()
+	if err != nil {
+		// Not fatal: the Warden re-reads groups from /proc when it can
+		groups = nil
+	}
 	req := &protocol.Request{
+		Version: protocol.ProtocolVersion,
 		Command: toolName,
 		Args:    args,
 		Cwd:     cwd,
-		Env:     env,
+		Env:     captureEnv(environ),
+		JailID:  jailID(os.Args[0]),
+		ShimDir: shimDir(os.Args[0]),
+		TaskID:  protocol.SanitizeCorrelationID(lookupEnv(environ, protocol.TaskIDEnv)),
+		RunID:   protocol.SanitizeCorrelationID(lookupEnv(environ, protocol.RunIDEnv)),
+		Session: captureSession(procSession, environ),
 		Identity: protocol.Identity{
-			UID: uid,
-			GID: gid,
+			UID:    os.Getuid(),
+			GID:    os.Getgid(),
+			Groups: groups,
 		},
 	}
+	// The Warden refuses a malformed request anyway; failing here says why
+	// without a round trip
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
 
-	// Determine socket path (allow override via env)
-	socketPath := os.Getenv("CLAWRDEN_SOCKET")
-	if socketPath == "" {
-		socketPath = protocol.DefaultSocketPath
+// captureEnv returns the environment to send: entries the Warden passes on
+// to commands whole, and only the names of the rest. The Warden drops those
+// anyway and just audits their names, so multi-megabyte Nix or Bazel values
+// and secrets never have to be encoded or cross the socket.
+func captureEnv(environ []string) []string {
+	env := make([]string, len(environ))
+	for i, entry := range environ {
+		key, _, _ := strings.Cut(entry, "=")
+		if protocol.EnvPassesThrough(key) {
+			env[i] = entry
+		} else {
+			env[i] = key
+		}
 	}
+	return env
+}
 
-	// Connect to the Warden
-	conn, err := net.Dial("unix", socketPath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "clawrden-shim [%s]: failed to connect to warden at %s: %v\n",
-			toolName, socketPath, err)
-		return 1
+// lookupEnv returns the value of key in environ, or "".
+func lookupEnv(environ []string, key string) string {
+	for _, entry := range environ {
+		if k, v, ok := strings.Cut(entry, "="); ok && k == key {
+			return v
+		}
 	}
-	defer conn.Close()
+	return ""
+}
 
-	// Set up signal handling (must happen before any blocking I/O)
-	cancelSignals(conn)
+// firstWrite records when the first write on a connection, the request,
+// completed.
+type firstWrite struct {
+	net.Conn
+	at time.Time
+}
 
+func (c *firstWrite) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if c.at.IsZero() {
+		c.at = time.Now()
+	}
+	return n, err
+}
+
+// execute sends req over conn, waits for the Warden's decision and streams
+// the command's output, returning the exit code. What it learns about the
+// request is recorded in res.
+func execute(conn net.Conn, req *protocol.Request, stdout, stderr io.Writer, toolName string, opts streamOptions, res *Result) int {
 	// Send the request
 	if err := protocol.WriteRequest(conn, req); err != nil {
-		fmt.Fprintf(os.Stderr, "clawrden-shim [%s]: failed to send request: %v\n", toolName, err)
+		fmt.Fprintf(stderr, "clawrden-shim [%s]: failed to send request: %v\n", toolName, err)
 		return 1
 	}
 
 	// Read the ack byte
 	ack, err := protocol.ReadAck(conn)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "clawrden-shim [%s]: failed to read ack: %v\n", toolName, err)
+		fmt.Fprintf(stderr, "clawrden-shim [%s]: failed to read ack: %v\n", toolName, err)
 		return 1
 	}
 
 	switch ack {
 	case protocol.AckDenied:
-		fmt.Fprintf(os.Stderr, "clawrden-shim [%s]: command denied by policy\n", toolName)
+		if reason := readDenial(conn, res, stderr); reason != "" {
+			fmt.Fprintf(stderr, "clawrden-shim [%s]: command denied: %s\n", toolName, reason)
+			return 1
+		}
+		fmt.Fprintf(stderr, "clawrden-shim [%s]: command denied by policy\n", toolName)
 		return 1
 	case protocol.AckPendingHITL:
-		fmt.Fprintf(os.Stderr, "clawrden-shim [%s]: awaiting approval...\n", toolName)
-		// After the pending message, the Warden will send another ack when resolved
-		resolvedAck, err := protocol.ReadAck(conn)
+		// After the pending ack, the Warden will send another ack when
+		// resolved. Newer Wardens first say where the request stands; for
+		// older ones, a plain line is printed once they have not.
+		var announce sync.Once
+		plain := func() { fmt.Fprintf(stderr, "clawrden-shim [%s]: awaiting approval...\n", toolName) }
+		timer := time.AfterFunc(pendingMetaWait, func() { announce.Do(plain) })
+		waitStarted := time.Now()
+		resolvedAck, err := protocol.ReadResolution(conn, func(meta *protocol.ExecMetadata) {
+			res.applyMetadata(meta)
+			announce.Do(func() { fmt.Fprintf(stderr, "clawrden-shim [%s]: %s\n", toolName, pendingLine(meta)) })
+		})
+		timer.Stop()
+		announce.Do(plain)
+		res.WaitMS = time.Since(waitStarted).Milliseconds()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "clawrden-shim [%s]: lost connection while awaiting approval: %v\n", toolName, err)
+			fmt.Fprintf(stderr, "clawrden-shim [%s]: lost connection while awaiting approval: %v\n", toolName, err)
 			return 1
 		}
-		if resolvedAck == protocol.AckDenied {
-			fmt.Fprintf(os.Stderr, "clawrden-shim [%s]: command denied by reviewer\n", toolName)
+		switch resolvedAck {
+		case protocol.AckAllowed:
+			// Approved; proceed to streaming
+		case protocol.AckDenied:
+			if reason := readDenial(conn, res, stderr); reason != "" {
+				fmt.Fprintf(stderr, "clawrden-shim [%s]: command denied by reviewer: %s\n", toolName, reason)
+				return 1
+			}
+			fmt.Fprintf(stderr, "clawrden-shim [%s]: command denied by reviewer\n", toolName)
+			return 1
+		default:
+			// Only an explicit approval runs the command; a repeated pending
+			// ack or an unknown one is not one
+			fmt.Fprintf(stderr, "clawrden-shim [%s]: unknown ack after approval wait: %d\n", toolName, resolvedAck)
 			return 1
 		}
 	case protocol.AckAllowed:
 		// Proceed to streaming
 	default:
-		fmt.Fprintf(os.Stderr, "clawrden-shim [%s]: unknown ack: %d\n", toolName, ack)
+		fmt.Fprintf(stderr, "clawrden-shim [%s]: unknown ack: %d\n", toolName, ack)
 		return 1
 	}
 
-	// Stream frames from the Warden
-	return streamFrames(conn, toolName)
+	// Stream frames from the Warden; a metadata frame refines the decision
+	res.Decision = protocol.DecisionAllow
+	execStarted := time.Now()
+	stopTerminal := func() {}
+	if opts.terminal != nil {
+		stopTerminal = opts.terminal.forward(conn)
+	}
+	code := streamFrames(conn, stdout, stderr, toolName, opts, res)
+	stopTerminal()
+	res.ExecMS = time.Since(execStarted).Milliseconds()
+	return code
 }
 
-// streamFrames reads and dispatches frames from the Warden connection.
-func streamFrames(conn net.Conn, toolName string) int {
-	for {
-		frame, err := protocol.ReadFrame(conn)
-		if err != nil {
-			if err == io.EOF {
-				// Connection closed without an exit frame
-				return 1
-			}
-			fmt.Fprintf(os.Stderr, "clawrden-shim [%s]: stream error: %v\n", toolName, err)
-			return 1
-		}
+// pendingMetaWait is how long the shim waits for a queued request's
+// metadata before announcing the wait without it; older wardens send none.
+const pendingMetaWait = time.Second
 
-		switch frame.Type {
-		case protocol.StreamStdout:
-			os.Stdout.Write(frame.Payload)
-		case protocol.StreamStderr:
-			os.Stderr.Write(frame.Payload)
-		case protocol.StreamExit:
-			if len(frame.Payload) > 0 {
-				return int(frame.Payload[0])
-			}
-			return 0
-		default:
-			// Unknown frame type, ignore
-		}
+// pendingLine describes a queued request: its ID, how many requests are
+// ahead of it, when it expires and where reviewers find it.
+func pendingLine(meta *protocol.ExecMetadata) string {
+	if meta.RequestID == "" {
+		return "awaiting approval..."
+	}
+	line := "awaiting approval: " + meta.RequestID
+	var notes []string
+	if ahead := meta.QueuePosition - 1; ahead > 0 {
+		notes = append(notes, fmt.Sprintf("%d ahead", ahead))
+	}
+	if timeout := meta.HITLTimeout(); timeout > 0 {
+		notes = append(notes, "expires in "+formatLimit(timeout))
+	}
+	if len(notes) > 0 {
+		line += " (" + strings.Join(notes, ", ") + ")"
+	}
+	if meta.ReviewURL != "" {
+		line += ", approve at " + meta.ReviewURL
+	}
+	return line
+}
+
+// denialWait bounds how long the shim waits for what may follow a denial;
+// older wardens close the connection without sending anything.
+const denialWait = time.Second
+
+// readDenial records a denial in res and returns the Warden's explanation,
+// or "" if it gave none in time. A reviewer's message to the agent is
+// copied to stderr.
+func readDenial(conn net.Conn, res *Result, stderr io.Writer) string {
+	res.Decision = protocol.DecisionDeny
+	conn.SetReadDeadline(time.Now().Add(denialWait))
+	reason, meta, _ := protocol.ReadDenialTo(conn, stderr)
+	res.DeniedReason = reason
+	res.applyMetadata(meta)
+	return reason
+}
+
+// formatLimit renders a time limit without trailing zero units ("5m", not "5m0s").
+func formatLimit(d time.Duration) string {
+	s := d.Round(time.Millisecond).String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
 	}
+	return s
 }
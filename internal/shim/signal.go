@@ -9,8 +9,9 @@ import (
 )
 
 // cancelSignals sets up signal handlers for SIGINT and SIGTERM.
-// When received, it sends a cancel frame to the Warden and closes the connection.
-func cancelSignals(conn net.Conn) {
+// When received, it sends a cancel frame to the Warden and exits, leaving
+// tty, if any, out of raw mode.
+func cancelSignals(conn net.Conn, tty *passthrough) {
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 
@@ -23,10 +24,11 @@ func cancelSignals(conn net.Conn) {
 			Payload: nil,
 		})
 
-		// Close the connection to unblock any pending reads
-		conn.Close()
+		tty.restore()
 
-		// Exit with signal-killed code (128 + signal number)
+		// Exit with signal-killed code (128 + signal number). The connection
+		// stays open until then: closing it first would let a pending read
+		// fail and report a stream error with its own exit code.
 		os.Exit(130) // 128 + SIGINT(2)
 	}()
 }
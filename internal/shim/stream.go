@@ -0,0 +1,160 @@
+package shim
+
+import (
+	"clawrden/pkg/protocol"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ExitStreamFailure is returned when the output stream from the Warden ends
+// without an exit frame or cannot be read, so the command's own exit code is
+// unknown.
+const ExitStreamFailure = 125
+
+// Environment variables tuning the stream.
+const (
+	IdleTimeoutEnv = "CLAWRDEN_IDLE_TIMEOUT" // Go duration; "0" waits forever
+	ShimDebugEnv   = "CLAWRDEN_SHIM_DEBUG"   // Non-empty enables debug messages
+)
+
+// DefaultIdleTimeout is how long the shim waits for the next frame before
+// assuming the Warden is wedged. It is generous because silent commands are
+// common; an announced time limit extends it.
+const DefaultIdleTimeout = time.Hour
+
+// idleGrace is added to an announced time limit, so the Warden can report a
+// timeout before the shim gives up on it.
+const idleGrace = time.Minute
+
+// streamOptions tunes streamFrames.
+type streamOptions struct {
+	idleTimeout time.Duration // Longest wait for a frame; 0 = no limit
+	debug       bool          // Report ignored frames on stderr
+	output      outputLimit   // How much stdout to print
+	terminal    *passthrough  // Passed through while the command runs; nil without one
+}
+
+// streamOptionsFromEnv reads the stream options from the environment,
+// warning about an unparsable idle timeout.
+func streamOptionsFromEnv(toolName string) streamOptions {
+	opts := streamOptions{
+		idleTimeout: DefaultIdleTimeout,
+		debug:       os.Getenv(ShimDebugEnv) != "",
+		output:      outputLimitFromEnv(toolName),
+	}
+	if v := os.Getenv(IdleTimeoutEnv); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			fmt.Fprintf(os.Stderr, "clawrden-shim [%s]: ignoring invalid %s=%q (using %s)\n",
+				toolName, IdleTimeoutEnv, v, formatLimit(DefaultIdleTimeout))
+		} else {
+			opts.idleTimeout = d
+		}
+	}
+	return opts
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// streamFrames reads frames from the Warden connection, writing output to
+// stdout and stderr, and returns the command's exit code. A stream that
+// fails, goes idle for opts.idleTimeout, or ends without an exit frame
+// returns ExitStreamFailure with a message naming the frame that failed.
+// Stdout beyond the output limit is saved to a file instead of printed.
+// Output sizes, the Warden's metadata and any stream failure go into res.
+func streamFrames(conn net.Conn, stdout, stderr io.Writer, toolName string, opts streamOptions, res *Result) int {
+	in := &countingReader{r: conn}
+	idle := opts.idleTimeout
+	unknown := make(map[byte]int)
+	if opts.debug {
+		defer reportUnknownFrames(stderr, toolName, unknown)
+	}
+	pager := newStdoutPager(stdout, opts.output)
+	defer func() { res.Truncated, res.SpillFile = pager.finish() }()
+
+	for frameNum := 1; ; frameNum++ {
+		if idle > 0 {
+			conn.SetReadDeadline(time.Now().Add(idle))
+		}
+		offset := in.n
+		frame, err := protocol.ReadFrame(in)
+		if err != nil {
+			switch {
+			case errors.Is(err, io.EOF) && in.n == offset:
+				res.StreamError = fmt.Sprintf("connection closed before the exit code (after %d frames)", frameNum-1)
+				fmt.Fprintf(stderr, "clawrden-shim [%s]: connection closed unexpectedly before the command's exit code (after %d frames)\n",
+					toolName, frameNum-1)
+			case errors.Is(err, os.ErrDeadlineExceeded):
+				res.StreamError = fmt.Sprintf("no data from warden for %s (frame %d, offset %d)", formatLimit(idle), frameNum, offset)
+				fmt.Fprintf(stderr, "clawrden-shim [%s]: no data from warden for %s, giving up (frame %d, offset %d; set %s to wait longer)\n",
+					toolName, formatLimit(idle), frameNum, offset, IdleTimeoutEnv)
+			default:
+				res.StreamError = fmt.Sprintf("frame %d (offset %d): %v", frameNum, offset, err)
+				fmt.Fprintf(stderr, "clawrden-shim [%s]: stream error at frame %d (offset %d): %v\n",
+					toolName, frameNum, offset, err)
+			}
+			return ExitStreamFailure
+		}
+
+		switch frame.Type {
+		case protocol.StreamStdout:
+			pager.write(frame.Payload, res.RequestID)
+			res.BytesStdout += int64(len(frame.Payload))
+		case protocol.StreamStderr:
+			stderr.Write(frame.Payload)
+			res.BytesStderr += int64(len(frame.Payload))
+		case protocol.StreamExit:
+			return protocol.ParseExitCode(frame)
+		case protocol.StreamMeta:
+			meta, err := protocol.ParseMetadata(frame)
+			if err == nil {
+				res.applyMetadata(meta)
+				pager.limit = pager.limit.tighten(meta)
+			}
+			if err == nil && meta.TimeoutSeconds > 0 {
+				fmt.Fprintf(stderr, "clawrden-shim [%s]: time limit: %s\n", toolName, formatLimit(meta.Timeout()))
+				if limit := meta.Timeout() + idleGrace; idle > 0 && limit > idle {
+					idle = limit
+				}
+			}
+		default:
+			// Unknown frame types come from newer wardens; skip them
+			unknown[frame.Type]++
+		}
+	}
+}
+
+// reportUnknownFrames prints a one-line summary of ignored frame types.
+func reportUnknownFrames(w io.Writer, toolName string, unknown map[byte]int) {
+	if len(unknown) == 0 {
+		return
+	}
+	types := make([]int, 0, len(unknown))
+	total := 0
+	for t, n := range unknown {
+		types = append(types, int(t))
+		total += n
+	}
+	sort.Ints(types)
+	parts := make([]string, len(types))
+	for i, t := range types {
+		parts[i] = fmt.Sprintf("type %d x%d", t, unknown[byte(t)])
+	}
+	fmt.Fprintf(w, "clawrden-shim [%s]: debug: ignored %d unknown frames (%s)\n", toolName, total, strings.Join(parts, ", "))
+}
@@ -0,0 +1,154 @@
+package shim
+
+import (
+	"bytes"
+	"clawrden/pkg/protocol"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// frameBytes encodes a frame as the Warden writes it.
+func frameBytes(typ byte, payload string) []byte {
+	var buf bytes.Buffer
+	protocol.WriteFrame(&buf, protocol.Frame{Type: typ, Payload: []byte(payload)})
+	return buf.Bytes()
+}
+
+// streamFrom runs streamFrames against a fake Warden that writes stream and,
+// unless keepOpen is set, closes the connection.
+func streamFrom(t *testing.T, stream []byte, keepOpen bool, opts streamOptions) (code int, stdout, stderr string) {
+	t.Helper()
+	shimSide, wardenSide := net.Pipe()
+	defer shimSide.Close()
+	defer wardenSide.Close()
+	go func() {
+		wardenSide.Write(stream)
+		if !keepOpen {
+			wardenSide.Close()
+		}
+	}()
+
+	var out, errOut bytes.Buffer
+	code = streamFrames(shimSide, &out, &errOut, "npm", opts, &Result{})
+	return code, out.String(), errOut.String()
+}
+
+func TestStreamFrames(t *testing.T) {
+	hugeLength := []byte{protocol.StreamStdout, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(hugeLength[1:], 64<<20)
+	ok := frameBytes(protocol.StreamStdout, "hello\n")
+
+	tests := []struct {
+		name       string
+		stream     []byte
+		keepOpen   bool
+		wantCode   int
+		wantStdout string
+		wantStderr []string
+	}{
+		{
+			name:       "complete",
+			stream:     join(ok, frameBytes(protocol.StreamStderr, "warn\n"), frameBytes(protocol.StreamExit, "\x03")),
+			wantCode:   3,
+			wantStdout: "hello\n",
+			wantStderr: []string{"warn\n"},
+		},
+		{
+			name:     "legacy empty exit frame",
+			stream:   frameBytes(protocol.StreamExit, ""),
+			wantCode: 0,
+		},
+		{
+			name:       "eof without exit",
+			stream:     ok,
+			wantCode:   ExitStreamFailure,
+			wantStdout: "hello\n",
+			wantStderr: []string{"connection closed unexpectedly", "after 1 frames"},
+		},
+		{
+			name:       "truncated payload",
+			stream:     join(ok, frameBytes(protocol.StreamStdout, "cut short")[:8]),
+			wantCode:   ExitStreamFailure,
+			wantStdout: "hello\n",
+			wantStderr: []string{"frame 2", "offset 11", "read frame payload"},
+		},
+		{
+			name:       "corrupted length",
+			stream:     join(ok, hugeLength),
+			wantCode:   ExitStreamFailure,
+			wantStderr: []string{"frame 2", "frame too large"},
+			wantStdout: "hello\n",
+		},
+		{
+			name:       "desync waits for bytes that never come",
+			stream:     join(ok, []byte{protocol.StreamStdout, 0, 0, 1, 0}),
+			keepOpen:   true,
+			wantCode:   ExitStreamFailure,
+			wantStdout: "hello\n",
+			wantStderr: []string{"no data from warden for 50ms", "frame 2", IdleTimeoutEnv},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, stdout, stderr := streamFrom(t, tt.stream, tt.keepOpen, streamOptions{idleTimeout: 50 * time.Millisecond})
+			if code != tt.wantCode {
+				t.Errorf("exit code = %d, want %d (stderr %q)", code, tt.wantCode, stderr)
+			}
+			if stdout != tt.wantStdout {
+				t.Errorf("stdout = %q, want %q", stdout, tt.wantStdout)
+			}
+			for _, want := range tt.wantStderr {
+				if !strings.Contains(stderr, want) {
+					t.Errorf("stderr = %q, missing %q", stderr, want)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamFramesUnknownTypes(t *testing.T) {
+	stream := join(
+		frameBytes(42, "from the future"),
+		frameBytes(protocol.StreamStdout, "ok"),
+		frameBytes(42, ""),
+		frameBytes(9, "x"),
+		frameBytes(protocol.StreamExit, "\x00"),
+	)
+
+	code, stdout, stderr := streamFrom(t, stream, false, streamOptions{})
+	if code != 0 || stdout != "ok" || stderr != "" {
+		t.Errorf("without debug: code %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+
+	_, _, stderr = streamFrom(t, stream, false, streamOptions{debug: true})
+	if want := "ignored 3 unknown frames (type 9 x1, type 42 x2)"; !strings.Contains(stderr, want) || strings.Count(stderr, "\n") != 1 {
+		t.Errorf("with debug: stderr = %q, want one line with %q", stderr, want)
+	}
+}
+
+func TestStreamFramesAnnouncedLimitExtendsIdleTimeout(t *testing.T) {
+	var meta bytes.Buffer
+	protocol.WriteMetadata(&meta, &protocol.ExecMetadata{TimeoutSeconds: 0.001})
+	// The frame after the announcement arrives later than the idle timeout
+	shimSide, wardenSide := net.Pipe()
+	defer shimSide.Close()
+	go func() {
+		wardenSide.Write(meta.Bytes())
+		time.Sleep(100 * time.Millisecond)
+		wardenSide.Write(frameBytes(protocol.StreamExit, "\x07"))
+		wardenSide.Close()
+	}()
+
+	var stderr bytes.Buffer
+	code := streamFrames(shimSide, &bytes.Buffer{}, &stderr, "npm", streamOptions{idleTimeout: 50 * time.Millisecond}, &Result{})
+	if code != 7 {
+		t.Errorf("exit code = %d, want 7 (stderr %q)", code, stderr.String())
+	}
+}
+
+func join(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
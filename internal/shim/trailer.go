@@ -0,0 +1,52 @@
+package shim
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// TrailerEnv asks the shim to print its trailer line, e.g. "1".
+const TrailerEnv = "CLAWRDEN_TRAILER"
+
+// trailerLine describes how a command was handled in one line on stderr,
+// for agents that tune themselves by it:
+//
+//	clawrden: decision=allow outcome=- wait_ms=0 exec_ms=412 strategy=mirror exit=0 request=req-1
+//
+// The format is a contract. The fields come in this order, each once, as
+// key=value without spaces; a value that is not known is "-". New fields
+// are only ever added at the end, so parsers should ignore keys they do not
+// know.
+func trailerLine(res *Result) string {
+	fields := []struct{ key, value string }{
+		{"decision", res.Decision.String()},
+		{"outcome", res.Outcome.String()},
+		{"wait_ms", strconv.FormatInt(res.WaitMS, 10)},
+		{"exec_ms", strconv.FormatInt(res.ExecMS, 10)},
+		{"strategy", res.Strategy},
+		{"exit", strconv.Itoa(res.ExitCode)},
+		{"request", res.RequestID},
+	}
+	var b strings.Builder
+	b.WriteString("clawrden:")
+	for _, f := range fields {
+		value := strings.Join(strings.Fields(f.value), "_")
+		if value == "" {
+			value = "-"
+		}
+		fmt.Fprintf(&b, " %s=%s", f.key, value)
+	}
+	return b.String()
+}
+
+// writeTrailer prints the trailer line after the command's output, if the
+// environment or the policy asks for it.
+func writeTrailer(res *Result, stderr io.Writer) {
+	enabled, _ := strconv.ParseBool(os.Getenv(TrailerEnv))
+	if enabled || res.trailer {
+		fmt.Fprintln(stderr, trailerLine(res))
+	}
+}
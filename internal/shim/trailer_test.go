@@ -0,0 +1,100 @@
+package shim
+
+import (
+	"bytes"
+	"clawrden/pkg/protocol"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTrailer(t *testing.T) {
+	meta := func(decision protocol.Decision, outcome protocol.Outcome, strategy string) *protocol.ExecMetadata {
+		return &protocol.ExecMetadata{RequestID: "req-7", Decision: decision, Outcome: outcome, Strategy: strategy, WardenVersion: protocol.ProtocolVersion}
+	}
+	exit := func(code byte) protocol.Frame {
+		return protocol.Frame{Type: protocol.StreamExit, Payload: []byte{code}}
+	}
+	tests := []struct {
+		name    string
+		replies []any
+		minWait int64
+		want    string // With wait_ms 1500 and exec_ms 412 when the command ran
+	}{
+		{
+			name:    "allowed",
+			replies: []any{protocol.AckAllowed, meta(protocol.DecisionAllow, protocol.OutcomeNone, "mirror"), exit(0)},
+			want:    "clawrden: decision=allow outcome=- wait_ms=0 exec_ms=412 strategy=mirror exit=0 request=req-7",
+		},
+		{
+			name: "approved by a reviewer",
+			replies: []any{
+				protocol.AckPendingHITL, 20 * time.Millisecond, protocol.AckAllowed,
+				meta(protocol.DecisionAllow, protocol.OutcomeAfterHITL, "ghost"), exit(2),
+			},
+			minWait: 20,
+			want:    "clawrden: decision=allow outcome=after_hitl wait_ms=1500 exec_ms=412 strategy=ghost exit=2 request=req-7",
+		},
+		{
+			name:    "denied",
+			replies: []any{protocol.AckDenied, meta(protocol.DecisionDeny, protocol.OutcomeNone, "")},
+			want:    "clawrden: decision=deny outcome=- wait_ms=0 exec_ms=0 strategy=- exit=1 request=req-7",
+		},
+		{
+			name:    "denied by an older warden",
+			replies: []any{protocol.AckDenied},
+			want:    "clawrden: decision=deny outcome=- wait_ms=0 exec_ms=0 strategy=- exit=1 request=-",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.Dial("unix", scriptedWarden(t, tt.replies...))
+			if err != nil {
+				t.Fatalf("dial: %v", err)
+			}
+			defer conn.Close()
+
+			res := Result{Decision: protocol.DecisionError}
+			res.ExitCode = execute(conn, &protocol.Request{Command: "npm"}, io.Discard, io.Discard, "npm", streamOptions{idleTimeout: time.Second}, &res)
+			if res.WaitMS < tt.minWait {
+				t.Errorf("wait_ms = %d, want at least %d", res.WaitMS, tt.minWait)
+			}
+			// Timings vary; the format does not
+			if res.WaitMS > 0 {
+				res.WaitMS = 1500
+			}
+			if res.Decision == protocol.DecisionAllow {
+				res.ExecMS = 412
+			}
+			if got := trailerLine(&res); got != tt.want {
+				t.Errorf("trailer =\n  %s\nwant\n  %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteTrailer(t *testing.T) {
+	res := &Result{Decision: protocol.DecisionError, ExitCode: 1}
+	const want = "clawrden: decision=error outcome=- wait_ms=0 exec_ms=0 strategy=- exit=1 request=-\n"
+
+	for _, tt := range []struct {
+		env     string
+		trailer bool // Asked for by the policy
+		want    string
+	}{
+		{"", false, ""},
+		{"0", false, ""},
+		{"1", false, want},
+		{"true", false, want},
+		{"", true, want},
+	} {
+		t.Setenv(TrailerEnv, tt.env)
+		res.trailer = tt.trailer
+		var stderr bytes.Buffer
+		writeTrailer(res, &stderr)
+		if stderr.String() != tt.want {
+			t.Errorf("%s=%q, policy %v: wrote %q, want %q", TrailerEnv, tt.env, tt.trailer, stderr.String(), tt.want)
+		}
+	}
+}
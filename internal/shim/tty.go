@@ -0,0 +1,126 @@
+package shim
+
+import (
+	"clawrden/pkg/protocol"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// passthrough passes the shim's terminal through to a command the Warden
+// runs on one (see protocol.TTYVersion): keys typed on stdin reach the
+// command as they are pressed, and it learns the size of the window on
+// stdout, and when it changes.
+type passthrough struct {
+	in, out *os.File
+
+	mu       sync.Mutex
+	oldState *term.State // Of stdin before raw mode; nil outside it
+}
+
+// openPassthrough returns the terminal to pass through, or nil when stdout
+// is not a terminal and the command runs without one.
+func openPassthrough(in, out *os.File) *passthrough {
+	if !term.IsTerminal(int(out.Fd())) {
+		return nil
+	}
+	return &passthrough{in: in, out: out}
+}
+
+// size returns the size of the window, or nil if it is unknown.
+func (t *passthrough) size() *protocol.WindowSize {
+	cols, rows, err := term.GetSize(int(t.out.Fd()))
+	if err != nil {
+		return nil
+	}
+	return &protocol.WindowSize{Rows: uint16(rows), Cols: uint16(cols)}
+}
+
+// forward puts stdin in raw mode, if it is a terminal, and sends what is
+// typed on it and the window's new size after each SIGWINCH to the Warden
+// over conn. A stdin that ends is sent as an empty StreamStdin frame. stop
+// ends forwarding and restores stdin's mode.
+func (t *passthrough) forward(conn net.Conn) (stop func()) {
+	if term.IsTerminal(int(t.in.Fd())) {
+		if state, err := term.MakeRaw(int(t.in.Fd())); err == nil {
+			t.mu.Lock()
+			t.oldState = state
+			t.mu.Unlock()
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := t.in.Read(buf)
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if n > 0 {
+				if protocol.WriteFrame(conn, protocol.Frame{Type: protocol.StreamStdin, Payload: buf[:n]}) != nil {
+					return
+				}
+			}
+			if err == io.EOF {
+				protocol.WriteFrame(conn, protocol.Frame{Type: protocol.StreamStdin})
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	go func() {
+		last := t.size()
+		for {
+			select {
+			case <-winch:
+				size := t.size()
+				if size == nil || (last != nil && *size == *last) {
+					continue
+				}
+				last = size
+				if protocol.WriteResize(conn, *size) != nil {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(winch)
+		close(done)
+		// Unblocks the input read where stdin supports it; elsewhere the
+		// read is abandoned, as the shim is about to exit
+		t.in.SetReadDeadline(time.Now())
+		t.restore()
+	}
+}
+
+// restore leaves raw mode. It may be called at any time, and on a nil
+// terminal.
+func (t *passthrough) restore() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.oldState != nil {
+		term.Restore(int(t.in.Fd()), t.oldState)
+		t.oldState = nil
+	}
+}
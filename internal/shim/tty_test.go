@@ -0,0 +1,166 @@
+package shim
+
+import (
+	"bytes"
+	"clawrden/pkg/protocol"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// openPTY opens a pseudo-terminal pair standing in for the user's terminal:
+// the shim reads and writes the slave, the test types and reads the screen
+// on the master.
+func openPTY(t *testing.T, rows, cols uint16) (master, slave *os.File) {
+	t.Helper()
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("no pseudo-terminals: %v", err)
+	}
+	t.Cleanup(func() { master.Close() })
+
+	var n int
+	control(t, master, func(fd int) error {
+		if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+			return err
+		}
+		n, err = unix.IoctlGetInt(fd, unix.TIOCGPTN)
+		return err
+	})
+	slave, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("open pseudo-terminal: %v", err)
+	}
+	t.Cleanup(func() { slave.Close() })
+	resizePTY(t, slave, rows, cols)
+	return master, slave
+}
+
+// control runs fn on f's descriptor without switching it to blocking mode,
+// as Fd would, so that read deadlines keep working.
+func control(t *testing.T, f *os.File, fn func(fd int) error) {
+	t.Helper()
+	conn, err := f.SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fnErr error
+	if err := conn.Control(func(fd uintptr) { fnErr = fn(int(fd)) }); err != nil {
+		t.Fatal(err)
+	}
+	if fnErr != nil {
+		t.Fatal(fnErr)
+	}
+}
+
+func resizePTY(t *testing.T, f *os.File, rows, cols uint16) {
+	t.Helper()
+	control(t, f, func(fd int) error {
+		return unix.IoctlSetWinsize(fd, unix.TIOCSWINSZ, &unix.Winsize{Row: rows, Col: cols})
+	})
+}
+
+// readScreen reads the master until the screen shows want.
+func readScreen(t *testing.T, master *os.File, screen *bytes.Buffer, want string) {
+	t.Helper()
+	master.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 256)
+	for !strings.Contains(screen.String(), want) {
+		n, err := master.Read(buf)
+		screen.Write(buf[:n])
+		if err != nil {
+			t.Fatalf("screen shows %q, want %q: %v", screen.String(), want, err)
+		}
+	}
+}
+
+func TestTerminalPassthroughEchoesPrompt(t *testing.T) {
+	master, slave := openPTY(t, 24, 80)
+	tty := openPassthrough(slave, slave)
+	if tty == nil {
+		t.Fatal("a pseudo-terminal is not a terminal")
+	}
+	req := &protocol.Request{Command: "passwd", Cwd: "/", TTY: true, WindowSize: tty.size()}
+
+	// A Warden running passwd on a terminal, which echoes what it reads
+	// and asks again once the window is resized
+	shimSide, wardenSide := net.Pipe()
+	defer shimSide.Close()
+	wardenErr := make(chan error, 1)
+	go func() {
+		defer wardenSide.Close()
+		wardenErr <- func() error {
+			got, err := protocol.ReadRequest(wardenSide)
+			if err != nil {
+				return err
+			}
+			if !got.TTY || got.WindowSize == nil || *got.WindowSize != (protocol.WindowSize{Rows: 24, Cols: 80}) {
+				return fmt.Errorf("request tty %v, window %+v; want a 24x80 terminal", got.TTY, got.WindowSize)
+			}
+			protocol.WriteAck(wardenSide, protocol.AckAllowed)
+			protocol.WriteFrame(wardenSide, protocol.Frame{Type: protocol.StreamStdout, Payload: []byte("Password: ")})
+
+			var typed []byte
+			for !bytes.HasSuffix(typed, []byte("\r")) {
+				f, err := protocol.ReadFrame(wardenSide)
+				if err != nil {
+					return err
+				}
+				if f.Type != protocol.StreamStdin {
+					return fmt.Errorf("frame type %d, want stdin", f.Type)
+				}
+				typed = append(typed, f.Payload...)
+			}
+			protocol.WriteFrame(wardenSide, protocol.Frame{Type: protocol.StreamStdout, Payload: []byte("echo: " + string(typed) + "\n")})
+
+			f, err := protocol.ReadFrame(wardenSide)
+			if err != nil {
+				return err
+			}
+			if size, err := protocol.ParseResize(f); f.Type != protocol.StreamResize || err != nil || size != (protocol.WindowSize{Rows: 40, Cols: 120}) {
+				return fmt.Errorf("frame %d %q after resizing, want a 40x120 resize", f.Type, f.Payload)
+			}
+			return protocol.WriteExitCode(wardenSide, 0)
+		}()
+	}()
+
+	code := make(chan int, 1)
+	go func() {
+		code <- execute(shimSide, req, slave, io.Discard, "passwd", streamOptions{terminal: tty}, &Result{})
+	}()
+
+	var screen bytes.Buffer
+	readScreen(t, master, &screen, "Password: ")
+	master.Write([]byte("hunter2\r"))
+	readScreen(t, master, &screen, "echo: hunter2\r")
+	resizePTY(t, slave, 40, 120)
+	syscall.Kill(os.Getpid(), syscall.SIGWINCH)
+
+	if err := <-wardenErr; err != nil {
+		t.Fatal(err)
+	}
+	if got := <-code; got != 0 {
+		t.Errorf("exit code %d, want 0", got)
+	}
+	// Raw mode: the typed line reached the command as it was, carriage
+	// return and all, and the terminal did not echo it itself
+	if strings.Count(screen.String(), "hunter2") != 1 {
+		t.Errorf("screen %q echoes the input other than once", screen.String())
+	}
+
+	// The terminal is back in the mode it was in
+	control(t, slave, func(fd int) error {
+		termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+		if err == nil && termios.Lflag&unix.ECHO == 0 {
+			t.Error("terminal left in raw mode")
+		}
+		return err
+	})
+}
@@ -0,0 +1,12 @@
+//go:build embedshim
+
+package shimbin
+
+import _ "embed"
+
+//go:embed clawrden-shim
+var embedded []byte
+
+func init() {
+	binary = embedded
+}
@@ -0,0 +1,12 @@
+// Package shimbin carries the shim binary embedded into the warden at build
+// time. `make build-warden` builds the shim, copies it here and compiles the
+// warden with the embedshim build tag; without the tag nothing is embedded.
+package shimbin
+
+// binary is set by embed.go in builds with the embedshim tag.
+var binary []byte
+
+// Binary returns the embedded shim, or nil if the warden was built without one.
+func Binary() []byte {
+	return binary
+}
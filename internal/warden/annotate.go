@@ -0,0 +1,501 @@
+package warden
+
+import (
+	"clawrden/internal/cliout"
+	"clawrden/pkg/protocol"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultAnnotateTimeout bounds how long an ask waits for its annotations.
+const defaultAnnotateTimeout = 500 * time.Millisecond
+
+// maxRmEntries caps how many entries the rm annotator enumerates.
+const maxRmEntries = 10000
+
+// Annotation is impact context computed for an ask before it is queued, so
+// reviewers see what the command would touch: how much rm would delete,
+// where git push would push. Annotators read only arguments and file
+// metadata; nothing is run.
+type Annotation struct {
+	Command string `json:"command"`
+	Summary string `json:"summary,omitempty"` // One line for reviewers
+	Details any    `json:"details,omitempty"` // What the annotator found, e.g. RmImpact
+	Error   string `json:"error,omitempty"`   // Why there is no summary
+}
+
+// AnnotatePolicy picks the commands whose asks are annotated.
+type AnnotatePolicy struct {
+	Commands []string      `yaml:"commands,omitempty"` // Commands with a built-in annotator, e.g. [rm, git, kubectl, npm]
+	Timeout  time.Duration `yaml:"timeout,omitempty"`  // Longest an ask waits for its annotations (default: 500ms)
+}
+
+// validate checks the annotate settings.
+func (p AnnotatePolicy) validate() error {
+	for _, cmd := range p.Commands {
+		if _, ok := annotators[cmd]; !ok {
+			return fmt.Errorf("annotate.commands: no annotator for %q", cmd)
+		}
+	}
+	if p.Timeout < 0 {
+		return fmt.Errorf("annotate.timeout must not be negative")
+	}
+	return nil
+}
+
+// annotates reports whether asks for command are annotated.
+func (p AnnotatePolicy) annotates(command string) bool {
+	return slices.Contains(p.Commands, command)
+}
+
+// annotateInput is what an annotator sees of a command.
+type annotateInput struct {
+	args []string
+	// path returns where the warden sees a path of the command, resolved
+	// against its working directory
+	path func(string) string
+}
+
+// annotator describes what a command would do. An empty summary with no
+// error means it has nothing to say, as for git commands other than push.
+// It must return soon after ctx is done.
+type annotator func(ctx context.Context, in annotateInput) (summary string, details any, err error)
+
+// annotators are the built-in annotators, by the command they describe. It
+// is read-only; servers get it as their annotators.
+var annotators = map[string]annotator{
+	"rm":      annotateRm,
+	"git":     annotateGitPush,
+	"kubectl": annotateKubectl,
+	"npm":     packageAnnotator(npm),
+	"pnpm":    packageAnnotator(npm),
+	"yarn":    packageAnnotator(npm),
+	"pip":     packageAnnotator(pip),
+	"pip3":    packageAnnotator(pip),
+	"apt":     packageAnnotator(apt),
+	"apt-get": packageAnnotator(apt),
+	"gem":     packageAnnotator(gem),
+	"cargo":   packageAnnotator(cargo),
+}
+
+// annotate runs the policy's annotators for req, or for each command of a
+// shell script, and returns what they found within the annotate timeout.
+// Annotators still running then are reported as timed out and left to
+// finish on their own, so a slow filesystem never holds up the queue.
+func (s *Server) annotate(policy *PolicyEngine, req *protocol.Request, subcommands []SubcommandDecision) []Annotation {
+	cfg := policy.config.Annotate
+	commands := []SubcommandDecision{{Command: req.Command, Args: req.Args}}
+	if len(subcommands) > 0 {
+		commands = subcommands
+	}
+	var targets []SubcommandDecision
+	var fns []annotator
+	for _, cmd := range commands {
+		name := filepath.Base(cmd.Command)
+		if fn, ok := s.annotators[name]; ok && cfg.annotates(name) {
+			targets = append(targets, cmd)
+			fns = append(fns, fn)
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultAnnotateTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	results := make([]*Annotation, len(targets))
+	for i, cmd := range targets {
+		results[i] = &Annotation{Command: cmd.Command, Error: fmt.Sprintf("timed out after %v", timeout)}
+	}
+	var wg sync.WaitGroup
+	for i, cmd := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			in := annotateInput{args: cmd.Args, path: func(p string) string { return s.annotatePath(req.Cwd, p) }}
+			a := runAnnotator(ctx, fns[i], cmd.Command, in)
+			mu.Lock()
+			results[i] = a
+			mu.Unlock()
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.logger.Printf("warning: annotating %s took longer than %v; queueing it without some annotations", req.Command, timeout)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var annotations []Annotation
+	for _, a := range results {
+		if a != nil {
+			annotations = append(annotations, *a)
+		}
+	}
+	return annotations
+}
+
+// runAnnotator runs fn, command's annotator, returning nil when it has
+// nothing to say.
+func runAnnotator(ctx context.Context, fn annotator, command string, in annotateInput) *Annotation {
+	summary, details, err := fn(ctx, in)
+	switch {
+	case err != nil:
+		return &Annotation{Command: command, Error: err.Error()}
+	case summary == "":
+		return nil
+	}
+	return &Annotation{Command: command, Summary: summary, Details: details}
+}
+
+// annotatePath resolves p against cwd. With a workspace directory
+// configured, paths under /app are read from there.
+func (s *Server) annotatePath(cwd, p string) string {
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(cwd, p)
+	}
+	p = filepath.Clean(p)
+	if s.config.WorkspaceDir != "" && (p == "/app" || strings.HasPrefix(p, "/app/")) {
+		return filepath.Join(s.config.WorkspaceDir, strings.TrimPrefix(p, "/app"))
+	}
+	return p
+}
+
+// RmImpact is what an rm command would delete.
+type RmImpact struct {
+	Files     int      `json:"files"` // Files and symlinks; directories are not counted
+	Bytes     int64    `json:"bytes"`
+	Missing   []string `json:"missing,omitempty"`   // Paths that do not exist
+	Truncated bool     `json:"truncated,omitempty"` // Enumeration stopped at maxRmEntries; the counts are lower bounds
+}
+
+// annotateRm counts the files rm would delete and their total size.
+// Directories count only with -r; rm refuses them otherwise.
+func annotateRm(ctx context.Context, in annotateInput) (string, any, error) {
+	var paths []string
+	recursive, flags := false, true
+	for _, arg := range in.args {
+		switch {
+		case flags && arg == "--":
+			flags = false
+		case flags && arg == "--recursive":
+			recursive = true
+		case flags && strings.HasPrefix(arg, "--"):
+		case flags && strings.HasPrefix(arg, "-") && arg != "-":
+			recursive = recursive || strings.ContainsAny(arg, "rR")
+		default:
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) == 0 {
+		return "", nil, nil
+	}
+
+	var impact RmImpact
+	entries := 0
+	for _, p := range paths {
+		root := in.path(p)
+		info, err := os.Lstat(root)
+		if errors.Is(err, fs.ErrNotExist) {
+			impact.Missing = append(impact.Missing, p)
+			continue
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		if !info.IsDir() {
+			impact.Files++
+			impact.Bytes += info.Size()
+			entries++
+			continue
+		}
+		if !recursive {
+			continue
+		}
+		err = filepath.WalkDir(root, func(_ string, d fs.DirEntry, err error) error {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			if entries >= maxRmEntries {
+				impact.Truncated = true
+				return filepath.SkipAll
+			}
+			entries++
+			if err != nil || d.IsDir() {
+				return nil // Unreadable entries are skipped
+			}
+			impact.Files++
+			if info, err := d.Info(); err == nil {
+				impact.Bytes += info.Size()
+			}
+			return nil
+		})
+		if err != nil {
+			return "", nil, err
+		}
+		if impact.Truncated {
+			break
+		}
+	}
+
+	summary := fmt.Sprintf("deletes %s (%s)", countOf(impact.Files, "file"), cliout.FormatBytes(impact.Bytes))
+	if impact.Truncated {
+		summary = fmt.Sprintf("deletes at least %s (%s+)", countOf(impact.Files, "file"), cliout.FormatBytes(impact.Bytes))
+	}
+	if len(impact.Missing) > 0 {
+		summary += fmt.Sprintf("; %s missing", countOf(len(impact.Missing), "path"))
+	}
+	return summary, impact, nil
+}
+
+// countOf renders n of noun, e.g. "1 file" or "3 files".
+func countOf(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// GitPushImpact is where a git push command pushes.
+type GitPushImpact struct {
+	Remote   string   `json:"remote,omitempty"` // Empty: the current branch's upstream
+	Refspecs []string `json:"refspecs,omitempty"`
+	Flags    []string `json:"flags,omitempty"` // Notable options: force, delete, all, mirror, tags, dry-run
+}
+
+// gitPushFlags are the git push options worth a reviewer's attention.
+var gitPushFlags = map[string]string{
+	"-f":                 "force",
+	"--force":            "force",
+	"--force-with-lease": "force",
+	"-d":                 "delete",
+	"--delete":           "delete",
+	"--all":              "all",
+	"--mirror":           "mirror",
+	"--tags":             "tags",
+	"-n":                 "dry-run",
+	"--dry-run":          "dry-run",
+}
+
+// annotateGitPush parses the remote and refspecs of git push.
+func annotateGitPush(_ context.Context, in annotateInput) (string, any, error) {
+	args := in.args
+	// Global options come before the subcommand; -C and -c take a value
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		if args[0] == "-C" || args[0] == "-c" {
+			args = args[1:]
+		}
+		args = args[1:]
+	}
+	if len(args) == 0 || args[0] != "push" {
+		return "", nil, nil
+	}
+
+	var impact GitPushImpact
+	addFlag := func(flag string) {
+		if !slices.Contains(impact.Flags, flag) {
+			impact.Flags = append(impact.Flags, flag)
+		}
+	}
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-o" || arg == "--push-option":
+			i++
+		case strings.HasPrefix(arg, "-"):
+			name, _, _ := strings.Cut(arg, "=")
+			if flag, ok := gitPushFlags[name]; ok {
+				addFlag(flag)
+			}
+		case impact.Remote == "":
+			impact.Remote = arg
+		default:
+			impact.Refspecs = append(impact.Refspecs, arg)
+			if strings.HasPrefix(arg, "+") {
+				addFlag("force")
+			}
+			if strings.HasPrefix(arg, ":") {
+				addFlag("delete")
+			}
+		}
+	}
+
+	remote := impact.Remote
+	if remote == "" {
+		remote = "the current branch's upstream"
+	}
+	summary := "push to " + remote
+	if len(impact.Refspecs) > 0 {
+		summary += " " + strings.Join(impact.Refspecs, ", ")
+	}
+	if len(impact.Flags) > 0 {
+		summary += " (" + strings.Join(impact.Flags, ", ") + ")"
+	}
+	return summary, impact, nil
+}
+
+// KubectlImpact is where a kubectl command acts.
+type KubectlImpact struct {
+	Verb          string `json:"verb,omitempty"`
+	Namespace     string `json:"namespace,omitempty"` // Empty: the context's namespace
+	AllNamespaces bool   `json:"all_namespaces,omitempty"`
+	Context       string `json:"context,omitempty"` // Empty: the kubeconfig's current context
+}
+
+// kubectlValueFlags take their value as the next argument.
+var kubectlValueFlags = map[string]bool{
+	"-n": true, "--namespace": true, "--context": true,
+	"-f": true, "--filename": true, "-l": true, "--selector": true,
+	"-o": true, "--output": true, "-c": true, "--container": true,
+	"--kubeconfig": true, "--cluster": true, "--user": true, "-s": true, "--server": true,
+}
+
+// annotateKubectl parses the verb, namespace and context of kubectl.
+func annotateKubectl(_ context.Context, in annotateInput) (string, any, error) {
+	var impact KubectlImpact
+	args := in.args
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name, value, hasValue := strings.Cut(arg, "=")
+		if !hasValue && kubectlValueFlags[arg] && i+1 < len(args) {
+			i++
+			value, hasValue = args[i], true
+		}
+		switch {
+		case arg == "-A" || arg == "--all-namespaces":
+			impact.AllNamespaces = true
+		case (name == "-n" || name == "--namespace") && hasValue:
+			impact.Namespace = value
+		case strings.HasPrefix(arg, "-n") && !strings.HasPrefix(arg, "--") && len(arg) > 2:
+			impact.Namespace = arg[2:]
+		case name == "--context" && hasValue:
+			impact.Context = value
+		case !strings.HasPrefix(arg, "-") && impact.Verb == "":
+			impact.Verb = arg
+		}
+	}
+
+	summary := impact.Verb
+	if summary == "" {
+		summary = "kubectl"
+	}
+	switch {
+	case impact.AllNamespaces:
+		summary += " in all namespaces"
+	case impact.Namespace != "":
+		summary += " in namespace " + impact.Namespace
+	default:
+		summary += " in the context's default namespace"
+	}
+	if impact.Context != "" {
+		summary += " on context " + impact.Context
+	} else {
+		summary += " on the current context"
+	}
+	return summary, impact, nil
+}
+
+// PackageImpact is what a package manager command installs or removes.
+type PackageImpact struct {
+	Verb     string   `json:"verb"`
+	Packages []string `json:"packages,omitempty"`
+	Files    []string `json:"files,omitempty"` // Requirement files, e.g. pip's -r
+}
+
+// packageManager is how a package manager's command line names packages.
+type packageManager struct {
+	verbs      []string        // Subcommands that take package names
+	valueFlags map[string]bool // Flags that take the next argument as their value
+	fileFlags  map[string]bool // Flags whose value is a file of requirements
+}
+
+var (
+	npm = packageManager{
+		verbs:      []string{"install", "i", "add", "uninstall", "remove", "rm", "update", "up", "upgrade"},
+		valueFlags: map[string]bool{"--registry": true, "--prefix": true, "-w": true, "--workspace": true, "--tag": true, "--cache": true, "--filter": true},
+	}
+	pip = packageManager{
+		verbs: []string{"install", "uninstall", "download"},
+		valueFlags: map[string]bool{"-c": true, "--constraint": true, "-i": true, "--index-url": true, "--extra-index-url": true,
+			"-t": true, "--target": true, "--prefix": true, "--root": true, "-f": true, "--find-links": true},
+		fileFlags: map[string]bool{"-r": true, "--requirement": true},
+	}
+	apt = packageManager{
+		verbs:      []string{"install", "remove", "purge", "reinstall"},
+		valueFlags: map[string]bool{"-o": true, "--option": true, "-t": true, "--target-release": true, "-c": true, "--config-file": true},
+	}
+	gem = packageManager{
+		verbs:      []string{"install", "uninstall", "update"},
+		valueFlags: map[string]bool{"-v": true, "--version": true, "-s": true, "--source": true, "-i": true, "--install-dir": true},
+	}
+	cargo = packageManager{
+		verbs: []string{"add", "install", "remove", "rm"},
+		valueFlags: map[string]bool{"--version": true, "--git": true, "--path": true, "--branch": true, "--tag": true, "--rev": true,
+			"-F": true, "--features": true, "--registry": true, "--root": true, "-p": true, "--package": true},
+	}
+)
+
+// packageAnnotator returns an annotator listing the packages m's command
+// names.
+func packageAnnotator(m packageManager) annotator {
+	return func(_ context.Context, in annotateInput) (string, any, error) {
+		var impact PackageImpact
+		args := in.args
+		for i := 0; i < len(args); i++ {
+			arg := args[i]
+			name, value, hasValue := strings.Cut(arg, "=")
+			switch {
+			case m.fileFlags[name]:
+				if !hasValue && i+1 < len(args) {
+					i++
+					value = args[i]
+				}
+				impact.Files = append(impact.Files, value)
+			case m.valueFlags[arg]:
+				i++
+			case strings.HasPrefix(arg, "-"):
+			case impact.Verb == "":
+				impact.Verb = arg
+			default:
+				impact.Packages = append(impact.Packages, arg)
+			}
+		}
+		if !slices.Contains(m.verbs, impact.Verb) {
+			return "", nil, nil
+		}
+
+		var named []string
+		named = append(named, impact.Packages...)
+		for _, f := range impact.Files {
+			named = append(named, "everything in "+f)
+		}
+		if len(named) == 0 {
+			return impact.Verb + " the project's dependencies", impact, nil
+		}
+		const shown = 10
+		if len(named) > shown {
+			named = append(named[:shown], fmt.Sprintf("and %d more", len(named)-shown))
+		}
+		return impact.Verb + " " + strings.Join(named, ", "), impact, nil
+	}
+}
@@ -0,0 +1,230 @@
+package warden
+
+import (
+	"clawrden/pkg/protocol"
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// identityPaths resolves paths against cwd as the warden does without a
+// workspace directory.
+func identityPaths(cwd string) func(string) string {
+	return func(p string) string { return (&Server{}).annotatePath(cwd, p) }
+}
+
+func TestAnnotateRm(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "12345")
+	writeTestFile(t, filepath.Join(dir, "build", "x.o"), "1234567890")
+	writeTestFile(t, filepath.Join(dir, "build", "sub", "y.o"), "12")
+
+	tests := []struct {
+		name    string
+		args    []string
+		summary string
+		impact  RmImpact
+	}{
+		{"file", []string{"a.txt"}, "deletes 1 file (5B)", RmImpact{Files: 1, Bytes: 5}},
+		{"recursive", []string{"-rf", "build", "a.txt"}, "deletes 3 files (17B)", RmImpact{Files: 3, Bytes: 17}},
+		{"directory without -r", []string{"build"}, "deletes 0 files (0B)", RmImpact{}},
+		{"missing", []string{"-f", "gone", dir + "/a.txt"}, "deletes 1 file (5B); 1 path missing", RmImpact{Files: 1, Bytes: 5, Missing: []string{"gone"}}},
+		{"after --", []string{"--", "-r"}, "deletes 0 files (0B); 1 path missing", RmImpact{Missing: []string{"-r"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary, details, err := annotateRm(context.Background(), annotateInput{args: tt.args, path: identityPaths(dir)})
+			if err != nil {
+				t.Fatalf("annotateRm: %v", err)
+			}
+			if summary != tt.summary || !reflect.DeepEqual(details, tt.impact) {
+				t.Errorf("got %q %+v, want %q %+v", summary, details, tt.summary, tt.impact)
+			}
+		})
+	}
+
+	if summary, _, _ := annotateRm(context.Background(), annotateInput{args: []string{"-f"}, path: identityPaths(dir)}); summary != "" {
+		t.Errorf("rm without paths: %q, want nothing", summary)
+	}
+}
+
+func TestAnnotateRmCapsEnumeration(t *testing.T) {
+	dir := t.TempDir()
+	for i := range maxRmEntries + 5 {
+		writeTestFile(t, filepath.Join(dir, "many", strconv.Itoa(i/1000), strconv.Itoa(i)), "")
+	}
+
+	_, details, err := annotateRm(context.Background(), annotateInput{args: []string{"-r", "many"}, path: identityPaths(dir)})
+	if err != nil {
+		t.Fatalf("annotateRm: %v", err)
+	}
+	impact := details.(RmImpact)
+	if !impact.Truncated || impact.Files >= maxRmEntries {
+		t.Errorf("impact = %+v, want a truncated count", impact)
+	}
+}
+
+func TestAnnotateGitPush(t *testing.T) {
+	tests := []struct {
+		args    []string
+		summary string
+	}{
+		{[]string{"push"}, "push to the current branch's upstream"},
+		{[]string{"push", "origin", "main"}, "push to origin main"},
+		{[]string{"-C", "/app", "push", "-f", "--force-with-lease", "upstream", "HEAD:release"}, "push to upstream HEAD:release (force)"},
+		{[]string{"push", "-o", "ci.skip", "origin", "+main", ":old"}, "push to origin +main, :old (force, delete)"},
+		{[]string{"push", "--tags", "--dry-run", "origin"}, "push to origin (tags, dry-run)"},
+		{[]string{"pull", "origin", "main"}, ""},
+		{[]string{"-c", "push.default=current", "status"}, ""},
+	}
+	for _, tt := range tests {
+		summary, _, err := annotateGitPush(context.Background(), annotateInput{args: tt.args})
+		if err != nil || summary != tt.summary {
+			t.Errorf("git %q: %q, %v; want %q", tt.args, summary, err, tt.summary)
+		}
+	}
+}
+
+func TestAnnotateKubectl(t *testing.T) {
+	tests := []struct {
+		args    []string
+		summary string
+		impact  KubectlImpact
+	}{
+		{[]string{"delete", "pod", "web-1"}, "delete in the context's default namespace on the current context", KubectlImpact{Verb: "delete"}},
+		{[]string{"--context", "prod", "-n", "payments", "delete", "deploy", "api"}, "delete in namespace payments on context prod", KubectlImpact{Verb: "delete", Namespace: "payments", Context: "prod"}},
+		{[]string{"apply", "-f", "deploy.yaml", "--namespace=staging", "--context=stage"}, "apply in namespace staging on context stage", KubectlImpact{Verb: "apply", Namespace: "staging", Context: "stage"}},
+		{[]string{"get", "pods", "-A"}, "get in all namespaces on the current context", KubectlImpact{Verb: "get", AllNamespaces: true}},
+		{[]string{"-nkube-system", "rollout", "restart", "ds/proxy"}, "rollout in namespace kube-system on the current context", KubectlImpact{Verb: "rollout", Namespace: "kube-system"}},
+	}
+	for _, tt := range tests {
+		summary, details, err := annotateKubectl(context.Background(), annotateInput{args: tt.args})
+		if err != nil || summary != tt.summary || details != tt.impact {
+			t.Errorf("kubectl %q: %q %+v, %v; want %q %+v", tt.args, summary, details, err, tt.summary, tt.impact)
+		}
+	}
+}
+
+func TestAnnotatePackages(t *testing.T) {
+	tests := []struct {
+		command string
+		args    []string
+		summary string
+	}{
+		{"npm", []string{"install", "--save-dev", "left-pad", "lodash@4"}, "install left-pad, lodash@4"},
+		{"npm", []string{"install"}, "install the project's dependencies"},
+		{"npm", []string{"run", "build"}, ""},
+		{"yarn", []string{"add", "--registry", "https://r.example", "react"}, "add react"},
+		{"pip", []string{"install", "-r", "requirements.txt", "--index-url", "https://pypi.example", "requests==2.31"}, "install requests==2.31, everything in requirements.txt"},
+		{"pip3", []string{"uninstall", "-y", "numpy"}, "uninstall numpy"},
+		{"apt-get", []string{"-o", "Dpkg::Use-Pty=0", "install", "-y", "curl", "jq"}, "install curl, jq"},
+		{"cargo", []string{"add", "serde", "--features", "derive"}, "add serde"},
+		{"npm", []string{"i", "a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l"}, "i a, b, c, d, e, f, g, h, i, j, and 2 more"},
+	}
+	for _, tt := range tests {
+		summary, _, err := annotators[tt.command](context.Background(), annotateInput{args: tt.args})
+		if err != nil || summary != tt.summary {
+			t.Errorf("%s %q: %q, %v; want %q", tt.command, tt.args, summary, err, tt.summary)
+		}
+	}
+}
+
+func TestAnnotateAsk(t *testing.T) {
+	srv := newTestServer(t)
+	dir := t.TempDir()
+	srv.config.WorkspaceDir = dir
+	writeTestFile(t, filepath.Join(dir, "logs", "app.log"), "hello")
+
+	release := make(chan struct{})
+	defer close(release)
+	srv.annotators = maps.Clone(annotators)
+	srv.annotators["slow"] = func(context.Context, annotateInput) (string, any, error) {
+		<-release // Ignores its deadline
+		return "too late", nil, nil
+	}
+
+	policy := &PolicyEngine{config: PolicyConfig{Annotate: AnnotatePolicy{
+		Commands: []string{"rm", "git", "slow"},
+		Timeout:  50 * time.Millisecond,
+	}}}
+
+	// Workspace paths are read from the warden's workspace directory
+	got := srv.annotate(policy, &protocol.Request{Command: "/bin/rm", Args: []string{"logs/app.log"}, Cwd: "/app"}, nil)
+	if len(got) != 1 || got[0].Command != "/bin/rm" || got[0].Summary != "deletes 1 file (5B)" {
+		t.Errorf("rm annotations = %+v", got)
+	}
+
+	// A script's commands are annotated one by one, and a slow annotator
+	// does not hold up the ask
+	start := time.Now()
+	got = srv.annotate(policy, &protocol.Request{Command: "sh", Cwd: "/app"}, []SubcommandDecision{
+		{Command: "git", Args: []string{"push", "origin", "main"}},
+		{Command: "git", Args: []string{"status"}},
+		{Command: "ls"},
+		{Command: "slow"},
+	})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("annotating took %v", elapsed)
+	}
+	want := []Annotation{
+		{Command: "git", Summary: "push to origin main", Details: GitPushImpact{Remote: "origin", Refspecs: []string{"main"}}},
+		{Command: "slow", Error: "timed out after 50ms"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("script annotations = %+v, want %+v", got, want)
+	}
+
+	if got := srv.annotate(&PolicyEngine{}, &protocol.Request{Command: "rm", Args: []string{"x"}}, nil); got != nil {
+		t.Errorf("annotations without annotate.commands = %+v", got)
+	}
+}
+
+func TestAnnotatePolicyValidation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	for _, bad := range []string{"annotate:\n  commands: [make]\n", "annotate:\n  timeout: -1s\n"} {
+		writeTestFile(t, path, "default_action: deny\n"+bad)
+		if _, err := LoadPolicy(path); err == nil {
+			t.Errorf("LoadPolicy accepted %q", bad)
+		}
+	}
+}
+
+func TestQueueEntryAPI(t *testing.T) {
+	srv := newTestServer(t)
+	api := &APIServer{warden: srv}
+
+	go srv.hitl.EnqueueOutcome(context.Background(), &protocol.Request{Command: "rm", Args: []string{"-rf", "build"}}, &ReviewInfo{
+		Annotations: []Annotation{{Command: "rm", Summary: "deletes 3 files (17B)"}},
+	})
+	var id string
+	for deadline := time.Now().Add(5 * time.Second); id == "" && time.Now().Before(deadline); {
+		if pending := srv.hitl.List(); len(pending) == 1 {
+			id = pending[0].ID
+		}
+		time.Sleep(time.Millisecond)
+	}
+	defer srv.hitl.Resolve(id, DecisionDeny)
+
+	rec := httptest.NewRecorder()
+	api.handleQueueAction(rec, httptest.NewRequest(http.MethodGet, "/api/queue/"+id, nil))
+	var entry QueueEntry
+	if err := json.NewDecoder(rec.Body).Decode(&entry); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if rec.Code != http.StatusOK || entry.ID != id || len(entry.Annotations) != 1 || entry.Annotations[0].Summary != "deletes 3 files (17B)" {
+		t.Errorf("GET /api/queue/%s = %d %+v", id, rec.Code, entry)
+	}
+
+	rec = httptest.NewRecorder()
+	api.handleQueueAction(rec, httptest.NewRequest(http.MethodGet, "/api/queue/nope", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown ID: status %d, want 404", rec.Code)
+	}
+}
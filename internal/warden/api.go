@@ -2,144 +2,1003 @@
 package warden
 
 import (
+	"bytes"
+	"clawrden/internal/cliout"
+	"clawrden/internal/faultinject"
+	"clawrden/internal/jailhouse"
 	"clawrden/pkg/protocol"
-	_ "embed"
+	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
-//go:embed web/dashboard.html
-var dashboardHTML string
-
 // APIServer provides HTTP endpoints for warden control.
 type APIServer struct {
-	warden *Server
-	server *http.Server
-	logger *log.Logger
-	mu     sync.Mutex
+	warden  *Server
+	server  *http.Server // The next server to start, or the one serving
+	handler http.Handler
+	logger  *log.Logger
+	mu      sync.Mutex
+
+	// Listener lifecycle (see api_lifecycle.go), guarded by lifecycleMu
+	lifecycleMu sync.Mutex
+	listener    net.Listener  // nil while stopped
+	served      chan struct{} // Closed when the running server's Serve returns
+
+	// Request instrumentation
+	debug         bool          // Log every request, not just slow ones and errors
+	slowThreshold time.Duration // Requests slower than this are logged as warnings
+	metrics       *routeMetrics
+
+	assets map[string]*staticAsset // Embedded web files; nil when the dashboard is disabled
+
+	// Browser access (see api_cors.go)
+	allowedOrigins []string // Origins allowed to call the API cross-origin
+	csrfKey        []byte   // Signs the dashboard's CSRF cookie
+
+	// Live dashboard connections (see api_ws.go), guarded by mu
+	wsClients    map[*wsClient]struct{}
+	wsPingPeriod time.Duration // Zero means wsPingPeriod
+	closing      bool
+}
+
+// NewAPIServer creates a new HTTP API server.
+func NewAPIServer(warden *Server, addr string, logger *log.Logger) *APIServer {
+	api := &APIServer{
+		warden:        warden,
+		logger:        logger,
+		debug:         warden.config.APIDebug,
+		slowThreshold: warden.config.SlowRequestThreshold,
+		metrics:       newRouteMetrics(),
+		csrfKey:       make([]byte, 32),
+	}
+	rand.Read(api.csrfKey)
+	for _, origin := range warden.config.AllowedOrigins {
+		api.allowedOrigins = append(api.allowedOrigins, normalizeOrigin(origin))
+	}
+	if api.slowThreshold == 0 {
+		api.slowThreshold = defaultSlowRequestThreshold
+	}
+	if !warden.config.DisableDashboard {
+		assets, err := loadStaticAssets()
+		if err != nil {
+			logger.Printf("warning: dashboard disabled: %v", err)
+		}
+		api.assets = assets
+	}
+
+	mux := http.NewServeMux()
+	handle := func(pattern string, handler http.HandlerFunc) {
+		mux.HandleFunc(pattern, api.instrument(pattern, handler))
+	}
+
+	// Dashboard UI (404 when disabled)
+	handle("/", api.handleDashboard)
+	handle("/static/", api.handleStatic)
+
+	// API endpoints
+	handle("/api/status", api.handleStatus)
+	handle("/api/queue", api.handleQueue)
+	handle("/api/queue/", api.handleQueueAction)
+	handle("/api/ws", api.handleWebSocket)
+	handle("/api/history", api.handleHistory)
+	handle("/api/history/export", api.handleHistoryExport)
+	handle("/api/kill", api.handleKill)
+	handle("/api/jails", api.handleJails)
+	handle("/api/jails/", api.handleJailByID)
+	handle("/api/bridges/heartbeat", api.handleBridgeHeartbeat)
+	handle("/api/incidents", api.handleIncidents)
+	handle("/api/incidents/", api.handleIncidentAction)
+	handle("/api/transcripts/", api.handleTranscript)
+	handle("/api/maintenance", api.handleMaintenance)
+	handle("/api/policy/validate", api.handlePolicyValidate)
+	handle("/api/policy/evaluate", api.handlePolicyEvaluate)
+	handle("/api/policy/shadow-report", api.handleShadowReport)
+	handle("/api/policy/suggestions", api.handleSuggestions)
+	handle("/api/policy/suggestions/", api.handleAdoptSuggestion)
+	handle("/api/policy/confirm-reload", api.handleConfirmReload)
+	handle("/api/policy/rules", api.handlePolicyRules)
+	handle("/api/policy/rules/", api.handlePolicyRule)
+	handle("/api/executions", api.handleExecutions)
+	handle("/api/stats/throughput", api.handleThroughput)
+	handle("/api/metrics", api.handleMetrics)
+	handle("/api/metrics/rules", api.handleRuleMetrics)
+	handle("/api/executions/", api.handleExecution)
+	handle("/api/admin/restart-api", api.handleRestartAPI)
+	handle("/api/config", api.handleConfig)
+	handle("/readyz", api.handleReadyz)
+	if faultinject.Enabled {
+		handle("/api/debug/faults", api.handleFaults)
+	}
+
+	api.handler = api.protect(mux)
+	api.server = api.newHTTPServer(addr)
+
+	return api
+}
+
+// handleStatus returns the current warden status.
+func (api *APIServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	queue := api.warden.GetHITLQueue()
+	pending := queue.List()
+
+	status := map[string]interface{}{
+		"status":        "running",
+		"pending_count": len(pending),
+		"uptime":        time.Since(time.Now()).Seconds(), // TODO: track actual uptime
+		"api_routes":    api.RouteStats(),
+	}
+	if jh := api.warden.GetJailhouse(); jh != nil {
+		status["jailhouse"] = jh.Inventory()
+	}
+	if bridges := api.warden.GetBridges(); bridges != nil {
+		status["bridges"] = bridges.List()
+	}
+	if incidents := api.warden.GetIncidents(); incidents != nil {
+		status["open_incidents"] = incidents.OpenCount()
+	}
+	if docker := api.warden.GetDocker(); docker != nil {
+		status["docker"] = docker.Health()
+	}
+	if m := api.warden.GetMaintenance().Active(); m != nil {
+		status["maintenance"] = m
+	}
+	if audit := api.warden.GetAudit(); audit != nil {
+		status["audit"] = audit.Health()
+		if integrity := audit.Integrity(); integrity != nil {
+			status["audit_integrity"] = integrity
+		}
+	}
+	if throughput := api.warden.GetThroughput(); throughput != nil {
+		stdout, stderr := throughput.Totals()
+		status["throughput"] = map[string]int64{"stdout_bytes": stdout, "stderr_bytes": stderr}
+	}
+	if resources := api.warden.GetResources(); resources != nil {
+		status["resources"] = resources.Usage()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// handleReadyz reports whether the warden is ready to serve. Problems that
+// do not stop the warden itself, like silent chat bridges or an unreachable
+// Docker daemon, are returned as warnings with a 200 status.
+func (api *APIServer) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	warnings := []string{}
+	if bridges := api.warden.GetBridges(); bridges != nil {
+		warnings = append(warnings, bridges.Warnings()...)
+	}
+	resp := map[string]interface{}{"status": "ready"}
+	if docker := api.warden.GetDocker(); docker != nil {
+		health := docker.Health()
+		resp["docker"] = health
+		if !health.Healthy {
+			warnings = append(warnings, fmt.Sprintf("docker daemon unreachable since %s, containerized requests are denied: %s",
+				health.Since.Format(time.RFC3339), health.Error))
+		}
+	}
+	if m := api.warden.GetMaintenance().Active(); m != nil {
+		resp["maintenance"] = m
+		warnings = append(warnings, m.Reason())
+	}
+	if audit := api.warden.GetAudit(); audit != nil {
+		health := audit.Health()
+		resp["audit"] = health
+		if !health.Healthy {
+			warnings = append(warnings, fmt.Sprintf("audit log unwritable since %s (failure mode %s, %d entries held, %d dropped): %s",
+				health.Since.Format(time.RFC3339), health.Mode, health.Buffered, health.Dropped, health.Error))
+		}
+	}
+	if resources := api.warden.GetResources(); resources != nil {
+		usage := resources.Usage()
+		resp["resources"] = usage
+		if usage.MemoryPressure {
+			warnings = append(warnings, fmt.Sprintf("warden under memory pressure since %s (%s in use, watermark %s): ghost executions are refused, transcripts and output capture skipped",
+				usage.PressureSince.Format(time.RFC3339), cliout.FormatBytes(usage.MemoryBytes), cliout.FormatBytes(usage.MemoryWatermark)))
+		}
+	}
+	resp["warnings"] = warnings
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleBridgeHeartbeat records that a chat bridge is alive.
+func (api *APIServer) handleBridgeHeartbeat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	bridges := api.warden.GetBridges()
+	if bridges == nil {
+		http.Error(w, "Bridge tracking not initialized", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		Name    string `json:"name"`
+		Type    string `json:"type"`
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	bridges.Heartbeat(req.Name, req.Type, req.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// handleIncidents lists incidents, newest first.
+func (api *APIServer) handleIncidents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	incidents := api.warden.GetIncidents()
+	if incidents == nil {
+		http.Error(w, "Incident tracking not initialized", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(incidents.List())
+}
+
+// handleIncidentAction handles POST /api/incidents/{id}/clear.
+func (api *APIServer) handleIncidentAction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if api.warden.GetIncidents() == nil {
+		http.Error(w, "Incident tracking not initialized", http.StatusServiceUnavailable)
+		return
+	}
+
+	id, action, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/incidents/"), "/")
+	if !ok || id == "" || action != "clear" {
+		http.Error(w, "Invalid path (expected /api/incidents/{id}/clear)", http.StatusBadRequest)
+		return
+	}
+
+	inc, err := api.warden.ClearIncident(id)
+	switch {
+	case errors.Is(err, ErrIncidentNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, ErrIncidentCleared):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(inc)
+}
+
+// handlePolicyValidate lints the policy file without reloading it.
+func (api *APIServer) handlePolicyValidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(api.warden.ValidatePolicy())
+}
+
+// handlePolicyEvaluate reports what the policy in force decides for the
+// POSTed invocation, without running it.
+func (api *APIServer) handlePolicyEvaluate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req EvaluationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Command == "" {
+		http.Error(w, "command is required", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(api.warden.EvaluatePolicy(req))
+}
+
+// ActorHeader names who is making an API request, for the audit log of
+// policy edits (e.g. "alice@build-01"). The API does not verify it; without
+// it the client's address is recorded.
+const ActorHeader = "X-Clawrden-Actor"
+
+// reviewerOf names who decides a queued request through the API without
+// a reviewer token: the ActorHeader, or the client's host. It is recorded,
+// not trusted (see Review.Authenticated).
+func reviewerOf(r *http.Request) string {
+	if actor := r.Header.Get(ActorHeader); actor != "" {
+		return actor
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// reviewErrorStatus is the HTTP status of an error from HITLQueue.Review.
+func reviewErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errNotPending):
+		return http.StatusNotFound
+	case errors.Is(err, errAlreadyDecided), errors.Is(err, errApprovedTwice):
+		return http.StatusConflict
+	case errors.Is(err, errChannelNotRouted), errors.Is(err, errUnauthenticated):
+		return http.StatusForbidden
+	case errors.Is(err, errNoReviewer):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// maxRuleBody bounds the body of a policy rule edit.
+const maxRuleBody = 1 << 20
+
+// handlePolicyRules lists the policy file's rules (GET) or appends one
+// (POST, If-Match required).
+func (api *APIServer) handlePolicyRules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		rules, err := api.warden.PolicyRules()
+		if err != nil {
+			writePolicyEditError(w, err)
+			return
+		}
+		w.Header().Set("ETag", strconv.Quote(rules.Hash))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rules)
+	case http.MethodPost:
+		api.editPolicyRule(w, r, PolicyEditAdd, 0)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handlePolicyRule replaces (PUT) or removes (DELETE) the rule at
+// /api/policy/rules/{index}, If-Match required.
+func (api *APIServer) handlePolicyRule(w http.ResponseWriter, r *http.Request) {
+	index, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/policy/rules/"))
+	if err != nil {
+		http.Error(w, "Invalid path (expected /api/policy/rules/{index})", http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		api.editPolicyRule(w, r, PolicyEditUpdate, index)
+	case http.MethodDelete:
+		api.editPolicyRule(w, r, PolicyEditDelete, index)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// editPolicyRule makes one edit to the policy file's rules and answers
+// with the PolicyEdit, whose hash the next edit must send.
+func (api *APIServer) editPolicyRule(w http.ResponseWriter, r *http.Request, op string, index int) {
+	ifMatch := strings.Trim(strings.TrimPrefix(r.Header.Get("If-Match"), "W/"), `"`)
+	if ifMatch == "" {
+		http.Error(w, "If-Match header with the policy hash is required (see GET /api/policy/rules)", http.StatusPreconditionRequired)
+		return
+	}
+
+	var rule *Rule
+	if op != PolicyEditDelete {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxRuleBody))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		if rule, err = ParseRule(body); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid rule: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	actor := r.Header.Get(ActorHeader)
+	if actor == "" {
+		actor = r.RemoteAddr
+	}
+	edit, err := api.warden.EditPolicyRule(ifMatch, actor, op, index, rule)
+	if err != nil && edit == nil {
+		writePolicyEditError(w, err)
+		return
+	}
+	if err != nil {
+		api.logger.Printf("warning: %v", err)
+	}
+
+	status := http.StatusOK
+	var held *PolicyReloadHeldError
+	switch {
+	case errors.As(err, &held):
+		status = http.StatusAccepted // Written, but not in force until confirmed
+	case op == PolicyEditAdd:
+		status = http.StatusCreated
+	}
+	w.Header().Set("ETag", strconv.Quote(edit.Hash))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(edit)
+}
+
+// handleConfirmReload shows the policy reload the canary holds (GET), or
+// puts it in force (POST, optionally {"policy_hash": "..."} to confirm only
+// that policy).
+func (api *APIServer) handleConfirmReload(w http.ResponseWriter, r *http.Request) {
+	var held *HeldReload
+	switch r.Method {
+	case http.MethodGet:
+		if held = api.warden.HeldPolicyReload(); held == nil {
+			http.Error(w, ErrNoHeldReload.Error(), http.StatusNotFound)
+			return
+		}
+	case http.MethodPost:
+		var body struct {
+			PolicyHash string `json:"policy_hash"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		actor := r.Header.Get(ActorHeader)
+		if actor == "" {
+			actor = r.RemoteAddr
+		}
+		var err error
+		if held, err = api.warden.ConfirmPolicyReload(body.PolicyHash, actor); err != nil {
+			switch {
+			case errors.Is(err, ErrNoHeldReload):
+				http.Error(w, err.Error(), http.StatusNotFound)
+			case errors.Is(err, ErrPolicyChanged):
+				http.Error(w, err.Error(), http.StatusConflict)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(held)
+}
+
+// writePolicyEditError answers a failed policy read or edit.
+func writePolicyEditError(w http.ResponseWriter, err error) {
+	var rejected *PolicyEditRejectedError
+	switch {
+	case errors.Is(err, ErrPolicyChanged):
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+	case errors.Is(err, ErrRuleNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrNoPolicyFile), errors.Is(err, ErrPolicyNotRules):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.As(err, &rejected):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleShadowReport summarizes where the shadow policy would have decided
+// differently from the policy in force.
+func (api *APIServer) handleShadowReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	shadow := api.warden.GetShadowPolicy()
+	if shadow == nil {
+		http.Error(w, "No shadow policy configured (start the warden with -shadow-policy)", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shadow.Report())
+}
+
+// handleSuggestions lists the commands denied because no rule matched
+// them, most denied first (GET, ?top=N, default 20), or clears the list
+// (DELETE). Commands a rule now covers are left out.
+func (api *APIServer) handleSuggestions(w http.ResponseWriter, r *http.Request) {
+	suggestions := api.warden.GetSuggestions()
+	if suggestions == nil {
+		http.Error(w, "Policy suggestions not initialized", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		top := defaultTopSuggestions
+		if v := r.URL.Query().Get("top"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				http.Error(w, fmt.Sprintf("Invalid top %q (expected a positive number)", v), http.StatusBadRequest)
+				return
+			}
+			top = n
+		}
+		policy := api.warden.currentPolicy().engine
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(suggestions.Report(top, policy.HasRule))
+	case http.MethodDelete:
+		suggestions.Reset()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAdoptSuggestion drafts a rule for a suggested command
+// (POST /api/policy/suggestions/{command}, {"action":"allow"|"ask"}). The
+// draft is returned, not applied; POST it to /api/policy/rules to add it.
+func (api *APIServer) handleAdoptSuggestion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	suggestions := api.warden.GetSuggestions()
+	if suggestions == nil {
+		http.Error(w, "Policy suggestions not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	command := strings.TrimPrefix(r.URL.Path, "/api/policy/suggestions/")
+	if command == "" {
+		http.Error(w, "Command required", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		Action Action `json:"action"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	adopted, err := suggestions.Adopt(command, body.Action)
+	switch {
+	case errors.Is(err, ErrNoSuggestion):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(adopted)
+}
+
+// handleThroughput reports the output bytes forwarded to shims and the
+// commands and containers that forwarded the most: since the warden started,
+// over ?window=15m, or since the last ?reset=true read, which starts the
+// next count. ?top=N sets how many talkers are listed (default 10).
+func (api *APIServer) handleThroughput(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	stats := api.warden.GetThroughput()
+	if stats == nil {
+		http.Error(w, "Throughput stats not initialized", http.StatusServiceUnavailable)
+		return
+	}
+
+	q := r.URL.Query()
+	top := defaultTopTalkers
+	if v := q.Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, fmt.Sprintf("Invalid top %q (expected a positive number)", v), http.StatusBadRequest)
+			return
+		}
+		top = n
+	}
+	reset := q.Get("reset") == "true"
+	var window time.Duration
+	if v := q.Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, fmt.Sprintf("Invalid window %q (expected e.g. 15m)", v), http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+	if reset && window > 0 {
+		http.Error(w, "window and reset cannot be combined", http.StatusBadRequest)
+		return
+	}
+
+	var report ThroughputReport
+	switch {
+	case reset:
+		report = stats.ReportAndReset(top)
+	case window > 0:
+		report = stats.ReportWindow(window, top)
+	default:
+		report = stats.Report(top)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// handleMetrics serves the per-rule decision counters for Prometheus to
+// scrape.
+func (api *APIServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	stats := api.warden.GetRuleStats()
+	if stats == nil {
+		http.Error(w, "Rule stats not initialized", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	stats.WritePrometheus(w)
+}
+
+// handleRuleMetrics lists the rules counted in /api/metrics with their
+// actions and reasons, which metric labels cannot hold, for alert
+// annotations.
+func (api *APIServer) handleRuleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	stats := api.warden.GetRuleStats()
+	if stats == nil {
+		http.Error(w, "Rule stats not initialized", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats.Annotations())
+}
+
+// handleExecutions lists running and recently finished executions.
+func (api *APIServer) handleExecutions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	outputs := api.warden.GetOutputs()
+	if outputs == nil {
+		http.Error(w, "Output tracking not initialized", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(outputs.List())
 }
 
-// NewAPIServer creates a new HTTP API server.
-func NewAPIServer(warden *Server, addr string, logger *log.Logger) *APIServer {
-	api := &APIServer{
-		warden: warden,
-		logger: logger,
+// handleExecution serves GET /api/executions/{id}, an execution's details,
+// and GET /api/executions/{id}/output.
+func (api *APIServer) handleExecution(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	outputs := api.warden.GetOutputs()
+	if outputs == nil {
+		http.Error(w, "Output tracking not initialized", http.StatusServiceUnavailable)
+		return
 	}
 
-	mux := http.NewServeMux()
-
-	// Dashboard UI
-	mux.HandleFunc("/", api.handleDashboard)
+	id, rest, hasRest := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/executions/"), "/")
+	if id == "" || hasRest && rest != "output" {
+		http.Error(w, "Invalid path (expected /api/executions/{id} or /api/executions/{id}/output)", http.StatusBadRequest)
+		return
+	}
+	out, err := outputs.get(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if !hasRest {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out.Info())
+		return
+	}
+	api.handleExecutionOutput(w, r, out)
+}
 
-	// API endpoints
-	mux.HandleFunc("/api/status", api.handleStatus)
-	mux.HandleFunc("/api/queue", api.handleQueue)
-	mux.HandleFunc("/api/queue/", api.handleQueueAction)
-	mux.HandleFunc("/api/history", api.handleHistory)
-	mux.HandleFunc("/api/kill", api.handleKill)
-	mux.HandleFunc("/api/jails", api.handleJails)
-	mux.HandleFunc("/api/jails/", api.handleJailByID)
+// handleExecutionOutput streams an execution's output as NDJSON output
+// chunks: the buffered history, then with ?follow=true the live output
+// until the execution finishes or the client goes away.
+func (api *APIServer) handleExecutionOutput(w http.ResponseWriter, r *http.Request, out *executionOutput) {
+	history, live, detach := out.attach(r.URL.Query().Get("follow") == "true")
+	defer detach()
 
-	api.server = &http.Server{
-		Addr:         addr,
-		Handler:      mux,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+	// A followed command may run far longer than the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	for _, chunk := range history {
+		if err := enc.Encode(chunk); err != nil {
+			return
+		}
+	}
+	if flusher != nil {
+		flusher.Flush()
 	}
 
-	return api
-}
-
-// ListenAndServe starts the HTTP API server.
-func (api *APIServer) ListenAndServe() error {
-	api.logger.Printf("HTTP API listening on %s", api.server.Addr)
-	return api.server.ListenAndServe()
+	for live != nil {
+		select {
+		case <-r.Context().Done():
+			return
+		case chunk, ok := <-live:
+			if !ok {
+				return
+			}
+			if err := enc.Encode(chunk); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
 }
 
-// Shutdown gracefully shuts down the API server.
-func (api *APIServer) Shutdown() error {
-	return api.server.Close()
-}
+// handleMaintenance handles /api/maintenance: GET shows the active window,
+// POST starts one and DELETE ends it early.
+func (api *APIServer) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	if api.warden.GetMaintenance() == nil {
+		http.Error(w, "Maintenance windows not initialized", http.StatusServiceUnavailable)
+		return
+	}
 
-// handleDashboard serves the web dashboard UI.
-func (api *APIServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
-	if r.URL.Path != "/" {
-		http.NotFound(w, r)
+	var (
+		m   *Maintenance
+		err error
+	)
+	status := http.StatusOK
+	switch r.Method {
+	case http.MethodGet:
+		if m = api.warden.GetMaintenance().Active(); m == nil {
+			err = ErrNoMaintenance
+		}
+	case http.MethodPost:
+		var req struct {
+			Message  string `json:"message"`
+			Duration string `json:"duration"` // Go duration, e.g. "10m"
+			Queue    bool   `json:"queue"`    // Keep queueing ask requests instead of denying them
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			http.Error(w, fmt.Sprintf("Invalid duration %q (expected e.g. 10m)", req.Duration), http.StatusBadRequest)
+			return
+		}
+		m, err = api.warden.StartMaintenance(req.Message, d, req.Queue)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		status = http.StatusCreated
+	case http.MethodDelete:
+		m, err = api.warden.EndMaintenance()
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if errors.Is(err, ErrNoMaintenance) {
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.Write([]byte(dashboardHTML))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(m)
 }
 
-// handleStatus returns the current warden status.
-func (api *APIServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+// handleTranscript handles GET /api/transcripts/{request-id}.
+func (api *APIServer) handleTranscript(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	queue := api.warden.GetHITLQueue()
-	pending := queue.List()
-
-	status := map[string]interface{}{
-		"status":        "running",
-		"pending_count": len(pending),
-		"uptime":        time.Since(time.Now()).Seconds(), // TODO: track actual uptime
+	records, err := api.warden.ReadTranscript(strings.TrimPrefix(r.URL.Path, "/api/transcripts/"))
+	switch {
+	case errors.Is(err, ErrTranscriptNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(status)
+	json.NewEncoder(w).Encode(records)
 }
 
-// handleQueue lists all pending HITL requests.
-func (api *APIServer) handleQueue(w http.ResponseWriter, r *http.Request) {
+// handleJailBundle serves a tarball that bakes a jail's shim and symlinks
+// into a container image (see jailhouse.WriteBundle).
+func (api *APIServer) handleJailBundle(w http.ResponseWriter, r *http.Request, jh *jailhouse.Manager, jailID string) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if _, err := jh.GetJail(jailID); err != nil {
+		http.Error(w, fmt.Sprintf("Jail not found: %v", err), http.StatusNotFound)
+		return
+	}
 
-	queue := api.warden.GetHITLQueue()
-	pending := queue.List()
+	// Build in memory so a missing shim is still reported as an error status
+	var buf bytes.Buffer
+	if err := jh.WriteBundle(jailID, &buf); err != nil {
+		api.logger.Printf("build bundle for jail %s: %v", jailID, err)
+		http.Error(w, fmt.Sprintf("Failed to build bundle: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", jailhouse.BundleDir(jailID)+".tar.gz"))
+	w.Write(buf.Bytes())
+}
+
+// QueueEntry is a pending HITL request as the queue API shows it.
+type QueueEntry struct {
+	ID          string               `json:"id"`
+	Command     string               `json:"command"`
+	Args        []string             `json:"args"`
+	Cwd         string               `json:"cwd"`
+	Identity    protocol.Identity    `json:"identity"`
+	Groups      []string             `json:"groups,omitempty"`
+	Timestamp   time.Time            `json:"timestamp"`
+	Env         *EnvReport           `json:"env,omitempty"`
+	Subcommands []SubcommandDecision `json:"subcommands,omitempty"`
+	TaskID      string               `json:"task_id,omitempty"`
+	RunID       string               `json:"run_id,omitempty"`
+	Session     *SessionInfo         `json:"session,omitempty"`
+	Risk        RiskTier             `json:"risk,omitempty"`
+	AutoApprove *time.Time           `json:"auto_approve_at,omitempty"`         // When a low-risk ask is approved unless denied first
+	Countdown   *int                 `json:"auto_approve_in_seconds,omitempty"` // Seconds until then
+	Annotations []Annotation         `json:"annotations,omitempty"`             // Impact context, like how much rm would delete
+	FirstViewed *time.Time           `json:"first_viewed_at,omitempty"`         // When a reviewer first saw it
+	Approvers   int                  `json:"approvers,omitempty"`               // Different reviewers who must approve, when more than one
+	Approvals   []Approval           `json:"approvals,omitempty"`               // Approvals so far
+	Channels    []string             `json:"channels,omitempty"`                // Where it is posted and may be approved; empty means everywhere
+
+	// Reminder generation due (one more every hitl.renotify_after), how
+	// often bridges posted the request, and the generation each last posted
+	NotifyGeneration    int            `json:"notify_generation"`
+	NotifiedCount       int            `json:"notified_count"`
+	LastNotified        *time.Time     `json:"last_notified_at,omitempty"`
+	NotifiedGenerations map[string]int `json:"notified_generations,omitempty"`
+}
+
+// newQueueEntry converts a pending request for the queue API.
+func newQueueEntry(p PendingRequest) QueueEntry {
+	e := QueueEntry{
+		ID:          p.ID,
+		Command:     p.Request.Command,
+		Args:        p.Request.Args,
+		Cwd:         p.Request.Cwd,
+		Identity:    p.Request.Identity,
+		Groups:      GroupNames(p.Request.Identity),
+		Timestamp:   p.Timestamp,
+		Env:         p.Env,
+		Subcommands: p.Subcommands,
+		TaskID:      p.TaskID,
+		RunID:       p.RunID,
+		Session:     reportedSession(p.Request.Session),
+		Risk:        p.Risk,
+		Annotations: p.Annotations,
+		FirstViewed: p.FirstViewedAt,
+		Approvers:   p.Approvers,
+		Approvals:   p.Approvals,
+		Channels:    p.Channels,
+
+		NotifyGeneration:    p.NotifyGeneration,
+		NotifiedCount:       p.NotifiedCount,
+		LastNotified:        p.LastNotifiedAt,
+		NotifiedGenerations: p.NotifiedGenerations,
+	}
+	if p.AutoApproveAt != nil {
+		in := max(0, int(time.Until(*p.AutoApproveAt).Seconds()))
+		e.AutoApprove = p.AutoApproveAt
+		e.Countdown = &in
+	}
+	return e
+}
 
-	// Convert to JSON-friendly format
-	type QueueEntry struct {
-		ID       string            `json:"id"`
-		Command  string            `json:"command"`
-		Args     []string          `json:"args"`
-		Cwd      string            `json:"cwd"`
-		Identity protocol.Identity `json:"identity"`
+// handleQueue lists all pending HITL requests.
+func (api *APIServer) handleQueue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
 
+	pending := api.warden.GetHITLQueue().List()
 	entries := make([]QueueEntry, len(pending))
 	for i, p := range pending {
-		entries[i] = QueueEntry{
-			ID:       p.ID,
-			Command:  p.Request.Command,
-			Args:     p.Request.Args,
-			Cwd:      p.Request.Cwd,
-			Identity: p.Request.Identity,
-		}
+		entries[i] = newQueueEntry(p)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(entries)
 }
 
-// handleQueueAction approves or denies a pending request.
-func (api *APIServer) handleQueueAction(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+// handleQueueEntry returns one pending HITL request. Fetching it counts as
+// viewing it.
+func (api *APIServer) handleQueueEntry(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	queue := api.warden.GetHITLQueue()
+	queue.MarkViewed(id)
+	p, ok := queue.Get(id)
+	if !ok {
+		http.Error(w, fmt.Sprintf("No pending request %s", id), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newQueueEntry(p))
+}
+
+// handleQueueAction approves or denies a pending request. GET requests
+// carry a signed one-time token instead (see handleApprovalLink), and
+// POST /api/queue/{id}/links mints such tokens. GET /api/queue/{id}
+// returns the request, POST /api/queue/{id}/viewed records that a reviewer
+// saw it, and POST /api/queue/{id}/notified that a bridge posted it.
+func (api *APIServer) handleQueueAction(w http.ResponseWriter, r *http.Request) {
 	// Parse URL: /api/queue/{id}/approve or /api/queue/{id}/deny
 	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/queue/"), "/")
+	if len(parts) == 1 && parts[0] != "" {
+		api.handleQueueEntry(w, r, parts[0])
+		return
+	}
 	if len(parts) != 2 {
 		http.Error(w, "Invalid request path", http.StatusBadRequest)
 		return
@@ -148,33 +1007,173 @@ func (api *APIServer) handleQueueAction(w http.ResponseWriter, r *http.Request)
 	id := parts[0]
 	action := parts[1]
 
+	if r.Method == http.MethodGet && (action == "approve" || action == "deny") {
+		api.handleApprovalLink(w, r, id, action)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
 	queue := api.warden.GetHITLQueue()
 
 	switch action {
-	case "approve":
-		queue.Resolve(id, DecisionApprove)
+	case "approve", "deny":
+		// The body is optional: {"execution_overrides": {"strategy": "ghost", ...},
+		// "message_to_requester": "run the tests afterwards"}
+		var body struct {
+			Overrides *ExecutionOverrides `json:"execution_overrides"`
+			Message   string              `json:"message_to_requester"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		message, err := CleanReviewerMessage(body.Message)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		cred, authenticated, err := api.reviewerCredential(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		reviewer, channel := reviewerOf(r), ChannelAPI
+		switch {
+		case authenticated:
+			reviewer, channel = cred.Name, cred.Channel
+		case r.Header.Get(CSRFHeader) == "dashboard":
+			channel = ChannelDashboard // Its fallback while the live channel is down
+		}
+		if action == "deny" {
+			_, err := queue.Review(id, Review{Decision: DecisionDeny, Message: message, Reviewer: reviewer, Channel: channel, Authenticated: authenticated})
+			if err != nil {
+				http.Error(w, err.Error(), reviewErrorStatus(err))
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]string{"status": "denied"})
+			return
+		}
+		if body.Overrides != nil && *body.Overrides == (ExecutionOverrides{}) {
+			body.Overrides = nil
+		}
+		if body.Overrides != nil {
+			if err := api.warden.currentPolicy().engine.ValidateOverrides(*body.Overrides); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid execution overrides: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+		remaining, err := queue.Review(id, Review{
+			Decision: DecisionApprove, Overrides: body.Overrides, Message: message,
+			Reviewer: reviewer, Channel: channel, Authenticated: authenticated,
+		})
+		switch {
+		case err != nil:
+			http.Error(w, err.Error(), reviewErrorStatus(err))
+			return
+		case remaining > 0:
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]any{"status": "approval recorded", "approvals_remaining": remaining})
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(map[string]string{"status": "approved"})
 
-	case "deny":
-		queue.Resolve(id, DecisionDeny)
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{"status": "denied"})
+	case "links":
+		api.mintApprovalLinks(w, r, id)
+
+	case "viewed":
+		at, ok := queue.MarkViewed(id)
+		if !ok {
+			http.Error(w, fmt.Sprintf("No pending request %s", id), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]time.Time{"first_viewed_at": at})
+
+	case "notified":
+		api.handleQueueNotified(w, r, id)
 
 	default:
 		http.Error(w, "Invalid action", http.StatusBadRequest)
 	}
 }
 
-// handleHistory returns the command audit log.
+// handleQueueNotified records a bridge's acknowledgement that it posted a
+// pending request, or a reminder of it, to its chat. The body names the
+// bridge and the reminder generation it posted:
+// {"bridge": "slack-bridge", "generation": 2}.
+func (api *APIServer) handleQueueNotified(w http.ResponseWriter, r *http.Request, id string) {
+	var body struct {
+		Bridge     string `json:"bridge"`
+		Generation int    `json:"generation"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if body.Bridge == "" {
+		http.Error(w, "bridge is required", http.StatusBadRequest)
+		return
+	}
+	p, err := api.warden.GetHITLQueue().MarkNotified(id, body.Bridge, body.Generation)
+	if errors.Is(err, errNotPending) {
+		http.Error(w, fmt.Sprintf("No pending request %s", id), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newQueueEntry(p))
+}
+
+// handleHistory returns the command audit log. With ?collapse=true, runs of
+// identical entries are merged into HistoryGroup rows.
 func (api *APIServer) handleHistory(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	filter, err := ParseHistoryFilter(r.URL.Query(), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	collapse := false
+	if v := r.URL.Query().Get("collapse"); v != "" {
+		if collapse, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, fmt.Sprintf("invalid collapse %q: want true or false", v), http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Read audit log from the configured path
-	entries, err := ReadAuditLog(api.warden.config.AuditPath)
+	var entries []AuditEntry
+	var groups []HistoryGroup
+	collapser := &historyCollapser{emit: func(g HistoryGroup) error {
+		groups = append(groups, g)
+		return nil
+	}}
+	err = api.warden.ScanAudit(func(entry AuditEntry) error {
+		switch {
+		case !filter.Match(&entry):
+		case collapse:
+			return collapser.Add(&entry)
+		default:
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err == nil {
+		err = collapser.Flush()
+	}
 	if err != nil {
 		api.logger.Printf("read audit log error: %v", err)
 		http.Error(w, fmt.Sprintf("Failed to read audit log: %v", err), http.StatusInternalServerError)
@@ -182,9 +1181,86 @@ func (api *APIServer) handleHistory(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	if collapse {
+		json.NewEncoder(w).Encode(groups)
+		return
+	}
 	json.NewEncoder(w).Encode(entries)
 }
 
+// exportWriteTimeout bounds each write of a history export, replacing the
+// server's overall write timeout, which a large export would exceed.
+const exportWriteTimeout = 30 * time.Second
+
+// handleHistoryExport streams the audit entries matching the /api/history
+// filters as a CSV or JSONL download, one entry at a time.
+func (api *APIServer) handleHistoryExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	now := time.Now()
+	filter, err := ParseHistoryFilter(r.URL.Query(), now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	contentType, ok := map[string]string{"csv": "text/csv; charset=utf-8", "jsonl": "application/x-ndjson"}[format]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown format %q (want csv or jsonl)", format), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="clawrden-history-%s.%s"`, now.Format("20060102"), format))
+
+	out := &deadlineWriter{w: w, rc: http.NewResponseController(w), timeout: exportWriteTimeout}
+	rows := 0
+	exporter, err := newHistoryExporter(format, out)
+	if err == nil {
+		err = api.warden.ScanAudit(func(entry AuditEntry) error {
+			if !filter.Match(&entry) {
+				return nil
+			}
+			rows++
+			return exporter.Write(&entry)
+		})
+	}
+	if err == nil {
+		err = exporter.Flush()
+	}
+	if err != nil {
+		// The status line is usually gone; the client sees a short download
+		api.logger.Printf("warning: history export failed after %d entries: %v", rows, err)
+		if out.n == 0 {
+			w.Header().Del("Content-Disposition")
+			http.Error(w, fmt.Sprintf("Failed to export audit log: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+	api.logger.Printf("exported %d audit entries as %s", rows, format)
+}
+
+// deadlineWriter extends the connection's write deadline before each write
+// and counts the bytes written.
+type deadlineWriter struct {
+	w       io.Writer
+	rc      *http.ResponseController
+	timeout time.Duration
+	n       int64
+}
+
+func (d *deadlineWriter) Write(p []byte) (int, error) {
+	d.rc.SetWriteDeadline(time.Now().Add(d.timeout)) // Unsupported by test recorders; ignored
+	n, err := d.w.Write(p)
+	d.n += int64(n)
+	return n, err
+}
+
 // handleKill pauses or kills the prisoner container.
 func (api *APIServer) handleKill(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -224,56 +1300,160 @@ func (api *APIServer) listJails(w http.ResponseWriter, r *http.Request) {
 	}
 
 	jails := jailhouse.ListJails()
+	views := make([]jailView, 0, len(jails))
+	for _, jail := range jails {
+		views = append(views, api.viewJail(jailhouse, jail))
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(jails)
+	json.NewEncoder(w).Encode(views)
+}
+
+// jailView is a jail's persisted state plus its on-disk stats.
+type jailView struct {
+	*jailhouse.JailState
+	Stats *jailhouse.JailStats `json:"stats,omitempty"`
+}
+
+// viewJail attaches stats to a jail. A jail whose directory cannot be
+// scanned is still listed, without stats.
+func (api *APIServer) viewJail(jh *jailhouse.Manager, jail *jailhouse.JailState) jailView {
+	view := jailView{JailState: jail}
+	stats, err := jh.JailStats(jail.JailID)
+	if err != nil {
+		api.logger.Printf("warning: stats for jail %s: %v", jail.JailID, err)
+		return view
+	}
+	view.Stats = &stats
+	return view
 }
 
 // createJail creates a new jail.
 func (api *APIServer) createJail(w http.ResponseWriter, r *http.Request) {
-	jailhouse := api.warden.GetJailhouse()
-	if jailhouse == nil {
+	var req struct {
+		JailID   string          `json:"jail_id"`
+		Commands []string        `json:"commands"`
+		Hardened bool            `json:"hardened"`
+		Rules    json.RawMessage `json:"rules"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	_, err := api.warden.CreateJail(req.JailID, req.Commands, req.Hardened, req.Rules, "api")
+	var reqErr *JailRequestError
+	switch {
+	case errors.Is(err, ErrNoJailhouse):
 		http.Error(w, "Jailhouse not initialized", http.StatusServiceUnavailable)
 		return
+	case errors.As(err, &reqErr):
+		http.Error(w, reqErr.Reason, http.StatusBadRequest)
+		return
+	case errors.Is(err, ErrJailRules):
+		http.Error(w, fmt.Sprintf("Failed to %v", err), http.StatusInternalServerError)
+		return
+	case err != nil:
+		http.Error(w, fmt.Sprintf("Failed to create jail: %v", err), http.StatusConflict)
+		return
 	}
 
-	var req struct {
-		JailID   string   `json:"jail_id"`
-		Commands []string `json:"commands"`
-		Hardened bool     `json:"hardened"`
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"status": "created", "jail_id": req.JailID})
+}
+
+// handleJailUsage returns how often each of a jail's commands was used.
+func (api *APIServer) handleJailUsage(w http.ResponseWriter, r *http.Request, jh *jailhouse.Manager, jailID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+	usage, err := jh.Usage(jailID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Jail not found: %v", err), http.StatusNotFound)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
+}
 
-	if req.JailID == "" {
-		http.Error(w, "jail_id is required", http.StatusBadRequest)
+// handleJailPrune lists the commands of a jail never used in the last
+// older_than (default 30d) and, with "apply": true, removes them.
+func (api *APIServer) handleJailPrune(w http.ResponseWriter, r *http.Request, jh *jailhouse.Manager, jailID string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, err := jh.GetJail(jailID); err != nil {
+		http.Error(w, fmt.Sprintf("Jail not found: %v", err), http.StatusNotFound)
 		return
 	}
-	if len(req.Commands) == 0 {
-		http.Error(w, "commands is required", http.StatusBadRequest)
+	req := struct {
+		OlderThan string `json:"older_than"`
+		Apply     bool   `json:"apply"`
+	}{OlderThan: "30d"}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	olderThan, err := parseAge(req.OlderThan)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid older_than: %v", err), http.StatusBadRequest)
 		return
 	}
 
-	if err := jailhouse.CreateJail(req.JailID, req.Commands, req.Hardened); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to create jail: %v", err), http.StatusConflict)
+	result, err := api.warden.PruneUnusedCommands(jailID, olderThan, req.Apply, "api")
+	var reqErr *JailRequestError
+	switch {
+	case errors.As(err, &reqErr):
+		http.Error(w, reqErr.Reason, http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, fmt.Sprintf("Failed to prune jail: %v", err), http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
 
-	api.logger.Printf("created jail %s via API: %v", req.JailID, req.Commands)
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"status": "created", "jail_id": req.JailID})
+// writeJailChangeError answers a jail update or deletion that changed some
+// symlinks but not all, with what it did change.
+func writeJailChangeError(w http.ResponseWriter, err error, change *jailhouse.JailChange) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(map[string]any{"error": err.Error(), "change": change})
 }
 
-// handleJailByID handles GET and DELETE for a specific jail.
+// handleJailByID handles GET, PUT and DELETE for a specific jail. PUT and
+// DELETE take ?dry_run=true to only report the symlinks they would add and
+// remove.
 func (api *APIServer) handleJailByID(w http.ResponseWriter, r *http.Request) {
-	jailhouse := api.warden.GetJailhouse()
-	if jailhouse == nil {
+	jh := api.warden.GetJailhouse()
+	if jh == nil {
 		http.Error(w, "Jailhouse not initialized", http.StatusServiceUnavailable)
 		return
 	}
 
 	jailID := strings.TrimPrefix(r.URL.Path, "/api/jails/")
+	dryRun := false
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, fmt.Sprintf("invalid dry_run %q: want true or false", v), http.StatusBadRequest)
+			return
+		}
+	}
+	if id, ok := strings.CutSuffix(jailID, "/bundle"); ok {
+		api.handleJailBundle(w, r, jh, id)
+		return
+	}
+	if id, ok := strings.CutSuffix(jailID, "/usage"); ok {
+		api.handleJailUsage(w, r, jh, id)
+		return
+	}
+	if id, ok := strings.CutSuffix(jailID, "/prune-unused"); ok {
+		api.handleJailPrune(w, r, jh, id)
+		return
+	}
 	if jailID == "" {
 		http.Error(w, "jail ID is required", http.StatusBadRequest)
 		return
@@ -281,22 +1461,61 @@ func (api *APIServer) handleJailByID(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case http.MethodGet:
-		jail, err := jailhouse.GetJail(jailID)
+		jail, err := jh.GetJail(jailID)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Jail not found: %v", err), http.StatusNotFound)
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(jail)
+		json.NewEncoder(w).Encode(api.viewJail(jh, jail))
+
+	case http.MethodPut:
+		var req struct {
+			Commands []string        `json:"commands"`
+			Rules    json.RawMessage `json:"rules"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		jail, change, err := api.warden.UpdateJail(jailID, req.Commands, req.Rules, dryRun, "api")
+		var reqErr *JailRequestError
+		switch {
+		case errors.Is(err, ErrJailNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.As(err, &reqErr):
+			http.Error(w, reqErr.Reason, http.StatusBadRequest)
+			return
+		case errors.Is(err, jailhouse.ErrPartialChange):
+			writeJailChangeError(w, err, change)
+			return
+		case err != nil:
+			http.Error(w, fmt.Sprintf("Failed to update jail: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			jailView
+			Change *jailhouse.JailChange `json:"change"`
+		}{api.viewJail(jh, jail), change})
 
 	case http.MethodDelete:
-		if err := jailhouse.DestroyJail(jailID); err != nil {
+		change, err := api.warden.DestroyJail(jailID, dryRun, "api")
+		switch {
+		case errors.Is(err, jailhouse.ErrPartialChange):
+			writeJailChangeError(w, err, change)
+			return
+		case err != nil:
 			http.Error(w, fmt.Sprintf("Failed to delete jail: %v", err), http.StatusNotFound)
 			return
 		}
-		api.logger.Printf("deleted jail %s via API", jailID)
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{"status": "deleted", "jail_id": jailID})
+		status := "deleted"
+		if dryRun {
+			status = "dry-run"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"status": status, "jail_id": jailID, "change": change})
 
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -0,0 +1,419 @@
+package warden
+
+import (
+	"bytes"
+	"clawrden/internal/jailhouse"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ConfigReport is the warden's effective configuration as GET /api/config
+// returns it for support requests: every Config setting, where it came
+// from, and the state of the features the settings turn on.
+//
+// Secrets never appear in it. Tokens and keys only say whether they are
+// set, webhook URLs keep only their scheme and host, and other URLs lose
+// their credentials. Fields of nested settings whose names mention a token,
+// secret or password are redacted as well, and as a last resort the
+// encoded report is scrubbed of every secret the warden holds.
+type ConfigReport struct {
+	Settings map[string]ConfigSetting `json:"settings"` // By Config field, in snake_case
+	Features ConfigFeatures           `json:"features"`
+}
+
+// ConfigSetting is the effective value of one Config field.
+type ConfigSetting struct {
+	Value  any    `json:"value"`
+	Flag   string `json:"flag,omitempty"`   // The warden flag that sets it
+	Source string `json:"source,omitempty"` // "flag" or "default"; empty when unknown
+}
+
+// ConfigFeatures are the states the settings result in.
+type ConfigFeatures struct {
+	Docker        DockerFeature         `json:"docker"`
+	Jailhouse     JailhouseFeature      `json:"jailhouse"`
+	Audit         AuditFeature          `json:"audit"`
+	API           APIAuthFeature        `json:"api"`
+	Notifications []NotificationChannel `json:"notifications"`
+	Executors     ExecutorLimits        `json:"executors"`
+}
+
+// DockerFeature says whether containerized requests can run.
+type DockerFeature struct {
+	Available bool          `json:"available"`        // The warden found a Docker client at startup
+	Health    *DockerHealth `json:"health,omitempty"` // Whether the daemon answers now
+}
+
+// JailhouseFeature locates the jailhouse.
+type JailhouseFeature struct {
+	Armory       string               `json:"armory"`
+	Root         string               `json:"root"`
+	State        string               `json:"state"`
+	EmbeddedShim bool                 `json:"embedded_shim"` // The warden can install its own shim into the armory
+	AutoJail     bool                 `json:"auto_jail"`     // Jails follow container labels
+	Inventory    *jailhouse.Inventory `json:"inventory,omitempty"`
+}
+
+// AuditFeature describes where audit entries go. The warden appends to a
+// single file; rotating it is left to the operator.
+type AuditFeature struct {
+	Backend     string           `json:"backend"` // "file"
+	Path        string           `json:"path"`
+	FailureMode AuditFailureMode `json:"failure_mode"`
+	BufferSize  int              `json:"buffer_size"`
+	Rotation    string           `json:"rotation"` // "none"
+	Health      *AuditHealth     `json:"health,omitempty"`
+}
+
+// APIAuthFeature says how API callers are authenticated.
+type APIAuthFeature struct {
+	Addr          string `json:"addr"`
+	TLS           bool   `json:"tls"`
+	Dashboard     bool   `json:"dashboard"`
+	Admin         string `json:"admin"`          // "token" or "disabled"
+	GRPC          string `json:"grpc"`           // "token", "open" or "disabled"
+	ApprovalLinks bool   `json:"approval_links"` // One-time approve/deny links are signed
+	CORSOrigins   int    `json:"cors_origins"`   // Origins allowed to call the API cross-origin
+}
+
+// NotificationChannel is somewhere the warden sends alerts or review
+// requests: a webhook, by host, or a chat bridge, by name.
+type NotificationChannel struct {
+	Kind   string `json:"kind"`   // "incident_webhook", "bridge_alert_webhook" or "bridge"
+	Target string `json:"target"` // The webhook's scheme and host, or the bridge's type and name
+	Stale  bool   `json:"stale,omitempty"`
+}
+
+// ExecutorLimits are the limits on how commands run.
+type ExecutorLimits struct {
+	MaxGhosts             int    `json:"max_ghosts"`       // 0 = no cap
+	MaxConnections        int    `json:"max_connections"`  // 0 = no cap
+	MemoryWatermark       int64  `json:"memory_watermark"` // Bytes; 0 = off
+	MemoryLimit           int64  `json:"memory_limit"`     // Bytes; 0 = the runtime default
+	StallTimeout          string `json:"stall_timeout"`
+	AllowHostFallback     bool   `json:"allow_host_fallback"`
+	RequireShimProvenance bool   `json:"require_shim_provenance"`
+	SandboxRoot           string `json:"sandbox_root"`
+}
+
+// redactedValue stands in for a secret that is set.
+const redactedValue = "[redacted]"
+
+// ConfigReport describes the warden's effective configuration.
+func (s *Server) ConfigReport() ConfigReport {
+	cfg := s.config
+	report := ConfigReport{
+		Settings: configSettings(cfg),
+		Features: ConfigFeatures{
+			Docker: DockerFeature{Available: s.dockerExec != nil},
+			Jailhouse: JailhouseFeature{
+				Armory:       cfg.JailhouseArmory,
+				Root:         cfg.JailhouseRoot,
+				State:        cfg.JailhouseState,
+				EmbeddedShim: len(cfg.EmbeddedShim) > 0,
+				AutoJail:     cfg.AutoJailFromLabels,
+			},
+			Audit: AuditFeature{
+				Backend:     "file",
+				Path:        cfg.AuditPath,
+				FailureMode: cfg.AuditFailureMode,
+				BufferSize:  cfg.AuditBufferSize,
+				Rotation:    "none",
+			},
+			API: APIAuthFeature{
+				Addr:          cfg.APIAddr,
+				TLS:           cfg.APITLSCert != "",
+				Dashboard:     !cfg.DisableDashboard,
+				Admin:         "disabled",
+				GRPC:          "disabled",
+				ApprovalLinks: len(cfg.ApprovalLinkKey) > 0,
+				CORSOrigins:   len(cfg.AllowedOrigins),
+			},
+			Notifications: []NotificationChannel{},
+			Executors: ExecutorLimits{
+				MaxGhosts:             cfg.MaxGhosts,
+				MaxConnections:        cfg.MaxConnections,
+				MemoryWatermark:       cfg.MemoryWatermark,
+				MemoryLimit:           cfg.MemoryLimit,
+				StallTimeout:          formatStallTimeout(cfg.StallTimeout),
+				AllowHostFallback:     cfg.AllowHostFallback,
+				RequireShimProvenance: cfg.RequireShimProvenance,
+				SandboxRoot:           cfg.SandboxRoot,
+			},
+		},
+	}
+	features := &report.Features
+
+	if s.docker != nil {
+		health := s.docker.Health()
+		features.Docker.Health = &health
+	}
+	if s.jailhouse != nil {
+		inv := s.jailhouse.Inventory()
+		features.Jailhouse.Inventory = &inv
+	}
+	if s.audit != nil {
+		health := s.audit.Health()
+		features.Audit.Health = &health
+	}
+	if cfg.AdminToken != "" {
+		features.API.Admin = "token"
+	}
+	switch {
+	case cfg.GRPCAddr != "" && cfg.GRPCToken != "":
+		features.API.GRPC = "token"
+	case cfg.GRPCAddr != "":
+		features.API.GRPC = "open"
+	}
+
+	for _, hook := range []struct{ kind, url string }{
+		{"incident_webhook", cfg.IncidentWebhook},
+		{"bridge_alert_webhook", cfg.BridgeAlertWebhook},
+	} {
+		if hook.url != "" {
+			features.Notifications = append(features.Notifications, NotificationChannel{Kind: hook.kind, Target: redactURL(hook.url, true)})
+		}
+	}
+	if s.bridges != nil {
+		for _, b := range s.bridges.List() {
+			features.Notifications = append(features.Notifications, NotificationChannel{Kind: "bridge", Target: b.Type + " " + b.Name, Stale: b.Stale})
+		}
+	}
+	return report
+}
+
+// formatStallTimeout renders Config.StallTimeout as the flag reads it.
+func formatStallTimeout(d time.Duration) string {
+	switch {
+	case d < 0:
+		return "never"
+	case d == 0:
+		return defaultStallTimeout.String()
+	}
+	return d.String()
+}
+
+// configSettings lists cfg's fields for the report, by snake_case name.
+func configSettings(cfg Config) map[string]ConfigSetting {
+	settings := make(map[string]ConfigSetting)
+	v := reflect.ValueOf(cfg)
+	for _, field := range reflect.VisibleFields(v.Type()) {
+		tag := field.Tag.Get("config")
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+		setting := ConfigSetting{
+			Value: reportValue(v.FieldByIndex(field.Index), fieldRedaction(field)),
+			Flag:  field.Tag.Get("flag"),
+		}
+		if setting.Flag != "" && cfg.FlagsSet != nil {
+			setting.Source = "default"
+			if cfg.FlagsSet[setting.Flag] {
+				setting.Source = "flag"
+			}
+		}
+		settings[snakeCase(field.Name)] = setting
+	}
+	return settings
+}
+
+// fieldRedaction returns how a field's value is redacted: its config tag,
+// or "secret" for a name that sounds like one.
+func fieldRedaction(field reflect.StructField) string {
+	if tag := field.Tag.Get("config"); tag != "" {
+		return tag
+	}
+	name := strings.ToLower(field.Name)
+	for _, word := range []string{"token", "secret", "password", "passwd", "credential"} {
+		if strings.Contains(name, word) {
+			return "secret"
+		}
+	}
+	return ""
+}
+
+// reportValue renders a setting for the report, redacted as redaction says
+// (see fieldRedaction). Durations are written as such, and structs, slices
+// and maps are rendered element by element under the same rules.
+func reportValue(v reflect.Value, redaction string) any {
+	switch redaction {
+	case "secret":
+		if v.IsZero() {
+			return ""
+		}
+		return redactedValue
+	case "webhook", "url":
+		return redactURL(v.String(), redaction == "webhook")
+	}
+
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return reportValue(v.Elem(), "")
+	case reflect.Struct:
+		fields := make(map[string]any)
+		for _, field := range reflect.VisibleFields(v.Type()) {
+			if field.IsExported() && field.Tag.Get("config") != "-" {
+				fields[snakeCase(field.Name)] = reportValue(v.FieldByIndex(field.Index), fieldRedaction(field))
+			}
+		}
+		return fields
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return fmt.Sprintf("%d bytes", v.Len()) // Raw bytes are likely key material
+		}
+		items := make([]any, v.Len())
+		for i := range items {
+			items[i] = reportValue(v.Index(i), "")
+		}
+		return items
+	case reflect.Map:
+		entries := make(map[string]any)
+		iter := v.MapRange()
+		for iter.Next() {
+			key := fmt.Sprint(iter.Key().Interface())
+			redaction := fieldRedaction(reflect.StructField{Name: key})
+			entries[key] = reportValue(iter.Value(), redaction)
+		}
+		return entries
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return nil
+	}
+	return v.Interface()
+}
+
+// redactURL takes the credentials out of a URL: user info, query and
+// fragment, and for a webhook, whose path is often its secret, the path too.
+// What cannot be parsed is redacted whole.
+func redactURL(raw string, webhook bool) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return redactedValue
+	}
+	if webhook && u.Path != "" && u.Path != "/" {
+		return u.Scheme + "://" + u.Host + "/" + redactedValue
+	}
+	u.User, u.RawQuery, u.Fragment, u.RawFragment = nil, "", "", ""
+	return u.String()
+}
+
+// configSecrets returns the secret values of cfg: its secret-tagged fields
+// and the full webhook URLs. Values shorter than 4 bytes are left out;
+// scrubbing them would mangle the report.
+func configSecrets(cfg Config) []string {
+	var secrets []string
+	v := reflect.ValueOf(cfg)
+	for _, field := range reflect.VisibleFields(v.Type()) {
+		if !field.IsExported() {
+			continue
+		}
+		value := v.FieldByIndex(field.Index)
+		switch fieldRedaction(field) {
+		case "secret", "webhook":
+			switch value.Kind() {
+			case reflect.String:
+				secrets = append(secrets, value.String())
+			case reflect.Slice:
+				if value.Type().Elem().Kind() == reflect.Uint8 {
+					secrets = append(secrets, string(value.Bytes()))
+				}
+				if tokens, ok := value.Interface().([]ReviewerToken); ok {
+					for _, t := range tokens {
+						secrets = append(secrets, t.Token)
+					}
+				}
+			}
+		}
+	}
+	kept := secrets[:0]
+	for _, secret := range secrets {
+		if len(secret) >= 4 {
+			kept = append(kept, secret)
+		}
+	}
+	return kept
+}
+
+// marshalConfigReport encodes report, scrubbing every secret of cfg from
+// the result in case one slipped through.
+func marshalConfigReport(report ConfigReport, cfg Config) ([]byte, error) {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	for _, secret := range configSecrets(cfg) {
+		quoted, _ := json.Marshal(secret)
+		data = bytes.ReplaceAll(data, quoted[1:len(quoted)-1], []byte(redactedValue))
+	}
+	return append(data, '\n'), nil
+}
+
+// snakeCase turns a Go field name into the report's key for it, e.g.
+// "APITLSCert" into "api_tls_cert".
+func snakeCase(name string) string {
+	var words []string
+	for name != "" {
+		word := ""
+		for _, acronym := range []string{"GRPC", "API", "TLS"} {
+			if rest, ok := strings.CutPrefix(name, acronym); ok && (rest == "" || !unicode.IsLower(rune(rest[0]))) {
+				word = acronym
+				break
+			}
+		}
+		if word == "" {
+			end := 1
+			if upperAt(name, 1) {
+				// An acronym runs until the capital of the next word
+				for end < len(name) && upperAt(name, end) && !(end+1 < len(name) && unicode.IsLower(rune(name[end+1]))) {
+					end++
+				}
+			} else {
+				for end < len(name) && !upperAt(name, end) {
+					end++
+				}
+			}
+			word = name[:end]
+		}
+		words = append(words, strings.ToLower(word))
+		name = name[len(word):]
+	}
+	return strings.Join(words, "_")
+}
+
+// upperAt reports whether s[i] is an upper-case letter.
+func upperAt(s string, i int) bool {
+	return i < len(s) && unicode.IsUpper(rune(s[i]))
+}
+
+// handleConfig serves GET /api/config, the warden's effective configuration
+// (see ConfigReport). It needs the admin token.
+func (api *APIServer) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !api.authorizeAdmin(w, r) {
+		return
+	}
+	data, err := marshalConfigReport(api.warden.ConfigReport(), api.warden.config)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
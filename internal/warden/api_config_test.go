@@ -0,0 +1,172 @@
+package warden
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigReportRedactsSecrets(t *testing.T) {
+	secrets := []string{
+		"admin-token-7f3a",
+		"grpc-token-c01d",
+		"approval-key-0123456789abcdef0123456789abcdef",
+		"T000/B000/XXXXhooksecret",
+		"basicpass",
+		"sig=queryToken",
+	}
+	srv := newTestServer(t)
+	srv.config.AdminToken = secrets[0]
+	srv.config.GRPCAddr, srv.config.GRPCToken = "127.0.0.1:9090", secrets[1]
+	srv.config.ApprovalLinkKey = []byte(secrets[2])
+	srv.config.IncidentWebhook = "https://hooks.example.com/services/" + secrets[3]
+	srv.config.BridgeAlertWebhook = "https://alert:" + secrets[4] + "@alerts.example.com/notify?" + secrets[5]
+	srv.config.PublicURL = "https://ops:" + secrets[4] + "@warden.example.com/"
+	srv.config.FlagsSet = map[string]bool{"admin-token-file": true}
+	srv.bridges = NewBridgeRegistry(time.Minute, log.New(io.Discard, "", 0))
+	srv.bridges.Heartbeat("ops-room", "slack", "1.2")
+	api := startTestAPI(t, srv)
+
+	get := func(token string) (int, string) {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+api.Addr()+"/api/config", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET /api/config: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+	if code, _ := get(""); code != http.StatusUnauthorized {
+		t.Errorf("without the admin token: %d, want 401", code)
+	}
+	code, body := get(secrets[0])
+	if code != http.StatusOK {
+		t.Fatalf("with the admin token: %d %s", code, body)
+	}
+	for _, secret := range secrets {
+		if strings.Contains(body, secret) {
+			t.Errorf("report contains secret %q:\n%s", secret, body)
+		}
+	}
+
+	var report ConfigReport
+	if err := json.Unmarshal([]byte(body), &report); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	settings := report.Settings
+	if s := settings["admin_token"]; s.Value != redactedValue || s.Flag != "admin-token-file" || s.Source != "flag" {
+		t.Errorf("admin_token = %+v", s)
+	}
+	if s := settings["api_tls_cert"]; s.Value != "" || s.Source != "default" {
+		t.Errorf("api_tls_cert = %+v", s)
+	}
+	for key, want := range map[string]any{
+		"grpc_token":           redactedValue,
+		"approval_link_key":    redactedValue,
+		"approval_link_ttl":    "0s",
+		"incident_webhook":     "https://hooks.example.com/" + redactedValue,
+		"bridge_alert_webhook": "https://alerts.example.com/" + redactedValue,
+		"public_url":           "https://warden.example.com/",
+	} {
+		if got := settings[key].Value; got != want {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+	for _, hidden := range []string{"logger", "embedded_shim", "flags_set"} {
+		if _, ok := settings[hidden]; ok {
+			t.Errorf("report has setting %s", hidden)
+		}
+	}
+
+	features := report.Features
+	if features.API.Admin != "token" || features.API.GRPC != "token" || !features.API.ApprovalLinks {
+		t.Errorf("API features = %+v", features.API)
+	}
+	if features.Docker.Available || features.Audit.Backend != "file" || features.Executors.StallTimeout != "2m0s" {
+		t.Errorf("features = %+v", features)
+	}
+	want := []NotificationChannel{
+		{Kind: "incident_webhook", Target: "https://hooks.example.com/" + redactedValue},
+		{Kind: "bridge_alert_webhook", Target: "https://alerts.example.com/" + redactedValue},
+		{Kind: "bridge", Target: "slack ops-room"},
+	}
+	if !reflect.DeepEqual(features.Notifications, want) {
+		t.Errorf("notifications = %+v, want %+v", features.Notifications, want)
+	}
+}
+
+func TestReportValueRedactsNestedSecrets(t *testing.T) {
+	type credentials struct {
+		User     string
+		Password string
+	}
+	type nested struct {
+		Name    string
+		Inner   credentials
+		Logins  []credentials
+		Headers map[string]string
+		Pointer *credentials
+		Key     []byte
+		Hook    string `config:"webhook"`
+		Hidden  string `config:"-"`
+	}
+	value := nested{
+		Name:    "ci",
+		Inner:   credentials{User: "bot", Password: "hunter2-inner"},
+		Logins:  []credentials{{User: "a", Password: "hunter2-slice"}},
+		Headers: map[string]string{"X-Api-Token": "hunter2-map", "Accept": "json"},
+		Pointer: &credentials{Password: "hunter2-pointer"},
+		Key:     []byte("hunter2-bytes"),
+		Hook:    "https://hooks.example.com/hunter2-hook",
+		Hidden:  "hunter2-hidden",
+	}
+	data, err := json.Marshal(reportValue(reflect.ValueOf(value), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "hunter2") {
+		t.Errorf("nested secret leaked: %s", data)
+	}
+	for _, kept := range []string{`"name":"ci"`, `"user":"bot"`, `"Accept":"json"`, `"key":"13 bytes"`} {
+		if !strings.Contains(string(data), kept) {
+			t.Errorf("%s lost %s", data, kept)
+		}
+	}
+
+	// The last resort catches secrets that reached the report some other way
+	cfg := Config{AdminToken: "hunter2-admin"}
+	report := ConfigReport{Settings: map[string]ConfigSetting{"leak": {Value: "token is hunter2-admin"}}}
+	if data, _ := marshalConfigReport(report, cfg); strings.Contains(string(data), "hunter2") {
+		t.Errorf("scrubbed report: %s", data)
+	}
+}
+
+func TestConfigSettingsNameTheirFlags(t *testing.T) {
+	settings := configSettings(Config{})
+	for _, field := range reflect.VisibleFields(reflect.TypeOf(Config{})) {
+		if field.Tag.Get("config") == "-" {
+			continue
+		}
+		key := snakeCase(field.Name)
+		if settings[key].Flag == "" {
+			t.Errorf("Config.%s (%s) names no flag", field.Name, key)
+		}
+	}
+	for name, want := range map[string]string{
+		"APITLSCert": "api_tls_cert", "GRPCAddr": "grpc_addr", "InstanceID": "instance_id",
+		"ApprovalLinkTTL": "approval_link_ttl", "PublicURL": "public_url", "AutoJailFromLabels": "auto_jail_from_labels",
+	} {
+		if got := snakeCase(name); got != want {
+			t.Errorf("snakeCase(%s) = %s, want %s", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package warden
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// CSRFHeader marks a state-changing API request as sent by a script rather
+// than a cross-site form. Browsers only attach custom headers after a CORS
+// preflight, which fails for origins not in Config.AllowedOrigins.
+const CSRFHeader = "X-Clawrden-Request"
+
+// csrfCookie holds the token the dashboard page mints for its own requests.
+// It is SameSite=Strict, so other sites cannot make the browser send it.
+const csrfCookie = "clawrden_csrf"
+
+// Headers and methods cross-origin callers may use once their origin is
+// allowed.
+const (
+	corsAllowHeaders = "Authorization, Content-Type, If-Match, " + CSRFHeader + ", " + ActorHeader
+	corsAllowMethods = "GET, POST, PUT, DELETE"
+	corsMaxAge       = "600"
+)
+
+// ParseAllowedOrigins splits a comma-separated list of origins
+// ("https://ops.example.com, http://localhost:3000") and checks that each
+// is a scheme and host, without a path. "*" is rejected: it would let any
+// page pass the CSRF check by sending the custom header.
+func ParseAllowedOrigins(s string) ([]string, error) {
+	var origins []string
+	for _, field := range strings.Split(s, ",") {
+		origin := strings.TrimSpace(field)
+		if origin == "" {
+			continue
+		}
+		if origin == "*" {
+			return nil, fmt.Errorf("allowed origins: %q would allow every site; list the origins instead", origin)
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+			strings.TrimSuffix(u.Path, "/") != "" || u.RawQuery != "" || u.Fragment != "" {
+			return nil, fmt.Errorf("allowed origins: %q is not an origin like https://host[:port]", origin)
+		}
+		origins = append(origins, normalizeOrigin(origin))
+	}
+	return origins, nil
+}
+
+// normalizeOrigin lowercases an origin and drops a trailing slash, the way
+// browsers send the Origin header.
+func normalizeOrigin(origin string) string {
+	return strings.ToLower(strings.TrimSuffix(origin, "/"))
+}
+
+// corsAllowed reports whether origin may call the API from a browser.
+func (api *APIServer) corsAllowed(origin string) bool {
+	return origin != "" && slices.Contains(api.allowedOrigins, normalizeOrigin(origin))
+}
+
+// protect wraps the API with CORS handling for the allowed origins and CSRF
+// protection for state changes sent by browsers.
+func (api *APIServer) protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin != "" {
+			w.Header().Add("Vary", "Origin")
+		}
+		if r.Method == http.MethodOptions && origin != "" && r.Header.Get("Access-Control-Request-Method") != "" {
+			api.handlePreflight(w, r, origin)
+			return
+		}
+		if api.corsAllowed(origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+
+		if !safeMethod(r.Method) && browserOriginated(r) && !api.csrfExempt(r) {
+			api.logger.Printf("SECURITY: blocked %s %s from %s: browser request without %s header or dashboard cookie (origin %q)",
+				r.Method, r.URL.Path, r.RemoteAddr, CSRFHeader, origin)
+			http.Error(w, "Cross-site request blocked: send the "+CSRFHeader+" header", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handlePreflight answers a CORS preflight: allowed origins get the methods
+// and headers they may use, others a 403 so the browser never sends the
+// real request.
+func (api *APIServer) handlePreflight(w http.ResponseWriter, r *http.Request, origin string) {
+	w.Header().Add("Vary", "Access-Control-Request-Method")
+	w.Header().Add("Vary", "Access-Control-Request-Headers")
+	if !api.corsAllowed(origin) {
+		if api.debug {
+			api.logger.Printf("api: preflight from %q refused: origin not allowed", origin)
+		}
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Access-Control-Allow-Methods", corsAllowMethods)
+	w.Header().Set("Access-Control-Allow-Headers", corsAllowHeaders)
+	w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// safeMethod reports whether method only reads state.
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// browserOriginated reports whether a request carries the headers browsers
+// add and API clients such as the CLI and the chat bridges do not.
+func browserOriginated(r *http.Request) bool {
+	for _, h := range []string{"Origin", "Referer", "Sec-Fetch-Site", "Cookie"} {
+		if r.Header.Get(h) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// csrfExempt reports whether a browser request proves it is not a
+// cross-site forgery: it sends a bearer token, which pages cannot attach
+// without passing the preflight, the custom header, or the dashboard's
+// same-site cookie.
+func (api *APIServer) csrfExempt(r *http.Request) bool {
+	if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") || r.Header.Get(CSRFHeader) != "" {
+		return true
+	}
+	cookie, err := r.Cookie(csrfCookie)
+	return err == nil && api.validCSRFToken(cookie.Value)
+}
+
+// setCSRFCookie gives the dashboard page a token for its own requests,
+// unless the browser already holds a valid one.
+func (api *APIServer) setCSRFCookie(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(csrfCookie); err == nil && api.validCSRFToken(cookie.Value) {
+		return
+	}
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    api.signCSRFNonce(nonce),
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// signCSRFNonce returns a token of the form nonce.mac.
+func (api *APIServer) signCSRFNonce(nonce []byte) string {
+	mac := hmac.New(sha256.New, api.csrfKey)
+	mac.Write(nonce)
+	return base64.RawURLEncoding.EncodeToString(nonce) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validCSRFToken checks a token minted by setCSRFCookie. The key is
+// generated at startup, so tokens do not survive a restart; reloading the
+// dashboard mints a new one.
+func (api *APIServer) validCSRFToken(token string) bool {
+	encoded, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	nonce, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(nonce) == 0 {
+		return false
+	}
+	return hmac.Equal([]byte(api.signCSRFNonce(nonce)), []byte(token))
+}
@@ -0,0 +1,61 @@
+package warden
+
+import (
+	"clawrden/internal/faultinject"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// handleFaults arms and disarms fault injection points. It is only routed
+// in builds with the faultinject tag.
+//
+//	GET    /api/debug/faults              list the points and the armed faults
+//	POST   /api/debug/faults              arm a point: {"point": "...", "delay": "500ms", "disconnect": true}
+//	DELETE /api/debug/faults[?point=...]  disarm one point, or all of them
+func (api *APIServer) handleFaults(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req struct {
+			Point string `json:"point"`
+			Delay string `json:"delay"` // Go duration, e.g. "500ms"
+			faultinject.Fault
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		if !slices.Contains(faultinject.Points, req.Point) {
+			http.Error(w, fmt.Sprintf("Unknown injection point %q", req.Point), http.StatusBadRequest)
+			return
+		}
+		if req.Delay != "" {
+			d, err := time.ParseDuration(req.Delay)
+			if err != nil || d < 0 {
+				http.Error(w, fmt.Sprintf("Invalid delay %q (expected e.g. 500ms)", req.Delay), http.StatusBadRequest)
+				return
+			}
+			req.Fault.Delay = d
+		}
+		faultinject.Set(req.Point, req.Fault)
+		api.logger.Printf("fault injection: armed %s: %+v", req.Point, req.Fault)
+	case http.MethodDelete:
+		if point := r.URL.Query().Get("point"); point != "" {
+			faultinject.Clear(point)
+		} else {
+			faultinject.Reset()
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"points": faultinject.Points,
+		"armed":  faultinject.Armed(),
+	})
+}
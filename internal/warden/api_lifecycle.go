@@ -0,0 +1,208 @@
+package warden
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// The HTTP API runs on its own lifecycle, apart from the shim socket: it can
+// be stopped and started again against the same warden, for example to pick
+// up a rotated TLS certificate, without touching in-flight commands. Route
+// counters, the CSRF key and the event bus outlive a restart; dashboards
+// lose their WebSocket and resync from a fresh snapshot when they reconnect.
+
+// apiStopGrace is how long Stop waits for in-flight API requests before
+// closing their connections.
+const apiStopGrace = 5 * time.Second
+
+// wsRestartReason is the close reason dashboards are sent on an API restart.
+const wsRestartReason = "API restarting"
+
+// ErrAPIRunning is returned by Start when the API is already serving.
+var ErrAPIRunning = errors.New("HTTP API already running")
+
+// ErrNoAPI is returned by Server.RestartAPI when the API is not configured.
+var ErrNoAPI = errors.New("HTTP API not configured")
+
+// newHTTPServer returns an unstarted server for the API's routes; an
+// http.Server cannot be started again once shut down.
+func (api *APIServer) newHTTPServer(addr string) *http.Server {
+	return &http.Server{
+		Addr:         addr,
+		Handler:      api.handler,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+}
+
+// Start binds the API's address and serves it in the background. With a
+// TLS certificate configured it is loaded now, so each start picks up the
+// files as they are.
+func (api *APIServer) Start() error {
+	api.lifecycleMu.Lock()
+	defer api.lifecycleMu.Unlock()
+	if api.listener != nil {
+		return ErrAPIRunning
+	}
+	tlsConfig, err := api.loadTLS()
+	if err != nil {
+		return err
+	}
+	return api.start(tlsConfig)
+}
+
+// start binds and serves. The caller holds api.lifecycleMu.
+func (api *APIServer) start(tlsConfig *tls.Config) error {
+	ln, err := net.Listen("tcp", api.server.Addr)
+	if err != nil {
+		return fmt.Errorf("listen on %s: %w", api.server.Addr, err)
+	}
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+
+	api.mu.Lock()
+	api.closing = false
+	api.mu.Unlock()
+
+	srv, served := api.server, make(chan struct{})
+	api.listener, api.served = ln, served
+	go func() {
+		defer close(served)
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			api.logger.Printf("HTTP API server error: %v", err)
+		}
+	}()
+	scheme := "HTTP"
+	if tlsConfig != nil {
+		scheme = "HTTPS"
+	}
+	api.logger.Printf("HTTP API listening on %s (%s)", ln.Addr(), scheme)
+	return nil
+}
+
+// Stop closes the API listener and waits up to apiStopGrace for in-flight
+// requests. Dashboard WebSockets are told the warden is going away first,
+// since shutting the server down does not close hijacked connections.
+// Stopping a stopped API does nothing.
+func (api *APIServer) Stop() error {
+	api.lifecycleMu.Lock()
+	defer api.lifecycleMu.Unlock()
+	api.closeWebSockets(websocket.CloseGoingAway, wsCloseReason)
+	return api.stop()
+}
+
+// stop shuts the running server down and readies a new one for the next
+// start. The caller holds api.lifecycleMu.
+func (api *APIServer) stop() error {
+	if api.listener == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), apiStopGrace)
+	defer cancel()
+	err := api.server.Shutdown(ctx)
+	if err != nil {
+		api.server.Close()
+	}
+	<-api.served
+	api.listener, api.served = nil, nil
+	api.server = api.newHTTPServer(api.server.Addr)
+	return err
+}
+
+// Restart stops the API and starts it again on the same address. The TLS
+// certificate is loaded before anything stops, so a bad one leaves the
+// running API alone.
+func (api *APIServer) Restart() error {
+	api.lifecycleMu.Lock()
+	defer api.lifecycleMu.Unlock()
+	tlsConfig, err := api.loadTLS()
+	if err != nil {
+		return err
+	}
+	api.closeWebSockets(websocket.CloseServiceRestart, wsRestartReason)
+	if err := api.stop(); err != nil {
+		api.logger.Printf("warning: HTTP API restart: in-flight requests cut off: %v", err)
+	}
+	if err := api.start(tlsConfig); err != nil {
+		return fmt.Errorf("restart HTTP API: %w", err)
+	}
+	api.logger.Printf("HTTP API restarted")
+	return nil
+}
+
+// Addr returns the address the API is listening on, or "" while stopped.
+func (api *APIServer) Addr() string {
+	api.lifecycleMu.Lock()
+	defer api.lifecycleMu.Unlock()
+	if api.listener == nil {
+		return ""
+	}
+	return api.listener.Addr().String()
+}
+
+// loadTLS reads the configured certificate; nil without one.
+func (api *APIServer) loadTLS() (*tls.Config, error) {
+	cfg := api.warden.config
+	if cfg.APITLSCert == "" && cfg.APITLSKey == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.APITLSCert, cfg.APITLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("load API TLS certificate: %w", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
+
+// handleRestartAPI serves POST /api/admin/restart-api. The restart happens
+// once the response is out; callers reconnect to see it done.
+func (api *APIServer) handleRestartAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !api.authorizeAdmin(w, r) {
+		return
+	}
+	if _, err := api.loadTLS(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	api.logger.Printf("HTTP API restart requested by %s", r.RemoteAddr)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"status": "restarting"})
+	go func() {
+		if err := api.Restart(); err != nil {
+			api.logger.Printf("HTTP API restart failed: %v", err)
+		}
+	}()
+}
+
+// authorizeAdmin checks the admin bearer token, answering the request when
+// it fails.
+func (api *APIServer) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	want := api.warden.config.AdminToken
+	if want == "" {
+		http.Error(w, "Admin endpoints are disabled; start the warden with -admin-token-file", http.StatusForbidden)
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(want)) != 1 {
+		api.logger.Printf("SECURITY: rejected %s %s from %s: missing or invalid admin token", r.Method, r.URL.Path, r.RemoteAddr)
+		http.Error(w, "Missing or invalid bearer token", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
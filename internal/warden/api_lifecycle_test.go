@@ -0,0 +1,249 @@
+package warden
+
+import (
+	"clawrden/internal/events"
+	"clawrden/pkg/protocol"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// startTestAPI serves srv's API on a free localhost port until the test ends.
+func startTestAPI(t *testing.T, srv *Server) *APIServer {
+	t.Helper()
+	srv.config.DisableDashboard = true
+	api := NewAPIServer(srv, "127.0.0.1:0", log.New(io.Discard, "", 0))
+	if err := api.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { api.Stop() })
+	return api
+}
+
+func TestAPIRestartLeavesShimStream(t *testing.T) {
+	srv, audited := newMaintenanceTestServer(t, []Rule{{Command: "sh", Action: ActionAllow}})
+	api := startTestAPI(t, srv)
+	srv.api = api
+
+	flag := filepath.Join(t.TempDir(), "flag")
+	client, server := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.handleConnection(server)
+	}()
+	script := "echo before; while [ ! -e " + flag + " ]; do sleep 0.01; done; echo after"
+	if err := protocol.WriteRequest(client, &protocol.Request{Command: "sh", Args: []string{"-c", script}, Cwd: "/"}); err != nil {
+		t.Fatal(err)
+	}
+	if ack, err := protocol.ReadAck(client); err != nil || ack != protocol.AckAllowed {
+		t.Fatalf("ack %d, %v", ack, err)
+	}
+	readStdout := func() string {
+		for {
+			f, err := protocol.ReadFrame(client)
+			if err != nil {
+				t.Fatalf("read frame: %v", err)
+			}
+			if f.Type == protocol.StreamStdout {
+				return string(f.Payload)
+			}
+		}
+	}
+	if got := readStdout(); got != "before\n" {
+		t.Fatalf("first output %q", got)
+	}
+
+	// Restart the API while the command is still running
+	oldAddr := api.Addr()
+	if err := srv.RestartAPI(); err != nil {
+		t.Fatalf("RestartAPI: %v", err)
+	}
+	if api.Addr() == "" {
+		t.Fatal("API not listening after restart")
+	}
+	if _, err := http.Get("http://" + oldAddr + "/api/status"); err == nil && api.Addr() != oldAddr {
+		t.Error("old listener still answers after restart")
+	}
+	resp, err := http.Get("http://" + api.Addr() + "/api/status")
+	if err != nil {
+		t.Fatalf("status after restart: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status after restart = %d", resp.StatusCode)
+	}
+
+	writeTestFile(t, flag, "")
+	if got := readStdout(); got != "after\n" {
+		t.Errorf("output after restart %q, want after", got)
+	}
+	for {
+		f, err := protocol.ReadFrame(client)
+		if err != nil {
+			t.Fatalf("read exit: %v", err)
+		}
+		if f.Type == protocol.StreamExit {
+			if code := protocol.ParseExitCode(f); code != 0 {
+				t.Errorf("exit %d, want 0", code)
+			}
+			break
+		}
+	}
+	client.Close()
+	<-done
+	if entries := audited(); len(entries) != 1 || entries[0].ExitCode != 0 {
+		t.Errorf("audited %+v, want one successful command", entries)
+	}
+}
+
+func TestRestartAPIEndpoint(t *testing.T) {
+	srv := newTestServer(t)
+	srv.events = events.New(log.New(io.Discard, "", 0))
+	t.Cleanup(srv.events.Close)
+	api := startTestAPI(t, srv)
+
+	post := func(token string) int {
+		req, _ := http.NewRequest(http.MethodPost, "http://"+api.Addr()+"/api/admin/restart-api", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("restart-api: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := post("secret"); code != http.StatusForbidden {
+		t.Errorf("without an admin token configured: %d, want 403", code)
+	}
+	srv.config.AdminToken = "secret"
+	if code := post(""); code != http.StatusUnauthorized {
+		t.Errorf("without a token: %d, want 401", code)
+	}
+	if code := post("wrong"); code != http.StatusUnauthorized {
+		t.Errorf("with a wrong token: %d, want 401", code)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+api.Addr()+"/api/ws", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	readWS(t, conn, "snapshot", "")
+
+	oldAddr := api.Addr()
+	if code := post("secret"); code != http.StatusAccepted {
+		t.Fatalf("with the token: %d, want 202", code)
+	}
+
+	// Dashboards are told to come back rather than that the warden is gone
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err = conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseServiceRestart {
+		t.Errorf("read during restart: %v, want service restart", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for api.Addr() == "" || api.Addr() == oldAddr {
+		if time.Now().After(deadline) {
+			t.Fatal("API did not come back")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	conn2, _, err := websocket.DefaultDialer.Dial("ws://"+api.Addr()+"/api/ws", nil)
+	if err != nil {
+		t.Fatalf("dial after restart: %v", err)
+	}
+	defer conn2.Close()
+	readWS(t, conn2, "snapshot", "")
+	for _, stats := range api.RouteStats() {
+		if stats.Route == "/api/admin/restart-api" && stats.Requests != 4 {
+			t.Errorf("restart-api requests after restart = %d, want 4 kept", stats.Requests)
+		}
+	}
+}
+
+func TestAPIRestartReloadsCertificate(t *testing.T) {
+	dir := t.TempDir()
+	srv := newTestServer(t)
+	srv.config.APITLSCert = filepath.Join(dir, "api.crt")
+	srv.config.APITLSKey = filepath.Join(dir, "api.key")
+	writeTestCert(t, srv.config.APITLSCert, srv.config.APITLSKey, "first")
+	api := startTestAPI(t, srv)
+
+	commonName := func() string {
+		conn, err := tls.Dial("tcp", api.Addr(), &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatalf("TLS dial: %v", err)
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+	if got := commonName(); got != "first" {
+		t.Fatalf("certificate %q, want first", got)
+	}
+
+	writeTestCert(t, srv.config.APITLSCert, srv.config.APITLSKey, "second")
+	if err := api.Restart(); err != nil {
+		t.Fatalf("Restart: %v", err)
+	}
+	if got := commonName(); got != "second" {
+		t.Errorf("certificate after restart %q, want second", got)
+	}
+
+	// A broken certificate leaves the running API alone
+	os.WriteFile(srv.config.APITLSKey, []byte("garbage"), 0600)
+	addr := api.Addr()
+	if err := api.Restart(); err == nil || !strings.Contains(err.Error(), "load API TLS certificate") {
+		t.Errorf("restart with a broken key: %v", err)
+	}
+	if api.Addr() != addr || commonName() != "second" {
+		t.Error("API stopped by a failed restart")
+	}
+}
+
+// writeTestCert writes a self-signed certificate for name and its key.
+func writeTestCert(t *testing.T, certPath, keyPath, name string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, certPath, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+	writeTestFile(t, keyPath, string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})))
+}
@@ -0,0 +1,175 @@
+package warden
+
+import (
+	"clawrden/pkg/protocol"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// errLinkNotPending is recorded when a valid link arrives after the request
+// was decided or expired.
+var errLinkNotPending = errors.New("request is no longer pending")
+
+// linkPage is the confirmation page shown after an approval link is opened.
+var linkPage = template.Must(template.New("link").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Clawrden</title></head>
+<body style="font-family: sans-serif; max-width: 32em; margin: 3em auto; padding: 0 1em">
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+{{if .RequestID}}<p><small>Request <code>{{.RequestID}}</code></small></p>{{end}}
+</body>
+</html>
+`))
+
+// mintApprovalLinks returns signed one-time approve and deny URLs for a
+// pending request. Notifiers call it and put the URLs in their messages.
+func (api *APIServer) mintApprovalLinks(w http.ResponseWriter, r *http.Request, id string) {
+	signer := api.warden.links
+	if signer == nil {
+		http.Error(w, "Approval links are not configured", http.StatusServiceUnavailable)
+		return
+	}
+	if !api.warden.GetHITLQueue().IsPending(id) {
+		http.Error(w, "Request not pending", http.StatusNotFound)
+		return
+	}
+
+	var body struct {
+		IssuedTo string `json:"issued_to"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	base := strings.TrimSuffix(api.warden.config.PublicURL, "/")
+	if base == "" {
+		base = "http://" + r.Host
+	}
+
+	resp := map[string]interface{}{}
+	var expires time.Time
+	for _, action := range []string{"approve", "deny"} {
+		token, exp, err := signer.Issue(id, action, body.IssuedTo)
+		if err != nil {
+			api.logger.Printf("warning: issue approval link: %v", err)
+			http.Error(w, "Failed to issue approval link", http.StatusInternalServerError)
+			return
+		}
+		expires = exp
+		resp[action] = fmt.Sprintf("%s/api/queue/%s/%s?token=%s", base, url.PathEscape(id), action, url.QueryEscape(token))
+	}
+	resp["expires_at"] = expires
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleApprovalLink resolves a request from a signed one-time link and
+// renders a confirmation page. Every use, accepted or not, is audited.
+func (api *APIServer) handleApprovalLink(w http.ResponseWriter, r *http.Request, id, action string) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	signer := api.warden.links
+	if signer == nil {
+		renderLinkPage(w, http.StatusNotFound, "Not available", "Approval links are not enabled on this warden.", "")
+		return
+	}
+
+	claims, err := signer.Consume(r.URL.Query().Get("token"), id, action)
+	entry := AuditEntry{
+		RequestID: id,
+		Command:   approvalLinkCommand,
+		Args:      []string{action, id},
+		Decision:  protocol.DecisionEvent,
+		Detail:    action,
+	}
+	if claims != nil {
+		entry.IssuedTo = claims.IssuedTo
+	}
+
+	var remaining int
+	if err == nil {
+		review := Review{Decision: linkDecision(action), Reviewer: claims.IssuedTo, Channel: ChannelLink}
+		if review.Reviewer == "" {
+			review.Reviewer = reviewerOf(r)
+		}
+		remaining, err = api.warden.GetHITLQueue().Review(id, review)
+		if errors.Is(err, errNotPending) || errors.Is(err, errAlreadyDecided) {
+			err = errLinkNotPending
+		}
+	}
+	if err != nil {
+		entry.Decision = protocol.DecisionRejected
+		entry.Error = err.Error()
+	}
+	api.auditLink(entry)
+
+	switch {
+	case err == nil && remaining > 0:
+		api.logger.Printf("approval of request %s recorded via approval link (issued to %q); %d more needed", id, entry.IssuedTo, remaining)
+		renderLinkPage(w, http.StatusOK, "Approval recorded", fmt.Sprintf("The command needs %d more approval(s) before it runs. You can close this page.", remaining), id)
+	case err == nil:
+		verb := "approved"
+		if action == "deny" {
+			verb = "denied"
+		}
+		api.logger.Printf("request %s %s via approval link (issued to %q)", id, verb, entry.IssuedTo)
+		renderLinkPage(w, http.StatusOK, "Request "+verb, "The command was "+verb+". You can close this page.", id)
+	case errors.Is(err, ErrLinkExpired), errors.Is(err, ErrLinkUsed):
+		renderLinkPage(w, http.StatusGone, "Link no longer valid", capitalize(err.Error())+".", id)
+	case errors.Is(err, errLinkNotPending):
+		renderLinkPage(w, http.StatusConflict, "Nothing to do", capitalize(err.Error())+".", id)
+	case errors.Is(err, errChannelNotRouted), errors.Is(err, errApprovedTwice), errors.Is(err, errUnauthenticated), errors.Is(err, errNoReviewer):
+		renderLinkPage(w, http.StatusForbidden, "Not approved", capitalize(err.Error())+".", id)
+	default:
+		// Malformed, forged, or edited to point at another request or action
+		api.logger.Printf("SECURITY: rejected approval link for %s: %v", id, err)
+		renderLinkPage(w, http.StatusForbidden, "Invalid link", "This approval link is not valid.", "")
+	}
+}
+
+// auditLink records an approval link use.
+func (api *APIServer) auditLink(entry AuditEntry) {
+	if api.warden.audit == nil {
+		return
+	}
+	if err := api.warden.audit.Log(entry); err != nil {
+		api.logger.Printf("warning: audit approval link: %v", err)
+	}
+}
+
+func linkDecision(action string) Decision {
+	if action == "approve" {
+		return DecisionApprove
+	}
+	return DecisionDeny
+}
+
+func renderLinkPage(w http.ResponseWriter, status int, title, message, requestID string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	linkPage.Execute(w, map[string]string{
+		"Title":     title,
+		"Message":   message,
+		"RequestID": requestID,
+	})
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,188 @@
+package warden
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultSlowRequestThreshold is used when Config.SlowRequestThreshold is zero.
+const defaultSlowRequestThreshold = time.Second
+
+// RouteStats holds request counters for a single API route.
+type RouteStats struct {
+	Route       string  `json:"route"`
+	Requests    int64   `json:"requests"`
+	Errors      int64   `json:"errors"` // Responses with status >= 500
+	Slow        int64   `json:"slow"`
+	TotalMillis float64 `json:"total_ms"` // Excludes streaming responses
+}
+
+// routeMetrics accumulates per-route request statistics.
+type routeMetrics struct {
+	mu     sync.Mutex
+	routes map[string]*RouteStats
+}
+
+func newRouteMetrics() *routeMetrics {
+	return &routeMetrics{routes: make(map[string]*RouteStats)}
+}
+
+// record adds one request to a route's counters.
+func (m *routeMetrics) record(route string, status int, duration time.Duration, slow, streaming bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats, ok := m.routes[route]
+	if !ok {
+		stats = &RouteStats{Route: route}
+		m.routes[route] = stats
+	}
+	stats.Requests++
+	if status >= 500 {
+		stats.Errors++
+	}
+	if slow {
+		stats.Slow++
+	}
+	if !streaming {
+		stats.TotalMillis += float64(duration.Microseconds()) / 1000
+	}
+}
+
+// snapshot returns a copy of all route counters, sorted by route.
+func (m *routeMetrics) snapshot() []RouteStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]RouteStats, 0, len(m.routes))
+	for _, stats := range m.routes {
+		result = append(result, *stats)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Route < result[j].Route })
+	return result
+}
+
+// statusRecorder captures the response status code.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush lets streaming handlers flush through the recorder.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets WebSocket upgrades take over the connection.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(r.ResponseWriter).Hijack()
+	if err == nil && r.status == 0 {
+		r.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// instrument wraps a handler with panic recovery, request logging, slow-request
+// tracing, and per-route counters. Streaming responses (text/event-stream,
+// application/x-ndjson), WebSockets and downloads (attachments) are counted
+// but excluded from duration accounting and slow-request warnings.
+func (api *APIServer) instrument(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		defer func() {
+			if p := recover(); p != nil {
+				api.logger.Printf("ERROR: panic in %s %s: %v", r.Method, r.URL.Path, p)
+				if rec.status == 0 {
+					http.Error(rec, "Internal server error", http.StatusInternalServerError)
+				}
+				rec.status = http.StatusInternalServerError
+			}
+
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			duration := time.Since(start)
+			streaming := strings.HasPrefix(rec.Header().Get("Content-Type"), "text/event-stream") ||
+				strings.HasPrefix(rec.Header().Get("Content-Type"), "application/x-ndjson") ||
+				strings.HasPrefix(rec.Header().Get("Content-Disposition"), "attachment") ||
+				rec.status == http.StatusSwitchingProtocols
+			slow := !streaming && duration >= api.slowThreshold
+
+			api.metrics.record(route, status, duration, slow, streaming)
+
+			caller := r.RemoteAddr
+			switch {
+			case slow:
+				api.logger.Printf("warning: slow API request: %s %s status=%d duration=%v caller=%s route=%s query=%q",
+					r.Method, r.URL.Path, status, duration, caller, route, redactQuery(r.URL.RawQuery))
+			case status >= 500 || api.debug:
+				api.logger.Printf("api: %s %s status=%d duration=%v caller=%s",
+					r.Method, r.URL.Path, status, duration, caller)
+			}
+		}()
+
+		next(rec, r)
+	}
+}
+
+// credentialParams are query parameters whose values are credentials, such
+// as the token of a one-time approval link, matched case-insensitively.
+var credentialParams = map[string]bool{
+	"token": true, "access_token": true, "api_key": true, "key": true,
+	"password": true, "secret": true, "sig": true, "signature": true,
+}
+
+// redactQuery returns a raw query string with the values of credential
+// parameters replaced, so it can be logged. Parameter order is kept.
+func redactQuery(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	params := strings.Split(raw, "&")
+	for i, param := range params {
+		rawName, _, hasValue := strings.Cut(param, "=")
+		name, err := url.QueryUnescape(rawName)
+		if err != nil {
+			name = rawName
+		}
+		if hasValue && credentialParams[strings.ToLower(name)] {
+			params[i] = rawName + "=REDACTED"
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// RouteStats returns per-route API request counters.
+func (api *APIServer) RouteStats() []RouteStats {
+	return api.metrics.snapshot()
+}
@@ -0,0 +1,135 @@
+package warden
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestAPIServer(t *testing.T, cfg Config) (*APIServer, *bytes.Buffer) {
+	t.Helper()
+	var buf bytes.Buffer
+	srv := newTestServer(t)
+	srv.config.APIDebug = cfg.APIDebug
+	srv.config.SlowRequestThreshold = cfg.SlowRequestThreshold
+	srv.config.DisableDashboard = cfg.DisableDashboard
+	srv.config.AllowedOrigins = cfg.AllowedOrigins
+	return NewAPIServer(srv, "127.0.0.1:0", log.New(&buf, "", 0)), &buf
+}
+
+func TestInstrumentLogsRequestsInDebug(t *testing.T) {
+	api, logs := newTestAPIServer(t, Config{APIDebug: true})
+	handler := api.instrument("/api/test", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/test", nil)
+	req.RemoteAddr = "10.0.0.7:5555"
+	handler(httptest.NewRecorder(), req)
+
+	line := logs.String()
+	for _, want := range []string{"api: POST /api/test", "status=202", "caller=10.0.0.7:5555"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("log %q missing %q", line, want)
+		}
+	}
+
+	stats := api.RouteStats()
+	if len(stats) != 1 || stats[0].Route != "/api/test" || stats[0].Requests != 1 {
+		t.Errorf("RouteStats = %+v", stats)
+	}
+}
+
+func TestInstrumentQuietWithoutDebug(t *testing.T) {
+	api, logs := newTestAPIServer(t, Config{})
+	handler := api.instrument("/api/test", func(w http.ResponseWriter, r *http.Request) {})
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/test", nil))
+
+	if logs.Len() != 0 {
+		t.Errorf("unexpected log output: %q", logs.String())
+	}
+}
+
+func TestInstrumentSlowRequest(t *testing.T) {
+	api, logs := newTestAPIServer(t, Config{SlowRequestThreshold: time.Millisecond})
+	handler := api.instrument("/api/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+	})
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/slow?limit=5", nil))
+
+	if !strings.Contains(logs.String(), "warning: slow API request: GET /api/slow") {
+		t.Errorf("expected slow request warning, got %q", logs.String())
+	}
+	if !strings.Contains(logs.String(), `query="limit=5"`) {
+		t.Errorf("slow request warning missing query, got %q", logs.String())
+	}
+	if stats := api.RouteStats(); stats[0].Slow != 1 {
+		t.Errorf("Slow = %d, want 1", stats[0].Slow)
+	}
+}
+
+func TestInstrumentSlowRequestRedactsCredentials(t *testing.T) {
+	api, logs := newTestAPIServer(t, Config{SlowRequestThreshold: time.Millisecond})
+	handler := api.instrument("/api/links/{id}/{action}", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+	})
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/links/q-1/approve?token=s3cr3t-link&limit=5&API_KEY=k3y&Sig=abc", nil))
+
+	for _, secret := range []string{"s3cr3t-link", "k3y", "abc"} {
+		if strings.Contains(logs.String(), secret) {
+			t.Errorf("slow request warning leaks %q: %q", secret, logs.String())
+		}
+	}
+	if want := `query="token=REDACTED&limit=5&API_KEY=REDACTED&Sig=REDACTED"`; !strings.Contains(logs.String(), want) {
+		t.Errorf("slow request warning lacks %s, got %q", want, logs.String())
+	}
+}
+
+func TestInstrumentRecoversPanic(t *testing.T) {
+	api, logs := newTestAPIServer(t, Config{})
+	handler := api.instrument("/api/boom", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/boom", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", rec.Code)
+	}
+	if !strings.Contains(logs.String(), "panic in GET /api/boom: boom") {
+		t.Errorf("missing panic log, got %q", logs.String())
+	}
+	if !strings.Contains(logs.String(), "status=500") {
+		t.Errorf("missing status=500 log line, got %q", logs.String())
+	}
+	if stats := api.RouteStats(); stats[0].Errors != 1 {
+		t.Errorf("Errors = %d, want 1", stats[0].Errors)
+	}
+}
+
+func TestInstrumentExcludesStreamingFromDuration(t *testing.T) {
+	api, logs := newTestAPIServer(t, Config{SlowRequestThreshold: time.Millisecond})
+	handler := api.instrument("/api/events", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		time.Sleep(5 * time.Millisecond)
+	})
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/events", nil))
+
+	stats := api.RouteStats()
+	if stats[0].Requests != 1 || stats[0].TotalMillis != 0 || stats[0].Slow != 0 {
+		t.Errorf("streaming request affected duration stats: %+v", stats[0])
+	}
+	if strings.Contains(logs.String(), "slow API request") {
+		t.Errorf("streaming request logged as slow: %q", logs.String())
+	}
+}
@@ -0,0 +1,91 @@
+package warden
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// webFS holds the dashboard page and any assets under web/static/.
+//
+//go:embed web
+var webFS embed.FS
+
+// dashboardAsset is the dashboard page's path within webFS.
+const dashboardAsset = "dashboard.html"
+
+// staticAsset is an embedded file with its precomputed ETag.
+type staticAsset struct {
+	name string
+	body []byte
+	etag string
+}
+
+// loadStaticAssets reads every embedded web file and hashes it once, keyed
+// by its path relative to web/ (e.g. "dashboard.html", "static/app.js").
+func loadStaticAssets() (map[string]*staticAsset, error) {
+	root, err := fs.Sub(webFS, "web")
+	if err != nil {
+		return nil, err
+	}
+
+	assets := make(map[string]*staticAsset)
+	err = fs.WalkDir(root, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		body, err := fs.ReadFile(root, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(body)
+		assets[name] = &staticAsset{
+			name: name,
+			body: body,
+			etag: `"` + hex.EncodeToString(sum[:16]) + `"`,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("load embedded web assets: %w", err)
+	}
+	return assets, nil
+}
+
+// serveAsset writes an embedded asset. Browsers must revalidate on every
+// load, but an unchanged asset costs only a 304 (conditional requests and
+// HEAD are handled by http.ServeContent).
+func serveAsset(w http.ResponseWriter, r *http.Request, asset *staticAsset) {
+	w.Header().Set("ETag", asset.etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, asset.name, time.Time{}, bytes.NewReader(asset.body))
+}
+
+// handleDashboard serves the web dashboard UI and the CSRF cookie its requests
+// carry (see setCSRFCookie).
+func (api *APIServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" || api.assets == nil {
+		http.NotFound(w, r)
+		return
+	}
+	api.setCSRFCookie(w, r)
+	serveAsset(w, r, api.assets[dashboardAsset])
+}
+
+// handleStatic serves embedded assets under /static/.
+func (api *APIServer) handleStatic(w http.ResponseWriter, r *http.Request) {
+	name := path.Clean(strings.TrimPrefix(r.URL.Path, "/"))
+	asset, ok := api.assets[name]
+	if !ok || !strings.HasPrefix(name, "static/") {
+		http.NotFound(w, r)
+		return
+	}
+	serveAsset(w, r, asset)
+}
@@ -0,0 +1,114 @@
+package warden
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDashboardConditionalRequests(t *testing.T) {
+	api, _ := newTestAPIServer(t, Config{})
+	handler := api.server.Handler
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET / status = %d, want 200", rec.Code)
+	}
+	etag := rec.Header().Get("ETag")
+	if etag == "" || rec.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("missing cache headers: %v", rec.Header())
+	}
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("Content-Type = %q", rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), "<html") {
+		t.Error("body is not the dashboard page")
+	}
+
+	tests := []struct {
+		ifNoneMatch string
+		want        int
+	}{
+		{etag, http.StatusNotModified},
+		{`"stale", ` + etag, http.StatusNotModified},
+		{"W/" + etag, http.StatusNotModified},
+		{"*", http.StatusNotModified},
+		{`"stale"`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("If-None-Match", tt.ifNoneMatch)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("If-None-Match %s: status = %d, want %d", tt.ifNoneMatch, rec.Code, tt.want)
+		}
+		if rec.Code == http.StatusNotModified && rec.Body.Len() != 0 {
+			t.Errorf("If-None-Match %s: 304 has a body", tt.ifNoneMatch)
+		}
+	}
+
+	// The ETag is computed once, so it is stable across requests
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Header().Get("ETag") != etag {
+		t.Errorf("ETag changed: %q then %q", etag, rec.Header().Get("ETag"))
+	}
+}
+
+func TestStaticAssets(t *testing.T) {
+	api, _ := newTestAPIServer(t, Config{})
+	api.assets["static/app.js"] = &staticAsset{name: "static/app.js", body: []byte("x()"), etag: `"abc"`}
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/static/app.js", http.StatusOK},
+		{"/static/missing.js", http.StatusNotFound},
+		{"/static/../dashboard.html", http.StatusNotFound},
+		{"/dashboard.html", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.URL.Path = tt.path // Bypass client-side path cleaning
+		rec := httptest.NewRecorder()
+		if strings.HasPrefix(tt.path, "/static/") {
+			api.handleStatic(rec, req)
+		} else {
+			api.server.Handler.ServeHTTP(rec, req)
+		}
+		if rec.Code != tt.want {
+			t.Errorf("GET %s: status = %d, want %d", tt.path, rec.Code, tt.want)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/static/app.js", nil)
+	req.Header.Set("If-None-Match", `"abc"`)
+	rec := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("conditional static request: status = %d, want 304", rec.Code)
+	}
+}
+
+func TestDisableDashboard(t *testing.T) {
+	api, _ := newTestAPIServer(t, Config{DisableDashboard: true})
+	handler := api.server.Handler
+
+	for _, path := range []string{"/", "/static/app.js"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s with dashboard disabled: status = %d, want 404", path, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET /api/status with dashboard disabled: status = %d, want 200", rec.Code)
+	}
+}
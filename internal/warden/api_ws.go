@@ -0,0 +1,390 @@
+package warden
+
+import (
+	"clawrden/internal/events"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// The dashboard's live channel, GET /api/ws. Every message is a JSON object
+// with a "type".
+//
+// From the warden:
+//
+//	{"type":"snapshot","ref":"...","queue":[...]}     The pending queue, on connect and for each sync
+//	{"type":"enqueued","entry":{...}}                  A request started waiting
+//	{"type":"resolved","id":"...","outcome":"..."}     A request left the queue: approved, denied, expired or auto_approved
+//	{"type":"ack","ref":"...","id":"...","ok":true,"outcome":"approved"}  The answer to a resolve
+//
+// From the dashboard:
+//
+//	{"type":"resolve","ref":"...","id":"...","decision":"approve","execution_overrides":{...}}
+//	{"type":"sync","ref":"..."}
+//
+// A resolve that loses a race with another reviewer, or with the request's
+// timeout, is acked with ok false and outcome "not_pending".
+const (
+	wsSendQueue   = 64               // Messages buffered per connection before it counts as too slow
+	wsWriteWait   = 10 * time.Second // Deadline for each write
+	wsPingPeriod  = 30 * time.Second // Default keepalive interval
+	wsMaxMessage  = 64 << 10         // Largest message accepted from a client
+	wsCloseReason = "warden shutting down"
+)
+
+// wsSnapshot carries the whole pending queue.
+type wsSnapshot struct {
+	Type  string       `json:"type"`
+	Ref   string       `json:"ref,omitempty"`
+	Queue []QueueEntry `json:"queue"`
+}
+
+// wsEnqueued announces a new pending request.
+type wsEnqueued struct {
+	Type  string     `json:"type"`
+	Entry QueueEntry `json:"entry"`
+}
+
+// wsResolved announces that a request left the queue.
+type wsResolved struct {
+	Type    string `json:"type"`
+	ID      string `json:"id"`
+	Outcome string `json:"outcome"`
+}
+
+// wsAck answers a client's resolve command.
+type wsAck struct {
+	Type    string `json:"type"`
+	Ref     string `json:"ref,omitempty"`
+	ID      string `json:"id,omitempty"`
+	OK      bool   `json:"ok"`
+	Outcome string `json:"outcome,omitempty"` // approved, denied, approval_recorded or not_pending
+	Error   string `json:"error,omitempty"`
+
+	Remaining int `json:"approvals_remaining,omitempty"` // Approvals still needed after approval_recorded
+}
+
+// wsCommand is a message from the client.
+type wsCommand struct {
+	Type      string              `json:"type"`
+	Ref       string              `json:"ref"`
+	ID        string              `json:"id"`
+	Decision  string              `json:"decision"`
+	Overrides *ExecutionOverrides `json:"execution_overrides"`
+	Message   string              `json:"message_to_requester"`
+}
+
+// wsClient is one dashboard connection.
+type wsClient struct {
+	conn *websocket.Conn
+	send chan any
+
+	// canResolve is false for browser connections that did not prove they
+	// are not cross-site (see csrfExempt); they only watch.
+	canResolve bool
+
+	// reviewer names whoever decides requests on this connection (see
+	// reviewerOf)
+	reviewer string
+
+	// mu orders the snapshot before the events that follow it
+	mu sync.Mutex
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// enqueue queues msg for the writer. A client whose queue is full is
+// disconnected rather than allowed to hold up the others; it resyncs when it
+// reconnects.
+func (c *wsClient) enqueue(msg any) {
+	select {
+	case c.send <- msg:
+	case <-c.done:
+	default:
+		c.close(websocket.CloseTryAgainLater, "too slow")
+	}
+}
+
+// close sends a close frame with code and reason and drops the connection.
+func (c *wsClient) close(code int, reason string) {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+		c.conn.Close()
+	})
+}
+
+// handleWebSocket serves GET /api/ws.
+func (api *APIServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	bus := api.warden.GetEvents()
+	if bus == nil {
+		http.Error(w, "Event bus not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	api.mu.Lock()
+	closing := api.closing
+	api.mu.Unlock()
+	if closing {
+		http.Error(w, "Shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	upgrader := websocket.Upgrader{CheckOrigin: api.wsOriginAllowed}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		if api.debug {
+			api.logger.Printf("api: websocket upgrade from %s failed: %v", r.RemoteAddr, err)
+		}
+		return // The upgrader has answered
+	}
+
+	c := &wsClient{
+		conn:       conn,
+		send:       make(chan any, wsSendQueue),
+		canResolve: !browserOriginated(r) || api.csrfExempt(r),
+		reviewer:   reviewerOf(r),
+		done:       make(chan struct{}),
+	}
+	if !api.trackWebSocket(c, true) {
+		c.close(websocket.CloseGoingAway, wsCloseReason)
+		return
+	}
+	defer api.trackWebSocket(c, false)
+	defer c.close(websocket.CloseNormalClosure, "")
+
+	unsubscribe := bus.Subscribe("websocket", func(e events.Event) {
+		var msg any
+		switch e := e.(type) {
+		case events.HITLEnqueued:
+			p, ok := api.warden.GetHITLQueue().Get(e.ID)
+			if !ok {
+				return // Already resolved; its resolved event follows
+			}
+			msg = wsEnqueued{Type: "enqueued", Entry: newQueueEntry(p)}
+		case events.HITLResolved:
+			msg = wsResolved{Type: "resolved", ID: e.ID, Outcome: wsOutcome(e)}
+		default:
+			return
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.enqueue(msg)
+	}, events.Async(wsSendQueue))
+	defer unsubscribe()
+
+	api.wsSnapshot(c, "")
+	go api.wsWrite(c)
+	api.wsRead(c)
+}
+
+// wsOriginAllowed accepts same-origin and allowed cross-origin browsers, and
+// clients that send no Origin at all.
+func (api *APIServer) wsOriginAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	if api.corsAllowed(origin) {
+		return true
+	}
+	api.logger.Printf("SECURITY: refused websocket from %s: origin %q not allowed", r.RemoteAddr, origin)
+	return false
+}
+
+// trackWebSocket adds or removes c from the connections Shutdown closes. It
+// reports false when the server is already shutting down.
+func (api *APIServer) trackWebSocket(c *wsClient, add bool) bool {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if !add {
+		delete(api.wsClients, c)
+		return true
+	}
+	if api.closing {
+		return false
+	}
+	if api.wsClients == nil {
+		api.wsClients = make(map[*wsClient]struct{})
+	}
+	api.wsClients[c] = struct{}{}
+	return true
+}
+
+// wsSnapshot queues the pending queue for c. Holding c.mu keeps events
+// published meanwhile behind it, so a request resolved after the snapshot
+// was taken is never shown again.
+func (api *APIServer) wsSnapshot(c *wsClient, ref string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pending := api.warden.GetHITLQueue().List()
+	entries := make([]QueueEntry, len(pending))
+	for i, p := range pending {
+		entries[i] = newQueueEntry(p)
+	}
+	c.enqueue(wsSnapshot{Type: "snapshot", Ref: ref, Queue: entries})
+}
+
+// wsWrite sends queued messages and keepalive pings until c closes.
+func (api *APIServer) wsWrite(c *wsClient) {
+	period := api.wsPingPeriod
+	if period == 0 {
+		period = wsPingPeriod
+	}
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case msg := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.conn.WriteJSON(msg); err != nil {
+				c.close(websocket.CloseInternalServerErr, "write failed")
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				c.close(websocket.CloseInternalServerErr, "write failed")
+				return
+			}
+		}
+	}
+}
+
+// wsRead handles the client's commands until it goes away or stops
+// answering pings.
+func (api *APIServer) wsRead(c *wsClient) {
+	period := api.wsPingPeriod
+	if period == 0 {
+		period = wsPingPeriod
+	}
+	pongWait := 2 * period
+	c.conn.SetReadLimit(wsMaxMessage)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+
+		var cmd wsCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			c.enqueue(wsAck{Type: "ack", Error: "invalid message: " + err.Error()})
+			continue
+		}
+		switch cmd.Type {
+		case "sync":
+			api.wsSnapshot(c, cmd.Ref)
+		case "resolve":
+			c.enqueue(api.wsResolve(c, cmd))
+		default:
+			c.enqueue(wsAck{Type: "ack", Ref: cmd.Ref, Error: "unknown message type " + cmd.Type})
+		}
+	}
+}
+
+// wsResolve applies a resolve command the way POST /api/queue/{id}/approve
+// and /deny do.
+func (api *APIServer) wsResolve(c *wsClient, cmd wsCommand) wsAck {
+	ack := wsAck{Type: "ack", Ref: cmd.Ref, ID: cmd.ID}
+	if !c.canResolve {
+		ack.Error = "Cross-site request blocked: connect with the " + CSRFHeader + " header or from the dashboard"
+		return ack
+	}
+
+	var decision Decision
+	var outcome string
+	switch cmd.Decision {
+	case "approve":
+		decision, outcome = DecisionApprove, "approved"
+	case "deny":
+		decision, outcome = DecisionDeny, "denied"
+	default:
+		ack.Error = "decision must be approve or deny"
+		return ack
+	}
+
+	overrides := cmd.Overrides
+	if overrides != nil && (decision != DecisionApprove || *overrides == (ExecutionOverrides{})) {
+		overrides = nil
+	}
+	if overrides != nil {
+		if err := api.warden.currentPolicy().engine.ValidateOverrides(*overrides); err != nil {
+			ack.Error = "Invalid execution overrides: " + err.Error()
+			return ack
+		}
+	}
+
+	message, err := CleanReviewerMessage(cmd.Message)
+	if err != nil {
+		ack.Error = err.Error()
+		return ack
+	}
+
+	remaining, err := api.warden.GetHITLQueue().Review(cmd.ID, Review{
+		Decision: decision, Overrides: overrides, Message: message,
+		Reviewer: c.reviewer, Channel: ChannelDashboard,
+	})
+	switch {
+	case errors.Is(err, errNotPending), errors.Is(err, errAlreadyDecided):
+		ack.Outcome = "not_pending"
+		return ack
+	case err != nil:
+		ack.Error = capitalize(err.Error())
+		return ack
+	case remaining > 0:
+		outcome, ack.Remaining = "approval_recorded", remaining
+	}
+	ack.OK, ack.Outcome = true, outcome
+	return ack
+}
+
+// wsOutcome names how a request left the queue.
+func wsOutcome(e events.HITLResolved) string {
+	switch {
+	case e.Expired:
+		return "expired"
+	case e.Automatic:
+		return "auto_approved"
+	case e.Approved:
+		return "approved"
+	}
+	return "denied"
+}
+
+// closeWebSockets closes every dashboard connection with code and reason
+// and refuses new ones until the API starts again.
+func (api *APIServer) closeWebSockets(code int, reason string) {
+	api.mu.Lock()
+	api.closing = true
+	clients := make([]*wsClient, 0, len(api.wsClients))
+	for c := range api.wsClients {
+		clients = append(clients, c)
+	}
+	api.mu.Unlock()
+
+	for _, c := range clients {
+		c.close(code, reason)
+	}
+}
@@ -0,0 +1,196 @@
+package warden
+
+import (
+	"clawrden/internal/events"
+	"clawrden/pkg/protocol"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newWebSocketTest serves a warden API with an event bus and returns it with
+// its ws:// URL.
+func newWebSocketTest(t *testing.T) (*Server, *APIServer, string) {
+	t.Helper()
+	srv := newTestServer(t)
+	srv.events = events.New(log.New(io.Discard, "", 0))
+	t.Cleanup(srv.events.Close)
+	srv.hitl.events = srv.events
+
+	api := NewAPIServer(srv, "127.0.0.1:0", log.New(io.Discard, "", 0))
+	ts := httptest.NewServer(api.server.Handler)
+	t.Cleanup(ts.Close)
+	return srv, api, "ws" + strings.TrimPrefix(ts.URL, "http") + "/api/ws"
+}
+
+// enqueueTestRequest puts a request in the HITL queue and returns its ID and
+// a channel with its outcome.
+func enqueueTestRequest(t *testing.T, q *HITLQueue, command string) (string, <-chan Outcome) {
+	t.Helper()
+	outcome := make(chan Outcome, 1)
+	go func() { outcome <- q.EnqueueOutcome(context.Background(), &protocol.Request{Command: command}, nil) }()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		for _, p := range q.List() {
+			if p.Request.Command == command {
+				return p.ID, outcome
+			}
+		}
+	}
+	t.Fatalf("%s never reached the queue", command)
+	return "", nil
+}
+
+// readWS reads messages until one has the given type (and ref, if set).
+func readWS(t *testing.T, conn *websocket.Conn, typ, ref string) map[string]any {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var msg map[string]any
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("waiting for %s: %v", typ, err)
+		}
+		if msg["type"] == typ && (ref == "" || msg["ref"] == ref) {
+			return msg
+		}
+	}
+}
+
+func TestWebSocketQueue(t *testing.T) {
+	srv, api, url := newWebSocketTest(t)
+	api.wsPingPeriod = 20 * time.Millisecond
+	first, firstOutcome := enqueueTestRequest(t, srv.hitl, "first")
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	var pings atomic.Int32
+	conn.SetPingHandler(func(data string) error {
+		pings.Add(1)
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+
+	snapshot := readWS(t, conn, "snapshot", "")
+	if queue := snapshot["queue"].([]any); len(queue) != 1 || queue[0].(map[string]any)["id"] != first {
+		t.Errorf("snapshot = %v, want %s", snapshot, first)
+	}
+
+	second, secondOutcome := enqueueTestRequest(t, srv.hitl, "second")
+	defer srv.hitl.Resolve(second, DecisionDeny)
+	if entry := readWS(t, conn, "enqueued", "")["entry"].(map[string]any); entry["id"] != second || entry["command"] != "second" {
+		t.Errorf("enqueued entry = %v, want %s", entry, second)
+	}
+
+	conn.WriteJSON(map[string]string{"type": "resolve", "ref": "1", "id": first, "decision": "approve"})
+	if ack := readWS(t, conn, "ack", "1"); ack["ok"] != true || ack["outcome"] != "approved" || ack["id"] != first {
+		t.Errorf("ack = %v", ack)
+	}
+	if o := <-firstOutcome; o.Decision != DecisionApprove {
+		t.Errorf("decision = %v, want approve", o.Decision)
+	}
+
+	// A resolve that lost the race is refused, not applied twice
+	conn.WriteJSON(map[string]string{"type": "resolve", "ref": "2", "id": first, "decision": "deny"})
+	if ack := readWS(t, conn, "ack", "2"); ack["ok"] != false || ack["outcome"] != "not_pending" {
+		t.Errorf("second ack = %v", ack)
+	}
+
+	// Decisions made elsewhere are pushed
+	srv.hitl.Resolve(second, DecisionDeny)
+	<-secondOutcome
+	msg := readWS(t, conn, "resolved", "")
+	if msg["id"] == first {
+		msg = readWS(t, conn, "resolved", "")
+	}
+	if msg["id"] != second || msg["outcome"] != "denied" {
+		t.Errorf("resolved = %v, want %s denied", msg, second)
+	}
+
+	conn.WriteJSON(map[string]string{"type": "sync", "ref": "s"})
+	if queue := readWS(t, conn, "snapshot", "s")["queue"].([]any); len(queue) != 0 {
+		t.Errorf("resynced queue = %v, want empty", queue)
+	}
+	conn.WriteJSON(map[string]string{"type": "resolve", "ref": "3", "id": "x", "decision": "maybe"})
+	if ack := readWS(t, conn, "ack", "3"); ack["error"] != "decision must be approve or deny" {
+		t.Errorf("bad decision ack = %v", ack)
+	}
+
+	// Pings are handled while reading
+	for deadline := time.Now().Add(5 * time.Second); pings.Load() == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("no keepalive pings")
+		}
+		conn.WriteJSON(map[string]string{"type": "sync", "ref": "ping"})
+		readWS(t, conn, "snapshot", "ping")
+	}
+}
+
+func TestWebSocketOrigins(t *testing.T) {
+	srv, api, url := newWebSocketTest(t)
+	api.allowedOrigins = []string{"https://ops.example.com"}
+	id, _ := enqueueTestRequest(t, srv.hitl, "rm")
+	defer srv.hitl.Resolve(id, DecisionDeny)
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://evil.example"}})
+	if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("cross-site dial: %v, %v; want 403", err, resp)
+	}
+
+	// An allowed browser without the dashboard cookie may watch, not decide
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://ops.example.com"}})
+	if err != nil {
+		t.Fatalf("dial from an allowed origin: %v", err)
+	}
+	defer conn.Close()
+	readWS(t, conn, "snapshot", "")
+	conn.WriteJSON(map[string]string{"type": "resolve", "ref": "1", "id": id, "decision": "approve"})
+	if ack := readWS(t, conn, "ack", "1"); ack["ok"] != false || !strings.Contains(ack["error"].(string), "Cross-site") {
+		t.Errorf("ack = %v", ack)
+	}
+	if !srv.hitl.IsPending(id) {
+		t.Error("read-only connection resolved a request")
+	}
+
+	cookie := &http.Cookie{Name: csrfCookie, Value: api.signCSRFNonce([]byte("nonce"))}
+	conn2, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://ops.example.com"}, "Cookie": {cookie.String()}})
+	if err != nil {
+		t.Fatalf("dial with the dashboard cookie: %v", err)
+	}
+	defer conn2.Close()
+	conn2.WriteJSON(map[string]string{"type": "resolve", "ref": "1", "id": id, "decision": "deny"})
+	if ack := readWS(t, conn2, "ack", "1"); ack["ok"] != true {
+		t.Errorf("ack with the dashboard cookie = %v", ack)
+	}
+}
+
+func TestWebSocketShutdown(t *testing.T) {
+	_, api, url := newWebSocketTest(t)
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	readWS(t, conn, "snapshot", "")
+
+	api.Stop()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err = conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseGoingAway {
+		t.Errorf("read after shutdown: %v, want going away", err)
+	}
+
+	if _, resp, err := websocket.DefaultDialer.Dial(url, nil); err == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("dial after shutdown: %v, want 503", err)
+	}
+}
@@ -0,0 +1,188 @@
+package warden
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// approvalLinkCommand is the pseudo-command recorded in the audit log for
+// approval link uses.
+const approvalLinkCommand = "clawrden-approval-link"
+
+// defaultApprovalLinkTTL is used when Config.ApprovalLinkTTL is zero.
+const defaultApprovalLinkTTL = 15 * time.Minute
+
+// minApprovalLinkKeyLen is the shortest signing key accepted, in bytes.
+const minApprovalLinkKeyLen = 32
+
+// Errors returned by LinkSigner.Consume.
+var (
+	ErrLinkMalformed = errors.New("malformed approval link token")
+	ErrLinkSignature = errors.New("invalid approval link signature")
+	ErrLinkExpired   = errors.New("approval link has expired")
+	ErrLinkMismatch  = errors.New("approval link is for a different request or action")
+	ErrLinkUsed      = errors.New("approval link has already been used")
+)
+
+// LinkClaims is the signed content of an approval link token.
+type LinkClaims struct {
+	RequestID string `json:"id"`
+	Action    string `json:"act"` // "approve" or "deny"
+	ExpiresAt int64  `json:"exp"` // Unix seconds
+	IssuedTo  string `json:"to,omitempty"`
+	Nonce     string `json:"n"`
+}
+
+// LinkSigner issues and consumes HMAC-signed, single-use approval link
+// tokens. Used tokens are remembered in memory until they expire, so a
+// warden restart forgets them; keep the TTL short.
+//
+// Tokens carry their wall-clock expiry, but the signer also remembers a
+// monotonic deadline for each token it issued and goes by that, so stepping
+// the clock neither expires links early nor keeps them alive. Only tokens
+// issued before a restart fall back to the wall clock.
+type LinkSigner struct {
+	key  []byte
+	ttl  time.Duration
+	now  func() time.Time
+	mono func() time.Duration
+
+	mu     sync.Mutex
+	issued map[string]issuedLink    // Nonce -> deadlines of issued tokens
+	used   map[string]time.Duration // Signature -> monotonic deadline of consumed tokens
+}
+
+// issuedLink is when an issued token expires, by both clocks. It is
+// remembered until both have passed, so that a wall clock stepped back
+// cannot revive a token through the restart fallback.
+type issuedLink struct {
+	deadline time.Duration // Monotonic
+	expires  int64         // Unix seconds, as signed
+}
+
+// NewLinkSigner creates a signer with the given key and token lifetime
+// (default: 15m).
+func NewLinkSigner(key []byte, ttl time.Duration) (*LinkSigner, error) {
+	if len(key) < minApprovalLinkKeyLen {
+		return nil, fmt.Errorf("approval link key must be at least %d bytes, got %d", minApprovalLinkKeyLen, len(key))
+	}
+	if ttl <= 0 {
+		ttl = defaultApprovalLinkTTL
+	}
+	return &LinkSigner{
+		key:    key,
+		ttl:    ttl,
+		now:    time.Now,
+		mono:   monotonicNow,
+		issued: make(map[string]issuedLink),
+		used:   make(map[string]time.Duration),
+	}, nil
+}
+
+// Issue returns a token that performs action on request id once, until the
+// signer's TTL passes. issuedTo labels who the link was sent to (e.g.
+// "slack:#approvals") and is recorded in the audit log when it is used.
+func (s *LinkSigner) Issue(id, action, issuedTo string) (string, time.Time, error) {
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", time.Time{}, fmt.Errorf("generate nonce: %w", err)
+	}
+	expires := s.now().Add(s.ttl).Truncate(time.Second)
+	claims := LinkClaims{
+		RequestID: id,
+		Action:    action,
+		ExpiresAt: expires.Unix(),
+		IssuedTo:  issuedTo,
+		Nonce:     hex.EncodeToString(nonce),
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	s.mu.Lock()
+	s.pruneLocked()
+	s.issued[claims.Nonce] = issuedLink{deadline: s.mono() + s.ttl, expires: claims.ExpiresAt}
+	s.mu.Unlock()
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(s.sign(payload)), expires, nil
+}
+
+// Consume validates a token for request id and action and marks it used.
+// The claims are returned whenever the signature is valid, even if the token
+// is rejected for another reason, so that the rejection can be audited.
+func (s *LinkSigner) Consume(token, id, action string) (*LinkClaims, error) {
+	encPayload, encSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrLinkMalformed
+	}
+	enc := base64.RawURLEncoding
+	payload, err := enc.DecodeString(encPayload)
+	if err != nil {
+		return nil, ErrLinkMalformed
+	}
+	sig, err := enc.DecodeString(encSig)
+	if err != nil {
+		return nil, ErrLinkMalformed
+	}
+	if !hmac.Equal(sig, s.sign(payload)) {
+		return nil, ErrLinkSignature
+	}
+
+	var claims LinkClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrLinkMalformed
+	}
+	if claims.RequestID != id || claims.Action != action {
+		return &claims, ErrLinkMismatch
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked()
+	// A token issued before a restart only has its signed expiry to go by
+	deadline := s.mono() + time.Unix(claims.ExpiresAt, 0).Sub(s.now())
+	if link, ok := s.issued[claims.Nonce]; ok {
+		deadline = link.deadline
+	}
+	if s.mono() >= deadline {
+		return &claims, ErrLinkExpired
+	}
+
+	key := string(sig)
+	if _, used := s.used[key]; used {
+		return &claims, ErrLinkUsed
+	}
+	s.used[key] = deadline
+	return &claims, nil
+}
+
+// pruneLocked forgets expired tokens, which are rejected before being
+// looked up. s.mu must be held.
+func (s *LinkSigner) pruneLocked() {
+	now, wall := s.mono(), s.now().Unix()
+	for k, link := range s.issued {
+		if now >= link.deadline && wall >= link.expires {
+			delete(s.issued, k)
+		}
+	}
+	for k, deadline := range s.used {
+		if now >= deadline {
+			delete(s.used, k)
+		}
+	}
+}
+
+func (s *LinkSigner) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
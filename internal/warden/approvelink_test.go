@@ -0,0 +1,269 @@
+package warden
+
+import (
+	"clawrden/pkg/protocol"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testLinkKey = []byte("0123456789abcdef0123456789abcdef")
+
+func newTestLinkSigner(t *testing.T) (*LinkSigner, *fakeClock) {
+	t.Helper()
+	s, err := NewLinkSigner(testLinkKey, 10*time.Minute)
+	if err != nil {
+		t.Fatalf("NewLinkSigner: %v", err)
+	}
+	clock := &fakeClock{t: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	s.now, s.mono = clock.Now, clock.Mono
+	return s, clock
+}
+
+func TestLinkSignerRejectsShortKey(t *testing.T) {
+	if _, err := NewLinkSigner([]byte("short"), 0); err == nil {
+		t.Error("NewLinkSigner accepted a 5-byte key")
+	}
+}
+
+func TestLinkSignerConsume(t *testing.T) {
+	tamper := func(token string) string {
+		payload, sig, _ := strings.Cut(token, ".")
+		data, _ := base64.RawURLEncoding.DecodeString(payload)
+		data = []byte(strings.Replace(string(data), `"act":"deny"`, `"act":"approve"`, 1))
+		return base64.RawURLEncoding.EncodeToString(data) + "." + sig
+	}
+
+	tests := []struct {
+		name    string
+		issue   string // Action the token is issued for
+		mangle  func(string) string
+		advance time.Duration
+		action  string
+		id      string
+		want    error
+	}{
+		{name: "valid", issue: "approve", action: "approve", id: "req-1"},
+		{name: "expired", issue: "approve", advance: 10 * time.Minute, action: "approve", id: "req-1", want: ErrLinkExpired},
+		{name: "wrong action", issue: "deny", action: "approve", id: "req-1", want: ErrLinkMismatch},
+		{name: "wrong request", issue: "approve", action: "approve", id: "req-2", want: ErrLinkMismatch},
+		{name: "tampered payload", issue: "deny", mangle: tamper, action: "approve", id: "req-1", want: ErrLinkSignature},
+		{name: "truncated signature", issue: "approve", mangle: func(s string) string { return s[:len(s)-4] }, action: "approve", id: "req-1", want: ErrLinkSignature},
+		{name: "no signature", issue: "approve", mangle: func(s string) string { p, _, _ := strings.Cut(s, "."); return p }, action: "approve", id: "req-1", want: ErrLinkMalformed},
+		{name: "empty", issue: "approve", mangle: func(string) string { return "" }, action: "approve", id: "req-1", want: ErrLinkMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, clock := newTestLinkSigner(t)
+			token, expires, err := s.Issue("req-1", tt.issue, "slack:#ops")
+			if err != nil {
+				t.Fatalf("Issue: %v", err)
+			}
+			if want := clock.Now().Add(10 * time.Minute); !expires.Equal(want) {
+				t.Errorf("expires = %v, want %v", expires, want)
+			}
+			if tt.mangle != nil {
+				token = tt.mangle(token)
+			}
+			clock.Advance(tt.advance)
+
+			claims, err := s.Consume(token, tt.id, tt.action)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Consume() error = %v, want %v", err, tt.want)
+			}
+			if err == nil && claims.IssuedTo != "slack:#ops" {
+				t.Errorf("IssuedTo = %q", claims.IssuedTo)
+			}
+		})
+	}
+}
+
+func TestLinkSignerSingleUse(t *testing.T) {
+	s, clock := newTestLinkSigner(t)
+	token, _, _ := s.Issue("req-1", "approve", "")
+	other, _, _ := s.Issue("req-1", "approve", "")
+
+	if _, err := s.Consume(token, "req-1", "approve"); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if _, err := s.Consume(token, "req-1", "approve"); !errors.Is(err, ErrLinkUsed) {
+		t.Errorf("reuse error = %v, want ErrLinkUsed", err)
+	}
+	// Each issued token is distinct and independently usable
+	if _, err := s.Consume(other, "req-1", "approve"); err != nil {
+		t.Errorf("second token: %v", err)
+	}
+
+	// Used tokens are forgotten once expired; they stay rejected as expired
+	clock.Advance(11 * time.Minute)
+	if _, err := s.Consume(token, "req-1", "approve"); !errors.Is(err, ErrLinkExpired) {
+		t.Errorf("after expiry error = %v, want ErrLinkExpired", err)
+	}
+	fresh, _, _ := s.Issue("req-1", "deny", "")
+	s.Consume(fresh, "req-1", "deny")
+	if len(s.used) != 1 {
+		t.Errorf("used set has %d entries, want 1 after pruning", len(s.used))
+	}
+}
+
+func TestLinkSignerIgnoresClockSteps(t *testing.T) {
+	s, clock := newTestLinkSigner(t)
+	early, _, _ := s.Issue("req-1", "approve", "")
+	clock.Step(time.Hour)
+	if _, err := s.Consume(early, "req-1", "approve"); err != nil {
+		t.Errorf("after a step forward: %v, want the link still valid", err)
+	}
+
+	late, _, _ := s.Issue("req-1", "deny", "")
+	clock.Step(-2 * time.Hour)
+	clock.Advance(10 * time.Minute)
+	if _, err := s.Consume(late, "req-1", "deny"); !errors.Is(err, ErrLinkExpired) {
+		t.Errorf("after a step back and the TTL: %v, want ErrLinkExpired", err)
+	}
+
+	// A signer that did not issue the token, as after a restart, has only
+	// the signed expiry to go by
+	restarted, _ := newTestLinkSigner(t)
+	restarted.now = clock.Now
+	fresh, _, _ := s.Issue("req-1", "approve", "")
+	if _, err := restarted.Consume(fresh, "req-1", "approve"); err != nil {
+		t.Errorf("token from before a restart: %v", err)
+	}
+	clock.Advance(10 * time.Minute)
+	fresh, _, _ = s.Issue("req-2", "approve", "")
+	clock.Advance(10 * time.Minute)
+	if _, err := restarted.Consume(fresh, "req-2", "approve"); !errors.Is(err, ErrLinkExpired) {
+		t.Errorf("expired token from before a restart: %v, want ErrLinkExpired", err)
+	}
+}
+
+func TestApprovalLinkAPI(t *testing.T) {
+	api, _ := newTestAPIServer(t, Config{})
+	srv := api.warden
+	srv.links, _ = newTestLinkSigner(t)
+	srv.links.now, srv.links.mono = time.Now, monotonicNow
+	srv.config.AuditPath = filepath.Join(t.TempDir(), "audit.log")
+	audit, err := NewAuditLogger(srv.config.AuditPath)
+	if err != nil {
+		t.Fatalf("NewAuditLogger: %v", err)
+	}
+	t.Cleanup(func() { audit.Close() })
+	srv.audit = audit
+	handler := api.server.Handler
+
+	outcome := make(chan Outcome, 1)
+	go func() {
+		outcome <- srv.hitl.EnqueueOutcome(context.Background(), &protocol.Request{Command: "rm"}, nil)
+	}()
+	var id string
+	for i := 0; i < 100 && id == ""; i++ {
+		if pending := srv.hitl.List(); len(pending) > 0 {
+			id = pending[0].ID
+		} else {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if id == "" {
+		t.Fatal("request never became pending")
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/queue/"+id+"/links", strings.NewReader(`{"issued_to":"telegram:alice"}`))
+	req.Host = "warden.example:8080"
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("mint status = %d: %s", rec.Code, rec.Body.String())
+	}
+	var links struct {
+		Approve string `json:"approve"`
+		Deny    string `json:"deny"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&links); err != nil {
+		t.Fatalf("decode links: %v", err)
+	}
+	if !strings.HasPrefix(links.Approve, "http://warden.example:8080/api/queue/"+id+"/approve?token=") {
+		t.Errorf("approve link = %q", links.Approve)
+	}
+
+	open := func(link string) *httptest.ResponseRecorder {
+		u, err := url.Parse(link)
+		if err != nil {
+			t.Fatalf("parse %q: %v", link, err)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, u.RequestURI(), nil))
+		return rec
+	}
+
+	// A deny token cannot be replayed against the approve route
+	tampered := strings.Replace(links.Deny, "/deny?", "/approve?", 1)
+	if rec := open(tampered); rec.Code != http.StatusForbidden {
+		t.Errorf("wrong-action link status = %d, want 403", rec.Code)
+	}
+
+	rec = open(links.Approve)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Request approved") {
+		t.Fatalf("approve link: status %d, body %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("Cache-Control = %q", rec.Header().Get("Cache-Control"))
+	}
+	select {
+	case o := <-outcome:
+		if o.Decision != DecisionApprove {
+			t.Errorf("decision = %v, want approve", o.Decision)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("request was not resolved")
+	}
+
+	if rec := open(links.Approve); rec.Code != http.StatusGone {
+		t.Errorf("reused link status = %d, want 410", rec.Code)
+	}
+	if rec := open(links.Deny); rec.Code != http.StatusConflict {
+		t.Errorf("link for decided request status = %d, want 409", rec.Code)
+	}
+
+	entries, err := ReadAuditLog(srv.config.AuditPath)
+	if err != nil {
+		t.Fatalf("ReadAuditLog: %v", err)
+	}
+	var decisions []string
+	for _, e := range entries {
+		if e.Command != approvalLinkCommand || e.RequestID != id {
+			t.Errorf("unexpected audit entry %+v", e)
+		}
+		decisions = append(decisions, e.DecisionLabel())
+	}
+	if got := strings.Join(decisions, ","); got != "rejected,approve,rejected,rejected" {
+		t.Errorf("audit decisions = %s", got)
+	}
+	if entries[1].IssuedTo != "telegram:alice" || entries[0].IssuedTo != "telegram:alice" {
+		t.Errorf("IssuedTo = %q / %q, want telegram:alice", entries[0].IssuedTo, entries[1].IssuedTo)
+	}
+}
+
+func TestApprovalLinksDisabled(t *testing.T) {
+	api, _ := newTestAPIServer(t, Config{})
+	handler := api.server.Handler
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/queue/req-1/links", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("mint status = %d, want 503", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/queue/req-1/approve?token=x", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("link status = %d, want 404", rec.Code)
+	}
+}
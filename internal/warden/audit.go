@@ -2,10 +2,15 @@
 package warden
 
 import (
+	"bytes"
+	"clawrden/internal/events"
+	"clawrden/internal/executor"
+	"clawrden/internal/jailhouse"
 	"clawrden/pkg/protocol"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"sync"
 	"time"
@@ -13,23 +18,302 @@ import (
 
 // AuditEntry represents a single command execution record.
 type AuditEntry struct {
-	Timestamp        string            `json:"timestamp"`
-	Command          string            `json:"command"`
-	Args             []string          `json:"args"`
-	Cwd              string            `json:"cwd"`
-	Identity         protocol.Identity `json:"identity"`
-	ContainerID      string            `json:"container_id,omitempty"`
-	Decision         string            `json:"decision"` // "allow", "deny", "ask"
-	ExitCode         int               `json:"exit_code,omitempty"`
-	Duration         float64           `json:"duration_ms,omitempty"`
-	TimeoutViolation bool              `json:"timeout_violation,omitempty"`
-	Error            string            `json:"error,omitempty"`
+	Seq              uint64               `json:"seq"` // Increases by one per entry, across restarts; order by it rather than timestamp
+	Timestamp        string               `json:"timestamp"`
+	RequestID        string               `json:"request_id,omitempty"` // HITL queue ID for reviewed requests, a fresh ID otherwise
+	Command          string               `json:"command"`
+	Args             []string             `json:"args"`
+	Cwd              string               `json:"cwd"`
+	Identity         protocol.Identity    `json:"identity"`
+	IdentitySource   string               `json:"identity_source,omitempty"` // Whether the kernel vouched for Identity and ContainerID: "peercred" or "self_reported"
+	GroupNames       []string             `json:"group_names,omitempty"`
+	ContainerID      string               `json:"container_id,omitempty"`
+	Image            string               `json:"image,omitempty"`
+	ImageDigest      string               `json:"image_digest,omitempty"`
+	JailID           string               `json:"jail_id,omitempty"` // Jail the shim ran from, whose rules were evaluated first
+	TaskID           string               `json:"task_id,omitempty"` // Caller's correlation IDs (CLAWRDEN_TASK_ID, CLAWRDEN_RUN_ID)
+	RunID            string               `json:"run_id,omitempty"`
+	Session          *SessionInfo         `json:"session,omitempty"`     // Terminal and login session the shim reported
+	Decision         protocol.Decision    `json:"decision"`              // What was done, e.g. "deny"
+	Outcome          protocol.Outcome     `json:"outcome,omitempty"`     // Why, unless the policy decided alone, e.g. "after_hitl"
+	Detail           string               `json:"detail,omitempty"`      // Free-text context, e.g. "jail create" for an event
+	Rule             string               `json:"rule,omitempty"`        // Rule that decided, e.g. "rule 3 (pip)"; empty for default_action
+	Reason           string               `json:"reason,omitempty"`      // The deciding rule's reason
+	PolicyHash       string               `json:"policy_hash,omitempty"` // SHA-256 of the policy file in force
+	ExitCode         int                  `json:"exit_code,omitempty"`
+	Duration         float64              `json:"duration_ms,omitempty"`
+	TimeoutViolation bool                 `json:"timeout_violation,omitempty"`
+	TimeoutLimit     string               `json:"timeout_limit,omitempty"` // Limit that fired: "exec", "hitl" or "total"
+	Delivery         string               `json:"delivery,omitempty"`      // "complete", "partial", "failed"
+	BytesStdout      int64                `json:"bytes_stdout,omitempty"`
+	BytesStderr      int64                `json:"bytes_stderr,omitempty"`
+	Env              *EnvReport           `json:"env,omitempty"`
+	URLHosts         []string             `json:"url_hosts,omitempty"`   // Hosts of URL arguments, for rules with url_allow/url_deny
+	Subcommands      []SubcommandDecision `json:"subcommands,omitempty"` // Per-command decisions for shell scripts
+	Sandbox          *SandboxRecord       `json:"sandbox,omitempty"`
+	Strategy         string               `json:"strategy,omitempty"`            // Where the command ran: mirror, ghost or local
+	IssuedTo         string               `json:"issued_to,omitempty"`           // Recipient label of the approval link used
+	Risk             RiskTier             `json:"risk,omitempty"`                // Risk tier of an ask
+	Resolution       string               `json:"resolution,omitempty"`          // Who decided an ask: "human", "automatic" or "expired"
+	Reviewer         string               `json:"reviewer,omitempty"`            // Who made a human decision, when known (e.g. "console", "alice@build-01")
+	ReviewerMessage  string               `json:"reviewer_message,omitempty"`    // What the reviewer told the agent, like "run the tests afterwards"
+	Approvals        []Approval           `json:"approvals,omitempty"`           // Each reviewer's approval of an ask that needed several
+	WaitMs           int64                `json:"wait_ms,omitempty"`             // How long an ask waited for its resolution
+	FirstViewedMs    *int64               `json:"first_viewed_ms,omitempty"`     // How long until a reviewer first saw it; absent if nobody did
+	ClockSkew        bool                 `json:"clock_skew_detected,omitempty"` // The wall clock was stepped: backwards since the previous entry, or during the wait
+	Overrides        *ExecutionOverrides  `json:"reviewer_overrides,omitempty"`  // How the reviewer changed the execution
+	Transcript       string               `json:"transcript,omitempty"`          // Path of the saved conversation transcript
+	ShimStall        string               `json:"shim_stall,omitempty"`          // The shim stopped reading output: "killed" or "spooled"
+	OutputSpool      string               `json:"output_spool,omitempty"`        // Where the output it did not read was saved
+	Error            string               `json:"error,omitempty"`
+
+	// An allowed command is audited twice, linked by the request ID: a
+	// started entry before it runs and a finished one once it ends. Readers
+	// show only the finished entry, or the started one with Completed set
+	// if the command never finished
+	Phase     string `json:"phase,omitempty"`     // "started" or "finished"
+	Completed string `json:"completed,omitempty"` // "unknown" on a started entry without a finished one; "running" in the API while it runs
+
+	// Who edited the policy through the API, and what they changed
+	Actor      string      `json:"actor,omitempty"`
+	PolicyEdit *PolicyEdit `json:"policy_edit,omitempty"`
+
+	// What a jail update, prune or deletion changed in the jailhouse
+	JailChange *jailhouse.JailChange `json:"jail_change,omitempty"`
+
+	// What a ghost command with track_changes changed in its workspace
+	Changes *executor.ChangeSummary `json:"changes,omitempty"`
+
+	// The workspace files given back to the requester after a ghost command
+	OwnershipFix *executor.OwnershipFixed `json:"ownership_fix,omitempty"`
+
+	// A command's entry lists the request IDs of its pre and post hooks;
+	// each hook's own entry names its stage and the command's request ID
+	Hooks  []string `json:"hooks,omitempty"`
+	Hook   string   `json:"hook,omitempty"` // "pre" or "post"
+	HookOf string   `json:"hook_of,omitempty"`
+
+	// The scheduling priority the command ran with, when its rule lowered it
+	Priority *executor.AppliedPriority `json:"priority,omitempty"`
+
+	// Each run of a command retried after a transient failure
+	Attempts []ExecAttempt `json:"attempts,omitempty"`
+
+	// The matched rule asks the shim for its trailer line; not audited,
+	// only passed on in the request's metadata
+	trailer bool
+
+	// The action of the rule that decided the request, or of default_action;
+	// not audited, only counted in the rule metrics (see RuleStats)
+	action Action
+
+	// The request is part of a persistent session, which goes on once it
+	// ends; not audited, only passed on in the request's metadata
+	session bool
+}
+
+// DecisionLabel returns the entry's decision as people read it, e.g.
+// "deny (after HITL)" or "jail create".
+func (e *AuditEntry) DecisionLabel() string {
+	return protocol.FormatDecision(e.Decision, e.Outcome, e.Detail)
+}
+
+// Validate reports whether the entry's decision, outcome and detail fit
+// together: a valid decision, an outcome only where a request was allowed,
+// denied or rejected, and a detail on every event.
+func (e *AuditEntry) Validate() error {
+	switch {
+	case !e.Decision.Valid():
+		return fmt.Errorf("invalid decision %v", e.Decision)
+	case !e.Outcome.Valid():
+		return fmt.Errorf("invalid outcome %v", e.Outcome)
+	case e.Outcome != protocol.OutcomeNone && e.Decision != protocol.DecisionAllow &&
+		e.Decision != protocol.DecisionDeny && e.Decision != protocol.DecisionRejected:
+		return fmt.Errorf("outcome %v on a decision of %v", e.Outcome, e.Decision)
+	case e.Decision == protocol.DecisionEvent && e.Detail == "":
+		return fmt.Errorf("event without a detail")
+	}
+	return nil
+}
+
+// unmarshalAuditEntry decodes a line of the audit log. Lines written before
+// outcomes were split out have decisions such as "deny (after HITL)" or
+// "jail create"; they are read as the decision, outcome and detail a
+// current entry would have.
+func unmarshalAuditEntry(line []byte, entry *AuditEntry) error {
+	var raw struct {
+		*AuditEntry
+		Decision string `json:"decision"` // Shadows the entry's
+	}
+	raw.AuditEntry = entry
+	if err := json.Unmarshal(line, &raw); err != nil {
+		return err
+	}
+	decision, outcome, detail := protocol.ParseLegacyDecision(raw.Decision)
+	entry.Decision = decision
+	if outcome != protocol.OutcomeNone {
+		entry.Outcome = outcome
+	}
+	if entry.Detail == "" {
+		entry.Detail = detail
+	}
+	return nil
+}
+
+// SessionInfo is a request's session as the audit log and queue API show
+// it. The shim reports it and nothing verifies it, which SelfReported
+// spells out for API clients: it helps people tell users of a shared
+// machine apart, but is no identity.
+type SessionInfo struct {
+	protocol.Session
+	SelfReported bool `json:"self_reported"`
+}
+
+// reportedSession wraps a request's sanitized session; nil when it has none.
+func reportedSession(s *protocol.Session) *SessionInfo {
+	if s == nil {
+		return nil
+	}
+	return &SessionInfo{Session: *s, SelfReported: true}
+}
+
+// Time limits an AuditEntry's TimeoutLimit can name.
+const (
+	TimeoutLimitExec  = "exec"
+	TimeoutLimitHITL  = "hitl"
+	TimeoutLimitTotal = "total"
+)
+
+// How an ask was resolved, for an AuditEntry's Resolution.
+const (
+	ResolutionHuman     = "human"     // A reviewer approved or denied it
+	ResolutionAutomatic = "automatic" // A low-risk ask's timer approved it
+	ResolutionExpired   = "expired"   // Nobody decided in time
+)
+
+// Phases of an allowed command's audit entries.
+const (
+	PhaseStarted  = "started"
+	PhaseFinished = "finished"
+)
+
+// What readers set as the Completed of a started entry that has no
+// finished entry.
+const (
+	CompletionUnknown = "unknown" // The warden stopped or crashed while the command ran
+	CompletionRunning = "running" // The command is still running
+)
+
+// Audited is published on the event bus with each finished request's
+// audit entry. The AuditLogger subscribes to it.
+type Audited struct {
+	Entry AuditEntry
+}
+
+func (Audited) Name() string { return "audited" }
+
+// AuditFailureMode is what the warden does while audit entries cannot be
+// written.
+type AuditFailureMode string
+
+const (
+	// AuditFailLog drops entries that cannot be written, counting and
+	// logging the failures. Requests keep running, except for allowed
+	// commands whose started entry cannot be written.
+	AuditFailLog AuditFailureMode = "log"
+
+	// AuditFailBlock holds entries like AuditFailBuffer and denies new
+	// requests until writes succeed again.
+	AuditFailBlock AuditFailureMode = "block"
+
+	// AuditFailBuffer holds up to the buffer size of entries in memory and
+	// writes them once the log is writable again, dropping the oldest when
+	// full. Requests keep running, as with AuditFailLog.
+	AuditFailBuffer AuditFailureMode = "buffer"
+)
+
+// AuditSyncPolicy is when written audit entries are flushed to disk.
+type AuditSyncPolicy string
+
+const (
+	// AuditSyncNone leaves flushing to the operating system. Entries
+	// written shortly before a power loss or kernel crash may be lost.
+	AuditSyncNone AuditSyncPolicy = "none"
+
+	// AuditSyncAlways fsyncs the log after every entry, before the request
+	// it records goes on. Safer, but each entry waits for the disk.
+	AuditSyncAlways AuditSyncPolicy = "always"
+
+	// AuditSyncStarted fsyncs the log after the started entry of each
+	// allowed command, before the command runs, so that no command runs
+	// unrecorded. Other entries are left to the operating system.
+	AuditSyncStarted AuditSyncPolicy = "started"
+)
+
+// Valid reports whether p is a known sync policy.
+func (p AuditSyncPolicy) Valid() bool {
+	return p == AuditSyncNone || p == AuditSyncAlways || p == AuditSyncStarted
+}
+
+// auditIntegrityInterval is how long an integrity scan of the log is reused.
+const auditIntegrityInterval = time.Minute
+
+// DefaultAuditBufferSize is how many entries the buffer and block modes
+// hold by default.
+const DefaultAuditBufferSize = 1000
+
+// auditFailureReport is how often ongoing write failures are logged again.
+const auditFailureReport = time.Minute
+
+// Valid reports whether m is a known failure mode.
+func (m AuditFailureMode) Valid() bool {
+	switch m {
+	case AuditFailLog, AuditFailBlock, AuditFailBuffer:
+		return true
+	}
+	return false
+}
+
+// AuditHealth is the state of the audit log writer.
+type AuditHealth struct {
+	Mode     AuditFailureMode `json:"mode"`
+	Healthy  bool             `json:"healthy"`
+	Since    time.Time        `json:"since,omitzero"`     // When writes started failing
+	Failures int64            `json:"failures"`           // Failed writes since startup
+	Buffered int              `json:"buffered,omitempty"` // Entries waiting to be written
+	Dropped  int64            `json:"dropped,omitempty"`  // Entries lost since startup
+	Error    string           `json:"error,omitempty"`    // Last write error while unhealthy
 }
 
 // AuditLogger writes structured audit logs in JSON-lines format.
 type AuditLogger struct {
 	writer io.WriteCloser
 	mu     sync.Mutex
+
+	mode      AuditFailureMode
+	bufferMax int
+	logger    *log.Logger
+
+	pending    [][]byte // Entries held until the log is writable
+	failures   int64
+	dropped    int64
+	lastErr    error // Set while writes fail
+	since      time.Time
+	lastReport time.Time
+	lost       int64 // Entries dropped since the last report
+
+	seq  uint64    // Seq of the last entry
+	last time.Time // Timestamp of the last entry the logger stamped
+	now  func() time.Time
+
+	sync AuditSyncPolicy
+
+	running map[string]bool // Request IDs with a started entry and no finished one yet
+
+	path        string
+	integrity   *AuditParseReport // Last integrity scan
+	integrityAt time.Time
+	corrupt     int // Corrupt lines last logged about
 }
 
 // NewAuditLogger creates a new audit logger writing to the specified file.
@@ -52,7 +336,58 @@ func NewAuditLogger(path string) (*AuditLogger, error) {
 		return nil, fmt.Errorf("open audit log: %w", err)
 	}
 
-	return &AuditLogger{writer: file}, nil
+	seq, torn, err := lastAuditSeq(file.Name())
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	// End a line torn by a crash mid-write, so that it doesn't swallow the
+	// next entry; readers then report it as one corrupt line
+	if torn {
+		if _, err := file.Write([]byte("\n")); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("terminate torn audit log line: %w", err)
+		}
+	}
+	return &AuditLogger{writer: file, seq: seq, path: path}, nil
+}
+
+// auditTailSize is how much of the end of an existing audit log is read to
+// find the last entry's Seq; entries are far shorter.
+const auditTailSize = 64 << 10
+
+// lastAuditSeq returns the Seq of the last entry in the audit log at path,
+// so that numbering continues across restarts, and whether the log ends in
+// an unterminated line. Logs written before entries were numbered, and
+// empty logs, start from 0.
+func lastAuditSeq(path string) (seq uint64, torn bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false, fmt.Errorf("read audit log: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, false, fmt.Errorf("read audit log: %w", err)
+	}
+	offset := max(info.Size()-auditTailSize, 0)
+	tail := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(tail, offset); err != nil && err != io.EOF {
+		return 0, false, fmt.Errorf("read audit log: %w", err)
+	}
+	torn = len(tail) > 0 && tail[len(tail)-1] != '\n'
+
+	lines := bytes.Split(bytes.TrimRight(tail, "\n"), []byte("\n"))
+	for i := len(lines) - 1; i >= 0; i-- {
+		var entry struct {
+			Seq uint64 `json:"seq"`
+		}
+		// A torn last line, from a crash mid-write, is skipped
+		if json.Unmarshal(lines[i], &entry) == nil {
+			return entry.Seq, torn, nil
+		}
+	}
+	return 0, torn, nil
 }
 
 // Log writes an audit entry to the log file.
@@ -64,65 +399,297 @@ func (al *AuditLogger) Log(entry AuditEntry) error {
 	al.mu.Lock()
 	defer al.mu.Unlock()
 
+	// Number the entry; consumers order by Seq, since a stepped clock can
+	// make timestamps go backwards
+	al.seq++
+	entry.Seq = al.seq
+
 	// Set timestamp if not already set
 	if entry.Timestamp == "" {
-		entry.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+		now := time.Now()
+		if al.now != nil {
+			now = al.now()
+		}
+		if now.Round(0).Before(al.last) {
+			entry.ClockSkew = true
+		}
+		al.last = now.Round(0)
+		entry.Timestamp = now.UTC().Format(time.RFC3339Nano)
+	}
+	// A bug, not a reason to lose the entry
+	if err := entry.Validate(); err != nil {
+		al.logf("warning: audit entry %d (%s): %v", entry.Seq, entry.Command, err)
 	}
 
 	data, err := json.Marshal(entry)
 	if err != nil {
 		return fmt.Errorf("marshal audit entry: %w", err)
 	}
+	switch entry.Phase {
+	case PhaseStarted:
+		if al.running == nil {
+			al.running = make(map[string]bool)
+		}
+		al.running[entry.RequestID] = true
+	case PhaseFinished:
+		delete(al.running, entry.RequestID)
+	}
 
 	data = append(data, '\n')
+	if err := al.flush(); err != nil {
+		// Keep the order: the entry waits behind the ones already held
+		al.hold(data)
+		al.failed(err)
+		return fmt.Errorf("write audit entry: %w", err)
+	}
 	if _, err := al.writer.Write(data); err != nil {
+		al.hold(data)
+		al.failed(err)
 		return fmt.Errorf("write audit entry: %w", err)
 	}
+	if err := al.syncWriter(entry.Phase); err != nil {
+		// The entry is written; it may just not survive a crash
+		al.failed(err)
+		return fmt.Errorf("sync audit log: %w", err)
+	}
+	al.recovered()
 
 	return nil
 }
 
-// Close closes the audit log file.
-func (al *AuditLogger) Close() error {
+// SetSyncPolicy sets when entries are flushed to disk; the default is
+// AuditSyncNone.
+func (al *AuditLogger) SetSyncPolicy(policy AuditSyncPolicy) error {
+	if !policy.Valid() {
+		return fmt.Errorf("unknown audit sync policy %q (expected none, started or always)", policy)
+	}
 	al.mu.Lock()
 	defer al.mu.Unlock()
+	al.sync = policy
+	return nil
+}
 
-	if al.writer != nil {
-		return al.writer.Close()
+// syncWriter flushes the log to disk after an entry of the given phase, as
+// the sync policy asks. The caller holds al.mu.
+func (al *AuditLogger) syncWriter(phase string) error {
+	if al.sync != AuditSyncAlways && (al.sync != AuditSyncStarted || phase != PhaseStarted) {
+		return nil
+	}
+	if f, ok := al.writer.(interface{ Sync() error }); ok {
+		return f.Sync()
 	}
 	return nil
 }
 
-// ReadAuditLog reads all audit entries from the specified file.
-func ReadAuditLog(path string) ([]AuditEntry, error) {
-	if path == "" {
-		return nil, nil
+// Running reports whether the command of request id has a started entry
+// written by this logger and no finished one yet.
+func (al *AuditLogger) Running(id string) bool {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	return al.running[id]
+}
+
+// Integrity scans the log for lines that are not entries, reusing the last
+// scan for auditIntegrityInterval. Newly found corrupt lines are logged. It
+// returns nil for a disabled log or if the log cannot be read.
+func (al *AuditLogger) Integrity() *AuditParseReport {
+	if al.path == "" {
+		return nil
 	}
+	al.mu.Lock()
+	if al.integrity != nil && time.Since(al.integrityAt) < auditIntegrityInterval {
+		report := al.integrity
+		al.mu.Unlock()
+		return report
+	}
+	al.mu.Unlock()
 
-	file, err := os.Open(path)
+	// Scan without the lock: entries go on being written meanwhile
+	report, err := ScanAuditLogReport(al.path, func(AuditEntry) error { return nil })
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, nil
+		al.mu.Lock()
+		al.logf("warning: audit log integrity scan failed: %v", err)
+		al.mu.Unlock()
+		return nil
+	}
+
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	if report.CorruptLines > al.corrupt {
+		al.logf("SECURITY: audit log %s has %d corrupt lines (first at line %d); check the disk", al.path, report.CorruptLines, report.Corrupt[0])
+	}
+	al.corrupt = report.CorruptLines
+	al.integrity, al.integrityAt = &report, time.Now()
+	return al.integrity
+}
+
+// SetFailureMode sets what happens while entries cannot be written.
+// bufferSize bounds the entries held in the buffer and block modes; 0 means
+// DefaultAuditBufferSize. Failures are reported to logger.
+func (al *AuditLogger) SetFailureMode(mode AuditFailureMode, bufferSize int, logger *log.Logger) error {
+	if !mode.Valid() {
+		return fmt.Errorf("unknown audit failure mode %q (expected log, block or buffer)", mode)
+	}
+	if bufferSize < 0 {
+		return fmt.Errorf("audit buffer size must not be negative, got %d", bufferSize)
+	}
+	if bufferSize == 0 {
+		bufferSize = DefaultAuditBufferSize
+	}
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	al.mode, al.bufferMax, al.logger = mode, bufferSize, logger
+	return nil
+}
+
+// Health returns the writer's current state.
+func (al *AuditLogger) Health() AuditHealth {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	h := AuditHealth{
+		Mode:     al.failureMode(),
+		Healthy:  al.lastErr == nil,
+		Failures: al.failures,
+		Buffered: len(al.pending),
+		Dropped:  al.dropped,
+	}
+	if al.lastErr != nil {
+		h.Since = al.since
+		h.Error = al.lastErr.Error()
+	}
+	return h
+}
+
+// Accepting reports whether new requests may run. Only the block mode
+// refuses them, while writes fail; each call retries the held entries, so
+// the first request after the log recovers is accepted.
+func (al *AuditLogger) Accepting() bool {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	if al.mode != AuditFailBlock || al.lastErr == nil {
+		return true
+	}
+	if err := al.flush(); err != nil {
+		al.failed(err)
+		return false
+	}
+	al.recovered()
+	return true
+}
+
+func (al *AuditLogger) failureMode() AuditFailureMode {
+	if al.mode == "" {
+		return AuditFailLog
+	}
+	return al.mode
+}
+
+// flush writes the held entries, stopping at the first failure. The caller
+// holds al.mu.
+func (al *AuditLogger) flush() error {
+	for len(al.pending) > 0 {
+		if _, err := al.writer.Write(al.pending[0]); err != nil {
+			return err
 		}
-		return nil, fmt.Errorf("open audit log: %w", err)
+		al.pending[0] = nil
+		al.pending = al.pending[1:]
+	}
+	return nil
+}
+
+// hold keeps an unwritten entry for later, or drops it in the log mode or
+// when the buffer is full. The caller holds al.mu.
+func (al *AuditLogger) hold(data []byte) {
+	if al.failureMode() == AuditFailLog || al.bufferMax <= 0 {
+		al.dropped++
+		al.lost++
+		return
+	}
+	if len(al.pending) >= al.bufferMax {
+		al.pending[0] = nil
+		al.pending = al.pending[1:]
+		al.dropped++
+		al.lost++
 	}
-	defer file.Close()
+	al.pending = append(al.pending, data)
+}
 
-	var entries []AuditEntry
-	decoder := json.NewDecoder(file)
-	for {
-		var entry AuditEntry
-		if err := decoder.Decode(&entry); err != nil {
-			if err == io.EOF {
-				break
-			}
-			// Skip malformed lines
-			continue
+// failed records a write failure, logging the first one of an outage and
+// then a summary every auditFailureReport. The caller holds al.mu.
+func (al *AuditLogger) failed(err error) {
+	now := time.Now()
+	al.failures++
+	if al.lastErr == nil {
+		al.since = now
+		al.lastReport = now
+		al.lost = 0
+		al.logf("SECURITY: audit log write failed (failure mode %s): %v", al.failureMode(), err)
+	} else if now.Sub(al.lastReport) >= auditFailureReport {
+		al.lastReport = now
+		al.logf("SECURITY: audit log writes failing since %s: %d failed writes, %d entries held, %d dropped since last report: %v",
+			al.since.Format(time.RFC3339), al.failures, len(al.pending), al.lost, err)
+		al.lost = 0
+	}
+	al.lastErr = err
+}
+
+// recovered ends an outage after a successful write. The caller holds al.mu.
+func (al *AuditLogger) recovered() {
+	if al.lastErr == nil {
+		return
+	}
+	al.logf("audit log writable again after %s; %d entries dropped since startup",
+		time.Since(al.since).Round(time.Second), al.dropped)
+	al.lastErr = nil
+	al.since = time.Time{}
+}
+
+func (al *AuditLogger) logf(format string, args ...any) {
+	if al.logger != nil {
+		al.logger.Printf(format, args...)
+	}
+}
+
+// Subscribe writes every Audited event published on bus. Delivery is
+// synchronous, so entries are on disk before Publish returns.
+func (al *AuditLogger) Subscribe(bus *events.Bus) (unsubscribe func()) {
+	return bus.Subscribe("audit", func(e events.Event) {
+		if a, ok := e.(Audited); ok {
+			al.Log(a.Entry)
 		}
-		entries = append(entries, entry)
+	})
+}
+
+// Close closes the audit log file, making a last attempt to write the held
+// entries.
+func (al *AuditLogger) Close() error {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	if al.writer != nil {
+		if err := al.flush(); err != nil && len(al.pending) > 0 {
+			al.logf("SECURITY: %d audit entries lost at shutdown: %v", len(al.pending), err)
+		}
+		return al.writer.Close()
 	}
+	return nil
+}
 
-	return entries, nil
+// ReadAuditLog reads all audit entries from the specified file.
+func ReadAuditLog(path string) ([]AuditEntry, error) {
+	entries, _, err := ReadAuditLogReport(path)
+	return entries, err
+}
+
+// ReadAuditLogReport reads all audit entries from the specified file, and
+// reports the lines it skipped.
+func ReadAuditLogReport(path string) ([]AuditEntry, AuditParseReport, error) {
+	var entries []AuditEntry
+	report, err := ScanAuditLogReport(path, func(entry AuditEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	return entries, report, err
 }
 
 // lastIndex returns the last index of sep in s, or 0 if not found.
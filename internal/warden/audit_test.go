@@ -1,10 +1,25 @@
 package warden
 
 import (
+	"bytes"
 	"clawrden/pkg/protocol"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestAuditLogger(t *testing.T) {
@@ -25,7 +40,7 @@ func TestAuditLogger(t *testing.T) {
 			Args:     []string{"hello"},
 			Cwd:      "/app",
 			Identity: protocol.Identity{UID: 1000, GID: 1000},
-			Decision: "allow",
+			Decision: protocol.DecisionAllow,
 			ExitCode: 0,
 			Duration: 123.45,
 		},
@@ -34,14 +49,14 @@ func TestAuditLogger(t *testing.T) {
 			Args:     []string{"rm", "-rf", "/"},
 			Cwd:      "/app",
 			Identity: protocol.Identity{UID: 1000, GID: 1000},
-			Decision: "deny",
+			Decision: protocol.DecisionDeny,
 		},
 		{
 			Command:  "npm",
 			Args:     []string{"install"},
 			Cwd:      "/app",
 			Identity: protocol.Identity{UID: 1000, GID: 1000},
-			Decision: "ask",
+			Decision: protocol.DecisionAsk,
 			ExitCode: 0,
 			Duration: 5432.1,
 		},
@@ -90,7 +105,7 @@ func TestAuditLoggerDisabled(t *testing.T) {
 	// Should not error
 	err = logger.Log(AuditEntry{
 		Command:  "test",
-		Decision: "allow",
+		Decision: protocol.DecisionAllow,
 	})
 	if err != nil {
 		t.Errorf("log to disabled logger: %v", err)
@@ -123,8 +138,594 @@ func TestAuditLoggerCreatesDirectory(t *testing.T) {
 	}
 
 	// Verify we can write
-	err = logger.Log(AuditEntry{Command: "test", Decision: "allow"})
+	err = logger.Log(AuditEntry{Command: "test", Decision: protocol.DecisionAllow})
 	if err != nil {
 		t.Errorf("log entry: %v", err)
 	}
 }
+
+func TestAuditSeqAndClockSkew(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	clock := &fakeClock{t: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+	logger, err := NewAuditLogger(logPath)
+	if err != nil {
+		t.Fatalf("create audit logger: %v", err)
+	}
+	logger.now = clock.Now
+
+	logger.Log(AuditEntry{Command: "one"})
+	clock.Advance(time.Second)
+	logger.Log(AuditEntry{Command: "two"})
+	clock.Step(-time.Hour) // NTP steps the clock back
+	logger.Log(AuditEntry{Command: "three"})
+	clock.Advance(time.Second)
+	logger.Log(AuditEntry{Command: "four"})
+	logger.Close()
+
+	// Numbering continues after a restart
+	restarted, err := NewAuditLogger(logPath)
+	if err != nil {
+		t.Fatalf("reopen audit logger: %v", err)
+	}
+	restarted.Log(AuditEntry{Command: "five"})
+	restarted.Close()
+
+	entries, err := ReadAuditLog(logPath)
+	if err != nil {
+		t.Fatalf("read audit log: %v", err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, fmt.Sprintf("%d:%s:%v", e.Seq, e.Command, e.ClockSkew))
+	}
+	want := []string{"1:one:false", "2:two:false", "3:three:true", "4:four:false", "5:five:false"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("entries = %v, want %v", got, want)
+	}
+
+	// A line torn by a crash mid-write is passed over
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"seq":99,"comm`)
+	f.Close()
+	if seq, torn, err := lastAuditSeq(logPath); err != nil || seq != 5 || !torn {
+		t.Errorf("lastAuditSeq after a torn line = %d, %v, %v; want 5, torn", seq, torn, err)
+	}
+
+	// Reopening ends the torn line, so the next entry is not glued to it
+	restarted, err = NewAuditLogger(logPath)
+	if err != nil {
+		t.Fatalf("reopen audit logger: %v", err)
+	}
+	restarted.Log(AuditEntry{Command: "six"})
+	restarted.Close()
+	entries, report, err := ReadAuditLogReport(logPath)
+	if err != nil || len(entries) != 6 || entries[5].Seq != 6 {
+		t.Fatalf("entries after the torn line = %d, %v; want six up to seq 6", len(entries), err)
+	}
+	if want := (AuditParseReport{Entries: 6, CorruptLines: 1, Corrupt: []int{6}}); !reflect.DeepEqual(report, want) {
+		t.Errorf("report = %+v, want %+v", report, want)
+	}
+}
+
+func TestReadAuditLogReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeTestFile(t, path, `{"seq":1,"command":"ls"}
+garbage
+{"seq":2,"command":"pwd"}
+
+{"seq":3,"comm
+{"seq":4,"command":"cat"}
+{"seq":5,"command":"make","ar`)
+
+	entries, report, err := ReadAuditLogReport(path)
+	if err != nil {
+		t.Fatalf("ReadAuditLogReport: %v", err)
+	}
+	if len(entries) != 3 || entries[2].Command != "cat" {
+		t.Errorf("entries = %+v, want ls, pwd and cat", entries)
+	}
+	// The unterminated tail may still be being written; it isn't corruption
+	want := AuditParseReport{Entries: 3, CorruptLines: 2, Corrupt: []int{2, 5}, PartialTail: 7}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("report = %+v, want %+v", report, want)
+	}
+
+	// An unterminated last line that is a whole entry is read
+	writeTestFile(t, path, `{"seq":1,"command":"ls"}`)
+	if entries, report, err := ReadAuditLogReport(path); err != nil || len(entries) != 1 || report.PartialTail != 0 {
+		t.Errorf("unterminated entry = %d entries, %+v, %v; want it read", len(entries), report, err)
+	}
+}
+
+// syncCounter counts Sync calls, like an *os.File would make fsyncs.
+type syncCounter struct {
+	bytes.Buffer
+	syncs int
+}
+
+func (w *syncCounter) Sync() error  { w.syncs++; return nil }
+func (w *syncCounter) Close() error { return nil }
+
+func TestAuditSyncPolicy(t *testing.T) {
+	w := &syncCounter{}
+	al := &AuditLogger{writer: w}
+	al.Log(AuditEntry{Command: "one"})
+	if w.syncs != 0 {
+		t.Errorf("%d syncs by default, want none", w.syncs)
+	}
+	if err := al.SetSyncPolicy(AuditSyncAlways); err != nil {
+		t.Fatalf("SetSyncPolicy: %v", err)
+	}
+	al.Log(AuditEntry{Command: "two"})
+	al.Log(AuditEntry{Command: "three"})
+	if w.syncs != 2 {
+		t.Errorf("%d syncs with policy always, want one per entry", w.syncs)
+	}
+	if err := al.SetSyncPolicy("sometimes"); err == nil {
+		t.Error("unknown sync policy accepted")
+	}
+}
+
+func TestStatusReportsAuditCorruption(t *testing.T) {
+	api, _ := newTestAPIServer(t, Config{})
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeTestFile(t, path, "{\"seq\":1,\"command\":\"ls\"}\n\x00\x00\x00\n")
+	var logs bytes.Buffer
+	al, err := NewAuditLogger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer al.Close()
+	al.logger = log.New(&logs, "", 0)
+	api.warden.audit = al
+
+	rec := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/status", nil))
+	var resp struct {
+		Integrity AuditParseReport `json:"audit_integrity"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode /api/status: %v", err)
+	}
+	if resp.Integrity.Entries != 1 || resp.Integrity.CorruptLines != 1 || !reflect.DeepEqual(resp.Integrity.Corrupt, []int{2}) {
+		t.Errorf("audit integrity = %+v, want line 2 corrupt", resp.Integrity)
+	}
+	if !strings.Contains(logs.String(), "1 corrupt lines (first at line 2)") {
+		t.Errorf("corruption not logged: %q", logs.String())
+	}
+}
+
+// failingWriter fails every write while broken, like a full disk.
+type failingWriter struct {
+	broken bool
+	buf    bytes.Buffer
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.broken {
+		return 0, errors.New("no space left on device")
+	}
+	return w.buf.Write(p)
+}
+
+func (w *failingWriter) Close() error { return nil }
+
+// commands returns the commands of the entries written to w, in order.
+func (w *failingWriter) commands(t *testing.T) []string {
+	t.Helper()
+	var out []string
+	for _, line := range strings.Split(strings.TrimSpace(w.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var e AuditEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("unmarshal %q: %v", line, err)
+		}
+		out = append(out, e.Command)
+	}
+	return out
+}
+
+func TestAuditFailureModes(t *testing.T) {
+	tests := []struct {
+		mode          AuditFailureMode
+		wantWritten   string // Commands on disk after recovery
+		wantDropped   int64
+		wantAccepting bool // While writes fail
+	}{
+		{AuditFailLog, "before after", 3, true},
+		{AuditFailBuffer, "before two three after", 1, true},
+		{AuditFailBlock, "before two three after", 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			w := &failingWriter{}
+			var logs bytes.Buffer
+			al := &AuditLogger{writer: w}
+			if err := al.SetFailureMode(tt.mode, 2, log.New(&logs, "", 0)); err != nil {
+				t.Fatalf("SetFailureMode: %v", err)
+			}
+
+			al.Log(AuditEntry{Command: "before"})
+			w.broken = true
+			for _, cmd := range []string{"one", "two", "three"} {
+				if err := al.Log(AuditEntry{Command: cmd}); err == nil {
+					t.Fatalf("Log(%s) succeeded on a broken writer", cmd)
+				}
+			}
+
+			h := al.Health()
+			if h.Healthy || h.Failures != 3 || h.Dropped != tt.wantDropped || h.Error == "" {
+				t.Errorf("health while failing = %+v", h)
+			}
+			if got := al.Accepting(); got != tt.wantAccepting {
+				t.Errorf("Accepting while failing = %v, want %v", got, tt.wantAccepting)
+			}
+			if !strings.Contains(logs.String(), "SECURITY: audit log write failed") {
+				t.Errorf("failure not logged: %q", logs.String())
+			}
+
+			w.broken = false
+			if !al.Accepting() {
+				t.Error("not accepting after the writer recovered")
+			}
+			if err := al.Log(AuditEntry{Command: "after"}); err != nil {
+				t.Fatalf("Log after recovery: %v", err)
+			}
+			if got := strings.Join(w.commands(t), " "); got != tt.wantWritten {
+				t.Errorf("written = %q, want %q", got, tt.wantWritten)
+			}
+			if h := al.Health(); !h.Healthy || h.Buffered != 0 || h.Dropped != tt.wantDropped {
+				t.Errorf("health after recovery = %+v", h)
+			}
+		})
+	}
+}
+
+func TestAuditLoggerRejectsUnknownFailureMode(t *testing.T) {
+	al := &AuditLogger{writer: nopWriteCloser{}}
+	if err := al.SetFailureMode("panic", 0, log.New(io.Discard, "", 0)); err == nil {
+		t.Error("unknown failure mode accepted")
+	}
+}
+
+func TestReadyzReportsAuditFailures(t *testing.T) {
+	api, _ := newTestAPIServer(t, Config{})
+	w := &failingWriter{broken: true}
+	api.warden.audit = &AuditLogger{writer: w}
+	api.warden.audit.Log(AuditEntry{Command: "lost"})
+
+	rec := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var resp struct {
+		Audit    AuditHealth `json:"audit"`
+		Warnings []string    `json:"warnings"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode /readyz: %v", err)
+	}
+	if resp.Audit.Healthy || resp.Audit.Failures != 1 || resp.Audit.Mode != AuditFailLog {
+		t.Errorf("audit health = %+v", resp.Audit)
+	}
+	if len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], "audit log unwritable") {
+		t.Errorf("warnings = %q", resp.Warnings)
+	}
+}
+
+func TestAuditAndQueueSession(t *testing.T) {
+	srv, audited := newMaintenanceTestServer(t, nil)
+	srv.setPolicy(&PolicyEngine{config: PolicyConfig{DefaultAction: ActionDeny}})
+	sendRequest(t, srv, &protocol.Request{
+		Command: "rm", Args: []string{"-rf", "build"}, Cwd: t.TempDir(), Type: protocol.RequestTypeExec,
+		Session: &protocol.Session{TTY: "/dev/pts/3\x1b[2J", SSHConnection: "10.0.0.5 52144 10.0.0.1 22", LoginSession: "7"},
+	})
+	sendRequest(t, srv, &protocol.Request{Command: "ls", Cwd: t.TempDir(), Type: protocol.RequestTypeExec})
+
+	entries := audited()
+	if len(entries) != 2 {
+		t.Fatalf("audited %d entries, want 2", len(entries))
+	}
+	want := protocol.Session{TTY: "/dev/pts/3_[2J", SSHConnection: "10.0.0.5 52144 10.0.0.1 22", LoginSession: "7"}
+	if s := entries[0].Session; s == nil || s.Session != want || !s.SelfReported {
+		t.Errorf("audited session %+v, want %+v marked self-reported", s, want)
+	}
+	if s := entries[1].Session; s != nil {
+		t.Errorf("request without a session audited %+v", s)
+	}
+	line, _ := json.Marshal(entries[0])
+	if !strings.Contains(string(line), `"session":{"tty":"/dev/pts/3_[2J","ssh_connection":"10.0.0.5 52144 10.0.0.1 22","login_session":"7","self_reported":true}`) {
+		t.Errorf("audit line %s lacks the self-reported session", line)
+	}
+
+	q := newQueueEntry(PendingRequest{ID: "q-1", Request: &protocol.Request{Command: "rm", Session: &want}})
+	if q.Session == nil || q.Session.Session != want || !q.Session.SelfReported {
+		t.Errorf("queue entry session %+v, want %+v marked self-reported", q.Session, want)
+	}
+}
+
+func TestReadLegacyAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeTestFile(t, path, `{"seq":1,"command":"npm","decision":"deny (after HITL)","resolution":"human"}
+{"seq":2,"command":"clawrden-jail","decision":"jail create"}
+{"seq":3,"command":"ls","decision":"allow"}
+{"seq":4,"command":"rm","decision":"deny","outcome":"hitl_expired"}
+`)
+	entries, err := ReadAuditLog(path)
+	if err != nil {
+		t.Fatalf("ReadAuditLog: %v", err)
+	}
+	want := []struct {
+		decision protocol.Decision
+		outcome  protocol.Outcome
+		detail   string
+	}{
+		{protocol.DecisionDeny, protocol.OutcomeAfterHITL, ""},
+		{protocol.DecisionEvent, protocol.OutcomeNone, "jail create"},
+		{protocol.DecisionAllow, protocol.OutcomeNone, ""},
+		{protocol.DecisionDeny, protocol.OutcomeHITLExpired, ""},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("read %d entries, want %d", len(entries), len(want))
+	}
+	for i, w := range want {
+		e := entries[i]
+		if e.Decision != w.decision || e.Outcome != w.outcome || e.Detail != w.detail {
+			t.Errorf("entry %d = %v, %v, %q; want %v, %v, %q", e.Seq, e.Decision, e.Outcome, e.Detail, w.decision, w.outcome, w.detail)
+		}
+		if err := e.Validate(); err != nil {
+			t.Errorf("entry %d: %v", e.Seq, err)
+		}
+	}
+	if entries[0].Resolution != ResolutionHuman || entries[0].DecisionLabel() != "deny (after HITL)" {
+		t.Errorf("legacy entry = %+v", entries[0])
+	}
+}
+
+func TestAuditEntryValidate(t *testing.T) {
+	tests := []struct {
+		entry AuditEntry
+		valid bool
+	}{
+		{AuditEntry{Decision: protocol.DecisionAllow}, true},
+		{AuditEntry{Decision: protocol.DecisionDeny, Outcome: protocol.OutcomeLockdown}, true},
+		{AuditEntry{Decision: protocol.DecisionEvent, Detail: "incident"}, true},
+		{AuditEntry{}, false},
+		{AuditEntry{Decision: protocol.Decision(99)}, false},
+		{AuditEntry{Decision: protocol.DecisionEvent}, false},
+		{AuditEntry{Decision: protocol.DecisionAsk, Outcome: protocol.OutcomeAfterHITL}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.entry.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate(%v, %v, %q) = %v, want valid %v", tt.entry.Decision, tt.entry.Outcome, tt.entry.Detail, err, tt.valid)
+		}
+	}
+}
+
+// TestAuditDecisionsAreConstants checks, as a vet pass would, that every
+// audit entry this package writes takes its decision and outcome from the
+// protocol's constants, and that every event names itself in its detail.
+// Validate catches the rest when the entry is written.
+func TestAuditDecisionsAreConstants(t *testing.T) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(fi fs.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// constant reports whether e is a protocol constant of kind, or an
+	// Action's Decision()
+	constant := func(e ast.Expr, kind string) bool {
+		if call, ok := e.(*ast.CallExpr); ok {
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			return ok && kind == "Decision" && sel.Sel.Name == "Decision" && len(call.Args) == 0
+		}
+		sel, ok := e.(*ast.SelectorExpr)
+		if !ok {
+			return false
+		}
+		pkg, ok := sel.X.(*ast.Ident)
+		return ok && pkg.Name == "protocol" && strings.HasPrefix(sel.Sel.Name, kind) && sel.Sel.Name != kind
+	}
+	isEvent := func(e ast.Expr) bool {
+		sel, ok := e.(*ast.SelectorExpr)
+		return ok && sel.Sel.Name == "DecisionEvent"
+	}
+	check := func(pos token.Pos, fields map[string]ast.Expr) {
+		for _, kind := range []string{"Decision", "Outcome"} {
+			if e, ok := fields[kind]; ok && !constant(e, kind) {
+				t.Errorf("%s: %s is not a protocol constant", fset.Position(pos), kind)
+			}
+		}
+		if e, ok := fields["Decision"]; ok && isEvent(e) && fields["Detail"] == nil {
+			t.Errorf("%s: event without a detail", fset.Position(pos))
+		}
+	}
+
+	found := 0
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			ast.Inspect(file, func(n ast.Node) bool {
+				fields := make(map[string]ast.Expr)
+				switch n := n.(type) {
+				case *ast.FuncDecl:
+					// The decoder takes the decision from the line it reads
+					return n.Name.Name != "unmarshalAuditEntry"
+				case *ast.CompositeLit:
+					if id, ok := n.Type.(*ast.Ident); !ok || id.Name != "AuditEntry" {
+						return true
+					}
+					for _, elt := range n.Elts {
+						if kv, ok := elt.(*ast.KeyValueExpr); ok {
+							fields[kv.Key.(*ast.Ident).Name] = kv.Value
+						}
+					}
+				case *ast.AssignStmt:
+					if len(n.Lhs) != len(n.Rhs) {
+						return true
+					}
+					for i, lhs := range n.Lhs {
+						if sel, ok := lhs.(*ast.SelectorExpr); ok {
+							fields[sel.Sel.Name] = n.Rhs[i]
+						}
+					}
+				default:
+					return true
+				}
+				if _, ok := fields["Decision"]; ok {
+					found++
+					check(n.Pos(), fields)
+				}
+				return true
+			})
+		}
+	}
+	if found < 30 {
+		t.Errorf("found %d decisions, want every one the package sets", found)
+	}
+}
+
+func TestAuditPairsStartedAndFinished(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	al, err := NewAuditLogger(path)
+	if err != nil {
+		t.Fatalf("NewAuditLogger: %v", err)
+	}
+	defer al.Close()
+	allow := func(id, phase string) AuditEntry {
+		return AuditEntry{RequestID: id, Command: "make", Decision: protocol.DecisionAllow, Phase: phase}
+	}
+	al.Log(allow("req-1", PhaseStarted))
+	al.Log(allow("req-2", PhaseStarted)) // Its finish is never written
+	al.Log(AuditEntry{RequestID: "req-3", Command: "rm", Decision: protocol.DecisionDeny})
+	finished := allow("req-1", PhaseFinished)
+	finished.ExitCode = 2
+	al.Log(finished)
+
+	entries, err := ReadAuditLog(path)
+	if err != nil {
+		t.Fatalf("ReadAuditLog: %v", err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, fmt.Sprintf("%s %s %d %s", e.RequestID, e.Phase, e.ExitCode, e.Completed))
+	}
+	want := []string{"req-2 started 0 unknown", "req-3  0 ", "req-1 finished 2 "}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("entries = %q, want %q", got, want)
+	}
+	if !al.Running("req-2") || al.Running("req-1") {
+		t.Error("Running should report req-2 only")
+	}
+
+	// A finished entry appended after the first pass is left for the next read
+	var seen []string
+	ScanAuditLog(path, func(e AuditEntry) error {
+		if len(seen) == 0 {
+			al.Log(allow("req-2", PhaseFinished))
+		}
+		seen = append(seen, e.RequestID+" "+e.Completed)
+		return nil
+	})
+	if want := []string{"req-2 unknown", "req-3 ", "req-1 "}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("scan while appending = %q, want %q", seen, want)
+	}
+	if entries, _ := ReadAuditLog(path); len(entries) != 3 || entries[2].RequestID != "req-2" || entries[2].Completed != "" {
+		t.Errorf("after the finish: %+v, want req-2 finished last", entries)
+	}
+}
+
+func TestAuditSyncStarted(t *testing.T) {
+	w := &syncCounter{}
+	al := &AuditLogger{writer: w}
+	if err := al.SetSyncPolicy(AuditSyncStarted); err != nil {
+		t.Fatalf("SetSyncPolicy: %v", err)
+	}
+	al.Log(AuditEntry{RequestID: "req-1", Command: "make", Phase: PhaseStarted})
+	al.Log(AuditEntry{RequestID: "req-1", Command: "make", Phase: PhaseFinished})
+	al.Log(AuditEntry{Command: "rm"})
+	if w.syncs != 1 {
+		t.Errorf("%d syncs with policy started, want one for the started entry", w.syncs)
+	}
+}
+
+func TestAuditCrashLeavesUnknownCompletion(t *testing.T) {
+	srv, _ := newMaintenanceTestServer(t, []Rule{{Command: "echo", Action: ActionAllow}})
+	srv.config.AuditPath = filepath.Join(t.TempDir(), "audit.log")
+	al, err := NewAuditLogger(srv.config.AuditPath)
+	if err != nil {
+		t.Fatalf("NewAuditLogger: %v", err)
+	}
+	srv.audit = al
+	defer al.Subscribe(srv.events)()
+
+	if ack, _ := sendRequest(t, srv, &protocol.Request{Command: "echo", Args: []string{"hi"}, Cwd: "/"}); ack != protocol.AckAllowed {
+		t.Fatalf("ack = %d, want allowed", ack)
+	}
+	data, _ := os.ReadFile(srv.config.AuditPath)
+	if n := strings.Count(string(data), `"phase":"started"`); n != 1 || !strings.Contains(string(data), `"phase":"finished"`) {
+		t.Errorf("audit log:\n%s\nwant a started and a finished entry", data)
+	}
+
+	// The warden dies while a command runs: its finished entry is never written
+	crashed := AuditEntry{RequestID: "req-crash", Command: "make", Decision: protocol.DecisionAllow}
+	srv.recordStarted(&crashed)
+
+	history := func() []AuditEntry {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		(&APIServer{warden: srv}).handleHistory(rec, httptest.NewRequest(http.MethodGet, "/api/history", nil))
+		var entries []AuditEntry
+		if err := json.NewDecoder(rec.Body).Decode(&entries); err != nil {
+			t.Fatalf("decode history: %v", err)
+		}
+		return entries
+	}
+	entries := history()
+	if len(entries) != 2 || entries[0].Command != "echo" || entries[0].Phase != PhaseFinished || entries[0].Completed != "" {
+		t.Fatalf("history = %+v, want the echo once, finished", entries)
+	}
+	if entries[1].RequestID != "req-crash" || entries[1].Completed != CompletionRunning {
+		t.Errorf("history = %+v, want req-crash running", entries[1])
+	}
+
+	// After a restart nobody knows how it ended
+	al.Close()
+	if srv.audit, err = NewAuditLogger(srv.config.AuditPath); err != nil {
+		t.Fatalf("NewAuditLogger: %v", err)
+	}
+	defer srv.audit.Close()
+	if entries := history(); len(entries) != 2 || entries[1].Completed != CompletionUnknown {
+		t.Errorf("history after restart = %+v, want req-crash unknown", entries)
+	}
+}
+
+func TestUnwritableStartedEntryRefusesCommand(t *testing.T) {
+	for _, mode := range []AuditFailureMode{AuditFailLog, AuditFailBuffer} {
+		t.Run(string(mode), func(t *testing.T) {
+			srv, audited := newMaintenanceTestServer(t, []Rule{{Command: "touch", Action: ActionAllow}})
+			srv.audit = &AuditLogger{writer: &failingWriter{broken: true}}
+			if err := srv.audit.SetFailureMode(mode, 0, log.New(io.Discard, "", 0)); err != nil {
+				t.Fatalf("SetFailureMode: %v", err)
+			}
+
+			dir := t.TempDir()
+			marker := filepath.Join(dir, "ran")
+			ack, reason := sendRequest(t, srv, &protocol.Request{Command: "touch", Args: []string{marker}, Cwd: dir})
+			if ack != protocol.AckDenied || !strings.Contains(reason, "cannot write its audit log") {
+				t.Errorf("ack = %d (%q), want denied for the audit log", ack, reason)
+			}
+			if _, err := os.Stat(marker); !os.IsNotExist(err) {
+				t.Errorf("command ran without a started entry (stat: %v)", err)
+			}
+			entries := audited()
+			if len(entries) != 1 || entries[0].Outcome != protocol.OutcomeAuditUnavailable || entries[0].Phase != PhaseFinished {
+				t.Errorf("audited %+v, want one finished audit_unavailable denial", entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package warden
+
+import (
+	"clawrden/internal/events"
+	"clawrden/internal/jailhouse"
+	"clawrden/pkg/labels"
+	"clawrden/pkg/protocol"
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	dockerevents "github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// defaultAutoJailGrace is how long a label-provisioned jail outlives its last
+// container, so restarts don't tear down and rebuild the jail.
+const defaultAutoJailGrace = 30 * time.Second
+
+// autoJailCommand is the pseudo-command recorded in the audit log for jail actions.
+const autoJailCommand = "clawrden-autojail"
+
+// ContainerEvent is a container lifecycle event relevant to jail provisioning.
+type ContainerEvent struct {
+	Action      string // "start" or "die"
+	ContainerID string
+	Labels      map[string]string
+}
+
+// ContainerEventSource streams container events. It is abstracted so the
+// auto-jailer can be driven without a Docker daemon.
+type ContainerEventSource interface {
+	Events(ctx context.Context) (<-chan ContainerEvent, <-chan error)
+}
+
+// AutoJailer creates and destroys jails as labeled containers start and stop.
+type AutoJailer struct {
+	jails  *jailhouse.Manager
+	audit  *AuditLogger
+	events *events.Bus // Optional; receives JailChanged
+	logger *log.Logger
+	grace  time.Duration
+
+	// isPolicyJail reports jails defined in policy.yaml, which are never destroyed
+	isPolicyJail func(jailID string) bool
+
+	mu      sync.Mutex
+	owners  map[string]map[string]bool // jailID -> running container IDs
+	timers  map[string]*time.Timer     // jailID -> pending destroy
+	managed map[string]bool            // jails provisioned from labels
+}
+
+// NewAutoJailer creates an auto-jailer. A zero grace uses defaultAutoJailGrace.
+// isPolicyJail may be nil.
+func NewAutoJailer(jails *jailhouse.Manager, audit *AuditLogger, logger *log.Logger, grace time.Duration, isPolicyJail func(string) bool) *AutoJailer {
+	if grace == 0 {
+		grace = defaultAutoJailGrace
+	}
+	if isPolicyJail == nil {
+		isPolicyJail = func(string) bool { return false }
+	}
+	return &AutoJailer{
+		jails:        jails,
+		audit:        audit,
+		logger:       logger,
+		grace:        grace,
+		isPolicyJail: isPolicyJail,
+		owners:       make(map[string]map[string]bool),
+		timers:       make(map[string]*time.Timer),
+		managed:      make(map[string]bool),
+	}
+}
+
+// JailsOwnedBy returns the label jails provisioned for a running container.
+func (aj *AutoJailer) JailsOwnedBy(containerID string) []string {
+	aj.mu.Lock()
+	defer aj.mu.Unlock()
+	var jailIDs []string
+	for jailID, containers := range aj.owners {
+		if containers[containerID] {
+			jailIDs = append(jailIDs, jailID)
+		}
+	}
+	return jailIDs
+}
+
+// Run consumes events from source until ctx is cancelled, reconnecting
+// after stream errors.
+func (aj *AutoJailer) Run(ctx context.Context, source ContainerEventSource) {
+	for {
+		eventCh, errCh := source.Events(ctx)
+	stream:
+		for {
+			select {
+			case <-ctx.Done():
+				aj.stop()
+				return
+			case ev := <-eventCh:
+				aj.Handle(ev)
+			case err := <-errCh:
+				aj.logger.Printf("warning: container event stream: %v (reconnecting in 5s)", err)
+				break stream
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			aj.stop()
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// Handle applies a single container event.
+func (aj *AutoJailer) Handle(ev ContainerEvent) {
+	spec, ok := labels.ParseJail(ev.Labels)
+	if !ok {
+		return
+	}
+
+	switch ev.Action {
+	case string(dockerevents.ActionStart):
+		aj.containerStarted(ev.ContainerID, spec)
+	case string(dockerevents.ActionDie):
+		aj.containerDied(ev.ContainerID, spec.JailID)
+	}
+}
+
+func (aj *AutoJailer) containerStarted(containerID string, spec labels.JailSpec) {
+	aj.mu.Lock()
+	defer aj.mu.Unlock()
+
+	if aj.owners[spec.JailID] == nil {
+		aj.owners[spec.JailID] = make(map[string]bool)
+	}
+	aj.owners[spec.JailID][containerID] = true
+
+	// A restart within the grace period keeps the existing jail
+	if timer, ok := aj.timers[spec.JailID]; ok {
+		timer.Stop()
+		delete(aj.timers, spec.JailID)
+	}
+
+	// Existing jail (restart, or persisted across a warden restart): bring
+	// its commands in line with the labels
+	if _, err := aj.jails.GetJail(spec.JailID); err == nil {
+		if !aj.isPolicyJail(spec.JailID) {
+			aj.managed[spec.JailID] = true
+		}
+		if _, err := aj.jails.ReconcileJail(spec.JailID, spec.Commands, false); err != nil {
+			aj.logger.Printf("warning: auto-jail: reconcile %s for container %s: %v", spec.JailID, truncateID(containerID), err)
+		}
+		return
+	}
+
+	err := aj.jails.CreateJail(spec.JailID, spec.Commands, spec.Hardened)
+	aj.record("create", spec.JailID, containerID, spec.Commands, err)
+	if err != nil {
+		aj.logger.Printf("warning: auto-jail: create %s for container %s: %v", spec.JailID, truncateID(containerID), err)
+		return
+	}
+	aj.managed[spec.JailID] = true
+	aj.logger.Printf("auto-jail: created %s for container %s: %v", spec.JailID, truncateID(containerID), spec.Commands)
+}
+
+func (aj *AutoJailer) containerDied(containerID, jailID string) {
+	aj.mu.Lock()
+	defer aj.mu.Unlock()
+
+	delete(aj.owners[jailID], containerID)
+
+	// Only jails created from labels are torn down; policy jails stay
+	if len(aj.owners[jailID]) > 0 || !aj.managed[jailID] {
+		return
+	}
+	if _, pending := aj.timers[jailID]; pending {
+		return
+	}
+
+	aj.timers[jailID] = time.AfterFunc(aj.grace, func() {
+		aj.destroy(jailID, containerID)
+	})
+}
+
+// destroy removes a jail once its grace period expires, unless a container
+// using it started in the meantime.
+func (aj *AutoJailer) destroy(jailID, containerID string) {
+	aj.mu.Lock()
+	defer aj.mu.Unlock()
+
+	if _, pending := aj.timers[jailID]; !pending || len(aj.owners[jailID]) > 0 {
+		return
+	}
+	delete(aj.timers, jailID)
+	delete(aj.owners, jailID)
+	delete(aj.managed, jailID)
+
+	_, err := aj.jails.DestroyJail(jailID, false)
+	aj.record("destroy", jailID, containerID, nil, err)
+	if err != nil {
+		aj.logger.Printf("warning: auto-jail: destroy %s: %v", jailID, err)
+		return
+	}
+	aj.logger.Printf("auto-jail: destroyed %s (last container %s stopped)", jailID, truncateID(containerID))
+}
+
+// stop cancels pending destroys on shutdown; the jails persist in state.
+func (aj *AutoJailer) stop() {
+	aj.mu.Lock()
+	defer aj.mu.Unlock()
+	for jailID, timer := range aj.timers {
+		timer.Stop()
+		delete(aj.timers, jailID)
+	}
+}
+
+// record writes a jail action to the audit log and publishes successful
+// changes.
+func (aj *AutoJailer) record(action, jailID, containerID string, commands []string, err error) {
+	if err == nil {
+		change := "created"
+		if action == "destroy" {
+			change = "destroyed"
+		}
+		aj.events.Publish(events.JailChanged{JailID: jailID, Change: change, Source: "labels"})
+	}
+	if aj.audit == nil {
+		return
+	}
+	entry := AuditEntry{
+		Command:     autoJailCommand,
+		Args:        append([]string{action, jailID}, commands...),
+		ContainerID: containerID,
+		Decision:    protocol.DecisionEvent,
+		Detail:      "jail " + action,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	aj.audit.Log(entry)
+}
+
+// dockerEventSource streams container start/die events for labeled containers
+// from the Docker daemon. Containers already running when the stream opens are
+// reported as synthetic start events.
+type dockerEventSource struct {
+	client *client.Client
+}
+
+func (d *dockerEventSource) Events(ctx context.Context) (<-chan ContainerEvent, <-chan error) {
+	out := make(chan ContainerEvent)
+	errs := make(chan error, 1)
+
+	go func() {
+		labelFilter := filters.NewArgs(filters.Arg("label", labels.Jail))
+		running, err := d.client.ContainerList(ctx, container.ListOptions{Filters: labelFilter})
+		if err != nil {
+			errs <- err
+			return
+		}
+		for _, c := range running {
+			select {
+			case out <- ContainerEvent{Action: string(dockerevents.ActionStart), ContainerID: c.ID, Labels: c.Labels}:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		msgs, msgErrs := d.client.Events(ctx, dockerevents.ListOptions{Filters: filters.NewArgs(
+			filters.Arg("type", string(dockerevents.ContainerEventType)),
+			filters.Arg("event", string(dockerevents.ActionStart)),
+			filters.Arg("event", string(dockerevents.ActionDie)),
+			filters.Arg("label", labels.Jail),
+		)})
+		for {
+			select {
+			case msg := <-msgs:
+				ev := ContainerEvent{
+					Action:      string(msg.Action),
+					ContainerID: msg.Actor.ID,
+					Labels:      containerLabels(msg.Actor.Attributes),
+				}
+				select {
+				case out <- ev:
+				case <-ctx.Done():
+					return
+				}
+			case err := <-msgErrs:
+				errs <- err
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, errs
+}
+
+// containerLabels extracts clawrden.* labels from event attributes, which mix
+// container labels with fields like "name" and "image".
+func containerLabels(attrs map[string]string) map[string]string {
+	result := make(map[string]string)
+	for k, v := range attrs {
+		if strings.HasPrefix(k, "clawrden.") {
+			result[k] = v
+		}
+	}
+	return result
+}
@@ -0,0 +1,167 @@
+package warden
+
+import (
+	"clawrden/internal/jailhouse"
+	"clawrden/pkg/labels"
+	"context"
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// chanEventSource feeds synthetic container events to an AutoJailer.
+type chanEventSource struct {
+	events chan ContainerEvent
+}
+
+func (c *chanEventSource) Events(ctx context.Context) (<-chan ContainerEvent, <-chan error) {
+	return c.events, make(chan error)
+}
+
+func newTestAutoJailer(t *testing.T, grace time.Duration, policyJails ...string) (*AutoJailer, *jailhouse.Manager, string) {
+	t.Helper()
+	dir := t.TempDir()
+	mgr, err := jailhouse.NewManager(jailhouse.Config{
+		ArmoryPath:    filepath.Join(dir, "armory"),
+		JailhousePath: filepath.Join(dir, "jailhouse"),
+		StatePath:     filepath.Join(dir, "state.json"),
+		Logger:        log.New(io.Discard, "", 0),
+	})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+
+	auditPath := filepath.Join(dir, "audit.log")
+	audit, err := NewAuditLogger(auditPath)
+	if err != nil {
+		t.Fatalf("NewAuditLogger: %v", err)
+	}
+	t.Cleanup(func() { audit.Close() })
+
+	isPolicyJail := func(id string) bool {
+		for _, p := range policyJails {
+			if p == id {
+				return true
+			}
+		}
+		return false
+	}
+	return NewAutoJailer(mgr, audit, log.New(io.Discard, "", 0), grace, isPolicyJail), mgr, auditPath
+}
+
+func agentLabels(jailID, commands string) map[string]string {
+	return map[string]string{labels.Jail: jailID, labels.Commands: commands}
+}
+
+func waitForJail(t *testing.T, mgr *jailhouse.Manager, jailID string, exists bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		_, err := mgr.GetJail(jailID)
+		if (err == nil) == exists {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("jail %s exists = %v, want %v", jailID, !exists, exists)
+}
+
+func TestAutoJailerCreateAndDestroy(t *testing.T) {
+	aj, mgr, auditPath := newTestAutoJailer(t, 10*time.Millisecond)
+
+	aj.Handle(ContainerEvent{Action: "start", ContainerID: "c1", Labels: agentLabels("agent-x", "npm,git")})
+
+	state, err := mgr.GetJail("agent-x")
+	if err != nil {
+		t.Fatalf("jail not created: %v", err)
+	}
+	if len(state.Commands) != 2 {
+		t.Errorf("commands = %v, want [npm git]", state.Commands)
+	}
+
+	aj.Handle(ContainerEvent{Action: "die", ContainerID: "c1", Labels: agentLabels("agent-x", "npm,git")})
+	waitForJail(t, mgr, "agent-x", false)
+
+	entries, err := ReadAuditLog(auditPath)
+	if err != nil {
+		t.Fatalf("ReadAuditLog: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Detail != "jail create" || entries[1].Detail != "jail destroy" {
+		t.Fatalf("audit entries = %+v", entries)
+	}
+	if entries[0].Command != autoJailCommand || entries[0].ContainerID != "c1" {
+		t.Errorf("create entry = %+v", entries[0])
+	}
+}
+
+func TestAutoJailerRestartWithinGraceKeepsJail(t *testing.T) {
+	aj, mgr, _ := newTestAutoJailer(t, 50*time.Millisecond)
+	lbls := agentLabels("agent-x", "npm")
+
+	aj.Handle(ContainerEvent{Action: "start", ContainerID: "c1", Labels: lbls})
+	aj.Handle(ContainerEvent{Action: "die", ContainerID: "c1", Labels: lbls})
+	aj.Handle(ContainerEvent{Action: "start", ContainerID: "c2", Labels: agentLabels("agent-x", "npm,python")})
+
+	time.Sleep(100 * time.Millisecond)
+	state, err := mgr.GetJail("agent-x")
+	if err != nil {
+		t.Fatalf("jail destroyed despite restart: %v", err)
+	}
+	if len(state.Commands) != 2 {
+		t.Errorf("commands not reconciled with new labels: %v", state.Commands)
+	}
+}
+
+func TestAutoJailerSharedJailWaitsForLastContainer(t *testing.T) {
+	aj, mgr, _ := newTestAutoJailer(t, time.Millisecond)
+	lbls := agentLabels("agent-x", "ls")
+
+	aj.Handle(ContainerEvent{Action: "start", ContainerID: "c1", Labels: lbls})
+	aj.Handle(ContainerEvent{Action: "start", ContainerID: "c2", Labels: lbls})
+	aj.Handle(ContainerEvent{Action: "die", ContainerID: "c1", Labels: lbls})
+
+	time.Sleep(20 * time.Millisecond)
+	waitForJail(t, mgr, "agent-x", true)
+
+	aj.Handle(ContainerEvent{Action: "die", ContainerID: "c2", Labels: lbls})
+	waitForJail(t, mgr, "agent-x", false)
+}
+
+func TestAutoJailerIgnoresUnlabeledAndPolicyJails(t *testing.T) {
+	aj, mgr, _ := newTestAutoJailer(t, time.Millisecond, "policy-jail")
+
+	aj.Handle(ContainerEvent{Action: "start", ContainerID: "c0", Labels: map[string]string{"other": "x"}})
+	if jails := mgr.ListJails(); len(jails) != 0 {
+		t.Fatalf("unlabeled container created jails: %v", jails)
+	}
+
+	if err := mgr.CreateJail("policy-jail", []string{"ls"}, false); err != nil {
+		t.Fatalf("CreateJail: %v", err)
+	}
+	lbls := agentLabels("policy-jail", "ls")
+	aj.Handle(ContainerEvent{Action: "start", ContainerID: "c1", Labels: lbls})
+	aj.Handle(ContainerEvent{Action: "die", ContainerID: "c1", Labels: lbls})
+
+	time.Sleep(20 * time.Millisecond)
+	waitForJail(t, mgr, "policy-jail", true)
+}
+
+func TestAutoJailerRunConsumesSource(t *testing.T) {
+	aj, mgr, _ := newTestAutoJailer(t, time.Millisecond)
+	source := &chanEventSource{events: make(chan ContainerEvent)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		aj.Run(ctx, source)
+		close(done)
+	}()
+
+	source.events <- ContainerEvent{Action: "start", ContainerID: "c1", Labels: agentLabels("agent-z", "make")}
+	waitForJail(t, mgr, "agent-z", true)
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,181 @@
+package warden
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultBridgeStaleAfter is used when Config.BridgeStaleAfter is zero.
+// Bridges send a heartbeat every 30 seconds, so this allows three misses.
+const defaultBridgeStaleAfter = 2 * time.Minute
+
+// bridgeCheckInterval is how often the warden looks for silent bridges.
+const bridgeCheckInterval = 15 * time.Second
+
+// BridgeStatus describes a chat bridge that has sent at least one heartbeat.
+type BridgeStatus struct {
+	Name       string    `json:"name"`
+	Type       string    `json:"type"`
+	Version    string    `json:"version,omitempty"`
+	LastSeen   time.Time `json:"last_seen"`
+	AgeSeconds float64   `json:"age_seconds"`
+	Stale      bool      `json:"stale"`
+}
+
+// BridgeRegistry tracks bridge heartbeats and alerts once when a bridge that
+// was seen before goes silent for longer than the stale threshold.
+type BridgeRegistry struct {
+	mu         sync.Mutex
+	bridges    map[string]*BridgeStatus
+	alerted    map[string]bool // Bridges already reported as stale
+	staleAfter time.Duration
+	now        func() time.Time
+	logger     *log.Logger
+	alert      func(BridgeStatus) // Optional extra notification, e.g. a webhook
+}
+
+// NewBridgeRegistry creates a registry that considers bridges stale after
+// staleAfter without a heartbeat (default: 2m).
+func NewBridgeRegistry(staleAfter time.Duration, logger *log.Logger) *BridgeRegistry {
+	if staleAfter <= 0 {
+		staleAfter = defaultBridgeStaleAfter
+	}
+	return &BridgeRegistry{
+		bridges:    make(map[string]*BridgeStatus),
+		alerted:    make(map[string]bool),
+		staleAfter: staleAfter,
+		now:        time.Now,
+		logger:     logger,
+	}
+}
+
+// Heartbeat records that a bridge is alive.
+func (r *BridgeRegistry) Heartbeat(name, bridgeType, version string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.bridges[name]
+	if !ok {
+		r.logger.Printf("bridge %s (%s %s) registered", name, bridgeType, version)
+		b = &BridgeStatus{Name: name}
+		r.bridges[name] = b
+	}
+	b.Type = bridgeType
+	b.Version = version
+	b.LastSeen = r.now()
+
+	if r.alerted[name] {
+		delete(r.alerted, name)
+		r.logger.Printf("bridge %s is sending heartbeats again", name)
+	}
+}
+
+// List returns every known bridge, sorted by name, with its current age.
+func (r *BridgeRegistry) List() []BridgeStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	result := make([]BridgeStatus, 0, len(r.bridges))
+	for _, b := range r.bridges {
+		status := *b
+		age := now.Sub(b.LastSeen)
+		status.AgeSeconds = age.Seconds()
+		status.Stale = age > r.staleAfter
+		result = append(result, status)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Warnings describes each stale bridge, for readiness checks.
+func (r *BridgeRegistry) Warnings() []string {
+	var warnings []string
+	for _, b := range r.List() {
+		if b.Stale {
+			warnings = append(warnings, fmt.Sprintf("bridge %s (%s) last seen %s ago",
+				b.Name, b.Type, time.Duration(b.AgeSeconds*float64(time.Second)).Round(time.Second)))
+		}
+	}
+	return warnings
+}
+
+// CheckStale logs and alerts about bridges that became stale since the last
+// check, and returns them. Each silence is reported once.
+func (r *BridgeRegistry) CheckStale() []BridgeStatus {
+	var newlyStale []BridgeStatus
+	for _, b := range r.List() {
+		if !b.Stale {
+			continue
+		}
+		r.mu.Lock()
+		already := r.alerted[b.Name]
+		r.alerted[b.Name] = true
+		r.mu.Unlock()
+		if !already {
+			newlyStale = append(newlyStale, b)
+		}
+	}
+
+	for _, b := range newlyStale {
+		r.logger.Printf("warning: bridge %s (%s) has not sent a heartbeat since %s; approvals may not be delivered",
+			b.Name, b.Type, b.LastSeen.Format(time.RFC3339))
+		if r.alert != nil {
+			r.alert(b)
+		}
+	}
+	return newlyStale
+}
+
+// Run checks for stale bridges until ctx is done.
+func (r *BridgeRegistry) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.CheckStale()
+		}
+	}
+}
+
+// webhookAlert returns an alert function that POSTs stale bridges to url as
+// JSON ({"text": ..., "bridge": {...}}), which Slack-style webhooks accept.
+func webhookAlert(url string, logger *log.Logger) func(BridgeStatus) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	return func(b BridgeStatus) {
+		err := postWebhook(client, url, map[string]interface{}{
+			"text":   fmt.Sprintf("Clawrden: bridge %s (%s) stopped sending heartbeats; approvals may not be delivered", b.Name, b.Type),
+			"bridge": b,
+		})
+		if err != nil {
+			logger.Printf("warning: bridge alert webhook: %v", err)
+		}
+	}
+}
+
+// postWebhook POSTs payload to url as JSON.
+func postWebhook(client *http.Client, url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package warden
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced time source.
+// fakeClock is a wall clock and a monotonic clock moved by hand. Advance
+// moves both; Step moves only the wall clock, like NTP stepping it.
+type fakeClock struct {
+	t    time.Time
+	mono time.Duration
+}
+
+func (c *fakeClock) Now() time.Time          { return c.t }
+func (c *fakeClock) Mono() time.Duration     { return c.mono }
+func (c *fakeClock) Advance(d time.Duration) { c.t = c.t.Add(d); c.mono += d }
+func (c *fakeClock) Step(d time.Duration)    { c.t = c.t.Add(d) }
+
+func newTestBridgeRegistry(staleAfter time.Duration) (*BridgeRegistry, *fakeClock, *bytes.Buffer) {
+	var logs bytes.Buffer
+	clock := &fakeClock{t: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	r := NewBridgeRegistry(staleAfter, log.New(&logs, "", 0))
+	r.now = clock.Now
+	return r, clock, &logs
+}
+
+func TestBridgeRegistryStaleness(t *testing.T) {
+	r, clock, logs := newTestBridgeRegistry(time.Minute)
+	var alerts []BridgeStatus
+	r.alert = func(b BridgeStatus) { alerts = append(alerts, b) }
+
+	r.Heartbeat("slack-bridge", "slack", "1.0.0")
+	r.Heartbeat("telegram-bridge", "telegram", "1.0.0")
+
+	clock.Advance(45 * time.Second)
+	r.Heartbeat("telegram-bridge", "telegram", "1.0.0")
+	if stale := r.CheckStale(); len(stale) != 0 {
+		t.Fatalf("CheckStale() = %v before threshold, want none", stale)
+	}
+
+	clock.Advance(30 * time.Second) // slack: 75s, telegram: 30s
+	stale := r.CheckStale()
+	if len(stale) != 1 || stale[0].Name != "slack-bridge" {
+		t.Fatalf("CheckStale() = %v, want slack-bridge", stale)
+	}
+	if len(alerts) != 1 || alerts[0].Name != "slack-bridge" {
+		t.Errorf("alerts = %v, want one for slack-bridge", alerts)
+	}
+	if !strings.Contains(logs.String(), "warning: bridge slack-bridge (slack) has not sent a heartbeat") {
+		t.Errorf("missing stale warning in log: %q", logs.String())
+	}
+
+	list := r.List()
+	if len(list) != 2 || list[0].Name != "slack-bridge" || !list[0].Stale || list[1].Stale {
+		t.Errorf("List() = %+v", list)
+	}
+	if list[0].AgeSeconds != 75 {
+		t.Errorf("AgeSeconds = %v, want 75", list[0].AgeSeconds)
+	}
+	warnings := r.Warnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "slack-bridge (slack) last seen 1m15s ago") {
+		t.Errorf("Warnings() = %v", warnings)
+	}
+
+	// A silence is reported once
+	clock.Advance(time.Minute)
+	if stale := r.CheckStale(); len(stale) != 1 || stale[0].Name != "telegram-bridge" {
+		t.Errorf("CheckStale() = %v, want only telegram-bridge", stale)
+	}
+	if len(alerts) != 2 {
+		t.Errorf("got %d alerts, want 2", len(alerts))
+	}
+
+	// A heartbeat clears the alert so the next silence is reported again
+	r.Heartbeat("slack-bridge", "slack", "1.0.1")
+	if !strings.Contains(logs.String(), "bridge slack-bridge is sending heartbeats again") {
+		t.Errorf("missing recovery message in log: %q", logs.String())
+	}
+	if list := r.List(); list[0].Stale || list[0].Version != "1.0.1" {
+		t.Errorf("after heartbeat List()[0] = %+v", list[0])
+	}
+	clock.Advance(2 * time.Minute)
+	if stale := r.CheckStale(); len(stale) != 1 || stale[0].Name != "slack-bridge" {
+		t.Errorf("CheckStale() = %v, want slack-bridge again", stale)
+	}
+}
+
+func TestBridgeRegistryDefaultThreshold(t *testing.T) {
+	r := NewBridgeRegistry(0, log.New(io.Discard, "", 0))
+	if r.staleAfter != defaultBridgeStaleAfter {
+		t.Errorf("staleAfter = %v, want %v", r.staleAfter, defaultBridgeStaleAfter)
+	}
+}
+
+func TestBridgeHeartbeatAPI(t *testing.T) {
+	api, _ := newTestAPIServer(t, Config{})
+	registry, clock, _ := newTestBridgeRegistry(time.Minute)
+	api.warden.bridges = registry
+	handler := api.server.Handler
+
+	rec := httptest.NewRecorder()
+	body := `{"name":"slack-bridge","type":"slack","version":"1.0.0"}`
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/bridges/heartbeat", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("heartbeat status = %d, want 200", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/bridges/heartbeat", strings.NewReader(`{"type":"slack"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("heartbeat without name status = %d, want 400", rec.Code)
+	}
+
+	readyz := func() []string {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("/readyz status = %d, want 200", rec.Code)
+		}
+		var resp struct {
+			Warnings []string `json:"warnings"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode /readyz: %v", err)
+		}
+		return resp.Warnings
+	}
+
+	if warnings := readyz(); len(warnings) != 0 {
+		t.Errorf("warnings = %v, want none", warnings)
+	}
+	clock.Advance(2 * time.Minute)
+	if warnings := readyz(); len(warnings) != 1 || !strings.Contains(warnings[0], "slack-bridge") {
+		t.Errorf("warnings = %v, want slack-bridge", warnings)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/status", nil))
+	var status struct {
+		Bridges []BridgeStatus `json:"bridges"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatalf("decode /api/status: %v", err)
+	}
+	if len(status.Bridges) != 1 || !status.Bridges[0].Stale {
+		t.Errorf("status bridges = %+v", status.Bridges)
+	}
+}
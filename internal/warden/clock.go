@@ -0,0 +1,32 @@
+package warden
+
+import "time"
+
+// clockSkewTolerance is how far the wall clock may drift from the monotonic
+// clock over an interval before the interval is flagged as skewed.
+const clockSkewTolerance = time.Second
+
+// monoStart anchors monotonicNow.
+var monoStart = time.Now()
+
+// monotonicNow reads the monotonic clock as the time since the warden
+// started. Unlike wall-clock readings, it never goes backwards and does not
+// jump when NTP or an operator steps the clock, so durations and deadlines
+// are measured with it.
+func monotonicNow() time.Duration {
+	return time.Since(monoStart)
+}
+
+// elapsed returns the time between two monotonic readings, never negative,
+// and whether the wall clock moved by a different amount between the
+// matching wall readings, i.e. it was stepped in between.
+func elapsed(monoFrom, monoTo time.Duration, wallFrom, wallTo time.Time) (time.Duration, bool) {
+	d := monoTo - monoFrom
+	if d < 0 {
+		d = 0
+	}
+	// Round(0) strips the monotonic reading time.Now attaches, which Sub
+	// would otherwise use instead of the wall clock
+	drift := wallTo.Round(0).Sub(wallFrom.Round(0)) - d
+	return d, drift > clockSkewTolerance || drift < -clockSkewTolerance
+}
@@ -0,0 +1,285 @@
+package warden
+
+import (
+	"bufio"
+	"clawrden/internal/events"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConsoleReviewer is the reviewer recorded for decisions typed on the
+// warden's console.
+const ConsoleReviewer = "console"
+
+// consolePrompt is shown while the console waits for a decision.
+const consolePrompt = "approve/deny/skip [a/d/s]? "
+
+// consoleWriter serializes the console's output with the warden's log, so
+// log lines never break into a request being shown. A log line printed
+// while a prompt is waiting goes on its own line and the prompt is repeated
+// after it.
+type consoleWriter struct {
+	mu        sync.Mutex
+	out       io.Writer
+	prompting bool
+}
+
+func newConsoleWriter(out io.Writer) *consoleWriter {
+	return &consoleWriter{out: out}
+}
+
+// Write prints log output.
+func (w *consoleWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.prompting {
+		io.WriteString(w.out, "\n")
+	}
+	n, err := w.out.Write(p)
+	if w.prompting {
+		io.WriteString(w.out, consolePrompt)
+	}
+	return n, err
+}
+
+// ask prints text followed by the prompt.
+func (w *consoleWriter) ask(text string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	io.WriteString(w.out, text+consolePrompt)
+	w.prompting = true
+}
+
+// say prints a line, ending a waiting prompt first.
+func (w *consoleWriter) say(format string, args ...interface{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.prompting {
+		io.WriteString(w.out, "\n")
+		w.prompting = false
+	}
+	fmt.Fprintf(w.out, format+"\n", args...)
+}
+
+// answered notes that the operator pressed enter, ending the prompt line.
+func (w *consoleWriter) answered() {
+	w.mu.Lock()
+	w.prompting = false
+	w.mu.Unlock()
+}
+
+// Console lets a single operator decide asks on the terminal the warden
+// runs in. Pending requests are shown one at a time, oldest first, and the
+// answer resolves them through the HITL queue like any other reviewer.
+// Skipped requests stay pending for the API and chat bridges.
+type Console struct {
+	queue *HITLQueue
+	bus   *events.Bus
+	in    io.Reader
+	out   *consoleWriter
+}
+
+// newConsole creates a console reading decisions from in and writing
+// through out, which the warden's log should share.
+func newConsole(queue *HITLQueue, bus *events.Bus, in io.Reader, out *consoleWriter) *Console {
+	return &Console{queue: queue, bus: bus, in: in, out: out}
+}
+
+// newTerminalConsole creates a console on the warden's stdin and stdout,
+// or returns nil if either is not a terminal. A log going to stdout is
+// routed through the console so the two do not interleave.
+func (s *Server) newTerminalConsole() *Console {
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		s.logger.Printf("warning: console disabled: stdin and stdout must be a terminal")
+		return nil
+	}
+	out := newConsoleWriter(os.Stdout)
+	if s.logger.Writer() == os.Stdout {
+		s.logger.SetOutput(out)
+	}
+	s.logger.Printf("console enabled: pending requests are shown here for approval")
+	return newConsole(s.hitl, s.events, os.Stdin, out)
+}
+
+// isTerminal reports whether f is a character device, i.e. an interactive
+// terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Run shows pending requests and applies decisions until ctx ends. It
+// returns when ctx ends even while a read from the terminal is blocked; the
+// reading goroutine is left behind, as such a read cannot be interrupted.
+// When input ends the console stops prompting and returns.
+func (c *Console) Run(ctx context.Context) {
+	changes := make(chan events.Event, 64)
+	unsubscribe := c.bus.Subscribe("console", func(e events.Event) {
+		switch e.(type) {
+		case events.HITLEnqueued, events.HITLResolved:
+			select {
+			case changes <- e:
+			case <-ctx.Done():
+			}
+		}
+	}, events.Async(64))
+	defer unsubscribe()
+
+	lines := make(chan string)
+	go c.read(ctx, lines)
+
+	// Requests already waiting, oldest first; events may repeat some
+	var waiting []string
+	seen := make(map[string]bool)
+	pending := c.queue.List()
+	slices.SortFunc(pending, func(a, b PendingRequest) int { return a.Timestamp.Compare(b.Timestamp) })
+	for _, pr := range pending {
+		waiting = append(waiting, pr.ID)
+		seen[pr.ID] = true
+	}
+
+	current := ""
+	for {
+		for current == "" && len(waiting) > 0 {
+			current, waiting = waiting[0], waiting[1:]
+			if !c.show(current) {
+				current = ""
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+
+		case e := <-changes:
+			switch e := e.(type) {
+			case events.HITLEnqueued:
+				if !seen[e.ID] {
+					seen[e.ID] = true
+					waiting = append(waiting, e.ID)
+				}
+			case events.HITLResolved:
+				delete(seen, e.ID)
+				waiting = slices.DeleteFunc(waiting, func(id string) bool { return id == e.ID })
+				if e.ID == current {
+					c.out.say("[console] %s was %s elsewhere", e.ID, resolvedAs(e))
+					current = ""
+				}
+			}
+
+		case line, ok := <-lines:
+			if !ok {
+				c.out.say("[console] input closed; decide pending requests through the API or a chat bridge")
+				return
+			}
+			c.out.answered()
+			if current == "" {
+				continue
+			}
+			if !c.answer(current, line) {
+				c.out.ask("[console] please answer a (approve), d (deny) or s (skip)\n")
+				continue
+			}
+			current = ""
+		}
+	}
+}
+
+// read sends each line of input to lines, and closes it when input ends.
+func (c *Console) read(ctx context.Context, lines chan<- string) {
+	defer close(lines)
+	scanner := bufio.NewScanner(c.in)
+	for scanner.Scan() {
+		select {
+		case lines <- strings.TrimSpace(scanner.Text()):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// show prints a pending request and the prompt. It reports false if the
+// request is no longer pending.
+func (c *Console) show(id string) bool {
+	pr, ok := c.queue.Get(id)
+	if !ok {
+		return false
+	}
+	req := pr.Request
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n[console] %s: %s\n", pr.ID, shellJoin(append([]string{req.Command}, req.Args...)))
+	details := []string{"cwd " + req.Cwd, fmt.Sprintf("uid %d", req.Identity.UID)}
+	if req.ContainerID != "" {
+		details = append(details, "container "+truncateID(req.ContainerID))
+	}
+	if req.JailID != "" {
+		details = append(details, "jail "+req.JailID)
+	}
+	if pr.Risk != "" {
+		details = append(details, string(pr.Risk)+" risk")
+	}
+	if pr.AutoApproveAt != nil {
+		details = append(details, "approved automatically in "+time.Until(*pr.AutoApproveAt).Round(time.Second).String())
+	}
+	fmt.Fprintf(&b, "  %s\n", strings.Join(details, ", "))
+	c.out.ask(b.String())
+	return true
+}
+
+// answer applies the operator's answer to a request. It reports false if
+// the answer is not one of the choices.
+func (c *Console) answer(id, line string) bool {
+	var decision Decision
+	switch strings.ToLower(line) {
+	case "a", "approve":
+		decision = DecisionApprove
+	case "d", "deny":
+		decision = DecisionDeny
+	case "s", "skip":
+		c.out.say("[console] skipped %s; it stays pending", id)
+		return true
+	default:
+		return false
+	}
+
+	verb := "approved"
+	if decision == DecisionDeny {
+		verb = "denied"
+	}
+	remaining, err := c.queue.Review(id, Review{
+		Decision: decision, Reviewer: ConsoleReviewer, Channel: ChannelConsole,
+		Authenticated: true, // Whoever holds the warden's terminal
+	})
+	switch {
+	case errors.Is(err, errNotPending), errors.Is(err, errAlreadyDecided):
+		c.out.say("[console] %s is no longer pending", id)
+	case err != nil:
+		c.out.say("[console] %s: %v", id, err)
+	case remaining > 0:
+		c.out.say("[console] approval of %s recorded; %d more needed", id, remaining)
+	default:
+		c.out.say("[console] %s %s", verb, id)
+	}
+	return true
+}
+
+// resolvedAs describes how a request left the queue.
+func resolvedAs(e events.HITLResolved) string {
+	switch {
+	case e.Expired:
+		return "abandoned"
+	case e.Automatic:
+		return "approved automatically"
+	case e.Approved:
+		return "approved"
+	}
+	return "denied"
+}
@@ -0,0 +1,209 @@
+package warden
+
+import (
+	"bytes"
+	"clawrden/internal/events"
+	"clawrden/pkg/protocol"
+	"context"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// consoleOutput collects what a console prints.
+type consoleOutput struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (o *consoleOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.Write(p)
+}
+
+func (o *consoleOutput) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.String()
+}
+
+// waitFor waits until the output contains want n times.
+func (o *consoleOutput) waitFor(t *testing.T, want string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for strings.Count(o.String(), want) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("console output lacks %d× %q:\n%s", n, want, o.String())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// consoleHarness runs a console on a queue, with a pipe as its input.
+type consoleHarness struct {
+	queue *HITLQueue
+	input *io.PipeWriter
+	out   *consoleOutput
+	done  chan struct{} // Closed when Run returns
+}
+
+func startConsole(t *testing.T) (*consoleHarness, context.CancelFunc) {
+	t.Helper()
+	bus := events.New(log.New(io.Discard, "", 0))
+	t.Cleanup(bus.Close)
+	queue := NewHITLQueue()
+	queue.events = bus
+
+	in, input := io.Pipe()
+	t.Cleanup(func() { input.Close() })
+	h := &consoleHarness{queue: queue, input: input, out: &consoleOutput{}, done: make(chan struct{})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() {
+		defer close(h.done)
+		newConsole(queue, bus, in, newConsoleWriter(h.out)).Run(ctx)
+	}()
+	return h, cancel
+}
+
+// enqueue queues echo with args and returns its outcome once decided.
+func (h *consoleHarness) enqueue(arg string) <-chan Outcome {
+	outcome := make(chan Outcome, 1)
+	go func() {
+		outcome <- h.queue.EnqueueOutcome(context.Background(), &protocol.Request{Command: "echo", Args: []string{arg}, Cwd: "/app"}, nil)
+	}()
+	return outcome
+}
+
+func (h *consoleHarness) answer(t *testing.T, line string) {
+	t.Helper()
+	if _, err := io.WriteString(h.input, line+"\n"); err != nil {
+		t.Fatalf("write answer: %v", err)
+	}
+}
+
+func waitOutcome(t *testing.T, outcome <-chan Outcome) Outcome {
+	t.Helper()
+	select {
+	case o := <-outcome:
+		return o
+	case <-time.After(5 * time.Second):
+		t.Fatal("request not decided")
+		return Outcome{}
+	}
+}
+
+func TestConsoleDecisions(t *testing.T) {
+	h, _ := startConsole(t)
+
+	first := h.enqueue("first")
+	h.out.waitFor(t, "echo first\n  cwd /app, uid 0\n"+consolePrompt, 1)
+	h.answer(t, "maybe")
+	h.out.waitFor(t, "please answer", 1)
+	h.answer(t, "a")
+	if o := waitOutcome(t, first); o.Decision != DecisionApprove || o.Reviewer != ConsoleReviewer {
+		t.Errorf("first: decision %v, reviewer %q; want approve by console", o.Decision, o.Reviewer)
+	}
+
+	second := h.enqueue("second")
+	h.out.waitFor(t, "echo second", 1)
+	h.answer(t, "deny")
+	if o := waitOutcome(t, second); o.Decision != DecisionDeny || o.Reviewer != ConsoleReviewer {
+		t.Errorf("second: decision %v, reviewer %q; want deny by console", o.Decision, o.Reviewer)
+	}
+
+	// A skipped request stays pending for other reviewers
+	third := h.enqueue("third")
+	h.out.waitFor(t, "echo third", 1)
+	h.answer(t, "s")
+	h.out.waitFor(t, "skipped", 1)
+	if pending := h.queue.List(); len(pending) != 1 || pending[0].Request.Args[0] != "third" {
+		t.Fatalf("pending = %+v, want third", pending)
+	}
+	h.queue.Resolve(h.queue.List()[0].ID, DecisionApprove)
+	if o := waitOutcome(t, third); o.Reviewer != "" {
+		t.Errorf("third: reviewer %q, want none for an API decision", o.Reviewer)
+	}
+}
+
+func TestConsoleShowsRequestsInTurn(t *testing.T) {
+	h, _ := startConsole(t)
+
+	first := h.enqueue("first")
+	h.out.waitFor(t, "echo first", 1)
+	second := h.enqueue("second")
+
+	// The second request waits until the first is decided, even when it
+	// is decided elsewhere
+	time.Sleep(20 * time.Millisecond)
+	if strings.Contains(h.out.String(), "echo second") {
+		t.Fatal("second request shown before the first was decided")
+	}
+	var firstID string
+	for _, pr := range h.queue.List() {
+		if pr.Request.Args[0] == "first" {
+			firstID = pr.ID
+		}
+	}
+	h.queue.Resolve(firstID, DecisionDeny)
+	waitOutcome(t, first)
+	h.out.waitFor(t, firstID+" was denied elsewhere", 1)
+	h.out.waitFor(t, "echo second", 1)
+
+	h.answer(t, "a")
+	if o := waitOutcome(t, second); o.Decision != DecisionApprove {
+		t.Errorf("second: decision %v, want approve", o.Decision)
+	}
+}
+
+func TestConsoleStops(t *testing.T) {
+	t.Run("shutdown while reading", func(t *testing.T) {
+		h, cancel := startConsole(t)
+		h.enqueue("waiting")
+		h.out.waitFor(t, consolePrompt, 1)
+		cancel()
+		select {
+		case <-h.done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("console blocks shutdown while waiting for input")
+		}
+	})
+
+	t.Run("input closed", func(t *testing.T) {
+		h, _ := startConsole(t)
+		h.input.Close()
+		select {
+		case <-h.done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("console still running after its input closed")
+		}
+		if !strings.Contains(h.out.String(), "input closed") {
+			t.Errorf("output = %q, want a note that input closed", h.out.String())
+		}
+	})
+}
+
+func TestConsoleWriterRepeatsPromptAfterLog(t *testing.T) {
+	var out bytes.Buffer
+	w := newConsoleWriter(&out)
+	logger := log.New(w, "[warden] ", 0)
+
+	logger.Printf("before")
+	w.ask("[console] req-1: ls\n")
+	logger.Printf("during")
+	w.answered()
+	logger.Printf("after")
+
+	want := "[warden] before\n" +
+		"[console] req-1: ls\n" + consolePrompt +
+		"\n[warden] during\n" + consolePrompt +
+		"[warden] after\n"
+	if out.String() != want {
+		t.Errorf("output:\n%q\nwant:\n%q", out.String(), want)
+	}
+}
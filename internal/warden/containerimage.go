@@ -0,0 +1,107 @@
+package warden
+
+import (
+	"clawrden/pkg/protocol"
+	"context"
+	"log"
+	"path"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+const (
+	imageInspectTimeout = 2 * time.Second
+	maxCachedImages     = 4096 // Containers whose image is remembered
+)
+
+// ContainerImage is the image a container was created from.
+type ContainerImage struct {
+	Name   string // Image reference the container was created with, e.g. "ghcr.io/acme/agent:1.4"
+	Digest string // Image ID, e.g. "sha256:4f2a..."
+}
+
+// containerInspector is what the image resolver needs from the Docker client.
+type containerInspector interface {
+	ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error)
+}
+
+// ImageResolver looks up the image of the container a request comes from.
+// A container's image cannot change, so results are cached per container
+// ID; failed lookups are not cached and are retried on the next request.
+type ImageResolver struct {
+	inspector containerInspector
+	logger    *log.Logger
+
+	mu    sync.Mutex
+	cache map[string]ContainerImage
+}
+
+// NewImageResolver creates a resolver inspecting containers through inspector.
+func NewImageResolver(inspector containerInspector, logger *log.Logger) *ImageResolver {
+	return &ImageResolver{
+		inspector: inspector,
+		logger:    logger,
+		cache:     make(map[string]ContainerImage),
+	}
+}
+
+// Resolve returns the image of containerID. ok is false when the container
+// cannot be inspected.
+func (r *ImageResolver) Resolve(ctx context.Context, containerID string) (ContainerImage, bool) {
+	r.mu.Lock()
+	img, ok := r.cache[containerID]
+	r.mu.Unlock()
+	if ok {
+		return img, true
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, imageInspectTimeout)
+	defer cancel()
+	info, err := r.inspector.ContainerInspect(ctx, containerID)
+	if err != nil || info.ContainerJSONBase == nil || info.Config == nil {
+		r.logger.Printf("warning: cannot inspect container %s, its image is unknown and image rules do not match: %v", truncateID(containerID), err)
+		return ContainerImage{}, false
+	}
+	img = ContainerImage{Name: info.Config.Image, Digest: info.Image}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.cache) >= maxCachedImages {
+		for id := range r.cache {
+			delete(r.cache, id)
+			break
+		}
+	}
+	r.cache[containerID] = img
+	return img, true
+}
+
+// resolveImage sets the image of the container req comes from, if it can be
+// inspected. Requests from the host have no image.
+func (s *Server) resolveImage(req *protocol.Request) {
+	if req.ContainerID == "" || s.images == nil {
+		return
+	}
+	if img, ok := s.images.Resolve(s.ctx, req.ContainerID); ok {
+		req.Image, req.ImageDigest = img.Name, img.Digest
+	}
+}
+
+// matchImage reports whether the request's image satisfies the rule's image
+// and image_digest conditions. An unknown image satisfies none, so such
+// rules neither allow nor deny requests whose container cannot be inspected.
+func (r Rule) matchImage(req *protocol.Request) bool {
+	if len(r.Image) > 0 && !slices.ContainsFunc(r.Image, func(pattern string) bool {
+		matched, err := path.Match(pattern, req.Image)
+		return req.Image != "" && err == nil && matched
+	}) {
+		return false
+	}
+	if len(r.ImageDigest) > 0 && (req.ImageDigest == "" || !slices.Contains(r.ImageDigest, req.ImageDigest)) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,123 @@
+package warden
+
+import (
+	"clawrden/pkg/protocol"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// fakeInspector answers container inspections from a map and counts them.
+type fakeInspector struct {
+	images map[string]ContainerImage
+	calls  int
+}
+
+func (f *fakeInspector) ContainerInspect(ctx context.Context, id string) (container.InspectResponse, error) {
+	f.calls++
+	img, ok := f.images[id]
+	if !ok {
+		return container.InspectResponse{}, errors.New("no such container: " + id)
+	}
+	return container.InspectResponse{
+		ContainerJSONBase: &container.ContainerJSONBase{ID: id, Image: img.Digest},
+		Config:            &container.Config{Image: img.Name},
+	}, nil
+}
+
+const blessedDigest = "sha256:4f2a0c1e"
+
+func TestImageResolverCaches(t *testing.T) {
+	inspector := &fakeInspector{images: map[string]ContainerImage{
+		"c1": {Name: "ghcr.io/acme/agent:1.4", Digest: blessedDigest},
+	}}
+	r := NewImageResolver(inspector, log.New(io.Discard, "", 0))
+
+	for range 3 {
+		if img, ok := r.Resolve(t.Context(), "c1"); !ok || img.Name != "ghcr.io/acme/agent:1.4" || img.Digest != blessedDigest {
+			t.Fatalf("Resolve(c1) = %+v, %v", img, ok)
+		}
+	}
+	if inspector.calls != 1 {
+		t.Errorf("inspected %d times, want the result cached", inspector.calls)
+	}
+
+	// Failures are retried, and a new container ID is inspected afresh
+	if _, ok := r.Resolve(t.Context(), "c2"); ok {
+		t.Error("Resolve(c2) succeeded for an unknown container")
+	}
+	inspector.images["c2"] = ContainerImage{Name: "node:20", Digest: "sha256:99"}
+	if img, ok := r.Resolve(t.Context(), "c2"); !ok || img.Name != "node:20" {
+		t.Errorf("Resolve(c2) after it appeared = %+v, %v", img, ok)
+	}
+	if inspector.calls != 3 {
+		t.Errorf("inspected %d times, want 3", inspector.calls)
+	}
+}
+
+func TestImageRules(t *testing.T) {
+	pe := &PolicyEngine{config: PolicyConfig{
+		DefaultAction: ActionAsk,
+		Rules: []Rule{
+			{Command: "curl", Action: ActionDeny, Image: []string{"docker.io/library/*"}},
+			{Command: "npm", Action: ActionAllow, Image: []string{"ghcr.io/acme/agent:*"}},
+			{Command: "pip", Action: ActionAllow, ImageDigest: []string{blessedDigest}},
+		},
+	}}
+	tests := []struct {
+		name    string
+		command string
+		image   string
+		digest  string
+		want    Action
+	}{
+		{"blessed image", "npm", "ghcr.io/acme/agent:1.4", "", ActionAllow},
+		{"other image", "npm", "node:20", "", ActionAsk},
+		{"unknown image fails closed for allow", "npm", "", "", ActionAsk},
+		{"pinned digest", "pip", "", blessedDigest, ActionAllow},
+		{"other digest", "pip", "ghcr.io/acme/agent:1.4", "sha256:99", ActionAsk},
+		{"denied image", "curl", "docker.io/library/alpine", "", ActionDeny},
+		{"unknown image fails open for deny", "curl", "", "", ActionAsk},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &protocol.Request{Command: tt.command, Image: tt.image, ImageDigest: tt.digest}
+			if got := pe.Evaluate(req).Action; got != tt.want {
+				t.Errorf("Evaluate = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateImageRules(t *testing.T) {
+	if err := ValidateRules([]Rule{{Command: "npm", Action: ActionAllow, Image: []string{"acme/[agent"}}}); err == nil {
+		t.Error("malformed image pattern accepted")
+	}
+	if err := ValidateRules([]Rule{{Command: "npm", Action: ActionAllow, ImageDigest: []string{"4f2a0c1e"}}}); err == nil {
+		t.Error("image_digest without an algorithm accepted")
+	}
+}
+
+func TestServerResolvesImage(t *testing.T) {
+	srv := newTestServer(t)
+	inspector := &fakeInspector{images: map[string]ContainerImage{
+		"0123456789ab": {Name: "ghcr.io/acme/agent:1.4", Digest: blessedDigest},
+	}}
+	srv.images = NewImageResolver(inspector, srv.logger)
+
+	host := &protocol.Request{Command: "echo"}
+	srv.resolveImage(host)
+	if host.Image != "" || inspector.calls != 0 {
+		t.Errorf("host request: image %q after %d inspections, want none", host.Image, inspector.calls)
+	}
+
+	req := &protocol.Request{Command: "echo", ContainerID: "0123456789ab"}
+	srv.resolveImage(req)
+	if req.Image != "ghcr.io/acme/agent:1.4" || req.ImageDigest != blessedDigest {
+		t.Errorf("image = %q, %q", req.Image, req.ImageDigest)
+	}
+}
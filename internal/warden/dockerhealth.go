@@ -0,0 +1,194 @@
+package warden
+
+import (
+	"clawrden/internal/events"
+	"clawrden/pkg/protocol"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// dockerCommand is the pseudo-command recorded in the audit log for Docker
+// daemon outages.
+const dockerCommand = "clawrden-docker"
+
+// ErrNoContainment is returned for containerized requests while the Docker
+// daemon is unreachable; they are denied rather than run on the host.
+var ErrNoContainment = errors.New("no containment available")
+
+const (
+	defaultDockerPingInterval = 10 * time.Second
+	dockerPingTimeout         = 5 * time.Second
+	dockerRetryMin            = time.Second      // First retry after a failed probe
+	dockerRetryMax            = 30 * time.Second // Backoff ceiling while the daemon is down
+)
+
+// DockerHealth is the Docker daemon's state as last probed.
+type DockerHealth struct {
+	Healthy   bool      `json:"healthy"`
+	Since     time.Time `json:"since"` // When the daemon entered this state
+	LastCheck time.Time `json:"last_check,omitempty"`
+	Failures  int       `json:"failures,omitempty"` // Consecutive failed probes
+	Error     string    `json:"error,omitempty"`    // Last probe error while unhealthy
+}
+
+// dockerPinger is what the supervisor needs from the Docker client.
+type dockerPinger interface {
+	Ping(ctx context.Context) (types.Ping, error)
+}
+
+// apiVersionNegotiator is implemented by Docker clients that cache the
+// daemon's API version, which may change when the daemon is upgraded.
+type apiVersionNegotiator interface {
+	NegotiateAPIVersion(ctx context.Context)
+}
+
+// DockerSupervisor probes the Docker daemon and tracks whether containerized
+// requests can run. While the daemon is down it retries with exponential
+// backoff; on recovery it renegotiates the client's API version.
+type DockerSupervisor struct {
+	pinger   dockerPinger
+	logger   *log.Logger
+	interval time.Duration // Between probes of a healthy daemon
+	retryMin time.Duration
+	retryMax time.Duration
+
+	// onChange is called after every transition, outside the lock. The first
+	// probe only sets the baseline; a daemon down at startup is just logged.
+	onChange func(prev, cur DockerHealth)
+
+	mu     sync.RWMutex
+	health DockerHealth
+	probed bool
+}
+
+// NewDockerSupervisor creates a supervisor for pinger. The daemon is assumed
+// healthy until the first probe says otherwise.
+func NewDockerSupervisor(pinger dockerPinger, interval time.Duration, logger *log.Logger) *DockerSupervisor {
+	if interval <= 0 {
+		interval = defaultDockerPingInterval
+	}
+	return &DockerSupervisor{
+		pinger:   pinger,
+		logger:   logger,
+		interval: interval,
+		retryMin: dockerRetryMin,
+		retryMax: dockerRetryMax,
+		health:   DockerHealth{Healthy: true, Since: time.Now()},
+	}
+}
+
+// Health returns the daemon's current state.
+func (d *DockerSupervisor) Health() DockerHealth {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.health
+}
+
+// Run probes the daemon until ctx is cancelled.
+func (d *DockerSupervisor) Run(ctx context.Context) {
+	for {
+		timer := time.NewTimer(d.Check(ctx))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Check probes the daemon once, records the result, and returns how long to
+// wait before the next probe.
+func (d *DockerSupervisor) Check(ctx context.Context) time.Duration {
+	pingCtx, cancel := context.WithTimeout(ctx, dockerPingTimeout)
+	_, err := d.pinger.Ping(pingCtx)
+	cancel()
+	if err != nil && ctx.Err() != nil {
+		return 0 // Shutting down, not an outage
+	}
+
+	now := time.Now()
+	d.mu.Lock()
+	prev := d.health
+	cur := prev
+	cur.LastCheck = now
+	if err == nil {
+		cur.Failures = 0
+		cur.Error = ""
+	} else {
+		cur.Failures++
+		cur.Error = err.Error()
+	}
+	if cur.Healthy != (err == nil) {
+		cur.Healthy = err == nil
+		cur.Since = now
+	}
+	d.health = cur
+	baseline := !d.probed
+	d.probed = true
+	d.mu.Unlock()
+
+	switch {
+	case baseline && !cur.Healthy:
+		d.logger.Printf("warning: docker daemon unreachable at startup: %s; denying containerized requests until it is reachable", cur.Error)
+	case cur.Healthy != prev.Healthy:
+		if n, ok := d.pinger.(apiVersionNegotiator); ok && cur.Healthy {
+			n.NegotiateAPIVersion(ctx)
+		}
+		if d.onChange != nil {
+			d.onChange(prev, cur)
+		}
+	}
+	if cur.Healthy {
+		return d.interval
+	}
+	return d.retryDelay(cur.Failures)
+}
+
+// retryDelay doubles the wait after each consecutive failure, up to retryMax.
+func (d *DockerSupervisor) retryDelay(failures int) time.Duration {
+	delay := d.retryMin
+	for i := 1; i < failures && delay < d.retryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, d.retryMax)
+}
+
+// dockerHealthChanged announces a Docker outage starting or ending: a log
+// line, an audit entry and a DockerHealthChanged event for notifiers.
+func (s *Server) dockerHealthChanged(prev, cur DockerHealth) {
+	entry := AuditEntry{Command: dockerCommand}
+	var outage time.Duration
+	if cur.Healthy {
+		outage = cur.Since.Sub(prev.Since)
+		s.logger.Printf("docker daemon reachable again after %s; containerized requests resume", outage.Round(time.Second))
+		entry.Args = []string{"outage", "end"}
+		entry.Decision, entry.Detail = protocol.DecisionEvent, "docker recovered"
+		entry.Duration = float64(outage.Milliseconds())
+	} else {
+		s.logger.Printf("warning: docker daemon unreachable: %s; denying containerized requests until it returns", cur.Error)
+		entry.Args = []string{"outage", "start"}
+		entry.Decision, entry.Detail = protocol.DecisionEvent, "docker unreachable"
+		entry.Error = cur.Error
+	}
+	s.record(entry)
+	s.events.Publish(events.DockerHealthChanged{Healthy: cur.Healthy, Error: cur.Error, Outage: outage})
+}
+
+// containment reports why a request cannot be contained, or nil if it can.
+// Requests from containers need a reachable Docker daemon.
+func (s *Server) containment(req *protocol.Request) error {
+	if req.ContainerID == "" || s.dockerExec == nil || s.docker == nil {
+		return nil
+	}
+	if h := s.docker.Health(); !h.Healthy {
+		return fmt.Errorf("%w: docker daemon unreachable since %s: %s", ErrNoContainment, h.Since.Format(time.RFC3339), h.Error)
+	}
+	return nil
+}
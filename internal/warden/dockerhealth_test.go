@@ -0,0 +1,193 @@
+package warden
+
+import (
+	"clawrden/internal/events"
+	"clawrden/internal/executor"
+	"clawrden/pkg/protocol"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// flakyDocker is a Docker client whose daemon is down for a number of pings.
+type flakyDocker struct {
+	executor.DockerAPI // Unused container calls panic
+
+	down       int // Pings left to fail
+	negotiated int
+}
+
+func (f *flakyDocker) Ping(ctx context.Context) (types.Ping, error) {
+	if f.down > 0 {
+		f.down--
+		return types.Ping{}, errors.New("Cannot connect to the Docker daemon")
+	}
+	return types.Ping{APIVersion: "1.47"}, nil
+}
+
+func (f *flakyDocker) NegotiateAPIVersion(ctx context.Context) {
+	f.negotiated++
+}
+
+func TestDockerSupervisorBackoffAndRecovery(t *testing.T) {
+	docker := &flakyDocker{}
+	sup := NewDockerSupervisor(docker, 10*time.Second, log.New(io.Discard, "", 0))
+	var transitions []bool
+	sup.onChange = func(prev, cur DockerHealth) { transitions = append(transitions, cur.Healthy) }
+
+	if got := sup.Check(context.Background()); got != 10*time.Second {
+		t.Errorf("healthy daemon: next probe in %s, want 10s", got)
+	}
+	docker.down = 6
+	wantDelays := []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 30 * time.Second, // Down, backing off
+		10 * time.Second, // Recovered
+	}
+	for i, want := range wantDelays {
+		if got := sup.Check(context.Background()); got != want {
+			t.Errorf("check %d: next probe in %s, want %s", i+1, got, want)
+		}
+		if i == 0 {
+			if h := sup.Health(); h.Healthy || h.Failures != 1 || !strings.Contains(h.Error, "Cannot connect") {
+				t.Errorf("health after first failure = %+v", h)
+			}
+		}
+	}
+
+	if h := sup.Health(); !h.Healthy || h.Failures != 0 || h.Error != "" {
+		t.Errorf("health after recovery = %+v", h)
+	}
+	if len(transitions) != 2 || transitions[0] || !transitions[1] {
+		t.Errorf("transitions = %v, want [false true]", transitions)
+	}
+	if docker.negotiated != 1 {
+		t.Errorf("API version negotiated %d times, want once on recovery", docker.negotiated)
+	}
+}
+
+func TestDockerSupervisorIgnoresShutdown(t *testing.T) {
+	sup := NewDockerSupervisor(&flakyDocker{down: 1}, time.Second, log.New(io.Discard, "", 0))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sup.Check(ctx)
+	if !sup.Health().Healthy {
+		t.Error("a cancelled probe marked the daemon unhealthy")
+	}
+}
+
+func TestDockerSupervisorDownAtStartup(t *testing.T) {
+	var logs strings.Builder
+	sup := NewDockerSupervisor(&flakyDocker{down: 1}, time.Second, log.New(&logs, "", 0))
+	changes := 0
+	sup.onChange = func(prev, cur DockerHealth) { changes++ }
+
+	sup.Check(context.Background())
+	if sup.Health().Healthy || changes != 0 || !strings.Contains(logs.String(), "unreachable at startup") {
+		t.Errorf("after failed first probe: health %+v, %d changes, logs %q", sup.Health(), changes, logs.String())
+	}
+	sup.Check(context.Background())
+	if !sup.Health().Healthy || changes != 1 {
+		t.Errorf("after recovery: health %+v, %d changes, want 1", sup.Health(), changes)
+	}
+}
+
+// newDockerTestServer returns a server with a Docker executor on docker,
+// collecting its audit entries.
+func newDockerTestServer(t *testing.T, docker *flakyDocker) (*Server, *[]AuditEntry) {
+	t.Helper()
+	srv := newTestServer(t)
+	srv.events = events.New(log.New(io.Discard, "", 0))
+	t.Cleanup(srv.events.Close)
+	var audited []AuditEntry
+	srv.events.Subscribe("test", func(e events.Event) {
+		if a, ok := e.(Audited); ok {
+			audited = append(audited, a.Entry)
+		}
+	})
+	srv.dockerExec = executor.NewDockerExecutor(docker, srv.logger)
+	srv.docker = NewDockerSupervisor(docker, time.Second, srv.logger)
+	srv.docker.onChange = srv.dockerHealthChanged
+	srv.docker.Check(context.Background())
+	return srv, &audited
+}
+
+func TestDockerOutageDeniesContainerizedRequests(t *testing.T) {
+	docker := &flakyDocker{}
+	srv, audited := newDockerTestServer(t, docker)
+	docker.down = 1
+	srv.docker.Check(context.Background())
+
+	if err := srv.containment(&protocol.Request{Command: "ls"}); err != nil {
+		t.Errorf("host request refused: %v", err)
+	}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	ack := make(chan byte, 1)
+	go func() {
+		b, _ := protocol.ReadAck(client)
+		ack <- b
+		protocol.ReadDenial(client) // Drain the frames that follow the denial
+	}()
+	entry := AuditEntry{Command: "npm"}
+	req := &protocol.Request{Command: "npm", ContainerID: "abc123"}
+	if !srv.refuseUncontained(server, req, &entry, nil, false) {
+		t.Fatal("containerized request was not refused during the outage")
+	}
+	if got := <-ack; got != protocol.AckDenied {
+		t.Errorf("ack = %d, want denied", got)
+	}
+	if entry.Decision != protocol.DecisionDeny || entry.Outcome != protocol.OutcomeNoContainment || !strings.Contains(entry.Error, ErrNoContainment.Error()) {
+		t.Errorf("audit entry = %+v", entry)
+	}
+
+	srv.docker.Check(context.Background())
+	if srv.refuseUncontained(server, req, &AuditEntry{}, nil, false) {
+		t.Error("request refused after Docker recovered")
+	}
+
+	var decisions []string
+	for _, e := range *audited {
+		if e.Command == dockerCommand {
+			decisions = append(decisions, e.DecisionLabel())
+		}
+	}
+	if strings.Join(decisions, ",") != "docker unreachable,docker recovered" {
+		t.Errorf("docker audit entries = %v", decisions)
+	}
+}
+
+func TestReadyzReportsDockerOutage(t *testing.T) {
+	api, _ := newTestAPIServer(t, Config{})
+	api.warden.docker = NewDockerSupervisor(&flakyDocker{down: 1}, time.Second, log.New(io.Discard, "", 0))
+
+	readyz := func() (resp struct {
+		Docker   DockerHealth `json:"docker"`
+		Warnings []string     `json:"warnings"`
+	}) {
+		rec := httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode /readyz: %v", err)
+		}
+		return resp
+	}
+
+	if resp := readyz(); !resp.Docker.Healthy || len(resp.Warnings) != 0 {
+		t.Errorf("before the outage: %+v", resp)
+	}
+	api.warden.docker.Check(context.Background())
+	if resp := readyz(); resp.Docker.Healthy || len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], "docker daemon unreachable") {
+		t.Errorf("during the outage: %+v", resp)
+	}
+}
@@ -1,6 +1,7 @@
 package warden
 
 import (
+	"clawrden/pkg/protocol"
 	"strings"
 )
 
@@ -8,24 +9,9 @@ import (
 // The Warden must filter the Prisoner's environment to prevent
 // confused deputy attacks and privilege escalation.
 
-// envAllowlist contains variables that are safe to pass through.
-var envAllowlist = map[string]bool{
-	"PATH":     true,
-	"LANG":     true,
-	"LANGUAGE": true,
-	"LC_ALL":   true,
-	"TERM":     true,
-	"HOME":     true,
-	"USER":     true,
-	"SHELL":    true,
-	"NODE_ENV": true,
-	"GOPATH":   true,
-	"GOROOT":   true,
-	"PYTHONPATH": true,
-}
-
 // envBlocklist contains variables that must NEVER be passed through,
-// even if they appear in the allowlist (belt-and-suspenders).
+// even if they appear in the allowlist, protocol.EnvPassesThrough
+// (belt-and-suspenders).
 var envBlocklist = map[string]bool{
 	"LD_PRELOAD":    true,
 	"LD_LIBRARY_PATH": true,
@@ -37,26 +23,48 @@ var envBlocklist = map[string]bool{
 	"CLAWRDEN_SOCKET": true, // Prevent the prisoner from discovering/manipulating our socket
 }
 
+// EnvReport summarizes what ScrubEnvironment did to a request's environment.
+// It holds variable names only, never values, so it is safe to show reviewers.
+type EnvReport struct {
+	Blocked        []string `json:"blocked,omitempty"`         // Dropped by the blocklist
+	NotAllowlisted []string `json:"not_allowlisted,omitempty"` // Dropped for not being allowlisted
+	Passed         []string `json:"passed,omitempty"`          // Passed through to the command
+}
+
+// Dropped returns the names of all dropped variables.
+func (r *EnvReport) Dropped() []string {
+	dropped := make([]string, 0, len(r.Blocked)+len(r.NotAllowlisted))
+	dropped = append(dropped, r.Blocked...)
+	return append(dropped, r.NotAllowlisted...)
+}
+
 // ScrubEnvironment filters environment variables through the allowlist
-// and blocklist to prevent security issues.
-func ScrubEnvironment(env []string) []string {
+// and blocklist to prevent security issues. The report lists which
+// variables were dropped and why.
+func ScrubEnvironment(env []string) ([]string, EnvReport) {
 	scrubbed := make([]string, 0, len(env))
+	var report EnvReport
 
 	for _, entry := range env {
 		key := envKey(entry)
 
 		// Check blocklist first (highest priority)
 		if envBlocklist[key] {
+			report.Blocked = append(report.Blocked, key)
 			continue
 		}
 
-		// Only pass through allowlisted variables
-		if envAllowlist[key] {
+		// Only pass through allowlisted variables (shims send just the
+		// names of the others)
+		if protocol.EnvPassesThrough(key) {
 			scrubbed = append(scrubbed, entry)
+			report.Passed = append(report.Passed, key)
+		} else {
+			report.NotAllowlisted = append(report.NotAllowlisted, key)
 		}
 	}
 
-	return scrubbed
+	return scrubbed, report
 }
 
 // envKey extracts the key from a "KEY=VALUE" environment entry.
@@ -0,0 +1,79 @@
+package warden
+
+import (
+	"clawrden/pkg/protocol"
+	"net"
+	"strings"
+	"testing"
+)
+
+// runForStdout runs req through the server and returns its stdout.
+func runForStdout(t *testing.T, srv *Server, req *protocol.Request) string {
+	t.Helper()
+	client, server := net.Pipe()
+	defer client.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.handleConnection(server)
+	}()
+	if err := protocol.WriteRequest(client, req); err != nil {
+		t.Fatalf("write request: %v", err)
+	}
+	if ack, err := protocol.ReadAck(client); err != nil || ack != protocol.AckAllowed {
+		t.Fatalf("ack %d, %v", ack, err)
+	}
+	var stdout strings.Builder
+	for {
+		f, err := protocol.ReadFrame(client)
+		if err != nil {
+			t.Fatalf("read frame: %v", err)
+		}
+		if f.Type == protocol.StreamStdout {
+			stdout.Write(f.Payload)
+		}
+		if f.Type == protocol.StreamExit {
+			break
+		}
+	}
+	client.Close()
+	<-done
+	return stdout.String()
+}
+
+func TestEnvironmentMarker(t *testing.T) {
+	policy, err := ParsePolicy([]byte(`
+default_action: deny
+rules:
+  - command: env
+    action: allow
+  - command: printenv
+    action: allow
+    mark_environment: false
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, _ := newMaintenanceTestServer(t, nil)
+	srv.setPolicy(policy)
+
+	cwd := t.TempDir() // Within the default allowed_paths
+	env := []string{"PATH=/usr/bin:/bin", "CLAWRDEN=0", "CLAWRDEN_STRATEGY=ghost"}
+	marked := runForStdout(t, srv, &protocol.Request{Command: "env", Env: env, Cwd: cwd})
+	for _, want := range []string{"\nCLAWRDEN=1\n", "\nCLAWRDEN_STRATEGY=local\n", "\nCLAWRDEN_REQUEST_ID=req-"} {
+		if !strings.Contains("\n"+marked, want) {
+			t.Errorf("env output lacks %q:\n%s", strings.TrimSpace(want), marked)
+		}
+	}
+	if strings.Contains(marked, "CLAWRDEN=0") || strings.Contains(marked, "CLAWRDEN_STRATEGY=ghost") {
+		t.Errorf("agent's values not replaced:\n%s", marked)
+	}
+
+	unmarked := runForStdout(t, srv, &protocol.Request{Command: "printenv", Env: env, Cwd: cwd})
+	if strings.Contains(unmarked, "CLAWRDEN") {
+		t.Errorf("mark_environment: false still marked the environment:\n%s", unmarked)
+	}
+	if !strings.Contains(unmarked, "PATH=/usr/bin:/bin") {
+		t.Errorf("printenv output lacks PATH:\n%s", unmarked)
+	}
+}
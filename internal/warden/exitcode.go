@@ -0,0 +1,34 @@
+package warden
+
+import (
+	"clawrden/pkg/protocol"
+	"net"
+)
+
+// legacyExitConn sits between the executors and a shim older than
+// protocol.ExitCodeVersion, which reads only the first byte of an exit
+// frame, and sends it each exit code as that single byte (see
+// protocol.ExitStatus). Like the other frame-aware connections, it relies
+// on protocol.WriteFrame writing a whole frame at once.
+type legacyExitConn struct {
+	net.Conn
+}
+
+// forShimVersion wraps conn for a shim of the given protocol version.
+func forShimVersion(conn net.Conn, version int) net.Conn {
+	if version >= protocol.ExitCodeVersion {
+		return conn
+	}
+	return &legacyExitConn{Conn: conn}
+}
+
+func (c *legacyExitConn) Write(b []byte) (int, error) {
+	if len(b) <= protocol.FrameHeaderSize || b[0] != protocol.StreamExit {
+		return c.Conn.Write(b)
+	}
+	code := protocol.ParseExitCode(protocol.Frame{Payload: b[protocol.FrameHeaderSize:]})
+	if err := protocol.WriteFrame(c.Conn, protocol.Frame{Type: protocol.StreamExit, Payload: []byte{byte(protocol.ExitStatus(code))}}); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
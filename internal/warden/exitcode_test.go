@@ -0,0 +1,39 @@
+package warden
+
+import (
+	"clawrden/pkg/protocol"
+	"net"
+	"testing"
+)
+
+func TestExitCodeForShimVersion(t *testing.T) {
+	tests := []struct {
+		version int
+		code    int
+		want    []byte
+	}{
+		{protocol.ExitCodeVersion, 512, []byte{0, 0, 2, 0}},
+		{protocol.ExitCodeVersion, -1, []byte{0xff, 0xff, 0xff, 0xff}},
+		{protocol.ExitCodeVersion - 1, 3, []byte{3}},
+		{protocol.ExitCodeVersion - 1, 512, []byte{1}}, // Not success
+		{0, -1, []byte{255}},
+	}
+	for _, tt := range tests {
+		client, server := net.Pipe()
+		conn := forShimVersion(server, tt.version)
+		go func() {
+			protocol.WriteFrame(conn, protocol.Frame{Type: protocol.StreamStdout, Payload: []byte("out\n")})
+			protocol.WriteExitCode(conn, tt.code)
+			server.Close()
+		}()
+
+		if f, err := protocol.ReadFrame(client); err != nil || string(f.Payload) != "out\n" {
+			t.Errorf("v%d: output frame = %+v, %v; want it unchanged", tt.version, f, err)
+		}
+		f, err := protocol.ReadFrame(client)
+		if err != nil || f.Type != protocol.StreamExit || string(f.Payload) != string(tt.want) {
+			t.Errorf("v%d, exit %d: frame = %+v, %v; want payload %v", tt.version, tt.code, f, err, tt.want)
+		}
+		client.Close()
+	}
+}
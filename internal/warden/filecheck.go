@@ -0,0 +1,56 @@
+package warden
+
+import (
+	"clawrden/internal/securefile"
+	"fmt"
+)
+
+// FileCheckMode is what the warden does when its policy file or audit log
+// could have been swapped by an untrusted user (see securefile.Check).
+type FileCheckMode string
+
+const (
+	// FileCheckWarn logs a SECURITY warning and carries on.
+	FileCheckWarn FileCheckMode = "warn"
+
+	// FileCheckStrict refuses to start, and refuses policy reloads, until
+	// the files are fixed.
+	FileCheckStrict FileCheckMode = "strict"
+
+	// FileCheckOff skips the checks.
+	FileCheckOff FileCheckMode = "off"
+)
+
+// Valid reports whether m is a known check mode.
+func (m FileCheckMode) Valid() bool {
+	switch m {
+	case FileCheckWarn, FileCheckStrict, FileCheckOff:
+		return true
+	}
+	return false
+}
+
+// checkTrustedFile checks a file the warden relies on, described by what
+// (e.g. "policy file"). It returns an error only in strict mode; otherwise
+// problems are logged.
+func checkTrustedFile(cfg Config, what, path string) error {
+	mode := cfg.FileCheckMode
+	if mode == "" {
+		mode = FileCheckWarn
+	}
+	if mode == FileCheckOff || path == "" {
+		return nil
+	}
+
+	exp := cfg.FileExpectations
+	exp.AllowMissing = true // Missing files are handled where they are opened
+	err := securefile.Check(path, exp)
+	if err == nil {
+		return nil
+	}
+	if mode == FileCheckStrict {
+		return fmt.Errorf("untrusted %s %w", what, err)
+	}
+	cfg.Logger.Printf("SECURITY: untrusted %s %v (start with -file-check strict to refuse it)", what, err)
+	return nil
+}
@@ -0,0 +1,46 @@
+package warden
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckTrustedFile(t *testing.T) {
+	dir := t.TempDir()
+	audit := filepath.Join(dir, "audit.log")
+	if err := os.Symlink("/dev/null", audit); err != nil {
+		t.Fatal(err)
+	}
+	policy := filepath.Join(dir, "policy.yaml")
+	writeTestFile(t, policy, "default_action: deny\n")
+
+	var buf bytes.Buffer
+	cfg := Config{Logger: log.New(&buf, "", 0)}
+	for _, mode := range []FileCheckMode{"", FileCheckWarn, FileCheckStrict, FileCheckOff} {
+		buf.Reset()
+		cfg.FileCheckMode = mode
+		err := checkTrustedFile(cfg, "audit log", audit)
+		switch mode {
+		case FileCheckStrict:
+			if err == nil || !strings.Contains(err.Error(), "untrusted audit log "+audit+": is a symlink to /dev/null") {
+				t.Errorf("strict: %v", err)
+			}
+		case FileCheckOff:
+			if err != nil || buf.Len() > 0 {
+				t.Errorf("off: %v, logged %q", err, buf.String())
+			}
+		default:
+			if err != nil || !strings.Contains(buf.String(), "SECURITY: untrusted audit log") {
+				t.Errorf("warn mode %q: %v, logged %q", mode, err, buf.String())
+			}
+		}
+
+		if err := checkTrustedFile(cfg, "policy file", policy); err != nil {
+			t.Errorf("mode %q refused a sound policy file: %v", mode, err)
+		}
+	}
+}
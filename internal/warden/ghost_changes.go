@@ -0,0 +1,75 @@
+package warden
+
+import (
+	"clawrden/internal/executor"
+	"clawrden/pkg/protocol"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// maxChangedPaths bounds the changed paths listed for one execution.
+const maxChangedPaths = 50
+
+// snapshotTimeout bounds each workspace snapshot. Snapshots run outside the
+// request's own time limits, so a command that timed out is still compared.
+const snapshotTimeout = 2 * time.Minute
+
+// workspaceSnapshotter snapshots the workspace ghost containers see.
+// *executor.DockerExecutor implements it; tests use fakes.
+type workspaceSnapshotter interface {
+	SnapshotWorkspace(ctx context.Context, req *protocol.Request, t executor.ChangeTracking) (executor.Manifest, error)
+}
+
+// trackChanges snapshots the workspace before a ghost command runs, if the
+// ghost policy tracks its changes, and returns a function that compares it
+// with the workspace afterwards and records the result on entry and the
+// execution's details. Sandboxed commands never touch the workspace and are
+// not tracked. policy is the policy in force for the request.
+func (s *Server) trackChanges(policy *PolicyEngine, req *protocol.Request, strategy executor.Strategy, sandboxed bool) func(entry *AuditEntry) {
+	if strategy != executor.StrategyGhost || sandboxed || s.snapshots == nil {
+		return func(*AuditEntry) {}
+	}
+	tracking, ok := policy.ChangeTracking(req.Command)
+	if !ok {
+		return func(*AuditEntry) {}
+	}
+
+	before, err := s.snapshot(req, tracking)
+	return func(entry *AuditEntry) {
+		var changes *executor.ChangeSummary
+		if err == nil {
+			var after executor.Manifest
+			if after, err = s.snapshot(req, tracking); err == nil {
+				changes = executor.DiffManifests(before, after, maxChangedPaths)
+			}
+		}
+		if err != nil {
+			if !errors.Is(err, executor.ErrWorkspaceTooLarge) {
+				s.logger.Printf("warning: could not track changes of %s: %v", req.Command, err)
+			}
+			changes = &executor.ChangeSummary{Skipped: err.Error()}
+		}
+
+		if tracking.MaxFilesChanged > 0 && changes.Total() > tracking.MaxFilesChanged {
+			changes.MaxFilesChanged, changes.Exceeded = tracking.MaxFilesChanged, true
+			reason := fmt.Sprintf("ghost %s changed %d files, over its max_files_changed of %d",
+				req.Command, changes.Total(), tracking.MaxFilesChanged)
+			s.logger.Printf("SECURITY: %s", reason)
+			s.openIncident(s.incidents.ObserveFilesChanged(policy.Incidents(), req, reason))
+		}
+
+		entry.Changes = changes
+		if s.outputs != nil {
+			s.outputs.setChanges(entry.RequestID, changes)
+		}
+	}
+}
+
+// snapshot takes one workspace snapshot within snapshotTimeout.
+func (s *Server) snapshot(req *protocol.Request, t executor.ChangeTracking) (executor.Manifest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), snapshotTimeout)
+	defer cancel()
+	return s.snapshots.SnapshotWorkspace(ctx, req, t)
+}
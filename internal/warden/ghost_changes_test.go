@@ -0,0 +1,168 @@
+package warden
+
+import (
+	"clawrden/internal/executor"
+	"clawrden/pkg/protocol"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// dirSnapshotter snapshots a directory on the host, as the Docker executor
+// does for a workspace mounted on the warden.
+type dirSnapshotter struct {
+	dir string
+}
+
+func (d dirSnapshotter) SnapshotWorkspace(_ context.Context, _ *protocol.Request, t executor.ChangeTracking) (executor.Manifest, error) {
+	return executor.ScanManifest(d.dir, t)
+}
+
+func TestPolicyChangeTracking(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writeTestFile(t, path, `default_action: deny
+rules: []
+ghost:
+  defaults:
+    max_files_changed: 500
+  commands:
+    npm:
+      track_changes: true
+    pip:
+      track_changes: true
+      track_max_files: 1000
+      max_files_changed: 0
+`)
+	policy, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+
+	tests := []struct {
+		command string
+		want    executor.ChangeTracking
+		wantOK  bool
+	}{
+		{"npm", executor.ChangeTracking{MaxFilesChanged: 500}, true},
+		{"pip", executor.ChangeTracking{MaxFiles: 1000}, true},
+		{"python", executor.ChangeTracking{MaxFilesChanged: 500}, false},
+	}
+	for _, tt := range tests {
+		if got, ok := policy.ChangeTracking(tt.command); !reflect.DeepEqual(got, tt.want) || ok != tt.wantOK {
+			t.Errorf("ChangeTracking(%s) = %+v, %v; want %+v, %v", tt.command, got, ok, tt.want, tt.wantOK)
+		}
+	}
+
+	for _, bad := range []string{
+		"ghost:\n  defaults:\n    track_max_files: 0\n",
+		"ghost:\n  commands:\n    npm:\n      max_files_changed: -1\n",
+	} {
+		writeTestFile(t, path, "default_action: deny\nrules: []\n"+bad)
+		if _, err := LoadPolicy(path); err == nil {
+			t.Errorf("LoadPolicy accepted %q", bad)
+		}
+	}
+}
+
+func TestTrackChanges(t *testing.T) {
+	workspace := t.TempDir()
+	writeTestFile(t, filepath.Join(workspace, "package.json"), `{"name":"app"}`)
+	writeTestFile(t, filepath.Join(workspace, "README.md"), "hello")
+
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writeTestFile(t, path, `default_action: deny
+rules: []
+incidents:
+  files_changed: true
+ghost:
+  commands:
+    npm:
+      track_changes: true
+      max_files_changed: 2
+`)
+	policy, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+	srv := newTestServer(t)
+	srv.setPolicy(policy)
+	srv.snapshots = dirSnapshotter{dir: workspace}
+	srv.incidents = NewIncidentTracker()
+	srv.outputs = NewOutputRegistry()
+
+	req := &protocol.Request{Command: "npm", Args: []string{"install"}, ContainerID: "abc123"}
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	_, done := srv.outputs.start("req-1", req, c1)
+
+	// Untracked commands and strategies take no snapshot
+	for _, untracked := range []func(*AuditEntry){
+		srv.trackChanges(policy, &protocol.Request{Command: "python"}, executor.StrategyGhost, false),
+		srv.trackChanges(policy, req, executor.StrategyMirror, false),
+		srv.trackChanges(policy, req, executor.StrategyGhost, true),
+	} {
+		var entry AuditEntry
+		untracked(&entry)
+		if entry.Changes != nil {
+			t.Errorf("untracked execution has changes %+v", entry.Changes)
+		}
+	}
+
+	recordChanges := srv.trackChanges(policy, req, executor.StrategyGhost, false)
+	writeTestFile(t, filepath.Join(workspace, "node_modules", "left-pad", "index.js"), "module.exports = 1")
+	writeTestFile(t, filepath.Join(workspace, "package.json"), `{"name":"app","dependencies":{"left-pad":"1"}}`)
+	os.Remove(filepath.Join(workspace, "README.md"))
+	entry := AuditEntry{RequestID: "req-1", Command: "npm"}
+	recordChanges(&entry)
+	done()
+
+	want := &executor.ChangeSummary{
+		Added:    1,
+		Modified: 1,
+		Deleted:  1,
+		Paths: []executor.FileChange{
+			{Path: "README.md", Change: executor.FileDeleted},
+			{Path: "node_modules/left-pad/index.js", Change: executor.FileAdded},
+			{Path: "package.json", Change: executor.FileModified},
+		},
+		MaxFilesChanged: 2,
+		Exceeded:        true,
+	}
+	if !reflect.DeepEqual(entry.Changes, want) {
+		t.Errorf("Changes = %+v, want %+v", entry.Changes, want)
+	}
+	if info := srv.outputs.List(); len(info) != 1 || !reflect.DeepEqual(info[0].Changes, want) {
+		t.Errorf("execution details = %+v, want the changes", info)
+	}
+	incidents := srv.incidents.List()
+	if len(incidents) != 1 || incidents[0].Trigger != IncidentTriggerFilesChanged || !strings.Contains(incidents[0].Reason, "changed 3 files") {
+		t.Errorf("incidents = %+v, want one for the files changed", incidents)
+	}
+}
+
+func TestTrackChangesSkipsLargeWorkspaces(t *testing.T) {
+	workspace := t.TempDir()
+	for _, name := range []string{"a", "b", "c"} {
+		writeTestFile(t, filepath.Join(workspace, name), name)
+	}
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writeTestFile(t, path, "default_action: deny\nrules: []\nghost:\n  defaults:\n    track_changes: true\n    track_max_files: 2\n")
+	policy, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+	srv := newTestServer(t)
+	srv.setPolicy(policy)
+	srv.snapshots = dirSnapshotter{dir: workspace}
+
+	var entry AuditEntry
+	srv.trackChanges(policy, &protocol.Request{Command: "npm"}, executor.StrategyGhost, false)(&entry)
+	if entry.Changes == nil || !strings.Contains(entry.Changes.Skipped, "too large") || entry.Changes.Total() != 0 {
+		t.Errorf("Changes = %+v, want tracking skipped", entry.Changes)
+	}
+}
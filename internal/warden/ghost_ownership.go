@@ -0,0 +1,55 @@
+package warden
+
+import (
+	"clawrden/internal/executor"
+	"clawrden/pkg/protocol"
+	"context"
+	"net"
+	"time"
+)
+
+// ownershipFixTimeout bounds each ownership fix. Like snapshots, fixes run
+// outside the request's own time limits.
+const ownershipFixTimeout = 2 * time.Minute
+
+// ownershipFixer gives workspace files written by ghost commands back to
+// the requester. *executor.DockerExecutor implements it; tests use fakes.
+type ownershipFixer interface {
+	FixOwnership(ctx context.Context, req *protocol.Request, fix executor.OwnershipFix, since time.Time) (int, error)
+}
+
+// withOwnershipFix runs a ghost command through run, then gives the
+// workspace files the policy's ownership_fix selects to the requester,
+// holding back the command's exit code until they are, so the agent never
+// finds its own files owned by root. The fix is recorded on entry. Sandboxed
+// commands never touch the workspace and are not fixed. policy is the
+// policy in force for the request.
+func (s *Server) withOwnershipFix(policy *PolicyEngine, req *protocol.Request, strategy executor.Strategy, sandboxed bool, entry *AuditEntry, conn net.Conn, run func(net.Conn) error) error {
+	if strategy != executor.StrategyGhost || sandboxed || s.ownership == nil {
+		return run(conn)
+	}
+	fix := policy.OwnershipFix(req.Command)
+	if fix == executor.OwnershipFixNone {
+		return run(conn)
+	}
+
+	since := time.Now()
+	held := &hookConn{Conn: conn}
+	err := run(held)
+
+	ctx, cancel := context.WithTimeout(context.Background(), ownershipFixTimeout)
+	fixed, fixErr := s.ownership.FixOwnership(ctx, req, fix, since)
+	cancel()
+	entry.OwnershipFix = &executor.OwnershipFixed{Mode: fix, Files: fixed}
+	if fixErr != nil {
+		s.logger.Printf("warning: could not fix ownership after %s: %v", req.Command, fixErr)
+		entry.OwnershipFix.Error = fixErr.Error()
+	}
+
+	if code, ok := held.exitCode(); ok {
+		if werr := protocol.WriteExitCode(conn, code); err == nil {
+			err = werr
+		}
+	}
+	return err
+}
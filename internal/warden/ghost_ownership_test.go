@@ -0,0 +1,156 @@
+package warden
+
+import (
+	"clawrden/internal/executor"
+	"clawrden/pkg/protocol"
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// orderLog records what happened, in order, across goroutines.
+type orderLog struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *orderLog) add(event string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, event)
+}
+
+// logFixer records each fix in log and reports fixing files files.
+type logFixer struct {
+	log   *orderLog
+	files int
+	err   error
+	fixes []executor.OwnershipFix
+}
+
+func (f *logFixer) FixOwnership(_ context.Context, _ *protocol.Request, fix executor.OwnershipFix, since time.Time) (int, error) {
+	f.log.add("fix")
+	f.fixes = append(f.fixes, fix)
+	return f.files, f.err
+}
+
+func TestPolicyOwnershipFix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writeTestFile(t, path, `default_action: deny
+rules: []
+ghost:
+  defaults:
+    ownership_fix: none
+  commands:
+    npm:
+      ownership_fix: all
+    pip:
+      track_changes: true
+`)
+	policy, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+	for command, want := range map[string]executor.OwnershipFix{"npm": executor.OwnershipFixAll, "pip": executor.OwnershipFixNone} {
+		if got := policy.OwnershipFix(command); got != want {
+			t.Errorf("OwnershipFix(%s) = %q, want %q", command, got, want)
+		}
+	}
+
+	writeTestFile(t, path, "default_action: deny\nrules: []\n")
+	if policy, err = LoadPolicy(path); err != nil || policy.OwnershipFix("npm") != executor.OwnershipFixChanged {
+		t.Errorf("default ownership fix = %q, %v; want changed", policy.OwnershipFix("npm"), err)
+	}
+
+	writeTestFile(t, path, "default_action: deny\nrules: []\nghost:\n  defaults:\n    ownership_fix: chown\n")
+	if _, err := LoadPolicy(path); err == nil {
+		t.Error("LoadPolicy accepted ownership_fix: chown")
+	}
+}
+
+func TestOwnershipFixedBeforeExit(t *testing.T) {
+	policy, err := ParsePolicy([]byte("default_action: deny\nrules: []\nghost:\n  commands:\n    pip:\n      ownership_fix: none\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newTestServer(t)
+	order := &orderLog{}
+	fixer := &logFixer{log: order, files: 42}
+	srv.ownership = fixer
+
+	run := func(req *protocol.Request, strategy executor.Strategy, sandboxed bool) AuditEntry {
+		client, server := net.Pipe()
+		read, output := make(chan struct{}), make(chan struct{}, 1)
+		go func() {
+			defer close(read)
+			for {
+				f, err := protocol.ReadFrame(client)
+				if err != nil {
+					return
+				}
+				switch f.Type {
+				case protocol.StreamStdout:
+					order.add("output")
+					output <- struct{}{}
+				case protocol.StreamExit:
+					order.add("exit")
+				}
+			}
+		}()
+		var entry AuditEntry
+		err := srv.withOwnershipFix(policy, req, strategy, sandboxed, &entry, server, func(conn net.Conn) error {
+			protocol.WriteFrame(conn, protocol.Frame{Type: protocol.StreamStdout, Payload: []byte("added 1 package\n")})
+			<-output // Recorded before the command finishes
+			return protocol.WriteExitCode(conn, 3)
+		})
+		if err != nil {
+			t.Fatalf("withOwnershipFix: %v", err)
+		}
+		server.Close()
+		<-read
+		return entry
+	}
+
+	npm := &protocol.Request{Command: "npm", Args: []string{"install"}}
+	entry := run(npm, executor.StrategyGhost, false)
+	if want := []string{"output", "fix", "exit"}; !reflect.DeepEqual(order.events, want) {
+		t.Errorf("order = %v, want %v", order.events, want)
+	}
+	if want := (&executor.OwnershipFixed{Mode: executor.OwnershipFixChanged, Files: 42}); !reflect.DeepEqual(entry.OwnershipFix, want) {
+		t.Errorf("audited fix = %+v, want %+v", entry.OwnershipFix, want)
+	}
+
+	// Mirrored, sandboxed and ownership_fix: none commands are left alone
+	for _, untouched := range []struct {
+		req       *protocol.Request
+		strategy  executor.Strategy
+		sandboxed bool
+	}{
+		{npm, executor.StrategyMirror, false},
+		{npm, executor.StrategyGhost, true},
+		{&protocol.Request{Command: "pip"}, executor.StrategyGhost, false},
+	} {
+		order.events = nil
+		if entry := run(untouched.req, untouched.strategy, untouched.sandboxed); entry.OwnershipFix != nil || len(fixer.fixes) != 1 {
+			t.Errorf("%s (%s, sandboxed %v) fixed: %+v", untouched.req.Command, untouched.strategy, untouched.sandboxed, entry.OwnershipFix)
+		}
+		if want := []string{"output", "exit"}; !reflect.DeepEqual(order.events, want) {
+			t.Errorf("order = %v, want %v", order.events, want)
+		}
+	}
+
+	// A failed fix is audited; the command's exit code still goes out
+	order.events = nil
+	fixer.err = errors.New("chown: /app/x: Operation not permitted")
+	if entry := run(npm, executor.StrategyGhost, false); entry.OwnershipFix == nil || entry.OwnershipFix.Error != fixer.err.Error() {
+		t.Errorf("audited fix = %+v, want the error", entry.OwnershipFix)
+	}
+	if order.events[len(order.events)-1] != "exit" {
+		t.Errorf("order = %v, want the exit code last", order.events)
+	}
+}
@@ -0,0 +1,59 @@
+package warden
+
+import (
+	"clawrden/internal/executor"
+	"clawrden/pkg/protocol"
+	"context"
+	"time"
+)
+
+// ghostSweepInterval is how often containers left behind by a killed warden
+// are looked for, after the sweep at startup.
+const ghostSweepInterval = 5 * time.Minute
+
+// ghostSweepCommand is the pseudo-command recorded in the audit log for
+// removed orphans.
+const ghostSweepCommand = "clawrden-ghost-sweep"
+
+// orphanSweeper removes containers no live execution uses.
+// *executor.DockerExecutor implements it; tests use fakes.
+type orphanSweeper interface {
+	SweepOrphans(ctx context.Context) ([]executor.OrphanedGhost, error)
+}
+
+// runGhostSweeper sweeps orphaned ghost containers now and then every
+// ghostSweepInterval until ctx ends.
+func (s *Server) runGhostSweeper(ctx context.Context, sweeper orphanSweeper) {
+	ticker := time.NewTicker(ghostSweepInterval)
+	defer ticker.Stop()
+	for {
+		s.sweepGhosts(ctx, sweeper)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweepGhosts removes orphaned ghost containers once, logging and auditing
+// each one.
+func (s *Server) sweepGhosts(ctx context.Context, sweeper orphanSweeper) {
+	removed, err := sweeper.SweepOrphans(ctx)
+	if err != nil {
+		s.logger.Printf("warning: orphaned ghost sweep failed: %v", err)
+		return
+	}
+	for _, orphan := range removed {
+		s.logger.Printf("removed orphaned ghost container %s of request %s (created %s)",
+			truncateID(orphan.ContainerID), orphan.RequestID, orphan.Created.Format(time.RFC3339))
+		s.record(AuditEntry{
+			Command:     ghostSweepCommand,
+			Args:        []string{"remove", orphan.ContainerID},
+			ContainerID: orphan.ContainerID,
+			RequestID:   orphan.RequestID,
+			Decision:    protocol.DecisionEvent,
+			Detail:      "orphan removed",
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package warden
+
+import (
+	"clawrden/internal/events"
+	"clawrden/internal/executor"
+	"context"
+	"io"
+	"log"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSweeper returns orphans on its first sweep and counts sweeps.
+type fakeSweeper struct {
+	orphans []executor.OrphanedGhost
+	sweeps  int
+}
+
+func (f *fakeSweeper) SweepOrphans(context.Context) ([]executor.OrphanedGhost, error) {
+	f.sweeps++
+	orphans := f.orphans
+	f.orphans = nil
+	return orphans, nil
+}
+
+func TestGhostSweepAtStartup(t *testing.T) {
+	srv := newTestServer(t)
+	srv.events = events.New(log.New(io.Discard, "", 0))
+	var mu sync.Mutex
+	var audited []AuditEntry
+	srv.events.Subscribe("test", func(e events.Event) {
+		if a, ok := e.(Audited); ok {
+			mu.Lock()
+			audited = append(audited, a.Entry)
+			mu.Unlock()
+		}
+	})
+
+	sweeper := &fakeSweeper{orphans: []executor.OrphanedGhost{
+		{ContainerID: "abc123", RequestID: "req-1", Created: time.Now().Add(-time.Hour)},
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	srv.runGhostSweeper(ctx, sweeper) // Sweeps once before noticing ctx is done
+	srv.events.Close()
+
+	if sweeper.sweeps != 1 {
+		t.Errorf("sweeps = %d, want 1 at startup", sweeper.sweeps)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(audited) != 1 {
+		t.Fatalf("audited = %+v, want the removed orphan", audited)
+	}
+	if e := audited[0]; e.Command != ghostSweepCommand || e.ContainerID != "abc123" || e.RequestID != "req-1" || e.Detail != "orphan removed" {
+		t.Errorf("audit entry = %+v", e)
+	}
+}
@@ -0,0 +1,186 @@
+package warden
+
+import (
+	"bufio"
+	"clawrden/pkg/protocol"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// etcGroupPath is the group database used to resolve group names.
+// It is a variable so tests can point it at a fixture.
+var etcGroupPath = "/etc/group"
+
+// resolveProcGroups reads /proc/<pid>/status to obtain the supplementary groups
+// of a process. Unlike the shim's self-reported list, these come from the kernel.
+func resolveProcGroups(pid int32) ([]int, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return nil, fmt.Errorf("read status for pid %d: %w", pid, err)
+	}
+	return parseGroupsFromProcStatus(string(data)), nil
+}
+
+// parseGroupsFromProcStatus extracts the "Groups:" line from /proc/<pid>/status contents.
+// Returns nil if the line is absent or empty.
+func parseGroupsFromProcStatus(status string) []int {
+	for _, line := range strings.Split(status, "\n") {
+		if !strings.HasPrefix(line, "Groups:") {
+			continue
+		}
+		var groups []int
+		for _, field := range strings.Fields(strings.TrimPrefix(line, "Groups:")) {
+			gid, err := strconv.Atoi(field)
+			if err != nil {
+				continue
+			}
+			groups = append(groups, gid)
+		}
+		return groups
+	}
+	return nil
+}
+
+// groupDB maps group names to IDs and back, as read from /etc/group.
+type groupDB struct {
+	byName map[string]int
+	byID   map[int]string
+}
+
+// loadGroupDB parses the group database at etcGroupPath.
+// A missing or unreadable file yields an empty database (numeric IDs still work).
+func loadGroupDB() *groupDB {
+	db := &groupDB{byName: map[string]int{}, byID: map[int]string{}}
+
+	file, err := os.Open(etcGroupPath)
+	if err != nil {
+		return db
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// Format: name:password:GID:member,member
+		fields := strings.Split(line, ":")
+		if len(fields) < 3 {
+			continue
+		}
+		gid, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+		db.byName[fields[0]] = gid
+		if _, exists := db.byID[gid]; !exists {
+			db.byID[gid] = fields[0]
+		}
+	}
+	return db
+}
+
+// groupDBMaxAge bounds how long a parse of the group database is reused
+// even when the file looks unchanged, in case it was rewritten within the
+// file system's mtime granularity.
+const groupDBMaxAge = time.Minute
+
+// groupDBCache keeps the last parse of the group database, which is read on
+// every policy evaluation with group rules and every queued request.
+var groupDBCache struct {
+	mu       sync.Mutex
+	db       *groupDB
+	path     string
+	modTime  time.Time
+	size     int64
+	loadedAt time.Time
+}
+
+// cachedGroupDB returns the group database, parsing etcGroupPath again only
+// when the file changed or the last parse is older than groupDBMaxAge.
+func cachedGroupDB() *groupDB {
+	var modTime time.Time
+	var size int64
+	if info, err := os.Stat(etcGroupPath); err == nil {
+		modTime, size = info.ModTime(), info.Size()
+	}
+
+	c := &groupDBCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.db != nil && c.path == etcGroupPath && c.modTime.Equal(modTime) && c.size == size &&
+		time.Since(c.loadedAt) < groupDBMaxAge {
+		return c.db
+	}
+	c.db, c.path, c.modTime, c.size, c.loadedAt = loadGroupDB(), etcGroupPath, modTime, size, time.Now()
+	return c.db
+}
+
+// lookup resolves a group selector (name or numeric ID) to a GID.
+func (db *groupDB) lookup(selector string) (int, bool) {
+	if gid, err := strconv.Atoi(selector); err == nil {
+		return gid, true
+	}
+	gid, ok := db.byName[selector]
+	return gid, ok
+}
+
+// name returns the display name for a GID, falling back to the numeric ID.
+func (db *groupDB) name(gid int) string {
+	if name, ok := db.byID[gid]; ok {
+		return name
+	}
+	return strconv.Itoa(gid)
+}
+
+// identityGroups returns the primary GID followed by all supplementary groups.
+func identityGroups(id protocol.Identity) []int {
+	groups := make([]int, 0, len(id.Groups)+1)
+	groups = append(groups, id.GID)
+	for _, gid := range id.Groups {
+		if gid != id.GID {
+			groups = append(groups, gid)
+		}
+	}
+	return groups
+}
+
+// matchGroups reports whether the identity is a member of any of the selector groups.
+// Selectors that cannot be resolved never match.
+func matchGroups(selectors []string, id protocol.Identity) bool {
+	db := cachedGroupDB()
+	member := makeIntSet(identityGroups(id))
+	for _, selector := range selectors {
+		gid, ok := db.lookup(selector)
+		if ok && member[gid] {
+			return true
+		}
+	}
+	return false
+}
+
+// GroupNames resolves the identity's groups to human-readable names,
+// falling back to numeric IDs for groups unknown to the Warden host.
+func GroupNames(id protocol.Identity) []string {
+	db := cachedGroupDB()
+	groups := identityGroups(id)
+	names := make([]string, len(groups))
+	for i, gid := range groups {
+		names[i] = db.name(gid)
+	}
+	return names
+}
+
+// makeIntSet converts a slice to a set (map).
+func makeIntSet(items []int) map[int]bool {
+	set := make(map[int]bool, len(items))
+	for _, item := range items {
+		set[item] = true
+	}
+	return set
+}
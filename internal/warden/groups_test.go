@@ -0,0 +1,139 @@
+package warden
+
+import (
+	"clawrden/pkg/protocol"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// withGroupFile points the group database at a fixture for the duration of a test.
+func withGroupFile(t *testing.T, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "group")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("write group file: %v", err)
+	}
+	old := etcGroupPath
+	etcGroupPath = path
+	t.Cleanup(func() { etcGroupPath = old })
+}
+
+func TestParseGroupsFromProcStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected []int
+	}{
+		{
+			name:     "supplementary groups",
+			content:  "Name:\tbash\nUid:\t1000\t1000\t1000\t1000\nGid:\t1000\t1000\t1000\t1000\nGroups:\t4 27 1001 \n",
+			expected: []int{4, 27, 1001},
+		},
+		{
+			name:     "empty groups line",
+			content:  "Name:\tbash\nGroups:\t\n",
+			expected: nil,
+		},
+		{
+			name:     "no groups line",
+			content:  "Name:\tbash\n",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseGroupsFromProcStatus(tt.content)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("parseGroupsFromProcStatus() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPolicyEvaluateGroups(t *testing.T) {
+	withGroupFile(t, "root:x:0:\ndeployers:x:2001:alice,bob\nauditors:x:2002:\n")
+
+	pe := &PolicyEngine{
+		config: PolicyConfig{
+			DefaultAction:  ActionDeny,
+			DefaultTimeout: 2 * time.Minute,
+			Rules: []Rule{
+				{Command: "kubectl", Action: ActionAllow, Groups: []string{"deployers"}},
+				{Command: "terraform", Action: ActionAsk, Groups: []string{"2002"}},
+				{Command: "helm", Action: ActionAllow, Groups: []string{"no-such-group"}},
+				{Command: "kubectl", Action: ActionAsk},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		command  string
+		identity protocol.Identity
+		expected Action
+	}{
+		{"named group via supplementary", "kubectl", protocol.Identity{UID: 1000, GID: 1000, Groups: []int{2001}}, ActionAllow},
+		{"named group via primary gid", "kubectl", protocol.Identity{UID: 1000, GID: 2001}, ActionAllow},
+		{"not a member falls through", "kubectl", protocol.Identity{UID: 1000, GID: 1000, Groups: []int{2002}}, ActionAsk},
+		{"numeric group selector", "terraform", protocol.Identity{UID: 1000, GID: 1000, Groups: []int{2002}}, ActionAsk},
+		{"numeric group not a member", "terraform", protocol.Identity{UID: 1000, GID: 1000}, ActionDeny},
+		{"unknown group name never matches", "helm", protocol.Identity{UID: 0, GID: 0}, ActionDeny},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &protocol.Request{Command: tt.command, Cwd: "/app", Identity: tt.identity}
+			if got := pe.Evaluate(req).Action; got != tt.expected {
+				t.Errorf("Evaluate(%s) = %v, want %v", tt.command, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGroupNames(t *testing.T) {
+	withGroupFile(t, "# comment\nusers:x:100:\ndeployers:x:2001:alice\n")
+
+	got := GroupNames(protocol.Identity{UID: 1000, GID: 100, Groups: []int{100, 2001, 4242}})
+	expected := []string{"users", "deployers", "4242"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("GroupNames() = %v, want %v", got, expected)
+	}
+}
+
+func TestGroupDBCached(t *testing.T) {
+	withGroupFile(t, "deployers:x:2001:\n")
+	id := protocol.Identity{UID: 1000, GID: 2001}
+	if got := GroupNames(id); !reflect.DeepEqual(got, []string{"deployers"}) {
+		t.Fatalf("GroupNames() = %v, want [deployers]", got)
+	}
+	info, err := os.Stat(etcGroupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rewritten with the same size and mtime, the file is not parsed again
+	if err := os.WriteFile(etcGroupPath, []byte("releasers:x:2001:\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(etcGroupPath, info.ModTime(), info.ModTime())
+	if got := GroupNames(id); !reflect.DeepEqual(got, []string{"deployers"}) {
+		t.Errorf("GroupNames() = %v, want the cached [deployers]", got)
+	}
+	if !matchGroups([]string{"deployers"}, id) {
+		t.Error("matchGroups did not use the cached database")
+	}
+
+	// A new mtime refreshes it
+	later := info.ModTime().Add(time.Second)
+	os.Chtimes(etcGroupPath, later, later)
+	if got := GroupNames(id); !reflect.DeepEqual(got, []string{"releasers"}) {
+		t.Errorf("GroupNames() = %v, want [releasers] after the file changed", got)
+	}
+	if matchGroups([]string{"deployers"}, id) || !matchGroups([]string{"releasers"}, id) {
+		t.Error("matchGroups still uses the stale database")
+	}
+}
@@ -0,0 +1,458 @@
+package warden
+
+import (
+	"clawrden/internal/events"
+	"clawrden/internal/jailhouse"
+	"clawrden/pkg/grpcapi"
+	"clawrden/pkg/protocol"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcWatchQueue is how many events may wait for one WatchEvents stream
+// before further events for it are dropped.
+const grpcWatchQueue = 256
+
+// GRPCServer serves the WardenControl gRPC API. It is backed by the same
+// warden components as the HTTP API and runs independently of it.
+type GRPCServer struct {
+	grpcapi.UnimplementedWardenControlServer
+
+	warden *Server
+	addr   string
+	token  string // Bearer token required on every call; empty accepts any caller
+	server *grpc.Server
+	logger *log.Logger
+}
+
+// NewGRPCServer creates a gRPC API server for warden.
+func NewGRPCServer(warden *Server, addr string, logger *log.Logger) *GRPCServer {
+	g := &GRPCServer{
+		warden: warden,
+		addr:   addr,
+		token:  warden.config.GRPCToken,
+		logger: logger,
+	}
+	g.server = grpc.NewServer(
+		grpc.ChainUnaryInterceptor(g.authorizeUnary),
+		grpc.ChainStreamInterceptor(g.authorizeStream),
+	)
+	grpcapi.RegisterWardenControlServer(g.server, g)
+	return g
+}
+
+// ListenAndServe starts the gRPC API server.
+func (g *GRPCServer) ListenAndServe() error {
+	l, err := net.Listen("tcp", g.addr)
+	if err != nil {
+		return err
+	}
+	return g.Serve(l)
+}
+
+// Serve accepts gRPC connections on l.
+func (g *GRPCServer) Serve(l net.Listener) error {
+	g.logger.Printf("gRPC API listening on %s", l.Addr())
+	return g.server.Serve(l)
+}
+
+// Shutdown stops the server, ending open event streams.
+func (g *GRPCServer) Shutdown() {
+	g.server.Stop()
+}
+
+// authorize checks the bearer token in the call's "authorization" metadata.
+func (g *GRPCServer) authorize(ctx context.Context, method string) error {
+	if g.token == "" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		token, ok := strings.CutPrefix(v, "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(token), []byte(g.token)) == 1 {
+			return nil
+		}
+	}
+	g.logger.Printf("SECURITY: rejected gRPC call %s: missing or invalid token", method)
+	return status.Error(codes.Unauthenticated, "missing or invalid bearer token")
+}
+
+func (g *GRPCServer) authorizeUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := g.authorize(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (g *GRPCServer) authorizeStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := g.authorize(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// GetStatus returns the queue, jailhouse, bridge and Docker status.
+func (g *GRPCServer) GetStatus(ctx context.Context, _ *grpcapi.GetStatusRequest) (*grpcapi.GetStatusResponse, error) {
+	resp := &grpcapi.GetStatusResponse{
+		PendingCount: int32(len(g.warden.GetHITLQueue().List())),
+	}
+	if jh := g.warden.GetJailhouse(); jh != nil {
+		inv := jh.Inventory()
+		resp.Jailhouse = &grpcapi.JailInventory{
+			Jails:     int32(inv.Jails),
+			Symlinks:  int32(inv.Symlinks),
+			DiskBytes: inv.DiskBytes,
+		}
+	}
+	if bridges := g.warden.GetBridges(); bridges != nil {
+		for _, b := range bridges.List() {
+			resp.Bridges = append(resp.Bridges, &grpcapi.Bridge{
+				Name:     b.Name,
+				Type:     b.Type,
+				Version:  b.Version,
+				LastSeen: timestamppb.New(b.LastSeen),
+				Stale:    b.Stale,
+			})
+		}
+	}
+	if incidents := g.warden.GetIncidents(); incidents != nil {
+		resp.OpenIncidents = int32(incidents.OpenCount())
+	}
+	if docker := g.warden.GetDocker(); docker != nil {
+		health := docker.Health()
+		resp.Docker = &grpcapi.DockerHealth{
+			Healthy: health.Healthy,
+			Since:   timestamppb.New(health.Since),
+			Error:   health.Error,
+		}
+	}
+	if m := g.warden.GetMaintenance().Active(); m != nil {
+		resp.Maintenance = &grpcapi.Maintenance{
+			Id:      m.ID,
+			Message: m.Message,
+			Until:   timestamppb.New(m.Until),
+		}
+	}
+	return resp, nil
+}
+
+// ListQueue returns the requests waiting for a reviewer.
+func (g *GRPCServer) ListQueue(ctx context.Context, _ *grpcapi.ListQueueRequest) (*grpcapi.ListQueueResponse, error) {
+	pending := g.warden.GetHITLQueue().List()
+	resp := &grpcapi.ListQueueResponse{Requests: make([]*grpcapi.PendingRequest, len(pending))}
+	for i, p := range pending {
+		resp.Requests[i] = &grpcapi.PendingRequest{
+			Id:          p.ID,
+			Command:     p.Request.Command,
+			Args:        p.Request.Args,
+			Cwd:         p.Request.Cwd,
+			Uid:         uint32(p.Request.Identity.UID),
+			Gid:         uint32(p.Request.Identity.GID),
+			Groups:      GroupNames(p.Request.Identity),
+			ContainerId: p.Request.ContainerID,
+			JailId:      p.Request.JailID,
+			TaskId:      p.TaskID,
+			RunId:       p.RunID,
+			Timestamp:   timestamppb.New(p.Timestamp),
+		}
+	}
+	return resp, nil
+}
+
+// Resolve approves or denies a pending request. An approval of a request
+// that needs several is recorded and the request stays pending.
+func (g *GRPCServer) Resolve(ctx context.Context, req *grpcapi.ResolveRequest) (*grpcapi.ResolveResponse, error) {
+	var decision Decision
+	switch req.GetDecision() {
+	case grpcapi.Decision_DECISION_APPROVE:
+		decision = DecisionApprove
+	case grpcapi.Decision_DECISION_DENY:
+		decision = DecisionDeny
+	default:
+		return nil, status.Error(codes.InvalidArgument, "decision must be approve or deny")
+	}
+	_, err := g.warden.GetHITLQueue().Review(req.GetId(), Review{Decision: decision, Reviewer: grpcReviewer(ctx), Channel: ChannelGRPC})
+	switch {
+	case errors.Is(err, errNotPending), errors.Is(err, errAlreadyDecided):
+		return nil, status.Errorf(codes.NotFound, "no pending request %s", req.GetId())
+	case err != nil:
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	return &grpcapi.ResolveResponse{}, nil
+}
+
+// grpcReviewer names the caller of Resolve, like reviewerOf: the
+// x-clawrden-actor metadata, or the caller's host.
+func grpcReviewer(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if actor := md.Get(strings.ToLower(ActorHeader)); len(actor) > 0 && actor[0] != "" {
+			return actor[0]
+		}
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+		return host
+	}
+	return p.Addr.String()
+}
+
+// WatchEvents streams events published on the warden's event bus until the
+// caller goes away. Response headers are sent once the stream is subscribed.
+// A caller that falls behind misses events.
+func (g *GRPCServer) WatchEvents(req *grpcapi.WatchEventsRequest, stream grpcapi.WardenControl_WatchEventsServer) error {
+	bus := g.warden.GetEvents()
+	if bus == nil {
+		return status.Error(codes.Unavailable, "event bus not initialized")
+	}
+	names := make(map[string]bool, len(req.GetNames()))
+	for _, name := range req.GetNames() {
+		names[name] = true
+	}
+
+	ctx := stream.Context()
+	queue := make(chan *grpcapi.Event)
+	unsubscribe := bus.Subscribe("grpc-watch", func(e events.Event) {
+		if len(names) > 0 && !names[e.Name()] {
+			return
+		}
+		select {
+		case queue <- eventToProto(e, time.Now()):
+		case <-ctx.Done():
+		}
+	}, events.Async(grpcWatchQueue))
+	defer unsubscribe()
+
+	// Headers tell the caller that events from now on will be delivered
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e := <-queue:
+			if err := stream.Send(e); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ListJails returns all active jails.
+func (g *GRPCServer) ListJails(ctx context.Context, _ *grpcapi.ListJailsRequest) (*grpcapi.ListJailsResponse, error) {
+	jh := g.warden.GetJailhouse()
+	if jh == nil {
+		return nil, status.Error(codes.Unavailable, ErrNoJailhouse.Error())
+	}
+	resp := &grpcapi.ListJailsResponse{}
+	for _, jail := range jh.ListJails() {
+		resp.Jails = append(resp.Jails, jailToProto(jail))
+	}
+	return resp, nil
+}
+
+// GetJail returns one jail.
+func (g *GRPCServer) GetJail(ctx context.Context, req *grpcapi.GetJailRequest) (*grpcapi.Jail, error) {
+	jh := g.warden.GetJailhouse()
+	if jh == nil {
+		return nil, status.Error(codes.Unavailable, ErrNoJailhouse.Error())
+	}
+	jail, err := jh.GetJail(req.GetJailId())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return jailToProto(jail), nil
+}
+
+// CreateJail creates a jail, like POST /api/jails.
+func (g *GRPCServer) CreateJail(ctx context.Context, req *grpcapi.CreateJailRequest) (*grpcapi.Jail, error) {
+	var rules json.RawMessage
+	if req.GetRulesJson() != "" {
+		rules = json.RawMessage(req.GetRulesJson())
+	}
+	jail, err := g.warden.CreateJail(req.GetJailId(), req.GetCommands(), req.GetHardened(), rules, "grpc")
+	var reqErr *JailRequestError
+	switch {
+	case errors.Is(err, ErrNoJailhouse):
+		return nil, status.Error(codes.Unavailable, err.Error())
+	case errors.As(err, &reqErr):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrJailRules):
+		return nil, status.Error(codes.Internal, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	}
+	return jailToProto(jail), nil
+}
+
+// DeleteJail destroys a jail, like DELETE /api/jails/{id}.
+func (g *GRPCServer) DeleteJail(ctx context.Context, req *grpcapi.DeleteJailRequest) (*grpcapi.DeleteJailResponse, error) {
+	_, err := g.warden.DestroyJail(req.GetJailId(), false, "grpc")
+	switch {
+	case errors.Is(err, ErrNoJailhouse):
+		return nil, status.Error(codes.Unavailable, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &grpcapi.DeleteJailResponse{}, nil
+}
+
+// QueryHistory returns audit entries matching the same filters as
+// GET /api/history.
+func (g *GRPCServer) QueryHistory(ctx context.Context, req *grpcapi.QueryHistoryRequest) (*grpcapi.QueryHistoryResponse, error) {
+	filter, err := ParseHistoryFilter(url.Values{
+		"command":   {req.GetCommand()},
+		"decision":  {req.GetDecision()},
+		"container": {req.GetContainer()},
+		"task_id":   {req.GetTaskId()},
+		"since":     {req.GetSince()},
+		"until":     {req.GetUntil()},
+	}, time.Now())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	limit := int(req.GetLimit())
+	var entries []*grpcapi.AuditEntry
+	err = ScanAuditLog(g.warden.config.AuditPath, func(entry AuditEntry) error {
+		if !filter.Match(&entry) {
+			return nil
+		}
+		entries = append(entries, auditEntryToProto(&entry))
+		if limit > 0 && len(entries) > limit {
+			entries[0] = nil
+			entries = entries[1:]
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		g.logger.Printf("read audit log error: %v", err)
+		return nil, status.Errorf(codes.Internal, "read audit log: %v", err)
+	}
+	return &grpcapi.QueryHistoryResponse{Entries: entries}, nil
+}
+
+func jailToProto(jail *jailhouse.JailState) *grpcapi.Jail {
+	return &grpcapi.Jail{
+		JailId:    jail.JailID,
+		Commands:  jail.Commands,
+		Hardened:  jail.Hardened,
+		CreatedAt: timestamppb.New(jail.CreatedAt),
+		JailPath:  jail.JailPath,
+		RulesJson: string(jail.Rules),
+	}
+}
+
+func auditEntryToProto(e *AuditEntry) *grpcapi.AuditEntry {
+	return &grpcapi.AuditEntry{
+		Timestamp:   e.Timestamp,
+		RequestId:   e.RequestID,
+		Command:     e.Command,
+		Args:        e.Args,
+		Cwd:         e.Cwd,
+		Uid:         uint32(e.Identity.UID),
+		Gid:         uint32(e.Identity.GID),
+		ContainerId: e.ContainerID,
+		JailId:      e.JailID,
+		TaskId:      e.TaskID,
+		RunId:       e.RunID,
+		Decision:    e.DecisionLabel(),
+		ExitCode:    int32(e.ExitCode),
+		DurationMs:  e.Duration,
+		Strategy:    e.Strategy,
+		Error:       e.Error,
+	}
+}
+
+// eventToProto converts a bus event. Requests are reduced to the fields a
+// reviewer sees in the queue; their environment is never sent.
+func eventToProto(e events.Event, at time.Time) *grpcapi.Event {
+	pb := &grpcapi.Event{Name: e.Name(), Time: timestamppb.New(at)}
+	setRequest := func(req *protocol.Request) {
+		if req == nil {
+			return
+		}
+		pb.Command = req.Command
+		pb.Args = req.Args
+		pb.ContainerId = req.ContainerID
+		pb.JailId = req.JailID
+		pb.TaskId = req.TaskID
+		pb.RunId = req.RunID
+	}
+
+	var detail map[string]interface{}
+	switch e := e.(type) {
+	case events.RequestReceived:
+		setRequest(e.Request)
+	case events.DecisionMade:
+		setRequest(e.Request)
+		detail = map[string]interface{}{"action": e.Action, "timeout_ms": e.Timeout.Milliseconds()}
+	case events.HITLEnqueued:
+		pb.Id = e.ID
+		setRequest(e.Request)
+	case events.HITLResolved:
+		pb.Id = e.ID
+		setRequest(e.Request)
+		detail = map[string]interface{}{"approved": e.Approved, "expired": e.Expired, "waited_ms": e.Waited.Milliseconds()}
+	case events.ExecutionStarted:
+		pb.Id = e.ID
+		setRequest(e.Request)
+	case events.ExecutionFinished:
+		setRequest(e.Request)
+		detail = map[string]interface{}{"exit_code": e.ExitCode, "duration_ms": e.Duration.Milliseconds(), "timed_out": e.TimedOut}
+		if e.Err != nil {
+			detail["error"] = e.Err.Error()
+		}
+	case events.JailChanged:
+		pb.JailId = e.JailID
+		detail = map[string]interface{}{"change": e.Change, "source": e.Source}
+	case events.PolicyReloaded:
+		detail = map[string]interface{}{"path": e.Path}
+	case events.PolicyReloadHeld:
+		detail = map[string]interface{}{"path": e.Path, "policy_hash": e.PolicyHash, "summary": e.Summary}
+	case events.IncidentOpened:
+		pb.Id = e.ID
+		detail = map[string]interface{}{"subject": e.Subject, "trigger": e.Trigger, "reason": e.Reason, "lockdown": e.Lockdown}
+	case events.IncidentCleared:
+		pb.Id = e.ID
+		detail = map[string]interface{}{"subject": e.Subject}
+	case events.DockerHealthChanged:
+		detail = map[string]interface{}{"healthy": e.Healthy, "error": e.Error, "outage_ms": e.Outage.Milliseconds()}
+	case events.MaintenanceChanged:
+		pb.Id = e.ID
+		detail = map[string]interface{}{"active": e.Active, "message": e.Message, "until": e.Until}
+	case Audited:
+		pb.Id = e.Entry.RequestID
+		pb.Command = e.Entry.Command
+		pb.Args = e.Entry.Args
+		pb.ContainerId = e.Entry.ContainerID
+		pb.JailId = e.Entry.JailID
+		pb.TaskId = e.Entry.TaskID
+		pb.RunId = e.Entry.RunID
+		detail = map[string]interface{}{"decision": e.Entry.Decision, "exit_code": e.Entry.ExitCode}
+	}
+	if detail != nil {
+		if b, err := json.Marshal(detail); err == nil {
+			pb.DetailJson = string(b)
+		}
+	}
+	return pb
+}
@@ -0,0 +1,44 @@
+package warden
+
+import (
+	"clawrden/internal/events"
+	"clawrden/pkg/protocol"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventToProto(t *testing.T) {
+	req := &protocol.Request{
+		Command:     "terraform",
+		Args:        []string{"apply"},
+		Env:         []string{"AWS_SECRET_ACCESS_KEY=hunter2"},
+		ContainerID: "c0ffee",
+		TaskID:      "task-1",
+	}
+	tests := []struct {
+		event      events.Event
+		wantID     string
+		wantDetail string
+	}{
+		{events.HITLEnqueued{ID: "req-1", Request: req}, "req-1", ""},
+		{events.HITLResolved{ID: "req-1", Request: req, Approved: true, Waited: 2 * time.Second}, "req-1", `{"approved":true,"expired":false,"waited_ms":2000}`},
+		{events.ExecutionFinished{Request: req, ExitCode: 3, Err: errors.New("boom")}, "", `{"duration_ms":0,"error":"boom","exit_code":3,"timed_out":false}`},
+		{events.JailChanged{JailID: "ci", Change: "created", Source: "grpc"}, "", `{"change":"created","source":"grpc"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.event.Name(), func(t *testing.T) {
+			pb := eventToProto(tt.event, time.Now())
+			if pb.GetName() != tt.event.Name() || pb.GetId() != tt.wantID || pb.GetDetailJson() != tt.wantDetail {
+				t.Errorf("event = %v", pb)
+			}
+			if strings.Contains(pb.String(), "hunter2") {
+				t.Errorf("event leaks the request environment: %v", pb)
+			}
+			if _, ok := tt.event.(events.JailChanged); !ok && (pb.GetCommand() != "terraform" || pb.GetContainerId() != "c0ffee" || pb.GetTaskId() != "task-1") {
+				t.Errorf("request fields missing: %v", pb)
+			}
+		})
+	}
+}
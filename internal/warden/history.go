@@ -0,0 +1,430 @@
+package warden
+
+import (
+	"bufio"
+	"bytes"
+	"clawrden/pkg/protocol"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HistoryFilter selects audit entries for /api/history and its exports.
+// The zero value matches every entry.
+type HistoryFilter struct {
+	Since     time.Time // Entries at or after this time
+	Until     time.Time // Entries before this time
+	Command   string    // Exact command name
+	Decision  string    // Decision, e.g. "deny", or with its outcome, "deny (after HITL)"; see matchDecision
+	Outcome   string    // Exact outcome name, e.g. "hitl_expired"
+	Container string    // Container ID prefix
+	TaskID    string    // Exact task ID (CLAWRDEN_TASK_ID)
+	RequestID string    // Exact request ID
+}
+
+// ParseHistoryFilter reads a filter from query parameters: since (a
+// duration such as "12h" or "90d" before now, a date, or an RFC 3339 time),
+// until (a date or RFC 3339 time), command, decision, outcome, container,
+// task_id and request_id.
+func ParseHistoryFilter(q url.Values, now time.Time) (HistoryFilter, error) {
+	f := HistoryFilter{
+		Command:   q.Get("command"),
+		Decision:  q.Get("decision"),
+		Outcome:   q.Get("outcome"),
+		Container: q.Get("container"),
+		TaskID:    q.Get("task_id"),
+		RequestID: q.Get("request_id"),
+	}
+	if v := q.Get("since"); v != "" {
+		if d, err := parseAge(v); err == nil {
+			f.Since = now.Add(-d)
+		} else if t, err := parseHistoryTime(v); err == nil {
+			f.Since = t
+		} else {
+			return f, fmt.Errorf("invalid since %q: want a duration like 90d or a time", v)
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		t, err := parseHistoryTime(v)
+		if err != nil {
+			return f, fmt.Errorf("invalid until %q: want a date or RFC 3339 time", v)
+		}
+		f.Until = t
+	}
+	return f, nil
+}
+
+// parseAge parses a Go duration, also accepting whole days ("90d").
+func parseAge(v string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid days %q", v)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err == nil && d < 0 {
+		err = fmt.Errorf("negative duration %q", v)
+	}
+	return d, err
+}
+
+// parseHistoryTime parses an RFC 3339 time or a date (midnight UTC).
+func parseHistoryTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, v)
+}
+
+// Match reports whether e passes the filter. Entries without a readable
+// timestamp never match a time bound.
+func (f HistoryFilter) Match(e *AuditEntry) bool {
+	if f.Command != "" && e.Command != f.Command {
+		return false
+	}
+	if f.Decision != "" && !f.matchDecision(e) {
+		return false
+	}
+	if f.Outcome != "" && e.Outcome.String() != f.Outcome {
+		return false
+	}
+	if f.Container != "" && !strings.HasPrefix(e.ContainerID, f.Container) {
+		return false
+	}
+	if f.TaskID != "" && e.TaskID != f.TaskID {
+		return false
+	}
+	if f.RequestID != "" && e.RequestID != f.RequestID {
+		return false
+	}
+	if f.Since.IsZero() && f.Until.IsZero() {
+		return true
+	}
+	t, err := time.Parse(time.RFC3339Nano, e.Timestamp)
+	if err != nil {
+		return false
+	}
+	return (f.Since.IsZero() || !t.Before(f.Since)) && (f.Until.IsZero() || t.Before(f.Until))
+}
+
+// matchDecision reports whether e has the filter's decision. A decision
+// name such as "deny" matches whatever the outcome, one with an outcome
+// such as "deny (after HITL)" only that outcome, and anything else is a
+// prefix of the entry's DecisionLabel, e.g. "jail" for jail changes.
+func (f HistoryFilter) matchDecision(e *AuditEntry) bool {
+	decision, outcome, detail := protocol.ParseLegacyDecision(f.Decision)
+	if detail != "" {
+		return strings.HasPrefix(e.DecisionLabel(), f.Decision)
+	}
+	return e.Decision == decision && (outcome == protocol.OutcomeNone || e.Outcome == outcome)
+}
+
+// maxReportedCorruptLines bounds the line numbers an AuditParseReport lists.
+const maxReportedCorruptLines = 100
+
+// AuditParseReport is what a scan of the audit log could not read. An
+// unterminated last line is usually an entry being appended while the log
+// is read, and is reported apart from corrupt lines before it, which point
+// at disk problems or a crash mid-write.
+type AuditParseReport struct {
+	Entries      int   `json:"entries"`                        // Entries read
+	CorruptLines int   `json:"corrupt_lines"`                  // Terminated lines that are not entries
+	Corrupt      []int `json:"corrupt_line_numbers,omitempty"` // Their 1-based line numbers, the first 100
+	PartialTail  int   `json:"partial_tail_line,omitempty"`    // Line number of an unterminated last line that is not an entry
+}
+
+// ScanAuditLog calls fn with each entry of the audit log at path, in order,
+// reading one line at a time so the log is never held in memory. Malformed
+// lines are skipped; a missing log has no entries. An error from fn stops
+// the scan and is returned.
+//
+// An allowed command's started and finished entries are paired by request
+// ID: fn gets the finished entry, which records everything the started one
+// does, in its place in the log. A started entry without a finished one is
+// passed on with Completed set to CompletionUnknown.
+func ScanAuditLog(path string, fn func(AuditEntry) error) error {
+	_, err := ScanAuditLogReport(path, fn)
+	return err
+}
+
+// ScanAuditLogReport is ScanAuditLog, also reporting the lines it skipped.
+// Blank lines are not reported.
+func ScanAuditLogReport(path string, fn func(AuditEntry) error) (AuditParseReport, error) {
+	var report AuditParseReport
+	if path == "" {
+		return report, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return report, nil
+		}
+		return report, fmt.Errorf("open audit log: %w", err)
+	}
+	defer file.Close()
+
+	// Which started entries never finished can only be known at the end;
+	// the second pass stops where the first did, before entries appended
+	// since
+	unfinished, size, err := unfinishedAuditEntries(file)
+	if err != nil {
+		return report, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return report, fmt.Errorf("read audit log: %w", err)
+	}
+
+	r := bufio.NewReader(io.LimitReader(file, size))
+	for lineNo := 1; ; lineNo++ {
+		line, readErr := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var entry AuditEntry
+			switch err := unmarshalAuditEntry(line, &entry); {
+			case err == nil:
+				report.Entries++
+				if entry.Phase == PhaseStarted && !unfinished[entry.RequestID] {
+					break // Its finished entry follows
+				}
+				if entry.Phase == PhaseStarted {
+					entry.Completed = CompletionUnknown
+				}
+				if err := fn(entry); err != nil {
+					return report, err
+				}
+			case readErr == io.EOF:
+				// No newline yet: the write may still be under way
+				report.PartialTail = lineNo
+			default:
+				report.CorruptLines++
+				if len(report.Corrupt) < maxReportedCorruptLines {
+					report.Corrupt = append(report.Corrupt, lineNo)
+				}
+			}
+		}
+		if readErr == io.EOF {
+			return report, nil
+		}
+		if readErr != nil {
+			return report, fmt.Errorf("read audit log: %w", readErr)
+		}
+	}
+}
+
+// unfinishedAuditEntries reads the audit log for the request IDs of started
+// entries without a finished entry after them, and returns them with the
+// number of bytes read.
+func unfinishedAuditEntries(r io.Reader) (map[string]bool, int64, error) {
+	unfinished := make(map[string]bool)
+	br := bufio.NewReader(r)
+	var size int64
+	for {
+		line, err := br.ReadBytes('\n')
+		size += int64(len(line))
+		var entry struct {
+			RequestID string `json:"request_id"`
+			Phase     string `json:"phase"`
+		}
+		// Most entries have no phase; skip decoding them
+		if bytes.Contains(line, []byte(`"phase"`)) && json.Unmarshal(line, &entry) == nil {
+			switch entry.Phase {
+			case PhaseStarted:
+				unfinished[entry.RequestID] = true
+			case PhaseFinished:
+				delete(unfinished, entry.RequestID)
+			}
+		}
+		if err == io.EOF {
+			return unfinished, size, nil
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("read audit log: %w", err)
+		}
+	}
+}
+
+// HistoryGroup is a run of consecutive audit entries with the same command,
+// arguments, decision and container, as /api/history?collapse=true shows
+// it. The embedded entry is the run's first.
+type HistoryGroup struct {
+	AuditEntry
+	Count          int     `json:"count"`
+	FirstTimestamp string  `json:"first_timestamp"`
+	LastTimestamp  string  `json:"last_timestamp"`
+	MinDuration    float64 `json:"min_duration_ms"`
+	MaxDuration    float64 `json:"max_duration_ms"`
+}
+
+// historyCollapser merges runs of identical entries as they are scanned,
+// holding only the current run. Entries only merge with their neighbours:
+// `ls`, `cat`, `ls` is three rows, so the history still reads in order.
+type historyCollapser struct {
+	emit    func(HistoryGroup) error
+	current *HistoryGroup
+}
+
+// Add extends the current run with e, or emits the run and starts a new one.
+func (c *historyCollapser) Add(e *AuditEntry) error {
+	if g := c.current; g != nil && sameHistoryRun(&g.AuditEntry, e) {
+		g.Count++
+		g.LastTimestamp = e.Timestamp
+		g.MinDuration = min(g.MinDuration, e.Duration)
+		g.MaxDuration = max(g.MaxDuration, e.Duration)
+		return nil
+	}
+	if err := c.Flush(); err != nil {
+		return err
+	}
+	c.current = &HistoryGroup{
+		AuditEntry:     *e,
+		Count:          1,
+		FirstTimestamp: e.Timestamp,
+		LastTimestamp:  e.Timestamp,
+		MinDuration:    e.Duration,
+		MaxDuration:    e.Duration,
+	}
+	return nil
+}
+
+// Flush emits the current run, if any.
+func (c *historyCollapser) Flush() error {
+	if c.current == nil {
+		return nil
+	}
+	g := *c.current
+	c.current = nil
+	return c.emit(g)
+}
+
+// sameHistoryRun reports whether two entries collapse into one row.
+func sameHistoryRun(a, b *AuditEntry) bool {
+	return a.Command == b.Command && slices.Equal(a.Args, b.Args) &&
+		a.Decision == b.Decision && a.Outcome == b.Outcome && a.Detail == b.Detail &&
+		a.ContainerID == b.ContainerID && a.Completed == b.Completed
+}
+
+// historyCSVColumns is the header of CSV exports.
+var historyCSVColumns = []string{
+	"timestamp", "request_id", "argv", "cwd", "uid", "gid",
+	"container_id", "jail_id", "decision", "outcome", "detail", "exit_code", "duration_ms",
+	"timeout_violation", "delivery", "issued_to", "transcript", "error",
+}
+
+// historyExporter writes audit entries in an export format.
+type historyExporter interface {
+	Write(e *AuditEntry) error
+	Flush() error
+}
+
+// newHistoryExporter returns an exporter for format writing to w.
+func newHistoryExporter(format string, w io.Writer) (historyExporter, error) {
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write(historyCSVColumns); err != nil {
+			return nil, err
+		}
+		return &csvExporter{w: cw}, nil
+	case "jsonl":
+		return &jsonlExporter{enc: json.NewEncoder(w)}, nil
+	}
+	return nil, fmt.Errorf("unknown export format %q", format)
+}
+
+// csvExporter writes one row per entry, with the command line as a single
+// shell-quoted cell.
+type csvExporter struct {
+	w *csv.Writer
+}
+
+func (x *csvExporter) Write(e *AuditEntry) error {
+	var exitCode, duration string
+	if e.ExitCode != 0 || e.Delivery != "" {
+		exitCode = strconv.Itoa(e.ExitCode)
+	}
+	if e.Completed != "" {
+		exitCode = e.Completed // A started entry: "unknown" or "running"
+	}
+	if e.Duration > 0 {
+		duration = strconv.FormatFloat(e.Duration, 'f', -1, 64)
+	}
+	var timeout string
+	if e.TimeoutViolation {
+		timeout = "true"
+	}
+	return x.w.Write([]string{
+		csvCell(e.Timestamp),
+		csvCell(e.RequestID),
+		csvCell(shellJoin(append([]string{e.Command}, e.Args...))),
+		csvCell(e.Cwd),
+		strconv.Itoa(e.Identity.UID),
+		strconv.Itoa(e.Identity.GID),
+		csvCell(e.ContainerID),
+		csvCell(e.JailID),
+		csvCell(e.Decision.String()),
+		csvCell(e.Outcome.String()),
+		csvCell(e.Detail),
+		exitCode,
+		duration,
+		timeout,
+		csvCell(e.Delivery),
+		csvCell(e.IssuedTo),
+		csvCell(e.Transcript),
+		csvCell(e.Error),
+	})
+}
+
+func (x *csvExporter) Flush() error {
+	x.w.Flush()
+	return x.w.Error()
+}
+
+// jsonlExporter writes each entry as a JSON line, as the audit log does.
+type jsonlExporter struct {
+	enc *json.Encoder
+}
+
+func (x *jsonlExporter) Write(e *AuditEntry) error { return x.enc.Encode(e) }
+func (x *jsonlExporter) Flush() error              { return nil }
+
+// csvCell defuses text a spreadsheet would run as a formula by prefixing a
+// single quote. Quoting of commas, quotes and newlines is left to the CSV
+// writer.
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// shellJoin renders argv as a POSIX shell command line, single-quoting
+// words that contain anything beyond a safe set of characters.
+func shellJoin(argv []string) string {
+	words := make([]string, len(argv))
+	for i, arg := range argv {
+		words[i] = shellQuoteWord(arg)
+	}
+	return strings.Join(words, " ")
+}
+
+// shellQuoteWord quotes one argument for shellJoin.
+func shellQuoteWord(s string) string {
+	if s == "" {
+		return "''"
+	}
+	for _, r := range s {
+		safe := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("_@%+=:,./-", r)
+		if !safe {
+			return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+		}
+	}
+	return s
+}
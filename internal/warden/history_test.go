@@ -0,0 +1,340 @@
+package warden
+
+import (
+	"bytes"
+	"clawrden/pkg/protocol"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// checkGolden compares got against testdata/<name>.golden.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("update golden: %v", err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output mismatch for %s\n--- got ---\n%s\n--- want ---\n%s", name, got, want)
+	}
+}
+
+// trickyEntries are audit entries whose fields need escaping in CSV.
+var trickyEntries = []AuditEntry{
+	{Timestamp: "2026-01-05T10:00:00Z", Command: "ls", Args: []string{"-la"}, Cwd: "/app", Decision: protocol.DecisionAllow, Delivery: "complete", Duration: 12},
+	{Timestamp: "2026-01-05T10:00:01Z", Command: "git", Args: []string{"commit", "-m", "fix: a, b and \"c\""}, Cwd: "/app/repo, with comma", Decision: protocol.DecisionAllow, ExitCode: 1, Delivery: "complete"},
+	{Timestamp: "2026-01-05T10:00:02Z", Command: "sh", Args: []string{"-c", "echo 'hi'\nrm -rf /"}, Cwd: "/app", Decision: protocol.DecisionDeny, Error: "multi\nline \"error\""},
+	{Timestamp: "2026-01-05T10:00:03Z", Command: "=cmd", Args: []string{"", "+1", "@sum"}, Cwd: "/app", Decision: protocol.DecisionDeny, Outcome: protocol.OutcomeAfterHITL, RequestID: "req-1", ContainerID: "abc123", JailID: "ci"},
+}
+
+func TestHistoryExportCSVGolden(t *testing.T) {
+	var buf bytes.Buffer
+	x, err := newHistoryExporter("csv", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range trickyEntries {
+		if err := x.Write(&trickyEntries[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := x.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "history_export_csv", buf.Bytes())
+
+	// Whatever the escaping, a CSV reader gets each argv back in one cell
+	records, err := csv.NewReader(bytes.NewReader(buf.Bytes())).ReadAll()
+	if err != nil {
+		t.Fatalf("exported CSV does not parse: %v", err)
+	}
+	if len(records) != len(trickyEntries)+1 {
+		t.Fatalf("got %d records, want header + %d", len(records), len(trickyEntries))
+	}
+	if got := records[3][2]; got != "sh -c 'echo '\\''hi'\\''\nrm -rf /'" {
+		t.Errorf("argv cell = %q", got)
+	}
+}
+
+func TestShellJoin(t *testing.T) {
+	tests := []struct {
+		argv []string
+		want string
+	}{
+		{[]string{"npm", "install", "--save-dev", "a@1.2.3"}, "npm install --save-dev a@1.2.3"},
+		{[]string{"echo", "two words"}, "echo 'two words'"},
+		{[]string{"echo", "it's"}, `echo 'it'\''s'`},
+		{[]string{"echo", ""}, "echo ''"},
+		{[]string{"echo", "$HOME", "*"}, "echo '$HOME' '*'"},
+	}
+	for _, tt := range tests {
+		if got := shellJoin(tt.argv); got != tt.want {
+			t.Errorf("shellJoin(%q) = %s, want %s", tt.argv, got, tt.want)
+		}
+	}
+}
+
+func TestParseHistoryFilter(t *testing.T) {
+	now := time.Date(2026, 4, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		query   string
+		since   time.Time
+		until   time.Time
+		wantErr bool
+	}{
+		{query: "since=90d", since: now.Add(-90 * 24 * time.Hour)},
+		{query: "since=12h", since: now.Add(-12 * time.Hour)},
+		{query: "since=2026-01-01&until=2026-04-01", since: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), until: time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{query: "since=2026-01-01T08:00:00Z", since: time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC)},
+		{query: "since=-3d", wantErr: true},
+		{query: "since=yesterday", wantErr: true},
+		{query: "until=90d", wantErr: true},
+	}
+	for _, tt := range tests {
+		q, _ := url.ParseQuery(tt.query)
+		f, err := ParseHistoryFilter(q, now)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.query, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (!f.Since.Equal(tt.since) || !f.Until.Equal(tt.until)) {
+			t.Errorf("%s: since %v until %v, want %v and %v", tt.query, f.Since, f.Until, tt.since, tt.until)
+		}
+	}
+}
+
+func TestHistoryFilterMatch(t *testing.T) {
+	since, _ := time.Parse(time.RFC3339, "2026-01-05T10:00:01Z")
+	until, _ := time.Parse(time.RFC3339, "2026-01-05T10:00:03Z")
+	tests := []struct {
+		filter HistoryFilter
+		want   []string
+	}{
+		{HistoryFilter{}, []string{"ls", "git", "sh", "=cmd"}},
+		{HistoryFilter{Decision: "deny"}, []string{"sh", "=cmd"}},
+		{HistoryFilter{Decision: "deny (after HITL)"}, []string{"=cmd"}},
+		{HistoryFilter{Outcome: "after_hitl"}, []string{"=cmd"}},
+		{HistoryFilter{Command: "git"}, []string{"git"}},
+		{HistoryFilter{Container: "abc"}, []string{"=cmd"}},
+		{HistoryFilter{RequestID: "req-1"}, []string{"=cmd"}},
+		{HistoryFilter{Since: since, Until: until}, []string{"git", "sh"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for i := range trickyEntries {
+			if tt.filter.Match(&trickyEntries[i]) {
+				got = append(got, trickyEntries[i].Command)
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%+v matched %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestScanAuditLogSkipsMalformedLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeTestFile(t, path, `{"command":"ls"}
+not json
+{"command":"pwd"}
+
+{"command":"cat"`)
+	var commands []string
+	err := ScanAuditLog(path, func(e AuditEntry) error {
+		commands = append(commands, e.Command)
+		return nil
+	})
+	if err != nil || strings.Join(commands, ",") != "ls,pwd" {
+		t.Errorf("ScanAuditLog = %v, %v; want ls,pwd", commands, err)
+	}
+}
+
+func TestHistoryExportAPI(t *testing.T) {
+	api, _ := newTestAPIServer(t, Config{})
+	api.warden.config.AuditPath = filepath.Join(t.TempDir(), "audit.log")
+	var log bytes.Buffer
+	enc := json.NewEncoder(&log)
+	for _, e := range trickyEntries {
+		enc.Encode(e)
+	}
+	writeTestFile(t, api.warden.config.AuditPath, log.String())
+
+	tests := []struct {
+		query    string
+		want     int
+		wantType string
+		wantRows int
+	}{
+		{"format=csv", http.StatusOK, "text/csv; charset=utf-8", 5},
+		{"", http.StatusOK, "text/csv; charset=utf-8", 5},
+		{"format=csv&decision=deny", http.StatusOK, "text/csv; charset=utf-8", 3},
+		{"format=jsonl&command=git", http.StatusOK, "application/x-ndjson", 1},
+		{"format=xml", http.StatusBadRequest, "", 0},
+		{"since=soon", http.StatusBadRequest, "", 0},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/history/export?"+tt.query, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%q: status = %d, want %d: %s", tt.query, rec.Code, tt.want, rec.Body.String())
+			continue
+		}
+		if tt.want != http.StatusOK {
+			continue
+		}
+		if got := rec.Header().Get("Content-Type"); got != tt.wantType {
+			t.Errorf("%q: Content-Type = %q, want %q", tt.query, got, tt.wantType)
+		}
+		if got := rec.Header().Get("Content-Disposition"); !strings.HasPrefix(got, `attachment; filename="clawrden-history-`) {
+			t.Errorf("%q: Content-Disposition = %q", tt.query, got)
+		}
+		rows := 0
+		if strings.HasPrefix(tt.wantType, "text/csv") {
+			records, err := csv.NewReader(rec.Body).ReadAll()
+			if err != nil {
+				t.Fatalf("%q: %v", tt.query, err)
+			}
+			rows = len(records)
+		} else {
+			rows = strings.Count(rec.Body.String(), "\n")
+		}
+		if rows != tt.wantRows {
+			t.Errorf("%q: %d rows, want %d", tt.query, rows, tt.wantRows)
+		}
+	}
+
+	// The same filters apply to /api/history
+	rec := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/history?decision=deny", nil))
+	var entries []AuditEntry
+	if err := json.NewDecoder(rec.Body).Decode(&entries); err != nil || len(entries) != 2 {
+		t.Errorf("/api/history?decision=deny = %d entries, %v; want 2", len(entries), err)
+	}
+}
+
+// repeatedEntries interleaves runs of the same command, as an agent retrying
+// in a loop would.
+var repeatedEntries = []AuditEntry{
+	{Timestamp: "2026-01-05T10:00:00Z", Command: "ls", Args: []string{"-la"}, Decision: protocol.DecisionAllow, ContainerID: "abc", Duration: 12},
+	{Timestamp: "2026-01-05T10:00:01Z", Command: "ls", Args: []string{"-la"}, Decision: protocol.DecisionAllow, ContainerID: "abc", Duration: 30},
+	{Timestamp: "2026-01-05T10:00:02Z", Command: "ls", Args: []string{"-la"}, Decision: protocol.DecisionAllow, ContainerID: "abc", Duration: 7},
+	{Timestamp: "2026-01-05T10:00:03Z", Command: "ls", Args: []string{"-l", "a"}, Decision: protocol.DecisionAllow, ContainerID: "abc", Duration: 5},
+	{Timestamp: "2026-01-05T10:00:04Z", Command: "ls", Args: []string{"-la"}, Decision: protocol.DecisionAllow, ContainerID: "abc", Duration: 9},
+	{Timestamp: "2026-01-05T10:00:05Z", Command: "ls", Args: []string{"-la"}, Decision: protocol.DecisionAllow, ContainerID: "def", Duration: 9},
+	{Timestamp: "2026-01-05T10:00:06Z", Command: "rm", Args: []string{"-rf", "/"}, Decision: protocol.DecisionDeny, ContainerID: "def"},
+	{Timestamp: "2026-01-05T10:00:07Z", Command: "rm", Args: []string{"-rf", "/"}, Decision: protocol.DecisionDeny, ContainerID: "def"},
+	{Timestamp: "2026-01-05T10:00:08Z", Command: "rm", Args: []string{"-rf", "/"}, Decision: protocol.DecisionDeny, Outcome: protocol.OutcomeAfterHITL, ContainerID: "def"},
+}
+
+func TestHistoryCollapser(t *testing.T) {
+	var groups []HistoryGroup
+	c := &historyCollapser{emit: func(g HistoryGroup) error {
+		groups = append(groups, g)
+		return nil
+	}}
+	for i := range repeatedEntries {
+		if err := c.Add(&repeatedEntries[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only consecutive entries merge: the `ls -la` after `ls -l a` starts a
+	// new row rather than joining the first, and so does a change of
+	// container or decision.
+	want := []struct {
+		command     string
+		count       int
+		first, last string
+		min, max    float64
+	}{
+		{"ls", 3, "2026-01-05T10:00:00Z", "2026-01-05T10:00:02Z", 7, 30},
+		{"ls", 1, "2026-01-05T10:00:03Z", "2026-01-05T10:00:03Z", 5, 5},
+		{"ls", 1, "2026-01-05T10:00:04Z", "2026-01-05T10:00:04Z", 9, 9},
+		{"ls", 1, "2026-01-05T10:00:05Z", "2026-01-05T10:00:05Z", 9, 9},
+		{"rm", 2, "2026-01-05T10:00:06Z", "2026-01-05T10:00:07Z", 0, 0},
+		{"rm", 1, "2026-01-05T10:00:08Z", "2026-01-05T10:00:08Z", 0, 0},
+	}
+	if len(groups) != len(want) {
+		t.Fatalf("%d groups, want %d: %+v", len(groups), len(want), groups)
+	}
+	for i, w := range want {
+		g := groups[i]
+		if g.Command != w.command || g.Count != w.count || g.FirstTimestamp != w.first || g.LastTimestamp != w.last ||
+			g.MinDuration != w.min || g.MaxDuration != w.max {
+			t.Errorf("group %d = %s x%d %s..%s %v-%vms; want %+v", i, g.Command, g.Count,
+				g.FirstTimestamp, g.LastTimestamp, g.MinDuration, g.MaxDuration, w)
+		}
+	}
+	// The group carries its first entry
+	if groups[0].Timestamp != "2026-01-05T10:00:00Z" || groups[0].Duration != 12 {
+		t.Errorf("group 0 entry = %+v, want the first ls", groups[0].AuditEntry)
+	}
+}
+
+func TestHistoryCollapseAPI(t *testing.T) {
+	api, _ := newTestAPIServer(t, Config{})
+	api.warden.config.AuditPath = filepath.Join(t.TempDir(), "audit.log")
+	var log bytes.Buffer
+	enc := json.NewEncoder(&log)
+	for _, e := range repeatedEntries {
+		enc.Encode(e)
+	}
+	writeTestFile(t, api.warden.config.AuditPath, log.String())
+
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/history?"+query, nil))
+		return rec
+	}
+
+	// Filters apply before collapsing
+	var groups []HistoryGroup
+	rec := get("collapse=true&container=abc")
+	if err := json.NewDecoder(rec.Body).Decode(&groups); err != nil {
+		t.Fatalf("collapse: %d %v", rec.Code, err)
+	}
+	var counts []int
+	for _, g := range groups {
+		counts = append(counts, g.Count)
+	}
+	if fmt.Sprint(counts) != "[3 1 1]" || groups[0].LastTimestamp != "2026-01-05T10:00:02Z" {
+		t.Errorf("collapsed counts = %v, want [3 1 1]: %+v", counts, groups)
+	}
+
+	var entries []AuditEntry
+	if err := json.NewDecoder(get("collapse=false").Body).Decode(&entries); err != nil || len(entries) != len(repeatedEntries) {
+		t.Errorf("collapse=false = %d entries, %v; want %d", len(entries), err, len(repeatedEntries))
+	}
+
+	if rec := get("collapse=maybe"); rec.Code != http.StatusBadRequest {
+		t.Errorf("collapse=maybe: status %d, want 400", rec.Code)
+	}
+
+	// Exports keep every entry
+	rec = httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/history/export?format=jsonl&collapse=true", nil))
+	if n := strings.Count(rec.Body.String(), "\n"); n != len(repeatedEntries) {
+		t.Errorf("export with collapse=true = %d lines, want %d", n, len(repeatedEntries))
+	}
+}
@@ -1,11 +1,18 @@
 package warden
 
 import (
+	"clawrden/internal/events"
 	"clawrden/pkg/protocol"
 	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Decision represents a human reviewer's decision.
@@ -21,68 +28,365 @@ type PendingRequest struct {
 	ID        string            `json:"id"`
 	Request   *protocol.Request `json:"request"`
 	Timestamp time.Time         `json:"timestamp"`
-	decision  chan Decision
+	Env       *EnvReport        `json:"env,omitempty"` // What was scrubbed from the request's environment
+	Subcommands []SubcommandDecision `json:"subcommands,omitempty"` // Per-command decisions for shell scripts
+	TaskID    string            `json:"task_id,omitempty"` // Caller's correlation IDs (CLAWRDEN_TASK_ID, CLAWRDEN_RUN_ID)
+	RunID     string            `json:"run_id,omitempty"`
+	Risk      RiskTier          `json:"risk,omitempty"`
+	AutoApproveAt *time.Time    `json:"auto_approve_at,omitempty"` // When a low-risk ask is approved unless denied first
+	Annotations []Annotation    `json:"annotations,omitempty"` // Impact context, like how much rm would delete
+	FirstViewedAt *time.Time    `json:"first_viewed_at,omitempty"` // When a reviewer first saw it (see MarkViewed)
+	Approvers int               `json:"approvers,omitempty"` // Different reviewers who must approve, when more than one
+	Approvals []Approval        `json:"approvals,omitempty"` // Approvals so far of a request that needs several
+	Channels  []string          `json:"channels,omitempty"`  // Where it is posted and may be approved; empty means everywhere
+
+	// Reminders: a new generation is due every renotify_after the request
+	// waits, and bridges acknowledge each one they post (see MarkNotified)
+	NotifyGeneration    int            `json:"notify_generation"`
+	NotifiedCount       int            `json:"notified_count"`
+	LastNotifiedAt      *time.Time     `json:"last_notified_at,omitempty"`
+	NotifiedGenerations map[string]int `json:"notified_generations,omitempty"` // Last generation each bridge posted
+	renotifyAfter       time.Duration
+
+	decision  chan resolution
+
+	// Monotonic readings of Timestamp and FirstViewedAt, which durations and
+	// queue order are taken from; the wall times are only shown
+	queuedMono time.Duration
+	viewedMono time.Duration
+}
+
+// resolution is a reviewer's decision and, for approvals, the execution
+// overrides they chose.
+type resolution struct {
+	decision  Decision
+	overrides *ExecutionOverrides
+	automatic bool // Sent by a soft ask's timer
+	reviewer  string
+	message   string // For the agent, like "run the tests afterwards"
+	approvals []Approval
+}
+
+// Approval is one reviewer's approval of a request that needs several.
+type Approval struct {
+	Reviewer string    `json:"reviewer"`
+	Channel  string    `json:"channel,omitempty"`
+	At       time.Time `json:"at"`
+}
+
+// Review is a reviewer's decision on a pending request.
+type Review struct {
+	Decision  Decision
+	Overrides *ExecutionOverrides // Validated; approvals only
+	Message   string              // Checked with CleanReviewerMessage
+
+	// Who decided, told apart from other reviewers of a request that needs
+	// several approvals, and the channel they decided through (e.g.
+	// ChannelDashboard). An empty channel is not checked against the
+	// request's channels.
+	Reviewer string
+	Channel  string
+
+	// Reviewer and Channel come from a credential or the warden's own
+	// terminal rather than the client's word. Only such approvals count
+	// towards requests that need several approvals or are routed to
+	// channels, since anyone else could name a second reviewer or another
+	// channel.
+	Authenticated bool
+}
+
+// ReviewInfo is extra context shown to reviewers alongside a request.
+type ReviewInfo struct {
+	Env         *EnvReport
+	Subcommands []SubcommandDecision
+
+	// Risk tier of the ask. A positive AutoApproveAfter makes it a soft ask,
+	// approved once that long has passed without a decision.
+	Risk             RiskTier
+	AutoApproveAfter time.Duration
+
+	Annotations []Annotation
+
+	// Approvers different reviewers must approve the request; 0 means one.
+	// Approvals through channels other than Channels are refused; denials
+	// are taken from anywhere.
+	Approvers int
+	Channels  []string
+
+	// How often bridges remind reviewers of the request while it waits;
+	// 0 means never
+	RenotifyAfter time.Duration
+
+	// OnQueued, if set, is called with the request's ID and place in the
+	// queue (1 for the oldest request) once it is queued, before the wait.
+	OnQueued func(id string, position int)
 }
 
 // HITLQueue manages pending requests awaiting human approval.
 type HITLQueue struct {
 	mu       sync.RWMutex
 	pending  map[string]*PendingRequest
-	counter  atomic.Int64
+	events   *events.Bus // Optional; receives HITLEnqueued and HITLResolved
+
+	now   func() time.Time
+	mono  func() time.Duration                // See monotonicNow
+	after func(time.Duration) <-chan time.Time // Soft ask timers
 }
 
 // NewHITLQueue creates a new HITL approval queue.
 func NewHITLQueue() *HITLQueue {
 	return &HITLQueue{
 		pending: make(map[string]*PendingRequest),
+		now:     time.Now,
+		mono:    monotonicNow,
+		after:   time.After,
 	}
 }
 
+// Outcome describes how a request left the pending queue.
+type Outcome struct {
+	ID       string
+	Decision Decision
+	Expired  bool // The context ended before a reviewer decided (Decision is DecisionDeny)
+
+	// A soft ask's timer approved the request, not a reviewer
+	Automatic bool
+
+	Overrides *ExecutionOverrides // How the reviewer changed the execution, if they did
+	Reviewer  string              // Who decided, if known (e.g. "console")
+	Message   string              // The reviewer's message to the agent, if they left one
+	Approvals []Approval          // Who approved a request that needed several approvals
+
+	// How long the request waited, and how long until a reviewer first saw
+	// it (nil if nobody did)
+	Waited      time.Duration
+	FirstViewed *time.Duration
+
+	// The wall clock was stepped while the request waited; Waited and
+	// FirstViewed come from the monotonic clock regardless
+	ClockSkew bool
+}
+
 // Enqueue adds a request to the pending queue and blocks until a decision is made
 // or the context is cancelled. Returns the decision.
 func (q *HITLQueue) Enqueue(ctx context.Context, req *protocol.Request) Decision {
+	return q.EnqueueOutcome(ctx, req, nil).Decision
+}
+
+// EnqueueOutcome is like Enqueue but also reports the assigned request ID and
+// whether the request expired instead of being decided. info, if non-nil, is
+// shown to reviewers alongside the request.
+func (q *HITLQueue) EnqueueOutcome(ctx context.Context, req *protocol.Request, info *ReviewInfo) Outcome {
 	id := q.nextID()
 	pr := &PendingRequest{
 		ID:        id,
 		Request:   req,
-		Timestamp: time.Now(),
-		decision:  make(chan Decision, 1),
+		Timestamp: q.now(),
+		TaskID:    req.TaskID,
+		RunID:     req.RunID,
+		decision:  make(chan resolution, 1),
+		queuedMono: q.mono(),
+	}
+	var autoApprove <-chan time.Time // nil blocks forever
+	if info != nil {
+		pr.Env = info.Env
+		pr.Subcommands = info.Subcommands
+		pr.Risk = info.Risk
+		pr.Annotations = info.Annotations
+		pr.renotifyAfter = info.RenotifyAfter
+		pr.Channels = info.Channels
+		if info.Approvers > 1 {
+			pr.Approvers = info.Approvers
+		}
+		if info.AutoApproveAfter > 0 {
+			at := pr.Timestamp.Add(info.AutoApproveAfter)
+			pr.AutoApproveAt = &at
+			autoApprove = q.after(info.AutoApproveAfter)
+		}
 	}
 
 	q.mu.Lock()
 	q.pending[id] = pr
+	position := 1
+	for _, other := range q.pending {
+		if other.queuedMono < pr.queuedMono {
+			position++
+		}
+	}
 	q.mu.Unlock()
+	q.events.Publish(events.HITLEnqueued{ID: id, Request: req})
+	if info != nil && info.OnQueued != nil {
+		info.OnQueued(id, position)
+	}
 
-	defer func() {
-		q.mu.Lock()
-		delete(q.pending, id)
-		q.mu.Unlock()
-	}()
-
+	var outcome Outcome
 	select {
-	case d := <-pr.decision:
-		return d
+	case r := <-pr.decision:
+		outcome = Outcome{ID: id, Decision: r.decision, Overrides: r.overrides, Reviewer: r.reviewer, Message: r.message, Approvals: r.approvals}
+	case <-autoApprove:
+		// Claim the decision slot like a reviewer would; a decision that
+		// got there first wins over the timer
+		select {
+		case pr.decision <- resolution{decision: DecisionApprove, automatic: true}:
+		default:
+		}
+		r := <-pr.decision
+		outcome = Outcome{ID: id, Decision: r.decision, Overrides: r.overrides, Automatic: r.automatic, Reviewer: r.reviewer, Message: r.message}
 	case <-ctx.Done():
-		return DecisionDeny
+		outcome = Outcome{ID: id, Decision: DecisionDeny, Expired: true}
+	}
+
+	q.mu.Lock()
+	delete(q.pending, id)
+	if pr.FirstViewedAt != nil {
+		viewed, skewed := elapsed(pr.queuedMono, pr.viewedMono, pr.Timestamp, *pr.FirstViewedAt)
+		outcome.FirstViewed = &viewed
+		outcome.ClockSkew = skewed
 	}
+	q.mu.Unlock()
+	waited, skewed := elapsed(pr.queuedMono, q.mono(), pr.Timestamp, q.now())
+	outcome.Waited = waited
+	outcome.ClockSkew = outcome.ClockSkew || skewed
+	q.events.Publish(events.HITLResolved{
+		ID:       id,
+		Request:  req,
+		Approved: outcome.Decision == DecisionApprove,
+		Expired:   outcome.Expired,
+		Automatic: outcome.Automatic,
+		Waited:    outcome.Waited,
+	})
+	return outcome
 }
 
-// Resolve resolves a pending request with the given decision.
+// Errors of Review.
+var (
+	errAlreadyDecided   = errors.New("request already decided")
+	errChannelNotRouted = errors.New("request cannot be approved through this channel")
+	errApprovedTwice    = errors.New("reviewer already approved this request")
+	errNoReviewer       = errors.New("request needs several approvals, so the reviewer must be named")
+	errUnauthenticated  = errors.New("request needs an approval from an authenticated reviewer")
+)
+
+// Resolve resolves a pending request with the given decision. A request
+// that needs several approvals takes one approval from each named reviewer
+// (see Review), so it cannot be approved this way.
 func (q *HITLQueue) Resolve(id string, decision Decision) bool {
-	q.mu.RLock()
-	pr, ok := q.pending[id]
-	q.mu.RUnlock()
+	_, err := q.Review(id, Review{Decision: decision})
+	return err == nil
+}
+
+// Review passes a reviewer's decision to a pending request and returns how
+// many more approvals it needs. A denial decides the request at once. An
+// approval counts once per reviewer, and decides the request once it has
+// as many as it needs, with the overrides and message of the last one.
+func (q *HITLQueue) Review(id string, review Review) (remaining int, err error) {
+	r := resolution{decision: review.Decision, overrides: review.Overrides, reviewer: review.Reviewer, message: review.Message}
 
+	q.mu.Lock()
+	pr, ok := q.pending[id]
 	if !ok {
-		return false
+		q.mu.Unlock()
+		return 0, errNotPending
 	}
+	if review.Decision == DecisionApprove {
+		if (pr.Approvers > 1 || len(pr.Channels) > 0) && !review.Authenticated {
+			q.mu.Unlock()
+			return 0, errUnauthenticated
+		}
+		if review.Channel != "" && len(pr.Channels) > 0 && !slices.Contains(pr.Channels, review.Channel) {
+			q.mu.Unlock()
+			return 0, fmt.Errorf("%w %q; it is routed to %s", errChannelNotRouted, review.Channel, strings.Join(pr.Channels, ", "))
+		}
+		if pr.Approvers > 1 {
+			switch {
+			case review.Reviewer == "":
+				q.mu.Unlock()
+				return 0, errNoReviewer
+			case slices.ContainsFunc(pr.Approvals, func(a Approval) bool { return a.Reviewer == review.Reviewer }):
+				q.mu.Unlock()
+				return 0, errApprovedTwice
+			}
+			pr.Approvals = append(pr.Approvals, Approval{Reviewer: review.Reviewer, Channel: review.Channel, At: q.now()})
+			if remaining = pr.Approvers - len(pr.Approvals); remaining > 0 {
+				q.mu.Unlock()
+				return remaining, nil
+			}
+			r.approvals = slices.Clone(pr.Approvals)
+		}
+	}
+	q.mu.Unlock()
 
 	select {
-	case pr.decision <- decision:
-		return true
+	case pr.decision <- r:
+		return 0, nil
 	default:
-		return false // Already resolved
+		return 0, errAlreadyDecided
+	}
+}
+
+// MarkViewed records that a reviewer saw a pending request and returns when
+// one first did. Only the first view is kept, however many reviewers look.
+func (q *HITLQueue) MarkViewed(id string) (time.Time, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	pr, ok := q.pending[id]
+	if !ok {
+		return time.Time{}, false
 	}
+	if pr.FirstViewedAt == nil {
+		now := q.now()
+		pr.FirstViewedAt = &now
+		pr.viewedMono = q.mono()
+	}
+	return *pr.FirstViewedAt, true
+}
+
+// errNotPending is returned for a request that is not, or no longer, in the
+// queue.
+var errNotPending = errors.New("no such pending request")
+
+// MarkNotified records that bridge posted generation of a pending request's
+// reminders (0 for its first notification) and returns the request. Each
+// bridge's acknowledgements only count once per generation, so a bridge
+// that restarts and acknowledges again changes nothing.
+func (q *HITLQueue) MarkNotified(id, bridge string, generation int) (PendingRequest, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	pr, ok := q.pending[id]
+	if !ok {
+		return PendingRequest{}, errNotPending
+	}
+	if due := pr.generation(q.mono()); generation < 0 || generation > due {
+		return PendingRequest{}, fmt.Errorf("generation %d is not due; the request is at generation %d", generation, due)
+	}
+	last, acked := pr.NotifiedGenerations[bridge]
+	if !acked || generation > last {
+		if pr.NotifiedGenerations == nil {
+			pr.NotifiedGenerations = make(map[string]int)
+		}
+		pr.NotifiedGenerations[bridge] = generation
+		pr.NotifiedCount++
+		now := q.now()
+		pr.LastNotifiedAt = &now
+	}
+	return pr.snapshot(q.mono()), nil
+}
+
+// generation returns how many renotify intervals the request has waited
+// at the monotonic reading mono.
+func (pr *PendingRequest) generation(mono time.Duration) int {
+	if pr.renotifyAfter <= 0 {
+		return 0
+	}
+	return int((mono - pr.queuedMono) / pr.renotifyAfter)
+}
+
+// IsPending reports whether a request is waiting for a decision.
+func (q *HITLQueue) IsPending(id string) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	_, ok := q.pending[id]
+	return ok
 }
 
 // List returns all currently pending requests.
@@ -90,34 +394,80 @@ func (q *HITLQueue) List() []PendingRequest {
 	q.mu.RLock()
 	defer q.mu.RUnlock()
 
+	mono := q.mono()
 	result := make([]PendingRequest, 0, len(q.pending))
 	for _, pr := range q.pending {
-		result = append(result, PendingRequest{
-			ID:        pr.ID,
-			Request:   pr.Request,
-			Timestamp: pr.Timestamp,
-		})
+		result = append(result, pr.snapshot(mono))
 	}
 	return result
 }
 
+// snapshot copies the request's public fields for callers outside the
+// lock, with its reminder generation at mono.
+func (pr *PendingRequest) snapshot(mono time.Duration) PendingRequest {
+	return PendingRequest{
+		ID:        pr.ID,
+		Request:   pr.Request,
+		Timestamp: pr.Timestamp,
+		Env:       pr.Env,
+		Subcommands: pr.Subcommands,
+		TaskID:    pr.TaskID,
+		RunID:     pr.RunID,
+		Risk:      pr.Risk,
+		AutoApproveAt: pr.AutoApproveAt,
+		Annotations: pr.Annotations,
+		FirstViewedAt: pr.FirstViewedAt,
+		Approvers: pr.Approvers,
+		Approvals: slices.Clone(pr.Approvals),
+		Channels:  pr.Channels,
+		NotifyGeneration:    pr.generation(mono),
+		NotifiedCount:       pr.NotifiedCount,
+		LastNotifiedAt:      pr.LastNotifiedAt,
+		NotifiedGenerations: maps.Clone(pr.NotifiedGenerations),
+	}
+}
+
+// Get returns a pending request by ID.
+func (q *HITLQueue) Get(id string) (PendingRequest, bool) {
+	for _, pr := range q.List() {
+		if pr.ID == id {
+			return pr, true
+		}
+	}
+	return PendingRequest{}, false
+}
+
 // nextID generates a unique request ID.
 func (q *HITLQueue) nextID() string {
-	n := q.counter.Add(1)
-	return "req-" + time.Now().Format("20060102-150405") + "-" + itoa(n)
+	return newID("req", time.Now())
 }
 
-// itoa is a simple int-to-string without importing strconv.
-func itoa(n int64) string {
-	if n == 0 {
-		return "0"
+// MaxReviewerMessage is the longest message a reviewer may leave the agent,
+// in bytes.
+const MaxReviewerMessage = 500
+
+// CleanReviewerMessage prepares a reviewer's message for the agent's
+// terminal: control characters, newlines included, become spaces, so the
+// message stays on its one prefixed line and cannot move the cursor or
+// change colors. Messages longer than MaxReviewerMessage are refused.
+func CleanReviewerMessage(message string) (string, error) {
+	if !utf8.ValidString(message) {
+		return "", fmt.Errorf("message to requester is not valid UTF-8")
 	}
-	var buf [20]byte
-	pos := len(buf)
-	for n > 0 {
-		pos--
-		buf[pos] = byte('0' + n%10)
-		n /= 10
+	message = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, message))
+	if len(message) > MaxReviewerMessage {
+		return "", fmt.Errorf("message to requester is %d bytes; at most %d are allowed", len(message), MaxReviewerMessage)
 	}
-	return string(buf[pos:])
+	return message, nil
+}
+
+// reviewerNote is how a reviewer's message reaches the agent: a stderr line
+// that cannot be mistaken for the command's own output.
+func reviewerNote(message string) string {
+	return "clawrden reviewer: " + message + "\n"
 }
@@ -0,0 +1,238 @@
+package warden
+
+import (
+	"bytes"
+	"clawrden/internal/executor"
+	"clawrden/pkg/protocol"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Hook stages, for an AuditEntry's Hook.
+const (
+	HookPre  = "pre"
+	HookPost = "post"
+)
+
+// HookOutput is what the shim is sent of a hook's output.
+type HookOutput string
+
+const (
+	HookOutputPrefix   HookOutput = "prefix"   // Stdout and stderr go to stderr, each line prefixed with the hook (default)
+	HookOutputSuppress HookOutput = "suppress" // Nothing
+)
+
+// Hook is a command a rule runs before (pre) or after (post) the command it
+// matches, with the same executor, identity and environment. In Command and
+// Args, {{cwd}} is replaced by the request's working directory,
+// {{request_id}} by its request ID and {{args}} by its arguments: an
+// argument of just "{{args}}" becomes all of them, and elsewhere they are
+// joined with spaces.
+type Hook struct {
+	Command string     `yaml:"command"`
+	Args    []string   `yaml:"args,omitempty"`
+	Output  HookOutput `yaml:"output,omitempty"`
+}
+
+// validateHooks checks the hooks of a rule.
+func validateHooks(stages ...[]Hook) error {
+	for _, hooks := range stages {
+		for _, h := range hooks {
+			if h.Command == "" {
+				return fmt.Errorf("hook command is required")
+			}
+			switch h.Output {
+			case "", HookOutputPrefix, HookOutputSuppress:
+			default:
+				return fmt.Errorf("hook %s: output must be prefix or suppress, got %q", h.Command, h.Output)
+			}
+		}
+	}
+	return nil
+}
+
+// expand returns the hook with its placeholders replaced.
+func (h Hook) expand(args []string, cwd, requestID string) Hook {
+	r := strings.NewReplacer("{{args}}", strings.Join(args, " "), "{{cwd}}", cwd, "{{request_id}}", requestID)
+	expanded := Hook{Command: r.Replace(h.Command), Output: h.Output}
+	for _, arg := range h.Args {
+		if arg == "{{args}}" {
+			expanded.Args = append(expanded.Args, args...)
+			continue
+		}
+		expanded.Args = append(expanded.Args, r.Replace(arg))
+	}
+	return expanded
+}
+
+// bindHookArgs replaces {{args}} in hooks by args, leaving the other
+// placeholders. Hooks of the commands in a shell script get the args of
+// their own command rather than the shell's.
+func bindHookArgs(hooks []Hook, args []string) []Hook {
+	bound := make([]Hook, len(hooks))
+	for i, h := range hooks {
+		bound[i] = h.expand(args, "{{cwd}}", "{{request_id}}")
+	}
+	return bound
+}
+
+// executeWithHooks runs result's pre hooks, then the command through run,
+// then its post hooks, all with exec and sending their output to conn.
+// A failing pre hook ends the request with its exit code instead of the
+// command's, and no post hooks run. Post hooks run however the command
+// ended, within postCtx rather than the command's time limit, and the
+// command's exit code is held back until they finish; theirs is only
+// audited.
+func (s *Server) executeWithHooks(ctx, postCtx context.Context, exec executor.Executor, req *protocol.Request, result EvaluationResult, entry *AuditEntry, conn net.Conn, run func(net.Conn) error) error {
+	for _, hook := range result.Pre {
+		if code, command := s.runHook(ctx, exec, HookPre, hook, req, entry, conn); code != 0 {
+			if err := ctx.Err(); err != nil {
+				return err // The command's time limit ran out during its hook
+			}
+			s.logger.Printf("pre hook %s of %s exited with %d; not running %s", command, req.Command, code, req.Command)
+			entry.Error = fmt.Sprintf("pre hook %s exited with %d; the command did not run", command, code)
+			return protocol.WriteExitCode(conn, code)
+		}
+	}
+	if len(result.Post) == 0 {
+		return run(conn)
+	}
+
+	held := &hookConn{Conn: conn}
+	err := run(held)
+	for _, hook := range result.Post {
+		s.runHook(postCtx, exec, HookPost, hook, req, entry, conn)
+	}
+	if code, ok := held.exitCode(); ok {
+		if werr := protocol.WriteExitCode(conn, code); err == nil {
+			err = werr
+		}
+	}
+	return err
+}
+
+// runHook runs one hook of req as its own execution, audited in an entry
+// linked to the command's. It returns the hook's exit code, 1 if it could
+// not run, and its expanded command.
+func (s *Server) runHook(ctx context.Context, exec executor.Executor, stage string, hook Hook, req *protocol.Request, parent *AuditEntry, conn net.Conn) (int, string) {
+	start := time.Now()
+	hook = hook.expand(req.Args, req.Cwd, parent.RequestID)
+	hookReq := *req
+	hookReq.Command, hookReq.Args = hook.Command, hook.Args
+	hookReq.RequestID = newID("hook", start)
+	parent.Hooks = append(parent.Hooks, hookReq.RequestID)
+	s.logger.Printf("%s hook of %s: %s %v", stage, req.Command, hook.Command, hook.Args)
+
+	out := &hookConn{Conn: conn, suppress: hook.Output == HookOutputSuppress}
+	if !out.suppress {
+		out.prefix = []byte(fmt.Sprintf("[%s %s] ", stage, hook.Command))
+	}
+	err := exec.Execute(ctx, &hookReq, out)
+	code, exited := out.exitCode()
+
+	entry := AuditEntry{
+		RequestID:   hookReq.RequestID,
+		Command:     hook.Command,
+		Args:        hook.Args,
+		Cwd:         parent.Cwd,
+		Identity:    parent.Identity,
+		GroupNames:  parent.GroupNames,
+		ContainerID: parent.ContainerID,
+		Image:       parent.Image,
+		ImageDigest: parent.ImageDigest,
+		JailID:      parent.JailID,
+		TaskID:      parent.TaskID,
+		RunID:       parent.RunID,
+		Session:     parent.Session,
+		PolicyHash:  parent.PolicyHash,
+		Decision:    protocol.DecisionEvent,
+		Detail:      "hook",
+		Strategy:    parent.Strategy,
+		Hook:        stage,
+		HookOf:      parent.RequestID,
+	}
+	switch {
+	case err != nil:
+		s.logger.Printf("%s hook %s of %s failed: %v", stage, hook.Command, req.Command, err)
+		code, entry.Error = 1, err.Error()
+		protocol.WriteFrame(conn, protocol.Frame{
+			Type:    protocol.StreamStderr,
+			Payload: []byte(fmt.Sprintf("clawrden: %s hook %s failed: %v\n", stage, hook.Command, err)),
+		})
+	case !exited:
+		code, entry.Error = 1, "hook sent no exit code"
+	}
+	entry.ExitCode = code
+	entry.Duration = float64(time.Since(start).Milliseconds())
+	s.record(entry)
+	return code, hook.Command
+}
+
+// hookConn sits between an executor and the shim's connection and holds
+// back the exit frame, for the warden to decide what to send. Unless
+// suppress is set, output passes through, on stderr with each line
+// prefixed when prefix is set. Like DeliveryConn, it takes each Write to be
+// one whole frame.
+type hookConn struct {
+	net.Conn
+	prefix   []byte
+	suppress bool
+
+	mu      sync.Mutex
+	midLine bool // The last output did not end a line
+	exited  bool
+	code    int
+}
+
+func (c *hookConn) Write(b []byte) (int, error) {
+	if len(b) < protocol.FrameHeaderSize {
+		return c.Conn.Write(b)
+	}
+	payload := b[protocol.FrameHeaderSize:]
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch b[0] {
+	case protocol.StreamExit:
+		if len(payload) > 0 {
+			c.exited, c.code = true, protocol.ParseExitCode(protocol.Frame{Payload: payload})
+		}
+		return len(b), nil
+	case protocol.StreamStdout, protocol.StreamStderr:
+		if c.suppress {
+			return len(b), nil
+		}
+		if c.prefix == nil || len(payload) == 0 {
+			return c.Conn.Write(b)
+		}
+		var prefixed []byte
+		for len(payload) > 0 {
+			if !c.midLine {
+				prefixed = append(prefixed, c.prefix...)
+			}
+			line := payload
+			if i := bytes.IndexByte(payload, '\n'); i >= 0 {
+				line = payload[:i+1]
+			}
+			prefixed = append(prefixed, line...)
+			payload = payload[len(line):]
+			c.midLine = line[len(line)-1] != '\n'
+		}
+		if err := protocol.WriteFrame(c.Conn, protocol.Frame{Type: protocol.StreamStderr, Payload: prefixed}); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	return c.Conn.Write(b)
+}
+
+// exitCode returns the exit code held back, if one was written.
+func (c *hookConn) exitCode() (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.code, c.exited
+}
@@ -0,0 +1,179 @@
+package warden
+
+import (
+	"clawrden/internal/events"
+	"clawrden/pkg/protocol"
+	"context"
+	"io"
+	"log"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// hookExecutor runs nothing: it records each command it is asked to run,
+// prints a line and exits with the code exits has for the command line.
+type hookExecutor struct {
+	exits map[string]int
+	ran   []string
+}
+
+func (e *hookExecutor) Execute(_ context.Context, req *protocol.Request, conn net.Conn) error {
+	line := strings.Join(append([]string{req.Command}, req.Args...), " ")
+	e.ran = append(e.ran, line)
+	protocol.WriteFrame(conn, protocol.Frame{Type: protocol.StreamStdout, Payload: []byte("output of " + req.Command + "\n")})
+	return protocol.WriteExitCode(conn, e.exits[line])
+}
+
+// runWithHooks runs an allowed terraform apply through executeWithHooks
+// with result's hooks, returning what the shim read and the audit entries.
+func runWithHooks(t *testing.T, exec *hookExecutor, result EvaluationResult) (stdout, stderr string, exit int, entries []AuditEntry) {
+	t.Helper()
+	srv := newTestServer(t)
+	srv.events = events.New(log.New(io.Discard, "", 0))
+	var mu sync.Mutex
+	srv.events.Subscribe("test", func(e events.Event) {
+		if a, ok := e.(Audited); ok {
+			mu.Lock()
+			entries = append(entries, a.Entry)
+			mu.Unlock()
+		}
+	})
+
+	client, server := net.Pipe()
+	defer client.Close()
+	read := make(chan struct{})
+	go func() {
+		defer close(read)
+		var out, errOut strings.Builder
+		for {
+			f, err := protocol.ReadFrame(client)
+			if err != nil {
+				t.Errorf("read frame: %v", err)
+				return
+			}
+			switch f.Type {
+			case protocol.StreamStdout:
+				out.Write(f.Payload)
+			case protocol.StreamStderr:
+				errOut.Write(f.Payload)
+			case protocol.StreamExit:
+				stdout, stderr, exit = out.String(), errOut.String(), protocol.ParseExitCode(f)
+				return
+			}
+		}
+	}()
+
+	req := &protocol.Request{Command: "terraform", Args: []string{"apply", "-auto-approve"}, Cwd: "/app/infra"}
+	entry := AuditEntry{RequestID: "req-1", Command: "terraform", Decision: protocol.DecisionAllow}
+	err := srv.executeWithHooks(context.Background(), context.Background(), exec, req, result, &entry, server, func(conn net.Conn) error {
+		return exec.Execute(context.Background(), req, conn)
+	})
+	if err != nil {
+		t.Fatalf("executeWithHooks: %v", err)
+	}
+	<-read
+	srv.record(entry)
+	srv.events.Close()
+	return stdout, stderr, exit, entries
+}
+
+func TestHooksRunAroundCommand(t *testing.T) {
+	exec := &hookExecutor{exits: map[string]int{"terraform apply -auto-approve": 2, "upload /app/infra apply -auto-approve": 1}}
+	stdout, stderr, exit, entries := runWithHooks(t, exec, EvaluationResult{
+		Pre:  []Hook{{Command: "terraform", Args: []string{"plan", "-out", "{{request_id}}.tfplan"}}},
+		Post: []Hook{{Command: "upload", Args: []string{"{{cwd}}", "{{args}}"}, Output: HookOutputSuppress}},
+	})
+
+	want := []string{"terraform plan -out req-1.tfplan", "terraform apply -auto-approve", "upload /app/infra apply -auto-approve"}
+	if !reflect.DeepEqual(exec.ran, want) {
+		t.Errorf("ran %q, want %q", exec.ran, want)
+	}
+	// The post hook's failure does not change the command's exit code
+	if exit != 2 {
+		t.Errorf("exit = %d, want the command's 2", exit)
+	}
+	if stdout != "output of terraform\n" || stderr != "[pre terraform] output of terraform\n" {
+		t.Errorf("stdout %q, stderr %q; want the command's output and the pre hook's prefixed", stdout, stderr)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("audit entries = %+v, want two hooks and the command", entries)
+	}
+	pre, post, main := entries[0], entries[1], entries[2]
+	if pre.Hook != HookPre || pre.HookOf != "req-1" || pre.ExitCode != 0 || post.Hook != HookPost || post.HookOf != "req-1" || post.ExitCode != 1 {
+		t.Errorf("hook entries = %+v, %+v", pre, post)
+	}
+	if !reflect.DeepEqual(main.Hooks, []string{pre.RequestID, post.RequestID}) {
+		t.Errorf("command's hooks = %v, want %s and %s", main.Hooks, pre.RequestID, post.RequestID)
+	}
+}
+
+func TestFailingPreHookAbortsCommand(t *testing.T) {
+	exec := &hookExecutor{exits: map[string]int{"check": 3}}
+	_, _, exit, entries := runWithHooks(t, exec, EvaluationResult{
+		Pre:  []Hook{{Command: "check"}, {Command: "never"}},
+		Post: []Hook{{Command: "upload"}},
+	})
+
+	if !reflect.DeepEqual(exec.ran, []string{"check"}) {
+		t.Errorf("ran %q, want only the failing pre hook", exec.ran)
+	}
+	if exit != 3 {
+		t.Errorf("exit = %d, want the pre hook's 3", exit)
+	}
+	if len(entries) != 2 || entries[0].ExitCode != 3 || !strings.Contains(entries[1].Error, "pre hook check exited with 3") {
+		t.Errorf("audit entries = %+v, want the hook's and the aborted command's", entries)
+	}
+}
+
+func TestPolicyHooks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writeTestFile(t, path, `default_action: deny
+shell_commands: [sh]
+rules:
+  - command: sh
+    action: allow
+  - command: terraform
+    args: [apply]
+    action: allow
+    pre:
+      - command: terraform
+        args: [plan, "{{args}}"]
+    post:
+      - command: upload
+        args: ["{{request_id}}"]
+`)
+	policy, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+
+	result := policy.Evaluate(&protocol.Request{Command: "terraform", Args: []string{"apply"}})
+	if len(result.Pre) != 1 || len(result.Post) != 1 {
+		t.Errorf("result hooks = %+v, %+v; want the rule's", result.Pre, result.Post)
+	}
+
+	// A shell script gets the hooks of its commands, with their args
+	result = policy.Evaluate(&protocol.Request{Command: "sh", Args: []string{"-c", "terraform apply -lock=false"}})
+	wantPre := []Hook{{Command: "terraform", Args: []string{"plan", "apply", "-lock=false"}}}
+	if !reflect.DeepEqual(result.Pre, wantPre) {
+		t.Errorf("script pre hooks = %+v, want %+v", result.Pre, wantPre)
+	}
+	if got := result.Post[0].expand(nil, "/app", "req-1"); !reflect.DeepEqual(got.Args, []string{"req-1"}) {
+		t.Errorf("script post hook args = %q, want the request ID", got.Args)
+	}
+
+	for _, bad := range []string{
+		"    pre:\n      - args: [x]\n",
+		"    post:\n      - command: upload\n        output: quiet\n",
+	} {
+		writeTestFile(t, path, "default_action: deny\nrules:\n  - command: terraform\n    action: allow\n"+bad)
+		if _, err := LoadPolicy(path); err == nil {
+			t.Errorf("LoadPolicy accepted %q", bad)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package warden
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+	"time"
+)
+
+// idEncoding renders random ID suffixes in lowercase base32: URL-safe, and
+// free of characters chat markup treats specially (like "_").
+var idEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// idRandomBytes is the size of an ID's random suffix (80 bits).
+const idRandomBytes = 10
+
+// newID returns an ID made of prefix, a readable timestamp, and a random
+// suffix, e.g. "req-20250101-120000-3lx7q2mbk4wdzs5e". IDs outlive the
+// process that issued them (in audit logs and bridge state), so uniqueness
+// comes from the random suffix rather than a counter that restarts at 1.
+func newID(prefix string, now time.Time) string {
+	var b [idRandomBytes]byte
+	rand.Read(b[:]) // Never fails; a broken system RNG aborts the program
+	return prefix + "-" + now.Format("20060102-150405") + "-" + strings.ToLower(idEncoding.EncodeToString(b[:]))
+}
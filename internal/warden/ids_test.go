@@ -0,0 +1,36 @@
+package warden
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestNewIDFormat(t *testing.T) {
+	now := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+	id := newID("req", now)
+	if !regexp.MustCompile(`^req-20250102-150405-[a-z2-7]{16}$`).MatchString(id) {
+		t.Errorf("newID = %q", id)
+	}
+}
+
+// TestRequestIDsUniqueAcrossRestarts generates a million request IDs from
+// fresh queues, as after warden restarts. Runs share timestamps, which is
+// where the old per-process counter collided.
+func TestRequestIDsUniqueAcrossRestarts(t *testing.T) {
+	if testing.Short() {
+		t.Skip("generates a million IDs")
+	}
+	const restarts, perRun = 10, 100_000
+	seen := make(map[string]struct{}, restarts*perRun)
+	for r := 0; r < restarts; r++ {
+		q := NewHITLQueue() // Everything a restart resets
+		for i := 0; i < perRun; i++ {
+			id := q.nextID()
+			if _, dup := seen[id]; dup {
+				t.Fatalf("duplicate ID %s after %d restarts", id, r)
+			}
+			seen[id] = struct{}{}
+		}
+	}
+}
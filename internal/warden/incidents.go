@@ -0,0 +1,385 @@
+package warden
+
+import (
+	"clawrden/internal/events"
+	"clawrden/pkg/protocol"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// incidentCommand is the pseudo-command recorded in the audit log for incidents.
+const incidentCommand = "clawrden-incident"
+
+// defaultIncidentWindow is how far back denials are counted when the policy
+// sets a threshold but no window.
+const defaultIncidentWindow = 10 * time.Minute
+
+// maxIncidents bounds how many incidents are kept; the oldest cleared ones
+// are dropped first.
+const maxIncidents = 200
+
+// maxIncidentCommands bounds the denied commands recorded on one incident.
+const maxIncidentCommands = 20
+
+// Incident triggers
+const (
+	IncidentTriggerDenials       = "denials"
+	IncidentTriggerPathViolation = "path_violation"
+	IncidentTriggerFilesChanged  = "files_changed"
+)
+
+var (
+	ErrIncidentNotFound = errors.New("incident not found")
+	ErrIncidentCleared  = errors.New("incident already cleared")
+)
+
+// IncidentPolicy configures when denials become an incident.
+type IncidentPolicy struct {
+	DenyThreshold int           `yaml:"deny_threshold,omitempty"` // Denials by deny rules within Window that open an incident (0 disables)
+	Window        time.Duration `yaml:"window,omitempty"`         // Default: 10m
+	PathViolation bool          `yaml:"path_violation,omitempty"` // Any path violation opens an incident
+	FilesChanged  bool          `yaml:"files_changed,omitempty"`  // A ghost command changing more than its max_files_changed opens an incident
+	Lockdown      bool          `yaml:"lockdown,omitempty"`       // Refuse all further requests from the subject until cleared
+}
+
+// Incident is a burst of denials (or a path violation) from one container,
+// or from one uid for requests outside containers.
+type Incident struct {
+	ID          string     `json:"id"`
+	Subject     string     `json:"subject"`
+	ContainerID string     `json:"container_id,omitempty"`
+	UID         int        `json:"uid"`
+	Trigger     string     `json:"trigger"`
+	Reason      string     `json:"reason"`
+	Commands    []string   `json:"commands"` // Denied commands, oldest first
+	Lockdown    bool       `json:"lockdown"`
+	OpenedAt    time.Time  `json:"opened_at"`
+	ClearedAt   *time.Time `json:"cleared_at,omitempty"`
+}
+
+// Open reports whether the incident has not been cleared.
+func (inc *Incident) Open() bool {
+	return inc.ClearedAt == nil
+}
+
+type recentDenial struct {
+	at      time.Time
+	command string
+}
+
+// IncidentTracker counts denials per subject and opens incidents when the
+// policy's thresholds are crossed. It holds no policy itself: callers pass
+// the current one, so reloads apply immediately.
+type IncidentTracker struct {
+	mu        sync.Mutex
+	now       func() time.Time
+	recent    map[string][]recentDenial // Subject -> denials within the window
+	open      map[string]*Incident      // Subject -> its open incident
+	incidents []*Incident               // Oldest first
+}
+
+// NewIncidentTracker creates an empty tracker.
+func NewIncidentTracker() *IncidentTracker {
+	return &IncidentTracker{
+		now:    time.Now,
+		recent: make(map[string][]recentDenial),
+		open:   make(map[string]*Incident),
+	}
+}
+
+// incidentSubject identifies who an incident is about: the container when
+// known, the uid otherwise.
+func incidentSubject(req *protocol.Request) string {
+	if req.ContainerID != "" {
+		return "container:" + req.ContainerID
+	}
+	return "uid:" + strconv.Itoa(req.Identity.UID)
+}
+
+// ObserveDenial records a request denied by a deny rule. It returns the
+// incident it opened, or nil.
+func (t *IncidentTracker) ObserveDenial(p IncidentPolicy, req *protocol.Request) *Incident {
+	if p.DenyThreshold <= 0 {
+		return nil
+	}
+	window := p.Window
+	if window <= 0 {
+		window = defaultIncidentWindow
+	}
+	command := formatIncidentCommand(req)
+	subject := incidentSubject(req)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	if inc := t.open[subject]; inc != nil {
+		// Already an incident: keep the evidence but don't open another
+		inc.addCommand(command)
+		return nil
+	}
+
+	recent := t.recent[subject]
+	cutoff := now.Add(-window)
+	kept := recent[:0]
+	for _, d := range recent {
+		if d.at.After(cutoff) {
+			kept = append(kept, d)
+		}
+	}
+	kept = append(kept, recentDenial{at: now, command: command})
+	if len(kept) < p.DenyThreshold {
+		t.recent[subject] = kept
+		return nil
+	}
+	delete(t.recent, subject)
+
+	inc := t.openLocked(req, subject, IncidentTriggerDenials, p.Lockdown,
+		fmt.Sprintf("%d denials within %s", len(kept), window))
+	for _, d := range kept {
+		inc.addCommand(d.command)
+	}
+	return inc.copy()
+}
+
+// ObservePathViolation records a request refused for its working directory.
+// It returns the incident it opened, or nil.
+func (t *IncidentTracker) ObservePathViolation(p IncidentPolicy, req *protocol.Request, violation error) *Incident {
+	if !p.PathViolation {
+		return nil
+	}
+	return t.observe(req, IncidentTriggerPathViolation, p.Lockdown, violation.Error())
+}
+
+// ObserveFilesChanged records a ghost command that changed more files than
+// its max_files_changed allows. It returns the incident it opened, or nil.
+func (t *IncidentTracker) ObserveFilesChanged(p IncidentPolicy, req *protocol.Request, reason string) *Incident {
+	if !p.FilesChanged {
+		return nil
+	}
+	return t.observe(req, IncidentTriggerFilesChanged, p.Lockdown, reason)
+}
+
+// observe opens an incident for a single offending request, or adds the
+// request to the subject's open incident and returns nil.
+func (t *IncidentTracker) observe(req *protocol.Request, trigger string, lockdown bool, reason string) *Incident {
+	subject := incidentSubject(req)
+	command := formatIncidentCommand(req)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if inc := t.open[subject]; inc != nil {
+		inc.addCommand(command)
+		return nil
+	}
+	inc := t.openLocked(req, subject, trigger, lockdown, reason)
+	inc.addCommand(command)
+	return inc.copy()
+}
+
+// openLocked records a new incident. The caller holds t.mu.
+func (t *IncidentTracker) openLocked(req *protocol.Request, subject, trigger string, lockdown bool, reason string) *Incident {
+	now := t.now()
+	inc := &Incident{
+		ID:          newID("inc", now),
+		Subject:     subject,
+		ContainerID: req.ContainerID,
+		UID:         req.Identity.UID,
+		Trigger:     trigger,
+		Reason:      reason,
+		Lockdown:    lockdown,
+		OpenedAt:    now,
+	}
+	t.open[subject] = inc
+	t.incidents = append(t.incidents, inc)
+	t.pruneLocked()
+	return inc
+}
+
+// pruneLocked drops the oldest cleared incidents beyond maxIncidents. Open
+// incidents are never dropped. The caller holds t.mu.
+func (t *IncidentTracker) pruneLocked() {
+	excess := len(t.incidents) - maxIncidents
+	if excess <= 0 {
+		return
+	}
+	kept := t.incidents[:0]
+	for _, inc := range t.incidents {
+		if excess > 0 && !inc.Open() {
+			excess--
+			continue
+		}
+		kept = append(kept, inc)
+	}
+	t.incidents = kept
+}
+
+// Lockdown returns the open lockdown incident for the request's subject, or
+// nil if its requests may proceed.
+func (t *IncidentTracker) Lockdown(req *protocol.Request) *Incident {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if inc := t.open[incidentSubject(req)]; inc != nil && inc.Lockdown {
+		return inc.copy()
+	}
+	return nil
+}
+
+// List returns all incidents, newest first.
+func (t *IncidentTracker) List() []Incident {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	list := make([]Incident, 0, len(t.incidents))
+	for i := len(t.incidents) - 1; i >= 0; i-- {
+		list = append(list, *t.incidents[i].copy())
+	}
+	return list
+}
+
+// OpenCount returns the number of incidents that have not been cleared.
+func (t *IncidentTracker) OpenCount() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.open)
+}
+
+// Clear closes an incident, lifting its lockdown and resetting the subject's
+// denial count.
+func (t *IncidentTracker) Clear(id string) (*Incident, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, inc := range t.incidents {
+		if inc.ID != id {
+			continue
+		}
+		if !inc.Open() {
+			return nil, ErrIncidentCleared
+		}
+		now := t.now()
+		inc.ClearedAt = &now
+		delete(t.open, inc.Subject)
+		delete(t.recent, inc.Subject)
+		return inc.copy(), nil
+	}
+	return nil, ErrIncidentNotFound
+}
+
+func (inc *Incident) addCommand(command string) {
+	if len(inc.Commands) < maxIncidentCommands {
+		inc.Commands = append(inc.Commands, command)
+	}
+}
+
+// copy returns a snapshot safe to use outside the tracker's lock.
+func (inc *Incident) copy() *Incident {
+	c := *inc
+	c.Commands = append([]string(nil), inc.Commands...)
+	if inc.ClearedAt != nil {
+		at := *inc.ClearedAt
+		c.ClearedAt = &at
+	}
+	return &c
+}
+
+// formatIncidentCommand renders a request's command line for an incident.
+func formatIncidentCommand(req *protocol.Request) string {
+	cmd := req.Command
+	for _, arg := range req.Args {
+		cmd += " " + arg
+	}
+	if len(cmd) > 200 {
+		cmd = cmd[:200] + "..."
+	}
+	return cmd
+}
+
+// openIncident announces an incident returned by the tracker: a prominent
+// log line, an audit entry, and an IncidentOpened event for notifiers. A nil
+// incident is ignored.
+func (s *Server) openIncident(inc *Incident) {
+	if inc == nil {
+		return
+	}
+	action := "reported"
+	if inc.Lockdown {
+		action = "locked down"
+	}
+	s.logger.Printf("SECURITY: INCIDENT %s: %s %s: %s (commands: %v)", inc.ID, inc.Subject, action, inc.Reason, inc.Commands)
+	s.record(AuditEntry{
+		Command:     incidentCommand,
+		Args:        append([]string{"open", inc.ID, inc.Trigger}, inc.Commands...),
+		Identity:    protocol.Identity{UID: inc.UID},
+		ContainerID: inc.ContainerID,
+		RequestID:   inc.ID,
+		Decision:    protocol.DecisionEvent,
+		Detail:      "incident",
+		Error:       inc.Reason,
+	})
+	s.events.Publish(events.IncidentOpened{
+		ID:       inc.ID,
+		Subject:  inc.Subject,
+		Trigger:  inc.Trigger,
+		Reason:   inc.Reason,
+		Lockdown: inc.Lockdown,
+	})
+}
+
+// ClearIncident clears an incident on an operator's behalf, lifting any
+// lockdown it imposed.
+func (s *Server) ClearIncident(id string) (*Incident, error) {
+	inc, err := s.incidents.Clear(id)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Printf("incident %s cleared (%s)", inc.ID, inc.Subject)
+	s.record(AuditEntry{
+		Command:     incidentCommand,
+		Args:        []string{"clear", inc.ID},
+		Identity:    protocol.Identity{UID: inc.UID},
+		ContainerID: inc.ContainerID,
+		RequestID:   inc.ID,
+		Decision:    protocol.DecisionEvent,
+		Detail:      "incident cleared",
+	})
+	s.events.Publish(events.IncidentCleared{ID: inc.ID, Subject: inc.Subject})
+	return inc, nil
+}
+
+// incidentWebhook returns an event handler that POSTs opened incidents to url
+// as JSON ({"text": ..., "incident": {...}}), which Slack-style webhooks accept.
+// Docker daemon outages and recoveries are posted as {"text": ..., "docker": {...}},
+// and policy reloads the canary holds as {"text": ..., "policy": {...}}.
+func incidentWebhook(url string, logger *log.Logger) func(events.Event) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	return func(e events.Event) {
+		var body map[string]interface{}
+		switch e := e.(type) {
+		case events.IncidentOpened:
+			text := fmt.Sprintf("Clawrden INCIDENT %s: %s: %s", e.ID, e.Subject, e.Reason)
+			if e.Lockdown {
+				text += " (locked down until cleared)"
+			}
+			body = map[string]interface{}{"text": text, "incident": e}
+		case events.DockerHealthChanged:
+			text := "Clawrden: Docker daemon unreachable, containerized requests are denied: " + e.Error
+			if e.Healthy {
+				text = fmt.Sprintf("Clawrden: Docker daemon reachable again after %s", e.Outage.Round(time.Second))
+			}
+			body = map[string]interface{}{"text": text, "docker": e}
+		case events.PolicyReloadHeld:
+			text := fmt.Sprintf("Clawrden: policy reload held: %s; confirm with POST /api/policy/confirm-reload", e.Summary)
+			body = map[string]interface{}{"text": text, "policy": e}
+		default:
+			return
+		}
+		if err := postWebhook(client, url, body); err != nil {
+			logger.Printf("warning: incident webhook: %v", err)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package warden
+
+import (
+	"clawrden/pkg/protocol"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestIncidentTracker() (*IncidentTracker, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	tracker := NewIncidentTracker()
+	tracker.now = clock.Now
+	return tracker, clock
+}
+
+func deniedRequest(containerID string, uid int, command string) *protocol.Request {
+	return &protocol.Request{
+		Command:     command,
+		Args:        []string{"-rf", "/"},
+		ContainerID: containerID,
+		Identity:    protocol.Identity{UID: uid},
+	}
+}
+
+func TestIncidentDenialThreshold(t *testing.T) {
+	policy := IncidentPolicy{DenyThreshold: 3, Window: 5 * time.Minute}
+
+	tests := []struct {
+		name     string
+		gaps     []time.Duration // Clock advance before each denial
+		wantOpen int             // Denial (1-based) that opens the incident; 0 = none
+	}{
+		{"burst", []time.Duration{0, time.Second, time.Second}, 3},
+		{"spread beyond window", []time.Duration{0, 3 * time.Minute, 3 * time.Minute}, 0},
+		{"old denial expires", []time.Duration{0, 3 * time.Minute, 3 * time.Minute, time.Minute}, 4},
+		{"below threshold", []time.Duration{0, time.Second}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker, clock := newTestIncidentTracker()
+			opened := 0
+			for i, gap := range tt.gaps {
+				clock.Advance(gap)
+				if inc := tracker.ObserveDenial(policy, deniedRequest("abc123", 1000, "rm")); inc != nil {
+					if opened != 0 {
+						t.Fatalf("second incident opened at denial %d", i+1)
+					}
+					opened = i + 1
+					if inc.Trigger != IncidentTriggerDenials || inc.Subject != "container:abc123" {
+						t.Errorf("incident = %+v", inc)
+					}
+					if len(inc.Commands) != policy.DenyThreshold || inc.Commands[0] != "rm -rf /" {
+						t.Errorf("commands = %q", inc.Commands)
+					}
+				}
+			}
+			if opened != tt.wantOpen {
+				t.Errorf("incident opened at denial %d, want %d", opened, tt.wantOpen)
+			}
+		})
+	}
+}
+
+func TestIncidentSubjectsCountedSeparately(t *testing.T) {
+	tracker, _ := newTestIncidentTracker()
+	policy := IncidentPolicy{DenyThreshold: 2}
+
+	requests := []*protocol.Request{
+		deniedRequest("aaa", 1000, "rm"),
+		deniedRequest("bbb", 1000, "rm"),
+		deniedRequest("", 1000, "rm"),
+		deniedRequest("", 1001, "rm"),
+	}
+	for _, req := range requests {
+		if inc := tracker.ObserveDenial(policy, req); inc != nil {
+			t.Fatalf("incident opened for %s after one denial", inc.Subject)
+		}
+	}
+	inc := tracker.ObserveDenial(policy, deniedRequest("", 1001, "rm"))
+	if inc == nil || inc.Subject != "uid:1001" {
+		t.Fatalf("incident = %+v, want one for uid:1001", inc)
+	}
+}
+
+func TestIncidentOpenIncidentCollectsFurtherDenials(t *testing.T) {
+	tracker, _ := newTestIncidentTracker()
+	policy := IncidentPolicy{DenyThreshold: 1}
+
+	first := tracker.ObserveDenial(policy, deniedRequest("abc", 0, "rm"))
+	if first == nil {
+		t.Fatal("no incident opened")
+	}
+	if inc := tracker.ObserveDenial(policy, deniedRequest("abc", 0, "curl")); inc != nil {
+		t.Fatalf("second incident %s opened while %s is open", inc.ID, first.ID)
+	}
+	list := tracker.List()
+	if len(list) != 1 || len(list[0].Commands) != 2 || list[0].Commands[1] != "curl -rf /" {
+		t.Errorf("incidents = %+v", list)
+	}
+}
+
+func TestIncidentPathViolation(t *testing.T) {
+	tracker, _ := newTestIncidentTracker()
+	req := deniedRequest("abc", 0, "ls")
+	violation := errors.New(`path "/etc" not allowed by policy`)
+
+	if inc := tracker.ObservePathViolation(IncidentPolicy{}, req, violation); inc != nil {
+		t.Fatalf("incident opened with path_violation disabled: %+v", inc)
+	}
+	inc := tracker.ObservePathViolation(IncidentPolicy{PathViolation: true}, req, violation)
+	if inc == nil || inc.Trigger != IncidentTriggerPathViolation || inc.Reason != violation.Error() {
+		t.Fatalf("incident = %+v", inc)
+	}
+}
+
+func TestIncidentDisabledByDefault(t *testing.T) {
+	tracker, _ := newTestIncidentTracker()
+	for i := 0; i < 100; i++ {
+		if inc := tracker.ObserveDenial(IncidentPolicy{}, deniedRequest("abc", 0, "rm")); inc != nil {
+			t.Fatalf("incident opened without a threshold: %+v", inc)
+		}
+	}
+}
+
+func TestIncidentLockdownUntilCleared(t *testing.T) {
+	tracker, clock := newTestIncidentTracker()
+	policy := IncidentPolicy{DenyThreshold: 2, Lockdown: true}
+	req := deniedRequest("abc", 0, "rm")
+	other := deniedRequest("def", 0, "ls")
+
+	tracker.ObserveDenial(policy, req)
+	if tracker.Lockdown(req) != nil {
+		t.Fatal("locked down below the threshold")
+	}
+	inc := tracker.ObserveDenial(policy, req)
+	if inc == nil || !inc.Lockdown {
+		t.Fatalf("incident = %+v, want lockdown", inc)
+	}
+	if got := tracker.Lockdown(req); got == nil || got.ID != inc.ID {
+		t.Fatalf("Lockdown = %+v, want %s", got, inc.ID)
+	}
+	if tracker.Lockdown(other) != nil {
+		t.Error("lockdown applied to another container")
+	}
+	// Time alone does not lift a lockdown
+	clock.Advance(24 * time.Hour)
+	if tracker.Lockdown(req) == nil {
+		t.Error("lockdown lifted without an operator")
+	}
+
+	cleared, err := tracker.Clear(inc.ID)
+	if err != nil {
+		t.Fatalf("Clear: %v", err)
+	}
+	if cleared.ClearedAt == nil || !cleared.ClearedAt.Equal(clock.Now()) {
+		t.Errorf("ClearedAt = %v", cleared.ClearedAt)
+	}
+	if tracker.Lockdown(req) != nil {
+		t.Error("still locked down after clear")
+	}
+	if _, err := tracker.Clear(inc.ID); !errors.Is(err, ErrIncidentCleared) {
+		t.Errorf("second Clear error = %v, want ErrIncidentCleared", err)
+	}
+	if _, err := tracker.Clear("inc-missing"); !errors.Is(err, ErrIncidentNotFound) {
+		t.Errorf("Clear(missing) error = %v, want ErrIncidentNotFound", err)
+	}
+
+	// Clearing resets the count: one more denial is not a new incident
+	if inc := tracker.ObserveDenial(policy, req); inc != nil {
+		t.Errorf("incident reopened after one denial: %+v", inc)
+	}
+	if tracker.OpenCount() != 0 {
+		t.Errorf("OpenCount = %d, want 0", tracker.OpenCount())
+	}
+}
+
+func TestIncidentPruneKeepsOpenIncidents(t *testing.T) {
+	tracker, _ := newTestIncidentTracker()
+	policy := IncidentPolicy{DenyThreshold: 1}
+
+	locked := tracker.ObserveDenial(policy, deniedRequest("keep", 0, "rm"))
+	for i := 0; i < maxIncidents+10; i++ {
+		inc := tracker.ObserveDenial(policy, deniedRequest("c"+strconv.Itoa(i), 0, "rm"))
+		tracker.Clear(inc.ID)
+	}
+	list := tracker.List()
+	if len(list) != maxIncidents {
+		t.Fatalf("kept %d incidents, want %d", len(list), maxIncidents)
+	}
+	if list[len(list)-1].ID != locked.ID {
+		t.Errorf("oldest kept = %s, want open incident %s", list[len(list)-1].ID, locked.ID)
+	}
+}
+
+func TestPolicyEvaluateRuleMatched(t *testing.T) {
+	pe := &PolicyEngine{config: PolicyConfig{
+		DefaultAction: ActionDeny,
+		Rules:         []Rule{{Command: "rm", Action: ActionDeny}, {Command: "ls", Action: ActionAllow}},
+		ShellCommands: []string{"sh"},
+	}}
+	tests := []struct {
+		command string
+		args    []string
+		want    bool
+	}{
+		{"rm", nil, true},
+		{"ls", nil, true},
+		{"unknown", nil, false},
+		{"sh", []string{"-c", "ls; rm -rf /"}, true},
+		{"sh", []string{"-c", "ls; unknown"}, false},
+	}
+	for _, tt := range tests {
+		got := pe.Evaluate(&protocol.Request{Command: tt.command, Args: tt.args})
+		if got.RuleMatched != tt.want {
+			t.Errorf("%s %v: RuleMatched = %v, want %v (action %s)", tt.command, tt.args, got.RuleMatched, tt.want, got.Action)
+		}
+	}
+}
+
+func TestIncidentAPI(t *testing.T) {
+	api, _ := newTestAPIServer(t, Config{})
+	api.warden.incidents = NewIncidentTracker()
+	inc := api.warden.incidents.ObserveDenial(IncidentPolicy{DenyThreshold: 1, Lockdown: true}, deniedRequest("abc", 0, "rm"))
+
+	rec := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/incidents", nil))
+	var list []Incident
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil || len(list) != 1 || list[0].ID != inc.ID {
+		t.Fatalf("GET /api/incidents = %d %+v (%v)", rec.Code, list, err)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{http.MethodGet, "/api/incidents/" + inc.ID + "/clear", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/incidents/" + inc.ID, http.StatusBadRequest},
+		{http.MethodPost, "/api/incidents/inc-missing/clear", http.StatusNotFound},
+		{http.MethodPost, "/api/incidents/" + inc.ID + "/clear", http.StatusOK},
+		{http.MethodPost, "/api/incidents/" + inc.ID + "/clear", http.StatusConflict},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s = %d, want %d: %s", tt.method, tt.path, rec.Code, tt.want, strings.TrimSpace(rec.Body.String()))
+		}
+	}
+	if api.warden.incidents.Lockdown(deniedRequest("abc", 0, "ls")) != nil {
+		t.Error("lockdown not lifted by the API")
+	}
+}
@@ -0,0 +1,132 @@
+package warden
+
+import (
+	"clawrden/pkg/protocol"
+	"fmt"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ParseJailRules decodes and validates rules in the policy's rule format.
+// Rules stored with a jail are JSON, which YAML decoding accepts as well.
+func ParseJailRules(data []byte) ([]Rule, error) {
+	var rules []Rule
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse rules: %w", err)
+	}
+	if err := ValidateRules(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// resolveJail settles which jail a request came from. The jail_id the shim
+// reports is only a claim: for a container with label jails the claim must
+// name one of them, otherwise the first of them is used, and owned reports
+// true. For other containers a claim naming a jail that does not exist is
+// dropped, and one naming a jail that does is kept but not confirmed, so
+// its rules may only tighten the decision (see evaluate).
+func (s *Server) resolveJail(policy *policyState, req *protocol.Request) (owned bool) {
+	if s.autoJailer != nil && req.ContainerID != "" {
+		if owned := s.autoJailer.JailsOwnedBy(req.ContainerID); len(owned) > 0 {
+			if slices.Contains(owned, req.JailID) {
+				return true
+			}
+			slices.Sort(owned)
+			if req.JailID != "" {
+				s.logger.Printf("SECURITY: %s claims jail %s, but container %s runs in %v; using %s",
+					req.Command, req.JailID, truncateID(req.ContainerID), owned, owned[0])
+			}
+			req.JailID = owned[0]
+			return true
+		}
+	}
+	if req.JailID != "" && !s.jailExists(policy, req.JailID) {
+		s.logger.Printf("warning: %s claims unknown jail %q; jail rules skipped", req.Command, req.JailID)
+		req.JailID = ""
+	}
+	return false
+}
+
+// evaluate decides req, the rules of its jail first, and returns the jail
+// rules the decision used. The rules of a jail the container is not known
+// to own come from nothing but the shim's claim, so they apply only where
+// they are stricter than the global rules; a claim never loosens policy.
+func (s *Server) evaluate(policy *policyState, req *protocol.Request, owned bool) (EvaluationResult, []Rule) {
+	rules := s.jailRules(policy, req.JailID)
+	result := policy.engine.EvaluateInJail(req, rules)
+	if owned || rules == nil {
+		return result, rules
+	}
+	global := policy.engine.EvaluateInJail(req, nil)
+	if actionRank(result.Action) > actionRank(global.Action) {
+		return result, rules
+	}
+	if actionRank(result.Action) < actionRank(global.Action) {
+		s.logger.Printf("SECURITY: %s claims jail %s, which container %s does not own; its rules may not loosen %s to %s",
+			req.Command, req.JailID, truncateID(req.ContainerID), global.Action, result.Action)
+	}
+	return global, nil
+}
+
+// hardenedJail returns a hardened jail req may come from: the jail it
+// claims, or any its container owns through labels, so leaving the claim
+// out does not get a client out of its hardened jail.
+func (s *Server) hardenedJail(policy *policyState, req *protocol.Request) (string, bool) {
+	jails := []string{req.JailID}
+	if s.autoJailer != nil && req.ContainerID != "" {
+		jails = append(jails, s.autoJailer.JailsOwnedBy(req.ContainerID)...)
+	}
+	for _, id := range jails {
+		if id == "" {
+			continue
+		}
+		if jail, ok := policy.jails[id]; ok && jail.Hardened {
+			return id, true
+		}
+		if s.jailhouse == nil {
+			continue
+		}
+		if state, err := s.jailhouse.GetJail(id); err == nil && state.Hardened {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// jailExists reports whether a jail is defined in the policy or the jailhouse.
+func (s *Server) jailExists(policy *policyState, jailID string) bool {
+	if _, ok := policy.jails[jailID]; ok {
+		return true
+	}
+	if s.jailhouse == nil {
+		return false
+	}
+	_, err := s.jailhouse.GetJail(jailID)
+	return err == nil
+}
+
+// jailRules returns the rules attached to a jail: from its policy definition,
+// or else the rules persisted with the jail when it was created.
+func (s *Server) jailRules(policy *policyState, jailID string) []Rule {
+	if jailID == "" {
+		return nil
+	}
+	if jail, ok := policy.jails[jailID]; ok {
+		return jail.Rules
+	}
+	if s.jailhouse == nil {
+		return nil
+	}
+	state, err := s.jailhouse.GetJail(jailID)
+	if err != nil || len(state.Rules) == 0 {
+		return nil
+	}
+	rules, err := ParseJailRules(state.Rules)
+	if err != nil {
+		s.logger.Printf("warning: jail %s: ignoring stored rules: %v", jailID, err)
+		return nil
+	}
+	return rules
+}
@@ -0,0 +1,474 @@
+package warden
+
+import (
+	"clawrden/internal/events"
+	"clawrden/internal/jailhouse"
+	"clawrden/pkg/protocol"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvaluateJailRulesTakePrecedence(t *testing.T) {
+	pe := &PolicyEngine{config: PolicyConfig{
+		DefaultAction: ActionDeny,
+		Rules: []Rule{
+			{Command: "npm", Action: ActionAllow},
+			{Command: "git", Action: ActionAsk},
+		},
+		ShellCommands: []string{"sh"},
+		Jails: map[string]JailConfig{
+			"ci": {Commands: []string{"npm", "git"}, Rules: []Rule{
+				{Command: "npm", Args: []string{"publish"}, Action: ActionDeny},
+				{Command: "git", Action: ActionAllow, Timeout: time.Minute},
+			}},
+		},
+	}}
+
+	tests := []struct {
+		name    string
+		jail    string
+		command string
+		args    []string
+		want    Action
+	}{
+		{"global rule outside the jail", "", "git", []string{"push"}, ActionAsk},
+		{"jail rule overrides global rule", "ci", "git", []string{"push"}, ActionAllow},
+		{"jail rule narrows global rule", "ci", "npm", []string{"publish"}, ActionDeny},
+		{"falls through to global rules", "ci", "npm", []string{"install"}, ActionAllow},
+		{"unknown jail uses global rules", "other", "git", nil, ActionAsk},
+		{"shell script in the jail", "ci", "sh", []string{"-c", "git status && npm install"}, ActionAllow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pe.Evaluate(&protocol.Request{Command: tt.command, Args: tt.args, JailID: tt.jail})
+			if got.Action != tt.want {
+				t.Errorf("Evaluate = %s, want %s", got.Action, tt.want)
+			}
+		})
+	}
+
+	// Explicit jail rules are evaluated the same way
+	rules := []Rule{{Command: "npm", Action: ActionAsk}}
+	if got := pe.EvaluateInJail(&protocol.Request{Command: "npm"}, rules); got.Action != ActionAsk {
+		t.Errorf("EvaluateInJail = %s, want ask", got.Action)
+	}
+}
+
+func TestLoadPolicyValidatesJailRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writeTestFile(t, path, `default_action: deny
+jails:
+  ci:
+    commands: [curl]
+    rules:
+      - command: curl
+        action: allow
+        url_violation_action: maybe
+`)
+	_, err := LoadPolicy(path)
+	if err == nil || !strings.Contains(err.Error(), "jail ci") {
+		t.Errorf("LoadPolicy error = %v, want an error naming jail ci", err)
+	}
+}
+
+func TestParseJailRules(t *testing.T) {
+	rules, err := ParseJailRules([]byte(`[{"command":"npm","args":["test"],"action":"allow","timeout":"2m"}]`))
+	if err != nil {
+		t.Fatalf("ParseJailRules: %v", err)
+	}
+	if len(rules) != 1 || rules[0].Command != "npm" || rules[0].Action != ActionAllow || rules[0].Timeout != 2*time.Minute {
+		t.Errorf("rules = %+v", rules)
+	}
+
+	if _, err := ParseJailRules([]byte(`{"command":"npm"}`)); err == nil {
+		t.Error("ParseJailRules accepted an object")
+	}
+}
+
+func TestResolveJail(t *testing.T) {
+	aj, mgr, _ := newTestAutoJailer(t, time.Minute)
+	srv := newTestServer(t)
+	srv.jailhouse = mgr
+	srv.autoJailer = aj
+	srv.setPolicy(&PolicyEngine{config: PolicyConfig{Jails: map[string]JailConfig{"policy-jail": {Commands: []string{"ls"}}}}})
+
+	aj.Handle(ContainerEvent{Action: "start", ContainerID: "labelled", Labels: agentLabels("agent-b", "npm")})
+	aj.Handle(ContainerEvent{Action: "start", ContainerID: "labelled", Labels: agentLabels("agent-a", "git")})
+	if err := mgr.CreateJail("manual", []string{"make"}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		container string
+		claimed   string
+		want      string
+		owned     bool
+	}{
+		{"claim of a label jail kept", "labelled", "agent-b", "agent-b", true},
+		{"claim of another jail replaced", "labelled", "manual", "agent-a", true},
+		{"label jail filled in", "labelled", "", "agent-a", true},
+		{"jailhouse jail kept unconfirmed", "other", "manual", "manual", false},
+		{"policy jail kept unconfirmed", "", "policy-jail", "policy-jail", false},
+		{"unknown jail dropped", "other", "nope", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &protocol.Request{Command: "npm", ContainerID: tt.container, JailID: tt.claimed}
+			owned := srv.resolveJail(srv.currentPolicy(), req)
+			if req.JailID != tt.want || owned != tt.owned {
+				t.Errorf("JailID = %q, owned = %v; want %q, %v", req.JailID, owned, tt.want, tt.owned)
+			}
+		})
+	}
+}
+
+func TestUnownedJailClaimOnlyTightens(t *testing.T) {
+	aj, mgr, _ := newTestAutoJailer(t, time.Minute)
+	srv := newTestServer(t)
+	srv.jailhouse = mgr
+	srv.autoJailer = aj
+	srv.setPolicy(&PolicyEngine{config: PolicyConfig{
+		DefaultAction: ActionDeny,
+		Rules: []Rule{
+			{Command: "git", Action: ActionAsk},
+			{Command: "npm", Action: ActionAllow},
+		},
+		Jails: map[string]JailConfig{
+			"trusted": {Commands: []string{"git", "npm"}, Rules: []Rule{
+				{Command: "git", Action: ActionAllow},
+				{Command: "npm", Args: []string{"publish"}, Action: ActionDeny},
+			}},
+		},
+	}})
+	aj.Handle(ContainerEvent{Action: "start", ContainerID: "labelled", Labels: agentLabels("trusted", "git")})
+
+	tests := []struct {
+		name      string
+		container string
+		command   string
+		args      []string
+		want      Action
+	}{
+		{"owner gets the looser jail rule", "labelled", "git", []string{"push"}, ActionAllow},
+		{"unlabeled claim cannot loosen", "unlabeled", "git", []string{"push"}, ActionAsk},
+		{"unlabeled claim can tighten", "unlabeled", "npm", []string{"publish"}, ActionDeny},
+		{"unlabeled claim falls through", "unlabeled", "npm", []string{"install"}, ActionAllow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &protocol.Request{Command: tt.command, Args: tt.args, ContainerID: tt.container, JailID: "trusted"}
+			policy := srv.currentPolicy()
+			got, _ := srv.evaluate(policy, req, srv.resolveJail(policy, req))
+			if got.Action != tt.want {
+				t.Errorf("decision = %s, want %s", got.Action, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatusRefusedInHardenedJail(t *testing.T) {
+	aj, mgr, _ := newTestAutoJailer(t, time.Minute)
+	srv := newTestServer(t)
+	srv.jailhouse = mgr
+	srv.autoJailer = aj
+	srv.setPolicy(&PolicyEngine{config: PolicyConfig{
+		DefaultAction: ActionDeny,
+		Jails:         map[string]JailConfig{"policy-locked": {Commands: []string{"ls"}, Hardened: true}},
+	}})
+	if err := mgr.CreateJail("locked", []string{"git"}, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.CreateJail("open", []string{"git"}, false); err != nil {
+		t.Fatal(err)
+	}
+	aj.Handle(ContainerEvent{Action: "start", ContainerID: "hardened", Labels: agentLabels("locked", "git")})
+
+	tests := []struct {
+		name      string
+		container string
+		claimed   string
+		refused   bool
+	}{
+		{"label jail is hardened, nothing claimed", "hardened", "", true},
+		{"label jail is hardened, another jail claimed", "hardened", "open", true},
+		{"hardened jailhouse jail claimed", "", "locked", true},
+		{"hardened policy jail claimed", "", "policy-locked", true},
+		{"open jail", "", "open", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var audited []AuditEntry
+			srv.events = events.New(log.New(io.Discard, "", 0))
+			srv.events.Subscribe("test", func(e events.Event) {
+				if a, ok := e.(Audited); ok {
+					audited = append(audited, a.Entry)
+				}
+			})
+
+			client, server := net.Pipe()
+			defer client.Close()
+			go func() {
+				defer server.Close()
+				srv.handleStatusRequest(server, &protocol.Request{
+					Type:        protocol.RequestTypeStatus,
+					Version:     protocol.ProtocolVersion,
+					Command:     "git",
+					ContainerID: tt.container,
+					JailID:      tt.claimed,
+				})
+			}()
+			_, err := protocol.ReadStatus(client)
+			srv.events.Close()
+
+			if refused := err != nil; refused != tt.refused {
+				t.Fatalf("refused = %v (%v), want %v", refused, err, tt.refused)
+			}
+			want := protocol.DecisionEvent
+			if tt.refused {
+				want = protocol.DecisionDeny
+			}
+			if len(audited) != 1 || audited[0].Decision != want || audited[0].Detail != "debug (status)" {
+				t.Errorf("audit entries = %+v, want one %s of debug (status)", audited, want)
+			}
+		})
+	}
+}
+
+func TestCreateJailWithRules(t *testing.T) {
+	_, mgr, _ := newTestAutoJailer(t, time.Minute)
+	api, _ := newTestAPIServer(t, Config{})
+	api.warden.jailhouse = mgr
+	api.warden.setPolicy(&PolicyEngine{config: PolicyConfig{DefaultAction: ActionAsk}})
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"with rules", `{"jail_id":"ci","commands":["npm"],"rules":[{"command":"npm","action":"allow"}]}`, http.StatusCreated},
+		{"without rules", `{"jail_id":"plain","commands":["npm"]}`, http.StatusCreated},
+		{"invalid rules", `{"jail_id":"bad","commands":["curl"],"rules":[{"command":"curl","url_violation_action":"maybe"}]}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/jails", strings.NewReader(tt.body)))
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, rec.Code, tt.want, strings.TrimSpace(rec.Body.String()))
+		}
+	}
+	if _, err := mgr.GetJail("bad"); err == nil {
+		t.Error("jail with invalid rules was created")
+	}
+
+	// The rules are persisted with the jail and apply to requests from it
+	state, err := mgr.GetJail("ci")
+	if err != nil || len(state.Rules) == 0 {
+		t.Fatalf("jail ci state = %+v, %v; want stored rules", state, err)
+	}
+	got := api.warden.currentPolicy().engine.EvaluateInJail(&protocol.Request{Command: "npm"}, api.warden.jailRules(api.warden.currentPolicy(), "ci"))
+	if got.Action != ActionAllow {
+		t.Errorf("npm in jail ci = %s, want allow", got.Action)
+	}
+	if rules := api.warden.jailRules(api.warden.currentPolicy(), "plain"); rules != nil {
+		t.Errorf("jail plain rules = %+v, want none", rules)
+	}
+}
+
+func TestUpdateJailAPI(t *testing.T) {
+	_, mgr, _ := newTestAutoJailer(t, time.Minute)
+	api, _ := newTestAPIServer(t, Config{})
+	api.warden.jailhouse = mgr
+	api.warden.events = events.New(log.New(io.Discard, "", 0))
+	if err := mgr.CreateJail("ci", []string{"npm", "git"}, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.SetRules("ci", json.RawMessage(`[{"command":"npm","action":"allow"}]`)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		body string
+		want int
+	}{
+		{"no such jail", "/api/jails/web", `{"commands":["ls"]}`, http.StatusNotFound},
+		{"no commands", "/api/jails/ci", `{"commands":[]}`, http.StatusBadRequest},
+		{"invalid command", "/api/jails/ci", `{"commands":["../sh"]}`, http.StatusBadRequest},
+		{"invalid rules", "/api/jails/ci", `{"commands":["curl"],"rules":[{"command":"curl","url_violation_action":"maybe"}]}`, http.StatusBadRequest},
+		{"reconcile", "/api/jails/ci", `{"commands":["git","ls"]}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, tt.path, strings.NewReader(tt.body)))
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, rec.Code, tt.want, strings.TrimSpace(rec.Body.String()))
+		}
+	}
+
+	// Commands follow the request, rules are dropped, the jail stays hardened
+	state, err := mgr.GetJail("ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(state.Commands, []string{"git", "ls"}) || state.Rules != nil || !state.Hardened {
+		t.Errorf("jail ci = %+v, want commands [git ls], no rules, hardened", state)
+	}
+}
+
+func TestJailChangeAPI(t *testing.T) {
+	_, mgr, _ := newTestAutoJailer(t, time.Minute)
+	api, _ := newTestAPIServer(t, Config{})
+	api.warden.jailhouse = mgr
+	api.warden.events = events.New(log.New(io.Discard, "", 0))
+	var audited []AuditEntry
+	api.warden.events.Subscribe("test", func(e events.Event) {
+		if a, ok := e.(Audited); ok {
+			audited = append(audited, a.Entry)
+		}
+	})
+	if err := mgr.CreateJail("ci", []string{"npm", "git"}, false); err != nil {
+		t.Fatal(err)
+	}
+	serve := func(method, path, body string) (int, map[string]json.RawMessage) {
+		rec := httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		var resp map[string]json.RawMessage
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+	changeOf := func(resp map[string]json.RawMessage) jailhouse.JailChange {
+		var change jailhouse.JailChange
+		json.Unmarshal(resp["change"], &change)
+		return change
+	}
+
+	// A dry run reports the plan and changes nothing
+	code, resp := serve(http.MethodPut, "/api/jails/ci?dry_run=true", `{"commands":["git","ls"]}`)
+	if change := changeOf(resp); code != http.StatusOK || !change.DryRun || !reflect.DeepEqual(change.Added, []string{"ls"}) || !reflect.DeepEqual(change.Removed, []string{"npm"}) {
+		t.Errorf("dry run: %d %+v", code, change)
+	}
+	if code, resp = serve(http.MethodDelete, "/api/jails/ci?dry_run=1", ""); code != http.StatusOK || len(changeOf(resp).Removed) != 2 {
+		t.Errorf("delete dry run: %d %s", code, resp["change"])
+	}
+	if state, err := mgr.GetJail("ci"); err != nil || !reflect.DeepEqual(state.Commands, []string{"npm", "git"}) {
+		t.Errorf("after dry runs: %+v, %v", state, err)
+	}
+	if code, _ = serve(http.MethodPut, "/api/jails/ci?dry_run=maybe", `{"commands":["git"]}`); code != http.StatusBadRequest {
+		t.Errorf("dry_run=maybe: status %d", code)
+	}
+
+	// A symlink that cannot be created fails the request with what did change
+	state, _ := mgr.GetJail("ci")
+	if err := os.WriteFile(filepath.Join(state.JailPath, "bin", "ls"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	code, resp = serve(http.MethodPut, "/api/jails/ci", `{"commands":["git","ls"]}`)
+	change := changeOf(resp)
+	if code != http.StatusInternalServerError || !reflect.DeepEqual(change.Removed, []string{"npm"}) || len(change.Failed) != 1 || change.Failed[0].Command != "ls" {
+		t.Errorf("partial update: %d %+v", code, change)
+	}
+	if state, _ := mgr.GetJail("ci"); !reflect.DeepEqual(state.Commands, []string{"git"}) {
+		t.Errorf("commands after partial update = %v, want [git]", state.Commands)
+	}
+
+	code, resp = serve(http.MethodDelete, "/api/jails/ci", "")
+	if change := changeOf(resp); code != http.StatusOK || !reflect.DeepEqual(change.Removed, []string{"git"}) {
+		t.Errorf("delete: %d %+v", code, change)
+	}
+
+	api.warden.events.Close()
+	if len(audited) != 2 {
+		t.Fatalf("audited %d entries, want the update and the delete: %+v", len(audited), audited)
+	}
+	if e := audited[0]; e.Command != jailCommand || e.Detail != "jail update" || e.Actor != "api" || e.Error == "" || e.JailChange == nil {
+		t.Errorf("update entry = %+v", e)
+	}
+	if e := audited[1]; e.Detail != "jail destroy" || e.Error != "" || !reflect.DeepEqual(e.JailChange.Removed, []string{"git"}) {
+		t.Errorf("destroy entry = %+v", e)
+	}
+}
+
+func TestRecordJailUse(t *testing.T) {
+	_, mgr, _ := newTestAutoJailer(t, time.Minute)
+	srv := newTestServer(t)
+	srv.jailhouse = mgr
+	if err := mgr.CreateJail("ci", []string{"npm", "git"}, false); err != nil {
+		t.Fatal(err)
+	}
+	state, _ := mgr.GetJail("ci")
+	binDir := filepath.Join(state.JailPath, "bin")
+
+	for _, req := range []*protocol.Request{
+		{Command: "npm", JailID: "ci"},                     // Jail ID from the marker
+		{Command: "npm", ShimDir: binDir},                  // Matched by the shim's directory
+		{Command: "git", ShimDir: "/usr/local/bin"},        // Not in a jail
+		{Command: "curl", JailID: "ci"},                    // No such command in the jail
+		{Command: "git", JailID: "other", ShimDir: binDir}, // The jail ID wins
+	} {
+		srv.recordJailUse(req)
+	}
+
+	usage, err := mgr.Usage("ci")
+	if err != nil {
+		t.Fatalf("Usage: %v", err)
+	}
+	if git, npm := usage.Commands[0], usage.Commands[1]; git.Count != 0 || npm.Count != 2 {
+		t.Errorf("usage = %+v, want npm used twice and git never", usage.Commands)
+	}
+}
+
+func TestJailUsageAndPruneAPI(t *testing.T) {
+	_, mgr, _ := newTestAutoJailer(t, time.Minute)
+	api, _ := newTestAPIServer(t, Config{})
+	api.warden.jailhouse = mgr
+	if err := mgr.CreateJail("ci", []string{"npm", "git", "ls"}, false); err != nil {
+		t.Fatal(err)
+	}
+	mgr.RecordUse("ci", "npm", time.Now())
+
+	call := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := call(http.MethodGet, "/api/jails/ci/usage", ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"command":"npm","count":1`) {
+		t.Errorf("usage: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := call(http.MethodGet, "/api/jails/nope/usage", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("usage of unknown jail: status %d", rec.Code)
+	}
+
+	// The jail was just created: 30 days of usage are not known yet
+	if rec := call(http.MethodPost, "/api/jails/ci/prune-unused", ""); rec.Code != http.StatusConflict {
+		t.Errorf("prune with the default window: status %d, want 409: %s", rec.Code, rec.Body.String())
+	}
+
+	rec := call(http.MethodPost, "/api/jails/ci/prune-unused", `{"older_than":"0s"}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"unused":["git","ls"],"removed":false`) {
+		t.Fatalf("proposal: %d %s", rec.Code, rec.Body.String())
+	}
+	if state, _ := mgr.GetJail("ci"); len(state.Commands) != 3 {
+		t.Errorf("proposal changed the jail: %v", state.Commands)
+	}
+
+	rec = call(http.MethodPost, "/api/jails/ci/prune-unused", `{"older_than":"0s","apply":true}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"removed":true`) {
+		t.Fatalf("prune: %d %s", rec.Code, rec.Body.String())
+	}
+	if state, _ := mgr.GetJail("ci"); strings.Join(state.Commands, ",") != "npm" {
+		t.Errorf("jail commands after pruning = %v, want npm", state.Commands)
+	}
+}
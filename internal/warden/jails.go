@@ -0,0 +1,236 @@
+package warden
+
+import (
+	"clawrden/internal/events"
+	"clawrden/internal/jailhouse"
+	"clawrden/pkg/protocol"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// jailCommand is the pseudo-command recorded in the audit log for jail
+// changes made through the API, gRPC or the policy file.
+const jailCommand = "clawrden-jail"
+
+// ErrNoJailhouse is returned by jail operations on a warden running without
+// a jailhouse.
+var ErrNoJailhouse = errors.New("jailhouse not initialized")
+
+// ErrJailRules is returned when a jail was requested with rules that could
+// not be stored. The jail is not created.
+var ErrJailRules = errors.New("store jail rules")
+
+// ErrJailNotFound is returned when updating a jail the jailhouse does not
+// have.
+var ErrJailNotFound = errors.New("jail not found")
+
+// JailRequestError is a jail request rejected before reaching the
+// jailhouse: a required field is missing or the rules do not parse.
+type JailRequestError struct {
+	Reason string
+}
+
+func (e *JailRequestError) Error() string { return e.Reason }
+
+// CreateJail creates a jail for commands, with optional jail rules in the
+// policy file's rule format, and announces it on the event bus. Source
+// names the API the request came through, e.g. "api" or "grpc".
+func (s *Server) CreateJail(jailID string, commands []string, hardened bool, rules json.RawMessage, source string) (*jailhouse.JailState, error) {
+	jh := s.GetJailhouse()
+	if jh == nil {
+		return nil, ErrNoJailhouse
+	}
+	if jailID == "" {
+		return nil, &JailRequestError{"jail_id is required"}
+	}
+	if len(commands) == 0 {
+		return nil, &JailRequestError{"commands is required"}
+	}
+	if len(rules) > 0 && string(rules) != "null" {
+		if _, err := ParseJailRules(rules); err != nil {
+			return nil, &JailRequestError{fmt.Sprintf("invalid rules: %v", err)}
+		}
+	} else {
+		rules = nil
+	}
+
+	if err := jh.CreateJail(jailID, commands, hardened); err != nil {
+		return nil, err
+	}
+	if rules != nil {
+		if err := jh.SetRules(jailID, rules); err != nil {
+			jh.DestroyJail(jailID, false)
+			return nil, fmt.Errorf("%w: %v", ErrJailRules, err)
+		}
+	}
+
+	s.logger.Printf("created jail %s via %s: %v", jailID, source, commands)
+	s.GetEvents().Publish(events.JailChanged{JailID: jailID, Change: "created", Source: source})
+	return jh.GetJail(jailID)
+}
+
+// DestroyJail removes a jail, audits the symlinks removed and announces it
+// on the event bus. With dryRun it only returns the symlinks it would
+// remove. If some could not be removed, the jail is kept with the rest and
+// the change is returned with a jailhouse.ErrPartialChange.
+func (s *Server) DestroyJail(jailID string, dryRun bool, source string) (*jailhouse.JailChange, error) {
+	jh := s.GetJailhouse()
+	if jh == nil {
+		return nil, ErrNoJailhouse
+	}
+	change, err := jh.DestroyJail(jailID, dryRun)
+	if change == nil || dryRun {
+		return change, err
+	}
+	s.recordJailChange("destroy", source, change, err)
+	if err != nil {
+		s.GetEvents().Publish(events.JailChanged{JailID: jailID, Change: "reconciled", Source: source})
+		return change, err
+	}
+	s.logger.Printf("deleted jail %s via %s", jailID, source)
+	s.GetEvents().Publish(events.JailChanged{JailID: jailID, Change: "destroyed", Source: source})
+	return change, nil
+}
+
+// UpdateJail brings an existing jail's commands and rules in line with
+// commands and rules, as CreateJail takes them, audits the symlinks it
+// added and removed, and announces the change. With dryRun it changes
+// nothing and returns the symlinks it would add and remove. Whether the
+// jail is hardened cannot change; recreate it for that.
+//
+// If some symlinks could not be changed, the jail's commands are left as
+// the ones that have a symlink, its rules are not replaced, and the jail
+// and change are returned with a jailhouse.ErrPartialChange.
+func (s *Server) UpdateJail(jailID string, commands []string, rules json.RawMessage, dryRun bool, source string) (*jailhouse.JailState, *jailhouse.JailChange, error) {
+	jh := s.GetJailhouse()
+	if jh == nil {
+		return nil, nil, ErrNoJailhouse
+	}
+	if len(commands) == 0 {
+		return nil, nil, &JailRequestError{"commands is required"}
+	}
+	if len(rules) > 0 && string(rules) != "null" {
+		if _, err := ParseJailRules(rules); err != nil {
+			return nil, nil, &JailRequestError{fmt.Sprintf("invalid rules: %v", err)}
+		}
+	} else {
+		rules = nil
+	}
+	if _, err := jh.GetJail(jailID); err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrJailNotFound, jailID)
+	}
+
+	change, err := jh.ReconcileJail(jailID, commands, dryRun)
+	switch {
+	case change == nil:
+		return nil, nil, &JailRequestError{err.Error()}
+	case dryRun:
+		jail, err := jh.GetJail(jailID)
+		return jail, change, err
+	}
+	s.recordJailChange("update", source, change, err)
+	if err != nil {
+		s.GetEvents().Publish(events.JailChanged{JailID: jailID, Change: "reconciled", Source: source})
+		jail, _ := jh.GetJail(jailID)
+		return jail, change, err
+	}
+	if err := jh.SetRules(jailID, rules); err != nil {
+		return nil, change, fmt.Errorf("%w: %v", ErrJailRules, err)
+	}
+
+	s.logger.Printf("updated jail %s via %s: %v", jailID, source, commands)
+	s.GetEvents().Publish(events.JailChanged{JailID: jailID, Change: "reconciled", Source: source})
+	jail, err := jh.GetJail(jailID)
+	return jail, change, err
+}
+
+// recordJailChange audits a change to a jail's symlinks; dry runs are not
+// recorded.
+func (s *Server) recordJailChange(action, source string, change *jailhouse.JailChange, err error) {
+	if change == nil || change.DryRun {
+		return
+	}
+	entry := AuditEntry{
+		Command:    jailCommand,
+		Args:       []string{action, change.JailID},
+		Decision:   protocol.DecisionEvent,
+		Detail:     "jail " + action,
+		Actor:      source,
+		JailChange: change,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	s.record(entry)
+}
+
+// PruneResult lists the commands of a jail never used since its usage was
+// first counted, and whether they were removed.
+type PruneResult struct {
+	JailID       string                `json:"jail_id"`
+	TrackedSince time.Time             `json:"tracked_since"`
+	Unused       []string              `json:"unused"`
+	Removed      bool                  `json:"removed"`
+	Change       *jailhouse.JailChange `json:"change,omitempty"` // What removing them changed
+}
+
+// PruneUnusedCommands finds the commands of a jail never used in its usage
+// window, which must be at least olderThan long, and with apply removes
+// them via ReconcileJail.
+func (s *Server) PruneUnusedCommands(jailID string, olderThan time.Duration, apply bool, source string) (*PruneResult, error) {
+	jh := s.GetJailhouse()
+	if jh == nil {
+		return nil, ErrNoJailhouse
+	}
+	usage, err := jh.Usage(jailID)
+	if err != nil {
+		return nil, err
+	}
+	if tracked := time.Since(usage.TrackedSince); tracked < olderThan {
+		return nil, &JailRequestError{fmt.Sprintf("usage of jail %s is counted since %s, less than %s ago",
+			jailID, usage.TrackedSince.Format(time.RFC3339), olderThan)}
+	}
+
+	result := &PruneResult{JailID: jailID, TrackedSince: usage.TrackedSince, Unused: usage.Unused()}
+	if !apply || len(result.Unused) == 0 {
+		return result, nil
+	}
+	var keep []string
+	for _, c := range usage.Commands {
+		if c.Count > 0 {
+			keep = append(keep, c.Command)
+		}
+	}
+	change, err := jh.ReconcileJail(jailID, keep, false)
+	s.recordJailChange("prune", source, change, err)
+	if err != nil {
+		return nil, err
+	}
+	result.Removed, result.Change = true, change
+
+	s.logger.Printf("pruned jail %s via %s: removed unused %v", jailID, source, result.Unused)
+	s.GetEvents().Publish(events.JailChanged{JailID: jailID, Change: "pruned", Source: source})
+	return result, nil
+}
+
+// recordJailUse counts a request against the jail command it came through:
+// the jail the request resolved to, or else the jail whose bin directory
+// the shim reports running from.
+func (s *Server) recordJailUse(req *protocol.Request) {
+	jh := s.GetJailhouse()
+	if jh == nil {
+		return
+	}
+	jailID := req.JailID
+	if jailID == "" {
+		var ok bool
+		if jailID, ok = jh.JailForBinDir(req.ShimDir); !ok {
+			return
+		}
+	}
+	// Policy jails not in the jailhouse and commands without a symlink in
+	// the jail have nothing to count
+	jh.RecordUse(jailID, req.Command, time.Now())
+}
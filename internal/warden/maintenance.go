@@ -0,0 +1,148 @@
+package warden
+
+import (
+	"clawrden/internal/events"
+	"clawrden/pkg/protocol"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// maintenanceCommand is the pseudo-command recorded in the audit log when a
+// maintenance window starts or ends.
+const maintenanceCommand = "clawrden-maintenance"
+
+// ErrNoMaintenance is returned when ending a maintenance window that is not
+// active.
+var ErrNoMaintenance = errors.New("no maintenance window active")
+
+// Maintenance is an announced window during which the warden is about to go
+// away, e.g. for an upgrade. Requests that would wait for a human are denied
+// with Message instead of being queued, unless QueueAsk is set; allowed
+// requests run as usual.
+type Maintenance struct {
+	ID       string    `json:"id"`
+	Message  string    `json:"message"`
+	Started  time.Time `json:"started"`
+	Until    time.Time `json:"until"`
+	QueueAsk bool      `json:"queue_ask,omitempty"` // Keep queueing ask requests for review
+}
+
+// Reason is the denial reason given to agents during the window.
+func (m *Maintenance) Reason() string {
+	reason := "warden maintenance until " + m.Until.Format("15:04 MST")
+	if m.Message != "" {
+		reason += ": " + m.Message
+	}
+	return reason
+}
+
+// MaintenanceWindow holds the current maintenance window, if any. Windows
+// expire on their own once their duration has passed, measured on the
+// monotonic clock: stepping the wall clock neither ends a window early nor
+// stretches it.
+type MaintenanceWindow struct {
+	mu       sync.Mutex
+	current  *Maintenance
+	deadline time.Duration // Monotonic reading at which current expires
+	now      func() time.Time
+	mono     func() time.Duration
+}
+
+// NewMaintenanceWindow creates a window tracker with no active maintenance.
+func NewMaintenanceWindow() *MaintenanceWindow {
+	return &MaintenanceWindow{now: time.Now, mono: monotonicNow}
+}
+
+// Start announces maintenance for d, replacing any active window.
+func (w *MaintenanceWindow) Start(message string, d time.Duration, queueAsk bool) (*Maintenance, error) {
+	if d <= 0 {
+		return nil, fmt.Errorf("maintenance duration must be positive, got %s", d)
+	}
+	now := w.now()
+	m := &Maintenance{
+		ID:       newID("mnt", now),
+		Message:  message,
+		Started:  now,
+		Until:    now.Add(d),
+		QueueAsk: queueAsk,
+	}
+	w.mu.Lock()
+	w.current, w.deadline = m, w.mono()+d
+	w.mu.Unlock()
+	return m, nil
+}
+
+// End ends the active window early and returns it.
+func (w *MaintenanceWindow) End() (*Maintenance, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	m := w.activeLocked()
+	if m == nil {
+		return nil, ErrNoMaintenance
+	}
+	w.current = nil
+	return m, nil
+}
+
+// Active returns a copy of the active window, or nil if there is none.
+func (w *MaintenanceWindow) Active() *Maintenance {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if m := w.activeLocked(); m != nil {
+		cp := *m
+		return &cp
+	}
+	return nil
+}
+
+// activeLocked drops an expired window and returns the current one.
+func (w *MaintenanceWindow) activeLocked() *Maintenance {
+	if w.current != nil && w.mono() >= w.deadline {
+		w.current = nil
+	}
+	return w.current
+}
+
+// StartMaintenance announces a maintenance window: a log line, an audit
+// entry and a MaintenanceChanged event that chat bridges relay.
+func (s *Server) StartMaintenance(message string, d time.Duration, queueAsk bool) (*Maintenance, error) {
+	m, err := s.maintenance.Start(message, d, queueAsk)
+	if err != nil {
+		return nil, err
+	}
+	mode := "denying"
+	if queueAsk {
+		mode = "queueing"
+	}
+	s.logger.Printf("maintenance %s started until %s (%s ask requests): %s", m.ID, m.Until.Format(time.RFC3339), mode, m.Message)
+	s.record(AuditEntry{
+		Command:  maintenanceCommand,
+		Args:     []string{"start", m.ID, d.String(), m.Message},
+		Decision: protocol.DecisionEvent,
+		Detail:   "maintenance started",
+	})
+	s.events.Publish(events.MaintenanceChanged{ID: m.ID, Active: true, Message: m.Message, Until: m.Until})
+	return m, nil
+}
+
+// EndMaintenance ends the active maintenance window early.
+func (s *Server) EndMaintenance() (*Maintenance, error) {
+	m, err := s.maintenance.End()
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Printf("maintenance %s ended", m.ID)
+	s.record(AuditEntry{
+		Command:  maintenanceCommand,
+		Args:     []string{"end", m.ID},
+		Decision: protocol.DecisionEvent,
+		Detail:   "maintenance ended",
+	})
+	s.events.Publish(events.MaintenanceChanged{ID: m.ID, Message: m.Message, Until: m.Until})
+	return m, nil
+}
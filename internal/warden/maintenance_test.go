@@ -0,0 +1,258 @@
+package warden
+
+import (
+	"clawrden/internal/events"
+	"clawrden/internal/executor"
+	"clawrden/pkg/protocol"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceWindowExpires(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+	w := NewMaintenanceWindow()
+	w.now, w.mono = clock.Now, clock.Mono
+
+	if _, err := w.Start("upgrading", 0, false); err == nil {
+		t.Error("Start accepted a zero duration")
+	}
+	m, err := w.Start("upgrading", 10*time.Minute, false)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if !strings.HasPrefix(m.ID, "mnt-") || m.Reason() != "warden maintenance until 12:10 UTC: upgrading" {
+		t.Errorf("window = %+v, reason %q", m, m.Reason())
+	}
+
+	clock.Advance(9 * time.Minute)
+	if w.Active() == nil {
+		t.Fatal("window ended early")
+	}
+	clock.Advance(time.Minute)
+	if got := w.Active(); got != nil {
+		t.Errorf("window still active after its duration: %+v", got)
+	}
+	if _, err := w.End(); !errors.Is(err, ErrNoMaintenance) {
+		t.Errorf("End after expiry = %v, want ErrNoMaintenance", err)
+	}
+
+	var none *MaintenanceWindow
+	if none.Active() != nil {
+		t.Error("nil window reported maintenance")
+	}
+}
+
+func TestMaintenanceWindowIgnoresClockSteps(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+	w := NewMaintenanceWindow()
+	w.now, w.mono = clock.Now, clock.Mono
+
+	if _, err := w.Start("upgrading", 10*time.Minute, false); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	clock.Step(time.Hour)
+	if w.Active() == nil {
+		t.Fatal("stepping the clock forward ended the window")
+	}
+	clock.Step(-2 * time.Hour)
+	clock.Advance(10 * time.Minute)
+	if got := w.Active(); got != nil {
+		t.Errorf("stepping the clock back kept the window past its duration: %+v", got)
+	}
+}
+
+// newMaintenanceTestServer returns a server that runs allowed commands
+// locally, collecting its audit entries.
+func newMaintenanceTestServer(t *testing.T, rules []Rule) (*Server, func() []AuditEntry) {
+	t.Helper()
+	srv := newTestServer(t)
+	srv.setPolicy(&PolicyEngine{config: PolicyConfig{DefaultAction: ActionDeny, Rules: rules}})
+	srv.incidents = NewIncidentTracker()
+	srv.maintenance = NewMaintenanceWindow()
+	srv.localExec = executor.NewLocalExecutor(srv.logger)
+	srv.events = events.New(log.New(io.Discard, "", 0))
+	var mu sync.Mutex
+	var audited []AuditEntry
+	srv.events.Subscribe("test", func(e events.Event) {
+		if a, ok := e.(Audited); ok {
+			mu.Lock()
+			audited = append(audited, a.Entry)
+			mu.Unlock()
+		}
+	})
+	return srv, func() []AuditEntry {
+		srv.events.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for i := range audited {
+			if err := audited[i].Validate(); err != nil {
+				t.Errorf("audit entry for %s: %v", audited[i].Command, err)
+			}
+		}
+		return audited
+	}
+}
+
+// sendRequest runs req through the server and returns the first ack and the
+// denial reason, if any.
+func sendRequest(t *testing.T, srv *Server, req *protocol.Request) (byte, string) {
+	t.Helper()
+	client, server := net.Pipe()
+	defer client.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.handleConnection(server)
+	}()
+
+	if err := protocol.WriteRequest(client, req); err != nil {
+		t.Fatalf("write request: %v", err)
+	}
+	ack, err := protocol.ReadAck(client)
+	if err != nil {
+		t.Fatalf("read ack: %v", err)
+	}
+	var reason string
+	switch ack {
+	case protocol.AckDenied:
+		if reason, err = protocol.ReadDenialReason(client); err != nil {
+			t.Fatalf("read denial reason: %v", err)
+		}
+	case protocol.AckPendingHITL:
+		for len(srv.hitl.List()) == 0 {
+			time.Sleep(time.Millisecond) // The ack goes out before the request is queued
+		}
+		srv.hitl.Resolve(srv.hitl.List()[0].ID, DecisionDeny)
+		io.Copy(io.Discard, client)
+	default:
+		io.Copy(io.Discard, client)
+	}
+	<-done
+	return ack, reason
+}
+
+func TestMaintenanceDecisionOverrides(t *testing.T) {
+	rules := []Rule{
+		{Command: "echo", Action: ActionAllow},
+		{Command: "terraform", Action: ActionAsk},
+	}
+	tests := []struct {
+		name         string
+		maintenance  bool
+		queueAsk     bool
+		command      string
+		wantAck      byte
+		wantReason   string
+		wantDecision string
+	}{
+		{"ask without maintenance is queued", false, false, "terraform", protocol.AckPendingHITL, "", "deny (after HITL)"},
+		{"ask is denied during maintenance", true, false, "terraform", protocol.AckDenied, "upgrading", "deny (maintenance)"},
+		{"ask is queued when configured", true, true, "terraform", protocol.AckPendingHITL, "", "deny (after HITL)"},
+		{"allow still runs", true, false, "echo", protocol.AckAllowed, "", "allow"},
+		{"deny is unchanged", true, false, "rm", protocol.AckDenied, "", "deny"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, audited := newMaintenanceTestServer(t, rules)
+			if tt.maintenance {
+				if _, err := srv.StartMaintenance("upgrading", 10*time.Minute, tt.queueAsk); err != nil {
+					t.Fatalf("StartMaintenance: %v", err)
+				}
+			}
+
+			ack, reason := sendRequest(t, srv, &protocol.Request{Command: tt.command, Args: []string{"hi"}, Cwd: t.TempDir()})
+			if ack != tt.wantAck {
+				t.Errorf("ack = %d, want %d", ack, tt.wantAck)
+			}
+			if !strings.Contains(reason, tt.wantReason) || (tt.wantReason == "") != (reason == "") {
+				t.Errorf("denial reason = %q, want %q", reason, tt.wantReason)
+			}
+			entries := audited()
+			last := entries[len(entries)-1]
+			if last.Command != tt.command || last.DecisionLabel() != tt.wantDecision {
+				t.Errorf("audited %s: %q, want %q", last.Command, last.DecisionLabel(), tt.wantDecision)
+			}
+			if tt.wantReason != "" && !strings.Contains(last.Error, tt.wantReason) {
+				t.Errorf("audit error = %q, want the maintenance message", last.Error)
+			}
+		})
+	}
+}
+
+func TestMaintenanceAPI(t *testing.T) {
+	api, _ := newTestAPIServer(t, Config{})
+	api.warden.maintenance = NewMaintenanceWindow()
+
+	do := func(method, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(rec, httptest.NewRequest(method, "/api/maintenance", strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := do(http.MethodGet, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("GET without maintenance = %d, want 404", rec.Code)
+	}
+	if rec := do(http.MethodPost, `{"message":"upgrading","duration":"soon"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("POST with a bad duration = %d, want 400", rec.Code)
+	}
+	rec := do(http.MethodPost, `{"message":"upgrading","duration":"10m"}`)
+	var m Maintenance
+	if rec.Code != http.StatusCreated || json.NewDecoder(rec.Body).Decode(&m) != nil || m.Message != "upgrading" {
+		t.Fatalf("POST = %d %+v", rec.Code, m)
+	}
+
+	// The status endpoint shows the window
+	rec = httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/status", nil))
+	var status struct {
+		Maintenance *Maintenance `json:"maintenance"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil || status.Maintenance == nil || status.Maintenance.ID != m.ID {
+		t.Errorf("/api/status maintenance = %+v, %v", status.Maintenance, err)
+	}
+
+	if rec := do(http.MethodGet, ""); rec.Code != http.StatusOK {
+		t.Errorf("GET during maintenance = %d, want 200", rec.Code)
+	}
+	if rec := do(http.MethodDelete, ""); rec.Code != http.StatusOK {
+		t.Errorf("DELETE = %d, want 200", rec.Code)
+	}
+	if rec := do(http.MethodDelete, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("second DELETE = %d, want 404", rec.Code)
+	}
+}
+
+func TestAuditBlockModeDeniesRequests(t *testing.T) {
+	srv, audited := newMaintenanceTestServer(t, []Rule{{Command: "echo", Action: ActionAllow}})
+	w := &failingWriter{broken: true}
+	srv.audit = &AuditLogger{writer: w}
+	srv.audit.SetFailureMode(AuditFailBlock, 10, srv.logger)
+	srv.audit.Log(AuditEntry{Command: "lost"})
+
+	ack, reason := sendRequest(t, srv, &protocol.Request{Command: "echo", Args: []string{"hi"}, Cwd: "/"})
+	if ack != protocol.AckDenied || !strings.Contains(reason, "cannot write its audit log") {
+		t.Errorf("ack = %d, reason %q; want a denial naming the audit log", ack, reason)
+	}
+
+	w.broken = false
+	if ack, _ := sendRequest(t, srv, &protocol.Request{Command: "echo", Args: []string{"hi"}, Cwd: "/"}); ack != protocol.AckAllowed {
+		t.Errorf("ack after recovery = %d, want allowed", ack)
+	}
+	entries := audited()
+	if len(entries) != 2 || entries[0].Decision != protocol.DecisionDeny || entries[0].Outcome != protocol.OutcomeAuditUnavailable {
+		t.Errorf("audit entries = %+v, want the denial recorded", entries)
+	}
+	// The allowed echo's started entry goes straight to the log
+	if got := strings.Join(w.commands(t), " "); got != "lost echo" {
+		t.Errorf("written = %q, want the held entry flushed, then the started entry", got)
+	}
+}
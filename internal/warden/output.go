@@ -0,0 +1,273 @@
+package warden
+
+import (
+	"clawrden/internal/executor"
+	"clawrden/pkg/protocol"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// outputHistoryBytes bounds the output payload kept per execution for
+// viewers that attach late. Older chunks are evicted first.
+const outputHistoryBytes = 256 << 10
+
+// outputSubscriberQueue is how many chunks may wait for one viewer. A viewer
+// that falls further behind misses chunks and is told how many.
+const outputSubscriberQueue = 256
+
+// outputRecentFinished is how many finished executions stay viewable.
+const outputRecentFinished = 16
+
+// ErrExecutionNotFound is returned for an execution that is neither running
+// nor among the recently finished ones.
+var ErrExecutionNotFound = errors.New("execution not found")
+
+// OutputDropped is the stream of the marker for chunks a viewer missed.
+const OutputDropped = "dropped"
+
+// OutputChunk is one piece of an execution's output as seen by a viewer.
+type OutputChunk struct {
+	Seq      uint64 `json:"seq,omitempty"`
+	Stream   string `json:"stream"` // stdout, stderr, exit, or dropped
+	Data     string `json:"data,omitempty"`
+	ExitCode *int   `json:"exit_code,omitempty"`
+	Dropped  uint64 `json:"dropped,omitempty"` // Chunks missed before this marker
+}
+
+// ExecutionInfo describes a running or recently finished execution.
+type ExecutionInfo struct {
+	ID       string     `json:"id"`
+	Command  string     `json:"command"`
+	Args     []string   `json:"args,omitempty"`
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+
+	// What the command changed in its workspace, once known
+	Changes *executor.ChangeSummary `json:"changes,omitempty"`
+}
+
+// executionOutput keeps the recent output of one execution and fans new
+// chunks out to its viewers. Publishing never blocks: a viewer whose queue
+// is full misses the chunk.
+type executionOutput struct {
+	mu       sync.Mutex
+	info     ExecutionInfo
+	history  []OutputChunk
+	size     int    // Payload bytes in history
+	evicted  uint64 // Chunks dropped from the front of history
+	seq      uint64
+	viewers  map[*outputViewer]struct{}
+	finished bool
+}
+
+// outputViewer is one attached reader of an execution's output.
+type outputViewer struct {
+	chunks  chan OutputChunk
+	dropped uint64 // Chunks missed since the last delivered one
+}
+
+// publish appends a chunk to the history and offers it to every viewer.
+func (o *executionOutput) publish(chunk OutputChunk) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.finished {
+		return
+	}
+
+	o.seq++
+	chunk.Seq = o.seq
+	o.history = append(o.history, chunk)
+	o.size += len(chunk.Data)
+	for o.size > outputHistoryBytes && len(o.history) > 1 {
+		o.size -= len(o.history[0].Data)
+		o.history[0] = OutputChunk{}
+		o.history = o.history[1:]
+		o.evicted++
+	}
+
+	for v := range o.viewers {
+		v.offer(chunk)
+	}
+}
+
+// offer queues chunk without blocking, preceded by a marker for any chunks
+// the viewer missed. One slot of the queue stays free for the final marker.
+func (v *outputViewer) offer(chunk OutputChunk) {
+	if v.dropped > 0 {
+		if len(v.chunks) >= outputSubscriberQueue {
+			v.dropped++
+			return
+		}
+		v.chunks <- OutputChunk{Stream: OutputDropped, Dropped: v.dropped}
+		v.dropped = 0
+	}
+	if len(v.chunks) >= outputSubscriberQueue {
+		v.dropped++
+		return
+	}
+	v.chunks <- chunk
+}
+
+// attach returns the buffered history and, when follow is set and the
+// execution is still running, a channel of live chunks that is closed when
+// it finishes. detach must be called when the viewer goes away.
+func (o *executionOutput) attach(follow bool) (history []OutputChunk, live <-chan OutputChunk, detach func()) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.evicted > 0 {
+		history = append(history, OutputChunk{Stream: OutputDropped, Dropped: o.evicted})
+	}
+	history = append(history, o.history...)
+	if !follow || o.finished {
+		return history, nil, func() {}
+	}
+
+	v := &outputViewer{chunks: make(chan OutputChunk, outputSubscriberQueue+1)}
+	o.viewers[v] = struct{}{}
+	return history, v.chunks, func() {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		if _, ok := o.viewers[v]; ok {
+			delete(o.viewers, v)
+			close(v.chunks)
+		}
+	}
+}
+
+// Info returns the execution's details.
+func (o *executionOutput) Info() ExecutionInfo {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.info
+}
+
+// finish ends the live stream of every viewer.
+func (o *executionOutput) finish(at time.Time) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.finished = true
+	o.info.Finished = &at
+	for v := range o.viewers {
+		if v.dropped > 0 {
+			v.chunks <- OutputChunk{Stream: OutputDropped, Dropped: v.dropped}
+		}
+		delete(o.viewers, v)
+		close(v.chunks)
+	}
+}
+
+// record turns one write to the shim into a chunk. protocol.WriteFrame
+// issues a single Write per frame, so a write is a whole frame.
+func (o *executionOutput) record(b []byte) {
+	if len(b) < protocol.FrameHeaderSize {
+		return
+	}
+	payload := b[protocol.FrameHeaderSize:]
+	switch b[0] {
+	case protocol.StreamStdout:
+		o.publish(OutputChunk{Stream: "stdout", Data: string(payload)})
+	case protocol.StreamStderr:
+		o.publish(OutputChunk{Stream: "stderr", Data: string(payload)})
+	case protocol.StreamExit:
+		code := protocol.ParseExitCode(protocol.Frame{Payload: payload})
+		o.publish(OutputChunk{Stream: "exit", ExitCode: &code})
+	}
+}
+
+// outputConn tees what the executor writes to the shim into an execution's
+// output. The shim write happens first and is never held up by viewers.
+type outputConn struct {
+	net.Conn
+	out *executionOutput
+}
+
+func (c *outputConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.out.record(b)
+	return n, err
+}
+
+// OutputRegistry tracks the output of running executions and keeps the
+// last few finished ones.
+type OutputRegistry struct {
+	mu       sync.Mutex
+	running  map[string]*executionOutput
+	finished []*executionOutput // Oldest first
+}
+
+// NewOutputRegistry creates an empty registry.
+func NewOutputRegistry() *OutputRegistry {
+	return &OutputRegistry{running: make(map[string]*executionOutput)}
+}
+
+// start registers an execution and returns conn with its output teed, and a
+// function to call once the execution is over.
+func (r *OutputRegistry) start(id string, req *protocol.Request, conn net.Conn) (net.Conn, func()) {
+	out := &executionOutput{
+		info:    ExecutionInfo{ID: id, Command: req.Command, Args: req.Args, Started: time.Now()},
+		viewers: make(map[*outputViewer]struct{}),
+	}
+	r.mu.Lock()
+	r.running[id] = out
+	r.mu.Unlock()
+
+	return &outputConn{Conn: conn, out: out}, func() {
+		out.finish(time.Now())
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.running, id)
+		r.finished = append(r.finished, out)
+		if len(r.finished) > outputRecentFinished {
+			r.finished[0] = nil
+			r.finished = r.finished[1:]
+		}
+	}
+}
+
+// get returns a running or recently finished execution.
+func (r *OutputRegistry) get(id string) (*executionOutput, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if out, ok := r.running[id]; ok {
+		return out, nil
+	}
+	for _, out := range r.finished {
+		if out.info.ID == id {
+			return out, nil
+		}
+	}
+	return nil, ErrExecutionNotFound
+}
+
+// setChanges records what an execution changed in its workspace.
+func (r *OutputRegistry) setChanges(id string, changes *executor.ChangeSummary) {
+	out, err := r.get(id)
+	if err != nil {
+		return
+	}
+	out.mu.Lock()
+	out.info.Changes = changes
+	out.mu.Unlock()
+}
+
+// List returns the running and recently finished executions, newest first.
+func (r *OutputRegistry) List() []ExecutionInfo {
+	r.mu.Lock()
+	outputs := make([]*executionOutput, 0, len(r.running)+len(r.finished))
+	for _, out := range r.running {
+		outputs = append(outputs, out)
+	}
+	outputs = append(outputs, r.finished...)
+	r.mu.Unlock()
+
+	list := make([]ExecutionInfo, len(outputs))
+	for i, out := range outputs {
+		list[i] = out.Info()
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Started.After(list[j].Started) })
+	return list
+}
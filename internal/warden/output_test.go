@@ -0,0 +1,191 @@
+package warden
+
+import (
+	"bufio"
+	"clawrden/pkg/protocol"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startTestOutput registers an execution whose shim end discards everything.
+func startTestOutput(t *testing.T, reg *OutputRegistry, id string) (net.Conn, func()) {
+	t.Helper()
+	client, server := net.Pipe()
+	go io.Copy(io.Discard, client)
+	t.Cleanup(func() { client.Close(); server.Close() })
+	return reg.start(id, &protocol.Request{Command: "terraform", Args: []string{"plan"}}, server)
+}
+
+func TestOutputSlowViewerDropsChunks(t *testing.T) {
+	reg := NewOutputRegistry()
+	conn, done := startTestOutput(t, reg, "req-1")
+	out, _ := reg.get("req-1")
+	_, live, detach := out.attach(true)
+	defer detach()
+
+	// The viewer reads nothing; the shim stream must not wait for it
+	total := outputSubscriberQueue + 100
+	writes := make(chan struct{})
+	go func() {
+		defer close(writes)
+		for i := 0; i < total; i++ {
+			protocol.WriteFrame(conn, protocol.Frame{Type: protocol.StreamStdout, Payload: []byte("line\n")})
+		}
+	}()
+	select {
+	case <-writes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("writes to the shim blocked on a slow viewer")
+	}
+	done()
+
+	var received, dropped uint64
+	for chunk := range live {
+		switch chunk.Stream {
+		case "stdout":
+			received++
+		case OutputDropped:
+			dropped += chunk.Dropped
+		}
+	}
+	if received != outputSubscriberQueue || received+dropped != uint64(total) {
+		t.Errorf("received %d and dropped %d chunks, want %d and %d", received, dropped, outputSubscriberQueue, total-outputSubscriberQueue)
+	}
+}
+
+func TestOutputHistoryBounded(t *testing.T) {
+	reg := NewOutputRegistry()
+	_, done := startTestOutput(t, reg, "req-1")
+	out, _ := reg.get("req-1")
+
+	chunk := strings.Repeat("x", 1024)
+	for i := 0; i < outputHistoryBytes/1024+10; i++ {
+		out.publish(OutputChunk{Stream: "stdout", Data: chunk})
+	}
+	done()
+
+	history, live, _ := out.attach(true)
+	if live != nil {
+		t.Error("following a finished execution returned a live channel")
+	}
+	if history[0].Stream != OutputDropped || history[0].Dropped != 10 {
+		t.Errorf("first chunk = %+v, want a marker for 10 evicted chunks", history[0])
+	}
+	if len(history)-1 != outputHistoryBytes/1024 {
+		t.Errorf("history has %d chunks, want %d", len(history)-1, outputHistoryBytes/1024)
+	}
+}
+
+func TestOutputRecentFinishedBounded(t *testing.T) {
+	reg := NewOutputRegistry()
+	for i := 0; i < outputRecentFinished+1; i++ {
+		_, done := startTestOutput(t, reg, newID("req", time.Now()))
+		done()
+	}
+	if got := len(reg.List()); got != outputRecentFinished {
+		t.Errorf("List has %d executions, want %d", got, outputRecentFinished)
+	}
+}
+
+// TestExecutionOutputLiveTail follows a slow command over the API while it
+// runs.
+func TestExecutionOutputLiveTail(t *testing.T) {
+	srv, _ := newMaintenanceTestServer(t, []Rule{{Command: "sh", Action: ActionAllow}})
+	srv.outputs = NewOutputRegistry()
+	api := httptest.NewServer(NewAPIServer(srv, "127.0.0.1:0", log.New(io.Discard, "", 0)).server.Handler)
+	defer api.Close()
+
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		sendRequest(t, srv, &protocol.Request{
+			Command: "sh",
+			Args:    []string{"-c", "echo one; sleep 0.5; echo two >&2; exit 3"},
+			Cwd:     t.TempDir(),
+		})
+	}()
+
+	var running []ExecutionInfo
+	for deadline := time.Now().Add(5 * time.Second); len(running) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("execution never started")
+		}
+		time.Sleep(5 * time.Millisecond)
+		running = srv.outputs.List()
+	}
+
+	resp, err := http.Get(api.URL + "/api/executions/" + running[0].ID + "/output?follow=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	var chunks []OutputChunk
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var chunk OutputChunk
+		if err := json.Unmarshal(scanner.Bytes(), &chunk); err != nil {
+			t.Fatalf("decode %q: %v", scanner.Text(), err)
+		}
+		if len(chunks) == 0 && srv.outputs.List()[0].Finished != nil {
+			t.Error("first chunk arrived after the command finished")
+		}
+		chunks = append(chunks, chunk)
+	}
+	<-sent
+
+	var got []string
+	for _, c := range chunks {
+		switch {
+		case c.ExitCode != nil:
+			got = append(got, fmt.Sprintf("%s:%d", c.Stream, *c.ExitCode))
+		default:
+			got = append(got, c.Stream+":"+strings.TrimSpace(c.Data))
+		}
+	}
+	if want := "stdout:one stderr:two exit:3"; strings.Join(got, " ") != want {
+		t.Errorf("chunks = %v, want %s", got, want)
+	}
+
+	// The finished execution's output can still be read without following
+	resp, err = http.Get(api.URL + "/api/executions/" + running[0].ID + "/output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if strings.Count(string(body), "\n") != len(chunks) {
+		t.Errorf("history after finishing = %q, want %d chunks", body, len(chunks))
+	}
+
+	resp, err = http.Get(api.URL + "/api/executions/" + running[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var info ExecutionInfo
+	json.NewDecoder(resp.Body).Decode(&info)
+	resp.Body.Close()
+	if info.ID != running[0].ID || info.Command != "sh" || info.Finished == nil {
+		t.Errorf("execution details = %+v", info)
+	}
+
+	resp, err = http.Get(api.URL + "/api/executions/req-unknown/output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown execution: status %d, want 404", resp.StatusCode)
+	}
+}
@@ -0,0 +1,122 @@
+package warden
+
+import (
+	"clawrden/internal/executor"
+	"clawrden/pkg/protocol"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Knobs a policy's reviewer_overrides may list.
+const (
+	OverrideStrategy = "strategy"
+	OverrideNetwork  = "network"
+	OverrideTimeout  = "timeout"
+)
+
+var overrideKnobs = []string{OverrideStrategy, OverrideNetwork, OverrideTimeout}
+
+// ExecutionOverrides change how an approved request runs. A reviewer sets
+// them when approving; unset fields keep the policy's choice.
+type ExecutionOverrides struct {
+	Strategy executor.Strategy `json:"strategy,omitempty"` // Where the command runs
+	Network  string            `json:"network,omitempty"`  // Ghost container network: "none" or "bridge"
+	Timeout  string            `json:"timeout,omitempty"`  // exec_timeout as a Go duration, e.g. "5m"
+}
+
+// knobs returns the names of the fields o sets.
+func (o ExecutionOverrides) knobs() []string {
+	var set []string
+	if o.Strategy != "" {
+		set = append(set, OverrideStrategy)
+	}
+	if o.Network != "" {
+		set = append(set, OverrideNetwork)
+	}
+	if o.Timeout != "" {
+		set = append(set, OverrideTimeout)
+	}
+	return set
+}
+
+// String lists the fields o sets, e.g. "strategy=ghost network=none".
+func (o ExecutionOverrides) String() string {
+	var parts []string
+	if o.Strategy != "" {
+		parts = append(parts, "strategy="+string(o.Strategy))
+	}
+	if o.Network != "" {
+		parts = append(parts, "network="+o.Network)
+	}
+	if o.Timeout != "" {
+		parts = append(parts, "timeout="+o.Timeout)
+	}
+	return strings.Join(parts, " ")
+}
+
+// validateOverrideKnobs checks the knobs listed in reviewer_overrides.
+func validateOverrideKnobs(knobs []string) error {
+	for _, k := range knobs {
+		if !slices.Contains(overrideKnobs, k) {
+			return fmt.Errorf("reviewer_overrides: unknown knob %q (expected %s)", k, strings.Join(overrideKnobs, ", "))
+		}
+	}
+	return nil
+}
+
+// ValidateOverrides checks that the policy lets reviewers set every field of
+// o and that each value is usable.
+func (pe *PolicyEngine) ValidateOverrides(o ExecutionOverrides) error {
+	for _, k := range o.knobs() {
+		if !slices.Contains(pe.config.ReviewerOverrides, k) {
+			return fmt.Errorf("%s cannot be overridden: the policy's reviewer_overrides does not list it", k)
+		}
+	}
+	if o.Strategy != "" && (!o.Strategy.Valid() || o.Strategy == executor.StrategyAuto) {
+		return fmt.Errorf("strategy must be mirror, ghost or local, got %q", o.Strategy)
+	}
+	if o.Network != "" {
+		if o.Network != "none" && o.Network != "bridge" {
+			return fmt.Errorf("network must be none or bridge, got %q", o.Network)
+		}
+		if o.Strategy != "" && o.Strategy != executor.StrategyGhost {
+			return fmt.Errorf("network only applies to the ghost strategy, not %s", o.Strategy)
+		}
+	}
+	if o.Timeout != "" {
+		if d, err := time.ParseDuration(o.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid timeout %q (expected e.g. 5m)", o.Timeout)
+		}
+	}
+	return nil
+}
+
+// applyOverrides changes how an approved request runs as the reviewer asked.
+// A network pins the ghost strategy, the only one that starts a container
+// of its own. It fails when the pinned strategy is unavailable for req, for
+// instance ghost for a request from the host.
+func (s *Server) applyOverrides(req *protocol.Request, result *EvaluationResult, o ExecutionOverrides) error {
+	if o.Timeout != "" {
+		d, err := time.ParseDuration(o.Timeout)
+		if err != nil {
+			return fmt.Errorf("invalid timeout %q: %w", o.Timeout, err)
+		}
+		result.ExecTimeout = d
+	}
+	if o.Network != "" {
+		req.Network = o.Network
+		result.Strategy = executor.StrategyGhost
+	}
+	if o.Strategy != "" {
+		result.Strategy = o.Strategy
+	}
+	if o.Strategy == "" && o.Network == "" {
+		return nil
+	}
+	if _, strategy := s.executorFor(req, result.Strategy, result.Sandbox != nil); strategy != result.Strategy {
+		return fmt.Errorf("reviewer pinned the %s strategy, but this request would run with %s", result.Strategy, strategy)
+	}
+	return nil
+}
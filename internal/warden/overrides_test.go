@@ -0,0 +1,180 @@
+package warden
+
+import (
+	"clawrden/internal/executor"
+	"clawrden/pkg/protocol"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateOverrides(t *testing.T) {
+	pe := &PolicyEngine{config: PolicyConfig{ReviewerOverrides: []string{OverrideStrategy, OverrideNetwork}}}
+	tests := []struct {
+		name      string
+		overrides ExecutionOverrides
+		wantErr   string
+	}{
+		{"strategy", ExecutionOverrides{Strategy: executor.StrategyGhost}, ""},
+		{"network", ExecutionOverrides{Network: "none"}, ""},
+		{"ghost without network", ExecutionOverrides{Strategy: executor.StrategyGhost, Network: "none"}, ""},
+		{"knob not overridable", ExecutionOverrides{Timeout: "5m"}, "timeout cannot be overridden"},
+		{"unknown strategy", ExecutionOverrides{Strategy: "vm"}, "strategy must be"},
+		{"auto is no pin", ExecutionOverrides{Strategy: executor.StrategyAuto}, "strategy must be"},
+		{"unknown network", ExecutionOverrides{Network: "host"}, "network must be"},
+		{"network outside a ghost", ExecutionOverrides{Strategy: executor.StrategyMirror, Network: "none"}, "only applies to the ghost strategy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := pe.ValidateOverrides(tt.overrides)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("ValidateOverrides: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("ValidateOverrides error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	pe.config.ReviewerOverrides = append(pe.config.ReviewerOverrides, OverrideTimeout)
+	if err := pe.ValidateOverrides(ExecutionOverrides{Timeout: "soon"}); err == nil {
+		t.Error("invalid timeout accepted")
+	}
+}
+
+func TestLoadPolicyRejectsUnknownOverrideKnob(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writeTestFile(t, path, "default_action: deny\nreviewer_overrides: [strategy, image]\nrules: []\n")
+	if _, err := LoadPolicy(path); err == nil || !strings.Contains(err.Error(), `"image"`) {
+		t.Errorf("LoadPolicy error = %v, want the unknown knob named", err)
+	}
+}
+
+func TestApplyOverridesSelectsExecutor(t *testing.T) {
+	const container = "0123456789ab"
+	tests := []struct {
+		name         string
+		container    string
+		policy       executor.Strategy // The rule's strategy
+		overrides    ExecutionOverrides
+		wantStrategy executor.Strategy
+		wantNetwork  string
+		wantErr      bool
+	}{
+		{"network pins a ghost", container, executor.StrategyMirror, ExecutionOverrides{Network: "none"}, executor.StrategyGhost, "none", false},
+		{"strategy", container, executor.StrategyGhost, ExecutionOverrides{Strategy: executor.StrategyMirror}, executor.StrategyMirror, "", false},
+		{"timeout keeps the strategy", container, executor.StrategyGhost, ExecutionOverrides{Timeout: "1m"}, executor.StrategyGhost, "", false},
+		{"ghost unavailable for host requests", "", executor.StrategyMirror, ExecutionOverrides{Strategy: executor.StrategyGhost}, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t)
+			docker := &routingDocker{}
+			srv.dockerExec = executor.NewDockerExecutor(docker, srv.logger)
+			srv.localExec = executor.NewLocalExecutor(srv.logger)
+
+			req := &protocol.Request{Command: "pip", Args: []string{"install", "x"}, Cwd: t.TempDir(), ContainerID: tt.container}
+			result := EvaluationResult{Action: ActionAsk, Strategy: tt.policy}
+			err := srv.applyOverrides(req, &result, tt.overrides)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyOverrides error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if _, strategy := srv.executorFor(req, result.Strategy, false); strategy != tt.wantStrategy {
+				t.Errorf("strategy = %q, want %q", strategy, tt.wantStrategy)
+			}
+			if req.Network != tt.wantNetwork {
+				t.Errorf("network = %q, want %q", req.Network, tt.wantNetwork)
+			}
+			if tt.overrides.Timeout != "" && result.ExecTimeout != time.Minute {
+				t.Errorf("exec timeout = %v, want 1m", result.ExecTimeout)
+			}
+		})
+	}
+}
+
+// approveWith sends req, approves it with overrides once it is queued and
+// returns everything the shim received after the pending ack.
+func approveWith(t *testing.T, srv *Server, req *protocol.Request, overrides *ExecutionOverrides) string {
+	t.Helper()
+	client, server := net.Pipe()
+	defer client.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.handleConnection(server)
+	}()
+	if err := protocol.WriteRequest(client, req); err != nil {
+		t.Fatalf("write request: %v", err)
+	}
+	if ack, err := protocol.ReadAck(client); err != nil || ack != protocol.AckPendingHITL {
+		t.Fatalf("ack = %d, %v; want pending", ack, err)
+	}
+	for len(srv.hitl.List()) == 0 {
+		time.Sleep(time.Millisecond) // The ack goes out before the request is queued
+	}
+	srv.hitl.Review(srv.hitl.List()[0].ID, Review{Decision: DecisionApprove, Overrides: overrides})
+	rest, _ := io.ReadAll(client)
+	<-done
+	return string(rest)
+}
+
+func TestReviewerOverridesApplied(t *testing.T) {
+	rules := []Rule{{Command: "sleep", Action: ActionAsk, ExecTimeout: time.Minute}}
+
+	srv, audited := newMaintenanceTestServer(t, rules)
+	out := approveWith(t, srv, &protocol.Request{Command: "sleep", Args: []string{"10"}, Cwd: "/"}, &ExecutionOverrides{Timeout: "100ms"})
+	if !strings.Contains(out, "approved with reviewer overrides: timeout=100ms") {
+		t.Errorf("shim output %q lacks the overrides notice", out)
+	}
+	entry := audited()[0]
+	if entry.Overrides == nil || entry.Overrides.Timeout != "100ms" || entry.TimeoutLimit != TimeoutLimitExec {
+		t.Errorf("audit entry: overrides %+v, timeout limit %q; want the reviewer's timeout to fire", entry.Overrides, entry.TimeoutLimit)
+	}
+
+	// Requests from the host cannot be pinned into a ghost
+	srv, audited = newMaintenanceTestServer(t, rules)
+	approveWith(t, srv, &protocol.Request{Command: "sleep", Args: []string{"10"}, Cwd: "/"}, &ExecutionOverrides{Strategy: executor.StrategyGhost})
+	if entry := audited()[0]; entry.Decision != protocol.DecisionDeny || entry.Outcome != protocol.OutcomeOverrideUnavailable || entry.Overrides == nil {
+		t.Errorf("audit entry: decision %q, overrides %+v; want the pinned strategy refused", entry.DecisionLabel(), entry.Overrides)
+	}
+}
+
+func TestApproveAPIValidatesOverrides(t *testing.T) {
+	api, _ := newTestAPIServer(t, Config{})
+	api.warden.setPolicy(&PolicyEngine{config: PolicyConfig{ReviewerOverrides: []string{OverrideStrategy}}})
+	queue := api.warden.GetHITLQueue()
+	outcome := make(chan Outcome, 1)
+	go func() {
+		outcome <- queue.EnqueueOutcome(t.Context(), &protocol.Request{Command: "pip"}, nil)
+	}()
+	for len(queue.List()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	id := queue.List()[0].ID
+
+	post := func(body string) int {
+		rec := httptest.NewRecorder()
+		api.handleQueueAction(rec, httptest.NewRequest(http.MethodPost, "/api/queue/"+id+"/approve", strings.NewReader(body)))
+		return rec.Code
+	}
+	if code := post(`{"execution_overrides": {"network": "none"}}`); code != http.StatusBadRequest {
+		t.Errorf("non-overridable knob: HTTP %d, want 400", code)
+	}
+	if !queue.IsPending(id) {
+		t.Fatal("a rejected approval resolved the request")
+	}
+	if code := post(`{"execution_overrides": {"strategy": "ghost"}}`); code != http.StatusOK {
+		t.Errorf("overridable knob: HTTP %d, want 200", code)
+	}
+	if o := <-outcome; o.Decision != DecisionApprove || o.Overrides == nil || o.Overrides.Strategy != executor.StrategyGhost {
+		t.Errorf("outcome = %+v, want approval with strategy ghost", o)
+	}
+}
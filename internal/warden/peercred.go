@@ -1,9 +1,7 @@
 package warden
 
 import (
-	"fmt"
 	"net"
-	"syscall"
 )
 
 // PeerCredentials holds the kernel-enforced identity of a Unix socket peer.
@@ -15,35 +13,41 @@ type PeerCredentials struct {
 	ContainerID string // resolved via cgroup (empty if host process)
 }
 
-// extractPeerCreds retrieves the peer credentials from a Unix domain socket connection.
-// Uses SO_PEERCRED which is kernel-enforced and cannot be spoofed.
-func extractPeerCreds(conn net.Conn) (*PeerCredentials, error) {
-	unixConn, ok := conn.(*net.UnixConn)
-	if !ok {
-		return nil, fmt.Errorf("connection is not a Unix socket")
-	}
+// peerResolver finds out who is on the other end of a shim connection: the
+// peer process's credentials, then its supplementary groups and container.
+// kernelPeers implements it; tests use fakes.
+type peerResolver interface {
+	Credentials(conn net.Conn) (*PeerCredentials, error)
+	Groups(pid int32) ([]int, error)
+	ContainerID(pid int32) (string, error)
+}
 
-	raw, err := unixConn.SyscallConn()
-	if err != nil {
-		return nil, fmt.Errorf("get raw connection: %w", err)
-	}
+// kernelPeers asks the kernel: SO_PEERCRED for the credentials, /proc for
+// the groups and container.
+type kernelPeers struct{}
 
-	var cred *syscall.Ucred
-	var credErr error
+func (kernelPeers) Credentials(conn net.Conn) (*PeerCredentials, error) {
+	return extractPeerCreds(conn)
+}
 
-	err = raw.Control(func(fd uintptr) {
-		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
-	})
-	if err != nil {
-		return nil, fmt.Errorf("raw control: %w", err)
-	}
-	if credErr != nil {
-		return nil, fmt.Errorf("getsockopt SO_PEERCRED: %w", credErr)
-	}
+func (kernelPeers) Groups(pid int32) ([]int, error) {
+	return resolveProcGroups(pid)
+}
+
+func (kernelPeers) ContainerID(pid int32) (string, error) {
+	return resolveContainerID(pid)
+}
 
-	return &PeerCredentials{
-		PID: cred.Pid,
-		UID: cred.Uid,
-		GID: cred.Gid,
-	}, nil
+// Where an audit entry's identity and container came from.
+const (
+	IdentityPeerCred     = "peercred"      // The kernel's view of the shim process replaced what the shim reported
+	IdentitySelfReported = "self_reported" // No peer credentials; the request's own word was taken
+)
+
+// identitySource returns the IdentitySource of a request with creds.
+func identitySource(creds *PeerCredentials) string {
+	if creds == nil {
+		return IdentitySelfReported
+	}
+	return IdentityPeerCred
 }
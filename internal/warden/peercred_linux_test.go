@@ -0,0 +1,58 @@
+package warden
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// socketpair returns both ends of a connected Unix socket pair.
+func socketpair(t *testing.T) (*net.UnixConn, *net.UnixConn) {
+	t.Helper()
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatalf("socketpair: %v", err)
+	}
+	conns := make([]*net.UnixConn, 2)
+	for i, fd := range fds {
+		f := os.NewFile(uintptr(fd), "socketpair")
+		c, err := net.FileConn(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("FileConn: %v", err)
+		}
+		t.Cleanup(func() { c.Close() })
+		conns[i] = c.(*net.UnixConn)
+	}
+	return conns[0], conns[1]
+}
+
+func TestExtractPeerCreds(t *testing.T) {
+	a, _ := socketpair(t)
+	creds, err := extractPeerCreds(a)
+	if err != nil {
+		t.Fatalf("extractPeerCreds: %v", err)
+	}
+	// Both ends belong to this process
+	if int(creds.PID) != os.Getpid() || int(creds.UID) != os.Getuid() || int(creds.GID) != os.Getgid() {
+		t.Errorf("creds = %+v, want pid %d, uid %d, gid %d", creds, os.Getpid(), os.Getuid(), os.Getgid())
+	}
+}
+
+func TestExtractPeerCredsNotUnixSocket(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	if creds, err := extractPeerCreds(server); err == nil {
+		t.Errorf("extractPeerCreds on a pipe = %+v, want an error", creds)
+	}
+}
+
+func TestExtractPeerCredsClosed(t *testing.T) {
+	a, _ := socketpair(t)
+	a.Close()
+	if creds, err := extractPeerCreds(a); err == nil {
+		t.Errorf("extractPeerCreds on a closed socket = %+v, want an error", creds)
+	}
+}
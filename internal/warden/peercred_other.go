@@ -0,0 +1,15 @@
+//go:build !linux
+
+package warden
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// extractPeerCreds fails outside Linux, which alone has SO_PEERCRED; the
+// warden then takes each request's identity as reported, as in dev mode.
+func extractPeerCreds(conn net.Conn) (*PeerCredentials, error) {
+	return nil, fmt.Errorf("peer credentials: %w", errors.ErrUnsupported)
+}
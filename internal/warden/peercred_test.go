@@ -1,6 +1,12 @@
 package warden
 
 import (
+	"clawrden/pkg/protocol"
+	"errors"
+	"log"
+	"net"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -86,3 +92,115 @@ func TestTruncateID(t *testing.T) {
 		}
 	}
 }
+
+// fakePeers is a peerResolver with fixed answers.
+type fakePeers struct {
+	creds        *PeerCredentials
+	credsErr     error
+	groups       []int
+	containerID  string
+	containerErr error
+}
+
+func (f *fakePeers) Credentials(net.Conn) (*PeerCredentials, error) {
+	return f.creds, f.credsErr
+}
+
+func (f *fakePeers) Groups(int32) ([]int, error) {
+	return f.groups, nil
+}
+
+func (f *fakePeers) ContainerID(int32) (string, error) {
+	return f.containerID, f.containerErr
+}
+
+func TestPeerCredsInAuditEntry(t *testing.T) {
+	const peerContainer = "deadbeef0123456789abcdef0123456789abcdef0123456789abcdef01234567"
+	peer := &PeerCredentials{PID: 4242, UID: 1234, GID: 5678}
+	reported := protocol.Identity{UID: 0, GID: 0, Groups: []int{0}}
+
+	tests := []struct {
+		name          string
+		peers         *fakePeers
+		wantIdentity  protocol.Identity
+		wantContainer string
+		wantSource    string
+		wantLog       string
+	}{
+		{
+			name:          "creds override the reported identity and set the container",
+			peers:         &fakePeers{creds: peer, groups: []int{27}, containerID: peerContainer},
+			wantIdentity:  protocol.Identity{UID: 1234, GID: 5678, Groups: []int{27}},
+			wantContainer: peerContainer,
+			wantSource:    IdentityPeerCred,
+		},
+		{
+			name:         "no creds: the reported identity is taken, without its groups",
+			peers:        &fakePeers{credsErr: errors.New("connection is not a Unix socket")},
+			wantIdentity: protocol.Identity{UID: 0, GID: 0},
+			wantSource:   IdentitySelfReported,
+			wantLog:      "could not extract peer credentials: connection is not a Unix socket",
+		},
+		{
+			name:         "creds but no container: the identity is still overridden, on the host",
+			peers:        &fakePeers{creds: peer, containerErr: errors.New("read cgroup for pid 4242: no such file")},
+			wantIdentity: protocol.Identity{UID: 1234, GID: 5678},
+			wantSource:   IdentityPeerCred,
+			wantLog:      "could not resolve container ID for pid 4242",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, audited := newMaintenanceTestServer(t, nil) // Denies everything, so nothing runs
+			// Requests go on logging after the handler returns
+			var logs consoleOutput
+			srv.logger = log.New(&logs, "", 0)
+			srv.peers = tt.peers
+
+			ack, _ := sendRequest(t, srv, &protocol.Request{
+				Command:  "whoami",
+				Cwd:      t.TempDir(),
+				Identity: reported,
+			})
+			if ack != protocol.AckDenied {
+				t.Fatalf("ack = %d, want denied", ack)
+			}
+
+			entries := audited()
+			if len(entries) != 1 {
+				t.Fatalf("got %d audit entries, want 1", len(entries))
+			}
+			e := entries[0]
+			if !reflect.DeepEqual(e.Identity, tt.wantIdentity) {
+				t.Errorf("identity = %+v, want %+v", e.Identity, tt.wantIdentity)
+			}
+			if e.ContainerID != tt.wantContainer {
+				t.Errorf("container = %q, want %q", e.ContainerID, tt.wantContainer)
+			}
+			if e.IdentitySource != tt.wantSource {
+				t.Errorf("identity_source = %q, want %q", e.IdentitySource, tt.wantSource)
+			}
+			if !strings.Contains(logs.String(), tt.wantLog) {
+				t.Errorf("log lacks %q:\n%s", tt.wantLog, logs.String())
+			}
+		})
+	}
+}
+
+func TestReportedGroupsIgnoredWithoutPeerCreds(t *testing.T) {
+	// Group 27 is granted what everyone else is denied
+	srv, audited := newMaintenanceTestServer(t, []Rule{{Command: "whoami", Groups: []string{"27"}, Action: ActionAllow}})
+	srv.peers = &fakePeers{credsErr: errors.New("connection is not a Unix socket")}
+
+	ack, _ := sendRequest(t, srv, &protocol.Request{
+		Command:  "whoami",
+		Cwd:      t.TempDir(),
+		Identity: protocol.Identity{UID: 1000, GID: 1000, Groups: []int{27}},
+	})
+	if ack != protocol.AckDenied {
+		t.Errorf("ack = %d, want denied: the claimed group matched", ack)
+	}
+	if entries := audited(); len(entries) != 1 || len(entries[0].Identity.Groups) != 0 {
+		t.Errorf("audit entries = %+v, want one without the claimed groups", entries)
+	}
+}
@@ -1,9 +1,11 @@
 package warden
 
 import (
+	"clawrden/internal/executor"
 	"clawrden/pkg/protocol"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
@@ -24,33 +26,201 @@ func (a Action) String() string {
 	return string(a)
 }
 
+// Decision is the audit decision for the action.
+func (a Action) Decision() protocol.Decision {
+	switch a {
+	case ActionAllow:
+		return protocol.DecisionAllow
+	case ActionAsk:
+		return protocol.DecisionAsk
+	}
+	return protocol.DecisionDeny
+}
+
 // Rule defines a single policy rule.
 type Rule struct {
-	Command string        `yaml:"command"`
-	Action  Action        `yaml:"action"`
-	Args    []string      `yaml:"args,omitempty"`    // Optional: specific arg patterns
-	Reason  string        `yaml:"reason,omitempty"`  // Optional: human-readable reason
-	Timeout time.Duration `yaml:"timeout,omitempty"` // Optional: per-command timeout (e.g., "300s", "5m")
+	Command string   `yaml:"command"`
+	Action  Action   `yaml:"action"`
+	Args    []string `yaml:"args,omitempty"`   // Optional: specific arg patterns
+	Reason  string   `yaml:"reason,omitempty"` // Optional: human-readable reason
+	Groups  []string `yaml:"groups,omitempty"` // Optional: only applies to members of these groups (names or GIDs)
+
+	// Optional: only applies to requests from containers running these
+	// images (globs, e.g. "ghcr.io/acme/agent:*") or image IDs ("sha256:...")
+	Image       []string `yaml:"image,omitempty"`
+	ImageDigest []string `yaml:"image_digest,omitempty"`
+
+	// Optional time limits (e.g., "300s", "5m"); 0 uses the policy default
+	ExecTimeout  time.Duration `yaml:"exec_timeout,omitempty"`  // How long the command may run
+	Timeout      time.Duration `yaml:"timeout,omitempty"`       // Older name for exec_timeout
+	HITLTimeout  time.Duration `yaml:"hitl_timeout,omitempty"`  // How long an ask waits for a reviewer
+	TotalTimeout time.Duration `yaml:"total_timeout,omitempty"` // How long the request may live, review and run together
+
+	// Optional: run in a scratch directory instead of the real cwd
+	SandboxCwd  bool     `yaml:"sandbox_cwd,omitempty"`
+	CopyIn      []string `yaml:"copy_in,omitempty"`       // Globs seeded into the sandbox from cwd
+	CopyOut     []string `yaml:"copy_out,omitempty"`      // Globs copied back into cwd after execution
+	CopyOutAuto bool     `yaml:"copy_out_auto,omitempty"` // Copy out without asking a reviewer first
+
+	// Optional: restrict the hosts of URLs found in the arguments
+	URLAllow           []string `yaml:"url_allow,omitempty"`            // Host patterns URLs may point at
+	URLDeny            []string `yaml:"url_deny,omitempty"`             // Host patterns URLs may never point at
+	URLViolationAction Action   `yaml:"url_violation_action,omitempty"` // ask or deny (default: deny)
+
+	// Optional: save a transcript of every conversation with the shim
+	Transcript bool `yaml:"transcript,omitempty"`
+
+	// Optional: bytes of stdout the shim prints before saving the rest to a
+	// file, tightening the agent's CLAWRDEN_MAX_STDOUT_BYTES, and bytes of
+	// the end of cut output to print after the truncation notice
+	MaxStdoutBytes int64 `yaml:"max_stdout_bytes,omitempty"`
+	TailOnTruncate int64 `yaml:"tail_on_truncate,omitempty"`
+
+	// Optional: have the shim print a machine-readable trailer line on
+	// stderr after the command, as the agent's CLAWRDEN_TRAILER=1 does
+	Trailer bool `yaml:"trailer,omitempty"`
+
+	// Optional: lower the command's CPU and IO priority on a shared host:
+	// nice from 0 to 19, ionice_class best-effort or idle, and ionice_level
+	// from 0 to 7 within best-effort (default 4). Ghost containers get the
+	// closest equivalents, CPU shares and blkio weight.
+	Nice        int    `yaml:"nice,omitempty"`
+	IONiceClass string `yaml:"ionice_class,omitempty"`
+	IONiceLevel *int   `yaml:"ionice_level,omitempty"`
+
+	// Optional: risk tier of an ask: low, medium or high (default: risk.default)
+	Risk RiskTier `yaml:"risk,omitempty"`
+
+	// Optional: where containerized requests run: mirror, ghost, local or
+	// auto (default: ghost.commands, then ghost.defaults, then auto)
+	Strategy executor.Strategy `yaml:"strategy,omitempty"`
+
+	// Optional: false keeps CLAWRDEN, CLAWRDEN_REQUEST_ID and
+	// CLAWRDEN_STRATEGY out of the command's environment, for tools that
+	// choke on unknown variables (default: true)
+	MarkEnvironment *bool `yaml:"mark_environment,omitempty"`
+
+	// Optional: commands run by the same executor before and after the
+	// command; a failing pre hook keeps it from running (see Hook)
+	Pre  []Hook `yaml:"pre,omitempty"`
+	Post []Hook `yaml:"post,omitempty"`
+
+	// Optional: run the command again when it fails transiently before
+	// sending output, e.g. {attempts: 2, backoff: 2s} (see RetryPolicy)
+	Retry *RetryPolicy `yaml:"retry,omitempty"`
+}
+
+// hasURLRules reports whether the rule restricts URL hosts.
+func (r Rule) hasURLRules() bool {
+	return len(r.URLAllow) > 0 || len(r.URLDeny) > 0
+}
+
+// SandboxPolicy describes how a sandboxed command's scratch directory is seeded and harvested.
+type SandboxPolicy struct {
+	CopyIn      []string
+	CopyOut     []string
+	CopyOutAuto bool
 }
 
 // JailConfig defines a jail's intercepted commands and hardening mode.
 type JailConfig struct {
 	Commands []string `yaml:"commands"`
 	Hardened bool     `yaml:"hardened"`
+
+	// Rules for requests from this jail, evaluated before the global rules
+	Rules []Rule `yaml:"rules,omitempty"`
 }
 
 // PolicyConfig is the top-level policy configuration.
 type PolicyConfig struct {
 	DefaultAction  Action                `yaml:"default_action"`
-	DefaultTimeout time.Duration         `yaml:"default_timeout,omitempty"` // Default timeout for all commands
+	DefaultTimeout time.Duration         `yaml:"default_timeout,omitempty"` // Default exec_timeout for all commands
 	AllowedPaths   []string              `yaml:"allowed_paths,omitempty"`
 	Jails          map[string]JailConfig `yaml:"jails,omitempty"`
 	Rules          []Rule                `yaml:"rules"`
+
+	// Defaults for the rules' hitl_timeout and total_timeout; 0 means no limit
+	DefaultHITLTimeout  time.Duration `yaml:"default_hitl_timeout,omitempty"`
+	DefaultTotalTimeout time.Duration `yaml:"default_total_timeout,omitempty"`
+
+	// Shells whose "-c" scripts are split and evaluated command by command
+	// (e.g. [sh, bash, zsh]). Empty disables shell-aware evaluation.
+	ShellCommands []string `yaml:"shell_commands,omitempty"`
+
+	// When repeated denials become an incident
+	Incidents IncidentPolicy `yaml:"incidents,omitempty"`
+
+	// How asks waiting for a reviewer are brought back to attention
+	HITL HITLPolicy `yaml:"hitl,omitempty"`
+
+	// How commands learn about their timeout
+	TimeoutNotices TimeoutNotices `yaml:"timeout_notices,omitempty"`
+
+	// Restrictions on ghost containers
+	Ghost GhostPolicy `yaml:"ghost,omitempty"`
+
+	// Save a transcript of any request whose execution fails
+	TranscriptOnError bool `yaml:"transcript_on_error,omitempty"`
+
+	// What to do with a command whose shim stops reading its output:
+	// kill it, or let it finish and spool the rest (default: kill)
+	OnShimStall StallAction `yaml:"on_shim_stall,omitempty"`
+
+	// What lint findings do: warn logs them, error refuses the policy (default: warn)
+	Lint LintSeverity `yaml:"lint,omitempty"`
+
+	// Defaults of the asks' risk tiers
+	Risk RiskPolicy `yaml:"risk,omitempty"`
+
+	// Commands whose asks reviewers see impact context for, like how much
+	// rm would delete (see Annotation)
+	Annotate AnnotatePolicy `yaml:"annotate,omitempty"`
+
+	// What reviewers may change when approving: strategy, network, timeout
+	ReviewerOverrides []string `yaml:"reviewer_overrides,omitempty"`
+
+	// Example invocations with their expected actions; a policy failing
+	// any of them is refused
+	Tests []PolicyTest `yaml:"tests,omitempty"`
+}
+
+// TimeoutNotices makes a command's timeout visible to the agent. Each notice
+// is off unless enabled and only applies to commands with a timeout.
+type TimeoutNotices struct {
+	Announce bool `yaml:"announce,omitempty"` // Send the limit to the shim, which prints it
+	Env      bool `yaml:"env,omitempty"`      // Set CLAWRDEN_TIMEOUT_SECONDS in the command's environment
+	Warn     bool `yaml:"warn,omitempty"`     // Write a stderr warning when 80% of the limit has elapsed
+}
+
+// HITLPolicy configures the queue of asks waiting for a reviewer.
+type HITLPolicy struct {
+	// Bridges post a reminder for a request still pending after each
+	// interval this long (0 = never)
+	RenotifyAfter time.Duration `yaml:"renotify_after,omitempty"`
+}
+
+// minRenotifyAfter keeps reminders from flooding the chat.
+const minRenotifyAfter = time.Minute
+
+// validate checks the queue settings.
+func (p HITLPolicy) validate() error {
+	if p.RenotifyAfter != 0 && p.RenotifyAfter < minRenotifyAfter {
+		return fmt.Errorf("hitl.renotify_after must be at least %v, got %v", minRenotifyAfter, p.RenotifyAfter)
+	}
+	return nil
+}
+
+// RenotifyAfter returns how often reviewers are reminded of a pending ask;
+// 0 means never.
+func (pe *PolicyEngine) RenotifyAfter() time.Duration {
+	return pe.config.HITL.RenotifyAfter
 }
 
 // PolicyEngine evaluates commands against a set of rules.
 type PolicyEngine struct {
 	config PolicyConfig
+	lint   []LintFinding
+	hash   string // SHA-256 of the policy file, hex; empty for built-in policies
 }
 
 // LoadPolicy loads a policy from a YAML file.
@@ -59,7 +229,12 @@ func LoadPolicy(path string) (*PolicyEngine, error) {
 	if err != nil {
 		return nil, fmt.Errorf("read policy file: %w", err)
 	}
+	return ParsePolicy(data)
+}
 
+// ParsePolicy builds a policy from the contents of a policy file, with the
+// same checks LoadPolicy makes.
+func ParsePolicy(data []byte) (*PolicyEngine, error) {
 	var config PolicyConfig
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("parse policy file: %w", err)
@@ -80,7 +255,106 @@ func LoadPolicy(path string) (*PolicyEngine, error) {
 		config.AllowedPaths = []string{"/app/*", "/tmp/*"}
 	}
 
-	return &PolicyEngine{config: config}, nil
+	if err := ValidateRules(config.Rules); err != nil {
+		return nil, err
+	}
+	for jailID, jail := range config.Jails {
+		if err := ValidateRules(jail.Rules); err != nil {
+			return nil, fmt.Errorf("jail %s: %w", jailID, err)
+		}
+	}
+	if err := config.Ghost.validate(); err != nil {
+		return nil, err
+	}
+	if err := config.HITL.validate(); err != nil {
+		return nil, err
+	}
+	if err := config.Lint.validate(); err != nil {
+		return nil, err
+	}
+	if err := config.OnShimStall.validate(); err != nil {
+		return nil, err
+	}
+	if err := config.Risk.validate(); err != nil {
+		return nil, err
+	}
+	if err := config.Annotate.validate(); err != nil {
+		return nil, err
+	}
+	if err := validateOverrideKnobs(config.ReviewerOverrides); err != nil {
+		return nil, err
+	}
+	if err := validateTests(config.Tests); err != nil {
+		return nil, err
+	}
+
+	findings := LintPolicy(config)
+	if config.Lint == LintError && len(findings) > 0 {
+		return nil, &PolicyLintError{Findings: findings}
+	}
+
+	pe := &PolicyEngine{config: config, lint: findings, hash: policyHash(data)}
+	if failures := pe.RunTests(); len(failures) > 0 {
+		return nil, &PolicyTestError{Total: len(config.Tests), Failures: failures}
+	}
+	return pe, nil
+}
+
+// Hash returns the SHA-256 of the policy file the engine was loaded from,
+// in hex, so audit entries can name the policy that decided them. It is
+// empty for built-in policies.
+func (pe *PolicyEngine) Hash() string {
+	if pe == nil {
+		return ""
+	}
+	return pe.hash
+}
+
+// LintFindings returns the lint findings of the loaded policy.
+func (pe *PolicyEngine) LintFindings() []LintFinding {
+	return pe.lint
+}
+
+// ValidateRules checks rule settings that cannot be applied.
+func ValidateRules(rules []Rule) error {
+	for i, rule := range rules {
+		switch rule.URLViolationAction {
+		case "", ActionAsk, ActionDeny:
+		default:
+			return fmt.Errorf("rule %d (%s): url_violation_action must be ask or deny, got %q",
+				i+1, rule.Command, rule.URLViolationAction)
+		}
+		if err := rule.Risk.validate(); err != nil {
+			return fmt.Errorf("rule %d (%s): %w", i+1, rule.Command, err)
+		}
+		if rule.MaxStdoutBytes < 0 || rule.TailOnTruncate < 0 {
+			return fmt.Errorf("rule %d (%s): max_stdout_bytes and tail_on_truncate must not be negative", i+1, rule.Command)
+		}
+		if !rule.Strategy.Valid() {
+			return fmt.Errorf("rule %d (%s): strategy must be mirror, ghost, local or auto, got %q",
+				i+1, rule.Command, rule.Strategy)
+		}
+		for _, pattern := range rule.Image {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("rule %d (%s): invalid image pattern %q", i+1, rule.Command, pattern)
+			}
+		}
+		for _, digest := range rule.ImageDigest {
+			if !strings.HasPrefix(digest, "sha256:") {
+				return fmt.Errorf("rule %d (%s): image_digest must be an image ID like sha256:..., got %q", i+1, rule.Command, digest)
+			}
+		}
+		if err := validateHooks(rule.Pre, rule.Post); err != nil {
+			return fmt.Errorf("rule %d (%s): %w", i+1, rule.Command, err)
+		}
+		if err := rule.Retry.validate(); err != nil {
+			return fmt.Errorf("rule %d (%s): %w", i+1, rule.Command, err)
+		}
+		if err := rule.validatePriority(); err != nil {
+			return fmt.Errorf("rule %d (%s): %w", i+1, rule.Command, err)
+		}
+	}
+	return nil
 }
 
 // DefaultPolicy returns a restrictive default policy.
@@ -109,48 +383,211 @@ func DefaultPolicy() *PolicyEngine {
 // EvaluationResult contains both the action and timeout for a request.
 type EvaluationResult struct {
 	Action  Action
-	Timeout time.Duration
+	Sandbox *SandboxPolicy // nil unless the matched rule sets sandbox_cwd
+
+	// Time limits; 0 means none
+	ExecTimeout  time.Duration // From the start of execution
+	HITLTimeout  time.Duration // From the start of review
+	TotalTimeout time.Duration // From the receipt of the request
+
+	URLHosts     []string // Hosts of URL arguments, when the matched rule restricts them
+	URLViolation string   // Why the URL hosts downgraded the rule's action, if they did
+
+	Subcommands []SubcommandDecision // Per-command decisions for a split shell script
+
+	// RuleMatched is set when a rule, not default_action, decided the
+	// action. For shell scripts it is set when a rule denied a command.
+	RuleMatched bool
+
+	Transcript bool // The matched rule asks for a transcript
+
+	// Output limits the shim is told to enforce; 0 means not set
+	MaxStdoutBytes int64
+	TailOnTruncate int64
+
+	Trailer bool // The matched rule asks the shim for its trailer line
+
+	Priority *protocol.Priority // nil unless the matched rule sets nice or ionice_class
+
+	// Risk tier of an ask, and how long a low-risk ask waits for an
+	// objection before it is approved automatically (0 means never)
+	Risk             RiskTier
+	AutoApproveAfter time.Duration
+
+	// Where a containerized request runs; empty means auto
+	Strategy executor.Strategy
+
+	UnmarkedEnv bool // The matched rule sets mark_environment: false
+
+	// The rule that decided the action, e.g. "rule 3 (pip)" or "jail ci
+	// rule 1 (npm)"; empty when default_action did
+	MatchedRule string
+	Reason      string // The deciding rule's reason, if it gives one
+
+	// Hooks of the matched rule, or of the commands of a shell script
+	Pre  []Hook
+	Post []Hook
+
+	Retry *RetryPolicy // The matched rule's retries of transient failures; nil for shell scripts
+
+	rule int // 1-based index of the deciding rule among the evaluated rules
 }
 
 // Evaluate checks a request against the policy rules and returns the appropriate action and timeout.
+// Rules of the request's jail, if the policy defines it, come before the global rules.
 func (pe *PolicyEngine) Evaluate(req *protocol.Request) EvaluationResult {
+	return pe.EvaluateInJail(req, pe.config.Jails[req.JailID].Rules)
+}
+
+// EvaluateInJail is Evaluate with jailRules, the rules of the request's
+// jail, evaluated before the global rules.
+func (pe *PolicyEngine) EvaluateInJail(req *protocol.Request, jailRules []Rule) EvaluationResult {
+	rules := pe.config.Rules
+	if len(jailRules) > 0 {
+		rules = append(append([]Rule(nil), jailRules...), pe.config.Rules...)
+	}
+	result := pe.evaluate(req, rules, 0)
+	if result.Action == ActionAsk {
+		result.Risk = pe.riskTier(result.Risk)
+		result.AutoApproveAfter = pe.autoApproveAfter(result.Risk)
+	} else {
+		result.Risk = ""
+	}
+	switch {
+	case result.rule == 0:
+	case result.rule <= len(jailRules):
+		r := jailRules[result.rule-1]
+		result.MatchedRule = fmt.Sprintf("jail %s rule %d (%s)", req.JailID, result.rule, r.Command)
+	default:
+		n := result.rule - len(jailRules)
+		result.MatchedRule = fmt.Sprintf("rule %d (%s)", n, pe.config.Rules[n-1].Command)
+	}
+	if result.Strategy == "" {
+		result.Strategy = pe.ghostStrategy(filepath.Base(req.Command))
+	}
+	return result
+}
+
+// evaluate checks req against rules, first match wins. depth is the nesting
+// depth of shell scripts being split.
+func (pe *PolicyEngine) evaluate(req *protocol.Request, rules []Rule, depth int) EvaluationResult {
 	command := filepath.Base(req.Command)
 
-	for _, rule := range pe.config.Rules {
+	if result, ok := pe.evaluateShell(req, rules, depth); ok {
+		return result
+	}
+
+	for i, rule := range rules {
 		if !matchCommand(rule.Command, command) {
 			continue
 		}
 
-		// If no specific args patterns are defined, match on command alone
-		if len(rule.Args) == 0 {
-			timeout := rule.Timeout
-			if timeout == 0 {
-				timeout = pe.config.DefaultTimeout
-			}
-			return EvaluationResult{
-				Action:  rule.Action,
-				Timeout: timeout,
-			}
+		// Group-scoped rules only apply to members of the listed groups
+		if len(rule.Groups) > 0 && !matchGroups(rule.Groups, req.Identity) {
+			continue
 		}
 
-		// Check if the request args match the rule's arg patterns
-		if matchArgs(rule.Args, req.Args) {
-			timeout := rule.Timeout
-			if timeout == 0 {
-				timeout = pe.config.DefaultTimeout
-			}
-			return EvaluationResult{
-				Action:  rule.Action,
-				Timeout: timeout,
+		// Image-scoped rules only apply to requests from matching containers
+		if !rule.matchImage(req) {
+			continue
+		}
+
+		// If no specific args patterns are defined, match on command alone;
+		// otherwise check if the request args match the rule's arg patterns
+		if len(rule.Args) == 0 || matchArgs(rule.Args, req.Args) {
+			result := pe.resultForRule(rule)
+			result.rule = i + 1
+			if rule.hasURLRules() {
+				applyURLRules(rule, req.Args, &result)
 			}
+			return result
 		}
 	}
 
-	// No matching rule found — use default action and timeout
+	// No matching rule found — use default action and timeouts
 	return EvaluationResult{
-		Action:  pe.config.DefaultAction,
-		Timeout: pe.config.DefaultTimeout,
+		Action:       pe.config.DefaultAction,
+		ExecTimeout:  pe.config.DefaultTimeout,
+		HITLTimeout:  firstNonZero(pe.config.Risk.tier(pe.riskTier("")).HITLTimeout, pe.config.DefaultHITLTimeout),
+		TotalTimeout: pe.config.DefaultTotalTimeout,
+	}
+}
+
+// resultForRule builds the evaluation result for a matched rule, applying defaults.
+func (pe *PolicyEngine) resultForRule(rule Rule) EvaluationResult {
+	result := EvaluationResult{
+		Action:       rule.Action,
+		ExecTimeout:  firstNonZero(rule.ExecTimeout, rule.Timeout, pe.config.DefaultTimeout),
+		HITLTimeout:  firstNonZero(rule.HITLTimeout, pe.config.Risk.tier(pe.riskTier(rule.Risk)).HITLTimeout, pe.config.DefaultHITLTimeout),
+		TotalTimeout: firstNonZero(rule.TotalTimeout, pe.config.DefaultTotalTimeout),
+		RuleMatched:  true,
+		Reason:       rule.Reason,
+		Transcript:   rule.Transcript,
+		Strategy:     rule.Strategy,
+		Risk:         rule.Risk,
+		UnmarkedEnv:  rule.MarkEnvironment != nil && !*rule.MarkEnvironment,
+
+		MaxStdoutBytes: rule.MaxStdoutBytes,
+		TailOnTruncate: rule.TailOnTruncate,
+		Trailer:        rule.Trailer,
+		Priority:       rule.priority(),
+
+		Pre:  rule.Pre,
+		Post: rule.Post,
+
+		Retry: rule.Retry,
+	}
+	if rule.SandboxCwd {
+		result.Sandbox = &SandboxPolicy{
+			CopyIn:      rule.CopyIn,
+			CopyOut:     rule.CopyOut,
+			CopyOutAuto: rule.CopyOutAuto,
+		}
+	}
+	return result
+}
+
+// firstNonZero returns the first of limits that is set, or 0.
+func firstNonZero(limits ...time.Duration) time.Duration {
+	for _, d := range limits {
+		if d != 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// applyURLRules checks the hosts of URL arguments against the rule's
+// url_allow/url_deny lists. A host that is denied, or not allowlisted when an
+// allowlist is set, turns the result into the rule's url_violation_action
+// unless the rule's own action is already stricter.
+func applyURLRules(rule Rule, args []string, result *EvaluationResult) {
+	result.URLHosts = ExtractURLHosts(args)
+	result.URLViolation = urlViolation(rule, result.URLHosts)
+	if result.URLViolation == "" {
+		return
+	}
+
+	violation := rule.URLViolationAction
+	if violation == "" {
+		violation = ActionDeny
+	}
+	if result.Action == ActionAllow || violation == ActionDeny {
+		result.Action = violation
+	}
+}
+
+// urlViolation describes the first host the rule does not permit, or "".
+func urlViolation(rule Rule, hosts []string) string {
+	for _, host := range hosts {
+		if MatchURLHost(rule.URLDeny, host) {
+			return fmt.Sprintf("URL host %s is denied", host)
+		}
+		if len(rule.URLAllow) > 0 && !MatchURLHost(rule.URLAllow, host) {
+			return fmt.Sprintf("URL host %s is not allowlisted", host)
+		}
 	}
+	return ""
 }
 
 // matchCommand checks if a command matches a rule pattern.
@@ -234,3 +671,26 @@ func (pe *PolicyEngine) HasRule(command string) bool {
 func (pe *PolicyEngine) GetJails() map[string]JailConfig {
 	return pe.config.Jails
 }
+
+// TimeoutNotices returns which timeout notices the policy enables.
+func (pe *PolicyEngine) TimeoutNotices() TimeoutNotices {
+	return pe.config.TimeoutNotices
+}
+
+// TranscriptOnError reports whether failed executions are transcribed.
+func (pe *PolicyEngine) TranscriptOnError() bool {
+	return pe.config.TranscriptOnError
+}
+
+// OnShimStall returns what to do with a command whose shim stops reading.
+func (pe *PolicyEngine) OnShimStall() StallAction {
+	if pe.config.OnShimStall == "" {
+		return StallKill
+	}
+	return pe.config.OnShimStall
+}
+
+// Incidents returns the policy's incident thresholds.
+func (pe *PolicyEngine) Incidents() IncidentPolicy {
+	return pe.config.Incidents
+}
@@ -0,0 +1,281 @@
+package warden
+
+import (
+	"clawrden/internal/events"
+	"clawrden/pkg/protocol"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// Defaults for the policy canary unless Config.PolicyCanary and
+// Config.PolicyCanaryThreshold say otherwise.
+const (
+	defaultPolicyCanary          = 200
+	defaultPolicyCanaryThreshold = 0.1
+)
+
+// maxCanaryChanges bounds the flipped decisions a canary report lists.
+const maxCanaryChanges = 20
+
+// ErrNoHeldReload means no reloaded policy waits for confirmation.
+var ErrNoHeldReload = errors.New("no policy reload is held")
+
+// PolicyCanaryReport compares what a reloaded policy decides for recently
+// audited requests with what was decided at the time.
+type PolicyCanaryReport struct {
+	PolicyHash   string               `json:"policy_hash"` // Of the reloaded policy
+	Replayed     int                  `json:"replayed"`
+	Allowed      int                  `json:"allowed"` // Replayed requests that were allowed, and denied
+	Denied       int                  `json:"denied"`
+	NewlyDenied  int                  `json:"newly_denied"` // Allowed then, denied by the reloaded policy
+	NewlyAllowed int                  `json:"newly_allowed"`
+	Threshold    float64              `json:"threshold"`
+	Changes      []PolicyCanaryChange `json:"changes,omitempty"` // The first flipped requests
+}
+
+// PolicyCanaryChange is a replayed request the reloaded policy decides the
+// other way.
+type PolicyCanaryChange struct {
+	Seq     uint64            `json:"seq"` // Of the audit entry
+	Command string            `json:"command"`
+	Args    []string          `json:"args"`
+	Was     protocol.Decision `json:"was"`
+	Now     protocol.Decision `json:"now"`
+	Rule    string            `json:"rule,omitempty"` // Rule of the reloaded policy that decided; empty for default_action
+}
+
+// Exceeded reports whether more than the threshold of the allowed requests
+// would now be denied, or of the denied ones allowed.
+func (r *PolicyCanaryReport) Exceeded() bool {
+	return over(r.NewlyDenied, r.Allowed, r.Threshold) || over(r.NewlyAllowed, r.Denied, r.Threshold)
+}
+
+func over(n, of int, threshold float64) bool {
+	return of > 0 && float64(n)/float64(of) > threshold
+}
+
+// Summary describes the flips, e.g. "12 of 40 allowed requests would now be
+// denied, 0 of 3 denied ones allowed".
+func (r *PolicyCanaryReport) Summary() string {
+	return fmt.Sprintf("%d of %d allowed requests would now be denied, %d of %d denied ones allowed",
+		r.NewlyDenied, r.Allowed, r.NewlyAllowed, r.Denied)
+}
+
+// HeldReload is a reloaded policy the canary kept from taking effect.
+type HeldReload struct {
+	Report PolicyCanaryReport `json:"report"`
+	HeldAt time.Time          `json:"held_at"`
+
+	engine *PolicyEngine
+}
+
+// PolicyReloadHeldError is returned by a reload the canary held.
+type PolicyReloadHeldError struct {
+	Report PolicyCanaryReport
+}
+
+func (e *PolicyReloadHeldError) Error() string {
+	return fmt.Sprintf("policy %s held by the canary: %s (confirm with POST /api/policy/confirm-reload)",
+		shortPolicyHash(e.Report.PolicyHash), e.Report.Summary())
+}
+
+// reloadPolicy puts a reloaded policy in force as applyPolicy does, unless
+// the canary holds it.
+func (s *Server) reloadPolicy(engine *PolicyEngine) error {
+	if err := s.checkCanary(engine); err != nil {
+		return err
+	}
+	return s.applyPolicy(engine)
+}
+
+// checkCanary replays recent requests through engine and holds it if too
+// many decisions flip. A confirmed policy, or one reloaded while the
+// canary is disabled or has no audit log to read, passes.
+func (s *Server) checkCanary(engine *PolicyEngine) error {
+	s.canaryMu.Lock()
+	defer s.canaryMu.Unlock()
+	if s.canaryConfirmed == engine {
+		s.canaryConfirmed, s.heldReload = nil, nil
+		return nil
+	}
+	size := s.config.PolicyCanary
+	if size == 0 {
+		size = defaultPolicyCanary
+	}
+	if size < 0 || s.config.AuditPath == "" {
+		return nil
+	}
+
+	report, err := s.runCanary(engine, size)
+	if err != nil {
+		s.logger.Printf("warning: policy canary skipped: %v", err)
+		return nil
+	}
+	if !report.Exceeded() {
+		s.heldReload = nil // Superseded by this reload
+		return nil
+	}
+
+	s.heldReload = &HeldReload{Report: *report, HeldAt: time.Now(), engine: engine}
+	summary := report.Summary()
+	s.logger.Printf("WARNING: policy reload held: %s; confirm with POST /api/policy/confirm-reload", summary)
+	for _, c := range report.Changes {
+		s.logger.Printf("  %s %v: %s, now %s", c.Command, c.Args, c.Was, c.Now)
+	}
+	s.record(AuditEntry{
+		Command:    policyEditCommand,
+		Args:       []string{"reload-held"},
+		Cwd:        filepath.Dir(s.config.PolicyPath),
+		Decision:   protocol.DecisionEvent,
+		Detail:     "policy reload held",
+		PolicyHash: report.PolicyHash,
+		Error:      summary,
+	})
+	s.events.Publish(events.PolicyReloadHeld{
+		Path:         s.config.PolicyPath,
+		PolicyHash:   report.PolicyHash,
+		Summary:      summary,
+		NewlyDenied:  report.NewlyDenied,
+		NewlyAllowed: report.NewlyAllowed,
+	})
+	return &PolicyReloadHeldError{Report: *report}
+}
+
+// runCanary replays the last size audited requests the policy decided (or
+// asked a reviewer about) through engine. Requests decided by the warden's
+// state rather than its policy, like lockdowns and maintenance, are left
+// out, as are hooks.
+func (s *Server) runCanary(engine *PolicyEngine, size int) (*PolicyCanaryReport, error) {
+	recent := make([]AuditEntry, 0, size)
+	next := 0
+	err := ScanAuditLog(s.config.AuditPath, func(e AuditEntry) error {
+		if !canaryReplays(&e) {
+			return nil
+		}
+		if len(recent) < size {
+			recent = append(recent, e)
+		} else {
+			recent[next] = e
+			next = (next + 1) % size
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	recent = append(recent[next:], recent[:next]...)
+
+	threshold := s.config.PolicyCanaryThreshold
+	if threshold == 0 {
+		threshold = defaultPolicyCanaryThreshold
+	}
+	report := &PolicyCanaryReport{PolicyHash: engine.Hash(), Replayed: len(recent), Threshold: threshold}
+	candidate := &policyState{engine: engine, jails: engine.GetJails()}
+	for _, e := range recent {
+		ev := s.evaluatePolicy(candidate, EvaluationRequest{
+			Command:     e.Command,
+			Args:        e.Args,
+			Cwd:         e.Cwd,
+			Identity:    e.Identity,
+			JailID:      e.JailID,
+			Image:       e.Image,
+			ImageDigest: e.ImageDigest,
+		})
+		switch {
+		case e.Decision == protocol.DecisionAllow:
+			report.Allowed++
+			if ev.Decision != protocol.DecisionDeny {
+				continue
+			}
+			report.NewlyDenied++
+		default:
+			report.Denied++
+			if ev.Decision != protocol.DecisionAllow {
+				continue
+			}
+			report.NewlyAllowed++
+		}
+		if len(report.Changes) < maxCanaryChanges {
+			report.Changes = append(report.Changes, PolicyCanaryChange{
+				Seq:     e.Seq,
+				Command: e.Command,
+				Args:    e.Args,
+				Was:     e.Decision,
+				Now:     ev.Decision,
+				Rule:    ev.Rule,
+			})
+		}
+	}
+	return report, nil
+}
+
+// canaryReplays reports whether the canary replays e: an allowed or denied
+// request, decided by the policy or a reviewer.
+func canaryReplays(e *AuditEntry) bool {
+	if e.Decision != protocol.DecisionAllow && e.Decision != protocol.DecisionDeny {
+		return false
+	}
+	if e.Hook != "" {
+		return false
+	}
+	switch e.Outcome {
+	case protocol.OutcomeNone, protocol.OutcomeAfterHITL, protocol.OutcomeHITLExpired,
+		protocol.OutcomeAutoApproved, protocol.OutcomePathViolation:
+		return true
+	}
+	return false
+}
+
+// HeldPolicyReload returns the reload the canary holds, or nil.
+func (s *Server) HeldPolicyReload() *HeldReload {
+	s.canaryMu.Lock()
+	defer s.canaryMu.Unlock()
+	return s.heldReload
+}
+
+// ConfirmPolicyReload puts the held reload in force on actor's behalf,
+// past the canary. hash, if set, must be the held policy's, so that a
+// confirmation meant for one reload does not apply another.
+func (s *Server) ConfirmPolicyReload(hash, actor string) (*HeldReload, error) {
+	s.canaryMu.Lock()
+	held := s.heldReload
+	if held == nil {
+		s.canaryMu.Unlock()
+		return nil, ErrNoHeldReload
+	}
+	if hash != "" && hash != held.Report.PolicyHash {
+		s.canaryMu.Unlock()
+		return nil, fmt.Errorf("%w: policy %s is held", ErrPolicyChanged, shortPolicyHash(held.Report.PolicyHash))
+	}
+	s.canaryConfirmed = held.engine
+	s.canaryMu.Unlock()
+
+	var err error
+	if s.policyWatcher != nil {
+		err = s.policyWatcher.Install(held.engine)
+	} else if err = s.reloadPolicy(held.engine); err == nil {
+		s.events.Publish(events.PolicyReloaded{Path: s.config.PolicyPath})
+	}
+	if err != nil {
+		s.canaryMu.Lock()
+		if s.canaryConfirmed == held.engine {
+			s.canaryConfirmed = nil
+		}
+		s.canaryMu.Unlock()
+		return nil, err
+	}
+
+	s.logger.Printf("policy reload %s confirmed by %s: %s", shortPolicyHash(held.Report.PolicyHash), actor, held.Report.Summary())
+	s.record(AuditEntry{
+		Command:    policyEditCommand,
+		Args:       []string{"reload-confirmed"},
+		Cwd:        filepath.Dir(s.config.PolicyPath),
+		Decision:   protocol.DecisionEvent,
+		Detail:     "policy reload confirmed",
+		PolicyHash: held.Report.PolicyHash,
+		Actor:      actor,
+	})
+	return held, nil
+}
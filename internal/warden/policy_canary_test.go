@@ -0,0 +1,167 @@
+package warden
+
+import (
+	"clawrden/pkg/protocol"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// seedCanaryAudit writes recent traffic for editTestPolicy to an audit log
+// and points srv at it: ten allowed requests (nine ls, one approved jq) and
+// two denied rm, besides entries the canary skips.
+func seedCanaryAudit(t *testing.T, srv *Server) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.log")
+	al, err := NewAuditLogger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer al.Close()
+	log := func(e AuditEntry) {
+		if e.Cwd == "" {
+			e.Cwd = "/app"
+		}
+		if err := al.Log(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for range 9 {
+		log(AuditEntry{Command: "ls", Args: []string{"-la"}, Decision: protocol.DecisionAllow})
+	}
+	log(AuditEntry{Command: "jq", Decision: protocol.DecisionAllow, Outcome: protocol.OutcomeAfterHITL})
+	log(AuditEntry{Command: "rm", Args: []string{"-rf", "/"}, Decision: protocol.DecisionDeny})
+	log(AuditEntry{Command: "rm", Decision: protocol.DecisionDeny})
+
+	// Decided by the warden's state, not its policy
+	log(AuditEntry{Command: "ls", Decision: protocol.DecisionDeny, Outcome: protocol.OutcomeLockdown})
+	log(AuditEntry{Command: "ls", Decision: protocol.DecisionAsk})
+	log(AuditEntry{Command: jailCommand, Decision: protocol.DecisionEvent, Detail: "jail create"})
+	srv.config.AuditPath = path
+}
+
+func TestPolicyCanaryHoldsEdits(t *testing.T) {
+	api, srv, _, audited := newPolicyEditTestAPI(t)
+	seedCanaryAudit(t, srv)
+	hash := getPolicyRules(t, api).Hash
+
+	// One allowed request in ten flips: within the default threshold
+	resp := policyEditRequest(t, api, http.MethodPut, "/api/policy/rules/2", hash, `{"command": "jq", "action": "deny"}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT jq deny: status %d, want 200", resp.StatusCode)
+	}
+	var edit PolicyEdit
+	json.NewDecoder(resp.Body).Decode(&edit)
+	if srv.currentPolicy().engine.Hash() != edit.Hash {
+		t.Fatal("edit within the threshold not in force")
+	}
+	if held := srv.HeldPolicyReload(); held != nil {
+		t.Fatalf("held %+v", held.Report)
+	}
+
+	// Denying ls flips every allowed request
+	inForce := edit.Hash
+	resp = policyEditRequest(t, api, http.MethodDelete, "/api/policy/rules/1", edit.Hash, "")
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("DELETE ls: status %d, want 202", resp.StatusCode)
+	}
+	json.NewDecoder(resp.Body).Decode(&edit)
+	if srv.currentPolicy().engine.Hash() != inForce {
+		t.Fatal("held policy went into force")
+	}
+
+	resp = policyEditRequest(t, api, http.MethodGet, "/api/policy/confirm-reload", "", "")
+	var held HeldReload
+	if err := json.NewDecoder(resp.Body).Decode(&held); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET confirm-reload: status %d, %v", resp.StatusCode, err)
+	}
+	r := held.Report
+	if r.PolicyHash != edit.Hash || r.Replayed != 12 || r.Allowed != 10 || r.Denied != 2 || r.NewlyDenied != 10 || r.NewlyAllowed != 0 {
+		t.Errorf("report = %+v", r)
+	}
+	if len(r.Changes) != 10 || r.Changes[0].Command != "ls" || r.Changes[0].Was != protocol.DecisionAllow || r.Changes[0].Now != protocol.DecisionDeny {
+		t.Errorf("changes = %+v", r.Changes)
+	}
+
+	resp = policyEditRequest(t, api, http.MethodPost, "/api/policy/confirm-reload", "", `{"policy_hash": "`+inForce+`"}`)
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("confirming another policy: status %d, want 409", resp.StatusCode)
+	}
+	resp = policyEditRequest(t, api, http.MethodPost, "/api/policy/confirm-reload", "", `{"policy_hash": "`+edit.Hash+`"}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("confirm: status %d, want 200", resp.StatusCode)
+	}
+	if srv.currentPolicy().engine.Hash() != edit.Hash {
+		t.Error("confirmed policy not in force")
+	}
+	resp = policyEditRequest(t, api, http.MethodPost, "/api/policy/confirm-reload", "", "")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("second confirm: status %d, want 404", resp.StatusCode)
+	}
+
+	var events []string
+	for _, e := range audited() {
+		if e.Decision == protocol.DecisionEvent && strings.HasPrefix(e.Detail, "policy reload") {
+			events = append(events, e.Detail+" by "+e.Actor+": "+e.Error)
+		}
+	}
+	want := []string{
+		"policy reload held by : 10 of 10 allowed requests would now be denied, 0 of 2 denied ones allowed",
+		"policy reload confirmed by alice@build-01: ",
+	}
+	if strings.Join(events, "\n") != strings.Join(want, "\n") {
+		t.Errorf("audited %q, want %q", events, want)
+	}
+}
+
+func TestPolicyCanaryNewlyAllowed(t *testing.T) {
+	_, srv, _, _ := newPolicyEditTestAPI(t)
+	seedCanaryAudit(t, srv)
+	allowRm, err := ParsePolicy([]byte("default_action: deny\nrules:\n  - command: ls\n    action: allow\n  - command: jq\n    action: ask\n  - command: rm\n    action: allow\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var heldErr *PolicyReloadHeldError
+	if err := srv.reloadPolicy(allowRm); !errors.As(err, &heldErr) || heldErr.Report.NewlyAllowed != 2 {
+		t.Fatalf("reload = %v, want held for two newly allowed requests", err)
+	}
+
+	// At a threshold of 1, no reload is held
+	srv.config.PolicyCanaryThreshold = 1
+	if err := srv.reloadPolicy(allowRm); err != nil {
+		t.Errorf("reload with threshold 1: %v", err)
+	}
+	if srv.HeldPolicyReload() != nil {
+		t.Error("reload that passed left the held one in place")
+	}
+
+	// Disabled, the canary holds nothing
+	srv.config.PolicyCanaryThreshold = 0
+	srv.config.PolicyCanary = -1
+	denyAll, _ := ParsePolicy([]byte("default_action: deny\n"))
+	if err := srv.reloadPolicy(denyAll); err != nil {
+		t.Errorf("reload with the canary disabled: %v", err)
+	}
+	if srv.currentPolicy().engine != denyAll {
+		t.Error("policy not in force with the canary disabled")
+	}
+}
+
+func TestPolicyCanaryReplaysTheLastRequests(t *testing.T) {
+	_, srv, _, _ := newPolicyEditTestAPI(t)
+	seedCanaryAudit(t, srv)
+	denyLs, _ := ParsePolicy([]byte("default_action: deny\nrules:\n  - command: jq\n    action: ask\n"))
+
+	// The last three are the approved jq and the two denied rm
+	report, err := srv.runCanary(denyLs, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Replayed != 3 || report.Allowed != 1 || report.Denied != 2 || report.NewlyDenied != 0 || report.Exceeded() {
+		t.Errorf("report = %+v", report)
+	}
+}
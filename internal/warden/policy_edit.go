@@ -0,0 +1,384 @@
+package warden
+
+import (
+	"bytes"
+	"clawrden/internal/events"
+	"clawrden/pkg/protocol"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// policyEditCommand is the pseudo-command recorded in the audit log for
+// edits made through the policy API.
+const policyEditCommand = "clawrden-policy"
+
+// Policy edit operations, for a PolicyEdit's Op.
+const (
+	PolicyEditAdd    = "add-rule"
+	PolicyEditUpdate = "update-rule"
+	PolicyEditDelete = "delete-rule"
+)
+
+var (
+	ErrNoPolicyFile   = errors.New("the warden runs without a policy file")
+	ErrPolicyChanged  = errors.New("policy file changed")
+	ErrRuleNotFound   = errors.New("rule not found")
+	ErrPolicyNotRules = errors.New("policy file rules are not a list")
+)
+
+// PolicyEditRejectedError is returned when an edit would leave a policy
+// that fails to load; the file is left as it was.
+type PolicyEditRejectedError struct {
+	Err error
+}
+
+func (e *PolicyEditRejectedError) Error() string {
+	return fmt.Sprintf("edit rejected: %v", e.Err)
+}
+
+func (e *PolicyEditRejectedError) Unwrap() error { return e.Err }
+
+// PolicyRules is the rules section of the policy file as the policy API
+// shows it. Index is the rule's position counting from 1, as rule names
+// like "rule 3 (pip)" do; edits name rules by it and Hash.
+type PolicyRules struct {
+	Path    string        `json:"path"`
+	Hash    string        `json:"hash"`     // SHA-256 of the file, for If-Match
+	InForce bool          `json:"in_force"` // Whether the file is the policy in force
+	Rules   []IndexedRule `json:"rules"`
+}
+
+// IndexedRule is one rule of PolicyRules, with the field names of the
+// policy file.
+type IndexedRule struct {
+	Index int            `json:"index"`
+	Rule  map[string]any `json:"rule"`
+}
+
+// PolicyEdit records one change made through the policy API.
+type PolicyEdit struct {
+	Op           string `json:"op"`
+	Index        int    `json:"index"`         // Rule added, changed or removed
+	Diff         string `json:"diff"`          // The rule's YAML before (-) and after (+)
+	PreviousHash string `json:"previous_hash"` // SHA-256 of the file before the edit
+	Hash         string `json:"hash"`          // And after it
+}
+
+// PolicyRules reads the rules of the policy file.
+func (s *Server) PolicyRules() (*PolicyRules, error) {
+	if s.config.PolicyPath == "" {
+		return nil, ErrNoPolicyFile
+	}
+	data, err := os.ReadFile(s.config.PolicyPath)
+	if err != nil {
+		return nil, fmt.Errorf("read policy file: %w", err)
+	}
+	var config PolicyConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parse policy file: %w", err)
+	}
+
+	hash := policyHash(data)
+	rules := &PolicyRules{
+		Path:    s.config.PolicyPath,
+		Hash:    hash,
+		InForce: hash == s.currentPolicy().engine.Hash(),
+		Rules:   make([]IndexedRule, 0, len(config.Rules)),
+	}
+	for i, rule := range config.Rules {
+		fields, err := ruleFields(rule)
+		if err != nil {
+			return nil, err
+		}
+		rules.Rules = append(rules.Rules, IndexedRule{Index: i + 1, Rule: fields})
+	}
+	return rules, nil
+}
+
+// EditPolicyRule changes the rules of the policy file on actor's behalf:
+// PolicyEditAdd appends rule, PolicyEditUpdate replaces the rule at index
+// with it, and PolicyEditDelete removes the rule at index. ifMatch must be
+// the hash of the file as the caller last read it; ErrPolicyChanged means
+// someone else edited it since. The edited policy must load as a reload
+// would load it, or nothing is written. The file is replaced atomically
+// and the new policy put in force at once, without waiting for the watcher.
+func (s *Server) EditPolicyRule(ifMatch, actor, op string, index int, rule *Rule) (*PolicyEdit, error) {
+	if s.config.PolicyPath == "" {
+		return nil, ErrNoPolicyFile
+	}
+	s.policyEditMu.Lock()
+	defer s.policyEditMu.Unlock()
+
+	path := s.config.PolicyPath
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read policy file: %w", err)
+	}
+	edit := &PolicyEdit{Op: op, Index: index, PreviousHash: policyHash(data)}
+	if ifMatch != edit.PreviousHash {
+		return nil, fmt.Errorf("%w: it is now %s", ErrPolicyChanged, edit.PreviousHash)
+	}
+
+	var before, after string
+	updated, err := editRules(data, func(rules *yaml.Node) error {
+		if op == PolicyEditAdd {
+			edit.Index = len(rules.Content) + 1
+		} else if index < 1 || index > len(rules.Content) {
+			return fmt.Errorf("%w: %d (the policy has %d)", ErrRuleNotFound, index, len(rules.Content))
+		} else {
+			before = nodeYAML(rules.Content[index-1])
+		}
+
+		var node yaml.Node
+		if rule != nil {
+			if err := node.Encode(rule); err != nil {
+				return err
+			}
+			after = nodeYAML(&node)
+		}
+		switch op {
+		case PolicyEditAdd:
+			rules.Content = append(rules.Content, &node)
+		case PolicyEditUpdate:
+			// Keep the comments around the rule it replaces
+			old := rules.Content[index-1]
+			node.HeadComment, node.LineComment, node.FootComment = old.HeadComment, old.LineComment, old.FootComment
+			rules.Content[index-1] = &node
+		case PolicyEditDelete:
+			rules.Content = append(rules.Content[:index-1], rules.Content[index:]...)
+		default:
+			return fmt.Errorf("unknown policy edit %q", op)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the result as a reload would, before the file is touched
+	engine, err := ParsePolicy(updated)
+	if err == nil {
+		_, err = s.planJails(s.currentPolicy(), &policyState{engine: engine, jails: engine.GetJails()})
+	}
+	if err != nil {
+		return nil, &PolicyEditRejectedError{Err: err}
+	}
+	if err := writeFileAtomic(path, updated); err != nil {
+		return nil, fmt.Errorf("write policy file: %w", err)
+	}
+	edit.Hash = engine.Hash()
+	edit.Diff = lineDiff(before, after)
+
+	s.logger.Printf("policy %s rule %d by %s (policy %s)", op, edit.Index, actor, shortPolicyHash(edit.Hash))
+	s.record(AuditEntry{
+		Command:    policyEditCommand,
+		Args:       []string{op, fmt.Sprint(edit.Index)},
+		Cwd:        filepath.Dir(path),
+		Decision:   protocol.DecisionEvent,
+		Detail:     "policy edit",
+		PolicyHash: edit.Hash,
+		Actor:      actor,
+		PolicyEdit: edit,
+	})
+
+	if s.policyWatcher != nil {
+		err = s.policyWatcher.Install(engine)
+	} else if err = s.reloadPolicy(engine); err == nil {
+		s.events.Publish(events.PolicyReloaded{Path: path})
+	}
+	if err != nil {
+		// The file is written; the watcher's next reload retries it
+		return edit, fmt.Errorf("policy file written but not applied: %w", err)
+	}
+	return edit, nil
+}
+
+// ParseRule reads a rule in the policy file's format (JSON or YAML), with
+// the checks a policy file's rules get, and a few a hand-written file is
+// spared: the command and action are required, and unknown fields are
+// rejected, so a misspelt restriction is not silently dropped.
+func ParseRule(data []byte) (*Rule, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var rule Rule
+	if err := dec.Decode(&rule); err != nil {
+		return nil, fmt.Errorf("parse rule: %w", err)
+	}
+	if rule.Command == "" {
+		return nil, fmt.Errorf("rule has no command")
+	}
+	switch rule.Action {
+	case ActionAllow, ActionDeny, ActionAsk:
+	default:
+		return nil, fmt.Errorf("rule action must be allow, deny or ask, got %q", rule.Action)
+	}
+	if err := ValidateRules([]Rule{rule}); err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// editRules applies edit to the rules list of a policy file and returns
+// the file, with its other settings and comments kept.
+func editRules(data []byte, edit func(rules *yaml.Node) error) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse policy file: %w", err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("parse policy file: not a mapping")
+	}
+
+	var rules *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "rules" {
+			rules = root.Content[i+1]
+		}
+	}
+	switch {
+	case rules == nil:
+		rules = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "rules"}, rules)
+	case rules.Kind == yaml.ScalarNode && rules.Tag == "!!null":
+		*rules = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", LineComment: rules.LineComment}
+	case rules.Kind != yaml.SequenceNode:
+		return nil, ErrPolicyNotRules
+	}
+	if err := edit(rules); err != nil {
+		return nil, err
+	}
+	if len(rules.Content) > 0 {
+		rules.Style &^= yaml.FlowStyle // "rules: []" grows into a block list
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ruleFields returns rule as the policy file spells it, for JSON clients.
+func ruleFields(rule Rule) (map[string]any, error) {
+	data, err := yaml.Marshal(rule)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]any{}
+	if err := yaml.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// nodeYAML renders one node of a policy file.
+func nodeYAML(node *yaml.Node) string {
+	data, err := yaml.Marshal(node)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(string(data), "\n")
+}
+
+// lineDiff shows how after differs from before, line by line: lines only
+// in before start with "-", lines only in after with "+", and shared lines
+// with a space.
+func lineDiff(before, after string) string {
+	var a, b []string
+	if before != "" {
+		a = strings.Split(before, "\n")
+	}
+	if after != "" {
+		b = strings.Split(after, "\n")
+	}
+
+	// Longest common subsequence; rules are a few lines long
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			out = append(out, " "+a[i])
+			i, j = i+1, j+1
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			out = append(out, "-"+a[i])
+			i++
+		default:
+			out = append(out, "+"+b[j])
+			j++
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// policyHash is the hash PolicyEngine.Hash reports for a policy file.
+func policyHash(data []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+// shortPolicyHash abbreviates a policy hash for log lines.
+func shortPolicyHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+// writeFileAtomic replaces path with data through a rename, keeping the
+// file's mode, so the watcher and readers never see a half-written policy.
+func writeFileAtomic(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
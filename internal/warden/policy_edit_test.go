@@ -0,0 +1,284 @@
+package warden
+
+import (
+	"clawrden/internal/events"
+	"clawrden/pkg/protocol"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const editTestPolicy = `# Reviewed policy for the build agents
+default_action: deny
+rules:
+  # Read-only tools
+  - command: ls
+    action: allow
+  - command: jq
+    action: ask
+tests:
+  - command: rm
+    expect: deny
+`
+
+// newPolicyEditTestAPI starts an API over a warden whose policy file is
+// editTestPolicy, and returns the file's path and what the warden audits.
+func newPolicyEditTestAPI(t *testing.T) (*httptest.Server, *Server, string, func() []AuditEntry) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writeTestFile(t, path, editTestPolicy)
+	engine, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+
+	srv := newTestServer(t)
+	srv.config.PolicyPath = path
+	srv.config.DisableDashboard = true
+	srv.setPolicy(engine)
+	srv.events = events.New(log.New(io.Discard, "", 0))
+	var mu sync.Mutex
+	var audited []AuditEntry
+	srv.events.Subscribe("test", func(e events.Event) {
+		if a, ok := e.(Audited); ok {
+			mu.Lock()
+			audited = append(audited, a.Entry)
+			mu.Unlock()
+		}
+	})
+	api := httptest.NewServer(NewAPIServer(srv, "127.0.0.1:0", log.New(io.Discard, "", 0)).server.Handler)
+	t.Cleanup(api.Close)
+	return api, srv, path, func() []AuditEntry {
+		srv.events.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		return audited
+	}
+}
+
+func policyEditRequest(t *testing.T, api *httptest.Server, method, path, ifMatch, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, api.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ifMatch != "" {
+		req.Header.Set("If-Match", `"`+ifMatch+`"`)
+	}
+	req.Header.Set(ActorHeader, "alice@build-01")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func getPolicyRules(t *testing.T, api *httptest.Server) PolicyRules {
+	t.Helper()
+	resp := policyEditRequest(t, api, http.MethodGet, "/api/policy/rules", "", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /api/policy/rules: status %d", resp.StatusCode)
+	}
+	var rules PolicyRules
+	if err := json.NewDecoder(resp.Body).Decode(&rules); err != nil {
+		t.Fatal(err)
+	}
+	return rules
+}
+
+func TestPolicyRulesEditing(t *testing.T) {
+	api, srv, path, audited := newPolicyEditTestAPI(t)
+
+	rules := getPolicyRules(t, api)
+	if !rules.InForce || len(rules.Rules) != 2 || rules.Rules[1].Index != 2 || rules.Rules[1].Rule["command"] != "jq" {
+		t.Fatalf("rules = %+v", rules)
+	}
+	if rules.Hash != srv.currentPolicy().engine.Hash() {
+		t.Fatalf("hash = %s, want the policy in force", rules.Hash)
+	}
+
+	// Allow jq without review
+	resp := policyEditRequest(t, api, http.MethodPut, "/api/policy/rules/2", rules.Hash, `{"command": "jq", "action": "allow", "exec_timeout": "30s"}`)
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("PUT: status %d: %s", resp.StatusCode, body)
+	}
+	var edit PolicyEdit
+	if err := json.NewDecoder(resp.Body).Decode(&edit); err != nil {
+		t.Fatal(err)
+	}
+	if edit.PreviousHash != rules.Hash || edit.Hash == rules.Hash || resp.Header.Get("ETag") != `"`+edit.Hash+`"` {
+		t.Errorf("edit = %+v, ETag %s", edit, resp.Header.Get("ETag"))
+	}
+
+	// In force at once, without waiting for a watcher
+	policy := srv.currentPolicy().engine
+	if policy.Hash() != edit.Hash {
+		t.Errorf("policy in force = %s, want %s", policy.Hash(), edit.Hash)
+	}
+	if got := policy.Evaluate(&protocol.Request{Command: "jq"}); got.Action != ActionAllow {
+		t.Errorf("jq action = %s, want allow", got.Action)
+	}
+
+	// Comments and other settings survive
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"# Reviewed policy for the build agents", "# Read-only tools", "exec_timeout: 30s", "expect: deny"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("policy file lost %q:\n%s", want, data)
+		}
+	}
+
+	resp = policyEditRequest(t, api, http.MethodPost, "/api/policy/rules", edit.Hash, `{"command": "yq", "action": "allow"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST: status %d", resp.StatusCode)
+	}
+	json.NewDecoder(resp.Body).Decode(&edit)
+	if edit.Index != 3 {
+		t.Errorf("added rule index = %d, want 3", edit.Index)
+	}
+	resp = policyEditRequest(t, api, http.MethodDelete, "/api/policy/rules/1", edit.Hash, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("DELETE: status %d", resp.StatusCode)
+	}
+
+	rules = getPolicyRules(t, api)
+	var commands []string
+	for _, r := range rules.Rules {
+		commands = append(commands, r.Rule["command"].(string))
+	}
+	if strings.Join(commands, " ") != "jq yq" {
+		t.Errorf("rules after edits = %v, want [jq yq]", commands)
+	}
+
+	entries := audited()
+	if len(entries) != 3 {
+		t.Fatalf("audited %d entries, want 3", len(entries))
+	}
+	first := entries[0]
+	if first.Command != policyEditCommand || first.Actor != "alice@build-01" || first.PolicyEdit == nil {
+		t.Fatalf("audit entry = %+v", first)
+	}
+	wantDiff := " command: jq\n-action: ask\n+action: allow\n+exec_timeout: 30s"
+	if first.PolicyEdit.Diff != wantDiff {
+		t.Errorf("diff =\n%s\nwant\n%s", first.PolicyEdit.Diff, wantDiff)
+	}
+	if got := entries[2].PolicyEdit; got.Op != PolicyEditDelete || got.Diff != "-# Read-only tools\n-command: ls\n-action: allow" {
+		t.Errorf("delete = %+v", got)
+	}
+}
+
+func TestPolicyEditConcurrentIfMatch(t *testing.T) {
+	api, _, path, _ := newPolicyEditTestAPI(t)
+	hash := getPolicyRules(t, api).Hash
+
+	// Editors that read the same policy race; only the first edit lands
+	const editors = 8
+	statuses := make(chan int, editors)
+	var wg sync.WaitGroup
+	for i := 0; i < editors; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := policyEditRequest(t, api, http.MethodPost, "/api/policy/rules", hash, `{"command": "yq", "action": "allow"}`)
+			statuses <- resp.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+	if counts[http.StatusCreated] != 1 || counts[http.StatusPreconditionFailed] != editors-1 {
+		t.Errorf("statuses = %v, want one 201 and %d 412", counts, editors-1)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "command: yq"); n != 1 {
+		t.Errorf("policy file has %d yq rules, want 1:\n%s", n, data)
+	}
+}
+
+func TestPolicyEditRejected(t *testing.T) {
+	api, srv, path, audited := newPolicyEditTestAPI(t)
+	hash := getPolicyRules(t, api).Hash
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		ifMatch    string
+		body       string
+		wantStatus int
+	}{
+		{"invalid action", http.MethodPost, "/api/policy/rules", hash, `{"command": "yq", "action": "maybe"}`, http.StatusBadRequest},
+		{"unknown field", http.MethodPost, "/api/policy/rules", hash, `{"command": "yq", "action": "allow", "exec_timout": "5s"}`, http.StatusBadRequest},
+		{"fails the policy's tests", http.MethodPost, "/api/policy/rules", hash, `{"command": "rm", "action": "allow"}`, http.StatusBadRequest},
+		{"no If-Match", http.MethodPost, "/api/policy/rules", "", `{"command": "yq", "action": "allow"}`, http.StatusPreconditionRequired},
+		{"stale If-Match", http.MethodDelete, "/api/policy/rules/1", strings.Repeat("0", 64), "", http.StatusPreconditionFailed},
+		{"no such rule", http.MethodDelete, "/api/policy/rules/9", hash, "", http.StatusNotFound},
+		{"bad index", http.MethodDelete, "/api/policy/rules/first", hash, "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := policyEditRequest(t, api, tt.method, tt.path, tt.ifMatch, tt.body)
+			if resp.StatusCode != tt.wantStatus {
+				body, _ := io.ReadAll(resp.Body)
+				t.Errorf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+		})
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != editTestPolicy {
+		t.Errorf("policy file changed:\n%s", data)
+	}
+	if srv.currentPolicy().engine.Hash() != hash {
+		t.Error("policy in force changed")
+	}
+	if entries := audited(); len(entries) != 0 {
+		t.Errorf("audited %d rejected edits", len(entries))
+	}
+}
+
+func TestPolicyEditWithoutPolicyFile(t *testing.T) {
+	srv := newTestServer(t)
+	if _, err := srv.PolicyRules(); err != ErrNoPolicyFile {
+		t.Errorf("PolicyRules err = %v, want ErrNoPolicyFile", err)
+	}
+	if _, err := srv.EditPolicyRule("", "alice", PolicyEditDelete, 1, nil); err != ErrNoPolicyFile {
+		t.Errorf("EditPolicyRule err = %v, want ErrNoPolicyFile", err)
+	}
+}
+
+func TestLineDiff(t *testing.T) {
+	tests := []struct {
+		before, after, want string
+	}{
+		{"", "command: jq\naction: allow", "+command: jq\n+action: allow"},
+		{"command: jq\naction: allow", "", "-command: jq\n-action: allow"},
+		{"command: jq\naction: ask\nreason: x", "command: jq\naction: allow\nreason: x", " command: jq\n-action: ask\n+action: allow\n reason: x"},
+	}
+	for _, tt := range tests {
+		if got := lineDiff(tt.before, tt.after); got != tt.want {
+			t.Errorf("lineDiff(%q, %q) =\n%s\nwant\n%s", tt.before, tt.after, got, tt.want)
+		}
+	}
+}
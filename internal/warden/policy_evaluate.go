@@ -0,0 +1,79 @@
+package warden
+
+import (
+	"clawrden/pkg/protocol"
+	"fmt"
+	"path/filepath"
+)
+
+// EvaluationRequest is an invocation to check against the policy in force.
+// Its fields are named like an audit entry's, so an audited request can be
+// evaluated again as it was.
+type EvaluationRequest struct {
+	Command     string            `json:"command"`
+	Args        []string          `json:"args"`
+	Cwd         string            `json:"cwd"`
+	Identity    protocol.Identity `json:"identity"`
+	JailID      string            `json:"jail_id,omitempty"`
+	Image       string            `json:"image,omitempty"` // Container image, for image-scoped rules
+	ImageDigest string            `json:"image_digest,omitempty"`
+}
+
+// PolicyEvaluation is what the policy in force decides for an
+// EvaluationRequest.
+type PolicyEvaluation struct {
+	Decision     protocol.Decision `json:"decision"`                // As audited: "allow", "ask" or "deny"
+	Outcome      protocol.Outcome  `json:"outcome,omitempty"`       // "path_violation" for a refused cwd
+	Rule         string            `json:"rule,omitempty"`          // Rule that decided; empty for default_action
+	Reason       string            `json:"reason,omitempty"`        // The rule's reason, or what violated the policy
+	AllowedPaths []string          `json:"allowed_paths,omitempty"` // The policy's allowed_paths, to explain path violations
+	PolicyHash   string            `json:"policy_hash,omitempty"`
+}
+
+// EvaluatePolicy decides er the way a request would be decided, without
+// running anything: the cwd must be allowed, then the jail's rules and the
+// global rules are evaluated. Checks that depend on the warden's state
+// rather than the policy, like lockdowns and maintenance, are left out.
+func (s *Server) EvaluatePolicy(er EvaluationRequest) PolicyEvaluation {
+	return s.evaluatePolicy(s.currentPolicy(), er)
+}
+
+// evaluatePolicy decides er as EvaluatePolicy does, under policy.
+func (s *Server) evaluatePolicy(policy *policyState, er EvaluationRequest) PolicyEvaluation {
+	ev := PolicyEvaluation{PolicyHash: policy.engine.Hash()}
+	if policy.engine == nil {
+		ev.Decision, ev.Reason = protocol.DecisionDeny, "no policy loaded"
+		return ev
+	}
+	ev.AllowedPaths = policy.engine.config.AllowedPaths
+
+	req := &protocol.Request{
+		Command:     er.Command,
+		Args:        er.Args,
+		Cwd:         er.Cwd,
+		Identity:    er.Identity,
+		JailID:      er.JailID,
+		Image:       er.Image,
+		ImageDigest: er.ImageDigest,
+	}
+	var pathErr error
+	if !filepath.IsAbs(req.Cwd) {
+		pathErr = fmt.Errorf("working directory %q is not an absolute path", req.Cwd)
+	} else {
+		pathErr = policy.engine.ValidatePath(filepath.Clean(req.Cwd))
+	}
+	if pathErr != nil {
+		ev.Decision, ev.Outcome, ev.Reason = protocol.DecisionDeny, protocol.OutcomePathViolation, pathErr.Error()
+		return ev
+	}
+
+	if req.JailID != "" && !s.jailExists(policy, req.JailID) {
+		req.JailID = ""
+	}
+	result := policy.engine.EvaluateInJail(req, s.jailRules(policy, req.JailID))
+	ev.Decision, ev.Rule, ev.Reason = result.Action.Decision(), result.MatchedRule, result.Reason
+	if result.URLViolation != "" {
+		ev.Reason = result.URLViolation
+	}
+	return ev
+}
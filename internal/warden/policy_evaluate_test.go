@@ -0,0 +1,91 @@
+package warden
+
+import (
+	"clawrden/pkg/protocol"
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestEvaluatePolicy(t *testing.T) {
+	const policyYAML = `
+default_action: deny
+allowed_paths: ["/app/*"]
+jails:
+  ci:
+    commands: [npm]
+    rules:
+      - command: npm
+        action: allow
+rules:
+  - command: git
+    args: ["--force"]
+    action: deny
+    reason: no force push
+  - command: curl
+    action: allow
+    url_allow: ["example.com"]
+  - command: npm
+    action: ask
+`
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writeTestFile(t, path, policyYAML)
+	engine, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(policyYAML)))
+	if engine.Hash() != hash {
+		t.Errorf("Hash() = %s, want %s", engine.Hash(), hash)
+	}
+	srv := newTestServer(t)
+	srv.setPolicy(engine)
+
+	tests := []struct {
+		name string
+		req  EvaluationRequest
+		want PolicyEvaluation
+	}{
+		{"rule with reason", EvaluationRequest{Command: "git", Args: []string{"push", "--force"}, Cwd: "/app"},
+			PolicyEvaluation{Decision: protocol.DecisionDeny, Rule: "rule 1 (git)", Reason: "no force push"}},
+		{"default action", EvaluationRequest{Command: "git", Args: []string{"push"}, Cwd: "/app/src"},
+			PolicyEvaluation{Decision: protocol.DecisionDeny}},
+		{"path violation", EvaluationRequest{Command: "git", Cwd: "/etc"},
+			PolicyEvaluation{Decision: protocol.DecisionDeny, Outcome: protocol.OutcomePathViolation, Reason: `path "/etc" not allowed by policy (allowed patterns: [/app/*])`}},
+		{"relative cwd", EvaluationRequest{Command: "git", Cwd: "app"},
+			PolicyEvaluation{Decision: protocol.DecisionDeny, Outcome: protocol.OutcomePathViolation, Reason: `working directory "app" is not an absolute path`}},
+		{"url violation", EvaluationRequest{Command: "curl", Args: []string{"https://evil.test/x"}, Cwd: "/app"},
+			PolicyEvaluation{Decision: protocol.DecisionDeny, Rule: "rule 2 (curl)", Reason: "URL host evil.test is not allowlisted"}},
+		{"jail rules first", EvaluationRequest{Command: "npm", Cwd: "/app", JailID: "ci", Identity: protocol.Identity{UID: 1000}},
+			PolicyEvaluation{Decision: protocol.DecisionAllow, Rule: "jail ci rule 1 (npm)"}},
+		{"unknown jail", EvaluationRequest{Command: "npm", Cwd: "/app", JailID: "nope"},
+			PolicyEvaluation{Decision: protocol.DecisionAsk, Rule: "rule 3 (npm)"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := srv.EvaluatePolicy(tt.req)
+			if got.PolicyHash != hash || len(got.AllowedPaths) != 1 {
+				t.Errorf("policy hash %q, allowed paths %v", got.PolicyHash, got.AllowedPaths)
+			}
+			got.PolicyHash, got.AllowedPaths = "", nil
+			if got.Decision != tt.want.Decision || got.Rule != tt.want.Rule || got.Reason != tt.want.Reason {
+				t.Errorf("EvaluatePolicy() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuditRecordsRuleAndPolicyHash(t *testing.T) {
+	srv, audited := newMaintenanceTestServer(t, []Rule{{Command: "git", Args: []string{"--force"}, Action: ActionDeny, Reason: "no force push"}})
+	srv.currentPolicy().engine.hash = "abc123"
+	sendRequest(t, srv, &protocol.Request{Command: "git", Args: []string{"push", "--force"}, Cwd: t.TempDir()})
+
+	entries := audited()
+	if len(entries) != 1 {
+		t.Fatalf("audited %d entries, want 1", len(entries))
+	}
+	if e := entries[0]; e.Rule != "rule 1 (git)" || e.Reason != "no force push" || e.PolicyHash != "abc123" {
+		t.Errorf("audited rule %q, reason %q, policy hash %q", e.Rule, e.Reason, e.PolicyHash)
+	}
+}
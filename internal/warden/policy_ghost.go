@@ -0,0 +1,149 @@
+package warden
+
+import (
+	"clawrden/internal/executor"
+	"fmt"
+)
+
+// defaultGhostHardening applies to ghost containers unless the policy's
+// ghost section relaxes it.
+var defaultGhostHardening = executor.GhostHardening{
+	ReadonlyRootfs:  true,
+	CapDropAll:      true,
+	NoNewPrivileges: true,
+}
+
+// GhostPolicy hardens the ephemeral containers ghost commands run in, sets
+// the strategy of commands whose rule has none, and tracks what they change.
+// Commands overrides Defaults field by field for individual commands.
+type GhostPolicy struct {
+	Defaults GhostHardeningConfig            `yaml:"defaults,omitempty"`
+	Commands map[string]GhostHardeningConfig `yaml:"commands,omitempty"`
+}
+
+// GhostHardeningConfig is a partial hardening setting; unset fields inherit.
+type GhostHardeningConfig struct {
+	ReadonlyRootfs  *bool    `yaml:"readonly_rootfs,omitempty"`   // Read-only image filesystem (/tmp stays writable)
+	CapDropAll      *bool    `yaml:"cap_drop_all,omitempty"`      // Drop all capabilities except cap_add
+	CapAdd          []string `yaml:"cap_add,omitempty"`           // Capabilities to keep, e.g. [CHOWN, SETUID]
+	NoNewPrivileges *bool    `yaml:"no_new_privileges,omitempty"` // Block privilege gain through setuid binaries
+	SeccompProfile  *string  `yaml:"seccomp_profile,omitempty"`   // Seccomp JSON profile on the warden host ("" = Docker's default)
+
+	// Where the command runs when its rule sets no strategy
+	Strategy executor.Strategy `yaml:"strategy,omitempty"`
+
+	// Record which files in the workspace the command added, modified or
+	// deleted, skipping workspaces with more than track_max_files files
+	TrackChanges    *bool `yaml:"track_changes,omitempty"`
+	TrackMaxFiles   *int  `yaml:"track_max_files,omitempty"`   // Default: 20000
+	MaxFilesChanged *int  `yaml:"max_files_changed,omitempty"` // Flag commands changing more files (0 = no limit)
+
+	// Which workspace files are given to the requester's uid and gid after
+	// the command: none, changed (the default) or all
+	OwnershipFix executor.OwnershipFix `yaml:"ownership_fix,omitempty"`
+}
+
+// apply overrides h with the fields set in c.
+func (c GhostHardeningConfig) apply(h executor.GhostHardening) executor.GhostHardening {
+	if c.ReadonlyRootfs != nil {
+		h.ReadonlyRootfs = *c.ReadonlyRootfs
+	}
+	if c.CapDropAll != nil {
+		h.CapDropAll = *c.CapDropAll
+	}
+	if c.CapAdd != nil {
+		h.CapAdd = append([]string(nil), c.CapAdd...)
+	}
+	if c.NoNewPrivileges != nil {
+		h.NoNewPrivileges = *c.NoNewPrivileges
+	}
+	if c.SeccompProfile != nil {
+		h.SeccompProfile = *c.SeccompProfile
+	}
+	return h
+}
+
+// GhostHardening returns the restrictions for command's ghost container:
+// the built-in defaults, then the policy's ghost.defaults, then its
+// ghost.commands entry.
+func (pe *PolicyEngine) GhostHardening(command string) executor.GhostHardening {
+	h := pe.config.Ghost.Defaults.apply(defaultGhostHardening)
+	if c, ok := pe.config.Ghost.Commands[command]; ok {
+		h = c.apply(h)
+	}
+	return h
+}
+
+// ChangeTracking reports whether command's changes to its workspace are
+// tracked when it runs in a ghost container, and how.
+func (pe *PolicyEngine) ChangeTracking(command string) (executor.ChangeTracking, bool) {
+	var enabled bool
+	var t executor.ChangeTracking
+	for _, c := range []GhostHardeningConfig{pe.config.Ghost.Defaults, pe.config.Ghost.Commands[command]} {
+		if c.TrackChanges != nil {
+			enabled = *c.TrackChanges
+		}
+		if c.TrackMaxFiles != nil {
+			t.MaxFiles = *c.TrackMaxFiles
+		}
+		if c.MaxFilesChanged != nil {
+			t.MaxFilesChanged = *c.MaxFilesChanged
+		}
+	}
+	return t, enabled
+}
+
+// OwnershipFix returns which workspace files are given back to the
+// requester after command runs in a ghost container: its ghost.commands
+// entry, then ghost.defaults, then "changed".
+func (pe *PolicyEngine) OwnershipFix(command string) executor.OwnershipFix {
+	if c, ok := pe.config.Ghost.Commands[command]; ok && c.OwnershipFix != "" {
+		return c.OwnershipFix
+	}
+	if fix := pe.config.Ghost.Defaults.OwnershipFix; fix != "" {
+		return fix
+	}
+	return executor.OwnershipFixChanged
+}
+
+// ghostStrategy returns where command runs when its rule sets no strategy:
+// its ghost.commands entry, then ghost.defaults. Empty means auto.
+func (pe *PolicyEngine) ghostStrategy(command string) executor.Strategy {
+	if c, ok := pe.config.Ghost.Commands[command]; ok && c.Strategy != "" {
+		return c.Strategy
+	}
+	return pe.config.Ghost.Defaults.Strategy
+}
+
+// validate checks the strategies in the ghost section.
+func (g GhostPolicy) validate() error {
+	if !g.Defaults.Strategy.Valid() {
+		return fmt.Errorf("ghost.defaults: strategy must be mirror, ghost, local or auto, got %q", g.Defaults.Strategy)
+	}
+	if err := g.Defaults.validateTracking(); err != nil {
+		return fmt.Errorf("ghost.defaults: %w", err)
+	}
+	for command, c := range g.Commands {
+		if !c.Strategy.Valid() {
+			return fmt.Errorf("ghost.commands.%s: strategy must be mirror, ghost, local or auto, got %q", command, c.Strategy)
+		}
+		if err := c.validateTracking(); err != nil {
+			return fmt.Errorf("ghost.commands.%s: %w", command, err)
+		}
+	}
+	return nil
+}
+
+// validateTracking checks the change tracking limits and ownership fix.
+func (c GhostHardeningConfig) validateTracking() error {
+	if !c.OwnershipFix.Valid() {
+		return fmt.Errorf("ownership_fix must be none, changed or all, got %q", c.OwnershipFix)
+	}
+	if c.TrackMaxFiles != nil && *c.TrackMaxFiles <= 0 {
+		return fmt.Errorf("track_max_files must be positive, got %d", *c.TrackMaxFiles)
+	}
+	if c.MaxFilesChanged != nil && *c.MaxFilesChanged < 0 {
+		return fmt.Errorf("max_files_changed must not be negative, got %d", *c.MaxFilesChanged)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package warden
+
+import (
+	"clawrden/internal/executor"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPolicyGhostHardening(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writeTestFile(t, path, `default_action: deny
+rules: []
+ghost:
+  defaults:
+    seccomp_profile: /etc/clawrden/seccomp.json
+  commands:
+    npm:
+      readonly_rootfs: false
+      cap_add: [CHOWN, SETUID]
+    docker:
+      cap_drop_all: false
+      no_new_privileges: false
+      seccomp_profile: ""
+`)
+	policy, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+
+	tests := []struct {
+		command string
+		want    executor.GhostHardening
+	}{
+		{"python", executor.GhostHardening{
+			ReadonlyRootfs: true, CapDropAll: true, NoNewPrivileges: true,
+			SeccompProfile: "/etc/clawrden/seccomp.json",
+		}},
+		{"npm", executor.GhostHardening{
+			CapDropAll: true, CapAdd: []string{"CHOWN", "SETUID"}, NoNewPrivileges: true,
+			SeccompProfile: "/etc/clawrden/seccomp.json",
+		}},
+		{"docker", executor.GhostHardening{ReadonlyRootfs: true}},
+	}
+	for _, tt := range tests {
+		if got := policy.GhostHardening(tt.command); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GhostHardening(%s) = %+v, want %+v", tt.command, got, tt.want)
+		}
+	}
+
+	// Without a ghost section every ghost is hardened
+	if got := DefaultPolicy().GhostHardening("npm"); !reflect.DeepEqual(got, defaultGhostHardening) {
+		t.Errorf("default GhostHardening = %+v", got)
+	}
+}
@@ -0,0 +1,258 @@
+package warden
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// LintSeverity decides what lint findings do to a policy load.
+type LintSeverity string
+
+const (
+	LintWarn  LintSeverity = "warn"  // Log findings and load the policy anyway
+	LintError LintSeverity = "error" // Refuse to load a policy with findings
+)
+
+// Lint checks, named in findings and logs.
+const (
+	LintWildcardAllow  = "wildcard-allow"  // An allow rule matches every command
+	LintShadowedAllow  = "shadowed-allow"  // An allow rule can never match
+	LintUnreachableAsk = "unreachable-ask" // An ask rule comes after an allow that matches first
+	LintDefaultAllow   = "default-allow"   // default_action allows unmatched commands
+)
+
+// LintFinding is a policy setting that is valid but probably a mistake.
+type LintFinding struct {
+	Check   string `json:"check"`
+	Jail    string `json:"jail,omitempty"` // Set for findings in a jail's rules
+	Rule    int    `json:"rule,omitempty"` // 1-based rule number, 0 for policy-wide findings
+	Message string `json:"message"`
+}
+
+func (f LintFinding) String() string {
+	var where string
+	if f.Jail != "" {
+		where = "jail " + f.Jail + " "
+	}
+	if f.Rule > 0 {
+		where += fmt.Sprintf("rule %d ", f.Rule)
+	}
+	return fmt.Sprintf("%s[%s]: %s", where, f.Check, f.Message)
+}
+
+// PolicyLintError is returned by LoadPolicy when lint is set to error and
+// the policy has findings.
+type PolicyLintError struct {
+	Findings []LintFinding
+}
+
+func (e *PolicyLintError) Error() string {
+	msgs := make([]string, len(e.Findings))
+	for i, f := range e.Findings {
+		msgs[i] = f.String()
+	}
+	return fmt.Sprintf("policy lint failed with %d finding(s): %s", len(e.Findings), strings.Join(msgs, "; "))
+}
+
+// validate checks the lint severity.
+func (s LintSeverity) validate() error {
+	switch s {
+	case "", LintWarn, LintError:
+		return nil
+	}
+	return fmt.Errorf("lint must be warn or error, got %q", s)
+}
+
+// LintPolicy returns the findings for config. Jail rules are checked on
+// their own, since they are evaluated before the global rules.
+func LintPolicy(config PolicyConfig) []LintFinding {
+	var findings []LintFinding
+	if config.DefaultAction == ActionAllow {
+		findings = append(findings, LintFinding{
+			Check:   LintDefaultAllow,
+			Message: "default_action: allow runs every command no rule matches",
+		})
+	}
+	findings = append(findings, lintRules("", config.Rules)...)
+
+	jailIDs := make([]string, 0, len(config.Jails))
+	for id := range config.Jails {
+		jailIDs = append(jailIDs, id)
+	}
+	sort.Strings(jailIDs)
+	for _, id := range jailIDs {
+		findings = append(findings, lintRules(id, config.Jails[id].Rules)...)
+	}
+	return findings
+}
+
+// logLintFindings writes each finding of a loaded policy to the log.
+func logLintFindings(logger *log.Logger, findings []LintFinding) {
+	for _, f := range findings {
+		logger.Printf("warning: policy lint: %s", f)
+	}
+}
+
+// lintRules checks one ordered rule list, first match wins.
+func lintRules(jail string, rules []Rule) []LintFinding {
+	var findings []LintFinding
+	add := func(check string, i int, format string, args ...interface{}) {
+		findings = append(findings, LintFinding{
+			Check:   check,
+			Jail:    jail,
+			Rule:    i + 1,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	for i, rule := range rules {
+		if rule.Action == ActionAllow && isWildcard(rule.Command) && len(rule.Args) == 0 {
+			add(LintWildcardAllow, i, "allow rule %q matches every command", rule.Command)
+		}
+		if rule.Action != ActionAllow && rule.Action != ActionAsk {
+			continue
+		}
+		for j, earlier := range rules[:i] {
+			if !ruleCovers(earlier, rule) {
+				continue
+			}
+			if rule.Action == ActionAllow {
+				add(LintShadowedAllow, i, "allow rule %q never matches: rule %d (%s %q) matches first",
+					rule.Command, j+1, earlier.Action, earlier.Command)
+				break
+			}
+			if earlier.Action == ActionAllow {
+				add(LintUnreachableAsk, i, "ask rule %q is unreachable: rule %d allows %q first",
+					rule.Command, j+1, earlier.Command)
+				break
+			}
+		}
+	}
+	return findings
+}
+
+// isWildcard reports whether a command pattern matches every command.
+func isWildcard(pattern string) bool {
+	return pattern != "" && strings.Trim(pattern, "*") == ""
+}
+
+// ruleCovers reports whether every request later matches, earlier matches
+// too. It only answers yes when that is certain, so overlapping globs with
+// different patterns are never reported.
+func ruleCovers(earlier, later Rule) bool {
+	switch {
+	case isWildcard(earlier.Command), earlier.Command == later.Command:
+	case !strings.ContainsAny(later.Command, `*?[\`) && matchCommand(earlier.Command, later.Command):
+	default:
+		return false
+	}
+
+	// Args match as substrings of the joined arguments, so an earlier
+	// pattern contained in every later pattern matches whenever later does
+	if len(earlier.Args) > 0 {
+		if len(later.Args) == 0 {
+			return false
+		}
+		for _, arg := range later.Args {
+			if !containsAny(arg, earlier.Args) {
+				return false
+			}
+		}
+	}
+
+	return coversList(earlier.Groups, later.Groups) &&
+		coversList(earlier.Image, later.Image) &&
+		coversList(earlier.ImageDigest, later.ImageDigest)
+}
+
+// coversList reports whether a condition list of an earlier rule (groups,
+// images) admits everything the later rule's list does: it is unset, or it
+// lists every later entry verbatim.
+func coversList(earlier, later []string) bool {
+	if len(earlier) == 0 {
+		return true
+	}
+	if len(later) == 0 {
+		return false
+	}
+	for _, v := range later {
+		if !containsString(earlier, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsAny reports whether s contains any of the substrings.
+func containsAny(s string, substrings []string) bool {
+	for _, sub := range substrings {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsString reports whether list contains s.
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// PolicyValidation is the outcome of checking the policy file the way a
+// reload would.
+type PolicyValidation struct {
+	Path     string        `json:"path,omitempty"`
+	Valid    bool          `json:"valid"` // Whether a reload would apply the file
+	Error    string        `json:"error,omitempty"`
+	Lint     LintSeverity  `json:"lint,omitempty"`
+	Findings []LintFinding `json:"findings"`
+
+	Tests        int                 `json:"tests"` // Policy tests run
+	TestFailures []PolicyTestFailure `json:"test_failures,omitempty"`
+}
+
+// ValidatePolicy loads the policy file without applying it and reports what
+// a reload would do. Without a policy file the running policy is linted.
+func (s *Server) ValidatePolicy() PolicyValidation {
+	v := PolicyValidation{Path: s.config.PolicyPath, Findings: []LintFinding{}}
+	policy, err := s.currentPolicy().engine, error(nil)
+	if v.Path != "" {
+		policy, err = LoadPolicy(v.Path)
+		if err == nil {
+			// A reload also rejects jails that cannot be set up
+			_, err = s.planJails(s.currentPolicy(), &policyState{engine: policy, jails: policy.GetJails()})
+		}
+	}
+
+	var lintErr *PolicyLintError
+	var testErr *PolicyTestError
+	switch {
+	case errors.As(err, &lintErr):
+		v.Error = err.Error()
+		v.Lint = LintError
+		v.Findings = lintErr.Findings
+	case errors.As(err, &testErr):
+		v.Error = fmt.Sprintf("%d of %d policy test(s) failed", len(testErr.Failures), testErr.Total)
+		v.Tests = testErr.Total
+		v.TestFailures = testErr.Failures
+	case err != nil:
+		v.Error = err.Error()
+	default:
+		v.Valid = true
+		v.Lint = policy.config.Lint
+		if v.Lint == "" {
+			v.Lint = LintWarn
+		}
+		v.Findings = append(v.Findings, policy.LintFindings()...)
+		v.Tests = policy.TestCount()
+	}
+	return v
+}
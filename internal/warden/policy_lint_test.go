@@ -0,0 +1,204 @@
+package warden
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLintPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		want   []string // "check@rule", jail findings prefixed with "jail/"
+	}{
+		{
+			name:   "clean",
+			policy: "rules:\n  - {command: ls, action: allow}\n  - {command: rm, action: ask}\n",
+		},
+		{
+			name:   "wildcard allow",
+			policy: "rules:\n  - {command: \"*\", action: allow}\n",
+			want:   []string{"wildcard-allow@1"},
+		},
+		{
+			name:   "wildcard allow with args is scoped",
+			policy: "rules:\n  - {command: \"*\", action: allow, args: [--version]}\n",
+		},
+		{
+			name:   "wildcard deny",
+			policy: "rules:\n  - {command: \"*\", action: deny}\n",
+		},
+		{
+			name:   "allow shadowed by broader allow",
+			policy: "rules:\n  - {command: git, action: allow}\n  - {command: git, action: allow, args: [status]}\n",
+			want:   []string{"shadowed-allow@2"},
+		},
+		{
+			name:   "allow shadowed by earlier deny glob",
+			policy: "rules:\n  - {command: \"py*\", action: deny}\n  - {command: python3, action: allow}\n",
+			want:   []string{"shadowed-allow@2"},
+		},
+		{
+			name:   "allow shadowed by shorter arg pattern",
+			policy: "rules:\n  - {command: git, action: deny, args: [push]}\n  - {command: git, action: allow, args: [push --dry-run]}\n",
+			want:   []string{"shadowed-allow@2"},
+		},
+		{
+			name:   "image-scoped deny does not shadow",
+			policy: "rules:\n  - {command: npm, action: deny, image: [\"node:*\"]}\n  - {command: npm, action: allow}\n",
+		},
+		{
+			name:   "allow shadowed by the same image",
+			policy: "rules:\n  - {command: npm, action: deny, image: [\"node:*\"]}\n  - {command: npm, action: allow, image: [\"node:*\"]}\n",
+			want:   []string{"shadowed-allow@2"},
+		},
+		{
+			name:   "narrower rule first is fine",
+			policy: "rules:\n  - {command: git, action: deny, args: [push]}\n  - {command: git, action: allow}\n",
+		},
+		{
+			name:   "group-scoped rule does not shadow everyone",
+			policy: "rules:\n  - {command: npm, action: deny, groups: [interns]}\n  - {command: npm, action: allow}\n",
+		},
+		{
+			name:   "different globs are not compared",
+			policy: "rules:\n  - {command: \"py*\", action: deny}\n  - {command: \"p*\", action: allow}\n",
+		},
+		{
+			name:   "ask after matching allow",
+			policy: "rules:\n  - {command: docker, action: allow}\n  - {command: docker, action: ask, args: [run]}\n",
+			want:   []string{"unreachable-ask@2"},
+		},
+		{
+			name:   "ask after deny",
+			policy: "rules:\n  - {command: docker, action: deny}\n  - {command: docker, action: ask}\n",
+		},
+		{
+			name:   "default allow",
+			policy: "default_action: allow\nrules:\n  - {command: rm, action: deny}\n",
+			want:   []string{"default-allow@0"},
+		},
+		{
+			name:   "wildcard swallows the rest",
+			policy: "rules:\n  - {command: \"*\", action: allow}\n  - {command: ls, action: allow}\n  - {command: rm, action: ask}\n",
+			want:   []string{"wildcard-allow@1", "shadowed-allow@2", "unreachable-ask@3"},
+		},
+		{
+			name:   "jail rules",
+			policy: "jails:\n  ci:\n    commands: [npm]\n    rules:\n      - {command: \"*\", action: allow}\n",
+			want:   []string{"ci/wildcard-allow@1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pe, err := LoadPolicy(writePolicy(t, tt.policy))
+			if err != nil {
+				t.Fatalf("LoadPolicy: %v", err)
+			}
+			var got []string
+			for _, f := range pe.LintFindings() {
+				id := fmt.Sprintf("%s@%d", f.Check, f.Rule)
+				if f.Jail != "" {
+					id = f.Jail + "/" + id
+				}
+				got = append(got, id)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findings = %v, want %v\n%+v", got, tt.want, pe.LintFindings())
+			}
+		})
+	}
+}
+
+func TestLintErrorRefusesLoad(t *testing.T) {
+	path := writePolicy(t, "lint: error\nrules:\n  - {command: \"*\", action: allow}\n")
+	_, err := LoadPolicy(path)
+	var lintErr *PolicyLintError
+	if !errors.As(err, &lintErr) || len(lintErr.Findings) != 1 || lintErr.Findings[0].Check != LintWildcardAllow {
+		t.Fatalf("LoadPolicy error = %v, want a wildcard-allow lint error", err)
+	}
+
+	// A clean policy loads with lint: error
+	if _, err := LoadPolicy(writePolicy(t, "lint: error\nrules:\n  - {command: ls, action: allow}\n")); err != nil {
+		t.Errorf("clean policy: %v", err)
+	}
+	if _, err := LoadPolicy(writePolicy(t, "lint: strict\n")); err == nil || !strings.Contains(err.Error(), "strict") {
+		t.Errorf("unknown severity: err = %v", err)
+	}
+}
+
+func TestLintErrorRefusesReload(t *testing.T) {
+	path := writePolicy(t, "rules:\n  - {command: ls, action: allow}\n")
+	original, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw, err := NewPolicyWatcher(path, original, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pw.watcher.Close()
+
+	os.WriteFile(path, []byte("lint: error\ndefault_action: allow\n"), 0644)
+	if err := pw.handlePolicyChange(); err == nil {
+		t.Fatal("reload of a policy failing lint succeeded")
+	}
+	if pw.GetPolicy() != original {
+		t.Error("policy replaced after a refused reload")
+	}
+}
+
+func TestPolicyValidateAPI(t *testing.T) {
+	api, _ := newTestAPIServer(t, Config{})
+	path := writePolicy(t, "default_action: allow\n")
+	api.warden.config.PolicyPath = path
+
+	validate := func() PolicyValidation {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		api.handlePolicyValidate(rec, httptest.NewRequest(http.MethodGet, "/api/policy/validate", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+		}
+		var v PolicyValidation
+		if err := json.NewDecoder(rec.Body).Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	v := validate()
+	if !v.Valid || v.Lint != LintWarn || len(v.Findings) != 1 || v.Findings[0].Check != LintDefaultAllow {
+		t.Errorf("warn policy: %+v", v)
+	}
+
+	os.WriteFile(path, []byte("lint: error\ndefault_action: allow\n"), 0644)
+	if v := validate(); v.Valid || v.Lint != LintError || len(v.Findings) != 1 || v.Error == "" {
+		t.Errorf("error policy: %+v", v)
+	}
+
+	os.WriteFile(path, []byte("rules: [\n"), 0644)
+	if v := validate(); v.Valid || v.Error == "" || len(v.Findings) != 0 {
+		t.Errorf("broken policy: %+v", v)
+	}
+}
+
+// writePolicy writes a policy file into a temporary directory.
+func writePolicy(t *testing.T, policy string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte(policy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
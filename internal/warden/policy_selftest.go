@@ -0,0 +1,161 @@
+package warden
+
+import (
+	"clawrden/pkg/protocol"
+	"fmt"
+	"strings"
+)
+
+// PolicyTest is an example invocation from the policy's tests section and
+// the action the policy must decide for it.
+type PolicyTest struct {
+	Name        string   `yaml:"name,omitempty"`
+	Command     string   `yaml:"command"`
+	Args        []string `yaml:"args,omitempty"`
+	Cwd         string   `yaml:"cwd,omitempty"`          // Checked against allowed_paths when set
+	Container   string   `yaml:"container,omitempty"`    // Container ID; empty for a request from the host
+	Image       string   `yaml:"image,omitempty"`        // Image of the container; empty when unknown
+	ImageDigest string   `yaml:"image_digest,omitempty"` // Image ID of the container
+	Jail        string   `yaml:"jail,omitempty"`         // Jail the request comes through
+	Expect      Action   `yaml:"expect"`
+
+	// Identity of the caller; groups are names or GIDs
+	UID    int      `yaml:"uid,omitempty"`
+	GID    int      `yaml:"gid,omitempty"`
+	Groups []string `yaml:"groups,omitempty"`
+}
+
+// String describes the invocation, e.g. "pip install requests in /app".
+func (t PolicyTest) String() string {
+	s := strings.Join(append([]string{t.Command}, t.Args...), " ")
+	if t.Cwd != "" {
+		s += " in " + t.Cwd
+	}
+	if t.Image != "" {
+		s += " in image " + t.Image
+	}
+	if t.Jail != "" {
+		s += " from jail " + t.Jail
+	}
+	return s
+}
+
+// request builds the request the test stands for.
+func (t PolicyTest) request() (*protocol.Request, error) {
+	req := &protocol.Request{
+		Command:     t.Command,
+		Args:        t.Args,
+		Cwd:         t.Cwd,
+		Identity:    protocol.Identity{UID: t.UID, GID: t.GID},
+		ContainerID: t.Container,
+		Image:       t.Image,
+		ImageDigest: t.ImageDigest,
+		JailID:      t.Jail,
+	}
+	db := loadGroupDB()
+	for _, g := range t.Groups {
+		gid, ok := db.lookup(g)
+		if !ok {
+			return nil, fmt.Errorf("unknown group %q", g)
+		}
+		req.Identity.Groups = append(req.Identity.Groups, gid)
+	}
+	return req, nil
+}
+
+// PolicyTestFailure is a policy test whose expected action the policy does
+// not decide.
+type PolicyTestFailure struct {
+	Test       int    `json:"test"` // 1-based
+	Name       string `json:"name,omitempty"`
+	Invocation string `json:"invocation"`
+	Expected   Action `json:"expected"`
+	Actual     Action `json:"actual"`
+	Rule       string `json:"rule"` // What decided the actual action
+}
+
+func (f PolicyTestFailure) String() string {
+	name := fmt.Sprintf("test %d", f.Test)
+	if f.Name != "" {
+		name += fmt.Sprintf(" (%s)", f.Name)
+	}
+	return fmt.Sprintf("%s: %s\n  expected: %s\n  actual:   %s by %s", name, f.Invocation, f.Expected, f.Actual, f.Rule)
+}
+
+// PolicyTestError is returned by LoadPolicy when the policy fails its own
+// tests.
+type PolicyTestError struct {
+	Total    int
+	Failures []PolicyTestFailure
+}
+
+func (e *PolicyTestError) Error() string {
+	msgs := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		msgs[i] = f.String()
+	}
+	return fmt.Sprintf("%d of %d policy test(s) failed:\n%s", len(e.Failures), e.Total, strings.Join(msgs, "\n"))
+}
+
+// validateTests checks that every test can be run.
+func validateTests(tests []PolicyTest) error {
+	for i, t := range tests {
+		if t.Command == "" {
+			return fmt.Errorf("test %d: command is required", i+1)
+		}
+		switch t.Expect {
+		case ActionAllow, ActionDeny, ActionAsk:
+		default:
+			return fmt.Errorf("test %d (%s): expect must be allow, deny or ask, got %q", i+1, t.Command, t.Expect)
+		}
+		if _, err := t.request(); err != nil {
+			return fmt.Errorf("test %d (%s): %w", i+1, t.Command, err)
+		}
+	}
+	return nil
+}
+
+// TestCount returns the number of tests in the policy.
+func (pe *PolicyEngine) TestCount() int {
+	return len(pe.config.Tests)
+}
+
+// RunTests evaluates the policy's tests and returns the ones that fail. A
+// cwd outside allowed_paths is denied, as the warden denies such requests
+// before evaluating the rules.
+func (pe *PolicyEngine) RunTests() []PolicyTestFailure {
+	var failures []PolicyTestFailure
+	for i, t := range pe.config.Tests {
+		req, err := t.request()
+		if err != nil {
+			continue // Rejected by validateTests
+		}
+
+		var actual Action
+		var rule string
+		if t.Cwd != "" {
+			if err := pe.ValidatePath(t.Cwd); err != nil {
+				actual, rule = ActionDeny, "allowed_paths"
+			}
+		}
+		if actual == "" {
+			result := pe.Evaluate(req)
+			actual, rule = result.Action, result.MatchedRule
+			if rule == "" {
+				rule = "default_action"
+			}
+		}
+
+		if actual != t.Expect {
+			failures = append(failures, PolicyTestFailure{
+				Test:       i + 1,
+				Name:       t.Name,
+				Invocation: t.String(),
+				Expected:   t.Expect,
+				Actual:     actual,
+				Rule:       rule,
+			})
+		}
+	}
+	return failures
+}
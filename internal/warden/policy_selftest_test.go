@@ -0,0 +1,167 @@
+package warden
+
+import (
+	"errors"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const selfTestPolicy = `
+default_action: deny
+allowed_paths: ["/app/*"]
+jails:
+  ci:
+    commands: [npm]
+    rules:
+      - command: npm
+        action: allow
+rules:
+  - command: ls
+    action: allow
+  - command: pip
+    args: ["install", "*"]
+    action: ask
+  - command: npm
+    action: ask
+`
+
+func TestPolicyTestsPass(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writeTestFile(t, path, selfTestPolicy+`
+tests:
+  - command: ls
+    cwd: /app/src
+    expect: allow
+  - name: installs need review
+    command: pip
+    args: [install, requests]
+    expect: ask
+  - command: ls
+    cwd: /etc
+    expect: deny
+  - command: npm
+    args: [test]
+    jail: ci
+    expect: allow
+  - command: npm
+    args: [test]
+    expect: ask
+  - command: rm
+    expect: deny
+`)
+	pe, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+	if pe.TestCount() != 6 {
+		t.Errorf("TestCount = %d, want 6", pe.TestCount())
+	}
+}
+
+func TestPolicyTestsFail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writeTestFile(t, path, selfTestPolicy+`
+tests:
+  - command: ls
+    expect: allow
+  - name: pip is allowed
+    command: pip
+    args: [install, requests]
+    expect: allow
+  - command: npm
+    jail: ci
+    expect: deny
+  - command: rm
+    expect: ask
+`)
+	_, err := LoadPolicy(path)
+	var testErr *PolicyTestError
+	if !errors.As(err, &testErr) {
+		t.Fatalf("LoadPolicy error = %v, want a PolicyTestError", err)
+	}
+	want := []PolicyTestFailure{
+		{Test: 2, Name: "pip is allowed", Invocation: "pip install requests", Expected: ActionAllow, Actual: ActionAsk, Rule: "rule 2 (pip)"},
+		{Test: 3, Invocation: "npm from jail ci", Expected: ActionDeny, Actual: ActionAllow, Rule: "jail ci rule 1 (npm)"},
+		{Test: 4, Invocation: "rm", Expected: ActionAsk, Actual: ActionDeny, Rule: "default_action"},
+	}
+	if testErr.Total != 4 || len(testErr.Failures) != len(want) {
+		t.Fatalf("failures = %+v of %d, want %d of 4", testErr.Failures, testErr.Total, len(want))
+	}
+	for i, f := range testErr.Failures {
+		if f != want[i] {
+			t.Errorf("failure %d = %+v, want %+v", i, f, want[i])
+		}
+	}
+	if !strings.Contains(err.Error(), "expected: allow\n  actual:   ask by rule 2 (pip)") {
+		t.Errorf("error does not show the diff: %v", err)
+	}
+}
+
+func TestPolicyTestsValidated(t *testing.T) {
+	tests := []struct {
+		name    string
+		tests   string
+		wantErr string
+	}{
+		{"missing command", "  - expect: allow\n", "command is required"},
+		{"unknown action", "  - command: ls\n    expect: maybe\n", "expect must be allow, deny or ask"},
+		{"unknown group", "  - command: ls\n    groups: [no-such-group-xyz]\n    expect: allow\n", `unknown group "no-such-group-xyz"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.yaml")
+			writeTestFile(t, path, selfTestPolicy+"tests:\n"+tt.tests)
+			if _, err := LoadPolicy(path); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadPolicy error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyReloadKeepsPolicyWhenTestsFail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writeTestFile(t, path, selfTestPolicy+"tests:\n  - command: ls\n    expect: allow\n")
+	policy, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+	pw, err := NewPolicyWatcher(path, policy, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("NewPolicyWatcher: %v", err)
+	}
+	defer pw.watcher.Close()
+
+	// ls is no longer allowed, which its test catches
+	writeTestFile(t, path, strings.Replace(selfTestPolicy, "ls\n    action: allow", "ls\n    action: ask", 1)+
+		"tests:\n  - command: ls\n    expect: allow\n")
+	if err := pw.handlePolicyChange(); err == nil || !strings.Contains(err.Error(), "1 of 1 policy test(s) failed") {
+		t.Errorf("handlePolicyChange error = %v, want the failed test", err)
+	}
+	if pw.GetPolicy() != policy {
+		t.Error("reload replaced the policy despite a failing test")
+	}
+}
+
+func TestValidatePolicyReportsTestFailures(t *testing.T) {
+	srv := newTestServer(t)
+	srv.config.PolicyPath = filepath.Join(t.TempDir(), "policy.yaml")
+	writeTestFile(t, srv.config.PolicyPath, selfTestPolicy+"tests:\n  - command: rm\n    expect: allow\n  - command: ls\n    expect: allow\n")
+
+	v := srv.ValidatePolicy()
+	if v.Valid || v.Tests != 2 || len(v.TestFailures) != 1 || v.TestFailures[0].Rule != "default_action" {
+		t.Errorf("validation = %+v, want test 1 failing", v)
+	}
+}
+
+func TestShippedPolicyPassesItsTests(t *testing.T) {
+	pe, err := LoadPolicy("../../policy.yaml")
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+	if pe.TestCount() == 0 {
+		t.Error("the shipped policy has no tests")
+	}
+}
@@ -0,0 +1,174 @@
+package warden
+
+import (
+	"clawrden/pkg/protocol"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxShellDepth bounds how deeply nested "sh -c" scripts are split.
+const maxShellDepth = 4
+
+// shellInert are builtins that run nothing and are not evaluated. cd is
+// not one of them: it moves every later command out of the request's cwd.
+var shellInert = map[string]bool{
+	"true": true, "false": true, ":": true,
+}
+
+// SubcommandDecision is the policy decision for one command of a shell script.
+type SubcommandDecision struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+	Action  Action   `json:"action"`
+}
+
+// evaluateShell splits "<shell> -c <script>" requests for shells listed in
+// shell_commands and evaluates every command in the script. The result takes
+// the most restrictive action, the summed exec timeouts, the tightest review
+// and total limits, and the first sandbox and URL violation found. ok is
+// false when the request is not a shell script or the script cannot be split
+// safely; the shell's own rule applies then.
+func (pe *PolicyEngine) evaluateShell(req *protocol.Request, rules []Rule, depth int) (EvaluationResult, bool) {
+	if depth >= maxShellDepth || !pe.isShell(filepath.Base(req.Command)) {
+		return EvaluationResult{}, false
+	}
+	script, ok := shellScript(req.Args)
+	if !ok {
+		return EvaluationResult{}, false
+	}
+	commands, err := SplitShellScript(script)
+	if err != nil {
+		return EvaluationResult{}, false
+	}
+
+	var result EvaluationResult
+	for _, cmd := range commands {
+		if shellInert[cmd.Name] {
+			continue
+		}
+
+		sub := *req
+		sub.Command = cmd.Name
+		sub.Args = cmd.Args
+		r := pe.evaluate(&sub, rules, depth+1)
+
+		// The first command with the strictest action names the rule
+		if len(result.Subcommands) == 0 || stricterAction(result.Action, r.Action) != result.Action {
+			result.Action = r.Action
+			result.rule = r.rule
+		}
+		result.ExecTimeout += r.ExecTimeout
+		result.HITLTimeout = tighterLimit(result.HITLTimeout, r.HITLTimeout)
+		result.TotalTimeout = tighterLimit(result.TotalTimeout, r.TotalTimeout)
+		if result.Sandbox == nil {
+			result.Sandbox = r.Sandbox
+		}
+		result.URLHosts = append(result.URLHosts, r.URLHosts...)
+		if result.URLViolation == "" {
+			result.URLViolation = r.URLViolation
+		}
+		if r.Action == ActionDeny && r.RuleMatched {
+			result.RuleMatched = true
+		}
+		result.Transcript = result.Transcript || r.Transcript
+		result.UnmarkedEnv = result.UnmarkedEnv || r.UnmarkedEnv
+		result.MaxStdoutBytes = tighterLimit(result.MaxStdoutBytes, r.MaxStdoutBytes)
+		result.TailOnTruncate = max(result.TailOnTruncate, r.TailOnTruncate)
+		result.Trailer = result.Trailer || r.Trailer
+		result.Priority = lowerPriority(result.Priority, r.Priority)
+		if r.Action == ActionAsk {
+			result.Risk = higherRisk(result.Risk, pe.riskTier(r.Risk))
+		}
+		// Hooks run around the whole script, with their command's args
+		result.Pre = append(result.Pre, bindHookArgs(r.Pre, cmd.Args)...)
+		result.Post = append(result.Post, bindHookArgs(r.Post, cmd.Args)...)
+
+		// Nested scripts contribute their own commands, not the shell
+		if len(r.Subcommands) > 0 {
+			result.Subcommands = append(result.Subcommands, r.Subcommands...)
+		} else {
+			result.Subcommands = append(result.Subcommands, SubcommandDecision{
+				Command: cmd.Name,
+				Args:    cmd.Args,
+				Action:  r.Action,
+			})
+		}
+	}
+
+	// A script of only builtins and assignments has nothing to decide on
+	if len(result.Subcommands) == 0 {
+		return EvaluationResult{}, false
+	}
+	return result, true
+}
+
+// isShell reports whether command is listed in shell_commands.
+func (pe *PolicyEngine) isShell(command string) bool {
+	for _, shell := range pe.config.ShellCommands {
+		if shell == command {
+			return true
+		}
+	}
+	return false
+}
+
+// shellScript finds the script of a "-c" invocation among a shell's args,
+// allowing combined short options ("-ec", "-lc") and "-o option" pairs
+// before it.
+func shellScript(args []string) (string, bool) {
+	hasC := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			if hasC && i+1 < len(args) {
+				return args[i+1], true
+			}
+			return "", false
+		case arg == "-o" || arg == "+o":
+			i++ // Skip the option name
+		case strings.HasPrefix(arg, "--"):
+			// Long options such as --norc or --login take no value
+		case len(arg) > 1 && (arg[0] == '-' || arg[0] == '+'):
+			if arg[0] == '-' && strings.ContainsRune(arg[1:], 'c') {
+				hasC = true
+			}
+		default:
+			if hasC {
+				return arg, true
+			}
+			return "", false
+		}
+	}
+	return "", false
+}
+
+// actionRank orders actions from least to most restrictive. Unknown
+// actions rank as deny.
+func actionRank(a Action) int {
+	switch a {
+	case ActionAllow:
+		return 0
+	case ActionAsk:
+		return 1
+	}
+	return 2
+}
+
+// tighterLimit returns the smaller of two time or size limits, where 0 is
+// none.
+func tighterLimit[T time.Duration | int64](a, b T) T {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// stricterAction returns the more restrictive of two actions.
+func stricterAction(a, b Action) Action {
+	if actionRank(b) > actionRank(a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,114 @@
+package warden
+
+import (
+	"clawrden/internal/events"
+	"clawrden/internal/jailhouse"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// policyState is the policy in force: the engine and the jails it defines.
+// A reload builds and validates a complete new state before swapping it in
+// through one pointer, and each request reads that pointer once, so no
+// request sees the rules of one policy with the jails of another, and a
+// reload that fails changes nothing.
+type policyState struct {
+	engine *PolicyEngine
+	jails  map[string]JailConfig
+}
+
+// jailStep is one change a new policy makes to the jailhouse.
+type jailStep struct {
+	jailID string
+	config JailConfig
+	create bool // Create the jail; otherwise set its commands
+}
+
+// currentPolicy returns the policy in force. Read it once per request.
+func (s *Server) currentPolicy() *policyState {
+	if st := s.policy.Load(); st != nil {
+		return st
+	}
+	return &policyState{}
+}
+
+// setPolicy puts engine in force without touching the jailhouse.
+func (s *Server) setPolicy(engine *PolicyEngine) {
+	s.policy.Store(&policyState{engine: engine, jails: engine.GetJails()})
+}
+
+// applyPolicy puts a newly loaded engine in force and brings the jailhouse
+// in line with the jails it defines: jails it adds are created, and jails
+// whose commands it changes are reconciled. The plan is checked before
+// anything changes; a policy whose jails cannot be set up is rejected. Jails
+// the policy no longer defines are left in the jailhouse.
+func (s *Server) applyPolicy(engine *PolicyEngine) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	old := s.currentPolicy()
+	next := &policyState{engine: engine, jails: engine.GetJails()}
+	plan, err := s.planJails(old, next)
+	if err != nil {
+		return err
+	}
+	s.policy.Store(next)
+	s.applyJailPlan(plan)
+	return nil
+}
+
+// planJails works out the jailhouse changes that take it from old's jails
+// to next's, and checks that they can be made.
+func (s *Server) planJails(old, next *policyState) ([]jailStep, error) {
+	ids := make([]string, 0, len(next.jails))
+	for jailID := range next.jails {
+		ids = append(ids, jailID)
+	}
+	sort.Strings(ids)
+
+	var plan []jailStep
+	for _, jailID := range ids {
+		cfg := next.jails[jailID]
+		for _, cmd := range cfg.Commands {
+			if err := jailhouse.ValidateCommandName(cmd); err != nil {
+				return nil, fmt.Errorf("jail %s: invalid command %q: %w", jailID, cmd, err)
+			}
+		}
+		if s.jailhouse == nil {
+			continue
+		}
+		if _, err := s.jailhouse.GetJail(jailID); err != nil {
+			plan = append(plan, jailStep{jailID: jailID, config: cfg, create: true})
+			continue
+		}
+		// Jails the policy did not change keep their commands, pruned or not
+		if prev, ok := old.jails[jailID]; ok && !slices.Equal(prev.Commands, cfg.Commands) {
+			plan = append(plan, jailStep{jailID: jailID, config: cfg})
+		}
+	}
+	return plan, nil
+}
+
+// applyJailPlan makes the jailhouse changes of a plan. Failures are logged;
+// the policy is already in force.
+func (s *Server) applyJailPlan(plan []jailStep) {
+	for _, step := range plan {
+		if step.create {
+			if err := s.jailhouse.CreateJail(step.jailID, step.config.Commands, step.config.Hardened); err != nil {
+				s.logger.Printf("warning: failed to create jail %s: %v", step.jailID, err)
+				continue
+			}
+			s.logger.Printf("created jail %s: %v", step.jailID, step.config.Commands)
+			s.events.Publish(events.JailChanged{JailID: step.jailID, Change: "created", Source: "policy"})
+			continue
+		}
+		change, err := s.jailhouse.ReconcileJail(step.jailID, step.config.Commands, false)
+		s.recordJailChange("update", "policy", change, err)
+		if err != nil {
+			s.logger.Printf("warning: failed to reconcile jail %s: %v", step.jailID, err)
+			continue
+		}
+		s.events.Publish(events.JailChanged{JailID: step.jailID, Change: "reconciled", Source: "policy"})
+	}
+}
@@ -0,0 +1,142 @@
+package warden
+
+import (
+	"clawrden/internal/jailhouse"
+	"clawrden/pkg/protocol"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// versionedPolicy is policy version n: jail ci runs tool-n, which its jail
+// rule allows, and the global rule's reason names the version.
+func versionedPolicy(n int) string {
+	return fmt.Sprintf(`default_action: deny
+jails:
+  ci:
+    commands: [tool-%d]
+    rules:
+      - command: tool-%d
+        action: allow
+rules:
+  - command: version
+    action: deny
+    reason: "%d"
+`, n, n, n)
+}
+
+// policyVersion returns the version of a versionedPolicy engine.
+func policyVersion(t *testing.T, engine *PolicyEngine) int {
+	n, err := strconv.Atoi(engine.config.Rules[0].Reason)
+	if err != nil {
+		t.Fatalf("policy version: %v", err)
+	}
+	return n
+}
+
+func TestPolicyReloadIsAtomic(t *testing.T) {
+	dir := t.TempDir()
+	mgr, err := jailhouse.NewManager(jailhouse.Config{
+		ArmoryPath:    filepath.Join(dir, "armory"),
+		JailhousePath: filepath.Join(dir, "jailhouse"),
+		StatePath:     filepath.Join(dir, "state.json"),
+		Logger:        log.New(io.Discard, "", 0),
+	})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	srv := newTestServer(t)
+	srv.jailhouse = mgr
+
+	path := filepath.Join(dir, "policy.yaml")
+	writeTestFile(t, path, versionedPolicy(0))
+	policy, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+	srv.setPolicy(policy)
+	if err := srv.applyPolicy(policy); err != nil {
+		t.Fatalf("applyPolicy: %v", err)
+	}
+	watcher, err := NewPolicyWatcher(path, policy, srv.logger)
+	if err != nil {
+		t.Fatalf("NewPolicyWatcher: %v", err)
+	}
+	defer watcher.Stop()
+	watcher.SetApply(srv.applyPolicy)
+
+	// Requests run the way handleConnection does, against one read of the
+	// policy, while reloads come in
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			last := 0
+			for !stop.Load() {
+				state := srv.currentPolicy()
+				version := policyVersion(t, state.engine)
+				if version < last {
+					t.Errorf("policy went back from version %d to %d", last, version)
+				}
+				last = version
+
+				tool := fmt.Sprintf("tool-%d", version)
+				if cmds := state.jails["ci"].Commands; len(cmds) != 1 || cmds[0] != tool {
+					t.Errorf("policy version %d has jail commands %v", version, cmds)
+				}
+				req := &protocol.Request{Command: tool, JailID: "ci"}
+				srv.resolveJail(state, req)
+				result := state.engine.EvaluateInJail(req, srv.jailRules(state, req.JailID))
+				if result.Action != ActionAllow || !strings.HasPrefix(result.MatchedRule, "jail ci") {
+					t.Errorf("policy version %d: %s decided %s by %q, want allow by the jail rule", version, tool, result.Action, result.MatchedRule)
+				}
+			}
+		}()
+	}
+
+	valid := 0
+	for i := 1; i <= 60; i++ {
+		before := srv.currentPolicy()
+		switch i % 3 {
+		case 0:
+			writeTestFile(t, path, "rules: [") // Does not parse
+		case 1:
+			// Loads, but the jail cannot be set up
+			writeTestFile(t, path, strings.Replace(versionedPolicy(i), "commands: [tool-", "commands: [../tool-", 1))
+		default:
+			writeTestFile(t, path, versionedPolicy(i))
+			if err := watcher.handlePolicyChange(); err != nil {
+				t.Fatalf("reload of version %d: %v", i, err)
+			}
+			valid = i
+			continue
+		}
+		if err := watcher.handlePolicyChange(); err == nil {
+			t.Fatalf("invalid reload %d succeeded", i)
+		}
+		if srv.currentPolicy() != before || watcher.GetPolicy() != before.engine {
+			t.Fatalf("invalid reload %d changed the policy", i)
+		}
+	}
+	stop.Store(true)
+	wg.Wait()
+
+	if got := policyVersion(t, srv.currentPolicy().engine); got != valid {
+		t.Errorf("policy version = %d, want %d", got, valid)
+	}
+	jail, err := mgr.GetJail("ci")
+	if err != nil {
+		t.Fatalf("GetJail: %v", err)
+	}
+	if want := fmt.Sprintf("tool-%d", valid); len(jail.Commands) != 1 || jail.Commands[0] != want {
+		t.Errorf("jail commands = %v, want [%s]", jail.Commands, want)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -14,12 +15,15 @@ import (
 // PolicyWatcher watches the policy file for changes and triggers hot-reload.
 type PolicyWatcher struct {
 	policyPath string
-	policy     *PolicyEngine
+	policy     atomic.Pointer[PolicyEngine] // Last policy loaded and applied
 	watcher    *fsnotify.Watcher
 	logger     *log.Logger
 
 	mu       sync.RWMutex
-	onReload []func(*PolicyEngine) // Callbacks to invoke on policy reload
+	apply    func(*PolicyEngine) error // Puts a loaded policy in force; an error rejects it
+	onReload []func(*PolicyEngine)     // Callbacks to invoke on policy reload
+
+	reloading sync.Mutex // One reload at a time, so an older one never lands last
 
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -33,13 +37,14 @@ func NewPolicyWatcher(policyPath string, policy *PolicyEngine, logger *log.Logge
 		return nil, fmt.Errorf("create fsnotify watcher: %w", err)
 	}
 
-	return &PolicyWatcher{
+	pw := &PolicyWatcher{
 		policyPath: policyPath,
-		policy:     policy,
 		watcher:    watcher,
 		logger:     logger,
 		onReload:   make([]func(*PolicyEngine), 0),
-	}, nil
+	}
+	pw.policy.Store(policy)
+	return pw, nil
 }
 
 // Start begins watching the policy file for changes.
@@ -82,6 +87,15 @@ func (pw *PolicyWatcher) Stop() error {
 	return nil
 }
 
+// SetApply sets the function that puts each reloaded policy in force before
+// GetPolicy returns it and the OnReload callbacks run. If it fails, the
+// reload is rejected and nothing changes.
+func (pw *PolicyWatcher) SetApply(apply func(*PolicyEngine) error) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	pw.apply = apply
+}
+
 // OnReload registers a callback to be invoked when the policy is reloaded.
 func (pw *PolicyWatcher) OnReload(callback func(*PolicyEngine)) {
 	pw.mu.Lock()
@@ -136,6 +150,8 @@ func (pw *PolicyWatcher) watchLoop() {
 
 // handlePolicyChange reloads the policy.
 func (pw *PolicyWatcher) handlePolicyChange() error {
+	pw.reloading.Lock()
+	defer pw.reloading.Unlock()
 	pw.logger.Printf("reloading policy from %s", pw.policyPath)
 
 	// Load new policy
@@ -143,15 +159,39 @@ func (pw *PolicyWatcher) handlePolicyChange() error {
 	if err != nil {
 		return fmt.Errorf("load policy: %w", err)
 	}
+	logLintFindings(pw.logger, newPolicy.LintFindings())
+	if err := pw.install(newPolicy); err != nil {
+		return err
+	}
+	pw.logger.Printf("policy reloaded successfully")
+	return nil
+}
 
-	// Update policy reference
-	pw.mu.Lock()
-	pw.policy = newPolicy
+// Install puts a policy loaded from the watched file in force as a reload
+// would, for callers that wrote the file themselves and need not wait for
+// the watcher to notice.
+func (pw *PolicyWatcher) Install(newPolicy *PolicyEngine) error {
+	pw.reloading.Lock()
+	defer pw.reloading.Unlock()
+	return pw.install(newPolicy)
+}
+
+// install applies newPolicy and runs the reload callbacks. The caller holds
+// pw.reloading.
+func (pw *PolicyWatcher) install(newPolicy *PolicyEngine) error {
+	pw.mu.RLock()
+	apply := pw.apply
 	callbacks := make([]func(*PolicyEngine), len(pw.onReload))
 	copy(callbacks, pw.onReload)
-	pw.mu.Unlock()
+	pw.mu.RUnlock()
 
-	pw.logger.Printf("policy reloaded successfully")
+	// Nothing changes unless the policy can be put in force
+	if apply != nil {
+		if err := apply(newPolicy); err != nil {
+			return fmt.Errorf("apply policy: %w", err)
+		}
+	}
+	pw.policy.Store(newPolicy)
 
 	// Invoke callbacks
 	for _, callback := range callbacks {
@@ -163,7 +203,5 @@ func (pw *PolicyWatcher) handlePolicyChange() error {
 
 // GetPolicy returns the current policy (thread-safe).
 func (pw *PolicyWatcher) GetPolicy() *PolicyEngine {
-	pw.mu.RLock()
-	defer pw.mu.RUnlock()
-	return pw.policy
+	return pw.policy.Load()
 }
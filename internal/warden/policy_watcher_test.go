@@ -39,7 +39,7 @@ rules:
 		t.Errorf("policyPath = %s, want %s", watcher.policyPath, policyPath)
 	}
 
-	if watcher.policy == nil {
+	if watcher.GetPolicy() == nil {
 		t.Error("policy should not be nil")
 	}
 }
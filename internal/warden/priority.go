@@ -0,0 +1,68 @@
+package warden
+
+import (
+	"clawrden/internal/executor"
+	"clawrden/pkg/protocol"
+	"cmp"
+	"fmt"
+)
+
+// defaultIONiceLevel is a best-effort rule's ionice_level unless it sets
+// one, the kernel's default for nice 0.
+const defaultIONiceLevel = 4
+
+// priority returns the scheduling priority the rule lowers its command to,
+// or nil if it sets none.
+func (r Rule) priority() *protocol.Priority {
+	if r.Nice == 0 && r.IONiceClass == "" {
+		return nil
+	}
+	p := &protocol.Priority{Nice: r.Nice, IOClass: r.IONiceClass}
+	if p.IOClass == protocol.IOClassBestEffort {
+		p.IOLevel = defaultIONiceLevel
+		if r.IONiceLevel != nil {
+			p.IOLevel = *r.IONiceLevel
+		}
+	}
+	return p
+}
+
+// validatePriority checks a rule's nice and ionice settings.
+func (r Rule) validatePriority() error {
+	if r.Nice < 0 || r.Nice > executor.MaxNice {
+		return fmt.Errorf("nice must be between 0 and %d, got %d", executor.MaxNice, r.Nice)
+	}
+	switch r.IONiceClass {
+	case "", protocol.IOClassBestEffort, protocol.IOClassIdle:
+	default:
+		return fmt.Errorf("ionice_class must be best-effort or idle, got %q", r.IONiceClass)
+	}
+	if r.IONiceLevel != nil {
+		if r.IONiceClass != protocol.IOClassBestEffort {
+			return fmt.Errorf("ionice_level needs ionice_class: best-effort")
+		}
+		if *r.IONiceLevel < 0 || *r.IONiceLevel > executor.MaxIOLevel {
+			return fmt.Errorf("ionice_level must be between 0 and %d, got %d", executor.MaxIOLevel, *r.IONiceLevel)
+		}
+	}
+	return nil
+}
+
+// lowerPriority returns the lower of two scheduling priorities, field by
+// field: the higher nice value, and the idle IO class over best-effort at
+// the higher level. nil is none.
+func lowerPriority(a, b *protocol.Priority) *protocol.Priority {
+	if a == nil || b == nil {
+		return cmp.Or(a, b)
+	}
+	p := *a
+	p.Nice = max(a.Nice, b.Nice)
+	switch {
+	case p.IOClass == protocol.IOClassIdle:
+	case b.IOClass == protocol.IOClassIdle, p.IOClass == "":
+		p.IOClass, p.IOLevel = b.IOClass, b.IOLevel
+	case b.IOClass == protocol.IOClassBestEffort:
+		p.IOLevel = max(p.IOLevel, b.IOLevel)
+	}
+	return &p
+}
@@ -0,0 +1,69 @@
+package warden
+
+import (
+	"clawrden/pkg/protocol"
+	"path/filepath"
+	"testing"
+)
+
+func TestRulePriority(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writeTestFile(t, path, `default_action: deny
+shell_commands: [sh]
+rules:
+  - command: webpack
+    action: allow
+    nice: 10
+    ionice_class: best-effort
+  - command: du
+    action: allow
+    nice: 5
+    ionice_class: idle
+  - command: tar
+    action: allow
+    ionice_class: best-effort
+    ionice_level: 6
+  - command: sh
+    action: allow
+`)
+	policy, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+
+	tests := []struct {
+		args []string
+		want *protocol.Priority
+	}{
+		{[]string{"webpack"}, &protocol.Priority{Nice: 10, IOClass: protocol.IOClassBestEffort, IOLevel: defaultIONiceLevel}},
+		{[]string{"du", "-sh"}, &protocol.Priority{Nice: 5, IOClass: protocol.IOClassIdle}},
+		{[]string{"tar", "cf", "x.tar"}, &protocol.Priority{IOClass: protocol.IOClassBestEffort, IOLevel: 6}},
+		{[]string{"sh", "-c", "echo hi"}, nil},
+		// A script runs at the lowest priority of its commands
+		{[]string{"sh", "-c", "webpack && tar cf x.tar dist"}, &protocol.Priority{Nice: 10, IOClass: protocol.IOClassBestEffort, IOLevel: 6}},
+		{[]string{"sh", "-c", "tar cf x.tar dist; du -sh; webpack"}, &protocol.Priority{Nice: 10, IOClass: protocol.IOClassIdle}},
+	}
+	for _, tt := range tests {
+		result := policy.Evaluate(&protocol.Request{Command: tt.args[0], Args: tt.args[1:]})
+		if (result.Priority == nil) != (tt.want == nil) || (tt.want != nil && *result.Priority != *tt.want) {
+			t.Errorf("%v: priority %+v, want %+v", tt.args, result.Priority, tt.want)
+		}
+	}
+}
+
+func TestRulePriorityValidation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	for _, bad := range []string{
+		"nice: -1",
+		"nice: 20",
+		"ionice_class: realtime",
+		"ionice_level: 3",
+		"ionice_class: idle, ionice_level: 3",
+		"ionice_class: best-effort, ionice_level: 8",
+	} {
+		writeTestFile(t, path, "default_action: deny\nrules:\n  - {command: webpack, action: allow, "+bad+"}\n")
+		if _, err := LoadPolicy(path); err == nil {
+			t.Errorf("LoadPolicy accepted %s", bad)
+		}
+	}
+}
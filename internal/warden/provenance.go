@@ -0,0 +1,185 @@
+package warden
+
+import (
+	"bytes"
+	"clawrden/pkg/protocol"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrUntrustedClient is wrapped by every provenance failure.
+var ErrUntrustedClient = errors.New("untrusted client")
+
+// procReader reads what the kernel knows about a peer process. It is
+// abstracted so provenance decisions can be tested without real processes.
+type procReader interface {
+	// ExeSHA256 returns the checksum of the binary the process is running.
+	ExeSHA256(pid int32) (string, error)
+	// Argv0 returns the first element of the process's command line.
+	Argv0(pid int32) (string, error)
+}
+
+// ShimVerifier checks that requests come from the armory shim invoked through
+// a jail symlink, rather than from any process that can reach the socket.
+type ShimVerifier struct {
+	proc    procReader
+	shimSum func() (string, error) // Checksum of the armory shim
+
+	// jailCommands returns the commands of the jails containerID may use
+	jailCommands func(containerID string) map[string]bool
+}
+
+// Verify returns an error wrapping ErrUntrustedClient unless pid runs the
+// armory shim, was invoked as req.Command, and req.Command is in a jail
+// known for req.ContainerID.
+func (v *ShimVerifier) Verify(pid int32, req *protocol.Request) error {
+	want, err := v.shimSum()
+	if err != nil {
+		return fmt.Errorf("%w: armory shim unavailable: %v", ErrUntrustedClient, err)
+	}
+	got, err := v.proc.ExeSHA256(pid)
+	if err != nil {
+		return fmt.Errorf("%w: cannot read executable of pid %d: %v", ErrUntrustedClient, pid, err)
+	}
+	if got != want {
+		return fmt.Errorf("%w: pid %d is not running the armory shim (sha256 %.12s, want %.12s)", ErrUntrustedClient, pid, got, want)
+	}
+
+	argv0, err := v.proc.Argv0(pid)
+	if err != nil {
+		return fmt.Errorf("%w: cannot read command line of pid %d: %v", ErrUntrustedClient, pid, err)
+	}
+	if name := filepath.Base(argv0); name != req.Command {
+		return fmt.Errorf("%w: shim invoked as %q but requested %q", ErrUntrustedClient, name, req.Command)
+	}
+	if !v.jailCommands(req.ContainerID)[req.Command] {
+		return fmt.Errorf("%w: %q is not a command of any jail for this client", ErrUntrustedClient, req.Command)
+	}
+	return nil
+}
+
+// fileKey identifies a file's contents well enough to reuse its checksum.
+type fileKey struct {
+	dev, ino uint64
+	size     int64
+	modTime  time.Time
+}
+
+// fileHasher checksums files, caching results by device, inode, size and
+// modification time so the shim is hashed once, not on every request.
+type fileHasher struct {
+	mu    sync.Mutex
+	cache map[fileKey]string
+}
+
+func newFileHasher() *fileHasher {
+	return &fileHasher{cache: make(map[fileKey]string)}
+}
+
+// Hash returns the SHA-256 of the file at path.
+func (h *fileHasher) Hash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	key := fileKey{size: info.Size(), modTime: info.ModTime()}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		key.dev, key.ino = uint64(st.Dev), st.Ino
+	}
+
+	h.mu.Lock()
+	sum, ok := h.cache[key]
+	h.mu.Unlock()
+	if ok {
+		return sum, nil
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	sum = hex.EncodeToString(hash.Sum(nil))
+
+	h.mu.Lock()
+	h.cache[key] = sum
+	h.mu.Unlock()
+	return sum, nil
+}
+
+// osProcReader reads peer processes from /proc.
+type osProcReader struct {
+	hasher *fileHasher
+}
+
+// ExeSHA256 hashes /proc/<pid>/exe, which opens the process's binary even
+// when it lives in another container's filesystem.
+func (r *osProcReader) ExeSHA256(pid int32) (string, error) {
+	return r.hasher.Hash(fmt.Sprintf("/proc/%d/exe", pid))
+}
+
+// Argv0 reads the first NUL-separated field of /proc/<pid>/cmdline.
+func (r *osProcReader) Argv0(pid int32) (string, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return "", err
+	}
+	argv0, _, _ := bytes.Cut(data, []byte{0})
+	return string(argv0), nil
+}
+
+// newShimVerifier creates the verifier for Config.RequireShimProvenance.
+func (s *Server) newShimVerifier() *ShimVerifier {
+	hasher := newFileHasher()
+	return &ShimVerifier{
+		proc: &osProcReader{hasher: hasher},
+		shimSum: func() (string, error) {
+			if s.jailhouse == nil {
+				return "", errors.New("jailhouse not initialized")
+			}
+			return hasher.Hash(s.jailhouse.ShimPath())
+		},
+		jailCommands: s.jailCommandsFor,
+	}
+}
+
+// jailCommandsFor returns the commands of the jails provisioned for
+// containerID from its labels, or of every jail when it has none.
+func (s *Server) jailCommandsFor(containerID string) map[string]bool {
+	commands := make(map[string]bool)
+	if s.jailhouse == nil {
+		return commands
+	}
+	var jailIDs []string
+	if s.autoJailer != nil && containerID != "" {
+		jailIDs = s.autoJailer.JailsOwnedBy(containerID)
+	}
+	if len(jailIDs) == 0 {
+		for _, jail := range s.jailhouse.ListJails() {
+			jailIDs = append(jailIDs, jail.JailID)
+		}
+	}
+	for _, id := range jailIDs {
+		jail, err := s.jailhouse.GetJail(id)
+		if err != nil {
+			continue
+		}
+		for _, cmd := range jail.Commands {
+			commands[cmd] = true
+		}
+	}
+	return commands
+}
@@ -0,0 +1,134 @@
+package warden
+
+import (
+	"clawrden/pkg/protocol"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeProcReader serves fixed /proc answers per pid.
+type fakeProcReader struct {
+	exe   map[int32]string
+	argv0 map[int32]string
+}
+
+func (f *fakeProcReader) ExeSHA256(pid int32) (string, error) {
+	sum, ok := f.exe[pid]
+	if !ok {
+		return "", os.ErrNotExist
+	}
+	return sum, nil
+}
+
+func (f *fakeProcReader) Argv0(pid int32) (string, error) {
+	argv0, ok := f.argv0[pid]
+	if !ok {
+		return "", os.ErrNotExist
+	}
+	return argv0, nil
+}
+
+func TestShimVerifier(t *testing.T) {
+	const shimSum = "abc123"
+	jails := map[string]map[string]bool{
+		"agent-ctr": {"ls": true, "cat": true},
+		"":          {"ls": true, "cat": true, "npm": true},
+	}
+
+	tests := []struct {
+		name        string
+		exe         string // Empty = process gone
+		argv0       string
+		command     string
+		containerID string
+		ok          bool
+	}{
+		{"shim through jail", shimSum, "/var/lib/clawrden/jailhouse/agent/bin/ls", "ls", "agent-ctr", true},
+		{"shim without container", shimSum, "/jail/bin/npm", "npm", "", true},
+		{"other binary", "def456", "ls", "ls", "agent-ctr", false},
+		{"argv0 mismatch", shimSum, "/var/lib/clawrden/jailhouse/agent/bin/cat", "ls", "agent-ctr", false},
+		{"process gone", "", "", "ls", "agent-ctr", false},
+		{"armory path", shimSum, "/var/lib/clawrden/armory/clawrden-shim", "clawrden-shim", "agent-ctr", false},
+		{"command outside jail", shimSum, "/tmp/curl", "curl", "agent-ctr", false},
+		{"command in another container's jail", shimSum, "/jail/bin/npm", "npm", "agent-ctr", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proc := &fakeProcReader{exe: map[int32]string{}, argv0: map[int32]string{}}
+			if tt.exe != "" {
+				proc.exe[42], proc.argv0[42] = tt.exe, tt.argv0
+			}
+			verifier := &ShimVerifier{
+				proc:         proc,
+				shimSum:      func() (string, error) { return shimSum, nil },
+				jailCommands: func(containerID string) map[string]bool { return jails[containerID] },
+			}
+			err := verifier.Verify(42, &protocol.Request{Command: tt.command, ContainerID: tt.containerID})
+			if tt.ok && err != nil {
+				t.Errorf("Verify = %v, want ok", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrUntrustedClient) {
+				t.Errorf("Verify = %v, want ErrUntrustedClient", err)
+			}
+		})
+	}
+}
+
+func TestShimVerifierWithoutArmory(t *testing.T) {
+	verifier := &ShimVerifier{
+		proc:         &fakeProcReader{exe: map[int32]string{1: "abc"}, argv0: map[int32]string{1: "ls"}},
+		shimSum:      func() (string, error) { return "", os.ErrNotExist },
+		jailCommands: func(string) map[string]bool { return map[string]bool{"ls": true} },
+	}
+	if err := verifier.Verify(1, &protocol.Request{Command: "ls"}); !errors.Is(err, ErrUntrustedClient) {
+		t.Errorf("Verify = %v, want ErrUntrustedClient", err)
+	}
+}
+
+func TestFileHasherCachesByInode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shim")
+	writeTestFile(t, path, "one")
+	hasher := newFileHasher()
+
+	first, err := hasher.Hash(path)
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if again, _ := hasher.Hash(path); again != first || len(hasher.cache) != 1 {
+		t.Errorf("second Hash = %s with %d cache entries, want cached %s", again, len(hasher.cache), first)
+	}
+
+	// Replacing the file (new inode) is noticed
+	writeTestFile(t, path+".new", "two")
+	if err := os.Rename(path+".new", path); err != nil {
+		t.Fatal(err)
+	}
+	if replaced, _ := hasher.Hash(path); replaced == first {
+		t.Error("Hash unchanged after the file was replaced")
+	}
+}
+
+func TestOSProcReaderSelf(t *testing.T) {
+	reader := &osProcReader{hasher: newFileHasher()}
+	pid := int32(os.Getpid())
+	argv0, err := reader.Argv0(pid)
+	if err != nil {
+		t.Skipf("no /proc: %v", err)
+	}
+	if argv0 != os.Args[0] {
+		t.Errorf("Argv0 = %q, want %q", argv0, os.Args[0])
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+	want, err := newFileHasher().Hash(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := reader.ExeSHA256(pid); err != nil || got != want {
+		t.Errorf("ExeSHA256 = %s, %v; want %s", got, err, want)
+	}
+}
@@ -0,0 +1,196 @@
+package warden
+
+import (
+	"clawrden/pkg/protocol"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenotifyGenerations(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+	q := NewHITLQueue()
+	q.now, q.mono = clock.Now, clock.Mono
+
+	go q.EnqueueOutcome(context.Background(), &protocol.Request{Command: "rm"}, &ReviewInfo{RenotifyAfter: 15 * time.Minute})
+	id := waitPending(t, q)
+	defer q.Resolve(id, DecisionDeny)
+
+	generation := func() int {
+		p, _ := q.Get(id)
+		return p.NotifyGeneration
+	}
+	for _, step := range []struct {
+		advance time.Duration
+		want    int
+	}{
+		{0, 0},
+		{14 * time.Minute, 0},
+		{time.Minute, 1},
+		{29 * time.Minute, 2},
+		{time.Minute, 3},
+	} {
+		clock.Advance(step.advance)
+		if got := generation(); got != step.want {
+			t.Errorf("after %v: generation %d, want %d", clock.Mono(), got, step.want)
+		}
+	}
+
+	// Generations follow the monotonic clock, not wall clock steps
+	clock.Step(24 * time.Hour)
+	if got := generation(); got != 3 {
+		t.Errorf("after a clock step: generation %d, want 3", got)
+	}
+}
+
+func TestRenotifyOff(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+	q := NewHITLQueue()
+	q.now, q.mono = clock.Now, clock.Mono
+
+	go q.EnqueueOutcome(context.Background(), &protocol.Request{Command: "rm"}, nil)
+	id := waitPending(t, q)
+	defer q.Resolve(id, DecisionDeny)
+
+	clock.Advance(48 * time.Hour)
+	if p, _ := q.Get(id); p.NotifyGeneration != 0 {
+		t.Errorf("generation %d without renotify_after, want 0", p.NotifyGeneration)
+	}
+	if _, err := q.MarkNotified(id, "slack-bridge", 1); err == nil {
+		t.Error("acknowledged a reminder that is never due")
+	}
+}
+
+func TestMarkNotified(t *testing.T) {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := &fakeClock{t: start}
+	q := NewHITLQueue()
+	q.now, q.mono = clock.Now, clock.Mono
+
+	outcome := make(chan Outcome, 1)
+	go func() {
+		outcome <- q.EnqueueOutcome(context.Background(), &protocol.Request{Command: "rm"}, &ReviewInfo{RenotifyAfter: 10 * time.Minute})
+	}()
+	id := waitPending(t, q)
+
+	check := func(p PendingRequest, count int, last time.Time, generations map[string]int) {
+		t.Helper()
+		if p.NotifiedCount != count || p.LastNotifiedAt == nil || !p.LastNotifiedAt.Equal(last) {
+			t.Errorf("notified %d times, last at %v; want %d, %v", p.NotifiedCount, p.LastNotifiedAt, count, last)
+		}
+		if len(p.NotifiedGenerations) != len(generations) {
+			t.Errorf("generations = %v, want %v", p.NotifiedGenerations, generations)
+		}
+		for bridge, g := range generations {
+			if p.NotifiedGenerations[bridge] != g {
+				t.Errorf("generations = %v, want %v", p.NotifiedGenerations, generations)
+			}
+		}
+	}
+
+	// The first notification is generation 0
+	clock.Advance(time.Second)
+	p, err := q.MarkNotified(id, "slack-bridge", 0)
+	if err != nil {
+		t.Fatalf("MarkNotified: %v", err)
+	}
+	check(p, 1, start.Add(time.Second), map[string]int{"slack-bridge": 0})
+
+	// A restarted bridge acknowledging again changes nothing
+	clock.Advance(time.Minute)
+	p, _ = q.MarkNotified(id, "slack-bridge", 0)
+	check(p, 1, start.Add(time.Second), map[string]int{"slack-bridge": 0})
+
+	// Reminders that are not due yet are refused
+	if _, err := q.MarkNotified(id, "slack-bridge", 1); err == nil {
+		t.Error("acknowledged generation 1 before it was due")
+	}
+	if _, err := q.MarkNotified(id, "slack-bridge", -1); err == nil {
+		t.Error("acknowledged generation -1")
+	}
+
+	// Each bridge counts
+	clock.Advance(9 * time.Minute)
+	q.MarkNotified(id, "slack-bridge", 1)
+	clock.Advance(time.Second)
+	p, _ = q.MarkNotified(id, "telegram-bridge", 1)
+	check(p, 3, clock.Now(), map[string]int{"slack-bridge": 1, "telegram-bridge": 1})
+
+	// A late acknowledgement of an older generation does not go back
+	p, _ = q.MarkNotified(id, "slack-bridge", 0)
+	check(p, 3, clock.Now(), map[string]int{"slack-bridge": 1, "telegram-bridge": 1})
+
+	// The listing's copy is the caller's own
+	p.NotifiedGenerations["slack-bridge"] = 7
+	if listed, _ := q.Get(id); listed.NotifiedGenerations["slack-bridge"] != 1 {
+		t.Error("changing a listed request changed the queue")
+	}
+
+	q.Resolve(id, DecisionApprove)
+	<-outcome
+	if _, err := q.MarkNotified(id, "slack-bridge", 1); !errors.Is(err, errNotPending) {
+		t.Errorf("MarkNotified after resolution: err = %v, want errNotPending", err)
+	}
+}
+
+func TestQueueNotifiedAPI(t *testing.T) {
+	srv := newTestServer(t)
+	api := &APIServer{warden: srv}
+	go srv.hitl.EnqueueOutcome(context.Background(), &protocol.Request{Command: "rm"}, &ReviewInfo{RenotifyAfter: time.Hour})
+	id := waitPending(t, srv.hitl)
+	defer srv.hitl.Resolve(id, DecisionDeny)
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		api.handleQueueAction(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := post("/api/queue/"+id+"/notified", `{"bridge": "slack-bridge", "generation": 0}`)
+	var entry QueueEntry
+	json.NewDecoder(rec.Body).Decode(&entry)
+	if rec.Code != http.StatusOK || entry.NotifiedCount != 1 || entry.LastNotified == nil || entry.NotifiedGenerations["slack-bridge"] != 0 {
+		t.Fatalf("POST notified = %d %+v", rec.Code, entry)
+	}
+
+	// The queue listing carries the bookkeeping
+	rec = httptest.NewRecorder()
+	api.handleQueue(rec, httptest.NewRequest(http.MethodGet, "/api/queue", nil))
+	var listed []map[string]any
+	json.NewDecoder(rec.Body).Decode(&listed)
+	if len(listed) != 1 || listed[0]["notified_count"] != 1.0 || listed[0]["notify_generation"] != 0.0 || listed[0]["last_notified_at"] == nil {
+		t.Errorf("GET /api/queue = %v", listed)
+	}
+
+	for _, tc := range []struct {
+		path, body string
+		want       int
+	}{
+		{"/api/queue/" + id + "/notified", `{"bridge": "slack-bridge", "generation": 1}`, http.StatusBadRequest},
+		{"/api/queue/" + id + "/notified", `{"generation": 0}`, http.StatusBadRequest},
+		{"/api/queue/" + id + "/notified", `{`, http.StatusBadRequest},
+		{"/api/queue/nope/notified", `{"bridge": "slack-bridge", "generation": 0}`, http.StatusNotFound},
+	} {
+		if rec := post(tc.path, tc.body); rec.Code != tc.want {
+			t.Errorf("POST %s %s: status %d, want %d", tc.path, tc.body, rec.Code, tc.want)
+		}
+	}
+}
+
+func TestPolicyRenotifyAfter(t *testing.T) {
+	policy, err := ParsePolicy([]byte("default_action: deny\nrules: []\nhitl:\n  renotify_after: 15m\n"))
+	if err != nil {
+		t.Fatalf("ParsePolicy: %v", err)
+	}
+	if got := policy.RenotifyAfter(); got != 15*time.Minute {
+		t.Errorf("RenotifyAfter = %v, want 15m", got)
+	}
+	if _, err := ParsePolicy([]byte("default_action: deny\nrules: []\nhitl:\n  renotify_after: 5s\n")); err == nil {
+		t.Error("ParsePolicy accepted renotify_after: 5s")
+	}
+}
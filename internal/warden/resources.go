@@ -0,0 +1,233 @@
+package warden
+
+import (
+	"clawrden/internal/cliout"
+	"clawrden/internal/executor"
+	"clawrden/pkg/protocol"
+	"context"
+	"log"
+	"net"
+	"runtime"
+	"runtime/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// resourceLogInterval is how often the warden logs its own memory use,
+// goroutines and shim connections.
+const resourceLogInterval = 5 * time.Minute
+
+// memoryPressureRecovery is the fraction of the watermark memory use must
+// fall below to end memory pressure, so that use hovering at the watermark
+// does not flip it on every request.
+const memoryPressureRecovery = 0.9
+
+// overloadReadTimeout bounds reading the request of a connection refused at
+// the connection cap, so refusals stay cheap.
+const overloadReadTimeout = 5 * time.Second
+
+// ResourceMonitor tracks the warden's own memory use, goroutines and shim
+// connections, so that on a busy host it degrades predictably instead of
+// competing with the workloads it supervises. Past MaxConnections, new shim
+// connections are refused; past the memory watermark, ghost executions are
+// refused and transcripts and live output capture are skipped until memory
+// use falls back below the watermark.
+type ResourceMonitor struct {
+	maxConns  int
+	watermark int64 // Bytes; 0 disables memory pressure
+	logger    *log.Logger
+
+	readMemory func() int64 // See runtimeMemory
+	now        func() time.Time
+
+	conns   atomic.Int64
+	refused atomic.Int64 // Connections refused at the cap
+	shed    atomic.Int64 // Ghost executions refused and captures skipped under memory pressure
+
+	mu       sync.Mutex
+	pressure bool
+	since    time.Time
+}
+
+// ResourceUsage is a snapshot of the warden's own resource use.
+type ResourceUsage struct {
+	MemoryBytes     int64      `json:"memory_bytes"` // Memory the Go runtime holds from the OS, close to RSS
+	Goroutines      int        `json:"goroutines"`
+	Connections     int64      `json:"connections"` // Open shim connections
+	MaxConnections  int        `json:"max_connections,omitempty"`
+	MemoryWatermark int64      `json:"memory_watermark,omitempty"`
+	MemoryPressure  bool       `json:"memory_pressure"`
+	PressureSince   *time.Time `json:"pressure_since,omitempty"`
+	Refused         int64      `json:"refused_connections"`
+	Shed            int64      `json:"shed"`
+}
+
+// NewResourceMonitor creates a monitor that refuses shim connections past
+// maxConns and sheds work past watermark bytes of memory; 0 disables either.
+func NewResourceMonitor(maxConns int, watermark int64, logger *log.Logger) *ResourceMonitor {
+	return &ResourceMonitor{
+		maxConns:   maxConns,
+		watermark:  watermark,
+		logger:     logger,
+		readMemory: runtimeMemory,
+		now:        time.Now,
+	}
+}
+
+// runtimeMemory returns the memory the Go runtime has mapped and not
+// returned to the OS, which tracks the warden's RSS without reading /proc.
+func runtimeMemory() int64 {
+	samples := []metrics.Sample{
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+	}
+	metrics.Read(samples)
+	return int64(samples[0].Value.Uint64() - samples[1].Value.Uint64())
+}
+
+// Acquire takes a connection slot, or reports false if maxConns are
+// already open. Every successful Acquire must be followed by Release.
+func (m *ResourceMonitor) Acquire() bool {
+	if m == nil {
+		return true
+	}
+	for {
+		n := m.conns.Load()
+		if m.maxConns > 0 && n >= int64(m.maxConns) {
+			m.refused.Add(1)
+			return false
+		}
+		if m.conns.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// Release gives back a slot taken by Acquire.
+func (m *ResourceMonitor) Release() {
+	if m != nil {
+		m.conns.Add(-1)
+	}
+}
+
+// UnderPressure samples memory use and reports whether the warden is under
+// memory pressure, logging when that starts and ends.
+func (m *ResourceMonitor) UnderPressure() bool {
+	if m == nil || m.watermark <= 0 {
+		return false
+	}
+	used := m.readMemory()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case !m.pressure && used >= m.watermark:
+		m.pressure, m.since = true, m.now()
+		m.logger.Printf("warning: memory pressure: %s in use, over the %s watermark; refusing ghost executions and skipping transcripts and output capture",
+			cliout.FormatBytes(used), cliout.FormatBytes(m.watermark))
+	case m.pressure && float64(used) < float64(m.watermark)*memoryPressureRecovery:
+		m.pressure = false
+		m.logger.Printf("memory pressure over: %s in use after %s", cliout.FormatBytes(used), m.now().Sub(m.since).Round(time.Second))
+	}
+	return m.pressure
+}
+
+// Shed counts a ghost execution refused, or a capture skipped, under
+// memory pressure.
+func (m *ResourceMonitor) Shed() {
+	if m != nil {
+		m.shed.Add(1)
+	}
+}
+
+// Usage returns the current resource use.
+func (m *ResourceMonitor) Usage() ResourceUsage {
+	pressure := m.UnderPressure()
+	u := ResourceUsage{
+		MemoryBytes:     m.readMemory(),
+		Goroutines:      runtime.NumGoroutine(),
+		Connections:     m.conns.Load(),
+		MaxConnections:  m.maxConns,
+		MemoryWatermark: m.watermark,
+		MemoryPressure:  pressure,
+		Refused:         m.refused.Load(),
+		Shed:            m.shed.Load(),
+	}
+	if pressure {
+		m.mu.Lock()
+		since := m.since
+		m.mu.Unlock()
+		u.PressureSince = &since
+	}
+	return u
+}
+
+// Run logs resource use every interval until ctx is done.
+func (m *ResourceMonitor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			u := m.Usage()
+			m.logger.Printf("resources: %s memory, %d goroutines, %d shim connections (%d refused, %d shed)",
+				cliout.FormatBytes(u.MemoryBytes), u.Goroutines, u.Connections, u.Refused, u.Shed)
+		}
+	}
+}
+
+// refuseOverloaded answers a shim connection refused at the connection cap
+// with a denial, without the work of a full request.
+func (s *Server) refuseOverloaded(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(overloadReadTimeout))
+	req, err := protocol.ReadRequest(conn)
+	if err != nil {
+		return
+	}
+	creds, err := s.peers.Credentials(conn)
+	if err == nil {
+		req.Identity.UID, req.Identity.GID = int(creds.UID), int(creds.GID)
+	}
+	req.Normalize()
+	if err := req.Validate(); err != nil {
+		s.rejectMalformed(conn, req, err)
+		return
+	}
+	s.logger.Printf("warning: refusing %s: %d shim connections already open", req.Command, s.resources.maxConns)
+	entry := AuditEntry{
+		RequestID:      newID("req", time.Now()),
+		Command:        req.Command,
+		Args:           req.Args,
+		Cwd:            req.Cwd,
+		Identity:       req.Identity,
+		IdentitySource: identitySource(creds),
+		TaskID:         protocol.SanitizeCorrelationID(req.TaskID),
+		RunID:          protocol.SanitizeCorrelationID(req.RunID),
+		PolicyHash:     s.currentPolicy().engine.Hash(),
+		Decision:       protocol.DecisionDeny,
+		Outcome:        protocol.OutcomeWardenOverloaded,
+		Error:          "shim connection limit reached",
+	}
+	s.deny(conn, &entry, "the warden is running as many commands as it allows at once; try again shortly")
+}
+
+// refuseUnderPressure denies a request that would run in a ghost container
+// while the warden is under memory pressure.
+func (s *Server) refuseUnderPressure(conn net.Conn, req *protocol.Request, strategy executor.Strategy, sandboxed bool, entry *AuditEntry, transcript *transcriptRecorder, keepTranscript bool) bool {
+	if !s.resources.UnderPressure() {
+		return false
+	}
+	if _, runs := s.executorFor(req, strategy, sandboxed); runs != executor.StrategyGhost {
+		return false
+	}
+	s.resources.Shed()
+	s.logger.Printf("warning: refusing %s: warden under memory pressure", req.Command)
+	entry.Decision, entry.Outcome = protocol.DecisionDeny, protocol.OutcomeMemoryPressure
+	entry.Error = "warden under memory pressure"
+	s.saveTranscript(transcript, entry, keepTranscript)
+	s.deny(conn, entry, "warden under memory pressure; ghost executions are paused until it recovers")
+	return true
+}
@@ -0,0 +1,194 @@
+package warden
+
+import (
+	"bytes"
+	"clawrden/internal/executor"
+	"clawrden/pkg/protocol"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestResourceMonitor returns a monitor whose memory use is *used.
+func newTestResourceMonitor(maxConns int, watermark int64) (*ResourceMonitor, *int64, *bytes.Buffer) {
+	var logs bytes.Buffer
+	m := NewResourceMonitor(maxConns, watermark, log.New(&logs, "", 0))
+	used := new(int64)
+	m.readMemory = func() int64 { return *used }
+	return m, used, &logs
+}
+
+func TestResourceMonitorMemoryPressure(t *testing.T) {
+	m, used, logs := newTestResourceMonitor(0, 100<<20)
+
+	steps := []struct {
+		used int64
+		want bool
+	}{
+		{50 << 20, false},
+		{100 << 20, true},
+		{95 << 20, true}, // Below the watermark, not yet below 90% of it
+		{89 << 20, false},
+		{99 << 20, false},
+	}
+	for _, step := range steps {
+		*used = step.used
+		if got := m.UnderPressure(); got != step.want {
+			t.Errorf("at %d MiB: pressure %v, want %v", step.used>>20, got, step.want)
+		}
+	}
+	if got := strings.Count(logs.String(), "warning: memory pressure"); got != 1 {
+		t.Errorf("logged pressure %d times, want once:\n%s", got, logs)
+	}
+	if !strings.Contains(logs.String(), "memory pressure over") {
+		t.Errorf("end of pressure not logged:\n%s", logs)
+	}
+
+	// Without a watermark there is never pressure
+	m, used, _ = newTestResourceMonitor(0, 0)
+	*used = 1 << 40
+	if m.UnderPressure() {
+		t.Error("pressure without a watermark")
+	}
+	var none *ResourceMonitor
+	if none.UnderPressure() || !none.Acquire() {
+		t.Error("nil monitor shed load")
+	}
+	if got := runtimeMemory(); got <= 0 {
+		t.Errorf("runtime memory = %d", got)
+	}
+}
+
+func TestResourceMonitorConnectionCap(t *testing.T) {
+	m, _, _ := newTestResourceMonitor(2, 0)
+	if !m.Acquire() || !m.Acquire() {
+		t.Fatal("refused a connection under the cap")
+	}
+	if m.Acquire() {
+		t.Fatal("accepted a connection over the cap")
+	}
+	m.Release()
+	if !m.Acquire() {
+		t.Error("refused a connection after one was released")
+	}
+	if u := m.Usage(); u.Connections != 2 || u.Refused != 1 || u.MaxConnections != 2 {
+		t.Errorf("usage = %+v", u)
+	}
+}
+
+func TestConnectionCapDeniesRequests(t *testing.T) {
+	srv, audited := newMaintenanceTestServer(t, []Rule{{Command: "echo", Action: ActionAllow}})
+	srv.resources, _, _ = newTestResourceMonitor(1, 0)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go srv.refuseOverloaded(server)
+	protocol.WriteRequest(client, &protocol.Request{Command: "echo", Args: []string{"hi"}, Cwd: "/"})
+	if ack, _ := protocol.ReadAck(client); ack != protocol.AckDenied {
+		t.Fatalf("ack = %d, want denied", ack)
+	}
+	if reason, _ := protocol.ReadDenialReason(client); !strings.Contains(reason, "as many commands as it allows") {
+		t.Errorf("reason = %q", reason)
+	}
+	io.Copy(io.Discard, client)
+	if entries := audited(); len(entries) != 1 || entries[0].Decision != protocol.DecisionDeny || entries[0].Outcome != protocol.OutcomeWardenOverloaded || entries[0].Command != "echo" {
+		t.Errorf("audit entries = %+v", entries)
+	}
+}
+
+func TestMemoryPressureSkipsCaptures(t *testing.T) {
+	srv, audited := newMaintenanceTestServer(t, []Rule{{Command: "echo", Action: ActionAllow, Transcript: true}})
+	srv.config.TranscriptDir = t.TempDir()
+	srv.outputs = NewOutputRegistry()
+	var used *int64
+	srv.resources, used, _ = newTestResourceMonitor(0, 100<<20)
+
+	*used = 200 << 20
+	if ack, _ := sendRequest(t, srv, &protocol.Request{Command: "echo", Args: []string{"hi"}, Cwd: "/"}); ack != protocol.AckAllowed {
+		t.Fatalf("ack under pressure = %d, want allowed", ack)
+	}
+	if got := len(srv.outputs.List()); got != 0 {
+		t.Errorf("%d executions captured under pressure", got)
+	}
+	if shed := srv.resources.Usage().Shed; shed != 2 {
+		t.Errorf("shed = %d, want the transcript and the output capture", shed)
+	}
+
+	*used = 10 << 20
+	sendRequest(t, srv, &protocol.Request{Command: "echo", Args: []string{"hi"}, Cwd: "/"})
+	entries := audited()
+	if len(entries) != 2 || entries[0].Transcript != "" || entries[1].Transcript == "" {
+		t.Errorf("transcripts = %q, %q; want only the second", entries[0].Transcript, entries[len(entries)-1].Transcript)
+	}
+	if got := len(srv.outputs.List()); got != 1 {
+		t.Errorf("%d executions captured after the pressure ended, want 1", got)
+	}
+}
+
+func TestMemoryPressureRefusesGhosts(t *testing.T) {
+	srv := newTestServer(t)
+	srv.dockerExec = executor.NewDockerExecutor(&routingDocker{}, srv.logger)
+	var used *int64
+	srv.resources, used, _ = newTestResourceMonitor(0, 100<<20)
+
+	tests := []struct {
+		command  string
+		strategy executor.Strategy
+		used     int64
+		want     bool
+	}{
+		{"npm", executor.StrategyAuto, 200 << 20, true},
+		{"ls", executor.StrategyGhost, 200 << 20, true},
+		{"ls", executor.StrategyAuto, 200 << 20, false}, // Mirrored into its own container
+		{"npm", executor.StrategyAuto, 10 << 20, false},
+	}
+	for _, tt := range tests {
+		*used = tt.used
+		req := &protocol.Request{Command: tt.command, ContainerID: "0123456789ab"}
+		entry := &AuditEntry{Command: tt.command}
+		client, server := net.Pipe()
+		go io.Copy(io.Discard, client)
+		refused := srv.refuseUnderPressure(server, req, tt.strategy, false, entry, nil, false)
+		server.Close()
+		if refused != tt.want {
+			t.Errorf("%s (%s) at %d MiB: refused %v, want %v", tt.command, tt.strategy, tt.used>>20, refused, tt.want)
+		}
+		if refused && (entry.Decision != protocol.DecisionDeny || entry.Outcome != protocol.OutcomeMemoryPressure) {
+			t.Errorf("decision = %q", entry.DecisionLabel())
+		}
+	}
+}
+
+func TestStatusReportsResources(t *testing.T) {
+	api, _ := newTestAPIServer(t, Config{})
+	var used *int64
+	api.warden.resources, used, _ = newTestResourceMonitor(4, 100<<20)
+	*used = 150 << 20
+
+	rec := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/status", nil))
+	var status struct {
+		Resources ResourceUsage `json:"resources"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatalf("decode /api/status: %v", err)
+	}
+	if r := status.Resources; r.MemoryBytes != 150<<20 || !r.MemoryPressure || r.PressureSince == nil || r.Goroutines == 0 || r.MaxConnections != 4 {
+		t.Errorf("resources = %+v", r)
+	}
+
+	rec = httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var ready struct {
+		Warnings []string `json:"warnings"`
+	}
+	json.NewDecoder(rec.Body).Decode(&ready)
+	if len(ready.Warnings) != 1 || !strings.Contains(ready.Warnings[0], "memory pressure") {
+		t.Errorf("warnings = %q", ready.Warnings)
+	}
+}
@@ -0,0 +1,97 @@
+package warden
+
+import (
+	"clawrden/internal/executor"
+	"clawrden/pkg/protocol"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// maxRetryAttempts bounds a rule's retry.attempts.
+const maxRetryAttempts = 10
+
+// RetryPolicy lets a rule run its command again when an execution fails
+// for a transient reason (see executor.TransientError), such as an
+// OOM-killed ghost container or a Docker daemon restart, instead of
+// failing the request and leaving the agent to send it through policy and
+// review again. Only executions that sent no output are retried, so
+// nothing the agent saw is repeated.
+type RetryPolicy struct {
+	Attempts int           `yaml:"attempts"`          // Runs in all, the first included
+	Backoff  time.Duration `yaml:"backoff,omitempty"` // Wait before each retry
+}
+
+// validate checks a rule's retry settings.
+func (p *RetryPolicy) validate() error {
+	if p == nil {
+		return nil
+	}
+	if p.Attempts < 1 || p.Attempts > maxRetryAttempts {
+		return fmt.Errorf("retry.attempts must be between 1 and %d, got %d", maxRetryAttempts, p.Attempts)
+	}
+	if p.Backoff < 0 {
+		return fmt.Errorf("retry.backoff must not be negative")
+	}
+	return nil
+}
+
+// ExecAttempt is one run of a command whose rule allows retries, for the
+// audit log.
+type ExecAttempt struct {
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+	Transient  bool   `json:"transient,omitempty"` // The failure was transient
+}
+
+// executeWithRetry calls run, and while it fails transiently before
+// sending any output, calls it again as retry allows. Once a run failed
+// transiently, every run is listed in entry.Attempts.
+func (s *Server) executeWithRetry(ctx context.Context, retry *RetryPolicy, req *protocol.Request, entry *AuditEntry, conn net.Conn, run func(net.Conn) error) error {
+	if retry == nil || retry.Attempts < 2 {
+		return run(conn)
+	}
+	var attempts []ExecAttempt
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		out := executor.NewDeliveryConn(conn)
+		err := run(out)
+
+		var transient *executor.TransientError
+		isTransient := errors.As(err, &transient)
+		if !isTransient && attempts == nil {
+			return err // Nothing was retried
+		}
+		record := ExecAttempt{DurationMs: time.Since(start).Milliseconds(), Transient: isTransient}
+		if err != nil {
+			record.Error = err.Error()
+		}
+		attempts = append(attempts, record)
+		entry.Attempts = attempts
+		if !isTransient {
+			return err
+		}
+
+		stats := out.Stats()
+		switch {
+		case stats.StdoutBytes+stats.StderrBytes > 0:
+			s.logger.Printf("warning: not retrying %s: %v after sending output", req.Command, err)
+			return err
+		case attempt >= retry.Attempts:
+			s.logger.Printf("warning: %s failed on all %d attempts: %v", req.Command, attempt, err)
+			return err
+		}
+		s.logger.Printf("warning: %s failed transiently: %v; retrying in %v (attempt %d of %d)", req.Command, err, retry.Backoff, attempt+1, retry.Attempts)
+		protocol.WriteFrame(conn, protocol.Frame{
+			Type:    protocol.StreamStderr,
+			Payload: []byte(fmt.Sprintf("clawrden: %s; retrying (attempt %d of %d)\n", transient.Reason, attempt+1, retry.Attempts)),
+		})
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(retry.Backoff):
+		}
+	}
+}
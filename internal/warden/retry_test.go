@@ -0,0 +1,110 @@
+package warden
+
+import (
+	"clawrden/internal/executor"
+	"clawrden/pkg/protocol"
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExecuteWithRetry(t *testing.T) {
+	oom := &executor.TransientError{Reason: "ghost container was OOM-killed", ExitCode: 137}
+	output := func(conn net.Conn) {
+		protocol.WriteFrame(conn, protocol.Frame{Type: protocol.StreamStdout, Payload: []byte("done\n")})
+	}
+
+	tests := []struct {
+		name     string
+		retry    *RetryPolicy
+		results  []error // Of each run; the last repeats
+		output   []bool  // Whether each run sends output first
+		calls    int
+		attempts int // Audited attempts
+		wantErr  bool
+	}{
+		{"no retry policy", nil, []error{oom}, nil, 1, 0, true},
+		{"succeeds on retry", &RetryPolicy{Attempts: 3}, []error{oom, nil}, []bool{false, true}, 2, 2, false},
+		{"always transient", &RetryPolicy{Attempts: 3}, []error{oom}, nil, 3, 3, true},
+		{"transient after output", &RetryPolicy{Attempts: 3}, []error{oom}, []bool{true}, 1, 1, true},
+		{"not transient", &RetryPolicy{Attempts: 3}, []error{errors.New("no such container")}, nil, 1, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			client, server := net.Pipe()
+			var stderr, stdout strings.Builder
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for {
+					f, err := protocol.ReadFrame(client)
+					if err != nil {
+						return
+					}
+					switch f.Type {
+					case protocol.StreamStdout:
+						stdout.Write(f.Payload)
+					case protocol.StreamStderr:
+						stderr.Write(f.Payload)
+					}
+				}
+			}()
+
+			var entry AuditEntry
+			calls := 0
+			err := s.executeWithRetry(context.Background(), tt.retry, &protocol.Request{Command: "npm"}, &entry, server, func(conn net.Conn) error {
+				i := min(calls, len(tt.results)-1)
+				if i < len(tt.output) && tt.output[i] {
+					output(conn)
+				}
+				calls++
+				return tt.results[i]
+			})
+			server.Close()
+			<-done
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if calls != tt.calls {
+				t.Errorf("calls = %d, want %d", calls, tt.calls)
+			}
+			if len(entry.Attempts) != tt.attempts {
+				t.Fatalf("attempts = %+v, want %d", entry.Attempts, tt.attempts)
+			}
+			if tt.attempts > 0 && !entry.Attempts[0].Transient {
+				t.Errorf("first attempt = %+v, want transient", entry.Attempts[0])
+			}
+			if retries := strings.Count(stderr.String(), "retrying"); retries != tt.calls-1 {
+				t.Errorf("stderr = %q, want %d retry notices", stderr.String(), tt.calls-1)
+			}
+			if tt.name == "succeeds on retry" && stdout.String() != "done\n" {
+				t.Errorf("stdout = %q, want the retry's output", stdout.String())
+			}
+		})
+	}
+}
+
+func TestRetryPolicyValidation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writeTestFile(t, path, "default_action: deny\nrules:\n  - command: npm\n    action: allow\n    retry: {attempts: 2, backoff: 2s}\n")
+	policy, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+	result := policy.Evaluate(&protocol.Request{Command: "npm", Args: []string{"ci"}})
+	if result.Retry == nil || result.Retry.Attempts != 2 || result.Retry.Backoff.Seconds() != 2 {
+		t.Errorf("result retry = %+v, want the rule's", result.Retry)
+	}
+
+	for _, bad := range []string{"{attempts: 0}", "{attempts: 11}", "{attempts: 2, backoff: -1s}"} {
+		writeTestFile(t, path, "default_action: deny\nrules:\n  - command: npm\n    action: allow\n    retry: "+bad+"\n")
+		if _, err := LoadPolicy(path); err == nil {
+			t.Errorf("LoadPolicy accepted retry %s", bad)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package warden
+
+import (
+	"bytes"
+	"clawrden/pkg/protocol"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCleanReviewerMessage(t *testing.T) {
+	tests := []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{"run the tests afterwards", "run the tests afterwards", false},
+		{"  use make deploy\n", "use make deploy", false},
+		{"line one\nline two\ttabbed", "line one line two tabbed", false},
+		{"\x1b[31mred\x1b[0m", "[31mred [0m", false},
+		{"", "", false},
+		{strings.Repeat("x", MaxReviewerMessage), strings.Repeat("x", MaxReviewerMessage), false},
+		{strings.Repeat("x", MaxReviewerMessage+1), "", true},
+		{"bad \xff byte", "", true},
+	}
+	for _, tt := range tests {
+		got, err := CleanReviewerMessage(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("CleanReviewerMessage(%q) = %q, %v; want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// resolveWithMessage sends req, resolves it with message once it is queued
+// and returns the ack deciding it and everything the shim received after.
+func resolveWithMessage(t *testing.T, srv *Server, req *protocol.Request, decision Decision, message string) (byte, *bytes.Reader) {
+	t.Helper()
+	client, server := net.Pipe()
+	defer client.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.handleConnection(server)
+	}()
+	if err := protocol.WriteRequest(client, req); err != nil {
+		t.Fatalf("write request: %v", err)
+	}
+	if ack, err := protocol.ReadAck(client); err != nil || ack != protocol.AckPendingHITL {
+		t.Fatalf("ack = %d, %v; want pending", ack, err)
+	}
+	for len(srv.hitl.List()) == 0 {
+		time.Sleep(time.Millisecond) // The ack goes out before the request is queued
+	}
+	srv.hitl.Review(srv.hitl.List()[0].ID, Review{Decision: decision, Message: message})
+	rest, _ := io.ReadAll(client)
+	<-done
+
+	r := bytes.NewReader(rest)
+	ack, err := protocol.ReadResolution(r, nil)
+	if err != nil {
+		t.Fatalf("read resolution: %v", err)
+	}
+	return ack, r
+}
+
+func TestReviewerMessageBeforeOutput(t *testing.T) {
+	srv, audited := newMaintenanceTestServer(t, []Rule{{Command: "echo", Action: ActionAsk}})
+	req := &protocol.Request{Command: "echo", Args: []string{"built"}, Cwd: "/", Version: protocol.ProtocolVersion}
+	ack, r := resolveWithMessage(t, srv, req, DecisionApprove, "run the tests afterwards")
+	if ack != protocol.AckAllowed {
+		t.Fatalf("ack = %d, want allowed", ack)
+	}
+
+	// The message is the first thing on stderr, before any command output
+	var order []string
+	for {
+		f, err := protocol.ReadFrame(r)
+		if err != nil {
+			break
+		}
+		switch f.Type {
+		case protocol.StreamStdout, protocol.StreamStderr:
+			order = append(order, string(f.Payload))
+		}
+	}
+	if len(order) != 2 || order[0] != "clawrden reviewer: run the tests afterwards\n" || order[1] != "built\n" {
+		t.Errorf("output = %q, want the reviewer's message, then the command's", order)
+	}
+	if entry := audited()[0]; entry.ReviewerMessage != "run the tests afterwards" || entry.Decision != protocol.DecisionAllow {
+		t.Errorf("audit entry: message %q, decision %q", entry.ReviewerMessage, entry.DecisionLabel())
+	}
+}
+
+func TestReviewerMessageWithDenial(t *testing.T) {
+	rules := []Rule{{Command: "kubectl", Action: ActionAsk}}
+	req := func(version int) *protocol.Request {
+		return &protocol.Request{Command: "kubectl", Args: []string{"apply"}, Cwd: "/", Version: version}
+	}
+
+	srv, audited := newMaintenanceTestServer(t, rules)
+	ack, r := resolveWithMessage(t, srv, req(protocol.ProtocolVersion), DecisionDeny, "use make deploy instead")
+	if ack != protocol.AckDenied {
+		t.Fatalf("ack = %d, want denied", ack)
+	}
+	var stderr bytes.Buffer
+	reason, meta, err := protocol.ReadDenialTo(r, &stderr)
+	if err != nil || reason != "" || meta == nil || meta.Outcome != protocol.OutcomeAfterHITL {
+		t.Errorf("denial = %q, %+v, %v; want metadata without a reason", reason, meta, err)
+	}
+	if got := stderr.String(); got != "clawrden reviewer: use make deploy instead\n" {
+		t.Errorf("stderr = %q, want the reviewer's message", got)
+	}
+	if entry := audited()[0]; entry.ReviewerMessage != "use make deploy instead" {
+		t.Errorf("audit entry message = %q", entry.ReviewerMessage)
+	}
+
+	// Older shims read nothing but the reason after a denial
+	srv, _ = newMaintenanceTestServer(t, rules)
+	ack, r = resolveWithMessage(t, srv, req(protocol.SessionVersion), DecisionDeny, "use make deploy instead")
+	if ack != protocol.AckDenied {
+		t.Fatalf("old shim: ack = %d, want denied", ack)
+	}
+	for {
+		f, err := protocol.ReadFrame(r)
+		if err != nil {
+			break
+		}
+		if f.Type == protocol.StreamStderr {
+			t.Errorf("old shim got a stderr frame %q after the denial", f.Payload)
+		}
+		if f.Type == protocol.StreamReason && string(f.Payload) != "use make deploy instead" {
+			t.Errorf("old shim: reason = %q, want the reviewer's message", f.Payload)
+		}
+	}
+}
+
+func TestResolveAPIMessage(t *testing.T) {
+	api, _ := newTestAPIServer(t, Config{})
+	queue := api.warden.GetHITLQueue()
+	outcome := make(chan Outcome, 1)
+	go func() {
+		outcome <- queue.EnqueueOutcome(t.Context(), &protocol.Request{Command: "rm"}, nil)
+	}()
+	for len(queue.List()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	id := queue.List()[0].ID
+
+	post := func(body string) int {
+		rec := httptest.NewRecorder()
+		api.handleQueueAction(rec, httptest.NewRequest(http.MethodPost, "/api/queue/"+id+"/deny", strings.NewReader(body)))
+		return rec.Code
+	}
+	if code := post(`{"message_to_requester": "` + strings.Repeat("x", MaxReviewerMessage+1) + `"}`); code != http.StatusBadRequest {
+		t.Errorf("long message: HTTP %d, want 400", code)
+	}
+	if !queue.IsPending(id) {
+		t.Fatal("a rejected denial resolved the request")
+	}
+	if code := post(`{"message_to_requester": "delete build/ only\n\u001b[2J"}`); code != http.StatusOK {
+		t.Errorf("message: HTTP %d, want 200", code)
+	}
+	if o := <-outcome; o.Decision != DecisionDeny || o.Message != "delete build/ only  [2J" {
+		t.Errorf("outcome = %+v, want denial with the cleaned message", o)
+	}
+}
@@ -0,0 +1,82 @@
+package warden
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// ReviewerToken is a reviewer's credential for the HTTP API. Approvals sent
+// with it count as Name's, through Channel, whatever the request's headers
+// claim.
+type ReviewerToken struct {
+	Name    string
+	Token   string
+	Channel string // api (the default), dashboard, slack or telegram
+}
+
+// reviewerTokenChannels are the channels whose approvals arrive over the
+// HTTP API, so a reviewer token may stand for them.
+var reviewerTokenChannels = []string{ChannelAPI, ChannelDashboard, ChannelSlack, ChannelTelegram}
+
+// minReviewerTokenLen is the shortest reviewer token accepted, in bytes.
+const minReviewerTokenLen = 16
+
+// errBadReviewerToken is returned for a bearer token that names no reviewer.
+var errBadReviewerToken = errors.New("invalid reviewer token")
+
+// ParseReviewerTokens reads a reviewer tokens file: one reviewer per line,
+// "<name> <token> [channel]", with blank lines and # comments ignored.
+func ParseReviewerTokens(data []byte) ([]ReviewerToken, error) {
+	var tokens []ReviewerToken
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("reviewer tokens line %d: expected \"<name> <token> [channel]\"", i+1)
+		}
+		t := ReviewerToken{Name: fields[0], Token: fields[1], Channel: ChannelAPI}
+		if len(fields) == 3 {
+			t.Channel = fields[2]
+		}
+		switch {
+		case len(t.Token) < minReviewerTokenLen:
+			return nil, fmt.Errorf("reviewer tokens line %d: token of %s must be at least %d bytes", i+1, t.Name, minReviewerTokenLen)
+		case !slices.Contains(reviewerTokenChannels, t.Channel):
+			return nil, fmt.Errorf("reviewer tokens line %d: channel %q (expected %s)", i+1, t.Channel, strings.Join(reviewerTokenChannels, ", "))
+		}
+		for _, other := range tokens {
+			if other.Name == t.Name {
+				return nil, fmt.Errorf("reviewer tokens line %d: %s is listed twice", i+1, t.Name)
+			}
+			if other.Token == t.Token {
+				return nil, fmt.Errorf("reviewer tokens line %d: %s has the token of %s", i+1, t.Name, other.Name)
+			}
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
+
+// reviewerCredential returns the reviewer whose token the request carries
+// as its bearer token. ok is false without one; a token matching nobody is
+// an error, so a mistyped token is not taken for an anonymous reviewer.
+func (api *APIServer) reviewerCredential(r *http.Request) (t ReviewerToken, ok bool, err error) {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		return ReviewerToken{}, false, nil
+	}
+	for _, t := range api.warden.config.ReviewerTokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t.Token)) == 1 {
+			return t, true, nil
+		}
+	}
+	api.logger.Printf("SECURITY: rejected %s %s from %s: invalid reviewer token", r.Method, r.URL.Path, r.RemoteAddr)
+	return ReviewerToken{}, false, errBadReviewerToken
+}
@@ -0,0 +1,177 @@
+package warden
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// RiskTier grades an ask rule by how much review it needs.
+type RiskTier string
+
+const (
+	// RiskLow is a soft ask: approved automatically after
+	// risk.low.auto_approve_after unless a reviewer denies it first.
+	RiskLow RiskTier = "low"
+
+	// RiskMedium is a normal ask, waiting for a reviewer.
+	RiskMedium RiskTier = "medium"
+
+	// RiskHigh needs explicit approvals, from risk.high.approvers different
+	// reviewers, and is never approved automatically.
+	RiskHigh RiskTier = "high"
+)
+
+// defaultAutoApproveAfter is how long a low-risk ask waits for an objection
+// when the policy does not say.
+const defaultAutoApproveAfter = time.Minute
+
+// defaultHighApprovers is how many reviewers approve a high-risk ask when
+// the policy does not say.
+const defaultHighApprovers = 2
+
+// Channels are where reviewers decide asks. Chat bridges post asks, named
+// after the bridge type, and approve with a reviewer token of that channel.
+const (
+	ChannelAPI       = "api"       // POST /api/queue/{id}/approve, e.g. clawrden-cli
+	ChannelDashboard = "dashboard" // The dashboard's live channel
+	ChannelLink      = "link"      // Signed one-time approval links
+	ChannelConsole   = "console"   // The warden's terminal console
+	ChannelGRPC      = "grpc"      // The gRPC control API
+	ChannelSlack     = "slack"     // The Slack bridge posts the ask
+	ChannelTelegram  = "telegram"  // The Telegram bridge posts the ask
+)
+
+// knownChannels are the channels a policy may route asks to.
+var knownChannels = []string{ChannelAPI, ChannelDashboard, ChannelLink, ChannelConsole, ChannelGRPC, ChannelSlack, ChannelTelegram}
+
+// riskRank orders tiers from least to most risky; unset ranks lowest.
+func riskRank(t RiskTier) int {
+	switch t {
+	case RiskLow:
+		return 1
+	case RiskMedium:
+		return 2
+	case RiskHigh:
+		return 3
+	}
+	return 0
+}
+
+// higherRisk returns the riskier of two tiers.
+func higherRisk(a, b RiskTier) RiskTier {
+	if riskRank(b) > riskRank(a) {
+		return b
+	}
+	return a
+}
+
+// validate checks a tier named in a policy; empty is allowed.
+func (t RiskTier) validate() error {
+	switch t {
+	case "", RiskLow, RiskMedium, RiskHigh:
+		return nil
+	}
+	return fmt.Errorf("risk must be low, medium or high, got %q", t)
+}
+
+// RiskTierConfig holds the defaults of one risk tier.
+type RiskTierConfig struct {
+	HITLTimeout      time.Duration `yaml:"hitl_timeout,omitempty"`       // Overrides default_hitl_timeout for the tier
+	AutoApproveAfter time.Duration `yaml:"auto_approve_after,omitempty"` // Low tier only (default: 1m)
+	Approvers        int           `yaml:"approvers,omitempty"`          // Different reviewers who must approve (default: 2 for high, else 1)
+	Channels         []string      `yaml:"channels,omitempty"`           // Where the tier's asks are posted and approved (default: everywhere)
+}
+
+// validate checks the settings of the tier named name.
+func (c RiskTierConfig) validate(name RiskTier) error {
+	if c.Approvers < 0 {
+		return fmt.Errorf("risk.%s.approvers must not be negative", name)
+	}
+	if c.Approvers > 1 && name == RiskLow {
+		return fmt.Errorf("risk.low.approvers: soft asks are approved by their timer; ask more reviewers with the medium or high tier")
+	}
+	for _, ch := range c.Channels {
+		if !slices.Contains(knownChannels, ch) {
+			return fmt.Errorf("risk.%s.channels: unknown channel %q (expected %s)", name, ch, strings.Join(knownChannels, ", "))
+		}
+	}
+	return nil
+}
+
+// RiskPolicy configures the risk tiers of ask rules.
+type RiskPolicy struct {
+	Default RiskTier       `yaml:"default,omitempty"` // Tier of asks without risk (default: medium)
+	Low     RiskTierConfig `yaml:"low,omitempty"`
+	Medium  RiskTierConfig `yaml:"medium,omitempty"`
+	High    RiskTierConfig `yaml:"high,omitempty"`
+}
+
+// validate checks the risk settings.
+func (p RiskPolicy) validate() error {
+	if err := p.Default.validate(); err != nil {
+		return fmt.Errorf("risk.default: %w", err)
+	}
+	if p.Low.AutoApproveAfter < 0 {
+		return fmt.Errorf("risk.low.auto_approve_after must not be negative")
+	}
+	if p.Medium.AutoApproveAfter != 0 || p.High.AutoApproveAfter != 0 {
+		return fmt.Errorf("auto_approve_after only applies to the low risk tier")
+	}
+	for _, t := range []RiskTier{RiskLow, RiskMedium, RiskHigh} {
+		if err := p.tier(t).validate(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tier returns the settings of t.
+func (p RiskPolicy) tier(t RiskTier) RiskTierConfig {
+	switch t {
+	case RiskLow:
+		return p.Low
+	case RiskHigh:
+		return p.High
+	}
+	return p.Medium
+}
+
+// riskTier returns the tier of an ask, falling back to risk.default.
+func (pe *PolicyEngine) riskTier(t RiskTier) RiskTier {
+	switch {
+	case t != "":
+		return t
+	case pe.config.Risk.Default != "":
+		return pe.config.Risk.Default
+	}
+	return RiskMedium
+}
+
+// autoApproveAfter returns how long an ask of tier t waits before it is
+// approved automatically; 0 means never.
+func (pe *PolicyEngine) autoApproveAfter(t RiskTier) time.Duration {
+	if t != RiskLow {
+		return 0
+	}
+	return firstNonZero(pe.config.Risk.Low.AutoApproveAfter, defaultAutoApproveAfter)
+}
+
+// approvers returns how many different reviewers must approve an ask of
+// tier t.
+func (pe *PolicyEngine) approvers(t RiskTier) int {
+	if n := pe.config.Risk.tier(t).Approvers; n > 0 {
+		return n
+	}
+	if t == RiskHigh {
+		return defaultHighApprovers
+	}
+	return 1
+}
+
+// channels returns where asks of tier t are posted and approved; nil means
+// everywhere.
+func (pe *PolicyEngine) channels(t RiskTier) []string {
+	return pe.config.Risk.tier(t).Channels
+}
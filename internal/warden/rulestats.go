@@ -0,0 +1,166 @@
+package warden
+
+import (
+	"clawrden/internal/events"
+	"clawrden/pkg/protocol"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// defaultMaxRuleMetrics bounds the rules counted separately unless
+// Config.MaxRuleMetrics says otherwise.
+const defaultMaxRuleMetrics = 100
+
+// Names rule counters are kept under: requests default_action decided, and
+// those of every rule past the cap.
+const (
+	ruleStatsDefault = "(default)"
+	ruleStatsOther   = "(other)"
+)
+
+// RuleStats counts the requests each policy rule decided, by the rule's
+// action and the audited decision and outcome, for alerting when one rule
+// starts firing, e.g. a deny rule someone is probing. Rules are named as
+// audited ("rule 3 (pip)"); past the cap, further rules are counted under
+// "(other)" so the series stay bounded. Requests refused before the
+// policy was evaluated are not counted.
+type RuleStats struct {
+	mu       sync.Mutex
+	maxRules int
+	counts   map[ruleStatsKey]int64
+	rules    map[string]*RuleAnnotation
+}
+
+type ruleStatsKey struct {
+	rule     string
+	action   Action
+	decision protocol.Decision
+	outcome  protocol.Outcome
+}
+
+// RuleAnnotation describes a counted rule, for GET /api/metrics/rules:
+// metric labels cannot hold its reason.
+type RuleAnnotation struct {
+	Rule      string `json:"rule"`
+	Action    Action `json:"action"`
+	Reason    string `json:"reason,omitempty"` // As of the rule's last decision
+	Decisions int64  `json:"decisions"`
+	Denials   int64  `json:"denials"`
+}
+
+// NewRuleStats returns empty counters that count up to maxRules rules
+// separately (defaultMaxRuleMetrics if 0 or less).
+func NewRuleStats(maxRules int) *RuleStats {
+	if maxRules <= 0 {
+		maxRules = defaultMaxRuleMetrics
+	}
+	return &RuleStats{
+		maxRules: maxRules,
+		counts:   make(map[ruleStatsKey]int64),
+		rules:    make(map[string]*RuleAnnotation),
+	}
+}
+
+// Observe counts entry if the policy decided it.
+func (rs *RuleStats) Observe(entry *AuditEntry) {
+	if entry.action == "" {
+		return
+	}
+	rule := entry.Rule
+	if rule == "" {
+		rule = ruleStatsDefault
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	a := rs.rules[rule]
+	if a == nil {
+		if len(rs.rules) >= rs.maxRules {
+			rule = ruleStatsOther
+			a = rs.rules[rule]
+		}
+		if a == nil {
+			a = &RuleAnnotation{Rule: rule}
+			rs.rules[rule] = a
+		}
+	}
+	if rule != ruleStatsOther {
+		a.Action, a.Reason = entry.action, entry.Reason
+	}
+	a.Decisions++
+	if entry.Decision == protocol.DecisionDeny {
+		a.Denials++
+	}
+	rs.counts[ruleStatsKey{rule: rule, action: entry.action, decision: entry.Decision, outcome: entry.Outcome}]++
+}
+
+// Subscribe counts every Audited event published on bus.
+func (rs *RuleStats) Subscribe(bus *events.Bus) (unsubscribe func()) {
+	return bus.Subscribe("rule-stats", func(e events.Event) {
+		if a, ok := e.(Audited); ok {
+			rs.Observe(&a.Entry)
+		}
+	})
+}
+
+// Annotations returns every counted rule, most decisions first.
+func (rs *RuleStats) Annotations() []RuleAnnotation {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	annotations := make([]RuleAnnotation, 0, len(rs.rules))
+	for _, a := range rs.rules {
+		annotations = append(annotations, *a)
+	}
+	sort.Slice(annotations, func(i, j int) bool {
+		if annotations[i].Decisions != annotations[j].Decisions {
+			return annotations[i].Decisions > annotations[j].Decisions
+		}
+		return annotations[i].Rule < annotations[j].Rule
+	})
+	return annotations
+}
+
+// WritePrometheus writes the counters in the Prometheus text format, one
+// clawrden_rule_decisions_total series per rule, action, decision and
+// outcome.
+func (rs *RuleStats) WritePrometheus(w io.Writer) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	keys := make([]ruleStatsKey, 0, len(rs.counts))
+	for k := range rs.counts {
+		keys = append(keys, k)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.rule != b.rule {
+			return a.rule < b.rule
+		}
+		if a.action != b.action {
+			return a.action < b.action
+		}
+		if a.decision != b.decision {
+			return a.decision < b.decision
+		}
+		return a.outcome < b.outcome
+	})
+
+	var b strings.Builder
+	b.WriteString("# HELP clawrden_rule_decisions_total Requests decided by each policy rule, by the rule's action and the audited decision and outcome. Reasons are at /api/metrics/rules.\n")
+	b.WriteString("# TYPE clawrden_rule_decisions_total counter\n")
+	for _, k := range keys {
+		fmt.Fprintf(&b, "clawrden_rule_decisions_total{rule=%s,action=%s,decision=%s,outcome=%s} %d\n",
+			promLabel(k.rule), promLabel(string(k.action)), promLabel(k.decision.String()), promLabel(k.outcome.String()), rs.counts[k])
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// promLabel quotes a label value as the Prometheus text format does.
+func promLabel(v string) string {
+	v = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+	return `"` + v + `"`
+}
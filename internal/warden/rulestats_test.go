@@ -0,0 +1,119 @@
+package warden
+
+import (
+	"clawrden/pkg/protocol"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRuleStatsCountsRequests(t *testing.T) {
+	srv, audited := newMaintenanceTestServer(t, []Rule{
+		{Command: "echo", Action: ActionAllow},
+		{Command: "curl", Action: ActionDeny, Reason: "no network \"egress\""},
+	})
+	srv.ruleStats = NewRuleStats(0)
+	srv.ruleStats.Subscribe(srv.events)
+
+	for _, req := range []*protocol.Request{
+		{Command: "curl", Args: []string{"evil.example"}, Cwd: "/"},
+		{Command: "curl", Args: []string{"other.example"}, Cwd: "/"},
+		{Command: "echo", Args: []string{"hi"}, Cwd: "/"},
+		{Command: "nc", Args: []string{"-l"}, Cwd: "/"},
+	} {
+		sendRequest(t, srv, req)
+	}
+	audited()
+
+	var out strings.Builder
+	if err := srv.ruleStats.WritePrometheus(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"# TYPE clawrden_rule_decisions_total counter\n",
+		`clawrden_rule_decisions_total{rule="(default)",action="deny",decision="deny",outcome=""} 1` + "\n",
+		`clawrden_rule_decisions_total{rule="rule 1 (echo)",action="allow",decision="allow",outcome=""} 1` + "\n",
+		`clawrden_rule_decisions_total{rule="rule 2 (curl)",action="deny",decision="deny",outcome=""} 2` + "\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("metrics missing %q:\n%s", want, out.String())
+		}
+	}
+	if n := strings.Count(out.String(), "clawrden_rule_decisions_total{"); n != 3 {
+		t.Errorf("got %d series, want 3:\n%s", n, out.String())
+	}
+
+	annotations := srv.ruleStats.Annotations()
+	if len(annotations) != 3 || annotations[0] != (RuleAnnotation{Rule: "rule 2 (curl)", Action: ActionDeny, Reason: `no network "egress"`, Decisions: 2, Denials: 2}) {
+		t.Errorf("annotations = %+v, want the curl rule first with its reason", annotations)
+	}
+}
+
+func TestRuleStatsCardinalityCap(t *testing.T) {
+	rs := NewRuleStats(2)
+	for _, e := range []AuditEntry{
+		{Rule: "rule 1 (ls)", action: ActionAllow, Decision: protocol.DecisionAllow},
+		{Rule: "rule 2 (rm)", action: ActionDeny, Decision: protocol.DecisionDeny, Reason: "destructive"},
+		{Rule: "rule 3 (dd)", action: ActionDeny, Decision: protocol.DecisionDeny, Reason: "raw disk"},
+		{Rule: "rule 4 (npm)", action: ActionAsk, Decision: protocol.DecisionAllow, Outcome: protocol.OutcomeAfterHITL},
+		{Rule: "rule 3 (dd)", action: ActionDeny, Decision: protocol.DecisionDeny},
+		{Rule: "rule 1 (ls)", action: ActionAllow, Decision: protocol.DecisionAllow},
+		{Decision: protocol.DecisionRejected, Outcome: protocol.OutcomeMalformed}, // Never evaluated
+	} {
+		rs.Observe(&e)
+	}
+
+	var out strings.Builder
+	rs.WritePrometheus(&out)
+	want := []string{
+		`clawrden_rule_decisions_total{rule="(other)",action="ask",decision="allow",outcome="after_hitl"} 1`,
+		`clawrden_rule_decisions_total{rule="(other)",action="deny",decision="deny",outcome=""} 2`,
+		`clawrden_rule_decisions_total{rule="rule 1 (ls)",action="allow",decision="allow",outcome=""} 2`,
+		`clawrden_rule_decisions_total{rule="rule 2 (rm)",action="deny",decision="deny",outcome=""} 1`,
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2+len(want) || strings.Join(lines[2:], "\n") != strings.Join(want, "\n") {
+		t.Errorf("metrics =\n%s\nwant series\n%s", out.String(), strings.Join(want, "\n"))
+	}
+
+	for _, a := range rs.Annotations() {
+		if a.Rule == ruleStatsOther && (a.Reason != "" || a.Action != "" || a.Decisions != 3 || a.Denials != 2) {
+			t.Errorf("other = %+v, want 3 decisions and 2 denials without a reason", a)
+		}
+	}
+}
+
+func TestRuleMetricsAPI(t *testing.T) {
+	srv := newTestServer(t)
+	srv.config.DisableDashboard = true
+	srv.ruleStats = NewRuleStats(0)
+	srv.ruleStats.Observe(&AuditEntry{Rule: "rule 1 (curl)", action: ActionDeny, Decision: protocol.DecisionDeny, Reason: "no network"})
+	api := httptest.NewServer(NewAPIServer(srv, "127.0.0.1:0", log.New(io.Discard, "", 0)).server.Handler)
+	defer api.Close()
+
+	resp, err := http.Get(api.URL + "/api/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain; version=0.0.4") ||
+		!strings.Contains(string(body), `clawrden_rule_decisions_total{rule="rule 1 (curl)",action="deny",decision="deny",outcome=""} 1`) {
+		t.Errorf("GET /api/metrics: %s\n%s", resp.Header.Get("Content-Type"), body)
+	}
+
+	resp, err = http.Get(api.URL + "/api/metrics/rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var annotations []RuleAnnotation
+	json.NewDecoder(resp.Body).Decode(&annotations)
+	resp.Body.Close()
+	if len(annotations) != 1 || annotations[0].Reason != "no network" || annotations[0].Denials != 1 {
+		t.Errorf("GET /api/metrics/rules = %+v", annotations)
+	}
+}
@@ -0,0 +1,96 @@
+package warden
+
+import (
+	"clawrden/internal/executor"
+	"clawrden/pkg/protocol"
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// sandboxCopyOutTimeout bounds how long sandbox results wait for a reviewer
+// to approve copying them back into the real workspace.
+const sandboxCopyOutTimeout = 15 * time.Minute
+
+// copyOutCommand is the pseudo-command shown to reviewers for copy-out approvals.
+const copyOutCommand = "clawrden-copy-out"
+
+// SandboxRecord is the audit record of a sandboxed execution.
+type SandboxRecord struct {
+	Path      string   `json:"path"`
+	CopiedIn  []string `json:"copied_in,omitempty"`
+	CopiedOut []string `json:"copied_out,omitempty"`
+	CopyOut   string   `json:"copy_out,omitempty"` // "none", "auto", "approved", "denied", "failed"
+}
+
+// executeSandboxed runs the request in a fresh scratch directory seeded from its cwd.
+// Results matching the copy_out globs are copied back automatically or after
+// a reviewer approves them. The sandbox is always removed, even on cancellation.
+func (s *Server) executeSandboxed(ctx context.Context, exec executor.Executor, req *protocol.Request, conn net.Conn, sp *SandboxPolicy, entry *AuditEntry) error {
+	sb, err := executor.NewSandbox(s.config.SandboxRoot, req.Cwd, req.Identity.UID, req.Identity.GID)
+	if err != nil {
+		return fmt.Errorf("create sandbox: %w", err)
+	}
+	defer func() {
+		if err := sb.Cleanup(); err != nil {
+			s.logger.Printf("warning: failed to remove sandbox %s: %v", sb.Dir, err)
+		}
+	}()
+
+	record := &SandboxRecord{Path: sb.Dir}
+	entry.Sandbox = record
+
+	copied, err := sb.CopyIn(sp.CopyIn)
+	if err != nil {
+		return fmt.Errorf("seed sandbox: %w", err)
+	}
+	record.CopiedIn = copied
+
+	req.SandboxDir = sb.Dir
+	if err := exec.Execute(ctx, req, conn); err != nil {
+		return err
+	}
+
+	// The exit frame has been sent by now, so copy-out problems are only audited
+	outputs, err := sb.Outputs(sp.CopyOut)
+	if err != nil {
+		s.logger.Printf("sandbox: could not list outputs in %s: %v", sb.Dir, err)
+		record.CopyOut = "failed"
+		return nil
+	}
+	if len(outputs) == 0 {
+		record.CopyOut = "none"
+		return nil
+	}
+
+	if sp.CopyOutAuto {
+		record.CopyOut = "auto"
+	} else {
+		approvalCtx, cancel := context.WithTimeout(s.ctx, sandboxCopyOutTimeout)
+		defer cancel()
+
+		copyReq := &protocol.Request{
+			Command:     copyOutCommand,
+			Args:        outputs,
+			Cwd:         req.Cwd,
+			Identity:    req.Identity,
+			ContainerID: req.ContainerID,
+		}
+		if s.hitl.Enqueue(approvalCtx, copyReq) == DecisionDeny {
+			s.logger.Printf("sandbox: copy-out of %d files into %s denied", len(outputs), req.Cwd)
+			record.CopyOut = "denied"
+			return nil
+		}
+		record.CopyOut = "approved"
+	}
+
+	if err := sb.CopyOut(outputs); err != nil {
+		s.logger.Printf("sandbox: copy-out into %s failed: %v", req.Cwd, err)
+		record.CopyOut = "failed"
+		return nil
+	}
+	record.CopiedOut = outputs
+	s.logger.Printf("sandbox: copied %d files back into %s", len(outputs), req.Cwd)
+	return nil
+}
@@ -0,0 +1,246 @@
+package warden
+
+import (
+	"clawrden/pkg/protocol"
+	"context"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeExecutor runs a function instead of a real command.
+type fakeExecutor struct {
+	run func(req *protocol.Request) error
+}
+
+func (f *fakeExecutor) Execute(ctx context.Context, req *protocol.Request, conn net.Conn) error {
+	return f.run(req)
+}
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return &Server{
+		config:     Config{SandboxRoot: t.TempDir()},
+		hitl:       NewHITLQueue(),
+		logger:     log.New(io.Discard, "", 0),
+		peers:      kernelPeers{},
+		annotators: annotators,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+func TestExecuteSandboxedCopyInAndAutoCopyOut(t *testing.T) {
+	srv := newTestServer(t)
+	workspace := t.TempDir()
+	writeTestFile(t, filepath.Join(workspace, "snippet.py"), "print(1)")
+	writeTestFile(t, filepath.Join(workspace, "lib", "helper.py"), "x = 1")
+	writeTestFile(t, filepath.Join(workspace, "secrets.env"), "TOKEN=abc")
+
+	var sandboxDir string
+	exec := &fakeExecutor{run: func(req *protocol.Request) error {
+		sandboxDir = req.SandboxDir
+		if req.SandboxDir == "" || req.SandboxDir == req.Cwd {
+			t.Errorf("executor did not receive a sandbox dir: %q", req.SandboxDir)
+		}
+		if _, err := os.Stat(filepath.Join(req.SandboxDir, "secrets.env")); !os.IsNotExist(err) {
+			t.Errorf("secrets.env should not have been copied in")
+		}
+		writeTestFile(t, filepath.Join(req.SandboxDir, "out", "result.txt"), "42")
+		writeTestFile(t, filepath.Join(req.SandboxDir, "scratch.tmp"), "junk")
+		return nil
+	}}
+
+	req := &protocol.Request{Command: "python", Cwd: workspace}
+	sp := &SandboxPolicy{CopyIn: []string{"*.py"}, CopyOut: []string{"*.txt"}, CopyOutAuto: true}
+	var entry AuditEntry
+
+	if err := srv.executeSandboxed(context.Background(), exec, req, nil, sp, &entry); err != nil {
+		t.Fatalf("executeSandboxed: %v", err)
+	}
+
+	if entry.Sandbox == nil {
+		t.Fatal("audit entry has no sandbox record")
+	}
+	if want := []string{"lib/helper.py", "snippet.py"}; !reflect.DeepEqual(entry.Sandbox.CopiedIn, want) {
+		t.Errorf("CopiedIn = %v, want %v", entry.Sandbox.CopiedIn, want)
+	}
+	if want := []string{"out/result.txt"}; !reflect.DeepEqual(entry.Sandbox.CopiedOut, want) {
+		t.Errorf("CopiedOut = %v, want %v", entry.Sandbox.CopiedOut, want)
+	}
+	if entry.Sandbox.CopyOut != "auto" {
+		t.Errorf("CopyOut = %q, want auto", entry.Sandbox.CopyOut)
+	}
+
+	data, err := os.ReadFile(filepath.Join(workspace, "out", "result.txt"))
+	if err != nil || string(data) != "42" {
+		t.Errorf("result.txt not copied back: %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(workspace, "scratch.tmp")); !os.IsNotExist(err) {
+		t.Error("scratch.tmp should not have been copied out")
+	}
+	if _, err := os.Stat(sandboxDir); !os.IsNotExist(err) {
+		t.Errorf("sandbox %s was not cleaned up", sandboxDir)
+	}
+}
+
+func TestExecuteSandboxedCopyOutRequiresApproval(t *testing.T) {
+	tests := []struct {
+		name     string
+		decision Decision
+		copyOut  string
+		copied   bool
+	}{
+		{"approved", DecisionApprove, "approved", true},
+		{"denied", DecisionDeny, "denied", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t)
+			workspace := t.TempDir()
+
+			exec := &fakeExecutor{run: func(req *protocol.Request) error {
+				writeTestFile(t, filepath.Join(req.SandboxDir, "report.json"), "{}")
+				return nil
+			}}
+
+			// Reviewer resolves the copy-out request once it shows up
+			go func() {
+				for i := 0; i < 100; i++ {
+					for _, p := range srv.hitl.List() {
+						if p.Request.Command == copyOutCommand {
+							srv.hitl.Resolve(p.ID, tt.decision)
+							return
+						}
+					}
+					time.Sleep(10 * time.Millisecond)
+				}
+			}()
+
+			req := &protocol.Request{Command: "python", Cwd: workspace}
+			sp := &SandboxPolicy{CopyOut: []string{"*.json"}}
+			var entry AuditEntry
+
+			if err := srv.executeSandboxed(context.Background(), exec, req, nil, sp, &entry); err != nil {
+				t.Fatalf("executeSandboxed: %v", err)
+			}
+
+			if entry.Sandbox.CopyOut != tt.copyOut {
+				t.Errorf("CopyOut = %q, want %q", entry.Sandbox.CopyOut, tt.copyOut)
+			}
+			_, err := os.Stat(filepath.Join(workspace, "report.json"))
+			if copied := err == nil; copied != tt.copied {
+				t.Errorf("report.json copied = %v, want %v", copied, tt.copied)
+			}
+		})
+	}
+}
+
+func TestExecuteSandboxedCleansUpOnError(t *testing.T) {
+	srv := newTestServer(t)
+
+	var sandboxDir string
+	exec := &fakeExecutor{run: func(req *protocol.Request) error {
+		sandboxDir = req.SandboxDir
+		return context.Canceled
+	}}
+
+	req := &protocol.Request{Command: "python", Cwd: t.TempDir()}
+	var entry AuditEntry
+	if err := srv.executeSandboxed(context.Background(), exec, req, nil, &SandboxPolicy{}, &entry); err == nil {
+		t.Fatal("expected executor error to propagate")
+	}
+	if _, err := os.Stat(sandboxDir); !os.IsNotExist(err) {
+		t.Errorf("sandbox %s was not cleaned up after error", sandboxDir)
+	}
+}
+
+func TestSandboxCopyOutRefusesSymlinks(t *testing.T) {
+	srv := newTestServer(t)
+	workspace := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(workspace, "out")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+
+	exec := &fakeExecutor{run: func(req *protocol.Request) error {
+		writeTestFile(t, filepath.Join(req.SandboxDir, "out", "evil.txt"), "pwned")
+		return nil
+	}}
+
+	req := &protocol.Request{Command: "python", Cwd: workspace}
+	sp := &SandboxPolicy{CopyOut: []string{"*.txt"}, CopyOutAuto: true}
+	var entry AuditEntry
+	if err := srv.executeSandboxed(context.Background(), exec, req, nil, sp, &entry); err != nil {
+		t.Fatalf("executeSandboxed: %v", err)
+	}
+
+	if entry.Sandbox.CopyOut != "failed" {
+		t.Errorf("CopyOut = %q, want failed", entry.Sandbox.CopyOut)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "evil.txt")); !os.IsNotExist(err) {
+		t.Error("copy-out wrote through a symlink")
+	}
+}
+
+func TestSandboxCopyOutRefusesFileSwappedDuringReview(t *testing.T) {
+	srv := newTestServer(t)
+	workspace := t.TempDir()
+	secret := filepath.Join(t.TempDir(), "secret")
+	writeTestFile(t, secret, "TOKEN=abc")
+
+	var sandboxDir string
+	exec := &fakeExecutor{run: func(req *protocol.Request) error {
+		sandboxDir = req.SandboxDir
+		writeTestFile(t, filepath.Join(req.SandboxDir, "report.json"), "{}")
+		return nil
+	}}
+
+	// While the copy-out waits for a reviewer, the output becomes a symlink
+	go func() {
+		for i := 0; i < 100; i++ {
+			for _, p := range srv.hitl.List() {
+				if p.Request.Command == copyOutCommand {
+					report := filepath.Join(sandboxDir, "report.json")
+					os.Remove(report)
+					os.Symlink(secret, report)
+					srv.hitl.Resolve(p.ID, DecisionApprove)
+					return
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	req := &protocol.Request{Command: "python", Cwd: workspace}
+	sp := &SandboxPolicy{CopyOut: []string{"*.json"}}
+	var entry AuditEntry
+	if err := srv.executeSandboxed(context.Background(), exec, req, nil, sp, &entry); err != nil {
+		t.Fatalf("executeSandboxed: %v", err)
+	}
+
+	if entry.Sandbox.CopyOut != "failed" {
+		t.Errorf("CopyOut = %q, want failed", entry.Sandbox.CopyOut)
+	}
+	if _, err := os.Lstat(filepath.Join(workspace, "report.json")); !os.IsNotExist(err) {
+		t.Error("copy-out followed a symlink swapped in during review")
+	}
+}
@@ -4,52 +4,240 @@
 package warden
 
 import (
+	"bytes"
+	"clawrden/internal/cliout"
+	"clawrden/internal/events"
 	"clawrden/internal/executor"
+	"clawrden/internal/faultinject"
 	"clawrden/internal/jailhouse"
+	"clawrden/internal/securefile"
 	"clawrden/pkg/protocol"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
-	"net/http"
+	"net/url"
 	"os"
+	"runtime/debug"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/docker/docker/client"
+	"google.golang.org/grpc"
 )
 
-// Config holds the configuration for the Warden server.
+// Config holds the configuration for the Warden server. Fields name the
+// warden flag that sets them; GET /api/config reports them, redacting the
+// ones tagged config:"secret", reducing config:"webhook" URLs to their host
+// and taking credentials out of config:"url" ones (see ConfigReport).
 type Config struct {
-	SocketPath      string
-	PolicyPath      string
-	AuditPath       string
-	APIAddr         string
-	Logger          *log.Logger
-	JailhouseArmory string // Path to armory (default: /var/lib/clawrden/armory)
-	JailhouseRoot   string // Path to jailhouse root (default: /var/lib/clawrden/jailhouse)
-	JailhouseState  string // Path to state file (default: /var/lib/clawrden/jailhouse.state.json)
+	SocketPath      string      `flag:"socket"`
+	PolicyPath      string      `flag:"policy"`
+	AuditPath       string      `flag:"audit"`
+	APIAddr         string      `flag:"api"`
+	GRPCAddr        string      `flag:"grpc"`                            // Address of the optional gRPC API (WardenControl); disabled when empty
+	GRPCToken       string      `flag:"grpc-token-file" config:"secret"` // Bearer token gRPC callers must send as "authorization" metadata; empty accepts any caller
+	Logger          *log.Logger `config:"-"`
+	JailhouseArmory string      `flag:"armory-path"`                 // Path to armory (default: /var/lib/clawrden/armory)
+	JailhouseRoot   string      `flag:"jailhouse-path"`              // Path to jailhouse root (default: /var/lib/clawrden/jailhouse)
+	JailhouseState  string      `flag:"state-path"`                  // Path to state file (default: /var/lib/clawrden/jailhouse.state.json)
+	EmbeddedShim    []byte      `flag:"no-embedded-shim" config:"-"` // Shim installed into an armory without one; nil requires the armory to provide it
+	SandboxRoot     string      `flag:"sandbox-root"`                // Parent directory for sandboxed working directories (default: os.TempDir())
+	TranscriptDir   string      `flag:"transcript-dir"`              // Directory for request transcripts (default: /var/lib/clawrden/transcripts)
+	SpoolDir        string      `flag:"spool-dir"`                   // Directory for output spooled from stalled shims (default: /var/lib/clawrden/spool)
+
+	// How long a write of command output to a shim may block before the
+	// shim counts as stalled (default: 2m; negative waits forever)
+	StallTimeout time.Duration `flag:"stall-timeout"`
+
+	AutoJailFromLabels bool          `flag:"auto-jail"`       // Create/destroy jails from clawrden.* labels as containers start/stop
+	AutoJailGrace      time.Duration `flag:"auto-jail-grace"` // Delay before destroying a label jail after its last container stops (default: 30s)
+
+	APIDebug             bool          `flag:"api-debug"`                        // Log every API request (method, path, status, duration, caller)
+	SlowRequestThreshold time.Duration `flag:"slow-request"`                     // API requests slower than this are logged as warnings (default: 1s)
+	DisableDashboard     bool          `flag:"disable-dashboard"`                // Serve only /api/*; the web UI returns 404
+	APITLSCert           string        `flag:"api-tls-cert"`                     // PEM certificate file for the API; plain HTTP when empty. Re-read on each API restart
+	APITLSKey            string        `flag:"api-tls-key"`                      // PEM key file for APITLSCert
+	AdminToken           string        `flag:"admin-token-file" config:"secret"` // Bearer token /api/admin/* callers must send; the admin endpoints are disabled when empty
+
+	// Reviewers who approve through the HTTP API with a bearer token. Only
+	// their approvals count towards asks that need several approvers or are
+	// routed to channels (see ParseReviewerTokens).
+	ReviewerTokens []ReviewerToken `flag:"reviewer-tokens-file" config:"secret"`
+
+	// Origins whose pages may call the API (CORS), e.g. a dashboard behind a
+	// reverse proxy on another host. See ParseAllowedOrigins.
+	AllowedOrigins []string `flag:"allowed-origins"`
+
+	BridgeStaleAfter   time.Duration `flag:"bridge-stale-after"`                    // Warn when a bridge sends no heartbeat for this long (default: 2m)
+	BridgeAlertWebhook string        `flag:"bridge-alert-webhook" config:"webhook"` // Optional URL POSTed to when a bridge goes silent
+
+	ApprovalLinkKey []byte        `flag:"approval-link-key-file" config:"secret"` // HMAC key for one-time approve/deny links; links are disabled when empty
+	ApprovalLinkTTL time.Duration `flag:"approval-link-ttl"`                      // Lifetime of approval links (default: 15m)
+	PublicURL       string        `flag:"public-url" config:"url"`                // Base URL used in approval links (default: the Host of the minting request) and in the review links sent to shims
+
+	IncidentWebhook string `flag:"incident-webhook" config:"webhook"` // Optional URL POSTed to when an incident opens, the Docker daemon goes down or recovers, or a policy reload is held
+
+	DockerPingInterval time.Duration `flag:"docker-ping-interval"` // How often to probe a healthy Docker daemon (default: 10s)
+
+	AuditFailureMode AuditFailureMode `flag:"audit-failure-mode"` // What to do while audit entries cannot be written (default: log)
+	AuditBufferSize  int              `flag:"audit-buffer-size"`  // Entries held in memory by the buffer and block modes (default: 1000)
+	AuditSync        AuditSyncPolicy  `flag:"audit-sync"`         // When entries are fsynced: none, started or always (default: none)
+
+	// Whether the policy file and audit log must be safe from untrusted
+	// users (default: warn), and who may own them (default: root or the
+	// warden's user)
+	FileCheckMode    FileCheckMode           `flag:"file-check"`
+	FileExpectations securefile.Expectations `flag:"file-owner"`
+
+	// Deny requests unless the peer runs the armory shim through a jail symlink.
+	// Off by default: development setups connect with test clients.
+	RequireShimProvenance bool `flag:"require-shim-provenance"`
+
+	// Let "strategy: local" run containerized requests on the warden host.
+	// Off by default: such rules deny instead.
+	AllowHostFallback bool `flag:"allow-host-fallback"`
+
+	// Prompt for HITL decisions on the warden's terminal (see Console).
+	// Ignored unless stdin and stdout are terminals.
+	Console bool `flag:"console"`
+
+	// Where the warden mounts the volume ghost containers see as /app, if
+	// it does. Snapshots for the ghost policy's track_changes then scan it,
+	// and ownership fixes chown in it, directly instead of in a helper
+	// container.
+	WorkspaceDir string `flag:"workspace-dir"`
+
+	// A second policy every request is also evaluated against, without
+	// enforcing it, to see where it would decide differently (see
+	// ShadowPolicy). It reloads on its own when the file changes.
+	ShadowPolicyPath string `flag:"shadow-policy"`
+
+	// Names this warden in the owner label of the ghost containers it
+	// creates, so after a crash it removes only its own leftovers. Keep it
+	// stable across restarts (default: the host name).
+	InstanceID string `flag:"instance-id"`
+
+	// Cap on ghost containers existing at once, whatever the request
+	// concurrency; more are refused (0 = no cap).
+	MaxGhosts int `flag:"max-ghosts"`
+
+	// Self-limits for a busy host (see ResourceMonitor): shim connections
+	// open at once, past which more are denied; memory use in bytes past
+	// which ghost executions are refused and transcripts and output capture
+	// are skipped; and the Go runtime's soft memory limit (debug.SetMemoryLimit).
+	// 0 disables each.
+	MaxConnections  int   `flag:"max-connections"`
+	MemoryWatermark int64 `flag:"memory-watermark-mb"`
+	MemoryLimit     int64 `flag:"memory-limit-mb"`
+
+	// Before a reloaded policy takes effect, the last PolicyCanary audited
+	// requests (default: 200; negative disables the canary) are decided
+	// again under it. If more than PolicyCanaryThreshold of the allowed ones
+	// would now be denied, or of the denied ones allowed (default: 0.1), the
+	// reload is held until confirmed (see ConfirmPolicyReload).
+	PolicyCanary          int     `flag:"policy-canary"`
+	PolicyCanaryThreshold float64 `flag:"policy-canary-threshold"`
+
+	// Rules counted separately in the rule metrics before the rest are
+	// counted as "(other)" (default: 100)
+	MaxRuleMetrics int `flag:"max-rule-metrics"`
+
+	// Flags given on the command line, by name, so GET /api/config can say
+	// which settings came from a flag rather than their default; nil when
+	// the warden was not started from its command line
+	FlagsSet map[string]bool `config:"-"`
 }
 
 // Server is the Warden supervisor.
 type Server struct {
 	config   Config
 	listener net.Listener
-	policy   *PolicyEngine
+	policy   atomic.Pointer[policyState] // See currentPolicy
 	hitl     *HITLQueue
 	audit    *AuditLogger
 	api      *APIServer
+	grpc     *GRPCServer
 	logger   *log.Logger
 
 	// Executors: dockerExec for containerized requests, localExec for host/dev
 	dockerExec *executor.DockerExecutor // nil if Docker unavailable
 	localExec  *executor.LocalExecutor
+	docker     *DockerSupervisor // Docker daemon health; nil with dockerExec
+	images     *ImageResolver    // Images of requesting containers; nil with dockerExec
+
+	// Workspace snapshots for the ghost policy's track_changes, and the
+	// ownership fixes after ghost commands; nil with dockerExec
+	snapshots workspaceSnapshotter
+	ownership ownershipFixer
 
 	// Jailhouse components
 	jailhouse     *jailhouse.Manager
 	policyWatcher *PolicyWatcher
+	reloadMu      sync.Mutex // Serializes applyPolicy
+	policyEditMu  sync.Mutex // Serializes edits through the policy API
+
+	// Policy canary: the reload it holds, and the one confirmed past it
+	canaryMu        sync.Mutex
+	heldReload      *HeldReload
+	canaryConfirmed *PolicyEngine
+
+	// Label-driven jail provisioning (nil unless Config.AutoJailFromLabels)
+	autoJailer      *AutoJailer
+	containerEvents ContainerEventSource
+
+	// Chat bridge heartbeats
+	bridges *BridgeRegistry
+
+	// In-process events: audit, HITL, jail and policy changes
+	events *events.Bus
+
+	// Signed one-time approval links (nil unless Config.ApprovalLinkKey is set)
+	links *LinkSigner
+
+	// Decisions typed on the warden's terminal (nil unless Config.Console)
+	console *Console
+
+	// Repeated-denial incidents and container lockdowns
+	incidents *IncidentTracker
+
+	// Announced maintenance windows
+	maintenance *MaintenanceWindow
+
+	// Output of running executions, for live tails
+	outputs *OutputRegistry
+
+	// Bytes forwarded per command and container
+	throughput *ThroughputStats
+
+	// Requests decided per policy rule, for the Prometheus metrics
+	ruleStats *RuleStats
+
+	// Who shim connections come from
+	peers peerResolver
+
+	// Annotators for asks, by command; never modified once the server runs
+	annotators map[string]annotator
+
+	// Shim provenance checks (nil unless Config.RequireShimProvenance)
+	shimVerifier *ShimVerifier
+
+	// Candidate policy evaluated alongside the real one (nil unless
+	// Config.ShadowPolicyPath)
+	shadow *ShadowPolicy
+
+	// Commands denied by default, as candidates for new rules
+	suggestions *PolicySuggestions
+
+	// The warden's own memory, goroutines and connections, and load shedding
+	resources *ResourceMonitor
+
+	startTime time.Time
+	starting  sync.Once // See Start
 
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -61,6 +249,20 @@ func NewServer(cfg Config) (*Server, error) {
 	if cfg.Logger == nil {
 		cfg.Logger = log.New(os.Stdout, "[warden] ", log.LstdFlags|log.Lmsgprefix)
 	}
+	if cfg.PolicyCanaryThreshold < 0 || cfg.PolicyCanaryThreshold > 1 {
+		return nil, fmt.Errorf("policy canary threshold %v is not a fraction between 0 and 1", cfg.PolicyCanaryThreshold)
+	}
+
+	// An attacker who could swap these would not need to get past the policy
+	if cfg.FileCheckMode != "" && !cfg.FileCheckMode.Valid() {
+		return nil, fmt.Errorf("unknown file check mode %q (want warn, strict or off)", cfg.FileCheckMode)
+	}
+	if err := checkTrustedFile(cfg, "policy file", cfg.PolicyPath); err != nil {
+		return nil, err
+	}
+	if err := checkTrustedFile(cfg, "audit log", cfg.AuditPath); err != nil {
+		return nil, err
+	}
 
 	// Load policy
 	policy, err := LoadPolicy(cfg.PolicyPath)
@@ -68,16 +270,54 @@ func NewServer(cfg Config) (*Server, error) {
 		cfg.Logger.Printf("warning: could not load policy from %s: %v (using default deny-all)", cfg.PolicyPath, err)
 		policy = DefaultPolicy()
 	}
+	logLintFindings(cfg.Logger, policy.LintFindings())
+
+	var shadow *ShadowPolicy
+	if cfg.ShadowPolicyPath != "" {
+		shadow = NewShadowPolicy(cfg.ShadowPolicyPath, cfg.Logger)
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
+	bus := events.New(cfg.Logger)
 
 	srv := &Server{
-		config: cfg,
-		policy: policy,
-		hitl:   NewHITLQueue(),
-		logger: cfg.Logger,
-		ctx:    ctx,
-		cancel: cancel,
+		config:      cfg,
+		hitl:        NewHITLQueue(),
+		logger:      cfg.Logger,
+		bridges:     NewBridgeRegistry(cfg.BridgeStaleAfter, cfg.Logger),
+		events:      bus,
+		incidents:   NewIncidentTracker(),
+		maintenance: NewMaintenanceWindow(),
+		outputs:     NewOutputRegistry(),
+		throughput:  NewThroughputStats(),
+		ruleStats:   NewRuleStats(cfg.MaxRuleMetrics),
+		shadow:      shadow,
+		suggestions: NewPolicySuggestions(),
+		peers:       kernelPeers{},
+		annotators:  annotators,
+		resources:   NewResourceMonitor(cfg.MaxConnections, cfg.MemoryWatermark, cfg.Logger),
+		startTime:   time.Now(),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+	srv.setPolicy(policy)
+	if cfg.BridgeAlertWebhook != "" {
+		srv.bridges.alert = webhookAlert(cfg.BridgeAlertWebhook, cfg.Logger)
+	}
+	if len(cfg.ApprovalLinkKey) > 0 {
+		srv.links, err = NewLinkSigner(cfg.ApprovalLinkKey, cfg.ApprovalLinkTTL)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+
+	if cfg.Console {
+		srv.console = srv.newTerminalConsole()
+	}
+	if cfg.MemoryLimit > 0 {
+		debug.SetMemoryLimit(cfg.MemoryLimit)
+		cfg.Logger.Printf("memory limit set to %s", cliout.FormatBytes(cfg.MemoryLimit))
 	}
 
 	// Initialize jailhouse (always enabled)
@@ -86,6 +326,10 @@ func NewServer(cfg Config) (*Server, error) {
 		cfg.Logger.Printf("warning: failed to initialize jailhouse: %v", err)
 	}
 
+	if cfg.RequireShimProvenance {
+		srv.shimVerifier = srv.newShimVerifier()
+	}
+
 	// Create executors — Docker for containerized requests, local as fallback
 	srv.localExec = executor.NewLocalExecutor(cfg.Logger)
 
@@ -94,6 +338,20 @@ func NewServer(cfg Config) (*Server, error) {
 		cfg.Logger.Printf("warning: docker unavailable: %v (mirror execution disabled)", dockerErr)
 	} else {
 		srv.dockerExec = executor.NewDockerExecutor(dockerClient, cfg.Logger)
+		srv.dockerExec.Hardening = func(command string) executor.GhostHardening {
+			return srv.currentPolicy().engine.GhostHardening(command)
+		}
+		srv.dockerExec.WorkspaceDir = cfg.WorkspaceDir
+		srv.snapshots = srv.dockerExec
+		srv.ownership = srv.dockerExec
+		srv.dockerExec.InstanceID = cfg.InstanceID
+		if srv.dockerExec.InstanceID == "" {
+			srv.dockerExec.InstanceID, _ = os.Hostname()
+		}
+		srv.dockerExec.MaxGhosts = cfg.MaxGhosts
+		srv.docker = NewDockerSupervisor(dockerClient, cfg.DockerPingInterval, cfg.Logger)
+		srv.docker.onChange = srv.dockerHealthChanged
+		srv.images = NewImageResolver(dockerClient, cfg.Logger)
 	}
 
 	// Create audit logger
@@ -101,13 +359,53 @@ func NewServer(cfg Config) (*Server, error) {
 	if err != nil {
 		return nil, fmt.Errorf("create audit logger: %w", err)
 	}
+	mode := cfg.AuditFailureMode
+	if mode == "" {
+		mode = AuditFailLog
+	}
+	if err := auditLogger.SetFailureMode(mode, cfg.AuditBufferSize, cfg.Logger); err != nil {
+		auditLogger.Close()
+		return nil, err
+	}
+	if cfg.AuditSync != "" {
+		if err := auditLogger.SetSyncPolicy(cfg.AuditSync); err != nil {
+			auditLogger.Close()
+			return nil, err
+		}
+	}
 
 	srv.audit = auditLogger
+	srv.audit.Subscribe(bus)
+	srv.ruleStats.Subscribe(bus)
+	srv.hitl.events = bus
+	if cfg.IncidentWebhook != "" {
+		bus.Subscribe("incident-webhook", incidentWebhook(cfg.IncidentWebhook, cfg.Logger), events.Async(16))
+	}
+
+	// Provision jails from container labels if enabled
+	if cfg.AutoJailFromLabels {
+		switch {
+		case srv.jailhouse == nil:
+			cfg.Logger.Printf("warning: auto-jail disabled: jailhouse unavailable")
+		case dockerErr != nil:
+			cfg.Logger.Printf("warning: auto-jail disabled: docker unavailable")
+		default:
+			srv.autoJailer = NewAutoJailer(srv.jailhouse, srv.audit, cfg.Logger, cfg.AutoJailGrace, func(jailID string) bool {
+				_, ok := srv.currentPolicy().jails[jailID]
+				return ok
+			})
+			srv.autoJailer.events = bus
+			srv.containerEvents = &dockerEventSource{client: dockerClient}
+		}
+	}
 
 	// Create HTTP API server if address is provided
 	if cfg.APIAddr != "" {
 		srv.api = NewAPIServer(srv, cfg.APIAddr, cfg.Logger)
 	}
+	if cfg.GRPCAddr != "" {
+		srv.grpc = NewGRPCServer(srv, cfg.GRPCAddr, cfg.Logger)
+	}
 
 	return srv, nil
 }
@@ -136,6 +434,7 @@ func (s *Server) initializeJailhouse() error {
 		JailhousePath: jailhousePath,
 		StatePath:     statePath,
 		Logger:        s.logger,
+		EmbeddedShim:  s.config.EmbeddedShim,
 	})
 	if err != nil {
 		return fmt.Errorf("create jailhouse manager: %w", err)
@@ -148,31 +447,33 @@ func (s *Server) initializeJailhouse() error {
 
 	s.jailhouse = jailhouseMgr
 
-	// Create jails from policy config
-	for jailID, cfg := range s.policy.GetJails() {
-		if _, err := s.jailhouse.GetJail(jailID); err == nil {
-			s.logger.Printf("jail %s already exists (from persisted state), skipping", jailID)
-			continue
-		}
-		if err := s.jailhouse.CreateJail(jailID, cfg.Commands, cfg.Hardened); err != nil {
-			s.logger.Printf("warning: failed to create jail %s: %v", jailID, err)
-		} else {
-			s.logger.Printf("created jail %s: %v", jailID, cfg.Commands)
-		}
+	// Create jails from policy config; jails persisted from an earlier run
+	// keep their commands
+	policy := s.currentPolicy()
+	if err := s.applyPolicy(policy.engine); err != nil {
+		s.logger.Printf("warning: policy jails not created: %v", err)
 	}
 
 	// Create policy watcher for hot-reload
 	if s.config.PolicyPath != "" {
-		policyWatcher, err := NewPolicyWatcher(s.config.PolicyPath, s.policy, s.logger)
+		policyWatcher, err := NewPolicyWatcher(s.config.PolicyPath, policy.engine, s.logger)
 		if err != nil {
 			s.logger.Printf("warning: failed to create policy watcher: %v (hot-reload disabled)", err)
 		} else {
 			s.policyWatcher = policyWatcher
 
-			// Register callback to update server's policy reference
+			// Reloaded policies take effect through reloadPolicy, whose
+			// canary may hold them and which may reject them, as may the
+			// file checks
+			s.policyWatcher.SetApply(func(p *PolicyEngine) error {
+				if err := checkTrustedFile(s.config, "policy file", s.config.PolicyPath); err != nil {
+					return err
+				}
+				return s.reloadPolicy(p)
+			})
 			s.policyWatcher.OnReload(func(newPolicy *PolicyEngine) {
-				s.policy = newPolicy
 				s.logger.Printf("server policy updated after hot-reload")
+				s.events.Publish(events.PolicyReloaded{Path: s.config.PolicyPath})
 			})
 		}
 	}
@@ -181,8 +482,17 @@ func (s *Server) initializeJailhouse() error {
 	return nil
 }
 
-// ListenAndServe starts the Unix socket listener and accepts connections.
+// ListenAndServe starts the warden (see Start) with the Unix socket
+// listener as its front-end, and accepts shim connections until Shutdown.
 func (s *Server) ListenAndServe() error {
+	if err := s.Listen(); err != nil {
+		return err
+	}
+	return s.Serve()
+}
+
+// Listen opens the Unix socket shims connect to, for Serve.
+func (s *Server) Listen() error {
 	// Remove existing socket file if it exists
 	os.Remove(s.config.SocketPath)
 
@@ -197,7 +507,6 @@ func (s *Server) ListenAndServe() error {
 	if err != nil {
 		return fmt.Errorf("listen on %s: %w", s.config.SocketPath, err)
 	}
-	defer s.listener.Close()
 
 	// Make the socket accessible
 	if err := os.Chmod(s.config.SocketPath, 0666); err != nil {
@@ -205,14 +514,66 @@ func (s *Server) ListenAndServe() error {
 	}
 
 	s.logger.Printf("listening on %s", s.config.SocketPath)
+	return nil
+}
 
+// Serve starts the warden (see Start) and accepts shim connections on the
+// socket Listen opened until Shutdown.
+func (s *Server) Serve() error {
+	defer s.listener.Close()
+	s.Start()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.ctx.Done():
+				return nil // Clean shutdown
+			default:
+				s.logger.Printf("accept error: %v", err)
+				continue
+			}
+		}
+
+		// Past the connection cap, deny instead of taking on the request
+		s.wg.Add(1)
+		if !s.resources.Acquire() {
+			go func() {
+				defer s.wg.Done()
+				s.refuseOverloaded(conn)
+			}()
+			continue
+		}
+		go func() {
+			defer s.wg.Done()
+			defer s.resources.Release()
+			s.handleConnection(conn)
+		}()
+	}
+}
+
+// Start starts what the warden runs alongside its front-ends: the HTTP and
+// gRPC APIs if configured, the policy watchers, and the background checks
+// and sweeps. ListenAndServe calls it; a warden embedded without the socket
+// calls it instead, and takes requests through Submit. Later calls do
+// nothing.
+func (s *Server) Start() {
+	s.starting.Do(s.start)
+}
+
+func (s *Server) start() {
 	// Start HTTP API server if configured
 	if s.api != nil {
+		if err := s.api.Start(); err != nil {
+			s.logger.Printf("HTTP API server error: %v", err)
+		}
+	}
+	if s.grpc != nil {
 		s.wg.Add(1)
 		go func() {
 			defer s.wg.Done()
-			if err := s.api.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-				s.logger.Printf("HTTP API server error: %v", err)
+			if err := s.grpc.ListenAndServe(); err != nil && err != grpc.ErrServerStopped {
+				s.logger.Printf("gRPC API server error: %v", err)
 			}
 		}()
 	}
@@ -227,188 +588,922 @@ func (s *Server) ListenAndServe() error {
 			}
 		}()
 	}
-
-	for {
-		conn, err := s.listener.Accept()
-		if err != nil {
-			select {
-			case <-s.ctx.Done():
-				return nil // Clean shutdown
-			default:
-				s.logger.Printf("accept error: %v", err)
-				continue
-			}
+	if s.shadow != nil && s.shadow.watcher != nil {
+		if err := s.shadow.watcher.Start(s.ctx); err != nil {
+			s.logger.Printf("Shadow policy watcher error: %v", err)
 		}
+	}
 
+	// Watch for chat bridges that stop sending heartbeats
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.bridges.Run(s.ctx, bridgeCheckInterval)
+	}()
+
+	// Log the warden's own resource use
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.resources.Run(s.ctx, resourceLogInterval)
+	}()
+
+	// Sample output counts for windowed throughput reports
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.throughput.Run(s.ctx, throughputInterval)
+	}()
+
+	// Watch the Docker daemon, which containerized requests depend on
+	if s.docker != nil {
 		s.wg.Add(1)
 		go func() {
 			defer s.wg.Done()
-			s.handleConnection(conn)
+			s.docker.Run(s.ctx)
 		}()
 	}
+
+	// Remove ghost containers left behind by a warden that was killed
+	if s.dockerExec != nil {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.runGhostSweeper(s.ctx, s.dockerExec)
+		}()
+	}
+
+	// Start label-driven jail provisioning if enabled
+	if s.autoJailer != nil {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.autoJailer.Run(s.ctx, s.containerEvents)
+		}()
+	}
+
+	// Prompt for decisions on the terminal
+	if s.console != nil {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.console.Run(s.ctx)
+		}()
+	}
+
 }
 
-// Shutdown gracefully shuts down the server.
+// RestartAPI stops the HTTP API and starts it again, leaving the shim socket
+// and in-flight commands alone.
+func (s *Server) RestartAPI() error {
+	if s.api == nil {
+		return ErrNoAPI
+	}
+	return s.api.Restart()
+}
+
+// Shutdown gracefully shuts down the server: the HTTP API first, so no new
+// work arrives over it, then the shim socket, waiting for its commands.
 func (s *Server) Shutdown() {
 	s.cancel()
 	if s.api != nil {
-		s.api.Shutdown()
+		s.api.Stop()
+	}
+	if s.grpc != nil {
+		s.grpc.Shutdown()
 	}
 	if s.policyWatcher != nil {
 		s.policyWatcher.Stop()
 	}
+	if s.shadow != nil && s.shadow.watcher != nil {
+		s.shadow.watcher.Stop()
+	}
 	if s.listener != nil {
 		s.listener.Close()
 	}
 	s.wg.Wait()
+	s.events.Close()
 	if s.audit != nil {
 		s.audit.Close()
 	}
 }
 
-// handleConnection processes a single shim connection.
+// handleConnection processes a shim connection: a single request, or each
+// request of a persistent session in turn.
 func (s *Server) handleConnection(conn net.Conn) {
 	defer conn.Close()
 
-	connCtx, connCancel := context.WithCancel(s.ctx)
-	defer connCancel()
-
 	// Extract peer credentials (kernel-enforced, unfakeable)
-	peerCreds, peerErr := extractPeerCreds(conn)
+	peerCreds, peerErr := s.peers.Credentials(conn)
 	if peerErr != nil {
 		s.logger.Printf("warning: could not extract peer credentials: %v", peerErr)
 		// Continue without peer creds — local/dev mode will still work
 	}
+	sess := &shimSession{conn: conn, creds: peerCreds}
 
-	// Monitor for cancel frames from the shim
-	go s.monitorCancel(conn, connCancel)
+	for {
+		// Read the request, keeping its raw bytes for a transcript
+		var rawRequest bytes.Buffer
+		req, err := s.readSessionRequest(sess, &rawRequest)
+		if err != nil {
+			if !sessionEnded(err) {
+				s.logger.Printf("read request error: %v", err)
+			}
+			return
+		}
+		if err := faultinject.Check(faultinject.PointRequest, conn); err != nil {
+			s.logger.Printf("read request error: %v", err)
+			return
+		}
 
-	// Read the request
-	req, err := protocol.ReadRequest(conn)
-	if err != nil {
-		s.logger.Printf("read request error: %v", err)
-		return
-	}
+		// Resolve identity and container ID from peer credentials
+		s.applyPeerCreds(sess, req)
 
-	// Resolve container ID from peer credentials
-	if peerCreds != nil {
-		// Override self-reported identity with kernel-enforced values
-		req.Identity.UID = int(peerCreds.UID)
-		req.Identity.GID = int(peerCreds.GID)
+		// Refuse what no shim would send before any of it is used; a
+		// session that sends it ends
+		req.Normalize()
+		if err := req.Validate(); err != nil {
+			s.rejectMalformed(conn, req, err)
+			return
+		}
 
-		// Resolve which container the peer process belongs to
-		containerID, resolveErr := resolveContainerID(peerCreds.PID)
-		if resolveErr != nil {
-			s.logger.Printf("warning: could not resolve container ID for pid %d: %v", peerCreds.PID, resolveErr)
-		} else if containerID != "" {
-			req.ContainerID = containerID
+		if req.Type == protocol.RequestTypeStatus {
+			s.handleStatusRequest(conn, req)
+			return
 		}
+
+		sess.persistent = sess.persistent || req.Persistent
+		if !sess.persistent {
+			s.serveRequest(conn, peerCreds, req, rawRequest.Bytes())
+			return
+		}
+
+		connCtx, connCancel := context.WithCancel(s.ctx)
+		stop := s.watchSession(conn, connCancel)
+		s.handleRequest(connCtx, conn, peerCreds, req, rawRequest.Bytes(), true)
+		connCancel()
+		next, err := stop()
+		if err != nil || s.ctx.Err() != nil {
+			return
+		}
+		sess.pending = next
+		sess.requests++
+	}
+}
+
+// serveRequest handles req, the only request on conn, which is cancelled if
+// the other end hangs up before it has ended.
+func (s *Server) serveRequest(conn net.Conn, peerCreds *PeerCredentials, req *protocol.Request, rawRequest []byte) {
+	connCtx, connCancel := context.WithCancel(s.ctx)
+	defer connCancel()
+
+	// Monitor for cancel frames from the shim. This only starts once the
+	// request is read, or the monitor could consume its first byte.
+	if req.TTY {
+		term := newTerminalInput()
+		req.Terminal = term.TerminalInput()
+		defer term.close()
+		go s.monitorTerminal(conn, connCancel, term)
+	} else {
+		go s.monitorCancel(conn, connCancel)
 	}
+	s.handleRequest(connCtx, conn, peerCreds, req, rawRequest, false)
+}
+
+// handleRequest evaluates and runs one request that passed validation,
+// answering it on conn. session tells the shim the connection stays open
+// for the next request of a persistent session once this one ends.
+func (s *Server) handleRequest(connCtx context.Context, conn net.Conn, peerCreds *PeerCredentials, req *protocol.Request, rawRequest []byte, session bool) {
+	// The policy in force when the request arrived decides all of it
+	policy := s.currentPolicy()
+
+	jailOwned := s.resolveJail(policy, req)
+	s.recordJailUse(req)
+
+	// The IDs come from the agent's environment; never trust the shim's cleanup
+	req.TaskID = protocol.SanitizeCorrelationID(req.TaskID)
+	req.RunID = protocol.SanitizeCorrelationID(req.RunID)
+	req.Session = req.Session.Sanitize()
 
 	s.logger.Printf("request: %s %v (cwd=%s, uid=%d, container=%s)",
 		req.Command, req.Args, req.Cwd, req.Identity.UID, truncateID(req.ContainerID))
+	s.events.Publish(events.RequestReceived{Request: req})
 
 	// Prepare audit entry
 	startTime := time.Now()
 	auditEntry := AuditEntry{
-		Command:     req.Command,
-		Args:        req.Args,
-		Cwd:         req.Cwd,
-		Identity:    req.Identity,
-		ContainerID: req.ContainerID,
+		RequestID:      newID("req", startTime), // Replaced by the queue ID if the request is reviewed
+		Command:        req.Command,
+		Args:           req.Args,
+		Cwd:            req.Cwd,
+		Identity:       req.Identity,
+		IdentitySource: identitySource(peerCreds),
+		ContainerID:    req.ContainerID,
+		JailID:         req.JailID,
+		TaskID:         req.TaskID,
+		RunID:          req.RunID,
+		Session:        reportedSession(req.Session),
+		GroupNames:     GroupNames(req.Identity),
+		PolicyHash:     policy.engine.Hash(),
+		session:        session,
+	}
+
+	// A request type from a newer shim is refused, never run as a command
+	if req.Type != protocol.RequestTypeExec {
+		s.logger.Printf("refusing %s: unknown request type %q (shim protocol version %d)", req.Command, req.Type, req.Version)
+		auditEntry.Decision, auditEntry.Outcome = protocol.DecisionDeny, protocol.OutcomeUnknownRequestType
+		auditEntry.Error = fmt.Sprintf("unknown request type %q", req.Type)
+		s.deny(conn, &auditEntry, fmt.Sprintf("this warden (protocol version %d) does not know %q requests", protocol.ProtocolVersion, req.Type))
+		return
+	}
+
+	// Only the armory shim, invoked through a jail, may run commands
+	if s.shimVerifier != nil {
+		var err error
+		if peerCreds == nil {
+			err = fmt.Errorf("%w: no peer credentials", ErrUntrustedClient)
+		} else {
+			err = s.shimVerifier.Verify(peerCreds.PID, req)
+		}
+		if err != nil {
+			s.logger.Printf("SECURITY: refusing %s: %v", req.Command, err)
+			auditEntry.Decision, auditEntry.Outcome = protocol.DecisionDeny, protocol.OutcomeUntrustedClient
+			auditEntry.Error = err.Error()
+			s.deny(conn, &auditEntry, "")
+			return
+		}
+	}
+
+	// Refuse everything from a container in lockdown
+	if inc := s.incidents.Lockdown(req); inc != nil {
+		s.logger.Printf("SECURITY: refusing %s from %s: locked down by incident %s", req.Command, inc.Subject, inc.ID)
+		auditEntry.Decision, auditEntry.Outcome = protocol.DecisionDeny, protocol.OutcomeLockdown
+		auditEntry.Error = "locked down by incident " + inc.ID
+		s.deny(conn, &auditEntry, "")
+		return
 	}
 
-	// Validate path security boundary using policy
-	if err := s.policy.ValidatePath(req.Cwd); err != nil {
+	// Refuse everything while the audit trail cannot be written, if so configured
+	if s.audit != nil && !s.audit.Accepting() {
+		h := s.audit.Health()
+		s.logger.Printf("SECURITY: refusing %s: audit log unwritable since %s", req.Command, h.Since.Format(time.RFC3339))
+		auditEntry.Decision, auditEntry.Outcome = protocol.DecisionDeny, protocol.OutcomeAuditUnavailable
+		auditEntry.Error = h.Error
+		s.deny(conn, &auditEntry, "the warden cannot write its audit log, so no commands run until it can; ask an operator to check the audit log's disk")
+		return
+	}
+
+	// Validate path security boundary using policy. Validate made sure the
+	// cwd, which executors run in, is absolute and clean, so the policy is
+	// the only path check.
+	if err := policy.engine.ValidatePath(req.Cwd); err != nil {
 		s.logger.Printf("SECURITY: %v", err)
-		auditEntry.Decision = "deny (path violation)"
+		auditEntry.Decision, auditEntry.Outcome = protocol.DecisionDeny, protocol.OutcomePathViolation
 		auditEntry.Error = err.Error()
-		s.audit.Log(auditEntry)
-		protocol.WriteAck(conn, protocol.AckDenied)
+		s.deny(conn, &auditEntry, "")
+		s.openIncident(s.incidents.ObservePathViolation(policy.engine.Incidents(), req, err))
 		return
 	}
 
 	// Scrub the environment
-	req.Env = ScrubEnvironment(req.Env)
+	var envReport EnvReport
+	req.Env, envReport = ScrubEnvironment(req.Env)
+	auditEntry.Env = &envReport
+
+	// Look up the container's image for image-scoped rules
+	s.resolveImage(req)
+	auditEntry.Image, auditEntry.ImageDigest = req.Image, req.ImageDigest
+
+	// Evaluate policy, the jail's own rules first
+	evalResult, jailRules := s.evaluate(policy, req, jailOwned)
+	if s.shadow != nil {
+		s.shadow.Observe(req, jailRules, evalResult)
+	}
+	s.logger.Printf("policy decision: %s for %s (timeout: %v)", evalResult.Action, req.Command, evalResult.ExecTimeout)
+	s.events.Publish(events.DecisionMade{Request: req, Action: string(evalResult.Action), Timeout: evalResult.ExecTimeout})
+	auditEntry.Rule, auditEntry.Reason = evalResult.MatchedRule, evalResult.Reason
+	auditEntry.action = evalResult.Action
+	auditEntry.trailer = evalResult.Trailer
+	auditEntry.URLHosts = evalResult.URLHosts
+	auditEntry.Subcommands = evalResult.Subcommands
+	if len(evalResult.Subcommands) > 0 {
+		s.logger.Printf("shell script for %s split into %d commands", req.Command, len(evalResult.Subcommands))
+	}
+	if evalResult.URLViolation != "" {
+		s.logger.Printf("SECURITY: %s: %s for %s", evalResult.URLViolation, evalResult.Action, req.Command)
+		if evalResult.Action == ActionDeny {
+			auditEntry.Error = evalResult.URLViolation
+		}
+	}
 
-	// Evaluate policy
-	evalResult := s.policy.Evaluate(req)
-	s.logger.Printf("policy decision: %s for %s (timeout: %v)", evalResult.Action, req.Command, evalResult.Timeout)
+	// Record the rest of the conversation if a transcript may be kept,
+	// unless the warden is short of memory
+	var transcript *transcriptRecorder
+	if evalResult.Transcript || policy.engine.TranscriptOnError() {
+		if s.resources.UnderPressure() {
+			s.resources.Shed()
+		} else if transcript = s.startTranscript(rawRequest); transcript != nil {
+			conn = transcript.wrap(conn)
+		}
+	}
+
+	// Older shims read only one byte of an exit code
+	conn = forShimVersion(conn, req.Version)
+
+	// Without Docker, containerized requests cannot be contained
+	if evalResult.Action != ActionDeny && s.refuseUncontained(conn, req, &auditEntry, transcript, evalResult.Transcript) {
+		return
+	}
+	if evalResult.Action != ActionDeny && s.refuseHostFallback(conn, req, evalResult.Strategy, &auditEntry, transcript, evalResult.Transcript) {
+		return
+	}
+	if evalResult.Action != ActionDeny && s.refuseUnderPressure(conn, req, evalResult.Strategy, evalResult.Sandbox != nil, &auditEntry, transcript, evalResult.Transcript) {
+		return
+	}
+
+	// total_timeout covers everything from here on, counted from receipt
+	reqCtx := connCtx
+	if evalResult.TotalTimeout > 0 {
+		var reqCancel context.CancelFunc
+		reqCtx, reqCancel = context.WithDeadline(connCtx, startTime.Add(evalResult.TotalTimeout))
+		defer reqCancel()
+	}
 
 	switch evalResult.Action {
 	case ActionDeny:
-		auditEntry.Decision = "deny"
-		s.audit.Log(auditEntry)
-		protocol.WriteAck(conn, protocol.AckDenied)
+		auditEntry.Decision = protocol.DecisionDeny
+		s.saveTranscript(transcript, &auditEntry, evalResult.Transcript)
+		s.deny(conn, &auditEntry, "")
+		if evalResult.RuleMatched {
+			s.openIncident(s.incidents.ObserveDenial(policy.engine.Incidents(), req))
+		} else if s.suggestions != nil {
+			s.suggestions.Observe(req)
+		}
 		return
 
 	case ActionAsk:
+		// Nobody should be asked to review while the warden goes away
+		if s.refuseForMaintenance(conn, &auditEntry, transcript, evalResult.Transcript) {
+			return
+		}
 		protocol.WriteAck(conn, protocol.AckPendingHITL)
+		faultinject.Check(faultinject.PointPendingAck, conn)
 
 		// Enqueue for human approval
-		decision := s.hitl.Enqueue(connCtx, req)
-		if decision == DecisionDeny {
-			auditEntry.Decision = "deny (after HITL)"
-			s.audit.Log(auditEntry)
-			protocol.WriteAck(conn, protocol.AckDenied)
+		hitlCtx := reqCtx
+		if evalResult.HITLTimeout > 0 {
+			var hitlCancel context.CancelFunc
+			hitlCtx, hitlCancel = context.WithTimeout(reqCtx, evalResult.HITLTimeout)
+			defer hitlCancel()
+		}
+		auditEntry.Risk = evalResult.Risk
+		review := &ReviewInfo{
+			Env:              &envReport,
+			Subcommands:      evalResult.Subcommands,
+			Risk:             evalResult.Risk,
+			AutoApproveAfter: evalResult.AutoApproveAfter,
+			Annotations:      s.annotate(policy.engine, req, evalResult.Subcommands),
+			Approvers:        policy.engine.approvers(evalResult.Risk),
+			Channels:         policy.engine.channels(evalResult.Risk),
+			RenotifyAfter:    policy.engine.RenotifyAfter(),
+		}
+		if req.Version >= protocol.PendingMetaVersion {
+			review.OnQueued = func(id string, position int) {
+				protocol.WriteMetadata(conn, s.pendingMetadata(id, position, evalResult.HITLTimeout))
+			}
+		}
+		outcome := s.hitl.EnqueueOutcome(hitlCtx, req, review)
+		auditEntry.RequestID = outcome.ID
+		auditEntry.WaitMs = outcome.Waited.Milliseconds()
+		auditEntry.ClockSkew = outcome.ClockSkew
+		if outcome.FirstViewed != nil {
+			viewed := outcome.FirstViewed.Milliseconds()
+			auditEntry.FirstViewedMs = &viewed
+		}
+		switch {
+		case outcome.Expired:
+			auditEntry.Resolution = ResolutionExpired
+		case outcome.Automatic:
+			auditEntry.Resolution = ResolutionAutomatic
+			s.logger.Printf("%s risk ask for %s approved automatically after %v without objection", evalResult.Risk, req.Command, evalResult.AutoApproveAfter)
+		default:
+			auditEntry.Resolution = ResolutionHuman
+			auditEntry.Reviewer = outcome.Reviewer
+			auditEntry.ReviewerMessage = outcome.Message
+			auditEntry.Approvals = outcome.Approvals
+		}
+		if outcome.Expired {
+			auditEntry.Decision, auditEntry.Outcome = protocol.DecisionDeny, protocol.OutcomeHITLExpired
+			if auditEntry.TimeoutLimit = firedLimit(reqCtx, hitlCtx, TimeoutLimitHITL); auditEntry.TimeoutLimit != "" {
+				s.logger.Printf("TIMEOUT: review of %s exceeded its %s limit", req.Command, auditEntry.TimeoutLimit)
+			}
+			s.saveTranscript(transcript, &auditEntry, evalResult.Transcript)
+			s.deny(conn, &auditEntry, "")
+			return
+		}
+		if outcome.Decision == DecisionDeny {
+			auditEntry.Decision, auditEntry.Outcome = protocol.DecisionDeny, protocol.OutcomeAfterHITL
+			s.saveTranscript(transcript, &auditEntry, evalResult.Transcript)
+			s.denyReviewed(conn, req, &auditEntry)
+			return
+		}
+		// Docker may have gone away while the reviewer decided
+		if s.refuseUncontained(conn, req, &auditEntry, transcript, evalResult.Transcript) {
+			return
+		}
+		if outcome.Overrides != nil {
+			auditEntry.Overrides = outcome.Overrides
+			if err := s.applyOverrides(req, &evalResult, *outcome.Overrides); err != nil {
+				s.logger.Printf("refusing %s: %v", req.Command, err)
+				auditEntry.Decision, auditEntry.Outcome = protocol.DecisionDeny, protocol.OutcomeOverrideUnavailable
+				auditEntry.Error = err.Error()
+				s.saveTranscript(transcript, &auditEntry, evalResult.Transcript)
+				s.deny(conn, &auditEntry, err.Error())
+				return
+			}
+			// A pinned strategy must not bypass the host fallback guard
+			if s.refuseHostFallback(conn, req, evalResult.Strategy, &auditEntry, transcript, evalResult.Transcript) {
+				return
+			}
+		}
+		// Memory may have run short while the reviewer decided
+		if s.refuseUnderPressure(conn, req, evalResult.Strategy, evalResult.Sandbox != nil, &auditEntry, transcript, evalResult.Transcript) {
 			return
 		}
 		// Approved — send allowed ack and proceed
-		auditEntry.Decision = "allow (after HITL)"
+		auditEntry.Decision, auditEntry.Outcome = protocol.DecisionAllow, protocol.OutcomeAfterHITL
+		if outcome.Automatic {
+			auditEntry.Decision, auditEntry.Outcome = protocol.DecisionAllow, protocol.OutcomeAutoApproved
+		}
+		if s.refuseUnaudited(conn, req, &auditEntry, transcript, evalResult.Transcript) {
+			return
+		}
 		protocol.WriteAck(conn, protocol.AckAllowed)
 
 	case ActionAllow:
-		auditEntry.Decision = "allow"
+		auditEntry.Decision = protocol.DecisionAllow
+		if s.refuseUnaudited(conn, req, &auditEntry, transcript, evalResult.Transcript) {
+			return
+		}
 		protocol.WriteAck(conn, protocol.AckAllowed)
 	}
 
 	// Execute the command with timeout
-	execCtx := connCtx
-	var execCancel context.CancelFunc
-	if evalResult.Timeout > 0 {
-		execCtx, execCancel = context.WithTimeout(connCtx, evalResult.Timeout)
+	execCtx := reqCtx
+	if evalResult.ExecTimeout > 0 {
+		var execCancel context.CancelFunc
+		execCtx, execCancel = context.WithTimeout(reqCtx, evalResult.ExecTimeout)
 		defer execCancel()
 	}
-
-	// Select executor: Docker mirror for containerized requests, local for host/dev
-	var exec executor.Executor
-	if req.ContainerID != "" && s.dockerExec != nil {
-		exec = s.dockerExec
-	} else {
-		exec = s.localExec
+	limit := execLimit(evalResult, startTime)
+
+	req.RequestID = auditEntry.RequestID
+	exec, strategy := s.executorFor(req, evalResult.Strategy, evalResult.Sandbox != nil)
+	auditEntry.Strategy = string(strategy)
+
+	// Kill the command, or spool its output, if the shim stops reading
+	runCtx, stallCancel := context.WithCancelCause(execCtx)
+	defer stallCancel(nil)
+	shimConn, stall, spool := s.guardStall(conn, &auditEntry, policy.engine.OnShimStall(), stallCancel)
+
+	// Keep the output viewable over the API while the command runs, unless
+	// the warden is short of memory
+	execConn := shimConn
+	if s.outputs != nil && s.resources.UnderPressure() {
+		s.resources.Shed()
+	} else if s.outputs != nil {
+		var done func()
+		execConn, done = s.outputs.start(auditEntry.RequestID, req, shimConn)
+		defer done()
 	}
 
-	execErr := exec.Execute(execCtx, req, conn)
+	// Count output frames so the audit records whether the shim received them
+	out := executor.NewDeliveryConn(execConn)
+	out.CountInto(s.throughput.Counter(req.Command, req.ContainerID))
+
+	// Tell the shim how the request was handled, and the shim and the
+	// command about the time limit, as the policy asks
+	meta := s.metadata(&auditEntry)
+	notices := policy.engine.TimeoutNotices()
+	if limit > 0 && notices.Announce {
+		meta.TimeoutSeconds = limit.Seconds()
+	}
+	meta.MaxStdoutBytes, meta.TailOnTruncate = evalResult.MaxStdoutBytes, evalResult.TailOnTruncate
+	protocol.WriteMetadata(out, meta)
+	if auditEntry.Overrides != nil {
+		protocol.WriteFrame(out, protocol.Frame{
+			Type:    protocol.StreamStderr,
+			Payload: []byte(fmt.Sprintf("clawrden: approved with reviewer overrides: %s\n", auditEntry.Overrides)),
+		})
+	}
+	if auditEntry.ReviewerMessage != "" {
+		protocol.WriteFrame(out, protocol.Frame{Type: protocol.StreamStderr, Payload: []byte(reviewerNote(auditEntry.ReviewerMessage))})
+	}
+	stopWarning := func() {}
+	if limit > 0 {
+		if notices.Env {
+			req.Env = withTimeoutEnv(req.Env, limit)
+		}
+		if notices.Warn {
+			stopWarning = startTimeoutWarning(out, limit)
+		}
+	}
+	req.UnmarkedEnv = evalResult.UnmarkedEnv
+	req.Priority = evalResult.Priority
+	auditEntry.Priority = executor.PriorityFor(req.Priority, strategy)
+
+	recordChanges := s.trackChanges(policy.engine, req, strategy, evalResult.Sandbox != nil)
+	s.events.Publish(events.ExecutionStarted{ID: auditEntry.RequestID, Request: req})
+	execStart := time.Now()
+
+	execErr := faultinject.Check(faultinject.PointExecute, out)
+	switch {
+	case execErr != nil:
+		// An injected fault fails the command before it starts
+	default:
+		execErr = s.executeWithHooks(runCtx, reqCtx, exec, req, evalResult, &auditEntry, out, func(conn net.Conn) error {
+			return s.withOwnershipFix(policy.engine, req, strategy, evalResult.Sandbox != nil, &auditEntry, conn, func(conn net.Conn) error {
+				return s.executeWithRetry(runCtx, evalResult.Retry, req, &auditEntry, conn, func(conn net.Conn) error {
+					if evalResult.Sandbox != nil {
+						return s.executeSandboxed(runCtx, exec, req, conn, evalResult.Sandbox, &auditEntry)
+					}
+					return exec.Execute(runCtx, req, conn)
+				})
+			})
+		})
+	}
+	stopWarning()
+	if spool != nil && errors.Is(execErr, executor.ErrShimStalled) {
+		execErr = nil // The command ran on; what the shim missed is spooled
+	}
 
 	// Calculate duration and update audit entry
 	auditEntry.Duration = float64(time.Since(startTime).Milliseconds())
+	finished := events.ExecutionFinished{
+		Request:  req,
+		Duration: time.Since(execStart),
+		TimedOut: execErr != nil && execCtx.Err() == context.DeadlineExceeded,
+		Err:      execErr,
+	}
 
 	if execErr != nil {
-		s.logger.Printf("execution error: %v", execErr)
-		auditEntry.ExitCode = 1
+		code, message := 1, fmt.Sprintf("clawrden: execution error: %v\n", execErr)
 		auditEntry.Error = execErr.Error()
+		var transient *executor.TransientError
+		if errors.As(execErr, &transient) && transient.ExitCode != 0 {
+			code = transient.ExitCode // E.g. 137 for an OOM-killed ghost
+		}
 
-		// Check if this was a timeout violation
-		if execCtx.Err() == context.DeadlineExceeded {
+		// A command killed for its time limit did not fail on its own; tell
+		// the agent which limit stopped it, with timeout(1)'s exit code
+		if auditEntry.TimeoutLimit = firedLimit(reqCtx, execCtx, TimeoutLimitExec); auditEntry.TimeoutLimit != "" {
+			configured := evalResult.ExecTimeout
+			if auditEntry.TimeoutLimit == TimeoutLimitTotal {
+				configured = evalResult.TotalTimeout
+			}
+			code, message = TimeoutExitCode, timeoutMessage(auditEntry.TimeoutLimit, configured, evalResult.MatchedRule)
+			auditEntry.Outcome = protocol.OutcomeTimeout
 			auditEntry.TimeoutViolation = true
-			auditEntry.Error = fmt.Sprintf("timeout exceeded (%v): %v", evalResult.Timeout, execErr)
-			s.logger.Printf("TIMEOUT: command %s exceeded %v", req.Command, evalResult.Timeout)
+			auditEntry.Error = fmt.Sprintf("%s timeout exceeded (%v)", auditEntry.TimeoutLimit, configured)
+			s.logger.Printf("TIMEOUT: command %s exceeded its %s limit of %v", req.Command, auditEntry.TimeoutLimit, configured)
+		} else {
+			s.logger.Printf("execution error: %v", execErr)
 		}
+		auditEntry.ExitCode = code
+
+		// Any output the command produced has been delivered; the error follows it
+		protocol.WriteFrame(out, protocol.Frame{Type: protocol.StreamStderr, Payload: []byte(message)})
+		protocol.WriteExitCode(out, code)
+
+		s.recordStall(runCtx, &auditEntry, stall, spool)
+		finished.ExitCode = auditEntry.ExitCode
+		s.events.Publish(finished)
+		s.recordDelivery(&auditEntry, out.Stats())
+		recordChanges(&auditEntry)
+		s.saveTranscript(transcript, &auditEntry, evalResult.Transcript || policy.engine.TranscriptOnError())
+		s.record(auditEntry)
+		return
+	}
 
-		s.audit.Log(auditEntry)
+	// The command ran; record the exit code the executor delivered
+	stats := out.Stats()
+	auditEntry.ExitCode = stats.ExitCode
+	s.recordStall(runCtx, &auditEntry, stall, spool)
+	finished.ExitCode = auditEntry.ExitCode
+	if auditEntry.TimeoutLimit = firedLimit(reqCtx, execCtx, TimeoutLimitExec); auditEntry.TimeoutLimit != "" {
+		// The executor killed the command and reported how it ended
+		auditEntry.Outcome = protocol.OutcomeTimeout
+		auditEntry.TimeoutViolation = true
+		finished.TimedOut = true
+		s.logger.Printf("TIMEOUT: command %s exceeded its %s limit of %v", req.Command, auditEntry.TimeoutLimit, limit)
+	}
+	if stats.ExitCode != 0 && strategy == executor.StrategyGhost && auditEntry.Error == "" {
+		// Hardening is a likely culprit when a ghost command fails
+		auditEntry.Error = s.dockerExec.GhostHardening(req.Command).Hint(req.Command, stats.StderrTail)
+	}
+	s.events.Publish(finished)
+	s.recordDelivery(&auditEntry, stats)
+	recordChanges(&auditEntry)
+	s.saveTranscript(transcript, &auditEntry, evalResult.Transcript)
+	s.record(auditEntry)
+}
 
-		// Send error via stderr frame
-		protocol.WriteFrame(conn, protocol.Frame{
-			Type:    protocol.StreamStderr,
-			Payload: []byte(fmt.Sprintf("clawrden: execution error: %v\n", execErr)),
+// execLimit returns how long a command may run: the rule's exec_timeout,
+// or what is left of its total_timeout if that ends first. 0 means no limit.
+func execLimit(result EvaluationResult, startTime time.Time) time.Duration {
+	limit := result.ExecTimeout
+	if result.TotalTimeout > 0 {
+		if left := time.Until(startTime.Add(result.TotalTimeout)); limit == 0 || left < limit {
+			limit = max(left, time.Millisecond)
+		}
+	}
+	return limit
+}
+
+// firedLimit names the time limit that ended ctx, a context derived from
+// reqCtx with its own limit: TimeoutLimitTotal if the request's overall
+// deadline passed, own if ctx's did, or "" if neither did.
+func firedLimit(reqCtx, ctx context.Context, own string) string {
+	switch {
+	case reqCtx.Err() == context.DeadlineExceeded:
+		return TimeoutLimitTotal
+	case ctx.Err() == context.DeadlineExceeded:
+		return own
+	}
+	return ""
+}
+
+// refuseUncontained denies a containerized request while the Docker daemon
+// is unreachable, reporting whether it did. The shim sees a plain denial.
+func (s *Server) refuseUncontained(conn net.Conn, req *protocol.Request, entry *AuditEntry, transcript *transcriptRecorder, keepTranscript bool) bool {
+	err := s.containment(req)
+	if err == nil {
+		return false
+	}
+	s.logger.Printf("refusing %s from %s: %v", req.Command, truncateID(req.ContainerID), err)
+	entry.Decision, entry.Outcome = protocol.DecisionDeny, protocol.OutcomeNoContainment
+	entry.Error = err.Error()
+	s.saveTranscript(transcript, entry, keepTranscript)
+	s.deny(conn, entry, "")
+	return true
+}
+
+// refuseHostFallback denies a containerized request whose strategy would run
+// it on the warden host unless Config.AllowHostFallback permits that,
+// reporting whether it did.
+func (s *Server) refuseHostFallback(conn net.Conn, req *protocol.Request, strategy executor.Strategy, entry *AuditEntry, transcript *transcriptRecorder, keepTranscript bool) bool {
+	if strategy != executor.StrategyLocal || req.ContainerID == "" || s.config.AllowHostFallback {
+		return false
+	}
+	s.logger.Printf("SECURITY: refusing %s from %s: strategy local would run it on the warden host", req.Command, truncateID(req.ContainerID))
+	entry.Decision, entry.Outcome = protocol.DecisionDeny, protocol.OutcomeHostFallbackDisabled
+	entry.Error = "strategy local runs containerized requests on the warden host; start the warden with -allow-host-fallback to permit it"
+	s.saveTranscript(transcript, entry, keepTranscript)
+	s.deny(conn, entry, "")
+	return true
+}
+
+// executorFor picks where req runs. Requests from the host, and all requests
+// without Docker, run locally; containerized ones follow strategy, with auto
+// leaving the choice to the Docker executor. Sandboxes need a ghost.
+func (s *Server) executorFor(req *protocol.Request, strategy executor.Strategy, sandboxed bool) (executor.Executor, executor.Strategy) {
+	if req.ContainerID == "" || s.dockerExec == nil || strategy == executor.StrategyLocal {
+		return s.localExec, executor.StrategyLocal
+	}
+	if strategy == "" || strategy == executor.StrategyAuto {
+		strategy = executor.StrategyMirror
+		if s.dockerExec.UsesGhost(req) {
+			strategy = executor.StrategyGhost
+		}
+	}
+	if strategy == executor.StrategyGhost || sandboxed {
+		return executor.Func(s.dockerExec.ExecuteGhost), executor.StrategyGhost
+	}
+	return executor.Func(s.dockerExec.ExecuteMirror), executor.StrategyMirror
+}
+
+// refuseForMaintenance denies a request that would wait for review during a
+// maintenance window, reporting whether it did. The shim is told why.
+func (s *Server) refuseForMaintenance(conn net.Conn, entry *AuditEntry, transcript *transcriptRecorder, keepTranscript bool) bool {
+	m := s.maintenance.Active()
+	if m == nil || m.QueueAsk {
+		return false
+	}
+	entry.Decision, entry.Outcome = protocol.DecisionDeny, protocol.OutcomeMaintenance
+	entry.Error = m.Reason()
+	s.saveTranscript(transcript, entry, keepTranscript)
+	s.deny(conn, entry, m.Reason())
+	return true
+}
+
+// denyWriteTimeout bounds writing a denial, so a client that never reads
+// the frames after the ack cannot hold the connection open.
+const denyWriteTimeout = 5 * time.Second
+
+// rejectMalformed refuses a request that failed Request.Validate. Its
+// arguments and environment are left out of the audit entry, since they may
+// be what was malformed; the error names the offending field.
+func (s *Server) rejectMalformed(conn net.Conn, req *protocol.Request, err error) {
+	command := req.Command
+	if len(command) > protocol.MaxCommandLen {
+		command = command[:protocol.MaxCommandLen]
+	}
+	s.logger.Printf("SECURITY: rejecting malformed request from uid %d: %v", req.Identity.UID, err)
+	entry := AuditEntry{
+		RequestID:   newID("req", time.Now()),
+		Command:     command,
+		Identity:    req.Identity,
+		ContainerID: req.ContainerID,
+		Decision:    protocol.DecisionRejected,
+		Outcome:     protocol.OutcomeMalformed,
+		Error:       err.Error(),
+	}
+	s.deny(conn, &entry, err.Error())
+}
+
+// deny records a denied request and tells the shim: the deny ack, the
+// reason if there is one, and the request's metadata.
+func (s *Server) deny(conn net.Conn, entry *AuditEntry, reason string) {
+	s.denyWithNote(conn, entry, "", reason)
+}
+
+// denyReviewed is deny for a request a reviewer denied, passing on their
+// message to the agent: as a stderr line before the reason, or as the
+// reason itself for shims that read nothing else after a denial.
+func (s *Server) denyReviewed(conn net.Conn, req *protocol.Request, entry *AuditEntry) {
+	switch {
+	case entry.ReviewerMessage == "":
+		s.deny(conn, entry, "")
+	case req.Version < protocol.ReviewerMessageVersion:
+		s.deny(conn, entry, entry.ReviewerMessage)
+	default:
+		s.denyWithNote(conn, entry, reviewerNote(entry.ReviewerMessage), "")
+	}
+}
+
+// denyWithNote is deny, also writing note to the shim's stderr before the
+// reason.
+func (s *Server) denyWithNote(conn net.Conn, entry *AuditEntry, note, reason string) {
+	s.record(*entry)
+	conn.SetWriteDeadline(time.Now().Add(denyWriteTimeout))
+	defer conn.SetWriteDeadline(time.Time{})
+	protocol.WriteAck(conn, protocol.AckDenied)
+	if note != "" {
+		protocol.WriteFrame(conn, protocol.Frame{Type: protocol.StreamStderr, Payload: []byte(note)})
+	}
+	if reason != "" {
+		protocol.WriteDenialReason(conn, reason)
+	}
+	protocol.WriteMetadata(conn, s.metadata(entry))
+}
+
+// metadata describes how a request was handled, for the shim.
+func (s *Server) metadata(entry *AuditEntry) *protocol.ExecMetadata {
+	return &protocol.ExecMetadata{
+		RequestID:     entry.RequestID,
+		Decision:      entry.Decision,
+		Outcome:       entry.Outcome,
+		WardenVersion: protocol.ProtocolVersion,
+		Strategy:      entry.Strategy,
+		Trailer:       entry.trailer,
+		SessionOpen:   entry.session,
+	}
+}
+
+// pendingMetadata tells the shim where its request stands once it is
+// queued for review. The link to the dashboard needs Config.PublicURL.
+func (s *Server) pendingMetadata(id string, position int, hitlTimeout time.Duration) *protocol.ExecMetadata {
+	meta := &protocol.ExecMetadata{
+		RequestID:          id,
+		WardenVersion:      protocol.ProtocolVersion,
+		QueuePosition:      position,
+		HITLTimeoutSeconds: hitlTimeout.Seconds(),
+	}
+	if base := strings.TrimSuffix(s.config.PublicURL, "/"); base != "" {
+		meta.ReviewURL = base + "/#" + url.PathEscape(id)
+	}
+	return meta
+}
+
+// record publishes a finished request's audit entry.
+func (s *Server) record(entry AuditEntry) {
+	s.events.Publish(Audited{Entry: entry})
+}
+
+// recordStarted writes the started entry of an allowed command before the
+// shim hears it may run, so that a command the warden crashes during is
+// still audited. entry goes on to become the finished entry. Only the audit
+// log gets the started entry; subscribers to Audited see the finished one.
+// entry is marked finished even if the write fails, so that a started entry
+// held for later is still paired with how the request ended.
+func (s *Server) recordStarted(entry *AuditEntry) error {
+	var err error
+	if s.audit != nil {
+		started := *entry
+		started.Phase = PhaseStarted
+		err = s.audit.Log(started)
+	}
+	entry.Phase = PhaseFinished
+	return err
+}
+
+// refuseUnaudited writes the started entry of an allowed command and, if
+// it cannot be written, denies the command instead of running it without
+// a record, whatever the audit failure mode. It reports whether it denied.
+func (s *Server) refuseUnaudited(conn net.Conn, req *protocol.Request, entry *AuditEntry, transcript *transcriptRecorder, keepTranscript bool) bool {
+	err := s.recordStarted(entry)
+	if err == nil {
+		return false
+	}
+	s.logger.Printf("SECURITY: refusing %s: %v", req.Command, err)
+	entry.Decision, entry.Outcome = protocol.DecisionDeny, protocol.OutcomeAuditUnavailable
+	entry.Error = err.Error()
+	s.saveTranscript(transcript, entry, keepTranscript)
+	s.deny(conn, entry, "the warden cannot write its audit log, so the command was not run; ask an operator to check the audit log's disk")
+	return true
+}
+
+// ScanAudit calls fn with each entry of the audit log in turn, as the
+// history API lists them: an entry of a command that is still running says
+// so (see CompletionRunning).
+func (s *Server) ScanAudit(fn func(AuditEntry) error) error {
+	return ScanAuditLog(s.config.AuditPath, func(entry AuditEntry) error {
+		s.markRunning(&entry)
+		return fn(entry)
+	})
+}
+
+// markRunning tells a started entry whose command is still running from
+// one whose command the warden lost track of.
+func (s *Server) markRunning(entry *AuditEntry) {
+	if entry.Completed == CompletionUnknown && s.audit != nil && s.audit.Running(entry.RequestID) {
+		entry.Completed = CompletionRunning
+	}
+}
+
+// recordDelivery copies output delivery counters into the audit entry and
+// warns when the shim did not receive all of the command's output.
+func (s *Server) recordDelivery(entry *AuditEntry, stats executor.DeliveryStats) {
+	entry.Delivery = stats.Outcome()
+	entry.BytesStdout = stats.StdoutBytes
+	entry.BytesStderr = stats.StderrBytes
+
+	if stats.Err != nil {
+		s.logger.Printf("warning: %s output delivery for %s: %d/%d bytes delivered: %v",
+			entry.Delivery, entry.Command, stats.DeliveredBytes, stats.AttemptedBytes, stats.Err)
+	}
+}
+
+// handleStatusRequest answers a shim's --clawrden-debug query with a status
+// summary. Nothing is executed; the query is audited as a debug entry.
+func (s *Server) handleStatusRequest(conn net.Conn, req *protocol.Request) {
+	s.logger.Printf("debug: status request from %s shim (protocol v%d, uid=%d, container=%s)",
+		req.Command, req.Version, req.Identity.UID, truncateID(req.ContainerID))
+
+	// Hardened jails get no debug status, whatever client asks; the shim
+	// refuses before asking, so the connection closes without a reply
+	if jailID, ok := s.hardenedJail(s.currentPolicy(), req); ok {
+		s.logger.Printf("SECURITY: refusing status request from %s shim in hardened jail %s (container=%s)",
+			req.Command, jailID, truncateID(req.ContainerID))
+		s.record(AuditEntry{
+			Command:     req.Command,
+			Args:        req.Args,
+			Cwd:         req.Cwd,
+			Identity:    req.Identity,
+			ContainerID: req.ContainerID,
+			JailID:      jailID,
+			Decision:    protocol.DecisionDeny,
+			Detail:      "debug (status)",
+			Error:       "debug status is disabled in hardened jails",
 		})
-		protocol.WriteExitCode(conn, 1)
 		return
 	}
 
-	// Success case
-	auditEntry.ExitCode = 0
-	s.audit.Log(auditEntry)
+	policy := s.currentPolicy().engine
+	status := &protocol.StatusResponse{
+		Version:       protocol.ProtocolVersion,
+		Pending:       len(s.hitl.List()),
+		UptimeSeconds: time.Since(s.startTime).Seconds(),
+		DefaultAction: string(policy.config.DefaultAction),
+		ToolHasRule:   policy.HasRule(req.Command),
+	}
+	if s.jailhouse != nil {
+		status.Jails = len(s.jailhouse.ListJails())
+	}
+
+	s.record(AuditEntry{
+		Command:     req.Command,
+		Args:        req.Args,
+		Cwd:         req.Cwd,
+		Identity:    req.Identity,
+		ContainerID: req.ContainerID,
+		Decision:    protocol.DecisionEvent,
+		Detail:      "debug (status)",
+	})
+
+	if err := protocol.WriteStatus(conn, status); err != nil {
+		s.logger.Printf("debug: failed to send status: %v", err)
+	}
 }
 
 // monitorCancel watches for cancel frames from the shim.
@@ -431,6 +1526,66 @@ func (s *Server) GetHITLQueue() *HITLQueue {
 	return s.hitl
 }
 
+// GetBridges returns the chat bridge heartbeat registry.
+func (s *Server) GetBridges() *BridgeRegistry {
+	return s.bridges
+}
+
+// GetIncidents returns the server's incident tracker.
+func (s *Server) GetIncidents() *IncidentTracker {
+	return s.incidents
+}
+
+// GetMaintenance returns the maintenance window tracker.
+func (s *Server) GetMaintenance() *MaintenanceWindow {
+	return s.maintenance
+}
+
+// GetResources returns the server's resource monitor.
+func (s *Server) GetResources() *ResourceMonitor {
+	return s.resources
+}
+
+// GetThroughput returns the server's output byte counters.
+func (s *Server) GetThroughput() *ThroughputStats {
+	return s.throughput
+}
+
+// GetRuleStats returns the server's per-rule decision counters.
+func (s *Server) GetRuleStats() *RuleStats {
+	return s.ruleStats
+}
+
+// GetOutputs returns the output registry of running executions.
+func (s *Server) GetOutputs() *OutputRegistry {
+	return s.outputs
+}
+
+// GetShadowPolicy returns the shadow policy, or nil if none is configured.
+func (s *Server) GetShadowPolicy() *ShadowPolicy {
+	return s.shadow
+}
+
+// GetSuggestions returns the commands denied by default.
+func (s *Server) GetSuggestions() *PolicySuggestions {
+	return s.suggestions
+}
+
+// GetAudit returns the audit logger, or nil before the server is set up.
+func (s *Server) GetAudit() *AuditLogger {
+	return s.audit
+}
+
+// GetDocker returns the Docker daemon supervisor, or nil when Docker is unavailable.
+func (s *Server) GetDocker() *DockerSupervisor {
+	return s.docker
+}
+
+// GetEvents returns the server's event bus.
+func (s *Server) GetEvents() *events.Bus {
+	return s.events
+}
+
 // GetJailhouse returns the jailhouse manager for external access (e.g., from the API).
 func (s *Server) GetJailhouse() *jailhouse.Manager {
 	return s.jailhouse
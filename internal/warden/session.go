@@ -0,0 +1,156 @@
+package warden
+
+import (
+	"bytes"
+	"clawrden/pkg/protocol"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// sessionIdleTimeout is how long a persistent session may wait for its
+// next request before the Warden hangs up.
+const sessionIdleTimeout = 5 * time.Minute
+
+// errSessionClosed ends a persistent session the shim closed between
+// requests, or the Warden closed to shut down. Neither is worth a log line.
+var errSessionClosed = errors.New("session closed")
+
+// shimSession is a shim connection and what the Warden resolved about the
+// process at its other end. A connection carries one request, or, once a
+// request opens a persistent session, one after another until the shim
+// hangs up.
+type shimSession struct {
+	conn       net.Conn
+	creds      *PeerCredentials
+	persistent bool
+	requests   int    // Requests handled so far
+	pending    []byte // Start of the next request, read while watching for a hang-up
+
+	// Groups and container resolved from creds, for the policy in force
+	// then; a reload resolves them again
+	resolvedFor *policyState
+	groups      []int
+	containerID string
+}
+
+// readSessionRequest reads the connection's next request. The first is
+// waited for as long as the shim takes; later ones in a persistent session
+// for sessionIdleTimeout, and not past the Warden's shutdown.
+func (s *Server) readSessionRequest(sess *shimSession, raw *bytes.Buffer) (*protocol.Request, error) {
+	if sess.requests == 0 {
+		return protocol.ReadRequest(io.TeeReader(sess.conn, raw))
+	}
+
+	sess.conn.SetReadDeadline(time.Now().Add(sessionIdleTimeout))
+	defer sess.conn.SetReadDeadline(time.Time{})
+	stop := context.AfterFunc(s.ctx, func() { sess.conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	r := io.MultiReader(bytes.NewReader(sess.pending), sess.conn)
+	sess.pending = nil
+	req, err := protocol.ReadRequest(io.TeeReader(r, raw))
+	switch {
+	case err == nil:
+		return req, nil
+	case raw.Len() == 0 && (errors.Is(err, io.EOF) || s.ctx.Err() != nil):
+		s.logger.Printf("session: closed after %d requests", sess.requests)
+		return nil, errSessionClosed
+	case raw.Len() == 0 && errors.Is(err, os.ErrDeadlineExceeded):
+		s.logger.Printf("session: no request for %v after %d requests, hanging up", sessionIdleTimeout, sess.requests)
+		return nil, errSessionClosed
+	}
+	return nil, err
+}
+
+// sessionEnded reports whether err ended a persistent session as expected.
+func sessionEnded(err error) bool {
+	return errors.Is(err, errSessionClosed)
+}
+
+// applyPeerCreds overrides the identity and container req reports with the
+// kernel's view of the shim process. A session resolves the process's
+// groups and container once, and again after a policy reload. Without peer
+// credentials the reported supplementary groups are dropped, since only
+// /proc can vouch for them.
+func (s *Server) applyPeerCreds(sess *shimSession, req *protocol.Request) {
+	if sess.creds == nil {
+		req.Identity.Groups = nil
+		return
+	}
+
+	// Override self-reported identity with kernel-enforced values
+	req.Identity.UID = int(sess.creds.UID)
+	req.Identity.GID = int(sess.creds.GID)
+
+	if policy := s.currentPolicy(); sess.resolvedFor != policy {
+		sess.resolvedFor = policy
+
+		// Replace self-reported supplementary groups with the kernel's view
+		groups, err := s.peers.Groups(sess.creds.PID)
+		if err != nil {
+			s.logger.Printf("warning: could not resolve groups for pid %d: %v", sess.creds.PID, err)
+		}
+		sess.groups = groups
+
+		// Resolve which container the peer process belongs to
+		containerID, err := s.peers.ContainerID(sess.creds.PID)
+		if err != nil {
+			s.logger.Printf("warning: could not resolve container ID for pid %d: %v", sess.creds.PID, err)
+		}
+		sess.containerID = containerID
+	}
+
+	req.Identity.Groups = slices.Clone(sess.groups)
+	if sess.containerID != "" {
+		req.ContainerID = sess.containerID
+	}
+}
+
+// watchSession cancels cancel if the shim hangs up while a request of a
+// persistent session is handled, as monitorCancel does for a single
+// request. It must not swallow the next request, so it stops at the first
+// byte the shim sends, which can only start that request. stop ends the
+// watch and returns what it read, or the error the connection ended with.
+func (s *Server) watchSession(conn net.Conn, cancel context.CancelFunc) (stop func() ([]byte, error)) {
+	var stopping atomic.Bool
+	var read []byte
+	var readErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 1)
+		for {
+			n, err := conn.Read(buf)
+			if n > 0 {
+				read = buf[:n]
+				return
+			}
+			if err == nil {
+				continue
+			}
+			if stopping.Load() && errors.Is(err, os.ErrDeadlineExceeded) {
+				return
+			}
+			if err != io.EOF {
+				s.logger.Printf("cancel monitor: connection error: %v", err)
+			}
+			readErr = err
+			cancel()
+			return
+		}
+	}()
+
+	return func() ([]byte, error) {
+		stopping.Store(true)
+		conn.SetReadDeadline(time.Now())
+		<-done
+		conn.SetReadDeadline(time.Time{})
+		return read, readErr
+	}
+}
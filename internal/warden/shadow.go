@@ -0,0 +1,181 @@
+package warden
+
+import (
+	"clawrden/pkg/protocol"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ShadowPolicy evaluates every request against a second, candidate policy
+// without enforcing it, and counts where its decisions differ from the
+// policy in force. It shows what a tighter policy would break before it is
+// rolled out.
+type ShadowPolicy struct {
+	path    string
+	logger  *log.Logger
+	watcher *PolicyWatcher // nil if hot-reload is unavailable
+
+	mu        sync.Mutex
+	policy    *PolicyEngine // nil until the file loads
+	since     time.Time     // When the current shadow policy was loaded
+	evaluated int64
+	commands  map[string]*shadowCommand
+}
+
+// shadowCommand counts one command's evaluations and divergences.
+type shadowCommand struct {
+	evaluated   int64
+	divergences map[shadowKey]*ShadowDivergence
+}
+
+type shadowKey struct {
+	primary, shadow Action
+}
+
+// ShadowDivergence counts requests where the primary policy decided one
+// way and the shadow policy another.
+type ShadowDivergence struct {
+	Primary Action   `json:"primary"`
+	Shadow  Action   `json:"shadow"`
+	Count   int64    `json:"count"`
+	Example []string `json:"example"` // argv of the first such request
+}
+
+// ShadowCommandReport is the divergences of one command.
+type ShadowCommandReport struct {
+	Command     string             `json:"command"`
+	Evaluated   int64              `json:"evaluated"`
+	Divergences []ShadowDivergence `json:"divergences"`
+}
+
+// ShadowReport summarizes the shadow policy's divergences since it was
+// loaded. Commands lists only commands with divergences, most first.
+type ShadowReport struct {
+	Path      string                `json:"path"`
+	Loaded    bool                  `json:"loaded"` // False while the shadow policy file fails to load
+	Since     time.Time             `json:"since"`
+	Evaluated int64                 `json:"evaluated"`
+	Diverged  int64                 `json:"diverged"`
+	Commands  []ShadowCommandReport `json:"commands"`
+}
+
+// NewShadowPolicy loads the shadow policy at path. A file that fails to
+// load leaves the shadow policy idle until it is fixed.
+func NewShadowPolicy(path string, logger *log.Logger) *ShadowPolicy {
+	sp := &ShadowPolicy{path: path, logger: logger}
+	policy, err := LoadPolicy(path)
+	if err != nil {
+		logger.Printf("warning: could not load shadow policy from %s: %v (shadow evaluation idle until it loads)", path, err)
+	}
+	sp.reset(policy)
+
+	watcher, err := NewPolicyWatcher(path, policy, logger)
+	if err != nil {
+		logger.Printf("warning: failed to create shadow policy watcher: %v (hot-reload disabled)", err)
+		return sp
+	}
+	watcher.OnReload(func(newPolicy *PolicyEngine) {
+		sp.reset(newPolicy)
+		logger.Printf("shadow policy reloaded; divergence counts reset")
+	})
+	sp.watcher = watcher
+	return sp
+}
+
+// reset installs policy and clears the counts, which describe a single
+// shadow policy.
+func (sp *ShadowPolicy) reset(policy *PolicyEngine) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	sp.policy = policy
+	sp.since = time.Now()
+	sp.evaluated = 0
+	sp.commands = make(map[string]*shadowCommand)
+}
+
+// Observe evaluates req against the shadow policy and counts a divergence
+// from primary, the decision being enforced. jailRules are the rules of a
+// jail the shadow policy does not define itself, such as one created over
+// the API.
+func (sp *ShadowPolicy) Observe(req *protocol.Request, jailRules []Rule, primary EvaluationResult) {
+	sp.mu.Lock()
+	policy := sp.policy
+	sp.mu.Unlock()
+	if policy == nil {
+		return
+	}
+
+	if jail, ok := policy.GetJails()[req.JailID]; ok {
+		jailRules = jail.Rules
+	}
+	shadow := policy.EvaluateInJail(req, jailRules)
+
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if sp.policy != policy {
+		return // Reloaded meanwhile; the counts belong to the new policy
+	}
+	sp.evaluated++
+	cmd := sp.commands[req.Command]
+	if cmd == nil {
+		cmd = &shadowCommand{divergences: make(map[shadowKey]*ShadowDivergence)}
+		sp.commands[req.Command] = cmd
+	}
+	cmd.evaluated++
+	if shadow.Action == primary.Action {
+		return
+	}
+
+	key := shadowKey{primary: primary.Action, shadow: shadow.Action}
+	d := cmd.divergences[key]
+	if d == nil {
+		d = &ShadowDivergence{Primary: primary.Action, Shadow: shadow.Action, Example: append([]string{req.Command}, req.Args...)}
+		cmd.divergences[key] = d
+	}
+	d.Count++
+	sp.logger.Printf("shadow policy: %s for %s, enforced %s", shadow.Action, req.Command, primary.Action)
+}
+
+// Report returns the divergences counted since the shadow policy loaded.
+func (sp *ShadowPolicy) Report() ShadowReport {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	report := ShadowReport{
+		Path:      sp.path,
+		Loaded:    sp.policy != nil,
+		Since:     sp.since,
+		Evaluated: sp.evaluated,
+		Commands:  []ShadowCommandReport{},
+	}
+	diverged := make(map[string]int64)
+	for command, cmd := range sp.commands {
+		if len(cmd.divergences) == 0 {
+			continue
+		}
+		c := ShadowCommandReport{Command: command, Evaluated: cmd.evaluated}
+		for _, d := range cmd.divergences {
+			c.Divergences = append(c.Divergences, *d)
+			diverged[command] += d.Count
+		}
+		sort.Slice(c.Divergences, func(i, j int) bool {
+			a, b := c.Divergences[i], c.Divergences[j]
+			if a.Count != b.Count {
+				return a.Count > b.Count
+			}
+			return a.Primary+a.Shadow < b.Primary+b.Shadow
+		})
+		report.Diverged += diverged[command]
+		report.Commands = append(report.Commands, c)
+	}
+	sort.Slice(report.Commands, func(i, j int) bool {
+		a, b := report.Commands[i], report.Commands[j]
+		if diverged[a.Command] != diverged[b.Command] {
+			return diverged[a.Command] > diverged[b.Command]
+		}
+		return a.Command < b.Command
+	})
+	return report
+}
@@ -0,0 +1,145 @@
+package warden
+
+import (
+	"clawrden/pkg/protocol"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestShadowPolicyReport(t *testing.T) {
+	dir := t.TempDir()
+	const primaryYAML = `default_action: deny
+rules:
+  - command: npm
+    action: allow
+  - command: git
+    action: allow
+  - command: curl
+    action: ask
+`
+	primaryPath := filepath.Join(dir, "policy.yaml")
+	writeTestFile(t, primaryPath, primaryYAML)
+	shadowPath := filepath.Join(dir, "shadow.yaml")
+	writeTestFile(t, shadowPath, `default_action: deny
+rules:
+  - command: npm
+    action: ask
+    args: ["install"]
+  - command: npm
+    action: allow
+  - command: git
+    action: allow
+  - command: ls
+    action: allow
+jails:
+  ci:
+    rules:
+      - command: curl
+        action: allow
+`)
+	primary, err := LoadPolicy(primaryPath)
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+	shadow := NewShadowPolicy(shadowPath, log.New(io.Discard, "", 0))
+
+	requests := []*protocol.Request{
+		{Command: "npm", Args: []string{"install", "left-pad"}},
+		{Command: "npm", Args: []string{"install"}},
+		{Command: "npm", Args: []string{"test"}},
+		{Command: "git", Args: []string{"status"}},
+		{Command: "curl", Args: []string{"https://example.com"}},
+		{Command: "curl", Args: []string{"https://example.org"}, JailID: "ci"},
+		{Command: "ls"},
+	}
+	for _, req := range requests {
+		shadow.Observe(req, nil, primary.Evaluate(req))
+	}
+
+	report := shadow.Report()
+	if !report.Loaded || report.Evaluated != 7 || report.Diverged != 5 {
+		t.Fatalf("report = %+v, want 5 of 7 requests diverging", report)
+	}
+	want := []ShadowCommandReport{
+		{Command: "curl", Evaluated: 2, Divergences: []ShadowDivergence{
+			{Primary: ActionAsk, Shadow: ActionAllow, Count: 1, Example: []string{"curl", "https://example.org"}},
+			{Primary: ActionAsk, Shadow: ActionDeny, Count: 1, Example: []string{"curl", "https://example.com"}},
+		}},
+		{Command: "npm", Evaluated: 3, Divergences: []ShadowDivergence{
+			{Primary: ActionAllow, Shadow: ActionAsk, Count: 2, Example: []string{"npm", "install", "left-pad"}},
+		}},
+		{Command: "ls", Evaluated: 1, Divergences: []ShadowDivergence{
+			{Primary: ActionDeny, Shadow: ActionAllow, Count: 1, Example: []string{"ls"}},
+		}},
+	}
+	if !reflect.DeepEqual(report.Commands, want) {
+		t.Errorf("commands = %+v\nwant %+v", report.Commands, want)
+	}
+
+	// A reload starts counting afresh for the new shadow policy
+	writeTestFile(t, shadowPath, primaryYAML)
+	if err := shadow.watcher.handlePolicyChange(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	for _, req := range requests {
+		shadow.Observe(req, nil, primary.Evaluate(req))
+	}
+	if report := shadow.Report(); report.Evaluated != 7 || report.Diverged != 0 || len(report.Commands) != 0 {
+		t.Errorf("report after reload = %+v, want no divergences from an identical policy", report)
+	}
+}
+
+func TestShadowPolicyUnloadable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shadow.yaml")
+	writeTestFile(t, path, "default_action: [not yaml")
+	shadow := NewShadowPolicy(path, log.New(io.Discard, "", 0))
+
+	req := &protocol.Request{Command: "rm"}
+	shadow.Observe(req, nil, DefaultPolicy().Evaluate(req))
+	if report := shadow.Report(); report.Loaded || report.Evaluated != 0 {
+		t.Errorf("report = %+v, want nothing evaluated while the file does not load", report)
+	}
+
+	// Fixing the file starts shadow evaluation
+	writeTestFile(t, path, "default_action: allow\nrules: []\n")
+	if err := shadow.watcher.handlePolicyChange(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	shadow.Observe(req, nil, DefaultPolicy().Evaluate(req))
+	if report := shadow.Report(); !report.Loaded || report.Diverged != 1 {
+		t.Errorf("report after fixing = %+v, want one divergence", report)
+	}
+}
+
+func TestShadowReportAPI(t *testing.T) {
+	srv := newTestServer(t)
+	api := &APIServer{warden: srv}
+
+	rec := httptest.NewRecorder()
+	api.handleShadowReport(rec, httptest.NewRequest(http.MethodGet, "/api/policy/shadow-report", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("without a shadow policy: status %d, want 404", rec.Code)
+	}
+
+	path := filepath.Join(t.TempDir(), "shadow.yaml")
+	writeTestFile(t, path, "default_action: allow\nrules: []\n")
+	srv.shadow = NewShadowPolicy(path, log.New(io.Discard, "", 0))
+	req := &protocol.Request{Command: "rm", Args: []string{"-rf", "build"}}
+	srv.shadow.Observe(req, nil, DefaultPolicy().Evaluate(req))
+
+	rec = httptest.NewRecorder()
+	api.handleShadowReport(rec, httptest.NewRequest(http.MethodGet, "/api/policy/shadow-report", nil))
+	var report ShadowReport
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if report.Path != path || len(report.Commands) != 1 || report.Commands[0].Divergences[0].Shadow != ActionAllow {
+		t.Errorf("report = %+v", report)
+	}
+}
@@ -0,0 +1,340 @@
+package warden
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ShellCommand is one simple command found in a shell script.
+type ShellCommand struct {
+	Name string
+	Args []string
+}
+
+// errShellUnsupported marks constructs the splitter refuses to interpret.
+// Callers fall back to evaluating the shell invocation as a whole.
+type errShellUnsupported struct{ what string }
+
+func (e errShellUnsupported) Error() string {
+	return "unsupported shell construct: " + e.what
+}
+
+// shellReserved are words that start compound commands or functions.
+// Scripts using them are not split. Quoted, they are ordinary words.
+var shellReserved = map[string]bool{
+	"if": true, "then": true, "else": true, "elif": true, "fi": true,
+	"for": true, "while": true, "until": true, "do": true, "done": true,
+	"case": true, "esac": true, "select": true, "function": true,
+	"{": true, "}": true, "[[": true, "]]": true,
+}
+
+// shellEvalBuiltins run code that is not visible in the script itself.
+// Unlike keywords they are still builtins when quoted or escaped ("eval",
+// \exec), so scripts naming them are never split.
+var shellEvalBuiltins = map[string]bool{
+	"eval": true, "exec": true, "source": true, ".": true,
+}
+
+type shellTokenKind int
+
+const (
+	shellWord shellTokenKind = iota
+	shellOperator
+	shellRedirect
+)
+
+type shellToken struct {
+	kind      shellTokenKind
+	text      string
+	quoted    bool // Any part of the word was quoted or escaped
+	expansion bool // The word contains an unquoted or double-quoted $
+}
+
+// SplitShellScript splits a "sh -c" script into its simple commands.
+// It understands quoting, escapes, comments, leading variable assignments,
+// redirections, and the separators ; & && || | and newline. Anything that
+// would need a real shell to interpret (subshells, command substitution,
+// here-documents, control flow, or a command name built from a variable)
+// returns an error rather than a guess. So do arguments taken from
+// variables, whose values only the shell knows.
+func SplitShellScript(script string) ([]ShellCommand, error) {
+	tokens, err := lexShell(script)
+	if err != nil {
+		return nil, err
+	}
+
+	var commands []ShellCommand
+	var words []shellToken
+	needCommand := false // After && || | another command must follow
+
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		switch tok.kind {
+		case shellWord:
+			words = append(words, tok)
+			continue
+		case shellRedirect:
+			// Redirections do not change which command runs; drop the target
+			if i+1 >= len(tokens) || tokens[i+1].kind != shellWord {
+				return nil, fmt.Errorf("redirection %q has no target", tok.text)
+			}
+			i++
+			continue
+		}
+
+		if len(words) == 0 {
+			// Blank lines are fine, and so is a single trailing ; or &
+			trailing := i == len(tokens)-1 && (tok.text == ";" || tok.text == "&")
+			if tok.text == "\n" || (trailing && len(commands) > 0 && !needCommand) {
+				continue
+			}
+			return nil, fmt.Errorf("syntax error near %q", tok.text)
+		}
+
+		cmd, ok, err := simpleCommand(words)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			commands = append(commands, cmd)
+		}
+		words = nil
+		needCommand = tok.text == "&&" || tok.text == "||" || tok.text == "|"
+	}
+
+	if len(words) > 0 {
+		cmd, ok, err := simpleCommand(words)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			commands = append(commands, cmd)
+		}
+	} else if needCommand {
+		return nil, fmt.Errorf("script ends with an operator")
+	}
+	return commands, nil
+}
+
+// simpleCommand turns the words of one simple command into a ShellCommand.
+// ok is false for commands that only assign variables.
+func simpleCommand(words []shellToken) (cmd ShellCommand, ok bool, err error) {
+	if words[0].text == "!" && !words[0].quoted {
+		words = words[1:]
+	}
+	for len(words) > 0 && isAssignment(words[0]) {
+		words = words[1:]
+	}
+	if len(words) == 0 {
+		return ShellCommand{}, false, nil
+	}
+
+	name := words[0]
+	if shellEvalBuiltins[name.text] || (!name.quoted && shellReserved[name.text]) {
+		return ShellCommand{}, false, errShellUnsupported{name.text}
+	}
+	if name.expansion {
+		return ShellCommand{}, false, errShellUnsupported{"command name from variable " + name.text}
+	}
+
+	cmd.Name = name.text
+	for _, w := range words[1:] {
+		// Rules would match the variable's name, not what the shell makes of it
+		if w.expansion {
+			return ShellCommand{}, false, errShellUnsupported{"argument from variable " + w.text}
+		}
+		cmd.Args = append(cmd.Args, w.text)
+	}
+	return cmd, true, nil
+}
+
+// isAssignment reports whether a word is a NAME=value prefix assignment.
+func isAssignment(tok shellToken) bool {
+	name, _, ok := strings.Cut(tok.text, "=")
+	if !ok || name == "" {
+		return false
+	}
+	for i, r := range name {
+		if r != '_' && !isASCIILetter(r) && (i == 0 || r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// lexShell splits a script into words, operators, and redirections.
+func lexShell(script string) ([]shellToken, error) {
+	var tokens []shellToken
+	var cur strings.Builder
+	var word shellToken
+	inWord := false
+
+	endWord := func() {
+		if inWord {
+			word.kind = shellWord
+			word.text = cur.String()
+			tokens = append(tokens, word)
+		}
+		cur.Reset()
+		word = shellToken{}
+		inWord = false
+	}
+	operator := func(kind shellTokenKind, text string) {
+		endWord()
+		tokens = append(tokens, shellToken{kind: kind, text: text})
+	}
+	peek := func(i int) byte {
+		if i < len(script) {
+			return script[i]
+		}
+		return 0
+	}
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch c {
+		case ' ', '\t':
+			endWord()
+
+		case '\n':
+			operator(shellOperator, "\n")
+
+		case '#':
+			if inWord {
+				cur.WriteByte(c)
+				continue
+			}
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+			i-- // Let the newline end the command
+
+		case '\'':
+			end := strings.IndexByte(script[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+			cur.WriteString(script[i+1 : i+1+end])
+			word.quoted, inWord = true, true
+			i += end + 1
+
+		case '"':
+			word.quoted, inWord = true, true
+			closed := false
+			for i++; i < len(script); i++ {
+				d := script[i]
+				if d == '"' {
+					closed = true
+					break
+				}
+				switch {
+				case d == '\\' && strings.IndexByte("$`\"\\\n", peek(i+1)) >= 0:
+					i++
+					if script[i] != '\n' {
+						cur.WriteByte(script[i])
+					}
+				case d == '`' || (d == '$' && peek(i+1) == '('):
+					return nil, errShellUnsupported{"command substitution"}
+				case d == '$':
+					word.expansion = true
+					cur.WriteByte(d)
+				default:
+					cur.WriteByte(d)
+				}
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated double quote")
+			}
+
+		case '\\':
+			if i+1 >= len(script) {
+				return nil, fmt.Errorf("trailing backslash")
+			}
+			i++
+			if script[i] != '\n' { // Backslash-newline continues the line
+				cur.WriteByte(script[i])
+				word.quoted, inWord = true, true
+			}
+
+		case '`':
+			return nil, errShellUnsupported{"command substitution"}
+
+		case '$':
+			if peek(i+1) == '(' {
+				return nil, errShellUnsupported{"command substitution"}
+			}
+			word.expansion, inWord = true, true
+			cur.WriteByte(c)
+
+		case '(', ')':
+			return nil, errShellUnsupported{"subshell"}
+
+		case '|':
+			if peek(i+1) == '|' {
+				i++
+				operator(shellOperator, "||")
+			} else {
+				if peek(i+1) == '&' { // |& pipes stderr too
+					i++
+				}
+				operator(shellOperator, "|")
+			}
+
+		case '&':
+			switch peek(i + 1) {
+			case '&':
+				i++
+				operator(shellOperator, "&&")
+			case '>':
+				i++
+				if peek(i+1) == '>' {
+					i++
+				}
+				operator(shellRedirect, "&>")
+			default:
+				operator(shellOperator, "&")
+			}
+
+		case ';':
+			if peek(i+1) == ';' {
+				return nil, errShellUnsupported{"case clause"}
+			}
+			operator(shellOperator, ";")
+
+		case '<', '>':
+			// A bare number right before the operator is a file descriptor
+			if inWord && !word.quoted && !word.expansion && isDigits(cur.String()) {
+				cur.Reset()
+				word = shellToken{}
+				inWord = false
+			}
+			op := string(c)
+			switch next := peek(i + 1); {
+			case c == '<' && next == '<':
+				return nil, errShellUnsupported{"here-document"}
+			case next == '>' || next == '&' || (c == '>' && next == '|') || (c == '<' && next == '>'):
+				op += string(next)
+				i++
+			}
+			operator(shellRedirect, op)
+
+		default:
+			cur.WriteByte(c)
+			inWord = true
+		}
+	}
+	endWord()
+	return tokens, nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,206 @@
+package warden
+
+import (
+	"clawrden/pkg/protocol"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSplitShellScript(t *testing.T) {
+	cmd := func(name string, args ...string) ShellCommand {
+		return ShellCommand{Name: name, Args: args}
+	}
+
+	tests := []struct {
+		name   string
+		script string
+		want   []ShellCommand
+	}{
+		{"single", "npm test", []ShellCommand{cmd("npm", "test")}},
+		{"and chain", "cd x && npm install && npm test",
+			[]ShellCommand{cmd("cd", "x"), cmd("npm", "install"), cmd("npm", "test")}},
+		{"or", "make || echo failed", []ShellCommand{cmd("make"), cmd("echo", "failed")}},
+		{"pipeline", "cat a.txt | grep foo | wc -l",
+			[]ShellCommand{cmd("cat", "a.txt"), cmd("grep", "foo"), cmd("wc", "-l")}},
+		{"pipe stderr", "make |& tee log", []ShellCommand{cmd("make"), cmd("tee", "log")}},
+		{"semicolons", "ls; pwd;", []ShellCommand{cmd("ls"), cmd("pwd")}},
+		{"background", "server & curl localhost", []ShellCommand{cmd("server"), cmd("curl", "localhost")}},
+		{"newlines", "ls\n\npwd\n", []ShellCommand{cmd("ls"), cmd("pwd")}},
+		{"operator then newline", "ls &&\n  pwd", []ShellCommand{cmd("ls"), cmd("pwd")}},
+		{"line continuation", "npm \\\n  test", []ShellCommand{cmd("npm", "test")}},
+		{"single quotes", "echo 'a && b; c | d'", []ShellCommand{cmd("echo", "a && b; c | d")}},
+		{"double quotes", `echo "a && b" "x\"y" "\$HOME"`, []ShellCommand{cmd("echo", "a && b", `x"y`, "$HOME")}},
+		{"adjacent quoting", `echo a'b'"c"d`, []ShellCommand{cmd("echo", "abcd")}},
+		{"escaped operator", `echo a\;b \&\& c`, []ShellCommand{cmd("echo", "a;b", "&&", "c")}},
+		{"empty string arg", `git commit -m ""`, []ShellCommand{cmd("git", "commit", "-m", "")}},
+		{"quoted command name", `"rm" -rf x`, []ShellCommand{cmd("rm", "-rf", "x")}},
+		{"quoted keyword is a command", `'if' x`, []ShellCommand{cmd("if", "x")}},
+		{"comment", "ls # && rm -rf /\npwd", []ShellCommand{cmd("ls"), cmd("pwd")}},
+		{"hash inside word", "echo a#b", []ShellCommand{cmd("echo", "a#b")}},
+		{"assignments", "CI=1 NODE_ENV=test npm test", []ShellCommand{cmd("npm", "test")}},
+		{"assignment only", "X=1; ls", []ShellCommand{cmd("ls")}},
+		{"negation", "! grep -q foo f", []ShellCommand{cmd("grep", "-q", "foo", "f")}},
+		{"redirections", "npm test > out.log 2>&1 < /dev/null",
+			[]ShellCommand{cmd("npm", "test")}},
+		{"redirect first", ">out ls", []ShellCommand{cmd("ls")}},
+		{"append and all", "make >>log &>all", []ShellCommand{cmd("make")}},
+		{"attached redirect", "echo hi>f", []ShellCommand{cmd("echo", "hi")}},
+		{"empty", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SplitShellScript(tt.script)
+			if err != nil {
+				t.Fatalf("SplitShellScript(%q): %v", tt.script, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitShellScript(%q) = %q, want %q", tt.script, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitShellScriptRejects(t *testing.T) {
+	scripts := map[string]string{
+		"subshell":                "(cd x && rm -rf y)",
+		"subshell after op":       "ls && (rm -rf /)",
+		"command substitution":    "echo $(rm -rf /)",
+		"quoted substitution":     `echo "$(rm -rf /)"`,
+		"backticks":               "echo `id`",
+		"here-document":           "cat <<EOF\nhi\nEOF",
+		"if":                      "if true; then rm x; fi",
+		"for loop":                "for f in *; do rm $f; done",
+		"brace group":             "{ ls; }",
+		"function":                "function f { ls; }",
+		"eval":                    `eval "rm -rf /"`,
+		"exec":                    "exec rm -rf /",
+		"source":                  ". ./script.sh",
+		"variable command":        "$CMD -rf /",
+		"braced variable command": "${CMD} x",
+		"variable arg":            "rm -rf $DIR",
+		"braced variable arg":     "ls ${PWD}",
+		"quoted variable arg":     `rm -rf "$DIR"`,
+		"single-quoted eval":      `'eval' "rm -rf /"`,
+		"double-quoted eval":      `"eval" ls`,
+		"escaped exec":            `\exec rm -rf /`,
+		"quoted exec":             `ex'ec' rm -rf /`,
+		"quoted source":           `"source" f`,
+		"escaped dot":             `\. ./script.sh`,
+		"quoted dot":              `'.' ./script.sh`,
+		"unterminated single":     "echo 'oops",
+		"unterminated double":     `echo "oops`,
+		"trailing backslash":      `echo \`,
+		"leading operator":        "&& ls",
+		"double operator":         "ls && && pwd",
+		"trailing and":            "ls &&",
+		"trailing pipe":           "ls |",
+		"empty command":           "ls ;; pwd",
+		"dangling redirect":       "ls >",
+		"redirect into operator":  "ls > && pwd",
+	}
+
+	for name, script := range scripts {
+		t.Run(name, func(t *testing.T) {
+			if got, err := SplitShellScript(script); err == nil {
+				t.Errorf("SplitShellScript(%q) = %q, want error", script, got)
+			}
+		})
+	}
+}
+
+func TestShellScriptArgs(t *testing.T) {
+	tests := []struct {
+		args   []string
+		script string
+		ok     bool
+	}{
+		{[]string{"-c", "ls"}, "ls", true},
+		{[]string{"-ec", "ls"}, "ls", true},
+		{[]string{"-lc", "ls", "arg0", "arg1"}, "ls", true},
+		{[]string{"--norc", "-c", "ls"}, "ls", true},
+		{[]string{"-o", "pipefail", "-c", "ls"}, "ls", true},
+		{[]string{"-c", "--", "ls"}, "ls", true},
+		{[]string{"script.sh"}, "", false},
+		{[]string{"-e", "script.sh"}, "", false},
+		{[]string{"-c"}, "", false},
+		{nil, "", false},
+	}
+
+	for _, tt := range tests {
+		script, ok := shellScript(tt.args)
+		if script != tt.script || ok != tt.ok {
+			t.Errorf("shellScript(%q) = %q, %v; want %q, %v", tt.args, script, ok, tt.script, tt.ok)
+		}
+	}
+}
+
+func TestPolicyEvaluateShellScripts(t *testing.T) {
+	pe := &PolicyEngine{
+		config: PolicyConfig{
+			DefaultAction:  ActionDeny,
+			DefaultTimeout: time.Minute,
+			ShellCommands:  []string{"sh", "bash"},
+			Rules: []Rule{
+				{Command: "npm", Action: ActionAsk, Timeout: 5 * time.Minute},
+				{Command: "ls", Action: ActionAllow},
+				{Command: "grep", Action: ActionAllow},
+				{Command: "rm", Action: ActionDeny},
+				{Command: "sh", Action: ActionAsk},
+				{Command: "bash", Action: ActionAllow},
+			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		command string
+		args    []string
+		want    Action
+		subs    []Action
+	}{
+		{"all allowed", "sh", []string{"-c", "ls | grep x"}, ActionAllow, []Action{ActionAllow, ActionAllow}},
+		{"any ask", "sh", []string{"-c", "true && ls && npm install"}, ActionAsk, []Action{ActionAllow, ActionAsk}},
+		{"cd is evaluated", "sh", []string{"-c", "cd /etc && ls"}, ActionDeny, []Action{ActionDeny, ActionAllow}},
+		{"any deny", "sh", []string{"-c", "npm test || rm -rf dist"}, ActionDeny, []Action{ActionAsk, ActionDeny}},
+		{"unknown command uses default", "sh", []string{"-c", "ls; curl x"}, ActionDeny, []Action{ActionAllow, ActionDeny}},
+		{"quoted operator is one command", "sh", []string{"-c", "grep 'a && rm -rf /'"}, ActionAllow, []Action{ActionAllow}},
+		{"nested shell", "bash", []string{"-c", `sh -c "ls && rm x"`}, ActionDeny, []Action{ActionAllow, ActionDeny}},
+		{"path command", "/bin/sh", []string{"-c", "/usr/bin/rm x"}, ActionDeny, []Action{ActionDeny}},
+		{"subshell falls back", "sh", []string{"-c", "(ls)"}, ActionAsk, nil},
+		{"substitution falls back", "bash", []string{"-c", "ls $(rm -rf /)"}, ActionAllow, nil},
+		{"builtins only fall back", "sh", []string{"-c", "true; :"}, ActionAsk, nil},
+		{"quoted eval falls back", "sh", []string{"-c", `'eval' "rm -rf /"`}, ActionAsk, nil},
+		{"variable arg falls back", "bash", []string{"-c", "ls $DIR"}, ActionAllow, nil},
+		{"script file falls back", "sh", []string{"build.sh"}, ActionAsk, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := pe.Evaluate(&protocol.Request{Command: tt.command, Args: tt.args})
+			if result.Action != tt.want {
+				t.Errorf("Action = %v, want %v", result.Action, tt.want)
+			}
+			var subs []Action
+			for _, sub := range result.Subcommands {
+				subs = append(subs, sub.Action)
+			}
+			if !reflect.DeepEqual(subs, tt.subs) {
+				t.Errorf("subcommand actions = %v, want %v (%+v)", subs, tt.subs, result.Subcommands)
+			}
+		})
+	}
+
+	// Timeouts add up across the script's commands
+	result := pe.Evaluate(&protocol.Request{Command: "sh", Args: []string{"-c", "npm ci && npm test && ls"}})
+	if want := 11 * time.Minute; result.ExecTimeout != want {
+		t.Errorf("Timeout = %v, want %v", result.ExecTimeout, want)
+	}
+
+	// Shell-aware evaluation is opt-in
+	pe.config.ShellCommands = nil
+	if result := pe.Evaluate(&protocol.Request{Command: "bash", Args: []string{"-c", "rm -rf /"}}); result.Action != ActionAllow {
+		t.Errorf("without shell_commands: Action = %v, want the shell's own rule", result.Action)
+	}
+}
@@ -0,0 +1,165 @@
+package warden
+
+import (
+	"clawrden/internal/executor"
+	"clawrden/pkg/protocol"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// defaultStallTimeout is how long a write of output to a shim may block
+// when Config.StallTimeout is unset. It is generous: agents pause, and a
+// shim printing to a slow terminal is not stalled.
+const defaultStallTimeout = 2 * time.Minute
+
+// defaultSpoolDir holds spooled output when Config.SpoolDir is unset.
+const defaultSpoolDir = "/var/lib/clawrden/spool"
+
+// StallAction is what the warden does with a command whose shim stopped
+// reading its output.
+type StallAction string
+
+const (
+	StallKill  StallAction = "kill"  // Stop the command (default)
+	StallSpool StallAction = "spool" // Let it finish, saving the rest of its output
+)
+
+// How an AuditEntry's ShimStall says a stall was handled.
+const (
+	ShimStallKilled  = "killed"
+	ShimStallSpooled = "spooled"
+)
+
+func (a StallAction) validate() error {
+	switch a {
+	case "", StallKill, StallSpool:
+		return nil
+	}
+	return fmt.Errorf("on_shim_stall must be kill or spool, got %q", a)
+}
+
+// stallTimeout returns how long output writes to a shim may block; 0
+// means forever.
+func (s *Server) stallTimeout() time.Duration {
+	switch {
+	case s.config.StallTimeout < 0:
+		return 0
+	case s.config.StallTimeout == 0:
+		return defaultStallTimeout
+	}
+	return s.config.StallTimeout
+}
+
+// spoolDir returns the directory spooled output is saved in.
+func (s *Server) spoolDir() string {
+	if s.config.SpoolDir != "" {
+		return s.config.SpoolDir
+	}
+	return defaultSpoolDir
+}
+
+// outputSpool saves the output frames written after a shim stalled to a
+// file, stdout and stderr as they came, and keeps the exit code. The file
+// is created on the first output.
+type outputSpool struct {
+	path     string
+	file     *os.File
+	exitCode *int
+}
+
+func (sp *outputSpool) Write(b []byte) (int, error) {
+	if len(b) < protocol.FrameHeaderSize {
+		return len(b), nil
+	}
+	payload := b[protocol.FrameHeaderSize:]
+	switch b[0] {
+	case protocol.StreamStdout, protocol.StreamStderr:
+		if sp.file == nil {
+			if err := os.MkdirAll(filepath.Dir(sp.path), 0700); err != nil {
+				return 0, err
+			}
+			f, err := os.OpenFile(sp.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+			if err != nil {
+				return 0, err
+			}
+			sp.file = f
+		}
+		if _, err := sp.file.Write(payload); err != nil {
+			return 0, err
+		}
+	case protocol.StreamExit:
+		if len(payload) > 0 {
+			code := protocol.ParseExitCode(protocol.Frame{Payload: payload})
+			sp.exitCode = &code
+		}
+	}
+	return len(b), nil
+}
+
+// close closes the spool file, if there is one.
+func (sp *outputSpool) close() {
+	if sp.file != nil {
+		sp.file.Close()
+	}
+}
+
+// guardStall wraps the shim connection of a request about to run so that a
+// shim that stops reading is detected within the stall timeout. As the
+// policy says, the command is then killed, by cancelling ctx with
+// executor.ErrShimStalled, or its remaining output is spooled. It returns
+// conn unchanged when stall detection is off.
+func (s *Server) guardStall(conn net.Conn, entry *AuditEntry, action StallAction, cancel context.CancelCauseFunc) (net.Conn, *executor.StallConn, *outputSpool) {
+	timeout := s.stallTimeout()
+	if timeout == 0 {
+		return conn, nil, nil
+	}
+	var spool *outputSpool
+	if action == StallSpool {
+		spool = &outputSpool{path: filepath.Join(s.spoolDir(), entry.RequestID+".out")}
+	}
+	stall := executor.NewStallConn(conn, timeout, func() {
+		if spool != nil {
+			s.logger.Printf("warning: shim for %s (%s) stopped reading output for %v; spooling the rest to %s",
+				entry.Command, entry.RequestID, timeout, spool.path)
+			return
+		}
+		s.logger.Printf("warning: shim for %s (%s) stopped reading output for %v; killing the command",
+			entry.Command, entry.RequestID, timeout)
+		cancel(executor.ErrShimStalled)
+	})
+	if spool != nil {
+		stall.SpoolTo(spool)
+	}
+	return stall, stall, spool
+}
+
+// recordStall notes in entry how a stalled shim was handled. A spooled
+// command's exit code never reached the shim, so it is taken from the spool.
+func (s *Server) recordStall(ctx context.Context, entry *AuditEntry, stall *executor.StallConn, spool *outputSpool) {
+	if stall == nil || !stall.Stalled() {
+		return
+	}
+	timeout := s.stallTimeout()
+	if spool == nil || errors.Is(context.Cause(ctx), executor.ErrShimStalled) {
+		entry.ShimStall = ShimStallKilled
+		entry.Error = fmt.Sprintf("shim stopped reading output for %v; the command was killed", timeout)
+		return
+	}
+	spool.close()
+	entry.ShimStall = ShimStallSpooled
+	if spool.file != nil {
+		entry.OutputSpool = spool.path
+	}
+	if spool.exitCode != nil {
+		entry.ExitCode = *spool.exitCode
+	}
+	if err := stall.SpoolErr(); err != nil {
+		s.logger.Printf("warning: spooling output of %s: %v", entry.Command, err)
+		entry.Error = fmt.Sprintf("shim stopped reading output for %v; spooling the rest failed: %v", timeout, err)
+	}
+}
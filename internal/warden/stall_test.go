@@ -0,0 +1,87 @@
+package warden
+
+import (
+	"clawrden/pkg/protocol"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShimStall(t *testing.T) {
+	const total = 10_000_000
+	line := strings.Repeat("x", 99) // 100 bytes with the newline
+	script := "yes " + line + " | head -c 10000000"
+
+	tests := []struct {
+		name   string
+		action StallAction
+	}{
+		{"kill by default", ""},
+		{"spool", StallSpool},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, audited := newMaintenanceTestServer(t, nil)
+			srv.setPolicy(&PolicyEngine{config: PolicyConfig{
+				DefaultAction: ActionDeny,
+				Rules:         []Rule{{Command: "sh", Action: ActionAllow}},
+				OnShimStall:   tt.action,
+			}})
+			srv.config.StallTimeout = 200 * time.Millisecond
+			srv.config.SpoolDir = t.TempDir()
+
+			// A shim that stops reading after 1KB
+			client, server := net.Pipe()
+			defer client.Close()
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				srv.handleConnection(server)
+			}()
+			if err := protocol.WriteRequest(client, &protocol.Request{Command: "sh", Args: []string{"-c", script}, Cwd: "/"}); err != nil {
+				t.Fatal(err)
+			}
+			if ack, err := protocol.ReadAck(client); err != nil || ack != protocol.AckAllowed {
+				t.Fatalf("ack %d, %v", ack, err)
+			}
+			if _, err := io.ReadFull(client, make([]byte, 1024)); err != nil {
+				t.Fatal(err)
+			}
+
+			select {
+			case <-done:
+			case <-time.After(10 * time.Second):
+				t.Fatal("warden still blocked on a shim that stopped reading")
+			}
+			entries := audited()
+			if len(entries) != 1 {
+				t.Fatalf("audited %d entries, want 1", len(entries))
+			}
+			e := entries[0]
+			if e.Delivery != "partial" {
+				t.Errorf("delivery = %q, want partial", e.Delivery)
+			}
+
+			if tt.action != StallSpool {
+				if e.ShimStall != ShimStallKilled || !strings.Contains(e.Error, "shim stopped reading output for 200ms; the command was killed") || e.ExitCode == 0 {
+					t.Errorf("entry = shim_stall %q, exit %d, error %q", e.ShimStall, e.ExitCode, e.Error)
+				}
+				return
+			}
+			if e.ShimStall != ShimStallSpooled || e.ExitCode != 0 || e.Error != "" {
+				t.Errorf("entry = shim_stall %q, exit %d, error %q", e.ShimStall, e.ExitCode, e.Error)
+			}
+			info, err := os.Stat(e.OutputSpool)
+			if err != nil {
+				t.Fatalf("spool file: %v", err)
+			}
+			// The line being written when the shim stalled may be in both
+			if delivered := e.BytesStdout + info.Size(); delivered < total || delivered > total+int64(len(line)+1) {
+				t.Errorf("delivered %d + spooled %d bytes, want the %d written", e.BytesStdout, info.Size(), total)
+			}
+		})
+	}
+}
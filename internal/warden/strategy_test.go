@@ -0,0 +1,159 @@
+package warden
+
+import (
+	"clawrden/internal/executor"
+	"clawrden/pkg/protocol"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// routingDocker records whether a command was mirrored (exec) or ghosted
+// (create) and fails the call, so nothing needs to be streamed.
+type routingDocker struct {
+	executor.DockerAPI // Unused container calls panic
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func (d *routingDocker) record(call string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.calls = append(d.calls, call)
+}
+
+func (d *routingDocker) ContainerExecCreate(ctx context.Context, id string, opts container.ExecOptions) (container.ExecCreateResponse, error) {
+	d.record("mirror")
+	return container.ExecCreateResponse{}, errors.New("fake docker")
+}
+
+func (d *routingDocker) ContainerCreate(ctx context.Context, cfg *container.Config, host *container.HostConfig, net *network.NetworkingConfig, platform *ocispec.Platform, name string) (container.CreateResponse, error) {
+	d.record("ghost")
+	return container.CreateResponse{}, errors.New("fake docker")
+}
+
+func TestStrategyRouting(t *testing.T) {
+	policy := &PolicyEngine{config: PolicyConfig{
+		DefaultAction: ActionDeny,
+		Ghost: GhostPolicy{
+			Commands: map[string]GhostHardeningConfig{"kubectl": {Strategy: executor.StrategyMirror}},
+		},
+		Rules: []Rule{
+			{Command: "node", Action: ActionAllow, Strategy: executor.StrategyMirror},
+			{Command: "terraform", Action: ActionAllow, Strategy: executor.StrategyGhost},
+			{Command: "echo", Action: ActionAllow, Strategy: executor.StrategyLocal},
+			{Command: "ls", Action: ActionAllow},
+			{Command: "npm", Action: ActionAllow},
+			{Command: "kubectl", Action: ActionAllow},
+			{Command: "cat", Action: ActionAllow, Strategy: executor.StrategyMirror, SandboxCwd: true},
+		},
+	}}
+
+	tests := []struct {
+		name         string
+		command      string
+		container    string
+		wantStrategy executor.Strategy
+	}{
+		{"rule mirrors a ghost command", "node", "0123456789ab", executor.StrategyMirror},
+		{"rule ghosts a command", "terraform", "0123456789ab", executor.StrategyGhost},
+		{"auto mirrors", "ls", "0123456789ab", executor.StrategyMirror},
+		{"auto ghosts toolchains", "npm", "0123456789ab", executor.StrategyGhost},
+		{"ghost config sets the default", "kubectl", "0123456789ab", executor.StrategyMirror},
+		{"sandboxes always ghost", "cat", "0123456789ab", executor.StrategyGhost},
+		{"local", "echo", "0123456789ab", executor.StrategyLocal},
+		{"host requests run locally", "terraform", "", executor.StrategyLocal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t)
+			docker := &routingDocker{}
+			srv.dockerExec = executor.NewDockerExecutor(docker, srv.logger)
+			srv.localExec = executor.NewLocalExecutor(srv.logger)
+
+			req := &protocol.Request{Command: tt.command, Args: []string{"x"}, Cwd: t.TempDir(), ContainerID: tt.container}
+			eval := policy.Evaluate(req)
+			exec, strategy := srv.executorFor(req, eval.Strategy, eval.Sandbox != nil)
+			if strategy != tt.wantStrategy {
+				t.Fatalf("strategy = %q, want %q", strategy, tt.wantStrategy)
+			}
+
+			client, server := net.Pipe()
+			go io.Copy(io.Discard, client)
+			exec.Execute(context.Background(), req, server)
+			server.Close()
+
+			wantDocker := string(tt.wantStrategy)
+			if tt.wantStrategy == executor.StrategyLocal {
+				wantDocker = ""
+			}
+			if got := strings.Join(docker.calls, ","); got != wantDocker {
+				t.Errorf("docker calls = %q, want %q", got, wantDocker)
+			}
+		})
+	}
+}
+
+func TestStrategyAudited(t *testing.T) {
+	rules := []Rule{
+		{Command: "echo", Action: ActionAllow, Strategy: executor.StrategyGhost},
+		{Command: "terraform", Action: ActionAllow, Strategy: executor.StrategyLocal},
+	}
+
+	// Host requests record where they ran
+	srv, audited := newMaintenanceTestServer(t, rules)
+	sendRequest(t, srv, &protocol.Request{Command: "echo", Args: []string{"hi"}, Cwd: t.TempDir()})
+	if entries := audited(); entries[len(entries)-1].Strategy != "local" {
+		t.Errorf("audited strategy = %q, want local", entries[len(entries)-1].Strategy)
+	}
+
+	// Containerized requests only run on the host with host fallback enabled
+	for _, allow := range []bool{false, true} {
+		srv, audited := newMaintenanceTestServer(t, rules)
+		srv.config.AllowHostFallback = allow
+		req := &protocol.Request{Command: "terraform", ContainerID: "0123456789ab"}
+		client, server := net.Pipe()
+		go io.Copy(io.Discard, client)
+		refused := srv.refuseHostFallback(server, req, executor.StrategyLocal, &AuditEntry{Command: req.Command}, nil, false)
+		server.Close()
+		if refused == allow {
+			t.Errorf("AllowHostFallback %v: refused = %v", allow, refused)
+		}
+		if entries := audited(); !allow && (len(entries) != 1 || entries[0].Decision != protocol.DecisionDeny || entries[0].Outcome != protocol.OutcomeHostFallbackDisabled) {
+			t.Errorf("AllowHostFallback %v: audited %+v", allow, entries)
+		}
+	}
+}
+
+func TestLoadPolicyRejectsUnknownStrategy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+	}{
+		{"rule", "rules:\n  - command: ls\n    action: allow\n    strategy: teleport\n"},
+		{"ghost defaults", "ghost:\n  defaults:\n    strategy: teleport\n"},
+		{"ghost command", "ghost:\n  commands:\n    npm:\n      strategy: teleport\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.yaml")
+			if err := os.WriteFile(path, []byte(tt.policy), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadPolicy(path); err == nil || !strings.Contains(err.Error(), "teleport") {
+				t.Errorf("LoadPolicy error = %v, want the unknown strategy named", err)
+			}
+		})
+	}
+}
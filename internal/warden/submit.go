@@ -0,0 +1,51 @@
+package warden
+
+import (
+	"bytes"
+	"clawrden/pkg/protocol"
+	"context"
+	"errors"
+	"net"
+)
+
+// ErrStopped is returned for requests submitted after Shutdown.
+var ErrStopped = errors.New("warden is shut down")
+
+// Submit handles req on behalf of code in the warden's own process, as the
+// Unix socket does for a shim: the request is validated, decided by the
+// policy, reviewed if it asks for approval, run and audited the same way.
+// The returned connection is the caller's end of the conversation, which
+// reads exactly as a shim's would (see protocol.ReadAck); closing it, or
+// cancelling ctx, cancels the request.
+//
+// There are no peer credentials to check the request's identity and
+// container against, so they are taken as given. A warden that requires
+// shim provenance denies every submitted request, and submitted requests
+// do not count against Config.MaxConnections.
+func (s *Server) Submit(ctx context.Context, req *protocol.Request) (net.Conn, error) {
+	if s.ctx.Err() != nil {
+		return nil, ErrStopped
+	}
+	// Transcripts record the request as it would have arrived on the socket
+	var rawRequest bytes.Buffer
+	if err := protocol.WriteRequest(&rawRequest, req); err != nil {
+		return nil, err
+	}
+
+	client, conn := net.Pipe()
+	stop := context.AfterFunc(ctx, func() { client.Close() })
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer stop()
+		defer conn.Close()
+
+		req.Normalize()
+		if err := req.Validate(); err != nil {
+			s.rejectMalformed(conn, req, err)
+			return
+		}
+		s.serveRequest(conn, nil, req, rawRequest.Bytes())
+	}()
+	return client, nil
+}
@@ -0,0 +1,200 @@
+package warden
+
+import (
+	"bytes"
+	"clawrden/pkg/protocol"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxSuggestions bounds the commands collected as suggestions. Past it, a
+// newly denied command replaces the one denied least (the least recently
+// among equals), so the most denied commands stay.
+const maxSuggestions = 200
+
+// maxSuggestionContainers bounds the containers kept per suggestion.
+const maxSuggestionContainers = 10
+
+// defaultTopSuggestions is how many suggestions a report lists unless
+// asked for more or fewer.
+const defaultTopSuggestions = 20
+
+// ErrNoSuggestion is returned when adopting a command that was not denied
+// by default since the suggestions were last cleared.
+var ErrNoSuggestion = errors.New("no suggestion for the command")
+
+// PolicySuggestions collects the commands denied because no rule matched
+// them (the policy's default_action was deny), as candidates for an allow
+// or ask rule. Most policy changes start from an agent being denied
+// something reasonable; the collection lists those without grepping the
+// audit log.
+type PolicySuggestions struct {
+	mu       sync.Mutex
+	commands map[string]*PolicySuggestion
+	since    time.Time
+	now      func() time.Time
+}
+
+// PolicySuggestion is one command denied by default.
+type PolicySuggestion struct {
+	Command    string    `json:"command"`
+	Count      int64     `json:"count"`
+	Example    []string  `json:"example"`    // argv of the first denial
+	Containers []string  `json:"containers"` // "host" for requests from the host; at most maxSuggestionContainers
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+}
+
+// SuggestionReport lists the commands denied by default since Since, most
+// denied first. Commands a rule now covers are left out.
+type SuggestionReport struct {
+	Since       time.Time          `json:"since"`
+	Total       int                `json:"total"` // Commands collected, before top was applied
+	Suggestions []PolicySuggestion `json:"suggestions"`
+}
+
+// AdoptedSuggestion is a rule drafted from a suggestion: Rule with the
+// field names of the policy file, for POST /api/policy/rules, and YAML to
+// paste under the policy's rules.
+type AdoptedSuggestion struct {
+	Rule map[string]any `json:"rule"`
+	YAML string         `json:"yaml"`
+}
+
+// NewPolicySuggestions returns an empty collection.
+func NewPolicySuggestions() *PolicySuggestions {
+	ps := &PolicySuggestions{now: time.Now}
+	ps.Reset()
+	return ps
+}
+
+// Reset clears the collection.
+func (ps *PolicySuggestions) Reset() {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.commands = make(map[string]*PolicySuggestion)
+	ps.since = ps.now()
+}
+
+// Observe counts a default denial of req.
+func (ps *PolicySuggestions) Observe(req *protocol.Request) {
+	container := req.ContainerID
+	if container == "" {
+		container = "host"
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	now := ps.now()
+	s := ps.commands[req.Command]
+	if s == nil {
+		if len(ps.commands) >= maxSuggestions {
+			ps.evict()
+		}
+		s = &PolicySuggestion{
+			Command:   req.Command,
+			Example:   append([]string{req.Command}, req.Args...),
+			FirstSeen: now,
+		}
+		ps.commands[req.Command] = s
+	}
+	s.Count++
+	s.LastSeen = now
+	for _, c := range s.Containers {
+		if c == container {
+			return
+		}
+	}
+	if len(s.Containers) < maxSuggestionContainers {
+		s.Containers = append(s.Containers, container)
+	}
+}
+
+// evict drops the least denied command, the least recently denied among
+// equals. ps.mu must be held.
+func (ps *PolicySuggestions) evict() {
+	var victim *PolicySuggestion
+	for _, s := range ps.commands {
+		if victim == nil || s.Count < victim.Count ||
+			(s.Count == victim.Count && s.LastSeen.Before(victim.LastSeen)) {
+			victim = s
+		}
+	}
+	if victim != nil {
+		delete(ps.commands, victim.Command)
+	}
+}
+
+// Report returns the top commands denied by default, leaving out those
+// covered reports as having a rule now.
+func (ps *PolicySuggestions) Report(top int, covered func(command string) bool) SuggestionReport {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	report := SuggestionReport{Since: ps.since, Suggestions: []PolicySuggestion{}}
+	for _, s := range ps.commands {
+		if covered != nil && covered(s.Command) {
+			continue
+		}
+		c := *s
+		c.Containers = append([]string(nil), s.Containers...)
+		report.Suggestions = append(report.Suggestions, c)
+	}
+	sort.Slice(report.Suggestions, func(i, j int) bool {
+		a, b := report.Suggestions[i], report.Suggestions[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Command < b.Command
+	})
+	report.Total = len(report.Suggestions)
+	if top > 0 && len(report.Suggestions) > top {
+		report.Suggestions = report.Suggestions[:top]
+	}
+	return report
+}
+
+// Adopt drafts a rule giving command action, allow or ask, from its
+// suggestion.
+func (ps *PolicySuggestions) Adopt(command string, action Action) (*AdoptedSuggestion, error) {
+	if action != ActionAllow && action != ActionAsk {
+		return nil, fmt.Errorf("a suggestion is adopted as allow or ask, got %q", action)
+	}
+	ps.mu.Lock()
+	s, ok := ps.commands[command]
+	var count int64
+	var example []string
+	if ok {
+		count, example = s.Count, s.Example
+	}
+	ps.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrNoSuggestion, command)
+	}
+
+	rule := Rule{
+		Command: command,
+		Action:  action,
+		Reason:  fmt.Sprintf("Adopted after %d default denials (e.g. %s)", count, strings.Join(example, " ")),
+	}
+	fields, err := ruleFields(rule)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode([]Rule{rule}); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return &AdoptedSuggestion{Rule: fields, YAML: buf.String()}, nil
+}
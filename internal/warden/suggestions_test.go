@@ -0,0 +1,170 @@
+package warden
+
+import (
+	"clawrden/pkg/protocol"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestPolicySuggestionsCollectDefaultDenials(t *testing.T) {
+	srv, _ := newMaintenanceTestServer(t, []Rule{{Command: "rm", Action: ActionDeny}})
+	srv.suggestions = NewPolicySuggestions()
+
+	seed := []*protocol.Request{
+		{Command: "npm", Args: []string{"install", "left-pad"}},
+		{Command: "jq", Args: []string{"."}},
+		{Command: "npm", Args: []string{"test"}},
+		{Command: "rm", Args: []string{"-rf", "/"}}, // Denied by a rule, not by default
+		{Command: "npm", Args: []string{"ci"}},
+		{Command: "curl", Args: []string{"example.com"}},
+		{Command: "jq", Args: []string{".name"}},
+	}
+	for _, req := range seed {
+		req.Cwd = "/"
+		if ack, _ := sendRequest(t, srv, req); ack != protocol.AckDenied {
+			t.Fatalf("%s: ack %d, want denied", req.Command, ack)
+		}
+	}
+
+	report := srv.suggestions.Report(defaultTopSuggestions, nil)
+	var ranking []string
+	for _, s := range report.Suggestions {
+		ranking = append(ranking, fmt.Sprintf("%s:%d", s.Command, s.Count))
+	}
+	if want := []string{"npm:3", "jq:2", "curl:1"}; !reflect.DeepEqual(ranking, want) {
+		t.Errorf("ranking = %v, want %v", ranking, want)
+	}
+	if npm := report.Suggestions[0]; !reflect.DeepEqual(npm.Example, []string{"npm", "install", "left-pad"}) {
+		t.Errorf("npm example %v, want the first denial", npm.Example)
+	}
+
+	// Container IDs come from peer credentials, which a pipe has none of
+	for _, id := range []string{"c1", "c2", "c1"} {
+		srv.suggestions.Observe(&protocol.Request{Command: "jq", ContainerID: id})
+	}
+	if jq := srv.suggestions.Report(1, nil).Suggestions[0]; jq.Command != "jq" || !reflect.DeepEqual(jq.Containers, []string{"host", "c1", "c2"}) {
+		t.Errorf("top suggestion %s from %v, want jq from host, c1 and c2", jq.Command, jq.Containers)
+	}
+
+	// Top N, and commands a rule now covers drop out
+	report = srv.suggestions.Report(1, func(command string) bool { return command == "jq" })
+	if report.Total != 2 || len(report.Suggestions) != 1 || report.Suggestions[0].Command != "npm" {
+		t.Errorf("top 1 without jq = %+v (total %d), want npm of 2", report.Suggestions, report.Total)
+	}
+
+	srv.suggestions.Reset()
+	if report := srv.suggestions.Report(0, nil); report.Total != 0 {
+		t.Errorf("after reset: %d suggestions", report.Total)
+	}
+}
+
+func TestPolicySuggestionsBounded(t *testing.T) {
+	ps := NewPolicySuggestions()
+	now := time.Unix(0, 0)
+	ps.now = func() time.Time { now = now.Add(time.Second); return now }
+
+	for i := 0; i < 3; i++ {
+		ps.Observe(&protocol.Request{Command: "frequent"})
+	}
+	for i := 0; i < maxSuggestions+10; i++ {
+		ps.Observe(&protocol.Request{Command: fmt.Sprintf("once-%d", i)})
+	}
+	report := ps.Report(0, nil)
+	if report.Total != maxSuggestions {
+		t.Errorf("collected %d commands, want at most %d", report.Total, maxSuggestions)
+	}
+	if report.Suggestions[0].Command != "frequent" || report.Suggestions[0].Count != 3 {
+		t.Errorf("most denied = %+v, want frequent kept", report.Suggestions[0])
+	}
+	if _, err := ps.Adopt("once-0", ActionAsk); err == nil {
+		t.Error("oldest single denial still collected")
+	}
+}
+
+func TestAdoptSuggestion(t *testing.T) {
+	srv := newTestServer(t)
+	srv.config.DisableDashboard = true
+	srv.setPolicy(&PolicyEngine{config: PolicyConfig{DefaultAction: ActionDeny}})
+	srv.suggestions = NewPolicySuggestions()
+	for _, args := range [][]string{{"install", "left-pad"}, {"test"}} {
+		srv.suggestions.Observe(&protocol.Request{Command: "npm", Args: args})
+	}
+	api := httptest.NewServer(NewAPIServer(srv, "127.0.0.1:0", log.New(io.Discard, "", 0)).server.Handler)
+	defer api.Close()
+
+	tests := []struct {
+		command, body string
+		wantStatus    int
+		wantYAML      string
+	}{
+		{"npm", `{"action":"ask"}`, http.StatusOK,
+			"- command: npm\n  action: ask\n  reason: Adopted after 2 default denials (e.g. npm install left-pad)\n"},
+		{"npm", `{"action":"allow"}`, http.StatusOK,
+			"- command: npm\n  action: allow\n  reason: Adopted after 2 default denials (e.g. npm install left-pad)\n"},
+		{"npm", `{"action":"deny"}`, http.StatusBadRequest, ""},
+		{"pip", `{"action":"ask"}`, http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		resp, err := http.Post(api.URL+"/api/policy/suggestions/"+tt.command, "application/json", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var adopted AdoptedSuggestion
+		if resp.StatusCode == http.StatusOK {
+			json.NewDecoder(resp.Body).Decode(&adopted)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.wantStatus || adopted.YAML != tt.wantYAML {
+			t.Errorf("%s %s: status %d, yaml %q; want %d, %q", tt.command, tt.body, resp.StatusCode, adopted.YAML, tt.wantStatus, tt.wantYAML)
+		}
+		if tt.wantYAML != "" {
+			var rules []Rule
+			if err := yaml.Unmarshal([]byte(adopted.YAML), &rules); err != nil || ValidateRules(rules) != nil {
+				t.Errorf("draft is not a valid rules list: %v", err)
+			}
+			if adopted.Rule["command"] != "npm" {
+				t.Errorf("rule fields = %v", adopted.Rule)
+			}
+		}
+	}
+
+	// Once a rule covers npm it is no longer suggested; a reset clears the rest
+	srv.suggestions.Observe(&protocol.Request{Command: "jq"})
+	srv.setPolicy(&PolicyEngine{config: PolicyConfig{DefaultAction: ActionDeny, Rules: []Rule{{Command: "npm", Action: ActionAsk}}}})
+	listed := func() []string {
+		resp, err := http.Get(api.URL + "/api/policy/suggestions")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var report SuggestionReport
+		json.NewDecoder(resp.Body).Decode(&report)
+		var commands []string
+		for _, s := range report.Suggestions {
+			commands = append(commands, s.Command)
+		}
+		return commands
+	}
+	if got := listed(); !reflect.DeepEqual(got, []string{"jq"}) {
+		t.Errorf("suggested %v, want only jq", got)
+	}
+	req, _ := http.NewRequest(http.MethodDelete, api.URL+"/api/policy/suggestions", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := listed(); resp.StatusCode != http.StatusNoContent || len(got) != 0 {
+		t.Errorf("reset: status %d, then suggested %v", resp.StatusCode, got)
+	}
+}
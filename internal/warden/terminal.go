@@ -0,0 +1,114 @@
+package warden
+
+import (
+	"clawrden/pkg/protocol"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+// terminalInputFrames is how many StreamStdin frames may wait for a command
+// to take them up. Input beyond that is dropped, so that a command that
+// never reads its stdin, such as one run in a ghost container, cannot stop
+// the monitor from noticing that the shim hung up.
+const terminalInputFrames = 256
+
+// terminalInput is the protocol.TerminalInput of a TTY request, fed by
+// monitorTerminal from the frames the shim sends while its command runs.
+type terminalInput struct {
+	input   chan []byte // StreamStdin payloads; closed when the shim ends its input
+	resize  chan protocol.WindowSize
+	done    chan struct{} // Closed once the request is handled
+	closing sync.Once
+	pending []byte
+}
+
+func newTerminalInput() *terminalInput {
+	return &terminalInput{
+		input:  make(chan []byte, terminalInputFrames),
+		resize: make(chan protocol.WindowSize, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+// TerminalInput returns what executors read the shim's input from.
+func (t *terminalInput) TerminalInput() *protocol.TerminalInput {
+	return &protocol.TerminalInput{Stdin: t, Resize: t.resize}
+}
+
+// Read returns the shim's input, and io.EOF once the shim ended it or the
+// request was handled.
+func (t *terminalInput) Read(p []byte) (int, error) {
+	for len(t.pending) == 0 {
+		select {
+		case b, ok := <-t.input:
+			if !ok {
+				return 0, io.EOF
+			}
+			t.pending = b
+		case <-t.done:
+			return 0, io.EOF
+		}
+	}
+	n := copy(p, t.pending)
+	t.pending = t.pending[n:]
+	return n, nil
+}
+
+// close ends the input for an executor still reading it.
+func (t *terminalInput) close() {
+	t.closing.Do(func() { close(t.done) })
+}
+
+// monitorTerminal is monitorCancel for a TTY request: the shim sends frames
+// rather than bytes once the request is allowed, and the terminal input
+// among them goes to term. It cancels cancel when the shim hangs up or
+// sends something that is not a frame.
+func (s *Server) monitorTerminal(conn net.Conn, cancel context.CancelFunc, term *terminalInput) {
+	inputOpen := true
+	endInput := func() {
+		if inputOpen {
+			close(term.input)
+			inputOpen = false
+		}
+	}
+	defer endInput()
+
+	for {
+		f, err := protocol.ReadFrame(conn)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				s.logger.Printf("cancel monitor: connection error: %v", err)
+			}
+			cancel()
+			return
+		}
+		switch f.Type {
+		case protocol.StreamStdin:
+			if len(f.Payload) == 0 {
+				endInput()
+				continue
+			}
+			if !inputOpen {
+				continue
+			}
+			select {
+			case term.input <- f.Payload:
+			default:
+			}
+		case protocol.StreamResize:
+			size, err := protocol.ParseResize(f)
+			if err != nil {
+				continue
+			}
+			// Only the latest size matters
+			select {
+			case <-term.resize:
+			default:
+			}
+			term.resize <- size
+		}
+	}
+}
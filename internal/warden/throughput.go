@@ -0,0 +1,260 @@
+package warden
+
+import (
+	"clawrden/internal/executor"
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// throughputInterval is how often cumulative byte counts are sampled for
+// windowed throughput reports, and throughputSamples how many samples are
+// kept; windows are as fine as the interval and as long as the samples.
+const (
+	throughputInterval = time.Minute
+	throughputSamples  = 60
+)
+
+// maxThroughputKeys bounds the command and container pairs counted
+// separately; output of further pairs is counted under "(other)".
+const maxThroughputKeys = 1000
+
+// throughputOther names the pair output is counted under once
+// maxThroughputKeys is reached.
+const throughputOther = "(other)"
+
+// defaultTopTalkers is how many commands and containers a throughput report
+// lists unless asked for more or fewer.
+const defaultTopTalkers = 10
+
+// ThroughputStats counts the stdout and stderr bytes the warden forwards to
+// shims, per command and container, for capacity planning. Requests fetch
+// their counter once; each output frame then costs one atomic add.
+type ThroughputStats struct {
+	mu       sync.Mutex
+	keys     map[throughputKey]int // Index into counters
+	counters []throughputCounter
+	samples  []throughputSample // Oldest first, at most throughputSamples
+	baseline throughputSample   // Counts at the last resetting read
+	start    time.Time
+	now      func() time.Time
+}
+
+type throughputKey struct {
+	command   string
+	container string // "" for requests from the host
+}
+
+type throughputCounter struct {
+	key    throughputKey
+	stream *executor.StreamCounter
+}
+
+// throughputSample holds every counter's cumulative counts at one time,
+// indexed as ThroughputStats.counters.
+type throughputSample struct {
+	at     time.Time
+	counts []byteCounts
+}
+
+type byteCounts struct {
+	stdout, stderr int64
+}
+
+// ThroughputReport is the output forwarded between Since and Until, in all
+// and by the commands and containers that forwarded the most.
+type ThroughputReport struct {
+	Since       time.Time     `json:"since"`
+	Until       time.Time     `json:"until"`
+	StdoutBytes int64         `json:"stdout_bytes"`
+	StderrBytes int64         `json:"stderr_bytes"`
+	Commands    []TalkerStats `json:"top_commands"`
+	Containers  []TalkerStats `json:"top_containers"` // "host" for requests from the host
+}
+
+// TalkerStats is the output one command or container forwarded.
+type TalkerStats struct {
+	Name        string `json:"name"`
+	StdoutBytes int64  `json:"stdout_bytes"`
+	StderrBytes int64  `json:"stderr_bytes"`
+	TotalBytes  int64  `json:"total_bytes"`
+}
+
+// NewThroughputStats returns empty throughput counters.
+func NewThroughputStats() *ThroughputStats {
+	return &ThroughputStats{
+		keys:  make(map[throughputKey]int),
+		start: time.Now(),
+		now:   time.Now,
+	}
+}
+
+// Counter returns the counter of command's output in container ("" for the
+// host), for executor.DeliveryConn.CountInto. It is nil on a nil receiver.
+func (t *ThroughputStats) Counter(command, container string) *executor.StreamCounter {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := throughputKey{command: command, container: container}
+	i, ok := t.keys[key]
+	if !ok && len(t.counters) >= maxThroughputKeys {
+		key = throughputKey{command: throughputOther, container: throughputOther}
+		i, ok = t.keys[key]
+	}
+	if !ok {
+		i = len(t.counters)
+		t.keys[key] = i
+		t.counters = append(t.counters, throughputCounter{key: key, stream: &executor.StreamCounter{}})
+	}
+	return t.counters[i].stream
+}
+
+// Run samples the counters every interval until ctx is done, for windowed
+// reports.
+func (t *ThroughputStats) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.Sample()
+		}
+	}
+}
+
+// Sample records the current counts for windowed reports.
+func (t *ThroughputStats) Sample() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.samples = append(t.samples, t.current())
+	if over := len(t.samples) - throughputSamples; over > 0 {
+		t.samples = append(t.samples[:0], t.samples[over:]...)
+	}
+}
+
+// Report returns the top talkers since the warden started.
+func (t *ThroughputStats) Report(top int) ThroughputReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.report(throughputSample{at: t.start}, t.current(), top)
+}
+
+// ReportWindow returns the top talkers over about the last window: from
+// the newest sample at least window old, or the oldest sample kept.
+func (t *ThroughputStats) ReportWindow(window time.Duration, top int) ThroughputReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.current()
+	from := throughputSample{at: t.start}
+	if len(t.samples) == throughputSamples {
+		from = t.samples[0]
+	}
+	for _, s := range t.samples {
+		if s.at.After(now.at.Add(-window)) {
+			break
+		}
+		from = s
+	}
+	return t.report(from, now, top)
+}
+
+// ReportAndReset returns the top talkers since the last ReportAndReset (or
+// since the warden started) and starts counting afresh for the next one.
+// Other reports are unaffected.
+func (t *ThroughputStats) ReportAndReset(top int) ThroughputReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	from := t.baseline
+	if from.at.IsZero() {
+		from.at = t.start
+	}
+	now := t.current()
+	t.baseline = now
+	return t.report(from, now, top)
+}
+
+// Totals returns the bytes forwarded since the warden started.
+func (t *ThroughputStats) Totals() (stdout, stderr int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, c := range t.counters {
+		stdout += c.stream.Stdout.Load()
+		stderr += c.stream.Stderr.Load()
+	}
+	return stdout, stderr
+}
+
+// current samples the counters now. The caller holds t.mu.
+func (t *ThroughputStats) current() throughputSample {
+	s := throughputSample{at: t.now(), counts: make([]byteCounts, len(t.counters))}
+	for i, c := range t.counters {
+		s.counts[i] = byteCounts{stdout: c.stream.Stdout.Load(), stderr: c.stream.Stderr.Load()}
+	}
+	return s
+}
+
+// report sums what was forwarded between two samples. The caller holds t.mu.
+func (t *ThroughputStats) report(from, to throughputSample, top int) ThroughputReport {
+	r := ThroughputReport{Since: from.at, Until: to.at}
+	commands := map[string]*TalkerStats{}
+	containers := map[string]*TalkerStats{}
+	add := func(m map[string]*TalkerStats, name string, d byteCounts) {
+		ts, ok := m[name]
+		if !ok {
+			ts = &TalkerStats{Name: name}
+			m[name] = ts
+		}
+		ts.StdoutBytes += d.stdout
+		ts.StderrBytes += d.stderr
+		ts.TotalBytes += d.stdout + d.stderr
+	}
+
+	for i, c := range to.counts {
+		d := c
+		if i < len(from.counts) {
+			d.stdout -= from.counts[i].stdout
+			d.stderr -= from.counts[i].stderr
+		}
+		if d.stdout == 0 && d.stderr == 0 {
+			continue
+		}
+		r.StdoutBytes += d.stdout
+		r.StderrBytes += d.stderr
+		key := t.counters[i].key
+		container := key.container
+		if container == "" {
+			container = "host"
+		}
+		add(commands, key.command, d)
+		add(containers, container, d)
+	}
+	r.Commands = topTalkers(commands, top)
+	r.Containers = topTalkers(containers, top)
+	return r
+}
+
+// topTalkers returns the top entries of m by total bytes, then name.
+func topTalkers(m map[string]*TalkerStats, top int) []TalkerStats {
+	talkers := make([]TalkerStats, 0, len(m))
+	for _, ts := range m {
+		talkers = append(talkers, *ts)
+	}
+	sort.Slice(talkers, func(i, j int) bool {
+		if talkers[i].TotalBytes != talkers[j].TotalBytes {
+			return talkers[i].TotalBytes > talkers[j].TotalBytes
+		}
+		return talkers[i].Name < talkers[j].Name
+	})
+	if top > 0 && len(talkers) > top {
+		talkers = talkers[:top]
+	}
+	return talkers
+}
@@ -0,0 +1,144 @@
+package warden
+
+import (
+	"clawrden/pkg/protocol"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThroughputCountsLocalCommands(t *testing.T) {
+	srv, _ := newMaintenanceTestServer(t, []Rule{
+		{Command: "head", Action: ActionAllow},
+		{Command: "sh", Action: ActionAllow},
+	})
+	srv.throughput = NewThroughputStats()
+
+	// 16-byte lines, since the local executor forwards output line by line
+	lines := filepath.Join(t.TempDir(), "lines")
+	writeTestFile(t, lines, strings.Repeat("0123456789abcde\n", 500))
+	requests := []*protocol.Request{
+		{Command: "head", Args: []string{"-n", "200", lines}, Cwd: "/"},
+		{Command: "head", Args: []string{"-n", "50", lines}, Cwd: "/"},
+		{Command: "sh", Args: []string{"-c", "head -n 10 " + lines + "; head -n 20 " + lines + " >&2"}, Cwd: "/"},
+	}
+	for _, req := range requests {
+		if ack, reason := sendRequest(t, srv, req); ack != protocol.AckAllowed {
+			t.Fatalf("%s: ack %d (%s)", req.Command, ack, reason)
+		}
+	}
+
+	report := srv.throughput.Report(1)
+	if report.StdoutBytes != 4160 || report.StderrBytes != 320 {
+		t.Errorf("totals = %d stdout, %d stderr; want 4160, 320", report.StdoutBytes, report.StderrBytes)
+	}
+	if len(report.Commands) != 1 || report.Commands[0] != (TalkerStats{Name: "head", StdoutBytes: 4000, TotalBytes: 4000}) {
+		t.Errorf("top commands = %+v, want head with 4000 bytes", report.Commands)
+	}
+	if len(report.Containers) != 1 || report.Containers[0].Name != "host" || report.Containers[0].TotalBytes != 4480 {
+		t.Errorf("top containers = %+v, want host with 4480 bytes", report.Containers)
+	}
+	if stdout, stderr := srv.throughput.Totals(); stdout != 4160 || stderr != 320 {
+		t.Errorf("Totals() = %d, %d", stdout, stderr)
+	}
+}
+
+func TestThroughputWindowAndReset(t *testing.T) {
+	stats := NewThroughputStats()
+	now := stats.start
+	stats.now = func() time.Time { return now }
+
+	stats.Counter("npm", "c1").Stdout.Add(100)
+	stats.Counter("npm", "c2").Stderr.Add(50)
+	now = now.Add(time.Minute)
+	stats.Sample()
+	stats.Counter("npm", "c1").Stdout.Add(10)
+	stats.Counter("git", "").Stdout.Add(5)
+	now = now.Add(time.Minute)
+
+	all := stats.Report(0)
+	if all.StdoutBytes != 115 || all.StderrBytes != 50 || len(all.Commands) != 2 || all.Commands[0].Name != "npm" {
+		t.Errorf("report = %+v", all)
+	}
+	if len(all.Containers) != 3 || all.Containers[0] != (TalkerStats{Name: "c1", StdoutBytes: 110, TotalBytes: 110}) {
+		t.Errorf("containers = %+v", all.Containers)
+	}
+
+	// The last minute starts at the sample
+	window := stats.ReportWindow(time.Minute, 0)
+	if window.StdoutBytes != 15 || window.StderrBytes != 0 || !window.Since.Equal(stats.start.Add(time.Minute)) {
+		t.Errorf("window report = %+v", window)
+	}
+	if window := stats.ReportWindow(time.Hour, 0); window.StdoutBytes != 115 {
+		t.Errorf("hour window = %d bytes, want 115", window.StdoutBytes)
+	}
+
+	// Resetting reads count from one to the next; other reports keep counting
+	if first := stats.ReportAndReset(0); first.StdoutBytes != 115 {
+		t.Errorf("first reset read = %d bytes, want 115", first.StdoutBytes)
+	}
+	stats.Counter("git", "").Stdout.Add(7)
+	if second := stats.ReportAndReset(0); second.StdoutBytes != 7 || len(second.Commands) != 1 || second.Commands[0].Name != "git" {
+		t.Errorf("second reset read = %+v", second)
+	}
+	if total := stats.Report(0); total.StdoutBytes != 122 {
+		t.Errorf("report after resets = %d bytes, want 122", total.StdoutBytes)
+	}
+}
+
+func TestThroughputKeyLimit(t *testing.T) {
+	stats := NewThroughputStats()
+	for i := 0; i < maxThroughputKeys; i++ {
+		stats.Counter("cmd", fmt.Sprint("c", i))
+	}
+	stats.Counter("one-more", "c").Stdout.Add(1)
+	stats.Counter("and-another", "c").Stdout.Add(1)
+	report := stats.Report(1)
+	if len(report.Commands) != 1 || report.Commands[0] != (TalkerStats{Name: throughputOther, StdoutBytes: 2, TotalBytes: 2}) {
+		t.Errorf("top commands = %+v, want both counted as %s", report.Commands, throughputOther)
+	}
+}
+
+func TestThroughputAPI(t *testing.T) {
+	srv := newTestServer(t)
+	srv.config.DisableDashboard = true
+	srv.throughput = NewThroughputStats()
+	srv.throughput.Counter("npm", "c1").Stdout.Add(42)
+	api := httptest.NewServer(NewAPIServer(srv, "127.0.0.1:0", log.New(io.Discard, "", 0)).server.Handler)
+	defer api.Close()
+
+	tests := []struct {
+		query      string
+		wantStatus int
+		wantBytes  int64
+	}{
+		{"", http.StatusOK, 42},
+		{"?top=1&window=5m", http.StatusOK, 42},
+		{"?reset=true", http.StatusOK, 42},
+		{"?reset=true", http.StatusOK, 0},
+		{"?window=5m&reset=true", http.StatusBadRequest, 0},
+		{"?window=soon", http.StatusBadRequest, 0},
+		{"?top=0", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(api.URL + "/api/stats/throughput" + tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var report ThroughputReport
+		if resp.StatusCode == http.StatusOK {
+			json.NewDecoder(resp.Body).Decode(&report)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.wantStatus || report.StdoutBytes != tt.wantBytes {
+			t.Errorf("%s: status %d, %d bytes; want %d, %d", tt.query, resp.StatusCode, report.StdoutBytes, tt.wantStatus, tt.wantBytes)
+		}
+	}
+}
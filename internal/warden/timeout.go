@@ -0,0 +1,76 @@
+package warden
+
+import (
+	"clawrden/pkg/protocol"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeoutEnvVar holds a command's timeout in whole seconds (rounded up).
+const timeoutEnvVar = "CLAWRDEN_TIMEOUT_SECONDS"
+
+// TimeoutExitCode is the exit code of a command stopped by its time limit,
+// as timeout(1) reports it, so agents can tell it from the command failing.
+const TimeoutExitCode = 124
+
+// timeoutMessage tells the agent which limit stopped its command: limit
+// names it (TimeoutLimitExec or TimeoutLimitTotal), d is its configured
+// length and rule the rule that decided the request, if one did.
+func timeoutMessage(limit string, d time.Duration, rule string) string {
+	kind := "time limit"
+	if limit == TimeoutLimitTotal {
+		kind = "total time limit"
+	}
+	source := "the policy's defaults"
+	if rule != "" {
+		source = fmt.Sprintf("policy rule '%s'", rule)
+	}
+	seconds := strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+	return fmt.Sprintf("clawrden: command exceeded the %s-second %s set by %s\n", seconds, kind, source)
+}
+
+// timeoutWarnAt is the fraction of the timeout after which the command is
+// warned that it is about to be stopped.
+const timeoutWarnAt = 0.8
+
+// withTimeoutEnv returns env with timeoutEnvVar set to timeout, replacing
+// any value the agent passed in.
+func withTimeoutEnv(env []string, timeout time.Duration) []string {
+	out := make([]string, 0, len(env)+1)
+	for _, kv := range env {
+		if !strings.HasPrefix(kv, timeoutEnvVar+"=") {
+			out = append(out, kv)
+		}
+	}
+	seconds := int64(math.Ceil(timeout.Seconds()))
+	return append(out, timeoutEnvVar+"="+strconv.FormatInt(seconds, 10))
+}
+
+// startTimeoutWarning writes a stderr frame to w once timeoutWarnAt of the
+// timeout has elapsed. The returned function cancels the warning if it has
+// not been sent yet.
+func startTimeoutWarning(w io.Writer, timeout time.Duration) (stop func()) {
+	warnAfter := time.Duration(float64(timeout) * timeoutWarnAt)
+	timer := time.AfterFunc(warnAfter, func() {
+		msg := fmt.Sprintf("clawrden: warning: %s of the %s time limit used; the command will be stopped in %s\n",
+			formatLimit(warnAfter), formatLimit(timeout), formatLimit(timeout-warnAfter))
+		protocol.WriteFrame(w, protocol.Frame{Type: protocol.StreamStderr, Payload: []byte(msg)})
+	})
+	return func() { timer.Stop() }
+}
+
+// formatLimit renders a duration without trailing zero units ("5m", not "5m0s").
+func formatLimit(d time.Duration) string {
+	s := d.Round(time.Millisecond).String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
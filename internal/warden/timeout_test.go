@@ -0,0 +1,278 @@
+package warden
+
+import (
+	"bytes"
+	"clawrden/pkg/protocol"
+	"io"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWithTimeoutEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     []string
+		timeout time.Duration
+		want    []string
+	}{
+		{"appended", []string{"PATH=/bin"}, 5 * time.Minute, []string{"PATH=/bin", "CLAWRDEN_TIMEOUT_SECONDS=300"}},
+		{"rounded up", nil, 1500 * time.Millisecond, []string{"CLAWRDEN_TIMEOUT_SECONDS=2"}},
+		{"agent value replaced", []string{"CLAWRDEN_TIMEOUT_SECONDS=99999", "HOME=/root"}, 30 * time.Second, []string{"HOME=/root", "CLAWRDEN_TIMEOUT_SECONDS=30"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withTimeoutEnv(tt.env, tt.timeout); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("withTimeoutEnv = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// frameRecorder records frames and when they were written.
+type frameRecorder struct {
+	mu     sync.Mutex
+	frames []protocol.Frame
+	at     []time.Time
+}
+
+func (r *frameRecorder) Write(b []byte) (int, error) {
+	frame, err := protocol.ReadFrame(bytes.NewReader(b))
+	if err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.frames = append(r.frames, frame)
+	r.at = append(r.at, time.Now())
+	return len(b), nil
+}
+
+func (r *frameRecorder) snapshot() ([]protocol.Frame, []time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]protocol.Frame(nil), r.frames...), append([]time.Time(nil), r.at...)
+}
+
+func TestTimeoutWarningTiming(t *testing.T) {
+	const timeout = 250 * time.Millisecond
+	var rec frameRecorder
+	start := time.Now()
+	stop := startTimeoutWarning(&rec, timeout)
+	defer stop()
+
+	time.Sleep(150 * time.Millisecond) // 60%
+	if frames, _ := rec.snapshot(); len(frames) != 0 {
+		t.Fatalf("warning sent before 80%% of the timeout: %q", frames[0].Payload)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		frames, at := rec.snapshot()
+		if len(frames) == 1 {
+			if frames[0].Type != protocol.StreamStderr {
+				t.Errorf("frame type = %d, want stderr", frames[0].Type)
+			}
+			if !strings.Contains(string(frames[0].Payload), "200ms of the 250ms time limit used") {
+				t.Errorf("warning = %q", frames[0].Payload)
+			}
+			if elapsed := at[0].Sub(start); elapsed < 200*time.Millisecond {
+				t.Errorf("warning after %v, want >= 200ms", elapsed)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no warning sent")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTimeoutWarningStopped(t *testing.T) {
+	var rec frameRecorder
+	stop := startTimeoutWarning(&rec, 50*time.Millisecond)
+	stop()
+	time.Sleep(100 * time.Millisecond)
+	if frames, _ := rec.snapshot(); len(frames) != 0 {
+		t.Errorf("warning sent after stop: %q", frames[0].Payload)
+	}
+}
+
+func TestFormatLimit(t *testing.T) {
+	tests := map[time.Duration]string{
+		5 * time.Minute:                "5m",
+		time.Hour:                      "1h",
+		90 * time.Minute:               "1h30m",
+		45 * time.Second:               "45s",
+		1500 * time.Millisecond:        "1.5s",
+		2*time.Minute + 30*time.Second: "2m30s",
+		time.Hour + 5*time.Second:      "1h0m5s",
+	}
+	for d, want := range tests {
+		if got := formatLimit(d); got != want {
+			t.Errorf("formatLimit(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestRuleTimeouts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writeTestFile(t, path, `
+default_action: deny
+default_timeout: 1m
+default_hitl_timeout: 10m
+rules:
+  - command: make
+    action: allow
+    exec_timeout: 5m
+    hitl_timeout: 2m
+    total_timeout: 6m
+  - command: npm
+    action: allow
+    timeout: 3m
+  - command: ls
+    action: allow
+`)
+	pe, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+	tests := []struct {
+		command             string
+		exec, review, total time.Duration
+	}{
+		{"make", 5 * time.Minute, 2 * time.Minute, 6 * time.Minute},
+		{"npm", 3 * time.Minute, 10 * time.Minute, 0}, // timeout is exec_timeout
+		{"ls", time.Minute, 10 * time.Minute, 0},
+		{"rm", time.Minute, 10 * time.Minute, 0}, // No rule matched
+	}
+	for _, tt := range tests {
+		r := pe.Evaluate(&protocol.Request{Command: tt.command})
+		if r.ExecTimeout != tt.exec || r.HITLTimeout != tt.review || r.TotalTimeout != tt.total {
+			t.Errorf("%s: limits = %v/%v/%v, want %v/%v/%v", tt.command,
+				r.ExecTimeout, r.HITLTimeout, r.TotalTimeout, tt.exec, tt.review, tt.total)
+		}
+	}
+}
+
+// TestTimeoutLimitFired runs requests that each outlive one limit and checks
+// that the audit entry names it.
+func TestTimeoutLimitFired(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		args []string
+		want string
+	}{
+		{"exec", Rule{Command: "sleep", Action: ActionAllow, ExecTimeout: 100 * time.Millisecond, HITLTimeout: time.Minute, TotalTimeout: time.Minute}, []string{"10"}, TimeoutLimitExec},
+		{"timeout alias", Rule{Command: "sleep", Action: ActionAllow, Timeout: 100 * time.Millisecond}, []string{"10"}, TimeoutLimitExec},
+		{"total while running", Rule{Command: "sleep", Action: ActionAllow, ExecTimeout: time.Minute, TotalTimeout: 100 * time.Millisecond}, []string{"10"}, TimeoutLimitTotal},
+		{"hitl", Rule{Command: "sleep", Action: ActionAsk, HITLTimeout: 100 * time.Millisecond, TotalTimeout: time.Minute}, []string{"10"}, TimeoutLimitHITL},
+		{"total while pending", Rule{Command: "sleep", Action: ActionAsk, HITLTimeout: time.Minute, TotalTimeout: 100 * time.Millisecond}, []string{"10"}, TimeoutLimitTotal},
+		{"none", Rule{Command: "true", Action: ActionAllow, ExecTimeout: time.Minute, TotalTimeout: time.Minute}, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, audited := newMaintenanceTestServer(t, []Rule{tt.rule})
+			client, server := net.Pipe()
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				srv.handleConnection(server)
+			}()
+			if err := protocol.WriteRequest(client, &protocol.Request{Command: tt.rule.Command, Args: tt.args, Cwd: "/"}); err != nil {
+				t.Fatalf("write request: %v", err)
+			}
+			start := time.Now()
+			io.Copy(io.Discard, client) // The warden closes the connection when done
+			client.Close()
+			<-done
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("request took %v; the limit did not stop it", elapsed)
+			}
+
+			entries := audited()
+			if len(entries) != 1 {
+				t.Fatalf("audited %d entries, want 1", len(entries))
+			}
+			e := entries[0]
+			if e.TimeoutLimit != tt.want {
+				t.Errorf("timeout_limit = %q, want %q (decision %q, error %q)", e.TimeoutLimit, tt.want, e.DecisionLabel(), e.Error)
+			}
+			if running := tt.rule.Action == ActionAllow && tt.want != ""; e.TimeoutViolation != running {
+				t.Errorf("timeout_violation = %v, want %v", e.TimeoutViolation, running)
+			}
+		})
+	}
+}
+
+func TestTimeoutMessage(t *testing.T) {
+	tests := []struct {
+		limit string
+		d     time.Duration
+		rule  string
+		want  string
+	}{
+		{TimeoutLimitExec, 30 * time.Second, "rule 2 (npm)", "clawrden: command exceeded the 30-second time limit set by policy rule 'rule 2 (npm)'\n"},
+		{TimeoutLimitTotal, 1500 * time.Millisecond, "jail ci rule 1 (make)", "clawrden: command exceeded the 1.5-second total time limit set by policy rule 'jail ci rule 1 (make)'\n"},
+		{TimeoutLimitExec, 2 * time.Minute, "", "clawrden: command exceeded the 120-second time limit set by the policy's defaults\n"},
+	}
+	for _, tt := range tests {
+		if got := timeoutMessage(tt.limit, tt.d, tt.rule); got != tt.want {
+			t.Errorf("timeoutMessage(%s, %v, %q) = %q, want %q", tt.limit, tt.d, tt.rule, got, tt.want)
+		}
+	}
+}
+
+// TestTimeoutDeliversOutputThenExit124 checks that a command killed by its
+// limit has its earlier output delivered, then the limit's message and exit
+// code 124.
+func TestTimeoutDeliversOutputThenExit124(t *testing.T) {
+	srv, audited := newMaintenanceTestServer(t, []Rule{{Command: "sh", Action: ActionAllow, ExecTimeout: 300 * time.Millisecond}})
+	client, server := net.Pipe()
+	defer client.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.handleConnection(server)
+	}()
+	if err := protocol.WriteRequest(client, &protocol.Request{Command: "sh", Args: []string{"-c", "echo started; exec sleep 10"}, Cwd: "/"}); err != nil {
+		t.Fatalf("write request: %v", err)
+	}
+	if ack, err := protocol.ReadAck(client); err != nil || ack != protocol.AckAllowed {
+		t.Fatalf("ack = %d, %v", ack, err)
+	}
+
+	var got []string
+	exit := -1
+	for exit < 0 {
+		f, err := protocol.ReadFrame(client)
+		if err != nil {
+			t.Fatalf("read frame after %q: %v", got, err)
+		}
+		switch f.Type {
+		case protocol.StreamStdout, protocol.StreamStderr:
+			got = append(got, string(f.Payload))
+		case protocol.StreamExit:
+			exit = protocol.ParseExitCode(f)
+		}
+	}
+	want := []string{"started\n", "clawrden: command exceeded the 0.3-second time limit set by policy rule 'rule 1 (sh)'\n"}
+	if !reflect.DeepEqual(got, want) || exit != TimeoutExitCode {
+		t.Errorf("output %q, exit %d; want %q, exit %d", got, exit, want, TimeoutExitCode)
+	}
+
+	client.Close()
+	<-done
+	entries := audited()
+	if len(entries) != 1 {
+		t.Fatalf("audited %d entries, want 1", len(entries))
+	}
+	if e := entries[0]; e.ExitCode != TimeoutExitCode || !e.TimeoutViolation || e.Error != "exec timeout exceeded (300ms)" {
+		t.Errorf("audited exit %d, timeout_violation %v, error %q", e.ExitCode, e.TimeoutViolation, e.Error)
+	}
+}
@@ -0,0 +1,251 @@
+package warden
+
+import (
+	"bufio"
+	"clawrden/pkg/protocol"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultTranscriptDir holds transcripts when Config.TranscriptDir is unset.
+const defaultTranscriptDir = "/var/lib/clawrden/transcripts"
+
+// transcriptPayloadCap bounds the payload bytes kept per transcript record.
+const transcriptPayloadCap = 4096
+
+// transcriptQueueSize is how many records may wait for the writer goroutine.
+const transcriptQueueSize = 256
+
+// Transcript record directions.
+const (
+	TranscriptIn  = "in"  // Shim to warden
+	TranscriptOut = "out" // Warden to shim
+)
+
+// ErrTranscriptNotFound is returned for a request without a saved transcript.
+var ErrTranscriptNotFound = errors.New("transcript not found")
+
+// TranscriptRecord is one message of a recorded shim conversation.
+type TranscriptRecord struct {
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"`
+	Type      string    `json:"type"`              // request, ack, stdout, stderr, exit, cancel, meta, data
+	Size      int       `json:"size"`              // Bytes on the wire, including headers
+	Payload   []byte    `json:"payload,omitempty"` // Message body, up to transcriptPayloadCap bytes
+	Truncated bool      `json:"truncated,omitempty"`
+}
+
+// frameTypeNames names the stream types in transcripts.
+var frameTypeNames = map[byte]string{
+	protocol.StreamStdout: "stdout",
+	protocol.StreamStderr: "stderr",
+	protocol.StreamExit:   "exit",
+	protocol.StreamCancel: "cancel",
+	protocol.StreamMeta:   "meta",
+}
+
+// transcriptRecorder writes a conversation to a file in the background.
+// Recording only copies the payload and queues it; a goroutine encodes and
+// writes through a buffered writer, so executors never wait on the disk.
+type transcriptRecorder struct {
+	dir     string
+	file    *os.File
+	records chan TranscriptRecord
+	stop    chan struct{}
+	done    chan struct{}
+	err     error // First write error; read after done is closed
+}
+
+// newTranscriptRecorder starts recording to a temporary file in dir.
+func newTranscriptRecorder(dir string) (*transcriptRecorder, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("create transcript directory: %w", err)
+	}
+	f, err := os.CreateTemp(dir, ".recording-*")
+	if err != nil {
+		return nil, fmt.Errorf("create transcript: %w", err)
+	}
+	r := &transcriptRecorder{
+		dir:     dir,
+		file:    f,
+		records: make(chan TranscriptRecord, transcriptQueueSize),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go r.run()
+	return r, nil
+}
+
+// run encodes queued records until stop, then drains the queue and flushes.
+func (r *transcriptRecorder) run() {
+	defer close(r.done)
+	w := bufio.NewWriter(r.file)
+	enc := json.NewEncoder(w)
+	write := func(rec TranscriptRecord) {
+		if err := enc.Encode(rec); err != nil && r.err == nil {
+			r.err = err
+		}
+	}
+	for {
+		select {
+		case rec := <-r.records:
+			write(rec)
+		case <-r.stop:
+			for {
+				select {
+				case rec := <-r.records:
+					write(rec)
+				default:
+					if err := w.Flush(); err != nil && r.err == nil {
+						r.err = err
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+// record queues one message. Messages recorded after finish are dropped.
+func (r *transcriptRecorder) record(direction, typ string, size int, payload []byte) {
+	rec := TranscriptRecord{Time: time.Now(), Direction: direction, Type: typ, Size: size}
+	if len(payload) > transcriptPayloadCap {
+		payload = payload[:transcriptPayloadCap]
+		rec.Truncated = true
+	}
+	rec.Payload = append([]byte(nil), payload...)
+	select {
+	case r.records <- rec:
+	case <-r.done:
+	}
+}
+
+// recordRequest records the raw bytes of a length-prefixed request message.
+func (r *transcriptRecorder) recordRequest(raw []byte) {
+	body := raw
+	if len(body) >= 4 {
+		body = body[4:]
+	}
+	r.record(TranscriptIn, "request", len(raw), body)
+}
+
+// recordWrite records one write to the shim. protocol.WriteFrame and
+// protocol.WriteAck issue a single Write each, so a write is a whole message.
+func (r *transcriptRecorder) recordWrite(b []byte) {
+	switch {
+	case len(b) == 1:
+		r.record(TranscriptOut, "ack", 1, b)
+	case len(b) >= protocol.FrameHeaderSize && frameTypeNames[b[0]] != "":
+		r.record(TranscriptOut, frameTypeNames[b[0]], len(b), b[protocol.FrameHeaderSize:])
+	default:
+		r.record(TranscriptOut, "data", len(b), b)
+	}
+}
+
+// wrap returns conn with every write recorded.
+func (r *transcriptRecorder) wrap(conn net.Conn) net.Conn {
+	return &transcriptConn{Conn: conn, rec: r}
+}
+
+// finish stops recording. A kept transcript is saved as <id>.jsonl and its
+// path returned; otherwise the recording is deleted.
+func (r *transcriptRecorder) finish(keep bool, id string) (string, error) {
+	close(r.stop)
+	<-r.done
+	err := r.err
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	if !keep || err != nil {
+		os.Remove(r.file.Name())
+		return "", err
+	}
+	path := filepath.Join(r.dir, id+".jsonl")
+	if err := os.Rename(r.file.Name(), path); err != nil {
+		os.Remove(r.file.Name())
+		return "", err
+	}
+	return path, nil
+}
+
+// transcriptConn records what the warden writes to the shim.
+type transcriptConn struct {
+	net.Conn
+	rec *transcriptRecorder
+}
+
+func (c *transcriptConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.rec.recordWrite(b)
+	return n, err
+}
+
+// transcriptDir returns the directory transcripts are saved in.
+func (s *Server) transcriptDir() string {
+	if s.config.TranscriptDir != "" {
+		return s.config.TranscriptDir
+	}
+	return defaultTranscriptDir
+}
+
+// startTranscript begins recording a request's conversation, starting with
+// the raw request it sent. It returns nil if the recording cannot be created.
+func (s *Server) startTranscript(rawRequest []byte) *transcriptRecorder {
+	rec, err := newTranscriptRecorder(s.transcriptDir())
+	if err != nil {
+		s.logger.Printf("warning: transcript disabled for this request: %v", err)
+		return nil
+	}
+	rec.recordRequest(rawRequest)
+	return rec
+}
+
+// saveTranscript finishes a recording, keeping it if keep is set and
+// referencing it from the audit entry. Requests that were not queued get a
+// request ID so the transcript can be looked up.
+func (s *Server) saveTranscript(rec *transcriptRecorder, entry *AuditEntry, keep bool) {
+	if rec == nil {
+		return
+	}
+	if keep && entry.RequestID == "" {
+		entry.RequestID = newID("req", time.Now())
+	}
+	path, err := rec.finish(keep, entry.RequestID)
+	if err != nil {
+		s.logger.Printf("warning: failed to save transcript for %s: %v", entry.Command, err)
+		return
+	}
+	entry.Transcript = path
+}
+
+// ReadTranscript returns the saved transcript of a request.
+func (s *Server) ReadTranscript(requestID string) ([]TranscriptRecord, error) {
+	if requestID == "" || filepath.Base(requestID) != requestID || strings.HasPrefix(requestID, ".") {
+		return nil, fmt.Errorf("%w: %q", ErrTranscriptNotFound, requestID)
+	}
+	f, err := os.Open(filepath.Join(s.transcriptDir(), requestID+".jsonl"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrTranscriptNotFound, requestID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []TranscriptRecord
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var rec TranscriptRecord
+		if err := dec.Decode(&rec); err != nil {
+			return nil, fmt.Errorf("decode transcript %s: %w", requestID, err)
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
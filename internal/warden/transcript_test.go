@@ -0,0 +1,160 @@
+package warden
+
+import (
+	"bytes"
+	"clawrden/pkg/protocol"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTranscriptRecordsConversation(t *testing.T) {
+	srv := newTestServer(t)
+	srv.config.TranscriptDir = t.TempDir()
+
+	// The request as the shim sent it
+	var raw bytes.Buffer
+	req := &protocol.Request{Command: "npm", Args: []string{"install"}, Cwd: "/app"}
+	if err := protocol.WriteRequest(&raw, req); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := srv.startTranscript(raw.Bytes())
+	if rec == nil {
+		t.Fatal("startTranscript failed")
+	}
+	client, server := net.Pipe()
+	defer client.Close()
+	conn := rec.wrap(server)
+	go io.Copy(io.Discard, client)
+
+	protocol.WriteAck(conn, protocol.AckAllowed)
+	protocol.WriteMetadata(conn, &protocol.ExecMetadata{TimeoutSeconds: 30})
+	protocol.WriteFrame(conn, protocol.Frame{Type: protocol.StreamStdout, Payload: []byte("added 1 package\n")})
+	protocol.WriteFrame(conn, protocol.Frame{Type: protocol.StreamStderr, Payload: bytes.Repeat([]byte("x"), transcriptPayloadCap+10)})
+	protocol.WriteExitCode(conn, 3)
+	server.Close()
+
+	entry := AuditEntry{Command: "npm"}
+	srv.saveTranscript(rec, &entry, true)
+	if entry.RequestID == "" || entry.Transcript != filepath.Join(srv.config.TranscriptDir, entry.RequestID+".jsonl") {
+		t.Fatalf("audit entry = %+v, want a request ID and transcript path", entry)
+	}
+
+	records, err := srv.ReadTranscript(entry.RequestID)
+	if err != nil {
+		t.Fatalf("ReadTranscript: %v", err)
+	}
+	want := []struct {
+		direction, typ string
+		size           int
+		payload        string
+	}{
+		{TranscriptIn, "request", raw.Len(), raw.String()[4:]},
+		{TranscriptOut, "ack", 1, "\x00"},
+		{TranscriptOut, "meta", protocol.FrameHeaderSize + len(`{"timeout_seconds":30}`), `{"timeout_seconds":30}`},
+		{TranscriptOut, "stdout", protocol.FrameHeaderSize + 16, "added 1 package\n"},
+		{TranscriptOut, "stderr", protocol.FrameHeaderSize + transcriptPayloadCap + 10, strings.Repeat("x", transcriptPayloadCap)},
+		{TranscriptOut, "exit", protocol.FrameHeaderSize + 4, "\x00\x00\x00\x03"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %d records, want %d: %+v", len(records), len(want), records)
+	}
+	for i, w := range want {
+		r := records[i]
+		if r.Direction != w.direction || r.Type != w.typ || r.Size != w.size || string(r.Payload) != w.payload {
+			t.Errorf("record %d = %s %s %d %.40q, want %s %s %d %.40q",
+				i, r.Direction, r.Type, r.Size, r.Payload, w.direction, w.typ, w.size, w.payload)
+		}
+		if r.Truncated != (w.typ == "stderr") {
+			t.Errorf("record %d truncated = %v", i, r.Truncated)
+		}
+	}
+}
+
+func TestTranscriptDiscardedUnlessKept(t *testing.T) {
+	srv := newTestServer(t)
+	srv.config.TranscriptDir = t.TempDir()
+
+	rec := srv.startTranscript([]byte("\x00\x00\x00\x02{}"))
+	rec.recordWrite([]byte{protocol.AckAllowed})
+	entry := AuditEntry{Command: "ls"}
+	srv.saveTranscript(rec, &entry, false)
+
+	if entry.RequestID != "" || entry.Transcript != "" {
+		t.Errorf("audit entry = %+v, want no transcript", entry)
+	}
+	files, _ := os.ReadDir(srv.config.TranscriptDir)
+	if len(files) != 0 {
+		t.Errorf("transcript directory has %d files, want none", len(files))
+	}
+
+	// Late writes, such as a timeout warning racing the end, are dropped
+	rec.recordWrite([]byte{protocol.AckDenied})
+}
+
+func TestReadTranscriptRejectsPaths(t *testing.T) {
+	srv := newTestServer(t)
+	srv.config.TranscriptDir = t.TempDir()
+	writeTestFile(t, filepath.Join(srv.config.TranscriptDir, "..", "secret.jsonl"), "{}\n")
+
+	for _, id := range []string{"", "../secret", ".recording-1", "req-missing"} {
+		if _, err := srv.ReadTranscript(id); !errors.Is(err, ErrTranscriptNotFound) {
+			t.Errorf("ReadTranscript(%q) error = %v, want ErrTranscriptNotFound", id, err)
+		}
+	}
+}
+
+func TestTranscriptAPI(t *testing.T) {
+	api, _ := newTestAPIServer(t, Config{})
+	api.warden.config.TranscriptDir = t.TempDir()
+	rec := api.warden.startTranscript([]byte("\x00\x00\x00\x02{}"))
+	entry := AuditEntry{RequestID: "req-20250101-120000-abcdefghijklmnop"}
+	api.warden.saveTranscript(rec, &entry, true)
+
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{http.MethodGet, "/api/transcripts/" + entry.RequestID, http.StatusOK},
+		{http.MethodGet, "/api/transcripts/req-missing", http.StatusNotFound},
+		{http.MethodPost, "/api/transcripts/" + entry.RequestID, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s = %d, want %d: %s", tt.method, tt.path, rec.Code, tt.want, strings.TrimSpace(rec.Body.String()))
+		}
+	}
+}
+
+func TestPolicyEvaluateTranscript(t *testing.T) {
+	pe := &PolicyEngine{config: PolicyConfig{
+		DefaultAction: ActionAllow,
+		Rules:         []Rule{{Command: "npm", Action: ActionAllow, Transcript: true}, {Command: "ls", Action: ActionAllow}},
+		ShellCommands: []string{"sh"},
+	}}
+	tests := []struct {
+		command string
+		args    []string
+		want    bool
+	}{
+		{"npm", nil, true},
+		{"ls", nil, false},
+		{"cat", nil, false},
+		{"sh", []string{"-c", "ls && npm test"}, true},
+	}
+	for _, tt := range tests {
+		if got := pe.Evaluate(&protocol.Request{Command: tt.command, Args: tt.args}).Transcript; got != tt.want {
+			t.Errorf("%s %v: Transcript = %v, want %v", tt.command, tt.args, got, tt.want)
+		}
+	}
+}
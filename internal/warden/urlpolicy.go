@@ -0,0 +1,312 @@
+package warden
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// invalidURLHost stands in for a URL argument whose host could not be parsed.
+// It never matches an allow pattern, so such arguments are always violations.
+const invalidURLHost = "(invalid)"
+
+// outputFlags take a file name rather than a URL in curl and wget, so their
+// values are not treated as schemeless URLs. Flags whose meaning differs
+// between tools (like -O or -c) are deliberately absent: skipping the token
+// after them could let a URL through unchecked.
+var outputFlags = map[string]bool{
+	"-o":                true,
+	"--output":          true,
+	"--output-document": true,
+	"--output-file":     true,
+	"--input-file":      true,
+	"--upload-file":     true,
+	"--dump-header":     true,
+	"--cookie-jar":      true,
+	"--config":          true,
+	"--cacert":          true,
+	"--cert":            true,
+	"--key":             true,
+}
+
+// ExtractURLHosts returns the normalized host of every URL-looking token in
+// args, in order and without duplicates. Tokens with a scheme ("https://...")
+// are always URLs; schemeless tokens count when they start with a hostname or
+// IP literal ("github.com/x", "10.0.0.1:8080"). Values of "--flag=value" are
+// inspected too. Unparsable URLs are reported as invalidURLHost.
+func ExtractURLHosts(args []string) []string {
+	var hosts []string
+	seen := make(map[string]bool)
+	add := func(host string) {
+		if !seen[host] {
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+
+	skipNext := false
+	for _, arg := range args {
+		if skipNext {
+			skipNext = false
+			if !strings.Contains(arg, "://") {
+				continue
+			}
+		}
+
+		token := arg
+		if strings.HasPrefix(arg, "-") {
+			flag, value, ok := strings.Cut(arg, "=")
+			if !ok {
+				skipNext = outputFlags[arg]
+				continue
+			}
+			if outputFlags[flag] && !strings.Contains(value, "://") {
+				continue
+			}
+			token = value
+		}
+
+		if host, ok := urlHost(token); ok {
+			add(host)
+		}
+	}
+	return hosts
+}
+
+// urlHost extracts the normalized host from a single token.
+func urlHost(token string) (string, bool) {
+	scheme, rest, hasScheme := strings.Cut(token, "://")
+	if hasScheme && !validScheme(scheme) {
+		return "", false
+	}
+
+	if !hasScheme {
+		// Paths and option-like values are not URLs
+		if token == "" || strings.ContainsAny(token[:1], "/.~@") {
+			return "", false
+		}
+		rest = token
+	}
+
+	u, err := url.Parse("http://" + rest)
+	if err != nil || u.Host == "" {
+		if hasScheme {
+			return invalidURLHost, true
+		}
+		return "", false
+	}
+
+	host := normalizeHost(u.Hostname())
+	if !hasScheme && !looksLikeHost(host) {
+		return "", false
+	}
+	if host == "" {
+		return invalidURLHost, true
+	}
+	return host, true
+}
+
+// validScheme reports whether s is a syntactically valid URL scheme.
+func validScheme(s string) bool {
+	if s == "" || !isASCIILetter(rune(s[0])) {
+		return false
+	}
+	for _, r := range s {
+		if !isASCIILetter(r) && !unicode.IsDigit(r) && r != '+' && r != '-' && r != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+func isASCIILetter(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+// looksLikeHost reports whether a schemeless token's host is plausibly a
+// network host: an IP literal, localhost, or a dotted name with a
+// non-numeric top-level label.
+func looksLikeHost(host string) bool {
+	if net.ParseIP(host) != nil || host == "localhost" {
+		return true
+	}
+	labels := strings.Split(host, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" {
+			return false
+		}
+		for _, r := range label {
+			if !isASCIILetter(r) && !unicode.IsDigit(r) && r != '-' {
+				return false
+			}
+		}
+	}
+	tld := labels[len(labels)-1]
+	return len(tld) >= 2 && strings.IndexFunc(tld, func(r rune) bool { return !unicode.IsDigit(r) }) >= 0
+}
+
+// normalizeHost lowercases a host, drops a trailing dot, canonicalizes IP
+// literals, and converts internationalized labels to punycode.
+func normalizeHost(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+
+	labels := strings.Split(host, ".")
+	for i, label := range labels {
+		labels[i] = toASCIILabel(label)
+	}
+	return strings.Join(labels, ".")
+}
+
+// MatchURLHost reports whether a normalized host matches any pattern.
+// Patterns are host names, optionally with a port (ignored), and may start
+// with "*." to match any subdomain (but not the domain itself). "*" matches
+// every host. IP literals only match patterns that list the same address.
+func MatchURLHost(patterns []string, host string) bool {
+	if host == invalidURLHost {
+		return false
+	}
+	isIP := net.ParseIP(host) != nil
+
+	for _, pattern := range patterns {
+		if pattern == "*" {
+			return true
+		}
+		pattern = normalizePattern(pattern)
+		if pattern == host {
+			return true
+		}
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok && !isIP {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// normalizePattern applies normalizeHost to a host pattern, keeping any
+// leading wildcard label and dropping a port.
+func normalizePattern(pattern string) string {
+	wildcard := strings.HasPrefix(pattern, "*.")
+	pattern = strings.TrimPrefix(pattern, "*.")
+
+	if h, _, err := net.SplitHostPort(pattern); err == nil {
+		pattern = h
+	}
+	pattern = strings.Trim(pattern, "[]")
+
+	pattern = normalizeHost(pattern)
+	if wildcard {
+		return "*." + pattern
+	}
+	return pattern
+}
+
+// toASCIILabel converts a single lowercased DNS label to its punycode
+// ("xn--") form when it contains non-ASCII characters (RFC 3492).
+func toASCIILabel(label string) string {
+	for i := 0; i < len(label); i++ {
+		if label[i] >= utf8.RuneSelf {
+			return "xn--" + punycodeEncode([]rune(label))
+		}
+	}
+	return label
+}
+
+// Punycode parameters from RFC 3492 section 5.
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 128
+)
+
+// punycodeEncode implements the RFC 3492 encoding procedure.
+func punycodeEncode(input []rune) string {
+	var out strings.Builder
+	for _, r := range input {
+		if r < utf8.RuneSelf {
+			out.WriteRune(r)
+		}
+	}
+	basic := out.Len()
+	handled := basic
+	if basic > 0 {
+		out.WriteByte('-')
+	}
+
+	n, delta, bias := rune(punyInitialN), 0, punyInitialBias
+	for handled < len(input) {
+		m := rune(unicode.MaxRune)
+		for _, r := range input {
+			if r >= n && r < m {
+				m = r
+			}
+		}
+		delta += int(m-n) * (handled + 1)
+		n = m
+
+		for _, r := range input {
+			if r < n {
+				delta++
+			}
+			if r != n {
+				continue
+			}
+			q := delta
+			for k := punyBase; ; k += punyBase {
+				t := k - bias
+				if t < punyTMin {
+					t = punyTMin
+				} else if t > punyTMax {
+					t = punyTMax
+				}
+				if q < t {
+					break
+				}
+				out.WriteByte(punyDigit(t + (q-t)%(punyBase-t)))
+				q = (q - t) / (punyBase - t)
+			}
+			out.WriteByte(punyDigit(q))
+			bias = punyAdapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+		delta++
+		n++
+	}
+	return out.String()
+}
+
+func punyAdapt(delta, numPoints int, first bool) int {
+	if first {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+	k := 0
+	for delta > ((punyBase-punyTMin)*punyTMax)/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
+
+func punyDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
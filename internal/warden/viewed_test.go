@@ -0,0 +1,182 @@
+package warden
+
+import (
+	"clawrden/pkg/protocol"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitPending waits until q holds a request and returns its ID.
+func waitPending(t *testing.T, q *HITLQueue) string {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if pending := q.List(); len(pending) == 1 {
+			return pending[0].ID
+		}
+	}
+	t.Fatal("request never reached the queue")
+	return ""
+}
+
+func TestMarkViewedFirstWins(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	q := NewHITLQueue()
+	q.now, q.mono = clock.Now, clock.Mono
+
+	outcome := make(chan Outcome, 1)
+	go func() { outcome <- q.EnqueueOutcome(context.Background(), &protocol.Request{Command: "rm"}, nil) }()
+	id := waitPending(t, q)
+	clock.Advance(3 * time.Second)
+
+	var wg sync.WaitGroup
+	seen := make([]time.Time, 8)
+	for i := range seen {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			seen[i], _ = q.MarkViewed(id)
+		}()
+	}
+	wg.Wait()
+	for _, at := range seen {
+		if !at.Equal(seen[0]) {
+			t.Fatalf("concurrent viewers saw different first views: %v", seen)
+		}
+	}
+
+	// Later views keep the first stamp
+	clock.Advance(5 * time.Second)
+	if at, ok := q.MarkViewed(id); !ok || !at.Equal(seen[0]) {
+		t.Errorf("second view = %v, %v; want %v", at, ok, seen[0])
+	}
+	if p, _ := q.Get(id); p.FirstViewedAt == nil || !p.FirstViewedAt.Equal(seen[0]) {
+		t.Errorf("pending request first viewed at %v, want %v", p.FirstViewedAt, seen[0])
+	}
+
+	q.Resolve(id, DecisionApprove)
+	o := <-outcome
+	if o.FirstViewed == nil || *o.FirstViewed != 3*time.Second || o.Waited != 8*time.Second {
+		t.Errorf("outcome first viewed %v, waited %v; want 3s, 8s", o.FirstViewed, o.Waited)
+	}
+
+	if _, ok := q.MarkViewed(id); ok {
+		t.Error("MarkViewed succeeded for a resolved request")
+	}
+}
+
+func TestHITLWaitSurvivesClockStep(t *testing.T) {
+	tests := []struct {
+		name     string
+		step     time.Duration // Wall clock step while the request waits
+		wantSkew bool
+	}{
+		{"steady", 0, false},
+		{"stepped back", -time.Hour, true},
+		{"stepped forward", time.Hour, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeClock{t: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+			q := NewHITLQueue()
+			q.now, q.mono = clock.Now, clock.Mono
+
+			outcome := make(chan Outcome, 1)
+			go func() { outcome <- q.EnqueueOutcome(context.Background(), &protocol.Request{Command: "rm"}, nil) }()
+			id := waitPending(t, q)
+			clock.Advance(2 * time.Second)
+			clock.Step(tt.step)
+			q.MarkViewed(id)
+			clock.Advance(3 * time.Second)
+
+			q.Resolve(id, DecisionApprove)
+			o := <-outcome
+			if o.FirstViewed == nil || *o.FirstViewed != 2*time.Second || o.Waited != 5*time.Second || o.ClockSkew != tt.wantSkew {
+				t.Errorf("first viewed %v, waited %v, skew %v; want 2s, 5s, %v", o.FirstViewed, o.Waited, o.ClockSkew, tt.wantSkew)
+			}
+		})
+	}
+}
+
+func TestQueuePositionSurvivesClockStep(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+	q := NewHITLQueue()
+	q.now, q.mono = clock.Now, clock.Mono
+
+	positions := make(chan int, 1)
+	info := &ReviewInfo{OnQueued: func(_ string, position int) { positions <- position }}
+	go q.EnqueueOutcome(context.Background(), &protocol.Request{Command: "rm"}, info)
+	first := <-positions
+	clock.Advance(time.Second)
+	clock.Step(-time.Hour) // The second request gets the earlier timestamp
+	go q.EnqueueOutcome(context.Background(), &protocol.Request{Command: "rm"}, info)
+	if second := <-positions; first != 1 || second != 2 {
+		t.Errorf("positions %d, %d; want 1, 2", first, second)
+	}
+	for _, p := range q.List() {
+		q.Resolve(p.ID, DecisionDeny)
+	}
+}
+
+func TestNeverViewed(t *testing.T) {
+	q := NewHITLQueue()
+	outcome := make(chan Outcome, 1)
+	go func() { outcome <- q.EnqueueOutcome(context.Background(), &protocol.Request{Command: "rm"}, nil) }()
+	id := waitPending(t, q)
+
+	q.Resolve(id, DecisionDeny)
+	if o := <-outcome; o.FirstViewed != nil {
+		t.Errorf("unviewed request has first view after %v", *o.FirstViewed)
+	}
+
+	// The audit entry leaves the field out rather than reporting 0ms
+	data, _ := json.Marshal(AuditEntry{WaitMs: 1500})
+	var fields map[string]any
+	json.Unmarshal(data, &fields)
+	if _, ok := fields["first_viewed_ms"]; ok || fields["wait_ms"] != 1500.0 {
+		t.Errorf("audit entry = %s", data)
+	}
+}
+
+func TestQueueViewedAPI(t *testing.T) {
+	srv := newTestServer(t)
+	api := &APIServer{warden: srv}
+	go srv.hitl.EnqueueOutcome(context.Background(), &protocol.Request{Command: "rm"}, nil)
+	id := waitPending(t, srv.hitl)
+	defer srv.hitl.Resolve(id, DecisionDeny)
+
+	// Listing the queue is not viewing a request
+	api.handleQueue(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/queue", nil))
+	if p, _ := srv.hitl.Get(id); p.FirstViewedAt != nil {
+		t.Fatal("GET /api/queue marked the request viewed")
+	}
+
+	rec := httptest.NewRecorder()
+	api.handleQueueAction(rec, httptest.NewRequest(http.MethodPost, "/api/queue/"+id+"/viewed", nil))
+	var body struct {
+		FirstViewedAt time.Time `json:"first_viewed_at"`
+	}
+	json.NewDecoder(rec.Body).Decode(&body)
+	if rec.Code != http.StatusOK || body.FirstViewedAt.IsZero() {
+		t.Fatalf("POST viewed = %d %+v", rec.Code, body)
+	}
+
+	// Fetching the request counts as a view too, but the first one stands
+	rec = httptest.NewRecorder()
+	api.handleQueueAction(rec, httptest.NewRequest(http.MethodGet, "/api/queue/"+id, nil))
+	var entry QueueEntry
+	json.NewDecoder(rec.Body).Decode(&entry)
+	if entry.FirstViewed == nil || !entry.FirstViewed.Equal(body.FirstViewedAt) {
+		t.Errorf("GET first_viewed_at = %v, want %v", entry.FirstViewed, body.FirstViewedAt)
+	}
+
+	rec = httptest.NewRecorder()
+	api.handleQueueAction(rec, httptest.NewRequest(http.MethodPost, "/api/queue/nope/viewed", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("viewing an unknown request: status %d, want 404", rec.Code)
+	}
+}
@@ -2,7 +2,13 @@ package warden
 
 import (
 	"clawrden/pkg/protocol"
+	"context"
+	"encoding/json"
+	"net"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestScrubEnvironment(t *testing.T) {
@@ -20,7 +26,7 @@ func TestScrubEnvironment(t *testing.T) {
 		"RANDOM_VAR=whatever",
 	}
 
-	scrubbed := ScrubEnvironment(env)
+	scrubbed, _ := ScrubEnvironment(env)
 
 	// Should keep allwlisted vars
 	expected := map[string]bool{
@@ -88,7 +94,7 @@ func TestPolicyEvaluate(t *testing.T) {
 			if result.Action != tt.expected {
 				t.Errorf("command %q: got %v, want %v", tt.command, result.Action, tt.expected)
 			}
-			if result.Timeout == 0 {
+			if result.ExecTimeout == 0 {
 				t.Errorf("command %q: expected non-zero timeout", tt.command)
 			}
 		})
@@ -159,3 +165,168 @@ func TestValidatePath(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleStatusRequest(t *testing.T) {
+	srv := newTestServer(t)
+	srv.setPolicy(DefaultPolicy())
+	srv.audit = &AuditLogger{writer: nopWriteCloser{}}
+	srv.startTime = time.Now().Add(-time.Minute)
+
+	client, server := net.Pipe()
+	defer client.Close()
+
+	go func() {
+		defer server.Close()
+		srv.handleStatusRequest(server, &protocol.Request{
+			Type:    protocol.RequestTypeStatus,
+			Version: protocol.ProtocolVersion,
+			Command: "ls",
+		})
+	}()
+
+	status, err := protocol.ReadStatus(client)
+	if err != nil {
+		t.Fatalf("ReadStatus: %v", err)
+	}
+	if status.Version != protocol.ProtocolVersion {
+		t.Errorf("Version = %d, want %d", status.Version, protocol.ProtocolVersion)
+	}
+	if status.DefaultAction != "deny" || !status.ToolHasRule {
+		t.Errorf("unexpected policy summary: %+v", status)
+	}
+	if status.UptimeSeconds < 60 {
+		t.Errorf("UptimeSeconds = %v, want >= 60", status.UptimeSeconds)
+	}
+}
+
+func TestScrubEnvironmentReport(t *testing.T) {
+	env := []string{
+		"PATH=/usr/bin:/bin",
+		"HTTP_PROXY=http://proxy:3128",
+		"LD_PRELOAD=/evil/lib.so",
+		"HOME=/home/agent",
+		"NVM_DIR=/home/agent/.nvm",
+		"AWS_SECRET_ACCESS_KEY=hunter2",
+	}
+
+	_, report := ScrubEnvironment(env)
+
+	if want := []string{"LD_PRELOAD", "AWS_SECRET_ACCESS_KEY"}; !reflect.DeepEqual(report.Blocked, want) {
+		t.Errorf("Blocked = %v, want %v", report.Blocked, want)
+	}
+	if want := []string{"HTTP_PROXY", "NVM_DIR"}; !reflect.DeepEqual(report.NotAllowlisted, want) {
+		t.Errorf("NotAllowlisted = %v, want %v", report.NotAllowlisted, want)
+	}
+	if want := []string{"PATH", "HOME"}; !reflect.DeepEqual(report.Passed, want) {
+		t.Errorf("Passed = %v, want %v", report.Passed, want)
+	}
+	if got := len(report.Dropped()); got != 4 {
+		t.Errorf("Dropped() has %d names, want 4", got)
+	}
+
+	// Names only: no value may leak into the report
+	data, _ := json.Marshal(report)
+	for _, secret := range []string{"hunter2", "proxy:3128", "/evil/lib.so"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("report leaks value %q: %s", secret, data)
+		}
+	}
+}
+
+func TestHITLEnqueueOutcome(t *testing.T) {
+	q := NewHITLQueue()
+
+	// Expired: the context ends before anyone decides
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	outcome := q.EnqueueOutcome(ctx, &protocol.Request{Command: "npm"}, nil)
+	if !outcome.Expired || outcome.Decision != DecisionDeny || outcome.ID == "" {
+		t.Errorf("expired outcome = %+v", outcome)
+	}
+
+	// Decided: the reported ID is the one reviewers saw in the queue
+	done := make(chan Outcome, 1)
+	go func() {
+		done <- q.EnqueueOutcome(context.Background(), &protocol.Request{Command: "npm"}, nil)
+	}()
+	var id string
+	for id == "" {
+		if pending := q.List(); len(pending) == 1 {
+			id = pending[0].ID
+		}
+		time.Sleep(time.Millisecond)
+	}
+	q.Resolve(id, DecisionApprove)
+	outcome = <-done
+	if outcome.Expired || outcome.Decision != DecisionApprove || outcome.ID != id {
+		t.Errorf("approved outcome = %+v, want ID %s", outcome, id)
+	}
+}
+
+func TestDenialMetadata(t *testing.T) {
+	srv, audited := newMaintenanceTestServer(t, []Rule{{Command: "rm", Action: ActionAsk}})
+	if _, err := srv.StartMaintenance("upgrading", 10*time.Minute, false); err != nil {
+		t.Fatalf("StartMaintenance: %v", err)
+	}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go srv.handleConnection(server)
+	if err := protocol.WriteRequest(client, &protocol.Request{Command: "rm", Cwd: t.TempDir()}); err != nil {
+		t.Fatalf("write request: %v", err)
+	}
+	if ack, err := protocol.ReadAck(client); err != nil || ack != protocol.AckDenied {
+		t.Fatalf("ack = %d, %v; want denied", ack, err)
+	}
+	reason, meta, err := protocol.ReadDenial(client)
+	if err != nil || meta == nil {
+		t.Fatalf("ReadDenial = %q, %+v, %v", reason, meta, err)
+	}
+
+	entries := audited()
+	entry := entries[len(entries)-1]
+	if !strings.Contains(reason, "upgrading") || meta.RequestID == "" || meta.RequestID != entry.RequestID ||
+		meta.Decision != protocol.DecisionDeny || meta.Outcome != protocol.OutcomeMaintenance || meta.WardenVersion != protocol.ProtocolVersion {
+		t.Errorf("denial = %q, %+v; audited %s", reason, meta, entry.RequestID)
+	}
+}
+
+func TestMalformedRequestIsRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		req  protocol.Request
+		want string
+	}{
+		{"path command", protocol.Request{Command: "/usr/bin/echo", Cwd: "/"}, "is a path"},
+		{"empty command", protocol.Request{Cwd: "/"}, "command is empty"},
+		{"NUL in arg", protocol.Request{Command: "echo", Args: []string{"a", "b\x00c"}, Cwd: "/"}, "args[1] contains a NUL byte"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, audited := newMaintenanceTestServer(t, []Rule{{Command: "echo", Action: ActionAllow}})
+			ack, reason := sendRequest(t, srv, &tt.req)
+			if ack != protocol.AckDenied || !strings.Contains(reason, tt.want) {
+				t.Errorf("ack = %d, reason = %q; want denied with %q", ack, reason, tt.want)
+			}
+			entries := audited()
+			if last := entries[len(entries)-1]; last.Decision != protocol.DecisionRejected || last.Outcome != protocol.OutcomeMalformed || len(last.Args) != 0 {
+				t.Errorf("audited %q with args %q", last.DecisionLabel(), last.Args)
+			}
+		})
+	}
+}
+
+func TestRelativeCwdIsRefused(t *testing.T) {
+	for _, cwd := range []string{"", ".", "app", "../etc"} {
+		t.Run(cwd, func(t *testing.T) {
+			srv, audited := newMaintenanceTestServer(t, []Rule{{Command: "echo", Action: ActionAllow}})
+			if ack, _ := sendRequest(t, srv, &protocol.Request{Command: "echo", Args: []string{"hi"}, Cwd: cwd}); ack != protocol.AckDenied {
+				t.Errorf("ack = %d, want denied", ack)
+			}
+			entries := audited()
+			if last := entries[len(entries)-1]; last.Decision != protocol.DecisionRejected || last.Outcome != protocol.OutcomeMalformed || !strings.Contains(last.Error, "not an absolute path") {
+				t.Errorf("audited %q: %q", last.DecisionLabel(), last.Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+// Package clawrden embeds a warden in another Go program. A Supervisor runs
+// the same policy, review queue, audit log and executors as the warden
+// daemon, in-process; the host program submits requests to it directly
+// rather than through shims and the Unix socket, which, like the HTTP API,
+// it only serves when asked to.
+//
+//	cfg := clawrden.NewConfig(dir)
+//	cfg.PolicyPath = "policy.yaml"
+//	sup, err := clawrden.NewSupervisor(cfg)
+//	...
+//	sup.Start()
+//	defer sup.Close()
+//	ex, err := sup.Submit(ctx, clawrden.Request{Command: "make", Args: []string{"test"}, Cwd: "/src"})
+//	io.Copy(os.Stdout, ex.Stdout)
+//	res, err := ex.Wait()
+//
+// The types below are aliases of the warden's own, so values can be built and
+// inspected without importing its internal packages.
+package clawrden
+
+import (
+	"clawrden/internal/warden"
+	"clawrden/pkg/protocol"
+	"errors"
+	"path/filepath"
+	"sync"
+)
+
+// Config configures a Supervisor, as the warden daemon's flags do (see
+// NewConfig). Its front-ends are optional: the Unix socket is served only
+// with a SocketPath, the HTTP API only with an APIAddr, and the gRPC API
+// only with a GRPCAddr.
+type Config = warden.Config
+
+// Request is a command submitted to a Supervisor, as a shim would send it.
+// The supervisor trusts its Identity and ContainerID; a request without a
+// ContainerID runs on the host.
+type Request = protocol.Request
+
+// Identity is the user a request runs as.
+type Identity = protocol.Identity
+
+// Queue holds the requests waiting for a reviewer's decision.
+type Queue = warden.HITLQueue
+
+// PendingRequest is a request in the Queue.
+type PendingRequest = warden.PendingRequest
+
+// Decision is a reviewer's decision on a pending request.
+type Decision = warden.Decision
+
+// Reviewer decisions.
+const (
+	Approve = warden.DecisionApprove
+	Reject  = warden.DecisionDeny
+)
+
+// AuditEntry is one entry of the audit log.
+type AuditEntry = warden.AuditEntry
+
+// NewConfig returns a configuration that keeps all of a supervisor's files
+// under dir: its audit log, jailhouse, transcripts, sandboxes and spooled
+// output. It serves no front-end and runs the built-in deny-all policy
+// until PolicyPath is set.
+func NewConfig(dir string) Config {
+	return Config{
+		AuditPath:       filepath.Join(dir, "audit.log"),
+		JailhouseArmory: filepath.Join(dir, "armory"),
+		JailhouseRoot:   filepath.Join(dir, "jailhouse"),
+		JailhouseState:  filepath.Join(dir, "jailhouse.state.json"),
+		SandboxRoot:     filepath.Join(dir, "sandboxes"),
+		TranscriptDir:   filepath.Join(dir, "transcripts"),
+		SpoolDir:        filepath.Join(dir, "spool"),
+	}
+}
+
+// Supervisor is an embedded warden.
+type Supervisor struct {
+	srv     *warden.Server
+	cfg     Config
+	closing sync.Once
+}
+
+// NewSupervisor creates a supervisor for cfg. Requests may be submitted
+// right away; Start starts its front-ends and background work.
+func NewSupervisor(cfg Config) (*Supervisor, error) {
+	srv, err := warden.NewServer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Supervisor{srv: srv, cfg: cfg}, nil
+}
+
+// Start starts what the supervisor runs in the background: the front-ends
+// its Config asks for, policy hot-reloading and the warden's periodic
+// checks. It fails if the Unix socket cannot be opened.
+func (s *Supervisor) Start() error {
+	if s.cfg.SocketPath == "" {
+		s.srv.Start()
+		return nil
+	}
+	if err := s.srv.Listen(); err != nil {
+		return err
+	}
+	go s.srv.Serve() // Returns once Close closes the socket
+	return nil
+}
+
+// Close shuts the supervisor down, cancelling the requests still running.
+// It is safe to call more than once.
+func (s *Supervisor) Close() {
+	s.closing.Do(s.srv.Shutdown)
+}
+
+// Queue returns the supervisor's review queue.
+func (s *Supervisor) Queue() *Queue {
+	return s.srv.GetHITLQueue()
+}
+
+// Audit returns the supervisor's audit log.
+func (s *Supervisor) Audit() *AuditLog {
+	return &AuditLog{srv: s.srv, path: s.cfg.AuditPath}
+}
+
+// Server returns the underlying warden for what the supervisor does not
+// cover.
+func (s *Supervisor) Server() *warden.Server {
+	return s.srv
+}
+
+// ErrNoAuditLog is returned when reading the audit log of a supervisor
+// configured without one.
+var ErrNoAuditLog = errors.New("no audit log configured")
+
+// AuditLog reads a supervisor's audit log.
+type AuditLog struct {
+	srv  *warden.Server
+	path string
+}
+
+// Scan calls fn with each entry in turn, oldest first, stopping at the
+// first error fn returns and returning it. An entry of a command still
+// running says so in its Completed field.
+func (a *AuditLog) Scan(fn func(AuditEntry) error) error {
+	if a.path == "" {
+		return ErrNoAuditLog
+	}
+	return a.srv.ScanAudit(fn)
+}
+
+// Entries returns every entry, oldest first.
+func (a *AuditLog) Entries() ([]AuditEntry, error) {
+	var entries []AuditEntry
+	err := a.Scan(func(e AuditEntry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	return entries, err
+}
@@ -0,0 +1,100 @@
+package clawrden
+
+import (
+	"clawrden/pkg/protocol"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newSupervisor starts a supervisor allowing echo and sleep in its
+// directory, serving the socket if socket is set.
+func newSupervisor(t *testing.T, socket bool) (*Supervisor, string) {
+	t.Helper()
+	dir := t.TempDir()
+	policy := filepath.Join(dir, "policy.yaml")
+	rules := "default_action: deny\nallowed_paths: [\"" + dir + "\"]\nrules:\n  - command: echo\n    action: allow\n  - command: sleep\n    action: allow\n"
+	if err := os.WriteFile(policy, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := NewConfig(dir)
+	cfg.PolicyPath = policy
+	cfg.Logger = log.New(io.Discard, "", 0)
+	if socket {
+		// Socket paths are limited to about 100 bytes
+		sockDir, err := os.MkdirTemp("", "clawrden")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { os.RemoveAll(sockDir) })
+		cfg.SocketPath = filepath.Join(sockDir, "warden.sock")
+	}
+	sup, err := NewSupervisor(cfg)
+	if err != nil {
+		t.Fatalf("NewSupervisor: %v", err)
+	}
+	if err := sup.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(sup.Close)
+	return sup, dir
+}
+
+func TestSupervisorServesSocketToo(t *testing.T) {
+	sup, dir := newSupervisor(t, true)
+
+	// A shim's request on the socket
+	conn, err := net.Dial("unix", sup.cfg.SocketPath)
+	if err != nil {
+		t.Fatalf("dial socket: %v", err)
+	}
+	defer conn.Close()
+	protocol.WriteRequest(conn, &protocol.Request{Command: "echo", Args: []string{"shim"}, Cwd: dir, Env: []string{"PATH=/usr/bin:/bin"}})
+	if ack, err := protocol.ReadAck(conn); err != nil || ack != protocol.AckAllowed {
+		t.Fatalf("socket ack = %d, %v; want allowed", ack, err)
+	}
+	io.Copy(io.Discard, conn)
+
+	// And a submitted one, audited alike
+	ex, err := sup.Submit(context.Background(), Request{Command: "echo", Args: []string{"host"}, Cwd: dir, Env: []string{"PATH=/usr/bin:/bin"}})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if res, err := ex.Wait(); err != nil || !res.Allowed() || res.RequestID == "" {
+		t.Fatalf("Wait = %+v, %v", res, err)
+	}
+
+	entries, err := sup.Audit().Entries()
+	if err != nil || len(entries) != 2 || entries[0].Args[0] != "shim" || entries[1].Args[0] != "host" {
+		t.Fatalf("audit log = %+v, %v; want the socket's request, then the submitted one", entries, err)
+	}
+}
+
+func TestSubmitCancel(t *testing.T) {
+	sup, dir := newSupervisor(t, false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ex, err := sup.Submit(ctx, Request{Command: "sleep", Args: []string{"30"}, Cwd: dir, Env: []string{"PATH=/usr/bin:/bin"}})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := ex.Wait(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait: err = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("cancelled request took %v", elapsed)
+	}
+
+	sup.Close()
+	if _, err := sup.Submit(context.Background(), Request{Command: "echo", Cwd: dir}); err == nil {
+		t.Error("Submit after Close succeeded")
+	}
+}
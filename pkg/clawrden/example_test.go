@@ -0,0 +1,98 @@
+package clawrden_test
+
+import (
+	"clawrden/pkg/clawrden"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A host program supervising its agent's commands in-process: echo is
+// allowed, ls needs a reviewer's approval, which the program gives itself
+// through the queue, and everything else is denied.
+func Example() {
+	dir, err := os.MkdirTemp("", "clawrden-example")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	policy := filepath.Join(dir, "policy.yaml")
+	err = os.WriteFile(policy, []byte(fmt.Sprintf(`default_action: deny
+allowed_paths: [%q]
+rules:
+  - command: echo
+    action: allow
+  - command: ls
+    action: ask
+`, dir+"/*")), 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cfg := clawrden.NewConfig(dir)
+	cfg.PolicyPath = policy
+	cfg.Logger = log.New(io.Discard, "", 0)
+	sup, err := clawrden.NewSupervisor(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := sup.Start(); err != nil {
+		log.Fatal(err)
+	}
+	defer sup.Close()
+
+	// Approve whatever waits for a reviewer
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			for _, pending := range sup.Queue().List() {
+				sup.Queue().Resolve(pending.ID, clawrden.Approve)
+			}
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}()
+
+	os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0644)
+	for _, argv := range [][]string{{"echo", "hello"}, {"ls", "notes.txt"}, {"curl", "example.com"}} {
+		ex, err := sup.Submit(context.Background(), clawrden.Request{
+			Command: argv[0],
+			Args:    argv[1:],
+			Cwd:     dir,
+			Env:     []string{"PATH=/usr/bin:/bin"},
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		out, _ := io.ReadAll(ex.Stdout)
+		res, err := ex.Wait()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%s: %s, exit code %d, output %q\n", argv[0], res.Decision, res.ExitCode, out)
+	}
+
+	entries, err := sup.Audit().Entries()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, e := range entries {
+		fmt.Printf("audited: %s %s\n", e.Command, e.Decision)
+	}
+
+	// Output:
+	// echo: allow, exit code 0, output "hello\n"
+	// ls: allow, exit code 0, output "notes.txt\n"
+	// curl: deny, exit code -1, output ""
+	// audited: echo allow
+	// audited: ls allow
+	// audited: curl deny
+}
@@ -0,0 +1,160 @@
+package clawrden
+
+import (
+	"clawrden/pkg/protocol"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+// Result is how a submitted request ended.
+type Result struct {
+	RequestID string            // ID of the request in the audit log and queue
+	Decision  protocol.Decision // Audit decision, e.g. "allow"
+	Outcome   protocol.Outcome  // And why, e.g. "after_hitl"
+	Reason    string            // Why the request was denied, if it was
+	ExitCode  int               // The command's exit code; -1 unless it ran
+}
+
+// Allowed reports whether the command was run.
+func (r *Result) Allowed() bool {
+	return r.Decision == protocol.DecisionAllow
+}
+
+// Execution is a submitted request. Its command's output is read from
+// Stdout and Stderr, which end once the command exits or the request is
+// denied. Like os/exec pipes, both must be read concurrently: a command
+// whose output on one is not read stalls its output on the other.
+type Execution struct {
+	Stdout io.Reader
+	Stderr io.Reader
+
+	conn   net.Conn
+	done   chan struct{}
+	result Result
+	err    error
+}
+
+// Submit sends req through the supervisor's policy, review queue, audit
+// log and executors, as a shim's request on the socket would be. A request
+// that asks for approval waits in the Queue until a reviewer decides it,
+// while Stdout and Stderr stay open. Cancelling ctx cancels the request;
+// the command, if it runs, is stopped.
+func (s *Supervisor) Submit(ctx context.Context, req Request) (*Execution, error) {
+	// Ask for what the warden tells current shims: where a queued request
+	// stands, and a reviewer's message with a denial
+	req.Version = protocol.ProtocolVersion
+	conn, err := s.srv.Submit(ctx, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, stdoutW := io.Pipe()
+	stderr, stderrW := io.Pipe()
+	e := &Execution{
+		Stdout: stdout,
+		Stderr: stderr,
+		conn:   conn,
+		done:   make(chan struct{}),
+		result: Result{ExitCode: -1},
+	}
+	go func() {
+		defer close(e.done)
+		defer conn.Close()
+		e.err = e.read(stdoutW, stderrW)
+		if e.err != nil && ctx.Err() != nil {
+			e.err = ctx.Err()
+		}
+		stdoutW.CloseWithError(e.err)
+		stderrW.CloseWithError(e.err)
+	}()
+	return e, nil
+}
+
+// read follows the warden's answer to the end, writing the command's
+// output to stdout and stderr.
+func (e *Execution) read(stdout, stderr io.Writer) error {
+	ack, err := protocol.ReadAck(e.conn)
+	if err != nil {
+		return fmt.Errorf("read ack: %w", err)
+	}
+	if ack == protocol.AckPendingHITL {
+		ack, err = protocol.ReadResolution(e.conn, func(meta *protocol.ExecMetadata) {
+			e.result.RequestID = meta.RequestID
+		})
+		if err != nil {
+			return fmt.Errorf("read ack: %w", err)
+		}
+	}
+
+	switch ack {
+	case protocol.AckAllowed:
+	case protocol.AckDenied:
+		reason, meta, err := protocol.ReadDenialTo(e.conn, stderr)
+		e.result.Decision, e.result.Reason = protocol.DecisionDeny, reason
+		e.applyMetadata(meta)
+		return err
+	default:
+		return fmt.Errorf("unknown ack %d", ack)
+	}
+
+	e.result.Decision = protocol.DecisionAllow
+	for {
+		frame, err := protocol.ReadFrame(e.conn)
+		if errors.Is(err, io.EOF) {
+			return errors.New("the warden ended the request without an exit code")
+		}
+		if err != nil {
+			return err
+		}
+		switch frame.Type {
+		case protocol.StreamStdout:
+			_, err = stdout.Write(frame.Payload)
+		case protocol.StreamStderr:
+			_, err = stderr.Write(frame.Payload)
+		case protocol.StreamMeta:
+			var meta *protocol.ExecMetadata
+			if meta, err = protocol.ParseMetadata(frame); err == nil {
+				e.applyMetadata(meta)
+			}
+		case protocol.StreamExit:
+			e.result.ExitCode = protocol.ParseExitCode(frame)
+			// The warden hangs up once the request is audited
+			_, err = io.Copy(io.Discard, e.conn)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// applyMetadata records what the warden said about the request.
+func (e *Execution) applyMetadata(meta *protocol.ExecMetadata) {
+	if meta == nil {
+		return
+	}
+	if meta.RequestID != "" {
+		e.result.RequestID = meta.RequestID
+	}
+	if meta.Decision != protocol.DecisionNone {
+		e.result.Decision, e.result.Outcome = meta.Decision, meta.Outcome
+	}
+}
+
+// Wait waits for the request to end and be audited, and returns how it
+// did. Output not read by then is discarded, so Wait is called once the
+// output wanted has been read. The error is the context's if the request
+// was cancelled, or says why the warden's answer could not be followed.
+func (e *Execution) Wait() (*Result, error) {
+	go io.Copy(io.Discard, e.Stdout)
+	go io.Copy(io.Discard, e.Stderr)
+	<-e.done
+	if e.err != nil {
+		return nil, e.err
+	}
+	res := e.result
+	return &res, nil
+}
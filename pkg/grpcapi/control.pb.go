@@ -0,0 +1,1816 @@
+// WardenControl is the gRPC counterpart of the warden's HTTP API. Run
+// `make proto` after editing this file to regenerate pkg/grpcapi.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: clawrden/v1/control.proto
+
+package grpcapi
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Decision int32
+
+const (
+	Decision_DECISION_UNSPECIFIED Decision = 0
+	Decision_DECISION_APPROVE     Decision = 1
+	Decision_DECISION_DENY        Decision = 2
+)
+
+// Enum value maps for Decision.
+var (
+	Decision_name = map[int32]string{
+		0: "DECISION_UNSPECIFIED",
+		1: "DECISION_APPROVE",
+		2: "DECISION_DENY",
+	}
+	Decision_value = map[string]int32{
+		"DECISION_UNSPECIFIED": 0,
+		"DECISION_APPROVE":     1,
+		"DECISION_DENY":        2,
+	}
+)
+
+func (x Decision) Enum() *Decision {
+	p := new(Decision)
+	*p = x
+	return p
+}
+
+func (x Decision) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Decision) Descriptor() protoreflect.EnumDescriptor {
+	return file_clawrden_v1_control_proto_enumTypes[0].Descriptor()
+}
+
+func (Decision) Type() protoreflect.EnumType {
+	return &file_clawrden_v1_control_proto_enumTypes[0]
+}
+
+func (x Decision) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Decision.Descriptor instead.
+func (Decision) EnumDescriptor() ([]byte, []int) {
+	return file_clawrden_v1_control_proto_rawDescGZIP(), []int{0}
+}
+
+type GetStatusRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStatusRequest) Reset() {
+	*x = GetStatusRequest{}
+	mi := &file_clawrden_v1_control_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatusRequest) ProtoMessage() {}
+
+func (x *GetStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clawrden_v1_control_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatusRequest.ProtoReflect.Descriptor instead.
+func (*GetStatusRequest) Descriptor() ([]byte, []int) {
+	return file_clawrden_v1_control_proto_rawDescGZIP(), []int{0}
+}
+
+type GetStatusResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	PendingCount  int32                  `protobuf:"varint,1,opt,name=pending_count,json=pendingCount,proto3" json:"pending_count,omitempty"`
+	OpenIncidents int32                  `protobuf:"varint,2,opt,name=open_incidents,json=openIncidents,proto3" json:"open_incidents,omitempty"`
+	Jailhouse     *JailInventory         `protobuf:"bytes,3,opt,name=jailhouse,proto3" json:"jailhouse,omitempty"` // Unset without a jailhouse
+	Bridges       []*Bridge              `protobuf:"bytes,4,rep,name=bridges,proto3" json:"bridges,omitempty"`
+	Docker        *DockerHealth          `protobuf:"bytes,5,opt,name=docker,proto3" json:"docker,omitempty"`           // Unset without Docker
+	Maintenance   *Maintenance           `protobuf:"bytes,6,opt,name=maintenance,proto3" json:"maintenance,omitempty"` // Unset outside a maintenance window
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStatusResponse) Reset() {
+	*x = GetStatusResponse{}
+	mi := &file_clawrden_v1_control_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatusResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatusResponse) ProtoMessage() {}
+
+func (x *GetStatusResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_clawrden_v1_control_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatusResponse.ProtoReflect.Descriptor instead.
+func (*GetStatusResponse) Descriptor() ([]byte, []int) {
+	return file_clawrden_v1_control_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetStatusResponse) GetPendingCount() int32 {
+	if x != nil {
+		return x.PendingCount
+	}
+	return 0
+}
+
+func (x *GetStatusResponse) GetOpenIncidents() int32 {
+	if x != nil {
+		return x.OpenIncidents
+	}
+	return 0
+}
+
+func (x *GetStatusResponse) GetJailhouse() *JailInventory {
+	if x != nil {
+		return x.Jailhouse
+	}
+	return nil
+}
+
+func (x *GetStatusResponse) GetBridges() []*Bridge {
+	if x != nil {
+		return x.Bridges
+	}
+	return nil
+}
+
+func (x *GetStatusResponse) GetDocker() *DockerHealth {
+	if x != nil {
+		return x.Docker
+	}
+	return nil
+}
+
+func (x *GetStatusResponse) GetMaintenance() *Maintenance {
+	if x != nil {
+		return x.Maintenance
+	}
+	return nil
+}
+
+type JailInventory struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Jails         int32                  `protobuf:"varint,1,opt,name=jails,proto3" json:"jails,omitempty"`
+	Symlinks      int32                  `protobuf:"varint,2,opt,name=symlinks,proto3" json:"symlinks,omitempty"`
+	DiskBytes     int64                  `protobuf:"varint,3,opt,name=disk_bytes,json=diskBytes,proto3" json:"disk_bytes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *JailInventory) Reset() {
+	*x = JailInventory{}
+	mi := &file_clawrden_v1_control_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *JailInventory) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JailInventory) ProtoMessage() {}
+
+func (x *JailInventory) ProtoReflect() protoreflect.Message {
+	mi := &file_clawrden_v1_control_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JailInventory.ProtoReflect.Descriptor instead.
+func (*JailInventory) Descriptor() ([]byte, []int) {
+	return file_clawrden_v1_control_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *JailInventory) GetJails() int32 {
+	if x != nil {
+		return x.Jails
+	}
+	return 0
+}
+
+func (x *JailInventory) GetSymlinks() int32 {
+	if x != nil {
+		return x.Symlinks
+	}
+	return 0
+}
+
+func (x *JailInventory) GetDiskBytes() int64 {
+	if x != nil {
+		return x.DiskBytes
+	}
+	return 0
+}
+
+type Bridge struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Type          string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Version       string                 `protobuf:"bytes,3,opt,name=version,proto3" json:"version,omitempty"`
+	LastSeen      *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=last_seen,json=lastSeen,proto3" json:"last_seen,omitempty"`
+	Stale         bool                   `protobuf:"varint,5,opt,name=stale,proto3" json:"stale,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Bridge) Reset() {
+	*x = Bridge{}
+	mi := &file_clawrden_v1_control_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Bridge) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Bridge) ProtoMessage() {}
+
+func (x *Bridge) ProtoReflect() protoreflect.Message {
+	mi := &file_clawrden_v1_control_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Bridge.ProtoReflect.Descriptor instead.
+func (*Bridge) Descriptor() ([]byte, []int) {
+	return file_clawrden_v1_control_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Bridge) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Bridge) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Bridge) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *Bridge) GetLastSeen() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastSeen
+	}
+	return nil
+}
+
+func (x *Bridge) GetStale() bool {
+	if x != nil {
+		return x.Stale
+	}
+	return false
+}
+
+type DockerHealth struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Healthy       bool                   `protobuf:"varint,1,opt,name=healthy,proto3" json:"healthy,omitempty"`
+	Since         *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=since,proto3" json:"since,omitempty"`
+	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DockerHealth) Reset() {
+	*x = DockerHealth{}
+	mi := &file_clawrden_v1_control_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DockerHealth) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DockerHealth) ProtoMessage() {}
+
+func (x *DockerHealth) ProtoReflect() protoreflect.Message {
+	mi := &file_clawrden_v1_control_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DockerHealth.ProtoReflect.Descriptor instead.
+func (*DockerHealth) Descriptor() ([]byte, []int) {
+	return file_clawrden_v1_control_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *DockerHealth) GetHealthy() bool {
+	if x != nil {
+		return x.Healthy
+	}
+	return false
+}
+
+func (x *DockerHealth) GetSince() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Since
+	}
+	return nil
+}
+
+func (x *DockerHealth) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type Maintenance struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	Until         *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=until,proto3" json:"until,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Maintenance) Reset() {
+	*x = Maintenance{}
+	mi := &file_clawrden_v1_control_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Maintenance) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Maintenance) ProtoMessage() {}
+
+func (x *Maintenance) ProtoReflect() protoreflect.Message {
+	mi := &file_clawrden_v1_control_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Maintenance.ProtoReflect.Descriptor instead.
+func (*Maintenance) Descriptor() ([]byte, []int) {
+	return file_clawrden_v1_control_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Maintenance) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Maintenance) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Maintenance) GetUntil() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Until
+	}
+	return nil
+}
+
+type ListQueueRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListQueueRequest) Reset() {
+	*x = ListQueueRequest{}
+	mi := &file_clawrden_v1_control_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListQueueRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListQueueRequest) ProtoMessage() {}
+
+func (x *ListQueueRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clawrden_v1_control_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListQueueRequest.ProtoReflect.Descriptor instead.
+func (*ListQueueRequest) Descriptor() ([]byte, []int) {
+	return file_clawrden_v1_control_proto_rawDescGZIP(), []int{6}
+}
+
+type ListQueueResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Requests      []*PendingRequest      `protobuf:"bytes,1,rep,name=requests,proto3" json:"requests,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListQueueResponse) Reset() {
+	*x = ListQueueResponse{}
+	mi := &file_clawrden_v1_control_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListQueueResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListQueueResponse) ProtoMessage() {}
+
+func (x *ListQueueResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_clawrden_v1_control_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListQueueResponse.ProtoReflect.Descriptor instead.
+func (*ListQueueResponse) Descriptor() ([]byte, []int) {
+	return file_clawrden_v1_control_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ListQueueResponse) GetRequests() []*PendingRequest {
+	if x != nil {
+		return x.Requests
+	}
+	return nil
+}
+
+type PendingRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Command       string                 `protobuf:"bytes,2,opt,name=command,proto3" json:"command,omitempty"`
+	Args          []string               `protobuf:"bytes,3,rep,name=args,proto3" json:"args,omitempty"`
+	Cwd           string                 `protobuf:"bytes,4,opt,name=cwd,proto3" json:"cwd,omitempty"`
+	Uid           uint32                 `protobuf:"varint,5,opt,name=uid,proto3" json:"uid,omitempty"`
+	Gid           uint32                 `protobuf:"varint,6,opt,name=gid,proto3" json:"gid,omitempty"`
+	Groups        []string               `protobuf:"bytes,7,rep,name=groups,proto3" json:"groups,omitempty"`
+	ContainerId   string                 `protobuf:"bytes,8,opt,name=container_id,json=containerId,proto3" json:"container_id,omitempty"`
+	JailId        string                 `protobuf:"bytes,9,opt,name=jail_id,json=jailId,proto3" json:"jail_id,omitempty"`
+	TaskId        string                 `protobuf:"bytes,10,opt,name=task_id,json=taskId,proto3" json:"task_id,omitempty"`
+	RunId         string                 `protobuf:"bytes,11,opt,name=run_id,json=runId,proto3" json:"run_id,omitempty"`
+	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,12,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PendingRequest) Reset() {
+	*x = PendingRequest{}
+	mi := &file_clawrden_v1_control_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PendingRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PendingRequest) ProtoMessage() {}
+
+func (x *PendingRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clawrden_v1_control_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PendingRequest.ProtoReflect.Descriptor instead.
+func (*PendingRequest) Descriptor() ([]byte, []int) {
+	return file_clawrden_v1_control_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *PendingRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *PendingRequest) GetCommand() string {
+	if x != nil {
+		return x.Command
+	}
+	return ""
+}
+
+func (x *PendingRequest) GetArgs() []string {
+	if x != nil {
+		return x.Args
+	}
+	return nil
+}
+
+func (x *PendingRequest) GetCwd() string {
+	if x != nil {
+		return x.Cwd
+	}
+	return ""
+}
+
+func (x *PendingRequest) GetUid() uint32 {
+	if x != nil {
+		return x.Uid
+	}
+	return 0
+}
+
+func (x *PendingRequest) GetGid() uint32 {
+	if x != nil {
+		return x.Gid
+	}
+	return 0
+}
+
+func (x *PendingRequest) GetGroups() []string {
+	if x != nil {
+		return x.Groups
+	}
+	return nil
+}
+
+func (x *PendingRequest) GetContainerId() string {
+	if x != nil {
+		return x.ContainerId
+	}
+	return ""
+}
+
+func (x *PendingRequest) GetJailId() string {
+	if x != nil {
+		return x.JailId
+	}
+	return ""
+}
+
+func (x *PendingRequest) GetTaskId() string {
+	if x != nil {
+		return x.TaskId
+	}
+	return ""
+}
+
+func (x *PendingRequest) GetRunId() string {
+	if x != nil {
+		return x.RunId
+	}
+	return ""
+}
+
+func (x *PendingRequest) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+type ResolveRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Decision      Decision               `protobuf:"varint,2,opt,name=decision,proto3,enum=clawrden.v1.Decision" json:"decision,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResolveRequest) Reset() {
+	*x = ResolveRequest{}
+	mi := &file_clawrden_v1_control_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResolveRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResolveRequest) ProtoMessage() {}
+
+func (x *ResolveRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clawrden_v1_control_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResolveRequest.ProtoReflect.Descriptor instead.
+func (*ResolveRequest) Descriptor() ([]byte, []int) {
+	return file_clawrden_v1_control_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ResolveRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *ResolveRequest) GetDecision() Decision {
+	if x != nil {
+		return x.Decision
+	}
+	return Decision_DECISION_UNSPECIFIED
+}
+
+type ResolveResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResolveResponse) Reset() {
+	*x = ResolveResponse{}
+	mi := &file_clawrden_v1_control_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResolveResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResolveResponse) ProtoMessage() {}
+
+func (x *ResolveResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_clawrden_v1_control_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResolveResponse.ProtoReflect.Descriptor instead.
+func (*ResolveResponse) Descriptor() ([]byte, []int) {
+	return file_clawrden_v1_control_proto_rawDescGZIP(), []int{10}
+}
+
+type WatchEventsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Event names to stream, e.g. "hitl_enqueued"; empty streams all events.
+	Names         []string `protobuf:"bytes,1,rep,name=names,proto3" json:"names,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchEventsRequest) Reset() {
+	*x = WatchEventsRequest{}
+	mi := &file_clawrden_v1_control_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchEventsRequest) ProtoMessage() {}
+
+func (x *WatchEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clawrden_v1_control_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchEventsRequest.ProtoReflect.Descriptor instead.
+func (*WatchEventsRequest) Descriptor() ([]byte, []int) {
+	return file_clawrden_v1_control_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *WatchEventsRequest) GetNames() []string {
+	if x != nil {
+		return x.Names
+	}
+	return nil
+}
+
+type Event struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Name  string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Time  *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=time,proto3" json:"time,omitempty"`
+	Id    string                 `protobuf:"bytes,3,opt,name=id,proto3" json:"id,omitempty"` // Queue, execution, incident or maintenance ID, if any
+	// The request the event is about, if any
+	Command     string   `protobuf:"bytes,4,opt,name=command,proto3" json:"command,omitempty"`
+	Args        []string `protobuf:"bytes,5,rep,name=args,proto3" json:"args,omitempty"`
+	ContainerId string   `protobuf:"bytes,6,opt,name=container_id,json=containerId,proto3" json:"container_id,omitempty"`
+	JailId      string   `protobuf:"bytes,7,opt,name=jail_id,json=jailId,proto3" json:"jail_id,omitempty"`
+	TaskId      string   `protobuf:"bytes,8,opt,name=task_id,json=taskId,proto3" json:"task_id,omitempty"`
+	RunId       string   `protobuf:"bytes,9,opt,name=run_id,json=runId,proto3" json:"run_id,omitempty"`
+	// Remaining event-specific fields as a JSON object, e.g. {"approved":true}
+	DetailJson    string `protobuf:"bytes,10,opt,name=detail_json,json=detailJson,proto3" json:"detail_json,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_clawrden_v1_control_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_clawrden_v1_control_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_clawrden_v1_control_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *Event) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Event) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *Event) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Event) GetCommand() string {
+	if x != nil {
+		return x.Command
+	}
+	return ""
+}
+
+func (x *Event) GetArgs() []string {
+	if x != nil {
+		return x.Args
+	}
+	return nil
+}
+
+func (x *Event) GetContainerId() string {
+	if x != nil {
+		return x.ContainerId
+	}
+	return ""
+}
+
+func (x *Event) GetJailId() string {
+	if x != nil {
+		return x.JailId
+	}
+	return ""
+}
+
+func (x *Event) GetTaskId() string {
+	if x != nil {
+		return x.TaskId
+	}
+	return ""
+}
+
+func (x *Event) GetRunId() string {
+	if x != nil {
+		return x.RunId
+	}
+	return ""
+}
+
+func (x *Event) GetDetailJson() string {
+	if x != nil {
+		return x.DetailJson
+	}
+	return ""
+}
+
+type Jail struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	JailId        string                 `protobuf:"bytes,1,opt,name=jail_id,json=jailId,proto3" json:"jail_id,omitempty"`
+	Commands      []string               `protobuf:"bytes,2,rep,name=commands,proto3" json:"commands,omitempty"`
+	Hardened      bool                   `protobuf:"varint,3,opt,name=hardened,proto3" json:"hardened,omitempty"`
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	JailPath      string                 `protobuf:"bytes,5,opt,name=jail_path,json=jailPath,proto3" json:"jail_path,omitempty"`
+	RulesJson     string                 `protobuf:"bytes,6,opt,name=rules_json,json=rulesJson,proto3" json:"rules_json,omitempty"` // Jail policy rules, in the policy file's rule format
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Jail) Reset() {
+	*x = Jail{}
+	mi := &file_clawrden_v1_control_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Jail) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Jail) ProtoMessage() {}
+
+func (x *Jail) ProtoReflect() protoreflect.Message {
+	mi := &file_clawrden_v1_control_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Jail.ProtoReflect.Descriptor instead.
+func (*Jail) Descriptor() ([]byte, []int) {
+	return file_clawrden_v1_control_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *Jail) GetJailId() string {
+	if x != nil {
+		return x.JailId
+	}
+	return ""
+}
+
+func (x *Jail) GetCommands() []string {
+	if x != nil {
+		return x.Commands
+	}
+	return nil
+}
+
+func (x *Jail) GetHardened() bool {
+	if x != nil {
+		return x.Hardened
+	}
+	return false
+}
+
+func (x *Jail) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Jail) GetJailPath() string {
+	if x != nil {
+		return x.JailPath
+	}
+	return ""
+}
+
+func (x *Jail) GetRulesJson() string {
+	if x != nil {
+		return x.RulesJson
+	}
+	return ""
+}
+
+type ListJailsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListJailsRequest) Reset() {
+	*x = ListJailsRequest{}
+	mi := &file_clawrden_v1_control_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListJailsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListJailsRequest) ProtoMessage() {}
+
+func (x *ListJailsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clawrden_v1_control_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListJailsRequest.ProtoReflect.Descriptor instead.
+func (*ListJailsRequest) Descriptor() ([]byte, []int) {
+	return file_clawrden_v1_control_proto_rawDescGZIP(), []int{14}
+}
+
+type ListJailsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Jails         []*Jail                `protobuf:"bytes,1,rep,name=jails,proto3" json:"jails,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListJailsResponse) Reset() {
+	*x = ListJailsResponse{}
+	mi := &file_clawrden_v1_control_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListJailsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListJailsResponse) ProtoMessage() {}
+
+func (x *ListJailsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_clawrden_v1_control_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListJailsResponse.ProtoReflect.Descriptor instead.
+func (*ListJailsResponse) Descriptor() ([]byte, []int) {
+	return file_clawrden_v1_control_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *ListJailsResponse) GetJails() []*Jail {
+	if x != nil {
+		return x.Jails
+	}
+	return nil
+}
+
+type GetJailRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	JailId        string                 `protobuf:"bytes,1,opt,name=jail_id,json=jailId,proto3" json:"jail_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetJailRequest) Reset() {
+	*x = GetJailRequest{}
+	mi := &file_clawrden_v1_control_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetJailRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetJailRequest) ProtoMessage() {}
+
+func (x *GetJailRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clawrden_v1_control_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetJailRequest.ProtoReflect.Descriptor instead.
+func (*GetJailRequest) Descriptor() ([]byte, []int) {
+	return file_clawrden_v1_control_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *GetJailRequest) GetJailId() string {
+	if x != nil {
+		return x.JailId
+	}
+	return ""
+}
+
+type CreateJailRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	JailId        string                 `protobuf:"bytes,1,opt,name=jail_id,json=jailId,proto3" json:"jail_id,omitempty"`
+	Commands      []string               `protobuf:"bytes,2,rep,name=commands,proto3" json:"commands,omitempty"`
+	Hardened      bool                   `protobuf:"varint,3,opt,name=hardened,proto3" json:"hardened,omitempty"`
+	RulesJson     string                 `protobuf:"bytes,4,opt,name=rules_json,json=rulesJson,proto3" json:"rules_json,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateJailRequest) Reset() {
+	*x = CreateJailRequest{}
+	mi := &file_clawrden_v1_control_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateJailRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateJailRequest) ProtoMessage() {}
+
+func (x *CreateJailRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clawrden_v1_control_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateJailRequest.ProtoReflect.Descriptor instead.
+func (*CreateJailRequest) Descriptor() ([]byte, []int) {
+	return file_clawrden_v1_control_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *CreateJailRequest) GetJailId() string {
+	if x != nil {
+		return x.JailId
+	}
+	return ""
+}
+
+func (x *CreateJailRequest) GetCommands() []string {
+	if x != nil {
+		return x.Commands
+	}
+	return nil
+}
+
+func (x *CreateJailRequest) GetHardened() bool {
+	if x != nil {
+		return x.Hardened
+	}
+	return false
+}
+
+func (x *CreateJailRequest) GetRulesJson() string {
+	if x != nil {
+		return x.RulesJson
+	}
+	return ""
+}
+
+type DeleteJailRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	JailId        string                 `protobuf:"bytes,1,opt,name=jail_id,json=jailId,proto3" json:"jail_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteJailRequest) Reset() {
+	*x = DeleteJailRequest{}
+	mi := &file_clawrden_v1_control_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteJailRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteJailRequest) ProtoMessage() {}
+
+func (x *DeleteJailRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clawrden_v1_control_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteJailRequest.ProtoReflect.Descriptor instead.
+func (*DeleteJailRequest) Descriptor() ([]byte, []int) {
+	return file_clawrden_v1_control_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *DeleteJailRequest) GetJailId() string {
+	if x != nil {
+		return x.JailId
+	}
+	return ""
+}
+
+type DeleteJailResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteJailResponse) Reset() {
+	*x = DeleteJailResponse{}
+	mi := &file_clawrden_v1_control_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteJailResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteJailResponse) ProtoMessage() {}
+
+func (x *DeleteJailResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_clawrden_v1_control_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteJailResponse.ProtoReflect.Descriptor instead.
+func (*DeleteJailResponse) Descriptor() ([]byte, []int) {
+	return file_clawrden_v1_control_proto_rawDescGZIP(), []int{19}
+}
+
+type QueryHistoryRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Filters take the same values as the /api/history query parameters.
+	Command       string `protobuf:"bytes,1,opt,name=command,proto3" json:"command,omitempty"`
+	Decision      string `protobuf:"bytes,2,opt,name=decision,proto3" json:"decision,omitempty"`
+	Container     string `protobuf:"bytes,3,opt,name=container,proto3" json:"container,omitempty"`
+	TaskId        string `protobuf:"bytes,4,opt,name=task_id,json=taskId,proto3" json:"task_id,omitempty"`
+	Since         string `protobuf:"bytes,5,opt,name=since,proto3" json:"since,omitempty"`
+	Until         string `protobuf:"bytes,6,opt,name=until,proto3" json:"until,omitempty"`
+	Limit         int32  `protobuf:"varint,7,opt,name=limit,proto3" json:"limit,omitempty"` // Most recent entries to return; 0 returns all
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryHistoryRequest) Reset() {
+	*x = QueryHistoryRequest{}
+	mi := &file_clawrden_v1_control_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryHistoryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryHistoryRequest) ProtoMessage() {}
+
+func (x *QueryHistoryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clawrden_v1_control_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryHistoryRequest.ProtoReflect.Descriptor instead.
+func (*QueryHistoryRequest) Descriptor() ([]byte, []int) {
+	return file_clawrden_v1_control_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *QueryHistoryRequest) GetCommand() string {
+	if x != nil {
+		return x.Command
+	}
+	return ""
+}
+
+func (x *QueryHistoryRequest) GetDecision() string {
+	if x != nil {
+		return x.Decision
+	}
+	return ""
+}
+
+func (x *QueryHistoryRequest) GetContainer() string {
+	if x != nil {
+		return x.Container
+	}
+	return ""
+}
+
+func (x *QueryHistoryRequest) GetTaskId() string {
+	if x != nil {
+		return x.TaskId
+	}
+	return ""
+}
+
+func (x *QueryHistoryRequest) GetSince() string {
+	if x != nil {
+		return x.Since
+	}
+	return ""
+}
+
+func (x *QueryHistoryRequest) GetUntil() string {
+	if x != nil {
+		return x.Until
+	}
+	return ""
+}
+
+func (x *QueryHistoryRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type QueryHistoryResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Entries       []*AuditEntry          `protobuf:"bytes,1,rep,name=entries,proto3" json:"entries,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryHistoryResponse) Reset() {
+	*x = QueryHistoryResponse{}
+	mi := &file_clawrden_v1_control_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryHistoryResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryHistoryResponse) ProtoMessage() {}
+
+func (x *QueryHistoryResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_clawrden_v1_control_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryHistoryResponse.ProtoReflect.Descriptor instead.
+func (*QueryHistoryResponse) Descriptor() ([]byte, []int) {
+	return file_clawrden_v1_control_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *QueryHistoryResponse) GetEntries() []*AuditEntry {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+type AuditEntry struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Timestamp     string                 `protobuf:"bytes,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	RequestId     string                 `protobuf:"bytes,2,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	Command       string                 `protobuf:"bytes,3,opt,name=command,proto3" json:"command,omitempty"`
+	Args          []string               `protobuf:"bytes,4,rep,name=args,proto3" json:"args,omitempty"`
+	Cwd           string                 `protobuf:"bytes,5,opt,name=cwd,proto3" json:"cwd,omitempty"`
+	Uid           uint32                 `protobuf:"varint,6,opt,name=uid,proto3" json:"uid,omitempty"`
+	Gid           uint32                 `protobuf:"varint,7,opt,name=gid,proto3" json:"gid,omitempty"`
+	ContainerId   string                 `protobuf:"bytes,8,opt,name=container_id,json=containerId,proto3" json:"container_id,omitempty"`
+	JailId        string                 `protobuf:"bytes,9,opt,name=jail_id,json=jailId,proto3" json:"jail_id,omitempty"`
+	TaskId        string                 `protobuf:"bytes,10,opt,name=task_id,json=taskId,proto3" json:"task_id,omitempty"`
+	RunId         string                 `protobuf:"bytes,11,opt,name=run_id,json=runId,proto3" json:"run_id,omitempty"`
+	Decision      string                 `protobuf:"bytes,12,opt,name=decision,proto3" json:"decision,omitempty"`
+	ExitCode      int32                  `protobuf:"varint,13,opt,name=exit_code,json=exitCode,proto3" json:"exit_code,omitempty"`
+	DurationMs    float64                `protobuf:"fixed64,14,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`
+	Strategy      string                 `protobuf:"bytes,15,opt,name=strategy,proto3" json:"strategy,omitempty"`
+	Error         string                 `protobuf:"bytes,16,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AuditEntry) Reset() {
+	*x = AuditEntry{}
+	mi := &file_clawrden_v1_control_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AuditEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AuditEntry) ProtoMessage() {}
+
+func (x *AuditEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_clawrden_v1_control_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AuditEntry.ProtoReflect.Descriptor instead.
+func (*AuditEntry) Descriptor() ([]byte, []int) {
+	return file_clawrden_v1_control_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *AuditEntry) GetTimestamp() string {
+	if x != nil {
+		return x.Timestamp
+	}
+	return ""
+}
+
+func (x *AuditEntry) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *AuditEntry) GetCommand() string {
+	if x != nil {
+		return x.Command
+	}
+	return ""
+}
+
+func (x *AuditEntry) GetArgs() []string {
+	if x != nil {
+		return x.Args
+	}
+	return nil
+}
+
+func (x *AuditEntry) GetCwd() string {
+	if x != nil {
+		return x.Cwd
+	}
+	return ""
+}
+
+func (x *AuditEntry) GetUid() uint32 {
+	if x != nil {
+		return x.Uid
+	}
+	return 0
+}
+
+func (x *AuditEntry) GetGid() uint32 {
+	if x != nil {
+		return x.Gid
+	}
+	return 0
+}
+
+func (x *AuditEntry) GetContainerId() string {
+	if x != nil {
+		return x.ContainerId
+	}
+	return ""
+}
+
+func (x *AuditEntry) GetJailId() string {
+	if x != nil {
+		return x.JailId
+	}
+	return ""
+}
+
+func (x *AuditEntry) GetTaskId() string {
+	if x != nil {
+		return x.TaskId
+	}
+	return ""
+}
+
+func (x *AuditEntry) GetRunId() string {
+	if x != nil {
+		return x.RunId
+	}
+	return ""
+}
+
+func (x *AuditEntry) GetDecision() string {
+	if x != nil {
+		return x.Decision
+	}
+	return ""
+}
+
+func (x *AuditEntry) GetExitCode() int32 {
+	if x != nil {
+		return x.ExitCode
+	}
+	return 0
+}
+
+func (x *AuditEntry) GetDurationMs() float64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
+func (x *AuditEntry) GetStrategy() string {
+	if x != nil {
+		return x.Strategy
+	}
+	return ""
+}
+
+func (x *AuditEntry) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+var File_clawrden_v1_control_proto protoreflect.FileDescriptor
+
+const file_clawrden_v1_control_proto_rawDesc = "" +
+	"\n" +
+	"\x19clawrden/v1/control.proto\x12\vclawrden.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\x12\n" +
+	"\x10GetStatusRequest\"\xb7\x02\n" +
+	"\x11GetStatusResponse\x12#\n" +
+	"\rpending_count\x18\x01 \x01(\x05R\fpendingCount\x12%\n" +
+	"\x0eopen_incidents\x18\x02 \x01(\x05R\ropenIncidents\x128\n" +
+	"\tjailhouse\x18\x03 \x01(\v2\x1a.clawrden.v1.JailInventoryR\tjailhouse\x12-\n" +
+	"\abridges\x18\x04 \x03(\v2\x13.clawrden.v1.BridgeR\abridges\x121\n" +
+	"\x06docker\x18\x05 \x01(\v2\x19.clawrden.v1.DockerHealthR\x06docker\x12:\n" +
+	"\vmaintenance\x18\x06 \x01(\v2\x18.clawrden.v1.MaintenanceR\vmaintenance\"`\n" +
+	"\rJailInventory\x12\x14\n" +
+	"\x05jails\x18\x01 \x01(\x05R\x05jails\x12\x1a\n" +
+	"\bsymlinks\x18\x02 \x01(\x05R\bsymlinks\x12\x1d\n" +
+	"\n" +
+	"disk_bytes\x18\x03 \x01(\x03R\tdiskBytes\"\x99\x01\n" +
+	"\x06Bridge\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x18\n" +
+	"\aversion\x18\x03 \x01(\tR\aversion\x127\n" +
+	"\tlast_seen\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\blastSeen\x12\x14\n" +
+	"\x05stale\x18\x05 \x01(\bR\x05stale\"p\n" +
+	"\fDockerHealth\x12\x18\n" +
+	"\ahealthy\x18\x01 \x01(\bR\ahealthy\x120\n" +
+	"\x05since\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x05since\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\"i\n" +
+	"\vMaintenance\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x120\n" +
+	"\x05until\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\x05until\"\x12\n" +
+	"\x10ListQueueRequest\"L\n" +
+	"\x11ListQueueResponse\x127\n" +
+	"\brequests\x18\x01 \x03(\v2\x1b.clawrden.v1.PendingRequestR\brequests\"\xc2\x02\n" +
+	"\x0ePendingRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x18\n" +
+	"\acommand\x18\x02 \x01(\tR\acommand\x12\x12\n" +
+	"\x04args\x18\x03 \x03(\tR\x04args\x12\x10\n" +
+	"\x03cwd\x18\x04 \x01(\tR\x03cwd\x12\x10\n" +
+	"\x03uid\x18\x05 \x01(\rR\x03uid\x12\x10\n" +
+	"\x03gid\x18\x06 \x01(\rR\x03gid\x12\x16\n" +
+	"\x06groups\x18\a \x03(\tR\x06groups\x12!\n" +
+	"\fcontainer_id\x18\b \x01(\tR\vcontainerId\x12\x17\n" +
+	"\ajail_id\x18\t \x01(\tR\x06jailId\x12\x17\n" +
+	"\atask_id\x18\n" +
+	" \x01(\tR\x06taskId\x12\x15\n" +
+	"\x06run_id\x18\v \x01(\tR\x05runId\x128\n" +
+	"\ttimestamp\x18\f \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\"S\n" +
+	"\x0eResolveRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x121\n" +
+	"\bdecision\x18\x02 \x01(\x0e2\x15.clawrden.v1.DecisionR\bdecision\"\x11\n" +
+	"\x0fResolveResponse\"*\n" +
+	"\x12WatchEventsRequest\x12\x14\n" +
+	"\x05names\x18\x01 \x03(\tR\x05names\"\x96\x02\n" +
+	"\x05Event\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12.\n" +
+	"\x04time\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x0e\n" +
+	"\x02id\x18\x03 \x01(\tR\x02id\x12\x18\n" +
+	"\acommand\x18\x04 \x01(\tR\acommand\x12\x12\n" +
+	"\x04args\x18\x05 \x03(\tR\x04args\x12!\n" +
+	"\fcontainer_id\x18\x06 \x01(\tR\vcontainerId\x12\x17\n" +
+	"\ajail_id\x18\a \x01(\tR\x06jailId\x12\x17\n" +
+	"\atask_id\x18\b \x01(\tR\x06taskId\x12\x15\n" +
+	"\x06run_id\x18\t \x01(\tR\x05runId\x12\x1f\n" +
+	"\vdetail_json\x18\n" +
+	" \x01(\tR\n" +
+	"detailJson\"\xce\x01\n" +
+	"\x04Jail\x12\x17\n" +
+	"\ajail_id\x18\x01 \x01(\tR\x06jailId\x12\x1a\n" +
+	"\bcommands\x18\x02 \x03(\tR\bcommands\x12\x1a\n" +
+	"\bhardened\x18\x03 \x01(\bR\bhardened\x129\n" +
+	"\n" +
+	"created_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x12\x1b\n" +
+	"\tjail_path\x18\x05 \x01(\tR\bjailPath\x12\x1d\n" +
+	"\n" +
+	"rules_json\x18\x06 \x01(\tR\trulesJson\"\x12\n" +
+	"\x10ListJailsRequest\"<\n" +
+	"\x11ListJailsResponse\x12'\n" +
+	"\x05jails\x18\x01 \x03(\v2\x11.clawrden.v1.JailR\x05jails\")\n" +
+	"\x0eGetJailRequest\x12\x17\n" +
+	"\ajail_id\x18\x01 \x01(\tR\x06jailId\"\x83\x01\n" +
+	"\x11CreateJailRequest\x12\x17\n" +
+	"\ajail_id\x18\x01 \x01(\tR\x06jailId\x12\x1a\n" +
+	"\bcommands\x18\x02 \x03(\tR\bcommands\x12\x1a\n" +
+	"\bhardened\x18\x03 \x01(\bR\bhardened\x12\x1d\n" +
+	"\n" +
+	"rules_json\x18\x04 \x01(\tR\trulesJson\",\n" +
+	"\x11DeleteJailRequest\x12\x17\n" +
+	"\ajail_id\x18\x01 \x01(\tR\x06jailId\"\x14\n" +
+	"\x12DeleteJailResponse\"\xc4\x01\n" +
+	"\x13QueryHistoryRequest\x12\x18\n" +
+	"\acommand\x18\x01 \x01(\tR\acommand\x12\x1a\n" +
+	"\bdecision\x18\x02 \x01(\tR\bdecision\x12\x1c\n" +
+	"\tcontainer\x18\x03 \x01(\tR\tcontainer\x12\x17\n" +
+	"\atask_id\x18\x04 \x01(\tR\x06taskId\x12\x14\n" +
+	"\x05since\x18\x05 \x01(\tR\x05since\x12\x14\n" +
+	"\x05until\x18\x06 \x01(\tR\x05until\x12\x14\n" +
+	"\x05limit\x18\a \x01(\x05R\x05limit\"I\n" +
+	"\x14QueryHistoryResponse\x121\n" +
+	"\aentries\x18\x01 \x03(\v2\x17.clawrden.v1.AuditEntryR\aentries\"\xa5\x03\n" +
+	"\n" +
+	"AuditEntry\x12\x1c\n" +
+	"\ttimestamp\x18\x01 \x01(\tR\ttimestamp\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x02 \x01(\tR\trequestId\x12\x18\n" +
+	"\acommand\x18\x03 \x01(\tR\acommand\x12\x12\n" +
+	"\x04args\x18\x04 \x03(\tR\x04args\x12\x10\n" +
+	"\x03cwd\x18\x05 \x01(\tR\x03cwd\x12\x10\n" +
+	"\x03uid\x18\x06 \x01(\rR\x03uid\x12\x10\n" +
+	"\x03gid\x18\a \x01(\rR\x03gid\x12!\n" +
+	"\fcontainer_id\x18\b \x01(\tR\vcontainerId\x12\x17\n" +
+	"\ajail_id\x18\t \x01(\tR\x06jailId\x12\x17\n" +
+	"\atask_id\x18\n" +
+	" \x01(\tR\x06taskId\x12\x15\n" +
+	"\x06run_id\x18\v \x01(\tR\x05runId\x12\x1a\n" +
+	"\bdecision\x18\f \x01(\tR\bdecision\x12\x1b\n" +
+	"\texit_code\x18\r \x01(\x05R\bexitCode\x12\x1f\n" +
+	"\vduration_ms\x18\x0e \x01(\x01R\n" +
+	"durationMs\x12\x1a\n" +
+	"\bstrategy\x18\x0f \x01(\tR\bstrategy\x12\x14\n" +
+	"\x05error\x18\x10 \x01(\tR\x05error*M\n" +
+	"\bDecision\x12\x18\n" +
+	"\x14DECISION_UNSPECIFIED\x10\x00\x12\x14\n" +
+	"\x10DECISION_APPROVE\x10\x01\x12\x11\n" +
+	"\rDECISION_DENY\x10\x022\x9f\x05\n" +
+	"\rWardenControl\x12J\n" +
+	"\tGetStatus\x12\x1d.clawrden.v1.GetStatusRequest\x1a\x1e.clawrden.v1.GetStatusResponse\x12J\n" +
+	"\tListQueue\x12\x1d.clawrden.v1.ListQueueRequest\x1a\x1e.clawrden.v1.ListQueueResponse\x12D\n" +
+	"\aResolve\x12\x1b.clawrden.v1.ResolveRequest\x1a\x1c.clawrden.v1.ResolveResponse\x12D\n" +
+	"\vWatchEvents\x12\x1f.clawrden.v1.WatchEventsRequest\x1a\x12.clawrden.v1.Event0\x01\x12J\n" +
+	"\tListJails\x12\x1d.clawrden.v1.ListJailsRequest\x1a\x1e.clawrden.v1.ListJailsResponse\x129\n" +
+	"\aGetJail\x12\x1b.clawrden.v1.GetJailRequest\x1a\x11.clawrden.v1.Jail\x12?\n" +
+	"\n" +
+	"CreateJail\x12\x1e.clawrden.v1.CreateJailRequest\x1a\x11.clawrden.v1.Jail\x12M\n" +
+	"\n" +
+	"DeleteJail\x12\x1e.clawrden.v1.DeleteJailRequest\x1a\x1f.clawrden.v1.DeleteJailResponse\x12S\n" +
+	"\fQueryHistory\x12 .clawrden.v1.QueryHistoryRequest\x1a!.clawrden.v1.QueryHistoryResponseB\x16Z\x14clawrden/pkg/grpcapib\x06proto3"
+
+var (
+	file_clawrden_v1_control_proto_rawDescOnce sync.Once
+	file_clawrden_v1_control_proto_rawDescData []byte
+)
+
+func file_clawrden_v1_control_proto_rawDescGZIP() []byte {
+	file_clawrden_v1_control_proto_rawDescOnce.Do(func() {
+		file_clawrden_v1_control_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_clawrden_v1_control_proto_rawDesc), len(file_clawrden_v1_control_proto_rawDesc)))
+	})
+	return file_clawrden_v1_control_proto_rawDescData
+}
+
+var file_clawrden_v1_control_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_clawrden_v1_control_proto_msgTypes = make([]protoimpl.MessageInfo, 23)
+var file_clawrden_v1_control_proto_goTypes = []any{
+	(Decision)(0),                 // 0: clawrden.v1.Decision
+	(*GetStatusRequest)(nil),      // 1: clawrden.v1.GetStatusRequest
+	(*GetStatusResponse)(nil),     // 2: clawrden.v1.GetStatusResponse
+	(*JailInventory)(nil),         // 3: clawrden.v1.JailInventory
+	(*Bridge)(nil),                // 4: clawrden.v1.Bridge
+	(*DockerHealth)(nil),          // 5: clawrden.v1.DockerHealth
+	(*Maintenance)(nil),           // 6: clawrden.v1.Maintenance
+	(*ListQueueRequest)(nil),      // 7: clawrden.v1.ListQueueRequest
+	(*ListQueueResponse)(nil),     // 8: clawrden.v1.ListQueueResponse
+	(*PendingRequest)(nil),        // 9: clawrden.v1.PendingRequest
+	(*ResolveRequest)(nil),        // 10: clawrden.v1.ResolveRequest
+	(*ResolveResponse)(nil),       // 11: clawrden.v1.ResolveResponse
+	(*WatchEventsRequest)(nil),    // 12: clawrden.v1.WatchEventsRequest
+	(*Event)(nil),                 // 13: clawrden.v1.Event
+	(*Jail)(nil),                  // 14: clawrden.v1.Jail
+	(*ListJailsRequest)(nil),      // 15: clawrden.v1.ListJailsRequest
+	(*ListJailsResponse)(nil),     // 16: clawrden.v1.ListJailsResponse
+	(*GetJailRequest)(nil),        // 17: clawrden.v1.GetJailRequest
+	(*CreateJailRequest)(nil),     // 18: clawrden.v1.CreateJailRequest
+	(*DeleteJailRequest)(nil),     // 19: clawrden.v1.DeleteJailRequest
+	(*DeleteJailResponse)(nil),    // 20: clawrden.v1.DeleteJailResponse
+	(*QueryHistoryRequest)(nil),   // 21: clawrden.v1.QueryHistoryRequest
+	(*QueryHistoryResponse)(nil),  // 22: clawrden.v1.QueryHistoryResponse
+	(*AuditEntry)(nil),            // 23: clawrden.v1.AuditEntry
+	(*timestamppb.Timestamp)(nil), // 24: google.protobuf.Timestamp
+}
+var file_clawrden_v1_control_proto_depIdxs = []int32{
+	3,  // 0: clawrden.v1.GetStatusResponse.jailhouse:type_name -> clawrden.v1.JailInventory
+	4,  // 1: clawrden.v1.GetStatusResponse.bridges:type_name -> clawrden.v1.Bridge
+	5,  // 2: clawrden.v1.GetStatusResponse.docker:type_name -> clawrden.v1.DockerHealth
+	6,  // 3: clawrden.v1.GetStatusResponse.maintenance:type_name -> clawrden.v1.Maintenance
+	24, // 4: clawrden.v1.Bridge.last_seen:type_name -> google.protobuf.Timestamp
+	24, // 5: clawrden.v1.DockerHealth.since:type_name -> google.protobuf.Timestamp
+	24, // 6: clawrden.v1.Maintenance.until:type_name -> google.protobuf.Timestamp
+	9,  // 7: clawrden.v1.ListQueueResponse.requests:type_name -> clawrden.v1.PendingRequest
+	24, // 8: clawrden.v1.PendingRequest.timestamp:type_name -> google.protobuf.Timestamp
+	0,  // 9: clawrden.v1.ResolveRequest.decision:type_name -> clawrden.v1.Decision
+	24, // 10: clawrden.v1.Event.time:type_name -> google.protobuf.Timestamp
+	24, // 11: clawrden.v1.Jail.created_at:type_name -> google.protobuf.Timestamp
+	14, // 12: clawrden.v1.ListJailsResponse.jails:type_name -> clawrden.v1.Jail
+	23, // 13: clawrden.v1.QueryHistoryResponse.entries:type_name -> clawrden.v1.AuditEntry
+	1,  // 14: clawrden.v1.WardenControl.GetStatus:input_type -> clawrden.v1.GetStatusRequest
+	7,  // 15: clawrden.v1.WardenControl.ListQueue:input_type -> clawrden.v1.ListQueueRequest
+	10, // 16: clawrden.v1.WardenControl.Resolve:input_type -> clawrden.v1.ResolveRequest
+	12, // 17: clawrden.v1.WardenControl.WatchEvents:input_type -> clawrden.v1.WatchEventsRequest
+	15, // 18: clawrden.v1.WardenControl.ListJails:input_type -> clawrden.v1.ListJailsRequest
+	17, // 19: clawrden.v1.WardenControl.GetJail:input_type -> clawrden.v1.GetJailRequest
+	18, // 20: clawrden.v1.WardenControl.CreateJail:input_type -> clawrden.v1.CreateJailRequest
+	19, // 21: clawrden.v1.WardenControl.DeleteJail:input_type -> clawrden.v1.DeleteJailRequest
+	21, // 22: clawrden.v1.WardenControl.QueryHistory:input_type -> clawrden.v1.QueryHistoryRequest
+	2,  // 23: clawrden.v1.WardenControl.GetStatus:output_type -> clawrden.v1.GetStatusResponse
+	8,  // 24: clawrden.v1.WardenControl.ListQueue:output_type -> clawrden.v1.ListQueueResponse
+	11, // 25: clawrden.v1.WardenControl.Resolve:output_type -> clawrden.v1.ResolveResponse
+	13, // 26: clawrden.v1.WardenControl.WatchEvents:output_type -> clawrden.v1.Event
+	16, // 27: clawrden.v1.WardenControl.ListJails:output_type -> clawrden.v1.ListJailsResponse
+	14, // 28: clawrden.v1.WardenControl.GetJail:output_type -> clawrden.v1.Jail
+	14, // 29: clawrden.v1.WardenControl.CreateJail:output_type -> clawrden.v1.Jail
+	20, // 30: clawrden.v1.WardenControl.DeleteJail:output_type -> clawrden.v1.DeleteJailResponse
+	22, // 31: clawrden.v1.WardenControl.QueryHistory:output_type -> clawrden.v1.QueryHistoryResponse
+	23, // [23:32] is the sub-list for method output_type
+	14, // [14:23] is the sub-list for method input_type
+	14, // [14:14] is the sub-list for extension type_name
+	14, // [14:14] is the sub-list for extension extendee
+	0,  // [0:14] is the sub-list for field type_name
+}
+
+func init() { file_clawrden_v1_control_proto_init() }
+func file_clawrden_v1_control_proto_init() {
+	if File_clawrden_v1_control_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_clawrden_v1_control_proto_rawDesc), len(file_clawrden_v1_control_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   23,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_clawrden_v1_control_proto_goTypes,
+		DependencyIndexes: file_clawrden_v1_control_proto_depIdxs,
+		EnumInfos:         file_clawrden_v1_control_proto_enumTypes,
+		MessageInfos:      file_clawrden_v1_control_proto_msgTypes,
+	}.Build()
+	File_clawrden_v1_control_proto = out.File
+	file_clawrden_v1_control_proto_goTypes = nil
+	file_clawrden_v1_control_proto_depIdxs = nil
+}
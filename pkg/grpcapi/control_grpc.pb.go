@@ -0,0 +1,446 @@
+// WardenControl is the gRPC counterpart of the warden's HTTP API. Run
+// `make proto` after editing this file to regenerate pkg/grpcapi.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: clawrden/v1/control.proto
+
+package grpcapi
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	WardenControl_GetStatus_FullMethodName    = "/clawrden.v1.WardenControl/GetStatus"
+	WardenControl_ListQueue_FullMethodName    = "/clawrden.v1.WardenControl/ListQueue"
+	WardenControl_Resolve_FullMethodName      = "/clawrden.v1.WardenControl/Resolve"
+	WardenControl_WatchEvents_FullMethodName  = "/clawrden.v1.WardenControl/WatchEvents"
+	WardenControl_ListJails_FullMethodName    = "/clawrden.v1.WardenControl/ListJails"
+	WardenControl_GetJail_FullMethodName      = "/clawrden.v1.WardenControl/GetJail"
+	WardenControl_CreateJail_FullMethodName   = "/clawrden.v1.WardenControl/CreateJail"
+	WardenControl_DeleteJail_FullMethodName   = "/clawrden.v1.WardenControl/DeleteJail"
+	WardenControl_QueryHistory_FullMethodName = "/clawrden.v1.WardenControl/QueryHistory"
+)
+
+// WardenControlClient is the client API for WardenControl service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type WardenControlClient interface {
+	// GetStatus mirrors GET /api/status.
+	GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*GetStatusResponse, error)
+	// ListQueue mirrors GET /api/queue.
+	ListQueue(ctx context.Context, in *ListQueueRequest, opts ...grpc.CallOption) (*ListQueueResponse, error)
+	// Resolve mirrors POST /api/queue/{id}/approve and /deny.
+	Resolve(ctx context.Context, in *ResolveRequest, opts ...grpc.CallOption) (*ResolveResponse, error)
+	// WatchEvents streams warden events as they are published, starting with
+	// the first event after the call.
+	WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error)
+	// Jail CRUD, mirroring /api/jails and /api/jails/{id}.
+	ListJails(ctx context.Context, in *ListJailsRequest, opts ...grpc.CallOption) (*ListJailsResponse, error)
+	GetJail(ctx context.Context, in *GetJailRequest, opts ...grpc.CallOption) (*Jail, error)
+	CreateJail(ctx context.Context, in *CreateJailRequest, opts ...grpc.CallOption) (*Jail, error)
+	DeleteJail(ctx context.Context, in *DeleteJailRequest, opts ...grpc.CallOption) (*DeleteJailResponse, error)
+	// QueryHistory mirrors GET /api/history.
+	QueryHistory(ctx context.Context, in *QueryHistoryRequest, opts ...grpc.CallOption) (*QueryHistoryResponse, error)
+}
+
+type wardenControlClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewWardenControlClient(cc grpc.ClientConnInterface) WardenControlClient {
+	return &wardenControlClient{cc}
+}
+
+func (c *wardenControlClient) GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*GetStatusResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetStatusResponse)
+	err := c.cc.Invoke(ctx, WardenControl_GetStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wardenControlClient) ListQueue(ctx context.Context, in *ListQueueRequest, opts ...grpc.CallOption) (*ListQueueResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListQueueResponse)
+	err := c.cc.Invoke(ctx, WardenControl_ListQueue_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wardenControlClient) Resolve(ctx context.Context, in *ResolveRequest, opts ...grpc.CallOption) (*ResolveResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ResolveResponse)
+	err := c.cc.Invoke(ctx, WardenControl_Resolve_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wardenControlClient) WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &WardenControl_ServiceDesc.Streams[0], WardenControl_WatchEvents_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchEventsRequest, Event]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WardenControl_WatchEventsClient = grpc.ServerStreamingClient[Event]
+
+func (c *wardenControlClient) ListJails(ctx context.Context, in *ListJailsRequest, opts ...grpc.CallOption) (*ListJailsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListJailsResponse)
+	err := c.cc.Invoke(ctx, WardenControl_ListJails_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wardenControlClient) GetJail(ctx context.Context, in *GetJailRequest, opts ...grpc.CallOption) (*Jail, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Jail)
+	err := c.cc.Invoke(ctx, WardenControl_GetJail_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wardenControlClient) CreateJail(ctx context.Context, in *CreateJailRequest, opts ...grpc.CallOption) (*Jail, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Jail)
+	err := c.cc.Invoke(ctx, WardenControl_CreateJail_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wardenControlClient) DeleteJail(ctx context.Context, in *DeleteJailRequest, opts ...grpc.CallOption) (*DeleteJailResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteJailResponse)
+	err := c.cc.Invoke(ctx, WardenControl_DeleteJail_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wardenControlClient) QueryHistory(ctx context.Context, in *QueryHistoryRequest, opts ...grpc.CallOption) (*QueryHistoryResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(QueryHistoryResponse)
+	err := c.cc.Invoke(ctx, WardenControl_QueryHistory_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// WardenControlServer is the server API for WardenControl service.
+// All implementations must embed UnimplementedWardenControlServer
+// for forward compatibility.
+type WardenControlServer interface {
+	// GetStatus mirrors GET /api/status.
+	GetStatus(context.Context, *GetStatusRequest) (*GetStatusResponse, error)
+	// ListQueue mirrors GET /api/queue.
+	ListQueue(context.Context, *ListQueueRequest) (*ListQueueResponse, error)
+	// Resolve mirrors POST /api/queue/{id}/approve and /deny.
+	Resolve(context.Context, *ResolveRequest) (*ResolveResponse, error)
+	// WatchEvents streams warden events as they are published, starting with
+	// the first event after the call.
+	WatchEvents(*WatchEventsRequest, grpc.ServerStreamingServer[Event]) error
+	// Jail CRUD, mirroring /api/jails and /api/jails/{id}.
+	ListJails(context.Context, *ListJailsRequest) (*ListJailsResponse, error)
+	GetJail(context.Context, *GetJailRequest) (*Jail, error)
+	CreateJail(context.Context, *CreateJailRequest) (*Jail, error)
+	DeleteJail(context.Context, *DeleteJailRequest) (*DeleteJailResponse, error)
+	// QueryHistory mirrors GET /api/history.
+	QueryHistory(context.Context, *QueryHistoryRequest) (*QueryHistoryResponse, error)
+	mustEmbedUnimplementedWardenControlServer()
+}
+
+// UnimplementedWardenControlServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedWardenControlServer struct{}
+
+func (UnimplementedWardenControlServer) GetStatus(context.Context, *GetStatusRequest) (*GetStatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStatus not implemented")
+}
+func (UnimplementedWardenControlServer) ListQueue(context.Context, *ListQueueRequest) (*ListQueueResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListQueue not implemented")
+}
+func (UnimplementedWardenControlServer) Resolve(context.Context, *ResolveRequest) (*ResolveResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Resolve not implemented")
+}
+func (UnimplementedWardenControlServer) WatchEvents(*WatchEventsRequest, grpc.ServerStreamingServer[Event]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchEvents not implemented")
+}
+func (UnimplementedWardenControlServer) ListJails(context.Context, *ListJailsRequest) (*ListJailsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListJails not implemented")
+}
+func (UnimplementedWardenControlServer) GetJail(context.Context, *GetJailRequest) (*Jail, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetJail not implemented")
+}
+func (UnimplementedWardenControlServer) CreateJail(context.Context, *CreateJailRequest) (*Jail, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateJail not implemented")
+}
+func (UnimplementedWardenControlServer) DeleteJail(context.Context, *DeleteJailRequest) (*DeleteJailResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteJail not implemented")
+}
+func (UnimplementedWardenControlServer) QueryHistory(context.Context, *QueryHistoryRequest) (*QueryHistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QueryHistory not implemented")
+}
+func (UnimplementedWardenControlServer) mustEmbedUnimplementedWardenControlServer() {}
+func (UnimplementedWardenControlServer) testEmbeddedByValue()                       {}
+
+// UnsafeWardenControlServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to WardenControlServer will
+// result in compilation errors.
+type UnsafeWardenControlServer interface {
+	mustEmbedUnimplementedWardenControlServer()
+}
+
+func RegisterWardenControlServer(s grpc.ServiceRegistrar, srv WardenControlServer) {
+	// If the following call pancis, it indicates UnimplementedWardenControlServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&WardenControl_ServiceDesc, srv)
+}
+
+func _WardenControl_GetStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WardenControlServer).GetStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WardenControl_GetStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WardenControlServer).GetStatus(ctx, req.(*GetStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WardenControl_ListQueue_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListQueueRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WardenControlServer).ListQueue(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WardenControl_ListQueue_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WardenControlServer).ListQueue(ctx, req.(*ListQueueRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WardenControl_Resolve_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResolveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WardenControlServer).Resolve(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WardenControl_Resolve_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WardenControlServer).Resolve(ctx, req.(*ResolveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WardenControl_WatchEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(WardenControlServer).WatchEvents(m, &grpc.GenericServerStream[WatchEventsRequest, Event]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WardenControl_WatchEventsServer = grpc.ServerStreamingServer[Event]
+
+func _WardenControl_ListJails_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListJailsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WardenControlServer).ListJails(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WardenControl_ListJails_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WardenControlServer).ListJails(ctx, req.(*ListJailsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WardenControl_GetJail_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetJailRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WardenControlServer).GetJail(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WardenControl_GetJail_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WardenControlServer).GetJail(ctx, req.(*GetJailRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WardenControl_CreateJail_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateJailRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WardenControlServer).CreateJail(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WardenControl_CreateJail_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WardenControlServer).CreateJail(ctx, req.(*CreateJailRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WardenControl_DeleteJail_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteJailRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WardenControlServer).DeleteJail(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WardenControl_DeleteJail_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WardenControlServer).DeleteJail(ctx, req.(*DeleteJailRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WardenControl_QueryHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WardenControlServer).QueryHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WardenControl_QueryHistory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WardenControlServer).QueryHistory(ctx, req.(*QueryHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// WardenControl_ServiceDesc is the grpc.ServiceDesc for WardenControl service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var WardenControl_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "clawrden.v1.WardenControl",
+	HandlerType: (*WardenControlServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetStatus",
+			Handler:    _WardenControl_GetStatus_Handler,
+		},
+		{
+			MethodName: "ListQueue",
+			Handler:    _WardenControl_ListQueue_Handler,
+		},
+		{
+			MethodName: "Resolve",
+			Handler:    _WardenControl_Resolve_Handler,
+		},
+		{
+			MethodName: "ListJails",
+			Handler:    _WardenControl_ListJails_Handler,
+		},
+		{
+			MethodName: "GetJail",
+			Handler:    _WardenControl_GetJail_Handler,
+		},
+		{
+			MethodName: "CreateJail",
+			Handler:    _WardenControl_CreateJail_Handler,
+		},
+		{
+			MethodName: "DeleteJail",
+			Handler:    _WardenControl_DeleteJail_Handler,
+		},
+		{
+			MethodName: "QueryHistory",
+			Handler:    _WardenControl_QueryHistory_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchEvents",
+			Handler:       _WardenControl_WatchEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "clawrden/v1/control.proto",
+}
@@ -0,0 +1,4 @@
+// Package grpcapi is the generated client and server code for the warden's
+// WardenControl gRPC service, defined in api/proto/clawrden/v1/control.proto.
+// Regenerate it with `make proto`.
+package grpcapi
@@ -0,0 +1,52 @@
+// Package labels defines the Docker container labels the Warden reads to
+// provision jails automatically. Agent containers declare their jail with:
+//
+//	clawrden.jail=agent-x
+//	clawrden.commands=npm,git,python
+//	clawrden.mode=hardened   (optional)
+package labels
+
+import "strings"
+
+const (
+	// Jail names the jail the container's shims live in.
+	Jail = "clawrden.jail"
+
+	// Commands is a comma-separated list of commands to intercept.
+	Commands = "clawrden.commands"
+
+	// Mode selects the jail mode; ModeHardened creates a hardened jail.
+	Mode = "clawrden.mode"
+
+	// ModeHardened is the Mode value for hardened jails.
+	ModeHardened = "hardened"
+)
+
+// JailSpec is the jail requested by a container's labels.
+type JailSpec struct {
+	JailID   string
+	Commands []string
+	Hardened bool
+}
+
+// ParseJail reads the jail labels from a container's label set.
+// It returns false when the container does not request a jail.
+func ParseJail(labels map[string]string) (JailSpec, bool) {
+	jailID := strings.TrimSpace(labels[Jail])
+	if jailID == "" {
+		return JailSpec{}, false
+	}
+
+	var commands []string
+	for _, cmd := range strings.Split(labels[Commands], ",") {
+		if cmd = strings.TrimSpace(cmd); cmd != "" {
+			commands = append(commands, cmd)
+		}
+	}
+
+	return JailSpec{
+		JailID:   jailID,
+		Commands: commands,
+		Hardened: strings.EqualFold(strings.TrimSpace(labels[Mode]), ModeHardened),
+	}, true
+}
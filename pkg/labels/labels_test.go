@@ -0,0 +1,45 @@
+package labels
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseJail(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   JailSpec
+		ok     bool
+	}{
+		{
+			name:   "no jail label",
+			labels: map[string]string{"com.example": "x"},
+			ok:     false,
+		},
+		{
+			name:   "commands are trimmed",
+			labels: map[string]string{Jail: "agent-x", Commands: " npm, git,,python "},
+			want:   JailSpec{JailID: "agent-x", Commands: []string{"npm", "git", "python"}},
+			ok:     true,
+		},
+		{
+			name:   "hardened mode",
+			labels: map[string]string{Jail: "agent-y", Commands: "ls", Mode: "Hardened"},
+			want:   JailSpec{JailID: "agent-y", Commands: []string{"ls"}, Hardened: true},
+			ok:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseJail(tt.labels)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseJail = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
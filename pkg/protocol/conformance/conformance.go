@@ -0,0 +1,543 @@
+// Package conformance pins down the shim protocol as whole conversations:
+// what the shim sends, every ack and frame the Warden answers with, and what
+// each side makes of it — the shim's exit code and output, the Warden's
+// audit decision.
+//
+// The same scenarios drive both sides. RunShim plays the Warden's part,
+// byte for byte, against the real shim; RunWarden plays the shim's part
+// against a real Warden loaded with the scenario's policy and checks that
+// it writes exactly the scenario's acks and frames. Scenarios without a
+// policy script wardens this one never is — older, newer or broken ones —
+// and only the shim is run against them.
+//
+// Anything a side does not recognize must end in a denial or an error, never
+// in a command running: an unknown ack, a repeated pending ack or output
+// after a denial does not run or print anything.
+package conformance
+
+import (
+	"bytes"
+	"clawrden/pkg/protocol"
+	"clawrden/pkg/wardentest"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+)
+
+// Step is one thing the Warden writes: an ack byte or a frame.
+type Step struct {
+	Ack   byte
+	Frame *protocol.Frame // Nil for an ack
+}
+
+// Ack is an ack step.
+func Ack(ack byte) Step {
+	return Step{Ack: ack}
+}
+
+// Frame is a frame step.
+func Frame(typ byte, payload string) Step {
+	return Step{Frame: &protocol.Frame{Type: typ, Payload: []byte(payload)}}
+}
+
+// Stdout and Stderr are output frames.
+func Stdout(s string) Step { return Frame(protocol.StreamStdout, s) }
+func Stderr(s string) Step { return Frame(protocol.StreamStderr, s) }
+
+// Exit is an exit frame.
+func Exit(code int) Step {
+	return Frame(protocol.StreamExit, string(binary.BigEndian.AppendUint32(nil, uint32(int32(code)))))
+}
+
+// LegacyExit is the exit frame shims before protocol.ExitCodeVersion get:
+// a single byte (see protocol.ExitStatus).
+func LegacyExit(code int) Step {
+	return Frame(protocol.StreamExit, string([]byte{byte(protocol.ExitStatus(code))}))
+}
+
+// Reason is a denial reason frame.
+func Reason(reason string) Step {
+	return Frame(protocol.StreamReason, reason)
+}
+
+// Meta is a metadata frame announcing decision and outcome. Against the
+// Warden, only those are compared; the request ID must match the audit
+// entry's.
+func Meta(decision protocol.Decision, outcome protocol.Outcome) Step {
+	payload, _ := json.Marshal(protocol.ExecMetadata{
+		RequestID:     "req-conformance",
+		Decision:      decision,
+		Outcome:       outcome,
+		WardenVersion: protocol.ProtocolVersion,
+	})
+	return Frame(protocol.StreamMeta, string(payload))
+}
+
+// SessionMeta is the metadata frame of a request in a persistent session,
+// which the Warden keeps open once the request has ended.
+func SessionMeta(decision protocol.Decision, outcome protocol.Outcome) Step {
+	payload, _ := json.Marshal(protocol.ExecMetadata{
+		RequestID:     "req-conformance",
+		Decision:      decision,
+		Outcome:       outcome,
+		WardenVersion: protocol.ProtocolVersion,
+		SessionOpen:   true,
+	})
+	return Frame(protocol.StreamMeta, string(payload))
+}
+
+// Queued is the metadata frame a shim of protocol.PendingMetaVersion or
+// later is sent once its request is queued for review. Against the Warden,
+// the queue position is compared and the request ID must be set.
+func Queued(meta protocol.ExecMetadata) Step {
+	meta.WardenVersion = protocol.ProtocolVersion
+	payload, _ := json.Marshal(meta)
+	return Frame(protocol.StreamMeta, string(payload))
+}
+
+// current is req as a shim of this build sends it.
+func current(req *protocol.Request) *protocol.Request {
+	req.Version = protocol.ProtocolVersion
+	return req
+}
+
+// persistent is req opening a persistent session.
+func persistent(req *protocol.Request) *protocol.Request {
+	req = current(req)
+	req.Persistent = true
+	return req
+}
+
+// Bytes encodes steps as the Warden writes them.
+func Bytes(steps []Step) []byte {
+	var buf bytes.Buffer
+	for _, s := range steps {
+		if s.Frame == nil {
+			protocol.WriteAck(&buf, s.Ack)
+			continue
+		}
+		protocol.WriteFrame(&buf, *s.Frame)
+	}
+	return buf.Bytes()
+}
+
+// String describes a step for failure messages.
+func (s Step) String() string {
+	if s.Frame == nil {
+		return fmt.Sprintf("ack %d", s.Ack)
+	}
+	return fmt.Sprintf("frame type %d %q", s.Frame.Type, s.Frame.Payload)
+}
+
+// match reports how a frame the Warden wrote differs from the step.
+func (s Step) match(got protocol.Frame) error {
+	if s.Frame == nil || got.Type != s.Frame.Type {
+		return fmt.Errorf("got frame type %d %q, want %v", got.Type, got.Payload, s)
+	}
+	if got.Type != protocol.StreamMeta {
+		if !bytes.Equal(got.Payload, s.Frame.Payload) {
+			return fmt.Errorf("got frame type %d %q, want %v", got.Type, got.Payload, s)
+		}
+		return nil
+	}
+	meta, err := protocol.ParseMetadata(got)
+	if err != nil {
+		return err
+	}
+	want, _ := protocol.ParseMetadata(*s.Frame)
+	if meta.Decision != want.Decision || meta.Outcome != want.Outcome || meta.QueuePosition != want.QueuePosition || meta.SessionOpen != want.SessionOpen ||
+		meta.RequestID == "" || meta.WardenVersion != protocol.ProtocolVersion {
+		return fmt.Errorf("got metadata %s, want decision %q, outcome %q, queue position %d, session open %v, a request ID and version %d",
+			got.Payload, want.Decision, want.Outcome, want.QueuePosition, want.SessionOpen, protocol.ProtocolVersion)
+	}
+	return nil
+}
+
+// Scenario is one conversation between the shim and the Warden.
+type Scenario struct {
+	Name string
+
+	// Policy is the Warden's; nil for scenarios only the shim is run
+	// against.
+	Policy *wardentest.Policy
+
+	// Request is what the shim sends. RawRequest is sent instead when set,
+	// and only the Warden is run against it. An empty Cwd is the Warden's
+	// directory.
+	Request    *protocol.Request
+	RawRequest []byte
+
+	// Review is how the reviewer decides an ask.
+	Review wardentest.Decision
+
+	// Warden is what the Warden writes, in order, before hanging up.
+	Warden []Step
+
+	// What the shim makes of it: its exit code, what it prints and its
+	// result decision and outcome. They are also what the Warden audits;
+	// DecisionNone means nothing is audited.
+	ExitCode int
+	Stdout   string
+	Stderr   []string // Substrings of the shim's stderr
+	Decision protocol.Decision
+	Outcome  protocol.Outcome
+}
+
+// pendingAgain is a repeated pending ack, as a broken or confused Warden
+// might send while the shim awaits approval.
+var pendingAgain = Ack(protocol.AckPendingHITL)
+
+// Scenarios is every conversation both sides must agree on.
+var Scenarios = []Scenario{
+	// What this Warden says
+	{
+		Name:     "allowed command streams its output",
+		Policy:   wardentest.AllowPolicy("echo"),
+		Request:  wardentest.NewRequest("echo", "hi"),
+		Warden:   []Step{Ack(protocol.AckAllowed), Meta(protocol.DecisionAllow, protocol.OutcomeNone), Stdout("hi\n"), LegacyExit(0)},
+		Stdout:   "hi\n",
+		Decision: protocol.DecisionAllow,
+	},
+	{
+		Name:     "exit code and stderr are passed on",
+		Policy:   wardentest.AllowPolicy("sh"),
+		Request:  wardentest.NewRequest("sh", "-c", "echo oops >&2; exit 3"),
+		Warden:   []Step{Ack(protocol.AckAllowed), Meta(protocol.DecisionAllow, protocol.OutcomeNone), Stderr("oops\n"), LegacyExit(3)},
+		ExitCode: 3,
+		Stderr:   []string{"oops\n"},
+		Decision: protocol.DecisionAllow,
+	},
+	{
+		// Older shims get the single byte above
+		Name:     "exit code to a current shim: four bytes",
+		Policy:   wardentest.AllowPolicy("sh"),
+		Request:  current(wardentest.NewRequest("sh", "-c", "exit 3")),
+		Warden:   []Step{Ack(protocol.AckAllowed), Meta(protocol.DecisionAllow, protocol.OutcomeNone), Exit(3)},
+		ExitCode: 3,
+		Decision: protocol.DecisionAllow,
+	},
+	{
+		Name:     "denied by policy",
+		Policy:   wardentest.AllowPolicy("echo"),
+		Request:  wardentest.NewRequest("rm", "-rf", "/"),
+		Warden:   []Step{Ack(protocol.AckDenied), Meta(protocol.DecisionDeny, protocol.OutcomeNone)},
+		ExitCode: 1,
+		Stderr:   []string{"command denied by policy"},
+		Decision: protocol.DecisionDeny,
+	},
+	{
+		// The denial comes first: nothing may precede the ack
+		Name:     "path violation is a clean denial",
+		Policy:   &wardentest.Policy{DefaultAction: wardentest.Allow, AllowedPaths: []string{"/app/*"}},
+		Request:  &protocol.Request{Command: "echo", Args: []string{"hi"}, Cwd: "/etc"},
+		Warden:   []Step{Ack(protocol.AckDenied), Meta(protocol.DecisionDeny, protocol.OutcomePathViolation)},
+		ExitCode: 1,
+		Stderr:   []string{"command denied by policy"},
+		Decision: protocol.DecisionDeny,
+		Outcome:  protocol.OutcomePathViolation,
+	},
+	{
+		Name:     "approved ask: pending ack, then allowed",
+		Policy:   wardentest.AskPolicy("echo"),
+		Request:  wardentest.NewRequest("echo", "hi"),
+		Review:   wardentest.Approve,
+		Warden:   []Step{Ack(protocol.AckPendingHITL), Ack(protocol.AckAllowed), Meta(protocol.DecisionAllow, protocol.OutcomeAfterHITL), Stdout("hi\n"), LegacyExit(0)},
+		Stdout:   "hi\n",
+		Stderr:   []string{"awaiting approval"},
+		Decision: protocol.DecisionAllow,
+		Outcome:  protocol.OutcomeAfterHITL,
+	},
+	{
+		// Older shims get the approved ask above
+		Name:    "approved ask from a current shim: pending ack, metadata, then allowed",
+		Policy:  wardentest.AskPolicy("echo"),
+		Request: current(wardentest.NewRequest("echo", "hi")),
+		Review:  wardentest.Approve,
+		Warden: []Step{
+			Ack(protocol.AckPendingHITL),
+			Queued(protocol.ExecMetadata{RequestID: "req-conformance", QueuePosition: 1}),
+			Ack(protocol.AckAllowed),
+			Meta(protocol.DecisionAllow, protocol.OutcomeAfterHITL),
+			Stdout("hi\n"),
+			Exit(0),
+		},
+		Stdout:   "hi\n",
+		Stderr:   []string{"awaiting approval: req-conformance\n"},
+		Decision: protocol.DecisionAllow,
+		Outcome:  protocol.OutcomeAfterHITL,
+	},
+	{
+		Name:     "rejected ask: pending ack, then denied",
+		Policy:   wardentest.AskPolicy("echo"),
+		Request:  wardentest.NewRequest("echo", "hi"),
+		Review:   wardentest.Reject,
+		Warden:   []Step{Ack(protocol.AckPendingHITL), Ack(protocol.AckDenied), Meta(protocol.DecisionDeny, protocol.OutcomeAfterHITL)},
+		ExitCode: 1,
+		Stderr:   []string{"awaiting approval", "command denied by reviewer"},
+		Decision: protocol.DecisionDeny,
+		Outcome:  protocol.OutcomeAfterHITL,
+	},
+	{
+		Name:    "unknown request type is denied, not run",
+		Policy:  wardentest.AllowPolicy("echo"),
+		Request: &protocol.Request{Type: "telepathy", Command: "echo", Args: []string{"hi"}},
+		Warden: []Step{
+			Ack(protocol.AckDenied),
+			Reason(fmt.Sprintf(`this warden (protocol version %d) does not know "telepathy" requests`, protocol.ProtocolVersion)),
+			Meta(protocol.DecisionDeny, protocol.OutcomeUnknownRequestType),
+		},
+		ExitCode: 1,
+		Stderr:   []string{fmt.Sprintf(`command denied: this warden (protocol version %d) does not know "telepathy" requests`, protocol.ProtocolVersion)},
+		Decision: protocol.DecisionDeny,
+		Outcome:  protocol.OutcomeUnknownRequestType,
+	},
+	{
+		Name:       "malformed request is dropped unanswered",
+		Policy:     wardentest.AllowPolicy("echo"),
+		RawRequest: []byte{0, 0, 0, 5, '{', 'n', 'o', 'p', 'e'},
+	},
+
+	// What older, newer and broken wardens say
+	{
+		Name:     "old warden: no metadata, empty exit frame",
+		Request:  wardentest.NewRequest("echo", "hi"),
+		Warden:   []Step{Ack(protocol.AckAllowed), Stdout("hi\n"), Frame(protocol.StreamExit, "")},
+		Stdout:   "hi\n",
+		Decision: protocol.DecisionAllow,
+	},
+	{
+		Name:     "old warden: denial without metadata",
+		Request:  wardentest.NewRequest("rm"),
+		Warden:   []Step{Ack(protocol.AckDenied)},
+		ExitCode: 1,
+		Stderr:   []string{"command denied by policy"},
+		Decision: protocol.DecisionDeny,
+	},
+	{
+		Name:     "denial with a reason",
+		Request:  wardentest.NewRequest("rm"),
+		Warden:   []Step{Ack(protocol.AckDenied), Reason("warden maintenance: upgrading"), Meta(protocol.DecisionDeny, protocol.OutcomeMaintenance)},
+		ExitCode: 1,
+		Stderr:   []string{"command denied: warden maintenance: upgrading"},
+		Decision: protocol.DecisionDeny,
+		Outcome:  protocol.OutcomeMaintenance,
+	},
+	{
+		Name:     "output after a denial is not printed",
+		Request:  wardentest.NewRequest("rm"),
+		Warden:   []Step{Ack(protocol.AckDenied), Stdout("removed everything\n"), Exit(0)},
+		ExitCode: 1,
+		Stderr:   []string{"command denied by policy"},
+		Decision: protocol.DecisionDeny,
+	},
+	{
+		Name:     "exit codes beyond a byte arrive whole",
+		Request:  current(wardentest.NewRequest("make")),
+		Warden:   []Step{Ack(protocol.AckAllowed), Meta(protocol.DecisionAllow, protocol.OutcomeNone), Exit(512)},
+		ExitCode: 512,
+		Decision: protocol.DecisionAllow,
+	},
+	{
+		Name:     "one-byte exit code from an older warden",
+		Request:  wardentest.NewRequest("make"),
+		Warden:   []Step{Ack(protocol.AckAllowed), Meta(protocol.DecisionAllow, protocol.OutcomeNone), LegacyExit(2)},
+		ExitCode: 2,
+		Decision: protocol.DecisionAllow,
+	},
+	{
+		Name:     "unknown frames from a newer warden are skipped",
+		Request:  wardentest.NewRequest("echo", "hi"),
+		Warden:   []Step{Ack(protocol.AckAllowed), Meta(protocol.DecisionAllow, protocol.OutcomeNone), Frame(42, "from the future"), Stdout("hi\n"), Exit(0)},
+		Stdout:   "hi\n",
+		Decision: protocol.DecisionAllow,
+	},
+	{
+		Name:    "pending metadata says where the request stands",
+		Request: current(wardentest.NewRequest("echo", "hi")),
+		Warden: []Step{
+			Ack(protocol.AckPendingHITL),
+			Queued(protocol.ExecMetadata{
+				RequestID:          "req-conformance",
+				QueuePosition:      4,
+				HITLTimeoutSeconds: 600,
+				ReviewURL:          "https://warden.example.com/#req-conformance",
+			}),
+			Ack(protocol.AckDenied),
+			Meta(protocol.DecisionDeny, protocol.OutcomeAfterHITL),
+		},
+		ExitCode: 1,
+		Stderr: []string{
+			"awaiting approval: req-conformance (3 ahead, expires in 10m), approve at https://warden.example.com/#req-conformance\n",
+			"command denied by reviewer",
+		},
+		Decision: protocol.DecisionDeny,
+		Outcome:  protocol.OutcomeAfterHITL,
+	},
+	{
+		Name:     "unknown ack",
+		Request:  wardentest.NewRequest("echo", "hi"),
+		Warden:   []Step{Ack(7), Stdout("hi\n"), Exit(0)},
+		ExitCode: 1,
+		Stderr:   []string{"unknown ack: 7"},
+		Decision: protocol.DecisionError,
+	},
+	{
+		Name:     "repeated pending ack is not an approval",
+		Request:  wardentest.NewRequest("echo", "hi"),
+		Warden:   []Step{Ack(protocol.AckPendingHITL), pendingAgain, Meta(protocol.DecisionAllow, protocol.OutcomeNone), Stdout("hi\n"), Exit(0)},
+		ExitCode: 1,
+		Stderr:   []string{"awaiting approval", "unknown ack after approval wait: 2"},
+		Decision: protocol.DecisionError,
+	},
+	{
+		Name:     "unknown ack after the approval wait",
+		Request:  wardentest.NewRequest("echo", "hi"),
+		Warden:   []Step{Ack(protocol.AckPendingHITL), Ack(9), Stdout("hi\n"), Exit(0)},
+		ExitCode: 1,
+		Stderr:   []string{"unknown ack after approval wait: 9"},
+		Decision: protocol.DecisionError,
+	},
+	{
+		Name:     "hang-up before the ack",
+		Request:  wardentest.NewRequest("echo", "hi"),
+		ExitCode: 1,
+		Stderr:   []string{"failed to read ack"},
+		Decision: protocol.DecisionError,
+	},
+	{
+		Name:     "hang-up while awaiting approval",
+		Request:  wardentest.NewRequest("echo", "hi"),
+		Warden:   []Step{Ack(protocol.AckPendingHITL)},
+		ExitCode: 1,
+		Stderr:   []string{"lost connection while awaiting approval"},
+		Decision: protocol.DecisionError,
+	},
+	{
+		Name:     "hang-up before the exit frame",
+		Request:  wardentest.NewRequest("echo", "hi"),
+		Warden:   []Step{Ack(protocol.AckAllowed), Meta(protocol.DecisionAllow, protocol.OutcomeNone), Stdout("hi\n")},
+		ExitCode: 125,
+		Stdout:   "hi\n",
+		Stderr:   []string{"connection closed unexpectedly before the command's exit code (after 2 frames)"},
+		Decision: protocol.DecisionAllow,
+	},
+	{
+		// The shim reads the frame's type byte as a pending ack and the
+		// first byte of its length as the approval; the rest does not parse,
+		// so nothing is printed and the shim reports a broken stream
+		Name:     "stderr frame before the ack",
+		Request:  wardentest.NewRequest("echo", "hi"),
+		Warden:   []Step{Stderr("path not allowed\n"), Ack(protocol.AckDenied), Meta(protocol.DecisionDeny, protocol.OutcomePathViolation)},
+		ExitCode: 125,
+		Stderr:   []string{"stream error at frame 1"},
+		Decision: protocol.DecisionAllow,
+	},
+}
+
+// SessionScenario is a persistent session: requests the shim sends one after
+// another on the same connection, each answered as in a Scenario. Only the
+// Warden is run against them.
+type SessionScenario struct {
+	Name   string
+	Policy *wardentest.Policy
+	Turns  []Turn
+
+	// HangsUp is whether the Warden ends the session after the last turn;
+	// otherwise the shim does
+	HangsUp bool
+}
+
+// Turn is one request of a session: what the shim sends, how the reviewer
+// decides an ask, what the Warden writes and what it audits.
+type Turn struct {
+	Request  *protocol.Request
+	Review   wardentest.Decision
+	Warden   []Step
+	Decision protocol.Decision
+	Outcome  protocol.Outcome
+}
+
+// Sessions is every persistent session both sides must agree on.
+var Sessions = []SessionScenario{
+	{
+		// Only the first request needs to ask for the session
+		Name:   "each request of a session is answered in turn",
+		Policy: wardentest.AllowPolicy("echo", "sh"),
+		Turns: []Turn{
+			{
+				Request:  persistent(wardentest.NewRequest("echo", "one")),
+				Warden:   []Step{Ack(protocol.AckAllowed), SessionMeta(protocol.DecisionAllow, protocol.OutcomeNone), Stdout("one\n"), Exit(0)},
+				Decision: protocol.DecisionAllow,
+			},
+			{
+				Request:  current(wardentest.NewRequest("sh", "-c", "echo oops >&2; exit 3")),
+				Warden:   []Step{Ack(protocol.AckAllowed), SessionMeta(protocol.DecisionAllow, protocol.OutcomeNone), Stderr("oops\n"), Exit(3)},
+				Decision: protocol.DecisionAllow,
+			},
+			{
+				Request:  current(wardentest.NewRequest("rm", "-rf", "/")),
+				Warden:   []Step{Ack(protocol.AckDenied), SessionMeta(protocol.DecisionDeny, protocol.OutcomeNone)},
+				Decision: protocol.DecisionDeny,
+			},
+			{
+				Request:  current(wardentest.NewRequest("echo", "two")),
+				Warden:   []Step{Ack(protocol.AckAllowed), SessionMeta(protocol.DecisionAllow, protocol.OutcomeNone), Stdout("two\n"), Exit(0)},
+				Decision: protocol.DecisionAllow,
+			},
+		},
+	},
+	{
+		Name:   "each ask in a session is reviewed on its own",
+		Policy: wardentest.AskPolicy("echo"),
+		Turns: []Turn{
+			{
+				Request: persistent(wardentest.NewRequest("echo", "one")),
+				Review:  wardentest.Reject,
+				Warden: []Step{
+					Ack(protocol.AckPendingHITL),
+					Queued(protocol.ExecMetadata{RequestID: "req-conformance", QueuePosition: 1}),
+					Ack(protocol.AckDenied),
+					SessionMeta(protocol.DecisionDeny, protocol.OutcomeAfterHITL),
+				},
+				Decision: protocol.DecisionDeny,
+				Outcome:  protocol.OutcomeAfterHITL,
+			},
+			{
+				Request: current(wardentest.NewRequest("echo", "two")),
+				Review:  wardentest.Approve,
+				Warden: []Step{
+					Ack(protocol.AckPendingHITL),
+					Queued(protocol.ExecMetadata{RequestID: "req-conformance", QueuePosition: 1}),
+					Ack(protocol.AckAllowed),
+					SessionMeta(protocol.DecisionAllow, protocol.OutcomeAfterHITL),
+					Stdout("two\n"),
+					Exit(0),
+				},
+				Decision: protocol.DecisionAllow,
+				Outcome:  protocol.OutcomeAfterHITL,
+			},
+		},
+	},
+	{
+		Name:   "a malformed request ends the session",
+		Policy: wardentest.AllowPolicy("echo"),
+		Turns: []Turn{
+			{
+				Request:  persistent(wardentest.NewRequest("echo", "one")),
+				Warden:   []Step{Ack(protocol.AckAllowed), SessionMeta(protocol.DecisionAllow, protocol.OutcomeNone), Stdout("one\n"), Exit(0)},
+				Decision: protocol.DecisionAllow,
+			},
+			{
+				Request: current(wardentest.NewRequest("/bin/echo", "two")),
+				Warden: []Step{
+					Ack(protocol.AckDenied),
+					Reason(`invalid request: command "/bin/echo" is a path, not a name`),
+					Meta(protocol.DecisionRejected, protocol.OutcomeMalformed),
+				},
+				Decision: protocol.DecisionRejected,
+				Outcome:  protocol.OutcomeMalformed,
+			},
+		},
+		HangsUp: true,
+	},
+}
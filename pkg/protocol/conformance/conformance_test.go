@@ -0,0 +1,11 @@
+package conformance
+
+import "testing"
+
+func TestWarden(t *testing.T) {
+	RunWarden(t)
+}
+
+func TestWardenSessions(t *testing.T) {
+	RunWardenSessions(t)
+}
@@ -0,0 +1,204 @@
+package conformance
+
+import (
+	"bytes"
+	"clawrden/pkg/protocol"
+	"clawrden/pkg/wardentest"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// conversationTimeout bounds one scenario, so a side that waits for bytes
+// that never come fails the test instead of hanging it.
+const conversationTimeout = 10 * time.Second
+
+// Shim is the shim's side of a conversation: it sends req over conn, acts on
+// what the Warden answers, and returns its exit code and result decision
+// and outcome.
+type Shim func(conn net.Conn, req *protocol.Request, stdout, stderr io.Writer) (code int, decision protocol.Decision, outcome protocol.Outcome)
+
+// RunShim plays the Warden's side of every scenario against shim: it reads
+// the request, writes the scenario's acks and frames and hangs up, then
+// checks the shim's exit code, output and decision.
+func RunShim(t *testing.T, shim Shim) {
+	for _, sc := range Scenarios {
+		if sc.Request == nil {
+			continue
+		}
+		t.Run(sc.Name, func(t *testing.T) {
+			shimSide, wardenSide := net.Pipe()
+			defer shimSide.Close()
+			shimSide.SetDeadline(time.Now().Add(conversationTimeout))
+			received := make(chan *protocol.Request, 1)
+			go func() {
+				defer wardenSide.Close()
+				req, err := protocol.ReadRequest(wardenSide)
+				received <- req
+				if err == nil {
+					wardenSide.Write(Bytes(sc.Warden)) // Fails once the shim stops reading
+				}
+			}()
+
+			var stdout, stderr bytes.Buffer
+			code, decision, outcome := shim(shimSide, sc.Request, &stdout, &stderr)
+			if req := <-received; req == nil || req.Command != sc.Request.Command {
+				t.Errorf("warden received %+v, want a request for %s", req, sc.Request.Command)
+			}
+			if code != sc.ExitCode {
+				t.Errorf("exit code = %d, want %d (stderr %q)", code, sc.ExitCode, stderr.String())
+			}
+			if stdout.String() != sc.Stdout {
+				t.Errorf("stdout = %q, want %q", stdout.String(), sc.Stdout)
+			}
+			for _, want := range sc.Stderr {
+				if !strings.Contains(stderr.String(), want) {
+					t.Errorf("stderr = %q, missing %q", stderr.String(), want)
+				}
+			}
+			if decision != sc.Decision || outcome != sc.Outcome {
+				t.Errorf("decision = %v (%v), want %v (%v)", decision, outcome, sc.Decision, sc.Outcome)
+			}
+		})
+	}
+}
+
+// RunWarden plays the shim's side of every scenario with a policy against a
+// real Warden (see wardentest): it sends the request, resolves asks as the
+// scenario says, and checks every ack and frame the Warden writes, that it
+// hangs up after the last, and what it audits.
+func RunWarden(t *testing.T) {
+	for _, sc := range Scenarios {
+		if sc.Policy == nil {
+			continue
+		}
+		t.Run(sc.Name, func(t *testing.T) {
+			w := wardentest.StartTestWarden(t, wardentest.Options{Policy: sc.Policy})
+			conn := w.Dial(t)
+			conn.SetDeadline(time.Now().Add(conversationTimeout))
+			if sc.RawRequest != nil {
+				if _, err := conn.Write(sc.RawRequest); err != nil {
+					t.Fatalf("write request: %v", err)
+				}
+			} else {
+				req := *sc.Request
+				if req.Cwd == "" {
+					req.Cwd = w.Dir
+				}
+				if err := protocol.WriteRequest(conn, &req); err != nil {
+					t.Fatalf("write request: %v", err)
+				}
+			}
+
+			meta, exitCode := converse(t, w, conn, sc.Warden, sc.Review)
+			if f, err := protocol.ReadFrame(conn); !errors.Is(err, io.EOF) {
+				t.Fatalf("after the last step: got frame type %d %q (%v), want the warden to hang up", f.Type, f.Payload, err)
+			}
+
+			if sc.Decision == protocol.DecisionNone {
+				w.Close() // Flushes the audit log
+				if entries, err := w.AuditEntries(); err != nil || len(entries) != 0 {
+					t.Errorf("audited %+v (%v), want nothing", entries, err)
+				}
+				return
+			}
+			checkAudit(t, w.WaitAudit(t, 1), meta, exitCode, sc.Decision, sc.Outcome)
+		})
+	}
+}
+
+// RunWardenSessions plays the shim's side of every persistent session
+// against a real Warden: it sends each turn's request on the same
+// connection once the one before has ended, checks the Warden's answers and
+// audit entry for each, and that the Warden hangs up only when the session
+// says it does.
+func RunWardenSessions(t *testing.T) {
+	for _, sc := range Sessions {
+		t.Run(sc.Name, func(t *testing.T) {
+			w := wardentest.StartTestWarden(t, wardentest.Options{Policy: sc.Policy})
+			conn := w.Dial(t)
+			conn.SetDeadline(time.Now().Add(conversationTimeout))
+
+			for i, turn := range sc.Turns {
+				req := *turn.Request
+				if req.Cwd == "" {
+					req.Cwd = w.Dir
+				}
+				if err := protocol.WriteRequest(conn, &req); err != nil {
+					t.Fatalf("turn %d: write request: %v", i, err)
+				}
+				meta, exitCode := converse(t, w, conn, turn.Warden, turn.Review)
+				checkAudit(t, w.WaitAudit(t, i+1), meta, exitCode, turn.Decision, turn.Outcome)
+			}
+
+			if sc.HangsUp {
+				if f, err := protocol.ReadFrame(conn); !errors.Is(err, io.EOF) {
+					t.Fatalf("after the last turn: got frame type %d %q (%v), want the warden to hang up", f.Type, f.Payload, err)
+				}
+				return
+			}
+			if err := conn.(*net.UnixConn).CloseWrite(); err != nil {
+				t.Fatalf("close session: %v", err)
+			}
+			if f, err := protocol.ReadFrame(conn); !errors.Is(err, io.EOF) {
+				t.Fatalf("after the shim closed the session: got frame type %d %q (%v), want the warden to hang up", f.Type, f.Payload, err)
+			}
+		})
+	}
+}
+
+// converse reads every step the Warden writes for one request and checks
+// it against want, resolving an ask as review says. It returns the
+// request's metadata and exit code, or -1 if it sent none.
+func converse(t *testing.T, w *wardentest.Warden, conn net.Conn, want []Step, review wardentest.Decision) (*protocol.ExecMetadata, int) {
+	t.Helper()
+	var meta *protocol.ExecMetadata
+	exitCode := -1
+	for i, step := range want {
+		if step.Frame == nil {
+			ack, err := protocol.ReadAck(conn)
+			if err != nil || ack != step.Ack {
+				t.Fatalf("step %d: got ack %d (%v), want %v", i, ack, err, step)
+			}
+			if ack == protocol.AckPendingHITL {
+				if err := w.Resolve(w.WaitPending(t, 1)[0].ID, review); err != nil {
+					t.Fatalf("step %d: resolve: %v", i, err)
+				}
+			}
+			continue
+		}
+		got, err := protocol.ReadFrame(conn)
+		if err != nil {
+			t.Fatalf("step %d: %v, want %v", i, err, step)
+		}
+		if err := step.match(got); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		switch got.Type {
+		case protocol.StreamMeta:
+			meta, _ = protocol.ParseMetadata(got)
+		case protocol.StreamExit:
+			exitCode = protocol.ParseExitCode(got)
+		}
+	}
+	return meta, exitCode
+}
+
+// checkAudit checks the last of entries against the decision and outcome
+// the scenario expects, and the metadata and exit code the Warden sent.
+func checkAudit(t *testing.T, entries []wardentest.AuditEntry, meta *protocol.ExecMetadata, exitCode int, decision protocol.Decision, outcome protocol.Outcome) {
+	t.Helper()
+	entry := entries[len(entries)-1]
+	if entry.Decision != decision || entry.Outcome != outcome {
+		t.Errorf("audited decision %v (%v), want %v (%v) (error %q)", entry.Decision, entry.Outcome, decision, outcome, entry.Error)
+	}
+	if meta == nil || meta.RequestID != entry.RequestID {
+		t.Errorf("metadata %+v, want the audited request ID %s", meta, entry.RequestID)
+	}
+	if exitCode >= 0 && entry.ExitCode != exitCode {
+		t.Errorf("audited exit code %d, want %d as sent", entry.ExitCode, exitCode)
+	}
+}
@@ -0,0 +1,238 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Decision is what the Warden did with a request, as audited and announced
+// in ExecMetadata. Why it did so is the Outcome; clients should compare
+// both rather than match on wording. Entries that record something other
+// than a request (a jail change, an incident, a maintenance window) are
+// DecisionEvent, described by their detail.
+type Decision uint8
+
+const (
+	DecisionNone     Decision = iota // Not decided; invalid in an audit entry
+	DecisionAllow                    // The command ran, or was allowed to
+	DecisionDeny                     // The command was refused
+	DecisionAsk                      // The request awaits review
+	DecisionRejected                 // The request or action was refused before any decision, e.g. malformed
+	DecisionError                    // The shim got no decision from the Warden
+	DecisionEvent                    // Not a request; see the detail
+)
+
+var decisionNames = [...]string{
+	DecisionNone:     "",
+	DecisionAllow:    "allow",
+	DecisionDeny:     "deny",
+	DecisionAsk:      "ask",
+	DecisionRejected: "rejected",
+	DecisionError:    "error",
+	DecisionEvent:    "event",
+}
+
+// Decisions lists every valid decision.
+var Decisions = []Decision{DecisionAllow, DecisionDeny, DecisionAsk, DecisionRejected, DecisionError, DecisionEvent}
+
+// String returns the decision's name, e.g. "deny".
+func (d Decision) String() string {
+	if int(d) < len(decisionNames) {
+		return decisionNames[d]
+	}
+	return fmt.Sprintf("Decision(%d)", d)
+}
+
+// Valid reports whether d is one of Decisions.
+func (d Decision) Valid() bool {
+	return d != DecisionNone && int(d) < len(decisionNames)
+}
+
+// ParseDecision returns the decision named s.
+func ParseDecision(s string) (Decision, error) {
+	for _, d := range Decisions {
+		if decisionNames[d] == s {
+			return d, nil
+		}
+	}
+	return DecisionNone, fmt.Errorf("unknown decision %q", s)
+}
+
+// MarshalJSON encodes the decision as its name. An invalid decision is
+// still encoded, as "Decision(n)", so an audit entry is never lost to it.
+func (d Decision) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON decodes a decision name. A legacy decision string such as
+// "deny (after HITL)" decodes to its decision; ParseLegacyDecision also
+// recovers the outcome.
+func (d *Decision) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*d, _, _ = ParseLegacyDecision(s)
+	return nil
+}
+
+// Outcome is why the Warden decided as it did, for decisions other than
+// the policy's own. OutcomeNone means the policy decided alone.
+type Outcome uint8
+
+const (
+	OutcomeNone                 Outcome = iota // The policy decided
+	OutcomeAfterHITL                           // A reviewer decided
+	OutcomeHITLExpired                         // Nobody reviewed it in time
+	OutcomeAutoApproved                        // The risk tier's auto-approval fired
+	OutcomePathViolation                       // The cwd is outside the allowed paths
+	OutcomeUnknownRequestType                  // The request type is not one the Warden serves
+	OutcomeUntrustedClient                     // The peer is not a trusted shim
+	OutcomeLockdown                            // The kill switch is on
+	OutcomeAuditUnavailable                    // The audit log cannot be written
+	OutcomeOverrideUnavailable                 // A reviewer override cannot be honoured
+	OutcomeNoContainment                       // Docker is unreachable
+	OutcomeHostFallbackDisabled                // Running on the host is not allowed
+	OutcomeMaintenance                         // A maintenance window is open
+	OutcomeWardenOverloaded                    // The connection limit is reached
+	OutcomeMemoryPressure                      // The memory limit is reached
+	OutcomeMalformed                           // The request failed validation
+	OutcomeTimeout                             // A time limit killed the command
+)
+
+// outcomeNames are the JSON names of outcomes; outcomeLabels their wording
+// in a legacy decision string, e.g. "deny (after HITL)".
+var (
+	outcomeNames = [...]string{
+		OutcomeNone:                 "",
+		OutcomeAfterHITL:            "after_hitl",
+		OutcomeHITLExpired:          "hitl_expired",
+		OutcomeAutoApproved:         "auto_approved",
+		OutcomePathViolation:        "path_violation",
+		OutcomeUnknownRequestType:   "unknown_request_type",
+		OutcomeUntrustedClient:      "untrusted_client",
+		OutcomeLockdown:             "lockdown",
+		OutcomeAuditUnavailable:     "audit_unavailable",
+		OutcomeOverrideUnavailable:  "override_unavailable",
+		OutcomeNoContainment:        "no_containment",
+		OutcomeHostFallbackDisabled: "host_fallback_disabled",
+		OutcomeMaintenance:          "maintenance",
+		OutcomeWardenOverloaded:     "warden_overloaded",
+		OutcomeMemoryPressure:       "memory_pressure",
+		OutcomeMalformed:            "malformed",
+		OutcomeTimeout:              "timeout",
+	}
+	outcomeLabels = [...]string{
+		OutcomeNone:                 "",
+		OutcomeAfterHITL:            "after HITL",
+		OutcomeHITLExpired:          "HITL expired",
+		OutcomeAutoApproved:         "auto-approved",
+		OutcomePathViolation:        "path violation",
+		OutcomeUnknownRequestType:   "unknown request type",
+		OutcomeUntrustedClient:      "untrusted client",
+		OutcomeLockdown:             "lockdown",
+		OutcomeAuditUnavailable:     "audit unavailable",
+		OutcomeOverrideUnavailable:  "override unavailable",
+		OutcomeNoContainment:        "no containment",
+		OutcomeHostFallbackDisabled: "host fallback disabled",
+		OutcomeMaintenance:          "maintenance",
+		OutcomeWardenOverloaded:     "warden overloaded",
+		OutcomeMemoryPressure:       "memory pressure",
+		OutcomeMalformed:            "malformed",
+		OutcomeTimeout:              "timeout",
+	}
+)
+
+// String returns the outcome's name, e.g. "after_hitl".
+func (o Outcome) String() string {
+	if int(o) < len(outcomeNames) {
+		return outcomeNames[o]
+	}
+	return fmt.Sprintf("Outcome(%d)", o)
+}
+
+// Label returns the outcome as people read it, e.g. "after HITL".
+func (o Outcome) Label() string {
+	if int(o) < len(outcomeLabels) {
+		return outcomeLabels[o]
+	}
+	return o.String()
+}
+
+// Valid reports whether o is a known outcome.
+func (o Outcome) Valid() bool {
+	return int(o) < len(outcomeNames)
+}
+
+// Reviewed reports whether a request with this outcome went to review.
+func (o Outcome) Reviewed() bool {
+	return o == OutcomeAfterHITL || o == OutcomeHITLExpired || o == OutcomeAutoApproved
+}
+
+// ParseOutcome returns the outcome named s; "" is OutcomeNone.
+func ParseOutcome(s string) (Outcome, error) {
+	for i, name := range outcomeNames {
+		if name == s {
+			return Outcome(i), nil
+		}
+	}
+	return OutcomeNone, fmt.Errorf("unknown outcome %q", s)
+}
+
+// MarshalJSON encodes the outcome as its name, "Outcome(n)" if invalid.
+func (o Outcome) MarshalJSON() ([]byte, error) {
+	return json.Marshal(o.String())
+}
+
+// UnmarshalJSON decodes an outcome name. Unknown names, from a newer
+// Warden, decode to OutcomeNone.
+func (o *Outcome) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*o, _ = ParseOutcome(s)
+	return nil
+}
+
+// FormatDecision returns a decision as people read it, in the wording
+// audit logs used before outcomes were split out: "allow", "deny (after
+// HITL)", or for an event its detail, e.g. "jail create".
+func FormatDecision(d Decision, o Outcome, detail string) string {
+	if d == DecisionEvent && detail != "" {
+		return detail
+	}
+	if o != OutcomeNone {
+		return d.String() + " (" + o.Label() + ")"
+	}
+	return d.String()
+}
+
+// ParseLegacyDecision splits a decision string of an audit log written
+// before outcomes were split out, such as "deny (after HITL)", into its
+// decision, outcome and detail. Strings that are not a request's decision,
+// such as "jail create", are DecisionEvent with the string as detail; so
+// is a known decision with an unknown parenthetical.
+func ParseLegacyDecision(s string) (Decision, Outcome, string) {
+	if s == "" {
+		return DecisionNone, OutcomeNone, ""
+	}
+	verb, rest, _ := strings.Cut(s, " ")
+	d, err := ParseDecision(verb)
+	switch {
+	case err != nil, d == DecisionEvent && rest != "":
+		return DecisionEvent, OutcomeNone, s
+	case rest == "":
+		return d, OutcomeNone, ""
+	}
+	label, ok := strings.CutPrefix(rest, "(")
+	if label, ok2 := strings.CutSuffix(label, ")"); ok && ok2 {
+		for i, l := range outcomeLabels {
+			if i > 0 && l == label {
+				return d, Outcome(i), ""
+			}
+		}
+	}
+	return DecisionEvent, OutcomeNone, s
+}
@@ -0,0 +1,110 @@
+package protocol
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// allOutcomes is every outcome, from the registry of names.
+func allOutcomes() []Outcome {
+	outcomes := make([]Outcome, len(outcomeNames))
+	for i := range outcomes {
+		outcomes[i] = Outcome(i)
+	}
+	return outcomes
+}
+
+func TestDecisionRegistry(t *testing.T) {
+	if len(Decisions) != len(decisionNames)-1 {
+		t.Errorf("Decisions lists %d decisions, names %d", len(Decisions), len(decisionNames)-1)
+	}
+	seen := make(map[string]bool)
+	for _, d := range Decisions {
+		if !d.Valid() || d.String() == "" || seen[d.String()] {
+			t.Errorf("decision %d: name %q is missing or repeated", d, d.String())
+		}
+		seen[d.String()] = true
+		if got, err := ParseDecision(d.String()); err != nil || got != d {
+			t.Errorf("ParseDecision(%q) = %v, %v", d, got, err)
+		}
+	}
+
+	if len(outcomeLabels) != len(outcomeNames) {
+		t.Fatalf("%d outcome labels for %d names", len(outcomeLabels), len(outcomeNames))
+	}
+	seen = make(map[string]bool)
+	for _, o := range allOutcomes()[1:] {
+		if o.String() == "" || o.Label() == "" || seen[o.String()] || seen[o.Label()] {
+			t.Errorf("outcome %d: name %q or label %q is missing or repeated", o, o.String(), o.Label())
+		}
+		seen[o.String()], seen[o.Label()] = true, true
+	}
+	if Decision(99).Valid() || Outcome(99).Valid() {
+		t.Error("out of range values are valid")
+	}
+}
+
+func TestDecisionJSON(t *testing.T) {
+	for _, d := range Decisions {
+		for _, o := range allOutcomes() {
+			data, err := json.Marshal(ExecMetadata{Decision: d, Outcome: o})
+			if err != nil {
+				t.Fatalf("marshal %v (%v): %v", d, o, err)
+			}
+			var meta ExecMetadata
+			if err := json.Unmarshal(data, &meta); err != nil || meta.Decision != d || meta.Outcome != o {
+				t.Errorf("%s decodes to %v (%v), %v", data, meta.Decision, meta.Outcome, err)
+			}
+		}
+	}
+
+	// Unknown outcomes, from a newer Warden, decode to none
+	var meta ExecMetadata
+	if err := json.Unmarshal([]byte(`{"decision":"deny","outcome":"solar_flare"}`), &meta); err != nil || meta.Decision != DecisionDeny || meta.Outcome != OutcomeNone {
+		t.Errorf("unknown outcome decodes to %+v, %v", meta, err)
+	}
+	// An older Warden's decision string decodes to its decision
+	if err := json.Unmarshal([]byte(`{"decision":"allow (after HITL)"}`), &meta); err != nil || meta.Decision != DecisionAllow {
+		t.Errorf("legacy decision decodes to %+v, %v", meta, err)
+	}
+}
+
+func TestParseLegacyDecision(t *testing.T) {
+	tests := []struct {
+		legacy   string
+		decision Decision
+		outcome  Outcome
+		detail   string
+	}{
+		{"", DecisionNone, OutcomeNone, ""},
+		{"allow", DecisionAllow, OutcomeNone, ""},
+		{"deny (after HITL)", DecisionDeny, OutcomeAfterHITL, ""},
+		{"deny (HITL expired)", DecisionDeny, OutcomeHITLExpired, ""},
+		{"allow (auto-approved)", DecisionAllow, OutcomeAutoApproved, ""},
+		{"rejected (malformed)", DecisionRejected, OutcomeMalformed, ""},
+		{"allow (timeout)", DecisionAllow, OutcomeTimeout, ""},
+		{"rejected", DecisionRejected, OutcomeNone, ""},
+		{"jail create", DecisionEvent, OutcomeNone, "jail create"},
+		{"debug (status)", DecisionEvent, OutcomeNone, "debug (status)"},
+		{"deny (solar flare)", DecisionEvent, OutcomeNone, "deny (solar flare)"},
+		{"approve", DecisionEvent, OutcomeNone, "approve"},
+	}
+	for _, tt := range tests {
+		d, o, detail := ParseLegacyDecision(tt.legacy)
+		if d != tt.decision || o != tt.outcome || detail != tt.detail {
+			t.Errorf("ParseLegacyDecision(%q) = %v, %v, %q; want %v, %v, %q", tt.legacy, d, o, detail, tt.decision, tt.outcome, tt.detail)
+		}
+		if tt.legacy != "" && FormatDecision(d, o, detail) != tt.legacy {
+			t.Errorf("FormatDecision(%v, %v, %q) = %q, want %q", d, o, detail, FormatDecision(d, o, detail), tt.legacy)
+		}
+	}
+
+	// Every current decision reads back from its legacy wording
+	for _, d := range Decisions[:len(Decisions)-1] {
+		for _, o := range allOutcomes() {
+			if gotD, gotO, _ := ParseLegacyDecision(FormatDecision(d, o, "")); gotD != d || gotO != o {
+				t.Errorf("%q parses as %v (%v), want %v (%v)", FormatDecision(d, o, ""), gotD, gotO, d, o)
+			}
+		}
+	}
+}
@@ -4,21 +4,136 @@
 package protocol
 
 import (
+	"bytes"
+	"clawrden/internal/faultinject"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // DefaultSocketPath is the canonical path for the Warden's Unix Domain Socket.
 const DefaultSocketPath = "/var/run/clawrden/warden.sock"
 
+// ProtocolVersion is the version of the wire protocol spoken by this build.
+// Shims send it with each request; the Warden reports its own in status replies.
+const ProtocolVersion = 6
+
+// PendingMetaVersion is the first shim version the Warden sends a StreamMeta
+// frame between AckPendingHITL and the ack deciding the request. Older shims
+// read that ack right after the pending one and would take the frame's type
+// byte for it, so they are sent nothing in between.
+const PendingMetaVersion = 2
+
+// SessionVersion is the first Warden version that holds persistent
+// sessions: a shim that sets Request.Persistent may send its next request
+// on the same connection once the current one has ended, if the Warden
+// says so in the request's metadata (ExecMetadata.SessionOpen). Older
+// Wardens hang up after every request.
+const SessionVersion = 3
+
+// ReviewerMessageVersion is the first shim version the Warden sends a
+// StreamStderr frame after AckDenied, carrying the reviewer's message to the
+// agent (see ReadDenialTo). Older shims stop reading at any frame but the
+// reason and metadata, so they get the message as the denial reason.
+const ReviewerMessageVersion = 4
+
+// TTYVersion is the first Warden version that runs the command of a
+// Request.TTY request on a terminal and reads the StreamStdin and
+// StreamResize frames the shim sends once it is allowed. Older Wardens
+// discard them and run the command without a terminal.
+const TTYVersion = 5
+
+// ExitCodeVersion is the first shim version the Warden sends exit codes as
+// four bytes (see WriteExitCode), so that codes outside 0-255, like -1 or
+// 512, arrive whole. Older shims read only the first byte, so they are sent
+// that byte alone (see ExitStatus).
+const ExitCodeVersion = 6
+
+// Request types. An empty Type is a normal command execution request.
+const (
+	RequestTypeExec   = ""
+	RequestTypeStatus = "status" // Debug status query; no command is run
+)
+
+// Environment variables an orchestrator sets to correlate an agent's
+// requests with its task and run.
+const (
+	TaskIDEnv = "CLAWRDEN_TASK_ID"
+	RunIDEnv  = "CLAWRDEN_RUN_ID"
+)
+
+// Environment variables the Warden sets for every command it runs, after
+// scrubbing the agent's environment, so build scripts can tell they are
+// supervised (and, say, skip prompts or not spawn daemons). They are a
+// stable contract; a policy rule leaves them out with mark_environment: false.
+const (
+	SupervisedEnv = "CLAWRDEN"            // Always "1"
+	RequestIDEnv  = "CLAWRDEN_REQUEST_ID" // The ID the request is audited under
+	StrategyEnv   = "CLAWRDEN_STRATEGY"   // Where the command runs: mirror, ghost or local
+)
+
+// passedEnv names the environment variables the Warden passes on to
+// commands; it drops all others.
+var passedEnv = map[string]bool{
+	"PATH":       true,
+	"LANG":       true,
+	"LANGUAGE":   true,
+	"LC_ALL":     true,
+	"TERM":       true,
+	"HOME":       true,
+	"USER":       true,
+	"SHELL":      true,
+	"NODE_ENV":   true,
+	"GOPATH":     true,
+	"GOROOT":     true,
+	"PYTHONPATH": true,
+}
+
+// EnvPassesThrough reports whether the Warden passes the environment
+// variable key on to commands. Shims send only the names of the others.
+func EnvPassesThrough(key string) bool {
+	return passedEnv[key]
+}
+
+// MaxCorrelationIDLen is the longest task or run ID kept.
+const MaxCorrelationIDLen = 128
+
+// SanitizeCorrelationID makes a caller-supplied task or run ID safe to log
+// and display: characters other than letters, digits and "-_.:/@" become
+// "_", and the result is cut to MaxCorrelationIDLen bytes.
+func SanitizeCorrelationID(id string) string {
+	if len(id) > MaxCorrelationIDLen {
+		id = id[:MaxCorrelationIDLen]
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case strings.ContainsRune("-_.:/@", r):
+			return r
+		}
+		return '_'
+	}, id)
+}
+
 // Stream type markers for the framing protocol.
 const (
 	StreamStdout byte = 1
 	StreamStderr byte = 2
 	StreamExit   byte = 3
 	StreamCancel byte = 4
+	StreamMeta   byte = 5 // JSON ExecMetadata, sent before any output
+	StreamReason byte = 6 // Why a request was denied, sent after the deny ack
+	StreamStdin  byte = 7 // Shim to Warden: terminal input; an empty payload ends it
+	StreamResize byte = 8 // Shim to Warden: JSON WindowSize, after the terminal was resized
 )
 
 // Ack bytes sent by the Warden after evaluating a request.
@@ -29,106 +144,435 @@ const (
 )
 
 // Identity holds the UID/GID of the process that invoked the shim.
+// Groups lists the supplementary group IDs of the process; the Warden
+// replaces it with the kernel's view when peer credentials are available.
 type Identity struct {
-	UID int `json:"uid"`
-	GID int `json:"gid"`
+	UID    int   `json:"uid"`
+	GID    int   `json:"gid"`
+	Groups []int `json:"groups,omitempty"`
 }
 
 // Request is the JSON payload sent from the Shim to the Warden.
 type Request struct {
+	Type     string   `json:"type,omitempty"`    // RequestTypeExec or RequestTypeStatus
+	Version  int      `json:"version,omitempty"` // Shim's ProtocolVersion (0 = pre-versioning shim)
 	Command  string   `json:"command"`
 	Args     []string `json:"args"`
 	Cwd      string   `json:"cwd"`
 	Env      []string `json:"env"`
 	Identity Identity `json:"identity"`
 
+	// JailID names the jail the shim was invoked from, read from the marker
+	// file in its bin directory. The Warden checks it against the container's
+	// label jails when it knows them.
+	JailID string `json:"jail_id,omitempty"`
+
+	// ShimDir is the directory of the symlink the shim was invoked through.
+	// The Warden matches it against jail paths to count usage of jails whose
+	// shims do not report a jail ID.
+	ShimDir string `json:"shim_dir,omitempty"`
+
+	// TaskID and RunID correlate requests with the caller's agent task and
+	// run. The shim copies them from TaskIDEnv and RunIDEnv; both sides pass
+	// them through SanitizeCorrelationID.
+	TaskID string `json:"task_id,omitempty"`
+	RunID  string `json:"run_id,omitempty"`
+
+	// Session is the login session the shim was invoked from; nil when it
+	// found none.
+	Session *Session `json:"session,omitempty"`
+
+	// Persistent asks the Warden to keep the connection open after this
+	// request for the next one, opening a persistent session (see
+	// SessionVersion). Only the first request of a session needs it.
+	Persistent bool `json:"persistent,omitempty"`
+
+	// TTY asks for the command to run on a terminal of WindowSize, because
+	// the shim's stdout is one (see TTYVersion). Once the request is
+	// allowed, the shim forwards its stdin and window size changes.
+	TTY        bool        `json:"tty,omitempty"`
+	WindowSize *WindowSize `json:"window_size,omitempty"`
+
 	// ContainerID is set server-side from peer credentials (not sent by shim).
 	// It identifies the originating container for mirror execution.
 	ContainerID string `json:"-"`
+
+	// SandboxDir is set server-side when the command must run in a scratch
+	// directory instead of Cwd (not sent by shim).
+	SandboxDir string `json:"-"`
+
+	// Network is set server-side when a reviewer pins the network of the
+	// command's ghost container (not sent by shim).
+	Network string `json:"-"`
+
+	// Image and ImageDigest are set server-side from an inspection of the
+	// originating container; empty when unknown (not sent by shim).
+	Image       string `json:"-"`
+	ImageDigest string `json:"-"`
+
+	// RequestID is set server-side to the ID the request is audited under
+	// (not sent by shim). Ghost containers are labeled with it.
+	RequestID string `json:"-"`
+
+	// UnmarkedEnv is set server-side when policy keeps SupervisedEnv and
+	// the other marker variables out of the command's environment (not
+	// sent by shim).
+	UnmarkedEnv bool `json:"-"`
+
+	// Priority is set server-side when policy lowers the command's CPU and
+	// IO scheduling priority (not sent by shim); nil leaves both as they are.
+	Priority *Priority `json:"-"`
+
+	// Terminal is set server-side for a TTY request to what the shim
+	// forwards while the command runs (not sent by shim); nil when the
+	// connection carries no terminal input.
+	Terminal *TerminalInput `json:"-"`
+}
+
+// WindowSize is the size of a terminal in character cells.
+type WindowSize struct {
+	Rows uint16 `json:"rows"`
+	Cols uint16 `json:"cols"`
+}
+
+// TerminalInput is what the shim of a TTY request forwards while its
+// command runs, as the Warden reads it from StreamStdin and StreamResize
+// frames.
+type TerminalInput struct {
+	Stdin  io.Reader         // Typed input; EOF once the shim ends it or hangs up
+	Resize <-chan WindowSize // Window size changes; only the latest is kept
+}
+
+// Limits Request.Validate enforces. They follow the kernel's limits on
+// what a shim can have been executed with: a file name, a path, and one
+// argument or environment string.
+const (
+	MaxCommandLen = 255       // NAME_MAX
+	MaxPathLen    = 4096      // PATH_MAX
+	MaxArgLen     = 128 << 10 // MAX_ARG_STRLEN
+)
+
+// ErrInvalidRequest is returned by Request.Validate for a request no shim
+// would send.
+var ErrInvalidRequest = errors.New("invalid request")
+
+// Normalize cleans an absolute Cwd, so that "/app/" and "/app/src/.." reach
+// Validate and the policy as "/app". A relative Cwd is left for Validate to
+// refuse rather than resolved against an unknown directory.
+func (r *Request) Normalize() {
+	if path.IsAbs(r.Cwd) {
+		r.Cwd = path.Clean(r.Cwd)
+	}
+}
+
+// Validate checks the fields a shim sends before they reach policy
+// matching, the audit log, file system paths and the Docker API:
+//
+//   - Command is the bare name the shim was invoked as, never a path:
+//     rules match names, and a path could pick a different binary than
+//     the one a rule was written for. "." and ".." are refused too.
+//   - Cwd is absolute and clean (what os.Getwd returns; see Normalize).
+//     Status requests may leave it empty.
+//   - No field contains a NUL byte, which the kernel would have cut the
+//     string at.
+//   - Command, paths and each argument and environment entry are within
+//     MaxCommandLen, MaxPathLen and MaxArgLen bytes.
+//
+// Errors wrap ErrInvalidRequest and name the offending field.
+func (r *Request) Validate() error {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: "+format, append([]any{ErrInvalidRequest}, args...)...)
+	}
+
+	switch {
+	case r.Command == "":
+		return invalid("command is empty")
+	case len(r.Command) > MaxCommandLen:
+		return invalid("command is %d bytes, the limit is %d", len(r.Command), MaxCommandLen)
+	case strings.ContainsRune(r.Command, '/'):
+		return invalid("command %q is a path, not a name", r.Command)
+	case r.Command == "." || r.Command == "..":
+		return invalid("command %q is not a name", r.Command)
+	}
+
+	switch {
+	case r.Cwd == "" && r.Type == RequestTypeStatus:
+	case len(r.Cwd) > MaxPathLen:
+		return invalid("cwd is %d bytes, the limit is %d", len(r.Cwd), MaxPathLen)
+	case !path.IsAbs(r.Cwd):
+		return invalid("cwd %q is not an absolute path", r.Cwd)
+	case path.Clean(r.Cwd) != r.Cwd:
+		return invalid("cwd %q is not clean (want %q)", r.Cwd, path.Clean(r.Cwd))
+	}
+	if len(r.ShimDir) > MaxPathLen || len(r.JailID) > MaxPathLen {
+		return invalid("shim_dir or jail_id is over %d bytes", MaxPathLen)
+	}
+
+	for _, f := range []struct{ name, value string }{{"command", r.Command}, {"cwd", r.Cwd}, {"shim_dir", r.ShimDir}, {"jail_id", r.JailID}} {
+		if strings.IndexByte(f.value, 0) >= 0 {
+			return invalid("%s contains a NUL byte", f.name)
+		}
+	}
+	for i, arg := range r.Args {
+		if err := validateArg(arg); err != nil {
+			return invalid("args[%d] %v", i, err)
+		}
+	}
+	for i, entry := range r.Env {
+		if err := validateArg(entry); err != nil {
+			return invalid("env[%d] %v", i, err)
+		}
+	}
+	return nil
+}
+
+// validateArg checks one argument or environment entry.
+func validateArg(s string) error {
+	if len(s) > MaxArgLen {
+		return fmt.Errorf("is %d bytes, the limit is %d", len(s), MaxArgLen)
+	}
+	if strings.IndexByte(s, 0) >= 0 {
+		return errors.New("contains a NUL byte")
+	}
+	return nil
 }
 
+// Session describes where the human behind a request is logged in, as the
+// shim reports it. Nothing verifies it: it tells people sharing a machine
+// apart, but must never decide anything.
+type Session struct {
+	TTY           string `json:"tty,omitempty"`            // Terminal on the shim's stdin or stderr, e.g. /dev/pts/3
+	SSHConnection string `json:"ssh_connection,omitempty"` // SSH_CONNECTION: client address and port, server address and port
+	SSHTTY        string `json:"ssh_tty,omitempty"`        // SSH_TTY
+	LoginSession  string `json:"login_session,omitempty"`  // Audit login session ID, from /proc/self/sessionid
+}
+
+// IO scheduling classes of Priority.IOClass.
+const (
+	IOClassBestEffort = "best-effort"
+	IOClassIdle       = "idle"
+)
+
+// Priority lowers a command's CPU and IO scheduling priority, as nice(1)
+// and ionice(1) do. The zero value changes neither.
+type Priority struct {
+	Nice    int    `json:"nice,omitempty"`         // 0 (unchanged) to 19 (lowest)
+	IOClass string `json:"ionice_class,omitempty"` // IOClassBestEffort or IOClassIdle; empty leaves IO priority as it is
+	IOLevel int    `json:"ionice_level"`           // 0 (highest) to 7 within best-effort
+}
+
+// Sanitize makes a self-reported session safe to log and display:
+// non-printable characters become "_" and each field is cut to
+// MaxCorrelationIDLen bytes. It returns nil for a session with no fields.
+func (s *Session) Sanitize() *Session {
+	if s == nil {
+		return nil
+	}
+	clean := Session{
+		TTY:           sanitizeSessionField(s.TTY),
+		SSHConnection: sanitizeSessionField(s.SSHConnection),
+		SSHTTY:        sanitizeSessionField(s.SSHTTY),
+		LoginSession:  sanitizeSessionField(s.LoginSession),
+	}
+	if clean == (Session{}) {
+		return nil
+	}
+	return &clean
+}
+
+// sanitizeSessionField cuts a session field and replaces what a terminal or
+// log reader might interpret.
+func sanitizeSessionField(v string) string {
+	if len(v) > MaxCorrelationIDLen {
+		v = v[:MaxCorrelationIDLen]
+	}
+	return strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || !unicode.IsPrint(r) {
+			return '_'
+		}
+		return r
+	}, v)
+}
+
+// StatusResponse is the Warden's reply to a RequestTypeStatus request.
+// It is sent as a length-prefixed JSON message instead of an ack.
+type StatusResponse struct {
+	Version       int     `json:"version"`        // Warden's ProtocolVersion
+	Pending       int     `json:"pending"`        // Requests awaiting human approval
+	Jails         int     `json:"jails"`          // Active jails
+	UptimeSeconds float64 `json:"uptime_seconds"` // Time since the Warden started
+	DefaultAction string  `json:"default_action"` // Policy default action
+	ToolHasRule   bool    `json:"tool_has_rule"`  // Whether any policy rule names the requested tool
+}
+
+// ExecMetadata describes how the Warden handled a request. It is sent in a
+// StreamMeta frame right after the allow ack, and after a denial, following
+// the StreamReason frame if there is one. Shims that predate it ignore the
+// frame. Shims of PendingMetaVersion or later are also sent one once a
+// request is queued for review, after AckPendingHITL; it has no Decision
+// yet, and says where the request stands instead.
+type ExecMetadata struct {
+	TimeoutSeconds float64  `json:"timeout_seconds,omitempty"` // 0 = no time limit, or not announced
+	RequestID      string   `json:"request_id,omitempty"`      // ID of the request in the audit log and queue
+	Decision       Decision `json:"decision,omitempty"`        // Audit decision, e.g. "allow"
+	Outcome        Outcome  `json:"outcome,omitempty"`         // And why, e.g. "after_hitl"
+	WardenVersion  int      `json:"warden_version,omitempty"`  // Warden's ProtocolVersion
+
+	// Where a queued request stands: its place in the review queue (1 is
+	// the oldest request), how long it may wait for a reviewer (0 = no
+	// limit) and where reviewers find it (empty without a public URL)
+	QueuePosition      int     `json:"queue_position,omitempty"`
+	HITLTimeoutSeconds float64 `json:"hitl_timeout_seconds,omitempty"`
+	ReviewURL          string  `json:"review_url,omitempty"`
+
+	// Stdout limit the policy sets for the command, tightening the shim's
+	// own CLAWRDEN_MAX_STDOUT_BYTES, and how much of the end of truncated
+	// output to print after the truncation notice; 0 = not set
+	MaxStdoutBytes int64 `json:"max_stdout_bytes,omitempty"`
+	TailOnTruncate int64 `json:"tail_on_truncate,omitempty"`
+
+	// Where the command runs: mirror, ghost or local; empty until it does
+	Strategy string `json:"strategy,omitempty"`
+
+	// The policy asks the shim to print its trailer line after the command,
+	// as CLAWRDEN_TRAILER=1 does
+	Trailer bool `json:"trailer,omitempty"`
+
+	// The Warden keeps the connection open once the request has ended, for
+	// the next request of a persistent session; without it, it hangs up
+	SessionOpen bool `json:"session_open,omitempty"`
+}
+
+// Timeout returns the command's time limit, or 0 if it has none.
+func (m ExecMetadata) Timeout() time.Duration {
+	return time.Duration(m.TimeoutSeconds * float64(time.Second))
+}
+
+// HITLTimeout returns how long a queued request may wait for a reviewer, or
+// 0 if it may wait forever.
+func (m ExecMetadata) HITLTimeout() time.Duration {
+	return time.Duration(m.HITLTimeoutSeconds * float64(time.Second))
+}
+
+// FrameHeaderSize is the size of a frame header: 1-byte type + 4-byte length.
+const FrameHeaderSize = 5
+
 // Frame represents a single chunk of streamed output or control data.
 type Frame struct {
-	Type    byte   // StreamStdout, StreamStderr, StreamExit, or StreamCancel
-	Payload []byte // For StreamExit, payload is a single byte (exit code)
+	Type    byte   // StreamStdout, StreamStderr, StreamExit, StreamCancel, StreamMeta, StreamReason, StreamStdin or StreamResize
+	Payload []byte // For StreamExit, the exit code (see ParseExitCode)
 }
 
 // WriteRequest serializes a Request as a length-prefixed JSON message.
 // Wire format: [4-byte big-endian length][JSON payload]
 func WriteRequest(w io.Writer, req *Request) error {
-	data, err := json.Marshal(req)
-	if err != nil {
-		return fmt.Errorf("marshal request: %w", err)
+	return writeMessage(w, req)
+}
+
+// ReadRequest reads a length-prefixed JSON Request from the reader.
+func ReadRequest(r io.Reader) (*Request, error) {
+	var req Request
+	if err := readMessage(r, &req); err != nil {
+		return nil, err
 	}
+	return &req, nil
+}
+
+// WriteStatus sends a StatusResponse as a length-prefixed JSON message.
+func WriteStatus(w io.Writer, status *StatusResponse) error {
+	return writeMessage(w, status)
+}
+
+// ReadStatus reads a length-prefixed JSON StatusResponse from the reader.
+func ReadStatus(r io.Reader) (*StatusResponse, error) {
+	var status StatusResponse
+	if err := readMessage(r, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// messageBuffers holds encode buffers for writeMessage, so a Warden or a
+// benchmark encoding request after request reuses their memory. Buffers
+// grown past maxPooledBuffer by an outsized message are let go.
+var messageBuffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+const maxPooledBuffer = 1 << 20
+
+// writeMessage marshals v and writes it with a 4-byte big-endian length
+// prefix, in a single Write.
+func writeMessage(w io.Writer, v interface{}) error {
+	buf := messageBuffers.Get().(*bytes.Buffer)
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			messageBuffers.Put(buf)
+		}
+	}()
+	buf.Reset()
 
-	// Write 4-byte length header
-	length := uint32(len(data))
-	if err := binary.Write(w, binary.BigEndian, length); err != nil {
-		return fmt.Errorf("write length: %w", err)
+	// Reserve the length header and encode the payload after it
+	buf.Write([]byte{0, 0, 0, 0})
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		return fmt.Errorf("marshal message: %w", err)
 	}
+	buf.Truncate(buf.Len() - 1) // Encode's trailing newline
+	data := buf.Bytes()
+	binary.BigEndian.PutUint32(data, uint32(len(data)-4))
 
-	// Write JSON payload
 	if _, err := w.Write(data); err != nil {
 		return fmt.Errorf("write payload: %w", err)
 	}
-
 	return nil
 }
 
-// ReadRequest reads a length-prefixed JSON Request from the reader.
-func ReadRequest(r io.Reader) (*Request, error) {
+// readMessage reads a length-prefixed JSON message into v.
+func readMessage(r io.Reader, v interface{}) error {
 	// Read 4-byte length header
 	var length uint32
 	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
-		return nil, fmt.Errorf("read length: %w", err)
+		return fmt.Errorf("read length: %w", err)
 	}
 
 	// Sanity check: reject absurdly large payloads (> 10MB)
 	if length > 10*1024*1024 {
-		return nil, fmt.Errorf("request too large: %d bytes", length)
+		return fmt.Errorf("message too large: %d bytes", length)
 	}
 
 	// Read JSON payload
 	data := make([]byte, length)
 	if _, err := io.ReadFull(r, data); err != nil {
-		return nil, fmt.Errorf("read payload: %w", err)
+		return fmt.Errorf("read payload: %w", err)
 	}
 
-	var req Request
-	if err := json.Unmarshal(data, &req); err != nil {
-		return nil, fmt.Errorf("unmarshal request: %w", err)
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("unmarshal message: %w", err)
 	}
 
-	return &req, nil
+	return nil
 }
 
 // WriteFrame writes a single frame to the writer.
 // Wire format: [1-byte type][4-byte big-endian length][payload]
+// The frame is written with a single Write call so that frames written
+// concurrently to the same connection never interleave.
 func WriteFrame(w io.Writer, f Frame) error {
-	// Write stream type
-	if _, err := w.Write([]byte{f.Type}); err != nil {
-		return fmt.Errorf("write frame type: %w", err)
-	}
+	buf := make([]byte, FrameHeaderSize+len(f.Payload))
+	buf[0] = f.Type
+	binary.BigEndian.PutUint32(buf[1:FrameHeaderSize], uint32(len(f.Payload)))
+	copy(buf[FrameHeaderSize:], f.Payload)
 
-	// Write 4-byte payload length
-	length := uint32(len(f.Payload))
-	if err := binary.Write(w, binary.BigEndian, length); err != nil {
-		return fmt.Errorf("write frame length: %w", err)
-	}
-
-	// Write payload
-	if len(f.Payload) > 0 {
-		if _, err := w.Write(f.Payload); err != nil {
-			return fmt.Errorf("write frame payload: %w", err)
-		}
+	if _, err := faultinject.Write(faultinject.PointWriteFrame, w, buf); err != nil {
+		return fmt.Errorf("write frame: %w", err)
 	}
-
 	return nil
 }
 
 // ReadFrame reads a single frame from the reader.
 func ReadFrame(r io.Reader) (Frame, error) {
 	var f Frame
+	if err := faultinject.Check(faultinject.PointReadFrame, r); err != nil {
+		return f, fmt.Errorf("read frame: %w", err)
+	}
 
 	// Read 1-byte stream type
 	typeBuf := make([]byte, 1)
@@ -172,10 +616,145 @@ func ReadAck(r io.Reader) (byte, error) {
 	return buf[0], err
 }
 
-// WriteExitCode sends an exit code frame.
+// WriteMetadata sends an ExecMetadata frame.
+func WriteMetadata(w io.Writer, meta *ExecMetadata) error {
+	payload, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("marshal metadata: %w", err)
+	}
+	return WriteFrame(w, Frame{Type: StreamMeta, Payload: payload})
+}
+
+// ParseMetadata decodes the payload of a StreamMeta frame.
+func ParseMetadata(f Frame) (*ExecMetadata, error) {
+	var meta ExecMetadata
+	if err := json.Unmarshal(f.Payload, &meta); err != nil {
+		return nil, fmt.Errorf("unmarshal metadata: %w", err)
+	}
+	return &meta, nil
+}
+
+// WriteResize sends a StreamResize frame with the terminal's new size.
+func WriteResize(w io.Writer, size WindowSize) error {
+	payload, err := json.Marshal(size)
+	if err != nil {
+		return fmt.Errorf("marshal window size: %w", err)
+	}
+	return WriteFrame(w, Frame{Type: StreamResize, Payload: payload})
+}
+
+// ParseResize decodes the payload of a StreamResize frame.
+func ParseResize(f Frame) (WindowSize, error) {
+	var size WindowSize
+	if err := json.Unmarshal(f.Payload, &size); err != nil {
+		return size, fmt.Errorf("unmarshal window size: %w", err)
+	}
+	return size, nil
+}
+
+// ReadResolution reads what follows AckPendingHITL until the ack deciding
+// the request, and returns that ack. Wardens send shims of
+// PendingMetaVersion or later the queued request's metadata first; queued,
+// if set, is called with it as soon as it arrives. Ack bytes and StreamMeta
+// differ, so an older Warden's ack is never mistaken for the frame.
+func ReadResolution(r io.Reader, queued func(*ExecMetadata)) (byte, error) {
+	ack, err := ReadAck(r)
+	if err != nil || ack != StreamMeta {
+		return ack, err
+	}
+	f, err := ReadFrame(io.MultiReader(bytes.NewReader([]byte{ack}), r))
+	if err != nil {
+		return 0, err
+	}
+	meta, err := ParseMetadata(f)
+	if err != nil {
+		return 0, err
+	}
+	if queued != nil {
+		queued(meta)
+	}
+	return ReadAck(r)
+}
+
+// WriteDenialReason sends a StreamReason frame explaining a denial. The
+// Warden may send one right after AckDenied (and the reviewer's message),
+// before the denial's metadata, and then closes the connection; shims that
+// predate it never read it.
+func WriteDenialReason(w io.Writer, reason string) error {
+	return WriteFrame(w, Frame{Type: StreamReason, Payload: []byte(reason)})
+}
+
+// ReadDenialReason reads the reason that may follow AckDenied. It returns
+// "" if the Warden closed the connection without giving one.
+func ReadDenialReason(r io.Reader) (string, error) {
+	reason, _, err := ReadDenial(r)
+	return reason, err
+}
+
+// ReadDenial reads what may follow AckDenied until the Warden closes the
+// connection: the reason and the denial's metadata. Either is empty if the
+// Warden did not send it.
+func ReadDenial(r io.Reader) (reason string, meta *ExecMetadata, err error) {
+	return ReadDenialTo(r, io.Discard)
+}
+
+// ReadDenialTo is ReadDenial, also copying StreamStderr frames, like a
+// reviewer's message, to stderr as they arrive.
+func ReadDenialTo(r io.Reader, stderr io.Writer) (reason string, meta *ExecMetadata, err error) {
+	for {
+		f, err := ReadFrame(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return reason, meta, nil
+			}
+			return reason, meta, err
+		}
+		switch f.Type {
+		case StreamReason:
+			reason = string(f.Payload)
+		case StreamStderr:
+			stderr.Write(f.Payload)
+		case StreamMeta:
+			if meta, err = ParseMetadata(f); err != nil {
+				return reason, nil, err
+			}
+		default:
+			return reason, meta, fmt.Errorf("unexpected frame type %d after denial", f.Type)
+		}
+	}
+}
+
+// WriteExitCode sends an exit code frame: the code as a 4-byte signed
+// big-endian integer.
 func WriteExitCode(w io.Writer, code int) error {
 	return WriteFrame(w, Frame{
 		Type:    StreamExit,
-		Payload: []byte{byte(code)},
+		Payload: binary.BigEndian.AppendUint32(nil, uint32(int32(code))),
 	})
 }
+
+// ParseExitCode returns the exit code a StreamExit frame carries. An empty
+// payload means success, and a single byte is the code as Wardens before
+// ExitCodeVersion send it. A payload of any other length is malformed and
+// reads as 1, so that it never passes for success.
+func ParseExitCode(f Frame) int {
+	switch len(f.Payload) {
+	case 0:
+		return 0
+	case 1:
+		return int(f.Payload[0])
+	case 4:
+		return int(int32(binary.BigEndian.Uint32(f.Payload)))
+	}
+	return 1
+}
+
+// ExitStatus narrows an exit code to the single byte a process status, or
+// a shim before ExitCodeVersion, holds: its low byte, except that a failure
+// whose low byte is zero, like 512, becomes 1 rather than pass for success.
+func ExitStatus(code int) int {
+	if code != 0 && code&0xff == 0 {
+		return 1
+	}
+	return code & 0xff
+}
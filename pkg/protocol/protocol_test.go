@@ -2,7 +2,11 @@ package protocol
 
 import (
 	"bytes"
+	"errors"
+	"path"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestRequestRoundTrip(t *testing.T) {
@@ -127,6 +131,55 @@ func TestAckRoundTrip(t *testing.T) {
 	}
 }
 
+func TestExitCodeRoundTrip(t *testing.T) {
+	for _, code := range []int{-1, 0, 137, 255, 512} {
+		var buf bytes.Buffer
+		if err := WriteExitCode(&buf, code); err != nil {
+			t.Fatalf("WriteExitCode(%d) failed: %v", code, err)
+		}
+		frame, err := ReadFrame(&buf)
+		if err != nil {
+			t.Fatalf("ReadFrame failed: %v", err)
+		}
+		if frame.Type != StreamExit || len(frame.Payload) != 4 {
+			t.Fatalf("frame = %+v, want a 4-byte exit frame", frame)
+		}
+		if got := ParseExitCode(frame); got != code {
+			t.Errorf("exit code: got %d, want %d", got, code)
+		}
+	}
+}
+
+func TestParseExitCode(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		want    int
+	}{
+		{"empty payload is success", nil, 0},
+		{"one byte from an older warden", []byte{137}, 137},
+		{"one byte cannot be negative", []byte{255}, 255},
+		{"four bytes", []byte{0, 0, 2, 0}, 512},
+		{"four bytes, negative", []byte{0xff, 0xff, 0xff, 0xff}, -1},
+		{"malformed", []byte{0, 0}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseExitCode(Frame{Type: StreamExit, Payload: tt.payload}); got != tt.want {
+				t.Errorf("ParseExitCode(%v) = %d, want %d", tt.payload, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	for code, want := range map[int]int{0: 0, 1: 1, 137: 137, 255: 255, 256: 1, 300: 44, 512: 1, -1: 255} {
+		if got := ExitStatus(code); got != want {
+			t.Errorf("ExitStatus(%d) = %d, want %d", code, got, want)
+		}
+	}
+}
+
 func TestRequestEmptyArgs(t *testing.T) {
 	original := &Request{
 		Command:  "ls",
@@ -179,3 +232,294 @@ func TestRequestUnicodePaths(t *testing.T) {
 		t.Errorf("Unicode cwd: got %q, want %q", decoded.Cwd, "/app/données")
 	}
 }
+
+func TestStatusRoundTrip(t *testing.T) {
+	original := &StatusResponse{
+		Version:       ProtocolVersion,
+		Pending:       3,
+		Jails:         2,
+		UptimeSeconds: 12.5,
+		DefaultAction: "deny",
+		ToolHasRule:   true,
+	}
+
+	var buf bytes.Buffer
+	if err := WriteStatus(&buf, original); err != nil {
+		t.Fatalf("WriteStatus failed: %v", err)
+	}
+
+	decoded, err := ReadStatus(&buf)
+	if err != nil {
+		t.Fatalf("ReadStatus failed: %v", err)
+	}
+	if *decoded != *original {
+		t.Errorf("status: got %+v, want %+v", *decoded, *original)
+	}
+}
+
+func TestMetadataRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteMetadata(&buf, &ExecMetadata{TimeoutSeconds: 300}); err != nil {
+		t.Fatalf("WriteMetadata failed: %v", err)
+	}
+	frame, err := ReadFrame(&buf)
+	if err != nil {
+		t.Fatalf("ReadFrame failed: %v", err)
+	}
+	if frame.Type != StreamMeta {
+		t.Fatalf("frame type = %d, want StreamMeta", frame.Type)
+	}
+	meta, err := ParseMetadata(frame)
+	if err != nil {
+		t.Fatalf("ParseMetadata failed: %v", err)
+	}
+	if meta.Timeout() != 5*time.Minute {
+		t.Errorf("timeout = %v, want 5m", meta.Timeout())
+	}
+}
+
+func TestDenialReasonRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteDenialReason(&buf, "warden maintenance: upgrading"); err != nil {
+		t.Fatalf("WriteDenialReason failed: %v", err)
+	}
+	reason, err := ReadDenialReason(&buf)
+	if err != nil || reason != "warden maintenance: upgrading" {
+		t.Errorf("ReadDenialReason = %q, %v", reason, err)
+	}
+
+	// A denial without a reason is just a closed connection
+	reason, err = ReadDenialReason(&buf)
+	if err != nil || reason != "" {
+		t.Errorf("ReadDenialReason at EOF = %q, %v; want no reason", reason, err)
+	}
+}
+
+func TestReadDenial(t *testing.T) {
+	var buf bytes.Buffer
+	WriteDenialReason(&buf, "warden maintenance: upgrading")
+	WriteMetadata(&buf, &ExecMetadata{RequestID: "req-1", Decision: DecisionDeny, Outcome: OutcomeMaintenance})
+	reason, meta, err := ReadDenial(&buf)
+	if err != nil || reason != "warden maintenance: upgrading" || meta == nil || meta.RequestID != "req-1" {
+		t.Errorf("ReadDenial = %q, %+v, %v", reason, meta, err)
+	}
+
+	// Metadata without a reason still reads as no reason
+	WriteMetadata(&buf, &ExecMetadata{RequestID: "req-2", Decision: DecisionDeny})
+	reason, err = ReadDenialReason(&buf)
+	if err != nil || reason != "" {
+		t.Errorf("ReadDenialReason = %q, %v; want no reason", reason, err)
+	}
+
+	WriteFrame(&buf, Frame{Type: StreamStdout, Payload: []byte("x")})
+	if _, _, err := ReadDenial(&buf); err == nil {
+		t.Error("ReadDenial accepted output after a denial")
+	}
+}
+
+func TestReadDenialTo(t *testing.T) {
+	var buf bytes.Buffer
+	WriteFrame(&buf, Frame{Type: StreamStderr, Payload: []byte("clawrden reviewer: use make deploy\n")})
+	WriteDenialReason(&buf, "not on a Friday")
+	WriteMetadata(&buf, &ExecMetadata{RequestID: "req-1", Decision: DecisionDeny})
+	var stderr bytes.Buffer
+	reason, meta, err := ReadDenialTo(&buf, &stderr)
+	if err != nil || reason != "not on a Friday" || meta == nil || meta.RequestID != "req-1" {
+		t.Errorf("ReadDenialTo = %q, %+v, %v", reason, meta, err)
+	}
+	if got := stderr.String(); got != "clawrden reviewer: use make deploy\n" {
+		t.Errorf("stderr = %q, want the reviewer's message", got)
+	}
+}
+
+// writeCounter counts Write calls.
+type writeCounter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *writeCounter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+func TestWriteFrameSingleWrite(t *testing.T) {
+	var w writeCounter
+	if err := WriteFrame(&w, Frame{Type: StreamStdout, Payload: []byte("hello")}); err != nil {
+		t.Fatalf("WriteFrame: %v", err)
+	}
+	if w.writes != 1 {
+		t.Errorf("WriteFrame used %d writes, want 1", w.writes)
+	}
+	if w.Len() != FrameHeaderSize+5 {
+		t.Errorf("wrote %d bytes, want %d", w.Len(), FrameHeaderSize+5)
+	}
+
+	frame, err := ReadFrame(&w.Buffer)
+	if err != nil || string(frame.Payload) != "hello" {
+		t.Errorf("ReadFrame = %+v, %v", frame, err)
+	}
+}
+
+func TestWriteRequestSingleWrite(t *testing.T) {
+	req := &Request{Command: "ls", Args: []string{"-la"}, Env: []string{"PATH=/bin", "NIX_CFLAGS"}}
+	for range 2 { // The second write reuses the first's buffer
+		var w writeCounter
+		if err := WriteRequest(&w, req); err != nil {
+			t.Fatalf("WriteRequest: %v", err)
+		}
+		if w.writes != 1 {
+			t.Errorf("WriteRequest used %d writes, want 1", w.writes)
+		}
+		got, err := ReadRequest(&w.Buffer)
+		if err != nil || got.Command != "ls" || len(got.Env) != 2 || w.Len() != 0 {
+			t.Errorf("ReadRequest = %+v, %v; %d bytes left", got, err, w.Len())
+		}
+	}
+}
+
+func TestSanitizeCorrelationID(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"task-42", "task-42"},
+		{"org/repo@v1.2:build_3", "org/repo@v1.2:build_3"},
+		{"run 7;$(reboot)", "run_7___reboot_"},
+		{"tâche\n", "t_che_"},
+		{strings.Repeat("a", MaxCorrelationIDLen+10), strings.Repeat("a", MaxCorrelationIDLen)},
+	}
+	for _, tt := range tests {
+		if got := SanitizeCorrelationID(tt.in); got != tt.want {
+			t.Errorf("SanitizeCorrelationID(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSessionSanitize(t *testing.T) {
+	tests := []struct {
+		in, want *Session
+	}{
+		{nil, nil},
+		{&Session{}, nil},
+		{&Session{TTY: "/dev/pts/3", LoginSession: "7"}, &Session{TTY: "/dev/pts/3", LoginSession: "7"}},
+		{&Session{SSHConnection: "10.0.0.5 52144 10.0.0.1 22"}, &Session{SSHConnection: "10.0.0.5 52144 10.0.0.1 22"}},
+		{&Session{SSHTTY: "/dev/pts/1\x1b]0;owned\a\xff"}, &Session{SSHTTY: "/dev/pts/1_]0;owned__"}},
+		{&Session{TTY: strings.Repeat("t", MaxCorrelationIDLen+1)}, &Session{TTY: strings.Repeat("t", MaxCorrelationIDLen)}},
+	}
+	for _, tt := range tests {
+		got := tt.in.Sanitize()
+		if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+			t.Errorf("%+v.Sanitize() = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRequestValidate(t *testing.T) {
+	valid := func() Request {
+		return Request{Command: "npm", Args: []string{"install", ""}, Cwd: "/app", Env: []string{"PATH=/bin", "SECRET"}}
+	}
+	tests := []struct {
+		name   string
+		mangle func(r *Request)
+		want   string // Substring of the error; empty if valid
+	}{
+		{"valid", func(r *Request) {}, ""},
+		{"unicode", func(r *Request) { r.Command, r.Cwd = "ñpm", "/app/über" }, ""},
+		{"root cwd", func(r *Request) { r.Cwd = "/" }, ""},
+		{"status without cwd", func(r *Request) { r.Type, r.Cwd = RequestTypeStatus, "" }, ""},
+		{"empty command", func(r *Request) { r.Command = "" }, "command is empty"},
+		{"absolute command", func(r *Request) { r.Command = "/usr/bin/npm" }, "is a path"},
+		{"relative command", func(r *Request) { r.Command = "bin/npm" }, "is a path"},
+		{"dot command", func(r *Request) { r.Command = ".." }, "not a name"},
+		{"long command", func(r *Request) { r.Command = strings.Repeat("n", MaxCommandLen+1) }, "command is 256 bytes"},
+		{"NUL in command", func(r *Request) { r.Command = "npm\x00rm" }, "command contains a NUL"},
+		{"empty cwd", func(r *Request) { r.Cwd = "" }, "not an absolute path"},
+		{"relative cwd", func(r *Request) { r.Cwd = "app" }, "not an absolute path"},
+		{"unclean cwd", func(r *Request) { r.Cwd = "/app/../etc" }, `want "/etc"`},
+		{"trailing slash", func(r *Request) { r.Cwd = "/app/" }, "not clean"},
+		{"long cwd", func(r *Request) { r.Cwd = "/" + strings.Repeat("d", MaxPathLen) }, "cwd is 4097 bytes"},
+		{"NUL in cwd", func(r *Request) { r.Cwd = "/app\x00/etc" }, "cwd contains a NUL"},
+		{"NUL in arg", func(r *Request) { r.Args[1] = "a\x00b" }, "args[1] contains a NUL"},
+		{"long arg", func(r *Request) { r.Args[0] = strings.Repeat("a", MaxArgLen+1) }, "args[0] is 131073 bytes"},
+		{"NUL in env", func(r *Request) { r.Env[1] = "SECRET\x00" }, "env[1] contains a NUL"},
+		{"NUL in jail", func(r *Request) { r.JailID = "jail\x00" }, "jail_id contains a NUL"},
+		{"long shim dir", func(r *Request) { r.ShimDir = strings.Repeat("s", MaxPathLen+1) }, "over 4096 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := valid()
+			tt.mangle(&r)
+			err := r.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidRequest) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate() = %v, want ErrInvalidRequest mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// FuzzReadRequest decodes arbitrary messages as requests and validates
+// them; neither may panic, and a request that validates must hold up to
+// what the warden assumes of it.
+func TestRequestNormalize(t *testing.T) {
+	for cwd, want := range map[string]string{"/app/": "/app", "/app/src/..": "/app", "//": "/", "app/": "app/", "": ""} {
+		r := Request{Cwd: cwd}
+		if r.Normalize(); r.Cwd != want {
+			t.Errorf("Normalize(%q) = %q, want %q", cwd, r.Cwd, want)
+		}
+	}
+}
+
+func FuzzReadRequest(f *testing.F) {
+	for _, req := range []*Request{
+		{Command: "npm", Args: []string{"install"}, Cwd: "/app", Env: []string{"PATH=/bin"}},
+		{Type: RequestTypeStatus, Version: ProtocolVersion, Command: "git"},
+		{Command: "/bin/sh", Args: []string{"-c", "a\x00b"}, Cwd: "/app/../etc", Session: &Session{TTY: "/dev/pts/1"}},
+	} {
+		var buf bytes.Buffer
+		WriteRequest(&buf, req)
+		f.Add(buf.Bytes())
+	}
+	f.Add([]byte("\x00\x00\x00\x02{}"))
+	f.Add([]byte("\x00\x00\x00\x10{\"args\":[null]}"))
+	f.Add([]byte("\xff\xff\xff\xff"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		req, err := ReadRequest(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		req.Normalize()
+		if err := req.Validate(); err != nil {
+			if !errors.Is(err, ErrInvalidRequest) {
+				t.Fatalf("Validate() = %v, not an ErrInvalidRequest", err)
+			}
+			return
+		}
+		if req.Command == "" || strings.ContainsAny(req.Command, "/\x00") {
+			t.Fatalf("valid request with command %q", req.Command)
+		}
+		if req.Type != RequestTypeStatus && (!path.IsAbs(req.Cwd) || path.Clean(req.Cwd) != req.Cwd) {
+			t.Fatalf("valid request with cwd %q", req.Cwd)
+		}
+
+		// A valid request stays valid on its way back over the wire
+		var buf bytes.Buffer
+		if err := WriteRequest(&buf, req); err != nil {
+			t.Fatalf("WriteRequest: %v", err)
+		}
+		again, err := ReadRequest(&buf)
+		if err != nil {
+			t.Fatalf("ReadRequest of the re-encoded request: %v", err)
+		}
+		if err := again.Validate(); err != nil {
+			t.Fatalf("re-encoded request: %v", err)
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package wardentest
+
+import (
+	"clawrden/internal/events"
+	"clawrden/pkg/protocol"
+	"sync"
+)
+
+// PendingRequest is a request waiting for a reviewer.
+type PendingRequest struct {
+	ID      string
+	Request *protocol.Request
+}
+
+// FakeApprover stands in for the human reviewer: every request that asks for
+// approval is resolved by its decide function as soon as it is queued.
+type FakeApprover struct {
+	decide func(PendingRequest) Decision
+
+	mu   sync.Mutex
+	seen []PendingRequest
+}
+
+// NewFakeApprover returns an approver that resolves requests with decide.
+// decide runs on the warden's goroutine and must not block.
+func NewFakeApprover(decide func(PendingRequest) Decision) *FakeApprover {
+	return &FakeApprover{decide: decide}
+}
+
+// ApproveAll returns an approver that approves every request.
+func ApproveAll() *FakeApprover {
+	return NewFakeApprover(func(PendingRequest) Decision { return Approve })
+}
+
+// DenyAll returns an approver that denies every request.
+func DenyAll() *FakeApprover {
+	return NewFakeApprover(func(PendingRequest) Decision { return Reject })
+}
+
+// Seen returns the requests the approver decided, in order.
+func (a *FakeApprover) Seen() []PendingRequest {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]PendingRequest(nil), a.seen...)
+}
+
+// attach starts resolving w's pending requests.
+func (a *FakeApprover) attach(w *Warden) {
+	w.Subscribe("wardentest-approver", func(e Event) {
+		enq, ok := e.(events.HITLEnqueued)
+		if !ok {
+			return
+		}
+		pr := PendingRequest{ID: enq.ID, Request: enq.Request}
+		a.mu.Lock()
+		a.seen = append(a.seen, pr)
+		a.mu.Unlock()
+		w.Resolve(pr.ID, a.decide(pr))
+	})
+}
@@ -0,0 +1,28 @@
+package wardentest
+
+// NewPolicy returns a policy deciding defaultAction for every command no
+// rule matches.
+func NewPolicy(defaultAction Action, rules ...Rule) *Policy {
+	return &Policy{DefaultAction: defaultAction, Rules: rules}
+}
+
+// AllowPolicy returns a policy that allows commands and denies the rest.
+func AllowPolicy(commands ...string) *Policy {
+	return NewPolicy(Deny, Rules(Allow, commands...)...)
+}
+
+// AskPolicy returns a policy that asks a reviewer about commands and denies
+// the rest.
+func AskPolicy(commands ...string) *Policy {
+	return NewPolicy(Deny, Rules(Ask, commands...)...)
+}
+
+// Rules returns one rule deciding action for each command, whatever its
+// arguments.
+func Rules(action Action, commands ...string) []Rule {
+	rules := make([]Rule, len(commands))
+	for i, c := range commands {
+		rules[i] = Rule{Command: c, Action: action}
+	}
+	return rules
+}
@@ -0,0 +1,118 @@
+package wardentest
+
+import (
+	"clawrden/pkg/protocol"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+// NewRequest builds a request the way a shim in a typical agent container
+// would send it: UID and GID 1000 and a minimal PATH. SendRequest fills in
+// the working directory.
+func NewRequest(command string, args ...string) *protocol.Request {
+	return &protocol.Request{
+		Command:  command,
+		Args:     args,
+		Env:      []string{"PATH=/usr/bin:/bin"},
+		Identity: protocol.Identity{UID: 1000, GID: 1000},
+	}
+}
+
+// Result is what a shim saw for one request.
+type Result struct {
+	Acks     []byte                 // Every ack received, e.g. pending then allowed
+	Pending  *protocol.ExecMetadata // Where the request stood in the review queue, if the warden said
+	Reason   string                 // Denial reason, if the warden sent one
+	Frames   []protocol.Frame       // Every frame after the final allowed ack
+	Stdout   string
+	Stderr   string
+	ExitCode int // -1 unless the command ran
+}
+
+// Allowed reports whether the command was run.
+func (r *Result) Allowed() bool {
+	return len(r.Acks) > 0 && r.Acks[len(r.Acks)-1] == protocol.AckAllowed
+}
+
+// Denied reports whether the request was denied outright, without waiting
+// for a reviewer.
+func (r *Result) Denied() bool {
+	return len(r.Acks) == 1 && r.Acks[0] == protocol.AckDenied
+}
+
+// Queued reports whether the request waited for a reviewer.
+func (r *Result) Queued() bool {
+	return len(r.Acks) > 0 && r.Acks[0] == protocol.AckPendingHITL
+}
+
+// Dial connects to the warden's socket, as a shim would. The connection is
+// closed when the test ends.
+func (w *Warden) Dial(t testing.TB) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("unix", w.SocketPath)
+	if err != nil {
+		t.Fatalf("wardentest: dial warden: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// SendRequest sends req over a new connection and collects everything the
+// warden answers until the command exits or is denied. A request waiting for
+// a reviewer blocks until it is resolved, by a FakeApprover or by the test.
+// An empty Cwd is replaced with the warden's directory.
+func (w *Warden) SendRequest(t testing.TB, req *protocol.Request) *Result {
+	t.Helper()
+	if req.Cwd == "" {
+		copied := *req
+		copied.Cwd = w.Dir
+		req = &copied
+	}
+	conn := w.Dial(t)
+	defer conn.Close()
+	if err := protocol.WriteRequest(conn, req); err != nil {
+		t.Fatalf("wardentest: write request: %v", err)
+	}
+
+	res := &Result{ExitCode: -1}
+	ack, err := protocol.ReadAck(conn)
+	if err != nil {
+		t.Fatalf("wardentest: read ack: %v", err)
+	}
+	res.Acks = append(res.Acks, ack)
+	for ack == protocol.AckPendingHITL {
+		ack, err = protocol.ReadResolution(conn, func(meta *protocol.ExecMetadata) { res.Pending = meta })
+		if err != nil {
+			t.Fatalf("wardentest: read ack: %v", err)
+		}
+		res.Acks = append(res.Acks, ack)
+	}
+	if ack == protocol.AckDenied {
+		if res.Reason, err = protocol.ReadDenialReason(conn); err != nil {
+			t.Fatalf("wardentest: read denial reason: %v", err)
+		}
+		return res
+	}
+
+	for {
+		frame, err := protocol.ReadFrame(conn)
+		if errors.Is(err, io.EOF) {
+			return res // The warden hung up without an exit frame
+		}
+		if err != nil {
+			t.Fatalf("wardentest: read frame: %v", err)
+		}
+		res.Frames = append(res.Frames, frame)
+		switch frame.Type {
+		case protocol.StreamStdout:
+			res.Stdout += string(frame.Payload)
+		case protocol.StreamStderr:
+			res.Stderr += string(frame.Payload)
+		case protocol.StreamExit:
+			res.ExitCode = protocol.ParseExitCode(frame)
+			return res
+		}
+	}
+}
@@ -0,0 +1,354 @@
+// Package wardentest runs a real warden inside Go tests. It starts a server
+// on a temporary socket with its audit log, transcripts and jailhouse in a
+// temporary directory, speaks the shim protocol to it, and can stand in for
+// the human reviewer.
+//
+//	w := wardentest.StartTestWarden(t, wardentest.Options{
+//		Policy: &wardentest.Policy{
+//			DefaultAction: wardentest.Deny,
+//			Rules:         []wardentest.Rule{{Command: "echo", Action: wardentest.Allow}},
+//		},
+//	})
+//	res := w.SendRequest(t, wardentest.NewRequest("echo", "hi"))
+//	if !res.Allowed() || res.Stdout != "hi\n" { ... }
+//
+// The types below are aliases of the warden's own, so values can be built and
+// inspected without importing its internal packages.
+package wardentest
+
+import (
+	"clawrden/internal/events"
+	"clawrden/internal/warden"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Policy and the types it is built from describe a warden policy, field for
+// field as in the policy YAML file.
+type (
+	Policy         = warden.PolicyConfig
+	Rule           = warden.Rule
+	JailConfig     = warden.JailConfig
+	IncidentPolicy = warden.IncidentPolicy
+	TimeoutNotices = warden.TimeoutNotices
+	Action         = warden.Action
+)
+
+// Policy actions.
+const (
+	Allow = warden.ActionAllow
+	Deny  = warden.ActionDeny
+	Ask   = warden.ActionAsk
+)
+
+// Decision is a reviewer's decision on a pending request.
+type Decision = warden.Decision
+
+// Reviewer decisions.
+const (
+	Approve = warden.DecisionApprove
+	Reject  = warden.DecisionDeny
+)
+
+// AuditEntry is one line of the warden's audit log.
+type AuditEntry = warden.AuditEntry
+
+// Event is anything the warden publishes on its event bus.
+type Event = events.Event
+
+// readyTimeout bounds how long StartTestWarden waits for the socket and API.
+const readyTimeout = 5 * time.Second
+
+// Options configures a test warden. The zero value runs the built-in
+// deny-all policy without the HTTP API.
+type Options struct {
+	Policy     *Policy // Written to a policy file in the warden's directory
+	PolicyPath string  // An existing policy file, used when Policy is nil
+
+	// Resolve requests that ask for approval automatically
+	Approver *FakeApprover
+
+	// Serve the HTTP API on a free localhost port (see Warden.APIURL)
+	API bool
+
+	// Base URL reviewers reach the warden at (see Config.PublicURL)
+	PublicURL string
+
+	// Bearer token for the admin endpoints (see Config.AdminToken)
+	AdminToken string
+
+	// Serve the gRPC API on a free localhost port (see Warden.GRPCAddr),
+	// requiring GRPCToken when set
+	GRPC      bool
+	GRPCToken string
+
+	// Only trust the shim binary in Armory (see Config.RequireShimProvenance)
+	RequireShimProvenance bool
+	Armory                string // Shim armory (default: <Dir>/armory)
+
+	Logger *log.Logger // Warden log (default: discarded)
+}
+
+// Warden is a running test warden.
+type Warden struct {
+	Dir        string // Temporary directory holding the warden's files
+	SocketPath string // Unix socket shims connect to
+	APIURL     string // Base URL of the HTTP API; empty unless Options.API
+	GRPCAddr   string // Address of the gRPC API; empty unless Options.GRPC
+	AuditPath  string // Audit log
+
+	srv     *warden.Server
+	served  chan error
+	closing sync.Once
+}
+
+// StartTestWarden starts a warden for opts and waits until it accepts
+// connections. It is shut down when the test ends, or earlier by Close.
+func StartTestWarden(t testing.TB, opts Options) *Warden {
+	t.Helper()
+	dir := t.TempDir()
+
+	// Socket paths are limited to about 100 bytes; test names make
+	// t.TempDir() paths long, so the socket lives in a short directory.
+	sockDir, err := os.MkdirTemp("", "wardentest")
+	if err != nil {
+		t.Fatalf("wardentest: create socket directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(sockDir) })
+
+	policyPath := opts.PolicyPath
+	if opts.Policy != nil {
+		policyPath = WritePolicy(t, opts.Policy)
+	}
+	armory := opts.Armory
+	if armory == "" {
+		armory = filepath.Join(dir, "armory")
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.New(io.Discard, "", 0)
+	}
+
+	w := &Warden{
+		Dir:        dir,
+		SocketPath: filepath.Join(sockDir, "warden.sock"),
+		AuditPath:  filepath.Join(dir, "audit.log"),
+		served:     make(chan error, 1),
+	}
+	cfg := warden.Config{
+		SocketPath:            w.SocketPath,
+		PolicyPath:            policyPath,
+		AuditPath:             w.AuditPath,
+		Logger:                logger,
+		JailhouseArmory:       armory,
+		JailhouseRoot:         filepath.Join(dir, "jailhouse"),
+		JailhouseState:        filepath.Join(dir, "jailhouse.state.json"),
+		SandboxRoot:           filepath.Join(dir, "sandboxes"),
+		TranscriptDir:         filepath.Join(dir, "transcripts"),
+		RequireShimProvenance: opts.RequireShimProvenance,
+		PublicURL:             opts.PublicURL,
+		AdminToken:            opts.AdminToken,
+	}
+	if opts.API {
+		addr, err := freeAddr()
+		if err != nil {
+			t.Fatalf("wardentest: pick API port: %v", err)
+		}
+		cfg.APIAddr = addr
+		w.APIURL = "http://" + addr
+	}
+	if opts.GRPC {
+		addr, err := freeAddr()
+		if err != nil {
+			t.Fatalf("wardentest: pick gRPC port: %v", err)
+		}
+		cfg.GRPCAddr = addr
+		cfg.GRPCToken = opts.GRPCToken
+		w.GRPCAddr = addr
+	}
+
+	w.srv, err = warden.NewServer(cfg)
+	if err != nil {
+		t.Fatalf("wardentest: create warden: %v", err)
+	}
+	if opts.Approver != nil {
+		opts.Approver.attach(w)
+	}
+	go func() { w.served <- w.srv.ListenAndServe() }()
+	t.Cleanup(w.Close)
+
+	if err := w.waitReady(); err != nil {
+		t.Fatalf("wardentest: %v", err)
+	}
+	return w
+}
+
+// freeAddr returns a localhost address with a port that was free a moment ago.
+func freeAddr() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+	return l.Addr().String(), nil
+}
+
+// waitReady waits until the socket, and the APIs if enabled, accept requests.
+func (w *Warden) waitReady() error {
+	deadline := time.Now().Add(readyTimeout)
+	for {
+		err := w.ping()
+		if err == nil {
+			return nil
+		}
+		select {
+		case serveErr := <-w.served:
+			return fmt.Errorf("warden stopped during startup: %v", serveErr)
+		default:
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("warden not ready after %v: %v", readyTimeout, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// ping checks the socket and the APIs once.
+func (w *Warden) ping() error {
+	conn, err := net.Dial("unix", w.SocketPath)
+	if err != nil {
+		return err
+	}
+	conn.Close()
+	if w.GRPCAddr != "" {
+		conn, err := net.Dial("tcp", w.GRPCAddr)
+		if err != nil {
+			return err
+		}
+		conn.Close()
+	}
+	if w.APIURL == "" {
+		return nil
+	}
+	resp, err := http.Get(w.APIURL + "/readyz")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Close shuts the warden down. It is safe to call more than once.
+func (w *Warden) Close() {
+	w.closing.Do(w.srv.Shutdown)
+}
+
+// Server returns the underlying warden for what the helpers don't cover.
+func (w *Warden) Server() *warden.Server {
+	return w.srv
+}
+
+// Subscribe calls fn with every event the warden publishes from now on.
+// fn runs on the publishing goroutine and must not block. The returned
+// function unsubscribes.
+func (w *Warden) Subscribe(name string, fn func(Event)) (unsubscribe func()) {
+	return w.srv.GetEvents().Subscribe(name, fn)
+}
+
+// Pending returns the requests waiting for a reviewer.
+func (w *Warden) Pending() []PendingRequest {
+	var pending []PendingRequest
+	for _, pr := range w.srv.GetHITLQueue().List() {
+		pending = append(pending, PendingRequest{ID: pr.ID, Request: pr.Request})
+	}
+	return pending
+}
+
+// WaitPending waits until at least n requests are waiting for a reviewer and
+// returns them.
+func (w *Warden) WaitPending(t testing.TB, n int) []PendingRequest {
+	t.Helper()
+	deadline := time.Now().Add(readyTimeout)
+	for {
+		pending := w.Pending()
+		if len(pending) >= n {
+			return pending
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("wardentest: %d pending requests after %v, want %d", len(pending), readyTimeout, n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// ErrNotPending is returned when resolving a request that is not waiting
+// for a reviewer.
+var ErrNotPending = errors.New("request is not pending")
+
+// Resolve decides a pending request, as a reviewer would.
+func (w *Warden) Resolve(id string, d Decision) error {
+	if !w.srv.GetHITLQueue().Resolve(id, d) {
+		return fmt.Errorf("%w: %s", ErrNotPending, id)
+	}
+	return nil
+}
+
+// AuditEntries returns the audit log so far.
+func (w *Warden) AuditEntries() ([]AuditEntry, error) {
+	return warden.ReadAuditLog(w.AuditPath)
+}
+
+// WaitAudit waits until the audit log has at least n entries, none of them
+// for a command still running, and returns them. Entries are finished
+// after the shim got the exit frame, so a test that just read a command's
+// output may have to wait for them. An entry without a valid decision
+// fails the test.
+func (w *Warden) WaitAudit(t testing.TB, n int) []AuditEntry {
+	t.Helper()
+	deadline := time.Now().Add(readyTimeout)
+	for {
+		entries, err := w.AuditEntries()
+		if err != nil {
+			t.Fatalf("wardentest: read audit log: %v", err)
+		}
+		unfinished := slices.ContainsFunc(entries, func(e AuditEntry) bool { return e.Phase == warden.PhaseStarted })
+		if len(entries) >= n && !unfinished {
+			for i := range entries {
+				if err := entries[i].Validate(); err != nil {
+					t.Errorf("wardentest: audit entry %d (%s): %v", entries[i].Seq, entries[i].Command, err)
+				}
+			}
+			return entries
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("wardentest: %d audit entries after %v, want %d", len(entries), readyTimeout, n)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// WritePolicy writes policy as YAML to a temporary file and returns its path.
+func WritePolicy(t testing.TB, policy *Policy) string {
+	t.Helper()
+	data, err := yaml.Marshal(policy)
+	if err != nil {
+		t.Fatalf("wardentest: marshal policy: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("wardentest: write policy: %v", err)
+	}
+	return path
+}
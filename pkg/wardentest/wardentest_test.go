@@ -0,0 +1,37 @@
+package wardentest
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestStartTestWardenServesAPI(t *testing.T) {
+	w := StartTestWarden(t, Options{
+		Policy: &Policy{
+			DefaultAction: Deny,
+			Rules:         []Rule{{Command: "echo", Action: Ask}},
+		},
+		Approver: DenyAll(),
+		API:      true,
+	})
+
+	res := w.SendRequest(t, NewRequest("echo", "hi"))
+	if !res.Queued() || res.Allowed() || res.ExitCode != -1 {
+		t.Errorf("result = %+v, want queued then denied", res)
+	}
+
+	w.WaitAudit(t, 1)
+	resp, err := http.Get(w.APIURL + "/api/history")
+	if err != nil {
+		t.Fatalf("GET /api/history: %v", err)
+	}
+	defer resp.Body.Close()
+	var entries []AuditEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil || len(entries) != 1 {
+		t.Fatalf("history = %+v, %v; want the denied request", entries, err)
+	}
+
+	w.Close()
+	w.Close()
+}
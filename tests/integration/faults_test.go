@@ -0,0 +1,144 @@
+//go:build faultinject
+
+package integration
+
+import (
+	"bytes"
+	"clawrden/internal/events"
+	"clawrden/internal/faultinject"
+	"clawrden/pkg/protocol"
+	"clawrden/pkg/wardentest"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// startFaultWarden starts a warden with a jail for commands and disarms
+// every injection point when the test ends.
+func startFaultWarden(t *testing.T, action wardentest.Action, commands ...string) *wardentest.Warden {
+	t.Helper()
+	var rules []wardentest.Rule
+	for _, c := range commands {
+		rules = append(rules, wardentest.Rule{Command: c, Action: action})
+	}
+	w := wardentest.StartTestWarden(t, wardentest.Options{
+		Policy: &wardentest.Policy{
+			DefaultAction: wardentest.Deny,
+			Jails:         map[string]wardentest.JailConfig{"agent": {Commands: commands}},
+			Rules:         rules,
+		},
+		Armory: buildShim(t),
+	})
+	t.Cleanup(faultinject.Reset)
+	return w
+}
+
+// startShim starts the real shim for command through the agent jail.
+func startShim(t *testing.T, w *wardentest.Warden, stderr *bytes.Buffer, command string, args ...string) *exec.Cmd {
+	t.Helper()
+	shim := exec.Command(filepath.Join(w.Dir, "jailhouse", "agent", "bin", command), args...)
+	shim.Dir = w.Dir
+	shim.Env = []string{"CLAWRDEN_SOCKET=" + w.SocketPath, "PATH=/usr/bin:/bin"}
+	shim.Stderr = stderr
+	if err := shim.Start(); err != nil {
+		t.Fatalf("start shim: %v", err)
+	}
+	return shim
+}
+
+// exitCode waits for the shim and returns its exit code.
+func exitCode(t *testing.T, shim *exec.Cmd) int {
+	t.Helper()
+	err := shim.Wait()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		t.Fatalf("wait for shim: %v", err)
+	}
+	return shim.ProcessState.ExitCode()
+}
+
+// TestFaultTruncatedFrame cuts the first output frame short and drops the
+// connection: the shim reports a stream failure and the audit log a
+// partially delivered, failed execution.
+func TestFaultTruncatedFrame(t *testing.T) {
+	w := startFaultWarden(t, wardentest.Allow, "echo")
+	// The metadata frame goes through; the first line of output does not
+	faultinject.Set(faultinject.PointWriteFrame, faultinject.Fault{Skip: 1, Truncate: 3, Times: 1})
+
+	var stderr bytes.Buffer
+	if code := exitCode(t, startShim(t, w, &stderr, "echo", "cut", "short")); code != 125 {
+		t.Errorf("shim exit code = %d, want 125 (stderr %q)", code, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "stream error at frame 2") {
+		t.Errorf("shim stderr = %q, want the failing frame named", stderr.String())
+	}
+
+	entry := w.WaitAudit(t, 1)[0]
+	if entry.Decision != protocol.DecisionAllow || entry.ExitCode == 0 || entry.Delivery != "partial" || entry.Error == "" {
+		t.Errorf("audit entry = decision %q, exit %d, delivery %q, error %q; want a failed, partial delivery",
+			entry.Decision, entry.ExitCode, entry.Delivery, entry.Error)
+	}
+}
+
+// TestFaultDisconnectWhilePending drops the connection right after the
+// pending ack: the shim gives up, and the request leaves the queue as
+// expired instead of waiting for a reviewer nobody can answer.
+func TestFaultDisconnectWhilePending(t *testing.T) {
+	w := startFaultWarden(t, wardentest.Ask, "echo")
+	faultinject.Set(faultinject.PointPendingAck, faultinject.Fault{Disconnect: true, Times: 1})
+
+	var stderr bytes.Buffer
+	if code := exitCode(t, startShim(t, w, &stderr, "echo", "never", "reviewed")); code != 1 {
+		t.Errorf("shim exit code = %d, want 1 (stderr %q)", code, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "lost connection while awaiting approval") {
+		t.Errorf("shim stderr = %q, want the lost connection reported", stderr.String())
+	}
+
+	entry := w.WaitAudit(t, 1)[0]
+	if entry.Decision != protocol.DecisionDeny || entry.Outcome != protocol.OutcomeHITLExpired {
+		t.Errorf("audit decision = %q, want deny (HITL expired)", entry.DecisionLabel())
+	}
+	if pending := w.Pending(); len(pending) != 0 {
+		t.Errorf("queue still holds %d requests", len(pending))
+	}
+}
+
+// TestFaultExecutorReturnsAfterCancel interrupts a running command while
+// the executor is slow to return: the shim exits as interrupted, and the
+// warden still audits the execution as failed instead of hanging.
+func TestFaultExecutorReturnsAfterCancel(t *testing.T) {
+	w := startFaultWarden(t, wardentest.Allow, "sleep")
+	faultinject.Set(faultinject.PointExecExit, faultinject.Fault{Delay: 300 * time.Millisecond, Times: 1})
+
+	started := make(chan struct{}, 1)
+	unsubscribe := w.Subscribe("test", func(e wardentest.Event) {
+		if _, ok := e.(events.ExecutionStarted); ok {
+			started <- struct{}{}
+		}
+	})
+	defer unsubscribe()
+
+	var stderr bytes.Buffer
+	shim := startShim(t, w, &stderr, "sleep", "30")
+	select {
+	case <-started:
+	case <-time.After(10 * time.Second):
+		t.Fatal("command never started")
+	}
+	time.Sleep(100 * time.Millisecond) // Let the executor reach the command
+	shim.Process.Signal(syscall.SIGINT)
+	if code := exitCode(t, shim); code != 130 {
+		t.Errorf("shim exit code = %d, want 130 (stderr %q)", code, stderr.String())
+	}
+
+	entry := w.WaitAudit(t, 1)[0]
+	if entry.Decision != protocol.DecisionAllow || entry.ExitCode == 0 || entry.Error == "" || entry.Duration > 10000 {
+		t.Errorf("audit entry = exit %d, error %q, duration %vms; want a prompt failure",
+			entry.ExitCode, entry.Error, entry.Duration)
+	}
+}
@@ -0,0 +1,165 @@
+package integration
+
+import (
+	"bytes"
+	"clawrden/pkg/grpcapi"
+	"clawrden/pkg/wardentest"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const grpcToken = "integration-token"
+
+// dialGRPC connects to the warden's gRPC API and returns a client and a
+// context carrying the bearer token.
+func dialGRPC(t *testing.T, w *wardentest.Warden) (grpcapi.WardenControlClient, context.Context) {
+	t.Helper()
+	conn, err := grpc.NewClient(w.GRPCAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial gRPC: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	return grpcapi.NewWardenControlClient(conn), metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+grpcToken)
+}
+
+// TestGRPCApprovalWhileShimWaits runs the HTTP and gRPC APIs against one
+// warden, watches the queue over gRPC and approves the request of a real
+// shim that is waiting for it.
+func TestGRPCApprovalWhileShimWaits(t *testing.T) {
+	armory := buildShim(t)
+	w := wardentest.StartTestWarden(t, wardentest.Options{
+		Policy: &wardentest.Policy{
+			DefaultAction: wardentest.Deny,
+			Jails:         map[string]wardentest.JailConfig{"agent": {Commands: []string{"echo"}}},
+			Rules:         []wardentest.Rule{{Command: "echo", Action: wardentest.Ask}},
+		},
+		Armory:    armory,
+		API:       true,
+		GRPC:      true,
+		GRPCToken: grpcToken,
+	})
+	client, ctx := dialGRPC(t, w)
+
+	// Calls without the token are refused
+	if _, err := client.GetStatus(context.Background(), &grpcapi.GetStatusRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("GetStatus without token: %v, want Unauthenticated", err)
+	}
+
+	watch, err := client.WatchEvents(ctx, &grpcapi.WatchEventsRequest{Names: []string{"hitl_enqueued", "hitl_resolved"}})
+	if err != nil {
+		t.Fatalf("WatchEvents: %v", err)
+	}
+	if _, err := watch.Header(); err != nil {
+		t.Fatalf("WatchEvents header: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	shim := exec.Command(filepath.Join(w.Dir, "jailhouse", "agent", "bin", "echo"), "approved", "over", "grpc")
+	shim.Dir = w.Dir
+	shim.Env = []string{"CLAWRDEN_SOCKET=" + w.SocketPath, "PATH=/usr/bin:/bin"}
+	shim.Stdout, shim.Stderr = &stdout, &stderr
+	if err := shim.Start(); err != nil {
+		t.Fatalf("start shim: %v", err)
+	}
+
+	enqueued, err := watch.Recv()
+	if err != nil || enqueued.GetName() != "hitl_enqueued" || enqueued.GetCommand() != "echo" {
+		t.Fatalf("first event = %v, %v; want hitl_enqueued for echo", enqueued, err)
+	}
+
+	// Both APIs see the same queue
+	queue, err := client.ListQueue(ctx, &grpcapi.ListQueueRequest{})
+	if err != nil || len(queue.GetRequests()) != 1 || queue.GetRequests()[0].GetId() != enqueued.GetId() {
+		t.Fatalf("ListQueue = %v, %v; want %s", queue, err, enqueued.GetId())
+	}
+	resp, err := http.Get(w.APIURL + "/api/queue")
+	if err != nil {
+		t.Fatalf("GET /api/queue: %v", err)
+	}
+	var httpQueue []struct{ ID string }
+	json.NewDecoder(resp.Body).Decode(&httpQueue)
+	resp.Body.Close()
+	if len(httpQueue) != 1 || httpQueue[0].ID != enqueued.GetId() {
+		t.Fatalf("HTTP queue = %+v, want %s", httpQueue, enqueued.GetId())
+	}
+
+	if _, err := client.Resolve(ctx, &grpcapi.ResolveRequest{Id: enqueued.GetId(), Decision: grpcapi.Decision_DECISION_APPROVE}); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	resolved, err := watch.Recv()
+	if err != nil || resolved.GetName() != "hitl_resolved" || !strings.Contains(resolved.GetDetailJson(), `"approved":true`) {
+		t.Fatalf("second event = %v, %v; want an approved hitl_resolved", resolved, err)
+	}
+
+	if err := shim.Wait(); err != nil || strings.TrimSpace(stdout.String()) != "approved over grpc" {
+		t.Fatalf("shim = %q, %v; want the approved output", stdout.String(), err)
+	}
+	if !strings.Contains(stderr.String(), "awaiting approval") {
+		t.Errorf("shim stderr = %q; want it to have waited for approval", stderr.String())
+	}
+
+	w.WaitAudit(t, 1)
+	history, err := client.QueryHistory(ctx, &grpcapi.QueryHistoryRequest{Command: "echo"})
+	if err != nil || len(history.GetEntries()) != 1 || history.GetEntries()[0].GetRequestId() != enqueued.GetId() {
+		t.Errorf("QueryHistory = %v, %v; want the approved request", history, err)
+	}
+	if _, err := client.Resolve(ctx, &grpcapi.ResolveRequest{Id: enqueued.GetId(), Decision: grpcapi.Decision_DECISION_APPROVE}); status.Code(err) != codes.NotFound {
+		t.Errorf("resolving a finished request: %v, want NotFound", err)
+	}
+}
+
+// TestGRPCJails manages a jail over gRPC and reads it back over HTTP.
+func TestGRPCJails(t *testing.T) {
+	w := wardentest.StartTestWarden(t, wardentest.Options{Armory: buildShim(t), API: true, GRPC: true, GRPCToken: grpcToken})
+	client, ctx := dialGRPC(t, w)
+
+	jail, err := client.CreateJail(ctx, &grpcapi.CreateJailRequest{
+		JailId:    "ci",
+		Commands:  []string{"npm"},
+		RulesJson: `[{"command": "npm", "action": "allow"}]`,
+	})
+	if err != nil || jail.GetJailId() != "ci" || jail.GetRulesJson() == "" {
+		t.Fatalf("CreateJail = %v, %v", jail, err)
+	}
+	if _, err := client.CreateJail(ctx, &grpcapi.CreateJailRequest{JailId: "ci", Commands: []string{"npm"}}); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("duplicate CreateJail: %v, want AlreadyExists", err)
+	}
+	if _, err := client.CreateJail(ctx, &grpcapi.CreateJailRequest{JailId: "bad", Commands: []string{"npm"}, RulesJson: "{"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("CreateJail with broken rules: %v, want InvalidArgument", err)
+	}
+
+	resp, err := http.Get(w.APIURL + "/api/jails/ci")
+	if err != nil {
+		t.Fatalf("GET /api/jails/ci: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("HTTP jail lookup: status %d", resp.StatusCode)
+	}
+
+	if _, err := client.DeleteJail(ctx, &grpcapi.DeleteJailRequest{JailId: "ci"}); err != nil {
+		t.Fatalf("DeleteJail: %v", err)
+	}
+	if _, err := client.GetJail(ctx, &grpcapi.GetJailRequest{JailId: "ci"}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetJail after delete: %v, want NotFound", err)
+	}
+	list, err := client.ListJails(ctx, &grpcapi.ListJailsRequest{})
+	if err != nil || len(list.GetJails()) != 0 {
+		t.Errorf("ListJails = %v, %v; want none", list, err)
+	}
+}
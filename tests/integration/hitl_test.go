@@ -0,0 +1,267 @@
+package integration
+
+import (
+	"clawrden/pkg/protocol"
+	"clawrden/pkg/wardentest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// auditWant is what a scenario expects of the audit entry for one request,
+// told apart from the others by its arguments.
+type auditWant struct {
+	args       string
+	decision   string
+	resolution string
+	exitCode   int
+}
+
+// assertAudit checks that the audit log holds exactly one entry per want,
+// in any order, as concurrent requests may finish in any order.
+func assertAudit(t *testing.T, w *wardentest.Warden, want ...auditWant) []wardentest.AuditEntry {
+	t.Helper()
+	entries := w.WaitAudit(t, len(want))
+	if len(entries) != len(want) {
+		t.Fatalf("audit log has %d entries, want %d: %+v", len(entries), len(want), entries)
+	}
+	for _, wa := range want {
+		i := slices.IndexFunc(entries, func(e wardentest.AuditEntry) bool {
+			return strings.Join(e.Args, " ") == wa.args
+		})
+		if i < 0 {
+			t.Errorf("no audit entry for %q", wa.args)
+			continue
+		}
+		e := entries[i]
+		if e.DecisionLabel() != wa.decision || e.Resolution != wa.resolution || e.ExitCode != wa.exitCode || e.RequestID == "" {
+			t.Errorf("audit entry for %q: decision %q, resolution %q, exit code %d, request ID %q; want %q, %q, %d",
+				wa.args, e.DecisionLabel(), e.Resolution, e.ExitCode, e.RequestID, wa.decision, wa.resolution, wa.exitCode)
+		}
+	}
+	return entries
+}
+
+// TestHITLApproveStreamsOutput approves a queued command and checks that its
+// output, on both streams, and exit code reach the shim.
+func TestHITLApproveStreamsOutput(t *testing.T) {
+	w := wardentest.StartTestWarden(t, wardentest.Options{Policy: wardentest.AskPolicy("sh")})
+
+	done := make(chan *wardentest.Result)
+	go func() {
+		done <- w.SendRequest(t, wardentest.NewRequest("sh", "-c", "echo out; echo err >&2; exit 3"))
+	}()
+	pending := w.WaitPending(t, 1)
+	if err := w.Resolve(pending[0].ID, wardentest.Approve); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+
+	res := <-done
+	if !slices.Equal(res.Acks, []byte{protocol.AckPendingHITL, protocol.AckAllowed}) {
+		t.Fatalf("acks = %v, want pending then allowed", res.Acks)
+	}
+	if res.Stdout != "out\n" || res.Stderr != "err\n" || res.ExitCode != 3 {
+		t.Errorf("stdout %q, stderr %q, exit code %d; want out, err, 3", res.Stdout, res.Stderr, res.ExitCode)
+	}
+	if last := res.Frames[len(res.Frames)-1]; last.Type != protocol.StreamExit {
+		t.Errorf("last frame type = %d, want exit", last.Type)
+	}
+
+	entry := assertAudit(t, w, auditWant{"-c echo out; echo err >&2; exit 3", "allow (after HITL)", "human", 3})[0]
+	if entry.RequestID != pending[0].ID || entry.BytesStdout != 4 || entry.BytesStderr != 4 {
+		t.Errorf("audit entry: request ID %q, %d bytes stdout, %d bytes stderr; want %q, 4, 4",
+			entry.RequestID, entry.BytesStdout, entry.BytesStderr, pending[0].ID)
+	}
+}
+
+// TestHITLDenySendsAckDenied denies a queued command: the shim gets the
+// denial after the pending ack and nothing runs.
+func TestHITLDenySendsAckDenied(t *testing.T) {
+	w := wardentest.StartTestWarden(t, wardentest.Options{Policy: wardentest.AskPolicy("echo")})
+
+	done := make(chan *wardentest.Result)
+	go func() { done <- w.SendRequest(t, wardentest.NewRequest("echo", "denied")) }()
+	if err := w.Resolve(w.WaitPending(t, 1)[0].ID, wardentest.Reject); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+
+	res := <-done
+	if !slices.Equal(res.Acks, []byte{protocol.AckPendingHITL, protocol.AckDenied}) {
+		t.Fatalf("acks = %v, want pending then denied", res.Acks)
+	}
+	if len(res.Frames) != 0 || res.ExitCode != -1 {
+		t.Errorf("denied command produced %d frames, exit code %d", len(res.Frames), res.ExitCode)
+	}
+	assertAudit(t, w, auditWant{"denied", "deny (after HITL)", "human", 0})
+}
+
+// TestHITLCancelWhilePending hangs up while the request waits for a
+// reviewer: it leaves the queue as expired and can no longer be approved.
+func TestHITLCancelWhilePending(t *testing.T) {
+	w := wardentest.StartTestWarden(t, wardentest.Options{Policy: wardentest.AskPolicy("echo")})
+
+	conn := w.Dial(t)
+	req := wardentest.NewRequest("echo", "abandoned")
+	req.Cwd = w.Dir
+	if err := protocol.WriteRequest(conn, req); err != nil {
+		t.Fatalf("write request: %v", err)
+	}
+	if ack, err := protocol.ReadAck(conn); err != nil || ack != protocol.AckPendingHITL {
+		t.Fatalf("ack = %d, %v; want pending", ack, err)
+	}
+	id := w.WaitPending(t, 1)[0].ID
+	conn.Close()
+
+	assertAudit(t, w, auditWant{"abandoned", "deny (HITL expired)", "expired", 0})
+	if pending := w.Pending(); len(pending) != 0 {
+		t.Errorf("queue still holds %d requests", len(pending))
+	}
+	if err := w.Resolve(id, wardentest.Approve); err == nil {
+		t.Error("approving an abandoned request succeeded")
+	}
+}
+
+// TestHITLConcurrentResolutionOrder queues several requests at once and
+// resolves them in different orders: each shim gets its own decision and
+// output, whatever order the reviewer works in.
+func TestHITLConcurrentResolutionOrder(t *testing.T) {
+	decisions := map[string]wardentest.Decision{
+		"first":  wardentest.Approve,
+		"second": wardentest.Reject,
+		"third":  wardentest.Approve,
+	}
+	tests := []struct {
+		name  string
+		order []string
+	}{
+		{"queue order", []string{"first", "second", "third"}},
+		{"reverse order", []string{"third", "second", "first"}},
+		{"denial first", []string{"second", "third", "first"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := wardentest.StartTestWarden(t, wardentest.Options{Policy: wardentest.AskPolicy("echo")})
+
+			results := make(map[string]chan *wardentest.Result)
+			for arg := range decisions {
+				result := make(chan *wardentest.Result, 1)
+				results[arg] = result
+				go func() { result <- w.SendRequest(t, wardentest.NewRequest("echo", arg)) }()
+			}
+			ids := make(map[string]string)
+			for _, pr := range w.WaitPending(t, len(decisions)) {
+				ids[pr.Request.Args[0]] = pr.ID
+			}
+
+			var want []auditWant
+			for i, arg := range tt.order {
+				if err := w.Resolve(ids[arg], decisions[arg]); err != nil {
+					t.Fatalf("Resolve %s: %v", arg, err)
+				}
+				select {
+				case res := <-results[arg]:
+					results[arg] <- res
+				case <-time.After(5 * time.Second):
+					t.Fatalf("%s not answered after its decision", arg)
+				}
+				// Deciding one request leaves the others waiting
+				if pending := w.Pending(); len(pending) != len(tt.order)-i-1 {
+					t.Errorf("after deciding %s, %d requests pending; want %d", arg, len(pending), len(tt.order)-i-1)
+				}
+
+				if decisions[arg] == wardentest.Approve {
+					want = append(want, auditWant{arg, "allow (after HITL)", "human", 0})
+				} else {
+					want = append(want, auditWant{arg, "deny (after HITL)", "human", 0})
+				}
+			}
+
+			for arg, decision := range decisions {
+				res := <-results[arg]
+				if decision == wardentest.Approve && (!res.Allowed() || res.Stdout != arg+"\n") {
+					t.Errorf("%s: acks %v, stdout %q; want its approved output", arg, res.Acks, res.Stdout)
+				}
+				if decision == wardentest.Reject && (res.Allowed() || !res.Queued() || res.Stdout != "") {
+					t.Errorf("%s: acks %v, stdout %q; want queued then denied", arg, res.Acks, res.Stdout)
+				}
+			}
+			assertAudit(t, w, want...)
+		})
+	}
+}
+
+// TestHITLPendingMetadata queues two requests from current shims: after the
+// pending ack, each is told its request ID, place in the queue, review
+// timeout and dashboard link before the decision.
+func TestHITLPendingMetadata(t *testing.T) {
+	policy := wardentest.AskPolicy("echo")
+	policy.DefaultHITLTimeout = 10 * time.Minute
+	w := wardentest.StartTestWarden(t, wardentest.Options{Policy: policy, PublicURL: "https://warden.example.com/"})
+
+	results := make(chan *wardentest.Result, 2)
+	for i, arg := range []string{"first", "second"} {
+		req := wardentest.NewRequest("echo", arg)
+		req.Version = protocol.ProtocolVersion
+		go func() { results <- w.SendRequest(t, req) }()
+		w.WaitPending(t, i+1) // Queue them in order
+	}
+	for _, pr := range w.Pending() {
+		if err := w.Resolve(pr.ID, wardentest.Approve); err != nil {
+			t.Fatalf("Resolve: %v", err)
+		}
+	}
+
+	ids := make(map[string]string)
+	for range 2 {
+		res := <-results
+		if !slices.Equal(res.Acks, []byte{protocol.AckPendingHITL, protocol.AckAllowed}) || res.Pending == nil {
+			t.Fatalf("acks = %v, pending metadata %+v; want pending with metadata, then allowed", res.Acks, res.Pending)
+		}
+		arg := strings.TrimSpace(res.Stdout)
+		meta := res.Pending
+		ids[arg] = meta.RequestID
+		wantPosition := map[string]int{"first": 1, "second": 2}[arg]
+		if meta.QueuePosition != wantPosition || meta.HITLTimeout() != 10*time.Minute ||
+			meta.ReviewURL != "https://warden.example.com/#"+meta.RequestID || meta.Decision != protocol.DecisionNone || meta.WardenVersion != protocol.ProtocolVersion {
+			t.Errorf("%s: pending metadata %+v; want position %d, 10m timeout and a link to its request", arg, meta, wantPosition)
+		}
+	}
+	for _, e := range assertAudit(t, w,
+		auditWant{"first", "allow (after HITL)", "human", 0},
+		auditWant{"second", "allow (after HITL)", "human", 0},
+	) {
+		if ids[e.Args[0]] != e.RequestID {
+			t.Errorf("%s: pending metadata named %s, audited as %s", e.Args[0], ids[e.Args[0]], e.RequestID)
+		}
+	}
+}
+
+// TestHITLPendingMetadataOldShims checks that shims older than
+// protocol.PendingMetaVersion, which read the deciding ack right after the
+// pending one, are sent nothing in between.
+func TestHITLPendingMetadataOldShims(t *testing.T) {
+	w := wardentest.StartTestWarden(t, wardentest.Options{Policy: wardentest.AskPolicy("echo"), PublicURL: "https://warden.example.com"})
+
+	for _, version := range []int{0, protocol.PendingMetaVersion - 1} {
+		conn := w.Dial(t)
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		req := wardentest.NewRequest("echo", "old")
+		req.Version = version
+		req.Cwd = w.Dir
+		if err := protocol.WriteRequest(conn, req); err != nil {
+			t.Fatalf("write request: %v", err)
+		}
+		if ack, err := protocol.ReadAck(conn); err != nil || ack != protocol.AckPendingHITL {
+			t.Fatalf("version %d: ack = %d, %v; want pending", version, ack, err)
+		}
+		if err := w.Resolve(w.WaitPending(t, 1)[0].ID, wardentest.Approve); err != nil {
+			t.Fatalf("Resolve: %v", err)
+		}
+		// As the shim before pending metadata read it
+		if ack, err := protocol.ReadAck(conn); err != nil || ack != protocol.AckAllowed {
+			t.Fatalf("version %d: byte after the pending ack = %d, %v; want the allowed ack", version, ack, err)
+		}
+		conn.Close()
+	}
+}
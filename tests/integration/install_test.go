@@ -0,0 +1,49 @@
+package integration
+
+import (
+	"clawrden/internal/install"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// TestInstallOwnership applies an install as root, for another owner, and
+// checks what it created. It changes ownership, so it only runs with
+// CLAWRDEN_ROOT_TESTS=1.
+func TestInstallOwnership(t *testing.T) {
+	if os.Getenv("CLAWRDEN_ROOT_TESTS") != "1" {
+		t.Skip("set CLAWRDEN_ROOT_TESTS=1 to run as root")
+	}
+	if os.Geteuid() != 0 {
+		t.Skip("needs root")
+	}
+
+	dir := t.TempDir()
+	layout := install.SystemLayout()
+	for _, p := range []*string{&layout.ConfigDir, &layout.SocketDir, &layout.StateDir, &layout.LogDir, &layout.UnitDir} {
+		*p = filepath.Join(dir, *p)
+	}
+	const owner = 65534 // nobody
+	ops, err := install.Plan(install.Options{Layout: layout, Binary: "/usr/local/bin/warden", Shim: []byte("#!/bin/sh\n"), UID: owner, GID: owner})
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	run := func(args []string) error { return nil } // Leave the host's systemd alone
+	if err := install.Apply(ops, run, io.Discard); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	for _, path := range []string{layout.SocketDir, layout.Armory(), layout.Jailhouse(), layout.Transcripts(), layout.LogDir, filepath.Join(layout.Armory(), "clawrden-shim"), layout.UnitPath()} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Errorf("stat: %v", err)
+			continue
+		}
+		st := info.Sys().(*syscall.Stat_t)
+		if st.Uid != owner || st.Gid != owner {
+			t.Errorf("%s owned by %d:%d, want %d:%d", path, st.Uid, st.Gid, owner, owner)
+		}
+	}
+}
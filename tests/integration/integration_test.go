@@ -1,14 +1,20 @@
 package integration
 
 import (
-	"clawrden/internal/warden"
+	"clawrden/internal/events"
 	"clawrden/pkg/protocol"
+	"clawrden/pkg/wardentest"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"log"
-	"net"
+	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -16,374 +22,649 @@ import (
 // TestShimWardenAllowedCommand tests the full flow:
 // shim connects → sends request → warden evaluates "allow" → local exec → streams back
 func TestShimWardenAllowedCommand(t *testing.T) {
-	socketPath := tempSocketPath(t)
-	tmpDir := t.TempDir()
+	w := wardentest.StartTestWarden(t, wardentest.Options{Policy: wardentest.AllowPolicy("echo")})
 
-	// Start the warden server
-	srv := startTestWarden(t, socketPath)
-	defer srv.Shutdown()
+	res := w.SendRequest(t, wardentest.NewRequest("echo", "hello", "clawrden"))
+	if !res.Allowed() {
+		t.Fatalf("acks = %v, want allowed", res.Acks)
+	}
+	if res.ExitCode != 0 {
+		t.Errorf("expected exit code 0, got %d (stderr: %s)", res.ExitCode, res.Stderr)
+	}
+	if expected := "hello clawrden\n"; res.Stdout != expected {
+		t.Errorf("stdout: got %q, want %q", res.Stdout, expected)
+	}
+}
 
-	// Wait for the server to be ready
-	waitForSocket(t, socketPath)
+// TestShimWardenDeniedCommand tests that denied commands get AckDenied.
+func TestShimWardenDeniedCommand(t *testing.T) {
+	// Anything but the deny rule is queued and rejected, never run
+	w := wardentest.StartTestWarden(t, wardentest.Options{
+		Policy: wardentest.NewPolicy(wardentest.Ask,
+			wardentest.Rule{Command: "rm", Args: []string{"-rf", "/"}, Action: wardentest.Deny}),
+		Approver: wardentest.DenyAll(),
+	})
 
-	// Connect as a shim would
-	conn, err := net.Dial("unix", socketPath)
-	if err != nil {
-		t.Fatalf("dial warden: %v", err)
+	req := wardentest.NewRequest("rm", "-rf", "/")
+	req.Cwd = "/app"
+	if res := w.SendRequest(t, req); !res.Denied() {
+		t.Fatalf("acks = %v, want denied", res.Acks)
 	}
-	defer conn.Close()
+}
 
-	// Send a request for an allowed command (echo)
-	req := &protocol.Request{
-		Command:  "echo",
-		Args:     []string{"hello", "clawrden"},
-		Cwd:      tmpDir,
-		Env:      []string{"PATH=/usr/bin:/bin"},
-		Identity: protocol.Identity{UID: 1000, GID: 1000},
+// TestShimWardenPathRejection tests that requests with cwd outside /app are rejected.
+func TestShimWardenPathRejection(t *testing.T) {
+	policy := wardentest.AllowPolicy("ls")
+	policy.AllowedPaths = []string{"/app/*"}
+	w := wardentest.StartTestWarden(t, wardentest.Options{Policy: policy})
+
+	req := wardentest.NewRequest("ls", "-la")
+	req.Cwd = "/etc"
+	if res := w.SendRequest(t, req); !res.Denied() {
+		t.Fatalf("acks = %v, want denied for path outside /app", res.Acks)
 	}
+}
 
-	if err := protocol.WriteRequest(conn, req); err != nil {
-		t.Fatalf("write request: %v", err)
+// TestShimWardenCustomAllowedPath tests that a cwd outside /app runs end to end
+// when the policy's allowed_paths permits it, and that traversal out of it is denied.
+func TestShimWardenCustomAllowedPath(t *testing.T) {
+	root := t.TempDir()
+	workspace := filepath.Join(root, "workspace", "project")
+	if err := os.MkdirAll(workspace, 0755); err != nil {
+		t.Fatalf("mkdir workspace: %v", err)
 	}
 
-	// Read ack — should be allowed
-	ack, err := protocol.ReadAck(conn)
-	if err != nil {
-		t.Fatalf("read ack: %v", err)
-	}
-	if ack != protocol.AckAllowed {
-		t.Fatalf("expected AckAllowed (0), got %d", ack)
+	w := wardentest.StartTestWarden(t, wardentest.Options{Policy: &wardentest.Policy{
+		DefaultAction: wardentest.Deny,
+		AllowedPaths:  []string{root + "/workspace/*"},
+		Rules:         []wardentest.Rule{{Command: "pwd", Action: wardentest.Allow}},
+	}})
+
+	tests := []struct {
+		name    string
+		cwd     string
+		allowed bool
+	}{
+		{"inside allowed path", workspace, true},
+		{"trailing slash normalized", workspace + "/", true},
+		{"traversal out of allowed path", filepath.Join(root, "workspace") + "/../..", false},
 	}
 
-	// Read frames until exit
-	var stdout, stderr []byte
-	exitCode := -1
-
-	for {
-		frame, err := protocol.ReadFrame(conn)
-		if err != nil {
-			if err == io.EOF {
-				break
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := wardentest.NewRequest("pwd")
+			req.Cwd = tt.cwd
+			res := w.SendRequest(t, req)
+			if res.Allowed() != tt.allowed || res.Denied() == tt.allowed {
+				t.Fatalf("acks = %v, want allowed %v", res.Acks, tt.allowed)
 			}
-			t.Fatalf("read frame: %v", err)
-		}
-
-		switch frame.Type {
-		case protocol.StreamStdout:
-			stdout = append(stdout, frame.Payload...)
-		case protocol.StreamStderr:
-			stderr = append(stderr, frame.Payload...)
-		case protocol.StreamExit:
-			if len(frame.Payload) > 0 {
-				exitCode = int(frame.Payload[0])
-			} else {
-				exitCode = 0
+			if !tt.allowed {
+				return
 			}
-			goto done
-		}
+			if res.ExitCode != 0 {
+				t.Fatalf("expected exit code 0, got %d", res.ExitCode)
+			}
+			if want := workspace + "\n"; res.Stdout != want {
+				t.Errorf("stdout: got %q, want %q", res.Stdout, want)
+			}
+		})
 	}
+}
+
+// TestShimWardenHITLFlow tests the human-in-the-loop approval flow.
+func TestShimWardenHITLFlow(t *testing.T) {
+	approver := wardentest.NewFakeApprover(func(pr wardentest.PendingRequest) wardentest.Decision {
+		if pr.Request.Args[0] == "approved-output" {
+			return wardentest.Approve
+		}
+		return wardentest.Reject
+	})
+	w := wardentest.StartTestWarden(t, wardentest.Options{Policy: wardentest.AskPolicy("echo"), Approver: approver})
 
-done:
-	if exitCode != 0 {
-		t.Errorf("expected exit code 0, got %d (stderr: %s)", exitCode, string(stderr))
+	res := w.SendRequest(t, wardentest.NewRequest("echo", "approved-output"))
+	if !res.Queued() || !res.Allowed() {
+		t.Fatalf("acks = %v, want pending then allowed", res.Acks)
+	}
+	if res.Stdout != "approved-output\n" {
+		t.Errorf("stdout: got %q", res.Stdout)
 	}
 
-	expected := "hello clawrden\n"
-	if string(stdout) != expected {
-		t.Errorf("stdout: got %q, want %q", string(stdout), expected)
+	res = w.SendRequest(t, wardentest.NewRequest("echo", "rejected-output"))
+	if !res.Queued() || res.Allowed() {
+		t.Fatalf("acks = %v, want pending then denied", res.Acks)
+	}
+	if seen := approver.Seen(); len(seen) != 2 {
+		t.Errorf("approver saw %d requests, want 2", len(seen))
 	}
 }
 
-// TestShimWardenDeniedCommand tests that denied commands get AckDenied.
-func TestShimWardenDeniedCommand(t *testing.T) {
-	socketPath := tempSocketPath(t)
+// TestShimWardenManualApproval resolves a queued request from the test
+// itself, as a reviewer using the API would.
+func TestShimWardenManualApproval(t *testing.T) {
+	w := wardentest.StartTestWarden(t, wardentest.Options{Policy: wardentest.AskPolicy("echo")})
 
-	srv := startTestWarden(t, socketPath)
-	defer srv.Shutdown()
+	done := make(chan *wardentest.Result)
+	go func() { done <- w.SendRequest(t, wardentest.NewRequest("echo", "manual")) }()
 
-	waitForSocket(t, socketPath)
+	pending := w.WaitPending(t, 1)
+	if err := w.Resolve(pending[0].ID, wardentest.Approve); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if res := <-done; !res.Allowed() || res.Stdout != "manual\n" {
+		t.Errorf("result = %+v, want approved output", res)
+	}
+	if err := w.Resolve(pending[0].ID, wardentest.Approve); err == nil {
+		t.Error("resolving a finished request succeeded")
+	}
+}
 
-	conn, err := net.Dial("unix", socketPath)
-	if err != nil {
-		t.Fatalf("dial warden: %v", err)
+// TestMultipleConcurrentRequests tests handling multiple connections simultaneously.
+func TestMultipleConcurrentRequests(t *testing.T) {
+	w := wardentest.StartTestWarden(t, wardentest.Options{Policy: wardentest.AllowPolicy("echo")})
+
+	var wg sync.WaitGroup
+	results := make([]*wardentest.Result, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			results[n] = w.SendRequest(t, wardentest.NewRequest("echo", fmt.Sprintf("request-%d", n)))
+		}(i)
 	}
-	defer conn.Close()
+	wg.Wait()
 
-	// Send a request for a denied command (rm -rf / is explicitly denied in policy)
-	req := &protocol.Request{
-		Command:  "rm",
-		Args:     []string{"-rf", "/"},
-		Cwd:      "/app",
-		Env:      []string{},
-		Identity: protocol.Identity{UID: 1000, GID: 1000},
+	for n, res := range results {
+		if !res.Allowed() || res.ExitCode != 0 || res.Stdout != fmt.Sprintf("request-%d\n", n) {
+			t.Errorf("request %d: acks %v, exit %d, stdout %q", n, res.Acks, res.ExitCode, res.Stdout)
+		}
 	}
+}
 
-	if err := protocol.WriteRequest(conn, req); err != nil {
-		t.Fatalf("write request: %v", err)
+// TestWardenPublishesRequestLifecycle checks the event bus sees an allowed
+// request from arrival to audit, in order, and that the audit log (which
+// subscribes to the bus) still records it.
+func TestWardenPublishesRequestLifecycle(t *testing.T) {
+	w := wardentest.StartTestWarden(t, wardentest.Options{Policy: wardentest.AllowPolicy("echo")})
+
+	var mu sync.Mutex
+	var names []string
+	w.Subscribe("test", func(e wardentest.Event) {
+		mu.Lock()
+		names = append(names, e.Name())
+		mu.Unlock()
+	})
+
+	if res := w.SendRequest(t, wardentest.NewRequest("echo", "events")); !res.Allowed() || res.ExitCode != 0 {
+		t.Fatalf("acks = %v, exit code = %d", res.Acks, res.ExitCode)
 	}
 
-	// Read ack — should be denied
-	ack, err := protocol.ReadAck(conn)
-	if err != nil {
-		t.Fatalf("read ack: %v", err)
+	want := "request_received,decision_made,execution_started,execution_finished,audited"
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		got := strings.Join(names, ",")
+		mu.Unlock()
+		if got == want {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("events = %s, want %s", got, want)
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
-	if ack != protocol.AckDenied {
-		t.Fatalf("expected AckDenied (1), got %d", ack)
+
+	entries := w.WaitAudit(t, 1)
+	if len(entries) != 1 || entries[0].Command != "echo" || entries[0].Decision != protocol.DecisionAllow {
+		t.Errorf("audit entries = %+v", entries)
 	}
 }
 
-// TestShimWardenPathRejection tests that requests with cwd outside /app are rejected.
-func TestShimWardenPathRejection(t *testing.T) {
-	socketPath := tempSocketPath(t)
+// TestWardenIncidentLockdown checks that repeated denials lock the caller
+// out of even allowed commands until the incident is cleared.
+func TestWardenIncidentLockdown(t *testing.T) {
+	policy := &wardentest.Policy{
+		DefaultAction: wardentest.Deny,
+		Rules: []wardentest.Rule{
+			{Command: "echo", Action: wardentest.Allow},
+			{Command: "rm", Action: wardentest.Deny},
+		},
+	}
+	policy.Incidents.DenyThreshold = 2
+	policy.Incidents.Window = time.Minute
+	policy.Incidents.Lockdown = true
+	w := wardentest.StartTestWarden(t, wardentest.Options{Policy: policy})
+
+	opened := make(chan events.IncidentOpened, 1)
+	w.Subscribe("test", func(e wardentest.Event) {
+		if inc, ok := e.(events.IncidentOpened); ok {
+			opened <- inc
+		}
+	})
 
-	srv := startTestWarden(t, socketPath)
-	defer srv.Shutdown()
+	allowed := func(command string) bool {
+		t.Helper()
+		return w.SendRequest(t, wardentest.NewRequest(command, "x")).Allowed()
+	}
 
-	waitForSocket(t, socketPath)
+	if !allowed("echo") {
+		t.Fatal("echo denied before incident")
+	}
+	allowed("rm")
+	allowed("rm")
+
+	var inc events.IncidentOpened
+	select {
+	case inc = <-opened:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no incident opened after two denials")
+	}
+	if !inc.Lockdown || inc.Trigger != "denials" {
+		t.Errorf("incident = %+v", inc)
+	}
+	if allowed("echo") {
+		t.Fatal("echo allowed during lockdown")
+	}
 
-	conn, err := net.Dial("unix", socketPath)
-	if err != nil {
-		t.Fatalf("dial warden: %v", err)
+	if _, err := w.Server().ClearIncident(inc.ID); err != nil {
+		t.Fatalf("ClearIncident: %v", err)
 	}
-	defer conn.Close()
+	if !allowed("echo") {
+		t.Fatal("echo denied after clear")
+	}
+}
 
-	// Send request with cwd outside /app
-	req := &protocol.Request{
-		Command:  "ls",
-		Args:     []string{"-la"},
-		Cwd:      "/etc",
-		Env:      []string{},
-		Identity: protocol.Identity{UID: 1000, GID: 1000},
+// TestWardenTimeoutNotices checks the metadata frame, the timeout variable
+// in the command's environment, and the warning before the timeout kills it.
+func TestWardenTimeoutNotices(t *testing.T) {
+	w := wardentest.StartTestWarden(t, wardentest.Options{Policy: &wardentest.Policy{
+		DefaultAction:  wardentest.Deny,
+		TimeoutNotices: wardentest.TimeoutNotices{Announce: true, Env: true, Warn: true},
+		Rules: []wardentest.Rule{
+			{Command: "sh", Action: wardentest.Allow, Timeout: 30 * time.Second},
+			{Command: "sleep", Action: wardentest.Allow, Timeout: 500 * time.Millisecond},
+		},
+	}})
+
+	// The environment variable replaces the agent's value
+	req := wardentest.NewRequest("sh", "-c", "echo $CLAWRDEN_TIMEOUT_SECONDS")
+	req.Env = append(req.Env, "CLAWRDEN_TIMEOUT_SECONDS=999")
+	res := w.SendRequest(t, req)
+	if !res.Allowed() {
+		t.Fatalf("acks = %v, want allowed", res.Acks)
+	}
+	if res.Frames[0].Type != protocol.StreamMeta {
+		t.Fatalf("first frame type = %d, want metadata", res.Frames[0].Type)
+	}
+	if meta, err := protocol.ParseMetadata(res.Frames[0]); err != nil || meta.Timeout() != 30*time.Second {
+		t.Errorf("metadata = %+v, %v; want 30s", meta, err)
+	}
+	if strings.TrimSpace(res.Stdout) != "30" {
+		t.Errorf("CLAWRDEN_TIMEOUT_SECONDS = %q, want 30", res.Stdout)
 	}
 
+	// A command outliving its timeout is warned at 80%. The frames are read
+	// by hand to see when the warning arrives.
+	conn := w.Dial(t)
+	req = wardentest.NewRequest("sleep", "5")
+	req.Cwd = w.Dir
 	if err := protocol.WriteRequest(conn, req); err != nil {
 		t.Fatalf("write request: %v", err)
 	}
-
-	// Should be denied due to path violation
-	ack, err := protocol.ReadAck(conn)
-	if err != nil {
-		t.Fatalf("read ack: %v", err)
+	if ack, err := protocol.ReadAck(conn); err != nil || ack != protocol.AckAllowed {
+		t.Fatalf("ack = %d, %v; want allowed", ack, err)
+	}
+	start := time.Now()
+	warned := false
+	for {
+		frame, err := protocol.ReadFrame(conn)
+		if err != nil {
+			t.Fatalf("read frame: %v", err)
+		}
+		if frame.Type == protocol.StreamExit {
+			break
+		}
+		if frame.Type == protocol.StreamStderr && strings.Contains(string(frame.Payload), "time limit used") {
+			warned = true
+			if at := time.Since(start); at < 350*time.Millisecond {
+				t.Errorf("warning after %v, want about 400ms", at)
+			}
+		}
 	}
-	if ack != protocol.AckDenied {
-		t.Fatalf("expected AckDenied (1) for path outside /app, got %d", ack)
+	if !warned {
+		t.Error("no timeout warning")
 	}
 }
 
-// TestShimWardenHITLFlow tests the human-in-the-loop approval flow.
-func TestShimWardenHITLFlow(t *testing.T) {
-	socketPath := tempSocketPath(t)
-
-	// Create a warden with a policy that has "ask" rules
-	srv := startTestWardenWithPolicy(t, socketPath, &warden.PolicyEngine{})
-	defer srv.Shutdown()
-
-	waitForSocket(t, socketPath)
-
-	// We'll approve the request from a separate goroutine
-	approved := make(chan struct{})
-	go func() {
-		// Wait a bit for the request to be queued
-		time.Sleep(200 * time.Millisecond)
-
-		// Find and approve the pending request
-		queue := srv.GetHITLQueue()
-		pending := queue.List()
-		if len(pending) > 0 {
-			queue.Resolve(pending[0].ID, warden.DecisionApprove)
-		}
-		close(approved)
-	}()
+// TestShimTimeoutExitCode runs a command through the real shim that
+// outlives its 1-second limit, and checks that the agent sees the output
+// from before the kill, why it was killed and timeout(1)'s exit code.
+func TestShimTimeoutExitCode(t *testing.T) {
+	armory := buildShim(t)
+	w := wardentest.StartTestWarden(t, wardentest.Options{
+		Policy: &wardentest.Policy{
+			DefaultAction: wardentest.Deny,
+			Jails:         map[string]wardentest.JailConfig{"agent": {Commands: []string{"sh"}}},
+			Rules:         []wardentest.Rule{{Command: "sh", Action: wardentest.Allow, ExecTimeout: time.Second}},
+		},
+		Armory: armory,
+	})
 
-	conn, err := net.Dial("unix", socketPath)
-	if err != nil {
-		t.Fatalf("dial warden: %v", err)
+	shim := exec.Command(filepath.Join(w.Dir, "jailhouse", "agent", "bin", "sh"), "-c", "echo building; exec sleep 5")
+	shim.Dir = w.Dir
+	shim.Env = []string{"CLAWRDEN_SOCKET=" + w.SocketPath, "PATH=/usr/bin:/bin"}
+	var stdout, stderr strings.Builder
+	shim.Stdout, shim.Stderr = &stdout, &stderr
+	start := time.Now()
+	err := shim.Run()
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Errorf("shim took %v; the limit did not stop the command", elapsed)
 	}
-	defer conn.Close()
 
-	// Send a request for a command that requires HITL (npm in policy.yaml)
-	tmpDir := t.TempDir()
-	req := &protocol.Request{
-		Command:  "echo",
-		Args:     []string{"approved-output"},
-		Cwd:      tmpDir,
-		Env:      []string{"PATH=/usr/bin:/bin"},
-		Identity: protocol.Identity{UID: 1000, GID: 1000},
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 124 {
+		t.Errorf("shim exited with %v, want exit code 124 (stderr %q)", err, stderr.String())
+	}
+	if stdout.String() != "building\n" {
+		t.Errorf("stdout = %q, want the output from before the kill", stdout.String())
+	}
+	if want := "clawrden: command exceeded the 1-second time limit set by policy rule 'rule 1 (sh)'"; !strings.Contains(stderr.String(), want) {
+		t.Errorf("stderr = %q, missing %q", stderr.String(), want)
 	}
 
-	if err := protocol.WriteRequest(conn, req); err != nil {
-		t.Fatalf("write request: %v", err)
+	entries := w.WaitAudit(t, 1)
+	if e := entries[0]; e.ExitCode != 124 || !e.TimeoutViolation || e.TimeoutLimit != "exec" || e.Outcome != protocol.OutcomeTimeout {
+		t.Errorf("audited exit code %d, timeout_violation %v, timeout_limit %q, outcome %v", e.ExitCode, e.TimeoutViolation, e.TimeoutLimit, e.Outcome)
 	}
+}
 
-	// Read ack — should be pending HITL
-	ack, err := protocol.ReadAck(conn)
+// buildShim builds the shim into a new armory and returns the armory.
+func buildShim(t *testing.T) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("builds the shim binary")
+	}
+	gobin, err := exec.LookPath("go")
 	if err != nil {
-		t.Fatalf("read ack: %v", err)
+		t.Skip("go toolchain not available")
 	}
-	if ack != protocol.AckPendingHITL {
-		// If the default policy is used and echo is allowed, skip this test
-		t.Skipf("echo is allowed by default policy, skipping HITL test (ack=%d)", ack)
+	armory := filepath.Join(t.TempDir(), "armory")
+	build := exec.Command(gobin, "build", "-o", filepath.Join(armory, "clawrden-shim"), "../../cmd/shim")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("build shim: %v\n%s", err, out)
 	}
+	return armory
+}
 
-	// Read the second ack after approval
-	ack2, err := protocol.ReadAck(conn)
-	if err != nil {
-		t.Fatalf("read resolved ack: %v", err)
+// TestWardenRequireShimProvenance runs the real shim through a jail symlink
+// against a warden that only trusts the armory shim.
+func TestWardenRequireShimProvenance(t *testing.T) {
+	armory := buildShim(t)
+
+	w := wardentest.StartTestWarden(t, wardentest.Options{
+		Policy: &wardentest.Policy{
+			DefaultAction: wardentest.Deny,
+			Jails:         map[string]wardentest.JailConfig{"agent": {Commands: []string{"echo"}}},
+			Rules:         []wardentest.Rule{{Command: "echo", Action: wardentest.Allow}},
+		},
+		Armory:                armory,
+		RequireShimProvenance: true,
+	})
+
+	// The shim, invoked as a jail command, passes
+	shim := exec.Command(filepath.Join(w.Dir, "jailhouse", "agent", "bin", "echo"), "through", "the", "jail")
+	shim.Dir = w.Dir
+	shim.Env = []string{"CLAWRDEN_SOCKET=" + w.SocketPath, "PATH=/usr/bin:/bin"}
+	out, err := shim.CombinedOutput()
+	if err != nil || strings.TrimSpace(string(out)) != "through the jail" {
+		t.Fatalf("shim = %q, %v; want the echoed arguments", out, err)
 	}
-	if ack2 != protocol.AckAllowed {
-		t.Fatalf("expected AckAllowed after approval, got %d", ack2)
+
+	// A client speaking the protocol itself is refused
+	if res := w.SendRequest(t, wardentest.NewRequest("echo", "forged")); !res.Denied() {
+		t.Fatalf("acks = %v, want denied", res.Acks)
 	}
 
-	<-approved
+	found := false
+	for _, entry := range w.WaitAudit(t, 2) {
+		found = found || entry.Decision == protocol.DecisionDeny && entry.Outcome == protocol.OutcomeUntrustedClient
+	}
+	if !found {
+		t.Error("audit log has no untrusted client denial")
+	}
 }
 
-// TestMultipleConcurrentRequests tests handling multiple connections simultaneously.
-func TestMultipleConcurrentRequests(t *testing.T) {
-	socketPath := tempSocketPath(t)
-	tmpDir := t.TempDir()
-
-	srv := startTestWarden(t, socketPath)
-	defer srv.Shutdown()
+// TestShimRequestOverhead runs the real shim from an environment like a CI
+// container's, with hundreds of variables and megabytes of values, and
+// checks that building and sending the request stays a few milliseconds.
+func TestShimRequestOverhead(t *testing.T) {
+	armory := buildShim(t)
+	w := wardentest.StartTestWarden(t, wardentest.Options{
+		Policy: &wardentest.Policy{
+			DefaultAction: wardentest.Deny,
+			Jails:         map[string]wardentest.JailConfig{"agent": {Commands: []string{"true"}}},
+			Rules:         []wardentest.Rule{{Command: "true", Action: wardentest.Allow}},
+		},
+		Armory: armory,
+	})
 
-	waitForSocket(t, socketPath)
+	resultPath := filepath.Join(t.TempDir(), "result.json")
+	shim := exec.Command(filepath.Join(w.Dir, "jailhouse", "agent", "bin", "true"))
+	shim.Dir = w.Dir
+	shim.Env = []string{"CLAWRDEN_SOCKET=" + w.SocketPath, "PATH=/usr/bin:/bin", "CLAWRDEN_RESULT_FILE=" + resultPath}
+	for i := range 400 {
+		shim.Env = append(shim.Env, fmt.Sprintf("CI_VAR_%d=value-%d", i, i))
+	}
+	for i := range 8 {
+		// Each value stays under the kernel's 128KB limit per variable
+		shim.Env = append(shim.Env, fmt.Sprintf("NIX_BUILD_%d=%s", i, strings.Repeat("/nix/store/abc-pkg ", 6000)))
+	}
+	if out, err := shim.CombinedOutput(); err != nil {
+		t.Fatalf("shim: %v\n%s", err, out)
+	}
 
-	// Send 5 concurrent requests
-	errs := make(chan error, 5)
-	for i := 0; i < 5; i++ {
-		go func(n int) {
-			conn, err := net.Dial("unix", socketPath)
-			if err != nil {
-				errs <- fmt.Errorf("dial %d: %v", n, err)
-				return
-			}
-			defer conn.Close()
-
-			req := &protocol.Request{
-				Command:  "echo",
-				Args:     []string{fmt.Sprintf("request-%d", n)},
-				Cwd:      tmpDir,
-				Env:      []string{"PATH=/usr/bin:/bin"},
-				Identity: protocol.Identity{UID: 1000, GID: 1000},
-			}
+	data, err := os.ReadFile(resultPath)
+	if err != nil {
+		t.Fatalf("read result: %v", err)
+	}
+	var result struct {
+		Decision   string `json:"decision"`
+		OverheadUS int64  `json:"overhead_us"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil || result.Decision != "allow" {
+		t.Fatalf("result = %s, %v", data, err)
+	}
+	if limit := 5 * time.Millisecond; time.Duration(result.OverheadUS)*time.Microsecond > limit {
+		t.Errorf("shim took %dus to send its request, want under %v", result.OverheadUS, limit)
+	}
 
-			if err := protocol.WriteRequest(conn, req); err != nil {
-				errs <- fmt.Errorf("write %d: %v", n, err)
-				return
-			}
+	// Values the warden drops never crossed the socket, but their names are audited
+	entries := w.WaitAudit(t, 1)
+	if env := entries[0].Env; env == nil || !slices.Contains(env.NotAllowlisted, "NIX_BUILD_7") {
+		t.Errorf("audited env = %+v, want NIX_BUILD_7 among the dropped names", env)
+	}
+}
 
-			ack, err := protocol.ReadAck(conn)
-			if err != nil {
-				errs <- fmt.Errorf("read ack %d: %v", n, err)
-				return
-			}
-			if ack != protocol.AckAllowed {
-				errs <- fmt.Errorf("request %d not allowed: ack=%d", n, ack)
-				return
-			}
+// TestShimCorrelationIDs runs the real shim with task and run IDs in its
+// environment and follows them to the queue, the audit log and the history API.
+func TestShimCorrelationIDs(t *testing.T) {
+	armory := buildShim(t)
+	approver := wardentest.ApproveAll()
+	w := wardentest.StartTestWarden(t, wardentest.Options{
+		Policy: &wardentest.Policy{
+			DefaultAction: wardentest.Deny,
+			Jails:         map[string]wardentest.JailConfig{"agent": {Commands: []string{"env"}}},
+			Rules:         []wardentest.Rule{{Command: "env", Action: wardentest.Ask}},
+		},
+		Armory:   armory,
+		Approver: approver,
+		API:      true,
+	})
 
-			// Read until exit
-			for {
-				frame, err := protocol.ReadFrame(conn)
-				if err != nil {
-					errs <- fmt.Errorf("frame %d: %v", n, err)
-					return
-				}
-				if frame.Type == protocol.StreamExit {
-					if len(frame.Payload) > 0 && frame.Payload[0] != 0 {
-						errs <- fmt.Errorf("request %d exit code: %d", n, frame.Payload[0])
-						return
-					}
-					break
-				}
-			}
+	shim := exec.Command(filepath.Join(w.Dir, "jailhouse", "agent", "bin", "env"))
+	shim.Dir = w.Dir
+	shim.Env = []string{
+		"CLAWRDEN_SOCKET=" + w.SocketPath,
+		"PATH=/usr/bin:/bin",
+		"CLAWRDEN_TASK_ID=task-42",
+		"CLAWRDEN_RUN_ID=run 7;$(reboot)",
+	}
+	out, err := shim.CombinedOutput()
+	if err != nil {
+		t.Fatalf("shim: %v\n%s", err, out)
+	}
+	// The IDs are recorded, not passed on to the command
+	if strings.Contains(string(out), "CLAWRDEN_TASK_ID") {
+		t.Errorf("task ID leaked into the command's environment:\n%s", out)
+	}
 
-			errs <- nil
-		}(i)
+	const wantRun = "run_7___reboot_"
+	if seen := approver.Seen(); len(seen) != 1 || seen[0].Request.TaskID != "task-42" || seen[0].Request.RunID != wantRun {
+		t.Fatalf("queued requests = %+v", seen)
+	}
+	entries := w.WaitAudit(t, 1)
+	if entries[0].TaskID != "task-42" || entries[0].RunID != wantRun {
+		t.Errorf("audited task %q run %q", entries[0].TaskID, entries[0].RunID)
 	}
 
-	for i := 0; i < 5; i++ {
-		if err := <-errs; err != nil {
-			t.Error(err)
+	for query, want := range map[string]int{"task-42": 1, "task-43": 0} {
+		resp, err := http.Get(w.APIURL + "/api/history?task_id=" + query)
+		if err != nil {
+			t.Fatalf("GET /api/history: %v", err)
+		}
+		var history []wardentest.AuditEntry
+		err = json.NewDecoder(resp.Body).Decode(&history)
+		resp.Body.Close()
+		if err != nil || len(history) != want {
+			t.Errorf("history for %s = %d entries, %v; want %d", query, len(history), err, want)
 		}
 	}
 }
 
-// ── Helpers ─────────────────────────────────────────────────────────────────
-
-func tempSocketPath(t *testing.T) string {
-	t.Helper()
-	dir := t.TempDir()
-	return filepath.Join(dir, "warden.sock")
-}
-
-func startTestWarden(t *testing.T, socketPath string) *warden.Server {
-	t.Helper()
+// TestWardenTranscripts checks that transcripts are saved for transcript
+// rules and failed executions, and referenced from the audit log.
+func TestWardenTranscripts(t *testing.T) {
+	w := wardentest.StartTestWarden(t, wardentest.Options{Policy: &wardentest.Policy{
+		DefaultAction:     wardentest.Deny,
+		TranscriptOnError: true,
+		Rules: []wardentest.Rule{
+			{Command: "echo", Action: wardentest.Allow, Transcript: true},
+			{Command: "true", Action: wardentest.Allow},
+			{Command: "clawrden-no-such-command", Action: wardentest.Allow},
+		},
+	}})
+
+	for _, command := range []string{"echo", "true", "clawrden-no-such-command"} {
+		if res := w.SendRequest(t, wardentest.NewRequest(command, "recorded")); !res.Allowed() {
+			t.Fatalf("%s: acks = %v; want allowed", command, res.Acks)
+		}
+	}
 
-	// Use the project's policy.yaml if available, otherwise default policy
-	policyPath := "../../policy.yaml"
+	entries := w.WaitAudit(t, 3)
+	if len(entries) != 3 {
+		t.Fatalf("got %d audit entries, want 3", len(entries))
+	}
 
-	logger := log.New(io.Discard, "[test-warden] ", log.LstdFlags)
+	wantTypes := map[string]string{
+		"echo":                     "stdout",
+		"true":                     "",
+		"clawrden-no-such-command": "stderr",
+	}
+	for _, entry := range entries {
+		wantType := wantTypes[entry.Command]
+		if wantType == "" {
+			if entry.Transcript != "" {
+				t.Errorf("%s: unexpected transcript %s", entry.Command, entry.Transcript)
+			}
+			continue
+		}
+		records, err := w.Server().ReadTranscript(entry.RequestID)
+		if err != nil {
+			t.Fatalf("%s: ReadTranscript(%q): %v", entry.Command, entry.RequestID, err)
+		}
+		if entry.Transcript == "" || records[0].Type != "request" || records[1].Type != "ack" {
+			t.Errorf("%s: transcript %q starts with %+v", entry.Command, entry.Transcript, records[:2])
+		}
+		found := false
+		for _, rec := range records {
+			found = found || rec.Type == wantType
+		}
+		if !found || records[len(records)-1].Type != "exit" {
+			t.Errorf("%s: transcript has no %s record or does not end with exit: %+v", entry.Command, wantType, records)
+		}
+	}
+}
 
-	srv, err := warden.NewServer(warden.Config{
-		SocketPath: socketPath,
-		PolicyPath: policyPath,
-		Logger:     logger,
+// TestShimTrailer runs the real shim under a rule that asks for the
+// trailer, and with CLAWRDEN_TRAILER: it follows the command's stderr as
+// the last line.
+func TestShimTrailer(t *testing.T) {
+	armory := buildShim(t)
+	w := wardentest.StartTestWarden(t, wardentest.Options{
+		Policy: &wardentest.Policy{
+			DefaultAction: wardentest.Deny,
+			Jails:         map[string]wardentest.JailConfig{"agent": {Commands: []string{"sh", "rm"}}},
+			Rules:         []wardentest.Rule{{Command: "sh", Action: wardentest.Allow, Trailer: true}},
+		},
+		Armory: armory,
 	})
-	if err != nil {
-		t.Fatalf("create warden: %v", err)
-	}
 
-	go func() {
-		if err := srv.ListenAndServe(); err != nil {
-			// Only log if not a clean shutdown
-			logger.Printf("server error: %v", err)
+	for _, tt := range []struct {
+		args []string
+		env  string // CLAWRDEN_TRAILER
+		want string // Empty for no trailer
+	}{
+		{[]string{"sh", "-c", "echo oops >&2; exit 3"}, "", `^oops\nclawrden: decision=allow outcome=- wait_ms=0 exec_ms=\d+ strategy=local exit=3 request=\S+\n$`},
+		{[]string{"rm", "-rf", "build"}, "1", `\nclawrden: decision=deny outcome=- wait_ms=0 exec_ms=0 strategy=- exit=1 request=\S+\n$`},
+		{[]string{"rm", "-rf", "build"}, "", ""},
+	} {
+		var stderr strings.Builder
+		shim := exec.Command(filepath.Join(w.Dir, "jailhouse", "agent", "bin", tt.args[0]), tt.args[1:]...)
+		shim.Dir = w.Dir
+		shim.Env = []string{"CLAWRDEN_SOCKET=" + w.SocketPath, "PATH=/usr/bin:/bin", "CLAWRDEN_TRAILER=" + tt.env}
+		shim.Stderr = &stderr
+		shim.Run()
+		if tt.want == "" && strings.Contains(stderr.String(), "decision=") {
+			t.Errorf("%s: stderr = %q, want no trailer", tt.args[0], stderr.String())
 		}
-	}()
-
-	return srv
+		if tt.want != "" && !regexp.MustCompile(tt.want).MatchString(stderr.String()) {
+			t.Errorf("%s: stderr = %q, want it to match %s", tt.args[0], stderr.String(), tt.want)
+		}
+	}
 }
 
-func startTestWardenWithPolicy(t *testing.T, socketPath string, _ *warden.PolicyEngine) *warden.Server {
-	t.Helper()
-
-	// Create a temporary policy file with "ask" for echo
-	dir := t.TempDir()
-	policyPath := filepath.Join(dir, "test-policy.yaml")
-	policyContent := `default_action: deny
-rules:
-  - command: echo
-    action: ask
-`
-	os.WriteFile(policyPath, []byte(policyContent), 0644)
-
-	logger := log.New(io.Discard, "[test-warden] ", log.LstdFlags)
-
-	srv, err := warden.NewServer(warden.Config{
-		SocketPath: socketPath,
-		PolicyPath: policyPath,
-		Logger:     logger,
+// TestShimOutputLimit runs the real shim under a rule that limits stdout:
+// the agent sees the start of the output and a notice, and the full output
+// is in the file the notice names.
+func TestShimOutputLimit(t *testing.T) {
+	armory := buildShim(t)
+	w := wardentest.StartTestWarden(t, wardentest.Options{
+		Policy: &wardentest.Policy{
+			DefaultAction: wardentest.Deny,
+			Jails:         map[string]wardentest.JailConfig{"agent": {Commands: []string{"seq"}}},
+			Rules:         []wardentest.Rule{{Command: "seq", Action: wardentest.Allow, MaxStdoutBytes: 1024}},
+		},
+		Armory: armory,
 	})
+
+	spillDir := t.TempDir()
+	shim := exec.Command(filepath.Join(w.Dir, "jailhouse", "agent", "bin", "seq"), "100000")
+	shim.Dir = w.Dir
+	shim.Env = []string{"CLAWRDEN_SOCKET=" + w.SocketPath, "PATH=/usr/bin:/bin", "TMPDIR=" + spillDir}
+	out, err := shim.Output()
 	if err != nil {
-		t.Fatalf("create warden: %v", err)
+		t.Fatalf("shim: %v", err)
 	}
 
-	go func() {
-		srv.ListenAndServe()
-	}()
-
-	return srv
-}
-
-func waitForSocket(t *testing.T, socketPath string) {
-	t.Helper()
-	deadline := time.Now().Add(3 * time.Second)
-	for time.Now().Before(deadline) {
-		conn, err := net.Dial("unix", socketPath)
-		if err == nil {
-			conn.Close()
-			return
-		}
-		time.Sleep(50 * time.Millisecond)
+	head, notice, found := strings.Cut(string(out), "[clawrden: output truncated at 1KB, full output saved to ")
+	if !found || len(head) > 1025 || !strings.HasPrefix(head, "1\n2\n3\n") {
+		t.Fatalf("shim printed %d bytes: %.200q...", len(out), out)
+	}
+	path, _, _ := strings.Cut(notice, " ]")
+	full, err := os.ReadFile(path)
+	if err != nil || filepath.Dir(path) != spillDir || !strings.HasSuffix(string(full), "\n99999\n100000\n") {
+		t.Errorf("spill file %s: %d bytes, %v; want the full output", path, len(full), err)
+	}
+	if entry := w.WaitAudit(t, 1)[0]; entry.ExitCode != 0 || entry.BytesStdout != int64(len(full)) {
+		t.Errorf("audit entry: exit code %d, %d bytes of stdout; want the whole command", entry.ExitCode, entry.BytesStdout)
 	}
-	t.Fatalf("warden socket not ready at %s", socketPath)
 }